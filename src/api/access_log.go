@@ -0,0 +1,454 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// accessUsageType tags the entities holding persisted usage windows
+	accessUsageType = "type:access_usage"
+
+	// accessLogMaxKeys caps how many distinct entities, tags or users one
+	// window tracks, so a scan over a huge dataset cannot grow it unbounded
+	accessLogMaxKeys = 10000
+
+	// accessLogMaxEntitiesPerRequest caps how many result entities of a
+	// single sampled list or query are counted
+	accessLogMaxEntitiesPerRequest = 100
+
+	// accessLogPersistedKeys is how many of the most accessed keys per
+	// category are kept when a window is persisted
+	accessLogPersistedKeys = 1000
+)
+
+// AccessCount is how often a key was seen in sampled reads
+type AccessCount struct {
+	Key      string    `json:"key"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// AccessUsageWindow is one persisted window of sampled reads
+type AccessUsageWindow struct {
+	WindowStart time.Time     `json:"window_start"`
+	WindowEnd   time.Time     `json:"window_end"`
+	SampleRate  float64       `json:"sample_rate"`
+	Samples     int64         `json:"samples"`
+	Entities    []AccessCount `json:"entities"`
+	Tags        []AccessCount `json:"tags"`
+	Users       []AccessCount `json:"users"`
+}
+
+// AccessInsights summarizes sampled reads over the retained windows
+type AccessInsights struct {
+	Enabled               bool          `json:"enabled"`
+	SampleRate            float64       `json:"sample_rate"`
+	WindowSeconds         int64         `json:"window_seconds"`
+	Windows               int           `json:"windows"`
+	From                  time.Time     `json:"from"`
+	To                    time.Time     `json:"to"`
+	Samples               int64         `json:"samples"`
+	EstimatedReads        int64         `json:"estimated_reads"`
+	MostAccessedEntities  []AccessCount `json:"most_accessed_entities"`
+	LeastAccessedEntities []AccessCount `json:"least_accessed_entities"`
+	MostAccessedTags      []AccessCount `json:"most_accessed_tags"`
+	LeastAccessedTags     []AccessCount `json:"least_accessed_tags"`
+	TopUsers              []AccessCount `json:"top_users"`
+}
+
+// accessCounts accumulates counts per key
+type accessCounts map[string]*AccessCount
+
+func (c accessCounts) add(key string, count int64, seen time.Time) {
+	if entry, ok := c[key]; ok {
+		entry.Count += count
+		if seen.After(entry.LastSeen) {
+			entry.LastSeen = seen
+		}
+		return
+	}
+	if len(c) >= accessLogMaxKeys {
+		return
+	}
+	c[key] = &AccessCount{Key: key, Count: count, LastSeen: seen}
+}
+
+// sorted returns the counts ordered from most to least accessed
+func (c accessCounts) sorted() []AccessCount {
+	result := make([]AccessCount, 0, len(c))
+	for _, entry := range c {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// accessWindow is the window currently collecting samples
+type accessWindow struct {
+	start    time.Time
+	samples  int64
+	entities accessCounts
+	tags     accessCounts
+	users    accessCounts
+}
+
+func newAccessWindow(start time.Time) *accessWindow {
+	return &accessWindow{
+		start:    start,
+		entities: make(accessCounts),
+		tags:     make(accessCounts),
+		users:    make(accessCounts),
+	}
+}
+
+// AccessLogger samples entity reads and rolls the counts into usage
+// entities, one per window, so access patterns survive restarts
+type AccessLogger struct {
+	repo       models.EntityRepository
+	sampleRate float64
+	window     time.Duration
+	retained   int
+
+	mu      sync.Mutex
+	current *accessWindow
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// accessLog is the global access logger
+var accessLog *AccessLogger
+
+// InitAccessLog initializes the global access logger and, when sampling is
+// enabled, starts rolling windows into usage entities
+func InitAccessLog(repo models.EntityRepository, cfg *config.Config) {
+	accessLog = NewAccessLogger(repo, cfg.AccessLogSampleRate, cfg.AccessLogWindow, cfg.AccessLogRetainedWindows)
+	accessLog.Start()
+}
+
+// GetAccessLog returns the global access logger
+func GetAccessLog() *AccessLogger {
+	return accessLog
+}
+
+// NewAccessLogger creates an access logger. A sample rate of 0 or less
+// disables sampling; rates above 1 are treated as 1.
+func NewAccessLogger(repo models.EntityRepository, sampleRate float64, window time.Duration, retained int) *AccessLogger {
+	if sampleRate > 1 {
+		sampleRate = 1
+	}
+	if window <= 0 {
+		window = time.Hour
+	}
+	if retained <= 0 {
+		retained = 24
+	}
+	return &AccessLogger{
+		repo:       repo,
+		sampleRate: sampleRate,
+		window:     window,
+		retained:   retained,
+		current:    newAccessWindow(time.Now()),
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// IsEnabled reports whether reads are being sampled
+func (a *AccessLogger) IsEnabled() bool {
+	return a.sampleRate > 0
+}
+
+// Start begins rolling windows in the background
+func (a *AccessLogger) Start() {
+	if !a.IsEnabled() {
+		return
+	}
+	logger.Info("Access log sampling enabled: rate=%.4f, window=%v, retained_windows=%d", a.sampleRate, a.window, a.retained)
+
+	go func() {
+		ticker := time.NewTicker(a.window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.rollWindow()
+			case <-a.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts window rolling and persists the partial current window
+func (a *AccessLogger) Stop() {
+	if !a.IsEnabled() {
+		return
+	}
+	a.stopOnce.Do(func() {
+		close(a.stopCh)
+		a.rollWindow()
+	})
+}
+
+// Record counts one read of the given entities and tags by user if the
+// request is selected by sampling
+func (a *AccessLogger) Record(user string, entityIDs []string, tags []string) {
+	if !a.IsEnabled() || (a.sampleRate < 1 && rand.Float64() >= a.sampleRate) {
+		return
+	}
+
+	now := time.Now()
+	if len(entityIDs) > accessLogMaxEntitiesPerRequest {
+		entityIDs = entityIDs[:accessLogMaxEntitiesPerRequest]
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.current.samples++
+	for _, id := range entityIDs {
+		a.current.entities.add(id, 1, now)
+	}
+	for _, tag := range tags {
+		if tag != "" {
+			a.current.tags.add(tag, 1, now)
+		}
+	}
+	if user != "" {
+		a.current.users.add(user, 1, now)
+	}
+}
+
+// rollWindow starts a new window and persists the finished one
+func (a *AccessLogger) rollWindow() {
+	now := time.Now()
+	a.mu.Lock()
+	finished := a.current
+	a.current = newAccessWindow(now)
+	a.mu.Unlock()
+
+	if finished.samples == 0 {
+		return
+	}
+
+	usage := AccessUsageWindow{
+		WindowStart: finished.start,
+		WindowEnd:   now,
+		SampleRate:  a.sampleRate,
+		Samples:     finished.samples,
+		Entities:    topAccessCounts(finished.entities.sorted(), accessLogPersistedKeys),
+		Tags:        topAccessCounts(finished.tags.sorted(), accessLogPersistedKeys),
+		Users:       topAccessCounts(finished.users.sorted(), accessLogPersistedKeys),
+	}
+	id, err := a.persistWindow(usage)
+	if err != nil {
+		logger.Warn("Failed to persist access usage window: %v", err)
+		return
+	}
+	a.pruneWindows(id)
+}
+
+// persistWindow stores a finished window as a usage entity and returns its ID
+func (a *AccessLogger) persistWindow(usage AccessUsageWindow) (string, error) {
+	content, err := json.Marshal(usage)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode usage window: %w", err)
+	}
+
+	entity := &models.Entity{
+		ID: models.GenerateUUID(),
+		Tags: []string{
+			accessUsageType,
+			"dataset:system",
+			"content:type:application/json",
+			fmt.Sprintf("usage:window_start:%d", usage.WindowStart.Unix()),
+			fmt.Sprintf("usage:window_end:%d", usage.WindowEnd.Unix()),
+			fmt.Sprintf("usage:samples:%d", usage.Samples),
+			"usage:sample_rate:" + strconv.FormatFloat(usage.SampleRate, 'f', -1, 64),
+		},
+		Content: content,
+	}
+	if err := a.repo.Create(entity); err != nil {
+		return "", err
+	}
+	logger.Debug("Persisted access usage window %s: samples=%d, entities=%d, tags=%d",
+		entity.ID, usage.Samples, len(usage.Entities), len(usage.Tags))
+	return entity.ID, nil
+}
+
+// usageWindowEntities returns the persisted usage entities, newest first
+func (a *AccessLogger) usageWindowEntities() ([]*models.Entity, error) {
+	entities, err := a.repo.ListByTag(accessUsageType)
+	if err != nil {
+		return nil, err
+	}
+	starts := make(map[string]int64, len(entities))
+	for _, entity := range entities {
+		for _, tag := range entity.GetTagsWithoutTimestamp() {
+			if value := strings.TrimPrefix(tag, "usage:window_start:"); value != tag {
+				starts[entity.ID], _ = strconv.ParseInt(value, 10, 64)
+				break
+			}
+		}
+	}
+	sort.Slice(entities, func(i, j int) bool {
+		return starts[entities[i].ID] > starts[entities[j].ID]
+	})
+	return entities, nil
+}
+
+// pruneWindows deletes persisted windows beyond the retained count. The
+// window just written is passed in as newest because batched writes may not
+// be visible to tag lookups yet.
+func (a *AccessLogger) pruneWindows(newestID string) {
+	entities, err := a.usageWindowEntities()
+	if err != nil {
+		logger.Warn("Failed to list access usage windows: %v", err)
+		return
+	}
+	kept := 1
+	for _, entity := range entities {
+		if entity.ID == newestID {
+			continue
+		}
+		if kept < a.retained {
+			kept++
+			continue
+		}
+		if err := a.repo.Delete(entity.ID); err != nil {
+			logger.Warn("Failed to delete access usage window %s: %v", entity.ID, err)
+		}
+	}
+}
+
+// Insights aggregates the retained windows and the current one and returns
+// up to limit of the most and least accessed keys per category. Least
+// accessed only covers keys that were sampled at least once.
+func (a *AccessLogger) Insights(limit int) (*AccessInsights, error) {
+	entities, err := a.usageWindowEntities()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage windows: %w", err)
+	}
+
+	insights := &AccessInsights{
+		Enabled:       a.IsEnabled(),
+		SampleRate:    a.sampleRate,
+		WindowSeconds: int64(a.window / time.Second),
+	}
+	entityCounts := make(accessCounts)
+	tagCounts := make(accessCounts)
+	userCounts := make(accessCounts)
+	var estimated float64
+
+	merge := func(usage AccessUsageWindow) {
+		insights.Windows++
+		insights.Samples += usage.Samples
+		if usage.SampleRate > 0 {
+			estimated += float64(usage.Samples) / usage.SampleRate
+		}
+		if insights.From.IsZero() || usage.WindowStart.Before(insights.From) {
+			insights.From = usage.WindowStart
+		}
+		if usage.WindowEnd.After(insights.To) {
+			insights.To = usage.WindowEnd
+		}
+		for _, c := range usage.Entities {
+			entityCounts.add(c.Key, c.Count, c.LastSeen)
+		}
+		for _, c := range usage.Tags {
+			tagCounts.add(c.Key, c.Count, c.LastSeen)
+		}
+		for _, c := range usage.Users {
+			userCounts.add(c.Key, c.Count, c.LastSeen)
+		}
+	}
+
+	for i, entity := range entities {
+		if i >= a.retained {
+			break
+		}
+		var usage AccessUsageWindow
+		if err := json.Unmarshal(entity.Content, &usage); err != nil {
+			logger.Warn("Skipping unreadable access usage window %s: %v", entity.ID, err)
+			continue
+		}
+		merge(usage)
+	}
+
+	a.mu.Lock()
+	if a.current.samples > 0 {
+		merge(AccessUsageWindow{
+			WindowStart: a.current.start,
+			WindowEnd:   time.Now(),
+			SampleRate:  a.sampleRate,
+			Samples:     a.current.samples,
+			Entities:    a.current.entities.sorted(),
+			Tags:        a.current.tags.sorted(),
+			Users:       a.current.users.sorted(),
+		})
+	}
+	a.mu.Unlock()
+
+	insights.EstimatedReads = int64(estimated)
+	sortedEntities := entityCounts.sorted()
+	sortedTags := tagCounts.sorted()
+	insights.MostAccessedEntities = topAccessCounts(sortedEntities, limit)
+	insights.LeastAccessedEntities = bottomAccessCounts(sortedEntities, limit)
+	insights.MostAccessedTags = topAccessCounts(sortedTags, limit)
+	insights.LeastAccessedTags = bottomAccessCounts(sortedTags, limit)
+	insights.TopUsers = topAccessCounts(userCounts.sorted(), limit)
+	return insights, nil
+}
+
+// topAccessCounts returns the first limit entries of sorted counts
+func topAccessCounts(sorted []AccessCount, limit int) []AccessCount {
+	if limit < len(sorted) {
+		sorted = sorted[:limit]
+	}
+	return append([]AccessCount{}, sorted...)
+}
+
+// bottomAccessCounts returns the last limit entries of sorted counts, least accessed first
+func bottomAccessCounts(sorted []AccessCount, limit int) []AccessCount {
+	result := make([]AccessCount, 0, limit)
+	for i := len(sorted) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, sorted[i])
+	}
+	return result
+}
+
+// recordEntityAccess samples a read of entities matched through tags
+func recordEntityAccess(r *http.Request, entities []*models.Entity, tags []string) {
+	if accessLog == nil || !accessLog.IsEnabled() {
+		return
+	}
+	user := ""
+	if securityCtx, ok := GetSecurityContext(r); ok && securityCtx.User != nil {
+		user = securityCtx.User.Username
+		if user == "" {
+			user = securityCtx.User.ID
+		}
+	}
+	ids := make([]string, 0, len(entities))
+	for _, entity := range entities {
+		if entity != nil {
+			ids = append(ids, entity.ID)
+		}
+	}
+	accessLog.Record(user, ids, tags)
+}
@@ -2,24 +2,33 @@ package api
 
 import (
 	"encoding/json"
+	"entitydb/cache"
 	"entitydb/logger"
 	"entitydb/models"
+	"entitydb/storage/binary"
+	"fmt"
 	"net/http"
-	"time"
+	"strconv"
 )
 
 // AdminHandler handles administrative operations
 type AdminHandler struct {
 	repo models.EntityRepository
+	jobs *JobManager
 }
 
-// NewAdminHandler creates a new admin handler
-func NewAdminHandler(repo models.EntityRepository) *AdminHandler {
+// NewAdminHandler creates a new admin handler submitting heavy operations
+// to the job manager
+func NewAdminHandler(repo models.EntityRepository, jobs *JobManager) *AdminHandler {
 	return &AdminHandler{
 		repo: repo,
+		jobs: jobs,
 	}
 }
 
+// reindexJobType identifies index rebuild jobs
+const reindexJobType = "reindex"
+
 // ReindexRequest represents a request to reindex the database
 type ReindexRequest struct {
 	Force bool `json:"force"` // Force reindex even if healthy
@@ -29,18 +38,17 @@ type ReindexRequest struct {
 type ReindexResponse struct {
 	Success        bool   `json:"success"`
 	Message        string `json:"message"`
-	EntitiesIndexed int    `json:"entities_indexed"`
-	Duration       string `json:"duration"`
+	JobID          string `json:"job_id,omitempty"`
+	StatusURL      string `json:"status_url,omitempty"`
+	EntitiesIndexed int    `json:"entities_indexed,omitempty"`
+	Duration       string `json:"duration,omitempty"`
 	Errors         []string `json:"errors,omitempty"`
 }
 
-// ReindexHandler handles the reindex request
+// ReindexHandler queues an index rebuild job and returns its ID.
+// The rebuild runs on a copy of the indexes so reads stay available;
+// progress is reported by GET /api/v1/jobs/{id}.
 func (h *AdminHandler) ReindexHandler(w http.ResponseWriter, r *http.Request) {
-	// This should be wrapped with RBAC middleware requiring admin permission
-	// For now, we'll add a basic check
-	
-	start := time.Now()
-	
 	// Decode request
 	var req ReindexRequest
 	if r.Body != nil {
@@ -49,34 +57,230 @@ func (h *AdminHandler) ReindexHandler(w http.ResponseWriter, r *http.Request) {
 	
 	logger.Info("admin reindex requested with force=%v", req.Force)
 	
-	// Call the repository's reindex method
-	if reindexer, ok := h.repo.(interface{ ReindexTags() error }); ok {
-		err := reindexer.ReindexTags()
-		if err != nil {
-			logger.Error("reindex failed: %v", err)
-			RespondJSON(w, http.StatusInternalServerError, ReindexResponse{
-				Success: false,
-				Message: "Reindex failed",
-				Errors:  []string{err.Error()},
-			})
-			return
-		}
-		
-		// Get entity count
-		entities, _ := h.repo.List()
-		
-		RespondJSON(w, http.StatusOK, ReindexResponse{
-			Success:         true,
-			Message:         "Reindex completed successfully",
-			EntitiesIndexed: len(entities),
-			Duration:        time.Since(start).String(),
-		})
-	} else {
+	rebuilder, err := asTemporalRepository(h.repo)
+	if err != nil {
 		RespondJSON(w, http.StatusNotImplemented, ReindexResponse{
 			Success: false,
 			Message: "Repository does not support reindexing",
 		})
+		return
 	}
+	
+	if active, ok := h.jobs.Active(reindexJobType); ok {
+		id := active.Status().ID
+		RespondJSON(w, http.StatusConflict, ReindexResponse{
+			Success:   false,
+			Message:   "Reindex already in progress",
+			JobID:     id,
+			StatusURL: "/api/v1/jobs/" + id,
+		})
+		return
+	}
+	
+	job, err := h.jobs.Submit(reindexJobType, requestUserID(r), func(job *Job) error {
+		return rebuilder.RebuildIndexesOnline(func(processed, total int, entityID string, err error) {
+			if err != nil {
+				job.AddError(fmt.Errorf("%s: %w", entityID, err))
+			}
+			job.SetProgress(int64(processed), int64(total))
+		})
+	})
+	if err != nil {
+		RespondJSON(w, http.StatusServiceUnavailable, ReindexResponse{
+			Success: false,
+			Message: "Failed to queue reindex: " + err.Error(),
+		})
+		return
+	}
+	id := job.Status().ID
+	
+	logger.Info("admin reindex queued as job %s", id)
+	RespondJSON(w, http.StatusAccepted, ReindexResponse{
+		Success:   true,
+		Message:   "Reindex queued",
+		JobID:     id,
+		StatusURL: "/api/v1/jobs/" + id,
+	})
+}
+
+// StartupReport returns what happened while the server initialized: WAL
+// replay, entities loaded, index source, migrations, recovery actions and
+// per-phase timings
+func (h *AdminHandler) StartupReport(w http.ResponseWriter, r *http.Request) {
+	RespondJSON(w, http.StatusOK, binary.GetStartupReport().Snapshot())
+}
+
+// AccessInsights returns the most and least accessed entities and tags, and
+// the most active users, from sampled reads over the retained usage windows
+func (h *AdminHandler) AccessInsights(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			RespondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+
+	accessLogger := GetAccessLog()
+	if accessLogger == nil {
+		RespondError(w, http.StatusServiceUnavailable, "Access log not initialized")
+		return
+	}
+
+	insights, err := accessLogger.Insights(limit)
+	if err != nil {
+		logger.Error("Failed to build access insights: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to build access insights")
+		return
+	}
+	RespondJSON(w, http.StatusOK, insights)
+}
+
+// SlowQueries returns the requests that exceeded the slow query threshold,
+// slowest first, with the index lookups, entities fetched, bytes read and
+// lock wait time of each
+func (h *AdminHandler) SlowQueries(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			RespondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+
+	slowLog := GetSlowQueryLog()
+	if slowLog == nil {
+		RespondError(w, http.StatusServiceUnavailable, "Slow query log not initialized")
+		return
+	}
+	RespondJSON(w, http.StatusOK, slowLog.Status(limit))
+}
+
+// StorageStats returns the sizes of the data, WAL and index files, the
+// entity count and average entity size, the bytes compaction would reclaim
+// and the sections of the unified header, for capacity planning
+func (h *AdminHandler) StorageStats(w http.ResponseWriter, r *http.Request) {
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Storage statistics not supported by this repository")
+		return
+	}
+	stats, err := binaryRepo.StorageStats()
+	if err != nil {
+		logger.Error("Failed to read storage statistics: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to read storage statistics")
+		return
+	}
+	RespondJSON(w, http.StatusOK, stats)
+}
+
+// IndexShards returns the tag count, posting count and approximate memory of
+// each shard of the tag index
+func (h *AdminHandler) IndexShards(w http.ResponseWriter, r *http.Request) {
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Index introspection not supported by this repository")
+		return
+	}
+	RespondJSON(w, http.StatusOK, binaryRepo.TagIndexShardStats())
+}
+
+// CacheStatsResponse reports the query result cache and the entity cache of
+// each repository layer
+type CacheStatsResponse struct {
+	QueryCache   cache.QueryCacheStats        `json:"query_cache"`
+	EntityCaches map[string]binary.CacheStats `json:"entity_caches"`
+}
+
+// CacheStats returns the entries, hit rate and evictions of the query result
+// cache and the entity caches
+func (h *AdminHandler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Cache introspection not supported by this repository")
+		return
+	}
+	response := CacheStatsResponse{
+		QueryCache:   binaryRepo.QueryCacheStats(),
+		EntityCaches: map[string]binary.CacheStats{"storage": binaryRepo.EntityCacheStats()},
+	}
+	if cachedRepo, ok := h.repo.(*binary.CachedRepository); ok {
+		response.EntityCaches["query"] = cachedRepo.EntityCacheStats()
+	}
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// PoolStats returns the size and borrow counters of the reader pool and the
+// use of the shared buffer pools
+func (h *AdminHandler) PoolStats(w http.ResponseWriter, r *http.Request) {
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Pool introspection not supported by this repository")
+		return
+	}
+	RespondJSON(w, http.StatusOK, binaryRepo.PoolStats())
+}
+
+// PinRequest names an entity to pin in or unpin from memory
+type PinRequest struct {
+	ID string `json:"id"`
+}
+
+// GetPinnedEntities reports the entities pinned in memory and their size
+func (h *AdminHandler) GetPinnedEntities(w http.ResponseWriter, r *http.Request) {
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Entity pinning not supported by this repository")
+		return
+	}
+	RespondJSON(w, http.StatusOK, binaryRepo.PinnedEntities())
+}
+
+// PinEntity keeps an entity in memory, never evicted, until it is unpinned or
+// the server restarts
+func (h *AdminHandler) PinEntity(w http.ResponseWriter, r *http.Request) {
+	h.setPinned(w, r, true)
+}
+
+// UnpinEntity removes a pin set by PinEntity
+func (h *AdminHandler) UnpinEntity(w http.ResponseWriter, r *http.Request) {
+	h.setPinned(w, r, false)
+}
+
+// setPinned pins or unpins the entity named in the request body
+func (h *AdminHandler) setPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	var req PinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		RespondError(w, http.StatusBadRequest, "Request body must contain an entity id")
+		return
+	}
+	
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Entity pinning not supported by this repository")
+		return
+	}
+	
+	if pinned {
+		if err := binaryRepo.PinEntity(req.ID); err != nil {
+			RespondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		logger.Info("Pinned entity %s in memory", req.ID)
+	} else {
+		binaryRepo.UnpinEntity(req.ID)
+		logger.Info("Unpinned entity %s", req.ID)
+	}
+	
+	RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"id":     req.ID,
+		"pinned": pinned,
+		"stats":  binaryRepo.PinnedEntities(),
+	})
 }
 
 // HealthCheckHandler provides detailed health information including index health
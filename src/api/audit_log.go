@@ -0,0 +1,748 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// auditEventType tags the entities holding audit events
+	auditEventType = "type:audit_event"
+
+	// auditQueueSize is how many events wait for the background writer
+	// before requests write their events themselves
+	auditQueueSize = 1024
+
+	// auditMaxBodyBytes bounds how much of a request body is inspected for
+	// the target entity ID
+	auditMaxBodyBytes = 1 << 20
+
+	// auditMaxResponseBytes bounds how much of a response body is kept to
+	// find the ID of a created entity
+	auditMaxResponseBytes = 64 << 10
+
+	// defaultAuditQueryLimit and maxAuditQueryLimit bound audit queries
+	defaultAuditQueryLimit = 100
+	maxAuditQueryLimit     = 1000
+)
+
+// Audit actions
+const (
+	AuditActionCreate     = "create"
+	AuditActionUpdate     = "update"
+	AuditActionDelete     = "delete"
+	AuditActionTag        = "tag"
+	AuditActionPermission = "permission"
+	AuditActionAdmin      = "admin"
+)
+
+// auditEntityPath matches entity routes that carry the entity ID in the path
+var auditEntityPath = regexp.MustCompile(`^/api/v1/entities/([^/]+)/(delete|restore|purge)$`)
+
+// AuditDiff describes how an operation changed its target entity. Tags are
+// compared without timestamps.
+type AuditDiff struct {
+	AddedTags         []string `json:"added_tags,omitempty"`
+	RemovedTags       []string `json:"removed_tags,omitempty"`
+	ContentChanged    bool     `json:"content_changed,omitempty"`
+	ContentSizeBefore int      `json:"content_size_before,omitempty"`
+	ContentSizeAfter  int      `json:"content_size_after,omitempty"`
+}
+
+// AuditEvent records one mutating API operation
+type AuditEvent struct {
+	ID        string     `json:"id,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
+	Actor     string     `json:"actor"`
+	ActorID   string     `json:"actor_id,omitempty"`
+	IP        string     `json:"ip"`
+	Protocol  string     `json:"protocol"`
+	Method    string     `json:"method"`
+	Endpoint  string     `json:"endpoint"`
+	Action    string     `json:"action"`
+	EntityID  string     `json:"entity_id,omitempty"`
+	Status    int        `json:"status"`
+	Success   bool       `json:"success"`
+	Diff      *AuditDiff `json:"diff,omitempty"`
+}
+
+// AuditQuery filters audit events
+type AuditQuery struct {
+	Actor    string
+	Action   string
+	EntityID string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// auditSnapshot is the state of an entity before an operation. It is copied
+// because handlers may change cached entities in place.
+type auditSnapshot struct {
+	tags        []string
+	contentSize int
+	contentHash [32]byte
+}
+
+func snapshotEntity(entity *models.Entity) *auditSnapshot {
+	if entity == nil || entity.IsRecoveryPlaceholder() {
+		return nil
+	}
+	return &auditSnapshot{
+		tags:        append([]string(nil), entity.GetTagsWithoutTimestamp()...),
+		contentSize: len(entity.Content),
+		contentHash: sha256.Sum256(entity.Content),
+	}
+}
+
+// diffSnapshots compares the states of an entity before and after an
+// operation; either may be nil
+func diffSnapshots(before, after *auditSnapshot) *AuditDiff {
+	if before == nil && after == nil {
+		return nil
+	}
+	if before == nil {
+		before = &auditSnapshot{contentHash: sha256.Sum256(nil)}
+	}
+	if after == nil {
+		after = &auditSnapshot{contentHash: sha256.Sum256(nil)}
+	}
+
+	counts := make(map[string]int)
+	for _, tag := range before.tags {
+		counts[tag]--
+	}
+	for _, tag := range after.tags {
+		counts[tag]++
+	}
+	diff := &AuditDiff{}
+	for tag, count := range counts {
+		switch {
+		case count > 0:
+			diff.AddedTags = append(diff.AddedTags, tag)
+		case count < 0:
+			diff.RemovedTags = append(diff.RemovedTags, tag)
+		}
+	}
+	sort.Strings(diff.AddedTags)
+	sort.Strings(diff.RemovedTags)
+
+	if before.contentHash != after.contentHash {
+		diff.ContentChanged = true
+		diff.ContentSizeBefore = before.contentSize
+		diff.ContentSizeAfter = after.contentSize
+	}
+	return diff
+}
+
+// touchesPermissions reports whether a diff changes RBAC tags
+func (d *AuditDiff) touchesPermissions() bool {
+	if d == nil {
+		return false
+	}
+	for _, tag := range append(append([]string{}, d.AddedTags...), d.RemovedTags...) {
+		if strings.HasPrefix(tag, "rbac:") {
+			return true
+		}
+	}
+	return false
+}
+
+// auditRecord collects an event while its request is handled. The security
+// middleware fills in the actor once the caller is authenticated.
+type auditRecord struct {
+	event  AuditEvent
+	before *auditSnapshot
+}
+
+// auditRecordKey is the context key of the request's audit record
+type auditRecordKey struct{}
+
+// noteAuditActor records the authenticated user of a request being audited
+func noteAuditActor(ctx context.Context, user *models.SecurityUser) {
+	if record, ok := ctx.Value(auditRecordKey{}).(*auditRecord); ok && user != nil {
+		record.event.Actor = user.Username
+		record.event.ActorID = user.ID
+	}
+}
+
+// AuditLogger records mutating API operations as immutable audit entities
+// and mirrors them to a JSON lines file and syslog when configured
+type AuditLogger struct {
+	repo    models.EntityRepository
+	enabled bool
+
+	queue    chan *AuditEvent
+	done     chan struct{}
+	stopOnce sync.Once
+
+	exportMu sync.Mutex
+	file     *os.File
+	syslog   *syslog.Writer
+}
+
+// auditLog is the global audit logger
+var auditLog *AuditLogger
+
+// InitAuditLog initializes the global audit logger and starts its writer
+func InitAuditLog(repo models.EntityRepository, cfg *config.Config) error {
+	audit, err := NewAuditLogger(repo, cfg.AuditEnabled, cfg.AuditLogFile, cfg.AuditSyslog)
+	if err != nil {
+		return err
+	}
+	auditLog = audit
+	auditLog.Start()
+	return nil
+}
+
+// GetAuditLog returns the global audit logger
+func GetAuditLog() *AuditLogger {
+	return auditLog
+}
+
+// NewAuditLogger creates an audit logger. Events are mirrored to logFile
+// and to the syslog destination when they are not empty.
+func NewAuditLogger(repo models.EntityRepository, enabled bool, logFile, syslogTarget string) (*AuditLogger, error) {
+	a := &AuditLogger{
+		repo:    repo,
+		enabled: enabled,
+		queue:   make(chan *AuditEvent, auditQueueSize),
+		done:    make(chan struct{}),
+	}
+	if !enabled {
+		return a, nil
+	}
+
+	if logFile != "" {
+		file, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log file: %w", err)
+		}
+		a.file = file
+	}
+	if syslogTarget != "" {
+		writer, err := dialAuditSyslog(syslogTarget)
+		if err != nil {
+			a.closeExports()
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		a.syslog = writer
+	}
+	return a, nil
+}
+
+// dialAuditSyslog connects to "local" or a udp:// or tcp:// syslog address
+func dialAuditSyslog(target string) (*syslog.Writer, error) {
+	const priority = syslog.LOG_NOTICE | syslog.LOG_AUTH
+	if target == "local" {
+		return syslog.New(priority, "entitydb-audit")
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "udp" && parsed.Scheme != "tcp") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid syslog destination %q", target)
+	}
+	return syslog.Dial(parsed.Scheme, parsed.Host, priority, "entitydb-audit")
+}
+
+// IsEnabled reports whether operations are audited
+func (a *AuditLogger) IsEnabled() bool {
+	return a != nil && a.enabled
+}
+
+// Start begins writing queued events in the background
+func (a *AuditLogger) Start() {
+	if !a.enabled {
+		close(a.done)
+		return
+	}
+	logger.Info("Audit log enabled (file: %q, syslog: %q)", a.fileName(), a.syslogTarget())
+
+	go func() {
+		defer close(a.done)
+		for event := range a.queue {
+			a.write(event)
+		}
+	}()
+}
+
+// Stop writes the queued events and closes the exports
+func (a *AuditLogger) Stop() {
+	a.stopOnce.Do(func() {
+		if a.enabled {
+			close(a.queue)
+		}
+		<-a.done
+		a.closeExports()
+	})
+}
+
+func (a *AuditLogger) fileName() string {
+	if a.file == nil {
+		return ""
+	}
+	return a.file.Name()
+}
+
+func (a *AuditLogger) syslogTarget() string {
+	if a.syslog == nil {
+		return ""
+	}
+	return "connected"
+}
+
+func (a *AuditLogger) closeExports() {
+	a.exportMu.Lock()
+	defer a.exportMu.Unlock()
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+	if a.syslog != nil {
+		a.syslog.Close()
+		a.syslog = nil
+	}
+}
+
+// Record queues an event. Events are never dropped: when the queue is full
+// the caller writes the event itself.
+func (a *AuditLogger) Record(event *AuditEvent) {
+	if !a.IsEnabled() {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	defer func() {
+		// The queue is closed during shutdown
+		if recover() != nil {
+			a.write(event)
+		}
+	}()
+	select {
+	case a.queue <- event:
+	default:
+		a.write(event)
+	}
+}
+
+// write persists an event as an audit entity and exports it
+func (a *AuditLogger) write(event *AuditEvent) {
+	event.ID = models.GenerateUUID()
+	content, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to encode audit event: %v", err)
+		return
+	}
+
+	tags := []string{
+		auditEventType,
+		"dataset:system",
+		"content:type:application/json",
+		"audit:action:" + event.Action,
+		"audit:protocol:" + strings.ToLower(event.Protocol),
+		"audit:status:" + strconv.Itoa(event.Status),
+	}
+	if event.Actor != "" {
+		tags = append(tags, "audit:actor:"+event.Actor)
+	}
+	if event.EntityID != "" {
+		tags = append(tags, "audit:entity:"+event.EntityID)
+	}
+	entity := &models.Entity{ID: event.ID, Tags: tags, Content: content}
+	if err := a.repo.Create(entity); err != nil {
+		logger.Error("Failed to persist audit event for %s %s by %s: %v", event.Method, event.Endpoint, event.Actor, err)
+	}
+
+	a.exportMu.Lock()
+	defer a.exportMu.Unlock()
+	if a.file != nil {
+		if _, err := a.file.Write(append(content, '\n')); err != nil {
+			logger.Warn("Failed to write audit log file: %v", err)
+		}
+	}
+	if a.syslog != nil {
+		if err := a.syslog.Notice(string(content)); err != nil {
+			logger.Warn("Failed to send audit event to syslog: %v", err)
+		}
+	}
+}
+
+// auditedRequest reports whether a request mutates state and is audited.
+// Session handling under /auth is not audited.
+func auditedRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	// Login and session calls are not audited, but changes to a user's second
+	// factor are
+	if strings.HasPrefix(r.URL.Path, "/api/v1/auth/") {
+		return strings.HasPrefix(r.URL.Path, "/api/v1/auth/mfa/")
+	}
+	return strings.HasPrefix(r.URL.Path, "/api/v1/")
+}
+
+// auditAction classifies a REST operation by its method and path
+func auditAction(method, path string) string {
+	switch {
+	case strings.HasPrefix(path, "/api/v1/users/") || strings.HasPrefix(path, "/api/v1/auth/mfa/") || strings.Contains(path, "/rbac"):
+		return AuditActionPermission
+	case method == http.MethodDelete || strings.HasSuffix(path, "/delete") || strings.HasSuffix(path, "/purge"):
+		return AuditActionDelete
+	case strings.Contains(path, "tag"):
+		return AuditActionTag
+	case strings.HasSuffix(path, "/create") || (method == http.MethodPost && path == "/api/v1/datasets"):
+		return AuditActionCreate
+	case strings.HasPrefix(path, "/api/v1/admin/") || strings.HasPrefix(path, "/api/v1/config") || strings.HasPrefix(path, "/api/v1/feature-flags"):
+		return AuditActionAdmin
+	}
+	return AuditActionUpdate
+}
+
+// auditTargetID finds the entity a request operates on: in the path, the
+// id query parameter or the id or entity_id field of a JSON body
+func auditTargetID(r *http.Request, body []byte) string {
+	if match := auditEntityPath.FindStringSubmatch(r.URL.Path); match != nil {
+		return match[1]
+	}
+	if id := r.URL.Query().Get("id"); id != "" {
+		return id
+	}
+	var fields struct {
+		ID       string `json:"id"`
+		EntityID string `json:"entity_id"`
+	}
+	if len(body) > 0 && json.Unmarshal(body, &fields) == nil {
+		if fields.ID != "" {
+			return fields.ID
+		}
+		return fields.EntityID
+	}
+	return ""
+}
+
+// auditResponseWriter captures the status and the start of the response body
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if room := auditMaxResponseBytes - w.body.Len(); room > 0 {
+		if len(data) < room {
+			room = len(data)
+		}
+		w.body.Write(data[:room])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Middleware audits mutating REST requests. It snapshots the target entity
+// before the request and diffs it afterwards, and rejects changes to audit
+// events so they stay immutable.
+func (a *AuditLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.IsEnabled() || !auditedRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Inspect the start of the body and hand the full body on unchanged
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, auditMaxBodyBytes))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			if len(body) == auditMaxBodyBytes {
+				body = nil
+			}
+		}
+
+		record := &auditRecord{event: AuditEvent{
+			Protocol: "HTTP",
+			IP:       getClientIP(r),
+			Method:   r.Method,
+			Endpoint: r.URL.Path,
+			Action:   auditAction(r.Method, r.URL.Path),
+			EntityID: auditTargetID(r, body),
+		}}
+		if record.event.EntityID != "" {
+			if entity, err := a.repo.GetByID(record.event.EntityID); err == nil && entity != nil {
+				if entity.HasTag(auditEventType) {
+					RespondError(w, http.StatusForbidden, "Audit events are immutable")
+					return
+				}
+				record.before = snapshotEntity(entity)
+			}
+		}
+
+		recorder := &auditResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), auditRecordKey{}, record)))
+
+		event := &record.event
+		event.Status = recorder.status
+		if event.Status == 0 {
+			event.Status = http.StatusOK
+		}
+		event.Success = event.Status < 400
+
+		// Requests that never authenticated were rejected or unrouted
+		// before reaching a handler
+		if event.Actor == "" {
+			return
+		}
+
+		if event.Success {
+			if event.EntityID == "" {
+				event.EntityID = createdEntityID(recorder.body.Bytes())
+			}
+			if event.EntityID != "" {
+				var after *auditSnapshot
+				if entity, err := a.repo.GetByID(event.EntityID); err == nil {
+					after = snapshotEntity(entity)
+				}
+				event.Diff = diffSnapshots(record.before, after)
+				if event.Diff.touchesPermissions() {
+					event.Action = AuditActionPermission
+				}
+			}
+		}
+		a.Record(event)
+	})
+}
+
+// BeginCall starts auditing a gRPC call on entityID, which is empty for
+// creates. The returned function records the event once the call finishes,
+// given the ID of a created entity and the call's error.
+func (a *AuditLogger) BeginCall(ctx context.Context, method, action, entityID string) func(createdID string, err error) {
+	if !a.IsEnabled() {
+		return func(string, error) {}
+	}
+
+	event := &AuditEvent{
+		Protocol: "GRPC",
+		Method:   "POST",
+		Endpoint: method,
+		Action:   action,
+		EntityID: entityID,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			event.IP = host
+		} else {
+			event.IP = p.Addr.String()
+		}
+	}
+	if securityCtx, ok := ctx.Value(securityContextKey{}).(*SecurityContext); ok && securityCtx.User != nil {
+		event.Actor = securityCtx.User.Username
+		event.ActorID = securityCtx.User.ID
+	}
+
+	var before *auditSnapshot
+	if entityID != "" {
+		if entity, err := a.repo.GetByID(entityID); err == nil {
+			before = snapshotEntity(entity)
+		}
+	}
+
+	return func(createdID string, err error) {
+		event.Status = int(status.Code(err))
+		event.Success = err == nil
+		if event.EntityID == "" {
+			event.EntityID = createdID
+		}
+		if event.Success && event.EntityID != "" {
+			var after *auditSnapshot
+			if entity, err := a.repo.GetByID(event.EntityID); err == nil {
+				after = snapshotEntity(entity)
+			}
+			event.Diff = diffSnapshots(before, after)
+			if event.Diff.touchesPermissions() {
+				event.Action = AuditActionPermission
+			}
+		}
+		a.Record(event)
+	}
+}
+
+// createdEntityID returns the id field of a JSON response, unwrapping the
+// data envelope some handlers use
+func createdEntityID(response []byte) string {
+	var envelope struct {
+		ID   string `json:"id"`
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(response, &envelope) != nil {
+		return ""
+	}
+	if envelope.ID != "" {
+		return envelope.ID
+	}
+	return envelope.Data.ID
+}
+
+// Query returns audit events matching q, newest first
+func (a *AuditLogger) Query(q AuditQuery) ([]*AuditEvent, error) {
+	// Narrow the candidates with the most selective indexed filter
+	tag := auditEventType
+	switch {
+	case q.EntityID != "":
+		tag = "audit:entity:" + q.EntityID
+	case q.Actor != "":
+		tag = "audit:actor:" + q.Actor
+	case q.Action != "":
+		tag = "audit:action:" + q.Action
+	}
+	entities, err := a.repo.ListByTag(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*AuditEvent, 0, len(entities))
+	for _, entity := range entities {
+		if !entity.HasTag(auditEventType) {
+			continue
+		}
+		event := &AuditEvent{}
+		if err := json.Unmarshal(entity.Content, event); err != nil {
+			logger.Warn("Skipping unreadable audit event %s: %v", entity.ID, err)
+			continue
+		}
+		if (q.Actor != "" && event.Actor != q.Actor) ||
+			(q.Action != "" && event.Action != q.Action) ||
+			(q.EntityID != "" && event.EntityID != q.EntityID) ||
+			(!q.From.IsZero() && event.Timestamp.Before(q.From)) ||
+			(!q.To.IsZero() && event.Timestamp.After(q.To)) {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Timestamp.After(events[j].Timestamp)
+	})
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[:q.Limit]
+	}
+	return events, nil
+}
+
+// AuditHandler serves the global audit log
+type AuditHandler struct{}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler() *AuditHandler {
+	return &AuditHandler{}
+}
+
+// AuditResponse lists audit events
+type AuditResponse struct {
+	Enabled bool          `json:"enabled"`
+	Count   int           `json:"count"`
+	Events  []*AuditEvent `json:"events"`
+}
+
+// QueryAudit returns audit events, newest first
+// @Summary Query the audit log
+// @Description List recorded mutating operations with actor, client IP, endpoint, status and the change to the target entity
+// @Tags admin
+// @Produce json
+// @Param actor query string false "Username of the actor"
+// @Param action query string false "create, update, delete, tag, permission or admin"
+// @Param entity_id query string false "Target entity ID"
+// @Param from query string false "Earliest event time (RFC3339)"
+// @Param to query string false "Latest event time (RFC3339)"
+// @Param limit query int false "Maximum events (default 100, max 1000)"
+// @Success 200 {object} AuditResponse
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/audit [get]
+func (h *AuditHandler) QueryAudit(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := AuditQuery{
+		Actor:    params.Get("actor"),
+		Action:   params.Get("action"),
+		EntityID: params.Get("entity_id"),
+		Limit:    defaultAuditQueryLimit,
+	}
+	for name, target := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if value := params.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				RespondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s time, expected RFC3339", name))
+				return
+			}
+			*target = parsed
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			RespondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		if limit > maxAuditQueryLimit {
+			limit = maxAuditQueryLimit
+		}
+		q.Limit = limit
+	}
+
+	audit := GetAuditLog()
+	if audit == nil {
+		RespondError(w, http.StatusServiceUnavailable, "Audit log is not initialized")
+		return
+	}
+	events, err := audit.Query(q)
+	if err != nil {
+		logger.Error("Failed to query audit log: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to query audit log")
+		return
+	}
+	RespondJSON(w, http.StatusOK, AuditResponse{
+		Enabled: audit.IsEnabled(),
+		Count:   len(events),
+		Events:  events,
+	})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestAuditLogMiddleware checks that authenticated mutating requests are
+// recorded with their actor and target, that requests refused before
+// authentication are not, that only users with audit:view can query the
+// log, and that audit events cannot be changed through the API
+func TestAuditLogMiddleware(t *testing.T) {
+	security := newTestSecurity(t)
+	audit, err := NewAuditLogger(security.repo, true, "", "")
+	if err != nil {
+		t.Fatalf("NewAuditLogger: %v", err)
+	}
+	audit.Start()
+	previous := auditLog
+	auditLog = audit
+	t.Cleanup(func() { auditLog = previous })
+
+	entities := NewEntityHandler(security.repo)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/entities/create", security.middleware.RequirePermission("entity", "create")(entities.CreateEntity)).Methods("POST")
+	router.HandleFunc("/api/v1/entities/update", security.middleware.RequirePermission("entity", "update")(entities.UpdateEntity)).Methods("PUT")
+	router.HandleFunc("/api/v1/audit", security.middleware.RequirePermission("audit", "view")(NewAuditHandler().QueryAudit)).Methods("GET")
+	handler := audit.Middleware(router)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	_, adminToken := security.login(t, "admin")
+	_, userToken := security.login(t, "alice")
+	body := []byte(`{"tags":["type:note"],"content":"hello"}`)
+
+	if rec := serve(authorizedRequest("POST", "/api/v1/entities/create", "", body)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous create = %d, want 401", rec.Code)
+	}
+	rec := serve(authorizedRequest("POST", "/api/v1/entities/create", userToken, body))
+	if rec.Code != http.StatusOK && rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", rec.Code, rec.Body)
+	}
+	createdID := createdEntityID(rec.Body.Bytes())
+	if createdID == "" {
+		t.Fatalf("create response has no id: %s", rec.Body)
+	}
+
+	// Users without audit:view cannot read the log
+	if rec := serve(authorizedRequest("GET", "/api/v1/audit", userToken, nil)); rec.Code != http.StatusForbidden {
+		t.Errorf("audit query by alice = %d, want 403", rec.Code)
+	}
+
+	// Stopping writes the queued events
+	audit.Stop()
+	rec = serve(authorizedRequest("GET", "/api/v1/audit?action=create", adminToken, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("audit query = %d: %s", rec.Code, rec.Body)
+	}
+	var response AuditResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Count != 1 {
+		t.Fatalf("audit query returned %d create events, want only alice's: %+v", response.Count, response.Events)
+	}
+	event := response.Events[0]
+	if event.Actor != "alice" || event.EntityID != createdID || event.Protocol != "HTTP" || !event.Success ||
+		event.Diff == nil || !event.Diff.ContentChanged {
+		t.Errorf("audit event = %+v, want alice's successful create of %s with a content diff", event, createdID)
+	}
+
+	update := []byte(`{"id":"` + event.ID + `","tags":["type:note"]}`)
+	if rec := serve(authorizedRequest("PUT", "/api/v1/entities/update", adminToken, update)); rec.Code != http.StatusForbidden {
+		t.Errorf("update of an audit event = %d, want 403", rec.Code)
+	}
+}
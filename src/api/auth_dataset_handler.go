@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"net/http"
+)
+
+// DefaultDatasetRequest sets the default dataset of the user named by
+// UserID or Username. An empty Dataset clears it.
+type DefaultDatasetRequest struct {
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Dataset  string `json:"dataset"`
+
+	// Restricted confines every session of the user to the dataset
+	Restricted bool `json:"restricted,omitempty"`
+}
+
+// DefaultDatasetResponse describes a user's default dataset
+type DefaultDatasetResponse struct {
+	UserID         string `json:"user_id"`
+	DefaultDataset string `json:"default_dataset,omitempty"`
+	Restricted     bool   `json:"restricted"`
+}
+
+// SetDefaultDataset sets a user's default dataset
+// @Summary Set a user's default dataset (admin only)
+// @Description Set the dataset a user works in by default. Restricted users are confined to it: every session they open, including open ones, can only reach that dataset's routes. An empty dataset clears the default and the restriction.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body DefaultDatasetRequest true "User and dataset"
+// @Success 200 {object} DefaultDatasetResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/default-dataset [post]
+func (h *AuthHandler) SetDefaultDataset(w http.ResponseWriter, r *http.Request) {
+	var req DefaultDatasetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.UserID == "" && req.Username == "" {
+		RespondError(w, http.StatusBadRequest, "Either user_id or username is required")
+		return
+	}
+	if req.Restricted && req.Dataset == "" {
+		RespondError(w, http.StatusBadRequest, "A restricted user needs a dataset")
+		return
+	}
+
+	user := findUser(h.securityManager.GetEntityRepo(), req.UserID, req.Username)
+	if user == nil {
+		RespondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := h.securityManager.SetDefaultDataset(user.ID, req.Dataset, req.Restricted); err != nil {
+		if errors.Is(err, models.ErrInvalidScope) {
+			RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Error("Failed to set default dataset of user %s: %v", user.ID, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to set default dataset")
+		return
+	}
+	logger.Info("Default dataset of user %s set to %q (restricted: %v)", user.ID, req.Dataset, req.Restricted)
+	RespondJSON(w, http.StatusOK, DefaultDatasetResponse{
+		UserID:         user.ID,
+		DefaultDataset: req.Dataset,
+		Restricted:     req.Restricted,
+	})
+}
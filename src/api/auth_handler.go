@@ -4,6 +4,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -26,6 +27,9 @@ import (
 //   - Integration with RBAC for permission checking
 type AuthHandler struct {
 	securityManager *models.SecurityManager
+
+	// oidc is set when single sign-on is enabled
+	oidc *OIDCLogin
 }
 
 // NewAuthHandler creates a new authentication handler.
@@ -41,6 +45,13 @@ func NewAuthHandler(securityManager *models.SecurityManager) *AuthHandler {
 type AuthLoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+
+	// TOTPCode or BackupCode is required for users with two-factor authentication
+	TOTPCode   string `json:"totp_code,omitempty"`
+	BackupCode string `json:"backup_code,omitempty"`
+
+	// Scope confines the session to a dataset the user can access
+	Scope string `json:"scope,omitempty"`
 }
 
 // AuthLoginResponse represents a login response for the new auth system
@@ -57,11 +68,18 @@ type AuthUserInfo struct {
 	Username string   `json:"username"`
 	Email    string   `json:"email"`
 	Roles    []string `json:"roles"`
+
+	DefaultDataset string `json:"default_dataset,omitempty"`
+	// Scope is the dataset the session is confined to
+	Scope string `json:"scope,omitempty"`
 }
 
 // AuthErrorResponse represents an error response for auth endpoints
 type AuthErrorResponse struct {
 	Error string `json:"error"`
+
+	// MFARequired is set when the login must be retried with a second factor
+	MFARequired bool `json:"mfa_required,omitempty"`
 }
 
 // Login handles user authentication using the embedded credential system.
@@ -73,7 +91,9 @@ type AuthErrorResponse struct {
 // Request Body:
 //   {
 //     "username": "admin",
-//     "password": "admin"
+//     "password": "admin",
+//     "totp_code": "123456",   // only for users with two-factor authentication
+//     "scope": "tenant-a"      // optional: confine the session to a dataset
 //   }
 //
 // Response:
@@ -86,19 +106,29 @@ type AuthErrorResponse struct {
 //       "id": "user-entity-id",
 //       "username": "admin",
 //       "email": "admin@example.com",
-//       "roles": ["admin", "user"]
+//       "roles": ["admin", "user"],
+//       "default_dataset": "tenant-a",
+//       "scope": "tenant-a"
 //     }
 //   }
 //
 // Error Responses:
-//   - 400 Bad Request: Invalid request body or missing credentials
-//   - 401 Unauthorized: Invalid username or password
+//   - 400 Bad Request: Invalid request body, missing credentials or a scope
+//     that is not a dataset name
+//   - 401 Unauthorized: Invalid username or password, or a missing or wrong
+//     second factor ("mfa_required": true)
+//   - 403 Forbidden: Password login is disabled in favour of OIDC single sign-on,
+//     or the user may not scope a session to the requested dataset
 //   - 500 Internal Server Error: Failed to create session
 //
 // Authentication Flow:
 //   1. Validates username and password are provided
 //   2. Looks up user entity by username tag
 //   3. Verifies password against embedded bcrypt hash in entity content
+//   3a. For users with two-factor authentication, verifies the TOTP code or
+//       consumes the backup code
+//   3b. Resolves the session's scope: users restricted to their default
+//       dataset always get it, others get the requested dataset if any
 //   4. Creates a new session with TTL (default 1 hour)
 //   5. Returns session token and user information
 //
@@ -123,6 +153,13 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	
 	var loginReq AuthLoginRequest
 	
+	if h.oidc != nil && !h.oidc.PasswordLogin {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(AuthErrorResponse{Error: "Password login is disabled; use single sign-on"})
+		return
+	}
+	
 	// Parse request body
 	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
 		logger.Warn("failed to decode login request: %v", err)
@@ -156,8 +193,38 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(AuthErrorResponse{Error: "Invalid credentials"})
 		return
 	}
+
+	// Users with two-factor authentication must also present a code
+	if models.MFAEnabled(userEntity.Entity) {
+		if loginReq.TOTPCode == "" && loginReq.BackupCode == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(AuthErrorResponse{Error: "Two-factor code required", MFARequired: true})
+			return
+		}
+		if err := h.securityManager.VerifySecondFactor(userEntity.ID, loginReq.TOTPCode, loginReq.BackupCode); err != nil {
+			logger.Warn("second factor failed for user %s: %v", loginReq.Username, err)
+			TrackHTTPError("auth_handler.Login", http.StatusUnauthorized, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(AuthErrorResponse{Error: "Invalid credentials", MFARequired: true})
+			return
+		}
+	}
 	logger.Info("user %s authenticated successfully", loginReq.Username)
-	
+
+	scope, err := h.securityManager.ResolveSessionScope(userEntity, loginReq.Scope)
+	if err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, models.ErrInvalidScope) {
+			status = http.StatusBadRequest
+		}
+		logger.Warn("session scope %q refused for user %s: %v", loginReq.Scope, loginReq.Username, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(AuthErrorResponse{Error: err.Error()})
+		return
+	}
 
 	// Extract user roles from entity tags
 	// Roles are stored as tags with the format "rbac:role:rolename"
@@ -173,7 +240,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	ipAddress := r.RemoteAddr
 	userAgent := r.Header.Get("User-Agent")
 	logger.TraceIf("auth", "creating database session for user %s", userEntity.ID)
-	dbSession, err := h.securityManager.CreateSession(userEntity, ipAddress, userAgent)
+	dbSession, err := h.securityManager.CreateScopedSession(userEntity, ipAddress, userAgent, scope)
 	if err != nil {
 		logger.Error("failed to create database session for user %s: %v", userEntity.ID, err)
 		w.Header().Set("Content-Type", "application/json")
@@ -189,10 +256,12 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		UserID:    userEntity.ID,
 		ExpiresAt: dbSession.ExpiresAt.Format(time.RFC3339),
 		User: AuthUserInfo{
-			ID:       userEntity.ID,
-			Username: userEntity.Username,
-			Email:    userEntity.Email,
-			Roles:    roles,
+			ID:             userEntity.ID,
+			Username:       userEntity.Username,
+			Email:          userEntity.Email,
+			Roles:          roles,
+			DefaultDataset: defaultDataset(userEntity.Entity),
+			Scope:          scope,
 		},
 	}
 
@@ -356,10 +425,12 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		UserID:    newSession.UserID,
 		ExpiresAt: newSession.ExpiresAt.Format(time.RFC3339),
 		User: AuthUserInfo{
-			ID:       newSession.UserID,
-			Username: username,
-			Email:    email,
-			Roles:    roles,
+			ID:             newSession.UserID,
+			Username:       username,
+			Email:          email,
+			Roles:          roles,
+			DefaultDataset: defaultDataset(userEntity),
+			Scope:          securityCtx.User.Scope,
 		},
 	}
 
@@ -397,10 +468,12 @@ func (h *AuthHandler) WhoAmI(w http.ResponseWriter, r *http.Request) {
 
 	// Create response
 	userInfo := AuthUserInfo{
-		ID:       securityCtx.User.ID,
-		Username: securityCtx.User.Username,
-		Email:    securityCtx.User.Email,
-		Roles:    roles,
+		ID:             securityCtx.User.ID,
+		Username:       securityCtx.User.Username,
+		Email:          securityCtx.User.Email,
+		Roles:          roles,
+		DefaultDataset: defaultDataset(securityCtx.User.Entity),
+		Scope:          securityCtx.User.Scope,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -425,6 +498,12 @@ func (h *AuthHandler) getUserRoles(user *models.SecurityUser) ([]string, error)
 	return roles, nil
 }
 
+// defaultDataset returns the user's default dataset, if any
+func defaultDataset(user *models.Entity) string {
+	dataset, _ := models.UserDefaultDataset(user)
+	return dataset
+}
+
 // Obsolete helper functions removed - using tag-based RBAC now
 
 // getClientIP extracts the client IP address from the request
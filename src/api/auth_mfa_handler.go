@@ -0,0 +1,276 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"net/http"
+)
+
+// MFACodeRequest carries a TOTP code or a backup code
+type MFACodeRequest struct {
+	TOTPCode   string `json:"totp_code"`
+	BackupCode string `json:"backup_code,omitempty"`
+}
+
+// MFAStatusResponse describes a user's two-factor authentication
+type MFAStatusResponse struct {
+	Enabled              bool `json:"enabled"`
+	BackupCodesRemaining int  `json:"backup_codes_remaining"`
+}
+
+// MFABackupCodesResponse returns backup codes, which are shown only once
+type MFABackupCodesResponse struct {
+	Enabled     bool     `json:"enabled"`
+	BackupCodes []string `json:"backup_codes"`
+}
+
+// ResetMFARequest names the user whose two-factor authentication an
+// administrator removes
+type ResetMFARequest struct {
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// respondMFAError maps two-factor errors to HTTP responses
+func respondMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidMFACode):
+		RespondError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, models.ErrMFAAlreadyEnabled):
+		RespondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, models.ErrMFANotEnabled), errors.Is(err, models.ErrMFANotEnrolled):
+		RespondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrMFANotConfigured):
+		RespondError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		logger.Error("Two-factor operation failed: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Two-factor operation failed")
+	}
+}
+
+// decodeMFACode reads an MFACodeRequest, requiring one of the codes
+func decodeMFACode(w http.ResponseWriter, r *http.Request) (*MFACodeRequest, bool) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+	if req.TOTPCode == "" && req.BackupCode == "" {
+		RespondError(w, http.StatusBadRequest, "totp_code or backup_code is required")
+		return nil, false
+	}
+	return &req, true
+}
+
+// MFAStatus reports whether the current user has two-factor authentication
+// @Summary Get two-factor status
+// @Description Report whether the current user has two-factor authentication and how many backup codes remain
+// @Tags authentication
+// @Produce json
+// @Success 200 {object} MFAStatusResponse
+// @Security BearerAuth
+// @Router /api/v1/auth/mfa [get]
+func (h *AuthHandler) MFAStatus(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	entity, err := h.securityManager.GetEntityRepo().GetByID(securityCtx.User.ID)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+	RespondJSON(w, http.StatusOK, MFAStatusResponse{
+		Enabled:              models.MFAEnabled(entity),
+		BackupCodesRemaining: models.MFABackupCodesRemaining(entity),
+	})
+}
+
+// EnrollMFA starts two-factor enrollment for the current user
+// @Summary Enroll an authenticator
+// @Description Generate a TOTP secret for the current user. Two-factor authentication is enabled once a code from the authenticator is confirmed.
+// @Tags authentication
+// @Produce json
+// @Success 200 {object} models.TOTPEnrollment
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/auth/mfa/enroll [post]
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	enrollment, err := h.securityManager.EnrollTOTP(securityCtx.User)
+	if err != nil {
+		respondMFAError(w, err)
+		return
+	}
+	logger.Info("Two-factor enrollment started for user %s", securityCtx.User.Username)
+	RespondJSON(w, http.StatusOK, enrollment)
+}
+
+// ConfirmMFA enables two-factor authentication with a code from the
+// enrolled authenticator
+// @Summary Confirm two-factor enrollment
+// @Description Enable two-factor authentication with a TOTP code from the enrolled authenticator and return one-time backup codes
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param body body MFACodeRequest true "TOTP code"
+// @Success 200 {object} MFABackupCodesResponse
+// @Failure 401 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/auth/mfa/confirm [post]
+func (h *AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	req, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+	codes, err := h.securityManager.ConfirmTOTP(securityCtx.User.ID, req.TOTPCode)
+	if err != nil {
+		respondMFAError(w, err)
+		return
+	}
+	logger.Info("Two-factor authentication enabled for user %s", securityCtx.User.Username)
+	RespondJSON(w, http.StatusOK, MFABackupCodesResponse{Enabled: true, BackupCodes: codes})
+}
+
+// RegenerateBackupCodes replaces the current user's backup codes
+// @Summary Regenerate backup codes
+// @Description Replace the current user's backup codes after verifying a TOTP code
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param body body MFACodeRequest true "TOTP code"
+// @Success 200 {object} MFABackupCodesResponse
+// @Failure 401 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/auth/mfa/backup-codes [post]
+func (h *AuthHandler) RegenerateBackupCodes(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	req, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+	// A backup code cannot mint new backup codes
+	if req.TOTPCode == "" {
+		RespondError(w, http.StatusBadRequest, "totp_code is required")
+		return
+	}
+	if err := h.securityManager.VerifySecondFactor(securityCtx.User.ID, req.TOTPCode, ""); err != nil {
+		respondMFAError(w, err)
+		return
+	}
+	codes, err := h.securityManager.RegenerateBackupCodes(securityCtx.User.ID)
+	if err != nil {
+		respondMFAError(w, err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, MFABackupCodesResponse{Enabled: true, BackupCodes: codes})
+}
+
+// DisableMFA turns off two-factor authentication for the current user
+// @Summary Disable two-factor authentication
+// @Description Remove the current user's TOTP secret and backup codes after verifying a TOTP or backup code. A pending enrollment is cancelled without a code.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param body body MFACodeRequest false "TOTP or backup code"
+// @Success 200 {object} MFAStatusResponse
+// @Failure 401 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/auth/mfa/disable [post]
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	entity, err := h.securityManager.GetEntityRepo().GetByID(securityCtx.User.ID)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+	if models.MFAEnabled(entity) {
+		req, ok := decodeMFACode(w, r)
+		if !ok {
+			return
+		}
+		if err := h.securityManager.VerifySecondFactor(securityCtx.User.ID, req.TOTPCode, req.BackupCode); err != nil {
+			respondMFAError(w, err)
+			return
+		}
+	}
+	if err := h.securityManager.DisableMFA(securityCtx.User.ID); err != nil {
+		respondMFAError(w, err)
+		return
+	}
+	logger.Info("Two-factor authentication disabled for user %s", securityCtx.User.Username)
+	RespondJSON(w, http.StatusOK, MFAStatusResponse{Enabled: false})
+}
+
+// ResetMFA removes a user's two-factor authentication, for users who lost
+// their authenticator and backup codes
+// @Summary Reset a user's two-factor authentication (admin only)
+// @Description Remove the TOTP secret and backup codes of a user so they can log in with their password and enroll again
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body ResetMFARequest true "User to reset"
+// @Success 200 {object} MFAStatusResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/users/reset-mfa [post]
+func (h *AuthHandler) ResetMFA(w http.ResponseWriter, r *http.Request) {
+	var req ResetMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.UserID == "" && req.Username == "" {
+		RespondError(w, http.StatusBadRequest, "Either user_id or username is required")
+		return
+	}
+
+	user := findUser(h.securityManager.GetEntityRepo(), req.UserID, req.Username)
+	if user == nil {
+		RespondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := h.securityManager.DisableMFA(user.ID); err != nil {
+		respondMFAError(w, err)
+		return
+	}
+	logger.Info("Two-factor authentication reset for user %s", user.ID)
+	RespondJSON(w, http.StatusOK, MFAStatusResponse{Enabled: false})
+}
+
+// findUser returns the user entity with userID, or else the one holding
+// username, or nil if there is none
+func findUser(repo models.EntityRepository, userID, username string) *models.Entity {
+	if userID != "" {
+		if entity, err := repo.GetByID(userID); err == nil && entity.HasTag("type:"+models.EntityTypeUser) {
+			return entity
+		}
+		return nil
+	}
+	entities, err := repo.ListByTag(models.UsernameTagPrefix + username)
+	if err != nil {
+		return nil
+	}
+	return models.SelectUserEntity(entities)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"entitydb/models"
+
+	"github.com/gorilla/mux"
+)
+
+// TestMFAHandlers checks two-factor enrollment through the API: enrollment
+// requires a session and a valid code, login then requires a second factor,
+// backup codes work once, and only users with user:update can reset
+// another user's two-factor authentication
+func TestMFAHandlers(t *testing.T) {
+	security := newTestSecurity(t)
+	auth := NewAuthHandler(security.manager)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/auth/login", auth.Login).Methods("POST")
+	router.HandleFunc("/api/v1/auth/mfa", security.middleware.RequireAuthentication(auth.MFAStatus)).Methods("GET")
+	router.HandleFunc("/api/v1/auth/mfa/enroll", security.middleware.RequireAuthentication(auth.EnrollMFA)).Methods("POST")
+	router.HandleFunc("/api/v1/auth/mfa/confirm", security.middleware.RequireAuthentication(auth.ConfirmMFA)).Methods("POST")
+	router.HandleFunc("/api/v1/users/reset-mfa", security.middleware.RequirePermission("user", "update")(auth.ResetMFA)).Methods("POST")
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	_, adminToken := security.login(t, "admin")
+	_, userToken := security.login(t, "alice")
+
+	if rec := serve(authorizedRequest("POST", "/api/v1/auth/mfa/enroll", "", nil)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous enroll = %d, want 401", rec.Code)
+	}
+	rec := serve(authorizedRequest("POST", "/api/v1/auth/mfa/enroll", userToken, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enroll = %d: %s", rec.Code, rec.Body)
+	}
+	var enrollment models.TOTPEnrollment
+	if err := json.Unmarshal(rec.Body.Bytes(), &enrollment); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("enrollment secret %q: %v", enrollment.Secret, err)
+	}
+
+	code := models.TOTPCode(secret, time.Now())
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	if rec := serve(authorizedRequest("POST", "/api/v1/auth/mfa/confirm", userToken, []byte(`{"totp_code":"`+wrong+`"}`))); rec.Code != http.StatusUnauthorized {
+		t.Errorf("confirm with a wrong code = %d, want 401", rec.Code)
+	}
+	rec = serve(authorizedRequest("POST", "/api/v1/auth/mfa/confirm", userToken, []byte(`{"totp_code":"`+code+`"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm = %d: %s", rec.Code, rec.Body)
+	}
+	var confirmed MFABackupCodesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &confirmed); err != nil || !confirmed.Enabled || len(confirmed.BackupCodes) == 0 {
+		t.Fatalf("confirm response = %s, %v", rec.Body, err)
+	}
+
+	login := func(extra string) *httptest.ResponseRecorder {
+		return serve(authorizedRequest("POST", "/api/v1/auth/login", "", []byte(`{"username":"alice","password":"password-alice"`+extra+`}`)))
+	}
+	if rec := login(""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login without a second factor = %d, want 401", rec.Code)
+	}
+	backup := `,"backup_code":"` + confirmed.BackupCodes[0] + `"`
+	if rec := login(backup); rec.Code != http.StatusOK {
+		t.Errorf("login with a backup code = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := login(backup); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login reusing a backup code = %d, want 401", rec.Code)
+	}
+
+	reset := []byte(`{"username":"alice"}`)
+	if rec := serve(authorizedRequest("POST", "/api/v1/users/reset-mfa", userToken, reset)); rec.Code != http.StatusForbidden {
+		t.Errorf("reset by alice = %d, want 403", rec.Code)
+	}
+	if rec := serve(authorizedRequest("POST", "/api/v1/users/reset-mfa", adminToken, reset)); rec.Code != http.StatusOK {
+		t.Fatalf("reset by admin = %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(authorizedRequest("GET", "/api/v1/auth/mfa", userToken, nil))
+	var status MFAStatusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || status.Enabled {
+		t.Errorf("status after reset = %s, %v, want disabled", rec.Body, err)
+	}
+	if rec := login(""); rec.Code != http.StatusOK {
+		t.Errorf("login after reset = %d: %s", rec.Code, rec.Body)
+	}
+}
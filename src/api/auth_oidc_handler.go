@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OIDCLogin maps users authenticated by an OpenID Connect provider to
+// EntityDB users
+type OIDCLogin struct {
+	Client        *OIDCClient
+	UsernameClaim string
+	GroupsClaim   string
+	GroupRoles    map[string][]string // provider group -> EntityDB roles
+	DefaultRole   string              // granted when no group is mapped; empty rejects the user
+	PasswordLogin bool                // whether POST /auth/login stays available
+}
+
+// NewOIDCLogin configures single sign-on from the server configuration
+func NewOIDCLogin(cfg *config.Config) (*OIDCLogin, error) {
+	if cfg.OIDCIssuerURL == "" || cfg.OIDCClientID == "" || cfg.OIDCRedirectURL == "" {
+		return nil, fmt.Errorf("OIDC requires an issuer URL, client ID and redirect URL")
+	}
+	groupRoles := make(map[string][]string)
+	for _, pair := range strings.Split(cfg.OIDCGroupRoles, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid OIDC group role mapping %q, expected group=role", pair)
+		}
+		groupRoles[group] = append(groupRoles[group], role)
+	}
+	return &OIDCLogin{
+		Client: NewOIDCClient(OIDCConfig{
+			IssuerURL:    cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+		}),
+		UsernameClaim: cfg.OIDCUsernameClaim,
+		GroupsClaim:   cfg.OIDCGroupsClaim,
+		GroupRoles:    groupRoles,
+		DefaultRole:   cfg.OIDCDefaultRole,
+		PasswordLogin: cfg.OIDCPasswordLogin,
+	}, nil
+}
+
+// identity maps ID token claims to an external identity
+func (o *OIDCLogin) identity(claims map[string]interface{}) (models.ExternalIdentity, error) {
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		email = ""
+	}
+
+	username, _ := claims[o.UsernameClaim].(string)
+	if username == "" {
+		username = email
+	}
+	if username == "" {
+		username = subject
+	}
+	if strings.ContainsAny(username, "|\r\n") {
+		return models.ExternalIdentity{}, fmt.Errorf("username %q contains invalid characters", username)
+	}
+
+	var roles []string
+	for _, group := range claimStrings(claims[o.GroupsClaim]) {
+		roles = append(roles, o.GroupRoles[group]...)
+	}
+	if len(roles) == 0 {
+		if o.DefaultRole == "" {
+			return models.ExternalIdentity{}, fmt.Errorf("none of the user's groups is mapped to a role")
+		}
+		roles = []string{o.DefaultRole}
+	}
+
+	return models.ExternalIdentity{
+		Provider: "oidc",
+		Subject:  subject,
+		Username: username,
+		Email:    email,
+		Roles:    roles,
+	}, nil
+}
+
+// claimStrings reads a claim holding a string or an array of strings
+func claimStrings(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// safeRedirect reports whether a post-login redirect stays on this server
+func safeRedirect(redirect string) bool {
+	return strings.HasPrefix(redirect, "/") && !strings.HasPrefix(redirect, "//") && !strings.Contains(redirect, "\\")
+}
+
+// OIDCLoginRedirect sends the user to the identity provider
+// @Summary Start single sign-on
+// @Description Redirect to the configured OpenID Connect provider. After login the provider returns to the callback, which issues a session. An optional relative redirect receives the token in the URL fragment.
+// @Tags authentication
+// @Param redirect query string false "Relative URL to return to after login"
+// @Success 302
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/v1/auth/oidc/login [get]
+func (h *AuthHandler) OIDCLoginRedirect(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		RespondError(w, http.StatusNotFound, "Single sign-on is not enabled")
+		return
+	}
+	redirect := r.URL.Query().Get("redirect")
+	if redirect != "" && !safeRedirect(redirect) {
+		RespondError(w, http.StatusBadRequest, "redirect must be a relative path")
+		return
+	}
+	target, err := h.oidc.Client.AuthURL(r.Context(), redirect)
+	if err != nil {
+		logger.Error("Failed to start OIDC login: %v", err)
+		RespondError(w, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback completes single sign-on and issues a session
+// @Summary Complete single sign-on
+// @Description Called by the identity provider after login. Verifies the ID token, creates or updates the user from its claims and issues a session token.
+// @Tags authentication
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "Login state"
+// @Success 200 {object} AuthLoginResponse
+// @Success 302
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/auth/oidc/callback [get]
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		RespondError(w, http.StatusNotFound, "Single sign-on is not enabled")
+		return
+	}
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		logger.Warn("OIDC login failed at provider: %s %s", providerErr, query.Get("error_description"))
+		RespondError(w, http.StatusUnauthorized, "Login failed at identity provider: "+providerErr)
+		return
+	}
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		RespondError(w, http.StatusBadRequest, "code and state are required")
+		return
+	}
+
+	claims, redirect, err := h.oidc.Client.Exchange(r.Context(), state, code)
+	if err != nil {
+		logger.Warn("OIDC login rejected: %v", err)
+		TrackHTTPError("auth_handler.OIDCCallback", http.StatusUnauthorized, err)
+		RespondError(w, http.StatusUnauthorized, "Single sign-on failed")
+		return
+	}
+	identity, err := h.oidc.identity(claims)
+	if err != nil {
+		logger.Warn("OIDC login for %v rejected: %v", claims["sub"], err)
+		RespondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	user, err := h.securityManager.ProvisionExternalUser(identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrExternalIdentityConflict):
+			RespondError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, models.ErrUserInactive):
+			RespondError(w, http.StatusForbidden, err.Error())
+		default:
+			logger.Error("Failed to provision OIDC user %s: %v", identity.Username, err)
+			RespondError(w, http.StatusInternalServerError, "Failed to provision user")
+		}
+		return
+	}
+
+	// Users restricted to their default dataset are scoped to it
+	scope, err := h.securityManager.ResolveSessionScope(user, "")
+	if err != nil {
+		logger.Error("Failed to resolve session scope for %s: %v", user.Username, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+	session, err := h.securityManager.CreateScopedSession(user, r.RemoteAddr, r.Header.Get("User-Agent"), scope)
+	if err != nil {
+		logger.Error("failed to create database session for user %s: %v", user.ID, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+	logger.Info("user %s authenticated through OIDC", user.Username)
+
+	expiresAt := session.ExpiresAt.Format(time.RFC3339)
+	if redirect != "" {
+		fragment := url.Values{"token": {session.Token}, "expires_at": {expiresAt}}
+		http.Redirect(w, r, redirect+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+	roles, _ := h.getUserRoles(user)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuthLoginResponse{
+		Token:     session.Token,
+		UserID:    user.ID,
+		ExpiresAt: expiresAt,
+		User: AuthUserInfo{
+			ID:             user.ID,
+			Username:       user.Username,
+			Email:          user.Email,
+			Roles:          roles,
+			DefaultDataset: defaultDataset(user.Entity),
+			Scope:          scope,
+		},
+	})
+}
+
+// SetOIDC enables single sign-on
+func (h *AuthHandler) SetOIDC(oidc *OIDCLogin) {
+	h.oidc = oidc
+}
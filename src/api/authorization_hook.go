@@ -0,0 +1,228 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthorizationDecision is the outcome of an authorization hook
+type AuthorizationDecision int
+
+const (
+	// AuthorizationAbstain leaves the decision to local RBAC
+	AuthorizationAbstain AuthorizationDecision = iota
+	// AuthorizationAllow grants the request
+	AuthorizationAllow
+	// AuthorizationDeny rejects the request
+	AuthorizationDeny
+)
+
+// String returns the decision name used in logs
+func (d AuthorizationDecision) String() string {
+	switch d {
+	case AuthorizationAllow:
+		return "allow"
+	case AuthorizationDeny:
+		return "deny"
+	default:
+		return "abstain"
+	}
+}
+
+// AuthorizationRequest describes a permission check passed to an authorization hook
+type AuthorizationRequest struct {
+	UserID   string   `json:"user_id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	Resource string   `json:"resource"`
+	Action   string   `json:"action"`
+	Dataset  string   `json:"dataset,omitempty"`
+	Method   string   `json:"method"`
+	Path     string   `json:"path"`
+}
+
+// AuthorizationHook delegates permission checks to an external policy engine.
+// Returning AuthorizationAbstain or an error falls back to local RBAC.
+type AuthorizationHook interface {
+	Authorize(ctx context.Context, req AuthorizationRequest) (AuthorizationDecision, error)
+}
+
+// newAuthorizationRequest builds the hook input for a permission check
+func newAuthorizationRequest(method, path string, user *models.SecurityUser, resource, action, dataset string) AuthorizationRequest {
+	req := AuthorizationRequest{
+		UserID:   user.ID,
+		Username: user.Username,
+		Roles:    []string{},
+		Resource: resource,
+		Action:   action,
+		Dataset:  dataset,
+		Method:   method,
+		Path:     path,
+	}
+	if user.Entity != nil {
+		for _, tag := range user.Entity.GetTagsWithoutTimestamp() {
+			if strings.HasPrefix(tag, "rbac:role:") {
+				req.Roles = append(req.Roles, strings.TrimPrefix(tag, "rbac:role:"))
+			}
+		}
+	}
+	return req
+}
+
+// HTTPAuthorizationHook asks an HTTP policy endpoint such as an OPA data API.
+// It POSTs {"input": <AuthorizationRequest>} and accepts {"result": true},
+// {"result": false} or {"result": {"allow": true}}. An undefined result
+// (no "result" key) abstains.
+type HTTPAuthorizationHook struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPAuthorizationHook creates a hook querying url with the given timeout
+func NewHTTPAuthorizationHook(url string, timeout time.Duration) *HTTPAuthorizationHook {
+	return &HTTPAuthorizationHook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Authorize queries the policy endpoint
+func (h *HTTPAuthorizationHook) Authorize(ctx context.Context, req AuthorizationRequest) (AuthorizationDecision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": req})
+	if err != nil {
+		return AuthorizationAbstain, fmt.Errorf("failed to encode authorization input: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return AuthorizationAbstain, fmt.Errorf("failed to create authorization request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return AuthorizationAbstain, fmt.Errorf("authorization endpoint unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return AuthorizationAbstain, fmt.Errorf("authorization endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return AuthorizationAbstain, fmt.Errorf("invalid authorization response: %w", err)
+	}
+	if len(result.Result) == 0 || string(result.Result) == "null" {
+		return AuthorizationAbstain, nil
+	}
+
+	var allowed bool
+	if err := json.Unmarshal(result.Result, &allowed); err != nil {
+		var object struct {
+			Allow *bool `json:"allow"`
+		}
+		if err := json.Unmarshal(result.Result, &object); err != nil || object.Allow == nil {
+			return AuthorizationAbstain, fmt.Errorf("authorization result is neither a boolean nor an object with allow")
+		}
+		allowed = *object.Allow
+	}
+	if allowed {
+		return AuthorizationAllow, nil
+	}
+	return AuthorizationDeny, nil
+}
+
+// authorizationCacheMaxEntries bounds the decision cache
+const authorizationCacheMaxEntries = 10000
+
+type cachedAuthorizationDecision struct {
+	decision AuthorizationDecision
+	expires  time.Time
+}
+
+// CachingAuthorizationHook caches allow and deny decisions of another hook
+// for a TTL. Abstentions and errors are not cached so an unavailable policy
+// engine is retried on the next request.
+type CachingAuthorizationHook struct {
+	hook AuthorizationHook
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedAuthorizationDecision
+}
+
+// NewCachingAuthorizationHook wraps hook with a decision cache
+func NewCachingAuthorizationHook(hook AuthorizationHook, ttl time.Duration) *CachingAuthorizationHook {
+	return &CachingAuthorizationHook{
+		hook:    hook,
+		ttl:     ttl,
+		entries: make(map[string]cachedAuthorizationDecision),
+	}
+}
+
+// Authorize returns a cached decision or asks the wrapped hook
+func (c *CachingAuthorizationHook) Authorize(ctx context.Context, req AuthorizationRequest) (AuthorizationDecision, error) {
+	key := strings.Join([]string{req.UserID, req.Resource, req.Action, req.Dataset, req.Method, req.Path}, "\x00")
+	now := time.Now()
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && now.Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.decision, nil
+	}
+	c.mu.Unlock()
+
+	decision, err := c.hook.Authorize(ctx, req)
+	if err != nil || decision == AuthorizationAbstain || c.ttl <= 0 {
+		return decision, err
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= authorizationCacheMaxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= authorizationCacheMaxEntries {
+			c.entries = make(map[string]cachedAuthorizationDecision)
+		}
+	}
+	c.entries[key] = cachedAuthorizationDecision{decision: decision, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return decision, nil
+}
+
+// authorize checks a permission through the authorization hook, falling
+// back to local RBAC when no hook is configured, the hook abstains or fails
+func (sm *SecurityMiddleware) authorize(r *http.Request, user *models.SecurityUser, resource, action, dataset string) (bool, error) {
+	return sm.authorizeCall(r.Context(), r.Method, r.URL.Path, user, resource, action, dataset)
+}
+
+// authorizeCall is authorize for callers without an HTTP request, such as
+// gRPC methods, which pass their own method and path for the hook input
+func (sm *SecurityMiddleware) authorizeCall(ctx context.Context, method, path string, user *models.SecurityUser, resource, action, dataset string) (bool, error) {
+	if sm.authzHook != nil {
+		decision, err := sm.authzHook.Authorize(ctx, newAuthorizationRequest(method, path, user, resource, action, dataset))
+		if err != nil {
+			logger.Warn("Authorization hook failed for %s on %s:%s, using local RBAC: %v", user.Username, resource, action, err)
+		} else if decision != AuthorizationAbstain {
+			logger.Debug("Authorization hook decided %s for %s on %s:%s", decision, user.Username, resource, action)
+			return decision == AuthorizationAllow, nil
+		}
+	}
+	return sm.securityManager.HasPermissionInDataset(user, resource, action, dataset)
+}
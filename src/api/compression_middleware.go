@@ -0,0 +1,273 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionMiddleware compresses JSON responses for clients accepting
+// zstd or gzip, preferring zstd. Responses below the size threshold, other
+// content types and responses that are already encoded pass through
+// unchanged, so entity content and chunk streams keep their Content-Length
+// and range support. ETags are left as they are: they identify entity
+// versions for conditional updates, not encoded bytes.
+type CompressionMiddleware struct {
+	minSize     int
+	gzipWriters sync.Pool
+	zstdWriters sync.Pool
+}
+
+// NewCompressionMiddleware creates a compression middleware leaving
+// responses below minSize bytes uncompressed
+func NewCompressionMiddleware(minSize int) *CompressionMiddleware {
+	if minSize < 0 {
+		minSize = 0
+	}
+	m := &CompressionMiddleware{minSize: minSize}
+	m.gzipWriters.New = func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}
+	m.zstdWriters.New = func() interface{} {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+		return encoder
+	}
+	return m
+}
+
+// Middleware returns the HTTP middleware function
+func (m *CompressionMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			m:              m,
+			encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding")),
+		}
+		next.ServeHTTP(cw, r)
+		// Not deferred: a handler aborting with a panic must not have its
+		// truncated body completed into a valid compressed stream
+		cw.close()
+	})
+}
+
+// negotiateEncoding picks zstd or gzip from an Accept-Encoding header by
+// quality, zstd winning ties, or returns "" when neither is acceptable
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+	quality := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		quality[coding] = q
+	}
+	qualityOf := func(coding string) float64 {
+		if q, ok := quality[coding]; ok {
+			return q
+		}
+		return quality["*"]
+	}
+	zstdQ, gzipQ := qualityOf("zstd"), qualityOf("gzip")
+	switch {
+	case zstdQ > 0 && zstdQ >= gzipQ:
+		return "zstd"
+	case gzipQ > 0:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressibleType reports whether a content type is JSON
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "application/x-ndjson" || strings.HasSuffix(mediaType, "+json")
+}
+
+// compressResponseWriter holds back the start of a JSON body until it
+// reaches the threshold, then compresses it; anything else is written
+// through as soon as its headers are known
+type compressResponseWriter struct {
+	http.ResponseWriter
+	m        *CompressionMiddleware
+	encoding string // negotiated coding, "" when the client accepts none
+	status   int    // status held back with the body
+	buf      []byte
+	decided  bool
+	encoder  io.WriteCloser // nil when passing through
+	flusher  interface{ Flush() error }
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+
+	header := w.Header()
+	json := compressibleType(header.Get("Content-Type"))
+	if json {
+		addVary(header, "Accept-Encoding")
+	}
+	switch {
+	case !json || w.encoding == "" || !bodyAllowed(status) || status == http.StatusPartialContent ||
+		header.Get("Content-Encoding") != "":
+		w.passThrough()
+	case header.Get("Content-Length") != "":
+		if n, err := strconv.Atoi(header.Get("Content-Length")); err == nil && n < w.m.minSize {
+			w.passThrough()
+		} else {
+			w.compress()
+		}
+	}
+}
+
+func (w *compressResponseWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		if w.status == 0 {
+			if w.Header().Get("Content-Type") == "" {
+				w.Header().Set("Content-Type", http.DetectContentType(data))
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+		if !w.decided {
+			w.buf = append(w.buf, data...)
+			if len(w.buf) >= w.m.minSize {
+				w.compress()
+			}
+			return len(data), nil
+		}
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush sends what has been written so far, compressing a held-back JSON
+// body regardless of its size
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.WriteHeader(http.StatusOK)
+		}
+		if !w.decided {
+			w.compress()
+		}
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// passThrough sends the held-back status and body unchanged
+func (w *compressResponseWriter) passThrough() {
+	w.decided = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+// compress sends the held-back status with the encoding and starts the
+// compressed body
+func (w *compressResponseWriter) compress() {
+	w.decided = true
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", w.encoding)
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if w.encoding == "zstd" {
+		encoder := w.m.zstdWriters.Get().(*zstd.Encoder)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder, w.flusher = encoder, encoder
+	} else {
+		encoder := w.m.gzipWriters.Get().(*gzip.Writer)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder, w.flusher = encoder, encoder
+	}
+	if len(w.buf) > 0 {
+		w.encoder.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+// close finishes the response once the handler has returned
+func (w *compressResponseWriter) close() {
+	if !w.decided {
+		if w.status == 0 {
+			return // Nothing written; the server sends its default response
+		}
+		w.passThrough()
+		return
+	}
+	if w.encoder == nil {
+		return
+	}
+	w.encoder.Close()
+	switch encoder := w.encoder.(type) {
+	case *zstd.Encoder:
+		encoder.Reset(nil)
+		w.m.zstdWriters.Put(encoder)
+	case *gzip.Writer:
+		encoder.Reset(io.Discard)
+		w.m.gzipWriters.Put(encoder)
+	}
+	w.encoder = nil
+}
+
+// bodyAllowed reports whether a response with status may have a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// addVary adds a field to the Vary header unless it is listed already
+func addVary(header http.Header, field string) {
+	for _, value := range header.Values("Vary") {
+		for _, listed := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(listed), field) || strings.TrimSpace(listed) == "*" {
+				return
+			}
+		}
+	}
+	header.Add("Vary", field)
+}
@@ -1,8 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"entitydb/logger"
 	"entitydb/models"
+	"entitydb/services"
+	"entitydb/storage/binary"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -13,12 +18,20 @@ import (
 
 // DatasetHandler handles dataset management operations
 type DatasetHandler struct {
-	repo models.EntityRepository
+	repo    models.EntityRepository
+	service *services.DatasetService
+	jobs    *JobManager
 }
 
+// Job types of clones and promotions submitted as jobs
+const (
+	datasetCloneJobType   = "dataset_clone"
+	datasetPromoteJobType = "dataset_promote"
+)
+
 // NewDatasetHandler creates a new handler for dataset management
-func NewDatasetHandler(repo models.EntityRepository) *DatasetHandler {
-	return &DatasetHandler{repo: repo}
+func NewDatasetHandler(repo models.EntityRepository, service *services.DatasetService, jobs *JobManager) *DatasetHandler {
+	return &DatasetHandler{repo: repo, service: service, jobs: jobs}
 }
 
 // DatasetRequest represents a request to create or update a dataset
@@ -26,6 +39,10 @@ type DatasetRequest struct {
 	Name        string            `json:"name" binding:"required"`
 	Description string            `json:"description"`
 	Settings    map[string]string `json:"settings"`
+	PublicRead  *bool             `json:"public_read,omitempty"` // Unchanged on update when omitted
+
+	// WriteOnce makes the dataset append-only; once set it cannot be cleared
+	WriteOnce *bool `json:"write_once,omitempty"`
 }
 
 // DatasetResponse represents a dataset in API responses
@@ -34,10 +51,23 @@ type DatasetResponse struct {
 	Name        string            `json:"name"`
 	Description string            `json:"description"`
 	Settings    map[string]string `json:"settings"`
+	PublicRead  bool              `json:"public_read"`
+	WriteOnce   bool              `json:"write_once"`
 	CreatedAt   time.Time         `json:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at"`
 }
 
+// DatasetCloneRequest names the dataset a clone creates
+type DatasetCloneRequest struct {
+	Name string `json:"name"`
+	AsOf string `json:"as_of,omitempty"` // RFC3339; copy the dataset as it was then
+}
+
+// DatasetPromoteRequest names the dataset a promotion moves entities into
+type DatasetPromoteRequest struct {
+	Target string `json:"target"`
+}
+
 // ListDatasets returns all configured datasets
 func (h *DatasetHandler) ListDatasets(w http.ResponseWriter, r *http.Request) {
 	// Get all entities with type:dataset tag
@@ -109,6 +139,12 @@ func (h *DatasetHandler) CreateDataset(w http.ResponseWriter, r *http.Request) {
 		},
 		Content: h.marshalDatasetContent(req),
 	}
+	if req.PublicRead != nil {
+		setPublicRead(entity, *req.PublicRead)
+	}
+	if req.WriteOnce != nil && *req.WriteOnce {
+		entity.Tags = append(entity.Tags, binary.WriteOnceTag)
+	}
 
 	if err := h.repo.Create(entity); err != nil {
 		RespondError(w, http.StatusInternalServerError, "Failed to create dataset")
@@ -143,10 +179,26 @@ func (h *DatasetHandler) UpdateDataset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Write-once mode is permanent
+	writeOnce := entity.HasTag(binary.WriteOnceTag)
+	if req.WriteOnce != nil && !*req.WriteOnce && writeOnce {
+		RespondError(w, http.StatusConflict, "Write-once mode cannot be switched off")
+		return
+	}
+
 	// Update content
 	entity.Content = h.marshalDatasetContent(req)
+	if req.PublicRead != nil {
+		setPublicRead(entity, *req.PublicRead)
+	}
+	if req.WriteOnce != nil && *req.WriteOnce && !writeOnce {
+		entity.AddTag(binary.WriteOnceTag)
+	}
 
 	if err := h.repo.Update(entity); err != nil {
+		if immutableRefused(w, err) {
+			return
+		}
 		RespondError(w, http.StatusInternalServerError, "Failed to update dataset")
 		return
 	}
@@ -192,6 +244,9 @@ func (h *DatasetHandler) DeleteDataset(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.repo.Delete(datasetID); err != nil {
+		if immutableRefused(w, err) {
+			return
+		}
 		RespondError(w, http.StatusInternalServerError, "Failed to delete dataset")
 		return
 	}
@@ -199,6 +254,178 @@ func (h *DatasetHandler) DeleteDataset(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GetDatasetUsage returns the storage used by a dataset and its quota
+// @Summary Get dataset usage
+// @Description Report the entity count, content bytes and tag bytes of a dataset, maintained incrementally on writes, with the quota that applies to it. The dataset may be named by its entity ID or its name.
+// @Tags datasets
+// @Produce json
+// @Param id path string true "Dataset entity ID or name"
+// @Success 200 {object} binary.DatasetUsage
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/datasets/{id}/usage [get]
+func (h *DatasetHandler) GetDatasetUsage(w http.ResponseWriter, r *http.Request) {
+	datasetID := mux.Vars(r)["id"]
+
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Dataset usage not supported by this repository")
+		return
+	}
+
+	name := datasetID
+	if entity, err := h.repo.GetByID(datasetID); err == nil && h.hasTag(entity.GetTagsWithoutTimestamp(), "type:dataset") {
+		name = entity.GetTagValue("name")
+	}
+
+	usage := binaryRepo.GetDatasetUsage(name)
+	if usage.Entities == 0 && name == datasetID {
+		existing, err := h.repo.ListByTags([]string{"type:dataset", "name:" + name}, true)
+		if err != nil || len(existing) == 0 {
+			RespondError(w, http.StatusNotFound, "Dataset not found")
+			return
+		}
+	}
+
+	RespondJSON(w, http.StatusOK, usage)
+}
+
+// CloneDataset copies a dataset into a new dataset
+// @Summary Clone dataset
+// @Description Copy every entity of a dataset into a new dataset, optionally with the tags the entities had at as_of. Copies get new IDs and a clone:source:<id> tag; tags referring to another copied entity are rewritten to its copy. Entities the caller cannot read are skipped. With async=true the clone is queued as a job and its result is reported by /api/v1/jobs/{id}.
+// @Tags datasets
+// @Accept json
+// @Produce json
+// @Param id path string true "Dataset entity ID or name"
+// @Param request body DatasetCloneRequest true "New dataset"
+// @Param async query bool false "Queue the clone as a background job"
+// @Success 201 {object} services.DatasetCloneResult
+// @Success 202 {object} JobStatus
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/datasets/{id}/clone [post]
+func (h *DatasetHandler) CloneDataset(w http.ResponseWriter, r *http.Request) {
+	var req DatasetCloneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	var asOf time.Time
+	if req.AsOf != "" {
+		var err error
+		if asOf, err = time.Parse(time.RFC3339Nano, req.AsOf); err != nil {
+			RespondError(w, http.StatusBadRequest, "as_of must be an RFC3339 timestamp such as 2025-05-21T08:45:20Z")
+			return
+		}
+		asOf = asOf.UTC()
+	}
+	source, err := h.service.ResolveDataset(mux.Vars(r)["id"])
+	if err != nil {
+		respondDatasetError(w, "clone", err)
+		return
+	}
+
+	user := requestUser(r)
+	if r.URL.Query().Get("async") == "true" {
+		job, err := h.jobs.Submit(datasetCloneJobType, requestUserID(r), func(job *Job) error {
+			result, err := h.service.Clone(job.Context(), source, req.Name, asOf, user)
+			if result != nil {
+				job.SetResult(result)
+			}
+			return err
+		})
+		if err != nil {
+			RespondError(w, http.StatusServiceUnavailable, "Failed to queue dataset clone: "+err.Error())
+			return
+		}
+		RespondJSON(w, http.StatusAccepted, job.Status())
+		return
+	}
+
+	result, err := h.service.Clone(context.Background(), source, req.Name, asOf, user)
+	if err != nil {
+		respondDatasetError(w, "clone", err)
+		return
+	}
+	RespondJSON(w, http.StatusCreated, result)
+}
+
+// PromoteDataset moves the entities of a dataset into another
+// @Summary Promote dataset
+// @Description Move every entity of a dataset, such as staging, into the target dataset, such as production, by replacing its dataset tag. The promotion applies to all entities or none: it is refused when the caller may not write every entity, and entities already moved are moved back when one fails. With async=true the promotion is queued as a job and its result is reported by /api/v1/jobs/{id}.
+// @Tags datasets
+// @Accept json
+// @Produce json
+// @Param id path string true "Dataset entity ID or name"
+// @Param request body DatasetPromoteRequest true "Target dataset"
+// @Param async query bool false "Queue the promotion as a background job"
+// @Success 200 {object} services.DatasetPromoteResult
+// @Success 202 {object} JobStatus
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/datasets/{id}/promote [post]
+func (h *DatasetHandler) PromoteDataset(w http.ResponseWriter, r *http.Request) {
+	var req DatasetPromoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	source, err := h.service.ResolveDataset(mux.Vars(r)["id"])
+	if err != nil {
+		respondDatasetError(w, "promote", err)
+		return
+	}
+
+	user := requestUser(r)
+	if r.URL.Query().Get("async") == "true" {
+		job, err := h.jobs.Submit(datasetPromoteJobType, requestUserID(r), func(job *Job) error {
+			result, err := h.service.Promote(job.Context(), source, req.Target, user)
+			if result != nil {
+				job.SetResult(result)
+			}
+			return err
+		})
+		if err != nil {
+			RespondError(w, http.StatusServiceUnavailable, "Failed to queue dataset promotion: "+err.Error())
+			return
+		}
+		RespondJSON(w, http.StatusAccepted, job.Status())
+		return
+	}
+
+	result, err := h.service.Promote(context.Background(), source, req.Target, user)
+	if err != nil {
+		respondDatasetError(w, "promote", err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
+
+// respondDatasetError maps dataset service errors to responses
+func respondDatasetError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, services.ErrDatasetNotFound):
+		RespondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrDatasetExists):
+		RespondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidDatasetOperation):
+		RespondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrDatasetForbidden):
+		RespondError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, binary.ErrDatasetQuotaExceeded):
+		RespondError(w, http.StatusInsufficientStorage, err.Error())
+	case isImmutableWrite(err):
+		RespondError(w, http.StatusConflict, err.Error())
+	default:
+		logger.Error("Failed to %s dataset: %v", action, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to "+action+" dataset: "+err.Error())
+	}
+}
+
 // Helper functions
 
 func (h *DatasetHandler) hasTag(tags []string, tag string) bool {
@@ -210,6 +437,25 @@ func (h *DatasetHandler) hasTag(tags []string, tag string) bool {
 	return false
 }
 
+// setPublicRead adds or removes the public:read tag that publishes a
+// dataset read-only
+func setPublicRead(entity *models.Entity, public bool) {
+	tags := make([]string, 0, len(entity.Tags)+1)
+	for _, tag := range entity.Tags {
+		actualTag := tag
+		if idx := strings.LastIndex(tag, "|"); idx != -1 {
+			actualTag = tag[idx+1:]
+		}
+		if !strings.HasPrefix(actualTag, "public:") {
+			tags = append(tags, tag)
+		}
+	}
+	if public {
+		tags = append(tags, binary.PublicReadTag)
+	}
+	entity.SetTags(tags)
+}
+
 func (h *DatasetHandler) marshalDatasetContent(req DatasetRequest) []byte {
 	content := map[string]interface{}{
 		"description": req.Description,
@@ -225,9 +471,11 @@ func (h *DatasetHandler) entityToDatasetResponse(entity *models.Entity) DatasetR
 	updatedAt := time.Unix(0, entity.UpdatedAt)
 	
 	resp := DatasetResponse{
-		ID:        entity.ID,
-		CreatedAt: createdAt,
-		UpdatedAt: updatedAt,
+		ID:         entity.ID,
+		PublicRead: entity.GetTagValue("public") == "read",
+		WriteOnce:  entity.HasTag(binary.WriteOnceTag),
+		CreatedAt:  createdAt,
+		UpdatedAt:  updatedAt,
 	}
 
 	// Extract dataset name and description from tags
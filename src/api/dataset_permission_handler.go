@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// DatasetPermissionHandler manages the permissions users hold within a
+// single dataset. Its routes require dataset:admin in the dataset, so
+// administrators of one dataset cannot touch the permissions of another.
+type DatasetPermissionHandler struct {
+	securityManager *models.SecurityManager
+}
+
+// NewDatasetPermissionHandler creates a new dataset permission handler
+func NewDatasetPermissionHandler(securityManager *models.SecurityManager) *DatasetPermissionHandler {
+	return &DatasetPermissionHandler{securityManager: securityManager}
+}
+
+// DatasetPermissionRequest grants or revokes permissions within a dataset
+// for the user named by UserID or Username
+type DatasetPermissionRequest struct {
+	UserID      string   `json:"user_id,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// DatasetUserPermissions lists a user's permissions within a dataset
+type DatasetUserPermissions struct {
+	UserID      string   `json:"user_id"`
+	Username    string   `json:"username"`
+	Permissions []string `json:"permissions"`
+}
+
+// DatasetPermissionsResponse lists the users holding permissions within a
+// dataset
+type DatasetPermissionsResponse struct {
+	Dataset string                   `json:"dataset"`
+	Users   []DatasetUserPermissions `json:"users"`
+}
+
+// ListPermissions lists the users holding permissions within a dataset
+// @Summary List dataset permissions
+// @Description List the users holding permissions granted within the dataset. Requires dataset:admin in the dataset.
+// @Tags datasets
+// @Produce json
+// @Param dataset path string true "Dataset name"
+// @Success 200 {object} DatasetPermissionsResponse
+// @Security BearerAuth
+// @Router /api/v1/datasets/{dataset}/permissions [get]
+func (h *DatasetPermissionHandler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	dataset := mux.Vars(r)["dataset"]
+	holders, err := h.securityManager.DatasetPermissionHolders(dataset)
+	if err != nil {
+		logger.Error("Failed to list permissions of dataset %s: %v", dataset, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to list dataset permissions")
+		return
+	}
+	users := make([]DatasetUserPermissions, 0, len(holders))
+	for _, holder := range holders {
+		users = append(users, datasetUserPermissions(holder, dataset))
+	}
+	RespondJSON(w, http.StatusOK, DatasetPermissionsResponse{Dataset: dataset, Users: users})
+}
+
+// GrantPermissions grants a user permissions within a dataset
+// @Summary Grant dataset permissions
+// @Description Grant a user permissions that apply only within the dataset: entity:view, entity:create, entity:update, entity:delete, entity:*, dataset:view, dataset:update or dataset:admin. Requires dataset:admin in the dataset.
+// @Tags datasets
+// @Accept json
+// @Produce json
+// @Param dataset path string true "Dataset name"
+// @Param body body DatasetPermissionRequest true "User and permissions"
+// @Success 200 {object} DatasetUserPermissions
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/datasets/{dataset}/permissions/grant [post]
+func (h *DatasetPermissionHandler) GrantPermissions(w http.ResponseWriter, r *http.Request) {
+	h.updatePermissions(w, r, h.securityManager.GrantDatasetPermissions, "granted")
+}
+
+// RevokePermissions removes permissions a user holds within a dataset
+// @Summary Revoke dataset permissions
+// @Description Remove permissions granted to a user within the dataset. Permissions the user does not hold are ignored; global permissions are never touched. Requires dataset:admin in the dataset.
+// @Tags datasets
+// @Accept json
+// @Produce json
+// @Param dataset path string true "Dataset name"
+// @Param body body DatasetPermissionRequest true "User and permissions"
+// @Success 200 {object} DatasetUserPermissions
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/datasets/{dataset}/permissions/revoke [post]
+func (h *DatasetPermissionHandler) RevokePermissions(w http.ResponseWriter, r *http.Request) {
+	h.updatePermissions(w, r, h.securityManager.RevokeDatasetPermissions, "revoked")
+}
+
+// updatePermissions applies a grant or revoke request with update
+func (h *DatasetPermissionHandler) updatePermissions(w http.ResponseWriter, r *http.Request, update func(userID, dataset string, perms []string) error, verb string) {
+	dataset := mux.Vars(r)["dataset"]
+	var req DatasetPermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.UserID == "" && req.Username == "" {
+		RespondError(w, http.StatusBadRequest, "Either user_id or username is required")
+		return
+	}
+
+	repo := h.securityManager.GetEntityRepo()
+	user := findUser(repo, req.UserID, req.Username)
+	if user == nil {
+		RespondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := update(user.ID, dataset, req.Permissions); err != nil {
+		if errors.Is(err, models.ErrInvalidDatasetPermission) {
+			RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Error("Failed to update permissions of user %s in dataset %s: %v", user.ID, dataset, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to update dataset permissions")
+		return
+	}
+
+	actor := ""
+	if securityCtx, ok := GetSecurityContext(r); ok {
+		actor = securityCtx.User.Username
+	}
+	logger.Info("Dataset permissions %v %s for user %s in dataset %s by %s", req.Permissions, verb, user.ID, dataset, actor)
+
+	updated, err := repo.GetByID(user.ID)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+	RespondJSON(w, http.StatusOK, datasetUserPermissions(updated, dataset))
+}
+
+// datasetUserPermissions describes the permissions of user within dataset
+func datasetUserPermissions(user *models.Entity, dataset string) DatasetUserPermissions {
+	perms := models.DatasetPermissions(user, dataset)
+	if perms == nil {
+		perms = []string{}
+	}
+	info := DatasetUserPermissions{UserID: user.ID, Permissions: perms}
+	for _, tag := range user.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, models.UsernameTagPrefix) {
+			info.Username = strings.TrimPrefix(tag, models.UsernameTagPrefix)
+			break
+		}
+	}
+	return info
+}
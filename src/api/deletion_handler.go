@@ -176,12 +176,16 @@ func (h *DeletionHandler) SoftDeleteEntity(w http.ResponseWriter, r *http.Reques
 	}
 	
 	// Get entity to delete
-	entity, err := h.repository.GetByID(entityID)
+	existing, err := h.repository.GetByID(entityID)
 	if err != nil {
 		logger.Warn("SoftDeleteEntity.entity_not_found %s: %v", entityID, err)
 		http.Error(w, "Entity not found", http.StatusNotFound)
 		return
 	}
+	entity := lifecycleCopy(existing)
+	if aclDenied(w, r, entity, models.ACLWrite) {
+		return
+	}
 	
 	// Check if entity is already deleted
 	if entity.GetLifecycleState() != models.StateActive {
@@ -222,6 +226,9 @@ func (h *DeletionHandler) SoftDeleteEntity(w http.ResponseWriter, r *http.Reques
 	
 	// Update entity in repository
 	if err := h.repository.Update(entity); err != nil {
+		if immutableRefused(w, err) {
+			return
+		}
 		logger.Error("SoftDeleteEntity.update_failed %s: %v", entityID, err)
 		http.Error(w, "Failed to update entity", http.StatusInternalServerError)
 		return
@@ -285,12 +292,16 @@ func (h *DeletionHandler) RestoreEntity(w http.ResponseWriter, r *http.Request)
 	}
 	
 	// Get entity to restore
-	entity, err := h.repository.GetByID(entityID)
+	existing, err := h.repository.GetByID(entityID)
 	if err != nil {
 		logger.Warn("RestoreEntity.entity_not_found %s: %v", entityID, err)
 		http.Error(w, "Entity not found", http.StatusNotFound)
 		return
 	}
+	entity := lifecycleCopy(existing)
+	if aclDenied(w, r, entity, models.ACLWrite) {
+		return
+	}
 	
 	// Check if entity can be restored
 	currentState := entity.GetLifecycleState()
@@ -322,6 +333,9 @@ func (h *DeletionHandler) RestoreEntity(w http.ResponseWriter, r *http.Request)
 	
 	// Update entity in repository
 	if err := h.repository.Update(entity); err != nil {
+		if immutableRefused(w, err) {
+			return
+		}
 		logger.Error("RestoreEntity.update_failed %s: %v", entityID, err)
 		http.Error(w, "Failed to update entity", http.StatusInternalServerError)
 		return
@@ -365,6 +379,9 @@ func (h *DeletionHandler) GetDeletionStatus(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Entity not found", http.StatusNotFound)
 		return
 	}
+	if aclDenied(w, r, entity, models.ACLRead) {
+		return
+	}
 	
 	// Build and return deletion status
 	status := h.buildDeletionStatusResponse(entity)
@@ -466,6 +483,8 @@ func (h *DeletionHandler) ListDeletedEntities(w http.ResponseWriter, r *http.Req
 		}
 	}
 	
+	allEntities = readableEntities(r, allEntities)
+	
 	// Apply additional filters
 	if deletedByFilter != "" {
 		filtered := make([]*models.Entity, 0)
@@ -570,6 +589,9 @@ func (h *DeletionHandler) PurgeEntity(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Entity not found", http.StatusNotFound)
 		return
 	}
+	if aclDenied(w, r, entity, models.ACLWrite) {
+		return
+	}
 	
 	// Check if entity can be purged (must be archived or soft deleted)
 	currentState := entity.GetLifecycleState()
@@ -579,6 +601,13 @@ func (h *DeletionHandler) PurgeEntity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Entities under legal hold must be kept until the hold is lifted
+	if entity.Lifecycle().IsOnLegalHold() {
+		logger.Warn("PurgeEntity.legal_hold %s", entityID)
+		http.Error(w, "Entity is under legal hold and cannot be purged", http.StatusConflict)
+		return
+	}
+	
 	// Log purge operation before deletion
 	logger.Info("PurgeEntity.executing %s: purged by %s, reason: %s, state: %s", 
 		entityID, user.ID, req.Reason, currentState)
@@ -605,6 +634,9 @@ func (h *DeletionHandler) PurgeEntity(w http.ResponseWriter, r *http.Request) {
 	
 	// Permanently remove entity from repository
 	if err := h.repository.Delete(entityID); err != nil {
+		if immutableRefused(w, err) {
+			return
+		}
 		logger.Error("PurgeEntity.delete_failed %s: %v", entityID, err)
 		http.Error(w, "Failed to purge entity", http.StatusInternalServerError)
 		return
@@ -612,6 +644,11 @@ func (h *DeletionHandler) PurgeEntity(w http.ResponseWriter, r *http.Request) {
 	
 	logger.Info("PurgeEntity.success %s: permanently removed by %s", entityID, user.ID)
 	
+	// Release shared content chunks now that this referrer is gone
+	if h.collector != nil {
+		h.collector.ReleaseChunks(entity)
+	}
+	
 	// Return success response
 	response := SuccessResponse{
 		Success: true,
@@ -626,6 +663,33 @@ func (h *DeletionHandler) PurgeEntity(w http.ResponseWriter, r *http.Request) {
 // Helper Methods
 // =============================================================================
 
+// lifecycleCopy returns a copy of entity for a lifecycle change, so a
+// rejected update leaves the stored entity untouched
+func lifecycleCopy(entity *models.Entity) *models.Entity {
+	return &models.Entity{
+		ID:        entity.ID,
+		Tags:      append([]string(nil), entity.Tags...),
+		Content:   entity.Content,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+	}
+}
+
+// aclDenied responds when an entity's ACL tags withhold the access from the
+// request's user: 404 when it cannot see the entity, 403 otherwise. It
+// reports whether a response was written.
+func aclDenied(w http.ResponseWriter, r *http.Request, entity *models.Entity, access models.ACLAccess) bool {
+	if !canAccessEntity(r, entity, models.ACLRead) {
+		http.Error(w, "Entity not found", http.StatusNotFound)
+		return true
+	}
+	if access == models.ACLWrite && !canAccessEntity(r, entity, models.ACLWrite) {
+		http.Error(w, "Entity ACL does not grant write access", http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
 // buildDeletionStatusResponse creates a DeletionStatusResponse from an entity
 func (h *DeletionHandler) buildDeletionStatusResponse(entity *models.Entity) DeletionStatusResponse {
 	status := DeletionStatusResponse{
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"entitydb/storage/binary"
+	"net/http"
+)
+
+// DurabilityHeader selects the durability of a request's writes: "strict"
+// returns once the write is fsynced to the WAL, "relaxed" may return while
+// it is queued for a group commit
+const DurabilityHeader = "X-EntityDB-Durability"
+
+// DurabilityMiddleware carries the durability a request selects with the
+// X-EntityDB-Durability header to the repository through the request context.
+// Requests without the header use the dataset's durability setting or the
+// configured default.
+type DurabilityMiddleware struct{}
+
+// NewDurabilityMiddleware creates a new durability middleware
+func NewDurabilityMiddleware() *DurabilityMiddleware {
+	return &DurabilityMiddleware{}
+}
+
+// Middleware returns the HTTP middleware function
+func (m *DurabilityMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(DurabilityHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mode, err := binary.ParseDurabilityMode(value)
+		if err != nil {
+			RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(binary.WithDurability(r.Context(), mode)))
+	})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"fmt"
+	"net/http"
+)
+
+// EncryptionHandler reports content encryption settings and re-encrypts
+// stored content after a master key rotation
+type EncryptionHandler struct {
+	repo models.EntityRepository
+	jobs *JobManager
+}
+
+// rekeyJobType identifies content re-encryption jobs
+const rekeyJobType = "encryption-rekey"
+
+// NewEncryptionHandler creates a new encryption handler
+func NewEncryptionHandler(repo models.EntityRepository, jobs *JobManager) *EncryptionHandler {
+	return &EncryptionHandler{repo: repo, jobs: jobs}
+}
+
+// EncryptionStatusResponse describes the content encryption settings
+type EncryptionStatusResponse struct {
+	Enabled   bool     `json:"enabled"`
+	ActiveKey string   `json:"active_key,omitempty"`
+	Keys      []string `json:"keys"`
+	RekeyJob  string   `json:"rekey_job,omitempty"`
+}
+
+// GetEncryptionStatus reports whether content is encrypted and which master keys are loaded
+// @Summary Get encryption status
+// @Description Report whether new content is encrypted at rest, the active master key and the key IDs in the key ring. Key material is never returned.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} EncryptionStatusResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/encryption [get]
+func (h *EncryptionHandler) GetEncryptionStatus(w http.ResponseWriter, r *http.Request) {
+	response := EncryptionStatusResponse{Keys: []string{}}
+	if encryptor := binary.GetContentEncryptor(); encryptor != nil {
+		response.Enabled = encryptor.Enabled()
+		response.ActiveKey = encryptor.ActiveKeyID()
+		response.Keys = encryptor.KeyIDs()
+	}
+	if active, ok := h.jobs.Active(rekeyJobType); ok {
+		response.RekeyJob = active.Status().ID
+	}
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// RekeyContent queues a job re-encrypting stored content with the active master key
+// @Summary Re-encrypt content
+// @Description Rewrite every entity whose content is not sealed with the active master key: after a key rotation, after encryption was enabled, or (when encryption is disabled) to store it in plaintext again. Tags and history are unchanged. Progress and the ContentRekeyResult are reported by /api/v1/jobs/{id}.
+// @Tags admin
+// @Produce json
+// @Success 202 {object} JobStatus
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/encryption/rekey [post]
+func (h *EncryptionHandler) RekeyContent(w http.ResponseWriter, r *http.Request) {
+	repo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Repository does not support re-encryption")
+		return
+	}
+	if active, ok := h.jobs.Active(rekeyJobType); ok {
+		RespondError(w, http.StatusConflict, "Re-encryption already in progress: job "+active.Status().ID)
+		return
+	}
+
+	job, err := h.jobs.Submit(rekeyJobType, requestUserID(r), func(job *Job) error {
+		result, err := repo.RekeyContent(job.Context(), func(processed, total int, entityID string, err error) {
+			if err != nil {
+				job.AddError(fmt.Errorf("%s: %w", entityID, err))
+			}
+			job.SetProgress(int64(processed), int64(total))
+		})
+		if result != nil {
+			job.SetResult(result)
+		}
+		return err
+	})
+	if err != nil {
+		RespondError(w, http.StatusServiceUnavailable, "Failed to queue re-encryption: "+err.Error())
+		return
+	}
+
+	logger.Info("Content re-encryption queued as job %s", job.Status().ID)
+	RespondJSON(w, http.StatusAccepted, job.Status())
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"entitydb/models"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// errDatasetRecordWrite refuses a write of a dataset or system dataset
+// entity outside the dataset endpoints
+var errDatasetRecordWrite = errors.New("writing dataset or system entities requires the dataset:update permission")
+
+// requestUser returns the authenticated user of a request, or nil
+func requestUser(r *http.Request) *models.SecurityUser {
+	if securityCtx, ok := GetSecurityContext(r); ok {
+		return securityCtx.User
+	}
+	return nil
+}
+
+// canAccessEntity reports whether the entity's ACL tags grant the request's
+// user the access; RBAC has been checked by the middleware
+func canAccessEntity(r *http.Request, entity *models.Entity, access models.ACLAccess) bool {
+	return models.CanAccessEntity(requestUser(r), entity, access)
+}
+
+// readableEntities drops the entities whose ACL hides them from the
+// request's user
+func readableEntities(r *http.Request, entities []*models.Entity) []*models.Entity {
+	return models.FilterReadableEntities(requestUser(r), entities)
+}
+
+// hiddenOrReadOnly responds for an entity the request may not change:
+// 404 when the user cannot see it, 403 when it can only read it. It
+// reports whether a response was written.
+func hiddenOrReadOnly(w http.ResponseWriter, r *http.Request, entity *models.Entity) bool {
+	if !canAccessEntity(r, entity, models.ACLRead) {
+		RespondError(w, http.StatusNotFound, "Entity not found")
+		return true
+	}
+	if !canAccessEntity(r, entity, models.ACLWrite) {
+		RespondError(w, http.StatusForbidden, "Entity ACL does not grant write access")
+		return true
+	}
+	return false
+}
+
+// visibleEntity returns an entity the request's user may read; entities
+// hidden by their ACL are reported as not found
+func (h *EntityHandler) visibleEntity(r *http.Request, id string) (*models.Entity, error) {
+	entity, err := h.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccessEntity(r, entity, models.ACLRead) {
+		return nil, models.ErrNotFound
+	}
+	return entity, nil
+}
+
+// historyEntity returns the current version of an entity whose history or
+// past versions are requested. History follows the entity's current ACL:
+// for an entity hidden from the user it returns models.ErrNotFound, so its
+// past tags and content stay hidden as well. An entity deleted since has no
+// ACL left to enforce and returns the repository's error.
+func historyEntity(repo models.EntityRepository, user *models.SecurityUser, id string) (*models.Entity, error) {
+	entity, err := repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !models.CanAccessEntity(user, entity, models.ACLRead) {
+		return nil, models.ErrNotFound
+	}
+	return entity, nil
+}
+
+// visibleChanges drops the changes of entities the request's user may not
+// read
+func (h *EntityHandler) visibleChanges(r *http.Request, changes []*models.EntityChange) []*models.EntityChange {
+	visible := make(map[string]bool)
+	filtered := changes[:0:0]
+	for _, change := range changes {
+		allowed, seen := visible[change.EntityID]
+		if !seen {
+			entity, err := h.repo.GetByID(change.EntityID)
+			// Changes of deleted entities carry no ACL to enforce
+			allowed = err != nil || canAccessEntity(r, entity, models.ACLRead)
+			visible[change.EntityID] = allowed
+		}
+		if allowed {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+// aclRepository is a read view of a repository hiding the entities whose
+// ACL withholds read access from a user. Handlers that walk from entity to
+// entity use it so hidden entities cannot be reached indirectly.
+type aclRepository struct {
+	models.EntityRepository
+	user *models.SecurityUser
+}
+
+// GetByID returns ErrNotFound for hidden entities
+func (ar aclRepository) GetByID(id string) (*models.Entity, error) {
+	entity, err := ar.EntityRepository.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !models.CanAccessEntity(ar.user, entity, models.ACLRead) {
+		return nil, models.ErrNotFound
+	}
+	return entity, nil
+}
+
+// ListByTag leaves out hidden entities
+func (ar aclRepository) ListByTag(tag string) ([]*models.Entity, error) {
+	entities, err := ar.EntityRepository.ListByTag(tag)
+	return models.FilterReadableEntities(ar.user, entities), err
+}
+
+// ListByTags leaves out hidden entities
+func (ar aclRepository) ListByTags(tags []string, matchAll bool) ([]*models.Entity, error) {
+	entities, err := ar.EntityRepository.ListByTags(tags, matchAll)
+	return models.FilterReadableEntities(ar.user, entities), err
+}
+
+// redactedEntity returns the entity with the sensitive content fields the
+// request's user may not see masked
+func redactedEntity(r *http.Request, entity *models.Entity) *models.Entity {
+	return models.RedactEntityFor(requestUser(r), entity)
+}
+
+// redactedEntities applies redactedEntity to each entity
+func redactedEntities(r *http.Request, entities []*models.Entity) []*models.Entity {
+	return models.RedactEntitiesFor(requestUser(r), entities)
+}
+
+// redactedVersion masks a historical version of an entity with the
+// sensitive paths of the version and of the current entity
+func redactedVersion(r *http.Request, version, current *models.Entity) *models.Entity {
+	return models.RedactVersionFor(requestUser(r), version, current)
+}
+
+// withholdsSensitiveContent reports whether the entity declares sensitive
+// fields the request's user may not see
+func withholdsSensitiveContent(r *http.Request, entity *models.Entity) bool {
+	return models.HasSensitiveContent(entity) && !models.CanViewSensitiveContent(requestUser(r))
+}
+
+// rejectSensitiveTagRemoval responds with 403 Forbidden when a user who may
+// not see an entity's sensitive fields would remove the tags declaring
+// them by giving it the tags. It reports whether a response was written.
+func rejectSensitiveTagRemoval(w http.ResponseWriter, r *http.Request, entity *models.Entity, tags []string) bool {
+	if !withholdsSensitiveContent(r, entity) || !models.DropsSensitivePaths(entity, tags) {
+		return false
+	}
+	RespondError(w, http.StatusForbidden, "Removing sensitive:content tags requires the entity:view_sensitive permission")
+	return true
+}
+
+// datasetRecordWriteRefused reports whether a write outside the dataset
+// endpoints would create or change a dataset entity or another system
+// dataset entity while the request's user may not update datasets. tagSets
+// are the entity's current tags, if it exists, and the tags the write gives
+// it.
+func datasetRecordWriteRefused(r *http.Request, tagSets ...[]string) bool {
+	return models.WritesDatasetRecord(tagSets...) && !models.CanManageDatasets(requestUser(r))
+}
+
+// rejectDatasetRecordWrite responds with 403 Forbidden when the write is
+// refused by datasetRecordWriteRefused. It reports whether a response was
+// written.
+func rejectDatasetRecordWrite(w http.ResponseWriter, r *http.Request, tagSets ...[]string) bool {
+	if !datasetRecordWriteRefused(r, tagSets...) {
+		return false
+	}
+	RespondError(w, http.StatusForbidden, errDatasetRecordWrite.Error())
+	return true
+}
+
+// withoutSensitiveMatches drops the entities a query matched on sensitive
+// fields the user may not see, so content filters and searches cannot
+// probe masked values
+func withoutSensitiveMatches(user *models.SecurityUser, entities []*models.Entity, params url.Values) []*models.Entity {
+	if filter := params.Get("filter"); models.IsContentPathField(filter) {
+		entities = models.FilterSensitiveMatches(user, entities, strings.TrimPrefix(filter, models.ContentPathPrefix))
+	}
+	if search := params.Get("search"); search != "" {
+		entities = models.FilterSensitiveSearchMatches(user, entities, search)
+	}
+	return entities
+}
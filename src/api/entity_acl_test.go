@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"entitydb/config"
+	"entitydb/models"
+	"entitydb/storage/binary"
+
+	"github.com/gorilla/mux"
+)
+
+// TestDatasetRecordWrites checks that the generic entity endpoints refuse to
+// create or change dataset entities and other system dataset entities for a
+// user who may not update datasets, and allow it for an admin
+func TestDatasetRecordWrites(t *testing.T) {
+	security := newTestSecurity(t)
+	handler := NewEntityHandler(security.repo)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/entities/create", security.middleware.RequirePermission("entity", "create")(handler.CreateEntity)).Methods("POST")
+	router.HandleFunc("/api/v1/entities/update", security.middleware.RequirePermission("entity", "update")(handler.UpdateEntity)).Methods("PUT")
+	router.HandleFunc("/api/v1/entities/patch-tags", security.middleware.RequirePermission("entity", "update")(handler.PatchEntityTags)).Methods("PATCH")
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	_, adminToken := security.login(t, "admin")
+	_, userToken := security.login(t, "alice")
+
+	dataset := &models.Entity{ID: "dataset-payroll", Tags: []string{"type:dataset", "dataset:system", "name:payroll"}}
+	if err := security.repo.Create(dataset); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	forbidden := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"create a dataset record", authorizedRequest("POST", "/api/v1/entities/create", userToken,
+			[]byte(`{"tags":["type:dataset","dataset:system","name:payroll","public:read"]}`))},
+		{"create a system dataset entity", authorizedRequest("POST", "/api/v1/entities/create", userToken,
+			[]byte(`{"tags":["type:document","dataset:system"]}`))},
+		{"update a dataset record", authorizedRequest("PUT", "/api/v1/entities/update", userToken,
+			[]byte(`{"id":"dataset-payroll","content":{"settings":{"quota_max_entities":"1"}}}`))},
+		{"lower the durability of a dataset record", authorizedRequest("PUT", "/api/v1/entities/update", userToken,
+			[]byte(`{"id":"dataset-payroll","content":{"settings":{"durability":"relaxed"}}}`))},
+		{"patch a dataset record", authorizedRequest("PATCH", "/api/v1/entities/patch-tags", userToken,
+			[]byte(`{"id":"dataset-payroll","add_tags":["public:read"]}`))},
+	}
+	for _, tc := range forbidden {
+		if rec := serve(tc.req); rec.Code != http.StatusForbidden {
+			t.Errorf("%s as alice = %d, want 403: %s", tc.name, rec.Code, rec.Body)
+		}
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if security.repo.IsPublicDataset("payroll") {
+		t.Fatal("alice published payroll")
+	}
+	if stored, err := security.repo.GetByID("dataset-payroll"); err != nil || len(stored.Content) != 0 {
+		t.Fatalf("alice changed the settings of payroll: %+v, %v", stored, err)
+	}
+
+	if rec := serve(authorizedRequest("POST", "/api/v1/entities/create", userToken,
+		[]byte(`{"tags":["type:document","dataset:default"]}`))); rec.Code != http.StatusCreated {
+		t.Errorf("create a document as alice = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(authorizedRequest("PATCH", "/api/v1/entities/patch-tags", adminToken,
+		[]byte(`{"id":"dataset-payroll","add_tags":["public:read"]}`))); rec.Code != http.StatusOK {
+		t.Fatalf("patch a dataset record as admin = %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if !security.repo.IsPublicDataset("payroll") {
+		t.Error("admin could not publish payroll")
+	}
+}
+
+// TestDatasetRecordUpserts checks that an upsert cannot make a dataset
+// write-once, neither by creating a dataset record nor by keying the real
+// one, unless the user may update datasets
+func TestDatasetRecordUpserts(t *testing.T) {
+	security := newTestSecurity(t)
+	handler := NewEntityHandler(security.repo)
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/entities/upsert", security.middleware.RequirePermission("entity", "create")(security.middleware.RequirePermission("entity", "update")(handler.UpsertEntity))).Methods("POST")
+	upsert := func(token, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, authorizedRequest("POST", "/api/v1/entities/upsert", token, []byte(body)))
+		return recorder
+	}
+
+	_, adminToken := security.login(t, "admin")
+	_, userToken := security.login(t, "alice")
+
+	dataset := &models.Entity{ID: "dataset-payroll", Tags: []string{"type:dataset", "dataset:system", "name:payroll", "id:payroll"}}
+	if err := security.repo.Create(dataset); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	if rec := upsert(userToken, `{"key":"id:payroll","tags":["write:once"]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("upsert of the dataset record as alice = %d, want 403: %s", rec.Code, rec.Body)
+	}
+	if rec := upsert(userToken, `{"key":"external:id:forged","tags":["type:dataset","dataset:system","name:payroll","write:once"]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("upsert creating a dataset record as alice = %d, want 403: %s", rec.Code, rec.Body)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if security.repo.IsWriteOnceDataset("payroll") {
+		t.Fatal("alice made payroll write-once")
+	}
+
+	if rec := upsert(adminToken, `{"key":"id:payroll","tags":["write:once"]}`); rec.Code != http.StatusOK {
+		t.Fatalf("upsert of the dataset record as admin = %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if !security.repo.IsWriteOnceDataset("payroll") {
+		t.Error("admin could not make payroll write-once")
+	}
+}
+
+// TestDatasetRecordUploads checks that a resumable upload cannot create a
+// dataset or system dataset entity for a user who may not update datasets
+func TestDatasetRecordUploads(t *testing.T) {
+	security := newTestSecurity(t)
+	handler := NewUploadHandler(security.repo, config.Load())
+	init := security.middleware.RequirePermission("entity", "create")(handler.InitUpload)
+	_, adminToken := security.login(t, "admin")
+	_, userToken := security.login(t, "alice")
+
+	for _, body := range []string{
+		`{"tags":["type:dataset","dataset:system","name:payroll","public:read"]}`,
+		`{"tags":["type:document","dataset:system"]}`,
+	} {
+		recorder := httptest.NewRecorder()
+		init(recorder, authorizedRequest("POST", "/api/v1/entities/upload/init", userToken, []byte(body)))
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("upload of %s as alice = %d, want 403: %s", body, recorder.Code, recorder.Body)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	init(recorder, authorizedRequest("POST", "/api/v1/entities/upload/init", adminToken, []byte(`{"tags":["type:dataset","dataset:system","name:payroll"]}`)))
+	if recorder.Code != http.StatusCreated {
+		t.Errorf("upload of a dataset record as admin = %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+// TestCountEntitiesACL checks that counts and their groups leave out the
+// entities whose ACL hides them from the user
+func TestCountEntitiesACL(t *testing.T) {
+	security := newTestSecurity(t)
+	handler := NewEntityHandler(security.repo)
+	count := security.middleware.RequirePermission("entity", "view")(handler.CountEntities)
+	_, aliceToken := security.login(t, "alice")
+	_, bobToken := security.login(t, "bob")
+
+	for _, entity := range []*models.Entity{
+		{ID: "doc-open", Tags: []string{"type:document", "status:open"}},
+		{ID: "doc-bob", Tags: []string{"type:document", "status:open", "acl:read:user:bob"}},
+		{ID: "doc-secret", Tags: []string{"type:document", "status:secret", "acl:read:user:bob"}},
+	} {
+		if err := security.repo.Create(entity); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	for _, tc := range []struct {
+		user   string
+		token  string
+		count  int
+		groups []binary.TagValueCount
+	}{
+		{"alice", aliceToken, 1, []binary.TagValueCount{{Value: "open", Count: 1}}},
+		{"bob", bobToken, 3, []binary.TagValueCount{{Value: "open", Count: 2}, {Value: "secret", Count: 1}}},
+	} {
+		recorder := httptest.NewRecorder()
+		count(recorder, authorizedRequest("GET", "/api/v1/entities/count?tag=type:document&group_by=status", tc.token, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("count as %s = %d: %s", tc.user, recorder.Code, recorder.Body)
+		}
+		var counts binary.TagCounts
+		if err := json.Unmarshal(recorder.Body.Bytes(), &counts); err != nil {
+			t.Fatalf("decode count: %v", err)
+		}
+		if counts.Count != tc.count || !reflect.DeepEqual(counts.Groups, tc.groups) || counts.TotalGroups != len(tc.groups) {
+			t.Errorf("count as %s = %+v, want %d in %+v", tc.user, counts, tc.count, tc.groups)
+		}
+	}
+}
+
+// TestHistoryFollowsACL checks that the history and past versions of an
+// entity are hidden from a user its current ACL hides it from
+func TestHistoryFollowsACL(t *testing.T) {
+	security := newTestSecurity(t)
+	handler := NewEntityHandler(security.repo)
+	history := security.middleware.RequirePermission("entity", "view")(handler.GetEntityHistory)
+	asOf := security.middleware.RequirePermission("entity", "view")(handler.GetEntityAsOf)
+	_, aliceToken := security.login(t, "alice")
+	_, bobToken := security.login(t, "bob")
+
+	if err := security.repo.Create(&models.Entity{ID: "doc-bob", Tags: []string{"type:document", "acl:read:user:bob"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	now := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+
+	for _, tc := range []struct {
+		user  string
+		token string
+		want  int
+	}{
+		{"alice", aliceToken, http.StatusNotFound},
+		{"bob", bobToken, http.StatusOK},
+	} {
+		recorder := httptest.NewRecorder()
+		history(recorder, authorizedRequest("GET", "/api/v1/entities/history?id=doc-bob", tc.token, nil))
+		if recorder.Code != tc.want {
+			t.Errorf("history as %s = %d, want %d: %s", tc.user, recorder.Code, tc.want, recorder.Body)
+		}
+		recorder = httptest.NewRecorder()
+		asOf(recorder, authorizedRequest("GET", "/api/v1/entities/as-of?id=doc-bob&as_of="+now, tc.token, nil))
+		if recorder.Code != tc.want {
+			t.Errorf("as-of as %s = %d, want %d: %s", tc.user, recorder.Code, tc.want, recorder.Body)
+		}
+	}
+}
@@ -25,13 +25,17 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"entitydb/models"
+	"entitydb/services"
 	"entitydb/storage/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -69,7 +73,7 @@ import (
 // Security Note:
 //   Implements proper AND logic to prevent multi-tenancy vulnerabilities
 //   where OR logic could expose data across tenant boundaries.
-func (h *EntityHandler) intersectTagQueries(tags []string) ([]*models.Entity, error) {
+func (h *EntityHandler) intersectTagQueries(ctx context.Context, tags []string) ([]*models.Entity, error) {
 	if len(tags) == 0 {
 		return []*models.Entity{}, nil
 	}
@@ -82,10 +86,11 @@ func (h *EntityHandler) intersectTagQueries(tags []string) ([]*models.Entity, er
 	}, len(tags))
 	
 	for i, tag := range tags {
-		entities, err := h.repo.ListByTag(tag)
+		entities, err := repoListByTag(ctx, h.repo, tag)
 		if err != nil {
 			return nil, err
 		}
+		binary.RequestStatsFrom(ctx).RecordIndexLookup(entities)
 		
 		// EARLY TERMINATION: If any tag has no results, intersection is empty
 		if len(entities) == 0 {
@@ -200,7 +205,9 @@ func (h *EntityHandler) intersectEntitySetsOptimized(set1, set2 []*models.Entity
 //   - Query: Advanced querying with filters and sorting
 //   - Temporal: Historical queries (as-of, history, changes, diff)
 type EntityHandler struct {
-	repo models.EntityRepository
+	repo       models.EntityRepository
+	locks      *services.EntityLockService
+	identities *models.SecurityManager
 }
 
 // NewEntityHandler creates a new EntityHandler with the given repository.
@@ -212,6 +219,17 @@ func NewEntityHandler(repo models.EntityRepository) *EntityHandler {
 	}
 }
 
+// SetLockService makes updates honor entity locks when they are enforced
+func (h *EntityHandler) SetLockService(locks *services.EntityLockService) {
+	h.locks = locks
+}
+
+// SetSecurityManager makes writes claiming identity tags hold the identity
+// lock of the security manager, so they cannot race user creation
+func (h *EntityHandler) SetSecurityManager(sm *models.SecurityManager) {
+	h.identities = sm
+}
+
 // stripTimestampsFromEntity returns a copy of the entity with timestamps conditionally removed from tags.
 //
 // EntityDB stores all tags with nanosecond timestamps in the format "TIMESTAMP|tag".
@@ -253,6 +271,59 @@ func asTemporalRepository(repo models.EntityRepository) (*binary.EntityRepositor
 	return nil, fmt.Errorf("repository does not support temporal features")
 }
 
+// setChangeCounterHeaders exposes the entity and dataset change counters as
+// response headers so clients can validate caches without diffing tags.
+func setChangeCounterHeaders(w http.ResponseWriter, repo models.EntityRepository, entity *models.Entity) {
+	binaryRepo, err := asTemporalRepository(repo)
+	if err != nil || entity == nil {
+		return
+	}
+	
+	version := strconv.FormatUint(binaryRepo.GetEntityChangeCounter(entity), 10)
+	w.Header().Set("X-Entity-Version", version)
+	w.Header().Set("ETag", `"`+version+`"`)
+	if dataset := entity.GetDataset(); dataset != "" {
+		w.Header().Set("X-Dataset-Version", strconv.FormatUint(binaryRepo.GetDatasetChangeCounter(dataset), 10))
+	}
+}
+
+// setQuotaWarningHeader flags a write that left the entity's dataset past a
+// quota enforced in warn mode
+func setQuotaWarningHeader(w http.ResponseWriter, repo models.EntityRepository, entity *models.Entity) {
+	binaryRepo, err := asTemporalRepository(repo)
+	if err != nil || entity == nil {
+		return
+	}
+	if dataset := entity.GetDataset(); dataset != "" && binaryRepo.GetDatasetUsage(dataset).QuotaExceeded {
+		w.Header().Set("X-Dataset-Quota-Exceeded", dataset)
+	}
+}
+
+// conditionalUpdater is implemented by repositories that can reject updates
+// based on a stale entity version
+type conditionalUpdater interface {
+	UpdateIfVersion(entity *models.Entity, expectedVersion uint64) error
+}
+
+// parseIfMatch parses an If-Match header into entity versions. Entity tags may
+// be quoted or weak (W/"123"). A "*" matches any existing entity and is
+// reported through any.
+func parseIfMatch(header string) (versions []uint64, any bool, err error) {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" {
+			return nil, true, nil
+		}
+		part = strings.Trim(strings.TrimPrefix(part, "W/"), `"`)
+		version, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid entity tag %q", part)
+		}
+		versions = append(versions, version)
+	}
+	return versions, false, nil
+}
+
 // parseInt safely parses a string to an integer using fmt.Sscanf.
 //
 // This is more strict than strconv.Atoi and ensures the entire string is a valid integer
@@ -310,7 +381,8 @@ type CreateEntityRequest struct {
 // Error Responses:
 //   - 400 Bad Request: Invalid request body or content type
 //   - 401 Unauthorized: Missing or invalid authentication
-//   - 403 Forbidden: User lacks entity:create permission
+//   - 403 Forbidden: User lacks entity:create permission, or lacks
+//     dataset:update and the entity is a dataset or system dataset entity
 //   - 500 Internal Server Error: Failed to create entity
 //
 // Features:
@@ -344,6 +416,12 @@ func (h *EntityHandler) CreateEntity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.createEntity(w, r, req, includeTimestamps)
+}
+
+// createEntity creates the entity described by a create request and writes
+// the response
+func (h *EntityHandler) createEntity(w http.ResponseWriter, r *http.Request, req CreateEntityRequest, includeTimestamps bool) {
 	// Get security context to determine creator (v2.32.0+ modern RBAC)
 	securityCtx, ok := GetSecurityContext(r)
 	if !ok {
@@ -351,169 +429,132 @@ func (h *EntityHandler) CreateEntity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Determine entity type from tags (look for type: tag)
-	entityType := "entity" // default type
-	additionalTags := []string{}
-	
-	for _, tag := range req.Tags {
-		if strings.HasPrefix(tag, "type:") {
-			entityType = strings.TrimPrefix(tag, "type:")
-		} else {
-			// Add non-type tags to additional tags
-			additionalTags = append(additionalTags, tag)
-		}
-	}
-
-	// Determine dataset - extract from URL path for dataset-scoped routes, fallback to request or default
-	dataset := "default"
-	
-	// First priority: Extract from URL path (e.g., /datasets/{dataset}/entities/create)
-	if pathDataset := extractDatasetFromPath(r.URL.Path); pathDataset != "" {
-		dataset = pathDataset
-	} else {
-		// Fallback: Check request body tags (for legacy global routes)
-		for _, tag := range req.Tags {
-			if strings.HasPrefix(tag, "dataset:") {
-				dataset = strings.TrimPrefix(tag, "dataset:")
-				break
-			}
-		}
-	}
-	
-	// SECURITY: Prevent dataset override in request body when using dataset-scoped routes
-	// Remove any dataset: tags from request to enforce URL path as single source of truth
-	filteredTags := []string{}
-	for _, tag := range additionalTags {
-		if !strings.HasPrefix(tag, "dataset:") {
-			filteredTags = append(filteredTags, tag)
-		}
-	}
-	additionalTags = filteredTags
-
-	// Create entity using UUID architecture with mandatory tags
-	entity, err := models.NewEntityWithMandatoryTags(
-		entityType,                // entityType
-		dataset,                   // dataset
-		securityCtx.User.ID,      // createdBy (current authenticated user)
-		additionalTags,           // additional tags (excluding type: and dataset: which are handled automatically)
-	)
+	entity, err := newRequestEntity(r, req.Tags, securityCtx.User.ID)
 	if err != nil {
-		logger.Error("Failed to create entity with UUID architecture: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to create entity with UUID architecture: %v", err)
 		RespondError(w, http.StatusInternalServerError, "Failed to create entity")
 		return
 	}
+	defer h.lockIdentities(entity.Tags)()
+	if rejectDatasetRecordWrite(w, r, entity.Tags) || rejectDuplicateIdentity(w, h.repo, "", entity.Tags) {
+		return
+	}
+	logger.SetEntityID(r.Context(), entity.ID)
 
 	// If a specific ID was requested, use it (but preserve UUID generation for system integrity)
 	if req.ID != "" {
 		// Note: In UUID architecture, IDs are auto-generated for integrity
 		// We log the requested ID but use the generated UUID
-		logger.Info("Requested entity ID '%s' overridden with generated UUID: %s", req.ID, entity.ID)
+		logger.InfoContext(r.Context(), "Requested entity ID '%s' overridden with generated UUID: %s", req.ID, entity.ID)
 	}
 
 	// Handle content if provided
 	if req.Content != nil {
-		var contentBytes []byte
-		var contentType string
-		
-		switch content := req.Content.(type) {
-		case string:
-			// String content - store directly as bytes without any wrapper or encoding
-			contentBytes = []byte(content)
-			contentType = "text/plain" // Standard MIME type for plain text
-			logger.TraceIf("storage", "storing text content: length=%d", len(contentBytes))
-		case map[string]interface{}:
-			// JSON object
-			jsonBytes, err := json.Marshal(content)
-			if err != nil {
-				RespondError(w, http.StatusBadRequest, "Invalid JSON content")
-				return
-			}
-			contentBytes = jsonBytes
-			contentType = "application/json"
-		case []interface{}:
-			// JSON array
-			jsonBytes, err := json.Marshal(content)
-			if err != nil {
-				RespondError(w, http.StatusBadRequest, "Invalid JSON content")
-				return
-			}
-			contentBytes = jsonBytes
-			contentType = "application/json"
-		default:
-			RespondError(w, http.StatusBadRequest, "Unsupported content type")
+		contentBytes, contentType, err := decodeRequestContent(req.Content)
+		if err != nil {
+			RespondError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 		
-		// Check if content is large enough for chunking
-		config := models.DefaultChunkConfig()
-		if int64(len(contentBytes)) > config.AutoChunkThreshold {
-			// Use SetContent for autochunking
-			reader := bytes.NewReader(contentBytes)
-			chunkIDs, err := entity.SetContent(reader, contentType, config)
-			if err != nil {
-				RespondError(w, http.StatusInternalServerError, "Failed to chunk content")
-				return
-			}
-			
-			// Create chunk entities
-			// Split content back into chunks
-			chunkSize := int(config.DefaultChunkSize)
-			for i := 0; i < len(contentBytes); i += chunkSize {
-				end := i + chunkSize
-				if end > len(contentBytes) {
-					end = len(contentBytes)
-				}
-				
-				chunkIndex := i / chunkSize
-				if chunkIndex < len(chunkIDs) {
-					chunkEntity := models.CreateChunkEntity(entity.ID, chunkIndex, contentBytes[i:end])
-					if err := h.repo.Create(chunkEntity); err != nil {
-						RespondError(w, http.StatusInternalServerError, "Failed to create chunk entity")
-						return
-					}
-				}
-			}
-		} else {
-			// Small content - store directly
-			entity.Content = contentBytes
-			
-			// Clear any existing content type tags to avoid duplicates
-			entity.Tags = removeTagsByPrefix(entity.Tags, "content:type:")
-			
-			// Add the correct content type tag
-			entity.AddTag("content:type:" + contentType)
-			
-			logger.TraceIf("storage", "set content type: %s", contentType)
+		if err := setEntityContent(h.repo, entity, contentBytes, contentType); err != nil {
+			logger.ErrorContext(r.Context(), "failed to store content for %s: %v", entity.ID, err)
+			RespondError(w, http.StatusInternalServerError, "Failed to store content")
+			return
 		}
 	}
 
 	// Save entity
-	err = h.repo.Create(entity)
+	err = repoCreate(r.Context(), h.repo, entity)
+	if errors.Is(err, binary.ErrDatasetQuotaExceeded) {
+		RespondError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	}
 	if err != nil {
-		logger.Error("failed to create entity %s: %v", entity.ID, err)
+		logger.ErrorContext(r.Context(), "failed to create entity %s: %v", entity.ID, err)
 		TrackHTTPError("entity_handler.CreateEntity", http.StatusInternalServerError, err)
 		RespondError(w, http.StatusInternalServerError, "Failed to create entity")
 		return
 	}
 	
 	// Verify entity was saved properly
-	saved, err := h.repo.GetByID(entity.ID)
+	saved, err := repoGetByID(r.Context(), h.repo, entity.ID)
 	if err != nil {
-		logger.Warn("entity created but verification failed: id=%s, error=%v", entity.ID, err)
+		logger.WarnContext(r.Context(), "entity created but verification failed: id=%s, error=%v", entity.ID, err)
 		// Continue anyway to return what we have
 	} else {
-		logger.Info("entity created: id=%s", entity.ID)
+		logger.InfoContext(r.Context(), "entity created: id=%s", entity.ID)
 		entity = saved
 	}
 
 	// Return created entity
-	response := h.stripTimestampsFromEntity(entity, includeTimestamps)
+	setChangeCounterHeaders(w, h.repo, entity)
+	setQuotaWarningHeader(w, h.repo, entity)
+	response := h.stripTimestampsFromEntity(redactedEntity(r, entity), includeTimestamps)
 	// Ensure the entity is properly retrieved after creation
 	// No need to manually base64 encode - JSON marshaling handles []byte automatically
 	logger.TraceIf("storage", "created entity: id=%s, content_size=%d", entity.ID, len(entity.Content))
 	RespondJSON(w, http.StatusCreated, response)
 }
 
+// newRequestEntity creates an entity with the mandatory tags from the tags of
+// a create request. The type: tag sets the entity type. The dataset comes
+// from the URL path of dataset-scoped routes, else from a dataset: tag, else
+// the user's default dataset, else "default"; dataset: tags are never copied
+// so the path stays the single source of truth.
+func newRequestEntity(r *http.Request, tags []string, createdBy string) (*models.Entity, error) {
+	entityType := "entity" // default type
+	additionalTags := []string{}
+	dataset := "default"
+	if securityCtx, ok := GetSecurityContext(r); ok {
+		if userDataset := defaultDataset(securityCtx.User.Entity); userDataset != "" {
+			dataset = userDataset
+		}
+	}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, "type:") {
+			entityType = strings.TrimPrefix(tag, "type:")
+		} else if !strings.HasPrefix(tag, "dataset:") {
+			additionalTags = append(additionalTags, tag)
+		}
+	}
+
+	// First priority: Extract from URL path (e.g., /datasets/{dataset}/entities/create)
+	if pathDataset := extractDatasetFromPath(r.URL.Path); pathDataset != "" {
+		dataset = pathDataset
+	} else {
+		// Fallback: Check request body tags (for legacy global routes)
+		for _, tag := range tags {
+			if strings.HasPrefix(tag, "dataset:") {
+				dataset = strings.TrimPrefix(tag, "dataset:")
+				break
+			}
+		}
+	}
+
+	// Create entity using UUID architecture with mandatory tags
+	return models.NewEntityWithMandatoryTags(entityType, dataset, createdBy, additionalTags)
+}
+
+// decodeRequestContent converts the content of a create request to bytes and
+// a content type: strings are stored as text/plain, JSON objects and arrays
+// as application/json
+func decodeRequestContent(content interface{}) ([]byte, string, error) {
+	switch content := content.(type) {
+	case string:
+		// String content - store directly as bytes without any wrapper or encoding
+		logger.TraceIf("storage", "storing text content: length=%d", len(content))
+		return []byte(content), "text/plain", nil
+	case map[string]interface{}, []interface{}:
+		jsonBytes, err := json.Marshal(content)
+		if err != nil {
+			return nil, "", errors.New("Invalid JSON content")
+		}
+		return jsonBytes, "application/json", nil
+	default:
+		return nil, "", errors.New("Unsupported content type")
+	}
+}
+
 // GetEntity handles retrieving an entity by ID.
 //
 // HTTP Method: GET
@@ -568,13 +609,25 @@ func (h *EntityHandler) GetEntity(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get entity from repository
-	entity, err := h.repo.GetByID(id)
+	entity, err := repoGetByID(r.Context(), h.repo, id)
 	if err != nil {
-		logger.Warn("Entity not found: id=%s", id)
+		logger.WarnContext(r.Context(), "Entity not found: id=%s", id)
 		TrackHTTPError("entity_handler.GetEntity", http.StatusNotFound, err)
 		RespondError(w, http.StatusNotFound, "Entity not found")
 		return
 	}
+	if outsidePathDataset(r, entity) || !canAccessEntity(r, entity, models.ACLRead) {
+		RespondError(w, http.StatusNotFound, "Entity not found")
+		return
+	}
+	recordEntityAccess(r, []*models.Entity{entity}, nil)
+
+	// Answer unchanged entities before any content is reassembled
+	setChangeCounterHeaders(w, h.repo, entity)
+	etag := `"` + strconv.FormatUint(entityVersion(h.repo, entity), 10) + `"`
+	if notModified(w, r, etag, lastModified([]*models.Entity{entity})) {
+		return
+	}
 
 	// Check if content should be included
 	includeContent := r.URL.Query().Get("include_content") == "true"
@@ -582,7 +635,8 @@ func (h *EntityHandler) GetEntity(w http.ResponseWriter, r *http.Request) {
 	// Use our fixed implementation in entity_handler_fix.go
 	if includeContent && entity.IsChunked() {
 		// Check if the request prefers streaming (better for large files)
-		if r.URL.Query().Get("stream") == "true" {
+		// Content with sensitive fields is reassembled so it can be redacted
+		if r.URL.Query().Get("stream") == "true" && !withholdsSensitiveContent(r, entity) {
 			// Stream content directly to the client
 			logger.TraceIf("chunking", "streaming chunked content: entity_id=%s", id)
 			h.StreamChunkedEntityContent(w, r)
@@ -614,14 +668,15 @@ func (h *EntityHandler) GetEntity(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return entity
-	response := h.stripTimestampsFromEntity(entity, includeTimestamps)
+	response := h.stripTimestampsFromEntity(redactedEntity(r, entity), includeTimestamps)
 	// Log content details for debugging
 	logger.TraceIf("storage", "retrieved entity: id=%s, content_size=%d, tag_count=%d", entity.ID, len(entity.Content), len(entity.Tags))
 	// No need to manually base64 encode - JSON marshaling handles []byte automatically
 	RespondJSON(w, http.StatusOK, response)
 }
 
-// StreamEntity handles direct streaming of entity content, including chunked entities
+// StreamEntity handles direct streaming of entity content, including chunked entities.
+// Supports HTTP Range requests (Accept-Ranges: bytes) for resumable downloads and seeking.
 func (h *EntityHandler) StreamEntity(w http.ResponseWriter, r *http.Request) {
 	// Get entity ID
 	id := r.URL.Query().Get("id")
@@ -631,9 +686,9 @@ func (h *EntityHandler) StreamEntity(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get entity from repository
-	entity, err := h.repo.GetByID(id)
-	if err != nil {
-		logger.Warn("Entity not found: id=%s", id)
+	entity, err := repoGetByID(r.Context(), h.repo, id)
+	if err != nil || !canAccessEntity(r, entity, models.ACLRead) {
+		logger.WarnContext(r.Context(), "Entity not found: id=%s", id)
 		RespondError(w, http.StatusNotFound, "Entity not found")
 		return
 	}
@@ -647,7 +702,8 @@ func (h *EntityHandler) StreamEntity(w http.ResponseWriter, r *http.Request) {
 
 	// Get content type from entity tags
 	contentType := "application/octet-stream"
-	for _, tag := range entity.Tags {
+	cleanTags := entity.GetTagsWithoutTimestamp()
+	for _, tag := range cleanTags {
 		if strings.HasPrefix(tag, "content:type:") {
 			parts := strings.SplitN(tag, "content:type:", 2)
 			if len(parts) == 2 {
@@ -663,7 +719,7 @@ func (h *EntityHandler) StreamEntity(w http.ResponseWriter, r *http.Request) {
 	chunkSize := int64(0)
 	totalSize := int64(0)
 
-	for _, tag := range entity.Tags {
+	for _, tag := range cleanTags {
 		if strings.HasPrefix(tag, "content:chunks:") {
 			parts := strings.SplitN(tag, "content:chunks:", 2)
 			if len(parts) == 2 {
@@ -690,56 +746,96 @@ func (h *EntityHandler) StreamEntity(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", id))
 
-	if isChunked && chunkCount > 0 {
-		// This is a chunked entity - stream chunks
-		logger.TraceIf("chunking", "streaming chunked entity: id=%s, chunks=%d, total_size=%d",
-			id, chunkCount, totalSize)
-
-		if totalSize > 0 {
-			w.Header().Set("Content-Length", fmt.Sprintf("%d", totalSize))
-		}
-
-		// Stream each chunk
-		for i := 0; i < chunkCount; i++ {
-			chunkID := fmt.Sprintf("%s-chunk-%d", entity.ID, i)
-			logger.TraceIf("chunking", "fetching chunk: %d/%d, id=%s", i+1, chunkCount, chunkID)
-			
-			chunkEntity, err := h.repo.GetByID(chunkID)
-			if err != nil {
-				logger.Error("failed to get chunk %s: %v", chunkID, err)
-				continue
-			}
-			
-			logger.TraceIf("chunking", "retrieved chunk: %d/%d, size=%d", i+1, chunkCount, len(chunkEntity.Content))
-			
-			// Write chunk content directly to response
-			if _, err := w.Write(chunkEntity.Content); err != nil {
-				logger.Error("failed to write chunk to response: %v", err)
+	// Content is served through http.ServeContent, which handles Range,
+	// If-Range and multi-range requests so interrupted downloads can resume
+	// and clients can seek within large content.
+	modTime := time.Unix(0, entity.UpdatedAt)
+
+	// Content with sensitive fields is read whole so it can be redacted
+	if withholdsSensitiveContent(r, entity) {
+		content := entity.Content
+		if isChunked && chunkCount > 0 {
+			if content, err = h.HandleChunkedContent(id, true); err != nil {
+				logger.Error("failed to reassemble chunked content for %s: %v", id, err)
+				RespondError(w, http.StatusInternalServerError, "Failed to read content")
 				return
 			}
-			
-			// Flush after each chunk
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
-			}
 		}
-	} else {
-		// Not chunked - stream the main entity's content
-		if len(entity.Content) == 0 {
-			RespondError(w, http.StatusNotFound, "Entity has no content")
+		visible := redactedEntity(r, &models.Entity{
+			ID:        entity.ID,
+			Tags:      entity.Tags,
+			Content:   content,
+			CreatedAt: entity.CreatedAt,
+			UpdatedAt: entity.UpdatedAt,
+		})
+		http.ServeContent(w, r, "", modTime, bytes.NewReader(visible.Content))
+		return
+	}
+
+	if isChunked && chunkCount > 0 {
+		if chunkSize <= 0 || totalSize <= 0 {
+			// Without a fixed chunk size offsets cannot be computed; stream sequentially
+			h.streamChunksSequentially(w, entity, chunkCount, totalSize)
 			return
 		}
-		
-		logger.TraceIf("chunking", "streaming entity content: id=%s, size=%d", 
-			id, len(entity.Content))
-		
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(entity.Content)))
-		
-		// Write content directly
-		if _, err := w.Write(entity.Content); err != nil {
-			logger.Error("failed to write content to response: %v", err)
+
+		logger.TraceIf("chunking", "serving chunked entity: id=%s, chunks=%d, total_size=%d, range=%q",
+			id, chunkCount, totalSize, r.Header.Get("Range"))
+
+		chunkIDs := entity.ChunkIDs()
+		chunks := h.readChunksAhead(chunkIDs)
+		defer chunks.Close()
+		http.ServeContent(w, r, "", modTime, newChunkedContentReader(chunks, chunkIDs, chunkSize, totalSize))
+		return
+	}
+
+	// Not chunked - serve the main entity's content
+	if len(entity.Content) == 0 {
+		RespondError(w, http.StatusNotFound, "Entity has no content")
+		return
+	}
+
+	logger.TraceIf("chunking", "serving entity content: id=%s, size=%d, range=%q",
+		id, len(entity.Content), r.Header.Get("Range"))
+
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(entity.Content))
+}
+
+// streamChunksSequentially writes every chunk of an entity in order without range support
+func (h *EntityHandler) streamChunksSequentially(w http.ResponseWriter, entity *models.Entity, chunkCount int, totalSize int64) {
+	logger.TraceIf("chunking", "streaming chunked entity: id=%s, chunks=%d, total_size=%d",
+		entity.ID, chunkCount, totalSize)
+
+	if totalSize > 0 {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", totalSize))
+	}
+
+	// Stream each chunk, fetching the following chunks while this one is sent
+	chunkIDs := entity.ChunkIDs()
+	if len(chunkIDs) > chunkCount {
+		chunkIDs = chunkIDs[:chunkCount]
+	}
+	chunks := h.readChunksAhead(chunkIDs)
+	defer chunks.Close()
+	for i, chunkID := range chunkIDs {
+		content, err := chunks.Next()
+		if err != nil {
+			logger.Error("failed to get chunk %s: %v", chunkID, err)
+			abortChunkStream()
+		}
+
+		logger.TraceIf("chunking", "retrieved chunk: %d/%d, size=%d", i+1, chunkCount, len(content))
+
+		// Write chunk content directly to response
+		if _, err := w.Write(content); err != nil {
+			logger.Error("failed to write chunk to response: %v", err)
 			return
 		}
+
+		// Flush after each chunk
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
 	}
 }
 
@@ -812,9 +908,13 @@ func (h *EntityHandler) ListEntities(w http.ResponseWriter, r *http.Request) {
 	search := r.URL.Query().Get("search")
 	contentType := r.URL.Query().Get("contentType")
 	namespace := r.URL.Query().Get("namespace")
+	projection, err := responseProjection(r.URL.Query())
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	
 	var entities []*models.Entity
-	var err error
 	
 	// Collect query tags for metrics
 	var queryTags []string
@@ -839,6 +939,19 @@ func (h *EntityHandler) ListEntities(w http.ResponseWriter, r *http.Request) {
 		queryType = "list_all"
 	}
 	
+	// Estimate cost and apply admission control before touching storage
+	spec := binary.QuerySpec{Wildcard: wildcard, Search: search, Namespace: namespace}
+	if tag != "" {
+		spec.Tags = []string{tag}
+	}
+	if !h.admitQuery(w, r, spec) {
+		return
+	}
+	
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	ctx = projectedContext(ctx, projection, r.URL.Query())
+	
 	// Use appropriate query method based on parameters
 	switch {
 	case wildcard != "":
@@ -846,16 +959,19 @@ func (h *EntityHandler) ListEntities(w http.ResponseWriter, r *http.Request) {
 		entities, err = h.repo.ListByTagWildcard(wildcard)
 	case search != "":
 		// General content search
-		entities, err = h.repo.SearchContent(search)
+		entities, err = repoSearchContent(ctx, h.repo, search)
 	case namespace != "":
 		// List by namespace
 		entities, err = h.repo.ListByNamespace(namespace)
 	case tag != "":
 		// Filter by specific tag
-		entities, err = h.repo.ListByTag(tag)
+		entities, err = repoListByTag(ctx, h.repo, tag)
 	default:
 		// List all entities
-		entities, err = h.repo.List()
+		entities, err = repoList(ctx, h.repo)
+	}
+	if err == nil {
+		binary.RequestStatsFrom(r.Context()).RecordIndexLookup(entities)
 	}
 	
 	// Apply dataset filtering for dataset-scoped routes
@@ -878,6 +994,11 @@ func (h *EntityHandler) ListEntities(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err != nil {
+		if respondQueryStopped(w, err) {
+			logger.Warn("entity list stopped: %v", err)
+			return
+		}
+		
 		// Build context string based on query type
 		var queryContext string
 		switch {
@@ -900,15 +1021,26 @@ func (h *EntityHandler) ListEntities(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entities = withoutSensitiveMatches(requestUser(r), readableEntities(r, entities), r.URL.Query())
+	
 	// Track query metrics
 	if queryMetrics != nil {
 		queryMetrics.TrackQuery(queryType, queryTags, startTime, len(entities), err)
 	}
+	recordEntityAccess(r, entities, queryTags)
+	
+	// Polling clients holding the current result set get a 304
+	if notModified(w, r, listETag(r, h.repo, entities), lastModified(entities)) {
+		return
+	}
 	
 	// Strip timestamps from all entities if not requested
 	responseEntities := make([]*models.Entity, len(entities))
 	for i, entity := range entities {
-		responseEntities[i] = h.stripTimestampsFromEntity(entity, includeTimestamps)
+		responseEntities[i] = h.stripTimestampsFromEntity(redactedEntity(r, entity), includeTimestamps)
+		if projection != nil {
+			responseEntities[i] = projection.Apply(responseEntities[i])
+		}
 	}
 	
 	// Return entities
@@ -921,9 +1053,12 @@ func (h *EntityHandler) ListEntities(w http.ResponseWriter, r *http.Request) {
 // @Tags entities
 // @Accept json
 // @Produce json
-// @Param filter query string false "Filter field (e.g., created_at, tag:type)"
-// @Param operator query string false "Filter operator (eq, ne, gt, lt, gte, lte, like, in)"
+// @Param filter query string false "Filter field (e.g., created_at, tag:type, content.customer.country)"
+// @Param operator query string false "Filter operator (eq, ne, gt, lt, gte, lte, like, in, exists)"
 // @Param value query string false "Filter value"
+// @Param content_path query string false "JSONPath into JSON content (e.g., $.customer.country); shorthand for filter=content.<path>"
+// @Param content_value query string false "Value at content_path; without it, operator defaults to exists"
+// @Param dataset query string false "Restrict results to a dataset; equality filters on indexed content paths use the dataset's content path index"
 // @Param sort query string false "Sort field (created_at, updated_at, id, tag_count)"
 // @Param order query string false "Sort order (asc, desc)"
 // @Param limit query int false "Limit results"
@@ -932,23 +1067,210 @@ func (h *EntityHandler) ListEntities(w http.ResponseWriter, r *http.Request) {
 // @Router /api/v1/entities/query [get]
 func (h *EntityHandler) QueryEntities(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
+	params, err := contentPathQuery(r.URL.Query())
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limitStr := params.Get("limit")
+	offsetStr := params.Get("offset")
+	projection, err := responseProjection(params)
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	
+	// Estimate cost and apply admission control before touching storage.
+	// Legacy filters are costed as a full scan since they evaluate every entity.
+	if !h.admitQuery(w, r, querySpecFromParams(params)) {
+		return
+	}
+	
+	dataset := params.Get("dataset")
+	if dataset == "" {
+		dataset = extractDatasetFromPath(r.URL.Path)
+	}
+	
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	entities, queryType, queryTags, err := h.runQuery(projectedContext(ctx, projection, params), params, dataset)
+	
+	// Track query metrics
+	if queryMetrics != nil {
+		queryMetrics.TrackQuery(queryType, queryTags, startTime, len(entities), err)
+	}
+	
+	if err != nil {
+		if respondQueryStopped(w, err) {
+			logger.Warn("query stopped: type=%s, tags=%v: %v", queryType, queryTags, err)
+			return
+		}
+		logger.Error("failed to execute query: type=%s, tags=%v, error: %v", 
+			queryType, queryTags, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to execute query")
+		return
+	}
+	// A dataset parameter can name another dataset than the path
+	entities = inPathDataset(r, entities)
+	entities = withoutSensitiveMatches(requestUser(r), readableEntities(r, entities), params)
+	recordEntityAccess(r, entities, queryTags)
+	
+	// Return response with metadata
+	responseEntities := redactedEntities(r, entities)
+	if projection != nil {
+		projected := make([]*models.Entity, len(responseEntities))
+		for i, entity := range responseEntities {
+			projected[i] = projection.Apply(entity)
+		}
+		responseEntities = projected
+	}
+	response := QueryEntityResponse{
+		Entities: responseEntities,
+		Total:    len(entities),
+		Offset:   0,
+		Limit:    0,
+	}
+	
+	// Update pagination metadata if provided
+	if offsetStr != "" {
+		offset, _ := strconv.Atoi(offsetStr)
+		response.Offset = offset
+	}
+	if limitStr != "" {
+		limit, _ := strconv.Atoi(limitStr)
+		response.Limit = limit
+	}
+	
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// querySpecFromParams describes the query parameters of QueryEntities for
+// cost estimation
+func querySpecFromParams(params url.Values) binary.QuerySpec {
+	return binary.QuerySpec{
+		Tags:      params["tag"],
+		Wildcard:  params.Get("wildcard"),
+		Search:    params.Get("search"),
+		Namespace: params.Get("namespace"),
+	}
+}
+
+// contentPathQuery returns query parameters with a content_path and
+// content_value filter rewritten as the equivalent content.<path> filter, so
+// every query path, including sensitive field checks, sees one form. The
+// operator parameter applies; it defaults to eq, or to exists when no
+// content_value is given.
+func contentPathQuery(params url.Values) (url.Values, error) {
+	jsonPath := params.Get("content_path")
+	if jsonPath == "" {
+		return params, nil
+	}
+	if params.Get("filter") != "" {
+		return nil, fmt.Errorf("content_path cannot be combined with filter")
+	}
+	path, err := models.ContentPathFromJSONPath(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rewritten := make(url.Values, len(params)+3)
+	for key, values := range params {
+		rewritten[key] = values
+	}
+	value := params.Get("content_value")
+	operator := params.Get("operator")
+	if operator == "" {
+		operator = "eq"
+		if value == "" {
+			operator = "exists"
+		}
+	}
+	rewritten.Set("filter", models.ContentPathPrefix+path)
+	rewritten.Set("operator", operator)
+	rewritten.Set("value", value)
+	return rewritten, nil
+}
+
+// ExplainQuery reports how a list or query request would be executed
+// @Summary Explain an entity query
+// @Description Given the parameters of /entities/list or /entities/query, report the index strategy, the entities that would be fetched and the estimated matching count, the tag index shard fan-out, and whether a full scan would occur. No entity is read.
+// @Tags entities
+// @Produce json
+// @Param tag query string false "Filter by tag; repeat for AND logic"
+// @Param wildcard query string false "Filter by wildcard pattern"
+// @Param search query string false "Search content"
+// @Param namespace query string false "Filter by namespace"
+// @Param filter query string false "Filter field (e.g., created_at, content.customer.country)"
+// @Param operator query string false "Filter operator"
+// @Param value query string false "Filter value"
+// @Param content_path query string false "JSONPath into JSON content; shorthand for filter=content.<path>"
+// @Param content_value query string false "Value at content_path"
+// @Param dataset query string false "Dataset scope of a filter query"
+// @Success 200 {object} binary.QueryPlan
+// @Failure 501 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/explain [get]
+func (h *EntityHandler) ExplainQuery(w http.ResponseWriter, r *http.Request) {
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Query explain is not supported by this repository")
+		return
+	}
+
+	params, err := contentPathQuery(r.URL.Query())
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dataset := params.Get("dataset")
+	if dataset == "" {
+		dataset = extractDatasetFromPath(r.URL.Path)
+	}
+
+	// Legacy filters take part only when complete, as in runQuery
+	var filter *binary.QueryFilterSpec
+	field, operator, value := params.Get("filter"), params.Get("operator"), params.Get("value")
+	contentFilter := models.IsContentPathField(field) && operator != "" && (value != "" || operator == "exists")
+	if field != "" && operator != "" && (value != "" || contentFilter) {
+		filter = &binary.QueryFilterSpec{Field: field, Operator: operator, Value: value}
+	}
+
+	RespondJSON(w, http.StatusOK, binaryRepo.ExplainQuery(querySpecFromParams(params), filter, dataset))
+}
+
+// runQuery selects the entities matching the query parameters of
+// QueryEntities in dataset, or in every dataset when it is empty. It also
+// returns the query type and tags for metrics.
+func (h *EntityHandler) runQuery(ctx context.Context, params url.Values, dataset string) ([]*models.Entity, string, []string, error) {
 	// SURGICAL FIX: Add missing tag parameter support like ListEntities
 	// Parse tag-based query parameters (primary filtering)
-	tags := r.URL.Query()["tag"] // Get ALL tag parameters for AND logic
-	tag := r.URL.Query().Get("tag") // Keep single tag for backward compatibility
-	wildcard := r.URL.Query().Get("wildcard")
-	search := r.URL.Query().Get("search")
-	namespace := r.URL.Query().Get("namespace")
+	tags := params["tag"] // Get ALL tag parameters for AND logic
+	tag := params.Get("tag") // Keep single tag for backward compatibility
+	wildcard := params.Get("wildcard")
+	search := params.Get("search")
+	namespace := params.Get("namespace")
 	
 	// Parse legacy filter parameters (secondary filtering)
-	filter := r.URL.Query().Get("filter")
-	operator := r.URL.Query().Get("operator")
-	value := r.URL.Query().Get("value")
-	sort := r.URL.Query().Get("sort")
-	order := r.URL.Query().Get("order")
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
+	filter := params.Get("filter")
+	operator := params.Get("operator")
+	value := params.Get("value")
+	
+	// Content path filters (content.<path>) also narrow tag-based queries
+	contentFilter := models.IsContentPathField(filter) && operator != "" && (value != "" || operator == "exists")
+	sort := params.Get("sort")
+	order := params.Get("order")
+	limitStr := params.Get("limit")
+	offsetStr := params.Get("offset")
+	
+	legacyFilter := filter != "" && operator != "" && (value != "" || contentFilter)
+	
+	// Tag queries and listings take the dataset as one more tag, so the
+	// index only returns the dataset's entities; filter queries are scoped
+	// by the entity query below
+	if dataset != "" && datasetScopedQuery(params) && (len(tags) > 0 || !legacyFilter) {
+		tags = append(append([]string(nil), tags...), "dataset:"+dataset)
+		tag = tags[0]
+	}
 	
 	// Collect tags for complexity calculation
 	var queryTags []string
@@ -965,7 +1287,7 @@ func (h *EntityHandler) QueryEntities(w http.ResponseWriter, r *http.Request) {
 		queryType = "wildcard"
 	case search != "":
 		// General content search
-		entities, err = h.repo.SearchContent(search)
+		entities, err = repoSearchContent(ctx, h.repo, search)
 		queryTags = append(queryTags, "search:"+search)
 		queryType = "search"
 	case namespace != "":
@@ -976,20 +1298,26 @@ func (h *EntityHandler) QueryEntities(w http.ResponseWriter, r *http.Request) {
 	case len(tags) > 1:
 		// CRITICAL FIX: Multi-tag AND filtering (intersection logic)
 		// This fixes the critical multi-tenancy security vulnerability
-		entities, err = h.intersectTagQueries(tags)
+		entities, err = h.intersectTagQueries(ctx, tags)
 		queryTags = append(queryTags, tags...)
 		queryType = "multi_tag_and"
 	case tag != "":
 		// Filter by specific tag (single tag)
-		entities, err = h.repo.ListByTag(tag)
+		entities, err = repoListByTag(ctx, h.repo, tag)
 		queryTags = append(queryTags, tag)
 		queryType = "tag_filter"
-	case filter != "" && operator != "" && value != "":
+	case legacyFilter:
 		// Legacy filter system - build query using EntityQuery
 		query := h.repo.Query()
 		query.AddFilter(filter, operator, value)
+		if dataset != "" {
+			query.InDataset(dataset)
+		}
 		queryTags = append(queryTags, filter+operator+value)
 		queryType = "legacy_filter"
+		if contentFilter {
+			queryType = "content_filter"
+		}
 		
 		// Add sorting for legacy queries
 		if sort != "" {
@@ -1018,41 +1346,50 @@ func (h *EntityHandler) QueryEntities(w http.ResponseWriter, r *http.Request) {
 		entities, err = query.Execute()
 	default:
 		// No filters provided - return all entities
-		entities, err = h.repo.List()
+		entities, err = repoList(ctx, h.repo)
 		queryType = "list_all"
 	}
-	
-	// Track query metrics
-	if queryMetrics != nil {
-		queryMetrics.TrackQuery(queryType, queryTags, startTime, len(entities), err)
+	if queryType != "multi_tag_and" && err == nil {
+		binary.RequestStatsFrom(ctx).RecordIndexLookup(entities)
 	}
 	
-	if err != nil {
-		logger.Error("failed to execute query: type=%s, tags=%v, error: %v", 
-			queryType, queryTags, err)
-		RespondError(w, http.StatusInternalServerError, "Failed to execute query")
-		return
+	// Wildcard, search and namespace results span every dataset
+	if dataset != "" && !datasetScopedQuery(params) && err == nil {
+		entities = entitiesInDataset(entities, dataset)
 	}
 	
-	// Return response with metadata
-	response := QueryEntityResponse{
-		Entities: entities,
-		Total:    len(entities),
-		Offset:   0,
-		Limit:    0,
+	// Apply a content path filter to tag-based results
+	if contentFilter && queryType != "content_filter" && err == nil {
+		path := strings.TrimPrefix(filter, models.ContentPathPrefix)
+		matched := make([]*models.Entity, 0, len(entities))
+		for _, entity := range entities {
+			if models.MatchContentPath(entity.Content, path, operator, value) {
+				matched = append(matched, entity)
+			}
+		}
+		entities = matched
+		queryTags = append(queryTags, filter+operator+value)
 	}
 	
-	// Update pagination metadata if provided
-	if offsetStr != "" {
-		offset, _ := strconv.Atoi(offsetStr)
-		response.Offset = offset
-	}
-	if limitStr != "" {
-		limit, _ := strconv.Atoi(limitStr)
-		response.Limit = limit
+	return entities, queryType, queryTags, err
+}
+
+// datasetScopedQuery reports whether runQuery can scope the query to a
+// dataset before reading entities. Wildcard, search and namespace queries
+// read the matches of every dataset.
+func datasetScopedQuery(params url.Values) bool {
+	return params.Get("wildcard") == "" && params.Get("search") == "" && params.Get("namespace") == ""
+}
+
+// entitiesInDataset returns the entities that belong to dataset
+func entitiesInDataset(entities []*models.Entity, dataset string) []*models.Entity {
+	scoped := make([]*models.Entity, 0, len(entities))
+	for _, entity := range entities {
+		if entity.GetDataset() == dataset {
+			scoped = append(scoped, entity)
+		}
 	}
-	
-	RespondJSON(w, http.StatusOK, response)
+	return scoped
 }
 
 // TestCreateEntity is a test endpoint for creating entities without authentication
@@ -1268,134 +1605,94 @@ func (h *EntityHandler) SimpleCreateEntity(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-// GetEntityTimeseries handles retrieving time series data for entities
-// This endpoint is used for visualizations in the dashboard
+// GetEntityTimeseries counts entity creations and tag changes per interval
+// @Summary Entity time series
+// @Description Count entity creations and tag changes per hour, day, week or month from the temporal index. Entities are selected by type and tags; a tag change is a tag added that the entity did not carry or a tag removed after it was created. Buckets are aligned in UTC.
+// @Tags temporal
+// @Produce json
+// @Param type query string false "Count only entities of this type"
+// @Param tags query string false "Comma-separated tags every counted entity carries"
+// @Param interval query string false "hour, day (default), week or month"
+// @Param created_after query string false "Start of the range, RFC3339 (default 7 days ago)"
+// @Param created_before query string false "End of the range, RFC3339 (default now)"
+// @Param change_namespace query string false "Count only changes of tags in this namespace"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/entities/timeseries [get]
 func (h *EntityHandler) GetEntityTimeseries(w http.ResponseWriter, r *http.Request) {
-	// Get parameters from query
-	entityType := r.URL.Query().Get("type")
-	tags := r.URL.Query().Get("tags")
-	interval := r.URL.Query().Get("interval")
-	createdAfterStr := r.URL.Query().Get("created_after")
-	createdBeforeStr := r.URL.Query().Get("created_before")
-	_ = r.URL.Query().Get("count_by_interval") == "true" // We use this variable later
-
-	// Parse time range
-	var createdAfter, createdBefore time.Time
-	var err error
+	query := r.URL.Query()
+	entityType := query.Get("type")
+	opts := binary.TimeseriesOptions{
+		Tags:      []string{},
+		Interval:  query.Get("interval"),
+		From:      time.Now().AddDate(0, 0, -7),
+		To:        time.Now(),
+		Namespace: query.Get("change_namespace"),
+	}
+	if opts.Interval == "" {
+		opts.Interval = binary.TimeseriesDay
+	}
+	if entityType != "" {
+		opts.Tags = append(opts.Tags, "type:"+entityType)
+	}
+	for _, tag := range strings.Split(query.Get("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			opts.Tags = append(opts.Tags, tag)
+		}
+	}
 
-	if createdAfterStr != "" {
-		createdAfter, err = time.Parse(time.RFC3339, createdAfterStr)
-		if err != nil {
+	var err error
+	if createdAfterStr := query.Get("created_after"); createdAfterStr != "" {
+		if opts.From, err = time.Parse(time.RFC3339, createdAfterStr); err != nil {
 			RespondError(w, http.StatusBadRequest, "Invalid created_after format, use RFC3339")
 			return
 		}
-	} else {
-		// Default to 7 days ago
-		createdAfter = time.Now().AddDate(0, 0, -7)
 	}
-
-	if createdBeforeStr != "" {
-		createdBefore, err = time.Parse(time.RFC3339, createdBeforeStr)
-		if err != nil {
+	if createdBeforeStr := query.Get("created_before"); createdBeforeStr != "" {
+		if opts.To, err = time.Parse(time.RFC3339, createdBeforeStr); err != nil {
 			RespondError(w, http.StatusBadRequest, "Invalid created_before format, use RFC3339")
 			return
 		}
-	} else {
-		// Default to now
-		createdBefore = time.Now()
-	}
-
-	// Validate interval
-	if interval == "" {
-		interval = "day" // Default interval
 	}
 
-	if interval != "hour" && interval != "day" && interval != "week" && interval != "month" {
-		RespondError(w, http.StatusBadRequest, "Invalid interval, use hour, day, week, or month")
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Time series not supported by this repository")
 		return
 	}
-
-	// For a real implementation, fetch entities from the repository based on criteria
-	// For now, we'll generate simulated time series data
-
-	// Generate time periods based on interval
-	var periods []string
-	var counts []int
-
-	currentTime := createdAfter
-
-	// Generate periods based on the interval
-	for currentTime.Before(createdBefore) || currentTime.Equal(createdBefore) {
-		var periodStr string
-
-		switch interval {
-		case "hour":
-			periodStr = currentTime.Format("2006-01-02 15:00")
-			currentTime = currentTime.Add(time.Hour)
-		case "day":
-			periodStr = currentTime.Format("2006-01-02")
-			currentTime = currentTime.AddDate(0, 0, 1)
-		case "week":
-			year, week := currentTime.ISOWeek()
-			periodStr = fmt.Sprintf("%d-W%02d", year, week)
-			currentTime = currentTime.AddDate(0, 0, 7)
-		case "month":
-			periodStr = currentTime.Format("2006-01")
-			currentTime = currentTime.AddDate(0, 1, 0)
-		}
-
-		periods = append(periods, periodStr)
-
-		// Generate a somewhat realistic count based on type and tags
-		baseCount := 10
-		if entityType == "issue" {
-			baseCount = 25
-		} else if entityType == "agent" {
-			baseCount = 5
-		}
-
-		// Adjust count based on tags
-		if strings.Contains(tags, "priority:high") {
-			baseCount = int(float64(baseCount) * 1.5)
-		} else if strings.Contains(tags, "status:completed") {
-			baseCount = int(float64(baseCount) * 0.8)
+	series, err := binaryRepo.EntityTimeseries(opts)
+	if err != nil {
+		if errors.Is(err, binary.ErrInvalidTimeseries) {
+			RespondError(w, http.StatusBadRequest, err.Error())
+			return
 		}
-
-		// Add some randomness
-		count := baseCount + int(float64(baseCount)*0.4*float64(time.Now().Unix()%10)/10.0)
-		counts = append(counts, count)
-	}
-
-	// This is where we'd normally query the entity repository
-	// For now, we'll return the simulated data
-
-	// Build response
-	response := map[string]interface{}{
-		"status":      "ok",
-		"type":        entityType,
-		"interval":    interval,
-		"start_date":  createdAfter.Format(time.RFC3339),
-		"end_date":    createdBefore.Format(time.RFC3339),
-		"periods":     periods,
-		"counts":      counts,
-		"total_count": sumArray(counts),
+		logger.Error("Failed to count entity time series: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to count entity time series")
+		return
 	}
 
-	// Log for debugging
-	logger.TraceIf("temporal", "generated timeseries data for type=%s, tags=%s, interval=%s",
-		entityType, tags, interval)
-
-	// Return timeseries data
-	RespondJSON(w, http.StatusOK, response)
-}
-
-// Helper function to sum array values
-func sumArray(arr []int) int {
-	sum := 0
-	for _, v := range arr {
-		sum += v
-	}
-	return sum
+	periods := make([]string, len(series.Buckets))
+	counts := make([]int, len(series.Buckets))
+	tagChanges := make([]int, len(series.Buckets))
+	for i, bucket := range series.Buckets {
+		periods[i] = bucket.Period
+		counts[i] = bucket.Created
+		tagChanges[i] = bucket.TagChanges
+	}
+	RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":            "ok",
+		"type":              entityType,
+		"tags":              opts.Tags,
+		"interval":          series.Interval,
+		"start_date":        series.From.Format(time.RFC3339),
+		"end_date":          series.To.Format(time.RFC3339),
+		"periods":           periods,
+		"counts":            counts,
+		"tag_changes":       tagChanges,
+		"total_count":       series.TotalCreated,
+		"total_tag_changes": series.TotalTagChanges,
+		"entities":          series.Entities,
+	})
 }
 
 // Helper function to check if array contains a tag with the given prefix
@@ -1435,6 +1732,42 @@ func removeTagsByPrefix(tags []string, prefix string) []string {
 	return result
 }
 
+// setEntityContent sets the content of a new entity. Content above the
+// autochunk threshold is stored as content-addressed chunk entities, reusing
+// identical chunks already stored; smaller content is stored inline.
+func setEntityContent(repo models.EntityRepository, entity *models.Entity, contentBytes []byte, contentType string) error {
+	config := models.DefaultChunkConfig()
+	if int64(len(contentBytes)) <= config.AutoChunkThreshold {
+		entity.Content = contentBytes
+		
+		// Clear any existing content type tags to avoid duplicates
+		entity.Tags = removeTagsByPrefix(entity.Tags, "content:type:")
+		entity.AddTag("content:type:" + contentType)
+		
+		logger.TraceIf("storage", "set content type: %s", contentType)
+		return nil
+	}
+
+	chunkIDs, err := entity.SetContent(bytes.NewReader(contentBytes), contentType, config)
+	if err != nil {
+		return fmt.Errorf("failed to chunk content: %w", err)
+	}
+	
+	chunkSize := int(config.DefaultChunkSize)
+	for i := 0; i < len(contentBytes) && i/chunkSize < len(chunkIDs); i += chunkSize {
+		end := i + chunkSize
+		if end > len(contentBytes) {
+			end = len(contentBytes)
+		}
+		chunkID, reused, err := models.StoreChunk(repo, entity.ID, contentBytes[i:end])
+		if err != nil {
+			return fmt.Errorf("failed to store chunk %d: %w", i/chunkSize, err)
+		}
+		logger.TraceIf("chunking", "stored chunk: %d/%d, id=%s, deduplicated=%v", i/chunkSize+1, len(chunkIDs), chunkID, reused)
+	}
+	return nil
+}
+
 // UpdateEntity handles updating an existing entity.
 //
 // HTTP Method: PUT
@@ -1464,10 +1797,17 @@ func removeTagsByPrefix(tags []string, prefix string) []string {
 // Error Responses:
 //   - 400 Bad Request: Missing entity ID or invalid request format
 //   - 401 Unauthorized: Missing or invalid authentication
-//   - 403 Forbidden: User lacks entity:update permission
+//   - 403 Forbidden: User lacks entity:update permission, or lacks
+//     dataset:update and the entity is a dataset or system dataset entity
 //   - 404 Not Found: Entity with given ID not found
+//   - 409 Conflict: If-Match names a version the entity has moved past
 //   - 500 Internal Server Error: Failed to update entity
 //
+// Concurrency:
+//   Responses carry the entity version as ETag. Sending it back in If-Match
+//   makes the update conditional: it is applied only if nobody updated the
+//   entity in between. Without If-Match the last write wins.
+//
 // Update Behavior:
 //   - Tags: If provided, completely replaces existing tags
 //   - Content: If provided, replaces existing content
@@ -1485,8 +1825,10 @@ func removeTagsByPrefix(tags []string, prefix string) []string {
 // @Accept json
 // @Produce json
 // @Param id query string false "Entity ID (can also be in body)"
+// @Param If-Match header string false "Entity version (ETag) the update is based on"
 // @Param body body map[string]interface{} true "Entity update data"
 // @Success 200 {object} models.Entity
+// @Failure 409 {object} ErrorResponse
 // @Router /api/v1/entities/update [put]
 func (h *EntityHandler) UpdateEntity(w http.ResponseWriter, r *http.Request) {
 	logger.TraceIf("storage", "UpdateEntity called")
@@ -1526,19 +1868,96 @@ func (h *EntityHandler) UpdateEntity(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the existing entity
-	entity, err := h.repo.GetByID(entityID)
+	existing, err := repoGetByID(r.Context(), h.repo, entityID)
 	if err != nil {
-		logger.Error("failed to get entity %s: %v", entityID, err)
+		logger.ErrorContext(r.Context(), "failed to get entity %s: %v", entityID, err)
+		RespondError(w, http.StatusNotFound, "Entity not found")
+		return
+	}
+	if outsidePathDataset(r, existing) {
 		RespondError(w, http.StatusNotFound, "Entity not found")
 		return
 	}
+	if hiddenOrReadOnly(w, r, existing) || rejectDatasetRecordWrite(w, r, existing.Tags, req.Tags) {
+		return
+	}
+
+	if h.locks != nil {
+		var locked *services.LockedError
+		if err := h.locks.CheckUpdate(existing, requestUser(r)); errors.As(err, &locked) {
+			respondLocked(w, locked)
+			return
+		}
+	}
 
 	logger.TraceIf("storage", "found existing entity %s", entityID)
 
+	// If-Match names the version the client based its changes on. Stale
+	// versions are rejected here and, for writers racing on the same
+	// version, again atomically by the repository.
+	var updater conditionalUpdater
+	var expectedVersion uint64
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		versions, any, err := parseIfMatch(ifMatch)
+		if err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid If-Match header: "+err.Error())
+			return
+		}
+		if !any {
+			binaryRepo, err := asTemporalRepository(h.repo)
+			updater, _ = h.repo.(conditionalUpdater)
+			if err != nil || updater == nil {
+				RespondError(w, http.StatusNotImplemented, "Conditional updates not supported")
+				return
+			}
+			expectedVersion = binaryRepo.GetEntityChangeCounter(existing)
+			matched := false
+			for _, version := range versions {
+				if version == expectedVersion {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				setChangeCounterHeaders(w, h.repo, existing)
+				RespondError(w, http.StatusConflict, fmt.Sprintf("Entity was modified: current version is %d", expectedVersion))
+				return
+			}
+		}
+	}
+
+	// Apply changes to a copy so a rejected update leaves the stored entity untouched
+	entity := &models.Entity{
+		ID:        existing.ID,
+		Tags:      append([]string(nil), existing.Tags...),
+		Content:   existing.Content,
+		CreatedAt: existing.CreatedAt,
+		UpdatedAt: existing.UpdatedAt,
+	}
+
 	// Update tags if provided
 	if req.Tags != nil {
 		logger.TraceIf("storage", "updating entity tags: %v", req.Tags)
-		entity.Tags = req.Tags
+		defer h.lockIdentities(req.Tags)()
+		if rejectDuplicateIdentity(w, h.repo, entityID, req.Tags) {
+			return
+		}
+		if rejectSensitiveTagRemoval(w, r, existing, req.Tags) {
+			return
+		}
+		// Lock tags are only changed by the lock endpoints
+		entity.Tags = models.KeepLockTags(existing, req.Tags)
+		
+		// SECURITY: Dataset-scoped routes cannot move an entity to another dataset
+		if pathDataset := extractDatasetFromPath(r.URL.Path); pathDataset != "" {
+			tags := make([]string, 0, len(entity.Tags)+1)
+			for _, tag := range entity.Tags {
+				if !strings.HasPrefix(tag, "dataset:") {
+					tags = append(tags, tag)
+				}
+			}
+			entity.Tags = append(tags, "dataset:"+pathDataset)
+		}
 	}
 
 	// Update content if provided
@@ -1602,23 +2021,43 @@ func (h *EntityHandler) UpdateEntity(w http.ResponseWriter, r *http.Request) {
 	logger.TraceIf("storage", "updating entity with %d tags and %d bytes of content", 
 		len(entity.Tags), len(entity.Content))
 	
-	err = h.repo.Update(entity)
+	if updater != nil {
+		err = updater.UpdateIfVersion(entity, expectedVersion)
+	} else {
+		err = repoUpdate(r.Context(), h.repo, entity)
+	}
+	if errors.Is(err, binary.ErrVersionConflict) {
+		if current, getErr := h.repo.GetByID(entityID); getErr == nil {
+			setChangeCounterHeaders(w, h.repo, current)
+		}
+		RespondError(w, http.StatusConflict, "Entity was modified by another request")
+		return
+	}
+	if errors.Is(err, binary.ErrDatasetQuotaExceeded) {
+		RespondError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	}
+	if immutableRefused(w, err) {
+		return
+	}
 	if err != nil {
-		logger.Error("failed to update entity %s: %v", entityID, err)
+		logger.ErrorContext(r.Context(), "failed to update entity %s: %v", entityID, err)
 		RespondError(w, http.StatusInternalServerError, "Failed to update entity")
 		return
 	}
 
 	// Re-fetch the entity to ensure we have the latest version
-	updated, err := h.repo.GetByID(entityID)
+	updated, err := repoGetByID(r.Context(), h.repo, entityID)
 	if err != nil {
-		logger.Error("failed to get updated entity %s: %v", entityID, err)
+		logger.ErrorContext(r.Context(), "failed to get updated entity %s: %v", entityID, err)
 		RespondError(w, http.StatusInternalServerError, "Failed to retrieve updated entity")
 		return
 	}
 
 	// Return the updated entity
-	RespondJSON(w, http.StatusOK, updated)
+	setChangeCounterHeaders(w, h.repo, updated)
+	setQuotaWarningHeader(w, h.repo, updated)
+	RespondJSON(w, http.StatusOK, redactedEntity(r, updated))
 }
 
 // GetEntityAsOf returns an entity as it existed at a specific point in time
@@ -1698,6 +2137,12 @@ func (h *EntityHandler) GetEntityAsOf(w http.ResponseWriter, r *http.Request) {
 	asOf = asOf.UTC()
 	logger.TraceIf("temporal", "using UTC timestamp: %v", asOf)
 	
+	current, err := historyEntity(h.repo, requestUser(r), entityID)
+	if errors.Is(err, models.ErrNotFound) {
+		RespondError(w, http.StatusNotFound, fmt.Sprintf("Entity %s not found", entityID))
+		return
+	}
+	
 	// Get entity as of timestamp with better error reporting
 	entity, err := temporalRepo.GetEntityAsOf(entityID, asOf)
 	if err != nil {
@@ -1714,21 +2159,22 @@ func (h *EntityHandler) GetEntityAsOf(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Return entity with timestamps stripped unless requested
-	response := h.stripTimestampsFromEntity(entity, includeTimestamps)
+	response := h.stripTimestampsFromEntity(redactedVersion(r, entity, current), includeTimestamps)
 	logger.TraceIf("temporal", "returning entity as of %v: %+v", asOf, response)
 	RespondJSON(w, http.StatusOK, response)
 }
 
 // GetEntityHistory returns the history of an entity within a time range
 // @Summary Get entity history
-// @Description Retrieve the history of an entity within a time range
+// @Description Retrieve the changes of an entity, oldest first: tags added (tag_added, with the namespace's previous value as old_value), tags removed (tag_removed) and content replaced (content_updated, with sha256 digests of the old and new content). With a limit only the most recent changes are returned.
 // @Tags temporal
 // @Accept json
 // @Produce json
 // @Param id query string true "Entity ID"
-// @Param from query string false "Start timestamp in RFC3339 format (default: 24 hours ago)"
-// @Param to query string false "End timestamp in RFC3339 format (default: now)"
-// @Success 200 {array} models.Entity
+// @Param from query string false "Start timestamp in RFC3339 format, inclusive (default: unbounded)"
+// @Param to query string false "End timestamp in RFC3339 format, inclusive (default: unbounded)"
+// @Param limit query int false "Maximum number of changes (default: 100)"
+// @Success 200 {array} models.EntityChange
 // @Router /api/v1/entities/history [get]
 func (h *EntityHandler) GetEntityHistory(w http.ResponseWriter, r *http.Request) {
 	// Debug logs
@@ -1750,6 +2196,22 @@ func (h *EntityHandler) GetEntityHistory(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	
+	// Optional time range, open at an end without a bound
+	var from, to time.Time
+	var err error
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		if from, err = time.Parse(time.RFC3339, fromStr); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid from format, use RFC3339")
+			return
+		}
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		if to, err = time.Parse(time.RFC3339, toStr); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid to format, use RFC3339")
+			return
+		}
+	}
+	
 	logger.TraceIf("temporal", "getting history for entity %s with limit %d", entityID, limit)
 	
 	// Get entity repository
@@ -1761,7 +2223,7 @@ func (h *EntityHandler) GetEntityHistory(w http.ResponseWriter, r *http.Request)
 	}
 	
 	// Check if entity exists first
-	_, err = temporalRepo.GetByID(entityID)
+	_, err = historyEntity(h.repo, requestUser(r), entityID)
 	if err != nil {
 		logger.Error("entity %s not found: %v", entityID, err)
 		RespondError(w, http.StatusNotFound, fmt.Sprintf("Entity %s not found", entityID))
@@ -1769,7 +2231,7 @@ func (h *EntityHandler) GetEntityHistory(w http.ResponseWriter, r *http.Request)
 	}
 	
 	// Get entity history
-	history, err := temporalRepo.GetEntityHistory(entityID, limit)
+	history, err := temporalRepo.GetEntityChanges(entityID, from, to, limit)
 	if err != nil {
 		logger.Error("failed to get entity history for %s (limit=%d): %v", entityID, limit, err)
 		RespondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get entity history: %v", err))
@@ -1817,7 +2279,7 @@ func (h *EntityHandler) GetRecentChanges(w http.ResponseWriter, r *http.Request)
 	
 	if entityID != "" {
 		// Check if entity exists first
-		_, err = temporalRepo.GetByID(entityID)
+		_, err = historyEntity(h.repo, requestUser(r), entityID)
 		if err != nil {
 			logger.Error("entity %s not found: %v", entityID, err)
 			RespondError(w, http.StatusNotFound, fmt.Sprintf("Entity %s not found", entityID))
@@ -1827,8 +2289,11 @@ func (h *EntityHandler) GetRecentChanges(w http.ResponseWriter, r *http.Request)
 		// Get changes for specific entity
 		changes, err = temporalRepo.GetEntityHistory(entityID, limit)
 	} else {
-		// Get global changes
+		// Get global changes, leaving out entities hidden by their ACL
 		changes, err = temporalRepo.GetRecentChanges(limit)
+		if err == nil {
+			changes = h.visibleChanges(r, changes)
+		}
 	}
 	
 	if err != nil {
@@ -1950,7 +2415,7 @@ func (h *EntityHandler) GetEntityDiff(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Check if entity exists first
-	_, err = temporalRepo.GetByID(entityID)
+	current, err := historyEntity(h.repo, requestUser(r), entityID)
 	if err != nil {
 		logger.Error("entity %s not found: %v", entityID, err)
 		RespondError(w, http.StatusNotFound, fmt.Sprintf("Entity %s not found", entityID))
@@ -1964,6 +2429,9 @@ func (h *EntityHandler) GetEntityDiff(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	beforeEntity = redactedVersion(r, beforeEntity, current)
+	afterEntity = redactedVersion(r, afterEntity, current)
+	
 	// Strip timestamps if not requested
 	if !includeTimestamps {
 		if beforeEntity != nil {
@@ -2051,11 +2519,47 @@ func (h *EntityHandler) TestTemporalFixHandler(w http.ResponseWriter, r *http.Re
 	w.Write([]byte(`{"status":"ok","message":"Temporal handlers are integrated"}`))
 }
 
-// GetEntitySummary provides a lightweight summary for change detection
+// GetEntitySummary provides a lightweight summary for change detection.
+// The binary repository keeps the counts up to date as entities are written
+// and deleted, so the summary never reads the entities; the counts cover
+// all live entities, while recent_entities lists only those the user may
+// read.
 func (h *EntityHandler) GetEntitySummary(w http.ResponseWriter, r *http.Request) {
 	logger.TraceIf("api", "GetEntitySummary called from %s", r.RemoteAddr)
 	
-	// Get all entities to build summary
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		h.scanEntitySummary(w, r)
+		return
+	}
+	
+	counts := binaryRepo.EntitySummary()
+	recentEntities := make([]string, 0, len(counts.RecentEntities))
+	for _, id := range counts.RecentEntities {
+		if _, err := h.visibleEntity(r, id); err == nil {
+			recentEntities = append(recentEntities, id)
+		}
+	}
+	
+	summary := map[string]interface{}{
+		"total_count":     counts.TotalCount,
+		"type_counts":     counts.TypeCounts,
+		"dataset_counts":  counts.DatasetCounts,
+		"last_updated":    counts.LastUpdated,
+		"recent_entities": recentEntities,
+		"timestamp":       time.Now().UnixNano(),
+		"change_counter":  binaryRepo.GetChangeCounter(),
+	}
+	
+	logger.TraceIf("api", "entity summary: %d total entities, %d types, last updated: %d", 
+		counts.TotalCount, len(counts.TypeCounts), counts.LastUpdated)
+	
+	RespondJSON(w, http.StatusOK, summary)
+}
+
+// scanEntitySummary builds the entity summary by listing every entity, for
+// repositories that do not maintain one
+func (h *EntityHandler) scanEntitySummary(w http.ResponseWriter, r *http.Request) {
 	entities, err := h.repo.List()
 	if err != nil {
 		logger.Error("failed to get entities for summary: %v", err)
@@ -2064,10 +2568,12 @@ func (h *EntityHandler) GetEntitySummary(w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
+	entities = readableEntities(r, entities)
 	
 	// Build summary statistics
 	totalCount := len(entities)
 	typeCount := make(map[string]int)
+	datasetCount := make(map[string]int)
 	var lastUpdated int64 = 0
 	var recentEntities []string
 	
@@ -2091,6 +2597,9 @@ func (h *EntityHandler) GetEntitySummary(w http.ResponseWriter, r *http.Request)
 			}
 		}
 		typeCount[entityType]++
+		if dataset := entity.GetDataset(); dataset != "" {
+			datasetCount[dataset]++
+		}
 		
 		// Track most recent update
 		if entity.UpdatedAt > lastUpdated {
@@ -2103,19 +2612,54 @@ func (h *EntityHandler) GetEntitySummary(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	
-	// Build summary response
-	summary := map[string]interface{}{
+	RespondJSON(w, http.StatusOK, map[string]interface{}{
 		"total_count":     totalCount,
 		"type_counts":     typeCount,
+		"dataset_counts":  datasetCount,
 		"last_updated":    lastUpdated,
 		"recent_entities": recentEntities,
 		"timestamp":       time.Now().UnixNano(),
+	})
+}
+
+// GetChangeCounters returns change counters for an entity, a dataset, or the whole repository.
+// Counters only ever increase, so a client detects changes by comparing a single number.
+// @Summary Get change counters
+// @Description Get monotonically increasing change counters for cheap cache validation
+// @Tags entities
+// @Produce json
+// @Param id query string false "Entity ID"
+// @Param dataset query string false "Dataset name"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/entities/version [get]
+func (h *EntityHandler) GetChangeCounters(w http.ResponseWriter, r *http.Request) {
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Change counters not supported by this repository")
+		return
 	}
 	
-	logger.TraceIf("api", "entity summary: %d total entities, %d types, last updated: %d", 
-		totalCount, len(typeCount), lastUpdated)
+	response := map[string]interface{}{
+		"change_counter": binaryRepo.GetChangeCounter(),
+	}
 	
-	RespondJSON(w, http.StatusOK, summary)
+	if id := r.URL.Query().Get("id"); id != "" {
+		entity, err := h.visibleEntity(r, id)
+		if err != nil {
+			RespondError(w, http.StatusNotFound, "Entity not found")
+			return
+		}
+		response["id"] = entity.ID
+		response["entity_version"] = binaryRepo.GetEntityChangeCounter(entity)
+		setChangeCounterHeaders(w, h.repo, entity)
+	}
+	
+	if dataset := r.URL.Query().Get("dataset"); dataset != "" {
+		response["dataset"] = dataset
+		response["dataset_version"] = binaryRepo.GetDatasetChangeCounter(dataset)
+	}
+	
+	RespondJSON(w, http.StatusOK, response)
 }
 
 // GetUniqueTagValues returns unique values for a tag namespace
@@ -2153,6 +2697,126 @@ func (h *EntityHandler) GetUniqueTagValues(w http.ResponseWriter, r *http.Reques
 	RespondJSON(w, http.StatusOK, response)
 }
 
+// Suggestion limits for SuggestTagValues
+const (
+	defaultTagSuggestLimit = 10
+	maxTagSuggestLimit     = 100
+)
+
+// SuggestTagValues returns the most frequent values of a tag namespace that start with a prefix
+// @Summary Suggest tag values
+// @Description Autocomplete tag values by prefix, most frequent first, served from an in-memory index
+// @Tags tags
+// @Produce json
+// @Param namespace query string true "Tag namespace (e.g., 'status')"
+// @Param prefix query string false "Value prefix (empty matches all values)"
+// @Param limit query int false "Maximum suggestions (default 10, max 100)"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/tags/suggest [get]
+func (h *EntityHandler) SuggestTagValues(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		RespondError(w, http.StatusBadRequest, "namespace parameter is required")
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	
+	limit := defaultTagSuggestLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			RespondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxTagSuggestLimit)
+	}
+	
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Tag suggestions not supported by this repository")
+		return
+	}
+	
+	suggestions := binaryRepo.SuggestTagValues(namespace, prefix, limit)
+	RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"namespace":   namespace,
+		"prefix":      prefix,
+		"suggestions": suggestions,
+		"count":       len(suggestions),
+	})
+}
+
+// Limits for GetTagStats
+const (
+	defaultTagStatsLimit     = 50
+	maxTagStatsLimit         = 1000
+	defaultTagStatsTopValues = 5
+	maxTagStatsTopValues     = 100
+)
+
+// GetTagStats reports cardinality, top values, growth rate and index memory per tag namespace
+// @Summary Tag namespace statistics
+// @Description Per-namespace cardinality, most frequent values, growth per hour and approximate index memory, highest cardinality first, to spot runaway high-cardinality tags
+// @Tags tags
+// @Produce json
+// @Param namespace query string false "Report only this namespace"
+// @Param limit query int false "Maximum namespaces (default 50, max 1000)"
+// @Param top query int false "Most frequent values per namespace (default 5, max 100, 0 for none)"
+// @Success 200 {object} binary.TagStats
+// @Router /api/v1/tags/stats [get]
+func (h *EntityHandler) GetTagStats(w http.ResponseWriter, r *http.Request) {
+	opts := binary.TagStatsOptions{
+		Namespace: r.URL.Query().Get("namespace"),
+		Limit:     defaultTagStatsLimit,
+		TopValues: defaultTagStatsTopValues,
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			RespondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		opts.Limit = min(parsed, maxTagStatsLimit)
+	}
+	if topStr := r.URL.Query().Get("top"); topStr != "" {
+		parsed, err := strconv.Atoi(topStr)
+		if err != nil || parsed < 0 {
+			RespondError(w, http.StatusBadRequest, "top must be a non-negative integer")
+			return
+		}
+		opts.TopValues = min(parsed, maxTagStatsTopValues)
+	}
+
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Tag statistics not supported by this repository")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, binaryRepo.GetTagStats(opts))
+}
+
+// outsidePathDataset reports whether a dataset-scoped route addresses an
+// entity of another dataset
+func outsidePathDataset(r *http.Request, entity *models.Entity) bool {
+	pathDataset := extractDatasetFromPath(r.URL.Path)
+	return pathDataset != "" && entity.GetDataset() != pathDataset
+}
+
+// inPathDataset drops the entities a dataset-scoped route does not address
+func inPathDataset(r *http.Request, entities []*models.Entity) []*models.Entity {
+	if extractDatasetFromPath(r.URL.Path) == "" {
+		return entities
+	}
+	scoped := make([]*models.Entity, 0, len(entities))
+	for _, entity := range entities {
+		if !outsidePathDataset(r, entity) {
+			scoped = append(scoped, entity)
+		}
+	}
+	return scoped
+}
+
 // extractDatasetFromPath extracts dataset from URL path for dataset-scoped routes
 // Handles paths like: /datasets/{dataset}/entities/create
 func extractDatasetFromPath(path string) string {
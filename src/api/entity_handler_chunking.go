@@ -3,7 +3,9 @@ package api
 import (
 	"entitydb/logger"
 	"entitydb/models"
+	"entitydb/storage/binary"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 )
@@ -77,8 +79,9 @@ func (h *EntityHandler) HandleChunkedContent(entityID string, includeContent boo
 	var reassembledContent []byte
 	
 	// Fetch all chunks and reassemble content
-	for i := 0; i < chunkCount; i++ {
-		chunkID := fmt.Sprintf("%s-chunk-%d", entity.ID, i)
+	chunkIDs := entity.ChunkIDs()
+	for i := 0; i < chunkCount && i < len(chunkIDs); i++ {
+		chunkID := chunkIDs[i]
 		chunkEntity, err := h.repo.GetByID(chunkID)
 		
 		if err != nil {
@@ -140,7 +143,7 @@ func (h *EntityHandler) HandleChunkedEntityRetrieval(w http.ResponseWriter, r *h
 	}
 
 	// Get main entity
-	entity, err := h.repo.GetByID(id)
+	entity, err := h.visibleEntity(r, id)
 	if err != nil {
 		logger.Error("Failed to get entity %s: %v", id, err)
 		RespondError(w, http.StatusNotFound, "Entity not found")
@@ -164,13 +167,14 @@ func (h *EntityHandler) HandleChunkedEntityRetrieval(w http.ResponseWriter, r *h
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
 	// Stream chunks directly to response
-	for i := 0; i < chunkInfo.ChunkCount; i++ {
-		chunkID := fmt.Sprintf("%s-chunk-%d", entity.ID, i)
+	chunkIDs := entity.ChunkIDs()
+	for i := 0; i < chunkInfo.ChunkCount && i < len(chunkIDs); i++ {
+		chunkID := chunkIDs[i]
 		chunkEntity, err := h.repo.GetByID(chunkID)
 		
 		if err != nil {
 			logger.Error("Failed to get chunk %s: %v", chunkID, err)
-			continue
+			abortChunkStream()
 		}
 		
 		logger.Debug("Retrieved chunk %d/%d with %d bytes", 
@@ -199,8 +203,19 @@ func (h *EntityHandler) HandleRawChunkRetrieval(w http.ResponseWriter, r *http.R
 	var chunkIndex int
 	fmt.Sscanf(chunkIndexStr, "%d", &chunkIndex)
 	
-	// Construct chunk ID
-	chunkID := fmt.Sprintf("%s-chunk-%d", parentID, chunkIndex)
+	// Resolve chunk ID from the parent's chunk manifest
+	parent, err := h.visibleEntity(r, parentID)
+	if err != nil {
+		logger.Error("Failed to get parent entity %s: %v", parentID, err)
+		RespondError(w, http.StatusNotFound, "Parent entity not found")
+		return
+	}
+	chunkIDs := parent.ChunkIDs()
+	if chunkIndex < 0 || chunkIndex >= len(chunkIDs) {
+		RespondError(w, http.StatusNotFound, "Chunk not found")
+		return
+	}
+	chunkID := chunkIDs[chunkIndex]
 	
 	// Get chunk entity
 	chunkEntity, err := h.repo.GetByID(chunkID)
@@ -230,7 +245,7 @@ func (h *EntityHandler) StreamChunkedEntityContent(w http.ResponseWriter, r *htt
 	}
 	
 	// Get the main entity
-	entity, err := h.repo.GetByID(id)
+	entity, err := h.visibleEntity(r, id)
 	if err != nil {
 		logger.Error("Failed to get entity %s: %v", id, err)
 		RespondError(w, http.StatusNotFound, "Entity not found")
@@ -288,19 +303,23 @@ func (h *EntityHandler) StreamChunkedEntityContent(w http.ResponseWriter, r *htt
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", id))
 	
 	// Stream chunks directly to response
-	for i := 0; i < chunkInfo.ChunkCount; i++ {
-		chunkID := fmt.Sprintf("%s-chunk-%d", entity.ID, i)
-		chunkEntity, err := h.repo.GetByID(chunkID)
-		
+	chunkIDs := entity.ChunkIDs()
+	if len(chunkIDs) > chunkInfo.ChunkCount {
+		chunkIDs = chunkIDs[:chunkInfo.ChunkCount]
+	}
+	chunks := h.readChunksAhead(chunkIDs)
+	defer chunks.Close()
+	for i := range chunkIDs {
+		content, err := chunks.Next()
 		if err != nil {
-			logger.Error("Failed to get chunk %s: %v", chunkID, err)
-			continue
+			logger.Error("Failed to get chunk %d/%d: %v", i+1, chunkInfo.ChunkCount, err)
+			abortChunkStream()
 		}
 		
 		logger.Debug("Streaming chunk %d/%d with %d bytes", 
-			i+1, chunkInfo.ChunkCount, len(chunkEntity.Content))
+			i+1, chunkInfo.ChunkCount, len(content))
 		
-		if _, err := w.Write(chunkEntity.Content); err != nil {
+		if _, err := w.Write(content); err != nil {
 			logger.Error("Failed to write chunk to response: %v", err)
 			return
 		}
@@ -310,4 +329,103 @@ func (h *EntityHandler) StreamChunkedEntityContent(w http.ResponseWriter, r *htt
 			flusher.Flush()
 		}
 	}
-}
\ No newline at end of file
+}
+// readChunksAhead returns a reader that fetches the given chunks ahead of the
+// client. Chunks are read from the storage repository when possible so large
+// chunk content bypasses the query cache.
+func (h *EntityHandler) readChunksAhead(chunkIDs []string) *binary.ChunkReadAhead {
+	if binaryRepo, err := asTemporalRepository(h.repo); err == nil {
+		return binaryRepo.ReadChunksAhead(chunkIDs)
+	}
+	return binary.NewChunkReadAhead(h.repo.GetByID, chunkIDs, 0)
+}
+
+// chunkedContentReader exposes a chunked entity's content as an io.ReadSeeker.
+// Chunks are fetched lazily, so seeking to an offset (e.g. for an HTTP Range
+// request) only loads the chunks that are actually read, while sequential
+// reads are served by read-ahead.
+type chunkedContentReader struct {
+	chunks    *binary.ChunkReadAhead
+	chunkIDs  []string
+	chunkSize int64
+	totalSize int64
+	offset    int64
+	
+	// Most recently loaded chunk
+	current      []byte
+	currentIndex int
+}
+
+// newChunkedContentReader creates a reader over the given chunk IDs.
+// All chunks except the last must be exactly chunkSize bytes long.
+func newChunkedContentReader(chunks *binary.ChunkReadAhead, chunkIDs []string, chunkSize, totalSize int64) *chunkedContentReader {
+	return &chunkedContentReader{
+		chunks:       chunks,
+		chunkIDs:     chunkIDs,
+		chunkSize:    chunkSize,
+		totalSize:    totalSize,
+		currentIndex: -1,
+	}
+}
+
+// Read implements io.Reader
+func (c *chunkedContentReader) Read(p []byte) (int, error) {
+	if c.offset >= c.totalSize {
+		return 0, io.EOF
+	}
+	
+	index := int(c.offset / c.chunkSize)
+	if index >= len(c.chunkIDs) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	
+	if index != c.currentIndex {
+		c.chunks.Seek(index)
+		content, err := c.chunks.Next()
+		if err != nil {
+			return 0, err
+		}
+		logger.TraceIf("chunking", "loaded chunk: %d/%d, id=%s, size=%d",
+			index+1, len(c.chunkIDs), c.chunkIDs[index], len(content))
+		c.current = content
+		c.currentIndex = index
+	}
+	
+	within := c.offset - int64(index)*c.chunkSize
+	if within >= int64(len(c.current)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	
+	n := copy(p, c.current[within:])
+	c.offset += int64(n)
+	return n, nil
+}
+
+// Seek implements io.Seeker
+func (c *chunkedContentReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = c.offset + offset
+	case io.SeekEnd:
+		target = c.totalSize + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if target < 0 {
+		return 0, fmt.Errorf("negative position: %d", target)
+	}
+	c.offset = target
+	return target, nil
+}
+
+// abortChunkStream ends a chunk stream that cannot be completed. The
+// Content-Length sent promised every chunk, and a shorter body is a
+// malformed response HTTP/2 clients reject as a protocol error, so the
+// connection or stream is reset instead and the client sees a failed
+// transfer.
+func abortChunkStream() {
+	panic(http.ErrAbortHandler)
+}
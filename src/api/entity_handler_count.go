@@ -0,0 +1,163 @@
+package api
+
+import (
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// countDefaultGroups is the number of groups of a grouped count without
+	// a limit
+	countDefaultGroups = 100
+	// countMaxGroups caps the limit of a grouped count
+	countMaxGroups = 1000
+)
+
+// CountEntities counts entities by tag, optionally grouped by the values of
+// a tag namespace, from the tag index. Only matching entities with read ACLs
+// are read, to leave out those hidden from the user.
+// @Summary Count entities
+// @Description Count the entities carrying all given tags, optionally grouped by the values of a tag namespace. Counts come from the tag index posting lists and agree with the length of the matching /entities/list result; entities whose ACL hides them from the user are not counted.
+// @Tags entities
+// @Produce json
+// @Param tag query string false "Count entities with this tag; repeat for AND logic"
+// @Param group_by query string false "Tag namespace to group the count by (e.g., status)"
+// @Param limit query int false "Maximum groups, largest first (default 100, max 1000)"
+// @Success 200 {object} binary.TagCounts
+// @Failure 400 {object} ErrorResponse
+// @Failure 501 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/count [get]
+func (h *EntityHandler) CountEntities(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	params := r.URL.Query()
+
+	query := binary.TagCountQuery{
+		GroupBy: strings.TrimSpace(params.Get("group_by")),
+		Limit:   countDefaultGroups,
+	}
+	for _, tag := range params["tag"] {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			query.Tags = append(query.Tags, tag)
+		}
+	}
+	if dataset := extractDatasetFromPath(r.URL.Path); dataset != "" {
+		query.Tags = append(query.Tags, "dataset:"+dataset)
+	}
+	if strings.ContainsAny(query.GroupBy, ":|") {
+		RespondError(w, http.StatusBadRequest, "group_by must be a tag namespace, such as status")
+		return
+	}
+	if limitStr := params.Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			RespondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		query.Limit = min(parsed, countMaxGroups)
+	}
+
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Counting is not supported by this repository")
+		return
+	}
+
+	counts, err := readableCounts(r, binaryRepo, query)
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to count entities")
+		return
+	}
+	if queryMetrics != nil {
+		queryTags := query.Tags
+		if query.GroupBy != "" {
+			queryTags = append(append([]string(nil), queryTags...), "group_by:"+query.GroupBy)
+		}
+		queryMetrics.TrackQuery("count", queryTags, startTime, counts.Count, nil)
+	}
+	RespondJSON(w, http.StatusOK, counts)
+}
+
+// readableCounts counts like CountByTags, leaving out the matching entities
+// whose ACL hides them from the request's user. The index cannot tell who
+// may read an entity, so when entities with acl:read tags match, they are
+// read and the hidden ones are taken off the counts.
+func readableCounts(r *http.Request, repo *binary.EntityRepository, query binary.TagCountQuery) (binary.TagCounts, error) {
+	var restricted []string
+	for _, group := range repo.CountByTags(binary.TagCountQuery{Tags: query.Tags, GroupBy: "acl"}).Groups {
+		if strings.HasPrefix(group.Value, "read:") {
+			restricted = append(restricted, "acl:"+group.Value)
+		}
+	}
+	if len(restricted) == 0 {
+		return repo.CountByTags(query), nil
+	}
+
+	user := requestUser(r)
+	hidden := make(map[string]*models.Entity)
+	for _, aclTag := range restricted {
+		entities, err := repo.ListByTags(append(append([]string(nil), query.Tags...), aclTag), true)
+		if err != nil {
+			return binary.TagCounts{}, err
+		}
+		for _, entity := range entities {
+			if !models.CanAccessEntity(user, entity, models.ACLRead) {
+				hidden[entity.ID] = entity
+			}
+		}
+	}
+
+	limit := query.Limit
+	query.Limit = 0
+	counts := repo.CountByTags(query)
+	if len(hidden) == 0 {
+		return limitGroups(counts, limit), nil
+	}
+	counts.Count -= len(hidden)
+	if query.GroupBy == "" {
+		return counts, nil
+	}
+
+	// An entity counts towards every value of the namespace it has carried
+	taken := make(map[string]int)
+	for _, entity := range hidden {
+		values := make(map[string]bool)
+		for _, tag := range entity.GetTagsWithoutTimestamp() {
+			if value, ok := strings.CutPrefix(tag, query.GroupBy+":"); ok {
+				values[value] = true
+			}
+		}
+		for value := range values {
+			taken[value]++
+		}
+	}
+	groups := counts.Groups[:0]
+	for _, group := range counts.Groups {
+		group.Count -= taken[group.Value]
+		if group.Count > 0 {
+			groups = append(groups, group)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Value < groups[j].Value
+	})
+	counts.Groups = groups
+	counts.TotalGroups = len(groups)
+	return limitGroups(counts, limit), nil
+}
+
+// limitGroups keeps the largest limit groups of a count (0 = all)
+func limitGroups(counts binary.TagCounts, limit int) binary.TagCounts {
+	if limit > 0 && len(counts.Groups) > limit {
+		counts.Groups = counts.Groups[:limit]
+	}
+	return counts
+}
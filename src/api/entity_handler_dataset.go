@@ -34,6 +34,7 @@ func (h *EntityHandler) ListEntitiesDatasetAware(w http.ResponseWriter, r *http.
 		RespondError(w, http.StatusInternalServerError, "Failed to list entities")
 		return
 	}
+	entities = redactedEntities(r, readableEntities(r, entities))
 	
 	// Convert to response format
 	response := make([]map[string]interface{}, len(entities))
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// geoSearchDefaultLimit is the number of results of a geo search
+	// without a limit
+	geoSearchDefaultLimit = 100
+	// geoSearchMaxLimit caps the limit of a geo search
+	geoSearchMaxLimit = 1000
+)
+
+// GeoSearchResult is an entity found by a geo search
+type GeoSearchResult struct {
+	Entity   *models.Entity  `json:"entity"`
+	Location models.GeoPoint `json:"location"`
+	// DistanceMeters is the distance from the center of a radius search
+	DistanceMeters float64 `json:"distance_meters,omitempty"`
+}
+
+// GeoSearchResponse lists the entities found by a geo search
+type GeoSearchResponse struct {
+	Results []GeoSearchResult `json:"results"`
+	Total   int               `json:"total"`
+	Limit   int               `json:"limit"`
+}
+
+// GeoJSONFeatureCollection is a geo search result as GeoJSON (RFC 7946)
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature is an entity as a GeoJSON point feature
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Geometry   GeoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONPoint is a GeoJSON point geometry, longitude first
+type GeoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// GeoSearch finds entities tagged with a location within a bounding box or
+// radius
+// @Summary Search entities by location
+// @Description Find entities located with geo:lat and geo:lon tags, or a geo:hash tag, within a bounding box (bbox=west,south,east,north; a west greater than east crosses the antimeridian) or within radius meters of lat,lon. Radius results are nearest first, with their distance; bounding box results are ordered by ID. format=geojson returns a GeoJSON FeatureCollection.
+// @Tags entities
+// @Produce json
+// @Param bbox query string false "Bounding box west,south,east,north in decimal degrees"
+// @Param lat query number false "Latitude of the radius center"
+// @Param lon query number false "Longitude of the radius center"
+// @Param radius query number false "Radius in meters"
+// @Param dataset query string false "Only entities of this dataset"
+// @Param limit query int false "Maximum results (default 100, at most 1000)"
+// @Param format query string false "json (default) or geojson"
+// @Param include_timestamps query bool false "Include tag timestamps"
+// @Success 200 {object} GeoSearchResponse
+// @Failure 400 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/geo-search [get]
+func (h *EntityHandler) GeoSearch(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	params := r.URL.Query()
+
+	query, err := geoQueryFromParams(params)
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := geoSearchDefaultLimit
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			RespondError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if limit > geoSearchMaxLimit {
+			limit = geoSearchMaxLimit
+		}
+	}
+	format := params.Get("format")
+	if format != "" && format != "json" && format != "geojson" {
+		RespondError(w, http.StatusBadRequest, "format must be json or geojson")
+		return
+	}
+
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		logger.Error("repository doesn't support geo search: %v", err)
+		RespondError(w, http.StatusNotImplemented, "Geo search not available")
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	matches, err := binaryRepo.GeoSearch(ctx, query)
+
+	queryTags := []string{"geo:"}
+	if queryMetrics != nil {
+		queryMetrics.TrackQuery("geo", queryTags, startTime, len(matches), err)
+	}
+	if err != nil {
+		if respondQueryStopped(w, err) {
+			logger.Warn("geo search stopped: %v", err)
+			return
+		}
+		logger.Error("failed to execute geo search: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to execute geo search")
+		return
+	}
+
+	// Drop the entities the caller may not read, keeping the match order
+	entities := make([]*models.Entity, len(matches))
+	for i, match := range matches {
+		entities[i] = match.Entity
+	}
+	readable := make(map[string]bool)
+	for _, entity := range readableEntities(r, entities) {
+		readable[entity.ID] = true
+	}
+	visible := matches[:0]
+	for _, match := range matches {
+		if readable[match.Entity.ID] {
+			visible = append(visible, match)
+		}
+	}
+
+	total := len(visible)
+	if len(visible) > limit {
+		visible = visible[:limit]
+	}
+	entities = entities[:0]
+	for _, match := range visible {
+		entities = append(entities, match.Entity)
+	}
+	recordEntityAccess(r, entities, queryTags)
+
+	includeTimestamps := params.Get("include_timestamps") == "true"
+	results := make([]GeoSearchResult, len(visible))
+	for i, match := range visible {
+		results[i] = GeoSearchResult{
+			Entity:         h.stripTimestampsFromEntity(redactedEntity(r, match.Entity), includeTimestamps),
+			Location:       match.Location,
+			DistanceMeters: match.DistanceMeters,
+		}
+	}
+
+	if format == "geojson" {
+		respondGeoJSON(w, results)
+		return
+	}
+	RespondJSON(w, http.StatusOK, GeoSearchResponse{Results: results, Total: total, Limit: limit})
+}
+
+// geoQueryFromParams builds a geo query from either a bbox or a lat, lon and
+// radius
+func geoQueryFromParams(params url.Values) (binary.GeoQuery, error) {
+	query := binary.GeoQuery{Dataset: params.Get("dataset")}
+	bbox := params.Get("bbox")
+	radius := params.Get("radius")
+	switch {
+	case bbox != "" && radius != "":
+		return query, fmt.Errorf("bbox cannot be combined with radius")
+	case bbox != "":
+		bounds, err := models.ParseGeoBBox(bbox)
+		if err != nil {
+			return query, err
+		}
+		query.Bounds = bounds
+	case radius != "":
+		radiusMeters, err := strconv.ParseFloat(radius, 64)
+		if err != nil || radiusMeters <= 0 {
+			return query, fmt.Errorf("radius must be a positive number of meters")
+		}
+		lat, latErr := strconv.ParseFloat(params.Get("lat"), 64)
+		lon, lonErr := strconv.ParseFloat(params.Get("lon"), 64)
+		center := models.GeoPoint{Lat: lat, Lon: lon}
+		if latErr != nil || lonErr != nil || !center.Valid() {
+			return query, fmt.Errorf("a radius search needs a valid lat and lon")
+		}
+		query.Center = &center
+		query.RadiusMeters = radiusMeters
+	default:
+		return query, fmt.Errorf("either bbox or lat, lon and radius are required")
+	}
+	return query, nil
+}
+
+// respondGeoJSON writes geo search results as a GeoJSON FeatureCollection
+func respondGeoJSON(w http.ResponseWriter, results []GeoSearchResult) {
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]GeoJSONFeature, len(results))}
+	for i, result := range results {
+		properties := map[string]interface{}{"entity": result.Entity}
+		if result.DistanceMeters > 0 {
+			properties["distance_meters"] = result.DistanceMeters
+		}
+		collection.Features[i] = GeoJSONFeature{
+			Type:       "Feature",
+			ID:         result.Entity.ID,
+			Geometry:   GeoJSONPoint{Type: "Point", Coordinates: [2]float64{result.Location.Lon, result.Location.Lat}},
+			Properties: properties,
+		}
+	}
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(collection); err != nil {
+		logger.Error("Failed to write GeoJSON response: %v", err)
+	}
+}
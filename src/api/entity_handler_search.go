@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// SearchEntitiesRequest is the body of an EQL search
+type SearchEntitiesRequest struct {
+	Query             string `json:"query"`
+	Limit             int    `json:"limit,omitempty"`
+	Offset            int    `json:"offset,omitempty"`
+	IncludeTimestamps bool   `json:"include_timestamps,omitempty"`
+}
+
+// SearchEntities handles searches with compound boolean tag expressions
+// @Summary Search entities with an EQL expression
+// @Description Search entities with AND, OR, NOT and parentheses over tags, e.g. "type:doc AND (status:draft OR status:review) AND NOT dataset:archive". Tags ending in * match by prefix.
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param request body SearchEntitiesRequest true "EQL query"
+// @Success 200 {object} QueryEntityResponse
+// @Failure 400 {object} ErrorResponse "Invalid expression"
+// @Router /api/v1/entities/search [post]
+func (h *EntityHandler) SearchEntities(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	var req SearchEntitiesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Limit < 0 || req.Offset < 0 {
+		RespondError(w, http.StatusBadRequest, "limit and offset must not be negative")
+		return
+	}
+
+	node, err := binary.ParseEQL(req.Query)
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	queryTags := binary.EQLTags(node)
+
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		logger.Error("repository doesn't support expression search: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Expression search not available")
+		return
+	}
+
+	if !h.admitQuery(w, r, binary.QuerySpec{Expression: req.Query}) {
+		return
+	}
+
+	entities, err := binaryRepo.ListByExpression(req.Query)
+
+	if queryMetrics != nil {
+		queryMetrics.TrackQuery("expression", queryTags, startTime, len(entities), err)
+	}
+	if err != nil {
+		logger.Error("failed to execute search %q: %v", req.Query, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to execute search")
+		return
+	}
+	entities = readableEntities(r, entities)
+	recordEntityAccess(r, entities, queryTags)
+
+	// Order results so offset and limit page consistently
+	sort.Slice(entities, func(i, j int) bool {
+		if entities[i].CreatedAt != entities[j].CreatedAt {
+			return entities[i].CreatedAt < entities[j].CreatedAt
+		}
+		return entities[i].ID < entities[j].ID
+	})
+
+	total := len(entities)
+	if req.Offset < len(entities) {
+		entities = entities[req.Offset:]
+	} else {
+		entities = entities[:0]
+	}
+	if req.Limit > 0 && req.Limit < len(entities) {
+		entities = entities[:req.Limit]
+	}
+
+	responseEntities := make([]*models.Entity, len(entities))
+	for i, entity := range entities {
+		responseEntities[i] = h.stripTimestampsFromEntity(redactedEntity(r, entity), req.IncludeTimestamps)
+	}
+
+	RespondJSON(w, http.StatusOK, QueryEntityResponse{
+		Entities: responseEntities,
+		Total:    total,
+		Offset:   req.Offset,
+		Limit:    req.Limit,
+	})
+}
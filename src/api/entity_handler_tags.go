@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// PatchTagsRequest is the body of a partial tag mutation
+type PatchTagsRequest struct {
+	ID         string   `json:"id"`
+	AddTags    []string `json:"add_tags,omitempty"`
+	RemoveTags []string `json:"remove_tags,omitempty"`
+}
+
+// PatchTagsResponse reports the tags added to and removed from an entity
+type PatchTagsResponse struct {
+	ID      string   `json:"id"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// PatchEntityTags adds and removes individual tags without rewriting the entity
+// @Summary Add and remove entity tags
+// @Description Remove the tags in remove_tags, then add the tags in add_tags. Unlike a full update, tags other writers add or remove concurrently are preserved. Removing a tag removes all of its temporal values.
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param id query string false "Entity ID (can also be in body)"
+// @Param request body PatchTagsRequest true "Tags to add and remove"
+// @Success 200 {object} PatchTagsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/entities/patch-tags [patch]
+func (h *EntityHandler) PatchEntityTags(w http.ResponseWriter, r *http.Request) {
+	var req PatchTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.ID == "" {
+		req.ID = r.URL.Query().Get("id")
+	}
+	if req.ID == "" {
+		RespondError(w, http.StatusBadRequest, "Entity ID is required")
+		return
+	}
+	if len(req.AddTags) == 0 && len(req.RemoveTags) == 0 {
+		RespondError(w, http.StatusBadRequest, "add_tags or remove_tags is required")
+		return
+	}
+	for _, tag := range append(append([]string{}, req.AddTags...), req.RemoveTags...) {
+		if strings.TrimSpace(tag) == "" {
+			RespondError(w, http.StatusBadRequest, "Tags must not be empty")
+			return
+		}
+	}
+
+	entity, err := h.repo.GetByID(req.ID)
+	if err != nil || entity == nil {
+		RespondError(w, http.StatusNotFound, "Entity not found")
+		return
+	}
+	if hiddenOrReadOnly(w, r, entity) || rejectDatasetRecordWrite(w, r, entity.Tags, req.AddTags) {
+		return
+	}
+	defer h.lockIdentities(req.AddTags)()
+	if rejectDuplicateIdentity(w, h.repo, req.ID, req.AddTags) {
+		return
+	}
+	if rejectSensitiveTagRemoval(w, r, entity, remainingTags(entity, req.RemoveTags)) {
+		return
+	}
+
+	response := PatchTagsResponse{ID: req.ID, Added: []string{}, Removed: []string{}}
+	for _, tag := range req.RemoveTags {
+		for _, stored := range entity.StoredTags(tag) {
+			if err := h.repo.RemoveTag(req.ID, stored); err != nil {
+				if immutableRefused(w, err) {
+					return
+				}
+				logger.Error("failed to remove tag %s from entity %s: %v", tag, req.ID, err)
+				RespondError(w, http.StatusInternalServerError, "Failed to remove tag "+tag)
+				return
+			}
+		}
+		response.Removed = append(response.Removed, tag)
+	}
+	for _, tag := range req.AddTags {
+		if err := h.repo.AddTag(req.ID, tag); err != nil {
+			if immutableRefused(w, err) {
+				return
+			}
+			logger.Error("failed to add tag %s to entity %s: %v", tag, req.ID, err)
+			RespondError(w, http.StatusInternalServerError, "Failed to add tag "+tag)
+			return
+		}
+		response.Added = append(response.Added, tag)
+	}
+
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// rejectDuplicateIdentity responds with 409 Conflict when tags claim an
+// identity, such as identity:username:alice, that another entity holds.
+// entityID is empty for entities being created.
+func rejectDuplicateIdentity(w http.ResponseWriter, repo models.EntityRepository, entityID string, tags []string) bool {
+	err := models.CheckUniqueIdentity(repo, entityID, tags)
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, models.ErrDuplicateIdentity):
+		RespondError(w, http.StatusConflict, err.Error())
+	default:
+		logger.Error("failed to check identity tags: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to check identity tags")
+	}
+	return true
+}
+
+// lockIdentities takes the security manager's identity lock when the tags
+// claim an identity and returns the function releasing it. Writers hold it
+// from the identity check until their write is stored.
+func (h *EntityHandler) lockIdentities(tagSets ...[]string) func() {
+	if h.identities == nil || !models.ClaimsIdentity(tagSets...) {
+		return func() {}
+	}
+	return h.identities.LockIdentities()
+}
+
+// remainingTags returns the entity's current tags without the removed ones
+func remainingTags(entity *models.Entity, removed []string) []string {
+	drop := make(map[string]bool, len(removed))
+	for _, tag := range removed {
+		drop[tag] = true
+	}
+	var remaining []string
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		if !drop[tag] {
+			remaining = append(remaining, tag)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestIdentityChecksHoldUserCreationLock checks that a write claiming an
+// identity tag waits for user creation to finish, so the two cannot both
+// claim the same username
+func TestIdentityChecksHoldUserCreationLock(t *testing.T) {
+	security := newTestSecurity(t)
+	handler := NewEntityHandler(security.repo)
+	handler.SetSecurityManager(security.manager)
+	create := security.middleware.RequirePermission("entity", "create")(handler.CreateEntity)
+	patch := security.middleware.RequirePermission("entity", "update")(handler.PatchEntityTags)
+	_, token := security.login(t, "alice")
+
+	document := &models.Entity{ID: "doc-1", Tags: []string{"type:document", "dataset:default"}}
+	if err := security.repo.Create(document); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		username string
+		serve    http.HandlerFunc
+		req      *http.Request
+	}{
+		{"create", "carol", create, authorizedRequest("POST", "/api/v1/entities/create", token,
+			[]byte(`{"tags":["type:document","identity:username:carol"]}`))},
+		{"patch", "dave", patch, authorizedRequest("PATCH", "/api/v1/entities/patch-tags", token,
+			[]byte(`{"id":"doc-1","add_tags":["identity:username:dave"]}`))},
+	} {
+		// Hold the lock as CreateUser does between its check and its write
+		unlock := security.manager.LockIdentities()
+		recorder := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			tc.serve(recorder, tc.req)
+		}()
+		select {
+		case <-done:
+			unlock()
+			t.Fatalf("%s claiming %s finished while user creation held the identity lock: %d", tc.name, tc.username, recorder.Code)
+		case <-time.After(100 * time.Millisecond):
+		}
+		user := &models.Entity{ID: "user-" + tc.username, Tags: []string{"type:user", "dataset:system", models.UsernameTagPrefix + tc.username}}
+		if err := security.repo.Create(user); err != nil {
+			unlock()
+			t.Fatalf("Create: %v", err)
+		}
+		unlock()
+		<-done
+		if recorder.Code != http.StatusConflict {
+			t.Errorf("%s claiming %s after it was created = %d, want 409: %s", tc.name, tc.username, recorder.Code, recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// upserter is implemented by repositories that can create or update an
+// entity by key tag atomically
+type upserter interface {
+	Upsert(keyTag string, apply binary.UpsertFunc) (*models.Entity, bool, error)
+}
+
+// errUpsertForbidden is returned by an upsert that would change an entity
+// the request may not write
+var errUpsertForbidden = errors.New("entity ACL does not grant write access")
+
+// errUpsertOtherDataset is returned by an upsert on a dataset-scoped route
+// whose key is held by an entity in another dataset
+var errUpsertOtherDataset = errors.New("key is held by an entity in another dataset")
+
+// UpsertEntityRequest creates or updates the entity holding a key tag
+type UpsertEntityRequest struct {
+	Key     string      `json:"key"`               // Unique tag, e.g. external:id:1234
+	Tags    []string    `json:"tags,omitempty"`    // Tags to create with or add
+	Content interface{} `json:"content,omitempty"` // Replaces the content when set
+}
+
+// UpsertEntity creates or updates an entity by a unique key tag
+// @Summary Create or update an entity by key tag
+// @Description Find the entity holding the key tag (e.g. external:id:1234) and apply the tags and content to it, or create it with them and the key tag. Tags are added to an existing entity without removing others; content replaces its content. Upserts of the same key are serialized, so concurrent upserts never create two entities. Responds 201 when the entity was created and 200 when it was updated.
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param request body UpsertEntityRequest true "Key tag, tags and content"
+// @Success 200 {object} models.Entity
+// @Success 201 {object} models.Entity
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/upsert [post]
+func (h *EntityHandler) UpsertEntity(w http.ResponseWriter, r *http.Request) {
+	includeTimestamps := r.URL.Query().Get("include_timestamps") == "true"
+
+	var req UpsertEntityRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Key = strings.TrimSpace(req.Key)
+	if !strings.Contains(req.Key, ":") || strings.Contains(req.Key, "|") {
+		RespondError(w, http.StatusBadRequest, "key must be a tag such as external:id:1234")
+		return
+	}
+	if strings.HasPrefix(req.Key, "dataset:") || strings.HasPrefix(req.Key, "type:") {
+		RespondError(w, http.StatusBadRequest, "key must identify a single entity, not a dataset or type")
+		return
+	}
+	for _, tag := range req.Tags {
+		if strings.TrimSpace(tag) == "" {
+			RespondError(w, http.StatusBadRequest, "Tags must not be empty")
+			return
+		}
+	}
+
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	repo, ok := h.repo.(upserter)
+	if !ok {
+		RespondError(w, http.StatusNotImplemented, "Upserts not supported")
+		return
+	}
+
+	var contentBytes []byte
+	var contentType string
+	if req.Content != nil {
+		var err error
+		if contentBytes, contentType, err = decodeRequestContent(req.Content); err != nil {
+			RespondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	unlockIdentities := h.lockIdentities(req.Tags, []string{req.Key})
+	entity, created, err := repo.Upsert(req.Key, func(existing *models.Entity) (*models.Entity, error) {
+		if existing == nil {
+			return h.newUpsertEntity(r, req, securityCtx.User.ID, contentBytes, contentType)
+		}
+		return h.applyUpsert(r, existing, req, contentBytes, contentType)
+	})
+	unlockIdentities()
+	switch {
+	case errors.Is(err, binary.ErrUpsertKeyAmbiguous), errors.Is(err, models.ErrDuplicateIdentity),
+		errors.Is(err, errUpsertOtherDataset):
+		RespondError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, errUpsertForbidden):
+		RespondError(w, http.StatusForbidden, "Entity ACL does not grant write access")
+		return
+	case errors.Is(err, errDatasetRecordWrite):
+		RespondError(w, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, binary.ErrDatasetQuotaExceeded):
+		RespondError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	case err != nil:
+		logger.Error("failed to upsert entity by %s: %v", req.Key, err)
+		TrackHTTPError("entity_handler.UpsertEntity", http.StatusInternalServerError, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to upsert entity")
+		return
+	}
+
+	if saved, err := h.repo.GetByID(entity.ID); err == nil {
+		entity = saved
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	logger.Info("entity upserted: id=%s, key=%s, created=%v", entity.ID, req.Key, created)
+
+	setChangeCounterHeaders(w, h.repo, entity)
+	setQuotaWarningHeader(w, h.repo, entity)
+	RespondJSON(w, status, h.stripTimestampsFromEntity(redactedEntity(r, entity), includeTimestamps))
+}
+
+// newUpsertEntity builds the entity an upsert creates, as CreateEntity would
+// from the request's tags and content
+func (h *EntityHandler) newUpsertEntity(r *http.Request, req UpsertEntityRequest, createdBy string, content []byte, contentType string) (*models.Entity, error) {
+	entity, err := newRequestEntity(r, append(append([]string{}, req.Tags...), req.Key), createdBy)
+	if err != nil {
+		return nil, err
+	}
+	if datasetRecordWriteRefused(r, entity.Tags) {
+		return nil, errDatasetRecordWrite
+	}
+	if err := models.CheckUniqueIdentity(h.repo, "", entity.Tags); err != nil {
+		return nil, err
+	}
+	if content != nil {
+		if err := setEntityContent(h.repo, entity, content, contentType); err != nil {
+			return nil, fmt.Errorf("failed to store content: %w", err)
+		}
+	}
+	return entity, nil
+}
+
+// applyUpsert adds the request's tags to a copy of the entity holding the
+// key and replaces its content when the request has content. Tags whose
+// value is already current are not added again, and dataset: tags are
+// ignored; an upsert never moves an entity between datasets.
+func (h *EntityHandler) applyUpsert(r *http.Request, existing *models.Entity, req UpsertEntityRequest, content []byte, contentType string) (*models.Entity, error) {
+	if outsidePathDataset(r, existing) {
+		return nil, errUpsertOtherDataset
+	}
+	if !canAccessEntity(r, existing, models.ACLRead) || !canAccessEntity(r, existing, models.ACLWrite) {
+		return nil, errUpsertForbidden
+	}
+	if datasetRecordWriteRefused(r, existing.Tags, req.Tags) {
+		return nil, errDatasetRecordWrite
+	}
+	if err := models.CheckUniqueIdentity(h.repo, existing.ID, req.Tags); err != nil {
+		return nil, err
+	}
+
+	entity := &models.Entity{
+		ID:        existing.ID,
+		Tags:      append([]string(nil), existing.Tags...),
+		Content:   existing.Content,
+		CreatedAt: existing.CreatedAt,
+		UpdatedAt: existing.UpdatedAt,
+	}
+	for _, tag := range req.Tags {
+		if strings.HasPrefix(tag, "dataset:") {
+			continue
+		}
+		// Tags are temporal: a value is current when it is the latest in
+		// its namespace, so only values that are not current are added
+		if namespace, value, ok := strings.Cut(tag, ":"); ok && entity.GetTagValue(namespace) == value {
+			continue
+		}
+		entity.AddTag(tag)
+	}
+	if content != nil {
+		if err := setEntityContent(h.repo, entity, content, contentType); err != nil {
+			return nil, fmt.Errorf("failed to store content: %w", err)
+		}
+	}
+	return entity, nil
+}
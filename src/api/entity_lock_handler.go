@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// EntityLockHandler takes and releases advisory locks on entities
+type EntityLockHandler struct {
+	repo    models.EntityRepository
+	service *services.EntityLockService
+}
+
+// NewEntityLockHandler creates a new entity lock handler
+func NewEntityLockHandler(repo models.EntityRepository, service *services.EntityLockService) *EntityLockHandler {
+	return &EntityLockHandler{repo: repo, service: service}
+}
+
+// EntityLockRequest takes or renews a lock
+type EntityLockRequest struct {
+	// TTL is the lease as a Go duration such as "90s" or "10m"
+	TTL string `json:"ttl,omitempty"`
+}
+
+// EntityLockedResponse describes the lock that refused a request
+type EntityLockedResponse struct {
+	Error string             `json:"error"`
+	Lock  *models.EntityLock `json:"lock"`
+}
+
+// LockEntity takes or renews the lock on an entity
+// @Summary Lock entity
+// @Description Take an advisory lock on an entity for a lease, or renew a lock the caller holds. The lock is stored as lock:holder, lock:acquired and lock:expires tags and is released when its lease expires. With ENTITYDB_ENTITY_LOCK_ENFORCE updates by other users are refused while it is held.
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param id path string true "Entity ID"
+// @Param request body EntityLockRequest false "Lease"
+// @Success 200 {object} models.EntityLock
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 423 {object} EntityLockedResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/{id}/lock [post]
+func (h *EntityLockHandler) LockEntity(w http.ResponseWriter, r *http.Request) {
+	var req EntityLockRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid ttl: "+err.Error())
+			return
+		}
+	}
+
+	id := mux.Vars(r)["id"]
+	if !h.writable(w, r, id) {
+		return
+	}
+	lock, err := h.service.Lock(id, requestUser(r), ttl)
+	if err != nil {
+		h.respondLockError(w, id, err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, lock)
+}
+
+// UnlockEntity releases the lock on an entity
+// @Summary Unlock entity
+// @Description Release the advisory lock on an entity. Only the holder may release an unexpired lock; administrators can release any lock with force=true.
+// @Tags entities
+// @Produce json
+// @Param id path string true "Entity ID"
+// @Param force query bool false "Release a lock held by another user (admin only)"
+// @Success 204
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 423 {object} EntityLockedResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/{id}/unlock [post]
+func (h *EntityLockHandler) UnlockEntity(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	force := r.URL.Query().Get("force") == "true"
+	if force && (user == nil || user.Entity == nil || !user.Entity.HasTag("rbac:role:admin")) {
+		RespondError(w, http.StatusForbidden, "Forcing an unlock requires the admin role")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if !h.writable(w, r, id) {
+		return
+	}
+	if err := h.service.Unlock(id, user, force); err != nil {
+		h.respondLockError(w, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writable responds unless the request's user may change the entity
+func (h *EntityLockHandler) writable(w http.ResponseWriter, r *http.Request, id string) bool {
+	entity, err := repoGetByID(r.Context(), h.repo, id)
+	if err != nil || outsidePathDataset(r, entity) {
+		RespondError(w, http.StatusNotFound, "Entity not found")
+		return false
+	}
+	return !hiddenOrReadOnly(w, r, entity)
+}
+
+// respondLockError maps lock service errors to responses
+func (h *EntityLockHandler) respondLockError(w http.ResponseWriter, id string, err error) {
+	var locked *services.LockedError
+	switch {
+	case errors.As(err, &locked):
+		respondLocked(w, locked)
+	case errors.Is(err, services.ErrInvalidLockTTL):
+		RespondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrLockNotHeld), isImmutableWrite(err):
+		RespondError(w, http.StatusConflict, err.Error())
+	default:
+		logger.Error("Failed to change lock of entity %s: %v", id, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to change entity lock")
+	}
+}
+
+// respondLocked responds with 423 Locked and the lock in the way
+func respondLocked(w http.ResponseWriter, locked *services.LockedError) {
+	RespondJSON(w, http.StatusLocked, EntityLockedResponse{Error: locked.Error(), Lock: locked.Lock})
+}
@@ -4,6 +4,7 @@ import (
 	"entitydb/logger"
 	"entitydb/models"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,12 +14,29 @@ import (
 
 // EntityRelationshipHandler provides advanced relationship discovery APIs
 type EntityRelationshipHandler struct {
-	repo models.EntityRepository
+	repo  models.EntityRepository
+	edges edgeIndex // nil when the repository keeps no adjacency index
+}
+
+// edgeIndex looks up the typed relationships declared by rel: tags without
+// scanning tags
+type edgeIndex interface {
+	Edges(entityID string, direction models.EdgeDirection, relType string) []models.Edge
 }
 
 // NewEntityRelationshipHandler creates a new relationship handler
 func NewEntityRelationshipHandler(repo models.EntityRepository) *EntityRelationshipHandler {
-	return &EntityRelationshipHandler{repo: repo}
+	h := &EntityRelationshipHandler{repo: repo}
+	if binaryRepo, err := asTemporalRepository(repo); err == nil {
+		h.edges = binaryRepo
+	}
+	return h
+}
+
+// forRequest returns a handler that only sees the entities the request's
+// user may read under their ACL tags
+func (h *EntityRelationshipHandler) forRequest(r *http.Request) *EntityRelationshipHandler {
+	return &EntityRelationshipHandler{repo: aclRepository{EntityRepository: h.repo, user: requestUser(r)}, edges: h.edges}
 }
 
 // RelationshipDiscovery represents discovered relationships
@@ -100,6 +118,7 @@ type EntityNetwork struct {
 
 // DiscoverRelationships performs comprehensive relationship discovery for an entity
 func (h *EntityRelationshipHandler) DiscoverRelationships(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	vars := mux.Vars(r)
 	entityID := vars["id"]
 
@@ -108,7 +127,7 @@ func (h *EntityRelationshipHandler) DiscoverRelationships(w http.ResponseWriter,
 		return
 	}
 
-	logger.Trace("relationship", "Discovering relationships for entity: %s", entityID)
+	logger.TraceIf("relationship", "Discovering relationships for entity: %s", entityID)
 
 	// Get the focus entity
 	focusEntity, err := h.repo.GetByID(entityID)
@@ -124,7 +143,7 @@ func (h *EntityRelationshipHandler) DiscoverRelationships(w http.ResponseWriter,
 	}
 
 	// Discover direct references (entities that reference this entity in their tags)
-	discovery.DirectRefs = h.discoverDirectReferences(entityID)
+	discovery.DirectRefs = append(h.discoverTypedReferences(focusEntity), h.discoverDirectReferences(entityID)...)
 
 	// Discover tag-based relationships (entities with similar/related tags)
 	discovery.TagBasedRefs = h.discoverTagBasedRelationships(focusEntity)
@@ -144,6 +163,7 @@ func (h *EntityRelationshipHandler) DiscoverRelationships(w http.ResponseWriter,
 
 // GetEntityNetwork returns a network graph for an entity up to specified depth
 func (h *EntityRelationshipHandler) GetEntityNetwork(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	vars := mux.Vars(r)
 	entityID := vars["id"]
 	depthStr := vars["depth"]
@@ -160,14 +180,56 @@ func (h *EntityRelationshipHandler) GetEntityNetwork(w http.ResponseWriter, r *h
 		}
 	}
 
-	logger.Trace("relationship", "Building network graph for entity: %s, depth: %d", entityID, depth)
+	direction, ok := models.ParseEdgeDirection(r.URL.Query().Get("direction"))
+	if !ok {
+		RespondError(w, http.StatusBadRequest, "direction must be out, in or both")
+		return
+	}
+	relType := r.URL.Query().Get("type")
 
-	network := h.buildEntityNetwork(entityID, depth)
+	logger.TraceIf("relationship", "Building network graph for entity: %s, depth: %d, direction: %s", entityID, depth, direction)
+
+	network := h.buildEntityNetwork(entityID, depth, direction, relType)
 	RespondJSON(w, http.StatusOK, network)
 }
 
+// EntityEdges lists the typed relationships of an entity
+type EntityEdges struct {
+	EntityID  string        `json:"entity_id"`
+	Direction string        `json:"direction"`
+	Edges     []models.Edge `json:"edges"`
+}
+
+// GetEntityEdges returns the typed relationships declared with
+// rel:<type>:<target-id> tags from and to an entity
+func (h *EntityRelationshipHandler) GetEntityEdges(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	entityID := mux.Vars(r)["id"]
+
+	direction, ok := models.ParseEdgeDirection(r.URL.Query().Get("direction"))
+	if !ok {
+		RespondError(w, http.StatusBadRequest, "direction must be out, in or both")
+		return
+	}
+
+	entity, err := h.repo.GetByID(entityID)
+	if err != nil {
+		RespondError(w, http.StatusNotFound, "Entity not found")
+		return
+	}
+
+	edges := []models.Edge{}
+	for _, edge := range h.entityEdges(entity, direction, r.URL.Query().Get("type")) {
+		if h.readable(edge.Source) && h.readable(edge.Target) {
+			edges = append(edges, edge)
+		}
+	}
+	RespondJSON(w, http.StatusOK, EntityEdges{EntityID: entityID, Direction: string(direction), Edges: edges})
+}
+
 // GetRelatedByTags returns entities related through specific tag relationships
 func (h *EntityRelationshipHandler) GetRelatedByTags(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	vars := mux.Vars(r)
 	entityID := vars["id"]
 
@@ -192,6 +254,46 @@ func (h *EntityRelationshipHandler) GetRelatedByTags(w http.ResponseWriter, r *h
 
 // Helper methods for relationship discovery
 
+// discoverTypedReferences reports the rel: edges from and to an entity whose
+// other end the caller may read
+func (h *EntityRelationshipHandler) discoverTypedReferences(entity *models.Entity) []EntityReference {
+	references := []EntityReference{}
+	peers := map[string]*models.Entity{entity.ID: entity}
+
+	for _, edge := range h.entityEdges(entity, models.EdgeBoth, "") {
+		peerID := edge.Target
+		if peerID == entity.ID {
+			peerID = edge.Source
+		}
+		peer, seen := peers[peerID]
+		if !seen {
+			if peer, _ = h.repo.GetByID(peerID); peer != nil && peer.IsRecoveryPlaceholder() {
+				peer = nil
+			}
+			peers[peerID] = peer
+		}
+		if peer == nil {
+			continue
+		}
+
+		source, target := peers[edge.Source], peers[edge.Target]
+		references = append(references, EntityReference{
+			SourceID:     source.ID,
+			SourceName:   h.getEntityName(source),
+			SourceType:   h.getEntityType(source),
+			TargetID:     target.ID,
+			TargetName:   h.getEntityName(target),
+			TargetType:   h.getEntityType(target),
+			RelationType: edge.Type,
+			ViaTag:       models.RelationshipTag(edge.Type, edge.Target),
+			Confidence:   1.0,
+			CreatedAt:    time.Unix(0, source.CreatedAt),
+		})
+	}
+
+	return references
+}
+
 func (h *EntityRelationshipHandler) discoverDirectReferences(entityID string) []EntityReference {
 	references := []EntityReference{}
 
@@ -320,7 +422,12 @@ func (h *EntityRelationshipHandler) discoverSharedTagRelationships(focusEntity *
 	return relations
 }
 
-func (h *EntityRelationshipHandler) buildEntityNetwork(focusEntityID string, depth int) *EntityNetwork {
+// buildEntityNetwork walks up to depth hops out from the focus entity.
+// Typed rel: edges are followed in the requested direction, optionally of
+// one type only; without a type filter the untyped references found by
+// findConnectedEntities are followed outwards too. Entities the caller may
+// not read are left out together with their edges.
+func (h *EntityRelationshipHandler) buildEntityNetwork(focusEntityID string, depth int, direction models.EdgeDirection, relType string) *EntityNetwork {
 	network := &EntityNetwork{
 		FocusEntity: focusEntityID,
 		Nodes:       []NetworkNode{},
@@ -329,64 +436,60 @@ func (h *EntityRelationshipHandler) buildEntityNetwork(focusEntityID string, dep
 		GeneratedAt: time.Now(),
 	}
 
-	visited := make(map[string]bool)
-	nodeQueue := []string{focusEntityID}
-	currentDepth := 0
+	distance := map[string]int{focusEntityID: 0}
+	included := make(map[string]bool)
+	var candidates []models.Edge
+	frontier := []string{focusEntityID}
 
-	for currentDepth < depth && len(nodeQueue) > 0 {
-		nextQueue := []string{}
+	for hop := 0; len(frontier) > 0; hop++ {
+		next := []string{}
 
-		for _, entityID := range nodeQueue {
-			if visited[entityID] {
-				continue
-			}
-			visited[entityID] = true
-
-			// Get entity details
+		for _, entityID := range frontier {
 			entity, err := h.repo.GetByID(entityID)
-			if err != nil {
+			if err != nil || entity.IsRecoveryPlaceholder() {
 				continue
 			}
+			included[entity.ID] = true
 
-			// Add node
-			node := NetworkNode{
+			network.Nodes = append(network.Nodes, NetworkNode{
 				ID:       entity.ID,
 				Name:     h.getEntityName(entity),
 				Type:     h.getEntityType(entity),
 				Tags:     h.parseEntityTags(entity),
 				IsFocus:  entity.ID == focusEntityID,
-				Distance: currentDepth,
+				Distance: hop,
 				Properties: map[string]string{
 					"created_at": time.Unix(0, entity.CreatedAt).Format(time.RFC3339),
 				},
-			}
-
-			network.Nodes = append(network.Nodes, node)
-
-			// Find connected entities for next depth level
-			if currentDepth < depth-1 {
-				connected := h.findConnectedEntities(entity)
-				for _, connectedID := range connected {
-					if !visited[connectedID] {
-						nextQueue = append(nextQueue, connectedID)
-
-						// Add edge
-						edge := NetworkEdge{
-							Source: entity.ID,
-							Target: connectedID,
-							Type:   "related",
-							Weight: 1.0,
-						}
-						network.Edges = append(network.Edges, edge)
+			})
+
+			// Edges of the outermost nodes still connect them to each other
+			edges := h.entityEdges(entity, direction, relType)
+			if relType == "" && direction != models.EdgeIncoming {
+				for _, connectedID := range h.findConnectedEntities(entity) {
+					if connectedID != entity.ID {
+						edges = append(edges, models.Edge{Source: entity.ID, Target: connectedID, Type: "related"})
 					}
 				}
 			}
+			for _, edge := range edges {
+				candidates = append(candidates, edge)
+				peer := edge.Target
+				if peer == entity.ID {
+					peer = edge.Source
+				}
+				if _, seen := distance[peer]; !seen && hop < depth {
+					distance[peer] = hop + 1
+					next = append(next, peer)
+				}
+			}
 		}
 
-		nodeQueue = nextQueue
-		currentDepth++
+		frontier = next
 	}
 
+	network.Edges = networkEdges(candidates, included)
+
 	// Calculate connection counts
 	for i := range network.Nodes {
 		connections := 0
@@ -404,6 +507,71 @@ func (h *EntityRelationshipHandler) buildEntityNetwork(focusEntityID string, dep
 	return network
 }
 
+// entityEdges returns the typed edges of an entity from the adjacency index,
+// or only the ones it declares itself when the repository keeps no index
+func (h *EntityRelationshipHandler) entityEdges(entity *models.Entity, direction models.EdgeDirection, relType string) []models.Edge {
+	if h.edges != nil {
+		return h.edges.Edges(entity.ID, direction, relType)
+	}
+	var edges []models.Edge
+	for _, edge := range models.EntityEdges(entity) {
+		if edge.Matches(entity.ID, direction, relType) {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// readable reports whether an entity exists and the caller may read it.
+// Missing entities come back from the repository as recovery placeholders.
+func (h *EntityRelationshipHandler) readable(entityID string) bool {
+	entity, err := h.repo.GetByID(entityID)
+	return err == nil && !entity.IsRecoveryPlaceholder()
+}
+
+// networkEdges keeps the distinct edges between included nodes. An edge
+// declared in both directions with the same type becomes one bidirectional
+// edge.
+func networkEdges(candidates []models.Edge, included map[string]bool) []NetworkEdge {
+	seen := make(map[models.Edge]bool)
+	var unique []models.Edge
+	for _, edge := range candidates {
+		if included[edge.Source] && included[edge.Target] && !seen[edge] {
+			seen[edge] = true
+			unique = append(unique, edge)
+		}
+	}
+
+	edges := []NetworkEdge{}
+	merged := make(map[models.Edge]bool)
+	for _, edge := range unique {
+		if merged[edge] {
+			continue
+		}
+		reverse := models.Edge{Source: edge.Target, Target: edge.Source, Type: edge.Type}
+		bidirectional := reverse != edge && seen[reverse]
+		merged[reverse] = bidirectional
+		edges = append(edges, NetworkEdge{
+			Source:        edge.Source,
+			Target:        edge.Target,
+			Type:          edge.Type,
+			Weight:        1.0,
+			Bidirectional: bidirectional,
+		})
+	}
+
+	sort.SliceStable(edges, func(i, j int) bool {
+		if edges[i].Type != edges[j].Type {
+			return edges[i].Type < edges[j].Type
+		}
+		if edges[i].Source != edges[j].Source {
+			return edges[i].Source < edges[j].Source
+		}
+		return edges[i].Target < edges[j].Target
+	})
+	return edges
+}
+
 // Utility helper methods
 
 func (h *EntityRelationshipHandler) parseEntityTags(entity *models.Entity) []string {
@@ -498,6 +666,10 @@ func (h *EntityRelationshipHandler) findConnectedEntities(entity *models.Entity)
 	tags := h.parseEntityTags(entity)
 
 	for _, tag := range tags {
+		// Typed relationships are followed through the adjacency index
+		if strings.HasPrefix(tag, models.RelationshipTagPrefix) {
+			continue
+		}
 		// Look for entity ID references in tags
 		if strings.Contains(tag, ":") && len(tag) > 30 { // Likely contains entity ID
 			parts := strings.Split(tag, ":")
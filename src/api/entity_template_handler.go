@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/services"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// EntityTemplateHandler manages entity templates and creates entities from
+// them through the entity handler's create path
+type EntityTemplateHandler struct {
+	service  *services.EntityTemplateService
+	entities *EntityHandler
+}
+
+// NewEntityTemplateHandler creates a new entity template handler
+func NewEntityTemplateHandler(service *services.EntityTemplateService, entities *EntityHandler) *EntityTemplateHandler {
+	return &EntityTemplateHandler{service: service, entities: entities}
+}
+
+// EntityTemplateListResponse lists entity templates
+type EntityTemplateListResponse struct {
+	Templates []services.EntityTemplate `json:"templates"`
+	Total     int                       `json:"total"`
+}
+
+// respondEntityTemplateError maps entity template service errors to responses
+func respondEntityTemplateError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, services.ErrEntityTemplateNotFound):
+		RespondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrEntityTemplateExists):
+		RespondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidEntityTemplate), errors.Is(err, services.ErrTemplateRequirements):
+		RespondError(w, http.StatusBadRequest, err.Error())
+	default:
+		logger.Error("Failed to %s entity template: %v", action, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to "+action+" entity template")
+	}
+}
+
+// ListTemplates lists entity templates
+// @Summary List entity templates
+// @Description List entity template definitions, ordered by name
+// @Tags entities
+// @Produce json
+// @Success 200 {object} EntityTemplateListResponse
+// @Security BearerAuth
+// @Router /api/v1/entity-templates [get]
+func (h *EntityTemplateHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.service.List()
+	if err != nil {
+		respondEntityTemplateError(w, "list", err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, EntityTemplateListResponse{Templates: templates, Total: len(templates)})
+}
+
+// CreateTemplate saves an entity template
+// @Summary Create entity template
+// @Description Save a named template: the type and optional dataset of created entities, default tags, required tag namespaces and content fields, and a JSON content scaffold
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param request body services.EntityTemplate true "Template definition"
+// @Success 201 {object} services.EntityTemplate
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entity-templates [post]
+func (h *EntityTemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	var req services.EntityTemplate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	template, err := h.service.Create(req, securityCtx.User.ID)
+	if err != nil {
+		respondEntityTemplateError(w, "create", err)
+		return
+	}
+	RespondJSON(w, http.StatusCreated, template)
+}
+
+// GetTemplate returns an entity template
+// @Summary Get entity template
+// @Tags entities
+// @Produce json
+// @Param name path string true "Template name"
+// @Success 200 {object} services.EntityTemplate
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entity-templates/{name} [get]
+func (h *EntityTemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	template, err := h.service.Get(mux.Vars(r)["name"])
+	if err != nil {
+		respondEntityTemplateError(w, "get", err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, template)
+}
+
+// UpdateTemplate replaces an entity template
+// @Summary Update entity template
+// @Description Replace the definition of a template. The name cannot change, and entities already created from it are not changed.
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param name path string true "Template name"
+// @Param request body services.EntityTemplate true "Template definition"
+// @Success 200 {object} services.EntityTemplate
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entity-templates/{name} [put]
+func (h *EntityTemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req services.EntityTemplate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	template, err := h.service.Update(mux.Vars(r)["name"], req)
+	if err != nil {
+		respondEntityTemplateError(w, "update", err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, template)
+}
+
+// DeleteTemplate removes an entity template
+// @Summary Delete entity template
+// @Tags entities
+// @Produce json
+// @Param name path string true "Template name"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entity-templates/{name} [delete]
+func (h *EntityTemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := h.service.Delete(name); err != nil {
+		respondEntityTemplateError(w, "delete", err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, map[string]interface{}{"template": name, "deleted": true})
+}
+
+// CreateEntityFromTemplate creates an entity from a template
+// @Summary Create entity from template
+// @Description Create an entity from a template. The body is a create request whose tags and content override the template's: a tag replaces the template's tags of its namespace and JSON object content is merged into the scaffold. The template fixes the type, and the dataset when it sets one. Instances are tagged template:<name>.
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param template path string true "Template name"
+// @Param include_timestamps query bool false "Return tags with timestamps"
+// @Param body body CreateEntityRequest false "Overrides"
+// @Success 201 {object} models.Entity
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/create-from-template/{template} [post]
+func (h *EntityTemplateHandler) CreateEntityFromTemplate(w http.ResponseWriter, r *http.Request) {
+	var req CreateEntityRequest
+	if r.ContentLength != 0 {
+		if err := DecodeJSON(r, &req); err != nil {
+			TrackHTTPError("entity_template_handler.CreateEntityFromTemplate", http.StatusBadRequest, err)
+			RespondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	template, err := h.service.Get(mux.Vars(r)["template"])
+	if err != nil {
+		respondEntityTemplateError(w, "load", err)
+		return
+	}
+	tags, content, err := template.Instantiate(req.Tags, req.Content)
+	if err != nil {
+		respondEntityTemplateError(w, "instantiate", err)
+		return
+	}
+
+	req.Tags, req.Content = tags, content
+	h.entities.createEntity(w, r, req, r.URL.Query().Get("include_timestamps") == "true")
+}
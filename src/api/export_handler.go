@@ -0,0 +1,641 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// Export formats
+const (
+	ExportFormatJSONL = "jsonl"
+	ExportFormatCSV   = "csv"
+)
+
+const (
+	exportJobType = "export"
+
+	// exportCleanupInterval is how often expired export artifacts are removed
+	exportCleanupInterval = time.Minute
+
+	// exportCallbackTimeout bounds the completion notification request
+	exportCallbackTimeout = 10 * time.Second
+)
+
+// ExportStatus describes an export job and, once completed, its artifact
+type ExportStatus struct {
+	JobStatus
+	Format      string     `json:"format"`
+	Query       string     `json:"query,omitempty"`
+	Entities    int64      `json:"entities"`
+	SizeBytes   int64      `json:"size_bytes"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// exportArtifact tracks an export job and the file it writes
+type exportArtifact struct {
+	job         *Job
+	owner       string
+	format      string
+	query       string
+	path        string
+	callbackURL string
+
+	mu        sync.Mutex
+	entities  int64
+	size      int64
+	expiresAt time.Time
+}
+
+// status returns a snapshot of the export
+func (a *exportArtifact) status() ExportStatus {
+	status := ExportStatus{
+		JobStatus: a.job.Status(),
+		Format:    a.format,
+		Query:     a.query,
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status.Entities = a.entities
+	status.SizeBytes = a.size
+	if status.Status == JobStatusCompleted {
+		status.DownloadURL = "/api/v1/exports/" + status.ID + "/download"
+		expiresAt := a.expiresAt
+		status.ExpiresAt = &expiresAt
+	}
+	return status
+}
+
+// ExportHandler runs query exports as background jobs. Results are written
+// server-side as JSONL or CSV and downloaded once the job completes, so
+// large exports do not have to fit in one HTTP request. Artifacts expire
+// after a TTL.
+type ExportHandler struct {
+	entities      *EntityHandler
+	jobs          *JobManager
+	dir           string
+	ttl           time.Duration
+	maxConcurrent int // 0 means no limit
+	client        *http.Client
+
+	mu        sync.Mutex
+	artifacts map[string]*exportArtifact
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewExportHandler creates an export handler running the queries of the
+// entity handler as jobs of the job manager
+func NewExportHandler(entities *EntityHandler, jobs *JobManager, cfg *config.Config) *ExportHandler {
+	ttl := cfg.ExportTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &ExportHandler{
+		entities:      entities,
+		jobs:          jobs,
+		dir:           cfg.ExportFullPath(),
+		ttl:           ttl,
+		maxConcurrent: cfg.ExportMaxConcurrent,
+		client:        &http.Client{Timeout: exportCallbackTimeout},
+		artifacts:     make(map[string]*exportArtifact),
+		stop:          make(chan struct{}),
+	}
+}
+
+// Start prepares the export directory and starts removing expired artifacts.
+// Artifacts left by a previous run are removed, since their jobs are gone.
+func (h *ExportHandler) Start() error {
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	for _, pattern := range []string{"*." + ExportFormatJSONL, "*." + ExportFormatCSV, "*.part"} {
+		leftovers, _ := filepath.Glob(filepath.Join(h.dir, pattern))
+		for _, path := range leftovers {
+			if err := os.Remove(path); err != nil {
+				logger.Warn("Failed to remove stale export %s: %v", path, err)
+			}
+		}
+	}
+	go h.cleanupLoop()
+	return nil
+}
+
+// Stop stops the cleanup loop; running exports are cancelled by the job
+// manager
+func (h *ExportHandler) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+}
+
+func (h *ExportHandler) cleanupLoop() {
+	ticker := time.NewTicker(exportCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.removeExpired(time.Now())
+		}
+	}
+}
+
+// removeExpired deletes completed and failed exports past their expiry
+func (h *ExportHandler) removeExpired(now time.Time) {
+	h.mu.Lock()
+	var expired []*exportArtifact
+	for id, artifact := range h.artifacts {
+		artifact.mu.Lock()
+		done := !artifact.expiresAt.IsZero() && now.After(artifact.expiresAt)
+		artifact.mu.Unlock()
+		if done {
+			expired = append(expired, artifact)
+			delete(h.artifacts, id)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, artifact := range expired {
+		if err := os.Remove(artifact.path); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to remove expired export %s: %v", artifact.path, err)
+		}
+	}
+	if len(expired) > 0 {
+		logger.Debug("Removed %d expired exports", len(expired))
+	}
+}
+
+// StartExport starts exporting the result of a query to a file
+// @Summary Export query results
+// @Description Run a query in the background and write the matching entities to a JSONL or CSV file. Takes the query parameters of /api/v1/entities/query. Poll status_url, or pass callback_url to be notified, then fetch download_url before the export expires.
+// @Tags entities
+// @Produce json
+// @Param format query string false "jsonl (default) or csv"
+// @Param callback_url query string false "URL receiving a POST with the export status when the job finishes"
+// @Param tag query string false "Tag filter; repeat for AND"
+// @Param dataset query string false "Restrict results to a dataset"
+// @Success 202 {object} ExportStatus
+// @Failure 429 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/export [post]
+func (h *ExportHandler) StartExport(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = ExportFormatJSONL
+	}
+	if format != ExportFormatJSONL && format != ExportFormatCSV {
+		RespondError(w, http.StatusBadRequest, "format must be jsonl or csv")
+		return
+	}
+	callbackURL := params.Get("callback_url")
+	if callbackURL != "" {
+		if u, err := url.Parse(callbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			RespondError(w, http.StatusBadRequest, "callback_url must be an http or https URL")
+			return
+		}
+	}
+
+	// The export parameters are not part of the query
+	query := url.Values{}
+	for key, values := range params {
+		if key != "format" && key != "callback_url" {
+			query[key] = values
+		}
+	}
+	query, err := contentPathQuery(query)
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dataset := query.Get("dataset")
+	if dataset == "" {
+		dataset = extractDatasetFromPath(r.URL.Path)
+	}
+
+	artifact, err := h.start(securityCtx.User, format, query, dataset, callbackURL)
+	if errors.Is(err, errTooManyExports) {
+		w.Header().Set("Retry-After", "30")
+		RespondError(w, http.StatusTooManyRequests,
+			fmt.Sprintf("Too many exports running (limit %d)", h.maxConcurrent))
+		return
+	}
+	if err != nil {
+		RespondError(w, http.StatusServiceUnavailable, "Failed to queue export: "+err.Error())
+		return
+	}
+	RespondJSON(w, http.StatusAccepted, artifact.status())
+}
+
+// errTooManyExports is returned when the concurrent export limit is reached
+var errTooManyExports = errors.New("too many exports running")
+
+// start queues an export of a query's result for user
+func (h *ExportHandler) start(user *models.SecurityUser, format string, query url.Values, dataset, callbackURL string) (*exportArtifact, error) {
+	h.mu.Lock()
+	if h.maxConcurrent > 0 && h.runningLocked() >= h.maxConcurrent {
+		h.mu.Unlock()
+		return nil, errTooManyExports
+	}
+
+	artifact := &exportArtifact{
+		owner:       user.ID,
+		format:      format,
+		query:       query.Encode(),
+		callbackURL: callbackURL,
+	}
+	job, err := h.jobs.Submit(exportJobType, user.ID, func(job *Job) error {
+		return h.run(job.Context(), job, artifact, user, query, dataset)
+	})
+	if err != nil {
+		h.mu.Unlock()
+		return nil, err
+	}
+	artifact.job = job
+	id := job.Status().ID
+	artifact.path = filepath.Join(h.dir, id+"."+format)
+	h.artifacts[id] = artifact
+	h.mu.Unlock()
+
+	go h.finish(artifact)
+
+	logger.Info("Export %s started by user %s (format: %s, query: %s)", id, user.Username, format, artifact.query)
+	return artifact, nil
+}
+
+// ExportAction returns the scheduler action that exports a dataset as the
+// schedule's owner. The run waits for the export, which the owner then
+// downloads from /api/v1/exports like any other.
+func (h *ExportHandler) ExportAction() services.ScheduleAction {
+	return services.ScheduleAction{
+		Resource:   "entity",
+		Permission: "view",
+		Validate: func(schedule services.Schedule) error {
+			if schedule.Dataset == "" {
+				return fmt.Errorf("export schedules need a schedule:dataset tag")
+			}
+			if schedule.Format != "" && schedule.Format != ExportFormatJSONL && schedule.Format != ExportFormatCSV {
+				return fmt.Errorf("export format must be jsonl or csv")
+			}
+			return nil
+		},
+		Run: func(ctx context.Context, schedule services.Schedule, owner *models.SecurityUser) (interface{}, error) {
+			format := schedule.Format
+			if format == "" {
+				format = ExportFormatJSONL
+			}
+			query := url.Values{"tag": {"dataset:" + schedule.Dataset}}
+			artifact, err := h.start(owner, format, query, schedule.Dataset, "")
+			if err != nil {
+				return nil, fmt.Errorf("failed to queue export: %w", err)
+			}
+			select {
+			case <-artifact.job.Done():
+			case <-ctx.Done():
+				h.jobs.Cancel(artifact.job.Status().ID)
+				<-artifact.job.Done()
+			}
+			status := artifact.status()
+			if status.Status != JobStatusCompleted {
+				return status, fmt.Errorf("export %s %s: %s", status.ID, status.Status, status.Message)
+			}
+			return status, nil
+		},
+	}
+}
+
+// runningLocked counts queued and running exports; h.mu must be held
+func (h *ExportHandler) runningLocked() int {
+	running := 0
+	for _, artifact := range h.artifacts {
+		if !artifact.job.Status().finished() {
+			running++
+		}
+	}
+	return running
+}
+
+// run executes the query for user and writes the result. The file is
+// written under a temporary name and renamed once complete.
+func (h *ExportHandler) run(ctx context.Context, job *Job, artifact *exportArtifact, user *models.SecurityUser, query url.Values, dataset string) error {
+	startTime := time.Now()
+	entities, queryType, queryTags, err := h.entities.runQuery(ctx, query, dataset)
+	if queryMetrics != nil {
+		queryMetrics.TrackQuery(queryType, queryTags, startTime, len(entities), err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	entities = withoutSensitiveMatches(user, models.FilterReadableEntities(user, entities), query)
+	entities = models.RedactEntitiesFor(user, entities)
+	total := int64(len(entities))
+	job.SetProgress(0, total)
+
+	// The artifact path is set right after the job is queued
+	h.mu.Lock()
+	path := artifact.path
+	h.mu.Unlock()
+
+	partial := path + ".part"
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(partial)
+
+	buffered := bufio.NewWriter(file)
+	write := writeExportJSONL
+	if artifact.format == ExportFormatCSV {
+		write = writeExportCSV
+	}
+	if err := write(ctx, buffered, entities, func(done int) {
+		job.SetProgress(int64(done), total)
+	}); err != nil {
+		file.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	info, err := os.Stat(partial)
+	if err != nil {
+		return fmt.Errorf("failed to stat export file: %w", err)
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return fmt.Errorf("failed to finalize export file: %w", err)
+	}
+
+	artifact.mu.Lock()
+	artifact.entities = total
+	artifact.size = info.Size()
+	artifact.mu.Unlock()
+	return nil
+}
+
+// finish sets the export's expiry once its job ends and notifies the
+// callback URL
+func (h *ExportHandler) finish(artifact *exportArtifact) {
+	<-artifact.job.Done()
+
+	artifact.mu.Lock()
+	artifact.expiresAt = time.Now().Add(h.ttl)
+	artifact.mu.Unlock()
+
+	status := artifact.status()
+	switch status.Status {
+	case JobStatusFailed:
+		logger.Warn("Export %s failed: %s", status.ID, status.Message)
+	case JobStatusCancelled:
+		logger.Info("Export %s cancelled", status.ID)
+	default:
+		logger.Info("Export %s completed: %d entities, %d bytes", status.ID, status.Entities, status.SizeBytes)
+	}
+
+	if artifact.callbackURL == "" {
+		return
+	}
+	body, err := json.Marshal(status)
+	if err != nil {
+		logger.Error("Failed to encode export %s status: %v", status.ID, err)
+		return
+	}
+	resp, err := h.client.Post(artifact.callbackURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.Warn("Failed to notify %s of export %s: %v", artifact.callbackURL, status.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logger.Warn("Export %s callback %s returned %s", status.ID, artifact.callbackURL, resp.Status)
+	}
+}
+
+// writeExportJSONL writes one JSON encoded entity per line
+func writeExportJSONL(ctx context.Context, w *bufio.Writer, entities []*models.Entity, progress func(int)) error {
+	encoder := json.NewEncoder(w)
+	for i, entity := range entities {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("export cancelled")
+		}
+		if err := encoder.Encode(entity); err != nil {
+			return fmt.Errorf("failed to write entity %s: %w", entity.ID, err)
+		}
+		if (i+1)%1000 == 0 {
+			progress(i + 1)
+		}
+	}
+	progress(len(entities))
+	return nil
+}
+
+// writeExportCSV writes a header and one row per entity. Tags are a JSON
+// array without timestamps; content is text when it is valid UTF-8 and
+// base64 otherwise, as content_encoding records.
+func writeExportCSV(ctx context.Context, w *bufio.Writer, entities []*models.Entity, progress func(int)) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"id", "created_at", "updated_at", "tags", "content_encoding", "content"}); err != nil {
+		return fmt.Errorf("failed to write export header: %w", err)
+	}
+	for i, entity := range entities {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("export cancelled")
+		}
+		tags, err := json.Marshal(entity.GetTagsWithoutTimestamp())
+		if err != nil {
+			return fmt.Errorf("failed to encode tags of %s: %w", entity.ID, err)
+		}
+		encoding, content := "text", string(entity.Content)
+		if !utf8.Valid(entity.Content) {
+			encoding, content = "base64", base64.StdEncoding.EncodeToString(entity.Content)
+		}
+		record := []string{
+			entity.ID,
+			time.Unix(0, entity.CreatedAt).UTC().Format(time.RFC3339Nano),
+			time.Unix(0, entity.UpdatedAt).UTC().Format(time.RFC3339Nano),
+			string(tags),
+			encoding,
+			content,
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write entity %s: %w", entity.ID, err)
+		}
+		if (i+1)%1000 == 0 {
+			progress(i + 1)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	progress(len(entities))
+	return nil
+}
+
+// lookup returns the export with the id in the path if the current user
+// started it
+func (h *ExportHandler) lookup(w http.ResponseWriter, r *http.Request) (*exportArtifact, bool) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return nil, false
+	}
+	h.mu.Lock()
+	artifact, ok := h.artifacts[mux.Vars(r)["id"]]
+	h.mu.Unlock()
+	if !ok || artifact.owner != securityCtx.User.ID {
+		RespondError(w, http.StatusNotFound, "Export not found")
+		return nil, false
+	}
+	return artifact, true
+}
+
+// ListExports lists the current user's exports
+// @Summary List exports
+// @Description List the exports started by the current user, newest first
+// @Tags entities
+// @Produce json
+// @Success 200 {array} ExportStatus
+// @Security BearerAuth
+// @Router /api/v1/exports [get]
+func (h *ExportHandler) ListExports(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	h.mu.Lock()
+	statuses := make([]ExportStatus, 0, len(h.artifacts))
+	for _, artifact := range h.artifacts {
+		if artifact.owner == securityCtx.User.ID {
+			statuses = append(statuses, artifact.status())
+		}
+	}
+	h.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].CreatedAt.After(statuses[j].CreatedAt)
+	})
+	RespondJSON(w, http.StatusOK, statuses)
+}
+
+// GetExport reports the progress of an export
+// @Summary Get export status
+// @Description Report the progress of an export and, once completed, its download URL and expiry
+// @Tags entities
+// @Produce json
+// @Param id path string true "Export ID"
+// @Success 200 {object} ExportStatus
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/exports/{id} [get]
+func (h *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	artifact, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	RespondJSON(w, http.StatusOK, artifact.status())
+}
+
+// DownloadExport serves the file of a completed export
+// @Summary Download export
+// @Description Download the JSONL or CSV file of a completed export
+// @Tags entities
+// @Produce application/x-ndjson,text/csv
+// @Param id path string true "Export ID"
+// @Success 200 {file} file
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/exports/{id}/download [get]
+func (h *ExportHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	artifact, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	status := artifact.status()
+	if status.Status != JobStatusCompleted {
+		RespondError(w, http.StatusConflict, "Export is "+status.Status)
+		return
+	}
+
+	file, err := os.Open(artifact.path)
+	if err != nil {
+		RespondError(w, http.StatusNotFound, "Export file not found")
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Failed to read export file")
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if artifact.format == ExportFormatCSV {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="export-`+status.ID+"."+artifact.format+`"`)
+	w.Header().Set("X-Export-Entities", strconv.FormatInt(status.Entities, 10))
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+// DeleteExport cancels a running export or removes a finished one
+// @Summary Delete export
+// @Description Cancel a running export or delete the file of a finished one before it expires
+// @Tags entities
+// @Param id path string true "Export ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/exports/{id} [delete]
+func (h *ExportHandler) DeleteExport(w http.ResponseWriter, r *http.Request) {
+	artifact, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	h.jobs.Cancel(artifact.job.Status().ID)
+	<-artifact.job.Done()
+
+	h.mu.Lock()
+	delete(h.artifacts, artifact.job.Status().ID)
+	h.mu.Unlock()
+	if err := os.Remove(artifact.path); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to remove export %s: %v", artifact.path, err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxFederatedDatasets bounds the datasets one federated query may span
+const maxFederatedDatasets = 32
+
+// FederatedQueryHandler runs one entity query across several datasets and
+// merges the results, attributing each entity to its dataset. Each dataset
+// is authorized separately, so a user sees the datasets it may view and is
+// told which it may not.
+type FederatedQueryHandler struct {
+	entities *EntityHandler
+	security *SecurityMiddleware
+}
+
+// NewFederatedQueryHandler creates a federated query handler that runs
+// queries through the entity handler and checks dataset permissions with
+// the security middleware
+func NewFederatedQueryHandler(entities *EntityHandler, security *SecurityMiddleware) *FederatedQueryHandler {
+	return &FederatedQueryHandler{entities: entities, security: security}
+}
+
+// FederatedEntity is an entity of a federated query with its dataset
+type FederatedEntity struct {
+	Dataset string         `json:"dataset"`
+	Entity  *models.Entity `json:"entity"`
+}
+
+// FederatedDatasetResult reports how a federated query went in one dataset
+type FederatedDatasetResult struct {
+	Dataset string `json:"dataset"`
+	Count   int    `json:"count"`
+	Error   string `json:"error,omitempty"`
+}
+
+// FederatedQueryResponse is the merged result of a federated query
+type FederatedQueryResponse struct {
+	Entities []FederatedEntity        `json:"entities"`
+	Datasets []FederatedDatasetResult `json:"datasets"`
+	Total    int                      `json:"total"`
+}
+
+// federatedDatasets returns the distinct dataset names of the datasets
+// parameter, which may be repeated or comma separated
+func federatedDatasets(values []string) []string {
+	seen := make(map[string]bool)
+	var datasets []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !seen[name] {
+				seen[name] = true
+				datasets = append(datasets, name)
+			}
+		}
+	}
+	return datasets
+}
+
+// FederatedQuery runs a query in several datasets and merges the results
+// @Summary Query entities across datasets
+// @Description Run the same query as /entities/query in each named dataset and merge the results. Every entity is returned with its dataset. Datasets where the user lacks entity:view are reported as forbidden and contribute no entities.
+// @Tags entities
+// @Produce json
+// @Param datasets query string true "Datasets to query, comma separated or repeated"
+// @Param tag query string false "Filter by tag; repeat for AND logic"
+// @Param wildcard query string false "Filter by wildcard pattern"
+// @Param search query string false "Search content"
+// @Param namespace query string false "Filter by namespace"
+// @Param filter query string false "Filter field (e.g., created_at, content.customer.country)"
+// @Param operator query string false "Filter operator"
+// @Param value query string false "Filter value"
+// @Param content_path query string false "JSONPath into JSON content (e.g., $.customer.country)"
+// @Param content_value query string false "Value at content_path"
+// @Success 200 {object} FederatedQueryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/federated [get]
+func (h *FederatedQueryHandler) FederatedQuery(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	params, err := contentPathQuery(r.URL.Query())
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	datasets := federatedDatasets(params["datasets"])
+	if len(datasets) == 0 {
+		RespondError(w, http.StatusBadRequest, "datasets is required")
+		return
+	}
+	if len(datasets) > maxFederatedDatasets {
+		RespondError(w, http.StatusBadRequest, fmt.Sprintf("A federated query may span at most %d datasets", maxFederatedDatasets))
+		return
+	}
+
+	user := requestUser(r)
+	if user == nil {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	// Authorize every dataset before touching storage
+	results := make([]FederatedDatasetResult, len(datasets))
+	permitted := 0
+	for i, dataset := range datasets {
+		results[i].Dataset = dataset
+		allowed, err := h.security.authorizeInDataset(r, user, "entity", "view", dataset)
+		if err != nil {
+			RespondError(w, http.StatusInternalServerError, "Failed to check permissions")
+			return
+		}
+		if !allowed {
+			results[i].Error = "forbidden"
+			continue
+		}
+		permitted++
+	}
+	if permitted == 0 {
+		RespondError(w, http.StatusForbidden, "Insufficient permissions: entity:view required in the requested datasets")
+		return
+	}
+
+	if !h.entities.admitQuery(w, r, querySpecFromParams(params)) {
+		return
+	}
+
+	// One query timeout covers the reads of every dataset
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	response := FederatedQueryResponse{
+		Entities: []FederatedEntity{},
+		Datasets: results,
+	}
+	var queryTags []string
+	failed := func(dataset string, tags []string, err error) {
+		if queryMetrics != nil {
+			queryMetrics.TrackQuery("federated", tags, startTime, 0, err)
+		}
+		if respondQueryStopped(w, err) {
+			logger.Warn("federated query stopped in dataset %s: %v", dataset, err)
+			return
+		}
+		logger.Error("failed to execute federated query in dataset %s: tags=%v, error: %v", dataset, tags, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to execute query")
+	}
+
+	// Queries runQuery cannot scope to a dataset run once for all of them
+	var shared []*models.Entity
+	if !datasetScopedQuery(params) {
+		shared, _, queryTags, err = h.entities.runQuery(ctx, params, "")
+		if err != nil {
+			failed(strings.Join(datasets, ","), queryTags, err)
+			return
+		}
+	}
+
+	for i, dataset := range datasets {
+		if results[i].Error != "" {
+			continue
+		}
+		entities := shared
+		if datasetScopedQuery(params) {
+			var tags []string
+			entities, _, tags, err = h.entities.runQuery(ctx, params, dataset)
+			if err != nil {
+				failed(dataset, tags, err)
+				return
+			}
+			queryTags = tags
+		}
+
+		// Entities the index still lists under a dataset they have left are
+		// dropped along with the other datasets of a shared query
+		inDataset := entitiesInDataset(entities, dataset)
+		inDataset = withoutSensitiveMatches(user, readableEntities(r, inDataset), params)
+		recordEntityAccess(r, inDataset, queryTags)
+
+		for _, entity := range redactedEntities(r, inDataset) {
+			response.Entities = append(response.Entities, FederatedEntity{Dataset: dataset, Entity: entity})
+		}
+		results[i].Count = len(inDataset)
+	}
+	response.Total = len(response.Entities)
+
+	if queryMetrics != nil {
+		queryMetrics.TrackQuery("federated", queryTags, startTime, response.Total, nil)
+	}
+	RespondJSON(w, http.StatusOK, response)
+}
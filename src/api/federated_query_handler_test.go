@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"testing"
+
+	"entitydb/models"
+	"entitydb/storage/binary"
+)
+
+// TestFederatedQuery checks that a federated query returns the matches of
+// the requested datasets only, reads only their entities when the query can
+// be scoped, and runs an unscopable query once
+func TestFederatedQuery(t *testing.T) {
+	security := newTestSecurity(t)
+	handler := NewFederatedQueryHandler(NewEntityHandler(security.repo), security.middleware)
+	federated := security.middleware.RequireAuthentication(handler.FederatedQuery)
+	_, token := security.login(t, "alice")
+
+	for id, dataset := range map[string]string{
+		"doc-a1": "a", "doc-a2": "a", "doc-b1": "b",
+		"doc-c1": "c", "doc-c2": "c", "doc-c3": "c", "doc-c4": "c",
+	} {
+		entity := &models.Entity{ID: id, Tags: []string{"type:document", "dataset:" + dataset}, Content: []byte("needle " + id)}
+		if err := security.repo.Create(entity); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	query := func(target string) (FederatedQueryResponse, binary.RequestStatsSnapshot) {
+		t.Helper()
+		stats := &binary.RequestStats{}
+		req := authorizedRequest("GET", target, token, nil)
+		req = req.WithContext(binary.WithRequestStats(req.Context(), stats))
+		recorder := httptest.NewRecorder()
+		federated(recorder, req)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s = %d: %s", target, recorder.Code, recorder.Body)
+		}
+		var response FederatedQueryResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode %s: %v", target, err)
+		}
+		return response, stats.Snapshot()
+	}
+	matches := func(response FederatedQueryResponse) []string {
+		var ids []string
+		for _, match := range response.Entities {
+			if match.Entity.GetDataset() != match.Dataset {
+				t.Errorf("entity %s of dataset %s attributed to %s", match.Entity.ID, match.Entity.GetDataset(), match.Dataset)
+			}
+			ids = append(ids, match.Entity.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	want := []string{"doc-a1", "doc-a2", "doc-b1"}
+
+	for _, target := range []string{
+		"/api/v1/entities/federated?datasets=a,b",
+		"/api/v1/entities/federated?datasets=a,b&tag=type:document",
+		"/api/v1/entities/federated?datasets=a&datasets=b&search=needle",
+	} {
+		response, _ := query(target)
+		if got := matches(response); !slices.Equal(got, want) || response.Total != len(want) {
+			t.Errorf("%s = %v (total %d), want %v", target, got, response.Total, want)
+		}
+	}
+
+	// A listing reads the entities of the requested datasets only
+	if _, stats := query("/api/v1/entities/federated?datasets=a,b"); stats.EntitiesFetched != 3 {
+		t.Errorf("listing two datasets fetched %d entities, want 3", stats.EntitiesFetched)
+	}
+	// A search cannot be scoped and runs once for both datasets
+	if _, stats := query("/api/v1/entities/federated?datasets=a,b&search=needle"); stats.IndexLookups != 1 {
+		t.Errorf("searching two datasets took %d lookups, want 1", stats.IndexLookups)
+	}
+}
+
+// TestQueryEntitiesDataset checks that the dataset parameter of a tag query
+// restricts its results to the dataset
+func TestQueryEntitiesDataset(t *testing.T) {
+	security := newTestSecurity(t)
+	query := security.middleware.RequirePermission("entity", "view")(NewEntityHandler(security.repo).QueryEntities)
+	_, token := security.login(t, "alice")
+
+	for _, entity := range []*models.Entity{
+		{ID: "doc-a", Tags: []string{"type:document", "dataset:a"}},
+		{ID: "doc-b", Tags: []string{"type:document", "dataset:b"}},
+	} {
+		if err := security.repo.Create(entity); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	query(recorder, authorizedRequest("GET", "/api/v1/entities/query?tag=type:document&dataset=b", token, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("query = %d: %s", recorder.Code, recorder.Body)
+	}
+	var response QueryEntityResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode query: %v", err)
+	}
+	if len(response.Entities) != 1 || response.Entities[0].ID != "doc-b" {
+		t.Errorf("query of dataset b returned %d entities: %+v", len(response.Entities), response.Entities)
+	}
+}
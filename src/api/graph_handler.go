@@ -0,0 +1,420 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/models"
+	"net/http"
+)
+
+// Graph query limits
+const (
+	graphDefaultPathDepth = 6
+	graphMaxPathDepth     = 10
+	graphMaxDepth         = 5
+	graphDefaultLimit     = 100
+	graphMaxLimit         = 1000
+	graphMaxVisited       = 100000 // entities a traversal may visit
+)
+
+// GraphHandler answers graph queries over the typed relationships declared
+// by rel:<type>:<target-id> tags. Traversals read the adjacency index only;
+// entities are fetched for the nodes returned, and for ACL checks when the
+// caller is not an administrator.
+type GraphHandler struct {
+	repo  models.EntityRepository
+	edges edgeIndex // nil when the repository keeps no adjacency index
+}
+
+// NewGraphHandler creates a new graph query handler
+func NewGraphHandler(repo models.EntityRepository) *GraphHandler {
+	h := &GraphHandler{repo: repo}
+	if binaryRepo, err := asTemporalRepository(repo); err == nil {
+		h.edges = binaryRepo
+	}
+	return h
+}
+
+// GraphQueryRequest is a graph query. Operation selects which of the other
+// fields apply:
+//
+//	shortest_path: from, to, depth (max hops, default 6, up to 10)
+//	neighborhood:  entity_id, depth (hops, default 1, up to 5), tags, limit
+//	degree:        entity_ids
+//
+// Direction ("out", "in" or "both", the default) and type restrict the
+// relationships followed or counted.
+type GraphQueryRequest struct {
+	Operation string   `json:"operation"`
+	From      string   `json:"from,omitempty"`
+	To        string   `json:"to,omitempty"`
+	EntityID  string   `json:"entity_id,omitempty"`
+	EntityIDs []string `json:"entity_ids,omitempty"`
+	Depth     int      `json:"depth,omitempty"`
+	Direction string   `json:"direction,omitempty"`
+	Type      string   `json:"type,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Limit     int      `json:"limit,omitempty"`
+}
+
+// GraphNode is an entity reached by a graph query with its fan-in and
+// fan-out over the relationships the query follows
+type GraphNode struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Distance int    `json:"distance"`
+	FanIn    int    `json:"fan_in"`
+	FanOut   int    `json:"fan_out"`
+}
+
+// GraphDegree is the number of relationships into and out of an entity,
+// in total and per relationship type
+type GraphDegree struct {
+	EntityID string                 `json:"entity_id"`
+	FanIn    int                    `json:"fan_in"`
+	FanOut   int                    `json:"fan_out"`
+	ByType   map[string]GraphFanOut `json:"by_type"`
+}
+
+// GraphFanOut counts the relationships of one type
+type GraphFanOut struct {
+	In  int `json:"in"`
+	Out int `json:"out"`
+}
+
+// GraphQueryResult is the answer to a graph query. Found, Path and Hops are
+// set by shortest_path; Nodes, Edges and Truncated by neighborhood; Degrees
+// by degree.
+type GraphQueryResult struct {
+	Operation string        `json:"operation"`
+	Found     *bool         `json:"found,omitempty"`
+	Hops      int           `json:"hops,omitempty"`
+	Path      []string      `json:"path,omitempty"`
+	Nodes     []GraphNode   `json:"nodes,omitempty"`
+	Edges     []models.Edge `json:"edges,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+	Degrees   []GraphDegree `json:"degrees,omitempty"`
+}
+
+// graphQuery holds the state of one query: the caller's view of the
+// repository and which entities it may see
+type graphQuery struct {
+	h         *GraphHandler
+	repo      models.EntityRepository
+	admin     bool
+	direction models.EdgeDirection
+	relType   string
+	visible   map[string]bool
+}
+
+// Query runs a graph query
+// @Summary Graph query
+// @Description Shortest path between two entities, k-hop neighbourhood with tag filters, or fan-in/fan-out counts over rel:<type>:<id> relationships
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param request body GraphQueryRequest true "Graph query"
+// @Success 200 {object} GraphQueryResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 501 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/graph/query [post]
+func (h *GraphHandler) Query(w http.ResponseWriter, r *http.Request) {
+	if h.edges == nil {
+		RespondError(w, http.StatusNotImplemented, "Repository does not index relationships")
+		return
+	}
+
+	var req GraphQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	direction, ok := models.ParseEdgeDirection(req.Direction)
+	if !ok {
+		RespondError(w, http.StatusBadRequest, "direction must be out, in or both")
+		return
+	}
+
+	user := requestUser(r)
+	q := &graphQuery{
+		h:         h,
+		repo:      aclRepository{EntityRepository: h.repo, user: user},
+		admin:     user != nil && user.Entity != nil && user.Entity.HasTag("rbac:role:admin"),
+		direction: direction,
+		relType:   req.Type,
+		visible:   make(map[string]bool),
+	}
+
+	switch req.Operation {
+	case "shortest_path":
+		if req.From == "" || req.To == "" {
+			RespondError(w, http.StatusBadRequest, "from and to are required")
+			return
+		}
+		if !q.exists(req.From) || !q.exists(req.To) {
+			RespondError(w, http.StatusNotFound, "Entity not found")
+			return
+		}
+		RespondJSON(w, http.StatusOK, q.shortestPath(req.From, req.To, clampGraph(req.Depth, graphDefaultPathDepth, graphMaxPathDepth)))
+	case "neighborhood":
+		if req.EntityID == "" {
+			RespondError(w, http.StatusBadRequest, "entity_id is required")
+			return
+		}
+		if !q.exists(req.EntityID) {
+			RespondError(w, http.StatusNotFound, "Entity not found")
+			return
+		}
+		RespondJSON(w, http.StatusOK, q.neighborhood(req.EntityID, clampGraph(req.Depth, 1, graphMaxDepth), req.Tags, clampGraph(req.Limit, graphDefaultLimit, graphMaxLimit)))
+	case "degree":
+		if len(req.EntityIDs) == 0 {
+			RespondError(w, http.StatusBadRequest, "entity_ids is required")
+			return
+		}
+		if len(req.EntityIDs) > graphMaxLimit {
+			RespondError(w, http.StatusBadRequest, "Too many entity_ids")
+			return
+		}
+		RespondJSON(w, http.StatusOK, q.degrees(req.EntityIDs))
+	default:
+		RespondError(w, http.StatusBadRequest, "operation must be shortest_path, neighborhood or degree")
+	}
+}
+
+// clampGraph applies a default to unset values and caps the rest
+func clampGraph(value, def, max int) int {
+	if value <= 0 {
+		return def
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// fetch returns an entity the caller may read. Missing entities come back
+// from the repository as recovery placeholders and are reported as absent.
+func (q *graphQuery) fetch(id string) (*models.Entity, bool) {
+	entity, err := q.repo.GetByID(id)
+	if err != nil || entity == nil || entity.IsRecoveryPlaceholder() {
+		return nil, false
+	}
+	return entity, true
+}
+
+// exists reports whether an entity exists and the caller may read it
+func (q *graphQuery) exists(id string) bool {
+	_, ok := q.fetch(id)
+	if ok {
+		q.visible[id] = true
+	}
+	return ok
+}
+
+// canSee reports whether the caller may traverse through an entity.
+// Administrators are never restricted by ACLs, so no entity is fetched;
+// edges to entities that do not exist lead nowhere in the index anyway.
+func (q *graphQuery) canSee(id string) bool {
+	if q.admin {
+		return true
+	}
+	visible, checked := q.visible[id]
+	if !checked {
+		_, visible = q.fetch(id)
+		q.visible[id] = visible
+	}
+	return visible
+}
+
+// neighbours returns the edges of an entity the query follows, leaving out
+// those leading to entities the caller may not see
+func (q *graphQuery) neighbours(id string) []models.Edge {
+	edges := q.h.edges.Edges(id, q.direction, q.relType)
+	visible := edges[:0]
+	for _, edge := range edges {
+		if q.canSee(otherEnd(edge, id)) {
+			visible = append(visible, edge)
+		}
+	}
+	return visible
+}
+
+// otherEnd returns the end of an edge that is not id
+func otherEnd(edge models.Edge, id string) string {
+	if edge.Source == id {
+		return edge.Target
+	}
+	return edge.Source
+}
+
+// shortestPath searches breadth first from one entity for another, up to
+// maxDepth hops
+func (q *graphQuery) shortestPath(from, to string, maxDepth int) *GraphQueryResult {
+	found := false
+	result := &GraphQueryResult{Operation: "shortest_path", Found: &found}
+	if from == to {
+		found = true
+		result.Path = []string{from}
+		return result
+	}
+
+	// via records the edge each entity was first reached over
+	via := map[string]models.Edge{from: {}}
+	frontier := []string{from}
+	for hop := 0; hop < maxDepth && len(frontier) > 0 && len(via) < graphMaxVisited; hop++ {
+		var next []string
+		for _, id := range frontier {
+			for _, edge := range q.neighbours(id) {
+				peer := otherEnd(edge, id)
+				if _, seen := via[peer]; seen {
+					continue
+				}
+				via[peer] = edge
+				if peer == to {
+					found = true
+					result.Path, result.Edges = tracePath(via, from, to)
+					result.Hops = len(result.Edges)
+					return result
+				}
+				next = append(next, peer)
+			}
+		}
+		frontier = next
+	}
+	return result
+}
+
+// tracePath walks the recorded edges back from to, returning the entities
+// and edges of the path in order
+func tracePath(via map[string]models.Edge, from, to string) ([]string, []models.Edge) {
+	path := []string{to}
+	var edges []models.Edge
+	for id := to; id != from; {
+		edge := via[id]
+		edges = append(edges, edge)
+		id = otherEnd(edge, id)
+		path = append(path, id)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	for i, j := 0, len(edges)-1; i < j; i, j = i+1, j-1 {
+		edges[i], edges[j] = edges[j], edges[i]
+	}
+	return path, edges
+}
+
+// neighborhood collects the entities up to depth hops away. Every entity
+// reached is traversed, but only those carrying all of tags are returned,
+// along with the edges between returned entities. At most limit entities
+// are returned; Truncated reports that more were reached.
+func (q *graphQuery) neighborhood(start string, depth int, tags []string, limit int) *GraphQueryResult {
+	result := &GraphQueryResult{Operation: "neighborhood", Nodes: []GraphNode{}, Edges: []models.Edge{}}
+	distance := map[string]int{start: 0}
+	order := []string{start}
+	adjacency := make(map[string][]models.Edge)
+
+	for i := 0; i < len(order); i++ {
+		id := order[i]
+		edges := q.neighbours(id)
+		adjacency[id] = edges
+		if distance[id] == depth {
+			continue
+		}
+		if len(order) >= graphMaxVisited {
+			result.Truncated = true
+			continue
+		}
+		for _, edge := range edges {
+			peer := otherEnd(edge, id)
+			if _, seen := distance[peer]; !seen {
+				distance[peer] = distance[id] + 1
+				order = append(order, peer)
+			}
+		}
+	}
+
+	returned := make(map[string]bool)
+	for _, id := range order {
+		if len(result.Nodes) == limit {
+			result.Truncated = true
+			break
+		}
+		entity, ok := q.fetch(id)
+		if !ok || !hasAllTags(entity, tags) {
+			continue
+		}
+		returned[id] = true
+		fanIn, fanOut := countFan(adjacency[id], id)
+		result.Nodes = append(result.Nodes, GraphNode{
+			ID:       id,
+			Name:     entity.GetTagValue("name"),
+			Type:     entity.GetTagValue("type"),
+			Distance: distance[id],
+			FanIn:    fanIn,
+			FanOut:   fanOut,
+		})
+	}
+
+	seen := make(map[models.Edge]bool)
+	for _, node := range result.Nodes {
+		for _, edge := range adjacency[node.ID] {
+			if returned[edge.Source] && returned[edge.Target] && !seen[edge] {
+				seen[edge] = true
+				result.Edges = append(result.Edges, edge)
+			}
+		}
+	}
+	return result
+}
+
+// hasAllTags reports whether an entity carries every tag
+func hasAllTags(entity *models.Entity, tags []string) bool {
+	for _, tag := range tags {
+		if !entity.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// countFan counts the edges into and out of id
+func countFan(edges []models.Edge, id string) (fanIn, fanOut int) {
+	for _, edge := range edges {
+		if edge.Source == id {
+			fanOut++
+		}
+		if edge.Target == id {
+			fanIn++
+		}
+	}
+	return fanIn, fanOut
+}
+
+// degrees counts the relationships of each entity, skipping entities that
+// do not exist or the caller may not see. Results follow the request order.
+func (q *graphQuery) degrees(ids []string) *GraphQueryResult {
+	result := &GraphQueryResult{Operation: "degree", Degrees: []GraphDegree{}}
+	for _, id := range ids {
+		if !q.exists(id) {
+			continue
+		}
+		degree := GraphDegree{EntityID: id, ByType: make(map[string]GraphFanOut)}
+		for _, edge := range q.neighbours(id) {
+			counts := degree.ByType[edge.Type]
+			if edge.Source == id {
+				degree.FanOut++
+				counts.Out++
+			}
+			if edge.Target == id {
+				degree.FanIn++
+				counts.In++
+			}
+			degree.ByType[edge.Type] = counts
+		}
+		result.Degrees = append(result.Degrees, degree)
+	}
+	return result
+}
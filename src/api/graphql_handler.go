@@ -0,0 +1,896 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+)
+
+// GraphQL limits
+const (
+	graphqlMaxBodySize     = 1 << 20
+	graphqlMaxDepth        = 12    // nested field levels of a query
+	graphqlMaxEntities     = 10000 // entities a query may resolve
+	graphqlDefaultLimit    = 100
+	graphqlMaxLimit        = 1000
+	graphqlDefaultHistory  = 100
+	graphqlMaxHistoryLimit = 1000
+)
+
+// graphqlFieldDef describes a field of the schema: the object type it
+// returns ("" for scalars) and the types of its arguments
+type graphqlFieldDef struct {
+	typ  string
+	args map[string]string
+}
+
+// graphqlSchema is the schema served by /graphql, read only:
+//
+//	type Query {
+//	  entity(id: ID!): Entity
+//	  entities(tags: [String!], matchAll: Boolean = true, type: String, dataset: String,
+//	           limit: Int = 100, offset: Int = 0): [Entity!]!
+//	  entityAsOf(id: ID!, asOf: String!): Entity
+//	}
+//	type Entity {
+//	  id: ID!  type: String  dataset: String  createdAt: String  updatedAt: String
+//	  content: String  contentBase64: String  contentJSON(path: String): JSON
+//	  tags(namespace: String, withTimestamps: Boolean = false): [String!]!
+//	  tag(namespace: String!): String
+//	  history(from: String, to: String, limit: Int = 100): [Change!]!
+//	  relationships(type: String, direction: Direction = BOTH): [Relationship!]!
+//	  related(type: String, direction: Direction = BOTH, tags: [String!], limit: Int = 100): [Entity!]!
+//	}
+//	type Relationship { type: String!  source: ID!  target: ID!  direction: Direction!  entity: Entity }
+//	type Change { type: String!  timestamp: String!  oldValue: String  newValue: String }
+//	enum Direction { OUT IN BOTH }
+var graphqlSchema = map[string]map[string]graphqlFieldDef{
+	"Query": {
+		"entity":     {typ: "Entity", args: map[string]string{"id": "ID!"}},
+		"entities":   {typ: "Entity", args: map[string]string{"tags": "[String!]", "matchAll": "Boolean", "type": "String", "dataset": "String", "limit": "Int", "offset": "Int"}},
+		"entityAsOf": {typ: "Entity", args: map[string]string{"id": "ID!", "asOf": "String!"}},
+	},
+	"Entity": {
+		"id":            {},
+		"type":          {},
+		"dataset":       {},
+		"createdAt":     {},
+		"updatedAt":     {},
+		"content":       {},
+		"contentBase64": {},
+		"contentJSON":   {args: map[string]string{"path": "String"}},
+		"tags":          {args: map[string]string{"namespace": "String", "withTimestamps": "Boolean"}},
+		"tag":           {args: map[string]string{"namespace": "String!"}},
+		"history":       {typ: "Change", args: map[string]string{"from": "String", "to": "String", "limit": "Int"}},
+		"relationships": {typ: "Relationship", args: map[string]string{"type": "String", "direction": "Direction"}},
+		"related":       {typ: "Entity", args: map[string]string{"type": "String", "direction": "Direction", "tags": "[String!]", "limit": "Int"}},
+	},
+	"Relationship": {
+		"type":      {},
+		"source":    {},
+		"target":    {},
+		"direction": {},
+		"entity":    {typ: "Entity"},
+	},
+	"Change": {
+		"type":      {},
+		"timestamp": {},
+		"oldValue":  {},
+		"newValue":  {},
+	},
+}
+
+// GraphQLHandler serves read-only GraphQL queries over entities, their
+// tags, temporal history and relationships. Clients select the fields
+// they need and traverse relationships in one request; relationships are
+// resolved from the adjacency index and entity lists from the tag index.
+// Entity ACLs and redaction apply to every entity returned.
+type GraphQLHandler struct {
+	repo       models.EntityRepository
+	binaryRepo *binary.EntityRepository // nil without history and relationship indexes
+}
+
+// NewGraphQLHandler creates a new GraphQL handler
+func NewGraphQLHandler(repo models.EntityRepository) *GraphQLHandler {
+	h := &GraphQLHandler{repo: repo}
+	if binaryRepo, err := asTemporalRepository(repo); err == nil {
+		h.binaryRepo = binaryRepo
+	}
+	return h
+}
+
+// GraphQLRequest is a GraphQL request
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLError is an error of a GraphQL response. Path locates the field
+// that failed in the response data.
+type GraphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// GraphQLResponse is the response to a GraphQL request. Data is absent
+// when the request was rejected before execution.
+type GraphQLResponse struct {
+	Data   interface{}    `json:"data,omitempty"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// Query executes a GraphQL query
+// @Summary GraphQL query
+// @Description Read entities, tags, temporal history and relationships with GraphQL, selecting only the fields needed and traversing relationships in one request. Queries are accepted as JSON ({"query", "operationName", "variables"}), as an application/graphql body, or as GET parameters. Mutations are not supported.
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param request body GraphQLRequest true "GraphQL request"
+// @Success 200 {object} GraphQLResponse
+// @Failure 400 {object} GraphQLResponse
+// @Failure 503 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/graphql [post]
+func (h *GraphQLHandler) Query(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	req, err := decodeGraphQLRequest(w, r)
+	if err != nil {
+		respondGraphQLError(w, err)
+		return
+	}
+	doc, err := models.ParseGraphQL(req.Query)
+	if err != nil {
+		respondGraphQLError(w, err)
+		return
+	}
+	op, err := doc.Operation(req.OperationName)
+	if err != nil {
+		respondGraphQLError(w, err)
+		return
+	}
+	if op.Type != "query" {
+		respondGraphQLError(w, fmt.Errorf("%s operations are not supported; change entities through the REST API", op.Type))
+		return
+	}
+	variables, err := op.VariableValues(req.Variables)
+	if err != nil {
+		respondGraphQLError(w, err)
+		return
+	}
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	user := requestUser(r)
+	exec := &graphqlExecution{
+		h:         h,
+		ctx:       ctx,
+		doc:       doc,
+		variables: variables,
+		user:      user,
+		repo:      aclRepository{EntityRepository: h.repo, user: user},
+		entities:  make(map[string]*models.Entity),
+	}
+	if err := exec.validate("Query", op.SelectionSet, 1); err != nil {
+		respondGraphQLError(w, err)
+		return
+	}
+
+	data := exec.selectionSet("Query", nil, op.SelectionSet, nil)
+	if queryMetrics != nil {
+		queryMetrics.TrackQuery("graphql", nil, startTime, exec.resolved, exec.stopped)
+	}
+	if respondQueryStopped(w, exec.stopped) {
+		return
+	}
+	resolved := make([]*models.Entity, 0, len(exec.entities))
+	for _, entity := range exec.entities {
+		if entity != nil {
+			resolved = append(resolved, entity)
+		}
+	}
+	recordEntityAccess(r, resolved, nil)
+
+	RespondJSON(w, http.StatusOK, GraphQLResponse{Data: data, Errors: exec.errors})
+}
+
+// decodeGraphQLRequest reads a request from the query string of a GET, or
+// from a JSON or application/graphql body
+func decodeGraphQLRequest(w http.ResponseWriter, r *http.Request) (*GraphQLRequest, error) {
+	req := &GraphQLRequest{}
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return nil, fmt.Errorf("variables must be a JSON object")
+			}
+		}
+	} else {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, graphqlMaxBodySize))
+		if err != nil {
+			return nil, fmt.Errorf("request body is unreadable or larger than %d bytes", graphqlMaxBodySize)
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			req.Query = string(body)
+		} else if err := json.Unmarshal(body, req); err != nil {
+			return nil, fmt.Errorf("request body must be a JSON object with a query")
+		}
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	return req, nil
+}
+
+// respondGraphQLError rejects a request that cannot be executed
+func respondGraphQLError(w http.ResponseWriter, err error) {
+	RespondJSON(w, http.StatusBadRequest, GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}})
+}
+
+// graphqlObject is a response object, which keeps its fields in the order
+// of the selection set
+type graphqlObject []graphqlEntry
+
+type graphqlEntry struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON encodes the fields in order
+func (o graphqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, entry := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(entry.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// graphqlRelationship is a relationship as seen from one of its entities
+type graphqlRelationship struct {
+	edge  models.Edge
+	other string
+	out   bool
+}
+
+// graphqlExecution holds the state of one query: the caller's view of the
+// repository, the entities fetched so far and the field errors
+type graphqlExecution struct {
+	h         *GraphQLHandler
+	ctx       context.Context
+	doc       *models.GraphQLDocument
+	variables map[string]interface{}
+	user      *models.SecurityUser
+	repo      models.EntityRepository
+	entities  map[string]*models.Entity // redacted; nil for hidden or missing entities
+	resolved  int
+	errors    []GraphQLError
+	stopped   error
+}
+
+// validate checks a selection set against the schema before anything is
+// read, so a malformed query fails as a whole
+func (x *graphqlExecution) validate(typeName string, set []*models.GraphQLSelection, depth int) error {
+	if depth > graphqlMaxDepth {
+		return fmt.Errorf("query is nested more than %d levels deep", graphqlMaxDepth)
+	}
+	fields, err := x.doc.CollectFields(typeName, set, x.variables)
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if field.Name == "__typename" {
+			if len(field.Arguments) > 0 || len(field.SelectionSet) > 0 {
+				return fmt.Errorf("__typename takes no arguments or selections")
+			}
+			continue
+		}
+		def, ok := graphqlSchema[typeName][field.Name]
+		if !ok {
+			return fmt.Errorf("cannot query field %q on type %s (line %d, column %d)", field.Name, typeName, field.Line, field.Column)
+		}
+		if _, err := x.arguments(field, def); err != nil {
+			return err
+		}
+		switch {
+		case def.typ == "" && len(field.SelectionSet) > 0:
+			return fmt.Errorf("field %q of type %s has no subfields to select", field.Name, typeName)
+		case def.typ != "" && len(field.SelectionSet) == 0:
+			return fmt.Errorf("field %q of type %s must select subfields of %s", field.Name, typeName, def.typ)
+		case def.typ != "":
+			if err := x.validate(def.typ, field.SelectionSet, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// arguments coerces the arguments of a field to the types of its
+// definition: string, int64, bool, []string or models.EdgeDirection
+func (x *graphqlExecution) arguments(field *models.GraphQLSelection, def graphqlFieldDef) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(field.Arguments))
+	for _, arg := range field.Arguments {
+		if _, ok := def.args[arg.Name]; !ok {
+			return nil, fmt.Errorf("unknown argument %q on field %q", arg.Name, field.Name)
+		}
+	}
+	for name, typ := range def.args {
+		value, err := field.Argument(name).Resolve(x.variables)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			if strings.HasSuffix(typ, "!") {
+				return nil, fmt.Errorf("argument %q of field %q is required", name, field.Name)
+			}
+			continue
+		}
+		coerced, ok := coerceGraphQLArgument(strings.TrimSuffix(typ, "!"), value)
+		if !ok {
+			return nil, fmt.Errorf("argument %q of field %q must be of type %s", name, field.Name, typ)
+		}
+		args[name] = coerced
+	}
+	return args, nil
+}
+
+// coerceGraphQLArgument converts a resolved argument value to its type.
+// Numbers from JSON variables arrive as float64 and a single string is
+// accepted for a list, as the specification allows.
+func coerceGraphQLArgument(typ string, value interface{}) (interface{}, bool) {
+	switch typ {
+	case "ID", "String":
+		s, ok := value.(string)
+		return s, ok
+	case "Int":
+		switch n := value.(type) {
+		case int64:
+			return n, n >= math.MinInt32 && n <= math.MaxInt32
+		case float64:
+			return int64(n), n == math.Trunc(n) && n >= math.MinInt32 && n <= math.MaxInt32
+		}
+	case "Boolean":
+		b, ok := value.(bool)
+		return b, ok
+	case "Direction":
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		return models.ParseEdgeDirection(strings.ToLower(s))
+	case "[String!]":
+		if s, ok := value.(string); ok {
+			return []string{s}, true
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		strs := make([]string, len(list))
+		for i, item := range list {
+			if strs[i], ok = item.(string); !ok {
+				return nil, false
+			}
+		}
+		return strs, true
+	}
+	return nil, false
+}
+
+// fieldError records an error of a field, whose value becomes null
+func (x *graphqlExecution) fieldError(path []interface{}, err error) {
+	x.errors = append(x.errors, GraphQLError{Message: err.Error(), Path: append([]interface{}{}, path...)})
+}
+
+// selectionSet resolves the fields selected on an object
+func (x *graphqlExecution) selectionSet(typeName string, source interface{}, set []*models.GraphQLSelection, path []interface{}) interface{} {
+	// Validation has checked the selections already
+	fields, _ := x.doc.CollectFields(typeName, set, x.variables)
+	object := make(graphqlObject, 0, len(fields))
+	for _, field := range fields {
+		key := field.ResponseKey()
+		if x.stopped == nil {
+			if err := x.ctx.Err(); err != nil {
+				x.stopped = err
+			}
+		}
+		if x.stopped != nil {
+			return nil
+		}
+		if field.Name == "__typename" {
+			object = append(object, graphqlEntry{key, typeName})
+			continue
+		}
+
+		fieldPath := append(path[:len(path):len(path)], key)
+		def := graphqlSchema[typeName][field.Name]
+		args, _ := x.arguments(field, def)
+		value, err := x.resolve(typeName, source, field.Name, args)
+		if err != nil {
+			x.fieldError(fieldPath, err)
+			object = append(object, graphqlEntry{key, nil})
+			continue
+		}
+		if def.typ != "" {
+			value = x.complete(def.typ, value, field.SelectionSet, fieldPath)
+		}
+		object = append(object, graphqlEntry{key, value})
+	}
+	return object
+}
+
+// complete resolves the selection set of an object or list of objects
+func (x *graphqlExecution) complete(typeName string, value interface{}, set []*models.GraphQLSelection, path []interface{}) interface{} {
+	switch v := value.(type) {
+	case []*models.Entity:
+		list := make([]interface{}, len(v))
+		for i, entity := range v {
+			list[i] = x.selectionSet(typeName, entity, set, append(path[:len(path):len(path)], i))
+		}
+		return list
+	case []graphqlRelationship:
+		list := make([]interface{}, len(v))
+		for i, relationship := range v {
+			list[i] = x.selectionSet(typeName, relationship, set, append(path[:len(path):len(path)], i))
+		}
+		return list
+	case []*models.EntityChange:
+		list := make([]interface{}, len(v))
+		for i, change := range v {
+			list[i] = x.selectionSet(typeName, change, set, append(path[:len(path):len(path)], i))
+		}
+		return list
+	case *models.Entity:
+		if v == nil {
+			return nil
+		}
+		return x.selectionSet(typeName, v, set, path)
+	default:
+		return nil
+	}
+}
+
+// resolve returns the value of a field of an object: a scalar, or the
+// entities, relationships or changes to complete
+func (x *graphqlExecution) resolve(typeName string, source interface{}, field string, args map[string]interface{}) (interface{}, error) {
+	switch typeName {
+	case "Query":
+		return x.resolveQuery(field, args)
+	case "Entity":
+		return x.resolveEntity(source.(*models.Entity), field, args)
+	case "Relationship":
+		relationship := source.(graphqlRelationship)
+		switch field {
+		case "type":
+			return relationship.edge.Type, nil
+		case "source":
+			return relationship.edge.Source, nil
+		case "target":
+			return relationship.edge.Target, nil
+		case "direction":
+			if relationship.out {
+				return "OUT", nil
+			}
+			return "IN", nil
+		default:
+			return x.entity(relationship.other)
+		}
+	default:
+		change := source.(*models.EntityChange)
+		switch field {
+		case "type":
+			return change.Type, nil
+		case "timestamp":
+			return graphqlTime(change.Timestamp), nil
+		case "oldValue":
+			return graphqlOptional(change.OldValue), nil
+		default:
+			return graphqlOptional(change.NewValue), nil
+		}
+	}
+}
+
+// resolveQuery resolves the root fields
+func (x *graphqlExecution) resolveQuery(field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "entity":
+		return x.entity(args["id"].(string))
+	case "entityAsOf":
+		return x.entityAsOf(args["id"].(string), args["asOf"].(string))
+	default:
+		return x.listEntities(args)
+	}
+}
+
+// fetch returns an entity the caller may read, redacted, or nil. Missing
+// entities come back from the repository as recovery placeholders.
+func (x *graphqlExecution) fetch(id string) *models.Entity {
+	entity, seen := x.entities[id]
+	if !seen {
+		fetched, err := x.repo.GetByID(id)
+		if err == nil && fetched != nil && !fetched.IsRecoveryPlaceholder() {
+			entity = models.RedactEntityFor(x.user, fetched)
+		}
+		x.entities[id] = entity
+	}
+	return entity
+}
+
+// entity returns an entity for the response, counting it against the cap
+func (x *graphqlExecution) entity(id string) (*models.Entity, error) {
+	entity := x.fetch(id)
+	if entity == nil {
+		return nil, nil
+	}
+	if err := x.count(1); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// count adds entities to the query's total, failing past the cap
+func (x *graphqlExecution) count(n int) error {
+	x.resolved += n
+	if x.resolved > graphqlMaxEntities {
+		return fmt.Errorf("query resolves more than %d entities; narrow it or lower its limits", graphqlMaxEntities)
+	}
+	return nil
+}
+
+// entityAsOf returns the version of an entity at a point in time. History
+// follows the entity's current ACL.
+func (x *graphqlExecution) entityAsOf(id, asOf string) (*models.Entity, error) {
+	if x.h.binaryRepo == nil {
+		return nil, fmt.Errorf("temporal features are not available")
+	}
+	at, err := time.Parse(time.RFC3339Nano, asOf)
+	if err != nil {
+		return nil, fmt.Errorf("asOf must be an RFC3339 timestamp")
+	}
+	current, err := x.repo.GetByID(id)
+	if err != nil || current == nil || current.IsRecoveryPlaceholder() {
+		return nil, nil
+	}
+	version, err := x.h.binaryRepo.GetEntityAsOf(id, at)
+	if err != nil || version == nil {
+		return nil, nil
+	}
+	if err := x.count(1); err != nil {
+		return nil, err
+	}
+	return models.RedactVersionFor(x.user, version, current), nil
+}
+
+// listEntities answers the entities field from the tag index: the tags,
+// type and dataset arguments become index lookups, and only a query
+// without any of them lists every entity
+func (x *graphqlExecution) listEntities(args map[string]interface{}) (interface{}, error) {
+	tags, _ := args["tags"].([]string)
+	matchAll := true
+	if b, ok := args["matchAll"].(bool); ok {
+		matchAll = b
+	}
+	limit, offset := graphqlDefaultLimit, 0
+	if n, ok := args["limit"].(int64); ok {
+		if n < 0 || n > graphqlMaxLimit {
+			return nil, fmt.Errorf("limit must be between 0 and %d", graphqlMaxLimit)
+		}
+		limit = int(n)
+	}
+	if n, ok := args["offset"].(int64); ok {
+		if n < 0 {
+			return nil, fmt.Errorf("offset must not be negative")
+		}
+		offset = int(n)
+	}
+
+	var filters []string
+	if t, ok := args["type"].(string); ok {
+		filters = append(filters, "type:"+t)
+	}
+	if d, ok := args["dataset"].(string); ok {
+		filters = append(filters, "dataset:"+d)
+	}
+
+	var entities []*models.Entity
+	var err error
+	switch {
+	case len(tags) == 0 && len(filters) == 0:
+		entities, err = repoList(x.ctx, x.h.repo)
+	case matchAll || len(tags) == 0:
+		all := append(append([]string{}, tags...), filters...)
+		if len(all) == 1 {
+			entities, err = repoListByTag(x.ctx, x.h.repo, all[0])
+		} else {
+			entities, err = x.h.repo.ListByTags(all, true)
+		}
+	default:
+		entities, err = x.h.repo.ListByTags(tags, false)
+		if err == nil && len(filters) > 0 {
+			entities = entitiesWithAllTags(entities, filters)
+		}
+	}
+	if err != nil {
+		if isQueryStopped(err) {
+			x.stopped = err
+			return nil, nil
+		}
+		logger.Error("graphql: failed to list entities: %v", err)
+		return nil, fmt.Errorf("failed to list entities")
+	}
+	entities = models.FilterReadableEntities(x.user, entities)
+
+	// Order results so offset and limit page consistently
+	sort.Slice(entities, func(i, j int) bool {
+		if entities[i].CreatedAt != entities[j].CreatedAt {
+			return entities[i].CreatedAt < entities[j].CreatedAt
+		}
+		return entities[i].ID < entities[j].ID
+	})
+	if offset < len(entities) {
+		entities = entities[offset:]
+	} else {
+		entities = nil
+	}
+	if limit < len(entities) {
+		entities = entities[:limit]
+	}
+	if err := x.count(len(entities)); err != nil {
+		return nil, err
+	}
+
+	page := make([]*models.Entity, len(entities))
+	for i, entity := range entities {
+		page[i] = models.RedactEntityFor(x.user, entity)
+		x.entities[entity.ID] = page[i]
+	}
+	return page, nil
+}
+
+// isQueryStopped reports whether a read ended with its context
+func isQueryStopped(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// entitiesWithAllTags keeps the entities carrying every tag
+func entitiesWithAllTags(entities []*models.Entity, tags []string) []*models.Entity {
+	kept := entities[:0:0]
+	for _, entity := range entities {
+		if hasAllTags(entity, tags) {
+			kept = append(kept, entity)
+		}
+	}
+	return kept
+}
+
+// resolveEntity resolves the fields of an entity
+func (x *graphqlExecution) resolveEntity(entity *models.Entity, field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "id":
+		return entity.ID, nil
+	case "type":
+		return graphqlOptional(entity.GetEntityType()), nil
+	case "dataset":
+		return graphqlOptional(entity.GetDataset()), nil
+	case "createdAt":
+		return graphqlTime(entity.CreatedAt), nil
+	case "updatedAt":
+		return graphqlTime(entity.UpdatedAt), nil
+	case "content":
+		// Chunked content is streamed by /entities/stream
+		if entity.IsChunked() || len(entity.Content) == 0 || !utf8.Valid(entity.Content) {
+			return nil, nil
+		}
+		return string(entity.Content), nil
+	case "contentBase64":
+		if entity.IsChunked() || len(entity.Content) == 0 {
+			return nil, nil
+		}
+		return base64.StdEncoding.EncodeToString(entity.Content), nil
+	case "contentJSON":
+		return graphqlContentJSON(entity, args)
+	case "tags":
+		return graphqlTags(entity, args), nil
+	case "tag":
+		return graphqlOptional(entity.GetTagValue(args["namespace"].(string))), nil
+	case "history":
+		return x.history(entity, args)
+	case "relationships":
+		return x.relationships(entity, args)
+	default:
+		return x.related(entity, args)
+	}
+}
+
+// graphqlContentJSON returns JSON content, or the value at a path into it
+// given as a JSONPath ("$.items[0].sku") or a dotted path ("items.0.sku")
+func graphqlContentJSON(entity *models.Entity, args map[string]interface{}) (interface{}, error) {
+	if entity.IsChunked() {
+		return nil, nil
+	}
+	document, ok := models.ParseJSONContent(entity.Content)
+	if !ok {
+		return nil, nil
+	}
+	path, _ := args["path"].(string)
+	if path == "" || path == "$" {
+		return document, nil
+	}
+	if strings.HasPrefix(path, "$") {
+		converted, err := models.ContentPathFromJSONPath(path)
+		if err != nil {
+			return nil, err
+		}
+		path = converted
+	}
+	value, found := models.LookupJSONPath(document, path)
+	if !found {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// graphqlTags returns the current tags of an entity, optionally only those
+// of one namespace, with or without their timestamps
+func graphqlTags(entity *models.Entity, args map[string]interface{}) []string {
+	namespace, _ := args["namespace"].(string)
+	withTimestamps, _ := args["withTimestamps"].(bool)
+	source := entity.GetTagsWithoutTimestamp()
+	if withTimestamps {
+		source = entity.Tags
+	}
+	tags := make([]string, 0, len(source))
+	for _, tag := range source {
+		plain := tag
+		if withTimestamps {
+			if _, parsed, err := models.ParseTemporalTag(tag); err == nil {
+				plain = parsed
+			}
+		}
+		if namespace == "" || strings.HasPrefix(plain, namespace+":") {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// history returns the changes of an entity, oldest first
+func (x *graphqlExecution) history(entity *models.Entity, args map[string]interface{}) (interface{}, error) {
+	if x.h.binaryRepo == nil {
+		return nil, fmt.Errorf("temporal features are not available")
+	}
+	var from, to time.Time
+	for name, bound := range map[string]*time.Time{"from": &from, "to": &to} {
+		if text, ok := args[name].(string); ok {
+			t, err := time.Parse(time.RFC3339Nano, text)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC3339 timestamp", name)
+			}
+			*bound = t
+		}
+	}
+	limit := graphqlDefaultHistory
+	if n, ok := args["limit"].(int64); ok {
+		if n <= 0 || n > graphqlMaxHistoryLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", graphqlMaxHistoryLimit)
+		}
+		limit = int(n)
+	}
+	changes, err := x.h.binaryRepo.GetEntityChanges(entity.ID, from, to, limit)
+	if err != nil {
+		logger.Error("graphql: failed to get history of %s: %v", entity.ID, err)
+		return nil, fmt.Errorf("failed to get entity history")
+	}
+	return changes, nil
+}
+
+// relationships returns the relationships of an entity from the adjacency
+// index, leaving out those leading to entities the caller may not see
+func (x *graphqlExecution) relationships(entity *models.Entity, args map[string]interface{}) (interface{}, error) {
+	if x.h.binaryRepo == nil {
+		return nil, fmt.Errorf("repository does not index relationships")
+	}
+	direction, ok := args["direction"].(models.EdgeDirection)
+	if !ok {
+		direction = models.EdgeBoth
+	}
+	relType, _ := args["type"].(string)
+
+	var relationships []graphqlRelationship
+	for _, edge := range x.h.binaryRepo.Edges(entity.ID, direction, relType) {
+		other, out := edge.Target, edge.Source == entity.ID
+		if !out {
+			other = edge.Source
+		}
+		if x.fetch(other) == nil {
+			continue
+		}
+		relationships = append(relationships, graphqlRelationship{edge: edge, other: other, out: out})
+	}
+	if relationships == nil {
+		relationships = []graphqlRelationship{}
+	}
+	return relationships, nil
+}
+
+// related returns the distinct entities an entity is related to, in the
+// order of the adjacency index, optionally only those carrying tags
+func (x *graphqlExecution) related(entity *models.Entity, args map[string]interface{}) (interface{}, error) {
+	limit := graphqlDefaultLimit
+	if n, ok := args["limit"].(int64); ok {
+		if n < 0 || n > graphqlMaxLimit {
+			return nil, fmt.Errorf("limit must be between 0 and %d", graphqlMaxLimit)
+		}
+		limit = int(n)
+	}
+	tags, _ := args["tags"].([]string)
+
+	value, err := x.relationships(entity, args)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	related := []*models.Entity{}
+	for _, relationship := range value.([]graphqlRelationship) {
+		if len(related) >= limit {
+			break
+		}
+		if seen[relationship.other] {
+			continue
+		}
+		seen[relationship.other] = true
+		other, err := x.entity(relationship.other)
+		if err != nil {
+			return nil, err
+		}
+		if other != nil && hasAllTags(other, tags) {
+			related = append(related, other)
+		}
+	}
+	return related, nil
+}
+
+// graphqlTime formats a nanosecond timestamp, or returns nil for zero
+func graphqlTime(nanos int64) interface{} {
+	if nanos == 0 {
+		return nil
+	}
+	return time.Unix(0, nanos).UTC().Format(time.RFC3339Nano)
+}
+
+// graphqlOptional returns nil for an empty string
+func graphqlOptional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,728 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"entitydb/api/grpcpb"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/services"
+	"entitydb/storage/binary"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcPermission is the RBAC permission a gRPC method requires
+type grpcPermission struct {
+	resource string
+	action   string
+}
+
+// grpcMethodPermissions mirrors the permissions of the equivalent REST
+// routes. Methods missing from the map are rejected.
+var grpcMethodPermissions = map[string]grpcPermission{
+	grpcpb.EntityService_GetEntity_FullMethodName:        {"entity", "view"},
+	grpcpb.EntityService_CreateEntity_FullMethodName:     {"entity", "create"},
+	grpcpb.EntityService_CreateEntities_FullMethodName:   {"entity", "create"},
+	grpcpb.EntityService_UpdateEntity_FullMethodName:     {"entity", "update"},
+	grpcpb.EntityService_DeleteEntity_FullMethodName:     {"entity", "delete"},
+	grpcpb.EntityService_PatchTags_FullMethodName:        {"entity", "update"},
+	grpcpb.EntityService_ListEntities_FullMethodName:     {"entity", "view"},
+	grpcpb.EntityService_GetEntityAsOf_FullMethodName:    {"entity", "view"},
+	grpcpb.EntityService_GetEntityHistory_FullMethodName: {"entity", "view"},
+	grpcpb.EntityService_WatchChanges_FullMethodName:     {"entity", "view"},
+}
+
+// GRPCServer serves the EntityService gRPC API. Calls authenticate with the
+// same session tokens as the REST API and are authorized by the same
+// SecurityMiddleware, including any authorization hook.
+type GRPCServer struct {
+	grpcpb.UnimplementedEntityServiceServer
+
+	repo     models.EntityRepository
+	entities *EntityHandler
+	security *SecurityMiddleware
+	mode     *ServerMode
+	server   *grpc.Server
+}
+
+// NewGRPCServer creates a gRPC server for the repository. Options such as
+// TLS credentials are passed through to grpc.NewServer.
+func NewGRPCServer(repo models.EntityRepository, security *SecurityMiddleware, opts ...grpc.ServerOption) *GRPCServer {
+	s := &GRPCServer{
+		repo:     repo,
+		entities: NewEntityHandler(repo),
+		security: security,
+	}
+	opts = append(opts,
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	)
+	s.server = grpc.NewServer(opts...)
+	grpcpb.RegisterEntityServiceServer(s.server, s)
+	s.entities.SetSecurityManager(security.securityManager)
+	return s
+}
+
+// SetLockService makes updates honor entity locks when they are enforced
+func (s *GRPCServer) SetLockService(locks *services.EntityLockService) {
+	s.entities.SetLockService(locks)
+}
+
+// SetServerMode makes mutating calls fail with Unavailable while the server
+// is read-only
+func (s *GRPCServer) SetServerMode(mode *ServerMode) {
+	s.mode = mode
+}
+
+// Serve accepts connections on the listener until Stop is called
+func (s *GRPCServer) Serve(listener net.Listener) error {
+	return s.server.Serve(listener)
+}
+
+// Stop waits for in-flight calls to finish until ctx expires, then closes
+// the remaining connections. Change feed streams never finish on their own,
+// so they are cut when ctx expires.
+func (s *GRPCServer) Stop(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.server.Stop()
+	}
+}
+
+// authenticate validates the bearer token in the call metadata and checks the
+// method's permission. It returns a context carrying the SecurityContext.
+func (s *GRPCServer) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	permission, ok := grpcMethodPermissions[fullMethod]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "no permission defined for %s", fullMethod)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "Authentication required")
+	}
+	parts := strings.Split(values[0], " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, status.Error(codes.Unauthenticated, "Invalid token format")
+	}
+	token := parts[1]
+
+	user, err := s.security.securityManager.ValidateSession(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Invalid or expired session")
+	}
+	// Calls are not tied to a dataset, so scoped sessions cannot be confined
+	if user.Scope != "" {
+		return nil, status.Errorf(codes.PermissionDenied, "Session is scoped to dataset %s", user.Scope)
+	}
+
+	allowed, err := s.security.authorizeCall(ctx, "GRPC", fullMethod, user, permission.resource, permission.action, "")
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to check permissions")
+	}
+	if !allowed {
+		return nil, status.Errorf(codes.PermissionDenied, "Insufficient permissions: %s:%s required", permission.resource, permission.action)
+	}
+
+	return context.WithValue(ctx, securityContextKey{}, &SecurityContext{User: user, Token: token}), nil
+}
+
+// grpcAuditActions lists the methods recorded in the audit log
+var grpcAuditActions = map[string]string{
+	grpcpb.EntityService_CreateEntity_FullMethodName:   AuditActionCreate,
+	grpcpb.EntityService_CreateEntities_FullMethodName: AuditActionCreate,
+	grpcpb.EntityService_UpdateEntity_FullMethodName:   AuditActionUpdate,
+	grpcpb.EntityService_DeleteEntity_FullMethodName:   AuditActionDelete,
+	grpcpb.EntityService_PatchTags_FullMethodName:      AuditActionTag,
+}
+
+func (s *GRPCServer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mode.checkGRPCWrite(info.FullMethod); err != nil {
+		return nil, err
+	}
+
+	action, audited := grpcAuditActions[info.FullMethod]
+	if !audited || !GetAuditLog().IsEnabled() {
+		return handler(ctx, req)
+	}
+	var entityID string
+	if target, ok := req.(interface{ GetId() string }); ok {
+		entityID = target.GetId()
+	}
+	finish := GetAuditLog().BeginCall(ctx, info.FullMethod, action, entityID)
+	resp, err := handler(ctx, req)
+	var createdID string
+	if created, ok := resp.(*grpcpb.Entity); ok && err == nil {
+		createdID = created.GetId()
+	}
+	finish(createdID, err)
+	return resp, err
+}
+
+func (s *GRPCServer) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	if err := s.mode.checkGRPCWrite(info.FullMethod); err != nil {
+		return err
+	}
+
+	action, audited := grpcAuditActions[info.FullMethod]
+	if !audited || !GetAuditLog().IsEnabled() {
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+	finish := GetAuditLog().BeginCall(ctx, info.FullMethod, action, "")
+	err = handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	finish("", err)
+	return err
+}
+
+// authenticatedStream carries the SecurityContext to stream handlers
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcUser returns the authenticated user of a call
+func grpcUser(ctx context.Context) (*models.SecurityUser, error) {
+	securityCtx, ok := ctx.Value(securityContextKey{}).(*SecurityContext)
+	if !ok || securityCtx.User == nil {
+		return nil, status.Error(codes.Unauthenticated, "Authentication required")
+	}
+	return securityCtx.User, nil
+}
+
+// grpcEntityACL returns NotFound when an entity's ACL hides it from the
+// call's user and PermissionDenied when it withholds write access
+func grpcEntityACL(ctx context.Context, entity *models.Entity, access models.ACLAccess) error {
+	user, _ := grpcUser(ctx)
+	if !models.CanAccessEntity(user, entity, models.ACLRead) {
+		return status.Error(codes.NotFound, "Entity not found")
+	}
+	if access == models.ACLWrite && !models.CanAccessEntity(user, entity, models.ACLWrite) {
+		return status.Error(codes.PermissionDenied, "Entity ACL does not grant write access")
+	}
+	return nil
+}
+
+// grpcSensitiveTagRemoval returns PermissionDenied when giving an entity
+// the tags would drop sensitive paths the call's user may not see past
+func grpcSensitiveTagRemoval(ctx context.Context, entity *models.Entity, tags []string) error {
+	user, _ := grpcUser(ctx)
+	if models.CanViewSensitiveContent(user) || !models.DropsSensitivePaths(entity, tags) {
+		return nil
+	}
+	return status.Error(codes.PermissionDenied, "Removing sensitive:content tags requires the entity:view_sensitive permission")
+}
+
+// grpcDatasetRecordWrite returns PermissionDenied when a write would create
+// or change a dataset or system dataset entity and the call's user may not
+// update datasets, as rejectDatasetRecordWrite does over REST
+func grpcDatasetRecordWrite(user *models.SecurityUser, tagSets ...[]string) error {
+	if !models.WritesDatasetRecord(tagSets...) || models.CanManageDatasets(user) {
+		return nil
+	}
+	return status.Error(codes.PermissionDenied, errDatasetRecordWrite.Error())
+}
+
+// grpcIdentityError converts a CheckUniqueIdentity error to a gRPC status
+func grpcIdentityError(err error) error {
+	if errors.Is(err, models.ErrDuplicateIdentity) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	logger.Error("failed to check identity tags: %v", err)
+	return status.Error(codes.Internal, "Failed to check identity tags")
+}
+
+// toProtoEntity converts an entity to its gRPC form as user may see it
+func (s *GRPCServer) toProtoEntity(user *models.SecurityUser, entity *models.Entity, includeTimestamps, includeContent bool) *grpcpb.Entity {
+	result := &grpcpb.Entity{
+		Id:        entity.ID,
+		Tags:      s.entities.stripTimestampsFromEntity(entity, includeTimestamps).Tags,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+	}
+	if includeContent {
+		result.Content = models.RedactEntityFor(user, entity).Content
+	}
+	if binaryRepo, err := asTemporalRepository(s.repo); err == nil {
+		result.Version = binaryRepo.GetEntityChangeCounter(entity)
+	}
+	return result
+}
+
+// getEntity loads an entity, reassembling chunked content
+func (s *GRPCServer) getEntity(id string) (*models.Entity, error) {
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "Entity ID is required")
+	}
+	entity, err := s.repo.GetByID(id)
+	if err != nil || entity == nil {
+		return nil, status.Error(codes.NotFound, "Entity not found")
+	}
+	if entity.IsChunked() {
+		content, err := s.entities.HandleChunkedContent(id, true)
+		if err != nil {
+			logger.Error("failed to reassemble chunked content for %s: %v", id, err)
+			return nil, status.Error(codes.Internal, "Failed to read chunked content")
+		}
+		// Copy so the reassembled content does not end up in the entity cache
+		reassembled := *entity
+		reassembled.Content = content
+		entity = &reassembled
+	}
+	return entity, nil
+}
+
+// GetEntity returns an entity by ID
+func (s *GRPCServer) GetEntity(ctx context.Context, req *grpcpb.GetEntityRequest) (*grpcpb.Entity, error) {
+	entity, err := s.getEntity(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := grpcEntityACL(ctx, entity, models.ACLRead); err != nil {
+		return nil, err
+	}
+	user, _ := grpcUser(ctx)
+	return s.toProtoEntity(user, entity, req.GetIncludeTimestamps(), true), nil
+}
+
+// createEntity creates an entity the way the REST CreateEntity handler does
+func (s *GRPCServer) createEntity(user *models.SecurityUser, req *grpcpb.CreateEntityRequest) (*models.Entity, error) {
+	entityType := "entity"
+	dataset := "default"
+	additionalTags := []string{}
+	for _, tag := range req.GetTags() {
+		switch {
+		case strings.HasPrefix(tag, "type:"):
+			entityType = strings.TrimPrefix(tag, "type:")
+		case strings.HasPrefix(tag, "dataset:"):
+			dataset = strings.TrimPrefix(tag, "dataset:")
+		default:
+			additionalTags = append(additionalTags, tag)
+		}
+	}
+
+	entity, err := models.NewEntityWithMandatoryTags(entityType, dataset, user.ID, additionalTags)
+	if err != nil {
+		logger.Error("Failed to create entity with UUID architecture: %v", err)
+		return nil, status.Error(codes.Internal, "Failed to create entity")
+	}
+	if err := grpcDatasetRecordWrite(user, entity.Tags); err != nil {
+		return nil, err
+	}
+	defer s.entities.lockIdentities(entity.Tags)()
+	if err := models.CheckUniqueIdentity(s.repo, "", entity.Tags); err != nil {
+		return nil, grpcIdentityError(err)
+	}
+
+	if len(req.GetContent()) > 0 {
+		contentType := req.GetContentType()
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		if err := setEntityContent(s.repo, entity, req.GetContent(), contentType); err != nil {
+			logger.Error("failed to store content for %s: %v", entity.ID, err)
+			return nil, status.Error(codes.Internal, "Failed to store content")
+		}
+	}
+
+	if err := s.repo.Create(entity); errors.Is(err, binary.ErrDatasetQuotaExceeded) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	} else if err != nil {
+		logger.Error("failed to create entity %s: %v", entity.ID, err)
+		return nil, status.Error(codes.Internal, "Failed to create entity")
+	}
+	return entity, nil
+}
+
+// CreateEntity creates an entity with the mandatory tags
+func (s *GRPCServer) CreateEntity(ctx context.Context, req *grpcpb.CreateEntityRequest) (*grpcpb.Entity, error) {
+	user, err := grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := s.createEntity(user, req)
+	if err != nil {
+		return nil, err
+	}
+	if saved, err := s.repo.GetByID(entity.ID); err == nil {
+		entity = saved
+	}
+	logger.Info("entity created via gRPC: id=%s", entity.ID)
+	return s.toProtoEntity(user, entity, false, true), nil
+}
+
+// CreateEntities creates every entity on the stream. Entities created before
+// a failure are kept; the error reports how many were created.
+func (s *GRPCServer) CreateEntities(stream grpc.ClientStreamingServer[grpcpb.CreateEntityRequest, grpcpb.CreateEntitiesResponse]) error {
+	user, err := grpcUser(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	response := &grpcpb.CreateEntitiesResponse{}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			logger.Info("created %d entities via gRPC stream", len(response.Ids))
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+		entity, err := s.createEntity(user, req)
+		if err != nil {
+			return status.Errorf(status.Code(err), "%s after %d entities created", status.Convert(err).Message(), len(response.Ids))
+		}
+		response.Ids = append(response.Ids, entity.ID)
+	}
+}
+
+// UpdateEntity replaces the tags and/or content of an entity. A non-zero
+// if_version makes the update conditional, as If-Match does over REST.
+func (s *GRPCServer) UpdateEntity(ctx context.Context, req *grpcpb.UpdateEntityRequest) (*grpcpb.Entity, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Entity ID is required")
+	}
+	existing, err := s.repo.GetByID(req.GetId())
+	if err != nil || existing == nil {
+		return nil, status.Error(codes.NotFound, "Entity not found")
+	}
+	if err := grpcEntityACL(ctx, existing, models.ACLWrite); err != nil {
+		return nil, err
+	}
+	user, _ := grpcUser(ctx)
+	if err := grpcDatasetRecordWrite(user, existing.Tags, req.GetTags()); err != nil {
+		return nil, err
+	}
+	if s.entities.locks != nil {
+		if err := s.entities.locks.CheckUpdate(existing, user); err != nil {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+	}
+
+	// Apply changes to a copy so a rejected update leaves the stored entity untouched
+	entity := &models.Entity{
+		ID:        existing.ID,
+		Tags:      append([]string(nil), existing.Tags...),
+		Content:   existing.Content,
+		CreatedAt: existing.CreatedAt,
+		UpdatedAt: existing.UpdatedAt,
+	}
+	if req.GetReplaceTags() {
+		defer s.entities.lockIdentities(req.GetTags())()
+		if err := models.CheckUniqueIdentity(s.repo, existing.ID, req.GetTags()); err != nil {
+			return nil, grpcIdentityError(err)
+		}
+		if err := grpcSensitiveTagRemoval(ctx, existing, req.GetTags()); err != nil {
+			return nil, err
+		}
+		entity.Tags = models.KeepLockTags(existing, req.GetTags())
+	}
+	if req.GetReplaceContent() {
+		entity.Content = req.GetContent()
+		if !containsTagPrefix(entity.GetTagsWithoutTimestamp(), "content:type:") {
+			entity.Tags = append(entity.Tags, "content:type:application/octet-stream")
+		}
+	}
+
+	if req.GetIfVersion() != 0 {
+		updater, ok := s.repo.(conditionalUpdater)
+		if !ok {
+			return nil, status.Error(codes.Unimplemented, "Conditional updates not supported")
+		}
+		err = updater.UpdateIfVersion(entity, req.GetIfVersion())
+	} else {
+		err = s.repo.Update(entity)
+	}
+	if errors.Is(err, binary.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, "Entity was modified by another request")
+	}
+	if errors.Is(err, binary.ErrDatasetQuotaExceeded) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if isImmutableWrite(err) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		logger.Error("failed to update entity %s: %v", req.GetId(), err)
+		return nil, status.Error(codes.Internal, "Failed to update entity")
+	}
+
+	updated, err := s.repo.GetByID(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to retrieve updated entity")
+	}
+	return s.toProtoEntity(user, updated, false, true), nil
+}
+
+// DeleteEntity soft deletes an entity, like POST /entities/{id}/delete
+func (s *GRPCServer) DeleteEntity(ctx context.Context, req *grpcpb.DeleteEntityRequest) (*grpcpb.DeleteEntityResponse, error) {
+	user, err := grpcUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Entity ID is required")
+	}
+	if req.GetReason() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Deletion reason is required")
+	}
+
+	entity, err := s.repo.GetByID(req.GetId())
+	if err != nil || entity == nil {
+		return nil, status.Error(codes.NotFound, "Entity not found")
+	}
+	if err := grpcEntityACL(ctx, entity, models.ACLWrite); err != nil {
+		return nil, err
+	}
+	if state := entity.GetLifecycleState(); state != models.StateActive {
+		return nil, status.Errorf(codes.FailedPrecondition, "Entity is already %s", state)
+	}
+	if err := entity.SoftDelete(user.ID, req.GetReason(), req.GetPolicy()); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "Cannot delete entity: %v", err)
+	}
+	if err := s.repo.Update(entity); err != nil {
+		logger.Error("failed to soft delete entity %s: %v", req.GetId(), err)
+		return nil, status.Error(codes.Internal, "Failed to update entity")
+	}
+
+	logger.Info("entity %s soft deleted via gRPC by %s, reason: %s", req.GetId(), user.ID, req.GetReason())
+	return &grpcpb.DeleteEntityResponse{Id: entity.ID, State: string(entity.GetLifecycleState())}, nil
+}
+
+// PatchTags removes and then adds individual tags, like PATCH /entities/patch-tags
+func (s *GRPCServer) PatchTags(ctx context.Context, req *grpcpb.PatchTagsRequest) (*grpcpb.PatchTagsResponse, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Entity ID is required")
+	}
+	if len(req.GetAddTags()) == 0 && len(req.GetRemoveTags()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "add_tags or remove_tags is required")
+	}
+	for _, tag := range append(append([]string{}, req.GetAddTags()...), req.GetRemoveTags()...) {
+		if strings.TrimSpace(tag) == "" {
+			return nil, status.Error(codes.InvalidArgument, "Tags must not be empty")
+		}
+	}
+	entity, err := s.repo.GetByID(req.GetId())
+	if err != nil || entity == nil {
+		return nil, status.Error(codes.NotFound, "Entity not found")
+	}
+	if err := grpcEntityACL(ctx, entity, models.ACLWrite); err != nil {
+		return nil, err
+	}
+	user, _ := grpcUser(ctx)
+	if err := grpcDatasetRecordWrite(user, entity.Tags, req.GetAddTags()); err != nil {
+		return nil, err
+	}
+	defer s.entities.lockIdentities(req.GetAddTags())()
+	if err := models.CheckUniqueIdentity(s.repo, req.GetId(), req.GetAddTags()); err != nil {
+		return nil, grpcIdentityError(err)
+	}
+	if err := grpcSensitiveTagRemoval(ctx, entity, remainingTags(entity, req.GetRemoveTags())); err != nil {
+		return nil, err
+	}
+
+	response := &grpcpb.PatchTagsResponse{Id: req.GetId(), Added: []string{}, Removed: []string{}}
+	for _, tag := range req.GetRemoveTags() {
+		for _, stored := range entity.StoredTags(tag) {
+			if err := s.repo.RemoveTag(req.GetId(), stored); err != nil {
+				if isImmutableWrite(err) {
+					return nil, status.Error(codes.FailedPrecondition, err.Error())
+				}
+				logger.Error("failed to remove tag %s from entity %s: %v", tag, req.GetId(), err)
+				return nil, status.Error(codes.Internal, "Failed to remove tag "+tag)
+			}
+		}
+		response.Removed = append(response.Removed, tag)
+	}
+	for _, tag := range req.GetAddTags() {
+		if err := s.repo.AddTag(req.GetId(), tag); err != nil {
+			if isImmutableWrite(err) {
+				return nil, status.Error(codes.FailedPrecondition, err.Error())
+			}
+			logger.Error("failed to add tag %s to entity %s: %v", tag, req.GetId(), err)
+			return nil, status.Error(codes.Internal, "Failed to add tag "+tag)
+		}
+		response.Added = append(response.Added, tag)
+	}
+	return response, nil
+}
+
+// ListEntities streams the entities carrying the requested tags. Without
+// tags, it streams the entities of the requested dataset.
+func (s *GRPCServer) ListEntities(req *grpcpb.ListEntitiesRequest, stream grpc.ServerStreamingServer[grpcpb.Entity]) error {
+	var entities []*models.Entity
+	var err error
+	switch {
+	case len(req.GetTags()) > 0:
+		entities, err = s.repo.ListByTags(req.GetTags(), req.GetMatchAll())
+	case req.GetDataset() != "":
+		entities, err = repoListByTag(stream.Context(), s.repo, "dataset:"+req.GetDataset())
+	default:
+		return status.Error(codes.InvalidArgument, "tags or dataset is required")
+	}
+	if err != nil {
+		if ctxErr := stream.Context().Err(); ctxErr != nil {
+			return status.FromContextError(ctxErr).Err()
+		}
+		logger.Error("failed to list entities by tags %v: %v", req.GetTags(), err)
+		return status.Error(codes.Internal, "Failed to list entities")
+	}
+	user, _ := grpcUser(stream.Context())
+	entities = models.FilterReadableEntities(user, entities)
+
+	sent := 0
+	for _, entity := range entities {
+		if req.GetLimit() > 0 && sent >= int(req.GetLimit()) {
+			break
+		}
+		if req.GetDataset() != "" && entity.GetDataset() != req.GetDataset() {
+			continue
+		}
+		if err := stream.Send(s.toProtoEntity(user, entity, req.GetIncludeTimestamps(), req.GetIncludeContent())); err != nil {
+			return err
+		}
+		sent++
+	}
+	return nil
+}
+
+// GetEntityAsOf returns an entity as it was at a point in time
+func (s *GRPCServer) GetEntityAsOf(ctx context.Context, req *grpcpb.GetEntityAsOfRequest) (*grpcpb.Entity, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Entity ID is required")
+	}
+	if req.GetAsOf() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "as_of is required")
+	}
+	temporalRepo, err := asTemporalRepository(s.repo)
+	if err != nil {
+		return nil, status.Error(codes.Unimplemented, "Temporal features not available")
+	}
+
+	user, _ := grpcUser(ctx)
+	current, err := historyEntity(s.repo, user, req.GetId())
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "Entity not found")
+	}
+
+	asOf := time.Unix(0, req.GetAsOf()).UTC()
+	entity, err := temporalRepo.GetEntityAsOf(req.GetId(), asOf)
+	if err != nil {
+		if strings.Contains(err.Error(), "entity not found") || strings.Contains(err.Error(), "did not exist at") {
+			return nil, status.Errorf(codes.NotFound, "Entity %s did not exist at %v", req.GetId(), asOf)
+		}
+		logger.Error("failed to get entity %s as of %v: %v", req.GetId(), asOf, err)
+		return nil, status.Errorf(codes.Internal, "Failed to get historical entity: %v", err)
+	}
+	return s.toProtoEntity(user, models.RedactVersionFor(user, entity, current), req.GetIncludeTimestamps(), true), nil
+}
+
+// GetEntityHistory returns the tag changes of an entity
+func (s *GRPCServer) GetEntityHistory(ctx context.Context, req *grpcpb.GetEntityHistoryRequest) (*grpcpb.GetEntityHistoryResponse, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Entity ID is required")
+	}
+	limit := 100
+	if req.GetLimit() > 0 {
+		limit = int(req.GetLimit())
+	}
+	temporalRepo, err := asTemporalRepository(s.repo)
+	if err != nil {
+		return nil, status.Error(codes.Unimplemented, "Temporal features not available")
+	}
+	user, _ := grpcUser(ctx)
+	if _, err := historyEntity(s.repo, user, req.GetId()); err != nil {
+		return nil, status.Errorf(codes.NotFound, "Entity %s not found", req.GetId())
+	}
+
+	history, err := temporalRepo.GetEntityHistory(req.GetId(), limit)
+	if err != nil {
+		logger.Error("failed to get entity history for %s (limit=%d): %v", req.GetId(), limit, err)
+		return nil, status.Errorf(codes.Internal, "Failed to get entity history: %v", err)
+	}
+
+	response := &grpcpb.GetEntityHistoryResponse{Changes: make([]*grpcpb.EntityChange, 0, len(history))}
+	for _, change := range history {
+		response.Changes = append(response.Changes, &grpcpb.EntityChange{
+			Type:      change.Type,
+			Timestamp: change.Timestamp,
+			OldValue:  change.OldValue,
+			NewValue:  change.NewValue,
+		})
+	}
+	return response, nil
+}
+
+// WatchChanges streams committed changes until the client cancels. A client
+// that cannot keep up is disconnected with ResourceExhausted and should
+// resubscribe, then re-read whatever it tracks.
+func (s *GRPCServer) WatchChanges(req *grpcpb.WatchChangesRequest, stream grpc.ServerStreamingServer[grpcpb.ChangeEvent]) error {
+	binaryRepo, err := asTemporalRepository(s.repo)
+	if err != nil {
+		return status.Error(codes.Unimplemented, "Change feed not available")
+	}
+
+	entityIDs := make(map[string]bool, len(req.GetEntityIds()))
+	for _, id := range req.GetEntityIds() {
+		entityIDs[id] = true
+	}
+
+	changes, cancel := binaryRepo.SubscribeChanges(0)
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case change, ok := <-changes:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "change feed subscriber fell behind; resubscribe")
+			}
+			if req.GetDataset() != "" && change.Dataset != req.GetDataset() {
+				continue
+			}
+			if len(entityIDs) > 0 && !entityIDs[change.EntityID] {
+				continue
+			}
+			err := stream.Send(&grpcpb.ChangeEvent{
+				Op:        change.Op,
+				EntityId:  change.EntityID,
+				Dataset:   change.Dataset,
+				Version:   change.Version,
+				Timestamp: change.Timestamp,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to send change event: %w", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"entitydb/api/grpcpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestGRPCClient serves the gRPC API of security's repository over an
+// in-memory connection
+func newTestGRPCClient(t *testing.T, security *testSecurity) grpcpb.EntityServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := NewGRPCServer(security.repo, security.middleware)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Stop(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpcpb.NewEntityServiceClient(conn)
+}
+
+// TestGRPCServerAuthorization checks that calls without a valid session are
+// unauthenticated, that calls are refused without the method's permission,
+// and that permitted calls create and return entities
+func TestGRPCServerAuthorization(t *testing.T) {
+	security := newTestSecurity(t)
+	client := newTestGRPCClient(t, security)
+	_, adminToken := security.login(t, "admin")
+	_, userToken := security.login(t, "alice")
+	as := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	created, err := client.CreateEntity(as(userToken), &grpcpb.CreateEntityRequest{
+		Tags:    []string{"type:note", "status:draft"},
+		Content: []byte("hello"),
+	})
+	if err != nil {
+		t.Fatalf("CreateEntity: %v", err)
+	}
+	got, err := client.GetEntity(as(userToken), &grpcpb.GetEntityRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatalf("GetEntity: %v", err)
+	}
+	if string(got.GetContent()) != "hello" {
+		t.Errorf("GetEntity content = %q, want hello", got.GetContent())
+	}
+
+	unauthenticated := map[string]context.Context{
+		"no token":      context.Background(),
+		"unknown token": as("not-a-session"),
+		"wrong scheme":  metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+userToken),
+	}
+	for name, ctx := range unauthenticated {
+		if _, err := client.GetEntity(ctx, &grpcpb.GetEntityRequest{Id: created.GetId()}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s: GetEntity error = %v, want Unauthenticated", name, err)
+		}
+	}
+
+	// Regular users cannot delete
+	if _, err := client.DeleteEntity(as(userToken), &grpcpb.DeleteEntityRequest{Id: created.GetId(), Reason: "test"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("DeleteEntity without entity:delete = %v, want PermissionDenied", err)
+	}
+	if _, err := client.GetEntity(as(userToken), &grpcpb.GetEntityRequest{Id: created.GetId()}); err != nil {
+		t.Errorf("entity is gone after a refused delete: %v", err)
+	}
+	if _, err := client.DeleteEntity(as(adminToken), &grpcpb.DeleteEntityRequest{Id: created.GetId(), Reason: "test"}); err != nil {
+		t.Errorf("DeleteEntity as admin: %v", err)
+	}
+}
+
+// TestGRPCDatasetRecordWrites checks that the gRPC API refuses to create or
+// change dataset records, and so re-quota a dataset, for a user who may not
+// update datasets
+func TestGRPCDatasetRecordWrites(t *testing.T) {
+	security := newTestSecurity(t)
+	client := newTestGRPCClient(t, security)
+	_, adminToken := security.login(t, "admin")
+	_, userToken := security.login(t, "alice")
+	as := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	quota := []byte(`{"settings":{"quota_max_entities":"1"}}`)
+	if _, err := client.CreateEntity(as(userToken), &grpcpb.CreateEntityRequest{
+		Tags:    []string{"type:dataset", "dataset:system", "name:payroll"},
+		Content: quota,
+	}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("CreateEntity of a dataset record as alice = %v, want PermissionDenied", err)
+	}
+
+	created, err := client.CreateEntity(as(adminToken), &grpcpb.CreateEntityRequest{
+		Tags: []string{"type:dataset", "dataset:system", "name:payroll"},
+	})
+	if err != nil {
+		t.Fatalf("CreateEntity of a dataset record as admin: %v", err)
+	}
+	update := &grpcpb.UpdateEntityRequest{Id: created.GetId(), Content: quota, ReplaceContent: true}
+	if _, err := client.UpdateEntity(as(userToken), update); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("UpdateEntity of a dataset record as alice = %v, want PermissionDenied", err)
+	}
+	if _, err := client.PatchTags(as(userToken), &grpcpb.PatchTagsRequest{Id: created.GetId(), AddTags: []string{"public:read"}}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("PatchTags of a dataset record as alice = %v, want PermissionDenied", err)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if usage := security.repo.GetDatasetUsage("payroll"); usage.Quota.MaxEntities != 0 {
+		t.Fatalf("alice set a payroll quota: %+v", usage.Quota)
+	}
+
+	if _, err := client.UpdateEntity(as(adminToken), update); err != nil {
+		t.Fatalf("UpdateEntity of a dataset record as admin: %v", err)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if usage := security.repo.GetDatasetUsage("payroll"); usage.Quota.MaxEntities != 1 {
+		t.Errorf("payroll quota after the admin update = %+v, want 1 entity", usage.Quota)
+	}
+}
@@ -0,0 +1,492 @@
+// gRPC API for EntityDB.
+//
+// Regenerate the Go code after editing:
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//          --go-grpc_out=. --go-grpc_opt=paths=source_relative entitydb.proto
+//
+// Every call must carry "authorization: Bearer <token>" metadata with a token
+// from POST /api/v1/auth/login. Timestamps are nanoseconds since the epoch.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: entitydb.proto
+
+package grpcpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	EntityService_GetEntity_FullMethodName        = "/entitydb.v1.EntityService/GetEntity"
+	EntityService_CreateEntity_FullMethodName     = "/entitydb.v1.EntityService/CreateEntity"
+	EntityService_CreateEntities_FullMethodName   = "/entitydb.v1.EntityService/CreateEntities"
+	EntityService_UpdateEntity_FullMethodName     = "/entitydb.v1.EntityService/UpdateEntity"
+	EntityService_DeleteEntity_FullMethodName     = "/entitydb.v1.EntityService/DeleteEntity"
+	EntityService_PatchTags_FullMethodName        = "/entitydb.v1.EntityService/PatchTags"
+	EntityService_ListEntities_FullMethodName     = "/entitydb.v1.EntityService/ListEntities"
+	EntityService_GetEntityAsOf_FullMethodName    = "/entitydb.v1.EntityService/GetEntityAsOf"
+	EntityService_GetEntityHistory_FullMethodName = "/entitydb.v1.EntityService/GetEntityHistory"
+	EntityService_WatchChanges_FullMethodName     = "/entitydb.v1.EntityService/WatchChanges"
+)
+
+// EntityServiceClient is the client API for EntityService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EntityServiceClient interface {
+	// GetEntity returns an entity by ID (entity:view)
+	GetEntity(ctx context.Context, in *GetEntityRequest, opts ...grpc.CallOption) (*Entity, error)
+	// CreateEntity creates an entity with the mandatory tags (entity:create)
+	CreateEntity(ctx context.Context, in *CreateEntityRequest, opts ...grpc.CallOption) (*Entity, error)
+	// CreateEntities creates a stream of entities and reports the created IDs (entity:create)
+	CreateEntities(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[CreateEntityRequest, CreateEntitiesResponse], error)
+	// UpdateEntity replaces tags and/or content, optionally only at a given version (entity:update)
+	UpdateEntity(ctx context.Context, in *UpdateEntityRequest, opts ...grpc.CallOption) (*Entity, error)
+	// DeleteEntity soft deletes an entity (entity:delete)
+	DeleteEntity(ctx context.Context, in *DeleteEntityRequest, opts ...grpc.CallOption) (*DeleteEntityResponse, error)
+	// PatchTags adds and removes individual tags (entity:update)
+	PatchTags(ctx context.Context, in *PatchTagsRequest, opts ...grpc.CallOption) (*PatchTagsResponse, error)
+	// ListEntities streams the entities carrying the given tags (entity:view)
+	ListEntities(ctx context.Context, in *ListEntitiesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Entity], error)
+	// GetEntityAsOf returns an entity as it was at a point in time (entity:view)
+	GetEntityAsOf(ctx context.Context, in *GetEntityAsOfRequest, opts ...grpc.CallOption) (*Entity, error)
+	// GetEntityHistory returns the tag changes of an entity (entity:view)
+	GetEntityHistory(ctx context.Context, in *GetEntityHistoryRequest, opts ...grpc.CallOption) (*GetEntityHistoryResponse, error)
+	// WatchChanges streams committed changes until the client cancels (entity:view)
+	WatchChanges(ctx context.Context, in *WatchChangesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChangeEvent], error)
+}
+
+type entityServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEntityServiceClient(cc grpc.ClientConnInterface) EntityServiceClient {
+	return &entityServiceClient{cc}
+}
+
+func (c *entityServiceClient) GetEntity(ctx context.Context, in *GetEntityRequest, opts ...grpc.CallOption) (*Entity, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Entity)
+	err := c.cc.Invoke(ctx, EntityService_GetEntity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entityServiceClient) CreateEntity(ctx context.Context, in *CreateEntityRequest, opts ...grpc.CallOption) (*Entity, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Entity)
+	err := c.cc.Invoke(ctx, EntityService_CreateEntity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entityServiceClient) CreateEntities(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[CreateEntityRequest, CreateEntitiesResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EntityService_ServiceDesc.Streams[0], EntityService_CreateEntities_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CreateEntityRequest, CreateEntitiesResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EntityService_CreateEntitiesClient = grpc.ClientStreamingClient[CreateEntityRequest, CreateEntitiesResponse]
+
+func (c *entityServiceClient) UpdateEntity(ctx context.Context, in *UpdateEntityRequest, opts ...grpc.CallOption) (*Entity, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Entity)
+	err := c.cc.Invoke(ctx, EntityService_UpdateEntity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entityServiceClient) DeleteEntity(ctx context.Context, in *DeleteEntityRequest, opts ...grpc.CallOption) (*DeleteEntityResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteEntityResponse)
+	err := c.cc.Invoke(ctx, EntityService_DeleteEntity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entityServiceClient) PatchTags(ctx context.Context, in *PatchTagsRequest, opts ...grpc.CallOption) (*PatchTagsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PatchTagsResponse)
+	err := c.cc.Invoke(ctx, EntityService_PatchTags_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entityServiceClient) ListEntities(ctx context.Context, in *ListEntitiesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Entity], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EntityService_ServiceDesc.Streams[1], EntityService_ListEntities_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListEntitiesRequest, Entity]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EntityService_ListEntitiesClient = grpc.ServerStreamingClient[Entity]
+
+func (c *entityServiceClient) GetEntityAsOf(ctx context.Context, in *GetEntityAsOfRequest, opts ...grpc.CallOption) (*Entity, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Entity)
+	err := c.cc.Invoke(ctx, EntityService_GetEntityAsOf_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entityServiceClient) GetEntityHistory(ctx context.Context, in *GetEntityHistoryRequest, opts ...grpc.CallOption) (*GetEntityHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetEntityHistoryResponse)
+	err := c.cc.Invoke(ctx, EntityService_GetEntityHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entityServiceClient) WatchChanges(ctx context.Context, in *WatchChangesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChangeEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EntityService_ServiceDesc.Streams[2], EntityService_WatchChanges_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchChangesRequest, ChangeEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EntityService_WatchChangesClient = grpc.ServerStreamingClient[ChangeEvent]
+
+// EntityServiceServer is the server API for EntityService service.
+// All implementations must embed UnimplementedEntityServiceServer
+// for forward compatibility.
+type EntityServiceServer interface {
+	// GetEntity returns an entity by ID (entity:view)
+	GetEntity(context.Context, *GetEntityRequest) (*Entity, error)
+	// CreateEntity creates an entity with the mandatory tags (entity:create)
+	CreateEntity(context.Context, *CreateEntityRequest) (*Entity, error)
+	// CreateEntities creates a stream of entities and reports the created IDs (entity:create)
+	CreateEntities(grpc.ClientStreamingServer[CreateEntityRequest, CreateEntitiesResponse]) error
+	// UpdateEntity replaces tags and/or content, optionally only at a given version (entity:update)
+	UpdateEntity(context.Context, *UpdateEntityRequest) (*Entity, error)
+	// DeleteEntity soft deletes an entity (entity:delete)
+	DeleteEntity(context.Context, *DeleteEntityRequest) (*DeleteEntityResponse, error)
+	// PatchTags adds and removes individual tags (entity:update)
+	PatchTags(context.Context, *PatchTagsRequest) (*PatchTagsResponse, error)
+	// ListEntities streams the entities carrying the given tags (entity:view)
+	ListEntities(*ListEntitiesRequest, grpc.ServerStreamingServer[Entity]) error
+	// GetEntityAsOf returns an entity as it was at a point in time (entity:view)
+	GetEntityAsOf(context.Context, *GetEntityAsOfRequest) (*Entity, error)
+	// GetEntityHistory returns the tag changes of an entity (entity:view)
+	GetEntityHistory(context.Context, *GetEntityHistoryRequest) (*GetEntityHistoryResponse, error)
+	// WatchChanges streams committed changes until the client cancels (entity:view)
+	WatchChanges(*WatchChangesRequest, grpc.ServerStreamingServer[ChangeEvent]) error
+	mustEmbedUnimplementedEntityServiceServer()
+}
+
+// UnimplementedEntityServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEntityServiceServer struct{}
+
+func (UnimplementedEntityServiceServer) GetEntity(context.Context, *GetEntityRequest) (*Entity, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEntity not implemented")
+}
+func (UnimplementedEntityServiceServer) CreateEntity(context.Context, *CreateEntityRequest) (*Entity, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateEntity not implemented")
+}
+func (UnimplementedEntityServiceServer) CreateEntities(grpc.ClientStreamingServer[CreateEntityRequest, CreateEntitiesResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CreateEntities not implemented")
+}
+func (UnimplementedEntityServiceServer) UpdateEntity(context.Context, *UpdateEntityRequest) (*Entity, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateEntity not implemented")
+}
+func (UnimplementedEntityServiceServer) DeleteEntity(context.Context, *DeleteEntityRequest) (*DeleteEntityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteEntity not implemented")
+}
+func (UnimplementedEntityServiceServer) PatchTags(context.Context, *PatchTagsRequest) (*PatchTagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PatchTags not implemented")
+}
+func (UnimplementedEntityServiceServer) ListEntities(*ListEntitiesRequest, grpc.ServerStreamingServer[Entity]) error {
+	return status.Errorf(codes.Unimplemented, "method ListEntities not implemented")
+}
+func (UnimplementedEntityServiceServer) GetEntityAsOf(context.Context, *GetEntityAsOfRequest) (*Entity, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEntityAsOf not implemented")
+}
+func (UnimplementedEntityServiceServer) GetEntityHistory(context.Context, *GetEntityHistoryRequest) (*GetEntityHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEntityHistory not implemented")
+}
+func (UnimplementedEntityServiceServer) WatchChanges(*WatchChangesRequest, grpc.ServerStreamingServer[ChangeEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchChanges not implemented")
+}
+func (UnimplementedEntityServiceServer) mustEmbedUnimplementedEntityServiceServer() {}
+func (UnimplementedEntityServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeEntityServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EntityServiceServer will
+// result in compilation errors.
+type UnsafeEntityServiceServer interface {
+	mustEmbedUnimplementedEntityServiceServer()
+}
+
+func RegisterEntityServiceServer(s grpc.ServiceRegistrar, srv EntityServiceServer) {
+	// If the following call pancis, it indicates UnimplementedEntityServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EntityService_ServiceDesc, srv)
+}
+
+func _EntityService_GetEntity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetEntityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntityServiceServer).GetEntity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntityService_GetEntity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntityServiceServer).GetEntity(ctx, req.(*GetEntityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntityService_CreateEntity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateEntityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntityServiceServer).CreateEntity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntityService_CreateEntity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntityServiceServer).CreateEntity(ctx, req.(*CreateEntityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntityService_CreateEntities_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EntityServiceServer).CreateEntities(&grpc.GenericServerStream[CreateEntityRequest, CreateEntitiesResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EntityService_CreateEntitiesServer = grpc.ClientStreamingServer[CreateEntityRequest, CreateEntitiesResponse]
+
+func _EntityService_UpdateEntity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateEntityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntityServiceServer).UpdateEntity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntityService_UpdateEntity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntityServiceServer).UpdateEntity(ctx, req.(*UpdateEntityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntityService_DeleteEntity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteEntityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntityServiceServer).DeleteEntity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntityService_DeleteEntity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntityServiceServer).DeleteEntity(ctx, req.(*DeleteEntityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntityService_PatchTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PatchTagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntityServiceServer).PatchTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntityService_PatchTags_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntityServiceServer).PatchTags(ctx, req.(*PatchTagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntityService_ListEntities_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListEntitiesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EntityServiceServer).ListEntities(m, &grpc.GenericServerStream[ListEntitiesRequest, Entity]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EntityService_ListEntitiesServer = grpc.ServerStreamingServer[Entity]
+
+func _EntityService_GetEntityAsOf_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetEntityAsOfRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntityServiceServer).GetEntityAsOf(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntityService_GetEntityAsOf_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntityServiceServer).GetEntityAsOf(ctx, req.(*GetEntityAsOfRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntityService_GetEntityHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetEntityHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntityServiceServer).GetEntityHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntityService_GetEntityHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntityServiceServer).GetEntityHistory(ctx, req.(*GetEntityHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntityService_WatchChanges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchChangesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EntityServiceServer).WatchChanges(m, &grpc.GenericServerStream[WatchChangesRequest, ChangeEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EntityService_WatchChangesServer = grpc.ServerStreamingServer[ChangeEvent]
+
+// EntityService_ServiceDesc is the grpc.ServiceDesc for EntityService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EntityService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "entitydb.v1.EntityService",
+	HandlerType: (*EntityServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetEntity",
+			Handler:    _EntityService_GetEntity_Handler,
+		},
+		{
+			MethodName: "CreateEntity",
+			Handler:    _EntityService_CreateEntity_Handler,
+		},
+		{
+			MethodName: "UpdateEntity",
+			Handler:    _EntityService_UpdateEntity_Handler,
+		},
+		{
+			MethodName: "DeleteEntity",
+			Handler:    _EntityService_DeleteEntity_Handler,
+		},
+		{
+			MethodName: "PatchTags",
+			Handler:    _EntityService_PatchTags_Handler,
+		},
+		{
+			MethodName: "GetEntityAsOf",
+			Handler:    _EntityService_GetEntityAsOf_Handler,
+		},
+		{
+			MethodName: "GetEntityHistory",
+			Handler:    _EntityService_GetEntityHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CreateEntities",
+			Handler:       _EntityService_CreateEntities_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ListEntities",
+			Handler:       _EntityService_ListEntities_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchChanges",
+			Handler:       _EntityService_WatchChanges_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "entitydb.proto",
+}
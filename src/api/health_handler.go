@@ -4,8 +4,12 @@ import (
 	"entitydb/models"
 	"entitydb/config"
 	"entitydb/logger"
+	"entitydb/storage/binary"
+	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"syscall"
 	"time"
 	"runtime"
 )
@@ -15,6 +19,9 @@ type HealthHandler struct {
 	entityRepo *models.RepositoryQueryWrapper
 	config     *config.Config
 	startTime  time.Time
+	shutdown   *ShutdownManager
+	mode       *ServerMode
+	standby    *binary.StandbyVerifier
 }
 
 // NewHealthHandler creates a new health handler
@@ -26,6 +33,45 @@ func NewHealthHandler(entityRepo models.EntityRepository, cfg *config.Config) *H
 	}
 }
 
+// SetShutdownManager makes readiness fail once the server starts draining
+func (h *HealthHandler) SetShutdownManager(shutdown *ShutdownManager) {
+	h.shutdown = shutdown
+}
+
+// SetServerMode reports the server mode in the readiness probe. A read-only
+// server still serves reads, so the check passes.
+func (h *HealthHandler) SetServerMode(mode *ServerMode) {
+	h.mode = mode
+}
+
+// SetStandbyVerifier reports the standby's backup age as replication lag
+func (h *HealthHandler) SetStandbyVerifier(standby *binary.StandbyVerifier) {
+	h.standby = standby
+}
+
+// Probe check statuses
+const (
+	ProbePass = "pass"
+	ProbeFail = "fail"
+	ProbeSkip = "skip"
+)
+
+// ProbeCheck is the outcome of one subsystem check of a probe
+type ProbeCheck struct {
+	Status    string      `json:"status"`
+	Message   string      `json:"message,omitempty"`
+	Observed  interface{} `json:"observed,omitempty"`
+	Threshold interface{} `json:"threshold,omitempty"`
+}
+
+// ProbeResponse is the response of the liveness and readiness probes
+type ProbeResponse struct {
+	Status    string                `json:"status"`
+	Timestamp time.Time             `json:"timestamp"`
+	Uptime    string                `json:"uptime"`
+	Checks    map[string]ProbeCheck `json:"checks"`
+}
+
 // HealthResponse represents the health check response
 type HealthResponse struct {
 	Status      string            `json:"status"`
@@ -140,4 +186,164 @@ func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	RespondJSON(w, statusCode, response)
-}
\ No newline at end of file
+}
+
+// Live reports whether the process is able to serve requests at all. It
+// checks nothing the process could recover from by itself, so a failing
+// dependency never gets the server restarted.
+// @Summary Liveness probe
+// @Description Returns 200 while the process serves HTTP
+// @Tags health
+// @Produce json
+// @Success 200 {object} ProbeResponse
+// @Router /health/live [get]
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	RespondJSON(w, http.StatusOK, ProbeResponse{
+		Status:    "alive",
+		Timestamp: time.Now(),
+		Uptime:    time.Since(h.startTime).String(),
+		Checks: map[string]ProbeCheck{
+			"process": {Status: ProbePass, Observed: map[string]int{"goroutines": runtime.NumGoroutine()}},
+		},
+	})
+}
+
+// Ready reports whether the server should receive traffic: startup has
+// finished loading the indexes, the database answers and is writable, disk
+// and memory are within their thresholds, the standby is not lagging and
+// the server is not draining. Any failing check returns 503.
+// @Summary Readiness probe
+// @Description Per-subsystem readiness checks; 503 when any check fails
+// @Tags health
+// @Produce json
+// @Success 200 {object} ProbeResponse
+// @Failure 503 {object} ProbeResponse
+// @Router /health/ready [get]
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]ProbeCheck{
+		"shutdown":    h.checkShutdown(),
+		"mode":        h.checkMode(),
+		"index":       h.checkIndex(),
+		"database":    h.checkDatabase(),
+		"wal":         h.checkWAL(),
+		"disk":        h.checkDisk(),
+		"memory":      h.checkMemory(),
+		"replication": h.checkReplication(),
+	}
+	
+	status, code := "ready", http.StatusOK
+	for _, check := range checks {
+		if check.Status == ProbeFail {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+	
+	RespondJSON(w, code, ProbeResponse{
+		Status:    status,
+		Timestamp: time.Now(),
+		Uptime:    time.Since(h.startTime).String(),
+		Checks:    checks,
+	})
+}
+
+func (h *HealthHandler) checkShutdown() ProbeCheck {
+	if h.shutdown != nil && h.shutdown.Draining() {
+		return ProbeCheck{Status: ProbeFail, Message: "server is draining for shutdown"}
+	}
+	return ProbeCheck{Status: ProbePass}
+}
+
+func (h *HealthHandler) checkMode() ProbeCheck {
+	if h.mode == nil {
+		return ProbeCheck{Status: ProbeSkip}
+	}
+	status := h.mode.Status()
+	check := ProbeCheck{Status: ProbePass, Observed: status.Mode}
+	if status.Mode == ModeReadOnly {
+		check.Message = "writes are refused while the server is read-only"
+	}
+	return check
+}
+
+// checkIndex passes once startup has loaded the entities and built the
+// indexes
+func (h *HealthHandler) checkIndex() ProbeCheck {
+	startup := binary.GetStartupReport().Snapshot()
+	observed := map[string]interface{}{
+		"entities_loaded": startup.EntitiesLoaded,
+		"index_source":    startup.IndexSource,
+	}
+	if !startup.Complete {
+		return ProbeCheck{Status: ProbeFail, Message: "startup in progress", Observed: observed}
+	}
+	return ProbeCheck{Status: ProbePass, Observed: observed}
+}
+
+func (h *HealthHandler) checkDatabase() ProbeCheck {
+	if _, err := h.entityRepo.Query().Limit(1).Execute(); err != nil {
+		return ProbeCheck{Status: ProbeFail, Message: err.Error()}
+	}
+	return ProbeCheck{Status: ProbePass}
+}
+
+// checkWAL opens the database file, which embeds the write-ahead log, for
+// writing without writing anything
+func (h *HealthHandler) checkWAL() ProbeCheck {
+	file, err := os.OpenFile(h.config.DatabaseFilename, os.O_WRONLY, 0)
+	if err != nil {
+		return ProbeCheck{Status: ProbeFail, Message: err.Error()}
+	}
+	file.Close()
+	return ProbeCheck{Status: ProbePass}
+}
+
+func (h *HealthHandler) checkDisk() ProbeCheck {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(h.config.DatabaseFilename), &stat); err != nil {
+		return ProbeCheck{Status: ProbeFail, Message: err.Error()}
+	}
+	freeMB := int64(stat.Bavail) * int64(stat.Bsize) / (1024 * 1024)
+	check := ProbeCheck{Status: ProbePass, Observed: freeMB, Threshold: h.config.HealthMinFreeDiskMB}
+	if freeMB < int64(h.config.HealthMinFreeDiskMB) {
+		check.Status = ProbeFail
+		check.Message = fmt.Sprintf("%d MB free, below %d MB", freeMB, h.config.HealthMinFreeDiskMB)
+	}
+	return check
+}
+
+func (h *HealthHandler) checkMemory() ProbeCheck {
+	monitor := binary.GetGlobalMemoryMonitor()
+	if monitor == nil {
+		return ProbeCheck{Status: ProbeSkip, Message: "memory monitor not running"}
+	}
+	pressure := monitor.GetCurrentPressure()
+	check := ProbeCheck{Status: ProbePass, Observed: pressure, Threshold: h.config.HealthMaxMemoryPressure}
+	if pressure > h.config.HealthMaxMemoryPressure {
+		check.Status = ProbeFail
+		check.Message = fmt.Sprintf("memory pressure %.2f above %.2f", pressure, h.config.HealthMaxMemoryPressure)
+	}
+	return check
+}
+
+// checkReplication reports the age of the backup the standby verifier last
+// restored, failing above the configured lag
+func (h *HealthHandler) checkReplication() ProbeCheck {
+	if h.standby == nil || !h.standby.IsRunning() {
+		return ProbeCheck{Status: ProbeSkip, Message: "standby verification disabled"}
+	}
+	report := h.standby.LatestReport()
+	if report == nil || report.Backup == nil {
+		return ProbeCheck{Status: ProbeSkip, Message: "no standby verification yet"}
+	}
+	
+	lag := time.Since(report.Backup.TakenAt).Truncate(time.Second)
+	check := ProbeCheck{Status: ProbePass, Message: "standby " + report.Status, Observed: lag.String()}
+	if h.config.HealthMaxReplicationLag > 0 {
+		check.Threshold = h.config.HealthMaxReplicationLag.String()
+		if lag > h.config.HealthMaxReplicationLag {
+			check.Status = ProbeFail
+			check.Message = fmt.Sprintf("standby %s, backup %v old", report.Status, lag)
+		}
+	}
+	return check
+}
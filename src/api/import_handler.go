@@ -0,0 +1,202 @@
+package api
+
+import (
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/services"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unicode/utf8"
+)
+
+// importJobType identifies import runs
+const importJobType = "import"
+
+// ImportHandler stages uploaded files and imports them as background jobs
+// through the import service's format adapters
+type ImportHandler struct {
+	service  *services.ImportService
+	jobs     *JobManager
+	dir      string
+	maxBytes int64
+}
+
+// ImportFormatsResponse lists the import formats
+type ImportFormatsResponse struct {
+	Formats  []string `json:"formats"`
+	MaxBytes int64    `json:"max_bytes"`
+}
+
+// NewImportHandler creates an import handler staging uploads under the
+// data path
+func NewImportHandler(service *services.ImportService, jobs *JobManager, cfg *config.Config) *ImportHandler {
+	return &ImportHandler{
+		service:  service,
+		jobs:     jobs,
+		dir:      filepath.Join(cfg.DataPath, "imports"),
+		maxBytes: cfg.ImportMaxBytes,
+	}
+}
+
+// Start prepares the staging directory. Files left by a previous run are
+// removed, since their jobs are gone.
+func (h *ImportHandler) Start() error {
+	if err := os.MkdirAll(h.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create import directory: %w", err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(h.dir, "import-*"))
+	for _, path := range leftovers {
+		if err := os.Remove(path); err != nil {
+			logger.Warn("Failed to remove stale import %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// ListImportFormats lists the import formats
+// @Summary List import formats
+// @Description List the formats /api/v1/admin/import accepts and the largest file it takes
+// @Tags admin
+// @Produce json
+// @Success 200 {object} ImportFormatsResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/import/formats [get]
+func (h *ImportHandler) ListImportFormats(w http.ResponseWriter, r *http.Request) {
+	RespondJSON(w, http.StatusOK, ImportFormatsResponse{Formats: h.service.Formats(), MaxBytes: h.maxBytes})
+}
+
+// StartImport stages the request body and queues its import
+// @Summary Import a file
+// @Description Create an entity per CSV row, JSONL line or SQLite table row of the request body. Every entity gets the type and dataset given; field maps a column or field, or a JSONPath into a JSONL record, to a tag namespace. Content is the whole record as JSON unless content_field names a field or is "-". With dry_run the records are mapped and validated without creating entities. Progress and the ImportResult, with an error per failed row, are reported by /api/v1/jobs/{id}.
+// @Tags admin
+// @Accept octet-stream
+// @Produce json
+// @Param format query string true "csv, jsonl or sqlite"
+// @Param type query string true "Entity type"
+// @Param dataset query string false "Dataset (default: default)"
+// @Param field query string false "Tag field namespace=field or field; repeatable"
+// @Param tag query string false "Tag added to every entity; repeatable"
+// @Param content_field query string false "Field stored as content; - for none"
+// @Param table query string false "Table of a sqlite import"
+// @Param delimiter query string false "Field separator of a csv import (default ,)"
+// @Param dry_run query bool false "Validate without creating entities"
+// @Param max_errors query int false "Stop after this many failed rows (0 = no limit)"
+// @Success 202 {object} JobStatus
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/import [post]
+func (h *ImportHandler) StartImport(w http.ResponseWriter, r *http.Request) {
+	options, err := importOptionsFromParams(r)
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.service.Validate(options); err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	path, err := h.stage(w, r, options.Format)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		RespondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Import file exceeds %d bytes", h.maxBytes))
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to stage import: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to store import file")
+		return
+	}
+
+	userID := requestUserID(r)
+	job, err := h.jobs.Submit(importJobType, userID, func(job *Job) error {
+		defer os.Remove(path)
+		result, err := h.service.Import(job.Context(), path, options, userID, func(rows int) {
+			job.SetProgress(int64(rows), 0)
+		})
+		if result != nil {
+			job.SetResult(result)
+		}
+		return err
+	})
+	if err != nil {
+		os.Remove(path)
+		RespondError(w, http.StatusServiceUnavailable, "Failed to queue import: "+err.Error())
+		return
+	}
+
+	logger.Info("Import of %s into %s queued as job %s (dry run: %v)",
+		options.Format, options.Mapping.Dataset, job.Status().ID, options.DryRun)
+	RespondJSON(w, http.StatusAccepted, job.Status())
+}
+
+// importOptionsFromParams reads the import options of a request
+func importOptionsFromParams(r *http.Request) (services.ImportOptions, error) {
+	params := r.URL.Query()
+	options := services.ImportOptions{
+		Format: params.Get("format"),
+		Table:  params.Get("table"),
+		DryRun: params.Get("dry_run") == "true",
+		Mapping: services.ImportMapping{
+			EntityType:   params.Get("type"),
+			Dataset:      params.Get("dataset"),
+			Tags:         params["tag"],
+			ContentField: params.Get("content_field"),
+		},
+	}
+	if options.Mapping.Dataset == "" {
+		options.Mapping.Dataset = "default"
+	}
+	for _, spec := range params["field"] {
+		field, err := services.ParseImportTagField(spec)
+		if err != nil {
+			return options, err
+		}
+		options.Mapping.TagFields = append(options.Mapping.TagFields, field)
+	}
+	if value := params.Get("max_errors"); value != "" {
+		maxErrors, err := strconv.Atoi(value)
+		if err != nil {
+			return options, fmt.Errorf("max_errors must be an integer")
+		}
+		options.MaxErrors = maxErrors
+	}
+	if delimiter := params.Get("delimiter"); delimiter != "" {
+		if delimiter == `\t` {
+			delimiter = "\t"
+		}
+		if utf8.RuneCountInString(delimiter) != 1 {
+			return options, fmt.Errorf("delimiter must be a single character")
+		}
+		options.Delimiter, _ = utf8.DecodeRuneInString(delimiter)
+	}
+	return options, nil
+}
+
+// stage writes the request body to a file in the import directory
+func (h *ImportHandler) stage(w http.ResponseWriter, r *http.Request, format string) (string, error) {
+	file, err := os.CreateTemp(h.dir, "import-*."+format)
+	if err != nil {
+		return "", err
+	}
+	body := io.Reader(r.Body)
+	if h.maxBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.maxBytes)
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,553 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// Errors returned by the job manager
+var (
+	ErrJobQueueFull = errors.New("job queue is full")
+	ErrJobFinished  = errors.New("job has already finished")
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobsStopped  = errors.New("job manager is stopped")
+)
+
+// maxJobErrorSamples caps the error messages kept per job; the count is exact
+const maxJobErrorSamples = 100
+
+// jobEntityType tags the entities jobs are persisted as
+const jobEntityType = "type:job"
+
+// jobPersistInterval limits how often the progress of a running job is
+// written to its entity
+const jobPersistInterval = 5 * time.Second
+
+// jobStopTimeout is how long Stop waits for running jobs to honour
+// cancellation
+const jobStopTimeout = 30 * time.Second
+
+// JobStatus is a snapshot of a background job
+type JobStatus struct {
+	ID              string      `json:"id"`
+	Type            string      `json:"type"`
+	Status          string      `json:"status"`
+	Owner           string      `json:"owner,omitempty"`
+	Processed       int64       `json:"processed"`
+	Total           int64       `json:"total"`
+	Percent         float64     `json:"percent"`
+	Errors          int64       `json:"errors"`
+	ErrorLog        []string    `json:"error_log,omitempty"`
+	Message         string      `json:"message,omitempty"`
+	Result          interface{} `json:"result,omitempty"`
+	CancelRequested bool        `json:"cancel_requested,omitempty"`
+	CreatedAt       time.Time   `json:"created_at"`
+	StartedAt       *time.Time  `json:"started_at,omitempty"`
+	FinishedAt      *time.Time  `json:"finished_at,omitempty"`
+	Elapsed         string      `json:"elapsed"`
+	ETA             string      `json:"eta,omitempty"`
+	ETASeconds      float64     `json:"eta_seconds,omitempty"`
+}
+
+// finished reports whether the job has reached a final state
+func (s JobStatus) finished() bool {
+	return s.Status != JobStatusQueued && s.Status != JobStatusRunning
+}
+
+// Job is a background job whose progress is reported through a JobManager
+type Job struct {
+	manager *JobManager
+	fn      func(job *Job) error
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu     sync.Mutex
+	status JobStatus
+
+	persistMu   sync.Mutex
+	persisted   bool
+	persistedAt time.Time
+}
+
+// Context is cancelled when the job is cancelled or the server stops;
+// long-running jobs should check it between items
+func (j *Job) Context() context.Context {
+	return j.ctx
+}
+
+// SetProgress records how many items of the total have been processed
+func (j *Job) SetProgress(processed, total int64) {
+	j.mu.Lock()
+	j.status.Processed = processed
+	j.status.Total = total
+	j.mu.Unlock()
+	j.manager.persistProgress(j)
+}
+
+// SetResult records the result reported once the job completes
+func (j *Job) SetResult(result interface{}) {
+	j.mu.Lock()
+	j.status.Result = result
+	j.mu.Unlock()
+}
+
+// AddError records a non-fatal error
+func (j *Job) AddError(err error) {
+	j.mu.Lock()
+	j.status.Errors++
+	if len(j.status.ErrorLog) < maxJobErrorSamples {
+		j.status.ErrorLog = append(j.status.ErrorLog, err.Error())
+	}
+	j.mu.Unlock()
+}
+
+// begin moves a queued job to running; it reports false when the job was
+// cancelled while queued
+func (j *Job) begin() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.Status != JobStatusQueued {
+		return false
+	}
+	now := time.Now()
+	j.status.Status = JobStatusRunning
+	j.status.StartedAt = &now
+	return true
+}
+
+// finish marks the job completed, or failed when err is set. A job that
+// fails after being cancelled is marked cancelled; one that completes
+// anyway is completed. It reports false when the job had already finished.
+func (j *Job) finish(err error) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.finished() {
+		return false
+	}
+	now := time.Now()
+	j.status.FinishedAt = &now
+	switch {
+	case err != nil && j.ctx.Err() != nil:
+		j.status.Status = JobStatusCancelled
+		j.status.Message = "cancelled"
+		if !errors.Is(err, context.Canceled) {
+			j.status.Message = err.Error()
+		}
+	case err != nil:
+		j.status.Status = JobStatusFailed
+		j.status.Message = err.Error()
+	default:
+		j.status.Status = JobStatusCompleted
+	}
+	close(j.done)
+	return true
+}
+
+// Done returns a channel that is closed when the job has finished
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Status returns a snapshot of the job with percentage and ETA filled in
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	status := j.status
+	status.ErrorLog = append([]string(nil), j.status.ErrorLog...)
+	j.mu.Unlock()
+
+	if status.StartedAt == nil {
+		status.Elapsed = "0s"
+		return status
+	}
+	end := time.Now()
+	if status.FinishedAt != nil {
+		end = *status.FinishedAt
+	}
+	elapsed := end.Sub(*status.StartedAt)
+	status.Elapsed = elapsed.Round(time.Millisecond).String()
+
+	if status.Total > 0 {
+		status.Percent = float64(status.Processed) / float64(status.Total) * 100
+		if status.Status == JobStatusRunning && status.Processed > 0 {
+			remaining := time.Duration(float64(elapsed) / float64(status.Processed) * float64(status.Total-status.Processed))
+			status.ETA = remaining.Round(time.Second).String()
+			status.ETASeconds = remaining.Seconds()
+		}
+	}
+	return status
+}
+
+// JobManager queues background jobs for a pool of workers and keeps their
+// status for polling. Jobs are persisted as type:job entities in the system
+// dataset, so finished jobs survive restarts and jobs interrupted by one are
+// reported as failed.
+type JobManager struct {
+	repo    models.EntityRepository // nil keeps jobs in memory only
+	workers int
+	history int
+	queue   chan *Job
+
+	mu   sync.RWMutex
+	jobs map[string]*Job
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewJobManager creates a job manager running up to workers jobs at once,
+// with up to queueSize jobs waiting and history finished jobs kept
+func NewJobManager(repo models.EntityRepository, workers, queueSize, history int) *JobManager {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	if history <= 0 {
+		history = 50
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JobManager{
+		repo:    repo,
+		workers: workers,
+		history: history,
+		queue:   make(chan *Job, queueSize),
+		jobs:    make(map[string]*Job),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start loads the jobs persisted by previous runs and starts the workers
+func (m *JobManager) Start() error {
+	if err := m.recover(); err != nil {
+		return err
+	}
+	for i := 0; i < m.workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	logger.Info("Job manager started with %d workers", m.workers)
+	return nil
+}
+
+// Stop cancels queued and running jobs and waits for the workers to exit.
+// Jobs still running after jobStopTimeout are reported as interrupted at
+// the next start.
+func (m *JobManager) Stop() error {
+	// Holding m.mu keeps Submit from queueing after the final drain below
+	m.mu.Lock()
+	m.cancel()
+	m.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(jobStopTimeout):
+		logger.Warn("Timed out waiting for running jobs to stop")
+	}
+
+	for {
+		select {
+		case job := <-m.queue:
+			if job.finish(context.Canceled) {
+				m.persist(job)
+			}
+		default:
+			logger.Info("Job manager stopped")
+			return nil
+		}
+	}
+}
+
+// recover loads persisted jobs, marking those a previous run left queued or
+// running as failed
+func (m *JobManager) recover() error {
+	if m.repo == nil {
+		return nil
+	}
+	entities, err := m.repo.ListByTag(jobEntityType)
+	if err != nil {
+		return fmt.Errorf("failed to load jobs: %w", err)
+	}
+
+	var interrupted []*Job
+	m.mu.Lock()
+	for _, entity := range entities {
+		var status JobStatus
+		if err := json.Unmarshal(entity.Content, &status); err != nil || status.ID == "" {
+			logger.Warn("Skipping unreadable job entity %s: %v", entity.ID, err)
+			continue
+		}
+		job := &Job{manager: m, status: status, done: make(chan struct{}), persisted: true}
+		job.ctx, job.cancel = context.WithCancel(m.ctx)
+		if !status.finished() {
+			now := time.Now()
+			job.status.Status = JobStatusFailed
+			job.status.Message = "interrupted by server restart"
+			job.status.FinishedAt = &now
+			interrupted = append(interrupted, job)
+		}
+		job.cancel()
+		close(job.done)
+		m.jobs[status.ID] = job
+	}
+	pruned := m.pruneLocked()
+	m.mu.Unlock()
+
+	for _, job := range interrupted {
+		m.persist(job)
+	}
+	m.deleteEntities(pruned)
+	if len(interrupted) > 0 {
+		logger.Warn("Marked %d jobs interrupted by the last shutdown as failed", len(interrupted))
+	}
+	return nil
+}
+
+func (m *JobManager) worker() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case job := <-m.queue:
+			m.run(job)
+		}
+	}
+}
+
+// run executes a queued job unless it was cancelled while waiting
+func (m *JobManager) run(job *Job) {
+	if job.ctx.Err() != nil {
+		// Cancelled or shutting down before a worker was free
+		if job.finish(context.Canceled) {
+			m.persist(job)
+		}
+		return
+	}
+	if !job.begin() {
+		return
+	}
+	m.persist(job)
+
+	var err error
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+		job.finish(err)
+		m.persist(job)
+		job.cancel()
+	}()
+	err = job.fn(job)
+}
+
+// Submit queues fn as a job of the given type started by owner (a user ID,
+// or empty for the server). It fails with ErrJobQueueFull when no more jobs
+// may wait.
+func (m *JobManager) Submit(jobType, owner string, fn func(job *Job) error) (*Job, error) {
+	job := &Job{
+		manager: m,
+		fn:      fn,
+		status: JobStatus{
+			ID:        models.GenerateUUID(),
+			Type:      jobType,
+			Status:    JobStatusQueued,
+			Owner:     owner,
+			CreatedAt: time.Now(),
+		},
+		done: make(chan struct{}),
+	}
+	job.ctx, job.cancel = context.WithCancel(m.ctx)
+
+	// Only Submit sends to the queue, and it holds m.mu, so the send below
+	// cannot block once the length check passed
+	m.mu.Lock()
+	if m.ctx.Err() != nil {
+		m.mu.Unlock()
+		job.cancel()
+		return nil, ErrJobsStopped
+	}
+	if len(m.queue) >= cap(m.queue) {
+		m.mu.Unlock()
+		job.cancel()
+		return nil, ErrJobQueueFull
+	}
+	m.persist(job)
+	m.jobs[job.status.ID] = job
+	pruned := m.pruneLocked()
+	m.queue <- job
+	m.mu.Unlock()
+
+	m.deleteEntities(pruned)
+	logger.Debug("Queued %s job %s", jobType, job.status.ID)
+	return job, nil
+}
+
+// Cancel cancels a queued or running job. A queued job is finished at once;
+// a running job stops when it notices its context was cancelled, and jobs
+// that cannot be interrupted run to completion.
+func (m *JobManager) Cancel(id string) (*Job, error) {
+	job, ok := m.Get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if job.Status().finished() {
+		return job, ErrJobFinished
+	}
+	job.mu.Lock()
+	job.status.CancelRequested = true
+	job.mu.Unlock()
+	job.cancel()
+	// A job still waiting in the queue will be skipped by the workers
+	if job.Status().Status == JobStatusQueued && job.finish(context.Canceled) {
+		m.persist(job)
+	}
+	return job, nil
+}
+
+// Get returns the job with the given ID
+func (m *JobManager) Get(id string) (*Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// Active returns the queued or running job of the given type, if any
+func (m *JobManager) Active(jobType string) (*Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, job := range m.jobs {
+		status := job.Status()
+		if status.Type == jobType && !status.finished() {
+			return job, true
+		}
+	}
+	return nil, false
+}
+
+// List returns snapshots of all known jobs, newest first
+func (m *JobManager) List() []JobStatus {
+	m.mu.RLock()
+	statuses := make([]JobStatus, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		statuses = append(statuses, job.Status())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].CreatedAt.After(statuses[j].CreatedAt)
+	})
+	return statuses
+}
+
+// pruneLocked drops the oldest finished jobs beyond the history limit and
+// returns their IDs; m.mu must be held
+func (m *JobManager) pruneLocked() []string {
+	var finished []JobStatus
+	for _, job := range m.jobs {
+		if status := job.Status(); status.finished() {
+			finished = append(finished, status)
+		}
+	}
+	if len(finished) <= m.history {
+		return nil
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].CreatedAt.Before(finished[j].CreatedAt)
+	})
+	var pruned []string
+	for _, status := range finished[:len(finished)-m.history] {
+		delete(m.jobs, status.ID)
+		pruned = append(pruned, status.ID)
+	}
+	return pruned
+}
+
+// persistProgress writes a running job's progress at most every
+// jobPersistInterval
+func (m *JobManager) persistProgress(job *Job) {
+	job.persistMu.Lock()
+	due := time.Since(job.persistedAt) >= jobPersistInterval
+	job.persistMu.Unlock()
+	if due {
+		m.persist(job)
+	}
+}
+
+// persist writes the job's status to its entity
+func (m *JobManager) persist(job *Job) {
+	if m.repo == nil {
+		return
+	}
+	job.persistMu.Lock()
+	defer job.persistMu.Unlock()
+
+	status := job.Status()
+	content, err := json.Marshal(status)
+	if err != nil {
+		logger.Error("Failed to encode job %s: %v", status.ID, err)
+		return
+	}
+	entity := &models.Entity{ID: status.ID, Content: content, CreatedAt: status.CreatedAt.UnixNano()}
+	for _, tag := range []string{
+		jobEntityType,
+		"dataset:system",
+		"content:type:application/json",
+		"job:type:" + status.Type,
+		"job:status:" + status.Status,
+	} {
+		entity.AddTag(tag)
+	}
+	if status.Owner != "" {
+		entity.AddTag("job:owner:" + status.Owner)
+	}
+
+	if job.persisted {
+		err = m.repo.Update(entity)
+	} else {
+		err = m.repo.Create(entity)
+	}
+	if err != nil {
+		logger.Error("Failed to persist %s job %s: %v", status.Type, status.ID, err)
+		return
+	}
+	job.persisted = true
+	job.persistedAt = time.Now()
+}
+
+// deleteEntities removes the entities of pruned jobs
+func (m *JobManager) deleteEntities(ids []string) {
+	if m.repo == nil {
+		return
+	}
+	for _, id := range ids {
+		if err := m.repo.Delete(id); err != nil {
+			logger.Warn("Failed to delete job entity %s: %v", id, err)
+		}
+	}
+}
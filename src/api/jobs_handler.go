@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// JobsHandler exposes the background jobs of the job manager
+type JobsHandler struct {
+	jobs *JobManager
+}
+
+// NewJobsHandler creates a new jobs handler
+func NewJobsHandler(jobs *JobManager) *JobsHandler {
+	return &JobsHandler{jobs: jobs}
+}
+
+// requestUserID returns the ID of the request's user, or "" when
+// unauthenticated
+func requestUserID(r *http.Request) string {
+	if user := requestUser(r); user != nil {
+		return user.ID
+	}
+	return ""
+}
+
+// ListJobs lists queued, running and recently finished jobs
+// @Summary List jobs
+// @Description List background jobs (reindex, export, retention), newest first
+// @Tags admin
+// @Produce json
+// @Param type query string false "Only jobs of this type"
+// @Param status query string false "Only jobs in this state: queued, running, completed, failed or cancelled"
+// @Success 200 {array} JobStatus
+// @Security BearerAuth
+// @Router /api/v1/jobs [get]
+func (h *JobsHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	jobType := r.URL.Query().Get("type")
+	state := r.URL.Query().Get("status")
+
+	statuses := h.jobs.List()
+	if jobType != "" || state != "" {
+		filtered := statuses[:0]
+		for _, status := range statuses {
+			if (jobType == "" || status.Type == jobType) && (state == "" || status.Status == state) {
+				filtered = append(filtered, status)
+			}
+		}
+		statuses = filtered
+	}
+	RespondJSON(w, http.StatusOK, statuses)
+}
+
+// GetJob reports the progress and result of a job
+// @Summary Get job status
+// @Description Report the state, progress, errors and result of a background job
+// @Tags admin
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} JobStatus
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/jobs/{id} [get]
+func (h *JobsHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.jobs.Get(mux.Vars(r)["id"])
+	if !ok {
+		RespondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	RespondJSON(w, http.StatusOK, job.Status())
+}
+
+// CancelJob cancels a queued or running job
+// @Summary Cancel job
+// @Description Cancel a queued job, or ask a running one to stop. Exports stop promptly; reindex and retention runs cannot be interrupted once running and complete with cancel_requested set.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} JobStatus
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/jobs/{id}/cancel [post]
+func (h *JobsHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Cancel(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		RespondError(w, http.StatusNotFound, "Job not found")
+	case errors.Is(err, ErrJobFinished):
+		RespondError(w, http.StatusConflict, "Job is already "+job.Status().Status)
+	default:
+		RespondJSON(w, http.StatusOK, job.Status())
+	}
+}
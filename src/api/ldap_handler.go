@@ -0,0 +1,81 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/services"
+	"net/http"
+)
+
+// LDAPHandler exposes LDAP directory synchronization status and manual runs
+type LDAPHandler struct {
+	service *services.LDAPSyncService // nil when LDAP sync is disabled
+}
+
+// NewLDAPHandler creates a new LDAP handler
+func NewLDAPHandler(service *services.LDAPSyncService) *LDAPHandler {
+	return &LDAPHandler{service: service}
+}
+
+// LDAPStatusResponse describes the directory synchronization and its last run
+type LDAPStatusResponse struct {
+	Enabled        bool                     `json:"enabled"`
+	URL            string                   `json:"url,omitempty"`
+	UserBaseDN     string                   `json:"user_base_dn,omitempty"`
+	GroupBaseDN    string                   `json:"group_base_dn,omitempty"`
+	Interval       string                   `json:"interval,omitempty"`
+	Deprovision    bool                     `json:"deprovision"`
+	LinkLocalUsers bool                     `json:"link_local_users"`
+	MappedGroups   int                      `json:"mapped_groups"`
+	LastResult     *services.LDAPSyncResult `json:"last_result,omitempty"`
+}
+
+// GetLDAPStatus reports the directory synchronization settings and last run
+// @Summary Get LDAP sync status
+// @Description Report whether LDAP directory synchronization is enabled, its settings (without credentials) and the result of the last run
+// @Tags admin
+// @Produce json
+// @Success 200 {object} LDAPStatusResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/ldap [get]
+func (h *LDAPHandler) GetLDAPStatus(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		RespondJSON(w, http.StatusOK, LDAPStatusResponse{})
+		return
+	}
+	config := h.service.Config()
+	RespondJSON(w, http.StatusOK, LDAPStatusResponse{
+		Enabled:        true,
+		URL:            config.URL,
+		UserBaseDN:     config.UserBaseDN,
+		GroupBaseDN:    config.GroupBaseDN,
+		Interval:       config.Interval.String(),
+		Deprovision:    config.Deprovision,
+		LinkLocalUsers: config.LinkLocalUsers,
+		MappedGroups:   len(config.GroupRoles),
+		LastResult:     h.service.LastResult(),
+	})
+}
+
+// RunLDAPSync synchronizes the directory immediately
+// @Summary Run LDAP sync
+// @Description Import users and group memberships from the directory now. Conflicts with local users and per-user errors are reported in the result.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} services.LDAPSyncResult
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/ldap/sync [post]
+func (h *LDAPHandler) RunLDAPSync(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		RespondError(w, http.StatusNotFound, "LDAP sync is not enabled")
+		return
+	}
+	result, err := h.service.RunOnce()
+	if err != nil && result.DirectoryUsers == 0 {
+		logger.Error("LDAP sync failed: %v", err)
+		RespondError(w, http.StatusBadGateway, "LDAP sync failed: "+err.Error())
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
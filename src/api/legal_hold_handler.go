@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// LegalHoldHandler places and lifts legal holds on entities
+type LegalHoldHandler struct {
+	repo models.EntityRepository
+}
+
+// NewLegalHoldHandler creates a new legal hold handler
+func NewLegalHoldHandler(repo models.EntityRepository) *LegalHoldHandler {
+	return &LegalHoldHandler{repo: repo}
+}
+
+// LegalHoldRequest places a legal hold
+type LegalHoldRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// GetLegalHold reports whether an entity is under legal hold
+// @Summary Get legal hold
+// @Description Report whether an entity is under legal hold, who placed the hold and why
+// @Tags entities
+// @Produce json
+// @Param id path string true "Entity ID"
+// @Success 200 {object} models.LegalHold
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/{id}/legal-hold [get]
+func (h *LegalHoldHandler) GetLegalHold(w http.ResponseWriter, r *http.Request) {
+	entity := h.entity(w, r)
+	if entity == nil {
+		return
+	}
+	RespondJSON(w, http.StatusOK, models.ParseLegalHold(entity))
+}
+
+// PlaceLegalHold places a legal hold on an entity
+// @Summary Place legal hold
+// @Description Place a legal hold on an entity. While held the entity cannot be updated, tagged, soft-deleted or purged, and retention does not prune its history. Placing a hold on a held entity replaces its reason. Requires entity:legal_hold.
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param id path string true "Entity ID"
+// @Param request body LegalHoldRequest false "Reason for the hold"
+// @Success 200 {object} models.LegalHold
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/{id}/legal-hold [post]
+func (h *LegalHoldHandler) PlaceLegalHold(w http.ResponseWriter, r *http.Request) {
+	var req LegalHoldRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	entity := h.entity(w, r)
+	if entity == nil {
+		return
+	}
+
+	tags := []string{models.LegalHoldTag, models.LegalHoldByTagPrefix + requestUserID(r)}
+	if req.Reason != "" {
+		tags = append(tags, models.LegalHoldReasonTagPrefix+req.Reason)
+	}
+	h.update(w, r, entity, tags, "placed")
+}
+
+// LiftLegalHold lifts the legal hold on an entity
+// @Summary Lift legal hold
+// @Description Lift the legal hold on an entity, making it writable again. Lifting the hold of an entity that is not held does nothing. Requires entity:legal_hold.
+// @Tags entities
+// @Produce json
+// @Param id path string true "Entity ID"
+// @Success 200 {object} models.LegalHold
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/{id}/legal-hold [delete]
+func (h *LegalHoldHandler) LiftLegalHold(w http.ResponseWriter, r *http.Request) {
+	entity := h.entity(w, r)
+	if entity == nil {
+		return
+	}
+	if !models.ParseLegalHold(entity).Held {
+		RespondJSON(w, http.StatusOK, models.LegalHold{EntityID: entity.ID})
+		return
+	}
+	h.update(w, r, entity, nil, "lifted")
+}
+
+// entity loads the entity named in the path, responding when the request's
+// user cannot see or change it
+func (h *LegalHoldHandler) entity(w http.ResponseWriter, r *http.Request) *models.Entity {
+	entity, err := repoGetByID(r.Context(), h.repo, mux.Vars(r)["id"])
+	if err != nil || outsidePathDataset(r, entity) || !canAccessEntity(r, entity, models.ACLRead) {
+		RespondError(w, http.StatusNotFound, "Entity not found")
+		return nil
+	}
+	if r.Method != http.MethodGet && hiddenOrReadOnly(w, r, entity) {
+		return nil
+	}
+	return entity
+}
+
+// update replaces the legal hold tags of an entity with tags
+func (h *LegalHoldHandler) update(w http.ResponseWriter, r *http.Request, entity *models.Entity, tags []string, verb string) {
+	kept := make([]string, 0, len(entity.Tags)+len(tags))
+	for _, tag := range entity.Tags {
+		if !models.IsLegalHoldTag(tag) {
+			kept = append(kept, tag)
+		}
+	}
+
+	updated := entity.WithTags(kept)
+	for _, tag := range tags {
+		updated.AddTag(tag)
+	}
+
+	if err := repoUpdate(binary.WithLegalHoldChange(r.Context()), h.repo, updated); err != nil {
+		if immutableRefused(w, err) {
+			return
+		}
+		logger.Error("Failed to change legal hold of entity %s: %v", entity.ID, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to change legal hold")
+		return
+	}
+	logger.Info("Legal hold %s on entity %s by %s", verb, entity.ID, requestUserID(r))
+	RespondJSON(w, http.StatusOK, models.ParseLegalHold(updated))
+}
@@ -30,6 +30,7 @@ type SetTraceSubsystemsRequest struct {
 // LogStatusResponse represents the current logging configuration
 type LogStatusResponse struct {
 	Level       string   `json:"level"`
+	Format      string   `json:"format"`
 	Subsystems  []string `json:"subsystems"`
 }
 
@@ -73,6 +74,7 @@ func (h *LogControlHandler) SetLogLevel(w http.ResponseWriter, r *http.Request)
 func (h *LogControlHandler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
 	RespondJSON(w, http.StatusOK, LogStatusResponse{
 		Level:      logger.GetLogLevel(),
+		Format:     logger.GetFormat(),
 		Subsystems: logger.GetTraceSubsystems(),
 	})
 }
@@ -130,6 +132,7 @@ func (h *LogControlHandler) SetTraceSubsystems(w http.ResponseWriter, r *http.Re
 func (h *LogControlHandler) GetTraceSubsystems(w http.ResponseWriter, r *http.Request) {
 	RespondJSON(w, http.StatusOK, LogStatusResponse{
 		Level:      logger.GetLogLevel(),
+		Format:     logger.GetFormat(),
 		Subsystems: logger.GetTraceSubsystems(),
 	})
 }
\ No newline at end of file
@@ -4,6 +4,8 @@ import (
 	"entitydb/models"
 	"entitydb/config"
 	"entitydb/logger"
+	"entitydb/services"
+	"entitydb/storage/binary"
 	"fmt"
 	"net/http"
 	"os"
@@ -17,6 +19,9 @@ type MetricsHandler struct {
 	entityRepo *models.RepositoryQueryWrapper
 	config     *config.Config
 	startTime  time.Time
+	retention  *services.RetentionService
+	scheduler  *services.SchedulerService
+	snapshots  *binary.SnapshotScheduler
 }
 
 // NewMetricsHandler creates a new metrics handler
@@ -28,6 +33,21 @@ func NewMetricsHandler(entityRepo models.EntityRepository, cfg *config.Config) *
 	}
 }
 
+// SetRetentionService includes the retention service's counters in the metrics
+func (h *MetricsHandler) SetRetentionService(service *services.RetentionService) {
+	h.retention = service
+}
+
+// SetSchedulerService includes the scheduler's counters in the metrics
+func (h *MetricsHandler) SetSchedulerService(service *services.SchedulerService) {
+	h.scheduler = service
+}
+
+// SetSnapshotScheduler includes the snapshot scheduler's counters in the metrics
+func (h *MetricsHandler) SetSnapshotScheduler(scheduler *binary.SnapshotScheduler) {
+	h.snapshots = scheduler
+}
+
 // PrometheusMetrics returns Prometheus-compatible metrics
 // @Summary Prometheus metrics
 // @Description Get system metrics in Prometheus format
@@ -142,6 +162,340 @@ func (h *MetricsHandler) PrometheusMetrics(w http.ResponseWriter, r *http.Reques
 	metrics.WriteString(fmt.Sprintf("entitydb_wal_size_bytes %d\n", walSize))
 	metrics.WriteString("\n")
 	
+	// Entity cache occupancy per cache layer
+	type entityCacheLayer struct {
+		name  string
+		stats binary.CacheStats
+	}
+	var entityCaches []entityCacheLayer
+	if cachedRepo, ok := h.entityRepo.EntityRepository.(*binary.CachedRepository); ok {
+		entityCaches = append(entityCaches, entityCacheLayer{"query", cachedRepo.EntityCacheStats()})
+	}
+	if binaryRepo, err := asTemporalRepository(h.entityRepo.EntityRepository); err == nil {
+		entityCaches = append(entityCaches, entityCacheLayer{"storage", binaryRepo.EntityCacheStats()})
+	}
+	if len(entityCaches) > 0 {
+		metrics.WriteString("# HELP entitydb_entity_cache_entries Entities held by the entity cache\n")
+		metrics.WriteString("# TYPE entitydb_entity_cache_entries gauge\n")
+		for _, layer := range entityCaches {
+			metrics.WriteString(fmt.Sprintf("entitydb_entity_cache_entries{cache=\"%s\"} %d\n", layer.name, layer.stats.Size))
+		}
+		metrics.WriteString("\n")
+		metrics.WriteString("# HELP entitydb_entity_cache_bytes Estimated memory used by the entity cache\n")
+		metrics.WriteString("# TYPE entitydb_entity_cache_bytes gauge\n")
+		for _, layer := range entityCaches {
+			metrics.WriteString(fmt.Sprintf("entitydb_entity_cache_bytes{cache=\"%s\"} %d\n", layer.name, layer.stats.MemoryUsed))
+		}
+		metrics.WriteString("\n")
+		metrics.WriteString("# HELP entitydb_entity_cache_evictions_total Entities evicted from the entity cache\n")
+		metrics.WriteString("# TYPE entitydb_entity_cache_evictions_total counter\n")
+		for _, layer := range entityCaches {
+			metrics.WriteString(fmt.Sprintf("entitydb_entity_cache_evictions_total{cache=\"%s\"} %d\n", layer.name, layer.stats.Evictions))
+		}
+		metrics.WriteString("\n")
+	}
+	if binaryRepo, err := asTemporalRepository(h.entityRepo.EntityRepository); err == nil {
+		pinned := binaryRepo.PinnedEntities()
+		metrics.WriteString("# HELP entitydb_entity_cache_pinned_entries Entities pinned in memory\n")
+		metrics.WriteString("# TYPE entitydb_entity_cache_pinned_entries gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_entity_cache_pinned_entries %d\n", pinned.Entities))
+		metrics.WriteString("\n")
+		metrics.WriteString("# HELP entitydb_entity_cache_pinned_bytes Estimated memory used by pinned entities\n")
+		metrics.WriteString("# TYPE entitydb_entity_cache_pinned_bytes gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_entity_cache_pinned_bytes %d\n", pinned.MemoryUsed))
+		metrics.WriteString("\n")
+	}
+	
+	// Index rebuild throughput (most recent startup or reindex)
+	if binaryRepo, err := asTemporalRepository(h.entityRepo.EntityRepository); err == nil {
+		rebuild := binaryRepo.GetIndexRebuildStats()
+		
+		metrics.WriteString("# HELP entitydb_index_rebuild_duration_seconds Duration of the last index rebuild\n")
+		metrics.WriteString("# TYPE entitydb_index_rebuild_duration_seconds gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_index_rebuild_duration_seconds %.3f\n", rebuild.Duration.Seconds()))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_index_rebuild_entities Entities indexed by the last index rebuild\n")
+		metrics.WriteString("# TYPE entitydb_index_rebuild_entities gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_index_rebuild_entities %d\n", rebuild.Entities))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_index_rebuild_entities_per_second Throughput of the last index rebuild in entities per second\n")
+		metrics.WriteString("# TYPE entitydb_index_rebuild_entities_per_second gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_index_rebuild_entities_per_second %.2f\n", rebuild.EntitiesPerSec))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_index_rebuild_bytes_per_second Throughput of the last index rebuild in bytes per second\n")
+		metrics.WriteString("# TYPE entitydb_index_rebuild_bytes_per_second gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_index_rebuild_bytes_per_second %.2f\n", rebuild.BytesPerSec))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_index_rebuild_throttled_seconds Time the last index rebuild spent waiting on the I/O rate limit\n")
+		metrics.WriteString("# TYPE entitydb_index_rebuild_throttled_seconds gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_index_rebuild_throttled_seconds %.3f\n", rebuild.ThrottledFor.Seconds()))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_index_rebuild_workers Workers used by the last index rebuild\n")
+		metrics.WriteString("# TYPE entitydb_index_rebuild_workers gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_index_rebuild_workers %d\n", rebuild.Workers))
+		metrics.WriteString("\n")
+
+		contentPaths := binaryRepo.ContentPathIndexStats()
+		metrics.WriteString("# HELP entitydb_content_path_index_values Values held by the JSON content path index\n")
+		metrics.WriteString("# TYPE entitydb_content_path_index_values gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_content_path_index_values %d\n", contentPaths.Values))
+		metrics.WriteString("\n")
+		
+		indexMemory := binaryRepo.IndexMemoryStats()
+		metrics.WriteString("# HELP entitydb_index_memory_bytes Approximate memory held by each in-memory index\n")
+		metrics.WriteString("# TYPE entitydb_index_memory_bytes gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_index_memory_bytes{index=\"tag\"} %d\n", indexMemory.TagIndexBytes))
+		metrics.WriteString(fmt.Sprintf("entitydb_index_memory_bytes{index=\"tag_value\"} %d\n", indexMemory.TagValueIndexBytes))
+		metrics.WriteString(fmt.Sprintf("entitydb_index_memory_bytes{index=\"adjacency\"} %d\n", indexMemory.AdjacencyIndexBytes))
+		metrics.WriteString(fmt.Sprintf("entitydb_index_memory_bytes{index=\"variant\"} %d\n", indexMemory.VariantCacheBytes))
+		metrics.WriteString(fmt.Sprintf("entitydb_index_memory_bytes{index=\"temporal\"} %d\n", indexMemory.TemporalIndexBytes))
+		metrics.WriteString(fmt.Sprintf("entitydb_index_memory_bytes{index=\"namespace\"} %d\n", indexMemory.NamespaceIndexBytes))
+		metrics.WriteString("\n")
+		
+		if spill := indexMemory.TagIndexSpill; spill != nil {
+			metrics.WriteString("# HELP entitydb_tag_index_spilled_tags Tags whose posting lists are spilled to disk\n")
+			metrics.WriteString("# TYPE entitydb_tag_index_spilled_tags gauge\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_tag_index_spilled_tags %d\n", spill.SpilledTags))
+			metrics.WriteString("# HELP entitydb_tag_index_spilled_bytes Memory freed by spilling tag posting lists\n")
+			metrics.WriteString("# TYPE entitydb_tag_index_spilled_bytes gauge\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_tag_index_spilled_bytes %d\n", spill.SpilledBytes))
+			metrics.WriteString("# HELP entitydb_tag_index_spill_loads_total Spilled posting lists loaded back into memory\n")
+			metrics.WriteString("# TYPE entitydb_tag_index_spill_loads_total counter\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_tag_index_spill_loads_total %d\n", spill.Loads))
+			metrics.WriteString("\n")
+		}
+	}
+	
+	// Lock, reader pool and writer contention
+	if binaryRepo, err := asTemporalRepository(h.entityRepo.EntityRepository); err == nil {
+		contention := binaryRepo.ContentionStats()
+		locks := contention.Locks
+		
+		metrics.WriteString("# HELP entitydb_entity_locks_held Entity locks currently held\n")
+		metrics.WriteString("# TYPE entitydb_entity_locks_held gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_entity_locks_held %d\n", locks.HeldEntityLocks))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_entity_locks_tracked Entities with a lock allocated\n")
+		metrics.WriteString("# TYPE entitydb_entity_locks_tracked gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_entity_locks_tracked %d\n", locks.TrackedEntityLocks))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_lock_acquisitions_total Locks acquired by mode\n")
+		metrics.WriteString("# TYPE entitydb_lock_acquisitions_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_lock_acquisitions_total{mode=\"read\"} %d\n", locks.ReadLocks))
+		metrics.WriteString(fmt.Sprintf("entitydb_lock_acquisitions_total{mode=\"write\"} %d\n", locks.WriteLocks))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_lock_contentions_total Lock acquisitions that waited for another holder\n")
+		metrics.WriteString("# TYPE entitydb_lock_contentions_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_lock_contentions_total %d\n", locks.Contentions))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_lock_wait_seconds_total Time spent waiting to acquire locks\n")
+		metrics.WriteString("# TYPE entitydb_lock_wait_seconds_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_lock_wait_seconds_total %.6f\n", locks.WaitTime.Seconds()))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_lock_wait_average_seconds Mean time a lock acquisition waited\n")
+		metrics.WriteString("# TYPE entitydb_lock_wait_average_seconds gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_lock_wait_average_seconds %.6f\n", locks.AverageWait().Seconds()))
+		metrics.WriteString("\n")
+		
+		pool := contention.ReaderPool
+		metrics.WriteString("# HELP entitydb_reader_pool_readers Readers open in the reader pool by state\n")
+		metrics.WriteString("# TYPE entitydb_reader_pool_readers gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_reader_pool_readers{state=\"idle\"} %d\n", pool.Available))
+		metrics.WriteString(fmt.Sprintf("entitydb_reader_pool_readers{state=\"borrowed\"} %d\n", max(pool.Open-pool.Available, 0)))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_reader_pool_max_readers Readers the reader pool may open\n")
+		metrics.WriteString("# TYPE entitydb_reader_pool_max_readers gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_reader_pool_max_readers %d\n", pool.MaxSize))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_reader_pool_borrows_total Reader borrows by outcome\n")
+		metrics.WriteString("# TYPE entitydb_reader_pool_borrows_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_reader_pool_borrows_total{outcome=\"hit\"} %d\n", pool.Hits))
+		metrics.WriteString(fmt.Sprintf("entitydb_reader_pool_borrows_total{outcome=\"miss\"} %d\n", pool.Misses))
+		metrics.WriteString(fmt.Sprintf("entitydb_reader_pool_borrows_total{outcome=\"timeout\"} %d\n", pool.Timeouts))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_reader_pool_hit_ratio Fraction of reader borrows served by an idle reader\n")
+		metrics.WriteString("# TYPE entitydb_reader_pool_hit_ratio gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_reader_pool_hit_ratio %.4f\n", pool.HitRatio()))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_writer_queue_depth Writes in progress or waiting for the writer\n")
+		metrics.WriteString("# TYPE entitydb_writer_queue_depth gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_writer_queue_depth %d\n", contention.WriterQueueDepth))
+		metrics.WriteString("\n")
+		
+		if contention.WriteQueueEnabled {
+			metrics.WriteString("# HELP entitydb_single_writer_queue_depth Operations waiting in the single writer queue\n")
+			metrics.WriteString("# TYPE entitydb_single_writer_queue_depth gauge\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_single_writer_queue_depth %d\n", contention.WriteQueueDepth))
+			metrics.WriteString("\n")
+		}
+		
+		// Change data capture
+		if cdc, ok := binaryRepo.GetCDCStats(); ok {
+			metrics.WriteString("# HELP entitydb_cdc_pending_operations Committed operations not yet acknowledged by the CDC broker\n")
+			metrics.WriteString("# TYPE entitydb_cdc_pending_operations gauge\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_cdc_pending_operations %d\n", cdc.Pending))
+			metrics.WriteString("\n")
+			
+			metrics.WriteString("# HELP entitydb_cdc_acked_sequence Sequence of the last operation acknowledged by the CDC broker\n")
+			metrics.WriteString("# TYPE entitydb_cdc_acked_sequence gauge\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_cdc_acked_sequence %d\n", cdc.AckedSequence))
+			metrics.WriteString("\n")
+			
+			metrics.WriteString("# HELP entitydb_cdc_outbox_bytes Size of the CDC outbox\n")
+			metrics.WriteString("# TYPE entitydb_cdc_outbox_bytes gauge\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_cdc_outbox_bytes %d\n", cdc.OutboxBytes))
+			metrics.WriteString("\n")
+			
+			metrics.WriteString("# HELP entitydb_cdc_published_total Operations published to the CDC broker\n")
+			metrics.WriteString("# TYPE entitydb_cdc_published_total counter\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_cdc_published_total %d\n", cdc.Published))
+			metrics.WriteString("\n")
+			
+			metrics.WriteString("# HELP entitydb_cdc_publish_failures_total Failed CDC batch publishes\n")
+			metrics.WriteString("# TYPE entitydb_cdc_publish_failures_total counter\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_cdc_publish_failures_total %d\n", cdc.Failures))
+			metrics.WriteString("\n")
+		}
+	}
+	
+	// Query admission metrics
+	if admission := GetQueryAdmission(); admission != nil {
+		stats := admission.Stats()
+		
+		metrics.WriteString("# HELP entitydb_query_admission_total Query admission decisions by outcome\n")
+		metrics.WriteString("# TYPE entitydb_query_admission_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_query_admission_total{outcome=\"admitted\"} %d\n", stats.Admitted))
+		metrics.WriteString(fmt.Sprintf("entitydb_query_admission_total{outcome=\"queued\"} %d\n", stats.Queued))
+		metrics.WriteString(fmt.Sprintf("entitydb_query_admission_total{outcome=\"rejected\"} %d\n", stats.Rejected))
+		metrics.WriteString("\n")
+	}
+	
+	// Retention service metrics
+	if h.retention != nil {
+		stats := h.retention.GetStats()
+		
+		metrics.WriteString("# HELP entitydb_retention_runs_total Retention cycles run\n")
+		metrics.WriteString("# TYPE entitydb_retention_runs_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_retention_runs_total %d\n", stats.TotalRuns))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_retention_policies Retention policies currently applied\n")
+		metrics.WriteString("# TYPE entitydb_retention_policies gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_retention_policies{state=\"valid\"} %d\n", stats.Policies))
+		metrics.WriteString(fmt.Sprintf("entitydb_retention_policies{state=\"invalid\"} %d\n", stats.InvalidPolicies))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_retention_entities_pruned_total Entities whose temporal tags were pruned\n")
+		metrics.WriteString("# TYPE entitydb_retention_entities_pruned_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_retention_entities_pruned_total %d\n", stats.EntitiesPruned))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_retention_tags_pruned_total Temporal tag values pruned by retention policy\n")
+		metrics.WriteString("# TYPE entitydb_retention_tags_pruned_total counter\n")
+		for policyID, count := range stats.TagsPrunedByPolicy {
+			metrics.WriteString(fmt.Sprintf("entitydb_retention_tags_pruned_total{policy=\"%s\"} %d\n", policyID, count))
+		}
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_retention_tags_would_prune_total Temporal tag values dry runs would have pruned\n")
+		metrics.WriteString("# TYPE entitydb_retention_tags_would_prune_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_retention_tags_would_prune_total %d\n", stats.TagsWouldPrune))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_retention_errors_total Entities retention failed to update\n")
+		metrics.WriteString("# TYPE entitydb_retention_errors_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_retention_errors_total %d\n", stats.Errors))
+		metrics.WriteString("\n")
+	}
+	
+	// Scheduler metrics
+	if h.scheduler != nil {
+		stats := h.scheduler.GetStats()
+		
+		metrics.WriteString("# HELP entitydb_scheduler_schedules Schedule entities known to the scheduler\n")
+		metrics.WriteString("# TYPE entitydb_scheduler_schedules gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_scheduler_schedules{state=\"valid\"} %d\n", stats.Schedules))
+		metrics.WriteString(fmt.Sprintf("entitydb_scheduler_schedules{state=\"invalid\"} %d\n", stats.InvalidSchedules))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_scheduler_runs_total Scheduled runs by outcome\n")
+		metrics.WriteString("# TYPE entitydb_scheduler_runs_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_scheduler_runs_total{status=\"succeeded\"} %d\n", stats.Succeeded))
+		metrics.WriteString(fmt.Sprintf("entitydb_scheduler_runs_total{status=\"failed\"} %d\n", stats.Failed))
+		metrics.WriteString(fmt.Sprintf("entitydb_scheduler_runs_total{status=\"skipped\"} %d\n", stats.Skipped))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_scheduler_consecutive_failures Failed runs since the last success per schedule\n")
+		metrics.WriteString("# TYPE entitydb_scheduler_consecutive_failures gauge\n")
+		for scheduleID, failures := range stats.ConsecutiveFailures {
+			metrics.WriteString(fmt.Sprintf("entitydb_scheduler_consecutive_failures{schedule=\"%s\"} %d\n", scheduleID, failures))
+		}
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_scheduler_alerts_total Failure alerts by delivery outcome\n")
+		metrics.WriteString("# TYPE entitydb_scheduler_alerts_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_scheduler_alerts_total{outcome=\"sent\"} %d\n", stats.AlertsSent))
+		metrics.WriteString(fmt.Sprintf("entitydb_scheduler_alerts_total{outcome=\"failed\"} %d\n", stats.AlertsFailed))
+		metrics.WriteString("\n")
+	}
+	
+	// Snapshot metrics
+	if h.snapshots != nil {
+		stats := h.snapshots.Stats()
+		
+		metrics.WriteString("# HELP entitydb_snapshots_total Snapshots taken by outcome\n")
+		metrics.WriteString("# TYPE entitydb_snapshots_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_snapshots_total{status=\"succeeded\"} %d\n", stats.Taken))
+		metrics.WriteString(fmt.Sprintf("entitydb_snapshots_total{status=\"failed\"} %d\n", stats.Failed))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_snapshot_duration_seconds Time taken by the last snapshot\n")
+		metrics.WriteString("# TYPE entitydb_snapshot_duration_seconds gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_snapshot_duration_seconds %f\n", stats.LastDuration.Seconds()))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_snapshot_duration_seconds_total Time spent taking snapshots\n")
+		metrics.WriteString("# TYPE entitydb_snapshot_duration_seconds_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_snapshot_duration_seconds_total %f\n", stats.TotalDuration.Seconds()))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_snapshot_size_bytes Size of the last snapshot\n")
+		metrics.WriteString("# TYPE entitydb_snapshot_size_bytes gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_snapshot_size_bytes %d\n", stats.LastSizeBytes))
+		metrics.WriteString("\n")
+		
+		if !stats.LastSnapshotAt.IsZero() {
+			metrics.WriteString("# HELP entitydb_snapshot_last_success_timestamp_seconds Time the last snapshot was taken\n")
+			metrics.WriteString("# TYPE entitydb_snapshot_last_success_timestamp_seconds gauge\n")
+			metrics.WriteString(fmt.Sprintf("entitydb_snapshot_last_success_timestamp_seconds %d\n", stats.LastSnapshotAt.Unix()))
+			metrics.WriteString("\n")
+		}
+		
+		metrics.WriteString("# HELP entitydb_snapshots_retained Snapshots kept after the last pruning\n")
+		metrics.WriteString("# TYPE entitydb_snapshots_retained gauge\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_snapshots_retained %d\n", stats.Retained))
+		metrics.WriteString("\n")
+		
+		metrics.WriteString("# HELP entitydb_snapshots_pruned_total Snapshots deleted by retention\n")
+		metrics.WriteString("# TYPE entitydb_snapshots_pruned_total counter\n")
+		metrics.WriteString(fmt.Sprintf("entitydb_snapshots_pruned_total %d\n", stats.Pruned))
+		metrics.WriteString("\n")
+	}
+	
 	// Version info
 	metrics.WriteString("# HELP entitydb_info Information about EntityDB server\n")
 	metrics.WriteString("# TYPE entitydb_info gauge\n")
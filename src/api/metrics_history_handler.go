@@ -6,6 +6,7 @@ import (
 	"entitydb/logger"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -23,20 +24,64 @@ func NewMetricsHistoryHandler(repo models.EntityRepository) *MetricsHistoryHandl
 
 // MetricDataPoint represents a single metric value at a point in time
 type MetricDataPoint struct {
-	Timestamp time.Time `json:"timestamp"`
-	Value     float64   `json:"value"`
+	Timestamp time.Time          `json:"timestamp"`
+	Value     float64            `json:"value"`
+	Bucket    *MetricBucketStats `json:"bucket,omitempty"`
+}
+
+// MetricBucketStats summarizes the raw values of a rollup bucket. The data
+// point's timestamp is the bucket start and its value the average.
+type MetricBucketStats struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Sum   float64 `json:"sum"`
+	Count int64   `json:"count"`
 }
 
 // MetricHistoryResponse represents the response for metric history queries
 type MetricHistoryResponse struct {
-	MetricName string            `json:"metric_name"`
-	Unit       string            `json:"unit"`
+	MetricName  string            `json:"metric_name"`
+	Aggregation string            `json:"aggregation"`
+	Unit        string            `json:"unit"`
 	DataPoints []MetricDataPoint `json:"data_points"`
 	StartTime  time.Time         `json:"start_time"`
 	EndTime    time.Time         `json:"end_time"`
 	Count      int               `json:"count"`
 }
 
+// MetricSeriesPoint is one step of an evenly spaced series. Value is null
+// for steps without data so charts show a gap rather than a zero.
+type MetricSeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     *float64  `json:"value"`
+	Count     int64     `json:"count"`
+}
+
+// MetricSeriesResponse is the response for history queries with a step
+type MetricSeriesResponse struct {
+	MetricName string              `json:"metric_name"`
+	Unit       string              `json:"unit"`
+	Step       string              `json:"step"`
+	Function   string              `json:"function"`
+	Source     string              `json:"source"`
+	DataPoints []MetricSeriesPoint `json:"data_points"`
+	StartTime  time.Time           `json:"start_time"`
+	EndTime    time.Time           `json:"end_time"`
+	Count      int                 `json:"count"`
+}
+
+// maxSeriesPoints bounds the steps of one series
+const maxSeriesPoints = 10000
+
+// seriesFunctions reduce a step's summary to its value
+var seriesFunctions = map[string]func(models.MetricRollup) float64{
+	"avg":   models.MetricRollup.Avg,
+	"min":   func(b models.MetricRollup) float64 { return b.Min },
+	"max":   func(b models.MetricRollup) float64 { return b.Max },
+	"sum":   func(b models.MetricRollup) float64 { return b.Sum },
+	"count": func(b models.MetricRollup) float64 { return float64(b.Count) },
+}
+
 // GetMetricHistory retrieves historical values for a specific metric
 // @Summary Get metric history
 // @Description Retrieve historical values for a specific metric
@@ -46,8 +91,12 @@ type MetricHistoryResponse struct {
 // @Param metric_name query string true "Metric name (e.g., memory_alloc, entity_count_total)"
 // @Param hours query int false "Number of hours to look back (default: 24)"
 // @Param limit query int false "Maximum number of data points (default: 100)"
-// @Param aggregation query string false "Aggregation level: raw, 1min, 1hour, 1day (default: raw)"
+// @Param aggregation query string false "Aggregation level: raw, 1min, 1hour, 1day or auto to pick one from hours, or from step when one is given (default: raw)"
+// @Param step query string false "Return an evenly spaced series with this step (duration such as 5m, or seconds)"
+// @Param points query int false "Return an evenly spaced series of about this many steps over the range"
+// @Param function query string false "Value of each step: avg, min, max, sum or count (default: avg)"
 // @Success 200 {object} MetricHistoryResponse
+// @Success 200 {object} MetricSeriesResponse
 // @Router /api/v1/metrics/history [get]
 func (h *MetricsHistoryHandler) GetMetricHistory(w http.ResponseWriter, r *http.Request) {
 	// Get query parameters
@@ -73,15 +122,44 @@ func (h *MetricsHistoryHandler) GetMetricHistory(w http.ResponseWriter, r *http.
 		}
 	}
 	
+	// Calculate time range
+	endTime := time.Now()
+	startTime := endTime.Add(-time.Duration(hours) * time.Hour)
+	
+	// A step or a number of points asks for an evenly spaced series
+	step, err := parseSeriesStep(r.URL.Query().Get("step"), r.URL.Query().Get("points"), endTime.Sub(startTime))
+	if err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	function := r.URL.Query().Get("function")
+	if function == "" {
+		function = "avg"
+	}
+	if _, ok := seriesFunctions[function]; !ok {
+		RespondError(w, http.StatusBadRequest, "function must be avg, min, max, sum or count")
+		return
+	}
+	
 	// Parse aggregation level
 	aggregation := r.URL.Query().Get("aggregation")
 	if aggregation == "" {
 		aggregation = "raw"
+		if step > 0 {
+			aggregation = "auto"
+		}
+	}
+	if aggregation == "auto" && step == 0 {
+		aggregation = autoMetricAggregation(hours)
+	}
+	var resolution models.RollupResolution
+	if aggregation != "raw" && aggregation != "auto" {
+		var ok bool
+		if resolution, ok = models.ParseRollupResolution(aggregation); !ok {
+			RespondError(w, http.StatusBadRequest, "aggregation must be raw, 1min, 1hour, 1day or auto")
+			return
+		}
 	}
-	
-	// Calculate time range
-	endTime := time.Now()
-	startTime := endTime.Add(-time.Duration(hours) * time.Hour)
 	
 	logger.Debug("Fetching metric history: name=%s, hours=%d, limit=%d, aggregation=%s", metricName, hours, limit, aggregation)
 	
@@ -96,6 +174,17 @@ func (h *MetricsHistoryHandler) GetMetricHistory(w http.ResponseWriter, r *http.
 	entity := entities[0] // Use the first matching entity
 	metricID := entity.ID
 	
+	if step > 0 {
+		h.respondSeries(w, entity, metricName, aggregation, step, function, startTime, endTime)
+		return
+	}
+	
+	// Rollup buckets serve long ranges without reading the raw values
+	if aggregation != "raw" {
+		h.respondRollups(w, entity, metricName, resolution, startTime, endTime, limit)
+		return
+	}
+	
 	// Get entity repository - handle wrapped repositories
 	// All temporal functionality is now merged into the base EntityRepository
 	var entityRepo *binary.EntityRepository
@@ -225,16 +314,203 @@ func (h *MetricsHistoryHandler) GetMetricHistory(w http.ResponseWriter, r *http.
 	
 	// Create response
 	response := MetricHistoryResponse{
+		MetricName:  metricName,
+		Aggregation: aggregation,
+		Unit:        unit,
+		DataPoints:  dataPoints,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Count:       len(dataPoints),
+	}
+	
+	logger.Debug("Returning %d data points for metric %s", len(dataPoints), metricName)
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// autoMetricAggregation picks the finest aggregation that keeps a range of
+// hours to a few hundred data points
+func autoMetricAggregation(hours int) string {
+	switch {
+	case hours <= 1:
+		return "raw"
+	case hours <= 24:
+		return "1min"
+	case hours <= 30*24:
+		return "1hour"
+	}
+	return "1day"
+}
+
+// parseSeriesStep reads the step of a series from a duration or seconds, or
+// derives it from a number of points over span. Zero means no series.
+func parseSeriesStep(stepStr, pointsStr string, span time.Duration) (time.Duration, error) {
+	var step time.Duration
+	switch {
+	case stepStr != "":
+		if seconds, err := strconv.Atoi(stepStr); err == nil {
+			step = time.Duration(seconds) * time.Second
+		} else if parsed, err := time.ParseDuration(stepStr); err == nil {
+			step = parsed
+		} else {
+			return 0, fmt.Errorf("invalid step %q", stepStr)
+		}
+		if step < time.Second {
+			return 0, fmt.Errorf("step must be at least 1s")
+		}
+	case pointsStr != "":
+		points, err := strconv.Atoi(pointsStr)
+		if err != nil || points <= 0 {
+			return 0, fmt.Errorf("points must be a positive integer")
+		}
+		// Whole seconds, rounded up so the range fits in the points
+		step = (span/time.Duration(points) + time.Second - 1).Truncate(time.Second)
+		if step < time.Second {
+			step = time.Second
+		}
+	default:
+		return 0, nil
+	}
+	if span/step >= maxSeriesPoints {
+		return 0, fmt.Errorf("step %v gives more than %d points over the range", step, maxSeriesPoints)
+	}
+	return step, nil
+}
+
+// respondSeries answers a history query with an evenly spaced series of
+// steps, each reduced by function. With aggregation auto the coarsest
+// existing rollup whose buckets fit the step whole is read, and raw values
+// newer than its last bucket fill the tail; without one raw values are read.
+func (h *MetricsHistoryHandler) respondSeries(w http.ResponseWriter, metric *models.Entity, metricName, aggregation string, step time.Duration, function string, startTime, endTime time.Time) {
+	var summaries []models.MetricRollup
+	source := "raw"
+	var covered time.Time
+	
+	var candidates []models.RollupResolution
+	switch aggregation {
+	case "raw":
+	case "auto":
+		for i := len(models.RollupResolutions) - 1; i >= 0; i-- {
+			if resolution := models.RollupResolutions[i]; step%resolution.Duration == 0 {
+				candidates = append(candidates, resolution)
+			}
+		}
+	default:
+		resolution, _ := models.ParseRollupResolution(aggregation)
+		candidates = append(candidates, resolution)
+	}
+	for _, resolution := range candidates {
+		buckets, ok := h.rollupBuckets(metric, resolution)
+		if !ok {
+			continue
+		}
+		source = resolution.Name
+		summaries = buckets
+		if len(buckets) > 0 {
+			covered = buckets[len(buckets)-1].Start.Add(resolution.Duration)
+		}
+		break
+	}
+	for _, value := range rawMetricValues(metric) {
+		if !value.Start.Before(covered) {
+			summaries = append(summaries, value)
+		}
+	}
+	
+	// Steps are aligned to multiples of step so repeated queries line up
+	first := startTime.Truncate(step)
+	series := make([]models.MetricRollup, int(endTime.Sub(first)/step)+1)
+	for i := range series {
+		series[i].Start = first.Add(time.Duration(i) * step)
+	}
+	for _, summary := range summaries {
+		if summary.Start.Before(first) || summary.Start.After(endTime) {
+			continue
+		}
+		series[summary.Start.Sub(first)/step].Merge(summary)
+	}
+	
+	reduce := seriesFunctions[function]
+	dataPoints := make([]MetricSeriesPoint, len(series))
+	for i, bucket := range series {
+		dataPoints[i] = MetricSeriesPoint{Timestamp: bucket.Start, Count: bucket.Count}
+		if bucket.Count > 0 {
+			value := reduce(bucket)
+			dataPoints[i].Value = &value
+		}
+	}
+	
+	RespondJSON(w, http.StatusOK, MetricSeriesResponse{
 		MetricName: metricName,
-		Unit:       unit,
+		Unit:       metric.GetTagValue("unit"),
+		Step:       step.String(),
+		Function:   function,
+		Source:     source,
 		DataPoints: dataPoints,
-		StartTime:  startTime,
+		StartTime:  first,
 		EndTime:    endTime,
 		Count:      len(dataPoints),
+	})
+}
+
+// rollupBuckets returns the buckets of one resolution of a metric, oldest
+// first, and whether its rollup entity exists
+func (h *MetricsHistoryHandler) rollupBuckets(metric *models.Entity, resolution models.RollupResolution) ([]models.MetricRollup, bool) {
+	rollupID := models.MetricRollupID(metric.ID, resolution)
+	
+	// Rollups are found by tag first, as fetching a missing ID logs a recovery
+	rollups, err := h.repo.ListByTag("rollup:source:" + metric.ID)
+	if err != nil {
+		return nil, false
+	}
+	for _, candidate := range rollups {
+		if candidate.ID != rollupID {
+			continue
+		}
+		rollup, err := h.repo.GetByID(rollupID)
+		if err != nil || rollup.IsRecoveryPlaceholder() {
+			return nil, false
+		}
+		var buckets []models.MetricRollup
+		for _, tag := range rollup.Tags {
+			if bucket, ok := models.ParseMetricRollupTag(tag); ok {
+				buckets = append(buckets, bucket)
+			}
+		}
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+		return buckets, true
+	}
+	return nil, false
+}
+
+// respondRollups answers a history query from the metric's rollup buckets,
+// returning the latest limit buckets in the range, oldest first
+func (h *MetricsHistoryHandler) respondRollups(w http.ResponseWriter, metric *models.Entity, metricName string, resolution models.RollupResolution, startTime, endTime time.Time, limit int) {
+	dataPoints := []MetricDataPoint{}
+	buckets, _ := h.rollupBuckets(metric, resolution)
+	for _, bucket := range buckets {
+		if bucket.Start.Before(startTime) || bucket.Start.After(endTime) {
+			continue
+		}
+		dataPoints = append(dataPoints, MetricDataPoint{
+			Timestamp: bucket.Start,
+			Value:     bucket.Avg(),
+			Bucket:    &MetricBucketStats{Min: bucket.Min, Max: bucket.Max, Sum: bucket.Sum, Count: bucket.Count},
+		})
 	}
 	
-	logger.Debug("Returning %d data points for metric %s", len(dataPoints), metricName)
-	RespondJSON(w, http.StatusOK, response)
+	if len(dataPoints) > limit {
+		dataPoints = dataPoints[len(dataPoints)-limit:]
+	}
+	
+	RespondJSON(w, http.StatusOK, MetricHistoryResponse{
+		MetricName:  metricName,
+		Aggregation: resolution.Name,
+		Unit:        metric.GetTagValue("unit"),
+		DataPoints:  dataPoints,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Count:       len(dataPoints),
+	})
 }
 
 // GetAvailableMetrics returns a list of all available metrics
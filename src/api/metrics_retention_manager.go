@@ -4,11 +4,11 @@ import (
 	"context"
 	"entitydb/logger"
 	"entitydb/models"
+	"entitydb/services"
 	"entitydb/storage/binary"
 	"fmt"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -19,10 +19,9 @@ type MetricsRetentionManager struct {
 	retention1Min        time.Duration
 	retention1Hour       time.Duration
 	retention1Day        time.Duration
+	pause                services.WritePause
 	ctx                  context.Context
 	cancel               context.CancelFunc
-	mu                   sync.RWMutex
-	aggregationRunning   bool
 }
 
 // NewMetricsRetentionManager creates a new retention manager
@@ -39,6 +38,12 @@ func NewMetricsRetentionManager(repo models.EntityRepository, rawRetention, min1
 	}
 }
 
+// SetWritePause makes the manager skip its runs while pause reports the
+// server read-only. Call it before Start.
+func (m *MetricsRetentionManager) SetWritePause(pause services.WritePause) {
+	m.pause = pause
+}
+
 // Start begins the retention management process
 func (m *MetricsRetentionManager) Start() {
 	logger.Info("Starting metrics retention manager - Raw: %v, 1min: %v, 1hour: %v, 1day: %v", 
@@ -64,7 +69,9 @@ func (m *MetricsRetentionManager) Start() {
 			select {
 			case <-ticker.C:
 				// Only run retention if system is stable
-				if !binary.IsMetricsOperation() {
+				if m.pause != nil && m.pause.ReadOnly() {
+					logger.Trace("Skipping retention cycle while the server is read-only")
+				} else if !binary.IsMetricsOperation() {
 					m.enforceRetention()
 				} else {
 					logger.Trace("Skipping retention cycle due to active metrics operations")
@@ -76,36 +83,7 @@ func (m *MetricsRetentionManager) Start() {
 		}
 	}()
 	
-	// BAR-RAISING SOLUTION: Conservative aggregation scheduling
-	go func() {
-		// Extended delay to prevent startup contention with authentication flows
-		select {
-		case <-time.After(45 * time.Minute):
-		case <-m.ctx.Done():
-			return
-		}
-		
-		// Skip initial aggregation to prevent resource conflicts
-		logger.Info("Metrics aggregation manager initialized with conservative scheduling")
-		
-		// Reduced frequency to minimize system impact
-		ticker := time.NewTicker(30 * time.Minute)
-		defer ticker.Stop()
-		
-		for {
-			select {
-			case <-ticker.C:
-				// Only aggregate if system is stable
-				if !binary.IsMetricsOperation() {
-					m.performAggregation()
-				} else {
-					logger.Trace("Skipping aggregation cycle due to active metrics operations")
-				}
-			case <-m.ctx.Done():
-				return
-			}
-		}
-	}()
+	// Aggregation into 1m/1h/1d buckets is done by the MetricsRollupEngine
 }
 
 // Stop stops the retention manager
@@ -222,266 +200,6 @@ func (m *MetricsRetentionManager) enforceRetention() {
 		cleanedCount, totalTagsRemoved, duration)
 }
 
-// performAggregation creates aggregated metrics from raw data
-func (m *MetricsRetentionManager) performAggregation() {
-	m.mu.Lock()
-	if m.aggregationRunning {
-		m.mu.Unlock()
-		logger.Debug("Aggregation already running, skipping")
-		return
-	}
-	m.aggregationRunning = true
-	m.mu.Unlock()
-	
-	// BAR-RAISING SOLUTION: Check database health before aggregation
-	if binary.IsMetricsOperation() {
-		m.mu.Lock()
-		m.aggregationRunning = false
-		m.mu.Unlock()
-		logger.Trace("Skipping aggregation during active metrics operation to prevent contention")
-		return
-	}
-	
-	// Mark this goroutine as performing metrics operations to prevent recursion
-	binary.SetMetricsOperation(true)
-	defer binary.SetMetricsOperation(false)
-	
-	defer func() {
-		m.mu.Lock()
-		m.aggregationRunning = false
-		m.mu.Unlock()
-	}()
-	
-	logger.Info("Starting metrics aggregation")
-	startTime := time.Now()
-	
-	// BAR-RAISING SOLUTION: Safe metrics listing for aggregation
-	metrics, err := m.safeListMetrics()
-	if err != nil {
-		logger.Warn("Metrics aggregation skipped due to database instability: %v", err)
-		return
-	}
-	
-	logger.Info("Found %d total metrics for aggregation processing", len(metrics))
-	
-	aggregatedCount := 0
-	rawMetricsCount := 0
-	
-	for _, metric := range metrics {
-		// Skip if already aggregated
-		isAggregated := false
-		for _, tag := range metric.GetTagsWithoutTimestamp() {
-			if strings.HasPrefix(tag, "aggregation:") {
-				isAggregated = true
-				break
-			}
-		}
-		
-		if isAggregated {
-			logger.Debug("Skipping aggregated metric: %s", metric.ID)
-			continue
-		}
-		
-		rawMetricsCount++
-		logger.Debug("Processing raw metric: %s", metric.ID)
-		
-		// Get metric name
-		metricName := ""
-		for _, tag := range metric.GetTagsWithoutTimestamp() {
-			if strings.HasPrefix(tag, "name:") {
-				metricName = strings.TrimPrefix(tag, "name:")
-				break
-			}
-		}
-		
-		if metricName == "" {
-			continue
-		}
-		
-		// Aggregate at different intervals
-		if err := m.aggregateMetric(metric, metricName, 1*time.Minute, "1min"); err != nil {
-			logger.Warn("Failed to aggregate %s at 1min: %v", metricName, err)
-		} else {
-			aggregatedCount++
-		}
-		
-		if err := m.aggregateMetric(metric, metricName, 1*time.Hour, "1hour"); err != nil {
-			logger.Warn("Failed to aggregate %s at 1hour: %v", metricName, err)
-		} else {
-			aggregatedCount++
-		}
-		
-		if err := m.aggregateMetric(metric, metricName, 24*time.Hour, "1day"); err != nil {
-			logger.Warn("Failed to aggregate %s at 1day: %v", metricName, err)
-		} else {
-			aggregatedCount++
-		}
-	}
-	
-	duration := time.Since(startTime)
-	logger.Info("Aggregation complete: %d raw metrics processed, %d aggregations performed in %v", rawMetricsCount, aggregatedCount, duration)
-}
-
-// aggregateMetric creates an aggregated version of a metric
-func (m *MetricsRetentionManager) aggregateMetric(metric *models.Entity, metricName string, interval time.Duration, intervalName string) error {
-	// Mark this operation as metrics-related to prevent recursion
-	binary.SetMetricsOperation(true)
-	defer binary.SetMetricsOperation(false)
-	
-	// BAR-RAISING SOLUTION: Safe aggregated metric handling to prevent mass entity creation
-	aggMetricID := fmt.Sprintf("metric_%s_agg_%s", metricName, intervalName)
-	
-	// Use timeout for aggregated metric lookup to prevent hanging
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	
-	type aggResult struct {
-		metric *models.Entity
-		err    error
-	}
-	resultCh := make(chan aggResult, 1)
-	
-	go func() {
-		metric, err := m.repo.GetByID(aggMetricID)
-		resultCh <- aggResult{metric: metric, err: err}
-	}()
-	
-	var aggMetric *models.Entity
-	var err error
-	select {
-	case res := <-resultCh:
-		aggMetric = res.metric
-		err = res.err
-	case <-ctx.Done():
-		return fmt.Errorf("timeout waiting for aggregated metric %s: database under stress", aggMetricID)
-	}
-	
-	if err != nil {
-		// Create new aggregated metric
-		aggMetric = &models.Entity{
-			ID: aggMetricID,
-			Tags: []string{
-				"type:metric",
-				"dataset:system",
-				fmt.Sprintf("name:%s", metricName),
-				fmt.Sprintf("aggregation:%s", intervalName),
-				fmt.Sprintf("source:%s", metric.ID),
-			},
-			Content: []byte{},
-		}
-		
-		// Copy other metadata tags
-		for _, tag := range metric.GetTagsWithoutTimestamp() {
-			if strings.HasPrefix(tag, "unit:") || strings.HasPrefix(tag, "description:") {
-				aggMetric.Tags = append(aggMetric.Tags, tag)
-			}
-		}
-		
-		// BAR-RAISING SOLUTION: Safe metric creation with timeout
-		createCtx, createCancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer createCancel()
-		
-		createCh := make(chan error, 1)
-		go func() {
-			createCh <- m.repo.Create(aggMetric)
-		}()
-		
-		select {
-		case createErr := <-createCh:
-			if createErr != nil {
-				return fmt.Errorf("failed to create aggregated metric: %w", createErr)
-			}
-		case <-createCtx.Done():
-			return fmt.Errorf("timeout creating aggregated metric %s: database under stress", aggMetricID)
-		}
-	}
-	
-	// Get latest aggregation timestamp
-	latestAggTime := time.Time{}
-	for _, tag := range aggMetric.Tags {
-		if idx := strings.Index(tag, "|"); idx != -1 {
-			if strings.HasPrefix(tag[idx+1:], "value:") {
-				if timestamp, err := strconv.ParseInt(tag[:idx], 10, 64); err == nil {
-					t := time.Unix(0, timestamp)
-					if t.After(latestAggTime) {
-						latestAggTime = t
-					}
-				}
-			}
-		}
-	}
-	
-	// Collect values to aggregate since last aggregation
-	now := time.Now()
-	buckets := make(map[time.Time][]float64)
-	
-	for _, tag := range metric.Tags {
-		if idx := strings.Index(tag, "|"); idx != -1 {
-			timestampStr := tag[:idx]
-			actualTag := tag[idx+1:]
-			
-			if strings.HasPrefix(actualTag, "value:") {
-				if timestamp, err := strconv.ParseInt(timestampStr, 10, 64); err == nil {
-					t := time.Unix(0, timestamp)
-					
-					// Skip if before last aggregation
-					if !latestAggTime.IsZero() && t.Before(latestAggTime) {
-						continue
-					}
-					
-					// Skip if too recent for complete bucket
-					if t.After(now.Add(-interval)) {
-						continue
-					}
-					
-					// Parse value
-					valueStr := strings.TrimPrefix(actualTag, "value:")
-					if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
-						// Round down to interval
-						bucket := t.Truncate(interval)
-						buckets[bucket] = append(buckets[bucket], value)
-					}
-				}
-			}
-		}
-	}
-	
-	// Create aggregated values
-	for bucket, values := range buckets {
-		if len(values) == 0 {
-			continue
-		}
-		
-		// Calculate aggregates
-		sum := 0.0
-		min := values[0]
-		max := values[0]
-		
-		for _, v := range values {
-			sum += v
-			if v < min {
-				min = v
-			}
-			if v > max {
-				max = v
-			}
-		}
-		
-		avg := sum / float64(len(values))
-		
-		// Add aggregated value tag with bucket information
-		aggTag := fmt.Sprintf("value:%.2f:avg:%.2f:min:%.2f:max:%.2f:count:%d:bucket:%d", 
-			avg, avg, min, max, len(values), bucket.Unix())
-		
-		// Add the aggregated value (will get current timestamp, but includes bucket time in value)
-		if err := m.repo.AddTag(aggMetricID, aggTag); err != nil {
-			logger.Warn("Failed to add aggregated tag for %s: %v", aggMetricID, err)
-		}
-	}
-	
-	return nil
-}
-
 // BAR-RAISING SOLUTION: Safe metrics listing with database health checks
 func (m *MetricsRetentionManager) safeListMetrics() ([]*models.Entity, error) {
 	// Quick health check - try to get system user entity first
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/services"
+	"entitydb/storage/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimum buckets kept per resolution, so the next coarser resolution can
+// still be computed from them
+var minRollupKeep = map[string]int{"1m": 120, "1h": 48, "1d": 1}
+
+// MetricsRollupEngine rolls the raw values of metric entities up into 1m, 1h
+// and 1d buckets holding min, max, avg, sum and count, stored on dedicated
+// rollup entities (see models.MetricRollup). Each run only computes buckets
+// that completed since the last one, so raw values are read once per
+// minute bucket and long ranges are served from a few hundred buckets.
+type MetricsRollupEngine struct {
+	repo     models.EntityRepository
+	interval time.Duration
+	keep     map[string]int
+	pause    services.WritePause
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// runMu serializes runs
+	runMu sync.Mutex
+}
+
+// MetricsRollupResult summarizes one rollup run
+type MetricsRollupResult struct {
+	Metrics  int           `json:"metrics"`
+	Buckets  int           `json:"buckets"`
+	Failed   int           `json:"failed"`
+	Duration time.Duration `json:"duration"`
+}
+
+// NewMetricsRollupEngine creates a rollup engine running every interval and
+// keeping the given number of 1m, 1h and 1d buckets per metric
+func NewMetricsRollupEngine(repo models.EntityRepository, interval time.Duration, keep1Min, keep1Hour, keep1Day int) *MetricsRollupEngine {
+	ctx, cancel := context.WithCancel(context.Background())
+	keep := map[string]int{"1m": keep1Min, "1h": keep1Hour, "1d": keep1Day}
+	for name, min := range minRollupKeep {
+		if keep[name] < min {
+			keep[name] = min
+		}
+	}
+	return &MetricsRollupEngine{
+		repo:     repo,
+		interval: interval,
+		keep:     keep,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// SetWritePause makes the engine skip its runs while pause reports the
+// server read-only. Call it before Start.
+func (e *MetricsRollupEngine) SetWritePause(pause services.WritePause) {
+	e.pause = pause
+}
+
+// Start begins rolling up metrics on the engine's interval
+func (e *MetricsRollupEngine) Start() {
+	logger.Info("Starting metrics rollup engine - interval: %v, keep 1m/1h/1d: %d/%d/%d",
+		e.interval, e.keep["1m"], e.keep["1h"], e.keep["1d"])
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if e.pause != nil && e.pause.ReadOnly() {
+					continue
+				}
+				result := e.Run(time.Now())
+				if result.Buckets > 0 || result.Failed > 0 {
+					logger.Debug("Metrics rollup: %d metrics, %d buckets written, %d failed in %v",
+						result.Metrics, result.Buckets, result.Failed, result.Duration)
+				}
+			case <-e.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the engine and waits for a running rollup to finish
+func (e *MetricsRollupEngine) Stop() {
+	e.cancel()
+	e.wg.Wait()
+}
+
+// Run rolls up every raw metric entity up to now. Buckets still open at now
+// are left for a later run.
+func (e *MetricsRollupEngine) Run(now time.Time) MetricsRollupResult {
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+
+	// Rollup writes must not be tracked as storage metrics themselves
+	binary.SetMetricsOperation(true)
+	defer binary.SetMetricsOperation(false)
+
+	start := time.Now()
+	var result MetricsRollupResult
+
+	metrics, err := e.repo.ListByTag("type:metric")
+	if err != nil {
+		logger.Warn("Metrics rollup skipped: %v", err)
+		return result
+	}
+
+	for _, metric := range metrics {
+		if e.ctx.Err() != nil {
+			break
+		}
+		// Buckets written by the legacy aggregation are not raw values
+		if metric.GetTagValue("aggregation") != "" {
+			continue
+		}
+		name := metric.GetTagValue("name")
+		if name == "" {
+			continue
+		}
+
+		// List results may carry only current tags; the values are temporal
+		source, err := e.repo.GetByID(metric.ID)
+		if err != nil {
+			continue
+		}
+
+		result.Metrics++
+		written, err := e.rollupMetric(source, name, now)
+		result.Buckets += written
+		if err != nil {
+			result.Failed++
+			logger.Warn("Failed to roll up metric %s: %v", name, err)
+		}
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// rollupMetric brings every resolution of one metric up to date, each
+// computed from the one before it
+func (e *MetricsRollupEngine) rollupMetric(source *models.Entity, name string, now time.Time) (int, error) {
+	// Look the rollups up by tag so missing ones are not fetched by ID
+	existing := make(map[string]bool)
+	rollups, err := e.repo.ListByTag("rollup:source:" + source.ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, rollup := range rollups {
+		existing[rollup.ID] = true
+	}
+
+	inputs := rawMetricValues(source)
+	written := 0
+	for _, resolution := range models.RollupResolutions {
+		exists := existing[models.MetricRollupID(source.ID, resolution)]
+		buckets, n, err := e.rollupResolution(source, name, resolution, exists, inputs, now)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		inputs = buckets
+	}
+	return written, nil
+}
+
+// rawMetricValues reads the temporal value: tags of a metric as one-value
+// summaries
+func rawMetricValues(entity *models.Entity) []models.MetricRollup {
+	var values []models.MetricRollup
+	for _, tag := range entity.Tags {
+		timestamp, value, ok := strings.Cut(tag, "|")
+		if !ok || !strings.HasPrefix(value, "value:") {
+			continue
+		}
+		nanos, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimPrefix(value, "value:"), 64)
+		if err != nil {
+			continue
+		}
+		values = append(values, models.MetricRollup{Start: time.Unix(0, nanos), Min: v, Max: v, Sum: v, Count: 1})
+	}
+	return values
+}
+
+// rollupResolution adds the buckets of one resolution that completed since
+// its last bucket and drops the oldest beyond the retention. It returns the
+// buckets including those just dropped, oldest first, so a first run over a
+// long raw history still feeds the coarser resolutions, and the number
+// written.
+func (e *MetricsRollupEngine) rollupResolution(source *models.Entity, name string, resolution models.RollupResolution, exists bool, inputs []models.MetricRollup, now time.Time) ([]models.MetricRollup, int, error) {
+	rollupID := models.MetricRollupID(source.ID, resolution)
+	var existing *models.Entity
+	if exists {
+		entity, err := e.repo.GetByID(rollupID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !entity.IsRecoveryPlaceholder() {
+			existing = entity
+		}
+	}
+
+	var buckets []models.MetricRollup
+	var otherTags []string
+	if existing != nil {
+		for _, tag := range existing.Tags {
+			if bucket, ok := models.ParseMetricRollupTag(tag); ok {
+				buckets = append(buckets, bucket)
+			} else {
+				otherTags = append(otherTags, tag)
+			}
+		}
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	}
+
+	var watermark time.Time
+	if len(buckets) > 0 {
+		watermark = buckets[len(buckets)-1].Start.Add(resolution.Duration)
+	}
+
+	// Fold the inputs into the buckets that completed since the watermark
+	pending := make(map[int64]*models.MetricRollup)
+	for _, input := range inputs {
+		bucketStart := input.Start.Truncate(resolution.Duration)
+		if bucketStart.Before(watermark) || bucketStart.Add(resolution.Duration).After(now) {
+			continue
+		}
+		bucket := pending[bucketStart.UnixNano()]
+		if bucket == nil {
+			bucket = &models.MetricRollup{Start: bucketStart}
+			pending[bucketStart.UnixNano()] = bucket
+		}
+		bucket.Merge(input)
+	}
+	if len(pending) == 0 {
+		return buckets, 0, nil
+	}
+
+	added := make([]models.MetricRollup, 0, len(pending))
+	for _, bucket := range pending {
+		added = append(added, *bucket)
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].Start.Before(added[j].Start) })
+	all := append(buckets, added...)
+	buckets = all
+	if keep := e.keep[resolution.Name]; len(buckets) > keep {
+		buckets = buckets[len(buckets)-keep:]
+	}
+
+	tags := otherTags
+	if existing == nil {
+		tags = []string{
+			"type:" + models.MetricRollupType,
+			"dataset:system",
+			"rollup:metric:" + name,
+			"rollup:source:" + source.ID,
+			"rollup:resolution:" + resolution.Name,
+		}
+		if unit := source.GetTagValue("unit"); unit != "" {
+			tags = append(tags, "unit:"+unit)
+		}
+	}
+	for _, bucket := range buckets {
+		tags = append(tags, bucket.Tag())
+	}
+
+	var err error
+	if existing == nil {
+		err = e.repo.Create(&models.Entity{ID: rollupID, Tags: tags, Content: []byte{}})
+	} else {
+		err = e.repo.Update(&models.Entity{
+			ID:        existing.ID,
+			Tags:      tags,
+			Content:   existing.Content,
+			CreatedAt: existing.CreatedAt,
+			UpdatedAt: now.UnixNano(),
+		})
+	}
+	if err != nil {
+		return all, 0, err
+	}
+	return all, len(added), nil
+}
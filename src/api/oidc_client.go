@@ -0,0 +1,503 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // SHA-384 and SHA-512 for RS384, RS512, ES384 and ES512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// oidcStateTTL bounds how long a login may take at the identity provider
+	oidcStateTTL = 10 * time.Minute
+
+	// oidcKeyRefreshInterval limits JWKS refetches triggered by unknown key IDs
+	oidcKeyRefreshInterval = time.Minute
+
+	// oidcClockSkew is tolerated between the provider's and our clock
+	oidcClockSkew = 2 * time.Minute
+
+	// oidcMaxResponseBytes bounds discovery, JWKS and token responses
+	oidcMaxResponseBytes = 1 << 20
+)
+
+// oidcDiscovery is the part of the provider metadata the client uses
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcLogin is a login waiting for the provider's callback
+type oidcLogin struct {
+	nonce    string
+	verifier string
+	redirect string
+	expires  time.Time
+}
+
+// OIDCConfig configures an OIDCClient
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCClient authenticates users with an OpenID Connect provider using the
+// authorization code flow with PKCE. ID tokens are verified against the
+// provider's published keys; RS256/384/512 and ES256/384/512 are supported.
+type OIDCClient struct {
+	config OIDCConfig
+	http   *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+	logins      map[string]*oidcLogin
+}
+
+// NewOIDCClient creates a client; provider metadata is fetched on first use
+func NewOIDCClient(config OIDCConfig) *OIDCClient {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid"}
+	}
+	return &OIDCClient{
+		config: config,
+		http:   &http.Client{Timeout: 10 * time.Second},
+		logins: make(map[string]*oidcLogin),
+	}
+}
+
+// getJSON fetches a JSON document
+func (c *OIDCClient) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(v)
+}
+
+// discover returns the provider metadata, fetching it once
+func (c *OIDCClient) discover(ctx context.Context) (*oidcDiscovery, error) {
+	c.mu.Lock()
+	discovery := c.discovery
+	c.mu.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	issuer := strings.TrimSuffix(c.config.IssuerURL, "/")
+	discovery = &oidcDiscovery{}
+	if err := c.getJSON(ctx, issuer+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", discovery.Issuer, c.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document is missing endpoints")
+	}
+
+	c.mu.Lock()
+	c.discovery = discovery
+	c.mu.Unlock()
+	return discovery, nil
+}
+
+// randomToken returns a URL-safe random string
+func randomToken() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// AuthURL starts a login and returns the provider URL to send the user to.
+// redirect is kept until the callback.
+func (c *OIDCClient) AuthURL(ctx context.Context, redirect string) (string, error) {
+	discovery, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state := randomToken()
+	login := &oidcLogin{
+		nonce:    randomToken(),
+		verifier: randomToken(),
+		redirect: redirect,
+		expires:  time.Now().Add(oidcStateTTL),
+	}
+	c.mu.Lock()
+	now := time.Now()
+	for key, pending := range c.logins {
+		if now.After(pending.expires) {
+			delete(c.logins, key)
+		}
+	}
+	c.logins[state] = login
+	c.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(login.verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.config.ClientID},
+		"redirect_uri":          {c.config.RedirectURL},
+		"scope":                 {strings.Join(c.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {login.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange completes a login: it redeems the authorization code and returns
+// the verified ID token claims and the redirect given to AuthURL
+func (c *OIDCClient) Exchange(ctx context.Context, state, code string) (map[string]interface{}, string, error) {
+	c.mu.Lock()
+	login, ok := c.logins[state]
+	delete(c.logins, state)
+	c.mu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		return nil, "", fmt.Errorf("unknown or expired login state")
+	}
+
+	discovery, err := c.discover(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.config.RedirectURL},
+		"client_id":     {c.config.ClientID},
+		"code_verifier": {login.verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(&token); err != nil {
+		return nil, "", fmt.Errorf("invalid token response (%s): %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, "", fmt.Errorf("token request rejected: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, "", fmt.Errorf("token response has no id_token")
+	}
+
+	claims, err := c.VerifyIDToken(ctx, token.IDToken, login.nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	return claims, login.redirect, nil
+}
+
+// VerifyIDToken checks an ID token's signature, issuer, audience, expiry
+// and nonce and returns its claims
+func (c *OIDCClient) VerifyIDToken(ctx context.Context, raw, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed ID token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token signature: %w", err)
+	}
+
+	key, err := c.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWS(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed ID token claims: %w", err)
+	}
+
+	discovery, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != discovery.Issuer {
+		return nil, fmt.Errorf("ID token issuer %q does not match %q", iss, discovery.Issuer)
+	}
+	if !audienceContains(claims["aud"], c.config.ClientID) {
+		return nil, fmt.Errorf("ID token audience does not include client %q", c.config.ClientID)
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return nil, fmt.Errorf("ID token expired")
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(oidcClockSkew)) {
+		return nil, fmt.Errorf("ID token issued in the future")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("ID token nonce mismatch")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("ID token has no subject")
+	}
+	return claims, nil
+}
+
+// key returns the provider key with the given ID, refetching the key set
+// when the ID is unknown, for example after a key rotation
+func (c *OIDCClient) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	keys, fetched := c.keys, c.keysFetched
+	c.mu.Unlock()
+	if key := pickKey(keys, kid); key != nil {
+		return key, nil
+	}
+	if time.Since(fetched) < oidcKeyRefreshInterval {
+		return nil, fmt.Errorf("ID token signed with unknown key %q", kid)
+	}
+
+	discovery, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := c.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	keys = make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	c.mu.Lock()
+	c.keys, c.keysFetched = keys, time.Now()
+	c.mu.Unlock()
+	if key := pickKey(keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("ID token signed with unknown key %q", kid)
+}
+
+// pickKey returns the key with the given ID, or the only key when the token
+// names none
+func pickKey(keys map[string]crypto.PublicKey, kid string) crypto.PublicKey {
+	if key, ok := keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// jsonWebKey is an RSA or EC public key in JWK form
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("key is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// esCurves names the curve of each ES algorithm (RFC 7518 section 3.4)
+var esCurves = map[string]string{
+	"ES256": "P-256",
+	"ES384": "P-384",
+	"ES512": "P-521",
+}
+
+// verifyJWS checks a JWS signature made with alg
+func verifyJWS(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported ID token algorithm %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported ID token algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("ID token algorithm %s does not match key type", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature); err != nil {
+			return errors.New("invalid ID token signature")
+		}
+		return nil
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("ID token algorithm %s does not match key type", alg)
+		}
+		// Each ES algorithm is defined over one curve, with the hash sized to it
+		if curve := ecKey.Curve.Params().Name; curve != esCurves[alg] {
+			return fmt.Errorf("ID token algorithm %s does not match key curve %s", alg, curve)
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid ID token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid ID token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported ID token algorithm %q", alg)
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains reports whether an aud claim, a string or an array,
+// includes clientID
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
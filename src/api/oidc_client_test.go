@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProvider serves OIDC discovery and a key set holding one P-256 key
+type testProvider struct {
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		size := (key.Curve.Params().BitSize + 7) / 8
+		json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {{
+			Kty: "EC",
+			Kid: "k1",
+			Use: "sig",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+		}}})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// sign returns an ID token for claims with the given header alg, signed
+// with the provider key over hash
+func (p *testProvider) sign(t *testing.T, alg string, hash crypto.Hash, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": alg, "kid": "k1"}) + "." + encode(claims)
+	h := hash.New()
+	h.Write([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, p.key, h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := (p.key.Curve.Params().BitSize + 7) / 8
+	signature := append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// TestVerifyIDToken checks that ID tokens are accepted only with a valid
+// signature from the provider key under a matching algorithm, and with the
+// expected issuer, audience, expiry, nonce and subject
+func TestVerifyIDToken(t *testing.T) {
+	provider := newTestProvider(t)
+	client := NewOIDCClient(OIDCConfig{IssuerURL: provider.server.URL, ClientID: "entitydb"})
+	claims := func(change func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":   provider.server.URL,
+			"aud":   "entitydb",
+			"sub":   "user-1",
+			"nonce": "n-1",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	valid := provider.sign(t, "ES256", crypto.SHA256, claims(nil))
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr string
+	}{
+		{"valid", valid, "n-1", ""},
+		{"audience list", provider.sign(t, "ES256", crypto.SHA256, claims(func(c map[string]interface{}) {
+			c["aud"] = []string{"other", "entitydb"}
+		})), "n-1", ""},
+		{"bad signature", valid[:len(valid)-4] + "AAAA", "n-1", "invalid ID token signature"},
+		{"claims changed after signing", strings.Join([]string{
+			strings.Split(valid, ".")[0],
+			strings.Split(provider.sign(t, "ES256", crypto.SHA256, claims(func(c map[string]interface{}) { c["sub"] = "admin" })), ".")[1],
+			strings.Split(valid, ".")[2],
+		}, "."), "n-1", "invalid ID token signature"},
+		{"algorithm for another key type", provider.sign(t, "RS256", crypto.SHA256, claims(nil)), "n-1", "does not match key type"},
+		{"algorithm for another curve", provider.sign(t, "ES384", crypto.SHA384, claims(nil)), "n-1", "does not match key curve"},
+		{"unsupported algorithm", provider.sign(t, "none", crypto.SHA256, claims(nil)), "n-1", "unsupported ID token algorithm"},
+		{"wrong issuer", provider.sign(t, "ES256", crypto.SHA256, claims(func(c map[string]interface{}) {
+			c["iss"] = "https://evil.example"
+		})), "n-1", "issuer"},
+		{"wrong audience", provider.sign(t, "ES256", crypto.SHA256, claims(func(c map[string]interface{}) {
+			c["aud"] = "another-client"
+		})), "n-1", "audience"},
+		{"expired", provider.sign(t, "ES256", crypto.SHA256, claims(func(c map[string]interface{}) {
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+		})), "n-1", "expired"},
+		{"no expiry", provider.sign(t, "ES256", crypto.SHA256, claims(func(c map[string]interface{}) {
+			delete(c, "exp")
+		})), "n-1", "expired"},
+		{"issued in the future", provider.sign(t, "ES256", crypto.SHA256, claims(func(c map[string]interface{}) {
+			c["iat"] = time.Now().Add(time.Hour).Unix()
+		})), "n-1", "future"},
+		{"nonce mismatch", valid, "n-2", "nonce mismatch"},
+		{"missing subject", provider.sign(t, "ES256", crypto.SHA256, claims(func(c map[string]interface{}) {
+			delete(c, "sub")
+		})), "n-1", "no subject"},
+		{"malformed", "not-a-token", "n-1", "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.VerifyIDToken(context.Background(), tt.token, tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyIDToken: %v", err)
+				}
+				if got["sub"] != "user-1" {
+					t.Errorf("sub = %v, want user-1", got["sub"])
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyIDToken error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
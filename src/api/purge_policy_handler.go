@@ -0,0 +1,35 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/services"
+	"net/http"
+)
+
+// PurgePolicyHandler exposes the purge policies applied by the deletion collector
+type PurgePolicyHandler struct {
+	collector *services.DeletionCollector
+}
+
+// NewPurgePolicyHandler creates a new purge policy handler
+func NewPurgePolicyHandler(collector *services.DeletionCollector) *PurgePolicyHandler {
+	return &PurgePolicyHandler{collector: collector}
+}
+
+// PreviewPurge lists what the next collection cycle would purge
+// @Summary Preview policy purges
+// @Description List purge policy entities as parsed by the deletion collector and the soft-deleted or archived entities its next cycle would permanently remove. Entities on legal hold are counted but never listed or purged. Nothing is changed.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} services.PurgePreview
+// @Security BearerAuth
+// @Router /api/v1/admin/purge/preview [get]
+func (h *PurgePolicyHandler) PreviewPurge(w http.ResponseWriter, r *http.Request) {
+	preview, err := h.collector.PreviewPurge()
+	if err != nil {
+		logger.Error("Failed to preview purge: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to preview purge")
+		return
+	}
+	RespondJSON(w, http.StatusOK, preview)
+}
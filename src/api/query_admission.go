@@ -0,0 +1,284 @@
+// Package api provides query admission control for EntityDB. Queries are
+// costed before execution and rejected or queued when they exceed the
+// per-query limit or the per-user and per-dataset budgets.
+package api
+
+import (
+	"context"
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/storage/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// costBucket is a token bucket of query cost that refills over one minute
+type costBucket struct {
+	capacity   float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+// newCostBucket creates a full bucket holding budget cost units per minute
+func newCostBucket(budget int) *costBucket {
+	return &costBucket{
+		capacity:   float64(budget),
+		tokens:     float64(budget),
+		lastRefill: time.Now(),
+	}
+}
+
+// refill adds the cost units earned since the last refill
+func (b *costBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.lastRefill).Minutes()
+	b.tokens += elapsed * b.capacity
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.lastRefill = now
+}
+
+// waitFor returns how long until the bucket holds cost units
+func (b *costBucket) waitFor(cost float64) time.Duration {
+	if b.tokens >= cost {
+		return 0
+	}
+	return time.Duration((cost - b.tokens) / b.capacity * float64(time.Minute))
+}
+
+// QueryRejection describes why a query was not admitted
+type QueryRejection struct {
+	Status     int                      `json:"-"`
+	Reason     string                   `json:"error"`
+	Estimate   binary.QueryCostEstimate `json:"estimate"`
+	Limit      int64                    `json:"limit"`
+	RetryAfter time.Duration            `json:"-"`
+	Hint       string                   `json:"hint"`
+}
+
+func (e *QueryRejection) Error() string {
+	return fmt.Sprintf("%s (estimated cost %d, limit %d)", e.Reason, e.Estimate.Cost, e.Limit)
+}
+
+// QueryAdmissionStats reports admission decisions since startup
+type QueryAdmissionStats struct {
+	Admitted int64 `json:"admitted"`
+	Queued   int64 `json:"queued"`
+	Rejected int64 `json:"rejected"`
+}
+
+// QueryAdmissionController admits queries based on their estimated cost.
+//
+// A query whose cost exceeds the per-query maximum is rejected outright. A
+// query that fits but finds its user or dataset budget exhausted waits for
+// the budget to refill, up to the queue timeout, and is rejected afterwards.
+type QueryAdmissionController struct {
+	maxCost       int64
+	userBudget    int
+	datasetBudget int
+	queueTimeout  time.Duration
+
+	mu       sync.Mutex
+	users    map[string]*costBucket
+	datasets map[string]*costBucket
+
+	admitted int64
+	queued   int64
+	rejected int64
+}
+
+// NewQueryAdmissionController creates a controller from configuration
+func NewQueryAdmissionController(cfg *config.Config) *QueryAdmissionController {
+	return &QueryAdmissionController{
+		maxCost:       int64(cfg.QueryMaxCost),
+		userBudget:    cfg.QueryUserBudget,
+		datasetBudget: cfg.QueryDatasetBudget,
+		queueTimeout:  cfg.QueryQueueTimeout,
+		users:         make(map[string]*costBucket),
+		datasets:      make(map[string]*costBucket),
+	}
+}
+
+// Admit blocks until the query may run or returns a *QueryRejection
+func (c *QueryAdmissionController) Admit(ctx context.Context, user, dataset string, estimate binary.QueryCostEstimate) error {
+	if c.maxCost > 0 && estimate.Cost > c.maxCost {
+		return c.reject(&QueryRejection{
+			Status:   http.StatusUnprocessableEntity,
+			Reason:   "query exceeds maximum cost",
+			Estimate: estimate,
+			Limit:    c.maxCost,
+		})
+	}
+	if c.userBudget > 0 && user != "" && estimate.Cost > int64(c.userBudget) {
+		return c.reject(&QueryRejection{
+			Status:   http.StatusUnprocessableEntity,
+			Reason:   "query exceeds per-user budget",
+			Estimate: estimate,
+			Limit:    int64(c.userBudget),
+		})
+	}
+	if c.datasetBudget > 0 && dataset != "" && estimate.Cost > int64(c.datasetBudget) {
+		return c.reject(&QueryRejection{
+			Status:   http.StatusUnprocessableEntity,
+			Reason:   "query exceeds per-dataset budget",
+			Estimate: estimate,
+			Limit:    int64(c.datasetBudget),
+		})
+	}
+
+	deadline := time.Now().Add(c.queueTimeout)
+	waited := false
+	for {
+		wait, limit, reason := c.tryTake(user, dataset, float64(estimate.Cost))
+		if wait == 0 {
+			if waited {
+				atomic.AddInt64(&c.queued, 1)
+			}
+			atomic.AddInt64(&c.admitted, 1)
+			return nil
+		}
+
+		if time.Now().Add(wait).After(deadline) {
+			return c.reject(&QueryRejection{
+				Status:     http.StatusTooManyRequests,
+				Reason:     reason,
+				Estimate:   estimate,
+				Limit:      limit,
+				RetryAfter: wait,
+			})
+		}
+
+		waited = true
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// tryTake deducts cost from the user and dataset budgets if both can afford it.
+// Otherwise it returns how long to wait and which budget is exhausted.
+func (c *QueryAdmissionController) tryTake(user, dataset string, cost float64) (time.Duration, int64, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var userBucket, datasetBucket *costBucket
+	if c.userBudget > 0 && user != "" {
+		userBucket = c.bucket(c.users, user, c.userBudget, now)
+	}
+	if c.datasetBudget > 0 && dataset != "" {
+		datasetBucket = c.bucket(c.datasets, dataset, c.datasetBudget, now)
+	}
+
+	if userBucket != nil {
+		if wait := userBucket.waitFor(cost); wait > 0 {
+			return wait, int64(c.userBudget), "per-user query budget exhausted"
+		}
+	}
+	if datasetBucket != nil {
+		if wait := datasetBucket.waitFor(cost); wait > 0 {
+			return wait, int64(c.datasetBudget), "per-dataset query budget exhausted"
+		}
+	}
+
+	if userBucket != nil {
+		userBucket.tokens -= cost
+	}
+	if datasetBucket != nil {
+		datasetBucket.tokens -= cost
+	}
+	return 0, 0, ""
+}
+
+// bucket returns the refilled bucket for key, creating it on first use
+func (c *QueryAdmissionController) bucket(buckets map[string]*costBucket, key string, budget int, now time.Time) *costBucket {
+	b, ok := buckets[key]
+	if !ok {
+		b = newCostBucket(budget)
+		buckets[key] = b
+	}
+	b.refill(now)
+	return b
+}
+
+// reject records a rejection and returns it
+func (c *QueryAdmissionController) reject(rejection *QueryRejection) error {
+	atomic.AddInt64(&c.rejected, 1)
+	if rejection.Estimate.FullScan {
+		rejection.Hint = "add a tag, namespace or dataset filter to avoid a full scan"
+	} else {
+		rejection.Hint = "narrow the query with more selective tag filters"
+	}
+	return rejection
+}
+
+// Stats returns admission decisions since startup
+func (c *QueryAdmissionController) Stats() QueryAdmissionStats {
+	return QueryAdmissionStats{
+		Admitted: atomic.LoadInt64(&c.admitted),
+		Queued:   atomic.LoadInt64(&c.queued),
+		Rejected: atomic.LoadInt64(&c.rejected),
+	}
+}
+
+// Global instance for use in handlers
+var queryAdmission *QueryAdmissionController
+
+// InitQueryAdmission initializes the global query admission controller
+func InitQueryAdmission(cfg *config.Config) {
+	queryAdmission = NewQueryAdmissionController(cfg)
+}
+
+// GetQueryAdmission returns the global query admission controller
+func GetQueryAdmission() *QueryAdmissionController {
+	return queryAdmission
+}
+
+// admitQuery estimates the cost of a query and applies admission control.
+// It writes the error response and returns false when the query is rejected.
+func (h *EntityHandler) admitQuery(w http.ResponseWriter, r *http.Request, spec binary.QuerySpec) bool {
+	if queryAdmission == nil {
+		return true
+	}
+
+	binaryRepo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		return true // Cost cannot be estimated for this repository
+	}
+	estimate := binaryRepo.EstimateQueryCost(spec)
+
+	user := ""
+	if securityCtx, ok := GetSecurityContext(r); ok && securityCtx.User != nil {
+		user = securityCtx.User.ID
+	}
+	dataset := extractDatasetFromPath(r.URL.Path)
+	if dataset == "" {
+		dataset = r.URL.Query().Get("dataset")
+	}
+
+	if err := queryAdmission.Admit(r.Context(), user, dataset, estimate); err != nil {
+		rejection, ok := err.(*QueryRejection)
+		if !ok {
+			RespondError(w, http.StatusServiceUnavailable, "Query cancelled while waiting for admission")
+			return false
+		}
+		logger.Warn("query rejected: type=%s, cost=%d, limit=%d, user=%s, dataset=%s: %s",
+			estimate.QueryType, estimate.Cost, rejection.Limit, user, dataset, rejection.Reason)
+		if rejection.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(rejection.RetryAfter.Seconds())+1))
+		}
+		RespondJSON(w, rejection.Status, rejection)
+		return false
+	}
+
+	w.Header().Set("X-Query-Cost", strconv.FormatInt(estimate.Cost, 10))
+	return true
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Entity lists, queries and searches read under the request context, so a
+// read stops when the client disconnects. A configured query timeout also
+// bounds how long the read may take.
+
+// queryTimeout is the deadline of entity reads; zero means none
+var queryTimeout time.Duration
+
+// SetQueryTimeout sets the deadline of entity list, query and search reads
+func SetQueryTimeout(timeout time.Duration) {
+	queryTimeout = timeout
+}
+
+// queryContext returns the context of an entity read for r: the request
+// context, bounded by the query timeout when one is set
+func queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if queryTimeout > 0 {
+		return context.WithTimeout(r.Context(), queryTimeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// respondQueryStopped writes the response of a read stopped by its context
+// and reports whether err was such a stop
+func respondQueryStopped(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		RespondError(w, http.StatusServiceUnavailable, "Query deadline exceeded")
+	case errors.Is(err, context.Canceled):
+		// The client has gone away; the response is for the access log
+		RespondError(w, http.StatusServiceUnavailable, "Query cancelled")
+	default:
+		return false
+	}
+	return true
+}
+
+// responseProjection parses the fields and exclude_content parameters of a
+// list or query request
+func responseProjection(params url.Values) (*models.Projection, error) {
+	return models.ParseProjection(params.Get("fields"), params.Get("exclude_content") == "true")
+}
+
+// projectedContext lets the reads of a request leave content on disk when
+// its projection drops content and no search or content filter needs it
+func projectedContext(ctx context.Context, projection *models.Projection, params url.Values) context.Context {
+	if projection == nil || projection.Content || params.Get("search") != "" || models.IsContentPathField(params.Get("filter")) {
+		return ctx
+	}
+	return binary.WithoutContent(ctx)
+}
+
+// The helpers below hand the read context to repositories that stop long
+// reads when it ends, falling back to the plain repository methods
+
+func repoList(ctx context.Context, repo models.EntityRepository) ([]*models.Entity, error) {
+	if cancellable, ok := repo.(binary.CancellableRepository); ok {
+		return cancellable.ListContext(ctx)
+	}
+	return repo.List()
+}
+
+func repoListByTag(ctx context.Context, repo models.EntityRepository, tag string) ([]*models.Entity, error) {
+	if cancellable, ok := repo.(binary.CancellableRepository); ok {
+		return cancellable.ListByTagContext(ctx, tag)
+	}
+	return repo.ListByTag(tag)
+}
+
+func repoSearchContent(ctx context.Context, repo models.EntityRepository, searchText string) ([]*models.Entity, error) {
+	if cancellable, ok := repo.(binary.CancellableRepository); ok {
+		return cancellable.SearchContentContext(ctx, searchText)
+	}
+	return repo.SearchContent(searchText)
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"fmt"
+	"net/http"
+)
+
+// RecoveryHandler lets operators diagnose storage corruption, inspect
+// quarantined entities and force an index rebuild without shell access to
+// the data directory
+type RecoveryHandler struct {
+	repo models.EntityRepository
+	jobs *JobManager
+}
+
+// recoveryJobType identifies storage diagnosis and rebuild jobs
+const recoveryJobType = "storage-recovery"
+
+// NewRecoveryHandler creates a new recovery handler
+func NewRecoveryHandler(repo models.EntityRepository, jobs *JobManager) *RecoveryHandler {
+	return &RecoveryHandler{repo: repo, jobs: jobs}
+}
+
+// RecoveryStatusResponse describes the last recovery run and the quarantine
+type RecoveryStatusResponse struct {
+	LastReport  *binary.RecoveryReport `json:"last_report"`
+	Quarantined int                    `json:"quarantined"`
+	Job         string                 `json:"job,omitempty"`
+}
+
+// QuarantineResponse lists the quarantined entities
+type QuarantineResponse struct {
+	Entities []binary.QuarantinedEntity `json:"entities"`
+	Count    int                        `json:"count"`
+}
+
+// GetRecoveryStatus reports the last diagnosis or rebuild
+// @Summary Get storage recovery status
+// @Description Return the report of the most recent diagnosis or forced rebuild (null when none has run since startup), the number of quarantined entities and the running recovery job, if any.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} RecoveryStatusResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/recovery [get]
+func (h *RecoveryHandler) GetRecoveryStatus(w http.ResponseWriter, r *http.Request) {
+	repo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Repository does not support recovery")
+		return
+	}
+	response := RecoveryStatusResponse{
+		LastReport:  repo.LastRecoveryReport(),
+		Quarantined: len(repo.QuarantinedEntities()),
+	}
+	if active, ok := h.jobs.Active(recoveryJobType); ok {
+		response.Job = active.Status().ID
+	}
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// ListQuarantine lists the quarantined entities
+// @Summary List quarantined entities
+// @Description List entities whose stored records failed a check, most recently detected first: an index entry outside the data file, a record that does not decode, content that does not match its checksum, or a read that failed at runtime. An entity is released when a later diagnosis reads it cleanly.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} QuarantineResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/recovery/quarantine [get]
+func (h *RecoveryHandler) ListQuarantine(w http.ResponseWriter, r *http.Request) {
+	repo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Repository does not support recovery")
+		return
+	}
+	entities := repo.QuarantinedEntities()
+	RespondJSON(w, http.StatusOK, QuarantineResponse{Entities: entities, Count: len(entities)})
+}
+
+// RunDiagnosis queues a diagnosis of every entity record
+// @Summary Diagnose storage
+// @Description Check every entity record in the data file, quarantining entities that fail and releasing quarantined entities that now read cleanly. Progress and the RecoveryReport are reported by /api/v1/jobs/{id}.
+// @Tags admin
+// @Produce json
+// @Success 202 {object} JobStatus
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/recovery/diagnose [post]
+func (h *RecoveryHandler) RunDiagnosis(w http.ResponseWriter, r *http.Request) {
+	h.submit(w, r, "diagnosis", (*binary.EntityRepository).DiagnoseStorage)
+}
+
+// ForceRebuild queues an index repair and rebuild followed by a diagnosis
+// @Summary Force a storage rebuild
+// @Description Repair index entries pointing outside the data file, rebuild the in-memory indexes from the data file and diagnose every record. Reads and writes continue meanwhile. Progress and the RecoveryReport are reported by /api/v1/jobs/{id}.
+// @Tags admin
+// @Produce json
+// @Success 202 {object} JobStatus
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/recovery/rebuild [post]
+func (h *RecoveryHandler) ForceRebuild(w http.ResponseWriter, r *http.Request) {
+	h.submit(w, r, "rebuild", (*binary.EntityRepository).ForceRecoveryRebuild)
+}
+
+// recoveryRun is a diagnosis or rebuild of the repository
+type recoveryRun func(*binary.EntityRepository, context.Context, binary.RecoveryProgressFunc) (*binary.RecoveryReport, error)
+
+// submit queues run as a recovery job
+func (h *RecoveryHandler) submit(w http.ResponseWriter, r *http.Request, action string, run recoveryRun) {
+	repo, err := asTemporalRepository(h.repo)
+	if err != nil {
+		RespondError(w, http.StatusNotImplemented, "Repository does not support recovery")
+		return
+	}
+	if active, ok := h.jobs.Active(recoveryJobType); ok {
+		RespondError(w, http.StatusConflict, "Storage recovery already in progress: job "+active.Status().ID)
+		return
+	}
+
+	job, err := h.jobs.Submit(recoveryJobType, requestUserID(r), func(job *Job) error {
+		report, err := run(repo, job.Context(), func(processed, total int, entityID string, err error) {
+			if err != nil {
+				job.AddError(fmt.Errorf("%s: %w", entityID, err))
+			}
+			job.SetProgress(int64(processed), int64(total))
+		})
+		if report != nil {
+			job.SetResult(report)
+		}
+		return err
+	})
+	if err != nil {
+		RespondError(w, http.StatusServiceUnavailable, "Failed to queue storage "+action+": "+err.Error())
+		return
+	}
+
+	logger.Info("Storage %s queued as job %s", action, job.Status().ID)
+	RespondJSON(w, http.StatusAccepted, job.Status())
+}
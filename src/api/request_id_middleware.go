@@ -0,0 +1,58 @@
+package api
+
+import (
+	"entitydb/logger"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID clients and logs correlate on
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware gives every request an ID, echoed in the X-Request-ID
+// response header and attached to the request context so messages logged
+// with it carry the request, user and entity IDs
+type RequestIDMiddleware struct{}
+
+// NewRequestIDMiddleware creates a new request ID middleware
+func NewRequestIDMiddleware() *RequestIDMiddleware {
+	return &RequestIDMiddleware{}
+}
+
+// Middleware returns the HTTP middleware function
+func (m *RequestIDMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Keep the ID of a proxy or client that already assigned one
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := logger.NewRequestContext(r.Context(), requestID)
+		if strings.HasPrefix(r.URL.Path, "/api/v1/entities/") {
+			if entityID := auditTargetID(r, nil); entityID != "" {
+				logger.SetEntityID(ctx, entityID)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID reports whether a client-supplied ID is safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
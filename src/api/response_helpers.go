@@ -2,7 +2,9 @@ package api
 
 import (
 	"encoding/json"
+	"entitydb/storage/binary"
 	"entitydb/storage/pools"
+	"errors"
 	"io"
 	"net/http"
 )
@@ -54,4 +56,20 @@ func DecodeJSONWithOptions(r io.Reader, v interface{}, disallowUnknownFields boo
 	
 	// Decode the JSON
 	return decoder.Decode(v)
-}
\ No newline at end of file
+}
+
+// isImmutableWrite reports whether the repository refused a write because
+// the entity is under legal hold or in a write-once dataset
+func isImmutableWrite(err error) bool {
+	return errors.Is(err, binary.ErrLegalHold) || errors.Is(err, binary.ErrWriteOnce)
+}
+
+// immutableRefused responds with 409 Conflict when the repository refused a
+// write as immutable. It reports whether a response was written.
+func immutableRefused(w http.ResponseWriter, err error) bool {
+	if !isImmutableWrite(err) {
+		return false
+	}
+	RespondError(w, http.StatusConflict, err.Error())
+	return true
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/services"
+	"net/http"
+)
+
+// RetentionHandler exposes the retention service's policies, statistics and manual runs
+type RetentionHandler struct {
+	service *services.RetentionService
+	jobs    *JobManager
+}
+
+// retentionJobType identifies retention runs submitted as jobs
+const retentionJobType = "retention"
+
+// NewRetentionHandler creates a new retention handler
+func NewRetentionHandler(service *services.RetentionService, jobs *JobManager) *RetentionHandler {
+	return &RetentionHandler{service: service, jobs: jobs}
+}
+
+// RetentionStatusResponse describes the retention service and its policies
+type RetentionStatusResponse struct {
+	Enabled  bool                          `json:"enabled"`
+	DryRun   bool                          `json:"dry_run"`
+	Policies []services.TagRetentionPolicy `json:"policies"`
+	Stats    services.RetentionStats       `json:"stats"`
+}
+
+// GetRetentionStatus lists retention policies and service statistics
+// @Summary Get retention status
+// @Description List retention policy entities as parsed by the retention service, with service statistics
+// @Tags admin
+// @Produce json
+// @Success 200 {object} RetentionStatusResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/retention [get]
+func (h *RetentionHandler) GetRetentionStatus(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.service.LoadPolicies()
+	if err != nil {
+		logger.Error("Failed to load retention policies: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to load retention policies")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, RetentionStatusResponse{
+		Enabled:  h.service.IsEnabled(),
+		DryRun:   h.service.IsDryRun(),
+		Policies: policies,
+		Stats:    h.service.GetStats(),
+	})
+}
+
+// RunRetention applies retention policies immediately
+// @Summary Run retention
+// @Description Apply retention policies now. With dry_run=true nothing is changed and the response reports what would be pruned. With async=true the run is queued as a job and its result is reported by /api/v1/jobs/{id}.
+// @Tags admin
+// @Produce json
+// @Param dry_run query bool false "Only report what would be pruned"
+// @Param async query bool false "Queue the run as a background job"
+// @Success 200 {object} services.RetentionRunResult
+// @Success 202 {object} JobStatus
+// @Security BearerAuth
+// @Router /api/v1/admin/retention/run [post]
+func (h *RetentionHandler) RunRetention(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	if r.URL.Query().Get("async") == "true" {
+		job, err := h.jobs.Submit(retentionJobType, requestUserID(r), func(job *Job) error {
+			result, err := h.service.RunOnce(dryRun)
+			if result != nil {
+				job.SetResult(result)
+			}
+			return err
+		})
+		if err != nil {
+			RespondError(w, http.StatusServiceUnavailable, "Failed to queue retention run: "+err.Error())
+			return
+		}
+		RespondJSON(w, http.StatusAccepted, job.Status())
+		return
+	}
+
+	result, err := h.service.RunOnce(dryRun)
+	if err != nil && result == nil {
+		logger.Error("Retention run failed: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Retention run failed: "+err.Error())
+		return
+	}
+	if err != nil {
+		// The cycle hit its runtime limit; report the partial result
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	RespondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/services"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SandboxHandler manages sandbox datasets, which are wiped and reseeded
+// from a template bundle on a schedule or on request
+type SandboxHandler struct {
+	service *services.SandboxService
+}
+
+// NewSandboxHandler creates a new sandbox handler
+func NewSandboxHandler(service *services.SandboxService) *SandboxHandler {
+	return &SandboxHandler{service: service}
+}
+
+// SandboxRequest creates a sandbox
+type SandboxRequest struct {
+	Name          string `json:"name"`
+	Template      string `json:"template,omitempty"`
+	ResetInterval string `json:"reset_interval,omitempty"`
+}
+
+// SandboxListResponse lists sandboxes and the available templates
+type SandboxListResponse struct {
+	Sandboxes []services.Sandbox `json:"sandboxes"`
+	Templates []string           `json:"templates"`
+}
+
+// SandboxCreateResponse describes a new sandbox and its initial seeding
+type SandboxCreateResponse struct {
+	Sandbox services.Sandbox            `json:"sandbox"`
+	Reset   services.SandboxResetResult `json:"reset"`
+}
+
+// ListSandboxes lists sandbox datasets
+// @Summary List sandboxes
+// @Description List sandbox datasets with their reset schedules, and the template bundles available for new sandboxes
+// @Tags datasets
+// @Produce json
+// @Success 200 {object} SandboxListResponse
+// @Security BearerAuth
+// @Router /api/v1/sandboxes [get]
+func (h *SandboxHandler) ListSandboxes(w http.ResponseWriter, r *http.Request) {
+	sandboxes, err := h.service.LoadSandboxes()
+	if err != nil {
+		logger.Error("Failed to list sandboxes: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to list sandboxes")
+		return
+	}
+	RespondJSON(w, http.StatusOK, SandboxListResponse{
+		Sandboxes: sandboxes,
+		Templates: h.service.Templates(),
+	})
+}
+
+// CreateSandbox creates a sandbox dataset and seeds it from its template
+// @Summary Create sandbox
+// @Description Create a sandbox dataset seeded from a template bundle (<template>.jsonl in the sandbox template directory). With reset_interval the sandbox is wiped and reseeded on that schedule. Users need rbac:perm:sandbox:<name> to use it.
+// @Tags datasets
+// @Accept json
+// @Produce json
+// @Param request body SandboxRequest true "Sandbox"
+// @Success 201 {object} SandboxCreateResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/sandboxes [post]
+func (h *SandboxHandler) CreateSandbox(w http.ResponseWriter, r *http.Request) {
+	var req SandboxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	sandbox, result, err := h.service.Create(req.Name, req.Template, req.ResetInterval)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSandboxExists):
+			RespondError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, services.ErrInvalidSandbox), errors.Is(err, services.ErrTemplateNotFound):
+			RespondError(w, http.StatusBadRequest, err.Error())
+		default:
+			logger.Error("Failed to create sandbox %s: %v", req.Name, err)
+			RespondError(w, http.StatusInternalServerError, "Failed to create sandbox: "+err.Error())
+		}
+		return
+	}
+	RespondJSON(w, http.StatusCreated, SandboxCreateResponse{Sandbox: *sandbox, Reset: *result})
+}
+
+// ResetSandbox wipes a sandbox and reseeds it from its template
+// @Summary Reset sandbox
+// @Description Delete every entity of a sandbox dataset and seed it again from its template bundle
+// @Tags datasets
+// @Produce json
+// @Param dataset path string true "Sandbox name"
+// @Success 200 {object} services.SandboxResetResult
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/datasets/{dataset}/reset [post]
+func (h *SandboxHandler) ResetSandbox(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["dataset"]
+	result, err := h.service.Reset(name)
+	if err != nil {
+		if errors.Is(err, services.ErrSandboxNotFound) {
+			RespondError(w, http.StatusNotFound, "Dataset is not a sandbox")
+			return
+		}
+		logger.Error("Failed to reset sandbox %s: %v", name, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to reset sandbox: "+err.Error())
+		return
+	}
+	logger.Info("Sandbox %s reset: deleted %d, seeded %d", name, result.Deleted, result.Seeded)
+	RespondJSON(w, http.StatusOK, result)
+}
+
+// DeleteSandbox deletes a sandbox and all of its entities
+// @Summary Delete sandbox
+// @Description Delete a sandbox dataset and every entity in it
+// @Tags datasets
+// @Produce json
+// @Param name path string true "Sandbox name"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/sandboxes/{name} [delete]
+func (h *SandboxHandler) DeleteSandbox(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	deleted, err := h.service.Delete(name)
+	if err != nil {
+		if errors.Is(err, services.ErrSandboxNotFound) {
+			RespondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		logger.Error("Failed to delete sandbox %s: %v", name, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to delete sandbox: "+err.Error())
+		return
+	}
+	RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"sandbox": name,
+		"deleted": deleted,
+	})
+}
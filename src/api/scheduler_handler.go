@@ -0,0 +1,120 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// SchedulerHandler exposes the scheduler's schedules, run history and
+// manual runs
+type SchedulerHandler struct {
+	service *services.SchedulerService
+}
+
+// NewSchedulerHandler creates a new scheduler handler
+func NewSchedulerHandler(service *services.SchedulerService) *SchedulerHandler {
+	return &SchedulerHandler{service: service}
+}
+
+// SchedulerStatusResponse describes the scheduler and its schedules
+type SchedulerStatusResponse struct {
+	Enabled   bool                    `json:"enabled"`
+	Schedules []services.Schedule     `json:"schedules"`
+	Stats     services.SchedulerStats `json:"stats"`
+}
+
+// ScheduleRunsResponse lists the recorded runs of a schedule
+type ScheduleRunsResponse struct {
+	ScheduleID string                 `json:"schedule_id"`
+	Runs       []services.ScheduleRun `json:"runs"`
+	Total      int                    `json:"total"`
+}
+
+// GetSchedulerStatus lists schedules and scheduler statistics
+// @Summary Get scheduler status
+// @Description List schedule entities as parsed by the scheduler, with their next run time and scheduler statistics
+// @Tags admin
+// @Produce json
+// @Success 200 {object} SchedulerStatusResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/schedules [get]
+func (h *SchedulerHandler) GetSchedulerStatus(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.service.LoadSchedules()
+	if err != nil {
+		logger.Error("Failed to load schedules: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to load schedules")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, SchedulerStatusResponse{
+		Enabled:   h.service.IsEnabled(),
+		Schedules: schedules,
+		Stats:     h.service.GetStats(),
+	})
+}
+
+// RunSchedule runs a schedule immediately
+// @Summary Run schedule
+// @Description Run a schedule's action now, as the schedule's owner, and wait for it to finish. Disabled schedules can be run this way too.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Schedule entity ID"
+// @Success 200 {object} services.ScheduleRun
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/schedules/{id}/run [post]
+func (h *SchedulerHandler) RunSchedule(w http.ResponseWriter, r *http.Request) {
+	run, err := h.service.RunNow(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, services.ErrScheduleNotFound):
+		RespondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidSchedule):
+		RespondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrScheduleRunning):
+		RespondError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		logger.Error("Failed to run schedule: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to run schedule")
+	default:
+		RespondJSON(w, http.StatusOK, run)
+	}
+}
+
+// ListScheduleRuns lists the recorded runs of a schedule
+// @Summary List schedule runs
+// @Description List the run records of a schedule, newest first. At most ENTITYDB_SCHEDULER_HISTORY_LIMIT runs are kept per schedule.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Schedule entity ID"
+// @Param limit query int false "Maximum runs to return"
+// @Success 200 {object} ScheduleRunsResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/schedules/{id}/runs [get]
+func (h *SchedulerHandler) ListScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	runs, err := h.service.ListRuns(id)
+	if err != nil {
+		logger.Error("Failed to list runs of schedule %s: %v", id, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to list schedule runs")
+		return
+	}
+	total := len(runs)
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			RespondError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		if limit > 0 && limit < len(runs) {
+			runs = runs[:limit]
+		}
+	}
+	RespondJSON(w, http.StatusOK, ScheduleRunsResponse{ScheduleID: id, Runs: runs, Total: total})
+}
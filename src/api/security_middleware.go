@@ -6,12 +6,26 @@ import (
 	"net/http"
 	"strings"
 
+	"entitydb/logger"
 	"entitydb/models"
 )
 
 // SecurityMiddleware replaces the old RBAC middleware with relationship-based security
 type SecurityMiddleware struct {
 	securityManager *models.SecurityManager
+	authzHook       AuthorizationHook
+	sandboxes       SandboxRegistry
+	publicDatasets  PublicDatasetRegistry
+}
+
+// SandboxRegistry reports which datasets are sandboxes
+type SandboxRegistry interface {
+	IsSandbox(dataset string) bool
+}
+
+// PublicDatasetRegistry reports which datasets are published read-only
+type PublicDatasetRegistry interface {
+	IsPublicDataset(dataset string) bool
 }
 
 // NewSecurityMiddleware creates a new security middleware
@@ -21,6 +35,37 @@ func NewSecurityMiddleware(securityManager *models.SecurityManager) *SecurityMid
 	}
 }
 
+// SetAuthorizationHook delegates permission checks to hook. Local RBAC still
+// decides when the hook abstains or fails.
+func (sm *SecurityMiddleware) SetAuthorizationHook(hook AuthorizationHook) {
+	sm.authzHook = hook
+}
+
+// SetSandboxes makes dataset routes of sandboxes require
+// sandbox:<dataset> instead of the route's own permission
+func (sm *SecurityMiddleware) SetSandboxes(sandboxes SandboxRegistry) {
+	sm.sandboxes = sandboxes
+}
+
+// SetPublicDatasets lets requests without credentials read the entities of
+// datasets published read-only
+func (sm *SecurityMiddleware) SetPublicDatasets(datasets PublicDatasetRegistry) {
+	sm.publicDatasets = datasets
+}
+
+// publicRead reports whether r is an anonymous read of a dataset published
+// read-only. Requests with credentials are authenticated as usual, so users
+// keep their own view of the dataset.
+func (sm *SecurityMiddleware) publicRead(r *http.Request) bool {
+	if sm.publicDatasets == nil || r.Header.Get("Authorization") != "" {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return sm.publicDatasets.IsPublicDataset(extractDatasetFromPath(r.URL.Path))
+}
+
 // SecurityContext stores security information in the request context
 type SecurityContext struct {
 	User    *models.SecurityUser
@@ -56,6 +101,14 @@ func (sm *SecurityMiddleware) RequireAuthentication(next http.HandlerFunc) http.
 			return
 		}
 
+		noteAuditActor(r.Context(), user)
+		logger.SetUserID(r.Context(), user.ID)
+
+		if user.Scope != "" && !scopeAllows(r, user.Scope) {
+			RespondError(w, http.StatusForbidden, fmt.Sprintf("Session is scoped to dataset %s", user.Scope))
+			return
+		}
+
 		// Create security context
 		securityCtx := &SecurityContext{
 			User:  user,
@@ -70,6 +123,19 @@ func (sm *SecurityMiddleware) RequireAuthentication(next http.HandlerFunc) http.
 	}
 }
 
+// scopeAllows reports whether a session scoped to dataset may make request
+// r: only auth endpoints, changing the user's own password and the routes of
+// that dataset, except copying or moving it to another dataset
+func scopeAllows(r *http.Request, dataset string) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/v1/auth/") || r.URL.Path == "/api/v1/users/change-password" {
+		return true
+	}
+	if extractDatasetFromPath(r.URL.Path) != dataset {
+		return false
+	}
+	return !strings.HasSuffix(r.URL.Path, "/clone") && !strings.HasSuffix(r.URL.Path, "/promote")
+}
+
 // RequirePermission creates middleware that checks for specific permissions using relationship traversal
 func (sm *SecurityMiddleware) RequirePermission(resource, action string) MiddlewareFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
@@ -82,8 +148,8 @@ func (sm *SecurityMiddleware) RequirePermission(resource, action string) Middlew
 				return
 			}
 
-			// Check permission using relationship traversal
-			hasPermission, err := sm.securityManager.HasPermission(securityCtx.User, resource, action)
+			// Check permission through the authorization hook or relationship traversal
+			hasPermission, err := sm.authorize(r, securityCtx.User, resource, action, "")
 			if err != nil {
 				RespondError(w, http.StatusInternalServerError, "Failed to check permissions")
 				return
@@ -114,21 +180,20 @@ func (sm *SecurityMiddleware) RequirePermissionInDataset(resource, action string
 				return
 			}
 
-			// Extract dataset ID from request path or query parameters
-			datasetID := r.URL.Query().Get("dataset_id")
+			// Extract dataset ID from the path of REST-style URLs like
+			// /datasets/{id}/entities, which the handlers act on, else from
+			// the query; permissions granted within another dataset named in
+			// the query must not authorize the path's dataset
+			datasetID := extractDatasetFromPath(r.URL.Path)
 			if datasetID == "" {
-				// Try to extract from path for REST-style URLs like /datasets/{id}/entities
-				pathParts := strings.Split(r.URL.Path, "/")
-				for i, part := range pathParts {
-					if part == "datasets" && i+1 < len(pathParts) {
-						datasetID = pathParts[i+1]
-						break
-					}
-				}
+				datasetID = r.URL.Query().Get("dataset_id")
 			}
 
-			// Check permission using relationship traversal with dataset context
-			hasPermission, err := sm.securityManager.HasPermissionInDataset(securityCtx.User, resource, action, datasetID)
+			// Sandboxes are isolated: only users granted the sandbox may use it
+			resource, action := sm.datasetPermission(resource, action, datasetID)
+
+			// Check permission through the authorization hook or relationship traversal with dataset context
+			hasPermission, err := sm.authorize(r, securityCtx.User, resource, action, datasetID)
 			if err != nil {
 				RespondError(w, http.StatusInternalServerError, "Failed to check permissions")
 				return
@@ -148,8 +213,39 @@ func (sm *SecurityMiddleware) RequirePermissionInDataset(resource, action string
 			next(w, r)
 		})
 
-		return authHandler
+		// Entity reads of datasets published read-only need no credentials;
+		// every other permission does
+		if resource != "entity" || action != "view" {
+			return authHandler
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			if sm.publicRead(r) {
+				next(w, r)
+				return
+			}
+			authHandler(w, r)
+		}
+	}
+}
+
+// datasetPermission returns the permission that grants resource:action in
+// a dataset, which in a sandbox is sandbox:<dataset>. Administering a
+// sandbox's permissions takes dataset:admin like in any other dataset.
+func (sm *SecurityMiddleware) datasetPermission(resource, action, dataset string) (string, string) {
+	if resource == "dataset" && action == "admin" {
+		return resource, action
+	}
+	if dataset != "" && sm.sandboxes != nil && sm.sandboxes.IsSandbox(dataset) {
+		return "sandbox", dataset
 	}
+	return resource, action
+}
+
+// authorizeInDataset checks resource:action in a dataset for handlers that
+// span several datasets, applying the rules of RequirePermissionInDataset
+func (sm *SecurityMiddleware) authorizeInDataset(r *http.Request, user *models.SecurityUser, resource, action, dataset string) (bool, error) {
+	resource, action = sm.datasetPermission(resource, action, dataset)
+	return sm.authorize(r, user, resource, action, dataset)
 }
 
 // RequireDatasetAccess creates middleware that checks if user can access a specific dataset
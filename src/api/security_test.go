@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"entitydb/config"
+	"entitydb/models"
+	"entitydb/storage/binary"
+)
+
+// testSecurity is a repository with a security manager and middleware, for
+// handler tests that authenticate real sessions
+type testSecurity struct {
+	repo       *binary.EntityRepository
+	manager    *models.SecurityManager
+	middleware *SecurityMiddleware
+}
+
+func newTestSecurity(t *testing.T) *testSecurity {
+	t.Helper()
+	cfg := config.Load()
+	cfg.DataPath = t.TempDir()
+	cfg.DatabaseFilename = filepath.Join(cfg.DataPath, "entities.edb")
+	cfg.WALFilename = filepath.Join(cfg.DataPath, "entitydb.wal")
+	cfg.IndexFilename = filepath.Join(cfg.DataPath, "entities.edb.idx")
+	repo, err := binary.NewEntityRepositoryWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	manager := models.NewSecurityManager(repo)
+	manager.SetMFAKey(bytes.Repeat([]byte{7}, 32), "entitydb-test")
+	return &testSecurity{repo: repo, manager: manager, middleware: NewSecurityMiddleware(manager)}
+}
+
+// login creates a user and a session for it. The admin user holds every
+// permission; other users can view, create and update entities only.
+func (s *testSecurity) login(t *testing.T, username string) (*models.SecurityUser, string) {
+	t.Helper()
+	user, err := s.manager.CreateUser(username, "password-"+username, username+"@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser %s: %v", username, err)
+	}
+	session, err := s.manager.CreateSession(user, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("CreateSession %s: %v", username, err)
+	}
+	return user, session.Token
+}
+
+// authorizedRequest returns a request carrying token as a bearer token, if set
+func authorizedRequest(method, target, token string, body []byte) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
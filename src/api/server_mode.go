@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server modes
+const (
+	ModeReadWrite = "read_write"
+	ModeReadOnly  = "read_only"
+)
+
+// readOnlyExemptPaths accept POST while the server is read-only: requests
+// that only read data, session handling so operators can sign in to leave
+// the mode, and the mode endpoint itself
+var readOnlyExemptPaths = map[string]bool{
+	"/api/v1/admin/mode":                  true,
+	"/api/v1/auth/login":                  true,
+	"/api/v1/auth/logout":                 true,
+	"/api/v1/auth/refresh":                true,
+	"/api/v1/entities/search":             true,
+	"/api/v1/entities/export":             true,
+	"/api/v1/graph/query":                 true,
+	"/api/v1/graphql":                     true,
+	"/api/v1/admin/standby/verify":        true,
+	"/api/v1/admin/standby/verify-backup": true,
+	"/api/v1/admin/log-level":             true,
+	"/api/v1/admin/trace-subsystems":      true,
+}
+
+// ServerMode switches the server between normal operation and read-only
+// mode. While read-only, mutating REST requests are refused with 503 and
+// mutating gRPC calls with Unavailable, and reads are served as usual, so
+// writes can be frozen for migrations, compaction or restores without
+// stopping the server. Background services that write on their own
+// schedule, such as retention, the scheduler and metrics rollups, skip
+// their runs while read-only; metrics collection continues.
+type ServerMode struct {
+	readOnly atomic.Bool
+	rejected atomic.Int64
+
+	mu        sync.RWMutex
+	reason    string
+	since     time.Time
+	changedBy string
+}
+
+// ServerModeStatus describes the current mode
+type ServerModeStatus struct {
+	Mode             string    `json:"mode"`
+	Reason           string    `json:"reason,omitempty"`
+	Since            time.Time `json:"since"`
+	ChangedBy        string    `json:"changed_by,omitempty"`
+	RejectedRequests int64     `json:"rejected_requests"`
+}
+
+// SetServerModeRequest changes the server mode
+type SetServerModeRequest struct {
+	Mode   string `json:"mode"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewServerMode creates a server mode, read-only when readOnly is set
+func NewServerMode(readOnly bool) *ServerMode {
+	m := &ServerMode{since: time.Now()}
+	if readOnly {
+		m.readOnly.Store(true)
+		m.reason = "started read-only by configuration"
+	}
+	return m
+}
+
+// ReadOnly reports whether mutating requests are refused
+func (m *ServerMode) ReadOnly() bool {
+	return m.readOnly.Load()
+}
+
+// Set changes the mode. Setting the current mode only updates the reason.
+func (m *ServerMode) Set(mode, reason, changedBy string) error {
+	var readOnly bool
+	switch mode {
+	case ModeReadWrite:
+	case ModeReadOnly:
+		readOnly = true
+	default:
+		return fmt.Errorf("unknown mode %q, expected %s or %s", mode, ModeReadWrite, ModeReadOnly)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.readOnly.Load() != readOnly {
+		m.since = time.Now()
+		m.rejected.Store(0)
+	}
+	m.reason = reason
+	m.changedBy = changedBy
+	m.readOnly.Store(readOnly)
+	return nil
+}
+
+// Status returns the current mode
+func (m *ServerMode) Status() ServerModeStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := ServerModeStatus{
+		Mode:             ModeReadWrite,
+		Reason:           m.reason,
+		Since:            m.since,
+		ChangedBy:        m.changedBy,
+		RejectedRequests: m.rejected.Load(),
+	}
+	if m.readOnly.Load() {
+		status.Mode = ModeReadOnly
+	}
+	return status
+}
+
+// rejectMessage explains a refused write
+func (m *ServerMode) rejectMessage() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.reason == "" {
+		return "Server is in read-only mode"
+	}
+	return "Server is in read-only mode: " + m.reason
+}
+
+// Middleware refuses mutating requests with 503 while the server is
+// read-only, except on the exempt paths
+func (m *ServerMode) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.readOnly.Load() && mutatingMethod(r.Method) && !readOnlyExemptPaths[strings.TrimSuffix(r.URL.Path, "/")] {
+			m.rejected.Add(1)
+			w.Header().Set("Retry-After", "30")
+			RespondError(w, http.StatusServiceUnavailable, m.rejectMessage())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkGRPCWrite refuses a mutating gRPC method while the server is
+// read-only. Methods that only need view permission are reads.
+func (m *ServerMode) checkGRPCWrite(fullMethod string) error {
+	if m == nil || !m.readOnly.Load() || grpcMethodPermissions[fullMethod].action == "view" {
+		return nil
+	}
+	m.rejected.Add(1)
+	return status.Error(codes.Unavailable, m.rejectMessage())
+}
+
+// GetMode returns the server mode
+// @Summary Get server mode
+// @Description Whether the server accepts writes or is read-only, why, and how many writes were refused
+// @Tags admin
+// @Produce json
+// @Success 200 {object} ServerModeStatus
+// @Security BearerAuth
+// @Router /api/v1/admin/mode [get]
+func (m *ServerMode) GetMode(w http.ResponseWriter, r *http.Request) {
+	RespondJSON(w, http.StatusOK, m.Status())
+}
+
+// SetMode switches the server between read_write and read_only
+// @Summary Set server mode
+// @Description Freeze writes (read_only) or resume them (read_write). Read-only mode refuses mutating requests with 503 while serving reads.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body SetServerModeRequest true "Mode and reason"
+// @Success 200 {object} ServerModeStatus
+// @Failure 400 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/mode [post]
+func (m *ServerMode) SetMode(w http.ResponseWriter, r *http.Request) {
+	var req SetServerModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	changedBy := ""
+	if securityCtx, ok := GetSecurityContext(r); ok && securityCtx.User != nil {
+		changedBy = securityCtx.User.Username
+	}
+	if err := m.Set(req.Mode, req.Reason, changedBy); err != nil {
+		RespondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logger.Info("Server mode set to %s by %s (reason: %s)", req.Mode, changedBy, req.Reason)
+	RespondJSON(w, http.StatusOK, m.Status())
+}
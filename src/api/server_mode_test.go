@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestReadOnlyGraphQL checks that GraphQL queries, which only read, are
+// answered while the server is read-only and entity writes are refused
+func TestReadOnlyGraphQL(t *testing.T) {
+	security := newTestSecurity(t)
+	_, token := security.login(t, "admin")
+	entity := &models.Entity{ID: "doc-1", Tags: []string{"type:document", "dataset:default"}}
+	if err := security.repo.Create(entity); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := security.repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	mode := NewServerMode(true)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/graphql", security.middleware.RequirePermission("entity", "view")(NewGraphQLHandler(security.repo).Query))
+	mux.HandleFunc("/api/v1/entities/create", security.middleware.RequirePermission("entity", "create")(NewEntityHandler(security.repo).CreateEntity))
+	handler := mode.Middleware(mux)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, authorizedRequest("POST", "/api/v1/graphql", token, []byte(`{"query":"{ entity(id: \"doc-1\") { id type } }"}`)))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"doc-1"`) {
+		t.Fatalf("GraphQL query while read-only = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, authorizedRequest("POST", "/api/v1/entities/create", token, []byte(`{"tags":["type:document"]}`)))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("create while read-only = %d, want 503: %s", recorder.Code, recorder.Body)
+	}
+}
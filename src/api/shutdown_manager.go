@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"entitydb/logger"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownManager coordinates a graceful shutdown. Once draining starts,
+// mutating requests are refused with 503 so no new work is buffered, the
+// requests already in flight are waited for, and the registered steps
+// flush buffered work in order. Everything runs within the caller's
+// deadline; steps not finished by then are reported as timed out.
+type ShutdownManager struct {
+	draining atomic.Bool
+	inFlight atomic.Int64
+	rejected atomic.Int64
+
+	mu    sync.Mutex
+	steps []shutdownStep
+}
+
+// shutdownStep flushes or stops one component, returning how many items
+// it flushed
+type shutdownStep struct {
+	name string
+	run  func() (int, error)
+}
+
+// ShutdownReport records what a drain did
+type ShutdownReport struct {
+	StartedAt        time.Time            `json:"started_at"`
+	Duration         time.Duration        `json:"duration"`
+	InFlightAtStart  int64                `json:"in_flight_at_start"`
+	InFlightAtEnd    int64                `json:"in_flight_at_end"`
+	RejectedRequests int64                `json:"rejected_requests"`
+	Steps            []ShutdownStepReport `json:"steps"`
+	TimedOut         bool                 `json:"timed_out"`
+}
+
+// ShutdownStepReport records one drain step
+type ShutdownStepReport struct {
+	Name     string        `json:"name"`
+	Flushed  int           `json:"flushed"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	TimedOut bool          `json:"timed_out,omitempty"`
+}
+
+// NewShutdownManager creates a shutdown manager with no steps
+func NewShutdownManager() *ShutdownManager {
+	return &ShutdownManager{}
+}
+
+// Register adds a step run after in-flight requests finish. Steps run in
+// registration order, so components that write into others come first.
+func (m *ShutdownManager) Register(name string, run func() (int, error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.steps = append(m.steps, shutdownStep{name: name, run: run})
+}
+
+// Draining reports whether shutdown has begun
+func (m *ShutdownManager) Draining() bool {
+	return m.draining.Load()
+}
+
+// InFlight returns the number of requests being served
+func (m *ShutdownManager) InFlight() int64 {
+	return m.inFlight.Load()
+}
+
+// Middleware counts in-flight requests and, while draining, refuses
+// mutating ones with 503 and closes the connection
+func (m *ShutdownManager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.draining.Load() && mutatingMethod(r.Method) {
+			m.rejected.Add(1)
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "5")
+			RespondError(w, http.StatusServiceUnavailable, "Server is shutting down")
+			return
+		}
+
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mutatingMethod reports whether requests with method may change data
+func mutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Drain stops accepting writes, waits for in-flight requests and runs the
+// registered steps until ctx expires. It only returns the report; the
+// caller logs it and stops the HTTP server.
+func (m *ShutdownManager) Drain(ctx context.Context) ShutdownReport {
+	m.draining.Store(true)
+	report := ShutdownReport{StartedAt: time.Now(), InFlightAtStart: m.inFlight.Load()}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for m.inFlight.Load() > 0 && ctx.Err() == nil {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+	}
+	report.InFlightAtEnd = m.inFlight.Load()
+
+	m.mu.Lock()
+	steps := append([]shutdownStep(nil), m.steps...)
+	m.mu.Unlock()
+
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			report.TimedOut = true
+			report.Steps = append(report.Steps, ShutdownStepReport{Name: step.name, TimedOut: true})
+			continue
+		}
+
+		stepReport := ShutdownStepReport{Name: step.name}
+		start := time.Now()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			flushed, err := step.run()
+			stepReport.Flushed = flushed
+			if err != nil {
+				stepReport.Error = err.Error()
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			// The step keeps running; the process is about to exit
+			report.TimedOut = true
+			report.Steps = append(report.Steps, ShutdownStepReport{Name: step.name, Duration: time.Since(start), TimedOut: true})
+			continue
+		}
+		stepReport.Duration = time.Since(start)
+		report.Steps = append(report.Steps, stepReport)
+	}
+
+	report.RejectedRequests = m.rejected.Load()
+	report.Duration = time.Since(report.StartedAt)
+	return report
+}
+
+// Log writes the report to the server log
+func (r ShutdownReport) Log() {
+	logger.Info("Drained in %v: %d requests in flight at start, %d at end, %d writes refused",
+		r.Duration, r.InFlightAtStart, r.InFlightAtEnd, r.RejectedRequests)
+	for _, step := range r.Steps {
+		switch {
+		case step.TimedOut:
+			logger.Warn("Shutdown step %s did not finish before the shutdown timeout", step.Name)
+		case step.Error != "":
+			logger.Error("Shutdown step %s failed after %v: %s", step.Name, step.Duration, step.Error)
+		default:
+			logger.Info("Shutdown step %s flushed %d in %v", step.Name, step.Flushed, step.Duration)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SigningHandler verifies entity signatures and publishes the keys they
+// are made with
+type SigningHandler struct {
+	repo models.EntityRepository
+}
+
+// NewSigningHandler creates a new signing handler
+func NewSigningHandler(repo models.EntityRepository) *SigningHandler {
+	return &SigningHandler{repo: repo}
+}
+
+// SigningKeysResponse lists the public keys of the signing key ring
+type SigningKeysResponse struct {
+	Enabled   bool                      `json:"enabled"`
+	ActiveKey string                    `json:"active_key,omitempty"`
+	Keys      []binary.SigningPublicKey `json:"keys"`
+}
+
+// VerifyEntity checks an entity's signature
+// @Summary Verify entity signature
+// @Description Check the newest signature of an entity against the signing key ring. The signature covers the entity ID, content and the tags it had when signed; tags added since are listed as unsigned. An entity that was never signed reports signed false.
+// @Tags entities
+// @Produce json
+// @Param id path string true "Entity ID"
+// @Success 200 {object} binary.SignatureVerification
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/entities/{id}/verify [get]
+func (h *SigningHandler) VerifyEntity(w http.ResponseWriter, r *http.Request) {
+	entity, err := repoGetByID(r.Context(), h.repo, mux.Vars(r)["id"])
+	if err != nil || outsidePathDataset(r, entity) || !canAccessEntity(r, entity, models.ACLRead) {
+		RespondError(w, http.StatusNotFound, "Entity not found")
+		return
+	}
+	RespondJSON(w, http.StatusOK, binary.GetEntitySigner().Verify(entity))
+}
+
+// GetSigningKeys lists the public keys entities are signed with
+// @Summary List signing keys
+// @Description List the public keys of the signing key ring, so signatures can be verified outside EntityDB. Keys retired by a rotation stay listed while they remain in the ring. Private keys are never returned.
+// @Tags entities
+// @Produce json
+// @Success 200 {object} SigningKeysResponse
+// @Security BearerAuth
+// @Router /api/v1/signing/keys [get]
+func (h *SigningHandler) GetSigningKeys(w http.ResponseWriter, r *http.Request) {
+	response := SigningKeysResponse{Keys: []binary.SigningPublicKey{}}
+	if signer := binary.GetEntitySigner(); signer != nil {
+		response.Enabled = signer.Enabled()
+		response.ActiveKey = signer.ActiveKeyID()
+		response.Keys = signer.PublicKeys()
+	}
+	RespondJSON(w, http.StatusOK, response)
+}
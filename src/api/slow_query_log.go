@@ -0,0 +1,175 @@
+package api
+
+import (
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/storage/binary"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SlowQueryEntry is an API request that took longer than the slow query
+// threshold, with the storage work it performed
+type SlowQueryEntry struct {
+	Time      time.Time                   `json:"time"`
+	RequestID string                      `json:"request_id,omitempty"`
+	UserID    string                      `json:"user_id,omitempty"`
+	Method    string                      `json:"method"`
+	Path      string                      `json:"path"`
+	Params    map[string][]string         `json:"params,omitempty"`
+	Status    int                         `json:"status"`
+	Duration  time.Duration               `json:"duration_ns"`
+	IO        binary.RequestStatsSnapshot `json:"io"`
+}
+
+// SlowQueryLogStatus describes the slow query log and its recent entries
+type SlowQueryLogStatus struct {
+	Enabled   bool             `json:"enabled"`
+	Threshold time.Duration    `json:"threshold_ns"`
+	Recorded  int64            `json:"recorded"` // since startup, including entries no longer kept
+	Entries   []SlowQueryEntry `json:"entries"`
+}
+
+// slowQueryRedactedParams are query parameters never recorded verbatim
+var slowQueryRedactedParams = []string{"token", "password", "secret", "key"}
+
+// SlowQueryLog keeps the most recent requests slower than a threshold
+type SlowQueryLog struct {
+	threshold time.Duration
+
+	mu       sync.Mutex
+	entries  []SlowQueryEntry // ring buffer
+	next     int
+	recorded int64
+}
+
+// slowQueryLog is the global slow query log
+var slowQueryLog *SlowQueryLog
+
+// InitSlowQueryLog initializes the global slow query log
+func InitSlowQueryLog(cfg *config.Config) {
+	slowQueryLog = NewSlowQueryLog(cfg.SlowQueryThreshold, cfg.SlowQueryLogSize)
+}
+
+// GetSlowQueryLog returns the global slow query log
+func GetSlowQueryLog() *SlowQueryLog {
+	return slowQueryLog
+}
+
+// NewSlowQueryLog creates a slow query log keeping size entries. A
+// threshold of 0 or less disables it.
+func NewSlowQueryLog(threshold time.Duration, size int) *SlowQueryLog {
+	if size <= 0 {
+		size = 500
+	}
+	return &SlowQueryLog{threshold: threshold, entries: make([]SlowQueryEntry, 0, size)}
+}
+
+// IsEnabled reports whether slow requests are recorded
+func (l *SlowQueryLog) IsEnabled() bool {
+	return l != nil && l.threshold > 0
+}
+
+// Middleware measures every request and records those over the threshold.
+// Storage work is counted through the request context.
+func (l *SlowQueryLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.IsEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		stats := &binary.RequestStats{}
+		ctx := binary.WithRequestStats(r.Context(), stats)
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		duration := time.Since(start)
+		if duration < l.threshold {
+			return
+		}
+		entry := SlowQueryEntry{
+			Time:      start,
+			RequestID: logger.RequestID(ctx),
+			UserID:    logger.UserID(ctx),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Params:    slowQueryParams(r),
+			Status:    wrapped.statusCode,
+			Duration:  duration,
+			IO:        stats.Snapshot(),
+		}
+		l.record(entry)
+		logger.WarnContext(ctx, "Slow request: %s %s took %v (status %d, %d index lookups, %d entities, %d bytes, lock wait %v)",
+			r.Method, r.URL.Path, duration, entry.Status, entry.IO.IndexLookups,
+			entry.IO.EntitiesFetched, entry.IO.BytesRead, entry.IO.LockWait)
+	})
+}
+
+// record adds an entry, replacing the oldest once the log is full
+func (l *SlowQueryLog) record(entry SlowQueryEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recorded++
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, entry)
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// Status returns up to limit entries, slowest first
+func (l *SlowQueryLog) Status(limit int) SlowQueryLogStatus {
+	l.mu.Lock()
+	entries := make([]SlowQueryEntry, len(l.entries))
+	copy(entries, l.entries)
+	recorded := l.recorded
+	l.mu.Unlock()
+
+	// Slowest first, then most recent first
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Duration != entries[j].Duration {
+			return entries[i].Duration > entries[j].Duration
+		}
+		return entries[i].Time.After(entries[j].Time)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return SlowQueryLogStatus{
+		Enabled:   l.IsEnabled(),
+		Threshold: l.threshold,
+		Recorded:  recorded,
+		Entries:   entries,
+	}
+}
+
+// slowQueryParams copies the query parameters of r, redacting credentials
+func slowQueryParams(r *http.Request) map[string][]string {
+	query := r.URL.Query()
+	if len(query) == 0 {
+		return nil
+	}
+	params := make(map[string][]string, len(query))
+	for name, values := range query {
+		lower := strings.ToLower(name)
+		redact := false
+		for _, sensitive := range slowQueryRedactedParams {
+			if strings.Contains(lower, sensitive) {
+				redact = true
+				break
+			}
+		}
+		if redact {
+			params[name] = []string{"[REDACTED]"}
+		} else {
+			params[name] = values
+		}
+	}
+	return params
+}
@@ -0,0 +1,1049 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/models"
+)
+
+// sqlServerVersion is the PostgreSQL version the gateway reports; clients
+// pick their dialect from it
+const sqlServerVersion = "14.0"
+
+// PostgreSQL startup request codes
+const (
+	pgProtocolVersion3 = 196608
+	pgSSLRequest       = 80877103
+	pgGSSENCRequest    = 80877104
+	pgCancelRequest    = 80877102
+)
+
+const (
+	// pgMaxMessageSize caps a frontend message
+	pgMaxMessageSize = 16 * 1024 * 1024
+	// pgStartupTimeout bounds the handshake and authentication
+	pgStartupTimeout = 30 * time.Second
+	// pgAuthFailureDelay slows down password guessing
+	pgAuthFailureDelay = time.Second
+)
+
+// SQLGateway serves read-only SELECT queries over the PostgreSQL wire
+// protocol, so BI tools such as Grafana and Metabase can chart entities
+// with their PostgreSQL drivers. Queries read the virtual tables entities,
+// tags and history, with equality conditions answered from the tag index.
+//
+// Clients log in with a password: either a session token, which any user
+// name accepts, or the user's own password unless single sign-on replaces
+// password login. Users with two-factor authentication must use a token.
+// The entity:view permission is required, and entity ACLs and redaction
+// apply to every row.
+type SQLGateway struct {
+	executor      *sqlExecutor
+	security      *SecurityMiddleware
+	tlsConfig     *tls.Config
+	passwordLogin bool
+
+	mu       sync.Mutex
+	listener net.Listener
+	sessions map[int32]*sqlSession
+	closing  bool
+	wg       sync.WaitGroup
+}
+
+// NewSQLGateway creates a SQL gateway for the repository. TLS follows
+// UseSSL, with the certificate of the REST API.
+func NewSQLGateway(repo models.EntityRepository, security *SecurityMiddleware, cfg *config.Config) (*SQLGateway, error) {
+	g := &SQLGateway{
+		executor: &sqlExecutor{
+			repo:     repo,
+			maxRows:  cfg.SQLGatewayMaxRows,
+			database: "entitydb",
+		},
+		security:      security,
+		passwordLogin: !cfg.OIDCEnabled || cfg.OIDCPasswordLogin,
+		sessions:      make(map[int32]*sqlSession),
+	}
+	if cfg.UseSSL {
+		certificate, err := tls.LoadX509KeyPair(cfg.SSLCert, cfg.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		g.tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+	}
+	return g, nil
+}
+
+// Serve accepts connections on the listener until Stop is called
+func (g *SQLGateway) Serve(listener net.Listener) error {
+	g.mu.Lock()
+	g.listener = listener
+	g.mu.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			g.mu.Lock()
+			closing := g.closing
+			g.mu.Unlock()
+			if closing {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			g.serveConn(conn)
+		}()
+	}
+}
+
+// Stop closes the listener and idle connections, waits for running queries
+// until ctx expires, then closes the remaining connections
+func (g *SQLGateway) Stop(ctx context.Context) {
+	g.mu.Lock()
+	g.closing = true
+	if g.listener != nil {
+		g.listener.Close()
+	}
+	for _, session := range g.sessions {
+		if !session.busy {
+			session.conn.Close()
+		}
+	}
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		g.mu.Lock()
+		for _, session := range g.sessions {
+			session.conn.Close()
+		}
+		g.mu.Unlock()
+	}
+}
+
+// sqlPrepared is a statement of the extended query protocol
+type sqlPrepared struct {
+	text       string
+	statement  *models.SQLStatement
+	paramTypes []uint32
+}
+
+// sqlPortal is a bound statement with its result once executed
+type sqlPortal struct {
+	statement *models.SQLStatement
+	formats   []int16
+	result    *sqlResult
+	sent      int
+}
+
+// sqlSession is a client connection
+type sqlSession struct {
+	gateway *SQLGateway
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+
+	user       *models.SecurityUser
+	pid        int32
+	secret     int32
+	settings   map[string]string
+	statements map[string]*sqlPrepared
+	portals    map[string]*sqlPortal
+	// failed discards extended protocol messages until the next Sync
+	failed        bool
+	inTransaction bool
+
+	// busy and cancel are guarded by the gateway mutex
+	busy   bool
+	cancel context.CancelFunc
+}
+
+// serveConn runs the startup handshake, authentication and query loop of
+// a connection
+func (g *SQLGateway) serveConn(conn net.Conn) {
+	defer conn.Close()
+	s := &sqlSession{
+		gateway:    g,
+		conn:       conn,
+		reader:     bufio.NewReader(conn),
+		writer:     bufio.NewWriter(conn),
+		statements: make(map[string]*sqlPrepared),
+		portals:    make(map[string]*sqlPortal),
+	}
+
+	conn.SetDeadline(time.Now().Add(pgStartupTimeout))
+	params, ok := s.startup()
+	if !ok {
+		return
+	}
+	if !s.authenticate(params) {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	if !g.register(s) {
+		return
+	}
+	defer g.unregister(s)
+	logger.Info("SQL gateway session opened for %s from %s", s.user.Username, conn.RemoteAddr())
+	s.loop()
+}
+
+// startup reads the startup message, negotiating TLS first when the client
+// asks. It returns the startup parameters.
+func (s *sqlSession) startup() (map[string]string, bool) {
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(s.reader, header[:]); err != nil {
+			return nil, false
+		}
+		length := int(binary.BigEndian.Uint32(header[:]))
+		if length < 8 || length > 10000 {
+			return nil, false
+		}
+		body := make([]byte, length-4)
+		if _, err := io.ReadFull(s.reader, body); err != nil {
+			return nil, false
+		}
+		code := binary.BigEndian.Uint32(body[:4])
+
+		switch code {
+		case pgSSLRequest:
+			if s.gateway.tlsConfig == nil || s.reader.Buffered() > 0 {
+				s.conn.Write([]byte{'N'})
+				continue
+			}
+			s.conn.Write([]byte{'S'})
+			tlsConn := tls.Server(s.conn, s.gateway.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				logger.Warn("SQL gateway TLS handshake with %s failed: %v", s.conn.RemoteAddr(), err)
+				return nil, false
+			}
+			s.conn = tlsConn
+			s.reader = bufio.NewReader(tlsConn)
+			s.writer = bufio.NewWriter(tlsConn)
+			continue
+		case pgGSSENCRequest:
+			s.conn.Write([]byte{'N'})
+			continue
+		case pgCancelRequest:
+			if len(body) >= 12 {
+				s.gateway.cancelQuery(int32(binary.BigEndian.Uint32(body[4:8])), int32(binary.BigEndian.Uint32(body[8:12])))
+			}
+			return nil, false
+		case pgProtocolVersion3:
+		default:
+			s.sendError("08P01", fmt.Sprintf("unsupported frontend protocol %d.%d", code>>16, code&0xffff))
+			s.writer.Flush()
+			return nil, false
+		}
+
+		if s.gateway.tlsConfig != nil {
+			if _, ok := s.conn.(*tls.Conn); !ok {
+				s.sendError("28000", "the SQL gateway requires SSL")
+				s.writer.Flush()
+				return nil, false
+			}
+		}
+
+		params := make(map[string]string)
+		fields := strings.Split(string(body[4:]), "\x00")
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i] == "" {
+				break
+			}
+			params[fields[i]] = fields[i+1]
+		}
+		return params, true
+	}
+}
+
+// authenticate asks for a cleartext password and logs the session in. The
+// password is tried as a session token first, then as the user's password.
+func (s *sqlSession) authenticate(params map[string]string) bool {
+	username := params["user"]
+	s.writeMessage('R', pgInt32(nil, 3))
+	if err := s.writer.Flush(); err != nil {
+		return false
+	}
+	kind, payload, err := s.readMessage()
+	if err != nil || kind != 'p' {
+		return false
+	}
+	password := strings.TrimSuffix(string(payload), "\x00")
+
+	security := s.gateway.security
+	user, err := security.securityManager.ValidateSession(password)
+	if err != nil || user == nil {
+		user = nil
+		switch {
+		case username == "" || password == "":
+		case !s.gateway.passwordLogin:
+			time.Sleep(pgAuthFailureDelay)
+			s.sendError("28P01", "password login is disabled; connect with a session token as the password")
+			s.writer.Flush()
+			return false
+		default:
+			authenticated, err := security.securityManager.AuthenticateUser(username, password)
+			if err == nil && models.MFAEnabled(authenticated.Entity) {
+				time.Sleep(pgAuthFailureDelay)
+				s.sendError("28P01", "user "+username+" has two-factor authentication; connect with a session token as the password")
+				s.writer.Flush()
+				return false
+			}
+			if err == nil {
+				user = authenticated
+			}
+		}
+	}
+	if user == nil {
+		logger.Warn("SQL gateway authentication failed for %q from %s", username, s.conn.RemoteAddr())
+		time.Sleep(pgAuthFailureDelay)
+		s.sendError("28P01", "password authentication failed for user \""+username+"\"")
+		s.writer.Flush()
+		return false
+	}
+
+	// Queries span datasets, so scoped sessions cannot be confined
+	if user.Scope != "" {
+		s.sendError("42501", "permission denied: session is scoped to dataset "+user.Scope)
+		s.writer.Flush()
+		return false
+	}
+
+	allowed, err := security.authorizeCall(context.Background(), "SQL", "/sql", user, "entity", "view", "")
+	if err != nil || !allowed {
+		s.sendError("42501", "permission denied: entity:view required")
+		s.writer.Flush()
+		return false
+	}
+	s.user = user
+
+	s.settings = map[string]string{
+		"server_version":                sqlServerVersion,
+		"server_encoding":               "UTF8",
+		"client_encoding":               "UTF8",
+		"datestyle":                     "ISO, MDY",
+		"timezone":                      "UTC",
+		"integer_datetimes":             "on",
+		"standard_conforming_strings":   "on",
+		"is_superuser":                  "off",
+		"session_authorization":         user.Username,
+		"application_name":              params["application_name"],
+		"transaction_isolation":         "read committed",
+		"default_transaction_read_only": "on",
+		"transaction_read_only":         "on",
+	}
+	s.writeMessage('R', pgInt32(nil, 0))
+	for _, name := range []string{"server_version", "server_encoding", "client_encoding", "application_name", "is_superuser", "session_authorization", "integer_datetimes", "standard_conforming_strings"} {
+		s.writeMessage('S', pgString(pgString(nil, name), s.settings[name]))
+	}
+	s.writeMessage('S', pgString(pgString(nil, "DateStyle"), s.settings["datestyle"]))
+	s.writeMessage('S', pgString(pgString(nil, "TimeZone"), s.settings["timezone"]))
+	return true
+}
+
+// register assigns the session its cancel key and reports it ready
+func (g *SQLGateway) register(s *sqlSession) bool {
+	var key [8]byte
+	g.mu.Lock()
+	if g.closing {
+		g.mu.Unlock()
+		return false
+	}
+	for {
+		rand.Read(key[:])
+		s.pid = int32(binary.BigEndian.Uint32(key[:4]) & 0x7fffffff)
+		s.secret = int32(binary.BigEndian.Uint32(key[4:]))
+		if _, taken := g.sessions[s.pid]; !taken && s.pid != 0 {
+			break
+		}
+	}
+	g.sessions[s.pid] = s
+	g.mu.Unlock()
+
+	s.writeMessage('K', pgInt32(pgInt32(nil, s.pid), s.secret))
+	s.readyForQuery()
+	return s.writer.Flush() == nil
+}
+
+func (g *SQLGateway) unregister(s *sqlSession) {
+	g.mu.Lock()
+	delete(g.sessions, s.pid)
+	g.mu.Unlock()
+	logger.Debug("SQL gateway session closed for %s", s.user.Username)
+}
+
+// cancelQuery cancels the running query of the session with the key
+func (g *SQLGateway) cancelQuery(pid, secret int32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if session, ok := g.sessions[pid]; ok && session.secret == secret && session.cancel != nil {
+		session.cancel()
+	}
+}
+
+// loop reads and answers messages until the client terminates
+func (s *sqlSession) loop() {
+	for {
+		kind, payload, err := s.readMessage()
+		if err != nil {
+			return
+		}
+		if !s.begin() {
+			return
+		}
+		terminate := s.handle(kind, payload)
+		if !s.end() || terminate {
+			return
+		}
+	}
+}
+
+// begin marks the session busy; it fails once the gateway is stopping
+func (s *sqlSession) begin() bool {
+	s.gateway.mu.Lock()
+	defer s.gateway.mu.Unlock()
+	s.busy = true
+	return !s.gateway.closing
+}
+
+// end flushes replies and marks the session idle, failing once the gateway
+// is stopping
+func (s *sqlSession) end() bool {
+	err := s.writer.Flush()
+	s.gateway.mu.Lock()
+	defer s.gateway.mu.Unlock()
+	s.busy = false
+	return err == nil && !s.gateway.closing
+}
+
+// handle answers a message and reports whether the session ends
+func (s *sqlSession) handle(kind byte, payload []byte) bool {
+	if kind == 'X' {
+		return true
+	}
+	if s.failed && kind != 'S' {
+		return false
+	}
+	r := &pgReader{data: payload}
+	switch kind {
+	case 'Q':
+		s.simpleQuery(r.string())
+	case 'P':
+		s.parse(r)
+	case 'B':
+		s.bind(r)
+	case 'D':
+		s.describe(r)
+	case 'E':
+		s.execute(r)
+	case 'C':
+		target, name := r.byte(), r.string()
+		if target == 'S' {
+			delete(s.statements, name)
+		} else {
+			delete(s.portals, name)
+		}
+		s.writeMessage('3', nil)
+	case 'S':
+		s.failed = false
+		s.readyForQuery()
+	case 'H':
+	default:
+		s.extendedError(&sqlError{code: "08P01", message: fmt.Sprintf("unsupported message type %q", kind)})
+	}
+	return false
+}
+
+// simpleQuery runs each statement of a simple query message
+func (s *sqlSession) simpleQuery(text string) {
+	defer s.readyForQuery()
+	statements := models.SplitSQLStatements(text)
+	if len(statements) == 0 {
+		s.writeMessage('I', nil)
+		return
+	}
+	for _, statementText := range statements {
+		statement, err := models.ParseSQL(statementText, nil)
+		if err != nil {
+			s.sendQueryError(err)
+			return
+		}
+		if statement.Kind == models.SQLStatementEmpty {
+			s.writeMessage('I', nil)
+			continue
+		}
+		result, err := s.run(statement)
+		if err != nil {
+			s.sendQueryError(err)
+			return
+		}
+		if result != nil {
+			s.rowDescription(result.columns, nil)
+			s.dataRows(result, 0, len(result.rows), nil)
+		}
+		s.commandComplete(statement, result)
+	}
+}
+
+// run executes a statement; it returns a result for SELECT and SHOW
+func (s *sqlSession) run(statement *models.SQLStatement) (*sqlResult, error) {
+	switch statement.Kind {
+	case models.SQLStatementSet:
+		s.settings[statement.Setting] = statement.Value
+		return nil, nil
+	case models.SQLStatementShow:
+		value, ok := s.settings[statement.Setting]
+		if !ok {
+			return nil, sqlErrorf("42704", "unrecognized configuration parameter %q", statement.Setting)
+		}
+		return &sqlResult{columns: []sqlColumn{{statement.Setting, sqlTypeText}}, rows: [][]interface{}{{value}}}, nil
+	case models.SQLStatementTransaction:
+		switch statement.Command {
+		case "BEGIN", "START TRANSACTION":
+			s.inTransaction = true
+		case "COMMIT", "ROLLBACK", "DISCARD ALL":
+			s.inTransaction = false
+		}
+		return nil, nil
+	case models.SQLStatementSelect:
+		return s.query(statement.Select)
+	}
+	return nil, nil
+}
+
+// query runs a SELECT under the query timeout; a cancel request from the
+// client stops it
+func (s *sqlSession) query(query *models.SQLSelect) (*sqlResult, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), queryTimeout)
+	}
+	defer cancel()
+	s.gateway.mu.Lock()
+	s.cancel = cancel
+	s.gateway.mu.Unlock()
+	defer func() {
+		s.gateway.mu.Lock()
+		s.cancel = nil
+		s.gateway.mu.Unlock()
+	}()
+
+	startTime := time.Now()
+	result, err := s.gateway.executor.execute(ctx, s.user, query)
+	if queryMetrics != nil && query.Table != "" {
+		count := 0
+		if result != nil {
+			count = len(result.rows)
+		}
+		queryMetrics.TrackQuery("sql", []string{query.Table}, startTime, count, err)
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, sqlErrorf(sqlStateCanceled, "canceling statement due to statement timeout")
+	case errors.Is(err, context.Canceled):
+		return nil, sqlErrorf(sqlStateCanceled, "canceling statement due to user request")
+	}
+	return result, err
+}
+
+// parse handles Parse: the statement is checked now and parsed again with
+// its parameters at Bind
+func (s *sqlSession) parse(r *pgReader) {
+	name, text := r.string(), r.string()
+	count := int(r.int16())
+	types := make([]uint32, count)
+	for i := range types {
+		types[i] = uint32(r.int32())
+	}
+	if r.err != nil {
+		s.extendedError(&sqlError{code: "08P01", message: "malformed Parse message"})
+		return
+	}
+	statement, err := models.ParseSQL(text, nil)
+	if err != nil {
+		s.extendedError(err)
+		return
+	}
+	if n := models.SQLParameterCount(text); n > len(types) {
+		types = append(types, make([]uint32, n-len(types))...)
+	}
+	for i, typ := range types {
+		if typ == 0 {
+			types[i] = uint32(sqlTypeText)
+		}
+	}
+	s.statements[name] = &sqlPrepared{text: text, statement: statement, paramTypes: types}
+	s.writeMessage('1', nil)
+}
+
+// bind handles Bind, substituting the parameters into the statement
+func (s *sqlSession) bind(r *pgReader) {
+	portalName, statementName := r.string(), r.string()
+	prepared, ok := s.statements[statementName]
+	if !ok {
+		s.extendedError(sqlErrorf("26000", "prepared statement %q does not exist", statementName))
+		return
+	}
+	paramFormats := make([]int16, r.int16())
+	for i := range paramFormats {
+		paramFormats[i] = r.int16()
+	}
+	args := make([]models.SQLValue, r.int16())
+	if len(args) != len(prepared.paramTypes) {
+		s.extendedError(sqlErrorf("08P01", "bind message supplies %d parameters, but prepared statement requires %d", len(args), len(prepared.paramTypes)))
+		return
+	}
+	for i := range args {
+		length := r.int32()
+		if length < 0 {
+			continue
+		}
+		format := int16(0)
+		switch {
+		case len(paramFormats) == 1:
+			format = paramFormats[0]
+		case i < len(paramFormats):
+			format = paramFormats[i]
+		}
+		value, err := decodeSQLParameter(r.bytes(int(length)), format, prepared.paramTypes[i])
+		if err != nil {
+			s.extendedError(err)
+			return
+		}
+		args[i] = value
+	}
+	formats := make([]int16, r.int16())
+	for i := range formats {
+		formats[i] = r.int16()
+	}
+	if r.err != nil {
+		s.extendedError(&sqlError{code: "08P01", message: "malformed Bind message"})
+		return
+	}
+
+	statement, err := models.ParseSQL(prepared.text, args)
+	if err != nil {
+		s.extendedError(err)
+		return
+	}
+	s.portals[portalName] = &sqlPortal{statement: statement, formats: formats}
+	s.writeMessage('2', nil)
+}
+
+// describe handles Describe of a statement or portal
+func (s *sqlSession) describe(r *pgReader) {
+	target, name := r.byte(), r.string()
+	var statement *models.SQLStatement
+	var formats []int16
+	if target == 'S' {
+		prepared, ok := s.statements[name]
+		if !ok {
+			s.extendedError(sqlErrorf("26000", "prepared statement %q does not exist", name))
+			return
+		}
+		payload := pgInt16(nil, int16(len(prepared.paramTypes)))
+		for _, typ := range prepared.paramTypes {
+			payload = pgInt32(payload, int32(typ))
+		}
+		s.writeMessage('t', payload)
+		statement = prepared.statement
+	} else {
+		portal, ok := s.portals[name]
+		if !ok {
+			s.extendedError(sqlErrorf("34000", "portal %q does not exist", name))
+			return
+		}
+		statement, formats = portal.statement, portal.formats
+	}
+
+	columns, err := s.describeColumns(statement)
+	if err != nil {
+		s.extendedError(err)
+		return
+	}
+	if columns == nil {
+		s.writeMessage('n', nil)
+		return
+	}
+	s.rowDescription(columns, formats)
+}
+
+// describeColumns returns the result columns of a statement, nil when it
+// returns no rows
+func (s *sqlSession) describeColumns(statement *models.SQLStatement) ([]sqlColumn, error) {
+	switch statement.Kind {
+	case models.SQLStatementSelect:
+		return s.gateway.executor.describe(statement.Select)
+	case models.SQLStatementShow:
+		return []sqlColumn{{statement.Setting, sqlTypeText}}, nil
+	}
+	return nil, nil
+}
+
+// execute handles Execute, sending at most maxRows rows and suspending the
+// portal when more remain
+func (s *sqlSession) execute(r *pgReader) {
+	name, maxRows := r.string(), int(r.int32())
+	portal, ok := s.portals[name]
+	if !ok {
+		s.extendedError(sqlErrorf("34000", "portal %q does not exist", name))
+		return
+	}
+	if portal.statement.Kind == models.SQLStatementEmpty {
+		s.writeMessage('I', nil)
+		return
+	}
+	if portal.result == nil {
+		result, err := s.run(portal.statement)
+		if err != nil {
+			s.extendedError(err)
+			return
+		}
+		if result == nil {
+			s.commandComplete(portal.statement, nil)
+			return
+		}
+		portal.result = result
+	}
+
+	end := len(portal.result.rows)
+	if maxRows > 0 && portal.sent+maxRows < end {
+		end = portal.sent + maxRows
+	}
+	s.dataRows(portal.result, portal.sent, end, portal.formats)
+	portal.sent = end
+	if end < len(portal.result.rows) {
+		s.writeMessage('s', nil)
+		return
+	}
+	s.commandComplete(portal.statement, portal.result)
+}
+
+// extendedError reports an error and discards messages until Sync
+func (s *sqlSession) extendedError(err error) {
+	s.sendQueryError(err)
+	s.failed = true
+}
+
+// sendQueryError reports a query error with its SQLSTATE
+func (s *sqlSession) sendQueryError(err error) {
+	var queryErr *sqlError
+	switch {
+	case errors.As(err, &queryErr):
+		s.sendError(queryErr.code, queryErr.message)
+	case errors.Is(err, models.ErrSQLReadOnly):
+		s.sendError(sqlStateReadOnly, err.Error())
+	case strings.HasPrefix(err.Error(), "syntax error"):
+		s.sendError(sqlStateSyntax, err.Error())
+	default:
+		logger.Error("SQL gateway query failed: %v", err)
+		s.sendError(sqlStateInternal, err.Error())
+	}
+}
+
+// commandComplete ends a statement with its command tag
+func (s *sqlSession) commandComplete(statement *models.SQLStatement, result *sqlResult) {
+	tag := statement.Command
+	switch statement.Kind {
+	case models.SQLStatementSelect:
+		tag = "SELECT " + strconv.Itoa(len(result.rows))
+	case models.SQLStatementShow:
+		tag = "SHOW"
+	}
+	s.writeMessage('C', pgString(nil, tag))
+}
+
+func (s *sqlSession) readyForQuery() {
+	status := byte('I')
+	if s.inTransaction {
+		status = 'T'
+	}
+	s.writeMessage('Z', []byte{status})
+}
+
+// rowDescription describes the result columns in the given formats
+func (s *sqlSession) rowDescription(columns []sqlColumn, formats []int16) {
+	payload := pgInt16(nil, int16(len(columns)))
+	for i, column := range columns {
+		size := int16(8)
+		switch column.typ {
+		case sqlTypeText:
+			size = -1
+		case sqlTypeBool:
+			size = 1
+		}
+		payload = pgString(payload, column.name)
+		payload = pgInt32(payload, 0)
+		payload = pgInt16(payload, 0)
+		payload = pgInt32(payload, int32(column.typ))
+		payload = pgInt16(payload, size)
+		payload = pgInt32(payload, -1)
+		payload = pgInt16(payload, resultFormat(formats, i))
+	}
+	s.writeMessage('T', payload)
+}
+
+// resultFormat returns the format of column i: one format applies to all
+// columns, none means text
+func resultFormat(formats []int16, i int) int16 {
+	switch {
+	case len(formats) == 1:
+		return formats[0]
+	case i < len(formats):
+		return formats[i]
+	default:
+		return 0
+	}
+}
+
+// dataRows sends rows [start, end) of a result
+func (s *sqlSession) dataRows(result *sqlResult, start, end int, formats []int16) {
+	for _, row := range result.rows[start:end] {
+		payload := pgInt16(nil, int16(len(row)))
+		for i, value := range row {
+			if value == nil {
+				payload = pgInt32(payload, -1)
+				continue
+			}
+			var encoded []byte
+			if resultFormat(formats, i) == 1 {
+				encoded = encodeSQLBinary(value, result.columns[i].typ)
+			} else {
+				encoded = []byte(encodeSQLText(value))
+			}
+			payload = pgInt32(payload, int32(len(encoded)))
+			payload = append(payload, encoded...)
+		}
+		s.writeMessage('D', payload)
+	}
+}
+
+// sendError sends an ErrorResponse
+func (s *sqlSession) sendError(code, message string) {
+	payload := []byte{'S'}
+	payload = pgString(payload, "ERROR")
+	payload = append(payload, 'V')
+	payload = pgString(payload, "ERROR")
+	payload = append(payload, 'C')
+	payload = pgString(payload, code)
+	payload = append(payload, 'M')
+	payload = pgString(payload, message)
+	s.writeMessage('E', append(payload, 0))
+}
+
+// readMessage reads a typed frontend message
+func (s *sqlSession) readMessage() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(s.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := int(binary.BigEndian.Uint32(header[1:]))
+	if length < 4 || length > pgMaxMessageSize {
+		return 0, nil, fmt.Errorf("invalid message length %d", length)
+	}
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(s.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// writeMessage buffers a typed backend message
+func (s *sqlSession) writeMessage(kind byte, payload []byte) {
+	var header [5]byte
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)+4))
+	s.writer.Write(header[:])
+	s.writer.Write(payload)
+}
+
+func pgInt16(b []byte, v int16) []byte {
+	return binary.BigEndian.AppendUint16(b, uint16(v))
+}
+
+func pgInt32(b []byte, v int32) []byte {
+	return binary.BigEndian.AppendUint32(b, uint32(v))
+}
+
+func pgString(b []byte, v string) []byte {
+	return append(append(b, v...), 0)
+}
+
+// pgReader reads the fields of a frontend message; err records a message
+// that ends early
+type pgReader struct {
+	data []byte
+	err  error
+}
+
+func (r *pgReader) take(n int) []byte {
+	if n < 0 || n > len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		r.data = nil
+		return make([]byte, max(n, 0))
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *pgReader) byte() byte {
+	return r.take(1)[0]
+}
+
+func (r *pgReader) int16() int16 {
+	return int16(binary.BigEndian.Uint16(r.take(2)))
+}
+
+func (r *pgReader) int32() int32 {
+	return int32(binary.BigEndian.Uint32(r.take(4)))
+}
+
+func (r *pgReader) bytes(n int) []byte {
+	return r.take(n)
+}
+
+func (r *pgReader) string() string {
+	for i, c := range r.data {
+		if c == 0 {
+			value := string(r.data[:i])
+			r.data = r.data[i+1:]
+			return value
+		}
+	}
+	r.err = io.ErrUnexpectedEOF
+	r.data = nil
+	return ""
+}
+
+// pgEpoch is the zero of PostgreSQL binary timestamps
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// decodeSQLParameter converts a bound parameter to a literal. Numeric and
+// boolean parameter types become numbers and booleans, the rest strings.
+func decodeSQLParameter(data []byte, format int16, typ uint32) (models.SQLValue, error) {
+	if format == 1 {
+		switch {
+		case typ == 16 && len(data) == 1:
+			return models.SQLValue{Kind: models.SQLBool, Text: strconv.FormatBool(data[0] != 0)}, nil
+		case (typ == 20 || typ == 23 || typ == 21) && (len(data) == 8 || len(data) == 4 || len(data) == 2):
+			var n int64
+			switch len(data) {
+			case 8:
+				n = int64(binary.BigEndian.Uint64(data))
+			case 4:
+				n = int64(int32(binary.BigEndian.Uint32(data)))
+			default:
+				n = int64(int16(binary.BigEndian.Uint16(data)))
+			}
+			return models.SQLValue{Kind: models.SQLNumber, Text: strconv.FormatInt(n, 10)}, nil
+		case typ == 701 && len(data) == 8:
+			f := math.Float64frombits(binary.BigEndian.Uint64(data))
+			return models.SQLValue{Kind: models.SQLNumber, Text: strconv.FormatFloat(f, 'g', -1, 64)}, nil
+		case typ == 700 && len(data) == 4:
+			f := math.Float32frombits(binary.BigEndian.Uint32(data))
+			return models.SQLValue{Kind: models.SQLNumber, Text: strconv.FormatFloat(float64(f), 'g', -1, 32)}, nil
+		case (typ == 1114 || typ == 1184) && len(data) == 8:
+			t := pgEpoch.Add(time.Duration(int64(binary.BigEndian.Uint64(data))) * time.Microsecond)
+			return models.SQLValue{Kind: models.SQLString, Text: t.Format(time.RFC3339Nano)}, nil
+		case typ == 25 || typ == 1043:
+			return models.SQLValue{Kind: models.SQLString, Text: string(data)}, nil
+		}
+		return models.SQLValue{}, sqlErrorf("22P03", "unsupported binary format for parameter of type %d", typ)
+	}
+
+	text := string(data)
+	switch typ {
+	case 20, 21, 23, 700, 701, 1700:
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return models.SQLValue{}, sqlErrorf(sqlStateInvalidText, "invalid input syntax for a number: %q", text)
+		}
+		return models.SQLValue{Kind: models.SQLNumber, Text: text}, nil
+	case 16:
+		switch strings.ToLower(text) {
+		case "t", "true", "1", "on", "yes":
+			return models.SQLValue{Kind: models.SQLBool, Text: "true"}, nil
+		default:
+			return models.SQLValue{Kind: models.SQLBool, Text: "false"}, nil
+		}
+	}
+	return models.SQLValue{Kind: models.SQLString, Text: text}, nil
+}
+
+// encodeSQLText formats a value in the PostgreSQL text format
+func encodeSQLText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "t"
+		}
+		return "f"
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05.999999") + "+00"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// encodeSQLBinary formats a value in the PostgreSQL binary format of the
+// column type
+func encodeSQLBinary(value interface{}, typ sqlType) []byte {
+	switch typ {
+	case sqlTypeBool:
+		if v, _ := value.(bool); v {
+			return []byte{1}
+		}
+		return []byte{0}
+	case sqlTypeInt8:
+		n, ok := value.(int64)
+		if !ok {
+			f, _ := sqlNumber(value)
+			n = int64(f)
+		}
+		return binary.BigEndian.AppendUint64(nil, uint64(n))
+	case sqlTypeFloat8:
+		f, _ := sqlNumber(value)
+		return binary.BigEndian.AppendUint64(nil, math.Float64bits(f))
+	case sqlTypeTimestamptz:
+		t, _ := value.(time.Time)
+		micros := t.Sub(pgEpoch).Microseconds()
+		return binary.BigEndian.AppendUint64(nil, uint64(micros))
+	default:
+		return []byte(encodeSQLText(value))
+	}
+}
@@ -0,0 +1,1215 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"entitydb/models"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// sqlType is the PostgreSQL type OID of a result column
+type sqlType uint32
+
+const (
+	sqlTypeBool        sqlType = 16
+	sqlTypeInt8        sqlType = 20
+	sqlTypeText        sqlType = 25
+	sqlTypeFloat8      sqlType = 701
+	sqlTypeTimestamptz sqlType = 1184
+)
+
+// sqlTypeNames are the information_schema names of the column types
+var sqlTypeNames = map[sqlType]string{
+	sqlTypeBool:        "boolean",
+	sqlTypeInt8:        "bigint",
+	sqlTypeText:        "text",
+	sqlTypeFloat8:      "double precision",
+	sqlTypeTimestamptz: "timestamp with time zone",
+}
+
+// sqlColumn is a column of a virtual table or result
+type sqlColumn struct {
+	name string
+	typ  sqlType
+}
+
+// sqlTable is a virtual table of the SQL gateway
+type sqlTable struct {
+	// columns are the columns of SELECT *
+	columns []sqlColumn
+	// tagColumns makes any other column the current value of the tag
+	// namespace of that name
+	tagColumns bool
+}
+
+// sqlTagTableColumns are the columns of the tags and history tables
+var sqlTagTableColumns = []sqlColumn{
+	{"entity_id", sqlTypeText},
+	{"type", sqlTypeText},
+	{"dataset", sqlTypeText},
+	{"namespace", sqlTypeText},
+	{"value", sqlTypeText},
+	{"tag", sqlTypeText},
+	{"timestamp", sqlTypeTimestamptz},
+}
+
+// sqlTables are the tables a SELECT may read. entities has a row per
+// entity, tags a row per distinct tag of an entity with the time it was
+// last set, and history a row per timestamped tag entry.
+var sqlTables = map[string]sqlTable{
+	"entities": {
+		columns: []sqlColumn{
+			{"id", sqlTypeText},
+			{"type", sqlTypeText},
+			{"dataset", sqlTypeText},
+			{"created_at", sqlTypeTimestamptz},
+			{"updated_at", sqlTypeTimestamptz},
+			{"tags", sqlTypeText},
+			{"content", sqlTypeText},
+		},
+		tagColumns: true,
+	},
+	"tags":    {columns: sqlTagTableColumns},
+	"history": {columns: sqlTagTableColumns},
+	"information_schema.tables": {columns: []sqlColumn{
+		{"table_catalog", sqlTypeText},
+		{"table_schema", sqlTypeText},
+		{"table_name", sqlTypeText},
+		{"table_type", sqlTypeText},
+	}},
+	"information_schema.columns": {columns: []sqlColumn{
+		{"table_catalog", sqlTypeText},
+		{"table_schema", sqlTypeText},
+		{"table_name", sqlTypeText},
+		{"column_name", sqlTypeText},
+		{"ordinal_position", sqlTypeInt8},
+		{"data_type", sqlTypeText},
+		{"is_nullable", sqlTypeText},
+	}},
+}
+
+// sqlEntityTables are the tables read from the repository, in the order
+// information_schema lists them
+var sqlEntityTables = []string{"entities", "history", "tags"}
+
+// sqlError is a query error with its SQLSTATE code
+type sqlError struct {
+	code    string
+	message string
+}
+
+func (e *sqlError) Error() string {
+	return e.message
+}
+
+func sqlErrorf(code, format string, args ...interface{}) error {
+	return &sqlError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// SQLSTATE codes reported by the gateway
+const (
+	sqlStateSyntax          = "42601"
+	sqlStateUndefinedTable  = "42P01"
+	sqlStateUndefinedColumn = "42703"
+	sqlStateUndefinedFunc   = "42883"
+	sqlStateGrouping        = "42803"
+	sqlStateDatatype        = "42804"
+	sqlStateInvalidText     = "22P02"
+	sqlStateTooManyRows     = "54000"
+	sqlStateReadOnly        = "25006"
+	sqlStateCanceled        = "57014"
+	sqlStateInternal        = "XX000"
+)
+
+// column returns a column of the table
+func (t sqlTable) column(name string) (sqlColumn, bool) {
+	for _, column := range t.columns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	if t.tagColumns && !strings.ContainsAny(name, ":|") {
+		return sqlColumn{name, sqlTypeText}, true
+	}
+	return sqlColumn{}, false
+}
+
+// sqlRow returns a value of a row by column: nil, string, int64, float64,
+// bool or time.Time
+type sqlRow func(column string) interface{}
+
+// sqlResult is the result of a SELECT
+type sqlResult struct {
+	columns []sqlColumn
+	rows    [][]interface{}
+}
+
+// sqlExecutor runs SELECT queries over the virtual tables
+type sqlExecutor struct {
+	repo models.EntityRepository
+	// maxRows caps the table rows a query reads before filtering
+	maxRows int
+	// database is reported by current_database()
+	database string
+}
+
+// describe returns the result columns of a query without running it
+func (x *sqlExecutor) describe(query *models.SQLSelect) ([]sqlColumn, error) {
+	var table sqlTable
+	if query.Table != "" {
+		var ok bool
+		if table, ok = sqlTables[query.Table]; !ok {
+			return nil, sqlErrorf(sqlStateUndefinedTable, "relation %q does not exist (tables: entities, tags, history)", query.Table)
+		}
+	}
+	if query.Star {
+		return table.columns, nil
+	}
+
+	columns := make([]sqlColumn, len(query.Items))
+	for i, item := range query.Items {
+		typ, err := x.itemType(table, query.Table != "", item)
+		if err != nil {
+			return nil, err
+		}
+		columns[i] = sqlColumn{name: item.Name(), typ: typ}
+	}
+	return columns, nil
+}
+
+// itemType returns the result type of a select item
+func (x *sqlExecutor) itemType(table sqlTable, hasTable bool, item models.SQLSelectItem) (sqlType, error) {
+	switch {
+	case item.Literal != nil:
+		switch item.Literal.Kind {
+		case models.SQLNumber:
+			if _, err := strconv.ParseInt(item.Literal.Text, 10, 64); err == nil {
+				return sqlTypeInt8, nil
+			}
+			return sqlTypeFloat8, nil
+		case models.SQLBool:
+			return sqlTypeBool, nil
+		default:
+			return sqlTypeText, nil
+		}
+	case item.Function != "":
+		switch item.Function {
+		case "now", "current_timestamp", "statement_timestamp", "transaction_timestamp":
+			return sqlTypeTimestamptz, nil
+		case "pg_backend_pid":
+			return sqlTypeInt8, nil
+		case "version", "current_database", "current_schema", "current_catalog", "current_user", "session_user", "user":
+			return sqlTypeText, nil
+		}
+		return 0, sqlErrorf(sqlStateUndefinedFunc, "function %s() does not exist", item.Function)
+	}
+
+	if !hasTable {
+		return 0, sqlErrorf(sqlStateUndefinedColumn, "column %q does not exist: the query has no FROM clause", item.Column)
+	}
+	if item.Aggregate == "count" {
+		if item.Column != "*" {
+			if _, ok := table.column(item.Column); !ok {
+				return 0, sqlErrorf(sqlStateUndefinedColumn, "column %q does not exist", item.Column)
+			}
+		}
+		return sqlTypeInt8, nil
+	}
+	column, ok := table.column(item.Column)
+	if !ok {
+		return 0, sqlErrorf(sqlStateUndefinedColumn, "column %q does not exist", item.Column)
+	}
+	switch {
+	case item.Trunc != "":
+		if column.typ != sqlTypeTimestamptz {
+			return 0, sqlErrorf(sqlStateDatatype, "date_trunc needs a timestamp column, %s is not one", item.Column)
+		}
+		return sqlTypeTimestamptz, nil
+	case item.Aggregate == "sum" || item.Aggregate == "avg":
+		return sqlTypeFloat8, nil
+	default:
+		return column.typ, nil
+	}
+}
+
+// execute runs a SELECT as user, whose entity ACLs and redaction apply
+func (x *sqlExecutor) execute(ctx context.Context, user *models.SecurityUser, query *models.SQLSelect) (*sqlResult, error) {
+	columns, err := x.describe(query)
+	if err != nil {
+		return nil, err
+	}
+	items := query.Items
+	if query.Star {
+		items = make([]models.SQLSelectItem, len(columns))
+		for i, column := range columns {
+			items[i] = models.SQLSelectItem{Column: column.name}
+		}
+	}
+
+	var rows []sqlRow
+	if query.Table == "" {
+		// A FROM-less SELECT has a single row of literals and functions
+		rows = []sqlRow{func(string) interface{} { return nil }}
+	} else {
+		table := sqlTables[query.Table]
+		if err := checkSQLConditionColumns(table, query.Where); err != nil {
+			return nil, err
+		}
+		match, err := compileSQLCondition(query.Where, table)
+		if err != nil {
+			return nil, err
+		}
+		candidates, err := x.tableRows(ctx, user, query.Table, query.Where)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range candidates {
+			if match(row) {
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	values := func(item models.SQLSelectItem, row sqlRow) interface{} {
+		return x.itemValue(user, item, row)
+	}
+
+	grouped := query.Distinct || len(query.GroupBy) > 0
+	for _, item := range items {
+		if item.Aggregate != "" {
+			grouped = true
+		}
+	}
+
+	type output struct {
+		values []interface{}
+		source sqlRow
+	}
+	var outputs []output
+	if grouped {
+		groups, err := groupSQLRows(query, items, rows, values)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			outputs = append(outputs, output{values: group})
+		}
+	} else {
+		for _, row := range rows {
+			result := make([]interface{}, len(items))
+			for i, item := range items {
+				result[i] = values(item, row)
+			}
+			outputs = append(outputs, output{values: result, source: row})
+		}
+	}
+
+	if len(query.OrderBy) > 0 {
+		type sortKey struct {
+			index  int
+			column string
+			desc   bool
+		}
+		keys := make([]sortKey, len(query.OrderBy))
+		for i, order := range query.OrderBy {
+			index, err := sqlOutputIndex(columns, order.Column, order.Position)
+			if err != nil && (grouped || query.Table == "") {
+				return nil, err
+			}
+			if err != nil {
+				if _, ok := sqlTables[query.Table].column(order.Column); !ok {
+					return nil, err
+				}
+			}
+			keys[i] = sortKey{index: index, column: order.Column, desc: order.Desc}
+		}
+		key := func(o output, k sortKey) interface{} {
+			if k.index >= 0 {
+				return o.values[k.index]
+			}
+			return o.source(k.column)
+		}
+		sort.SliceStable(outputs, func(a, b int) bool {
+			for _, k := range keys {
+				cmp := compareSQLValues(key(outputs[a], k), key(outputs[b], k), k.desc)
+				if cmp != 0 {
+					return cmp < 0
+				}
+			}
+			return false
+		})
+	}
+
+	if query.Offset > 0 {
+		if query.Offset >= len(outputs) {
+			outputs = nil
+		} else {
+			outputs = outputs[query.Offset:]
+		}
+	}
+	if query.Limit >= 0 && query.Limit < len(outputs) {
+		outputs = outputs[:query.Limit]
+	}
+
+	result := &sqlResult{columns: columns, rows: make([][]interface{}, len(outputs))}
+	for i, o := range outputs {
+		result.rows[i] = o.values
+	}
+	return result, nil
+}
+
+// sqlOutputIndex resolves an ORDER BY or GROUP BY term to a result column:
+// a 1-based position, else an output name
+func sqlOutputIndex(columns []sqlColumn, name string, position int) (int, error) {
+	if position > 0 {
+		if position > len(columns) {
+			return -1, sqlErrorf(sqlStateSyntax, "position %d is not in select list", position)
+		}
+		return position - 1, nil
+	}
+	for i, column := range columns {
+		if column.name == name {
+			return i, nil
+		}
+	}
+	return -1, sqlErrorf(sqlStateUndefinedColumn, "column %q does not exist", name)
+}
+
+// groupSQLRows evaluates an aggregating or DISTINCT query. Every item that
+// is not an aggregate must be grouped by; without GROUP BY, a query of
+// aggregates returns one row, and a DISTINCT query groups by every item.
+func groupSQLRows(query *models.SQLSelect, items []models.SQLSelectItem, rows []sqlRow, value func(models.SQLSelectItem, sqlRow) interface{}) ([][]interface{}, error) {
+	keyItems := make(map[int]bool)
+	var extraKeys []string
+	columns := make([]sqlColumn, len(items))
+	for i, item := range items {
+		columns[i] = sqlColumn{name: item.Name()}
+	}
+	for _, term := range query.GroupBy {
+		position, _ := strconv.Atoi(term)
+		index, err := sqlOutputIndex(columns, term, position)
+		if err != nil {
+			// Grouping by a column that is not selected
+			if position > 0 {
+				return nil, err
+			}
+			index = -1
+			for i, item := range items {
+				if item.Aggregate == "" && item.Trunc == "" && item.Column == term {
+					index = i
+				}
+			}
+			if index < 0 {
+				extraKeys = append(extraKeys, term)
+				continue
+			}
+		}
+		if items[index].Aggregate != "" {
+			return nil, sqlErrorf(sqlStateGrouping, "aggregate functions are not allowed in GROUP BY")
+		}
+		keyItems[index] = true
+	}
+	for i, item := range items {
+		if item.Aggregate != "" {
+			continue
+		}
+		if query.Distinct && len(query.GroupBy) == 0 {
+			keyItems[i] = true
+		}
+		if !keyItems[i] && item.Literal == nil && item.Function == "" {
+			return nil, sqlErrorf(sqlStateGrouping, "column %q must appear in the GROUP BY clause or be used in an aggregate function", item.Name())
+		}
+	}
+
+	type group struct {
+		values     []interface{}
+		aggregates []*sqlAggregate
+	}
+	var order []*group
+	groups := make(map[string]*group)
+	newGroup := func(row sqlRow) *group {
+		g := &group{values: make([]interface{}, len(items)), aggregates: make([]*sqlAggregate, len(items))}
+		for i, item := range items {
+			if item.Aggregate != "" {
+				g.aggregates[i] = &sqlAggregate{item: item}
+			} else if row != nil {
+				g.values[i] = value(item, row)
+			}
+		}
+		return g
+	}
+
+	for _, row := range rows {
+		var key strings.Builder
+		for i, item := range items {
+			if keyItems[i] {
+				writeSQLKey(&key, value(item, row))
+			}
+		}
+		for _, column := range extraKeys {
+			writeSQLKey(&key, row(column))
+		}
+		g, ok := groups[key.String()]
+		if !ok {
+			g = newGroup(row)
+			groups[key.String()] = g
+			order = append(order, g)
+		}
+		for i, aggregate := range g.aggregates {
+			if aggregate != nil {
+				aggregate.add(value(models.SQLSelectItem{Column: items[i].Column}, row))
+			}
+		}
+	}
+	if len(order) == 0 && len(keyItems) == 0 && len(extraKeys) == 0 {
+		// Aggregates over no rows still return a row: count 0, others NULL
+		order = append(order, newGroup(nil))
+	}
+
+	results := make([][]interface{}, len(order))
+	for i, g := range order {
+		for j, aggregate := range g.aggregates {
+			if aggregate != nil {
+				g.values[j] = aggregate.result()
+			}
+		}
+		results[i] = g.values
+	}
+	return results, nil
+}
+
+// writeSQLKey appends a value to a group key
+func writeSQLKey(key *strings.Builder, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		key.WriteString("n")
+	case time.Time:
+		fmt.Fprintf(key, "t%d", v.UnixNano())
+	default:
+		fmt.Fprintf(key, "v%T:%v", v, v)
+	}
+	key.WriteByte(0)
+}
+
+// sqlAggregate accumulates an aggregate function over a group
+type sqlAggregate struct {
+	item    models.SQLSelectItem
+	count   int64
+	sum     float64
+	numbers int64
+	best    interface{}
+	seen    map[string]bool
+}
+
+func (a *sqlAggregate) add(value interface{}) {
+	if a.item.Column == "*" {
+		a.count++
+		return
+	}
+	if value == nil {
+		return
+	}
+	if a.item.Distinct {
+		var key strings.Builder
+		writeSQLKey(&key, value)
+		if a.seen == nil {
+			a.seen = make(map[string]bool)
+		}
+		if a.seen[key.String()] {
+			return
+		}
+		a.seen[key.String()] = true
+	}
+	a.count++
+	switch a.item.Aggregate {
+	case "sum", "avg":
+		if number, ok := sqlNumber(value); ok {
+			a.sum += number
+			a.numbers++
+		}
+	case "min":
+		if a.best == nil || compareSQLValues(value, a.best, false) < 0 {
+			a.best = value
+		}
+	case "max":
+		if a.best == nil || compareSQLValues(value, a.best, false) > 0 {
+			a.best = value
+		}
+	}
+}
+
+func (a *sqlAggregate) result() interface{} {
+	switch a.item.Aggregate {
+	case "count":
+		return a.count
+	case "sum":
+		if a.numbers == 0 {
+			return nil
+		}
+		return a.sum
+	case "avg":
+		if a.numbers == 0 {
+			return nil
+		}
+		return a.sum / float64(a.numbers)
+	default:
+		return a.best
+	}
+}
+
+// itemValue evaluates a select item on a row
+func (x *sqlExecutor) itemValue(user *models.SecurityUser, item models.SQLSelectItem, row sqlRow) interface{} {
+	switch {
+	case item.Literal != nil:
+		return sqlLiteralValue(*item.Literal)
+	case item.Function != "":
+		switch item.Function {
+		case "now", "current_timestamp", "statement_timestamp", "transaction_timestamp":
+			return time.Now().UTC()
+		case "version":
+			return "PostgreSQL " + sqlServerVersion + " (EntityDB SQL gateway)"
+		case "current_database", "current_catalog":
+			return x.database
+		case "current_schema":
+			return "public"
+		case "pg_backend_pid":
+			return int64(0)
+		default:
+			if user != nil {
+				return user.Username
+			}
+			return nil
+		}
+	case item.Trunc != "":
+		t, ok := row(item.Column).(time.Time)
+		if !ok {
+			return nil
+		}
+		return truncateSQLTime(t, item.Trunc)
+	default:
+		return row(item.Column)
+	}
+}
+
+// truncateSQLTime truncates a UTC time to the start of the unit; weeks
+// start on Monday as in PostgreSQL
+func truncateSQLTime(t time.Time, unit string) time.Time {
+	t = t.UTC()
+	switch unit {
+	case "second":
+		return t.Truncate(time.Second)
+	case "minute":
+		return t.Truncate(time.Minute)
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// sqlLiteralValue converts a literal to a result value
+func sqlLiteralValue(literal models.SQLValue) interface{} {
+	switch literal.Kind {
+	case models.SQLString:
+		return literal.Text
+	case models.SQLNumber:
+		if n, err := strconv.ParseInt(literal.Text, 10, 64); err == nil {
+			return n
+		}
+		f, _ := strconv.ParseFloat(literal.Text, 64)
+		return f
+	case models.SQLBool:
+		return literal.Text == "true"
+	default:
+		return nil
+	}
+}
+
+// tableRows reads the rows of a table the user may see. Equality conditions
+// of the top-level AND chain on id, type, dataset or a tag are answered from
+// the tag index; other queries scan every entity.
+func (x *sqlExecutor) tableRows(ctx context.Context, user *models.SecurityUser, table string, where *models.SQLCondition) ([]sqlRow, error) {
+	switch table {
+	case "information_schema.tables":
+		var rows []sqlRow
+		for _, name := range sqlEntityTables {
+			values := map[string]interface{}{
+				"table_catalog": x.database, "table_schema": "public", "table_name": name, "table_type": "BASE TABLE",
+			}
+			rows = append(rows, sqlMapRow(values))
+		}
+		return rows, nil
+	case "information_schema.columns":
+		var rows []sqlRow
+		for _, name := range sqlEntityTables {
+			for i, column := range sqlTables[name].columns {
+				values := map[string]interface{}{
+					"table_catalog": x.database, "table_schema": "public", "table_name": name,
+					"column_name": column.name, "ordinal_position": int64(i + 1),
+					"data_type": sqlTypeNames[column.typ], "is_nullable": "YES",
+				}
+				rows = append(rows, sqlMapRow(values))
+			}
+		}
+		return rows, nil
+	}
+
+	entities, err := x.candidates(ctx, table, where)
+	if err != nil {
+		return nil, err
+	}
+	entities = models.RedactEntitiesFor(user, models.FilterReadableEntities(user, entities))
+
+	var rows []sqlRow
+	for i, entity := range entities {
+		if i%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		switch table {
+		case "entities":
+			rows = append(rows, sqlEntityRow(entity))
+		case "tags":
+			rows = append(rows, sqlTagRows(entity, false)...)
+		default:
+			rows = append(rows, sqlTagRows(entity, true)...)
+		}
+		if x.maxRows > 0 && len(rows) > x.maxRows {
+			return nil, sqlErrorf(sqlStateTooManyRows,
+				"query reads more than %d rows; narrow it with equality conditions on id, type, dataset or a tag", x.maxRows)
+		}
+	}
+	return rows, nil
+}
+
+// candidates loads the entities a query may match
+func (x *sqlExecutor) candidates(ctx context.Context, table string, where *models.SQLCondition) ([]*models.Entity, error) {
+	ids, tags := sqlIndexLookup(table, where)
+	if ids != nil {
+		var entities []*models.Entity
+		for _, id := range ids {
+			if entity, err := x.repo.GetByID(id); err == nil && entity != nil {
+				entities = append(entities, entity)
+			}
+		}
+		return entities, nil
+	}
+	switch len(tags) {
+	case 0:
+		return repoList(ctx, x.repo)
+	case 1:
+		return repoListByTag(ctx, x.repo, tags[0])
+	default:
+		return x.repo.ListByTags(tags, true)
+	}
+}
+
+// sqlIndexLookup collects the equality conditions of the top-level AND
+// chain that the repository can answer: entity IDs, and tags every row's
+// entity must have. ids is nil when no condition names an ID.
+func sqlIndexLookup(table string, where *models.SQLCondition) (ids []string, tags []string) {
+	idColumn := "entity_id"
+	if table == "entities" {
+		idColumn = "id"
+	}
+	var namespace, value string
+	var visit func(condition *models.SQLCondition)
+	visit = func(condition *models.SQLCondition) {
+		if condition == nil {
+			return
+		}
+		if condition.Op == models.SQLAnd {
+			visit(condition.Left)
+			visit(condition.Right)
+			return
+		}
+		var values []string
+		switch {
+		case condition.Op == models.SQLCompare && condition.Operator == "=",
+			condition.Op == models.SQLIn && !condition.Negated:
+			for _, v := range condition.Values {
+				if v.Kind != models.SQLString && v.Kind != models.SQLNumber {
+					return
+				}
+				values = append(values, v.Text)
+			}
+		default:
+			return
+		}
+
+		switch column := condition.Column; {
+		case column == idColumn:
+			if ids == nil {
+				ids = values
+			}
+		case len(values) != 1:
+		case column == "type" || column == "dataset":
+			tags = append(tags, column+":"+values[0])
+		case table == "entities":
+			if column != "created_at" && column != "updated_at" && column != "tags" && column != "content" {
+				tags = append(tags, column+":"+values[0])
+			}
+		case column == "tag":
+			tags = append(tags, values[0])
+		case column == "namespace":
+			namespace = values[0]
+		case column == "value":
+			value = values[0]
+		}
+	}
+	visit(where)
+	if namespace != "" && value != "" {
+		tags = append(tags, namespace+":"+value)
+	}
+	return ids, tags
+}
+
+// sqlMapRow is a row of fixed values
+func sqlMapRow(values map[string]interface{}) sqlRow {
+	return func(column string) interface{} {
+		return values[column]
+	}
+}
+
+// sqlText returns nil for an empty string, the NULL of a missing tag
+func sqlText(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// sqlTime converts nanoseconds since the epoch to a UTC time, nil for zero
+func sqlTime(nanos int64) interface{} {
+	if nanos == 0 {
+		return nil
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
+// sqlEntityRow is the entities row of an entity. Columns outside the table
+// read the current value of the tag namespace; content is NULL when it is
+// chunked or not text.
+func sqlEntityRow(entity *models.Entity) sqlRow {
+	return func(column string) interface{} {
+		switch column {
+		case "id":
+			return entity.ID
+		case "type":
+			return sqlText(entity.GetEntityType())
+		case "dataset":
+			return sqlText(entity.GetDataset())
+		case "created_at":
+			return sqlTime(entity.CreatedAt)
+		case "updated_at":
+			return sqlTime(entity.UpdatedAt)
+		case "tags":
+			encoded, _ := json.Marshal(entity.GetTagsWithoutTimestamp())
+			return string(encoded)
+		case "content":
+			if len(entity.Content) == 0 || entity.IsChunked() || !utf8.Valid(entity.Content) {
+				return nil
+			}
+			return string(entity.Content)
+		default:
+			return sqlText(entity.GetTagValue(column))
+		}
+	}
+}
+
+// sqlTagRows returns the tags rows of an entity, with the time each tag was
+// last set, or its history rows with every timestamped entry
+func sqlTagRows(entity *models.Entity, history bool) []sqlRow {
+	entityType, dataset := sqlText(entity.GetEntityType()), sqlText(entity.GetDataset())
+	type entry struct {
+		tag   string
+		nanos int64
+	}
+	var entries []entry
+	latest := make(map[string]int)
+	for _, raw := range entity.Tags {
+		e := entry{tag: raw}
+		if nanos, tag, err := models.ParseTemporalTag(raw); err == nil {
+			e = entry{tag: tag, nanos: nanos}
+		}
+		if !history {
+			if i, ok := latest[e.tag]; ok {
+				if e.nanos > entries[i].nanos {
+					entries[i] = e
+				}
+				continue
+			}
+			latest[e.tag] = len(entries)
+		}
+		entries = append(entries, e)
+	}
+
+	rows := make([]sqlRow, len(entries))
+	for i, e := range entries {
+		rows[i] = sqlTagRow(entity.ID, entityType, dataset, e.tag, e.nanos)
+	}
+	return rows
+}
+
+// sqlTagRow is a tags or history row
+func sqlTagRow(entityID string, entityType, dataset interface{}, tag string, nanos int64) sqlRow {
+	namespace, value, _ := strings.Cut(tag, ":")
+	return func(column string) interface{} {
+		switch column {
+		case "entity_id":
+			return entityID
+		case "type":
+			return entityType
+		case "dataset":
+			return dataset
+		case "namespace":
+			return namespace
+		case "value":
+			return value
+		case "tag":
+			return tag
+		case "timestamp":
+			return sqlTime(nanos)
+		default:
+			return nil
+		}
+	}
+}
+
+// checkSQLConditionColumns rejects conditions on columns the table lacks
+func checkSQLConditionColumns(table sqlTable, condition *models.SQLCondition) error {
+	if condition == nil {
+		return nil
+	}
+	switch condition.Op {
+	case models.SQLAnd, models.SQLOr:
+		if err := checkSQLConditionColumns(table, condition.Left); err != nil {
+			return err
+		}
+		return checkSQLConditionColumns(table, condition.Right)
+	case models.SQLNot:
+		return checkSQLConditionColumns(table, condition.Left)
+	}
+	if _, ok := table.column(condition.Column); !ok {
+		return sqlErrorf(sqlStateUndefinedColumn, "column %q does not exist", condition.Column)
+	}
+	return nil
+}
+
+// compileSQLCondition turns a WHERE condition into a row predicate, with
+// literals converted to the column type once. NULLs never match a
+// comparison, as in SQL.
+func compileSQLCondition(condition *models.SQLCondition, table sqlTable) (func(sqlRow) bool, error) {
+	if condition == nil {
+		return func(sqlRow) bool { return true }, nil
+	}
+	switch condition.Op {
+	case models.SQLAnd, models.SQLOr:
+		left, err := compileSQLCondition(condition.Left, table)
+		if err != nil {
+			return nil, err
+		}
+		right, err := compileSQLCondition(condition.Right, table)
+		if err != nil {
+			return nil, err
+		}
+		if condition.Op == models.SQLAnd {
+			return func(row sqlRow) bool { return left(row) && right(row) }, nil
+		}
+		return func(row sqlRow) bool { return left(row) || right(row) }, nil
+	case models.SQLNot:
+		operand, err := compileSQLCondition(condition.Left, table)
+		if err != nil {
+			return nil, err
+		}
+		return func(row sqlRow) bool { return !operand(row) }, nil
+	}
+
+	column, _ := table.column(condition.Column)
+	name, negated := condition.Column, condition.Negated
+	values := make([]interface{}, len(condition.Values))
+	for i, literal := range condition.Values {
+		value, err := sqlOperand(literal, column.typ)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	var match func(value interface{}) bool
+	switch condition.Op {
+	case models.SQLIsNull:
+		return func(row sqlRow) bool { return (row(name) == nil) != negated }, nil
+	case models.SQLCompare:
+		operator := condition.Operator
+		match = func(value interface{}) bool {
+			cmp, ok := compareSQLOperand(value, values[0])
+			if !ok {
+				return false
+			}
+			switch operator {
+			case "=":
+				return cmp == 0
+			case "!=":
+				return cmp != 0
+			case "<":
+				return cmp < 0
+			case "<=":
+				return cmp <= 0
+			case ">":
+				return cmp > 0
+			default:
+				return cmp >= 0
+			}
+		}
+	case models.SQLIn:
+		match = func(value interface{}) bool {
+			for _, candidate := range values {
+				if cmp, ok := compareSQLOperand(value, candidate); ok && cmp == 0 {
+					return true
+				}
+			}
+			return false
+		}
+	case models.SQLBetween:
+		match = func(value interface{}) bool {
+			low, lowOK := compareSQLOperand(value, values[0])
+			high, highOK := compareSQLOperand(value, values[1])
+			return lowOK && highOK && low >= 0 && high <= 0
+		}
+	case models.SQLLike:
+		pattern, ok := values[0].(string)
+		if !ok {
+			return nil, sqlErrorf(sqlStateDatatype, "LIKE needs a string pattern")
+		}
+		expr, err := sqlLikePattern(pattern, condition.Operator == "ilike")
+		if err != nil {
+			return nil, err
+		}
+		match = func(value interface{}) bool {
+			text, ok := value.(string)
+			return ok && expr.MatchString(text)
+		}
+	default:
+		return nil, sqlErrorf(sqlStateSyntax, "unsupported condition")
+	}
+
+	return func(row sqlRow) bool {
+		value := row(name)
+		if value == nil {
+			return false
+		}
+		return match(value) != negated
+	}, nil
+}
+
+// sqlOperand converts a literal for comparison with a column: timestamps
+// accept RFC 3339, PostgreSQL and date strings, or epoch seconds
+func sqlOperand(literal models.SQLValue, typ sqlType) (interface{}, error) {
+	if literal.Kind == models.SQLNull {
+		return nil, nil
+	}
+	if typ == sqlTypeTimestamptz {
+		if literal.Kind == models.SQLNumber {
+			seconds, _ := strconv.ParseFloat(literal.Text, 64)
+			whole, fraction := math.Modf(seconds)
+			return time.Unix(int64(whole), int64(fraction*1e9)).UTC(), nil
+		}
+		t, err := parseSQLTime(literal.Text)
+		if err != nil {
+			return nil, sqlErrorf(sqlStateInvalidText, "invalid input syntax for type timestamp: %q", literal.Text)
+		}
+		return t, nil
+	}
+	return sqlLiteralValue(literal), nil
+}
+
+// sqlTimeLayouts are the accepted timestamp layouts, zoned ones first
+var sqlTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07:00:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseSQLTime parses a timestamp literal; times without a zone are UTC
+func parseSQLTime(text string) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	for _, layout := range sqlTimeLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", text)
+}
+
+// sqlLikePattern compiles a LIKE pattern: % matches any run of characters,
+// _ one character and \ escapes the next
+func sqlLikePattern(pattern string, caseInsensitive bool) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	if caseInsensitive {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			expr.WriteString(".*")
+		case r == '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// sqlNumber reads a value as a number; text tag values that parse count
+func sqlNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// compareSQLOperand orders a column value against a converted literal.
+// Text compares numerically when both sides are numbers, so tag values
+// such as priority:10 order as numbers against numeric literals.
+func compareSQLOperand(value, operand interface{}) (int, bool) {
+	if value == nil || operand == nil {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case time.Time:
+		t, ok := operand.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		return v.Compare(t), true
+	case bool:
+		b, ok := operand.(bool)
+		if !ok {
+			if text, isText := operand.(string); isText {
+				b, ok = text == "true" || text == "t", text == "true" || text == "t" || text == "false" || text == "f"
+			}
+			if !ok {
+				return 0, false
+			}
+		}
+		return compareSQLBools(v, b), true
+	case string:
+		if text, ok := operand.(string); ok {
+			return strings.Compare(v, text), true
+		}
+		if a, ok := sqlNumber(v); ok {
+			if b, ok := sqlNumber(operand); ok {
+				return compareSQLFloats(a, b), true
+			}
+		}
+		return strings.Compare(v, fmt.Sprint(operand)), true
+	default:
+		a, aOK := sqlNumber(value)
+		b, bOK := sqlNumber(operand)
+		if !aOK || !bOK {
+			return 0, false
+		}
+		return compareSQLFloats(a, b), true
+	}
+}
+
+// compareSQLValues orders result values for ORDER BY, MIN and MAX. NULLs
+// sort last ascending and first descending, as in PostgreSQL; desc
+// reverses the order.
+func compareSQLValues(a, b interface{}, desc bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		if desc {
+			return -1
+		}
+		return 1
+	case b == nil:
+		if desc {
+			return 1
+		}
+		return -1
+	}
+	cmp := 0
+	switch v := a.(type) {
+	case time.Time:
+		if t, ok := b.(time.Time); ok {
+			cmp = v.Compare(t)
+		}
+	case string:
+		if s, ok := b.(string); ok {
+			cmp = strings.Compare(v, s)
+		}
+	case bool:
+		if c, ok := b.(bool); ok {
+			cmp = compareSQLBools(v, c)
+		}
+	default:
+		x, _ := sqlNumber(a)
+		y, _ := sqlNumber(b)
+		cmp = compareSQLFloats(x, y)
+	}
+	if desc {
+		return -cmp
+	}
+	return cmp
+}
+
+func compareSQLFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareSQLBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"net/http"
+)
+
+// StandbyHandler exposes warm standby verification reports
+type StandbyHandler struct {
+	verifier *binary.StandbyVerifier
+	repo     models.EntityRepository
+}
+
+// NewStandbyHandler creates a new standby handler
+func NewStandbyHandler(verifier *binary.StandbyVerifier, repo models.EntityRepository) *StandbyHandler {
+	return &StandbyHandler{verifier: verifier, repo: repo}
+}
+
+// StandbyStatusResponse reports the latest standby verification and recent history
+type StandbyStatusResponse struct {
+	Enabled bool                    `json:"enabled"`
+	Latest  *binary.StandbyReport   `json:"latest"`
+	History []*binary.StandbyReport `json:"history"`
+
+	// WALArchive reports WAL segment archiving for point-in-time recovery;
+	// omitted when archiving is disabled
+	WALArchive *binary.WALArchiveStats `json:"wal_archive,omitempty"`
+}
+
+// GetStandbyStatus returns the latest standby verification report
+// @Summary Get standby verification status
+// @Description Report on the most recent restore of the latest backup: backup freshness, restore integrity and divergence from the primary, and WAL archiving progress
+// @Tags admin
+// @Produce json
+// @Success 200 {object} StandbyStatusResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/standby [get]
+func (h *StandbyHandler) GetStandbyStatus(w http.ResponseWriter, r *http.Request) {
+	response := StandbyStatusResponse{
+		Enabled: h.verifier.IsRunning(),
+		Latest:  h.verifier.LatestReport(),
+		History: h.verifier.History(),
+	}
+	if binaryRepo, err := asTemporalRepository(h.repo); err == nil {
+		if stats, ok := binaryRepo.GetWALArchiveStats(); ok {
+			response.WALArchive = &stats
+		}
+	}
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// RunStandbyVerification restores and checks the latest backup now
+// @Summary Run standby verification
+// @Description Restore the latest backup, replay its WAL and compare it with the primary immediately. Works whether or not background verification is enabled.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} binary.StandbyReport
+// @Security BearerAuth
+// @Router /api/v1/admin/standby/verify [post]
+func (h *StandbyHandler) RunStandbyVerification(w http.ResponseWriter, r *http.Request) {
+	RespondJSON(w, http.StatusOK, h.verifier.Verify())
+}
+
+// VerifyBackupRequest names the backup to verify
+type VerifyBackupRequest struct {
+	// Backup is a file name in the backup directory; empty selects the latest routine backup
+	Backup string `json:"backup"`
+}
+
+// VerifyBackup checks a backup against its manifest
+// @Summary Verify a backup bundle
+// @Description Restore a backup from the backup directory and check its file checksum, per-entity checksums and manifest signature
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body VerifyBackupRequest false "Backup to verify"
+// @Success 200 {object} binary.BackupVerification
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/admin/standby/verify-backup [post]
+func (h *StandbyHandler) VerifyBackup(w http.ResponseWriter, r *http.Request) {
+	var req VerifyBackupRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	result, err := h.verifier.VerifyBackupFile(req.Backup)
+	if err != nil {
+		RespondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
@@ -4,6 +4,7 @@ import (
 	"entitydb/models"
 	"entitydb/config"
 	"entitydb/logger"
+	"entitydb/storage/binary"
 	"fmt"
 	"net/http"
 	"os"
@@ -108,6 +109,9 @@ type StorageMetrics struct {
 	AvgReadLatencyMs    *float64 `json:"avg_read_latency_ms,omitempty"`
 	AvgWriteLatencyMs   *float64 `json:"avg_write_latency_ms,omitempty"`
 	CacheHitRate        *float64 `json:"cache_hit_rate,omitempty"`
+	
+	// IndexMemory is the approximate RAM held by each in-memory index
+	IndexMemory         *binary.IndexMemoryStats `json:"index_memory,omitempty"`
 }
 
 type TemporalMetrics struct {
@@ -240,12 +244,18 @@ func (h *SystemMetricsHandler) SystemMetrics(w http.ResponseWriter, r *http.Requ
 	errorCount := asyncReader.GetMetricValue("error_count")
 	walCheckpoints := asyncReader.GetMetricValue("wal_checkpoint_success_total")
 	
+	var queryCacheHits, queryCacheMisses int
+	if binaryRepo, err := asTemporalRepository(h.entityRepo.EntityRepository); err == nil {
+		queryCache := binaryRepo.QueryCacheStats()
+		queryCacheHits, queryCacheMisses = int(queryCache.Hits), int(queryCache.Misses)
+	}
+	
 	perfMetrics := PerformanceMetrics{
 		GCRuns:              memStats.NumGC,
 		LastGCPause:         int64(memStats.PauseNs[(memStats.NumGC+255)%256]),
 		TotalGCPause:        int64(memStats.PauseTotalNs),
-		QueryCacheHits:      0, // Not implemented - no query cache in current version
-		QueryCacheMiss:      0, // Not implemented - no query cache in current version
+		QueryCacheHits:      queryCacheHits,
+		QueryCacheMiss:      queryCacheMisses,
 		IndexLookups:        0, // Not implemented - index lookup tracking not available
 		HTTPRequestDuration: httpDuration,
 		HTTPRequestsTotal:   httpTotal,
@@ -513,6 +523,12 @@ func (h *SystemMetricsHandler) calculateStorageMetrics() StorageMetrics {
 		cacheHitRate = float64(cacheHits) / float64(totalCacheOps) * 100
 	}
 	
+	var indexMemory *binary.IndexMemoryStats
+	if binaryRepo, err := asTemporalRepository(h.entityRepo.EntityRepository); err == nil {
+		stats := binaryRepo.IndexMemoryStats()
+		indexMemory = &stats
+	}
+	
 	return StorageMetrics{
 		DatabaseSizeBytes: dbSize,
 		WALSizeBytes:     walSize,
@@ -526,6 +542,7 @@ func (h *SystemMetricsHandler) calculateStorageMetrics() StorageMetrics {
 		AvgReadLatencyMs: &avgReadLatency,
 		AvgWriteLatencyMs: &avgWriteLatency,
 		CacheHitRate:     &cacheHitRate,
+		IndexMemory:      indexMemory,
 	}
 }
 
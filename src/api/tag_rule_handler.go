@@ -0,0 +1,93 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/services"
+	"fmt"
+	"net/http"
+)
+
+// TagRuleHandler exposes the tag rules and applies them to existing entities
+type TagRuleHandler struct {
+	service *services.TagRuleService
+	jobs    *JobManager
+}
+
+// tagRuleJobType identifies runs of the tag rules over existing entities
+const tagRuleJobType = "tag-rules"
+
+// NewTagRuleHandler creates a new tag rule handler
+func NewTagRuleHandler(service *services.TagRuleService, jobs *JobManager) *TagRuleHandler {
+	return &TagRuleHandler{service: service, jobs: jobs}
+}
+
+// TagRuleStatusResponse describes the tag rule service and its rules
+type TagRuleStatusResponse struct {
+	Enabled  bool                  `json:"enabled"`
+	Rules    []services.TagRule    `json:"rules"`
+	Stats    services.TagRuleStats `json:"stats"`
+	ApplyJob string                `json:"apply_job,omitempty"`
+}
+
+// GetTagRuleStatus lists tag rules and statistics
+// @Summary Get tag rule status
+// @Description List tag rule entities as parsed by the tag rule service, with statistics of the tags added on write
+// @Tags admin
+// @Produce json
+// @Success 200 {object} TagRuleStatusResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/tag-rules [get]
+func (h *TagRuleHandler) GetTagRuleStatus(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.service.LoadRules()
+	if err != nil {
+		logger.Error("Failed to load tag rules: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to load tag rules")
+		return
+	}
+
+	response := TagRuleStatusResponse{
+		Enabled: h.service.IsEnabled(),
+		Rules:   rules,
+		Stats:   h.service.GetStats(),
+	}
+	if active, ok := h.jobs.Active(tagRuleJobType); ok {
+		response.ApplyJob = active.Status().ID
+	}
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// ApplyTagRules queues a job applying the tag rules to existing entities
+// @Summary Apply tag rules
+// @Description Add the tags of every enabled tag rule to the existing entities of its dataset whose content matches, for entities written before the rule existed or while rules were disabled. Progress and the TagRuleRunResult are reported by /api/v1/jobs/{id}.
+// @Tags admin
+// @Produce json
+// @Success 202 {object} JobStatus
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/tag-rules/apply [post]
+func (h *TagRuleHandler) ApplyTagRules(w http.ResponseWriter, r *http.Request) {
+	if active, ok := h.jobs.Active(tagRuleJobType); ok {
+		RespondError(w, http.StatusConflict, "Tag rules are already being applied: job "+active.Status().ID)
+		return
+	}
+
+	job, err := h.jobs.Submit(tagRuleJobType, requestUserID(r), func(job *Job) error {
+		result, err := h.service.ApplyAll(job.Context(), func(processed, total int, entityID string, err error) {
+			if err != nil {
+				job.AddError(fmt.Errorf("%s: %w", entityID, err))
+			}
+			job.SetProgress(int64(processed), int64(total))
+		})
+		if result != nil {
+			job.SetResult(result)
+		}
+		return err
+	})
+	if err != nil {
+		RespondError(w, http.StatusServiceUnavailable, "Failed to queue tag rule run: "+err.Error())
+		return
+	}
+
+	logger.Info("Tag rule run queued as job %s", job.Status().ID)
+	RespondJSON(w, http.StatusAccepted, job.Status())
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"entitydb/tracing"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware starts the root span of every request, continuing the
+// caller's trace when it sends a W3C traceparent header. Storage operations
+// performed with the request context record child spans.
+type TracingMiddleware struct{}
+
+// NewTracingMiddleware creates a new tracing middleware
+func NewTracingMiddleware() *TracingMiddleware {
+	return &TracingMiddleware{}
+}
+
+// Middleware returns the HTTP middleware function
+func (m *TracingMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", getClientIP(r)),
+				attribute.String("entitydb.request_id", logger.RequestID(ctx)),
+			))
+		defer span.End()
+
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", wrapped.statusCode),
+			attribute.Int("http.response.body.size", wrapped.size),
+		)
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+		}
+	})
+}
+
+// The helpers below hand the request context to repositories that record
+// storage spans, falling back to the plain repository methods
+
+func repoGetByID(ctx context.Context, repo models.EntityRepository, id string) (*models.Entity, error) {
+	if traced, ok := repo.(binary.ContextRepository); ok {
+		return traced.GetByIDContext(ctx, id)
+	}
+	return repo.GetByID(id)
+}
+
+func repoCreate(ctx context.Context, repo models.EntityRepository, entity *models.Entity) error {
+	if traced, ok := repo.(binary.ContextRepository); ok {
+		return traced.CreateContext(ctx, entity)
+	}
+	return repo.Create(entity)
+}
+
+func repoUpdate(ctx context.Context, repo models.EntityRepository, entity *models.Entity) error {
+	if traced, ok := repo.(binary.ContextRepository); ok {
+		return traced.UpdateContext(ctx, entity)
+	}
+	return repo.Update(entity)
+}
@@ -0,0 +1,692 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// uploadSessionType is the entity type of upload session records
+	uploadSessionType = "upload_session"
+
+	// uploadChunkTagPrefix records a received chunk on the session entity
+	// in the form "upload:chunk:<index>:<sha256>:<size>"
+	uploadChunkTagPrefix = "upload:chunk:"
+
+	minUploadChunkSize = 64 * 1024
+	maxUploadChunkSize = 64 * 1024 * 1024
+)
+
+// UploadHandler implements resumable chunked uploads for content too large to
+// send in a single CreateEntity request.
+//
+// An upload is a session entity in the system dataset. Each appended chunk is
+// checksum-verified and stored as a content-addressed chunk referenced by the
+// session, so chunks survive restarts and duplicate data is stored once. On
+// commit the parent entity is created in a single write and the chunk
+// references move from the session to the new entity. Sessions that are not
+// committed within the configured TTL are aborted and their chunks released.
+type UploadHandler struct {
+	repo models.EntityRepository
+	ttl  time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*uploadState
+
+	cleaning int32
+}
+
+// uploadSession is the persisted description of an upload, stored as the
+// session entity's content
+type uploadSession struct {
+	EntityType  string   `json:"entity_type"`
+	Dataset     string   `json:"dataset"`
+	Tags        []string `json:"tags"`
+	ContentType string   `json:"content_type"`
+	ChunkSize   int64    `json:"chunk_size"`
+	TotalSize   int64    `json:"total_size,omitempty"`
+	ExpiresAt   int64    `json:"expires_at"`
+}
+
+// uploadedChunk is a chunk received by an upload session
+type uploadedChunk struct {
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+}
+
+// chunkID returns the ID of the chunk entity holding the chunk's data
+func (c uploadedChunk) chunkID() string {
+	return models.ChunkIDForHash(c.Checksum)
+}
+
+// uploadState is the in-memory view of a session. Chunk tags are written
+// through the batch writer and may not be readable immediately, so received
+// chunks are tracked here and reloaded from tags after a restart.
+type uploadState struct {
+	mu      sync.Mutex
+	id      string
+	owner   string
+	session uploadSession
+	chunks  map[int]uploadedChunk
+	closed  bool
+}
+
+// InitUploadRequest starts a chunked upload
+type InitUploadRequest struct {
+	Tags        []string `json:"tags,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+	ChunkSize   int64    `json:"chunk_size,omitempty"`
+	TotalSize   int64    `json:"total_size,omitempty"`
+}
+
+// CommitUploadRequest finalizes a chunked upload
+type CommitUploadRequest struct {
+	Checksum string `json:"checksum,omitempty"` // Optional SHA256 of the full content
+}
+
+// UploadStatusResponse describes the progress of an upload session
+type UploadStatusResponse struct {
+	UploadID      string `json:"upload_id"`
+	ChunkSize     int64  `json:"chunk_size"`
+	TotalSize     int64  `json:"total_size,omitempty"`
+	ReceivedBytes int64  `json:"received_bytes"`
+	Received      []int  `json:"received"`
+	Missing       []int  `json:"missing,omitempty"`
+	ExpiresAt     int64  `json:"expires_at"`
+}
+
+// NewUploadHandler creates a new upload handler
+func NewUploadHandler(repo models.EntityRepository, cfg *config.Config) *UploadHandler {
+	ttl := cfg.UploadSessionTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &UploadHandler{
+		repo:     repo,
+		ttl:      ttl,
+		sessions: make(map[string]*uploadState),
+	}
+}
+
+// InitUpload handles starting a chunked upload session.
+//
+// HTTP Method: POST
+// Endpoint: /api/v1/entities/upload/init
+// Required Permission: entity:create
+//
+// Request Body:
+//   {
+//     "tags": ["type:document"],
+//     "content_type": "application/octet-stream",
+//     "chunk_size": 4194304,
+//     "total_size": 10737418240
+//   }
+//
+// chunk_size defaults to 4MB and total_size is optional. Every chunk except
+// the last must be exactly chunk_size bytes. As with CreateEntity, uploading
+// a dataset or system dataset entity requires dataset:update.
+func (h *UploadHandler) InitUpload(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req InitUploadRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	session := uploadSession{
+		EntityType:  "entity",
+		Dataset:     "default",
+		ContentType: req.ContentType,
+		ChunkSize:   req.ChunkSize,
+		TotalSize:   req.TotalSize,
+		ExpiresAt:   time.Now().Add(h.ttl).UnixNano(),
+	}
+	if session.ContentType == "" {
+		session.ContentType = "application/octet-stream"
+	}
+	if session.ChunkSize == 0 {
+		session.ChunkSize = models.DefaultChunkConfig().DefaultChunkSize
+	}
+	if session.ChunkSize < minUploadChunkSize || session.ChunkSize > maxUploadChunkSize {
+		RespondError(w, http.StatusBadRequest, fmt.Sprintf("chunk_size must be between %d and %d bytes", minUploadChunkSize, maxUploadChunkSize))
+		return
+	}
+	if session.TotalSize < 0 {
+		RespondError(w, http.StatusBadRequest, "total_size must not be negative")
+		return
+	}
+
+	// Same type and dataset rules as CreateEntity: the URL path wins over tags
+	for _, tag := range req.Tags {
+		switch {
+		case strings.HasPrefix(tag, "type:"):
+			session.EntityType = strings.TrimPrefix(tag, "type:")
+		case strings.HasPrefix(tag, "dataset:"):
+			session.Dataset = strings.TrimPrefix(tag, "dataset:")
+		default:
+			session.Tags = append(session.Tags, tag)
+		}
+	}
+	if pathDataset := extractDatasetFromPath(r.URL.Path); pathDataset != "" {
+		session.Dataset = pathDataset
+	}
+	if rejectDatasetRecordWrite(w, r, session.Tags, []string{"type:" + session.EntityType, "dataset:" + session.Dataset}) {
+		return
+	}
+
+	entity, err := models.NewEntityWithMandatoryTags(uploadSessionType, "system", securityCtx.User.ID, nil)
+	if err != nil {
+		logger.Error("failed to create upload session: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to create upload session")
+		return
+	}
+	entity.Content, _ = json.Marshal(session)
+	entity.AddTag("content:type:application/json")
+
+	if err := h.repo.Create(entity); err != nil {
+		logger.Error("failed to create upload session: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to create upload session")
+		return
+	}
+
+	state := &uploadState{
+		id:      entity.ID,
+		owner:   securityCtx.User.ID,
+		session: session,
+		chunks:  make(map[int]uploadedChunk),
+	}
+	h.mu.Lock()
+	h.sessions[entity.ID] = state
+	h.mu.Unlock()
+
+	logger.Info("upload session started: id=%s, chunk_size=%d, total_size=%d", entity.ID, session.ChunkSize, session.TotalSize)
+
+	// Opportunistically reclaim abandoned sessions
+	go h.cleanupExpiredSessions()
+
+	RespondJSON(w, http.StatusCreated, h.status(state))
+}
+
+// UploadChunk handles appending one chunk to an upload session.
+//
+// HTTP Method: PUT
+// Endpoint: /api/v1/entities/upload/chunk?upload_id=<id>&index=<n>
+// Required Permission: entity:create
+//
+// The request body is the raw chunk data. The X-Chunk-Checksum header (or the
+// checksum query parameter) must carry its hex SHA256. Re-sending a chunk that
+// was already received is a no-op, so interrupted uploads can simply resume.
+func (h *UploadHandler) UploadChunk(w http.ResponseWriter, r *http.Request) {
+	state, ok := h.authorizedState(w, r)
+	if !ok {
+		return
+	}
+
+	index, err := strconv.Atoi(r.URL.Query().Get("index"))
+	if err != nil || index < 0 {
+		RespondError(w, http.StatusBadRequest, "index must be a non-negative integer")
+		return
+	}
+
+	checksum := r.Header.Get("X-Chunk-Checksum")
+	if checksum == "" {
+		checksum = r.URL.Query().Get("checksum")
+	}
+	checksum = strings.ToLower(checksum)
+	if checksum == "" {
+		RespondError(w, http.StatusBadRequest, "X-Chunk-Checksum header is required")
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.closed {
+		RespondError(w, http.StatusNotFound, "Upload session not found")
+		return
+	}
+	if state.session.TotalSize > 0 && int64(index) >= expectedChunkCount(state.session) {
+		RespondError(w, http.StatusBadRequest, "index exceeds the declared total size")
+		return
+	}
+	if existing, received := state.chunks[index]; received {
+		if existing.Checksum != checksum {
+			RespondError(w, http.StatusConflict, fmt.Sprintf("chunk %d was already received with a different checksum", index))
+			return
+		}
+		RespondJSON(w, http.StatusOK, h.status(state))
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, state.session.ChunkSize))
+	if err != nil {
+		RespondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("chunk exceeds chunk_size of %d bytes", state.session.ChunkSize))
+		return
+	}
+	if len(data) == 0 {
+		RespondError(w, http.StatusBadRequest, "chunk is empty")
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != checksum {
+		RespondJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error":    "chunk checksum mismatch",
+			"expected": checksum,
+			"actual":   actual,
+		})
+		return
+	}
+
+	_, reused, err := models.StoreChunk(h.repo, state.id, data)
+	if err != nil {
+		logger.Error("failed to store chunk %d for upload %s: %v", index, state.id, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to store chunk")
+		return
+	}
+
+	tag := fmt.Sprintf("%s%d:%s:%d", uploadChunkTagPrefix, index, checksum, len(data))
+	if err := h.repo.AddTag(state.id, tag); err != nil {
+		logger.Error("failed to record chunk %d for upload %s: %v", index, state.id, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to record chunk")
+		return
+	}
+	state.chunks[index] = uploadedChunk{Checksum: checksum, Size: int64(len(data))}
+
+	logger.TraceIf("chunking", "upload chunk stored: upload=%s, index=%d, size=%d, deduplicated=%v", state.id, index, len(data), reused)
+	RespondJSON(w, http.StatusOK, h.status(state))
+}
+
+// GetUploadStatus handles reporting which chunks an upload session has received.
+//
+// HTTP Method: GET
+// Endpoint: /api/v1/entities/upload/status?upload_id=<id>
+// Required Permission: entity:create
+func (h *UploadHandler) GetUploadStatus(w http.ResponseWriter, r *http.Request) {
+	state, ok := h.authorizedState(w, r)
+	if !ok {
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	RespondJSON(w, http.StatusOK, h.status(state))
+}
+
+// CommitUpload handles finalizing an upload session into an entity.
+//
+// HTTP Method: POST
+// Endpoint: /api/v1/entities/upload/commit?upload_id=<id>
+// Required Permission: entity:create
+//
+// All chunks from 0 to the last received index must be present. The full
+// content is re-hashed from the stored chunks and, if the request carries a
+// checksum, compared against it before the entity is created.
+func (h *UploadHandler) CommitUpload(w http.ResponseWriter, r *http.Request) {
+	state, ok := h.authorizedState(w, r)
+	if !ok {
+		return
+	}
+
+	var req CommitUploadRequest
+	if r.ContentLength > 0 {
+		if err := DecodeJSON(r, &req); err != nil {
+			RespondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.closed {
+		RespondError(w, http.StatusNotFound, "Upload session not found")
+		return
+	}
+
+	count, totalSize, err := validateUploadChunks(state)
+	if err != nil {
+		RespondJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":  err.Error(),
+			"status": h.status(state),
+		})
+		return
+	}
+
+	// Re-hash the stored chunks so the entity checksum reflects what was persisted
+	hasher := sha256.New()
+	for i := 0; i < count; i++ {
+		chunk, err := h.readChunk(state.chunks[i].chunkID())
+		if err != nil {
+			RespondError(w, http.StatusConflict, fmt.Sprintf("chunk %d is no longer available, re-upload it", i))
+			return
+		}
+		hasher.Write(chunk.Content)
+	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	if req.Checksum != "" && strings.ToLower(req.Checksum) != contentHash {
+		RespondJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error":    "content checksum mismatch",
+			"expected": strings.ToLower(req.Checksum),
+			"actual":   contentHash,
+		})
+		return
+	}
+
+	entity, err := models.NewEntityWithMandatoryTags(state.session.EntityType, state.session.Dataset, state.owner, state.session.Tags)
+	if err != nil {
+		logger.Error("failed to create entity for upload %s: %v", state.id, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to create entity")
+		return
+	}
+	entity.AddTag("content:type:" + state.session.ContentType)
+	entity.AddTag(fmt.Sprintf("content:size:%d", totalSize))
+	entity.AddTag("content:checksum:sha256:" + contentHash)
+	entity.AddTag(fmt.Sprintf("content:chunks:%d", count))
+	entity.AddTag(fmt.Sprintf("content:chunk-size:%d", state.session.ChunkSize))
+	for i := 0; i < count; i++ {
+		entity.AddTag(fmt.Sprintf("%s%d:%s", models.ChunkHashTagPrefix, i, state.chunks[i].Checksum))
+	}
+
+	if err := h.repo.Create(entity); errors.Is(err, binary.ErrDatasetQuotaExceeded) {
+		RespondError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	} else if err != nil {
+		logger.Error("failed to create entity for upload %s: %v", state.id, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to create entity")
+		return
+	}
+
+	// Hand the chunks over to the new entity before the session goes away
+	moved := make(map[string]bool)
+	for i := 0; i < count; i++ {
+		chunkID := state.chunks[i].chunkID()
+		if moved[chunkID] {
+			continue
+		}
+		moved[chunkID] = true
+		if err := models.MoveChunkReference(h.repo, state.id, entity.ID, chunkID); err != nil {
+			logger.Error("failed to move chunk %s from upload %s to %s: %v", chunkID, state.id, entity.ID, err)
+		}
+	}
+
+	h.closeSession(state)
+	logger.Info("upload committed: upload=%s, entity=%s, chunks=%d, size=%d", state.id, entity.ID, count, totalSize)
+
+	setChangeCounterHeaders(w, h.repo, entity)
+	result := *entity
+	result.Tags = entity.GetCurrentTags()
+	RespondJSON(w, http.StatusCreated, &result)
+}
+
+// AbortUpload handles discarding an upload session and releasing its chunks.
+//
+// HTTP Method: DELETE
+// Endpoint: /api/v1/entities/upload/abort?upload_id=<id>
+// Required Permission: entity:create
+func (h *UploadHandler) AbortUpload(w http.ResponseWriter, r *http.Request) {
+	state, ok := h.authorizedState(w, r)
+	if !ok {
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.closed {
+		RespondError(w, http.StatusNotFound, "Upload session not found")
+		return
+	}
+
+	released := h.abort(state)
+	logger.Info("upload aborted: upload=%s, chunks_released=%d", state.id, released)
+	RespondJSON(w, http.StatusOK, map[string]interface{}{
+		"upload_id":       state.id,
+		"chunks_released": released,
+	})
+}
+
+// authorizedState loads the session named by upload_id and checks that it
+// belongs to the caller. It writes the error response on failure.
+func (h *UploadHandler) authorizedState(w http.ResponseWriter, r *http.Request) (*uploadState, bool) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return nil, false
+	}
+
+	uploadID := r.URL.Query().Get("upload_id")
+	if uploadID == "" {
+		RespondError(w, http.StatusBadRequest, "upload_id is required")
+		return nil, false
+	}
+
+	state, err := h.loadState(uploadID)
+	if err != nil {
+		RespondError(w, http.StatusNotFound, "Upload session not found")
+		return nil, false
+	}
+	if state.owner != securityCtx.User.ID {
+		RespondError(w, http.StatusForbidden, "Upload session belongs to another user")
+		return nil, false
+	}
+	if time.Now().UnixNano() > state.session.ExpiresAt {
+		state.mu.Lock()
+		if !state.closed {
+			h.abort(state)
+		}
+		state.mu.Unlock()
+		RespondError(w, http.StatusGone, "Upload session expired")
+		return nil, false
+	}
+	return state, true
+}
+
+// loadState returns the in-memory state of a session, rebuilding it from the
+// session entity if needed (e.g. after a restart)
+func (h *UploadHandler) loadState(uploadID string) (*uploadState, error) {
+	h.mu.Lock()
+	state, ok := h.sessions[uploadID]
+	h.mu.Unlock()
+	if ok {
+		return state, nil
+	}
+
+	entity, err := h.repo.GetByID(uploadID)
+	if err != nil || entity == nil || entity.IsRecoveryPlaceholder() || entity.GetTagValue("type") != uploadSessionType {
+		return nil, fmt.Errorf("upload session not found: %s", uploadID)
+	}
+
+	state = &uploadState{
+		id:     entity.ID,
+		owner:  entity.GetTagValue("created_by"),
+		chunks: make(map[int]uploadedChunk),
+	}
+	if err := json.Unmarshal(entity.Content, &state.session); err != nil {
+		return nil, fmt.Errorf("invalid upload session %s: %w", uploadID, err)
+	}
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		if !strings.HasPrefix(tag, uploadChunkTagPrefix) {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(tag, uploadChunkTagPrefix), ":")
+		if len(parts) != 3 {
+			continue
+		}
+		index, err1 := strconv.Atoi(parts[0])
+		size, err2 := strconv.ParseInt(parts[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		state.chunks[index] = uploadedChunk{Checksum: parts[1], Size: size}
+	}
+
+	h.mu.Lock()
+	if existing, ok := h.sessions[uploadID]; ok {
+		state = existing // Lost a race with a concurrent load
+	} else {
+		h.sessions[uploadID] = state
+	}
+	h.mu.Unlock()
+	return state, nil
+}
+
+// readChunk loads a stored chunk. Chunks written moments ago may still be
+// queued in the batch writer, so missing chunks are retried briefly.
+func (h *UploadHandler) readChunk(chunkID string) (*models.Entity, error) {
+	for attempt := 0; ; attempt++ {
+		chunk, err := h.repo.GetByID(chunkID)
+		if err == nil && chunk != nil && !chunk.IsRecoveryPlaceholder() {
+			return chunk, nil
+		}
+		if attempt == 10 {
+			return nil, fmt.Errorf("chunk not found: %s", chunkID)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// abort releases a session's chunks and removes the session. Callers hold state.mu.
+func (h *UploadHandler) abort(state *uploadState) int {
+	released := make(map[string]bool)
+	for _, chunk := range state.chunks {
+		chunkID := chunk.chunkID()
+		if released[chunkID] {
+			continue
+		}
+		released[chunkID] = true
+		if _, err := models.ReleaseChunk(h.repo, state.id, chunkID); err != nil {
+			logger.Error("failed to release chunk %s from upload %s: %v", chunkID, state.id, err)
+		}
+	}
+	h.closeSession(state)
+	return len(released)
+}
+
+// closeSession deletes the session entity and forgets its state. Callers hold state.mu.
+func (h *UploadHandler) closeSession(state *uploadState) {
+	state.closed = true
+	if err := h.repo.Delete(state.id); err != nil {
+		logger.Warn("failed to delete upload session %s: %v", state.id, err)
+	}
+	h.mu.Lock()
+	delete(h.sessions, state.id)
+	h.mu.Unlock()
+}
+
+// cleanupExpiredSessions aborts sessions whose TTL has passed
+func (h *UploadHandler) cleanupExpiredSessions() {
+	if !atomic.CompareAndSwapInt32(&h.cleaning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&h.cleaning, 0)
+
+	entities, err := h.repo.ListByTag("type:" + uploadSessionType)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	for _, entity := range entities {
+		var session uploadSession
+		if err := json.Unmarshal(entity.Content, &session); err != nil || now <= session.ExpiresAt {
+			continue
+		}
+		state, err := h.loadState(entity.ID)
+		if err != nil {
+			continue
+		}
+		state.mu.Lock()
+		if !state.closed {
+			released := h.abort(state)
+			logger.Info("upload session expired: upload=%s, chunks_released=%d", state.id, released)
+		}
+		state.mu.Unlock()
+	}
+}
+
+// status summarises a session's progress. Callers hold state.mu.
+func (h *UploadHandler) status(state *uploadState) UploadStatusResponse {
+	resp := UploadStatusResponse{
+		UploadID:  state.id,
+		ChunkSize: state.session.ChunkSize,
+		TotalSize: state.session.TotalSize,
+		Received:  make([]int, 0, len(state.chunks)),
+		ExpiresAt: state.session.ExpiresAt,
+	}
+	for index, chunk := range state.chunks {
+		resp.Received = append(resp.Received, index)
+		resp.ReceivedBytes += chunk.Size
+	}
+	sort.Ints(resp.Received)
+
+	if state.session.TotalSize > 0 {
+		for i := 0; int64(i) < expectedChunkCount(state.session); i++ {
+			if _, ok := state.chunks[i]; !ok {
+				resp.Missing = append(resp.Missing, i)
+			}
+		}
+	}
+	return resp
+}
+
+// expectedChunkCount returns the number of chunks a session with a declared
+// total size must receive
+func expectedChunkCount(session uploadSession) int64 {
+	return (session.TotalSize + session.ChunkSize - 1) / session.ChunkSize
+}
+
+// validateUploadChunks checks that a session holds a contiguous run of chunks
+// in which only the last is shorter than the chunk size. It returns the chunk
+// count and total size.
+func validateUploadChunks(state *uploadState) (int, int64, error) {
+	count := 0
+	for index := range state.chunks {
+		if index+1 > count {
+			count = index + 1
+		}
+	}
+	if count == 0 {
+		return 0, 0, fmt.Errorf("no chunks received")
+	}
+	if state.session.TotalSize > 0 && int64(count) < expectedChunkCount(state.session) {
+		count = int(expectedChunkCount(state.session))
+	}
+
+	var totalSize int64
+	for i := 0; i < count; i++ {
+		chunk, ok := state.chunks[i]
+		if !ok {
+			return 0, 0, fmt.Errorf("chunk %d is missing", i)
+		}
+		if i < count-1 && chunk.Size != state.session.ChunkSize {
+			return 0, 0, fmt.Errorf("chunk %d is %d bytes, expected %d", i, chunk.Size, state.session.ChunkSize)
+		}
+		totalSize += chunk.Size
+	}
+
+	if state.session.TotalSize > 0 && totalSize != state.session.TotalSize {
+		return 0, 0, fmt.Errorf("received %d bytes, expected %d", totalSize, state.session.TotalSize)
+	}
+	return count, totalSize, nil
+}
@@ -7,8 +7,6 @@ import (
 	"net/http"
 	"strings"
 	"entitydb/logger"
-	
-	"golang.org/x/crypto/bcrypt"
 )
 
 // UserHandler handles user-related API endpoints through entity system
@@ -183,51 +181,15 @@ func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		userEntity = userEntities[0]
 	}
 	
-	// Parse user data from content
-	userData, err := parseUserData(userEntity.Content)
-	if err != nil {
-		logger.Error("Failed to parse user data: %v", err)
-		RespondError(w, http.StatusInternalServerError, "Failed to process user data")
-		return
-	}
-	
-	// Verify current password
-	storedHash, ok := userData["password_hash"]
-	if !ok {
-		RespondError(w, http.StatusInternalServerError, "Invalid user data: missing password hash")
-		return
-	}
-	
-	err = bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(req.CurrentPassword))
-	if err != nil {
+	// Verify current password against the stored credentials
+	stored, err := h.entityRepo.GetByID(userEntity.ID)
+	if err != nil || !models.VerifyCredentialContent(stored.Content, req.CurrentPassword) {
 		RespondError(w, http.StatusUnauthorized, "Current password is incorrect")
 		return
 	}
 	
-	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-	if err != nil {
-		RespondError(w, http.StatusInternalServerError, "Failed to hash new password")
-		return
-	}
-	
-	// Update password in user data
-	userData["password_hash"] = string(hashedPassword)
-	userData["updated_at"] = models.NowString()
-	
-	// Marshal updated user data
-	updatedContent, err := json.Marshal(userData)
-	if err != nil {
-		RespondError(w, http.StatusInternalServerError, "Failed to encode user data")
-		return
-	}
-	
-	// Update entity
-	userEntity.Content = updatedContent
-	userEntity.UpdatedAt = models.Now()
-	
-	// Save to repository
-	if err := h.entityRepo.Update(userEntity); err != nil {
+	if err := h.setPassword(userEntity.ID, req.NewPassword); err != nil {
+		logger.Error("Failed to change password of user %s: %v", req.Username, err)
 		RespondError(w, http.StatusInternalServerError, "Failed to update user")
 		return
 	}
@@ -323,38 +285,8 @@ func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// Parse user data from content
-	userData, err := parseUserData(userEntity.Content)
-	if err != nil {
-		logger.Error("Failed to parse user data: %v", err)
-		RespondError(w, http.StatusInternalServerError, "Failed to process user data")
-		return
-	}
-	
-	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		RespondError(w, http.StatusInternalServerError, "Failed to hash new password")
-		return
-	}
-	
-	// Update password in user data
-	userData["password_hash"] = string(hashedPassword)
-	userData["updated_at"] = models.NowString()
-	
-	// Marshal updated user data
-	updatedContent, err := json.Marshal(userData)
-	if err != nil {
-		RespondError(w, http.StatusInternalServerError, "Failed to encode user data")
-		return
-	}
-	
-	// Update entity
-	userEntity.Content = updatedContent
-	userEntity.UpdatedAt = models.Now()
-	
-	// Save to repository
-	if err := h.entityRepo.Update(userEntity); err != nil {
+	if err := h.setPassword(userEntity.ID, req.Password); err != nil {
+		logger.Error("Failed to reset password of user %s: %v", userEntity.ID, err)
 		RespondError(w, http.StatusInternalServerError, "Failed to update user")
 		return
 	}
@@ -363,28 +295,25 @@ func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	RespondJSON(w, http.StatusOK, map[string]string{"status": "success", "message": "Password reset successfully"})
 }
 
-// parseUserData extracts user data from entity content
-func parseUserData(content []byte) (map[string]string, error) {
-	userData := make(map[string]string)
-	
-	// With root cause fixed, content should be clean JSON
-	if err := json.Unmarshal(content, &userData); err == nil {
-		return userData, nil
-	}
-	
-	// Fallback for existing wrapped content
-	var wrapper map[string]interface{}
-	if err := json.Unmarshal(content, &wrapper); err == nil {
-		if innerContent, ok := wrapper["application/octet-stream"]; ok {
-			if innerStr, ok := innerContent.(string); ok {
-				if err := json.Unmarshal([]byte(innerStr), &userData); err == nil {
-					return userData, nil
-				}
-			}
-		}
+// setPassword replaces the credentials embedded in a user entity
+func (h *UserHandler) setPassword(userID, password string) error {
+	credentials, err := models.CredentialContent(password)
+	if err != nil {
+		return err
 	}
 	
-	return nil, fmt.Errorf("failed to parse user data")
+	// Re-read the entity so its temporal tags are written back unchanged
+	userEntity, err := h.entityRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	return h.entityRepo.Update(&models.Entity{
+		ID:        userEntity.ID,
+		Tags:      userEntity.Tags,
+		Content:   credentials,
+		CreatedAt: userEntity.CreatedAt,
+		UpdatedAt: models.Now(),
+	})
 }
 
 // Helper function to determine user role
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/services"
+	"net/http"
+)
+
+// UserReconciliationHandler exposes detection and merging of duplicate users
+type UserReconciliationHandler struct {
+	reconciler *services.UserReconciler
+}
+
+// NewUserReconciliationHandler creates a new user reconciliation handler
+func NewUserReconciliationHandler(reconciler *services.UserReconciler) *UserReconciliationHandler {
+	return &UserReconciliationHandler{reconciler: reconciler}
+}
+
+// GetDuplicateUsers reports users sharing a username without changing them
+// @Summary Find duplicate users
+// @Description List user entities sharing a username, the survivor each group would be merged into and the references that would be rewritten
+// @Tags admin
+// @Produce json
+// @Success 200 {object} services.UserReconciliationResult
+// @Security BearerAuth
+// @Router /api/v1/admin/users/duplicates [get]
+func (h *UserReconciliationHandler) GetDuplicateUsers(w http.ResponseWriter, r *http.Request) {
+	result, err := h.reconciler.RunOnce(true)
+	if err != nil {
+		logger.Error("Failed to find duplicate users: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to find duplicate users")
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
+
+// ReconcileUsers merges users sharing a username
+// @Summary Merge duplicate users
+// @Description Merge user entities sharing a username into one survivor, rewriting references to the merged users. With dry_run=true nothing is changed.
+// @Tags admin
+// @Produce json
+// @Param dry_run query bool false "Only report what would be merged"
+// @Success 200 {object} services.UserReconciliationResult
+// @Security BearerAuth
+// @Router /api/v1/admin/users/reconcile [post]
+func (h *UserReconciliationHandler) ReconcileUsers(w http.ResponseWriter, r *http.Request) {
+	result, err := h.reconciler.RunOnce(r.URL.Query().Get("dry_run") == "true")
+	if err != nil {
+		logger.Error("User reconciliation failed: %v", err)
+		RespondError(w, http.StatusInternalServerError, "User reconciliation failed: "+err.Error())
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/services"
+	"entitydb/storage/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ViewHandler manages saved queries and runs them with the query path and
+// permission checks of the entity handler
+type ViewHandler struct {
+	service  *services.ViewService
+	entities *EntityHandler
+}
+
+// NewViewHandler creates a new view handler
+func NewViewHandler(service *services.ViewService, entities *EntityHandler) *ViewHandler {
+	return &ViewHandler{service: service, entities: entities}
+}
+
+// ViewListResponse lists views
+type ViewListResponse struct {
+	Views []services.View `json:"views"`
+	Total int             `json:"total"`
+}
+
+// ViewRunResponse is the result of running a view. Views with fields
+// return rows holding only those fields instead of entities.
+type ViewRunResponse struct {
+	View     string                   `json:"view"`
+	Query    string                   `json:"query"`
+	Entities []*models.Entity         `json:"entities,omitempty"`
+	Rows     []map[string]interface{} `json:"rows,omitempty"`
+	Total    int                      `json:"total"`
+	Offset   int                      `json:"offset"`
+	Limit    int                      `json:"limit"`
+}
+
+// respondViewError maps view service errors to responses
+func respondViewError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, services.ErrViewNotFound):
+		RespondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrViewExists):
+		RespondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidView):
+		RespondError(w, http.StatusBadRequest, err.Error())
+	default:
+		logger.Error("Failed to %s view: %v", action, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to "+action+" view")
+	}
+}
+
+// ListViews lists saved queries
+// @Summary List views
+// @Description List saved query definitions, ordered by name
+// @Tags views
+// @Produce json
+// @Success 200 {object} ViewListResponse
+// @Security BearerAuth
+// @Router /api/v1/views [get]
+func (h *ViewHandler) ListViews(w http.ResponseWriter, r *http.Request) {
+	views, err := h.service.List()
+	if err != nil {
+		respondViewError(w, "list", err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, ViewListResponse{Views: views, Total: len(views)})
+}
+
+// CreateView saves a query definition
+// @Summary Create view
+// @Description Save a named query: an EQL expression whose tags may contain {{name}} parameters, with optional dataset, sort, order, projected fields, default limit and parameter defaults
+// @Tags views
+// @Accept json
+// @Produce json
+// @Param request body services.View true "View definition"
+// @Success 201 {object} services.View
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/views [post]
+func (h *ViewHandler) CreateView(w http.ResponseWriter, r *http.Request) {
+	securityCtx, ok := GetSecurityContext(r)
+	if !ok {
+		RespondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	var req services.View
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	view, err := h.service.Create(req, securityCtx.User.ID)
+	if err != nil {
+		respondViewError(w, "create", err)
+		return
+	}
+	RespondJSON(w, http.StatusCreated, view)
+}
+
+// GetView returns a view definition
+// @Summary Get view
+// @Tags views
+// @Produce json
+// @Param name path string true "View name"
+// @Success 200 {object} services.View
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/views/{name} [get]
+func (h *ViewHandler) GetView(w http.ResponseWriter, r *http.Request) {
+	view, err := h.service.Get(mux.Vars(r)["name"])
+	if err != nil {
+		respondViewError(w, "get", err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, view)
+}
+
+// UpdateView replaces a view definition
+// @Summary Update view
+// @Description Replace the definition of a view. The name cannot change.
+// @Tags views
+// @Accept json
+// @Produce json
+// @Param name path string true "View name"
+// @Param request body services.View true "View definition"
+// @Success 200 {object} services.View
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/views/{name} [put]
+func (h *ViewHandler) UpdateView(w http.ResponseWriter, r *http.Request) {
+	var req services.View
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	view, err := h.service.Update(mux.Vars(r)["name"], req)
+	if err != nil {
+		respondViewError(w, "update", err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, view)
+}
+
+// DeleteView removes a view
+// @Summary Delete view
+// @Tags views
+// @Produce json
+// @Param name path string true "View name"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/views/{name} [delete]
+func (h *ViewHandler) DeleteView(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := h.service.Delete(name); err != nil {
+		respondViewError(w, "delete", err)
+		return
+	}
+	RespondJSON(w, http.StatusOK, map[string]interface{}{"view": name, "deleted": true})
+}
+
+// RunView executes a view
+// @Summary Run view
+// @Description Run a saved query. Every query parameter other than limit and offset sets the view parameter of that name; parameters not given use the view's defaults. Values only ever fill tag text, so they cannot change the expression's operators.
+// @Tags views
+// @Produce json
+// @Param name path string true "View name"
+// @Param limit query int false "Page size (default: the view's limit)"
+// @Param offset query int false "Results to skip"
+// @Success 200 {object} ViewRunResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /api/v1/views/{name}/run [get]
+func (h *ViewHandler) RunView(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	view, err := h.service.Get(mux.Vars(r)["name"])
+	if err != nil {
+		respondViewError(w, "run", err)
+		return
+	}
+
+	params := r.URL.Query()
+	limit, offset := view.Limit, 0
+	if value := params.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			RespondError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+	}
+	if value := params.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			RespondError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+	}
+	values := make(map[string]string, len(params))
+	for name := range params {
+		if name != "limit" && name != "offset" {
+			values[name] = params.Get(name)
+		}
+	}
+	expression, err := view.Expression(values)
+	if err != nil {
+		respondViewError(w, "run", err)
+		return
+	}
+
+	if !h.entities.admitQuery(w, r, binary.QuerySpec{Expression: expression}) {
+		return
+	}
+
+	entities, err := h.evaluate(view, expression, startTime)
+	if err != nil {
+		logger.Error("failed to run view %s (%s): %v", view.Name, expression, err)
+		RespondError(w, http.StatusInternalServerError, "Failed to run view")
+		return
+	}
+	entities = readableEntities(r, entities)
+	recordEntityAccess(r, entities, []string{"view:" + view.Name})
+
+	view.SortViewResults(entities)
+	total := len(entities)
+	if offset < len(entities) {
+		entities = entities[offset:]
+	} else {
+		entities = entities[:0]
+	}
+	if limit > 0 && limit < len(entities) {
+		entities = entities[:limit]
+	}
+
+	response := ViewRunResponse{
+		View:   view.Name,
+		Query:  expression,
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+	}
+	entities = redactedEntities(r, entities)
+	if len(view.Fields) > 0 {
+		response.Rows = make([]map[string]interface{}, len(entities))
+		for i, entity := range entities {
+			response.Rows[i] = view.Project(entity)
+		}
+	} else {
+		response.Entities = make([]*models.Entity, len(entities))
+		for i, entity := range entities {
+			response.Entities[i] = h.entities.stripTimestampsFromEntity(entity, false)
+		}
+	}
+	RespondJSON(w, http.StatusOK, response)
+}
+
+// evaluate runs a view's expression and restricts the result to the view's
+// dataset. Permissions are left to the caller.
+func (h *ViewHandler) evaluate(view *services.View, expression string, startTime time.Time) ([]*models.Entity, error) {
+	binaryRepo, err := asTemporalRepository(h.entities.repo)
+	if err != nil {
+		return nil, fmt.Errorf("repository doesn't support expression search: %w", err)
+	}
+	entities, err := binaryRepo.ListByExpression(expression)
+	if queryMetrics != nil {
+		queryMetrics.TrackQuery("view", []string{"view:" + view.Name}, startTime, len(entities), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if view.Dataset != "" {
+		inDataset := entities[:0]
+		for _, entity := range entities {
+			if entity.GetDataset() == view.Dataset {
+				inDataset = append(inDataset, entity)
+			}
+		}
+		entities = inDataset
+	}
+	return entities, nil
+}
+
+// TagViewResult summarizes a scheduled tag_view run
+type TagViewResult struct {
+	View    string `json:"view"`
+	Query   string `json:"query"`
+	Tag     string `json:"tag"`
+	Matched int    `json:"matched"`
+	Tagged  int    `json:"tagged"`
+	Skipped int    `json:"skipped"` // results the owner may not change
+}
+
+// TagViewAction returns the scheduler action that runs a view and adds the
+// schedule's tag to every result the owner may change. Results already
+// carrying the tag are left alone.
+func (h *ViewHandler) TagViewAction() services.ScheduleAction {
+	return services.ScheduleAction{
+		Resource:   "entity",
+		Permission: "update",
+		Validate: func(schedule services.Schedule) error {
+			if schedule.View == "" {
+				return fmt.Errorf("tag_view schedules need a schedule:view tag")
+			}
+			if !strings.Contains(schedule.Tag, ":") {
+				return fmt.Errorf("tag_view schedules need a schedule:tag tag such as schedule:tag:status:stale")
+			}
+			return nil
+		},
+		Run: func(ctx context.Context, schedule services.Schedule, owner *models.SecurityUser) (interface{}, error) {
+			startTime := time.Now()
+			view, err := h.service.Get(schedule.View)
+			if err != nil {
+				return nil, err
+			}
+			expression, err := view.Expression(schedule.Params)
+			if err != nil {
+				return nil, err
+			}
+			entities, err := h.evaluate(view, expression, startTime)
+			if err != nil {
+				return nil, fmt.Errorf("failed to run view %s: %w", view.Name, err)
+			}
+			entities = models.FilterReadableEntities(owner, entities)
+
+			result := &TagViewResult{View: view.Name, Query: expression, Tag: schedule.Tag, Matched: len(entities)}
+			for _, entity := range entities {
+				if err := ctx.Err(); err != nil {
+					return result, err
+				}
+				if entity.HasTag(schedule.Tag) {
+					continue
+				}
+				if !models.CanAccessEntity(owner, entity, models.ACLWrite) {
+					result.Skipped++
+					continue
+				}
+				if err := h.entities.repo.AddTag(entity.ID, schedule.Tag); err != nil {
+					return result, fmt.Errorf("failed to tag %s: %w", entity.ID, err)
+				}
+				result.Tagged++
+			}
+			return result, nil
+		},
+	}
+}
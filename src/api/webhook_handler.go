@@ -0,0 +1,47 @@
+package api
+
+import (
+	"entitydb/logger"
+	"entitydb/services"
+	"net/http"
+)
+
+// WebhookHandler exposes the webhook service's webhooks and delivery statistics
+type WebhookHandler struct {
+	service *services.WebhookService
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(service *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+// WebhookStatusResponse describes the webhook service and its webhooks
+type WebhookStatusResponse struct {
+	Enabled  bool                  `json:"enabled"`
+	Webhooks []services.Webhook    `json:"webhooks"`
+	Stats    services.WebhookStats `json:"stats"`
+}
+
+// GetWebhookStatus lists webhooks and delivery statistics
+// @Summary Get webhook status
+// @Description List webhook entities as parsed by the webhook service, with delivery statistics. Secrets are never returned.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} WebhookStatusResponse
+// @Security BearerAuth
+// @Router /api/v1/admin/webhooks [get]
+func (h *WebhookHandler) GetWebhookStatus(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.service.LoadWebhooks()
+	if err != nil {
+		logger.Error("Failed to load webhooks: %v", err)
+		RespondError(w, http.StatusInternalServerError, "Failed to load webhooks")
+		return
+	}
+
+	RespondJSON(w, http.StatusOK, WebhookStatusResponse{
+		Enabled:  h.service.IsEnabled(),
+		Webhooks: webhooks,
+		Stats:    h.service.GetStats(),
+	})
+}
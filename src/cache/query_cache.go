@@ -13,6 +13,7 @@ package cache
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,6 +31,24 @@ type QueryCache struct {
 	entries  map[string]*CacheEntry
 	maxSize  int
 	ttl      time.Duration
+	
+	// Lookup and removal counters since the cache was created
+	hits        int64
+	misses      int64
+	evictions   int64
+	expirations int64
+}
+
+// QueryCacheStats describes the occupancy and effectiveness of a query cache
+type QueryCacheStats struct {
+	Entries     int     `json:"entries"`
+	MaxSize     int     `json:"max_size"`
+	TTLSeconds  float64 `json:"ttl_seconds"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	HitRate     float64 `json:"hit_rate"`
+	Evictions   int64   `json:"evictions"`
+	Expirations int64   `json:"expirations"`
 }
 
 // NewQueryCache creates a new query cache
@@ -53,16 +72,22 @@ func (c *QueryCache) Get(key string) (interface{}, bool) {
 	c.mu.RUnlock()
 	
 	if !exists {
+		atomic.AddInt64(&c.misses, 1)
 		return nil, false
 	}
 	
 	// Check if entry is expired
 	if time.Since(entry.Timestamp) > c.ttl {
 		c.mu.Lock()
-		delete(c.entries, key)
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+			atomic.AddInt64(&c.expirations, 1)
+		}
 		c.mu.Unlock()
+		atomic.AddInt64(&c.misses, 1)
 		return nil, false
 	}
+	atomic.AddInt64(&c.hits, 1)
 	
 	// Update access count
 	c.mu.Lock()
@@ -77,8 +102,8 @@ func (c *QueryCache) Set(key string, result interface{}) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
-	// Check if we need to evict entries
-	if len(c.entries) >= c.maxSize {
+	// Check if we need to evict entries; replacing a key needs no room
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxSize {
 		c.evictLRU()
 	}
 	
@@ -103,6 +128,7 @@ func (c *QueryCache) evictLRU() {
 	
 	if lruKey != "" {
 		delete(c.entries, lruKey)
+		atomic.AddInt64(&c.evictions, 1)
 	}
 }
 
@@ -117,6 +143,7 @@ func (c *QueryCache) cleanupLoop() {
 		for key, entry := range c.entries {
 			if now.Sub(entry.Timestamp) > c.ttl {
 				delete(c.entries, key)
+				atomic.AddInt64(&c.expirations, 1)
 			}
 		}
 		c.mu.Unlock()
@@ -161,4 +188,30 @@ func (c *QueryCache) GetStats() (int, int) {
 	}
 	
 	return total, hits
-}
\ No newline at end of file
+}
+
+// Stats returns the entry count and the hit, miss, eviction and expiration
+// counters of the cache. Entries dropped by Clear and Invalidate are not
+// counted as evictions.
+func (c *QueryCache) Stats() QueryCacheStats {
+	c.mu.RLock()
+	entries := len(c.entries)
+	c.mu.RUnlock()
+	
+	hits := atomic.LoadInt64(&c.hits)
+	misses := atomic.LoadInt64(&c.misses)
+	hitRate := float64(0)
+	if total := hits + misses; total > 0 {
+		hitRate = float64(hits) / float64(total)
+	}
+	return QueryCacheStats{
+		Entries:     entries,
+		MaxSize:     c.maxSize,
+		TTLSeconds:  c.ttl.Seconds(),
+		Hits:        hits,
+		Misses:      misses,
+		HitRate:     hitRate,
+		Evictions:   atomic.LoadInt64(&c.evictions),
+		Expirations: atomic.LoadInt64(&c.expirations),
+	}
+}
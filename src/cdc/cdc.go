@@ -0,0 +1,74 @@
+// Package cdc publishes EntityDB's change data capture stream to Kafka or
+// NATS JetStream.
+//
+// The storage layer keeps every committed WAL operation in a durable outbox
+// and hands batches to a sink, which must not return until the broker has
+// acknowledged them. Each record carries a sequence number that increases by
+// one per operation; since delivery is at-least-once, consumers skip
+// sequences they have already applied.
+package cdc
+
+import (
+	"encoding/json"
+	"entitydb/config"
+	"entitydb/storage/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sink names accepted by ENTITYDB_CDC_SINK
+const (
+	SinkKafka = "kafka"
+	SinkNATS  = "nats"
+)
+
+// Message headers set on every published record
+const (
+	HeaderSequence = "EntityDB-Sequence"
+	HeaderOp       = "EntityDB-Op"
+	HeaderEntityID = "EntityDB-Entity-ID"
+)
+
+// NewSink creates the sink configured by cfg
+func NewSink(cfg *config.Config) (binary.CDCSink, error) {
+	brokers := parseBrokers(cfg.CDCBrokers)
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("ENTITYDB_CDC_BROKERS is required for change data capture")
+	}
+	if cfg.CDCTopic == "" {
+		return nil, fmt.Errorf("ENTITYDB_CDC_TOPIC is required for change data capture")
+	}
+	switch strings.ToLower(cfg.CDCSink) {
+	case SinkKafka:
+		return NewKafkaSink(brokers, cfg.CDCTopic, cfg.CDCBatchSize), nil
+	case SinkNATS:
+		return NewNATSSink(brokers, cfg.CDCTopic)
+	default:
+		return nil, fmt.Errorf("unknown CDC sink %q (want %q or %q)", cfg.CDCSink, SinkKafka, SinkNATS)
+	}
+}
+
+func parseBrokers(value string) []string {
+	brokers := []string{}
+	for _, broker := range strings.Split(value, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
+
+// encode returns the message body and the header values of a record
+func encode(record binary.CDCRecord) ([]byte, map[string]string, error) {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode CDC record %d: %w", record.Sequence, err)
+	}
+	headers := map[string]string{
+		HeaderSequence: strconv.FormatUint(record.Sequence, 10),
+		HeaderOp:       record.Op,
+		HeaderEntityID: record.EntityID,
+	}
+	return body, headers, nil
+}
@@ -0,0 +1,54 @@
+package cdc
+
+import (
+	"context"
+	"entitydb/storage/binary"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSink writes records to a Kafka topic. Messages are keyed by entity
+// ID, so every operation on an entity lands in the same partition in order.
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaSink creates a sink writing to topic on brokers
+func NewKafkaSink(brokers []string, topic string, batchSize int) *KafkaSink {
+	return &KafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchSize:    batchSize,
+		// The publisher retries failed batches itself
+		MaxAttempts: 1,
+	}}
+}
+
+func (s *KafkaSink) Name() string { return SinkKafka }
+
+// Publish writes records and waits for every in-sync replica to acknowledge
+func (s *KafkaSink) Publish(ctx context.Context, records []binary.CDCRecord) error {
+	messages := make([]kafka.Message, 0, len(records))
+	for _, record := range records {
+		body, headers, err := encode(record)
+		if err != nil {
+			return err
+		}
+		message := kafka.Message{Key: []byte(record.EntityID), Value: body}
+		for key, value := range headers {
+			message.Headers = append(message.Headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+		messages = append(messages, message)
+	}
+	if err := s.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("kafka write failed: %w", err)
+	}
+	return nil
+}
+
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,75 @@
+package cdc
+
+import (
+	"context"
+	"entitydb/storage/binary"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSSink publishes records to a JetStream subject. A stream must capture
+// the subject. Each message ID is derived from its sequence number, so
+// JetStream drops redeliveries within the stream's duplicate window.
+type NATSSink struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+// NewNATSSink connects to servers and publishes to subject
+func NewNATSSink(servers []string, subject string) (*NATSSink, error) {
+	conn, err := nats.Connect(strings.Join(servers, ","),
+		nats.Name("entitydb-cdc"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open JetStream context: %w", err)
+	}
+	return &NATSSink{conn: conn, js: js, subject: subject}, nil
+}
+
+func (s *NATSSink) Name() string { return SinkNATS }
+
+// Publish sends records and waits for JetStream to acknowledge each one
+func (s *NATSSink) Publish(ctx context.Context, records []binary.CDCRecord) error {
+	futures := make([]nats.PubAckFuture, 0, len(records))
+	for _, record := range records {
+		body, headers, err := encode(record)
+		if err != nil {
+			return err
+		}
+		msg := nats.NewMsg(s.subject)
+		msg.Data = body
+		msg.Header.Set(nats.MsgIdHdr, fmt.Sprintf("entitydb-%d", record.Sequence))
+		for key, value := range headers {
+			msg.Header.Set(key, value)
+		}
+		future, err := s.js.PublishMsgAsync(msg)
+		if err != nil {
+			return fmt.Errorf("JetStream publish failed: %w", err)
+		}
+		futures = append(futures, future)
+	}
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			return fmt.Errorf("JetStream publish not acknowledged: %w", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *NATSSink) Close() error {
+	s.conn.Close()
+	return nil
+}
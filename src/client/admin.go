@@ -0,0 +1,311 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Job states reported by JobStatus.Status
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// JobStatus reports the progress of a background job
+type JobStatus struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Owner      string          `json:"owner,omitempty"`
+	Processed  int64           `json:"processed"`
+	Total      int64           `json:"total"`
+	Percent    float64         `json:"percent"`
+	Errors     int64           `json:"errors"`
+	ErrorLog   []string        `json:"error_log,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job has reached a final state
+func (s JobStatus) Finished() bool {
+	return s.Status != JobQueued && s.Status != JobRunning
+}
+
+// Err returns an error describing a job that finished without completing
+func (s JobStatus) Err() error {
+	if s.Status == JobCompleted || !s.Finished() {
+		return nil
+	}
+	message := s.Message
+	if message == "" && len(s.ErrorLog) > 0 {
+		message = s.ErrorLog[len(s.ErrorLog)-1]
+	}
+	return fmt.Errorf("entitydb: job %s %s: %s", s.ID, s.Status, message)
+}
+
+// ExportStatus reports an export job and its file
+type ExportStatus struct {
+	JobStatus
+	Format      string     `json:"format"`
+	Query       string     `json:"query,omitempty"`
+	Entities    int64      `json:"entities"`
+	SizeBytes   int64      `json:"size_bytes"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// ProbeResponse is the result of the readiness probe
+type ProbeResponse struct {
+	Status    string                `json:"status"`
+	Timestamp time.Time             `json:"timestamp"`
+	Uptime    string                `json:"uptime"`
+	Checks    map[string]ProbeCheck `json:"checks"`
+}
+
+// ProbeCheck is one readiness check
+type ProbeCheck struct {
+	Status    string      `json:"status"`
+	Message   string      `json:"message,omitempty"`
+	Observed  interface{} `json:"observed,omitempty"`
+	Threshold interface{} `json:"threshold,omitempty"`
+}
+
+// CreateUserRequest describes a new user
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email,omitempty"`
+	FullName string `json:"full_name,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// Job returns the status of a background job
+func (c *Client) Job(ctx context.Context, id string) (*JobStatus, error) {
+	var status JobStatus
+	if err := c.Do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// CancelJob asks a background job to stop
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	return c.Do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(id)+"/cancel", nil, nil, nil)
+}
+
+// WaitJob polls a job every interval until it finishes and returns its
+// final status. Use JobStatus.Err to check that it completed.
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*JobStatus, error) {
+	return poll(ctx, interval, func() (*JobStatus, bool, error) {
+		status, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, false, err
+		}
+		return status, status.Finished(), nil
+	})
+}
+
+// Reindex queues an index rebuild and returns its job ID
+func (c *Client) Reindex(ctx context.Context, force bool) (string, error) {
+	var response struct {
+		JobID string `json:"job_id"`
+	}
+	if err := c.Do(ctx, http.MethodPost, "/admin/reindex", nil, map[string]bool{"force": force}, &response); err != nil {
+		return "", err
+	}
+	return response.JobID, nil
+}
+
+// EncryptionStatus describes the server's content encryption settings
+type EncryptionStatus struct {
+	Enabled   bool     `json:"enabled"`
+	ActiveKey string   `json:"active_key,omitempty"`
+	Keys      []string `json:"keys"`
+	RekeyJob  string   `json:"rekey_job,omitempty"`
+}
+
+// Encryption returns the server's content encryption settings
+func (c *Client) Encryption(ctx context.Context) (*EncryptionStatus, error) {
+	var status EncryptionStatus
+	if err := c.Do(ctx, http.MethodGet, "/admin/encryption", nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RekeyContent queues re-encryption of stored content with the active
+// master key and returns the job
+func (c *Client) RekeyContent(ctx context.Context) (*JobStatus, error) {
+	var status JobStatus
+	if err := c.Do(ctx, http.MethodPost, "/admin/encryption/rekey", nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// StartExport starts exporting the entities matching q as "jsonl" or "csv"
+func (c *Client) StartExport(ctx context.Context, q Query, format string) (*ExportStatus, error) {
+	query := q.Values()
+	setIf(query, "format", format)
+	var status ExportStatus
+	if err := c.Do(ctx, http.MethodPost, "/entities/export", query, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Export returns the status of an export
+func (c *Client) Export(ctx context.Context, id string) (*ExportStatus, error) {
+	var status ExportStatus
+	if err := c.Do(ctx, http.MethodGet, "/exports/"+url.PathEscape(id), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// WaitExport polls an export every interval until it finishes
+func (c *Client) WaitExport(ctx context.Context, id string, interval time.Duration) (*ExportStatus, error) {
+	return poll(ctx, interval, func() (*ExportStatus, bool, error) {
+		status, err := c.Export(ctx, id)
+		if err != nil {
+			return nil, false, err
+		}
+		return status, status.Finished(), nil
+	})
+}
+
+// DownloadExport streams the file of a completed export
+func (c *Client) DownloadExport(ctx context.Context, id string) (io.ReadCloser, error) {
+	body, _, err := c.Stream(ctx, http.MethodGet, "/exports/"+url.PathEscape(id)+"/download", nil, nil)
+	return body, err
+}
+
+// ImportRequest describes a file import; see the import section of the API
+// reference for the meaning of each field
+type ImportRequest struct {
+	Format       string   // csv, jsonl or sqlite
+	Type         string   // entity type
+	Dataset      string   // dataset, "default" when empty
+	Fields       []string // tag fields as namespace=field or field
+	Tags         []string // tags added to every entity
+	ContentField string   // field stored as content, "-" for none
+	Table        string   // table of a sqlite import
+	Delimiter    string   // field separator of a csv import
+	DryRun       bool
+	MaxErrors    int
+}
+
+// StartImport uploads the file read from r and queues its import. The file
+// is sent in one request, so it is read into memory first.
+func (c *Client) StartImport(ctx context.Context, req ImportRequest, r io.Reader) (*JobStatus, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("entitydb: failed to read import file: %w", err)
+	}
+	query := url.Values{"field": req.Fields, "tag": req.Tags}
+	setIf(query, "format", req.Format)
+	setIf(query, "type", req.Type)
+	setIf(query, "dataset", req.Dataset)
+	setIf(query, "content_field", req.ContentField)
+	setIf(query, "table", req.Table)
+	setIf(query, "delimiter", req.Delimiter)
+	if req.DryRun {
+		query.Set("dry_run", "true")
+	}
+	if req.MaxErrors > 0 {
+		query.Set("max_errors", strconv.Itoa(req.MaxErrors))
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, "/admin/import", query, data, "application/octet-stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var status JobStatus
+	if err := decodeResponse(resp, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// CreateUser creates a user
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*Entity, error) {
+	var user Entity
+	if err := c.Do(ctx, http.MethodPost, "/users/create", nil, req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ChangePassword changes the password of username, which must be the
+// session's user unless it is an administrator
+func (c *Client) ChangePassword(ctx context.Context, username, currentPassword, newPassword string) error {
+	req := map[string]string{
+		"username":         username,
+		"current_password": currentPassword,
+		"new_password":     newPassword,
+	}
+	return c.Do(ctx, http.MethodPost, "/users/change-password", nil, req, nil)
+}
+
+// ResetPassword sets the password of another user (administrators only)
+func (c *Client) ResetPassword(ctx context.Context, username, password string) error {
+	req := map[string]string{"username": username, "password": password}
+	return c.Do(ctx, http.MethodPost, "/users/reset-password", nil, req, nil)
+}
+
+// Ready runs the server's readiness probe. A server that is not ready
+// answers with its failing checks, so the response is returned with a nil
+// error either way.
+func (c *Client) Ready(ctx context.Context) (*ProbeResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/health/ready", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("entitydb: readiness probe: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, readAPIError(resp)
+	}
+	var probe ProbeResponse
+	if err := decodeResponse(resp, &probe); err != nil {
+		return nil, err
+	}
+	return &probe, nil
+}
+
+// poll calls check every interval until it reports done
+func poll[T any](ctx context.Context, interval time.Duration, check func() (T, bool, error)) (T, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		value, done, err := check()
+		if err != nil || done {
+			return value, err
+		}
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
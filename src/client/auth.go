@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// LoginRequest holds the credentials of a password login. Users with
+// two-factor authentication also pass TOTPCode or BackupCode.
+type LoginRequest struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	TOTPCode   string `json:"totp_code,omitempty"`
+	BackupCode string `json:"backup_code,omitempty"`
+}
+
+// Session is an authenticated session
+type Session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      User      `json:"user"`
+}
+
+// User describes an account
+type User struct {
+	ID       string   `json:"id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// Login authenticates with a password and uses the new session for later
+// requests. The credentials are kept to log in again when the session
+// expires; two-factor logins are not repeated automatically.
+func (c *Client) Login(ctx context.Context, req LoginRequest) (*Session, error) {
+	var session Session
+	if err := c.Do(ctx, http.MethodPost, "/auth/login", nil, req, &session); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.token = session.Token
+	c.expiresAt = session.ExpiresAt
+	if req.TOTPCode == "" && req.BackupCode == "" {
+		c.username = req.Username
+		c.password = req.Password
+	} else {
+		c.username, c.password = "", ""
+	}
+	c.mu.Unlock()
+
+	c.notifyRefresh(session.Token, session.ExpiresAt)
+	return &session, nil
+}
+
+// Logout ends the session and forgets the token and credentials
+func (c *Client) Logout(ctx context.Context) error {
+	err := c.Do(ctx, http.MethodPost, "/auth/logout", nil, nil, nil)
+	c.mu.Lock()
+	c.token, c.expiresAt = "", time.Time{}
+	c.username, c.password = "", ""
+	c.mu.Unlock()
+	return err
+}
+
+// Refresh extends the session, replacing the token
+func (c *Client) Refresh(ctx context.Context) (*Session, error) {
+	var session Session
+	if err := c.Do(ctx, http.MethodPost, "/auth/refresh", nil, nil, &session); err != nil {
+		return nil, err
+	}
+	c.SetToken(session.Token, session.ExpiresAt)
+	c.notifyRefresh(session.Token, session.ExpiresAt)
+	return &session, nil
+}
+
+// WhoAmI returns the user of the session
+func (c *Client) WhoAmI(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.Do(ctx, http.MethodGet, "/auth/whoami", nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// refreshIfExpiring renews a session about to expire before it is used. A
+// failed renewal is not fatal: the request itself shows whether the server
+// still accepts the session.
+func (c *Client) refreshIfExpiring(ctx context.Context) {
+	c.mu.Lock()
+	token, expiresAt := c.token, c.expiresAt
+	c.mu.Unlock()
+	if token == "" || expiresAt.IsZero() || time.Until(expiresAt) > refreshWindow {
+		return
+	}
+	c.reauthenticate(ctx, token)
+}
+
+// canReauthenticate reports whether a request rejected with token can be
+// repeated with a new session
+func (c *Client) canReauthenticate(token string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return token != "" || c.username != ""
+}
+
+// reauthenticate replaces the session that issued stale: it is refreshed
+// while still valid, otherwise the stored credentials log in again.
+// Concurrent callers wait for one renewal instead of starting their own.
+func (c *Client) reauthenticate(ctx context.Context, stale string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.Lock()
+	current, expiresAt := c.token, c.expiresAt
+	username, password := c.username, c.password
+	c.mu.Unlock()
+	if current != stale && (expiresAt.IsZero() || time.Until(expiresAt) > refreshWindow) {
+		return nil
+	}
+
+	if current != "" && (expiresAt.IsZero() || time.Now().Before(expiresAt)) {
+		_, err := c.Refresh(ctx)
+		if err == nil {
+			return nil
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || username == "" {
+			return err
+		}
+	}
+	if username == "" {
+		return &APIError{StatusCode: http.StatusUnauthorized, Message: "session expired"}
+	}
+	_, err := c.Login(ctx, LoginRequest{Username: username, Password: password})
+	return err
+}
+
+func (c *Client) notifyRefresh(token string, expiresAt time.Time) {
+	if c.config.OnTokenRefresh != nil {
+		c.config.OnTokenRefresh(token, expiresAt)
+	}
+}
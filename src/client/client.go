@@ -0,0 +1,355 @@
+// Package client is a Go client for the EntityDB REST API.
+//
+// A Client wraps the /api/v1 endpoints in typed methods, keeps its session
+// alive by refreshing the token before it expires (or logging in again with
+// the configured credentials), and retries requests that failed on the
+// network or were refused while the server was busy or shutting down:
+//
+//	c, err := client.New(client.Config{BaseURL: "https://db.example.com"})
+//	if err != nil { ... }
+//	if _, err := c.Login(ctx, client.LoginRequest{Username: "admin", Password: pw}); err != nil { ... }
+//	entity, err := c.CreateEntity(ctx, client.CreateEntityRequest{
+//		Tags:    []string{"type:note"},
+//		Content: "hello",
+//	})
+//
+// Large content is streamed with OpenContent and Upload. Endpoints without a
+// typed method can be called with Do.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults applied by New
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+	DefaultTimeout    = 60 * time.Second
+
+	// refreshWindow is how long before expiry a session is refreshed
+	refreshWindow = time.Minute
+)
+
+// Config configures a Client
+type Config struct {
+	// BaseURL is the server address, e.g. https://db.example.com:8085
+	BaseURL string
+
+	// Token is an existing session token. ExpiresAt, when known, lets the
+	// client refresh it before it expires.
+	Token     string
+	ExpiresAt time.Time
+
+	// Username and Password, when set, are used to log in again if the
+	// session has expired and cannot be refreshed
+	Username string
+	Password string
+
+	// HTTPClient sends the requests; DefaultTimeout applies when nil
+	HTTPClient *http.Client
+
+	// MaxRetries is how often a failed request is retried; negative
+	// disables retries. Backoff doubles from MinBackoff up to MaxBackoff,
+	// with jitter, unless the server sends Retry-After.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// OnTokenRefresh is called whenever the client obtains a new token,
+	// so callers can persist the session
+	OnTokenRefresh func(token string, expiresAt time.Time)
+}
+
+// Client calls the EntityDB REST API. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	config  Config
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	username  string
+	password  string
+
+	// refreshMu serializes token refreshes
+	refreshMu sync.Mutex
+}
+
+// APIError is a response with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+
+	// MFARequired is set when a login needs a second factor
+	MFARequired bool
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("entitydb: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// New creates a client for the server at cfg.BaseURL
+func New(cfg Config) (*Client, error) {
+	base, err := url.Parse(strings.TrimRight(cfg.BaseURL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("entitydb: invalid base URL %q", cfg.BaseURL)
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return &Client{
+		baseURL:   base.String(),
+		http:      httpClient,
+		config:    cfg,
+		token:     cfg.Token,
+		expiresAt: cfg.ExpiresAt,
+		username:  cfg.Username,
+		password:  cfg.Password,
+	}, nil
+}
+
+// BaseURL returns the server address
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// Token returns the current session token and its expiry, zero if unknown
+func (c *Client) Token() (string, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, c.expiresAt
+}
+
+// SetToken replaces the session token
+func (c *Client) SetToken(token string, expiresAt time.Time) {
+	c.mu.Lock()
+	c.token = token
+	c.expiresAt = expiresAt
+	c.mu.Unlock()
+}
+
+// Do calls an API path such as /entities/get with body encoded as JSON, and
+// decodes the response into out, which may be nil or a *json.RawMessage.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("entitydb: failed to encode request: %w", err)
+		}
+	}
+	resp, err := c.send(ctx, method, path, query, payload, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, out)
+}
+
+// Stream calls an API path and returns the response body for the caller
+// to read and close
+func (c *Client) Stream(ctx context.Context, method, path string, query url.Values, header http.Header) (io.ReadCloser, http.Header, error) {
+	resp, err := c.send(ctx, method, path, query, nil, "", header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, resp.Header, nil
+}
+
+// decodeResponse reads a JSON response into out
+func decodeResponse(resp *http.Response, out interface{}) error {
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("entitydb: invalid response: %w", err)
+	}
+	return nil
+}
+
+// send performs a request, refreshing the session and retrying as needed.
+// The response is returned only for 2xx statuses.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, payload []byte, contentType string, header http.Header) (*http.Response, error) {
+	authPath := strings.HasPrefix(path, "/auth/login") || path == "/auth/refresh"
+	if !authPath {
+		c.refreshIfExpiring(ctx)
+	}
+
+	reauthenticated := false
+	for attempt := 0; ; attempt++ {
+		token, _ := c.Token()
+		resp, err := c.attempt(ctx, method, path, query, payload, contentType, header, token)
+
+		if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		// An expired session is renewed once, then the request is repeated
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && !authPath && !reauthenticated && c.canReauthenticate(token) {
+			drain(resp)
+			reauthenticated = true
+			if err := c.reauthenticate(ctx, token); err != nil {
+				return nil, err
+			}
+			attempt--
+			continue
+		}
+
+		delay, retry := c.retryDelay(method, attempt, resp, err)
+		if !retry {
+			if err != nil {
+				return nil, fmt.Errorf("entitydb: %s %s: %w", method, path, err)
+			}
+			return nil, readAPIError(resp)
+		}
+		if resp != nil {
+			drain(resp)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends one request
+func (c *Client) attempt(ctx context.Context, method, path string, query url.Values, payload []byte, contentType string, header http.Header, token string) (*http.Response, error) {
+	target := c.baseURL + "/api/v1" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if payload != nil && contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.http.Do(req)
+}
+
+// retryDelay decides whether a failed attempt is retried and after how
+// long. Network errors and gateway errors are only retried for idempotent
+// methods; 429 and 503 mean the server refused the request without
+// processing it, so every method is retried.
+func (c *Client) retryDelay(method string, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if c.config.MaxRetries < 0 || attempt >= c.config.MaxRetries {
+		return 0, false
+	}
+	idempotent := method == http.MethodGet || method == http.MethodHead || method == http.MethodPut || method == http.MethodDelete
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || !idempotent {
+			return 0, false
+		}
+		return c.backoff(attempt), true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		if !idempotent {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		delay := time.Duration(seconds) * time.Second
+		if delay > c.config.MaxBackoff {
+			delay = c.config.MaxBackoff
+		}
+		return delay, true
+	}
+	return c.backoff(attempt), true
+}
+
+// backoff returns the exponential delay before retry attempt+1, with up to
+// 50% jitter so concurrent clients do not retry in step
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.config.MinBackoff << uint(attempt)
+	if delay <= 0 || delay > c.config.MaxBackoff {
+		delay = c.config.MaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// readAPIError turns an error response into an *APIError
+func readAPIError(resp *http.Response) error {
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	var body struct {
+		Error       string `json:"error"`
+		Message     string `json:"message"`
+		MFARequired bool   `json:"mfa_required"`
+	}
+	if json.Unmarshal(data, &body) == nil {
+		switch {
+		case body.Error != "":
+			apiErr.Message = body.Error
+		case body.Message != "":
+			apiErr.Message = body.Message
+		}
+		apiErr.MFARequired = body.MFARequired
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
+
+// drain discards the rest of a response so the connection can be reused
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRetryAndRelogin checks that refused requests are retried and that an
+// expired session is replaced by logging in again with the stored
+// credentials
+func TestRetryAndRelogin(t *testing.T) {
+	var creates, logins atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/auth/login":
+			n := logins.Add(1)
+			json.NewEncoder(w).Encode(Session{
+				Token:     "token-" + string(rune('0'+n)),
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+		case "/api/v1/auth/refresh":
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to refresh session"})
+		case "/api/v1/entities/create":
+			// The first session expires; the first create with the new one
+			// hits a draining server
+			if r.Header.Get("Authorization") != "Bearer token-2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if creates.Add(1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(Entity{ID: "e1", Tags: []string{"type:note"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var refreshed []string
+	c, err := New(Config{
+		BaseURL:        server.URL,
+		MinBackoff:     time.Millisecond,
+		OnTokenRefresh: func(token string, _ time.Time) { refreshed = append(refreshed, token) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := c.Login(ctx, LoginRequest{Username: "admin", Password: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entity, err := c.CreateEntity(ctx, CreateEntityRequest{Tags: []string{"type:note"}})
+	if err != nil {
+		t.Fatalf("CreateEntity failed: %v", err)
+	}
+	if entity.ID != "e1" {
+		t.Errorf("entity ID = %q, want e1", entity.ID)
+	}
+	if got := logins.Load(); got != 2 {
+		t.Errorf("logins = %d, want 2", got)
+	}
+	if got := creates.Load(); got != 2 {
+		t.Errorf("creates reaching the handler = %d, want 2", got)
+	}
+	if token, _ := c.Token(); token != "token-2" {
+		t.Errorf("token = %q, want token-2", token)
+	}
+	if len(refreshed) != 2 || refreshed[1] != "token-2" {
+		t.Errorf("OnTokenRefresh tokens = %v, want [token-1 token-2]", refreshed)
+	}
+}
+
+// TestNoRetryForUnsafeNetworkErrors checks that a POST whose response was
+// lost is not sent again, since the server may have applied it
+func TestNoRetryForUnsafeNetworkErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// Drop the connection without a response
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer server.Close()
+
+	c, err := New(Config{BaseURL: server.URL, Token: "t", MinBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := c.CreateEntity(ctx, CreateEntityRequest{}); err == nil {
+		t.Error("CreateEntity succeeded on a dropped connection")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("POST attempts = %d, want 1", got)
+	}
+
+	calls.Store(0)
+	if _, err := c.GetEntity(ctx, "e1", GetOptions{}); err == nil {
+		t.Error("GetEntity succeeded on a dropped connection")
+	}
+	if got := calls.Load(); got != DefaultMaxRetries+1 {
+		t.Errorf("GET attempts = %d, want %d", got, DefaultMaxRetries+1)
+	}
+}
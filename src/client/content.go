@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultChunkSize is the upload chunk size used when none is given
+const DefaultChunkSize = 4 * 1024 * 1024
+
+// UploadRequest describes content uploaded in chunks
+type UploadRequest struct {
+	Tags        []string `json:"tags,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+
+	// ChunkSize is the size of every chunk but the last, between 64KB and
+	// 64MB; DefaultChunkSize when zero
+	ChunkSize int64 `json:"chunk_size,omitempty"`
+
+	// TotalSize, when known, lets the server reject oversized uploads early
+	TotalSize int64 `json:"total_size,omitempty"`
+}
+
+// UploadStatus reports the chunks an upload session has received
+type UploadStatus struct {
+	UploadID      string `json:"upload_id"`
+	ChunkSize     int64  `json:"chunk_size"`
+	TotalSize     int64  `json:"total_size,omitempty"`
+	ReceivedBytes int64  `json:"received_bytes"`
+	Received      []int  `json:"received"`
+	Missing       []int  `json:"missing,omitempty"`
+	ExpiresAt     int64  `json:"expires_at"`
+}
+
+// OpenContent streams the content of an entity, reassembling chunked
+// content on the server, starting at offset bytes
+func (c *Client) OpenContent(ctx context.Context, id string, offset int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	body, respHeader, err := c.Stream(ctx, http.MethodGet, "/entities/stream-content", url.Values{"id": {id}, "stream": {"true"}}, header)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 && respHeader.Get("Content-Range") == "" {
+		body.Close()
+		return nil, fmt.Errorf("entitydb: server ignored the range request for %s", id)
+	}
+	return body, nil
+}
+
+// DownloadContent copies the content of an entity to w. A download broken
+// off mid-stream resumes where it stopped, up to the client's retry limit.
+func (c *Client) DownloadContent(ctx context.Context, id string, w io.Writer) (int64, error) {
+	var written int64
+	for attempt := 0; ; attempt++ {
+		body, err := c.OpenContent(ctx, id, written)
+		if err != nil {
+			return written, err
+		}
+		n, err := io.Copy(destination{w}, body)
+		body.Close()
+		written += n
+		if err == nil {
+			return written, nil
+		}
+
+		var writeErr *writeError
+		if errors.As(err, &writeErr) || ctx.Err() != nil || c.config.MaxRetries < 0 || attempt >= c.config.MaxRetries {
+			return written, err
+		}
+		select {
+		case <-ctx.Done():
+			return written, ctx.Err()
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+// Upload stores the content read from r as a new entity, sending it in
+// checksummed chunks so content larger than a single request can be
+// stored. Failed chunks are retried; if the upload cannot complete, the
+// session is aborted so its chunks are released.
+func (c *Client) Upload(ctx context.Context, req UploadRequest, r io.Reader) (*Entity, error) {
+	if req.ChunkSize == 0 {
+		req.ChunkSize = DefaultChunkSize
+	}
+
+	var status UploadStatus
+	if err := c.Do(ctx, http.MethodPost, "/entities/upload/init", nil, req, &status); err != nil {
+		return nil, err
+	}
+	uploadQuery := url.Values{"upload_id": {status.UploadID}}
+
+	entity, err := c.uploadChunks(ctx, status, uploadQuery, r)
+	if err != nil {
+		// The caller's context may be done; aborting must still reach the server
+		abortCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		c.AbortUpload(abortCtx, status.UploadID)
+		cancel()
+		return nil, err
+	}
+	return entity, nil
+}
+
+// uploadChunks sends the chunks of r and commits the upload
+func (c *Client) uploadChunks(ctx context.Context, status UploadStatus, uploadQuery url.Values, r io.Reader) (*Entity, error) {
+	total := sha256.New()
+	buf := make([]byte, status.ChunkSize)
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("entitydb: failed to read upload content: %w", err)
+		}
+		chunk := buf[:n]
+		total.Write(chunk)
+
+		sum := sha256.Sum256(chunk)
+		query := url.Values{"upload_id": uploadQuery["upload_id"], "index": {strconv.Itoa(index)}}
+		header := http.Header{"X-Chunk-Checksum": {hex.EncodeToString(sum[:])}}
+		resp, sendErr := c.send(ctx, http.MethodPut, "/entities/upload/chunk", query, chunk, "application/octet-stream", header)
+		if sendErr != nil {
+			return nil, fmt.Errorf("entitydb: chunk %d: %w", index, sendErr)
+		}
+		drain(resp)
+
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+
+	var entity Entity
+	commit := map[string]string{"checksum": hex.EncodeToString(total.Sum(nil))}
+	if err := c.Do(ctx, http.MethodPost, "/entities/upload/commit", uploadQuery, commit, &entity); err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// UploadStatus returns the chunks an upload session has received
+func (c *Client) UploadStatus(ctx context.Context, uploadID string) (*UploadStatus, error) {
+	var status UploadStatus
+	if err := c.Do(ctx, http.MethodGet, "/entities/upload/status", url.Values{"upload_id": {uploadID}}, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// AbortUpload discards an upload session and its chunks
+func (c *Client) AbortUpload(ctx context.Context, uploadID string) error {
+	return c.Do(ctx, http.MethodDelete, "/entities/upload/abort", url.Values{"upload_id": {uploadID}}, nil, nil)
+}
+
+// destination marks failures writing a download's output, which resuming
+// cannot fix
+type destination struct{ w io.Writer }
+
+func (d destination) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	if err != nil {
+		err = &writeError{err}
+	}
+	return n, err
+}
+
+type writeError struct{ err error }
+
+func (e *writeError) Error() string { return e.err.Error() }
+func (e *writeError) Unwrap() error { return e.err }
@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Entity is an entity as returned by the API. Tags carry their timestamps
+// ("<nanoseconds>|tag") only when requested with IncludeTimestamps.
+type Entity struct {
+	ID        string   `json:"id"`
+	Tags      []string `json:"tags"`
+	Content   []byte   `json:"content,omitempty"`
+	CreatedAt int64    `json:"created_at,omitempty"`
+	UpdatedAt int64    `json:"updated_at,omitempty"`
+}
+
+// CreateEntityRequest describes a new entity. Content may be a string,
+// stored as text, or a value marshalled to a JSON object or array.
+type CreateEntityRequest struct {
+	Tags    []string    `json:"tags,omitempty"`
+	Content interface{} `json:"content,omitempty"`
+}
+
+// UpdateEntityRequest replaces the tags and content of an entity
+type UpdateEntityRequest struct {
+	ID      string      `json:"id"`
+	Tags    []string    `json:"tags,omitempty"`
+	Content interface{} `json:"content,omitempty"`
+}
+
+// GetOptions select what GetEntity returns
+type GetOptions struct {
+	IncludeContent    bool
+	IncludeTimestamps bool
+}
+
+// ListOptions filter ListEntities. Tag is matched exactly unless Wildcard
+// is set; Namespace matches every tag of a namespace such as status.
+type ListOptions struct {
+	Tag               string
+	Wildcard          bool
+	Search            string
+	Namespace         string
+	IncludeTimestamps bool
+}
+
+// Query describes an /entities/query request
+type Query struct {
+	Tags     []string
+	Dataset  string
+	Filter   string
+	Operator string
+	Value    string
+	Sort     string
+	Order    string
+	Limit    int
+	Offset   int
+}
+
+// Values returns the query parameters of q
+func (q Query) Values() url.Values {
+	values := url.Values{}
+	for _, tag := range q.Tags {
+		values.Add("tag", tag)
+	}
+	setIf(values, "dataset", q.Dataset)
+	setIf(values, "filter", q.Filter)
+	setIf(values, "operator", q.Operator)
+	setIf(values, "value", q.Value)
+	setIf(values, "sort", q.Sort)
+	setIf(values, "order", q.Order)
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		values.Set("offset", strconv.Itoa(q.Offset))
+	}
+	return values
+}
+
+// QueryResult is a page of query results
+type QueryResult struct {
+	Entities []Entity `json:"entities"`
+	Total    int      `json:"total"`
+	Offset   int      `json:"offset"`
+	Limit    int      `json:"limit"`
+}
+
+// TagPatch reports the tags PatchTags added and removed
+type TagPatch struct {
+	ID      string   `json:"id"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// DeletionStatus is the lifecycle state of an entity
+type DeletionStatus struct {
+	EntityID        string     `json:"entity_id"`
+	LifecycleState  string     `json:"lifecycle_state"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy       string     `json:"deleted_by,omitempty"`
+	DeleteReason    string     `json:"delete_reason,omitempty"`
+	RetentionPolicy string     `json:"retention_policy,omitempty"`
+	CanRestore      bool       `json:"can_restore"`
+	CanPurge        bool       `json:"can_purge"`
+}
+
+// GetEntity returns an entity by ID
+func (c *Client) GetEntity(ctx context.Context, id string, opts GetOptions) (*Entity, error) {
+	query := url.Values{"id": {id}, "include_content": {strconv.FormatBool(opts.IncludeContent)}}
+	if opts.IncludeTimestamps {
+		query.Set("include_timestamps", "true")
+	}
+	var entity Entity
+	if err := c.Do(ctx, http.MethodGet, "/entities/get", query, nil, &entity); err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// ListEntities lists the entities matching opts
+func (c *Client) ListEntities(ctx context.Context, opts ListOptions) ([]Entity, error) {
+	query := url.Values{}
+	setIf(query, "tag", opts.Tag)
+	setIf(query, "search", opts.Search)
+	setIf(query, "namespace", opts.Namespace)
+	if opts.Wildcard {
+		query.Set("wildcard", "true")
+	}
+	if opts.IncludeTimestamps {
+		query.Set("include_timestamps", "true")
+	}
+	var entities []Entity
+	if err := c.Do(ctx, http.MethodGet, "/entities/list", query, nil, &entities); err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+// QueryEntities runs a filtered, sorted and paged query
+func (c *Client) QueryEntities(ctx context.Context, q Query) (*QueryResult, error) {
+	var result QueryResult
+	if err := c.Do(ctx, http.MethodGet, "/entities/query", q.Values(), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CreateEntity creates an entity; the server assigns its ID
+func (c *Client) CreateEntity(ctx context.Context, req CreateEntityRequest) (*Entity, error) {
+	var entity Entity
+	if err := c.Do(ctx, http.MethodPost, "/entities/create", nil, req, &entity); err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// UpdateEntity replaces the tags and content of an entity
+func (c *Client) UpdateEntity(ctx context.Context, req UpdateEntityRequest) (*Entity, error) {
+	var entity Entity
+	if err := c.Do(ctx, http.MethodPut, "/entities/update", nil, req, &entity); err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// PatchTags adds and removes individual tags
+func (c *Client) PatchTags(ctx context.Context, id string, add, remove []string) (*TagPatch, error) {
+	req := struct {
+		ID         string   `json:"id"`
+		AddTags    []string `json:"add_tags,omitempty"`
+		RemoveTags []string `json:"remove_tags,omitempty"`
+	}{id, add, remove}
+	var patch TagPatch
+	if err := c.Do(ctx, http.MethodPatch, "/entities/patch-tags", nil, req, &patch); err != nil {
+		return nil, err
+	}
+	return &patch, nil
+}
+
+// DeleteEntity soft-deletes an entity. Policy may be empty for the
+// default retention policy.
+func (c *Client) DeleteEntity(ctx context.Context, id, reason, policy string) (*DeletionStatus, error) {
+	req := map[string]string{"reason": reason}
+	if policy != "" {
+		req["policy"] = policy
+	}
+	var status DeletionStatus
+	if err := c.Do(ctx, http.MethodPost, "/entities/"+url.PathEscape(id)+"/delete", nil, req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RestoreEntity restores a soft-deleted entity
+func (c *Client) RestoreEntity(ctx context.Context, id, reason string) (*DeletionStatus, error) {
+	var status DeletionStatus
+	req := map[string]string{"reason": reason}
+	if err := c.Do(ctx, http.MethodPost, "/entities/"+url.PathEscape(id)+"/restore", nil, req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func setIf(values url.Values, key, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
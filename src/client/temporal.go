@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Change is one tag change of an entity
+type Change struct {
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"`
+	OldValue  string `json:"old_value,omitempty"`
+	NewValue  string `json:"new_value,omitempty"`
+	EntityID  string `json:"entity_id,omitempty"`
+}
+
+// Diff compares an entity at two points in time
+type Diff struct {
+	EntityID    string   `json:"entity_id"`
+	FromTime    string   `json:"from_time"`
+	ToTime      string   `json:"to_time"`
+	Before      *Entity  `json:"before"`
+	After       *Entity  `json:"after"`
+	AddedTags   []string `json:"added_tags,omitempty"`
+	RemovedTags []string `json:"removed_tags,omitempty"`
+}
+
+// History returns the tag changes of an entity, newest first; limit 0
+// uses the server default
+func (c *Client) History(ctx context.Context, id string, limit int) ([]Change, error) {
+	query := url.Values{"id": {id}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var changes []Change
+	if err := c.Do(ctx, http.MethodGet, "/entities/history", query, nil, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// AsOf returns an entity as it was at t
+func (c *Client) AsOf(ctx context.Context, id string, t time.Time) (*Entity, error) {
+	query := url.Values{"id": {id}, "as_of": {t.UTC().Format(time.RFC3339Nano)}}
+	var entity Entity
+	if err := c.Do(ctx, http.MethodGet, "/entities/as-of", query, nil, &entity); err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// Diff compares an entity at from and to
+func (c *Client) Diff(ctx context.Context, id string, from, to time.Time) (*Diff, error) {
+	query := url.Values{
+		"id":   {id},
+		"from": {from.UTC().Format(time.RFC3339)},
+		"to":   {to.UTC().Format(time.RFC3339)},
+	}
+	var diff Diff
+	if err := c.Do(ctx, http.MethodGet, "/entities/diff", query, nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// Changes returns recent changes across entities, or of one entity when id
+// is set
+func (c *Client) Changes(ctx context.Context, id string, limit int) ([]Change, error) {
+	query := url.Values{}
+	setIf(query, "id", id)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var changes []Change
+	if err := c.Do(ctx, http.MethodGet, "/entities/changes", query, nil, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
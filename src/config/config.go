@@ -12,6 +12,7 @@ package config
 
 import (
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -127,6 +128,24 @@ type Config struct {
 	// Recommendation: 2-8 hours for web applications, 1-2 hours for APIs
 	SessionTTLHours int
 	
+	// AuthzHookURL is the endpoint of an external policy engine (e.g. an OPA
+	// data API URL) consulted for every permission check.
+	// Environment: ENTITYDB_AUTHZ_HOOK_URL
+	// Default: "" (local RBAC only)
+	// Fallback: Local RBAC decides when the endpoint fails or returns no result
+	AuthzHookURL string
+	
+	// AuthzHookTimeout bounds each call to the policy engine.
+	// Environment: ENTITYDB_AUTHZ_HOOK_TIMEOUT_MS (milliseconds)
+	// Default: 500 milliseconds
+	AuthzHookTimeout time.Duration
+	
+	// AuthzHookCacheTTL defines how long policy engine decisions are cached.
+	// Environment: ENTITYDB_AUTHZ_HOOK_CACHE_TTL (seconds)
+	// Default: 30 seconds
+	// Note: 0 disables caching; policy changes take up to this long to apply
+	AuthzHookCacheTTL time.Duration
+	
 	// HTTP Server Timeouts
 	// ====================
 	
@@ -154,6 +173,54 @@ type Config struct {
 	// Recommendation: 30-60 seconds to allow active requests to complete
 	ShutdownTimeout time.Duration
 	
+	// ReadOnly starts the server in read-only mode: mutating API requests are
+	// refused with 503 while reads are served, until the mode is changed
+	// through /api/v1/admin/mode. Used to freeze writes for migrations,
+	// compaction or restores without stopping the server.
+	// Environment: ENTITYDB_READ_ONLY
+	// Default: false
+	ReadOnly bool
+	
+	// HTTP2Enabled serves HTTP/2 to clients that negotiate it over TLS.
+	// Plain HTTP is always served as HTTP/1.1.
+	// Environment: ENTITYDB_HTTP2_ENABLED
+	// Default: false
+	HTTP2Enabled bool
+	
+	// ResponseCompression compresses JSON responses with zstd or gzip for
+	// clients that accept it, preferring zstd.
+	// Environment: ENTITYDB_RESPONSE_COMPRESSION
+	// Default: true
+	ResponseCompression bool
+	
+	// ResponseCompressionMinSize is the size in bytes below which JSON
+	// responses are sent uncompressed.
+	// Environment: ENTITYDB_RESPONSE_COMPRESSION_MIN_SIZE
+	// Default: 1024
+	ResponseCompressionMinSize int
+	
+	// Health Probe Configuration
+	// ==========================
+	
+	// HealthMinFreeDiskMB is the free space below which /health/ready fails
+	// its disk check, measured on the volume holding the database file.
+	// Environment: ENTITYDB_HEALTH_MIN_FREE_DISK_MB
+	// Default: 100
+	HealthMinFreeDiskMB int
+	
+	// HealthMaxMemoryPressure is the memory pressure (0-1, as tracked by the
+	// memory monitor) above which /health/ready fails its memory check.
+	// Environment: ENTITYDB_HEALTH_MAX_MEMORY_PRESSURE
+	// Default: 0.95
+	HealthMaxMemoryPressure float64
+	
+	// HealthMaxReplicationLag is the age of the latest standby-verified backup
+	// above which /health/ready fails its replication check. 0 reports the
+	// lag without failing on it.
+	// Environment: ENTITYDB_HEALTH_MAX_REPLICATION_LAG (seconds)
+	// Default: 0
+	HealthMaxReplicationLag time.Duration
+	
 	// Metrics Collection Configuration
 	// ================================
 	
@@ -257,6 +324,32 @@ type Config struct {
 	// Security: Can create metric recursion if misconfigured
 	MetricsEnableStorageTracking bool
 	
+	// MetricsRollupEnabled rolls raw metric values up into 1m, 1h and 1d
+	// buckets on dedicated rollup entities for /metrics/history.
+	// Environment: ENTITYDB_METRICS_ROLLUP_ENABLED
+	// Default: true
+	MetricsRollupEnabled bool
+	
+	// MetricsRollupInterval defines how often completed buckets are rolled up.
+	// Environment: ENTITYDB_METRICS_ROLLUP_INTERVAL (seconds)
+	// Default: 60 seconds
+	MetricsRollupInterval time.Duration
+	
+	// MetricsRollupKeep1Min is the number of 1-minute buckets kept per metric.
+	// Environment: ENTITYDB_METRICS_ROLLUP_KEEP_1MIN
+	// Default: 1440 (one day); at least 120
+	MetricsRollupKeep1Min int
+	
+	// MetricsRollupKeep1Hour is the number of 1-hour buckets kept per metric.
+	// Environment: ENTITYDB_METRICS_ROLLUP_KEEP_1HOUR
+	// Default: 720 (30 days); at least 48
+	MetricsRollupKeep1Hour int
+	
+	// MetricsRollupKeep1Day is the number of 1-day buckets kept per metric.
+	// Environment: ENTITYDB_METRICS_ROLLUP_KEEP_1DAY
+	// Default: 365
+	MetricsRollupKeep1Day int
+	
 	// API Documentation Configuration
 	// ===============================
 	
@@ -277,6 +370,41 @@ type Config struct {
 	// Recommendation: "info" for production, "debug" for development
 	LogLevel string
 	
+	// LogFormat selects the log output format.
+	// Environment: ENTITYDB_LOG_FORMAT
+	// Default: "text"
+	// Valid values: "text" (printf-style lines), "json" (one object per line
+	// with timestamp, level, subsystem and request/user/entity IDs, for
+	// ingestion by Loki or ELK)
+	LogFormat string
+	
+	// Tracing Configuration
+	// =====================
+	
+	// TracingEnabled exports OpenTelemetry spans for API requests and the
+	// storage operations they perform (WAL writes, index updates, disk
+	// reads and writes, cache lookups).
+	// Environment: ENTITYDB_TRACING_ENABLED
+	// Default: false
+	TracingEnabled bool
+	
+	// OTLPEndpoint is the OTLP/HTTP collector spans are exported to. An
+	// https URL exports over TLS; a URL without a path posts to /v1/traces.
+	// Environment: ENTITYDB_OTLP_ENDPOINT
+	// Default: "http://localhost:4318"
+	OTLPEndpoint string
+	
+	// TracingSampleRate is the fraction of new traces recorded, from 0 to 1.
+	// Requests carrying a W3C traceparent header follow the caller's decision.
+	// Environment: ENTITYDB_TRACING_SAMPLE_RATE
+	// Default: 1.0
+	TracingSampleRate float64
+	
+	// TracingServiceName is the service.name resource attribute of spans.
+	// Environment: ENTITYDB_TRACING_SERVICE_NAME
+	// Default: "entitydb"
+	TracingServiceName string
+	
 	// Performance Configuration
 	// =========================
 	
@@ -316,6 +444,57 @@ type Config struct {
 	// Recommendation: Set to 10-20% of available memory
 	EntityCacheMemoryLimit int64
 	
+	// CachePinTags lists tags that pin entities in the entity cache.
+	// Environment: ENTITYDB_CACHE_PIN_TAGS
+	// Default: "cache:pinned"
+	// Format: comma-separated tags, e.g. "cache:pinned,type:role"
+	// Purpose: Keep auth, config and hot reference entities in memory, never evicted
+	// Note: Pinned entities count towards the cache limits
+	CachePinTags string
+	
+	// IDBloomFilter answers lookups of missing entity IDs from a Bloom filter.
+	// Environment: ENTITYDB_ID_BLOOM_FILTER
+	// Default: true
+	// Purpose: Return 404 for IDs that were never stored without a disk read
+	// or recovery attempt
+	IDBloomFilter bool
+	
+	// IDBloomFalsePositiveRate is the target false positive rate of the ID filter.
+	// Environment: ENTITYDB_ID_BLOOM_FALSE_POSITIVE_RATE
+	// Default: 0.01
+	// Note: A false positive costs the disk read the filter would have saved;
+	// memory is about 1.2 bytes per entity at 1%
+	IDBloomFalsePositiveRate float64
+	
+	// Write Batching and Durability Configuration
+	// ==========================================
+	
+	// BatchWrites queues creates and tag additions and commits them in
+	// batches with one WAL fsync per batch.
+	// Environment: ENTITYDB_USE_BATCH_WRITES
+	// Default: true
+	// Purpose: Trade a short acknowledgement-to-durability window for write throughput
+	BatchWrites bool
+	
+	// BatchWriteSize is the number of queued writes that triggers a flush.
+	// Environment: ENTITYDB_BATCH_WRITE_SIZE
+	// Default: 10
+	BatchWriteSize int
+	
+	// BatchFlushInterval is how often queued writes are flushed.
+	// Environment: ENTITYDB_BATCH_FLUSH_INTERVAL_MS
+	// Default: 100 (milliseconds)
+	// Note: Bounds how long a relaxed write can be lost after it is acknowledged
+	BatchFlushInterval time.Duration
+	
+	// DurabilityMode is the durability of writes that neither the request
+	// (X-EntityDB-Durability header) nor the dataset (durability setting) selects.
+	// Environment: ENTITYDB_DURABILITY_MODE
+	// Default: "relaxed"
+	// Values: "strict" fsyncs the WAL before each write returns; "relaxed"
+	// group-commits through the batch writer when batch writes are enabled
+	DurabilityMode string
+	
 	// Rate Limiting Configuration
 	// ===========================
 	
@@ -399,6 +578,198 @@ type Config struct {
 	// Recommendation: 10-12 for most applications
 	BcryptCost int
 	
+	// MFAKeyFile holds the key that encrypts users' TOTP secrets.
+	// Environment: ENTITYDB_MFA_KEY_FILE
+	// Default: "./mfa.key" (relative to DataPath, generated on first start)
+	// Losing the key disables two-factor login for enrolled users until reset
+	MFAKeyFile string
+	
+	// MFAIssuer is the issuer name shown in authenticator apps.
+	// Environment: ENTITYDB_MFA_ISSUER
+	// Default: "EntityDB"
+	MFAIssuer string
+	
+	// OIDC Single Sign-On Configuration
+	// ==================================
+	
+	// OIDCEnabled turns on login through an OpenID Connect identity provider.
+	// Environment: ENTITYDB_OIDC_ENABLED
+	// Default: false
+	OIDCEnabled bool
+	
+	// OIDCIssuerURL is the provider's issuer; its discovery document is
+	// fetched from <issuer>/.well-known/openid-configuration.
+	// Environment: ENTITYDB_OIDC_ISSUER_URL
+	// Default: ""
+	OIDCIssuerURL string
+	
+	// OIDCClientID is the client ID registered with the provider.
+	// Environment: ENTITYDB_OIDC_CLIENT_ID
+	// Default: ""
+	OIDCClientID string
+	
+	// OIDCClientSecret is the client secret; empty for public clients.
+	// Environment: ENTITYDB_OIDC_CLIENT_SECRET
+	// Default: ""
+	OIDCClientSecret string
+	
+	// OIDCRedirectURL is the callback URL registered with the provider,
+	// e.g. https://db.example.com/api/v1/auth/oidc/callback.
+	// Environment: ENTITYDB_OIDC_REDIRECT_URL
+	// Default: ""
+	OIDCRedirectURL string
+	
+	// OIDCScopes are the space-separated scopes requested at login.
+	// Environment: ENTITYDB_OIDC_SCOPES
+	// Default: "openid profile email"
+	OIDCScopes string
+	
+	// OIDCUsernameClaim is the ID token claim used as the username; email and
+	// then sub are used when it is missing.
+	// Environment: ENTITYDB_OIDC_USERNAME_CLAIM
+	// Default: "preferred_username"
+	OIDCUsernameClaim string
+	
+	// OIDCGroupsClaim is the ID token claim listing the user's groups.
+	// Environment: ENTITYDB_OIDC_GROUPS_CLAIM
+	// Default: "groups"
+	OIDCGroupsClaim string
+	
+	// OIDCGroupRoles maps provider groups to EntityDB roles, as
+	// comma-separated group=role pairs (e.g. "db-admins=admin,staff=user").
+	// Environment: ENTITYDB_OIDC_GROUP_ROLES
+	// Default: ""
+	OIDCGroupRoles string
+	
+	// OIDCDefaultRole is granted to users none of whose groups are mapped;
+	// empty rejects them.
+	// Environment: ENTITYDB_OIDC_DEFAULT_ROLE
+	// Default: "user"
+	OIDCDefaultRole string
+	
+	// OIDCPasswordLogin keeps password login available alongside OIDC.
+	// Environment: ENTITYDB_OIDC_PASSWORD_LOGIN
+	// Default: true
+	OIDCPasswordLogin bool
+	
+	// LDAP Directory Synchronization Configuration
+	// ============================================
+	
+	// LDAPSyncEnabled turns on importing users and group memberships from an
+	// LDAP or Active Directory server. Synchronized users log in with their
+	// directory password.
+	// Environment: ENTITYDB_LDAP_SYNC_ENABLED
+	// Default: false
+	LDAPSyncEnabled bool
+	
+	// LDAPURL is the directory server, ldap:// or ldaps://.
+	// Environment: ENTITYDB_LDAP_URL
+	// Default: "ldap://localhost:389"
+	LDAPURL string
+	
+	// LDAPStartTLS upgrades ldap:// connections with StartTLS.
+	// Environment: ENTITYDB_LDAP_START_TLS
+	// Default: false
+	LDAPStartTLS bool
+	
+	// LDAPCACertFile is a PEM bundle trusted for the server certificate;
+	// empty uses the system roots.
+	// Environment: ENTITYDB_LDAP_CA_CERT_FILE
+	// Default: ""
+	LDAPCACertFile string
+	
+	// LDAPBindDN is the service account used for searches; empty binds
+	// anonymously.
+	// Environment: ENTITYDB_LDAP_BIND_DN
+	// Default: ""
+	LDAPBindDN string
+	
+	// LDAPBindPassword is the service account password.
+	// Environment: ENTITYDB_LDAP_BIND_PASSWORD
+	// Default: ""
+	LDAPBindPassword string
+	
+	// LDAPUserBaseDN is where users are searched (subtree).
+	// Environment: ENTITYDB_LDAP_USER_BASE_DN
+	// Default: ""
+	LDAPUserBaseDN string
+	
+	// LDAPUserFilter selects the users to synchronize.
+	// Environment: ENTITYDB_LDAP_USER_FILTER
+	// Default: "(objectClass=person)"
+	LDAPUserFilter string
+	
+	// LDAPUsernameAttribute holds the username (sAMAccountName for AD).
+	// Environment: ENTITYDB_LDAP_USERNAME_ATTRIBUTE
+	// Default: "uid"
+	LDAPUsernameAttribute string
+	
+	// LDAPEmailAttribute holds the email address; empty skips emails.
+	// Environment: ENTITYDB_LDAP_EMAIL_ATTRIBUTE
+	// Default: "mail"
+	LDAPEmailAttribute string
+	
+	// LDAPIDAttribute holds a stable unique user ID (objectGUID for AD), so
+	// renamed users keep their account.
+	// Environment: ENTITYDB_LDAP_ID_ATTRIBUTE
+	// Default: "entryUUID"
+	LDAPIDAttribute string
+	
+	// LDAPGroupAttribute lists a user's groups on the user entry. Used when
+	// LDAPGroupBaseDN is empty.
+	// Environment: ENTITYDB_LDAP_GROUP_ATTRIBUTE
+	// Default: "memberOf"
+	LDAPGroupAttribute string
+	
+	// LDAPGroupBaseDN, when set, reads memberships from group entries
+	// instead of the user entries.
+	// Environment: ENTITYDB_LDAP_GROUP_BASE_DN
+	// Default: ""
+	LDAPGroupBaseDN string
+	
+	// LDAPGroupFilter selects group entries under LDAPGroupBaseDN.
+	// Environment: ENTITYDB_LDAP_GROUP_FILTER
+	// Default: "(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=group)(objectClass=posixGroup))"
+	LDAPGroupFilter string
+	
+	// LDAPGroupMemberAttribute lists the members of a group entry, as DNs
+	// (member, uniqueMember) or usernames (memberUid).
+	// Environment: ENTITYDB_LDAP_GROUP_MEMBER_ATTRIBUTE
+	// Default: "member"
+	LDAPGroupMemberAttribute string
+	
+	// LDAPGroupRoles maps groups to EntityDB roles, as semicolon-separated
+	// group=role pairs; groups are DNs or common names
+	// (e.g. "cn=dba,ou=groups,dc=example,dc=com=admin;staff=user").
+	// Environment: ENTITYDB_LDAP_GROUP_ROLES
+	// Default: ""
+	LDAPGroupRoles string
+	
+	// LDAPDefaultRole is granted to users none of whose groups are mapped;
+	// empty leaves them out of the sync.
+	// Environment: ENTITYDB_LDAP_DEFAULT_ROLE
+	// Default: ""
+	LDAPDefaultRole string
+	
+	// LDAPSyncInterval is how often the directory is synchronized; 0 syncs
+	// only at startup and on request.
+	// Environment: ENTITYDB_LDAP_SYNC_INTERVAL (seconds)
+	// Default: 900 (15 minutes)
+	LDAPSyncInterval time.Duration
+	
+	// LDAPDeprovision deactivates synchronized users that left the directory
+	// or lost every mapped group, and revokes their sessions.
+	// Environment: ENTITYDB_LDAP_DEPROVISION
+	// Default: true
+	LDAPDeprovision bool
+	
+	// LDAPLinkLocalUsers converts local users whose username exists in the
+	// directory into directory users. When false such users are reported as
+	// conflicts and left alone.
+	// Environment: ENTITYDB_LDAP_LINK_LOCAL_USERS
+	// Default: false
+	LDAPLinkLocalUsers bool
+	
 	// File and Path Configuration
 	// ===========================
 	
@@ -448,6 +819,24 @@ type Config struct {
 	// When exceeded, oldest backups are removed
 	BackupMaxSizeMB int64
 	
+	// BackupManifestEnabled writes a manifest with per-entity checksums next to each routine backup.
+	// Environment: ENTITYDB_BACKUP_MANIFEST_ENABLED
+	// Default: true
+	// Purpose: Prove backups copied between environments or offsite are untampered
+	BackupManifestEnabled bool
+	
+	// BackupSigningKey is an Ed25519 private key file used to sign backup manifests.
+	// Environment: ENTITYDB_BACKUP_SIGNING_KEY
+	// Default: "" (manifests are not signed)
+	// PEM encoded PKCS#8 key or base64 encoded 32-byte seed
+	BackupSigningKey string
+	
+	// BackupVerifyKey is an Ed25519 public key file used to verify backup manifests.
+	// Environment: ENTITYDB_BACKUP_VERIFY_KEY
+	// Default: "" (signatures are checked only for integrity, not required)
+	// When set, backups without a valid signature fail verification
+	BackupVerifyKey string
+	
 	// TempPath is the directory for temporary files.
 	// Environment: ENTITYDB_TEMP_PATH
 	// Default: "./tmp"
@@ -534,6 +923,604 @@ type Config struct {
 	// Default: 4
 	// Purpose: Balance performance vs resource usage
 	DeletionCollectorConcurrency int
+	
+	// Index Rebuild Configuration
+	// ===========================
+	
+	// IndexRebuildWorkers controls how many goroutines build indexes at startup.
+	// Environment: ENTITYDB_INDEX_REBUILD_WORKERS
+	// Default: number of CPUs
+	// Purpose: Scale startup WAL decoding, entity loading and index rebuild with available cores
+	IndexRebuildWorkers int
+	
+	// IndexRebuildChunkSize defines how many entities each worker claims at once.
+	// Environment: ENTITYDB_INDEX_REBUILD_CHUNK_SIZE
+	// Default: 50
+	// Purpose: Balance goroutine overhead against lock contention
+	IndexRebuildChunkSize int
+	
+	// IndexRebuildIORateLimitMB caps rebuild throughput in megabytes per second.
+	// Environment: ENTITYDB_INDEX_REBUILD_IO_RATE_LIMIT_MB
+	// Default: 0 (unlimited)
+	// Purpose: Keep rebuilds from saturating disks shared with other workloads
+	IndexRebuildIORateLimitMB int
+	
+	// ContentIndexPaths lists JSON content paths to index, per dataset.
+	// Environment: ENTITYDB_CONTENT_INDEX_PATHS
+	// Default: "" (no content path index)
+	// Format: comma-separated "dataset:path" pairs, "*" as dataset for all datasets;
+	//         paths are dot-separated or JSONPaths
+	// Example: "default:customer.country,orders:$.status"
+	// Purpose: Serve equality filters on content paths without scanning content
+	ContentIndexPaths string
+	
+	// TagIndexMemoryBudget caps the memory of the tag index in bytes. Past it,
+	// posting lists of tags not looked up recently are spilled to disk and
+	// read back on demand.
+	// Environment: ENTITYDB_TAG_INDEX_MEMORY_BUDGET
+	// Default: 0 (everything stays in memory)
+	// Purpose: Keep huge tag spaces from exhausting memory
+	TagIndexMemoryBudget int64
+	
+	// TagIndexSpillDir is where spilled posting lists are written. The file is
+	// unlinked on creation, so nothing is left behind after a restart.
+	// Environment: ENTITYDB_TAG_INDEX_SPILL_DIR
+	// Default: "" (DataPath)
+	// Purpose: Put spilled postings on fast local storage
+	TagIndexSpillDir string
+	
+	// Dataset Quota Configuration
+	// ===========================
+	
+	// DatasetQuotaMaxEntities caps the number of entities in each dataset.
+	// Environment: ENTITYDB_DATASET_QUOTA_MAX_ENTITIES
+	// Default: 0 (unlimited)
+	// Purpose: Stop one dataset from growing without bound. Datasets can set
+	// their own limit with the quota_max_entities setting; the system dataset
+	// is only limited by its own setting.
+	DatasetQuotaMaxEntities int64
+	
+	// DatasetQuotaMaxBytes caps content plus tag bytes in each dataset.
+	// Environment: ENTITYDB_DATASET_QUOTA_MAX_BYTES
+	// Default: 0 (unlimited)
+	// Purpose: Bound per-dataset storage; overridden by the quota_max_bytes setting
+	DatasetQuotaMaxBytes int64
+	
+	// DatasetQuotaMode selects what happens to writes past a quota: "warn"
+	// logs them, "reject" refuses them.
+	// Environment: ENTITYDB_DATASET_QUOTA_MODE
+	// Default: "warn"
+	// Purpose: Roll quotas out as soft limits before enforcing them
+	DatasetQuotaMode string
+	
+	// Content Versioning Configuration
+	// ================================
+	
+	// ContentVersioning keeps the content an update replaces in a version
+	// entity, so GetEntityAsOf returns the content of the requested time.
+	// Environment: ENTITYDB_CONTENT_VERSIONING
+	// Default: false
+	// Purpose: Make content changes as retrievable as tag changes
+	ContentVersioning bool
+	
+	// ContentVersionLimit caps the content versions kept per entity; the
+	// oldest are deleted first.
+	// Environment: ENTITYDB_CONTENT_VERSION_LIMIT
+	// Default: 0 (unlimited)
+	// Purpose: Bound the storage used by frequently rewritten content
+	ContentVersionLimit int
+	
+	// Entity Lock Configuration
+	// =========================
+	
+	// EntityLockEnforce makes entity updates honor advisory locks: while
+	// another user holds an unexpired lock, updates are refused.
+	// Environment: ENTITYDB_ENTITY_LOCK_ENFORCE
+	// Default: false
+	// Purpose: Keep clients that do not take locks from clobbering edits
+	EntityLockEnforce bool
+	
+	// EntityLockDefaultTTL is the lease of a lock taken without a ttl.
+	// Environment: ENTITYDB_ENTITY_LOCK_DEFAULT_TTL (seconds)
+	// Default: 300 seconds (5 minutes)
+	// Purpose: Release locks of clients that stop renewing them
+	EntityLockDefaultTTL time.Duration
+	
+	// EntityLockMaxTTL is the longest lease a lock may be taken for.
+	// Environment: ENTITYDB_ENTITY_LOCK_MAX_TTL (seconds)
+	// Default: 3600 seconds (1 hour)
+	// Purpose: Bound how long a crashed client can keep an entity locked
+	EntityLockMaxTTL time.Duration
+	
+	// Query Admission Configuration
+	// =============================
+	
+	// QueryAdmissionEnabled enables cost estimation and admission control for queries.
+	// Environment: ENTITYDB_QUERY_ADMISSION_ENABLED
+	// Default: true
+	// Purpose: Protect the server from accidental full scans
+	QueryAdmissionEnabled bool
+	
+	// QueryMaxCost defines the highest estimated cost a single query may have.
+	// Environment: ENTITYDB_QUERY_MAX_COST
+	// Default: 100000 (0 = unlimited)
+	// Purpose: Reject queries that would touch too many entities
+	QueryMaxCost int
+	
+	// QueryUserBudget defines the query cost each user may spend per minute.
+	// Environment: ENTITYDB_QUERY_USER_BUDGET
+	// Default: 0 (unlimited)
+	// Purpose: Stop one user from monopolising the query path
+	QueryUserBudget int
+	
+	// QueryDatasetBudget defines the query cost each dataset may absorb per minute.
+	// Environment: ENTITYDB_QUERY_DATASET_BUDGET
+	// Default: 0 (unlimited)
+	// Purpose: Isolate busy datasets from each other
+	QueryDatasetBudget int
+	
+	// QueryQueueTimeout defines how long a query waits for budget before rejection.
+	// Environment: ENTITYDB_QUERY_QUEUE_TIMEOUT (seconds)
+	// Default: 5 seconds
+	// Purpose: Queue short bursts instead of failing them outright
+	QueryQueueTimeout time.Duration
+	
+	// QueryTimeout defines how long an entity list, query or search may read.
+	// Environment: ENTITYDB_QUERY_TIMEOUT (seconds)
+	// Default: 0 (no deadline; reads still stop when the client disconnects)
+	// Purpose: Abandon scans that outlive the HTTP write timeout
+	QueryTimeout time.Duration
+	
+	// Upload Configuration
+	// ====================
+	
+	// UploadSessionTTL defines how long an uncommitted chunked upload may stay open.
+	// Environment: ENTITYDB_UPLOAD_SESSION_TTL (seconds)
+	// Default: 86400 seconds (24 hours)
+	// Purpose: Reclaim chunks from abandoned uploads
+	UploadSessionTTL time.Duration
+	
+	// Encryption Configuration
+	// ========================
+	
+	// EncryptionEnabled controls whether entity content is encrypted at rest.
+	// Environment: ENTITYDB_ENCRYPTION_ENABLED
+	// Default: false
+	// Purpose: Keep content out of the data file and WAL in plaintext (AES-256-GCM,
+	// one data key per write sealed with a master key). Tags are not encrypted.
+	EncryptionEnabled bool
+	
+	// EncryptionKeyFile names the master key ring: one "<key-id> <base64 key>"
+	// line per 32-byte key. Keys stay listed after rotation so older content
+	// can still be read.
+	// Environment: ENTITYDB_ENCRYPTION_KEY_FILE
+	// Default: "" (required when encryption is enabled, unless a key command is set)
+	EncryptionKeyFile string
+	
+	// EncryptionKeyCommand is run through the shell at startup and must print
+	// the key ring on stdout, e.g. a KMS or vault CLI call.
+	// Environment: ENTITYDB_ENCRYPTION_KEY_COMMAND
+	// Default: "" (takes precedence over EncryptionKeyFile when set)
+	EncryptionKeyCommand string
+	
+	// EncryptionActiveKey is the ID of the master key new content is sealed with.
+	// Environment: ENTITYDB_ENCRYPTION_ACTIVE_KEY
+	// Default: "" (the last key in the key ring)
+	EncryptionActiveKey string
+	
+	// Signing Configuration
+	// =====================
+	
+	// SigningEnabled controls whether entities are signed when written.
+	// Environment: ENTITYDB_SIGNING_ENABLED
+	// Default: false
+	// Purpose: Let consumers prove content and tags were not changed outside
+	// EntityDB (Ed25519 over the entity ID, tags and content)
+	SigningEnabled bool
+	
+	// SigningKeyFile names the signing key ring: one "<key-id> <base64 key>"
+	// line per Ed25519 seed or private key. Keys stay listed after rotation
+	// so older signatures can still be verified.
+	// Environment: ENTITYDB_SIGNING_KEY_FILE
+	// Default: "" (required when signing is enabled)
+	SigningKeyFile string
+	
+	// SigningActiveKey is the ID of the key new signatures are made with.
+	// Environment: ENTITYDB_SIGNING_ACTIVE_KEY
+	// Default: "" (the last key in the key ring)
+	SigningActiveKey string
+	
+	// Compression Configuration
+	// =========================
+	
+	// CompressionCodec is the codec content over 1KB is compressed with:
+	// gzip, zstd, lz4 or none. Records keep the codec they were written with,
+	// so changing it never affects reading existing content.
+	// Environment: ENTITYDB_COMPRESSION_CODEC
+	// Default: "gzip"
+	CompressionCodec string
+	
+	// CompressionContentTypes overrides the codec per content type, as
+	// comma-separated "content-type=codec" pairs, e.g.
+	// "application/json=zstd,image/*=none".
+	// Environment: ENTITYDB_COMPRESSION_CONTENT_TYPES
+	// Default: "" (CompressionCodec for all content)
+	CompressionContentTypes string
+	
+	// WAL Archive Configuration
+	// =========================
+	
+	// WALArchiveDir enables WAL archiving. Each checkpoint seals the entries
+	// logged since the previous one into a numbered segment in this directory
+	// before the WAL is truncated.
+	// Environment: ENTITYDB_WAL_ARCHIVE_DIR
+	// Default: "" (archiving disabled)
+	// Purpose: Keep the change history needed for point-in-time recovery
+	WALArchiveDir string
+	
+	// WALArchiveCommand ships each sealed segment elsewhere, e.g. to an object
+	// store. It is run through the shell with %p replaced by the segment's
+	// path and %f by its name; the local copy is removed once it succeeds.
+	// Environment: ENTITYDB_WAL_ARCHIVE_COMMAND
+	// Default: "" (segments stay in WALArchiveDir)
+	// Example: "aws s3 cp %p s3://backups/entitydb/wal/%f"
+	WALArchiveCommand string
+	
+	// Change Data Capture Configuration
+	// =================================
+	
+	// CDCSink selects the broker every committed WAL operation is published to.
+	// Environment: ENTITYDB_CDC_SINK ("kafka" or "nats")
+	// Default: "" (change data capture disabled)
+	// Purpose: Feed search indexing, analytics and other pipelines in real time
+	CDCSink string
+	
+	// CDCBrokers lists the brokers to connect to.
+	// Environment: ENTITYDB_CDC_BROKERS
+	// Default: "" (required when CDCSink is set)
+	// Format: comma-separated host:port Kafka brokers or NATS server URLs
+	CDCBrokers string
+	
+	// CDCTopic is the Kafka topic or NATS subject operations are published to.
+	// Environment: ENTITYDB_CDC_TOPIC
+	// Default: "entitydb.changes"
+	CDCTopic string
+	
+	// CDCOutboxPath holds operations until the broker acknowledges them.
+	// Environment: ENTITYDB_CDC_OUTBOX_PATH (relative to data path)
+	// Default: "./cdc"
+	// Purpose: Operations survive broker outages and restarts until delivered
+	CDCOutboxPath string
+	
+	// CDCBatchSize limits the operations sent per broker request.
+	// Environment: ENTITYDB_CDC_BATCH_SIZE
+	// Default: 100
+	CDCBatchSize int
+	
+	// Job Queue Configuration
+	// =======================
+	
+	// JobWorkers defines how many background jobs (reindex, exports,
+	// retention runs) run at once; further jobs wait in the queue.
+	// Environment: ENTITYDB_JOB_WORKERS
+	// Default: 2
+	JobWorkers int
+	
+	// JobQueueSize limits how many jobs may wait for a worker.
+	// Environment: ENTITYDB_JOB_QUEUE_SIZE
+	// Default: 100 (submissions beyond it are rejected with 503)
+	JobQueueSize int
+	
+	// JobHistory defines how many finished jobs are kept for status queries.
+	// Environment: ENTITYDB_JOB_HISTORY
+	// Default: 50 (older job entities are deleted)
+	JobHistory int
+	
+	// Export Configuration
+	// ====================
+	
+	// ExportPath is where asynchronous query exports are written.
+	// Environment: ENTITYDB_EXPORT_PATH
+	// Default: "./exports" (relative to DataPath; cleared at startup)
+	ExportPath string
+	
+	// ExportTTL defines how long a finished export can be downloaded before it is removed.
+	// Environment: ENTITYDB_EXPORT_TTL (seconds)
+	// Default: 86400 seconds (24 hours)
+	ExportTTL time.Duration
+	
+	// ExportMaxConcurrent limits how many exports run at once.
+	// Environment: ENTITYDB_EXPORT_MAX_CONCURRENT
+	// Default: 2 (0 = unlimited)
+	// Purpose: Keep large exports from starving interactive queries
+	ExportMaxConcurrent int
+	
+	// Import Configuration
+	// ====================
+	
+	// ImportMaxBytes limits the size of a file uploaded to /api/v1/admin/import.
+	// Environment: ENTITYDB_IMPORT_MAX_BYTES
+	// Default: 1073741824 (1GB)
+	// Purpose: Uploads are staged on disk under DataPath until their job ends
+	ImportMaxBytes int64
+	
+	// Sandbox Configuration
+	// =====================
+	
+	// SandboxTemplatePath holds the template bundles sandbox datasets are
+	// seeded from, one <name>.jsonl file per template in the export format.
+	// Environment: ENTITYDB_SANDBOX_TEMPLATE_PATH
+	// Default: "./sandbox-templates" (relative to DataPath)
+	SandboxTemplatePath string
+	
+	// SandboxCheckInterval defines how often sandbox reset schedules are checked.
+	// Environment: ENTITYDB_SANDBOX_CHECK_INTERVAL (seconds)
+	// Default: 60 seconds (0 disables scheduled resets)
+	SandboxCheckInterval time.Duration
+	
+	// ChunkReadAhead defines how many chunks are fetched ahead of a streaming client.
+	// Environment: ENTITYDB_CHUNK_READ_AHEAD
+	// Default: 4 chunks (0 fetches chunks one at a time)
+	// Purpose: Overlap chunk reads with sending so large downloads are not latency-bound
+	// Memory: Up to this many chunks (4MB each by default) are buffered per download
+	ChunkReadAhead int
+	
+	// Retention Service Configuration
+	// ===============================
+	
+	// RetentionEnabled controls whether retention policies are applied in the background.
+	// Environment: ENTITYDB_RETENTION_ENABLED
+	// Default: true
+	// Purpose: Prune old temporal tag values according to type:retention_policy entities
+	RetentionEnabled bool
+	
+	// RetentionInterval defines how often retention policies are applied.
+	// Environment: ENTITYDB_RETENTION_INTERVAL (seconds)
+	// Default: 3600 seconds (1 hour)
+	// Purpose: Controls how quickly history beyond a policy's limits is pruned
+	RetentionInterval time.Duration
+	
+	// RetentionBatchSize limits entities processed between cancellation checks.
+	// Environment: ENTITYDB_RETENTION_BATCH_SIZE
+	// Default: 100
+	// Purpose: Lets long cycles stop promptly on shutdown or timeout
+	RetentionBatchSize int
+	
+	// RetentionMaxRuntime limits single retention cycle duration.
+	// Environment: ENTITYDB_RETENTION_MAX_RUNTIME (seconds)
+	// Default: 1800 seconds (30 minutes)
+	// Purpose: Prevents retention cycles from running too long
+	RetentionMaxRuntime time.Duration
+	
+	// RetentionDryRun counts what scheduled cycles would prune without changing entities.
+	// Environment: ENTITYDB_RETENTION_DRY_RUN
+	// Default: false
+	// Purpose: Test retention policies without actual modifications
+	RetentionDryRun bool
+	
+	// Webhook Configuration
+	// =====================
+	
+	// WebhooksEnabled controls whether type:webhook entities receive change events.
+	// Environment: ENTITYDB_WEBHOOKS_ENABLED
+	// Default: false
+	// Purpose: POST signed entity create, update and delete events to integrators
+	WebhooksEnabled bool
+	
+	// WebhookAllowedHosts restricts the hosts webhooks may deliver to.
+	// Environment: ENTITYDB_WEBHOOK_ALLOWED_HOSTS
+	// Default: "" (any host)
+	// Format: comma-separated host names, "*.example.com" also matches subdomains
+	// Security: Anyone who can create entities can register a webhook; set this
+	//           to keep change events from reaching arbitrary or internal hosts
+	WebhookAllowedHosts string
+	
+	// WebhookTimeout limits each delivery attempt.
+	// Environment: ENTITYDB_WEBHOOK_TIMEOUT (seconds)
+	// Default: 10 seconds
+	// Purpose: Keeps slow receivers from tying up delivery workers
+	WebhookTimeout time.Duration
+	
+	// WebhookMaxRetries is how many times a failed delivery is retried.
+	// Environment: ENTITYDB_WEBHOOK_MAX_RETRIES
+	// Default: 3
+	// Purpose: Rides out brief receiver outages; retries back off from 1 second
+	WebhookMaxRetries int
+	
+	// Tag Rule Configuration
+	// ======================
+	
+	// TagRulesEnabled controls whether type:tag_rule entities tag written entities.
+	// Environment: ENTITYDB_TAG_RULES_ENABLED
+	// Default: false
+	// Purpose: Keep tags derived from content, such as lifecycle:closed for
+	//          closed tickets, in step with the content automatically
+	TagRulesEnabled bool
+	
+	// Scheduler Configuration
+	// =======================
+	
+	// SchedulerEnabled controls whether type:schedule entities are run.
+	// Environment: ENTITYDB_SCHEDULER_ENABLED
+	// Default: false
+	// Purpose: Run retention, view tagging and exports on cron schedules
+	SchedulerEnabled bool
+	
+	// SchedulerHistoryLimit is how many run records are kept per schedule.
+	// Environment: ENTITYDB_SCHEDULER_HISTORY_LIMIT
+	// Default: 50
+	// Purpose: Bounds the schedule_run entities written by frequent schedules
+	SchedulerHistoryLimit int
+	
+	// SchedulerAlertURL receives a POST whenever a scheduled run fails.
+	// Environment: ENTITYDB_SCHEDULER_ALERT_URL
+	// Default: "" (only schedules' own schedule:alert URLs are notified)
+	// Security: Subject to WebhookAllowedHosts like schedule:alert URLs
+	SchedulerAlertURL string
+	
+	// User Reconciliation Configuration
+	// =================================
+	
+	// UserReconcileOnStartup merges user entities sharing a username at startup.
+	// Environment: ENTITYDB_USER_RECONCILE_ON_STARTUP
+	// Default: true
+	// Purpose: Repair duplicate users left by legacy migrations, which make logins resolve arbitrarily
+	UserReconcileOnStartup bool
+	
+	// Standby Verification Configuration
+	// ==================================
+	
+	// StandbyVerifyEnabled restores and checks the latest backup in the background.
+	// Environment: ENTITYDB_STANDBY_VERIFY_ENABLED
+	// Default: false
+	// Purpose: Run a warm standby that proves backups are restorable
+	StandbyVerifyEnabled bool
+	
+	// StandbyPrimaryDatabase is the primary database file the standby verifies.
+	// Environment: ENTITYDB_STANDBY_PRIMARY_DATABASE
+	// Default: "" (this instance's DatabaseFilename)
+	// Purpose: Point a second instance at the primary's database on shared storage
+	StandbyPrimaryDatabase string
+	
+	// StandbyBackupPath is the directory holding the primary's routine backups.
+	// Environment: ENTITYDB_STANDBY_BACKUP_PATH
+	// Default: "" (directory of the primary database)
+	StandbyBackupPath string
+	
+	// StandbyVerifyInterval is the time between standby verifications.
+	// Environment: ENTITYDB_STANDBY_VERIFY_INTERVAL (seconds)
+	// Default: 900 seconds (15 minutes)
+	StandbyVerifyInterval time.Duration
+	
+	// StandbyMaxBackupAge is the backup age after which the standby reports stale.
+	// Environment: ENTITYDB_STANDBY_MAX_BACKUP_AGE (seconds)
+	// Default: 7200 seconds (2 hours)
+	// Purpose: Alert when routine backups stop being taken
+	StandbyMaxBackupAge time.Duration
+	
+	// Snapshot Configuration
+	// ======================
+	
+	// SnapshotEnabled takes consistent snapshots of the database on an interval.
+	// Environment: ENTITYDB_SNAPSHOT_ENABLED
+	// Default: false
+	// Purpose: Built-in backups for small deployments without external tooling
+	SnapshotEnabled bool
+	
+	// SnapshotPath is the directory snapshots are written to.
+	// Environment: ENTITYDB_SNAPSHOT_PATH
+	// Default: "./snapshots"
+	// Relative to DataPath or absolute path
+	SnapshotPath string
+	
+	// SnapshotInterval is the time between scheduled snapshots.
+	// Environment: ENTITYDB_SNAPSHOT_INTERVAL (seconds)
+	// Default: 3600 seconds (1 hour)
+	SnapshotInterval time.Duration
+	
+	// SnapshotKeep is the number of snapshots kept; older ones are deleted.
+	// Environment: ENTITYDB_SNAPSHOT_KEEP
+	// Default: 24
+	// 0 keeps any number, subject to SnapshotMaxAge
+	SnapshotKeep int
+	
+	// SnapshotMaxAge is the age after which snapshots are deleted. The newest
+	// snapshot is always kept.
+	// Environment: ENTITYDB_SNAPSHOT_MAX_AGE (seconds)
+	// Default: 0 (no age limit)
+	SnapshotMaxAge time.Duration
+	
+	// gRPC API Configuration
+	// ======================
+	
+	// GRPCEnabled serves the gRPC API alongside the REST API.
+	// Environment: ENTITYDB_GRPC_ENABLED
+	// Default: false
+	// Purpose: Binary, multiplexed access for programmatic clients
+	GRPCEnabled bool
+	
+	// GRPCPort is the gRPC server listening port. TLS follows UseSSL.
+	// Environment: ENTITYDB_GRPC_PORT
+	// Default: 9085
+	// Valid range: 1-65535
+	GRPCPort int
+	
+	// SQL Gateway Configuration
+	// =========================
+	
+	// SQLGatewayEnabled serves read-only SQL over the PostgreSQL wire protocol.
+	// Environment: ENTITYDB_SQL_GATEWAY_ENABLED
+	// Default: false
+	// Purpose: Let BI tools such as Grafana and Metabase chart entities directly
+	SQLGatewayEnabled bool
+	
+	// SQLGatewayPort is the SQL gateway listening port. TLS follows UseSSL.
+	// Environment: ENTITYDB_SQL_GATEWAY_PORT
+	// Default: 5485
+	// Valid range: 1-65535
+	SQLGatewayPort int
+	
+	// SQLGatewayMaxRows limits the table rows a SQL query may read before its
+	// WHERE clause filters them; larger scans fail.
+	// Environment: ENTITYDB_SQL_GATEWAY_MAX_ROWS
+	// Default: 100000
+	// Purpose: Keep dashboard queries from scanning the whole database; 0 disables
+	SQLGatewayMaxRows int
+	
+	// Access Log Configuration
+	// ========================
+	
+	// AccessLogSampleRate defines the fraction of read requests recorded in the access log.
+	// Environment: ENTITYDB_ACCESS_LOG_SAMPLE_RATE
+	// Default: 0 (disabled)
+	// Purpose: Measure which entities, tags and users drive reads at bounded cost
+	AccessLogSampleRate float64
+	
+	// AccessLogWindow defines how long each usage window covers before it is persisted.
+	// Environment: ENTITYDB_ACCESS_LOG_WINDOW (seconds)
+	// Default: 3600 seconds (1 hour)
+	// Purpose: Controls the granularity of usage history
+	AccessLogWindow time.Duration
+	
+	// AccessLogRetainedWindows defines how many persisted usage windows are kept.
+	// Environment: ENTITYDB_ACCESS_LOG_RETAINED_WINDOWS
+	// Default: 24
+	// Purpose: Bounds usage history; older windows are deleted as new ones are written
+	AccessLogRetainedWindows int
+	
+	// Slow Query Log Configuration
+	// ============================
+	
+	// SlowQueryThreshold is the duration above which an API request is
+	// recorded in the slow query log with its storage I/O breakdown.
+	// Environment: ENTITYDB_SLOW_QUERY_THRESHOLD_MS (milliseconds)
+	// Default: 1000 milliseconds; 0 disables the log
+	SlowQueryThreshold time.Duration
+	
+	// SlowQueryLogSize is how many of the most recent slow requests are kept.
+	// Environment: ENTITYDB_SLOW_QUERY_LOG_SIZE
+	// Default: 500
+	SlowQueryLogSize int
+	
+	// Audit Log Configuration
+	// =======================
+	
+	// AuditEnabled records every mutating API operation as an immutable audit event.
+	// Environment: ENTITYDB_AUDIT_ENABLED
+	// Default: true
+	// Purpose: Answer who changed what and when
+	AuditEnabled bool
+	
+	// AuditLogFile is a file audit events are appended to as JSON lines.
+	// Environment: ENTITYDB_AUDIT_LOG_FILE
+	// Default: "" (not exported to a file)
+	AuditLogFile string
+	
+	// AuditSyslog is the syslog destination audit events are sent to.
+	// Environment: ENTITYDB_AUDIT_SYSLOG
+	// Default: "" (not exported to syslog)
+	// Values: "local" for the local syslog daemon, or udp://host:port, tcp://host:port
+	AuditSyslog string
 }
 
 // Load creates a new Config instance with values loaded from environment variables.
@@ -584,12 +1571,24 @@ func Load() *Config {
 		// Security
 		TokenSecret:      getEnv("ENTITYDB_TOKEN_SECRET", "entitydb-secret-key"),
 		SessionTTLHours:  getEnvInt("ENTITYDB_SESSION_TTL_HOURS", 2),
+		AuthzHookURL:      getEnv("ENTITYDB_AUTHZ_HOOK_URL", ""),
+		AuthzHookTimeout:  getEnvDurationMs("ENTITYDB_AUTHZ_HOOK_TIMEOUT_MS", 500),
+		AuthzHookCacheTTL: getEnvDuration("ENTITYDB_AUTHZ_HOOK_CACHE_TTL", 30),
 		
 		// Timeouts
 		HTTPReadTimeout:  getEnvDuration("ENTITYDB_HTTP_READ_TIMEOUT", 15),
 		HTTPWriteTimeout: getEnvDuration("ENTITYDB_HTTP_WRITE_TIMEOUT", 15),
 		HTTPIdleTimeout:  getEnvDuration("ENTITYDB_HTTP_IDLE_TIMEOUT", 60),
 		ShutdownTimeout:  getEnvDuration("ENTITYDB_SHUTDOWN_TIMEOUT", 30),
+		ReadOnly:         getEnvBool("ENTITYDB_READ_ONLY", false),
+		HTTP2Enabled:     getEnvBool("ENTITYDB_HTTP2_ENABLED", false),
+		ResponseCompression:        getEnvBool("ENTITYDB_RESPONSE_COMPRESSION", true),
+		ResponseCompressionMinSize: getEnvInt("ENTITYDB_RESPONSE_COMPRESSION_MIN_SIZE", 1024),
+		
+		// Health probes
+		HealthMinFreeDiskMB:     getEnvInt("ENTITYDB_HEALTH_MIN_FREE_DISK_MB", 100),
+		HealthMaxMemoryPressure: getEnvFloat("ENTITYDB_HEALTH_MAX_MEMORY_PRESSURE", 0.95),
+		HealthMaxReplicationLag: getEnvDuration("ENTITYDB_HEALTH_MAX_REPLICATION_LAG", 0),
 		
 		// Metrics
 		MetricsInterval:  getEnvDuration("ENTITYDB_METRICS_INTERVAL", 30),
@@ -611,12 +1610,24 @@ func Load() *Config {
 		MetricsHistogramBuckets: getEnvFloatSlice("ENTITYDB_METRICS_HISTOGRAM_BUCKETS", []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}),
 		MetricsEnableRequestTracking: getEnvBool("ENTITYDB_METRICS_ENABLE_REQUEST_TRACKING", false),
 		MetricsEnableStorageTracking: getEnvBool("ENTITYDB_METRICS_ENABLE_STORAGE_TRACKING", false),
+		MetricsRollupEnabled:   getEnvBool("ENTITYDB_METRICS_ROLLUP_ENABLED", true),
+		MetricsRollupInterval:  getEnvDuration("ENTITYDB_METRICS_ROLLUP_INTERVAL", 60),
+		MetricsRollupKeep1Min:  getEnvInt("ENTITYDB_METRICS_ROLLUP_KEEP_1MIN", 1440),
+		MetricsRollupKeep1Hour: getEnvInt("ENTITYDB_METRICS_ROLLUP_KEEP_1HOUR", 720),
+		MetricsRollupKeep1Day:  getEnvInt("ENTITYDB_METRICS_ROLLUP_KEEP_1DAY", 365),
 		
 		// API
 		SwaggerHost:      getEnv("ENTITYDB_SWAGGER_HOST", "localhost:8085"),
 		
 		// Logging
 		LogLevel:         getEnv("ENTITYDB_LOG_LEVEL", "info"),
+		LogFormat:        getEnv("ENTITYDB_LOG_FORMAT", "text"),
+		
+		// Tracing
+		TracingEnabled:     getEnvBool("ENTITYDB_TRACING_ENABLED", false),
+		OTLPEndpoint:       getEnv("ENTITYDB_OTLP_ENDPOINT", "http://localhost:4318"),
+		TracingSampleRate:  getEnvFloat("ENTITYDB_TRACING_SAMPLE_RATE", 1.0),
+		TracingServiceName: getEnv("ENTITYDB_TRACING_SERVICE_NAME", "entitydb"),
 		
 		// Performance
 		HighPerformance:  getEnvBool("ENTITYDB_HIGH_PERFORMANCE", false),
@@ -624,6 +1635,15 @@ func Load() *Config {
 		StringCacheMemoryLimit: getEnvInt64("ENTITYDB_STRING_CACHE_MEMORY_LIMIT", 100*1024*1024),
 		EntityCacheSize: getEnvInt("ENTITYDB_ENTITY_CACHE_SIZE", 10000),
 		EntityCacheMemoryLimit: getEnvInt64("ENTITYDB_ENTITY_CACHE_MEMORY_LIMIT", 1024*1024*1024),
+		CachePinTags: getEnv("ENTITYDB_CACHE_PIN_TAGS", "cache:pinned"),
+		IDBloomFilter: getEnvBool("ENTITYDB_ID_BLOOM_FILTER", true),
+		IDBloomFalsePositiveRate: getEnvFloat("ENTITYDB_ID_BLOOM_FALSE_POSITIVE_RATE", 0.01),
+		
+		// Write Batching and Durability
+		BatchWrites:        getEnvBool("ENTITYDB_USE_BATCH_WRITES", true),
+		BatchWriteSize:     getEnvInt("ENTITYDB_BATCH_WRITE_SIZE", 10),
+		BatchFlushInterval: getEnvDurationMs("ENTITYDB_BATCH_FLUSH_INTERVAL_MS", 100),
+		DurabilityMode:     getEnv("ENTITYDB_DURABILITY_MODE", "relaxed"),
 		
 		// Rate Limiting
 		EnableRateLimit:  getEnvBool("ENTITYDB_ENABLE_RATE_LIMIT", false),
@@ -645,6 +1665,43 @@ func Load() *Config {
 		
 		// Advanced Security Configuration
 		BcryptCost:      getEnvInt("ENTITYDB_BCRYPT_COST", 10),
+		MFAKeyFile:      getEnv("ENTITYDB_MFA_KEY_FILE", "./mfa.key"),
+		MFAIssuer:       getEnv("ENTITYDB_MFA_ISSUER", "EntityDB"),
+		
+		// OIDC Single Sign-On Configuration
+		OIDCEnabled:       getEnvBool("ENTITYDB_OIDC_ENABLED", false),
+		OIDCIssuerURL:     getEnv("ENTITYDB_OIDC_ISSUER_URL", ""),
+		OIDCClientID:      getEnv("ENTITYDB_OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:  getEnv("ENTITYDB_OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:   getEnv("ENTITYDB_OIDC_REDIRECT_URL", ""),
+		OIDCScopes:        getEnv("ENTITYDB_OIDC_SCOPES", "openid profile email"),
+		OIDCUsernameClaim: getEnv("ENTITYDB_OIDC_USERNAME_CLAIM", "preferred_username"),
+		OIDCGroupsClaim:   getEnv("ENTITYDB_OIDC_GROUPS_CLAIM", "groups"),
+		OIDCGroupRoles:    getEnv("ENTITYDB_OIDC_GROUP_ROLES", ""),
+		OIDCDefaultRole:   getEnv("ENTITYDB_OIDC_DEFAULT_ROLE", "user"),
+		OIDCPasswordLogin: getEnvBool("ENTITYDB_OIDC_PASSWORD_LOGIN", true),
+		
+		// LDAP Directory Synchronization Configuration
+		LDAPSyncEnabled:          getEnvBool("ENTITYDB_LDAP_SYNC_ENABLED", false),
+		LDAPURL:                  getEnv("ENTITYDB_LDAP_URL", "ldap://localhost:389"),
+		LDAPStartTLS:             getEnvBool("ENTITYDB_LDAP_START_TLS", false),
+		LDAPCACertFile:           getEnv("ENTITYDB_LDAP_CA_CERT_FILE", ""),
+		LDAPBindDN:               getEnv("ENTITYDB_LDAP_BIND_DN", ""),
+		LDAPBindPassword:         getEnv("ENTITYDB_LDAP_BIND_PASSWORD", ""),
+		LDAPUserBaseDN:           getEnv("ENTITYDB_LDAP_USER_BASE_DN", ""),
+		LDAPUserFilter:           getEnv("ENTITYDB_LDAP_USER_FILTER", "(objectClass=person)"),
+		LDAPUsernameAttribute:    getEnv("ENTITYDB_LDAP_USERNAME_ATTRIBUTE", "uid"),
+		LDAPEmailAttribute:       getEnv("ENTITYDB_LDAP_EMAIL_ATTRIBUTE", "mail"),
+		LDAPIDAttribute:          getEnv("ENTITYDB_LDAP_ID_ATTRIBUTE", "entryUUID"),
+		LDAPGroupAttribute:       getEnv("ENTITYDB_LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		LDAPGroupBaseDN:          getEnv("ENTITYDB_LDAP_GROUP_BASE_DN", ""),
+		LDAPGroupFilter:          getEnv("ENTITYDB_LDAP_GROUP_FILTER", "(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=group)(objectClass=posixGroup))"),
+		LDAPGroupMemberAttribute: getEnv("ENTITYDB_LDAP_GROUP_MEMBER_ATTRIBUTE", "member"),
+		LDAPGroupRoles:           getEnv("ENTITYDB_LDAP_GROUP_ROLES", ""),
+		LDAPDefaultRole:          getEnv("ENTITYDB_LDAP_DEFAULT_ROLE", ""),
+		LDAPSyncInterval:         getEnvDuration("ENTITYDB_LDAP_SYNC_INTERVAL", 900), // 15 minutes
+		LDAPDeprovision:          getEnvBool("ENTITYDB_LDAP_DEPROVISION", true),
+		LDAPLinkLocalUsers:       getEnvBool("ENTITYDB_LDAP_LINK_LOCAL_USERS", false),
 		
 		// File and Path Configuration
 		WALSuffix:        getEnv("ENTITYDB_WAL_SUFFIX", ".wal"),
@@ -655,6 +1712,9 @@ func Load() *Config {
 		BackupRetentionDays:  getEnvInt("ENTITYDB_BACKUP_RETENTION_DAYS", 7),
 		BackupRetentionWeeks: getEnvInt("ENTITYDB_BACKUP_RETENTION_WEEKS", 4),
 		BackupMaxSizeMB:      getEnvInt64("ENTITYDB_BACKUP_MAX_SIZE_MB", 1000),
+		BackupManifestEnabled: getEnvBool("ENTITYDB_BACKUP_MANIFEST_ENABLED", true),
+		BackupSigningKey:      getEnv("ENTITYDB_BACKUP_SIGNING_KEY", ""),
+		BackupVerifyKey:       getEnv("ENTITYDB_BACKUP_VERIFY_KEY", ""),
 		TempPath:         getEnv("ENTITYDB_TEMP_PATH", "./tmp"),
 		PIDFile:          getEnv("ENTITYDB_PID_FILE", "./var/entitydb.pid"),
 		LogFile:          getEnv("ENTITYDB_LOG_FILE", "./var/entitydb.log"),
@@ -674,6 +1734,144 @@ func Load() *Config {
 		DeletionCollectorMaxRuntime:  getEnvDuration("ENTITYDB_DELETION_COLLECTOR_MAX_RUNTIME", 1800),
 		DeletionCollectorDryRun:      getEnvBool("ENTITYDB_DELETION_COLLECTOR_DRY_RUN", false),
 		DeletionCollectorConcurrency: getEnvInt("ENTITYDB_DELETION_COLLECTOR_CONCURRENCY", 4),
+		
+		// Index Rebuild
+		IndexRebuildWorkers:       getEnvInt("ENTITYDB_INDEX_REBUILD_WORKERS", runtime.NumCPU()),
+		IndexRebuildChunkSize:     getEnvInt("ENTITYDB_INDEX_REBUILD_CHUNK_SIZE", 50),
+		IndexRebuildIORateLimitMB: getEnvInt("ENTITYDB_INDEX_REBUILD_IO_RATE_LIMIT_MB", 0),
+		ContentIndexPaths:         getEnv("ENTITYDB_CONTENT_INDEX_PATHS", ""),
+		TagIndexMemoryBudget:      getEnvInt64("ENTITYDB_TAG_INDEX_MEMORY_BUDGET", 0),
+		TagIndexSpillDir:          getEnv("ENTITYDB_TAG_INDEX_SPILL_DIR", ""),
+		
+		// Dataset Quotas
+		DatasetQuotaMaxEntities: getEnvInt64("ENTITYDB_DATASET_QUOTA_MAX_ENTITIES", 0),
+		DatasetQuotaMaxBytes:    getEnvInt64("ENTITYDB_DATASET_QUOTA_MAX_BYTES", 0),
+		DatasetQuotaMode:        getEnv("ENTITYDB_DATASET_QUOTA_MODE", "warn"),
+		
+		// Content Versioning
+		ContentVersioning:   getEnvBool("ENTITYDB_CONTENT_VERSIONING", false),
+		ContentVersionLimit: getEnvInt("ENTITYDB_CONTENT_VERSION_LIMIT", 0),
+		
+		// Entity Locks
+		EntityLockEnforce:    getEnvBool("ENTITYDB_ENTITY_LOCK_ENFORCE", false),
+		EntityLockDefaultTTL: getEnvDuration("ENTITYDB_ENTITY_LOCK_DEFAULT_TTL", 300),
+		EntityLockMaxTTL:     getEnvDuration("ENTITYDB_ENTITY_LOCK_MAX_TTL", 3600),
+		
+		// Query Admission
+		QueryAdmissionEnabled: getEnvBool("ENTITYDB_QUERY_ADMISSION_ENABLED", true),
+		QueryMaxCost:          getEnvInt("ENTITYDB_QUERY_MAX_COST", 100000),
+		QueryUserBudget:       getEnvInt("ENTITYDB_QUERY_USER_BUDGET", 0),
+		QueryDatasetBudget:    getEnvInt("ENTITYDB_QUERY_DATASET_BUDGET", 0),
+		QueryQueueTimeout:     getEnvDuration("ENTITYDB_QUERY_QUEUE_TIMEOUT", 5),
+		QueryTimeout:          getEnvDuration("ENTITYDB_QUERY_TIMEOUT", 0),
+		
+		// Uploads
+		UploadSessionTTL: getEnvDuration("ENTITYDB_UPLOAD_SESSION_TTL", 86400),
+		ChunkReadAhead:   getEnvInt("ENTITYDB_CHUNK_READ_AHEAD", 4),
+		
+		// Encryption
+		EncryptionEnabled:    getEnvBool("ENTITYDB_ENCRYPTION_ENABLED", false),
+		EncryptionKeyFile:    getEnv("ENTITYDB_ENCRYPTION_KEY_FILE", ""),
+		EncryptionKeyCommand: getEnv("ENTITYDB_ENCRYPTION_KEY_COMMAND", ""),
+		EncryptionActiveKey:  getEnv("ENTITYDB_ENCRYPTION_ACTIVE_KEY", ""),
+		
+		// Signing
+		SigningEnabled:   getEnvBool("ENTITYDB_SIGNING_ENABLED", false),
+		SigningKeyFile:   getEnv("ENTITYDB_SIGNING_KEY_FILE", ""),
+		SigningActiveKey: getEnv("ENTITYDB_SIGNING_ACTIVE_KEY", ""),
+		
+		// Compression
+		CompressionCodec:        getEnv("ENTITYDB_COMPRESSION_CODEC", "gzip"),
+		CompressionContentTypes: getEnv("ENTITYDB_COMPRESSION_CONTENT_TYPES", ""),
+		
+		// WAL Archive
+		WALArchiveDir:     getEnv("ENTITYDB_WAL_ARCHIVE_DIR", ""),
+		WALArchiveCommand: getEnv("ENTITYDB_WAL_ARCHIVE_COMMAND", ""),
+		
+		// Change Data Capture
+		CDCSink:       getEnv("ENTITYDB_CDC_SINK", ""),
+		CDCBrokers:    getEnv("ENTITYDB_CDC_BROKERS", ""),
+		CDCTopic:      getEnv("ENTITYDB_CDC_TOPIC", "entitydb.changes"),
+		CDCOutboxPath: getEnv("ENTITYDB_CDC_OUTBOX_PATH", "./cdc"),
+		CDCBatchSize:  getEnvInt("ENTITYDB_CDC_BATCH_SIZE", 100),
+		
+		// Jobs
+		JobWorkers:   getEnvInt("ENTITYDB_JOB_WORKERS", 2),
+		JobQueueSize: getEnvInt("ENTITYDB_JOB_QUEUE_SIZE", 100),
+		JobHistory:   getEnvInt("ENTITYDB_JOB_HISTORY", 50),
+		
+		// Exports
+		ExportPath:          getEnv("ENTITYDB_EXPORT_PATH", "./exports"),
+		ExportTTL:           getEnvDuration("ENTITYDB_EXPORT_TTL", 86400),
+		ExportMaxConcurrent: getEnvInt("ENTITYDB_EXPORT_MAX_CONCURRENT", 2),
+		
+		// Imports
+		ImportMaxBytes: getEnvInt64("ENTITYDB_IMPORT_MAX_BYTES", 1024*1024*1024),
+		
+		// Sandboxes
+		SandboxTemplatePath:  getEnv("ENTITYDB_SANDBOX_TEMPLATE_PATH", "./sandbox-templates"),
+		SandboxCheckInterval: getEnvDuration("ENTITYDB_SANDBOX_CHECK_INTERVAL", 60),
+		
+		// Retention Service
+		RetentionEnabled:    getEnvBool("ENTITYDB_RETENTION_ENABLED", true),
+		RetentionInterval:   getEnvDuration("ENTITYDB_RETENTION_INTERVAL", 3600),
+		RetentionBatchSize:  getEnvInt("ENTITYDB_RETENTION_BATCH_SIZE", 100),
+		RetentionMaxRuntime: getEnvDuration("ENTITYDB_RETENTION_MAX_RUNTIME", 1800),
+		RetentionDryRun:     getEnvBool("ENTITYDB_RETENTION_DRY_RUN", false),
+		
+		// Webhooks
+		WebhooksEnabled:     getEnvBool("ENTITYDB_WEBHOOKS_ENABLED", false),
+		WebhookAllowedHosts: getEnv("ENTITYDB_WEBHOOK_ALLOWED_HOSTS", ""),
+		WebhookTimeout:      getEnvDuration("ENTITYDB_WEBHOOK_TIMEOUT", 10),
+		WebhookMaxRetries:   getEnvInt("ENTITYDB_WEBHOOK_MAX_RETRIES", 3),
+		
+		// Tag rules
+		TagRulesEnabled: getEnvBool("ENTITYDB_TAG_RULES_ENABLED", false),
+		
+		// Scheduler
+		SchedulerEnabled:      getEnvBool("ENTITYDB_SCHEDULER_ENABLED", false),
+		SchedulerHistoryLimit: getEnvInt("ENTITYDB_SCHEDULER_HISTORY_LIMIT", 50),
+		SchedulerAlertURL:     getEnv("ENTITYDB_SCHEDULER_ALERT_URL", ""),
+		
+		// User Reconciliation
+		UserReconcileOnStartup: getEnvBool("ENTITYDB_USER_RECONCILE_ON_STARTUP", true),
+		
+		// Standby Verification
+		StandbyVerifyEnabled:   getEnvBool("ENTITYDB_STANDBY_VERIFY_ENABLED", false),
+		StandbyPrimaryDatabase: getEnv("ENTITYDB_STANDBY_PRIMARY_DATABASE", ""),
+		StandbyBackupPath:      getEnv("ENTITYDB_STANDBY_BACKUP_PATH", ""),
+		StandbyVerifyInterval:  getEnvDuration("ENTITYDB_STANDBY_VERIFY_INTERVAL", 900),
+		StandbyMaxBackupAge:    getEnvDuration("ENTITYDB_STANDBY_MAX_BACKUP_AGE", 7200),
+		
+		// Snapshots
+		SnapshotEnabled:  getEnvBool("ENTITYDB_SNAPSHOT_ENABLED", false),
+		SnapshotPath:     getEnv("ENTITYDB_SNAPSHOT_PATH", "./snapshots"),
+		SnapshotInterval: getEnvDuration("ENTITYDB_SNAPSHOT_INTERVAL", 3600),
+		SnapshotKeep:     getEnvInt("ENTITYDB_SNAPSHOT_KEEP", 24),
+		SnapshotMaxAge:   getEnvDuration("ENTITYDB_SNAPSHOT_MAX_AGE", 0),
+		
+		// gRPC API
+		GRPCEnabled: getEnvBool("ENTITYDB_GRPC_ENABLED", false),
+		GRPCPort:    getEnvInt("ENTITYDB_GRPC_PORT", 9085),
+		
+		// SQL Gateway
+		SQLGatewayEnabled: getEnvBool("ENTITYDB_SQL_GATEWAY_ENABLED", false),
+		SQLGatewayPort:    getEnvInt("ENTITYDB_SQL_GATEWAY_PORT", 5485),
+		SQLGatewayMaxRows: getEnvInt("ENTITYDB_SQL_GATEWAY_MAX_ROWS", 100000),
+		
+		// Access Log
+		AccessLogSampleRate:      getEnvFloat("ENTITYDB_ACCESS_LOG_SAMPLE_RATE", 0),
+		AccessLogWindow:          getEnvDuration("ENTITYDB_ACCESS_LOG_WINDOW", 3600),
+		AccessLogRetainedWindows: getEnvInt("ENTITYDB_ACCESS_LOG_RETAINED_WINDOWS", 24),
+		
+		// Slow Query Log
+		SlowQueryThreshold: getEnvDurationMs("ENTITYDB_SLOW_QUERY_THRESHOLD_MS", 1000),
+		SlowQueryLogSize:   getEnvInt("ENTITYDB_SLOW_QUERY_LOG_SIZE", 500),
+		
+		// Audit Log
+		AuditEnabled: getEnvBool("ENTITYDB_AUDIT_ENABLED", true),
+		AuditLogFile: getEnv("ENTITYDB_AUDIT_LOG_FILE", ""),
+		AuditSyslog:  getEnv("ENTITYDB_AUDIT_SYSLOG", ""),
 	}
 }
 
@@ -715,6 +1913,59 @@ func (c *Config) TempFullPath() string {
 	return c.DataPath + "/" + strings.TrimPrefix(c.TempPath, "./")
 }
 
+// MFAKeyFullPath returns the full path to the MFA key file.
+//
+// If MFAKeyFile is relative, it's resolved relative to DataPath.
+// If MFAKeyFile is absolute, it's used as-is.
+func (c *Config) MFAKeyFullPath() string {
+	if strings.HasPrefix(c.MFAKeyFile, "/") {
+		return c.MFAKeyFile
+	}
+	return c.DataPath + "/" + strings.TrimPrefix(c.MFAKeyFile, "./")
+}
+
+// ExportFullPath returns the full path to the export directory.
+//
+// If ExportPath is relative, it's resolved relative to DataPath.
+// If ExportPath is absolute, it's used as-is.
+func (c *Config) ExportFullPath() string {
+	if strings.HasPrefix(c.ExportPath, "/") {
+		return c.ExportPath
+	}
+	return c.DataPath + "/" + strings.TrimPrefix(c.ExportPath, "./")
+}
+
+// SandboxTemplateFullPath returns the full path to the sandbox template directory.
+//
+// If SandboxTemplatePath is relative, it's resolved relative to DataPath.
+// If SandboxTemplatePath is absolute, it's used as-is.
+func (c *Config) SandboxTemplateFullPath() string {
+	if strings.HasPrefix(c.SandboxTemplatePath, "/") {
+		return c.SandboxTemplatePath
+	}
+	return c.DataPath + "/" + strings.TrimPrefix(c.SandboxTemplatePath, "./")
+}
+
+// CDCOutboxFullPath returns the full path of the change data capture outbox.
+//
+// If CDCOutboxPath is relative, it's resolved relative to DataPath.
+func (c *Config) CDCOutboxFullPath() string {
+	if strings.HasPrefix(c.CDCOutboxPath, "/") {
+		return c.CDCOutboxPath
+	}
+	return c.DataPath + "/" + strings.TrimPrefix(c.CDCOutboxPath, "./")
+}
+
+// SnapshotFullPath returns the full path to the snapshot directory.
+//
+// If SnapshotPath is relative, it's resolved relative to DataPath.
+func (c *Config) SnapshotFullPath() string {
+	if strings.HasPrefix(c.SnapshotPath, "/") {
+		return c.SnapshotPath
+	}
+	return c.DataPath + "/" + strings.TrimPrefix(c.SnapshotPath, "./")
+}
+
 // PIDFullPath returns the full path to the PID file.
 //
 // If PIDFile is relative, it's resolved relative to DataPath.
@@ -880,6 +2131,27 @@ func getEnvDurationMs(key string, defaultMs int) time.Duration {
 	return time.Duration(defaultMs) * time.Millisecond
 }
 
+// getEnvFloat retrieves a floating-point environment variable with a default fallback.
+//
+// Parameters:
+//   key - Environment variable name
+//   defaultValue - Default value if variable is unset/invalid
+//
+// Returns:
+//   float64 value from environment variable or defaultValue
+//
+// Examples:
+//   ENTITYDB_ACCESS_LOG_SAMPLE_RATE=0.01 -> 0.01
+//   ENTITYDB_ACCESS_LOG_SAMPLE_RATE=abc  -> defaultValue
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
 // getEnvFloatSlice retrieves a comma-separated float slice with a default fallback.
 //
 // The function parses a comma-separated list of floating-point numbers from
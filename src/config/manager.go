@@ -165,14 +165,42 @@ func (cm *ConfigManager) RegisterFlags() {
 		"Secret key for JWT tokens")
 	flag.IntVar(&cm.config.SessionTTLHours, "entitydb-session-ttl-hours", cm.config.SessionTTLHours,
 		"Session timeout in hours")
+	flag.StringVar(&cm.config.AuthzHookURL, "entitydb-authz-hook-url", cm.config.AuthzHookURL,
+		"External policy engine endpoint for authorization decisions")
 
 	// Logging - all long flags
 	flag.StringVar(&cm.config.LogLevel, "entitydb-log-level", cm.config.LogLevel,
 		"Log level (trace, debug, info, warn, error)")
+	flag.StringVar(&cm.config.LogFormat, "entitydb-log-format", cm.config.LogFormat,
+		"Log output format (text, json)")
+	
+	// Tracing - all long flags
+	flag.BoolVar(&cm.config.TracingEnabled, "entitydb-tracing", cm.config.TracingEnabled,
+		"Export OpenTelemetry spans over OTLP")
+	flag.StringVar(&cm.config.OTLPEndpoint, "entitydb-otlp-endpoint", cm.config.OTLPEndpoint,
+		"OTLP/HTTP collector URL spans are exported to")
+	flag.Float64Var(&cm.config.TracingSampleRate, "entitydb-tracing-sample-rate", cm.config.TracingSampleRate,
+		"Fraction of new traces recorded (0-1)")
+	flag.StringVar(&cm.config.TracingServiceName, "entitydb-tracing-service-name", cm.config.TracingServiceName,
+		"Service name reported with spans")
 
 	// Performance - all long flags
 	flag.BoolVar(&cm.config.HighPerformance, "entitydb-high-performance", cm.config.HighPerformance,
 		"Enable high-performance mode")
+	flag.BoolVar(&cm.config.IDBloomFilter, "entitydb-id-bloom-filter", cm.config.IDBloomFilter,
+		"Answer lookups of missing entity IDs from a Bloom filter")
+	flag.Float64Var(&cm.config.IDBloomFalsePositiveRate, "entitydb-id-bloom-false-positive-rate", cm.config.IDBloomFalsePositiveRate,
+		"Target false positive rate of the entity ID Bloom filter")
+	
+	// Write Batching and Durability Configuration - all long flags
+	flag.BoolVar(&cm.config.BatchWrites, "entitydb-batch-writes", cm.config.BatchWrites,
+		"Commit creates and tag additions in batches with one WAL fsync per batch")
+	flag.IntVar(&cm.config.BatchWriteSize, "entitydb-batch-write-size", cm.config.BatchWriteSize,
+		"Queued writes that trigger a batch flush")
+	flag.DurationVar(&cm.config.BatchFlushInterval, "entitydb-batch-flush-interval", cm.config.BatchFlushInterval,
+		"Interval between batch flushes")
+	flag.StringVar(&cm.config.DurabilityMode, "entitydb-durability-mode", cm.config.DurabilityMode,
+		"Default write durability: strict or relaxed")
 
 	// Timeouts - all long flags
 	flag.DurationVar(&cm.config.HTTPReadTimeout, "entitydb-http-read-timeout", cm.config.HTTPReadTimeout,
@@ -183,6 +211,20 @@ func (cm *ConfigManager) RegisterFlags() {
 		"HTTP idle timeout")
 	flag.DurationVar(&cm.config.ShutdownTimeout, "entitydb-shutdown-timeout", cm.config.ShutdownTimeout,
 		"Server shutdown timeout")
+	flag.BoolVar(&cm.config.ReadOnly, "entitydb-read-only", cm.config.ReadOnly,
+		"Start in read-only mode, refusing mutating API requests")
+	flag.BoolVar(&cm.config.HTTP2Enabled, "entitydb-http2", cm.config.HTTP2Enabled,
+		"Serve HTTP/2 over TLS")
+	flag.BoolVar(&cm.config.ResponseCompression, "entitydb-response-compression", cm.config.ResponseCompression,
+		"Compress JSON responses with zstd or gzip")
+	flag.IntVar(&cm.config.ResponseCompressionMinSize, "entitydb-response-compression-min-size", cm.config.ResponseCompressionMinSize,
+		"Size in bytes below which JSON responses are not compressed")
+	flag.IntVar(&cm.config.HealthMinFreeDiskMB, "entitydb-health-min-free-disk-mb", cm.config.HealthMinFreeDiskMB,
+		"Free disk space in MB below which the readiness probe fails")
+	flag.Float64Var(&cm.config.HealthMaxMemoryPressure, "entitydb-health-max-memory-pressure", cm.config.HealthMaxMemoryPressure,
+		"Memory pressure (0-1) above which the readiness probe fails")
+	flag.DurationVar(&cm.config.HealthMaxReplicationLag, "entitydb-health-max-replication-lag", cm.config.HealthMaxReplicationLag,
+		"Standby backup age above which the readiness probe fails (0 = report only)")
 
 	// Metrics - all long flags
 	flag.DurationVar(&cm.config.MetricsInterval, "entitydb-metrics-interval", cm.config.MetricsInterval,
@@ -193,6 +235,16 @@ func (cm *ConfigManager) RegisterFlags() {
 		"Enable HTTP request metrics collection")
 	flag.BoolVar(&cm.config.MetricsEnableStorageTracking, "entitydb-metrics-enable-storage-tracking", cm.config.MetricsEnableStorageTracking,
 		"Enable storage operation metrics collection")
+	flag.BoolVar(&cm.config.MetricsRollupEnabled, "entitydb-metrics-rollup-enabled", cm.config.MetricsRollupEnabled,
+		"Roll metric values up into 1m, 1h and 1d buckets")
+	flag.DurationVar(&cm.config.MetricsRollupInterval, "entitydb-metrics-rollup-interval", cm.config.MetricsRollupInterval,
+		"How often completed metric buckets are rolled up")
+	flag.IntVar(&cm.config.MetricsRollupKeep1Min, "entitydb-metrics-rollup-keep-1min", cm.config.MetricsRollupKeep1Min,
+		"1-minute metric buckets kept per metric")
+	flag.IntVar(&cm.config.MetricsRollupKeep1Hour, "entitydb-metrics-rollup-keep-1hour", cm.config.MetricsRollupKeep1Hour,
+		"1-hour metric buckets kept per metric")
+	flag.IntVar(&cm.config.MetricsRollupKeep1Day, "entitydb-metrics-rollup-keep-1day", cm.config.MetricsRollupKeep1Day,
+		"1-day metric buckets kept per metric")
 	
 	// Throttling Configuration - all long flags
 	flag.BoolVar(&cm.config.ThrottleEnabled, "entitydb-throttle-enabled", cm.config.ThrottleEnabled,
@@ -225,6 +277,10 @@ func (cm *ConfigManager) RegisterFlags() {
 		"Index file suffix")
 	flag.StringVar(&cm.config.BackupPath, "entitydb-backup-path", cm.config.BackupPath,
 		"Backup directory path")
+	flag.StringVar(&cm.config.BackupSigningKey, "entitydb-backup-signing-key", cm.config.BackupSigningKey,
+		"Ed25519 private key file used to sign backup manifests")
+	flag.StringVar(&cm.config.BackupVerifyKey, "entitydb-backup-verify-key", cm.config.BackupVerifyKey,
+		"Ed25519 public key file required to verify backup manifests")
 	flag.StringVar(&cm.config.TempPath, "entitydb-temp-path", cm.config.TempPath,
 		"Temporary files directory")
 	flag.StringVar(&cm.config.PIDFile, "entitydb-pid-file", cm.config.PIDFile,
@@ -261,6 +317,284 @@ func (cm *ConfigManager) RegisterFlags() {
 	// Advanced Security Configuration - all long flags
 	flag.IntVar(&cm.config.BcryptCost, "entitydb-bcrypt-cost", cm.config.BcryptCost,
 		"Bcrypt cost for password hashing (4-31)")
+	flag.StringVar(&cm.config.MFAKeyFile, "entitydb-mfa-key-file", cm.config.MFAKeyFile,
+		"Key file encrypting TOTP secrets (relative to data path, generated if missing)")
+	flag.StringVar(&cm.config.MFAIssuer, "entitydb-mfa-issuer", cm.config.MFAIssuer,
+		"Issuer name shown in authenticator apps")
+	
+	// OIDC Single Sign-On Configuration - all long flags
+	flag.BoolVar(&cm.config.OIDCEnabled, "entitydb-oidc-enabled", cm.config.OIDCEnabled,
+		"Enable login through an OpenID Connect identity provider")
+	flag.StringVar(&cm.config.OIDCIssuerURL, "entitydb-oidc-issuer-url", cm.config.OIDCIssuerURL,
+		"OIDC provider issuer URL")
+	flag.StringVar(&cm.config.OIDCClientID, "entitydb-oidc-client-id", cm.config.OIDCClientID,
+		"OIDC client ID")
+	flag.StringVar(&cm.config.OIDCClientSecret, "entitydb-oidc-client-secret", cm.config.OIDCClientSecret,
+		"OIDC client secret")
+	flag.StringVar(&cm.config.OIDCRedirectURL, "entitydb-oidc-redirect-url", cm.config.OIDCRedirectURL,
+		"OIDC callback URL registered with the provider")
+	flag.StringVar(&cm.config.OIDCScopes, "entitydb-oidc-scopes", cm.config.OIDCScopes,
+		"Space-separated OIDC scopes")
+	flag.StringVar(&cm.config.OIDCUsernameClaim, "entitydb-oidc-username-claim", cm.config.OIDCUsernameClaim,
+		"ID token claim used as the username")
+	flag.StringVar(&cm.config.OIDCGroupsClaim, "entitydb-oidc-groups-claim", cm.config.OIDCGroupsClaim,
+		"ID token claim listing the user's groups")
+	flag.StringVar(&cm.config.OIDCGroupRoles, "entitydb-oidc-group-roles", cm.config.OIDCGroupRoles,
+		"Group to role mapping as comma-separated group=role pairs")
+	flag.StringVar(&cm.config.OIDCDefaultRole, "entitydb-oidc-default-role", cm.config.OIDCDefaultRole,
+		"Role for users without a mapped group (empty rejects them)")
+	flag.BoolVar(&cm.config.OIDCPasswordLogin, "entitydb-oidc-password-login", cm.config.OIDCPasswordLogin,
+		"Keep password login available when OIDC is enabled")
+	
+	// LDAP Directory Synchronization Configuration - all long flags
+	flag.BoolVar(&cm.config.LDAPSyncEnabled, "entitydb-ldap-sync-enabled", cm.config.LDAPSyncEnabled,
+		"Enable LDAP/Active Directory user synchronization")
+	flag.StringVar(&cm.config.LDAPURL, "entitydb-ldap-url", cm.config.LDAPURL,
+		"LDAP server URL (ldap:// or ldaps://)")
+	flag.BoolVar(&cm.config.LDAPStartTLS, "entitydb-ldap-start-tls", cm.config.LDAPStartTLS,
+		"Upgrade ldap:// connections with StartTLS")
+	flag.StringVar(&cm.config.LDAPCACertFile, "entitydb-ldap-ca-cert-file", cm.config.LDAPCACertFile,
+		"PEM bundle trusted for the LDAP server certificate")
+	flag.StringVar(&cm.config.LDAPBindDN, "entitydb-ldap-bind-dn", cm.config.LDAPBindDN,
+		"LDAP service account DN (empty binds anonymously)")
+	flag.StringVar(&cm.config.LDAPBindPassword, "entitydb-ldap-bind-password", cm.config.LDAPBindPassword,
+		"LDAP service account password")
+	flag.StringVar(&cm.config.LDAPUserBaseDN, "entitydb-ldap-user-base-dn", cm.config.LDAPUserBaseDN,
+		"Base DN searched for users")
+	flag.StringVar(&cm.config.LDAPUserFilter, "entitydb-ldap-user-filter", cm.config.LDAPUserFilter,
+		"LDAP filter selecting users to synchronize")
+	flag.StringVar(&cm.config.LDAPUsernameAttribute, "entitydb-ldap-username-attribute", cm.config.LDAPUsernameAttribute,
+		"Attribute holding the username")
+	flag.StringVar(&cm.config.LDAPEmailAttribute, "entitydb-ldap-email-attribute", cm.config.LDAPEmailAttribute,
+		"Attribute holding the email address")
+	flag.StringVar(&cm.config.LDAPIDAttribute, "entitydb-ldap-id-attribute", cm.config.LDAPIDAttribute,
+		"Attribute holding a stable unique user ID")
+	flag.StringVar(&cm.config.LDAPGroupAttribute, "entitydb-ldap-group-attribute", cm.config.LDAPGroupAttribute,
+		"User attribute listing the user's groups")
+	flag.StringVar(&cm.config.LDAPGroupBaseDN, "entitydb-ldap-group-base-dn", cm.config.LDAPGroupBaseDN,
+		"Base DN searched for groups (empty uses the group attribute)")
+	flag.StringVar(&cm.config.LDAPGroupFilter, "entitydb-ldap-group-filter", cm.config.LDAPGroupFilter,
+		"LDAP filter selecting group entries")
+	flag.StringVar(&cm.config.LDAPGroupMemberAttribute, "entitydb-ldap-group-member-attribute", cm.config.LDAPGroupMemberAttribute,
+		"Group attribute listing its members")
+	flag.StringVar(&cm.config.LDAPGroupRoles, "entitydb-ldap-group-roles", cm.config.LDAPGroupRoles,
+		"Group to role mapping as semicolon-separated group=role pairs")
+	flag.StringVar(&cm.config.LDAPDefaultRole, "entitydb-ldap-default-role", cm.config.LDAPDefaultRole,
+		"Role for users without a mapped group (empty skips them)")
+	flag.DurationVar(&cm.config.LDAPSyncInterval, "entitydb-ldap-sync-interval", cm.config.LDAPSyncInterval,
+		"How often the directory is synchronized (0 = startup and on request only)")
+	flag.BoolVar(&cm.config.LDAPDeprovision, "entitydb-ldap-deprovision", cm.config.LDAPDeprovision,
+		"Deactivate users removed from the directory")
+	flag.BoolVar(&cm.config.LDAPLinkLocalUsers, "entitydb-ldap-link-local-users", cm.config.LDAPLinkLocalUsers,
+		"Convert local users with a directory username into directory users")
+	
+	// Index Rebuild Configuration - all long flags
+	flag.IntVar(&cm.config.IndexRebuildWorkers, "entitydb-index-rebuild-workers", cm.config.IndexRebuildWorkers,
+		"Number of workers used to rebuild indexes at startup")
+	flag.IntVar(&cm.config.IndexRebuildChunkSize, "entitydb-index-rebuild-chunk-size", cm.config.IndexRebuildChunkSize,
+		"Entities claimed per worker during index rebuild")
+	flag.IntVar(&cm.config.IndexRebuildIORateLimitMB, "entitydb-index-rebuild-io-rate-limit-mb", cm.config.IndexRebuildIORateLimitMB,
+		"Index rebuild throughput cap in MB/s (0 = unlimited)")
+	flag.StringVar(&cm.config.ContentIndexPaths, "entitydb-content-index-paths", cm.config.ContentIndexPaths,
+		"JSON content paths to index as comma-separated dataset:path pairs")
+	flag.Int64Var(&cm.config.TagIndexMemoryBudget, "entitydb-tag-index-memory-budget", cm.config.TagIndexMemoryBudget,
+		"Tag index memory in bytes before cold posting lists spill to disk (0 = unlimited)")
+	flag.StringVar(&cm.config.TagIndexSpillDir, "entitydb-tag-index-spill-dir", cm.config.TagIndexSpillDir,
+		"Directory for spilled tag posting lists (default: data path)")
+	
+	// Dataset Quota Configuration - all long flags
+	flag.Int64Var(&cm.config.DatasetQuotaMaxEntities, "entitydb-dataset-quota-max-entities", cm.config.DatasetQuotaMaxEntities,
+		"Maximum entities per dataset (0 = unlimited)")
+	flag.Int64Var(&cm.config.DatasetQuotaMaxBytes, "entitydb-dataset-quota-max-bytes", cm.config.DatasetQuotaMaxBytes,
+		"Maximum content and tag bytes per dataset (0 = unlimited)")
+	flag.StringVar(&cm.config.DatasetQuotaMode, "entitydb-dataset-quota-mode", cm.config.DatasetQuotaMode,
+		"Action on writes past a dataset quota: warn or reject")
+	
+	// Content Versioning Configuration - all long flags
+	flag.BoolVar(&cm.config.ContentVersioning, "entitydb-content-versioning", cm.config.ContentVersioning,
+		"Keep replaced content as versions readable with as-of queries")
+	flag.IntVar(&cm.config.ContentVersionLimit, "entitydb-content-version-limit", cm.config.ContentVersionLimit,
+		"Maximum content versions kept per entity (0 = unlimited)")
+	
+	// Entity Lock Configuration - all long flags
+	flag.BoolVar(&cm.config.EntityLockEnforce, "entitydb-entity-lock-enforce", cm.config.EntityLockEnforce,
+		"Refuse entity updates while another user holds a lock")
+	flag.DurationVar(&cm.config.EntityLockDefaultTTL, "entitydb-entity-lock-default-ttl", cm.config.EntityLockDefaultTTL,
+		"Lease of entity locks taken without a ttl")
+	flag.DurationVar(&cm.config.EntityLockMaxTTL, "entitydb-entity-lock-max-ttl", cm.config.EntityLockMaxTTL,
+		"Longest lease an entity lock may be taken for")
+	
+	// Query Admission Configuration - all long flags
+	flag.BoolVar(&cm.config.QueryAdmissionEnabled, "entitydb-query-admission", cm.config.QueryAdmissionEnabled,
+		"Enable query cost estimation and admission control")
+	flag.IntVar(&cm.config.QueryMaxCost, "entitydb-query-max-cost", cm.config.QueryMaxCost,
+		"Maximum estimated cost of a single query (0 = unlimited)")
+	flag.IntVar(&cm.config.QueryUserBudget, "entitydb-query-user-budget", cm.config.QueryUserBudget,
+		"Query cost each user may spend per minute (0 = unlimited)")
+	flag.IntVar(&cm.config.QueryDatasetBudget, "entitydb-query-dataset-budget", cm.config.QueryDatasetBudget,
+		"Query cost each dataset may absorb per minute (0 = unlimited)")
+	flag.DurationVar(&cm.config.QueryQueueTimeout, "entitydb-query-queue-timeout", cm.config.QueryQueueTimeout,
+		"How long a query waits for budget before it is rejected")
+	flag.DurationVar(&cm.config.QueryTimeout, "entitydb-query-timeout", cm.config.QueryTimeout,
+		"How long an entity list, query or search may read (0 = no deadline)")
+	
+	// Upload Configuration - all long flags
+	flag.DurationVar(&cm.config.UploadSessionTTL, "entitydb-upload-session-ttl", cm.config.UploadSessionTTL,
+		"How long an uncommitted chunked upload may stay open")
+	flag.IntVar(&cm.config.ChunkReadAhead, "entitydb-chunk-read-ahead", cm.config.ChunkReadAhead,
+		"Chunks fetched ahead of a streaming client (0 = one at a time)")
+	
+	// Encryption Configuration - all long flags
+	flag.BoolVar(&cm.config.EncryptionEnabled, "entitydb-encryption-enabled", cm.config.EncryptionEnabled,
+		"Encrypt entity content at rest")
+	flag.StringVar(&cm.config.EncryptionKeyFile, "entitydb-encryption-key-file", cm.config.EncryptionKeyFile,
+		"Master key ring file, one \"<key-id> <base64 key>\" line per key")
+	flag.StringVar(&cm.config.EncryptionKeyCommand, "entitydb-encryption-key-command", cm.config.EncryptionKeyCommand,
+		"Shell command printing the master key ring (overrides the key file)")
+	flag.StringVar(&cm.config.EncryptionActiveKey, "entitydb-encryption-active-key", cm.config.EncryptionActiveKey,
+		"Master key ID new content is sealed with (default: last key in the ring)")
+	
+	// Signing Configuration - all long flags
+	flag.BoolVar(&cm.config.SigningEnabled, "entitydb-signing-enabled", cm.config.SigningEnabled,
+		"Sign entities with Ed25519 when they are written")
+	flag.StringVar(&cm.config.SigningKeyFile, "entitydb-signing-key-file", cm.config.SigningKeyFile,
+		"Signing key ring file, one \"<key-id> <base64 key>\" line per key")
+	flag.StringVar(&cm.config.SigningActiveKey, "entitydb-signing-active-key", cm.config.SigningActiveKey,
+		"Key ID new signatures are made with (default: last key in the ring)")
+	
+	// Compression Configuration - all long flags
+	flag.StringVar(&cm.config.CompressionCodec, "entitydb-compression-codec", cm.config.CompressionCodec,
+		"Content compression codec: gzip, zstd, lz4 or none")
+	flag.StringVar(&cm.config.CompressionContentTypes, "entitydb-compression-content-types", cm.config.CompressionContentTypes,
+		"Per content type codecs, e.g. \"application/json=zstd,image/*=none\"")
+	
+	// WAL Archive Configuration - all long flags
+	flag.StringVar(&cm.config.WALArchiveDir, "entitydb-wal-archive-dir", cm.config.WALArchiveDir,
+		"Archive WAL segments to this directory at each checkpoint (empty = disabled)")
+	flag.StringVar(&cm.config.WALArchiveCommand, "entitydb-wal-archive-command", cm.config.WALArchiveCommand,
+		"Shell command shipping each sealed WAL segment (%p = path, %f = name)")
+	
+	// Change Data Capture Configuration - all long flags
+	flag.StringVar(&cm.config.CDCSink, "entitydb-cdc-sink", cm.config.CDCSink,
+		"Publish committed WAL operations to this broker: kafka or nats (empty = disabled)")
+	flag.StringVar(&cm.config.CDCBrokers, "entitydb-cdc-brokers", cm.config.CDCBrokers,
+		"Comma-separated Kafka brokers or NATS server URLs")
+	flag.StringVar(&cm.config.CDCTopic, "entitydb-cdc-topic", cm.config.CDCTopic,
+		"Kafka topic or NATS subject for change data capture")
+	flag.StringVar(&cm.config.CDCOutboxPath, "entitydb-cdc-outbox-path", cm.config.CDCOutboxPath,
+		"Directory of operations awaiting broker acknowledgement (relative to data path)")
+	flag.IntVar(&cm.config.CDCBatchSize, "entitydb-cdc-batch-size", cm.config.CDCBatchSize,
+		"Operations sent per broker request")
+	
+	// Job Queue Configuration - all long flags
+	flag.IntVar(&cm.config.JobWorkers, "entitydb-job-workers", cm.config.JobWorkers,
+		"Background jobs that may run at once")
+	flag.IntVar(&cm.config.JobQueueSize, "entitydb-job-queue-size", cm.config.JobQueueSize,
+		"Jobs that may wait for a worker")
+	flag.IntVar(&cm.config.JobHistory, "entitydb-job-history", cm.config.JobHistory,
+		"Finished jobs kept for status queries")
+	
+	// Export Configuration - all long flags
+	flag.StringVar(&cm.config.ExportPath, "entitydb-export-path", cm.config.ExportPath,
+		"Directory for asynchronous query exports (relative to data path)")
+	flag.DurationVar(&cm.config.ExportTTL, "entitydb-export-ttl", cm.config.ExportTTL,
+		"How long a finished export can be downloaded")
+	flag.IntVar(&cm.config.ExportMaxConcurrent, "entitydb-export-max-concurrent", cm.config.ExportMaxConcurrent,
+		"Exports that may run at once (0 = unlimited)")
+	
+	// Import Configuration - all long flags
+	flag.Int64Var(&cm.config.ImportMaxBytes, "entitydb-import-max-bytes", cm.config.ImportMaxBytes,
+		"Maximum size of an uploaded import file")
+	
+	// Sandbox Configuration - all long flags
+	flag.StringVar(&cm.config.SandboxTemplatePath, "entitydb-sandbox-template-path", cm.config.SandboxTemplatePath,
+		"Directory of sandbox template bundles (relative to data path)")
+	flag.DurationVar(&cm.config.SandboxCheckInterval, "entitydb-sandbox-check-interval", cm.config.SandboxCheckInterval,
+		"How often sandbox reset schedules are checked (0 = disabled)")
+	
+	// Retention Service Configuration - all long flags
+	flag.BoolVar(&cm.config.RetentionEnabled, "entitydb-retention", cm.config.RetentionEnabled,
+		"Apply retention policies to temporal tags in the background")
+	flag.DurationVar(&cm.config.RetentionInterval, "entitydb-retention-interval", cm.config.RetentionInterval,
+		"How often retention policies are applied")
+	flag.BoolVar(&cm.config.RetentionDryRun, "entitydb-retention-dry-run", cm.config.RetentionDryRun,
+		"Count what retention would prune without changing entities")
+	
+	// Webhook Configuration - all long flags
+	flag.BoolVar(&cm.config.WebhooksEnabled, "entitydb-webhooks", cm.config.WebhooksEnabled,
+		"Deliver entity change events to type:webhook entities")
+	flag.StringVar(&cm.config.WebhookAllowedHosts, "entitydb-webhook-allowed-hosts", cm.config.WebhookAllowedHosts,
+		"Comma-separated hosts webhooks may deliver to (empty = any)")
+	flag.DurationVar(&cm.config.WebhookTimeout, "entitydb-webhook-timeout", cm.config.WebhookTimeout,
+		"Timeout of each webhook delivery attempt")
+	flag.IntVar(&cm.config.WebhookMaxRetries, "entitydb-webhook-max-retries", cm.config.WebhookMaxRetries,
+		"Retries of a failed webhook delivery")
+	
+	// Tag Rule Configuration - all long flags
+	flag.BoolVar(&cm.config.TagRulesEnabled, "entitydb-tag-rules", cm.config.TagRulesEnabled,
+		"Add the tags of type:tag_rule entities to written entities whose content matches")
+	
+	// Scheduler Configuration - all long flags
+	flag.BoolVar(&cm.config.SchedulerEnabled, "entitydb-scheduler", cm.config.SchedulerEnabled,
+		"Run type:schedule entities on their cron schedules")
+	flag.IntVar(&cm.config.SchedulerHistoryLimit, "entitydb-scheduler-history-limit", cm.config.SchedulerHistoryLimit,
+		"Run records kept per schedule")
+	flag.StringVar(&cm.config.SchedulerAlertURL, "entitydb-scheduler-alert-url", cm.config.SchedulerAlertURL,
+		"URL notified of every failed scheduled run")
+	
+	// User Reconciliation Configuration - all long flags
+	flag.BoolVar(&cm.config.UserReconcileOnStartup, "entitydb-user-reconcile-on-startup", cm.config.UserReconcileOnStartup,
+		"Merge user entities sharing a username at startup")
+	
+	// Standby Verification Configuration - all long flags
+	flag.BoolVar(&cm.config.StandbyVerifyEnabled, "entitydb-standby-verify", cm.config.StandbyVerifyEnabled,
+		"Continuously restore and check the latest backup of the primary database")
+	flag.StringVar(&cm.config.StandbyPrimaryDatabase, "entitydb-standby-primary-database", cm.config.StandbyPrimaryDatabase,
+		"Primary database file verified by the standby (default: this instance's database)")
+	
+	// Snapshot Configuration - all long flags
+	flag.BoolVar(&cm.config.SnapshotEnabled, "entitydb-snapshot", cm.config.SnapshotEnabled,
+		"Take consistent snapshots of the database on an interval")
+	flag.StringVar(&cm.config.SnapshotPath, "entitydb-snapshot-path", cm.config.SnapshotPath,
+		"Directory snapshots are written to (relative to the data path)")
+	flag.DurationVar(&cm.config.SnapshotInterval, "entitydb-snapshot-interval", cm.config.SnapshotInterval,
+		"Time between scheduled snapshots")
+	flag.IntVar(&cm.config.SnapshotKeep, "entitydb-snapshot-keep", cm.config.SnapshotKeep,
+		"Number of snapshots kept (0 = no limit)")
+	
+	// gRPC API Configuration - all long flags
+	flag.BoolVar(&cm.config.GRPCEnabled, "entitydb-grpc", cm.config.GRPCEnabled,
+		"Serve the gRPC API alongside the REST API")
+	flag.IntVar(&cm.config.GRPCPort, "entitydb-grpc-port", cm.config.GRPCPort,
+		"gRPC server port (default from ENTITYDB_GRPC_PORT or 9085)")
+	
+	// SQL Gateway Configuration - all long flags
+	flag.BoolVar(&cm.config.SQLGatewayEnabled, "entitydb-sql-gateway", cm.config.SQLGatewayEnabled,
+		"Serve read-only SQL over the PostgreSQL wire protocol")
+	flag.IntVar(&cm.config.SQLGatewayPort, "entitydb-sql-gateway-port", cm.config.SQLGatewayPort,
+		"SQL gateway port (default from ENTITYDB_SQL_GATEWAY_PORT or 5485)")
+	flag.IntVar(&cm.config.SQLGatewayMaxRows, "entitydb-sql-gateway-max-rows", cm.config.SQLGatewayMaxRows,
+		"Maximum table rows a SQL gateway query may read (0 = no limit)")
+	
+	// Access Log Configuration - all long flags
+	flag.Float64Var(&cm.config.AccessLogSampleRate, "entitydb-access-log-sample-rate", cm.config.AccessLogSampleRate,
+		"Fraction of read requests recorded in the access log (0 = disabled)")
+	flag.DurationVar(&cm.config.AccessLogWindow, "entitydb-access-log-window", cm.config.AccessLogWindow,
+		"Duration of each persisted usage window")
+	
+	// Slow Query Log Configuration - all long flags
+	flag.DurationVar(&cm.config.SlowQueryThreshold, "entitydb-slow-query-threshold", cm.config.SlowQueryThreshold,
+		"Requests slower than this are recorded in the slow query log (0 = disabled)")
+	flag.IntVar(&cm.config.SlowQueryLogSize, "entitydb-slow-query-log-size", cm.config.SlowQueryLogSize,
+		"Number of recent slow requests kept")
+	
+	// Audit Log Configuration - all long flags
+	flag.BoolVar(&cm.config.AuditEnabled, "entitydb-audit", cm.config.AuditEnabled,
+		"Record every mutating API operation as an audit event")
+	flag.StringVar(&cm.config.AuditLogFile, "entitydb-audit-log-file", cm.config.AuditLogFile,
+		"File audit events are appended to as JSON lines")
+	flag.StringVar(&cm.config.AuditSyslog, "entitydb-audit-syslog", cm.config.AuditSyslog,
+		"Syslog destination for audit events (local, udp://host:port or tcp://host:port)")
 
 	// Essential short flags only
 	flag.Bool("v", false, "Show version information")
@@ -269,6 +603,11 @@ func (cm *ConfigManager) RegisterFlags() {
 	flag.Bool("h", false, "Show help")
 	flag.Bool("help", false, "Show help")
 
+	// Maintenance modes, which run and exit without starting the server
+	flag.Bool("fsck", false, "Check the database for consistency, print a JSON report and exit")
+	flag.Bool("fsck-repair", false, "With --fsck, repair the database when problems are found")
+	flag.String("snapshot-restore", "", "Replace the database with a snapshot after checking it, print a JSON report and exit")
+
 	// Store flag values for priority handling
 	flag.VisitAll(func(f *flag.Flag) {
 		cm.flagValues[f.Name] = f.Value
@@ -308,10 +647,54 @@ func (cm *ConfigManager) applyFlags() {
 			if v, err := strconv.Atoi(f.Value.String()); err == nil {
 				cm.config.SessionTTLHours = v
 			}
+		case "entitydb-authz-hook-url":
+			cm.config.AuthzHookURL = f.Value.String()
 		case "entitydb-log-level":
 			cm.config.LogLevel = f.Value.String()
+		case "entitydb-log-format":
+			cm.config.LogFormat = f.Value.String()
+		case "entitydb-tracing":
+			cm.config.TracingEnabled = f.Value.String() == "true"
+		case "entitydb-otlp-endpoint":
+			cm.config.OTLPEndpoint = f.Value.String()
+		case "entitydb-tracing-sample-rate":
+			if v, err := strconv.ParseFloat(f.Value.String(), 64); err == nil {
+				cm.config.TracingSampleRate = v
+			}
+		case "entitydb-tracing-service-name":
+			cm.config.TracingServiceName = f.Value.String()
 		case "entitydb-high-performance":
 			cm.config.HighPerformance = f.Value.String() == "true"
+		case "entitydb-id-bloom-filter":
+			cm.config.IDBloomFilter = f.Value.String() == "true"
+		case "entitydb-id-bloom-false-positive-rate":
+			if v, err := strconv.ParseFloat(f.Value.String(), 64); err == nil {
+				cm.config.IDBloomFalsePositiveRate = v
+			}
+		
+		// Write Batching and Durability Configuration
+		case "entitydb-batch-writes":
+			cm.config.BatchWrites = f.Value.String() == "true"
+		case "entitydb-batch-write-size":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.BatchWriteSize = v
+			}
+		case "entitydb-batch-flush-interval":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.BatchFlushInterval = v
+			}
+		case "entitydb-durability-mode":
+			cm.config.DurabilityMode = f.Value.String()
+		case "entitydb-read-only":
+			cm.config.ReadOnly = f.Value.String() == "true"
+		case "entitydb-http2":
+			cm.config.HTTP2Enabled = f.Value.String() == "true"
+		case "entitydb-response-compression":
+			cm.config.ResponseCompression = f.Value.String() == "true"
+		case "entitydb-response-compression-min-size":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.ResponseCompressionMinSize = v
+			}
 		case "entitydb-enable-rate-limit":
 			cm.config.EnableRateLimit = f.Value.String() == "true"
 		case "entitydb-rate-limit-requests":
@@ -328,6 +711,36 @@ func (cm *ConfigManager) applyFlags() {
 			cm.config.MetricsEnableRequestTracking = f.Value.String() == "true"
 		case "entitydb-metrics-enable-storage-tracking":
 			cm.config.MetricsEnableStorageTracking = f.Value.String() == "true"
+		case "entitydb-health-min-free-disk-mb":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.HealthMinFreeDiskMB = v
+			}
+		case "entitydb-health-max-memory-pressure":
+			if v, err := strconv.ParseFloat(f.Value.String(), 64); err == nil {
+				cm.config.HealthMaxMemoryPressure = v
+			}
+		case "entitydb-health-max-replication-lag":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.HealthMaxReplicationLag = v
+			}
+		case "entitydb-metrics-rollup-enabled":
+			cm.config.MetricsRollupEnabled = f.Value.String() == "true"
+		case "entitydb-metrics-rollup-interval":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.MetricsRollupInterval = v
+			}
+		case "entitydb-metrics-rollup-keep-1min":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.MetricsRollupKeep1Min = v
+			}
+		case "entitydb-metrics-rollup-keep-1hour":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.MetricsRollupKeep1Hour = v
+			}
+		case "entitydb-metrics-rollup-keep-1day":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.MetricsRollupKeep1Day = v
+			}
 		case "entitydb-throttle-enabled":
 			cm.config.ThrottleEnabled = f.Value.String() == "true"
 		case "entitydb-throttle-requests-per-minute":
@@ -346,6 +759,10 @@ func (cm *ConfigManager) applyFlags() {
 			cm.config.IndexSuffix = f.Value.String()
 		case "entitydb-backup-path":
 			cm.config.BackupPath = f.Value.String()
+		case "entitydb-backup-signing-key":
+			cm.config.BackupSigningKey = f.Value.String()
+		case "entitydb-backup-verify-key":
+			cm.config.BackupVerifyKey = f.Value.String()
 		case "entitydb-temp-path":
 			cm.config.TempPath = f.Value.String()
 		case "entitydb-pid-file":
@@ -386,6 +803,360 @@ func (cm *ConfigManager) applyFlags() {
 			if v, err := strconv.Atoi(f.Value.String()); err == nil {
 				cm.config.BcryptCost = v
 			}
+		case "entitydb-mfa-key-file":
+			cm.config.MFAKeyFile = f.Value.String()
+		case "entitydb-mfa-issuer":
+			cm.config.MFAIssuer = f.Value.String()
+		
+		// OIDC Single Sign-On Configuration
+		case "entitydb-oidc-enabled":
+			cm.config.OIDCEnabled = f.Value.String() == "true"
+		case "entitydb-oidc-issuer-url":
+			cm.config.OIDCIssuerURL = f.Value.String()
+		case "entitydb-oidc-client-id":
+			cm.config.OIDCClientID = f.Value.String()
+		case "entitydb-oidc-client-secret":
+			cm.config.OIDCClientSecret = f.Value.String()
+		case "entitydb-oidc-redirect-url":
+			cm.config.OIDCRedirectURL = f.Value.String()
+		case "entitydb-oidc-scopes":
+			cm.config.OIDCScopes = f.Value.String()
+		case "entitydb-oidc-username-claim":
+			cm.config.OIDCUsernameClaim = f.Value.String()
+		case "entitydb-oidc-groups-claim":
+			cm.config.OIDCGroupsClaim = f.Value.String()
+		case "entitydb-oidc-group-roles":
+			cm.config.OIDCGroupRoles = f.Value.String()
+		case "entitydb-oidc-default-role":
+			cm.config.OIDCDefaultRole = f.Value.String()
+		case "entitydb-oidc-password-login":
+			cm.config.OIDCPasswordLogin = f.Value.String() == "true"
+		
+		// LDAP Directory Synchronization Configuration
+		case "entitydb-ldap-sync-enabled":
+			cm.config.LDAPSyncEnabled = f.Value.String() == "true"
+		case "entitydb-ldap-url":
+			cm.config.LDAPURL = f.Value.String()
+		case "entitydb-ldap-start-tls":
+			cm.config.LDAPStartTLS = f.Value.String() == "true"
+		case "entitydb-ldap-ca-cert-file":
+			cm.config.LDAPCACertFile = f.Value.String()
+		case "entitydb-ldap-bind-dn":
+			cm.config.LDAPBindDN = f.Value.String()
+		case "entitydb-ldap-bind-password":
+			cm.config.LDAPBindPassword = f.Value.String()
+		case "entitydb-ldap-user-base-dn":
+			cm.config.LDAPUserBaseDN = f.Value.String()
+		case "entitydb-ldap-user-filter":
+			cm.config.LDAPUserFilter = f.Value.String()
+		case "entitydb-ldap-username-attribute":
+			cm.config.LDAPUsernameAttribute = f.Value.String()
+		case "entitydb-ldap-email-attribute":
+			cm.config.LDAPEmailAttribute = f.Value.String()
+		case "entitydb-ldap-id-attribute":
+			cm.config.LDAPIDAttribute = f.Value.String()
+		case "entitydb-ldap-group-attribute":
+			cm.config.LDAPGroupAttribute = f.Value.String()
+		case "entitydb-ldap-group-base-dn":
+			cm.config.LDAPGroupBaseDN = f.Value.String()
+		case "entitydb-ldap-group-filter":
+			cm.config.LDAPGroupFilter = f.Value.String()
+		case "entitydb-ldap-group-member-attribute":
+			cm.config.LDAPGroupMemberAttribute = f.Value.String()
+		case "entitydb-ldap-group-roles":
+			cm.config.LDAPGroupRoles = f.Value.String()
+		case "entitydb-ldap-default-role":
+			cm.config.LDAPDefaultRole = f.Value.String()
+		case "entitydb-ldap-sync-interval":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.LDAPSyncInterval = v
+			}
+		case "entitydb-ldap-deprovision":
+			cm.config.LDAPDeprovision = f.Value.String() == "true"
+		case "entitydb-ldap-link-local-users":
+			cm.config.LDAPLinkLocalUsers = f.Value.String() == "true"
+		
+		// Index Rebuild Configuration
+		case "entitydb-index-rebuild-workers":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.IndexRebuildWorkers = v
+			}
+		case "entitydb-index-rebuild-chunk-size":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.IndexRebuildChunkSize = v
+			}
+		case "entitydb-index-rebuild-io-rate-limit-mb":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.IndexRebuildIORateLimitMB = v
+			}
+		case "entitydb-content-index-paths":
+			cm.config.ContentIndexPaths = f.Value.String()
+		case "entitydb-tag-index-memory-budget":
+			if v, err := strconv.ParseInt(f.Value.String(), 10, 64); err == nil {
+				cm.config.TagIndexMemoryBudget = v
+			}
+		case "entitydb-tag-index-spill-dir":
+			cm.config.TagIndexSpillDir = f.Value.String()
+		
+		// Dataset Quota Configuration
+		case "entitydb-dataset-quota-max-entities":
+			if v, err := strconv.ParseInt(f.Value.String(), 10, 64); err == nil {
+				cm.config.DatasetQuotaMaxEntities = v
+			}
+		case "entitydb-dataset-quota-max-bytes":
+			if v, err := strconv.ParseInt(f.Value.String(), 10, 64); err == nil {
+				cm.config.DatasetQuotaMaxBytes = v
+			}
+		case "entitydb-dataset-quota-mode":
+			cm.config.DatasetQuotaMode = f.Value.String()
+		
+		// Content Versioning Configuration
+		case "entitydb-content-versioning":
+			cm.config.ContentVersioning = f.Value.String() == "true"
+		case "entitydb-content-version-limit":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.ContentVersionLimit = v
+			}
+		
+		// Entity Lock Configuration
+		case "entitydb-entity-lock-enforce":
+			cm.config.EntityLockEnforce = f.Value.String() == "true"
+		case "entitydb-entity-lock-default-ttl":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.EntityLockDefaultTTL = v
+			}
+		case "entitydb-entity-lock-max-ttl":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.EntityLockMaxTTL = v
+			}
+		
+		// Query Admission Configuration
+		case "entitydb-query-admission":
+			cm.config.QueryAdmissionEnabled = f.Value.String() == "true"
+		case "entitydb-query-max-cost":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.QueryMaxCost = v
+			}
+		case "entitydb-query-user-budget":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.QueryUserBudget = v
+			}
+		case "entitydb-query-dataset-budget":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.QueryDatasetBudget = v
+			}
+		case "entitydb-query-queue-timeout":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.QueryQueueTimeout = v
+			}
+		case "entitydb-query-timeout":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.QueryTimeout = v
+			}
+		
+		// Upload Configuration
+		case "entitydb-upload-session-ttl":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.UploadSessionTTL = v
+			}
+		case "entitydb-chunk-read-ahead":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.ChunkReadAhead = v
+			}
+		
+		// Encryption Configuration
+		case "entitydb-encryption-enabled":
+			cm.config.EncryptionEnabled = f.Value.String() == "true"
+		case "entitydb-encryption-key-file":
+			cm.config.EncryptionKeyFile = f.Value.String()
+		case "entitydb-encryption-key-command":
+			cm.config.EncryptionKeyCommand = f.Value.String()
+		case "entitydb-encryption-active-key":
+			cm.config.EncryptionActiveKey = f.Value.String()
+		
+		// Signing Configuration
+		case "entitydb-signing-enabled":
+			cm.config.SigningEnabled = f.Value.String() == "true"
+		case "entitydb-signing-key-file":
+			cm.config.SigningKeyFile = f.Value.String()
+		case "entitydb-signing-active-key":
+			cm.config.SigningActiveKey = f.Value.String()
+		
+		// Compression Configuration
+		case "entitydb-compression-codec":
+			cm.config.CompressionCodec = f.Value.String()
+		case "entitydb-compression-content-types":
+			cm.config.CompressionContentTypes = f.Value.String()
+		
+		// WAL Archive Configuration
+		case "entitydb-wal-archive-dir":
+			cm.config.WALArchiveDir = f.Value.String()
+		case "entitydb-wal-archive-command":
+			cm.config.WALArchiveCommand = f.Value.String()
+		
+		// Change Data Capture Configuration
+		case "entitydb-cdc-sink":
+			cm.config.CDCSink = f.Value.String()
+		case "entitydb-cdc-brokers":
+			cm.config.CDCBrokers = f.Value.String()
+		case "entitydb-cdc-topic":
+			cm.config.CDCTopic = f.Value.String()
+		case "entitydb-cdc-outbox-path":
+			cm.config.CDCOutboxPath = f.Value.String()
+		case "entitydb-cdc-batch-size":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.CDCBatchSize = v
+			}
+		
+		// Job Queue Configuration
+		case "entitydb-job-workers":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.JobWorkers = v
+			}
+		case "entitydb-job-queue-size":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.JobQueueSize = v
+			}
+		case "entitydb-job-history":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.JobHistory = v
+			}
+		
+		// Export Configuration
+		case "entitydb-export-path":
+			cm.config.ExportPath = f.Value.String()
+		case "entitydb-export-ttl":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.ExportTTL = v
+			}
+		case "entitydb-export-max-concurrent":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.ExportMaxConcurrent = v
+			}
+		
+		// Import Configuration
+		case "entitydb-import-max-bytes":
+			if v, err := strconv.ParseInt(f.Value.String(), 10, 64); err == nil {
+				cm.config.ImportMaxBytes = v
+			}
+		
+		// Sandbox Configuration
+		case "entitydb-sandbox-template-path":
+			cm.config.SandboxTemplatePath = f.Value.String()
+		case "entitydb-sandbox-check-interval":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.SandboxCheckInterval = v
+			}
+		
+		// Retention Service Configuration
+		case "entitydb-retention":
+			cm.config.RetentionEnabled = f.Value.String() == "true"
+		case "entitydb-retention-interval":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.RetentionInterval = v
+			}
+		case "entitydb-retention-dry-run":
+			cm.config.RetentionDryRun = f.Value.String() == "true"
+		
+		// Webhook Configuration
+		case "entitydb-webhooks":
+			cm.config.WebhooksEnabled = f.Value.String() == "true"
+		case "entitydb-webhook-allowed-hosts":
+			cm.config.WebhookAllowedHosts = f.Value.String()
+		case "entitydb-webhook-timeout":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.WebhookTimeout = v
+			}
+		case "entitydb-webhook-max-retries":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.WebhookMaxRetries = v
+			}
+		
+		// Tag Rule Configuration
+		case "entitydb-tag-rules":
+			cm.config.TagRulesEnabled = f.Value.String() == "true"
+		
+		// Scheduler Configuration
+		case "entitydb-scheduler":
+			cm.config.SchedulerEnabled = f.Value.String() == "true"
+		case "entitydb-scheduler-history-limit":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.SchedulerHistoryLimit = v
+			}
+		case "entitydb-scheduler-alert-url":
+			cm.config.SchedulerAlertURL = f.Value.String()
+		
+		// User Reconciliation Configuration
+		case "entitydb-user-reconcile-on-startup":
+			cm.config.UserReconcileOnStartup = f.Value.String() == "true"
+		
+		// Standby Verification Configuration
+		case "entitydb-standby-verify":
+			cm.config.StandbyVerifyEnabled = f.Value.String() == "true"
+		case "entitydb-standby-primary-database":
+			cm.config.StandbyPrimaryDatabase = f.Value.String()
+		
+		// Snapshot Configuration
+		case "entitydb-snapshot":
+			cm.config.SnapshotEnabled = f.Value.String() == "true"
+		case "entitydb-snapshot-path":
+			cm.config.SnapshotPath = f.Value.String()
+		case "entitydb-snapshot-interval":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.SnapshotInterval = v
+			}
+		case "entitydb-snapshot-keep":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.SnapshotKeep = v
+			}
+		
+		// gRPC API Configuration
+		case "entitydb-grpc":
+			cm.config.GRPCEnabled = f.Value.String() == "true"
+		case "entitydb-grpc-port":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.GRPCPort = v
+			}
+		
+		// SQL Gateway Configuration
+		case "entitydb-sql-gateway":
+			cm.config.SQLGatewayEnabled = f.Value.String() == "true"
+		case "entitydb-sql-gateway-port":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.SQLGatewayPort = v
+			}
+		case "entitydb-sql-gateway-max-rows":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.SQLGatewayMaxRows = v
+			}
+		
+		// Access Log Configuration
+		case "entitydb-access-log-sample-rate":
+			if v, err := strconv.ParseFloat(f.Value.String(), 64); err == nil {
+				cm.config.AccessLogSampleRate = v
+			}
+		case "entitydb-access-log-window":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.AccessLogWindow = v
+			}
+		
+		// Slow Query Log Configuration
+		case "entitydb-slow-query-threshold":
+			if v, err := time.ParseDuration(f.Value.String()); err == nil {
+				cm.config.SlowQueryThreshold = v
+			}
+		case "entitydb-slow-query-log-size":
+			if v, err := strconv.Atoi(f.Value.String()); err == nil {
+				cm.config.SlowQueryLogSize = v
+			}
+		
+		// Audit Log Configuration
+		case "entitydb-audit":
+			cm.config.AuditEnabled = f.Value.String() == "true"
+		case "entitydb-audit-log-file":
+			cm.config.AuditLogFile = f.Value.String()
+		case "entitydb-audit-syslog":
+			cm.config.AuditSyslog = f.Value.String()
 		}
 	})
 }
@@ -476,6 +1247,9 @@ func (cm *ConfigManager) applyCachedConfig() error {
 	if v, ok := cm.dbCache["logging.level"]; ok {
 		cm.config.LogLevel = v
 	}
+	if v, ok := cm.dbCache["logging.format"]; ok {
+		cm.config.LogFormat = v
+	}
 	if v, ok := cm.dbCache["performance.high_performance"]; ok {
 		cm.config.HighPerformance = v == "true"
 	}
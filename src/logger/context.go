@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// RequestFields identify the API request a message is logged for. They are
+// attached to the request context when the request arrives and filled in as
+// it is authenticated and routed, so every message logged with the context
+// can be correlated with the call and the X-Request-ID response header.
+type RequestFields struct {
+	mu        sync.RWMutex
+	requestID string
+	userID    string
+	entityID  string
+}
+
+// requestFieldsKey is the context key of a request's fields
+type requestFieldsKey struct{}
+
+// NewRequestContext returns a context carrying fields for requestID
+func NewRequestContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestFieldsKey{}, &RequestFields{requestID: requestID})
+}
+
+// fieldsFrom returns the request fields of ctx, or nil
+func fieldsFrom(ctx context.Context) *RequestFields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(requestFieldsKey{}).(*RequestFields)
+	return fields
+}
+
+// RequestID returns the request ID of ctx, or "" outside a request
+func RequestID(ctx context.Context) string {
+	if fields := fieldsFrom(ctx); fields != nil {
+		requestID, _, _ := fields.values()
+		return requestID
+	}
+	return ""
+}
+
+// UserID returns the authenticated user of the request of ctx, or ""
+func UserID(ctx context.Context) string {
+	if fields := fieldsFrom(ctx); fields != nil {
+		_, userID, _ := fields.values()
+		return userID
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user of the request of ctx
+func SetUserID(ctx context.Context, userID string) {
+	if fields := fieldsFrom(ctx); fields != nil {
+		fields.mu.Lock()
+		fields.userID = userID
+		fields.mu.Unlock()
+	}
+}
+
+// SetEntityID records the entity the request of ctx operates on
+func SetEntityID(ctx context.Context, entityID string) {
+	if fields := fieldsFrom(ctx); fields != nil {
+		fields.mu.Lock()
+		fields.entityID = entityID
+		fields.mu.Unlock()
+	}
+}
+
+func (f *RequestFields) values() (requestID, userID, entityID string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.requestID, f.userID, f.entityID
+}
+
+// String formats the fields for text output
+func (f *RequestFields) String() string {
+	requestID, userID, entityID := f.values()
+	var b strings.Builder
+	b.WriteString("[request_id=" + requestID)
+	if userID != "" {
+		b.WriteString(" user_id=" + userID)
+	}
+	if entityID != "" {
+		b.WriteString(" entity_id=" + entityID)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// TraceContext logs a trace-level message with the request fields of ctx
+func TraceContext(ctx context.Context, format string, args ...interface{}) {
+	logMessage(TRACE, 3, "", fieldsFrom(ctx), format, args...)
+}
+
+// DebugContext logs a debug message with the request fields of ctx
+func DebugContext(ctx context.Context, format string, args ...interface{}) {
+	logMessage(DEBUG, 3, "", fieldsFrom(ctx), format, args...)
+}
+
+// InfoContext logs an info message with the request fields of ctx
+func InfoContext(ctx context.Context, format string, args ...interface{}) {
+	logMessage(INFO, 3, "", fieldsFrom(ctx), format, args...)
+}
+
+// WarnContext logs a warning message with the request fields of ctx
+func WarnContext(ctx context.Context, format string, args ...interface{}) {
+	logMessage(WARN, 3, "", fieldsFrom(ctx), format, args...)
+}
+
+// ErrorContext logs an error message with the request fields of ctx
+func ErrorContext(ctx context.Context, format string, args ...interface{}) {
+	logMessage(ERROR, 3, "", fieldsFrom(ctx), format, args...)
+}
@@ -8,12 +8,18 @@
 // Log output format:
 //   YYYY/MM/DD HH:MM:SS.ssssss [PID:GID] [LEVEL] Message (function.file:line)
 //
+// With the JSON format each message is instead one JSON object per line
+// carrying the timestamp, level, subsystem, caller and, for messages logged
+// with a request context, the request, user and entity IDs.
+//
 // The logger is safe for concurrent use and provides minimal overhead when
 // logging is disabled for a particular level.
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
@@ -132,6 +138,9 @@ var (
 	// Logger Infrastructure
 	// ====================
 	
+	// jsonFormat selects JSON output instead of text lines.
+	jsonFormat atomic.Bool
+	
 	// logger is the underlying Go standard library logger instance.
 	// Configured with no prefix since we format all output ourselves
 	// to maintain consistent formatting across all log levels.
@@ -174,6 +183,32 @@ func GetLogLevel() string {
 	return strings.TrimSpace(levelNames[level])
 }
 
+// SetFormat selects the output format: "text" or "json"
+func SetFormat(format string) error {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text":
+		jsonFormat.Store(false)
+	case "json":
+		jsonFormat.Store(true)
+	default:
+		return fmt.Errorf("invalid log format: %s", format)
+	}
+	return nil
+}
+
+// GetFormat returns the current output format
+func GetFormat() string {
+	if jsonFormat.Load() {
+		return "json"
+	}
+	return "text"
+}
+
+// SetOutput sets where log lines are written (standard output by default)
+func SetOutput(w io.Writer) {
+	logger.SetOutput(w)
+}
+
 // EnableTrace enables trace logging for specific subsystems
 func EnableTrace(subsystems ...string) {
 	traceMutex.Lock()
@@ -218,8 +253,23 @@ func isTraceEnabled(subsystem string) bool {
 	return traceSubsystems[subsystem]
 }
 
-// formatMessage formats a log message according to our standard
-func formatMessage(level LogLevel, skip int, format string, args ...interface{}) string {
+// jsonEntry is one message in the JSON format
+type jsonEntry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Subsystem string `json:"subsystem"`
+	Message   string `json:"msg"`
+	Caller    string `json:"caller"`
+	PID       int    `json:"pid"`
+	Goroutine int    `json:"goroutine"`
+	RequestID string `json:"request_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	EntityID  string `json:"entity_id,omitempty"`
+}
+
+// formatMessage formats a log message according to our standard. The
+// subsystem defaults to the caller's package; fields may be nil.
+func formatMessage(level LogLevel, skip int, subsystem string, fields *RequestFields, format string, args ...interface{}) string {
 	// Get caller info
 	pc, file, line, ok := runtime.Caller(skip)
 	if !ok {
@@ -235,14 +285,24 @@ func formatMessage(level LogLevel, skip int, format string, args ...interface{})
 		file = file[:idx]
 	}
 	
-	// Get function name
+	// Get function and package name
 	funcName := "unknown"
+	pkgName := "unknown"
 	if fn := runtime.FuncForPC(pc); fn != nil {
 		fullName := fn.Name()
 		// Extract just the function name
 		if idx := strings.LastIndex(fullName, "."); idx != -1 {
 			funcName = fullName[idx+1:]
 		}
+		// entitydb/storage/binary.(*Writer).Close -> binary
+		pkgName = fullName[strings.LastIndex(fullName, "/")+1:]
+		if idx := strings.Index(pkgName, "."); idx != -1 {
+			pkgName = pkgName[:idx]
+		}
+	}
+	traced := subsystem != ""
+	if !traced {
+		subsystem = pkgName
 	}
 	
 	// Format message
@@ -250,9 +310,35 @@ func formatMessage(level LogLevel, skip int, format string, args ...interface{})
 	
 	// Get current goroutine ID (thread ID equivalent)
 	threadID := getGoroutineID()
+	now := time.Now()
+	
+	if jsonFormat.Load() {
+		entry := jsonEntry{
+			Time:      now.UTC().Format(time.RFC3339Nano),
+			Level:     levelNames[level],
+			Subsystem: subsystem,
+			Message:   msg,
+			Caller:    fmt.Sprintf("%s.%s:%d", funcName, file, line),
+			PID:       processID,
+			Goroutine: threadID,
+		}
+		if fields != nil {
+			entry.RequestID, entry.UserID, entry.EntityID = fields.values()
+		}
+		if data, err := json.Marshal(entry); err == nil {
+			return string(data)
+		}
+	}
+	
+	if fields != nil {
+		msg = fields.String() + " " + msg
+	}
+	if traced {
+		msg = "[" + subsystem + "] " + msg
+	}
 	
 	// Format: timestamp [pid:tid] [LEVEL] function.filename:line: message
-	timestamp := time.Now().Format("2006/01/02 15:04:05.000000")
+	timestamp := now.Format("2006/01/02 15:04:05.000000")
 	return fmt.Sprintf("%s [%d:%d] [%s] %s.%s:%d: %s",
 		timestamp, processID, threadID, levelNames[level], funcName, file, line, msg)
 }
@@ -268,14 +354,14 @@ func getGoroutineID() int {
 }
 
 // logMessage is the internal logging function
-func logMessage(level LogLevel, skip int, format string, args ...interface{}) {
+func logMessage(level LogLevel, skip int, subsystem string, fields *RequestFields, format string, args ...interface{}) {
 	// Quick check if we should log (atomic operation, very fast)
 	if level < LogLevel(currentLevel.Load()) {
 		return
 	}
 	
 	// Format and output message
-	msg := formatMessage(level, skip, format, args...)
+	msg := formatMessage(level, skip, subsystem, fields, format, args...)
 	logger.Println(msg)
 }
 
@@ -285,44 +371,44 @@ func TraceIf(subsystem string, format string, args ...interface{}) {
 	if LogLevel(currentLevel.Load()) > TRACE || !isTraceEnabled(subsystem) {
 		return
 	}
-	logMessage(TRACE, 3, "[%s] %s", subsystem, fmt.Sprintf(format, args...))
+	logMessage(TRACE, 3, subsystem, nil, format, args...)
 }
 
 // Trace logs a trace-level message
 func Trace(format string, args ...interface{}) {
-	logMessage(TRACE, 3, format, args...)
+	logMessage(TRACE, 3, "", nil, format, args...)
 }
 
 // Debug logs a debug message
 func Debug(format string, args ...interface{}) {
-	logMessage(DEBUG, 3, format, args...)
+	logMessage(DEBUG, 3, "", nil, format, args...)
 }
 
 // Info logs an info message
 func Info(format string, args ...interface{}) {
-	logMessage(INFO, 3, format, args...)
+	logMessage(INFO, 3, "", nil, format, args...)
 }
 
 // Warn logs a warning message
 func Warn(format string, args ...interface{}) {
-	logMessage(WARN, 3, format, args...)
+	logMessage(WARN, 3, "", nil, format, args...)
 }
 
 // Error logs an error message
 func Error(format string, args ...interface{}) {
-	logMessage(ERROR, 3, format, args...)
+	logMessage(ERROR, 3, "", nil, format, args...)
 }
 
 // Fatal logs an error message and exits
 func Fatal(format string, args ...interface{}) {
-	msg := formatMessage(ERROR, 2, format, args...)
+	msg := formatMessage(ERROR, 2, "", nil, format, args...)
 	logger.Println(msg)
 	os.Exit(1)
 }
 
 // Panic logs an error message and panics
 func Panic(format string, args ...interface{}) {
-	msg := formatMessage(ERROR, 2, format, args...)
+	msg := formatMessage(ERROR, 2, "", nil, format, args...)
 	logger.Println(msg)
 	panic(fmt.Sprintf(format, args...))
 }
@@ -334,6 +420,11 @@ func Configure() {
 		SetLogLevel(level)
 	}
 	
+	// Set output format from environment
+	if format := os.Getenv("ENTITYDB_LOG_FORMAT"); format != "" {
+		SetFormat(format)
+	}
+	
 	// Set trace subsystems from environment
 	if trace := os.Getenv("ENTITYDB_TRACE_SUBSYSTEMS"); trace != "" {
 		subsystems := strings.Split(trace, ",")
@@ -11,10 +11,12 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -28,11 +30,15 @@ import (
 	"entitydb/storage/binary"
 	"entitydb/api"
 	"entitydb/logger"
+	"entitydb/cdc"
 	"entitydb/config"
 	"entitydb/services"
+	"entitydb/tracing"
 	
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	
 	_ "entitydb/docs" // This is required for swagger
 )
@@ -134,21 +140,42 @@ type EntityDBServer struct {
 	securityManager  *models.SecurityManager
 	securityInit     *models.SecurityInitializer
 	deletionCollector *services.DeletionCollector
+	retentionService *services.RetentionService
+	webhookService   *services.WebhookService
+	tagRuleService   *services.TagRuleService
+	schedulerService *services.SchedulerService
+	sandboxService   *services.SandboxService
+	entityLockService *services.EntityLockService
+	ldapSyncService  *services.LDAPSyncService
+	userReconciler   *services.UserReconciler
+	standbyVerifier  *binary.StandbyVerifier
+	snapshotScheduler *binary.SnapshotScheduler
 	mu               sync.RWMutex
 	server           *http.Server
+	grpcServer       *api.GRPCServer
+	sqlGateway       *api.SQLGateway
 	entityHandler    *api.EntityHandler
 	userHandler      *api.UserHandler
 	authHandler      *api.AuthHandler
+	exportHandler    *api.ExportHandler
+	viewHandler      *api.ViewHandler
+	jobManager       *api.JobManager
 	deletionHandler  *api.DeletionHandler
 	relationshipHandler *api.EntityRelationshipHandler
+	graphHandler        *api.GraphHandler
+	graphqlHandler      *api.GraphQLHandler
 	securityMiddleware *api.SecurityMiddleware
+	shutdownManager  *api.ShutdownManager
+	serverMode       *api.ServerMode
 	config           *config.Config
 }
 
 // NewEntityDBServer creates a new server instance
 func NewEntityDBServer(cfg *config.Config) *EntityDBServer {
 	server := &EntityDBServer{
-		config: cfg,
+		config:          cfg,
+		shutdownManager: api.NewShutdownManager(),
+		serverMode:      api.NewServerMode(cfg.ReadOnly),
 	}
 	return server
 }
@@ -192,6 +219,18 @@ func main() {
 		os.Exit(0)
 	}
 	
+	// The --fsck and --snapshot-restore reports are printed on standard
+	// output, so logs go to standard error
+	fsck := flag.Lookup("fsck").Value.String() == "true"
+	snapshotRestore := flag.Lookup("snapshot-restore").Value.String()
+	if fsck || snapshotRestore != "" {
+		logger.SetOutput(os.Stderr)
+	}
+	
+	// Record initialization phases for /api/v1/admin/startup-report
+	startupReport := binary.GetStartupReport()
+	phaseStart := time.Now()
+	
 	// Initialize configuration with proper hierarchy
 	cfg, err := configManager.Initialize()
 	if err != nil {
@@ -199,6 +238,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Failed to initialize configuration: %v\n", err)
 		os.Exit(1)
 	}
+	startupReport.RecordPhase("config_load", phaseStart, nil, nil)
 	
 	// Configure logging from configuration
 	logger.Configure()
@@ -208,6 +248,9 @@ func main() {
 	if err := logger.SetLogLevel(cfg.LogLevel); err != nil {
 		logger.Fatalf("Invalid log level: %v", err)
 	}
+	if err := logger.SetFormat(cfg.LogFormat); err != nil {
+		logger.Fatalf("Invalid log format: %v", err)
+	}
 	
 	// Check for trace subsystems from environment
 	if traceSubsystems := os.Getenv("ENTITYDB_TRACE_SUBSYSTEMS"); traceSubsystems != "" {
@@ -220,6 +263,16 @@ func main() {
 	}
 	
 	
+	// Check the database and exit instead of starting the server
+	if fsck {
+		os.Exit(runFsck(cfg, flag.Lookup("fsck-repair").Value.String() == "true"))
+	}
+	
+	// Restore a snapshot and exit instead of starting the server
+	if snapshotRestore != "" {
+		os.Exit(runSnapshotRestore(cfg, snapshotRestore))
+	}
+	
 	logger.Info("starting entitydb with log level %s", strings.ToUpper(logger.GetLogLevel()))
 
 	// Initialize string interning with configured limits
@@ -264,10 +317,14 @@ func main() {
 	}
 	
 	// Create entity repository based on configuration
+	phaseStart = time.Now()
 	entityRepo, err = factory.CreateRepository(cfg)
 	if err != nil {
 		logger.Fatalf("Failed to create entity repository: %v", err)
 	}
+	startupReport.RecordPhase("repository_create", phaseStart, map[string]interface{}{
+		"repository": fmt.Sprintf("%T", entityRepo),
+	}, nil)
 	
 	// Register entity cache pressure callback if repository supports it
 	if binaryRepo, ok := entityRepo.(*binary.EntityRepository); ok {
@@ -319,6 +376,7 @@ func main() {
 			
 			if err := asyncMetricsCollector.Start(ctx); err != nil {
 				logger.Warn("Failed to start async metrics collector: %v", err)
+				asyncMetricsCollector = nil
 			} else {
 				// Initialize storage metrics with async collection
 				binary.InitAsyncStorageMetrics(entityRepo, asyncMetricsCollector)
@@ -337,6 +395,12 @@ func main() {
 		logger.Info("Configuration refreshed from database")
 	}
 	
+	// Export request and storage spans when tracing is enabled
+	shutdownTracing, err := tracing.Configure(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to configure tracing: %v", err)
+	}
+	
 	// Create server
 	server := NewEntityDBServer(cfg)
 	server.entityRepo = entityRepo
@@ -344,6 +408,11 @@ func main() {
 	// Initialize security system
 	server.securityManager = models.NewSecurityManager(entityRepo)
 	server.securityInit = models.NewSecurityInitializer(server.securityManager, entityRepo)
+	mfaKey, err := models.LoadOrCreateMFAKey(cfg.MFAKeyFullPath())
+	if err != nil {
+		logger.Fatalf("Failed to load MFA key: %v", err)
+	}
+	server.securityManager.SetMFAKey(mfaKey, cfg.MFAIssuer)
 	
 	// Initialize deletion collector
 	deletionConfig := services.DeletionCollectorConfig{
@@ -356,33 +425,316 @@ func main() {
 		Concurrency:   cfg.DeletionCollectorConcurrency,
 	}
 	server.deletionCollector = services.NewDeletionCollector(entityRepo, deletionConfig)
+	server.deletionCollector.SetWritePause(server.serverMode)
+	
+	// Initialize retention service for per-dataset and per-type temporal tag retention
+	server.retentionService = services.NewRetentionService(entityRepo, services.RetentionServiceConfig{
+		Enabled:    cfg.RetentionEnabled,
+		Interval:   cfg.RetentionInterval,
+		BatchSize:  cfg.RetentionBatchSize,
+		MaxRuntime: cfg.RetentionMaxRuntime,
+		DryRun:     cfg.RetentionDryRun,
+	})
+	server.retentionService.SetWritePause(server.serverMode)
+	
+	// Initialize webhook service; webhook entities receive entity change events
+	var changeSource services.ChangeSource
+	if repo := server.binaryRepository(); repo != nil {
+		changeSource = repo
+	}
+	server.webhookService = services.NewWebhookService(entityRepo, changeSource, services.WebhookServiceConfig{
+		Enabled:      cfg.WebhooksEnabled,
+		AllowedHosts: services.ParseWebhookAllowedHosts(cfg.WebhookAllowedHosts),
+		Timeout:      cfg.WebhookTimeout,
+		MaxRetries:   cfg.WebhookMaxRetries,
+	})
+	
+	// Initialize tag rules; tag rule entities add tags to written entities
+	// whose content matches them
+	server.tagRuleService = services.NewTagRuleService(entityRepo, changeSource, services.TagRuleServiceConfig{
+		Enabled: cfg.TagRulesEnabled,
+	})
+	server.tagRuleService.SetWritePause(server.serverMode)
+	
+	// Initialize scheduler; schedule entities run retention, view tagging and
+	// exports as their owners. Actions are registered once their handlers exist.
+	server.schedulerService = services.NewSchedulerService(entityRepo, server.securityManager, services.SchedulerServiceConfig{
+		Enabled:      cfg.SchedulerEnabled,
+		HistoryLimit: cfg.SchedulerHistoryLimit,
+		AlertURL:     cfg.SchedulerAlertURL,
+		AllowedHosts: services.ParseWebhookAllowedHosts(cfg.WebhookAllowedHosts),
+		AlertTimeout: cfg.WebhookTimeout,
+	})
+	server.schedulerService.SetWritePause(server.serverMode)
+	server.schedulerService.RegisterAction(services.ScheduleActionRetention, server.retentionService.ScheduleAction())
+	
+	// Initialize sandbox service; sandbox datasets are reset from template bundles
+	server.sandboxService = services.NewSandboxService(entityRepo, services.SandboxServiceConfig{
+		TemplatePath:  cfg.SandboxTemplateFullPath(),
+		CheckInterval: cfg.SandboxCheckInterval,
+	})
+	server.sandboxService.SetWritePause(server.serverMode)
+	
+	// Initialize entity locks; advisory leases clients take before editing
+	server.entityLockService = services.NewEntityLockService(entityRepo, services.EntityLockServiceConfig{
+		Enforce:    cfg.EntityLockEnforce,
+		DefaultTTL: cfg.EntityLockDefaultTTL,
+		MaxTTL:     cfg.EntityLockMaxTTL,
+	})
+	
+	// Initialize LDAP directory synchronization
+	if cfg.LDAPSyncEnabled {
+		groupRoles, err := services.ParseLDAPGroupRoles(cfg.LDAPGroupRoles)
+		if err != nil {
+			logger.Fatalf("Failed to configure LDAP sync: %v", err)
+		}
+		server.ldapSyncService, err = services.NewLDAPSyncService(server.securityManager, services.LDAPSyncConfig{
+			URL:                  cfg.LDAPURL,
+			StartTLS:             cfg.LDAPStartTLS,
+			CACertFile:           cfg.LDAPCACertFile,
+			BindDN:               cfg.LDAPBindDN,
+			BindPassword:         cfg.LDAPBindPassword,
+			UserBaseDN:           cfg.LDAPUserBaseDN,
+			UserFilter:           cfg.LDAPUserFilter,
+			UsernameAttribute:    cfg.LDAPUsernameAttribute,
+			EmailAttribute:       cfg.LDAPEmailAttribute,
+			IDAttribute:          cfg.LDAPIDAttribute,
+			GroupAttribute:       cfg.LDAPGroupAttribute,
+			GroupBaseDN:          cfg.LDAPGroupBaseDN,
+			GroupFilter:          cfg.LDAPGroupFilter,
+			GroupMemberAttribute: cfg.LDAPGroupMemberAttribute,
+			GroupRoles:           groupRoles,
+			DefaultRole:          cfg.LDAPDefaultRole,
+			Interval:             cfg.LDAPSyncInterval,
+			Deprovision:          cfg.LDAPDeprovision,
+			LinkLocalUsers:       cfg.LDAPLinkLocalUsers,
+		})
+		if err != nil {
+			logger.Fatalf("Failed to configure LDAP sync: %v", err)
+		}
+		server.ldapSyncService.SetWritePause(server.serverMode)
+	}
+	
+	// Initialize user reconciler; it merges duplicate users left by legacy migrations
+	server.userReconciler = services.NewUserReconciler(entityRepo, server.securityManager)
+	
+	// Initialize standby verifier; it restores the latest routine backup of the primary
+	primaryDatabase := cfg.StandbyPrimaryDatabase
+	if primaryDatabase == "" {
+		primaryDatabase = cfg.DatabaseFilename
+	}
+	var backupVerifyKey ed25519.PublicKey
+	if cfg.BackupVerifyKey != "" {
+		if backupVerifyKey, err = binary.LoadBackupVerifyKey(cfg.BackupVerifyKey); err != nil {
+			logger.Fatalf("Failed to load backup verify key: %v", err)
+		}
+	}
+	server.standbyVerifier = binary.NewStandbyVerifier(binary.StandbyVerifierConfig{
+		PrimaryDatabase: primaryDatabase,
+		BackupPath:      cfg.StandbyBackupPath,
+		RestorePath:     filepath.Join(cfg.TempFullPath(), "standby"),
+		Interval:        cfg.StandbyVerifyInterval,
+		MaxBackupAge:    cfg.StandbyMaxBackupAge,
+		VerifyKey:       backupVerifyKey,
+	})
+	
+	// Initialize snapshot scheduler; snapshots copy the binary repository's data file
+	if repo := server.binaryRepository(); repo != nil {
+		server.snapshotScheduler = binary.NewSnapshotScheduler(repo, binary.SnapshotSchedulerConfig{
+			Path:       cfg.SnapshotFullPath(),
+			Interval:   cfg.SnapshotInterval,
+			Keep:       cfg.SnapshotKeep,
+			MaxAge:     cfg.SnapshotMaxAge,
+			Manifest:   cfg.BackupManifestEnabled,
+			SigningKey: cfg.BackupSigningKey,
+		})
+	}
 	
 	// Create security middleware first
 	server.securityMiddleware = api.NewSecurityMiddleware(server.securityManager)
+	if cfg.AuthzHookURL != "" {
+		server.securityMiddleware.SetAuthorizationHook(api.NewCachingAuthorizationHook(
+			api.NewHTTPAuthorizationHook(cfg.AuthzHookURL, cfg.AuthzHookTimeout), cfg.AuthzHookCacheTTL))
+		logger.Info("Authorization hook enabled: %s (timeout: %v, cache TTL: %v)", cfg.AuthzHookURL, cfg.AuthzHookTimeout, cfg.AuthzHookCacheTTL)
+	}
 	
 	// Create handlers
 	server.entityHandler = api.NewEntityHandler(entityRepo)
+	server.entityHandler.SetLockService(server.entityLockService)
+	server.entityHandler.SetSecurityManager(server.securityManager)
 	server.userHandler = api.NewUserHandler(entityRepo)
 	server.authHandler = api.NewAuthHandler(server.securityManager)
+	if cfg.OIDCEnabled {
+		oidcLogin, err := api.NewOIDCLogin(cfg)
+		if err != nil {
+			logger.Fatalf("Failed to configure OIDC: %v", err)
+		}
+		server.authHandler.SetOIDC(oidcLogin)
+		logger.Info("OIDC single sign-on enabled with issuer %s (password login: %v)", cfg.OIDCIssuerURL, cfg.OIDCPasswordLogin)
+	}
 	server.deletionHandler = api.NewDeletionHandler(entityRepo, server.deletionCollector, server.securityMiddleware)
+	server.jobManager = api.NewJobManager(entityRepo, cfg.JobWorkers, cfg.JobQueueSize, cfg.JobHistory)
+	server.exportHandler = api.NewExportHandler(server.entityHandler, server.jobManager, cfg)
+	if err := server.exportHandler.Start(); err != nil {
+		logger.Fatalf("Failed to start export handler: %v", err)
+	}
+	server.viewHandler = api.NewViewHandler(services.NewViewService(entityRepo), server.entityHandler)
+	server.schedulerService.RegisterAction(services.ScheduleActionTagView, server.viewHandler.TagViewAction())
+	server.schedulerService.RegisterAction(services.ScheduleActionExport, server.exportHandler.ExportAction())
 	
 	// Entity relationship handler for API-first modular architecture
 	server.relationshipHandler = api.NewEntityRelationshipHandler(entityRepo)
+	server.graphHandler = api.NewGraphHandler(entityRepo)
+	server.graphqlHandler = api.NewGraphQLHandler(entityRepo)
 	
 	// Migrate legacy user_ prefixed UUIDs to pure UUIDs (one-time migration - BEFORE entity initialization)
-	if err := MigrateLegacyUUIDs(entityRepo); err != nil {
+	phaseStart = time.Now()
+	migratedCount, err := MigrateLegacyUUIDs(entityRepo)
+	if err != nil {
 		logger.Warn("Legacy UUID migration failed (non-fatal): %v", err)
 	}
+	startupReport.RecordMigrations(migratedCount)
+	startupReport.RecordPhase("legacy_uuid_migration", phaseStart, map[string]interface{}{
+		"entities_migrated": migratedCount,
+	}, err)
 	
 	// Initialize with default entities (after migration)
+	phaseStart = time.Now()
 	server.initializeEntities()
+	startupReport.RecordPhase("security_init", phaseStart, nil, nil)
+	
+	// Merge users sharing a username so logins resolve to one entity
+	if cfg.UserReconcileOnStartup {
+		phaseStart = time.Now()
+		result, err := server.userReconciler.RunOnce(false)
+		var details map[string]interface{}
+		if result != nil {
+			details = map[string]interface{}{
+				"users_scanned": result.UsersScanned,
+				"merges":        len(result.Merges),
+			}
+		}
+		if err != nil {
+			logger.Error("Failed to reconcile duplicate users: %v", err)
+		}
+		startupReport.RecordPhase("user_reconciliation", phaseStart, details, err)
+	}
 	
 	// Start deletion collector service
-	if err := server.deletionCollector.Start(); err != nil {
+	phaseStart = time.Now()
+	err = server.deletionCollector.Start()
+	if err != nil {
 		logger.Error("Failed to start deletion collector: %v", err)
 	} else {
 		logger.Info("Deletion collector started successfully")
 	}
+	startupReport.RecordPhase("deletion_collector_start", phaseStart, map[string]interface{}{
+		"enabled": cfg.DeletionCollectorEnabled,
+	}, err)
+	
+	// Start job workers
+	phaseStart = time.Now()
+	err = server.jobManager.Start()
+	if err != nil {
+		logger.Error("Failed to start job manager: %v", err)
+	}
+	startupReport.RecordPhase("job_manager_start", phaseStart, map[string]interface{}{
+		"workers":    cfg.JobWorkers,
+		"queue_size": cfg.JobQueueSize,
+	}, err)
+	
+	// Start retention service
+	phaseStart = time.Now()
+	err = server.retentionService.Start()
+	if err != nil {
+		logger.Error("Failed to start retention service: %v", err)
+	}
+	startupReport.RecordPhase("retention_service_start", phaseStart, map[string]interface{}{
+		"enabled": cfg.RetentionEnabled,
+		"dry_run": cfg.RetentionDryRun,
+	}, err)
+	
+	// Start webhook service
+	phaseStart = time.Now()
+	err = server.webhookService.Start()
+	if err != nil {
+		logger.Error("Failed to start webhook service: %v", err)
+	}
+	startupReport.RecordPhase("webhook_service_start", phaseStart, map[string]interface{}{
+		"enabled":  cfg.WebhooksEnabled,
+		"webhooks": len(server.webhookService.Webhooks()),
+	}, err)
+	
+	// Start tag rule service
+	phaseStart = time.Now()
+	err = server.tagRuleService.Start()
+	if err != nil {
+		logger.Error("Failed to start tag rule service: %v", err)
+	}
+	startupReport.RecordPhase("tag_rule_service_start", phaseStart, map[string]interface{}{
+		"enabled": cfg.TagRulesEnabled,
+		"rules":   len(server.tagRuleService.Rules()),
+	}, err)
+	
+	// Start scheduler
+	phaseStart = time.Now()
+	err = server.schedulerService.Start()
+	if err != nil {
+		logger.Error("Failed to start scheduler: %v", err)
+	}
+	startupReport.RecordPhase("scheduler_start", phaseStart, map[string]interface{}{
+		"enabled": cfg.SchedulerEnabled,
+	}, err)
+	
+	// Start publishing committed operations to the CDC broker
+	if cfg.CDCSink != "" {
+		phaseStart = time.Now()
+		err = server.startCDC(cfg)
+		if err != nil {
+			logger.Error("Failed to start change data capture: %v", err)
+		}
+		startupReport.RecordPhase("cdc_start", phaseStart, map[string]interface{}{
+			"sink":  cfg.CDCSink,
+			"topic": cfg.CDCTopic,
+		}, err)
+	}
+	
+	// Start sandbox service
+	phaseStart = time.Now()
+	err = server.sandboxService.Start()
+	if err != nil {
+		logger.Error("Failed to start sandbox service: %v", err)
+	}
+	startupReport.RecordPhase("sandbox_service_start", phaseStart, map[string]interface{}{
+		"check_interval": cfg.SandboxCheckInterval.String(),
+	}, err)
+	
+	// Start LDAP directory synchronization
+	if server.ldapSyncService != nil {
+		phaseStart = time.Now()
+		err = server.ldapSyncService.Start()
+		if err != nil {
+			logger.Error("Failed to start LDAP sync service: %v", err)
+		}
+		startupReport.RecordPhase("ldap_sync_start", phaseStart, map[string]interface{}{
+			"url":      cfg.LDAPURL,
+			"interval": cfg.LDAPSyncInterval.String(),
+		}, err)
+	}
+	
+	// Start standby verification
+	if cfg.StandbyVerifyEnabled {
+		if err := server.standbyVerifier.Start(); err != nil {
+			logger.Error("Failed to start standby verifier: %v", err)
+		}
+	}
+	
+	// Start scheduled snapshots
+	if cfg.SnapshotEnabled && server.snapshotScheduler != nil {
+		if err := server.snapshotScheduler.Start(); err != nil {
+			logger.Error("Failed to start snapshot scheduler: %v", err)
+		}
+	}
 
 	// Set up HTTP server with gorilla/mux 
 	// Using gorilla/mux provides better route ordering control than standard ServeMux
@@ -409,19 +761,32 @@ func main() {
 	apiRouter.HandleFunc("/entities/list", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.ListEntities)).Methods("GET")
 	apiRouter.HandleFunc("/entities/get", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetEntity)).Methods("GET")
 	apiRouter.HandleFunc("/entities/create", server.securityMiddleware.RequirePermission("entity", "create")(server.entityHandler.CreateEntity)).Methods("POST")
+	apiRouter.HandleFunc("/entities/upsert", server.securityMiddleware.RequirePermission("entity", "create")(server.securityMiddleware.RequirePermission("entity", "update")(server.entityHandler.UpsertEntity))).Methods("POST")
 	apiRouter.HandleFunc("/entities/update", server.securityMiddleware.RequirePermission("entity", "update")(server.entityHandler.UpdateEntity)).Methods("PUT")
+	apiRouter.HandleFunc("/entities/patch-tags", server.securityMiddleware.RequirePermission("entity", "update")(server.entityHandler.PatchEntityTags)).Methods("PATCH")
 	apiRouter.HandleFunc("/entities/query", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.QueryEntities)).Methods("GET")
+	apiRouter.HandleFunc("/entities/explain", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.ExplainQuery)).Methods("GET")
+	apiRouter.HandleFunc("/entities/count", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.CountEntities)).Methods("GET")
+	// Federated queries check entity:view in each requested dataset
+	federatedQueryHandler := api.NewFederatedQueryHandler(server.entityHandler, server.securityMiddleware)
+	apiRouter.HandleFunc("/entities/federated", server.securityMiddleware.RequireAuthentication(federatedQueryHandler.FederatedQuery)).Methods("GET")
+	apiRouter.HandleFunc("/entities/search", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.SearchEntities)).Methods("POST")
+	apiRouter.HandleFunc("/entities/geo-search", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GeoSearch)).Methods("GET")
 	apiRouter.HandleFunc("/entities/listbytag", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.ListEntities)).Methods("GET")
 	apiRouter.HandleFunc("/entities/summary", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetEntitySummary)).Methods("GET")
+	apiRouter.HandleFunc("/entities/version", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetChangeCounters)).Methods("GET")
 	
 	// Tag operations with RBAC
 	apiRouter.HandleFunc("/tags/values", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetUniqueTagValues)).Methods("GET")
+	apiRouter.HandleFunc("/tags/suggest", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.SuggestTagValues)).Methods("GET")
+	apiRouter.HandleFunc("/tags/stats", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetTagStats)).Methods("GET")
 	
 	// Entity temporal operations with RBAC
 	apiRouter.HandleFunc("/entities/as-of", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetEntityAsOf)).Methods("GET")
 	apiRouter.HandleFunc("/entities/history", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetEntityHistory)).Methods("GET")
 	apiRouter.HandleFunc("/entities/changes", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetRecentChanges)).Methods("GET")
 	apiRouter.HandleFunc("/entities/diff", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetEntityDiff)).Methods("GET")
+	apiRouter.HandleFunc("/entities/timeseries", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetEntityTimeseries)).Methods("GET")
 	
 	// Entity deletion operations with RBAC
 	apiRouter.HandleFunc("/entities/{id}/delete", server.securityMiddleware.RequirePermission("entity", "delete")(server.deletionHandler.SoftDeleteEntity)).Methods("POST")
@@ -430,10 +795,41 @@ func main() {
 	apiRouter.HandleFunc("/entities/{id}/purge", server.securityMiddleware.RequirePermission("entity", "purge")(server.deletionHandler.PurgeEntity)).Methods("DELETE")
 	apiRouter.HandleFunc("/entities/deleted", server.securityMiddleware.RequirePermission("entity", "view")(server.deletionHandler.ListDeletedEntities)).Methods("GET")
 	
+	// Entity lock operations with RBAC
+	entityLockHandler := api.NewEntityLockHandler(server.entityRepo, server.entityLockService)
+	apiRouter.HandleFunc("/entities/{id}/lock", server.securityMiddleware.RequirePermission("entity", "update")(entityLockHandler.LockEntity)).Methods("POST")
+	apiRouter.HandleFunc("/entities/{id}/unlock", server.securityMiddleware.RequirePermission("entity", "update")(entityLockHandler.UnlockEntity)).Methods("POST")
+	
+	// Legal holds; placing and lifting them needs a dedicated permission
+	legalHoldHandler := api.NewLegalHoldHandler(server.entityRepo)
+	apiRouter.HandleFunc("/entities/{id}/legal-hold", server.securityMiddleware.RequirePermission("entity", "view")(legalHoldHandler.GetLegalHold)).Methods("GET")
+	apiRouter.HandleFunc("/entities/{id}/legal-hold", server.securityMiddleware.RequirePermission("entity", "legal_hold")(legalHoldHandler.PlaceLegalHold)).Methods("POST")
+	apiRouter.HandleFunc("/entities/{id}/legal-hold", server.securityMiddleware.RequirePermission("entity", "legal_hold")(legalHoldHandler.LiftLegalHold)).Methods("DELETE")
+	
+	// Entity signatures and the public keys to check them with
+	signingHandler := api.NewSigningHandler(server.entityRepo)
+	apiRouter.HandleFunc("/entities/{id}/verify", server.securityMiddleware.RequirePermission("entity", "view")(signingHandler.VerifyEntity)).Methods("GET")
+	apiRouter.HandleFunc("/signing/keys", server.securityMiddleware.RequirePermission("entity", "view")(signingHandler.GetSigningKeys)).Methods("GET")
+	
 	// Chunking endpoints with RBAC  
 	apiRouter.HandleFunc("/entities/get-chunk", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.GetEntity)).Methods("GET")
 	apiRouter.HandleFunc("/entities/stream-content", server.securityMiddleware.RequirePermission("entity", "view")(server.entityHandler.StreamEntity)).Methods("GET")
 	
+	// Resumable chunked upload endpoints with RBAC
+	uploadHandler := api.NewUploadHandler(server.entityRepo, server.config)
+	apiRouter.HandleFunc("/entities/upload/init", server.securityMiddleware.RequirePermission("entity", "create")(uploadHandler.InitUpload)).Methods("POST")
+	apiRouter.HandleFunc("/entities/upload/chunk", server.securityMiddleware.RequirePermission("entity", "create")(uploadHandler.UploadChunk)).Methods("PUT")
+	apiRouter.HandleFunc("/entities/upload/status", server.securityMiddleware.RequirePermission("entity", "create")(uploadHandler.GetUploadStatus)).Methods("GET")
+	apiRouter.HandleFunc("/entities/upload/commit", server.securityMiddleware.RequirePermission("entity", "create")(uploadHandler.CommitUpload)).Methods("POST")
+	apiRouter.HandleFunc("/entities/upload/abort", server.securityMiddleware.RequirePermission("entity", "create")(uploadHandler.AbortUpload)).Methods("DELETE")
+	
+	// Asynchronous query exports with RBAC; exports are visible to the user who started them
+	apiRouter.HandleFunc("/entities/export", server.securityMiddleware.RequirePermission("entity", "view")(server.exportHandler.StartExport)).Methods("POST")
+	apiRouter.HandleFunc("/exports", server.securityMiddleware.RequirePermission("entity", "view")(server.exportHandler.ListExports)).Methods("GET")
+	apiRouter.HandleFunc("/exports/{id}", server.securityMiddleware.RequirePermission("entity", "view")(server.exportHandler.GetExport)).Methods("GET")
+	apiRouter.HandleFunc("/exports/{id}/download", server.securityMiddleware.RequirePermission("entity", "view")(server.exportHandler.DownloadExport)).Methods("GET")
+	apiRouter.HandleFunc("/exports/{id}", server.securityMiddleware.RequirePermission("entity", "view")(server.exportHandler.DeleteExport)).Methods("DELETE")
+	
 	// Deprecated temporal patch endpoint
 	apiRouter.HandleFunc("/patches/reindex-tags", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -454,18 +850,33 @@ func main() {
 	apiRouter.HandleFunc("/entity-relationships/{id}/network", server.securityMiddleware.RequirePermission("entity", "view")(server.relationshipHandler.GetEntityNetwork)).Methods("GET")
 	apiRouter.HandleFunc("/entity-relationships/{id}/network/{depth}", server.securityMiddleware.RequirePermission("entity", "view")(server.relationshipHandler.GetEntityNetwork)).Methods("GET")
 	apiRouter.HandleFunc("/entity-relationships/{id}/related", server.securityMiddleware.RequirePermission("entity", "view")(server.relationshipHandler.GetRelatedByTags)).Methods("GET")
+	apiRouter.HandleFunc("/entity-relationships/{id}/edges", server.securityMiddleware.RequirePermission("entity", "view")(server.relationshipHandler.GetEntityEdges)).Methods("GET")
+	apiRouter.HandleFunc("/graph/query", server.securityMiddleware.RequirePermission("entity", "view")(server.graphHandler.Query)).Methods("POST")
+	apiRouter.HandleFunc("/graphql", server.securityMiddleware.RequirePermission("entity", "view")(server.graphqlHandler.Query)).Methods("GET", "POST")
 	
 	// Auth routes - New relationship-based security
 	apiRouter.HandleFunc("/auth/login", server.authHandler.Login).Methods("POST")
+	if server.config.OIDCEnabled {
+		apiRouter.HandleFunc("/auth/login", server.authHandler.OIDCLoginRedirect).Methods("GET")
+	}
+	apiRouter.HandleFunc("/auth/oidc/login", server.authHandler.OIDCLoginRedirect).Methods("GET")
+	apiRouter.HandleFunc("/auth/oidc/callback", server.authHandler.OIDCCallback).Methods("GET")
 	apiRouter.HandleFunc("/auth/logout", server.securityMiddleware.RequireAuthentication(server.authHandler.Logout)).Methods("POST")
 	apiRouter.HandleFunc("/auth/whoami", server.securityMiddleware.RequireAuthentication(server.authHandler.WhoAmI)).Methods("GET")
 	apiRouter.HandleFunc("/auth/refresh", server.securityMiddleware.RequireAuthentication(server.authHandler.RefreshToken)).Methods("POST")
+	apiRouter.HandleFunc("/auth/mfa", server.securityMiddleware.RequireAuthentication(server.authHandler.MFAStatus)).Methods("GET")
+	apiRouter.HandleFunc("/auth/mfa/enroll", server.securityMiddleware.RequireAuthentication(server.authHandler.EnrollMFA)).Methods("POST")
+	apiRouter.HandleFunc("/auth/mfa/confirm", server.securityMiddleware.RequireAuthentication(server.authHandler.ConfirmMFA)).Methods("POST")
+	apiRouter.HandleFunc("/auth/mfa/backup-codes", server.securityMiddleware.RequireAuthentication(server.authHandler.RegenerateBackupCodes)).Methods("POST")
+	apiRouter.HandleFunc("/auth/mfa/disable", server.securityMiddleware.RequireAuthentication(server.authHandler.DisableMFA)).Methods("POST")
 	
 	
 	// User management routes with modern SecurityMiddleware (v2.32.0+)
 	apiRouter.HandleFunc("/users/create", server.securityMiddleware.RequirePermission("user", "create")(server.userHandler.CreateUser)).Methods("POST")
 	apiRouter.HandleFunc("/users/change-password", server.securityMiddleware.RequireAuthentication(server.userHandler.ChangePassword)).Methods("POST")
 	apiRouter.HandleFunc("/users/reset-password", server.securityMiddleware.RequirePermission("user", "update")(server.userHandler.ResetPassword)).Methods("POST")
+	apiRouter.HandleFunc("/users/reset-mfa", server.securityMiddleware.RequirePermission("user", "update")(server.authHandler.ResetMFA)).Methods("POST")
+	apiRouter.HandleFunc("/users/default-dataset", server.securityMiddleware.RequirePermission("user", "update")(server.authHandler.SetDefaultDataset)).Methods("POST")
 	
 	// Dashboard routes with modern SecurityMiddleware (v2.32.0+)
 	dashboardHandler := api.NewDashboardHandler(server.entityRepo)
@@ -479,16 +890,92 @@ func main() {
 	apiRouter.HandleFunc("/feature-flags/set", server.securityMiddleware.RequirePermission("config", "update")(configHandler.SetFeatureFlag)).Methods("POST")
 	
 	// Admin routes with modern SecurityMiddleware (v2.32.0+)
-	adminHandler := api.NewAdminHandler(server.entityRepo)
+	adminHandler := api.NewAdminHandler(server.entityRepo, server.jobManager)
 	apiRouter.HandleFunc("/admin/reindex", server.securityMiddleware.RequirePermission("admin", "reindex")(adminHandler.ReindexHandler)).Methods("POST")
+	jobsHandler := api.NewJobsHandler(server.jobManager)
+	apiRouter.HandleFunc("/jobs", server.securityMiddleware.RequirePermission("admin", "view")(jobsHandler.ListJobs)).Methods("GET")
+	apiRouter.HandleFunc("/jobs/{id}", server.securityMiddleware.RequirePermission("admin", "view")(jobsHandler.GetJob)).Methods("GET")
+	apiRouter.HandleFunc("/jobs/{id}/cancel", server.securityMiddleware.RequirePermission("admin", "update")(jobsHandler.CancelJob)).Methods("POST")
+	// Deprecated aliases of /jobs
+	apiRouter.HandleFunc("/admin/jobs", server.securityMiddleware.RequirePermission("admin", "view")(jobsHandler.ListJobs)).Methods("GET")
+	apiRouter.HandleFunc("/admin/jobs/{id}", server.securityMiddleware.RequirePermission("admin", "view")(jobsHandler.GetJob)).Methods("GET")
+	apiRouter.HandleFunc("/admin/startup-report", server.securityMiddleware.RequirePermission("admin", "view")(adminHandler.StartupReport)).Methods("GET")
+	apiRouter.HandleFunc("/admin/access-insights", server.securityMiddleware.RequirePermission("admin", "view")(adminHandler.AccessInsights)).Methods("GET")
+	apiRouter.HandleFunc("/admin/slow-queries", server.securityMiddleware.RequirePermission("admin", "view")(adminHandler.SlowQueries)).Methods("GET")
+	apiRouter.HandleFunc("/admin/storage", server.securityMiddleware.RequirePermission("admin", "view")(adminHandler.StorageStats)).Methods("GET")
+	apiRouter.HandleFunc("/admin/index/shards", server.securityMiddleware.RequirePermission("admin", "view")(adminHandler.IndexShards)).Methods("GET")
+	apiRouter.HandleFunc("/admin/cache", server.securityMiddleware.RequirePermission("admin", "view")(adminHandler.CacheStats)).Methods("GET")
+	apiRouter.HandleFunc("/admin/pools", server.securityMiddleware.RequirePermission("admin", "view")(adminHandler.PoolStats)).Methods("GET")
+	apiRouter.HandleFunc("/admin/cache/pinned", server.securityMiddleware.RequirePermission("admin", "view")(adminHandler.GetPinnedEntities)).Methods("GET")
+	apiRouter.HandleFunc("/admin/cache/pin", server.securityMiddleware.RequirePermission("admin", "update")(adminHandler.PinEntity)).Methods("POST")
+	apiRouter.HandleFunc("/admin/cache/unpin", server.securityMiddleware.RequirePermission("admin", "update")(adminHandler.UnpinEntity)).Methods("POST")
+	retentionHandler := api.NewRetentionHandler(server.retentionService, server.jobManager)
+	apiRouter.HandleFunc("/admin/retention", server.securityMiddleware.RequirePermission("admin", "view")(retentionHandler.GetRetentionStatus)).Methods("GET")
+	apiRouter.HandleFunc("/admin/retention/run", server.securityMiddleware.RequirePermission("admin", "update")(retentionHandler.RunRetention)).Methods("POST")
+	purgePolicyHandler := api.NewPurgePolicyHandler(server.deletionCollector)
+	apiRouter.HandleFunc("/admin/purge/preview", server.securityMiddleware.RequirePermission("admin", "view")(purgePolicyHandler.PreviewPurge)).Methods("GET")
+	webhookHandler := api.NewWebhookHandler(server.webhookService)
+	apiRouter.HandleFunc("/admin/webhooks", server.securityMiddleware.RequirePermission("admin", "view")(webhookHandler.GetWebhookStatus)).Methods("GET")
+	tagRuleHandler := api.NewTagRuleHandler(server.tagRuleService, server.jobManager)
+	apiRouter.HandleFunc("/admin/tag-rules", server.securityMiddleware.RequirePermission("admin", "view")(tagRuleHandler.GetTagRuleStatus)).Methods("GET")
+	apiRouter.HandleFunc("/admin/tag-rules/apply", server.securityMiddleware.RequirePermission("admin", "update")(tagRuleHandler.ApplyTagRules)).Methods("POST")
+	importHandler := api.NewImportHandler(services.NewImportService(server.entityRepo), server.jobManager, cfg)
+	if err := importHandler.Start(); err != nil {
+		logger.Fatalf("Failed to start import handler: %v", err)
+	}
+	apiRouter.HandleFunc("/admin/import", server.securityMiddleware.RequirePermission("admin", "update")(importHandler.StartImport)).Methods("POST")
+	apiRouter.HandleFunc("/admin/import/formats", server.securityMiddleware.RequirePermission("admin", "view")(importHandler.ListImportFormats)).Methods("GET")
+	schedulerHandler := api.NewSchedulerHandler(server.schedulerService)
+	apiRouter.HandleFunc("/admin/schedules", server.securityMiddleware.RequirePermission("admin", "view")(schedulerHandler.GetSchedulerStatus)).Methods("GET")
+	apiRouter.HandleFunc("/admin/schedules/{id}/run", server.securityMiddleware.RequirePermission("admin", "update")(schedulerHandler.RunSchedule)).Methods("POST")
+	apiRouter.HandleFunc("/admin/schedules/{id}/runs", server.securityMiddleware.RequirePermission("admin", "view")(schedulerHandler.ListScheduleRuns)).Methods("GET")
+	ldapHandler := api.NewLDAPHandler(server.ldapSyncService)
+	apiRouter.HandleFunc("/admin/ldap", server.securityMiddleware.RequirePermission("admin", "view")(ldapHandler.GetLDAPStatus)).Methods("GET")
+	apiRouter.HandleFunc("/admin/ldap/sync", server.securityMiddleware.RequirePermission("admin", "update")(ldapHandler.RunLDAPSync)).Methods("POST")
+	userReconciliationHandler := api.NewUserReconciliationHandler(server.userReconciler)
+	apiRouter.HandleFunc("/admin/users/duplicates", server.securityMiddleware.RequirePermission("admin", "view")(userReconciliationHandler.GetDuplicateUsers)).Methods("GET")
+	apiRouter.HandleFunc("/admin/users/reconcile", server.securityMiddleware.RequirePermission("admin", "update")(userReconciliationHandler.ReconcileUsers)).Methods("POST")
+	standbyHandler := api.NewStandbyHandler(server.standbyVerifier, server.entityRepo)
+	apiRouter.HandleFunc("/admin/standby", server.securityMiddleware.RequirePermission("admin", "view")(standbyHandler.GetStandbyStatus)).Methods("GET")
+	apiRouter.HandleFunc("/admin/standby/verify", server.securityMiddleware.RequirePermission("admin", "update")(standbyHandler.RunStandbyVerification)).Methods("POST")
+	apiRouter.HandleFunc("/admin/standby/verify-backup", server.securityMiddleware.RequirePermission("admin", "update")(standbyHandler.VerifyBackup)).Methods("POST")
+	
+	// Database snapshots
+	if server.snapshotScheduler != nil {
+		snapshotHandler := api.NewSnapshotHandler(server.snapshotScheduler)
+		apiRouter.HandleFunc("/admin/snapshots", server.securityMiddleware.RequirePermission("admin", "view")(snapshotHandler.ListSnapshots)).Methods("GET")
+		apiRouter.HandleFunc("/admin/snapshots", server.securityMiddleware.RequirePermission("admin", "update")(snapshotHandler.TakeSnapshot)).Methods("POST")
+	}
+	encryptionHandler := api.NewEncryptionHandler(server.entityRepo, server.jobManager)
+	apiRouter.HandleFunc("/admin/encryption", server.securityMiddleware.RequirePermission("admin", "view")(encryptionHandler.GetEncryptionStatus)).Methods("GET")
+	apiRouter.HandleFunc("/admin/encryption/rekey", server.securityMiddleware.RequirePermission("admin", "update")(encryptionHandler.RekeyContent)).Methods("POST")
+	recoveryHandler := api.NewRecoveryHandler(server.entityRepo, server.jobManager)
+	apiRouter.HandleFunc("/admin/recovery", server.securityMiddleware.RequirePermission("admin", "view")(recoveryHandler.GetRecoveryStatus)).Methods("GET")
+	apiRouter.HandleFunc("/admin/recovery/quarantine", server.securityMiddleware.RequirePermission("admin", "view")(recoveryHandler.ListQuarantine)).Methods("GET")
+	apiRouter.HandleFunc("/admin/recovery/diagnose", server.securityMiddleware.RequirePermission("admin", "update")(recoveryHandler.RunDiagnosis)).Methods("POST")
+	apiRouter.HandleFunc("/admin/recovery/rebuild", server.securityMiddleware.RequirePermission("admin", "update")(recoveryHandler.ForceRebuild)).Methods("POST")
+	apiRouter.HandleFunc("/admin/mode", server.securityMiddleware.RequirePermission("admin", "view")(server.serverMode.GetMode)).Methods("GET")
+	apiRouter.HandleFunc("/admin/mode", server.securityMiddleware.RequirePermission("admin", "update")(server.serverMode.SetMode)).Methods("POST")
 	apiRouter.HandleFunc("/admin/health", server.securityMiddleware.RequirePermission("admin", "health")(adminHandler.HealthCheckHandler)).Methods("GET")
+	auditHandler := api.NewAuditHandler()
+	apiRouter.HandleFunc("/audit", server.securityMiddleware.RequirePermission("audit", "view")(auditHandler.QueryAudit)).Methods("GET")
 	
 	// Health endpoint (no authentication required)
 	healthHandler := api.NewHealthHandler(server.entityRepo, cfg)
+	healthHandler.SetShutdownManager(server.shutdownManager)
+	healthHandler.SetServerMode(server.serverMode)
+	healthHandler.SetStandbyVerifier(server.standbyVerifier)
 	router.HandleFunc("/health", healthHandler.Health).Methods("GET")
+	router.HandleFunc("/health/live", healthHandler.Live).Methods("GET")
+	router.HandleFunc("/health/ready", healthHandler.Ready).Methods("GET")
 	
 	// Metrics endpoint (Prometheus format, no authentication required)
 	metricsHandler := api.NewMetricsHandler(server.entityRepo, cfg)
+	metricsHandler.SetRetentionService(server.retentionService)
+	metricsHandler.SetSchedulerService(server.schedulerService)
+	if server.snapshotScheduler != nil {
+		metricsHandler.SetSnapshotScheduler(server.snapshotScheduler)
+	}
 	router.HandleFunc("/metrics", metricsHandler.PrometheusMetrics).Methods("GET")
 	
 	// Temporal metrics collection endpoints with modern SecurityMiddleware
@@ -520,7 +1007,10 @@ func main() {
 		logger.Info("Starting background metrics collector (metrics tracking enabled)")
 		backgroundCollector = api.NewBackgroundMetricsCollector(server.entityRepo, cfg, cfg.MetricsInterval, cfg.MetricsGentlePauseMs)
 		backgroundCollector.Start()
-		defer backgroundCollector.Stop()
+		server.shutdownManager.Register("metrics collector", func() (int, error) {
+			backgroundCollector.Stop()
+			return 0, nil
+		})
 	} else {
 		logger.Info("Background metrics collector disabled (metrics tracking disabled)")
 	}
@@ -537,11 +1027,32 @@ func main() {
 			cfg.MetricsRetention1Hour,
 			cfg.MetricsRetention1Day,
 		)
+		retentionManager.SetWritePause(server.serverMode)
 		retentionManager.Start()
-		defer retentionManager.Stop()
+		server.shutdownManager.Register("metrics retention", func() (int, error) {
+			retentionManager.Stop()
+			return 0, nil
+		})
 		logger.Info("Metrics retention manager started")
 	}
 	
+	// Roll metric values up into 1m/1h/1d buckets for long history ranges
+	if cfg.MetricsRollupEnabled && cfg.MetricsRollupInterval > 0 {
+		rollupEngine := api.NewMetricsRollupEngine(
+			server.entityRepo,
+			cfg.MetricsRollupInterval,
+			cfg.MetricsRollupKeep1Min,
+			cfg.MetricsRollupKeep1Hour,
+			cfg.MetricsRollupKeep1Day,
+		)
+		rollupEngine.SetWritePause(server.serverMode)
+		rollupEngine.Start()
+		server.shutdownManager.Register("metrics rollup", func() (int, error) {
+			rollupEngine.Stop()
+			return 0, nil
+		})
+	}
+	
 	// Initialize query metrics collector only if request tracking is enabled
 	if cfg.MetricsEnableRequestTracking {
 		api.InitQueryMetrics(server.entityRepo)
@@ -550,6 +1061,27 @@ func main() {
 		logger.Info("Query metrics tracking disabled")
 	}
 	
+	// Initialize query admission control
+	if cfg.QueryAdmissionEnabled {
+		api.InitQueryAdmission(cfg)
+		logger.Info("Query admission control enabled (max cost: %d, user budget: %d/min, dataset budget: %d/min)",
+			cfg.QueryMaxCost, cfg.QueryUserBudget, cfg.QueryDatasetBudget)
+	}
+	
+	// Entity reads stop at the query timeout as well as on client disconnect
+	api.SetQueryTimeout(cfg.QueryTimeout)
+	
+	// Initialize sampled access logging; insights stay readable when disabled
+	api.InitAccessLog(server.entityRepo, cfg)
+	
+	// Record requests over the slow query threshold with their I/O breakdown
+	api.InitSlowQueryLog(cfg)
+	
+	// Initialize the audit log of mutating operations
+	if err := api.InitAuditLog(server.entityRepo, cfg); err != nil {
+		logger.Fatalf("Failed to initialize audit log: %v", err)
+	}
+	
 	// Storage metrics already initialized early, no need to reinitialize
 	
 	// Initialize error metrics collector
@@ -587,7 +1119,7 @@ func main() {
 	apiRouter.HandleFunc("/admin/trace-subsystems", server.securityMiddleware.RequirePermission("admin", "view")(logControlHandler.GetTraceSubsystems)).Methods("GET")
 	
 	// Dataset management routes with modern SecurityMiddleware (v2.32.0+)
-	datasetHandler := api.NewDatasetHandler(server.entityRepo)
+	datasetHandler := api.NewDatasetHandler(server.entityRepo, services.NewDatasetService(server.entityRepo), server.jobManager)
 	
 	// Dataset CRUD operations
 	apiRouter.HandleFunc("/datasets", server.securityMiddleware.RequirePermission("dataset", "view")(datasetHandler.ListDatasets)).Methods("GET")
@@ -595,6 +1127,47 @@ func main() {
 	apiRouter.HandleFunc("/datasets/{id}", server.securityMiddleware.RequirePermission("dataset", "view")(datasetHandler.GetDataset)).Methods("GET")
 	apiRouter.HandleFunc("/datasets/{id}", server.securityMiddleware.RequirePermission("dataset", "update")(datasetHandler.UpdateDataset)).Methods("PUT")
 	apiRouter.HandleFunc("/datasets/{id}", server.securityMiddleware.RequirePermission("dataset", "delete")(datasetHandler.DeleteDataset)).Methods("DELETE")
+	apiRouter.HandleFunc("/datasets/{id}/usage", server.securityMiddleware.RequirePermission("dataset", "view")(datasetHandler.GetDatasetUsage)).Methods("GET")
+	apiRouter.HandleFunc("/datasets/{id}/clone", server.securityMiddleware.RequirePermission("dataset", "create")(datasetHandler.CloneDataset)).Methods("POST")
+	apiRouter.HandleFunc("/datasets/{id}/promote", server.securityMiddleware.RequirePermission("dataset", "update")(datasetHandler.PromoteDataset)).Methods("POST")
+	
+	// Datasets tagged public:read serve entity reads without credentials
+	if repo := server.binaryRepository(); repo != nil {
+		server.securityMiddleware.SetPublicDatasets(repo)
+	}
+	
+	// Sandbox datasets; their dataset routes require sandbox:<name>
+	sandboxHandler := api.NewSandboxHandler(server.sandboxService)
+	server.securityMiddleware.SetSandboxes(server.sandboxService)
+	apiRouter.HandleFunc("/sandboxes", server.securityMiddleware.RequirePermission("dataset", "view")(sandboxHandler.ListSandboxes)).Methods("GET")
+	apiRouter.HandleFunc("/sandboxes", server.securityMiddleware.RequirePermission("dataset", "create")(sandboxHandler.CreateSandbox)).Methods("POST")
+	apiRouter.HandleFunc("/sandboxes/{name}", server.securityMiddleware.RequirePermission("dataset", "delete")(sandboxHandler.DeleteSandbox)).Methods("DELETE")
+	apiRouter.HandleFunc("/datasets/{dataset}/reset", server.securityMiddleware.RequirePermissionInDataset("dataset", "update")(sandboxHandler.ResetSandbox)).Methods("POST")
+	
+	// Delegated administration: dataset:admin in a dataset manages the
+	// permissions users hold there
+	datasetPermissionHandler := api.NewDatasetPermissionHandler(server.securityManager)
+	apiRouter.HandleFunc("/datasets/{dataset}/permissions", server.securityMiddleware.RequirePermissionInDataset("dataset", "admin")(datasetPermissionHandler.ListPermissions)).Methods("GET")
+	apiRouter.HandleFunc("/datasets/{dataset}/permissions/grant", server.securityMiddleware.RequirePermissionInDataset("dataset", "admin")(datasetPermissionHandler.GrantPermissions)).Methods("POST")
+	apiRouter.HandleFunc("/datasets/{dataset}/permissions/revoke", server.securityMiddleware.RequirePermissionInDataset("dataset", "admin")(datasetPermissionHandler.RevokePermissions)).Methods("POST")
+	
+	// Saved queries, run with the caller's entity permissions
+	viewHandler := server.viewHandler
+	apiRouter.HandleFunc("/views", server.securityMiddleware.RequirePermission("entity", "view")(viewHandler.ListViews)).Methods("GET")
+	apiRouter.HandleFunc("/views", server.securityMiddleware.RequirePermission("entity", "create")(viewHandler.CreateView)).Methods("POST")
+	apiRouter.HandleFunc("/views/{name}", server.securityMiddleware.RequirePermission("entity", "view")(viewHandler.GetView)).Methods("GET")
+	apiRouter.HandleFunc("/views/{name}", server.securityMiddleware.RequirePermission("entity", "update")(viewHandler.UpdateView)).Methods("PUT")
+	apiRouter.HandleFunc("/views/{name}", server.securityMiddleware.RequirePermission("entity", "delete")(viewHandler.DeleteView)).Methods("DELETE")
+	apiRouter.HandleFunc("/views/{name}/run", server.securityMiddleware.RequirePermission("entity", "view")(viewHandler.RunView)).Methods("GET")
+	
+	// Entity templates: defaults, requirements and content scaffolds for creation
+	templateHandler := api.NewEntityTemplateHandler(services.NewEntityTemplateService(server.entityRepo), server.entityHandler)
+	apiRouter.HandleFunc("/entity-templates", server.securityMiddleware.RequirePermission("entity", "view")(templateHandler.ListTemplates)).Methods("GET")
+	apiRouter.HandleFunc("/entity-templates", server.securityMiddleware.RequirePermission("entity", "create")(templateHandler.CreateTemplate)).Methods("POST")
+	apiRouter.HandleFunc("/entity-templates/{name}", server.securityMiddleware.RequirePermission("entity", "view")(templateHandler.GetTemplate)).Methods("GET")
+	apiRouter.HandleFunc("/entity-templates/{name}", server.securityMiddleware.RequirePermission("entity", "update")(templateHandler.UpdateTemplate)).Methods("PUT")
+	apiRouter.HandleFunc("/entity-templates/{name}", server.securityMiddleware.RequirePermission("entity", "delete")(templateHandler.DeleteTemplate)).Methods("DELETE")
+	apiRouter.HandleFunc("/entities/create-from-template/{template}", server.securityMiddleware.RequirePermission("entity", "create")(templateHandler.CreateEntityFromTemplate)).Methods("POST")
 	
 	// Dataset management operations - removed grant/revoke until implemented
 	
@@ -603,6 +1176,7 @@ func main() {
 	apiRouter.HandleFunc("/datasets/{dataset}/entities/create", server.securityMiddleware.RequirePermissionInDataset("entity", "create")(server.entityHandler.CreateEntity)).Methods("POST")
 	apiRouter.HandleFunc("/datasets/{dataset}/entities/query", server.securityMiddleware.RequirePermissionInDataset("entity", "view")(server.entityHandler.QueryEntities)).Methods("GET")
 	apiRouter.HandleFunc("/datasets/{dataset}/entities/list", server.securityMiddleware.RequirePermissionInDataset("entity", "view")(server.entityHandler.ListEntities)).Methods("GET")
+	apiRouter.HandleFunc("/datasets/{dataset}/entities/count", server.securityMiddleware.RequirePermissionInDataset("entity", "view")(server.entityHandler.CountEntities)).Methods("GET")
 	apiRouter.HandleFunc("/datasets/{dataset}/entities/get", server.securityMiddleware.RequirePermissionInDataset("entity", "view")(server.entityHandler.GetEntity)).Methods("GET")
 	apiRouter.HandleFunc("/datasets/{dataset}/entities/update", server.securityMiddleware.RequirePermissionInDataset("entity", "update")(server.entityHandler.UpdateEntity)).Methods("PUT")
 	
@@ -623,6 +1197,21 @@ func main() {
 	// Add TE header middleware to prevent hangs with browser headers
 	teHeaderMiddleware := api.NewTEHeaderMiddleware()
 	
+	// Tag every request with an ID for log correlation
+	requestIDMiddleware := api.NewRequestIDMiddleware()
+	
+	// Start a root span per request; a no-op unless tracing is enabled
+	tracingMiddleware := api.NewTracingMiddleware()
+	
+	// Let requests select the durability of their writes
+	durabilityMiddleware := api.NewDurabilityMiddleware()
+	
+	// Compress large JSON responses for clients that accept it
+	var compressionMiddleware *api.CompressionMiddleware
+	if cfg.ResponseCompression {
+		compressionMiddleware = api.NewCompressionMiddleware(cfg.ResponseCompressionMinSize)
+	}
+	
 	// Add request metrics middleware (conditionally)
 	var requestMetrics *api.RequestMetricsMiddleware
 	// Enable request metrics now that race conditions are fixed
@@ -680,7 +1269,11 @@ func main() {
 	
 	// Chain middleware together
 	chainedMiddleware := func(h http.Handler) http.Handler {
-		// Apply in order: TE header fix -> throttling -> request metrics -> handler
+		// Apply in order: request ID -> tracing -> compression -> shutdown drain -> read-only mode -> slow query log -> TE header fix -> throttling -> request metrics -> audit -> durability -> handler
+		h = durabilityMiddleware.Middleware(h)
+		if auditLogger := api.GetAuditLog(); auditLogger.IsEnabled() {
+			h = auditLogger.Middleware(h)
+		}
 		h = teHeaderMiddleware.Middleware(h)
 		if requestThrottling != nil {
 			h = requestThrottling.Handler(h)
@@ -688,7 +1281,16 @@ func main() {
 		if requestMetrics != nil {
 			h = requestMetrics.Middleware(h)
 		}
-		return h
+		if slowLog := api.GetSlowQueryLog(); slowLog.IsEnabled() {
+			h = slowLog.Middleware(h)
+		}
+		h = server.serverMode.Middleware(h)
+		h = server.shutdownManager.Middleware(h)
+		if compressionMiddleware != nil {
+			h = compressionMiddleware.Middleware(h)
+		}
+		h = tracingMiddleware.Middleware(h)
+		return requestIDMiddleware.Middleware(h)
 	}
 	
 	// Add CORS middleware with very permissive settings
@@ -714,22 +1316,29 @@ func main() {
 	
 	// Create HTTP server with timeouts
 	if cfg.UseSSL {
-		// SSL enabled - create HTTPS server with HTTP/1.1 only (disable HTTP/2)
-		// This fixes ERR_HTTP2_PROTOCOL_ERROR issues with some clients
+		// SSL enabled - create HTTPS server, offering HTTP/2 only when configured.
+		// Listing just http/1.1 in NextProtos does not turn HTTP/2 off: the
+		// server adds h2 back unless TLSNextProto is non-nil without it.
 		tlsConfig := &tls.Config{
-			NextProtos: []string{"http/1.1"}, // Disable HTTP/2
+			NextProtos: []string{"http/1.1"},
+		}
+		tlsNextProto := map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		if cfg.HTTP2Enabled {
+			tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+			tlsNextProto = nil // nil lets the server configure HTTP/2
 		}
 		
 		server.server = &http.Server{
 			Addr:         fmt.Sprintf(":%d", cfg.SSLPort),
 			Handler:      corsHandler(chainedMiddleware(router)),
 			TLSConfig:    tlsConfig,
+			TLSNextProto: tlsNextProto,
 			ReadTimeout:  cfg.HTTPReadTimeout,
 			WriteTimeout: cfg.HTTPWriteTimeout,
 			IdleTimeout:  cfg.HTTPIdleTimeout,
 		}
 		
-		logger.Info("Starting EntityDB server on HTTPS port %d with SSL enabled", cfg.SSLPort)
+		logger.Info("Starting EntityDB server on HTTPS port %d with SSL enabled (HTTP/2: %v)", cfg.SSLPort, cfg.HTTP2Enabled)
 		logger.Info("Server URL: https://localhost:%d", cfg.SSLPort)
 		logger.Info("API documentation: https://localhost:%d/swagger/", cfg.SSLPort)
 		logger.Info("Dashboard: https://localhost:%d/", cfg.SSLPort)
@@ -755,6 +1364,9 @@ func main() {
 		logger.Info("API documentation: http://localhost:%d/swagger/", cfg.Port)
 		logger.Info("Dashboard: http://localhost:%d/", cfg.Port)
 		logger.Warn("SSL is disabled. For production use, enable SSL by setting ENTITYDB_USE_SSL=true")
+		if cfg.HTTP2Enabled {
+			logger.Warn("ENTITYDB_HTTP2_ENABLED has no effect without SSL; serving HTTP/1.1")
+		}
 		
 		// Start HTTP server
 		go func() {
@@ -764,6 +1376,58 @@ func main() {
 		}()
 	}
 	
+	// Start the gRPC API alongside the REST API when enabled
+	if cfg.GRPCEnabled {
+		var grpcOpts []grpc.ServerOption
+		if cfg.UseSSL {
+			creds, err := credentials.NewServerTLSFromFile(cfg.SSLCert, cfg.SSLKey)
+			if err != nil {
+				logger.Fatalf("Failed to load TLS credentials for gRPC: %v", err)
+			}
+			grpcOpts = append(grpcOpts, grpc.Creds(creds))
+		}
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+		if err != nil {
+			logger.Fatalf("Failed to listen on gRPC port %d: %v", cfg.GRPCPort, err)
+		}
+		server.grpcServer = api.NewGRPCServer(server.entityRepo, server.securityMiddleware, grpcOpts...)
+		server.grpcServer.SetServerMode(server.serverMode)
+		server.grpcServer.SetLockService(server.entityLockService)
+		logger.Info("Starting gRPC API on port %d (TLS: %v)", cfg.GRPCPort, cfg.UseSSL)
+		go func() {
+			if err := server.grpcServer.Serve(listener); err != nil {
+				logger.Fatalf("gRPC server failed: %v", err)
+			}
+		}()
+	}
+	
+	// Start the read-only SQL gateway for BI tools when enabled
+	if cfg.SQLGatewayEnabled {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.SQLGatewayPort))
+		if err != nil {
+			logger.Fatalf("Failed to listen on SQL gateway port %d: %v", cfg.SQLGatewayPort, err)
+		}
+		server.sqlGateway, err = api.NewSQLGateway(server.entityRepo, server.securityMiddleware, cfg)
+		if err != nil {
+			logger.Fatalf("Failed to create SQL gateway: %v", err)
+		}
+		logger.Info("Starting SQL gateway on port %d (TLS: %v)", cfg.SQLGatewayPort, cfg.UseSSL)
+		go func() {
+			if err := server.sqlGateway.Serve(listener); err != nil {
+				logger.Fatalf("SQL gateway failed: %v", err)
+			}
+		}()
+	}
+	
+	startupReport.Complete()
+	startup := startupReport.Snapshot()
+	logger.Info("Startup complete in %s: %d WAL entries replayed, %d entities loaded, indexes %s, %d migrations, %d recovery actions",
+		startup.TotalDuration, startup.WALEntriesReplayed, startup.EntitiesLoaded, startup.IndexSource,
+		startup.MigrationsApplied, len(startup.RecoveryActions))
+	if server.serverMode.ReadOnly() {
+		logger.Warn("Server is read-only: mutating requests are refused until POST /api/v1/admin/mode sets read_write")
+	}
+	
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -776,24 +1440,109 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 	
-	// Shutdown HTTP server
-	if err := server.server.Shutdown(ctx); err != nil {
-		logger.Error("HTTP server shutdown error: %v", err)
+	// Producers were registered as they started; stop serving next, then
+	// flush what the services buffered into the repository and close it
+	shutdown := server.shutdownManager
+	shutdown.Register("http server", func() (int, error) {
+		return 0, server.server.Shutdown(ctx)
+	})
+	if server.grpcServer != nil {
+		shutdown.Register("grpc server", func() (int, error) {
+			server.grpcServer.Stop(ctx)
+			return 0, nil
+		})
+	}
+	if server.sqlGateway != nil {
+		shutdown.Register("sql gateway", func() (int, error) {
+			server.sqlGateway.Stop(ctx)
+			return 0, nil
+		})
 	}
+	shutdown.Register("services", func() (int, error) {
+		server.stopServices()
+		return 0, nil
+	})
 	
-	// Stop deletion collector
-	if err := server.deletionCollector.Stop(); err != nil {
-		logger.Error("Deletion collector shutdown error: %v", err)
-	} else {
-		logger.Info("Deletion collector stopped successfully")
+	// Cancel queued and running jobs, exports included
+	shutdown.Register("jobs", func() (int, error) {
+		server.exportHandler.Stop()
+		return 0, server.jobManager.Stop()
+	})
+	
+	// Persist the partial access usage window and the queued audit events
+	shutdown.Register("access log", func() (int, error) {
+		if accessLogger := api.GetAccessLog(); accessLogger != nil {
+			accessLogger.Stop()
+		}
+		return 0, nil
+	})
+	shutdown.Register("audit log", func() (int, error) {
+		if auditLogger := api.GetAuditLog(); auditLogger != nil {
+			auditLogger.Stop()
+		}
+		return 0, nil
+	})
+	
+	if asyncMetricsCollector != nil {
+		shutdown.Register("async metrics", asyncMetricsCollector.Shutdown)
 	}
+	if repo := server.binaryRepository(); repo != nil {
+		shutdown.Register("batch writer", repo.FlushPendingWrites)
+	}
+	shutdown.Register("repository", func() (int, error) {
+		return 0, server.Close()
+	})
+	shutdown.Register("tracing", func() (int, error) {
+		return 0, shutdownTracing(ctx)
+	})
 	
-	// Close repositories
-	// Repository close not needed - handled by OS on process termination
+	// Refuse writes, let in-flight requests finish and run the steps
+	report := shutdown.Drain(ctx)
+	report.Log()
 	
 	logger.Info("EntityDB server shutdown complete")
 }
 
+// runFsck runs the --fsck consistency check, repairing the database when
+// asked to, and prints the report as JSON on standard output. It returns
+// the exit code: 0 when the database is consistent, 1 when problems remain
+// and 2 when the check could not run.
+func runFsck(cfg *config.Config, repair bool) int {
+	report, err := binary.CheckDatabase(context.Background(), cfg, binary.FsckOptions{Repair: repair})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Consistency check failed: %v\n", err)
+		return 2
+	}
+	
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if !report.Healthy {
+		return 1
+	}
+	return 0
+}
+
+// runSnapshotRestore runs the --snapshot-restore command and prints the
+// report as JSON on standard output. It returns the exit code: 0 when the
+// snapshot was restored, 1 when it failed its consistency check and 2 when
+// the restore could not run.
+func runSnapshotRestore(cfg *config.Config, snapshot string) int {
+	report, err := binary.RestoreSnapshot(context.Background(), cfg, snapshot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Snapshot restore failed: %v\n", err)
+		return 2
+	}
+	
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if !report.Restored {
+		return 1
+	}
+	return 0
+}
+
 // =============================================================================
 // Server Methods
 // =============================================================================
@@ -821,29 +1570,89 @@ func (s *EntityDBServer) initializeEntities() {
 	logger.Debug("security system initialized")
 }
 
-// Close cleans up server resources
-func (s *EntityDBServer) Close() {
-	// Close repositories if they have close methods
-	logger.Debug("closing repositories")
+// stopServices stops the background services started with the server
+func (s *EntityDBServer) stopServices() {
+	// Stop deletion collector
+	if err := s.deletionCollector.Stop(); err != nil {
+		logger.Error("Deletion collector shutdown error: %v", err)
+	} else {
+		logger.Info("Deletion collector stopped successfully")
+	}
 	
-	// Close entity repository to save tag index
-	// Try different repository types
+	// Stop retention service
+	if err := s.retentionService.Stop(); err != nil {
+		logger.Error("Retention service shutdown error: %v", err)
+	}
+	if err := s.webhookService.Stop(); err != nil {
+		logger.Error("Webhook service shutdown error: %v", err)
+	}
+	if err := s.tagRuleService.Stop(); err != nil {
+		logger.Error("Tag rule service shutdown error: %v", err)
+	}
+	if err := s.schedulerService.Stop(); err != nil {
+		logger.Error("Scheduler shutdown error: %v", err)
+	}
+	if err := s.sandboxService.Stop(); err != nil {
+		logger.Error("Sandbox service shutdown error: %v", err)
+	}
+	if s.ldapSyncService != nil {
+		if err := s.ldapSyncService.Stop(); err != nil {
+			logger.Error("LDAP sync service shutdown error: %v", err)
+		}
+	}
+	if s.standbyVerifier.IsRunning() {
+		s.standbyVerifier.Stop()
+	}
+	if s.snapshotScheduler != nil && s.snapshotScheduler.IsRunning() {
+		s.snapshotScheduler.Stop()
+	}
+}
+
+// binaryRepository returns the binary repository behind the server's
+// repository, or nil for other repository types
+func (s *EntityDBServer) binaryRepository() *binary.EntityRepository {
 	switch repo := s.entityRepo.(type) {
 	case *binary.EntityRepository:
 		// All repository variants now merged into EntityRepository
-		if err := repo.Close(); err != nil {
-			logger.Error("Failed to close entity repository: %v", err)
-		}
+		return repo
 	case *binary.CachedRepository:
 		// CachedRepository wraps another repository
 		if entityRepo, ok := repo.EntityRepository.(*binary.EntityRepository); ok {
-			if err := entityRepo.Close(); err != nil {
-				logger.Error("Failed to close wrapped entity repository: %v", err)
-			}
+			return entityRepo
 		}
-	default:
-		logger.Warn("Unknown repository type, cannot close: %T", s.entityRepo)
 	}
+	return nil
+}
+
+// startCDC connects the configured CDC sink and starts publishing the
+// repository's outbox to it. Operations stay in the outbox until it succeeds.
+func (s *EntityDBServer) startCDC(cfg *config.Config) error {
+	repo := s.binaryRepository()
+	if repo == nil {
+		return fmt.Errorf("change data capture requires the binary repository")
+	}
+	sink, err := cdc.NewSink(cfg)
+	if err != nil {
+		return err
+	}
+	if err := repo.StartCDC(sink); err != nil {
+		sink.Close()
+		return err
+	}
+	logger.Info("Change data capture publishing to %s %s", cfg.CDCSink, cfg.CDCTopic)
+	return nil
+}
+
+// Close flushes and closes the entity repository, writing the data file's
+// header and index
+func (s *EntityDBServer) Close() error {
+	logger.Debug("closing repositories")
+	
+	repo := s.binaryRepository()
+	if repo == nil {
+		return fmt.Errorf("unknown repository type, cannot close: %T", s.entityRepo)
+	}
+	return repo.Close()
 }
 
 // =============================================================================
@@ -1048,13 +1857,14 @@ func (s *EntityDBServer) serveStaticFile(w http.ResponseWriter, r *http.Request)
 }
 
 // MigrateLegacyUUIDs fixes legacy user_ prefixed UUIDs to pure 32-character UUIDs
-func MigrateLegacyUUIDs(repo models.EntityRepository) error {
+// and returns the number of entities migrated
+func MigrateLegacyUUIDs(repo models.EntityRepository) (int, error) {
 	logger.Info("Starting legacy UUID migration...")
 	
 	// Get all entities with legacy user_ prefixes
 	allEntities, err := repo.List()
 	if err != nil {
-		return fmt.Errorf("failed to list entities: %v", err)
+		return 0, fmt.Errorf("failed to list entities: %v", err)
 	}
 	
 	migratedCount := 0
@@ -1114,5 +1924,5 @@ func MigrateLegacyUUIDs(repo models.EntityRepository) error {
 	}
 	
 	logger.Info("Legacy UUID migration complete: %d entities migrated", migratedCount)
-	return nil
+	return migratedCount, nil
 }
\ No newline at end of file
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content-addressed chunk storage.
+//
+// Large objects are split into chunks that are stored as entities whose ID is
+// derived from the SHA256 of their data, so identical chunks uploaded by
+// different entities are stored once. Chunk IDs carry the "chunk-" prefix and
+// the first 58 hex digits of the hash, which fits the 64-character entity ID
+// limit and keeps chunk IDs apart from every other entity ID. Each chunk
+// carries one "chunk:ref:<parentID>" tag per referrer; the chunk is only
+// purged once no live referrer remains.
+
+const (
+	// ChunkIDPrefix prefixes the ID of every content-addressed chunk entity
+	ChunkIDPrefix = "chunk-"
+
+	// chunkIDHashLength is the number of hash digits in a chunk ID, the rest
+	// of the 64 characters an entity ID may have
+	chunkIDHashLength = 64 - len(ChunkIDPrefix)
+
+	// ChunkRefTagPrefix marks an entity that references a content-addressed chunk
+	ChunkRefTagPrefix = "chunk:ref:"
+
+	// ChunkHashTagPrefix records, on the parent, the hash of the chunk at each index
+	// in the form "content:chunk-hash:<index>:<sha256>"
+	ChunkHashTagPrefix = "content:chunk-hash:"
+)
+
+// chunkRefMu serialises chunk reference changes so that a concurrent store and
+// release cannot race on the same chunk's reference tags
+var chunkRefMu sync.Mutex
+
+// ContentAddressedChunkID returns the entity ID for a chunk with the given data
+func ContentAddressedChunkID(data []byte) string {
+	return ChunkIDForHash(calculateChecksum(data))
+}
+
+// ChunkIDForHash returns the entity ID of the chunk whose data has the given
+// hex SHA256
+func ChunkIDForHash(checksum string) string {
+	if len(checksum) > chunkIDHashLength {
+		checksum = checksum[:chunkIDHashLength]
+	}
+	return ChunkIDPrefix + strings.ToLower(checksum)
+}
+
+// IsContentAddressedChunkID reports whether id names a content-addressed chunk
+func IsContentAddressedChunkID(id string) bool {
+	if len(id) != len(ChunkIDPrefix)+chunkIDHashLength || !strings.HasPrefix(id, ChunkIDPrefix) {
+		return false
+	}
+	_, err := hex.DecodeString(id[len(ChunkIDPrefix):])
+	return err == nil
+}
+
+// NewContentAddressedChunk creates a chunk entity keyed by the hash of its data
+func NewContentAddressedChunk(data []byte) *Entity {
+	checksum := calculateChecksum(data)
+	entity := NewEntity()
+	entity.ID = ChunkIDForHash(checksum)
+	entity.Tags = []string{
+		"type:chunk",
+		fmt.Sprintf("content:size:%d", len(data)),
+		fmt.Sprintf("content:checksum:sha256:%s", checksum),
+	}
+	entity.Content = data
+	return entity
+}
+
+// ChunkIDs returns the IDs of the chunk entities holding this entity's content,
+// in order. Content-addressed chunks are resolved from the chunk-hash tags;
+// entities written before deduplication fall back to "<id>-chunk-<n>".
+func (e *Entity) ChunkIDs() []string {
+	count := 0
+	hashes := make(map[int]string)
+	for _, tag := range e.GetTagsWithoutTimestamp() {
+		switch {
+		case strings.HasPrefix(tag, "content:chunks:"):
+			if n, err := strconv.Atoi(strings.TrimPrefix(tag, "content:chunks:")); err == nil {
+				count = n
+			}
+		case strings.HasPrefix(tag, ChunkHashTagPrefix):
+			parts := strings.SplitN(strings.TrimPrefix(tag, ChunkHashTagPrefix), ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			if index, err := strconv.Atoi(parts[0]); err == nil {
+				hashes[index] = parts[1]
+			}
+		}
+	}
+
+	ids := make([]string, count)
+	for i := 0; i < count; i++ {
+		if hash, ok := hashes[i]; ok {
+			ids[i] = ChunkIDForHash(hash)
+		} else {
+			ids[i] = fmt.Sprintf("%s-chunk-%d", e.ID, i)
+		}
+	}
+	return ids
+}
+
+// ChunkReferrers returns the IDs of entities that reference this chunk
+func (e *Entity) ChunkReferrers() []string {
+	var referrers []string
+	for _, tag := range e.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, ChunkRefTagPrefix) {
+			referrers = append(referrers, strings.TrimPrefix(tag, ChunkRefTagPrefix))
+		}
+	}
+	return referrers
+}
+
+// StoreChunk stores data as a content-addressed chunk referenced by parentID.
+// If a chunk with identical data already exists, only a reference is added.
+// Returns the chunk ID and whether existing data was reused.
+func StoreChunk(repo EntityRepository, parentID string, data []byte) (string, bool, error) {
+	chunkRefMu.Lock()
+	defer chunkRefMu.Unlock()
+
+	chunkID := ContentAddressedChunkID(data)
+	refTag := ChunkRefTagPrefix + parentID
+
+	if existing, err := repo.GetByID(chunkID); err == nil && existing != nil && !existing.IsRecoveryPlaceholder() {
+		if !existing.HasTag(refTag) {
+			if err := repo.AddTag(chunkID, refTag); err != nil {
+				return "", false, fmt.Errorf("failed to add chunk reference: %w", err)
+			}
+		}
+		return chunkID, true, nil
+	}
+
+	chunk := NewContentAddressedChunk(data)
+	chunk.AddTag(refTag)
+	if err := repo.Create(chunk); err != nil {
+		return "", false, fmt.Errorf("failed to create chunk: %w", err)
+	}
+	return chunkID, false, nil
+}
+
+// MoveChunkReference transfers a chunk reference from one referrer to another
+// without purging the chunk, e.g. from an upload session to the committed entity
+func MoveChunkReference(repo EntityRepository, fromID, toID, chunkID string) error {
+	chunkRefMu.Lock()
+	defer chunkRefMu.Unlock()
+
+	chunk, err := repo.GetByID(chunkID)
+	if err != nil || chunk == nil || chunk.IsRecoveryPlaceholder() {
+		return fmt.Errorf("chunk not found: %s", chunkID)
+	}
+
+	if !chunk.HasTag(ChunkRefTagPrefix + toID) {
+		if err := repo.AddTag(chunkID, ChunkRefTagPrefix+toID); err != nil {
+			return fmt.Errorf("failed to add chunk reference: %w", err)
+		}
+	}
+	if chunk.HasTag(ChunkRefTagPrefix + fromID) {
+		if err := repo.RemoveTag(chunkID, ChunkRefTagPrefix+fromID); err != nil {
+			return fmt.Errorf("failed to remove chunk reference: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReleaseChunk drops parentID's reference to a chunk and deletes the chunk when
+// no live referrer remains. An empty parentID only re-evaluates the remaining
+// references, which lets callers collect chunks whose referrers vanished.
+// Returns true if the chunk was deleted.
+func ReleaseChunk(repo EntityRepository, parentID, chunkID string) (bool, error) {
+	chunkRefMu.Lock()
+	defer chunkRefMu.Unlock()
+
+	chunk, err := repo.GetByID(chunkID)
+	if err != nil || chunk == nil || chunk.IsRecoveryPlaceholder() {
+		return false, nil // Already gone
+	}
+
+	if parentID != "" && chunk.HasTag(ChunkRefTagPrefix+parentID) {
+		if err := repo.RemoveTag(chunkID, ChunkRefTagPrefix+parentID); err != nil {
+			return false, fmt.Errorf("failed to remove chunk reference: %w", err)
+		}
+	}
+
+	for _, referrer := range chunk.ChunkReferrers() {
+		if referrer == parentID {
+			continue
+		}
+		if isLiveReferrer(repo, referrer) {
+			return false, nil
+		}
+	}
+
+	if err := repo.Delete(chunkID); err != nil {
+		return false, fmt.Errorf("failed to delete chunk: %w", err)
+	}
+	return true, nil
+}
+
+// isLiveReferrer reports whether a referencing entity still exists and has not been purged
+func isLiveReferrer(repo EntityRepository, id string) bool {
+	entity, err := repo.GetByID(id)
+	if err != nil || entity == nil || entity.IsRecoveryPlaceholder() {
+		return false
+	}
+	return !entity.IsPurged()
+}
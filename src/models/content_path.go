@@ -0,0 +1,191 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ContentPathPrefix marks a query filter field as a path into JSON content,
+// e.g. "content.customer.country".
+const ContentPathPrefix = "content."
+
+// IsContentPathField reports whether a filter field addresses JSON content
+func IsContentPathField(field string) bool {
+	return strings.HasPrefix(field, ContentPathPrefix) && len(field) > len(ContentPathPrefix)
+}
+
+// ContentPathFromJSONPath converts a JSONPath such as "$.items[0].sku" to
+// the dot-separated content path "items.0.sku". Wildcards are rejected, as
+// a content path filter addresses a single value.
+func ContentPathFromJSONPath(expr string) (string, error) {
+	parsed, err := ParseSensitivePath(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid content path %q", expr)
+	}
+	for _, segment := range parsed.Segments {
+		if segment == "*" {
+			return "", fmt.Errorf("content path %q may not use wildcards", expr)
+		}
+		if strings.Contains(segment, ".") {
+			return "", fmt.Errorf("content path %q has a key containing '.'", expr)
+		}
+	}
+	return strings.Join(parsed.Segments, "."), nil
+}
+
+// ParseJSONContent decodes entity content holding a JSON object or array.
+// Content that does not start with '{' or '[' is not parsed.
+func ParseJSONContent(content []byte) (interface{}, bool) {
+	trimmed := strings.TrimSpace(string(content))
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil, false
+	}
+	var document interface{}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, false
+	}
+	return document, true
+}
+
+// LookupJSONPath resolves a dot-separated path such as "items.0.sku" in a
+// decoded JSON document. Numeric segments index into arrays.
+func LookupJSONPath(document interface{}, path string) (interface{}, bool) {
+	current := document
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// LookupContentPath resolves a path (without the "content." prefix) in JSON content
+func LookupContentPath(content []byte, path string) (interface{}, bool) {
+	document, ok := ParseJSONContent(content)
+	if !ok {
+		return nil, false
+	}
+	return LookupJSONPath(document, path)
+}
+
+// ContentPathValueKey returns the canonical string form of a scalar JSON
+// value, used both for comparisons and as the content path index key.
+// Objects and arrays are not scalar and return false.
+func ContentPathValueKey(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64), true
+		}
+		return v.String(), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case nil:
+		return "null", true
+	default:
+		return "", false
+	}
+}
+
+// ContentPathQueryKey normalizes a query value to the index key form so
+// "42.0" finds the number 42
+func ContentPathQueryKey(value string) string {
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return value
+}
+
+// MatchContentPath evaluates a content path filter against entity content.
+// Numbers compare numerically when the filter value is numeric, everything
+// else compares as strings. The "exists" operator matches when the path is
+// present; every other operator fails when it is missing.
+func MatchContentPath(content []byte, path, operator, value string) bool {
+	found, ok := LookupContentPath(content, path)
+	if operator == "exists" {
+		return ok
+	}
+	if !ok {
+		return false
+	}
+
+	key, scalar := ContentPathValueKey(found)
+	if !scalar {
+		encoded, err := json.Marshal(found)
+		if err != nil {
+			return false
+		}
+		key = string(encoded)
+	}
+
+	switch operator {
+	case "in":
+		for _, candidate := range strings.Split(value, ",") {
+			if compareContentValue(found, key, strings.TrimSpace(candidate)) == 0 {
+				return true
+			}
+		}
+		return false
+	case "like":
+		return strings.Contains(strings.ToLower(key), strings.ToLower(value))
+	}
+
+	cmp := compareContentValue(found, key, value)
+	switch operator {
+	case "eq":
+		return cmp == 0
+	case "ne":
+		return cmp != 0
+	case "gt":
+		return cmp > 0
+	case "lt":
+		return cmp < 0
+	case "gte":
+		return cmp >= 0
+	case "lte":
+		return cmp <= 0
+	default:
+		return false
+	}
+}
+
+// compareContentValue orders a JSON value against a query value, numerically
+// when both are numbers and lexically otherwise
+func compareContentValue(found interface{}, key, value string) int {
+	if number, ok := found.(json.Number); ok {
+		if a, err := number.Float64(); err == nil {
+			if b, err := strconv.ParseFloat(value, 64); err == nil {
+				switch {
+				case a < b:
+					return -1
+				case a > b:
+					return 1
+				default:
+					return 0
+				}
+			}
+		}
+	}
+	return strings.Compare(key, value)
+}
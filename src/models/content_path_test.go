@@ -0,0 +1,43 @@
+package models_test
+
+import (
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestContentPathFromJSONPath checks the conversion of JSONPaths to content
+// filter paths
+func TestContentPathFromJSONPath(t *testing.T) {
+	valid := map[string]string{
+		"$.customer.country":  "customer.country",
+		"$.items[0].sku":      "items.0.sku",
+		"$['order']['total']": "order.total",
+		"customer.country":    "customer.country",
+	}
+	for expr, want := range valid {
+		got, err := models.ContentPathFromJSONPath(expr)
+		if err != nil {
+			t.Errorf("ContentPathFromJSONPath(%q): %v", expr, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ContentPathFromJSONPath(%q) = %q, want %q", expr, got, want)
+		}
+	}
+
+	for _, expr := range []string{"$", "$.items[*].sku", "$.*", "$.a[0", "$['a.b']", "$..name"} {
+		if got, err := models.ContentPathFromJSONPath(expr); err == nil {
+			t.Errorf("ContentPathFromJSONPath(%q) = %q, want an error", expr, got)
+		}
+	}
+
+	content := []byte(`{"items":[{"sku":"A-1"}]}`)
+	path, err := models.ContentPathFromJSONPath("$.items[0].sku")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !models.MatchContentPath(content, path, "eq", "A-1") {
+		t.Error("converted path does not match the content")
+	}
+}
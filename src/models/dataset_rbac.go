@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Permissions granted within a single dataset are kept in user tags of the
+// form rbac:perm:<resource>:<action>:dataset:<name>. They count only when a
+// permission is checked in that dataset. dataset:admin in a dataset grants
+// every permission there, including managing the dataset permissions of
+// other users, so administration can be delegated per dataset without
+// global admin rights.
+const (
+	datasetPermissionInfix = ":dataset:"
+	rbacPermTagPrefix      = "rbac:perm:"
+)
+
+// datasetPermissionActions lists the permissions that can be granted within
+// a dataset
+var datasetPermissionActions = map[string][]string{
+	"entity":  {"view", "create", "update", "delete", "*"},
+	"dataset": {"view", "update", "admin"},
+}
+
+// ErrInvalidDatasetPermission is returned for permissions that cannot be
+// granted within a dataset
+var ErrInvalidDatasetPermission = errors.New("invalid dataset permission")
+
+// DatasetPermissionTag returns the tag granting resource:action in dataset
+func DatasetPermissionTag(resource, action, dataset string) string {
+	return rbacPermTagPrefix + resource + ":" + action + datasetPermissionInfix + dataset
+}
+
+// DatasetPermissions returns the resource:action permissions the user was
+// granted within dataset, sorted
+func DatasetPermissions(entity *Entity, dataset string) []string {
+	suffix := datasetPermissionInfix + dataset
+	var perms []string
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, rbacPermTagPrefix) && strings.HasSuffix(tag, suffix) {
+			perm := strings.TrimSuffix(strings.TrimPrefix(tag, rbacPermTagPrefix), suffix)
+			if strings.Count(perm, ":") == 1 {
+				perms = append(perms, perm)
+			}
+		}
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// hasDatasetPermission reports whether tags grant resource:action within
+// dataset, directly, through an action wildcard or through dataset:admin
+func hasDatasetPermission(tags []string, resource, action, dataset string) bool {
+	for _, tag := range tags {
+		switch tag {
+		case DatasetPermissionTag(resource, action, dataset),
+			DatasetPermissionTag(resource, "*", dataset),
+			DatasetPermissionTag("dataset", "admin", dataset):
+			return true
+		}
+	}
+	return false
+}
+
+// checkDatasetPermissions validates resource:action permissions for
+// GrantDatasetPermissions and RevokeDatasetPermissions
+func checkDatasetPermissions(dataset string, perms []string) error {
+	if !datasetNamePattern.MatchString(dataset) {
+		return fmt.Errorf("%w: dataset name %q may only use letters, digits, '.', '_' and '-'", ErrInvalidDatasetPermission, dataset)
+	}
+	if len(perms) == 0 {
+		return fmt.Errorf("%w: no permissions given", ErrInvalidDatasetPermission)
+	}
+	for _, perm := range perms {
+		resource, action, _ := strings.Cut(perm, ":")
+		valid := false
+		for _, allowed := range datasetPermissionActions[resource] {
+			if action == allowed {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("%w: %q; use entity:view, entity:create, entity:update, entity:delete, entity:*, dataset:view, dataset:update or dataset:admin", ErrInvalidDatasetPermission, perm)
+		}
+	}
+	return nil
+}
+
+// GrantDatasetPermissions grants the user resource:action permissions
+// within dataset
+func (sm *SecurityManager) GrantDatasetPermissions(userID, dataset string, perms []string) error {
+	if err := checkDatasetPermissions(dataset, perms); err != nil {
+		return err
+	}
+	return sm.updateDatasetPermissions(userID, dataset, perms, nil)
+}
+
+// RevokeDatasetPermissions removes resource:action permissions the user was
+// granted within dataset; permissions the user does not hold are ignored
+func (sm *SecurityManager) RevokeDatasetPermissions(userID, dataset string, perms []string) error {
+	if err := checkDatasetPermissions(dataset, perms); err != nil {
+		return err
+	}
+	return sm.updateDatasetPermissions(userID, dataset, nil, perms)
+}
+
+// updateDatasetPermissions adds and removes dataset permission tags of a
+// user in a single update
+func (sm *SecurityManager) updateDatasetPermissions(userID, dataset string, add, remove []string) error {
+	entity, err := sm.entityRepo.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	drop := make(map[string]bool, len(remove)+len(add))
+	for _, perm := range append(remove, add...) {
+		resource, action, _ := strings.Cut(perm, ":")
+		drop[DatasetPermissionTag(resource, action, dataset)] = true
+	}
+	kept := make([]string, 0, len(entity.Tags)+len(add))
+	for _, tag := range entity.Tags {
+		if !drop[stripTagTimestamp(tag)] {
+			kept = append(kept, tag)
+		}
+	}
+
+	updated := entity.WithTags(kept)
+	for _, perm := range add {
+		resource, action, _ := strings.Cut(perm, ":")
+		updated.AddTag(DatasetPermissionTag(resource, action, dataset))
+	}
+	if err := sm.entityRepo.Update(updated); err != nil {
+		return fmt.Errorf("failed to update dataset permissions: %w", err)
+	}
+	return nil
+}
+
+// DatasetPermissionHolders returns the users holding permissions within
+// dataset
+func (sm *SecurityManager) DatasetPermissionHolders(dataset string) ([]*Entity, error) {
+	users, err := sm.entityRepo.ListByTag("type:" + EntityTypeUser)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	var holders []*Entity
+	for _, user := range users {
+		if len(DatasetPermissions(user, dataset)) > 0 {
+			holders = append(holders, user)
+		}
+	}
+	return holders, nil
+}
@@ -0,0 +1,44 @@
+package models_test
+
+import (
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestHasPermissionInDataset checks that permissions granted within a
+// dataset apply there only, and that dataset:admin grants everything there
+func TestHasPermissionInDataset(t *testing.T) {
+	sm := models.NewSecurityManager(nil)
+	entity := models.NewEntity()
+	entity.AddTag(models.DatasetPermissionTag("entity", "view", "tenant-a"))
+	entity.AddTag(models.DatasetPermissionTag("dataset", "admin", "tenant-b"))
+	user := &models.SecurityUser{ID: entity.ID, Entity: entity}
+
+	cases := []struct {
+		resource, action, dataset string
+		want                      bool
+	}{
+		{"entity", "view", "tenant-a", true},
+		{"entity", "update", "tenant-a", false},
+		{"dataset", "admin", "tenant-a", false},
+		{"entity", "view", "", false},
+		{"entity", "view", "tenant-c", false},
+		{"entity", "delete", "tenant-b", true},
+		{"dataset", "admin", "tenant-b", true},
+		{"user", "update", "", false},
+	}
+	for _, c := range cases {
+		got, err := sm.HasPermissionInDataset(user, c.resource, c.action, c.dataset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("HasPermissionInDataset(%s:%s, %q) = %v, want %v", c.resource, c.action, c.dataset, got, c.want)
+		}
+	}
+
+	if perms := models.DatasetPermissions(entity, "tenant-b"); len(perms) != 1 || perms[0] != "dataset:admin" {
+		t.Errorf("DatasetPermissions(tenant-b) = %v", perms)
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"strings"
+)
+
+// SystemDataset holds the dataset entities, whose tags and settings publish,
+// freeze, re-quota and set the durability of the dataset each one names,
+// along with users and other system entities. The dataset endpoints write
+// dataset records; the generic entity endpoints may only touch system
+// dataset entities for users who may update datasets.
+const SystemDataset = "system"
+
+// isDatasetRecordTag reports whether a tag, with or without its timestamp,
+// makes an entity a dataset entity or places it in the system dataset
+func isDatasetRecordTag(tag string) bool {
+	if idx := strings.LastIndex(tag, "|"); idx >= 0 {
+		tag = tag[idx+1:]
+	}
+	return tag == "type:dataset" || tag == "dataset:"+SystemDataset
+}
+
+// WritesDatasetRecord reports whether a write involving the tag sets, such
+// as an entity's current tags and the tags a write gives it, creates or
+// changes a dataset entity or another system dataset entity
+func WritesDatasetRecord(tagSets ...[]string) bool {
+	for _, tags := range tagSets {
+		for _, tag := range tags {
+			if isDatasetRecordTag(tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanManageDatasets reports whether the user may write dataset entities and
+// other system dataset entities outside the dataset endpoints: admins and
+// users granted dataset:update
+func CanManageDatasets(user *SecurityUser) bool {
+	if user == nil || user.Entity == nil {
+		return false
+	}
+	for _, tag := range user.Entity.GetTagsWithoutTimestamp() {
+		switch tag {
+		case "rbac:role:admin", "rbac:perm:*", "rbac:perm:*:*", "rbac:perm:dataset:*", "rbac:perm:dataset:update":
+			return true
+		}
+	}
+	return false
+}
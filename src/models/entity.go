@@ -113,8 +113,8 @@ type EntityRepository interface {
 	// The tag is automatically timestamped by the storage layer.
 	AddTag(id string, tag string) error
 	
-	// RemoveTag removes all instances of a tag from an entity.
-	// Handles temporal tags by matching the tag content.
+	// RemoveTag removes a tag, as stored with its timestamp, from an entity.
+	// Chunk reference tags are matched by their content.
 	RemoveTag(id string, tag string) error
 	
 	// Temporal Operations
@@ -225,22 +225,33 @@ type Entity struct {
 // EntityChange represents a single change event in an entity's history.
 // Used for audit trails, history queries, and change tracking.
 type EntityChange struct {
-	// Type of change: "added", "modified", "removed"
+	// Type of change: ChangeTagAdded, ChangeTagRemoved or ChangeContentUpdated
+	// in entity history; "added", "modified" or "removed" from CompareEntityStates
 	Type      string `json:"type"`
 	
 	// Timestamp when the change occurred (nanosecond epoch)
 	Timestamp int64  `json:"timestamp"`
 	
-	// OldValue contains the previous value (for modifications and removals)
+	// OldValue contains the previous value (for modifications and removals).
+	// For an added tag it is the tag it replaced as its namespace's current
+	// value, and for content the sha256 digest of the previous content.
 	OldValue  string `json:"old_value,omitempty"`
 	
-	// NewValue contains the new value (for additions and modifications)
+	// NewValue contains the new value (for additions and modifications), for
+	// content the sha256 digest of the new content
 	NewValue  string `json:"new_value,omitempty"`
 	
 	// EntityID references the entity this change belongs to
 	EntityID  string `json:"entity_id,omitempty"`
 }
 
+// Change types recorded in entity history
+const (
+	ChangeTagAdded       = "tag_added"
+	ChangeTagRemoved     = "tag_removed"
+	ChangeContentUpdated = "content_updated"
+)
+
 // ChunkConfig configures the autochunking behavior for large content.
 // When content exceeds the threshold, it's automatically split into chunks
 // for efficient storage and retrieval.
@@ -387,6 +398,19 @@ func (e *Entity) GetTagsWithoutTimestamp() []string {
 	return result
 }
 
+// StoredTags returns every instance of tag as stored on the entity, with its
+// timestamp. RemoveTag matches stored tags exactly, so removing a tag by its
+// content removes each of these.
+func (e *Entity) StoredTags(tag string) []string {
+	var stored []string
+	for _, t := range e.Tags {
+		if t == tag || t[strings.LastIndex(t, "|")+1:] == tag {
+			stored = append(stored, t)
+		}
+	}
+	return stored
+}
+
 // GetCurrentTags returns only the most recent value for each tag namespace
 // This provides the current state of the entity by deduplicating tags
 func (e *Entity) GetCurrentTags() []string {
@@ -598,6 +622,19 @@ func (e *Entity) AppendTag(tag string) {
 	e.invalidateTagValueCache()
 }
 
+// WithTags returns a copy of the entity with tags in place of its own. The
+// repository cache holds the entities it returns, so updates are made to a
+// copy: the cached entity must not change before the update is written.
+func (e *Entity) WithTags(tags []string) *Entity {
+	return &Entity{
+		ID:        e.ID,
+		Tags:      tags,
+		Content:   e.Content,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+}
+
 // SetContent sets content with automatic chunking if needed
 func (e *Entity) SetContent(reader io.Reader, mimeType string, config ChunkConfig) ([]string, error) {
 	// First, determine the size
@@ -644,16 +681,20 @@ func (e *Entity) SetContent(reader io.Reader, mimeType string, config ChunkConfi
 	e.AddTag(fmt.Sprintf("content:chunk-size:%d", config.DefaultChunkSize))
 	e.Content = nil // Master entity has no content
 	
-	// Create chunk entity IDs
+	// Chunks are content-addressed so identical data is stored once
 	chunkIDs := make([]string, len(chunks))
-	for i := range chunks {
-		chunkIDs[i] = fmt.Sprintf("%s-chunk-%d", e.ID, i)
+	for i, chunk := range chunks {
+		checksum := calculateChecksum(chunk)
+		e.AddTag(fmt.Sprintf("%s%d:%s", ChunkHashTagPrefix, i, checksum))
+		chunkIDs[i] = ChunkIDForHash(checksum)
 	}
 	
 	return chunkIDs, nil
 }
 
-// CreateChunkEntity creates a chunk entity
+// CreateChunkEntity creates a chunk entity owned by a single parent.
+// New uploads use content-addressed chunks (see StoreChunk); this form
+// remains for entities chunked before deduplication was introduced.
 func CreateChunkEntity(parentID string, chunkIndex int, data []byte) *Entity {
 	entity := NewEntity()
 	entity.ID = fmt.Sprintf("%s-chunk-%d", parentID, chunkIndex)
@@ -769,6 +810,17 @@ func (e *Entity) IsSystemEntity() bool {
 	return IsSystemUser(mandatory.CreatedBy)
 }
 
+// IsRecoveryPlaceholder reports whether the entity is a placeholder produced by
+// partial recovery rather than real stored data
+func (e *Entity) IsRecoveryPlaceholder() bool {
+	for _, tag := range e.GetTagsWithoutTimestamp() {
+		if tag == "status:recovered" || tag == "recovery:placeholder" {
+			return true
+		}
+	}
+	return false
+}
+
 // GetEntityUUID returns the entity's UUID (same as ID in new architecture)
 func (e *Entity) GetEntityUUID() string {
 	return e.ID
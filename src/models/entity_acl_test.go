@@ -0,0 +1,59 @@
+package models_test
+
+import (
+	"testing"
+
+	"entitydb/models"
+)
+
+func aclUser(id, username string, tags ...string) *models.SecurityUser {
+	return &models.SecurityUser{ID: id, Username: username, Entity: &models.Entity{ID: id, Tags: tags}}
+}
+
+// TestEntityACL checks read and write decisions for entities with and
+// without ACL tags
+func TestEntityACL(t *testing.T) {
+	alice := aclUser("u1", "alice", "rbac:role:user")
+	bob := aclUser("u2", "bob", "rbac:role:user", "rbac:role:auditor")
+	carol := aclUser("u3", "carol", "rbac:role:user")
+	admin := aclUser("u4", "root", "rbac:role:admin")
+
+	open := &models.Entity{ID: "e1", Tags: []string{"type:doc"}}
+	private := &models.Entity{ID: "e2", Tags: []string{
+		"type:doc",
+		"1700000000000000000|acl:read:role:auditor",
+		"acl:write:user:u1",
+	}}
+	writersOnly := &models.Entity{ID: "e3", Tags: []string{"type:doc", "acl:write:user:alice"}}
+
+	tests := []struct {
+		name   string
+		user   *models.SecurityUser
+		entity *models.Entity
+		access models.ACLAccess
+		want   bool
+	}{
+		{"no ACL read", carol, open, models.ACLRead, true},
+		{"no ACL write", carol, open, models.ACLWrite, true},
+		{"role reader reads", bob, private, models.ACLRead, true},
+		{"role reader cannot write", bob, private, models.ACLWrite, false},
+		{"writer reads", alice, private, models.ACLRead, true},
+		{"writer writes", alice, private, models.ACLWrite, true},
+		{"unlisted user hidden", carol, private, models.ACLRead, false},
+		{"admin bypasses", admin, private, models.ACLWrite, true},
+		{"anonymous hidden", nil, private, models.ACLRead, false},
+		{"writer ACL leaves reads open", carol, writersOnly, models.ACLRead, true},
+		{"writer ACL by username", alice, writersOnly, models.ACLWrite, true},
+		{"writer ACL blocks others", carol, writersOnly, models.ACLWrite, false},
+	}
+	for _, tt := range tests {
+		if got := models.CanAccessEntity(tt.user, tt.entity, tt.access); got != tt.want {
+			t.Errorf("%s: CanAccessEntity = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	readable := models.FilterReadableEntities(carol, []*models.Entity{open, private, writersOnly})
+	if len(readable) != 2 || readable[0] != open || readable[1] != writersOnly {
+		t.Errorf("FilterReadableEntities returned %d entities, want e1 and e3", len(readable))
+	}
+}
@@ -264,36 +264,43 @@ func (el *EntityLifecycle) getMetadataForTimestamp(suffix string, timestamp int6
 
 // GetDeletedAt returns when the entity was deleted (if it has been deleted)
 func (el *EntityLifecycle) GetDeletedAt() *time.Time {
-	for _, tag := range el.entity.Tags {
-		// Parse temporal tag format: "TIMESTAMP|status:soft_deleted"
-		if strings.Contains(tag, "|status:soft_deleted") {
-			parts := strings.Split(tag, "|")
-			if len(parts) >= 2 && parts[1] == "status:soft_deleted" {
-				if timestamp, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
-					deletedAt := time.Unix(0, timestamp)
-					return &deletedAt
-				}
-			}
-		}
-	}
-	return nil
+	return el.stateEnteredAt(StateSoftDeleted)
 }
 
 // GetArchivedAt returns when the entity was archived (if it has been archived)
 func (el *EntityLifecycle) GetArchivedAt() *time.Time {
+	return el.stateEnteredAt(StateArchived)
+}
+
+// stateEnteredAt returns when the entity last entered state, read from its
+// lifecycle:state tags or, for entities written by older versions, from the
+// legacy status tags
+func (el *EntityLifecycle) stateEnteredAt(state EntityLifecycleState) *time.Time {
+	var latest int64
 	for _, tag := range el.entity.Tags {
-		// Parse temporal tag format: "TIMESTAMP|status:archived"
-		if strings.Contains(tag, "|status:archived") {
-			parts := strings.Split(tag, "|")
-			if len(parts) >= 2 && parts[1] == "status:archived" {
-				if timestamp, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
-					archivedAt := time.Unix(0, timestamp)
-					return &archivedAt
-				}
-			}
+		// Parse temporal tag format: "TIMESTAMP|lifecycle:state:value"
+		parts := strings.SplitN(tag, "|", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if parts[1] != "lifecycle:state:"+string(state) && parts[1] != "status:"+string(state) {
+			continue
+		}
+		if timestamp, err := strconv.ParseInt(parts[0], 10, 64); err == nil && timestamp > latest {
+			latest = timestamp
 		}
 	}
-	return nil
+	if latest == 0 {
+		return nil
+	}
+	at := time.Unix(0, latest)
+	return &at
+}
+
+// IsOnLegalHold reports whether the entity is under legal hold. Held
+// entities cannot change state and are never purged.
+func (el *EntityLifecycle) IsOnLegalHold() bool {
+	return el.entity.HasTag(LegalHoldTag)
 }
 
 // GetDeletionPolicy returns the deletion policy applied to this entity
@@ -0,0 +1,34 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestGetDeletedAt checks that the deletion time is read from the lifecycle
+// state tag, and from the legacy status tag of older entities
+func TestGetDeletedAt(t *testing.T) {
+	entity := models.NewEntity()
+	if deletedAt := entity.GetDeletedAt(); deletedAt != nil {
+		t.Fatalf("GetDeletedAt() of an active entity = %v, want nil", deletedAt)
+	}
+
+	before := time.Now()
+	if err := entity.Lifecycle().SoftDelete("admin", "test", ""); err != nil {
+		t.Fatal(err)
+	}
+	deletedAt := entity.GetDeletedAt()
+	if deletedAt == nil || deletedAt.Before(before) {
+		t.Fatalf("GetDeletedAt() after SoftDelete = %v, want at or after %v", deletedAt, before)
+	}
+	if archivedAt := entity.GetArchivedAt(); archivedAt != nil {
+		t.Errorf("GetArchivedAt() of a soft-deleted entity = %v, want nil", archivedAt)
+	}
+
+	legacy := &models.Entity{ID: "legacy", Tags: []string{"1700000000000000000|status:soft_deleted"}}
+	if deletedAt := legacy.GetDeletedAt(); deletedAt == nil || !deletedAt.Equal(time.Unix(0, 1700000000000000000)) {
+		t.Errorf("GetDeletedAt() of a legacy entity = %v", deletedAt)
+	}
+}
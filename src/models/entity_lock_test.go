@@ -0,0 +1,36 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestEntityLock checks that lock tags parse into a lock until it expires
+// and that updates cannot change them
+func TestEntityLock(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	lock := &models.EntityLock{EntityID: "e1", Holder: "u1", AcquiredAt: now, ExpiresAt: now.Add(time.Minute)}
+	entity := &models.Entity{ID: "e1", Tags: append([]string{"type:doc"}, lock.Tags()...)}
+
+	parsed := models.ParseEntityLock(entity, now)
+	if parsed == nil || *parsed != *lock {
+		t.Fatalf("ParseEntityLock = %+v, want %+v", parsed, lock)
+	}
+	if !parsed.HeldBy(&models.SecurityUser{ID: "u1"}) || parsed.HeldBy(&models.SecurityUser{ID: "u2"}) || parsed.HeldBy(nil) {
+		t.Error("HeldBy should only report the holder")
+	}
+	if expired := models.ParseEntityLock(entity, now.Add(time.Minute)); expired != nil {
+		t.Errorf("lock past its expiry parsed as %+v", expired)
+	}
+	if unlocked := models.ParseEntityLock(&models.Entity{ID: "e2", Tags: []string{"type:doc"}}, now); unlocked != nil {
+		t.Errorf("entity without lock tags parsed as %+v", unlocked)
+	}
+
+	tags := models.KeepLockTags(entity, []string{"type:note", "lock:holder:u2"})
+	kept := models.ParseEntityLock(&models.Entity{ID: "e1", Tags: tags}, now)
+	if len(tags) != 4 || kept == nil || kept.Holder != "u1" {
+		t.Errorf("KeepLockTags = %v, want type:note and the lock of u1", tags)
+	}
+}
@@ -47,6 +47,9 @@ type EntityQuery struct {
 	// namespace filters entities to a specific tag namespace
 	namespace string
 	
+	// dataset restricts results to a single dataset
+	dataset string
+	
 	// limit sets the maximum number of results to return
 	limit int
 	
@@ -218,6 +221,20 @@ func (q *EntityQuery) InNamespace(namespace string) *EntityQuery {
 	return q
 }
 
+// InDataset restricts results to entities in a dataset. Together with an
+// equality filter on a content path it lets repositories that implement
+// ContentPathLister answer from their content path index.
+//
+// Parameters:
+//   - dataset: The dataset name (e.g., "default")
+//
+// Returns:
+//   - *EntityQuery: The query builder for method chaining
+func (q *EntityQuery) InDataset(dataset string) *EntityQuery {
+	q.dataset = dataset
+	return q
+}
+
 // Limit sets the maximum number of results to return.
 // This is used for pagination in combination with Offset.
 // A limit of 0 or negative means no limit.
@@ -391,6 +408,12 @@ func (q *EntityQuery) Execute() ([]*Entity, error) {
 	} else if q.namespace != "" {
 		// Namespace filter
 		entities, err = q.repo.ListByNamespace(q.namespace)
+	} else if indexed, ok, indexErr := q.listByContentPathIndex(); ok {
+		// Equality on an indexed content path
+		entities, err = indexed, indexErr
+	} else if q.dataset != "" {
+		// Dataset scope
+		entities, err = q.repo.ListByTag("dataset:" + q.dataset)
 	} else {
 		// No primary filter - get all entities
 		entities, err = q.repo.List()
@@ -403,6 +426,11 @@ func (q *EntityQuery) Execute() ([]*Entity, error) {
 	// Apply additional filters in sequence
 	filtered := entities
 	
+	// Keep only entities in the requested dataset
+	if q.dataset != "" {
+		filtered = filterByDataset(filtered, q.dataset)
+	}
+	
 	// Apply multiple tag filters if needed
 	if len(q.tags) > 1 {
 		filtered = filterByTags(filtered, q.tags)
@@ -437,6 +465,49 @@ func (q *EntityQuery) Execute() ([]*Entity, error) {
 
 // Helper functions for query execution
 
+// ContentPathLister is implemented by repositories that index JSON content
+// paths. The boolean reports whether the path is indexed for the dataset.
+type ContentPathLister interface {
+	ListByContentPath(dataset, path, value string) ([]*Entity, bool, error)
+}
+
+// listByContentPathIndex looks up candidates for an equality filter on a
+// content path when every filter must match. Filters are still applied to the
+// candidates afterwards.
+func (q *EntityQuery) listByContentPathIndex() ([]*Entity, bool, error) {
+	lister, ok := q.repo.(ContentPathLister)
+	if !ok || q.dataset == "" {
+		return nil, false, nil
+	}
+	for _, operator := range q.operators {
+		if operator == "OR" {
+			return nil, false, nil
+		}
+	}
+	for _, filter := range q.filters {
+		value, isString := filter.Value.(string)
+		if filter.Operator != "eq" || !isString || !IsContentPathField(filter.Field) {
+			continue
+		}
+		path := strings.TrimPrefix(filter.Field, ContentPathPrefix)
+		if entities, indexed, err := lister.ListByContentPath(q.dataset, path, value); indexed {
+			return entities, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+// filterByDataset filters entities to those in a dataset.
+func filterByDataset(entities []*Entity, dataset string) []*Entity {
+	result := make([]*Entity, 0, len(entities))
+	for _, entity := range entities {
+		if entity.GetDataset() == dataset {
+			result = append(result, entity)
+		}
+	}
+	return result
+}
+
 // filterByTags filters entities to only those containing all specified tags.
 // This implements AND logic - an entity must have every tag in the list to be included.
 func filterByTags(entities []*Entity, tags []string) []*Entity {
@@ -585,6 +656,7 @@ func (q *EntityQuery) applyFilters(entities []*Entity) []*Entity {
 //   - "tag_count": Numeric comparison on total tag count
 //   - "content_type": Searches for content:type:* tags and compares values
 //   - "content_value": String search within entity binary content
+//   - "content.*": Path into JSON content (e.g., "content.customer.country")
 //   - "tag:*": Namespace-based tag filtering (e.g., "tag:status" matches "status:*")
 //
 // Tag Search Strategy:
@@ -635,6 +707,11 @@ func (q *EntityQuery) evaluateFilter(entity *Entity, filter Filter) bool {
 		return false
 		
 	default:
+		// Check if it's a JSON content path filter (e.g., "content.customer.country")
+		if IsContentPathField(filter.Field) {
+			value, _ := filter.Value.(string)
+			return MatchContentPath(entity.Content, strings.TrimPrefix(filter.Field, ContentPathPrefix), filter.Operator, value)
+		}
 		// Check if it's a tag namespace filter (e.g., "tag:type", "tag:status")
 		if strings.HasPrefix(filter.Field, "tag:") {
 			tagNamespace := strings.TrimPrefix(filter.Field, "tag:")
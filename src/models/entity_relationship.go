@@ -0,0 +1,99 @@
+package models
+
+import "strings"
+
+// Entities declare typed relationships to other entities with tags of the
+// form
+//
+//	rel:<type>:<target id>
+//
+// such as "rel:depends_on:4f1c...". The relationship belongs to the entity
+// carrying the tag (the source) and points at the target; the storage layer
+// indexes both ends so either side can be queried without scanning tags.
+// Relationship types may not contain ':'.
+const RelationshipTagPrefix = "rel:"
+
+// EdgeDirection selects which relationships of an entity to follow
+type EdgeDirection string
+
+const (
+	// EdgeOutgoing follows relationships declared by the entity
+	EdgeOutgoing EdgeDirection = "out"
+	// EdgeIncoming follows relationships other entities declare to it
+	EdgeIncoming EdgeDirection = "in"
+	// EdgeBoth follows relationships in either direction
+	EdgeBoth EdgeDirection = "both"
+)
+
+// ParseEdgeDirection parses "out", "in" or "both"; empty means both
+func ParseEdgeDirection(s string) (EdgeDirection, bool) {
+	switch EdgeDirection(s) {
+	case "", EdgeBoth:
+		return EdgeBoth, true
+	case EdgeOutgoing, EdgeIncoming:
+		return EdgeDirection(s), true
+	}
+	return "", false
+}
+
+// Edge is a typed relationship from a source entity to a target entity
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+// RelationshipTag builds the tag declaring a relationship to targetID
+func RelationshipTag(relType, targetID string) string {
+	return RelationshipTagPrefix + relType + ":" + targetID
+}
+
+// ParseRelationshipTag splits a relationship tag, with or without a
+// timestamp, into its type and target
+func ParseRelationshipTag(tag string) (relType, targetID string, ok bool) {
+	clean := stripTagTimestamp(tag)
+	if !strings.HasPrefix(clean, RelationshipTagPrefix) {
+		return "", "", false
+	}
+	relType, targetID, ok = strings.Cut(clean[len(RelationshipTagPrefix):], ":")
+	if !ok || relType == "" || targetID == "" {
+		return "", "", false
+	}
+	return relType, targetID, true
+}
+
+// EntityEdges returns the distinct relationships an entity declares
+func EntityEdges(entity *Entity) []Edge {
+	var edges []Edge
+	seen := make(map[Edge]bool)
+	for _, tag := range entity.Tags {
+		if !strings.Contains(tag, RelationshipTagPrefix) {
+			continue
+		}
+		relType, target, ok := ParseRelationshipTag(tag)
+		if !ok {
+			continue
+		}
+		edge := Edge{Source: entity.ID, Target: target, Type: relType}
+		if !seen[edge] {
+			seen[edge] = true
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// Matches reports whether the edge is a relationship of entityID in the
+// given direction, optionally restricted to one type
+func (e Edge) Matches(entityID string, direction EdgeDirection, relType string) bool {
+	if relType != "" && e.Type != relType {
+		return false
+	}
+	switch direction {
+	case EdgeOutgoing:
+		return e.Source == entityID
+	case EdgeIncoming:
+		return e.Target == entityID
+	}
+	return e.Source == entityID || e.Target == entityID
+}
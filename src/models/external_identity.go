@@ -0,0 +1,323 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"entitydb/logger"
+)
+
+// Users authenticated by an external identity provider carry
+// auth:provider:<provider> and identity:<provider>:<subject>. They have no
+// embedded credentials, so they cannot log in with a password unless a
+// password verifier is registered for their provider, and their RBAC tags
+// are replaced from the provider's claims on every login or sync.
+const (
+	AuthProviderTagPrefix = "auth:provider:"
+	rbacTagPrefix         = "rbac:"
+
+	// statusDeprovisioned marks users removed from their directory; unlike
+	// other inactive users they are reactivated if they return
+	statusDeprovisioned = "status:deprovisioned"
+)
+
+// ErrExternalIdentityConflict is returned when an external user's username
+// is held by a local user. Linking them automatically would let whoever
+// controls the username at the provider take over the local account.
+var ErrExternalIdentityConflict = errors.New("username belongs to a local user")
+
+// ErrUserInactive is returned for users whose status is not active
+var ErrUserInactive = errors.New("user account is not active")
+
+// ExternalIdentity is a user asserted by an external identity provider
+type ExternalIdentity struct {
+	Provider string // e.g. "oidc"
+	Subject  string // Stable user ID at the provider
+	Username string
+	Email    string
+	Roles    []string // EntityDB roles granted by the provider's claims
+}
+
+// ExternalSyncAction describes what SyncExternalUser changed
+type ExternalSyncAction string
+
+const (
+	ExternalUserCreated     ExternalSyncAction = "created"
+	ExternalUserUpdated     ExternalSyncAction = "updated"
+	ExternalUserUnchanged   ExternalSyncAction = "unchanged"
+	ExternalUserReactivated ExternalSyncAction = "reactivated"
+	ExternalUserLinked      ExternalSyncAction = "linked"
+)
+
+// ExternalPasswordVerifier checks the password of an external user against
+// its provider
+type ExternalPasswordVerifier func(user *Entity, password string) error
+
+// SetPasswordVerifier lets users of provider log in with a password checked
+// by verify
+func (sm *SecurityManager) SetPasswordVerifier(provider string, verify ExternalPasswordVerifier) {
+	if sm.passwordVerifiers == nil {
+		sm.passwordVerifiers = make(map[string]ExternalPasswordVerifier)
+	}
+	sm.passwordVerifiers[provider] = verify
+}
+
+// externalPasswordVerifier returns the verifier of a user's provider, if any
+func (sm *SecurityManager) externalPasswordVerifier(user *Entity) ExternalPasswordVerifier {
+	for _, tag := range user.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, AuthProviderTagPrefix) {
+			return sm.passwordVerifiers[strings.TrimPrefix(tag, AuthProviderTagPrefix)]
+		}
+	}
+	return nil
+}
+
+// externalSecurityUser returns the security user of an active user entity
+func externalSecurityUser(entity *Entity, username string) *SecurityUser {
+	user := &SecurityUser{ID: entity.ID, Username: username, Status: "active", Entity: entity}
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, "profile:email:") {
+			user.Email = strings.TrimPrefix(tag, "profile:email:")
+			break
+		}
+	}
+	return user
+}
+
+// RoleTags returns the RBAC tags granting a role: admin gets every
+// permission, user the permissions of users created by CreateUser, and
+// other roles only their role tag.
+func RoleTags(role string) []string {
+	switch role {
+	case "admin":
+		return []string{"rbac:role:admin", "rbac:perm:*:*"}
+	case "user":
+		return []string{"rbac:role:user", "rbac:perm:entity:view", "rbac:perm:entity:create", "rbac:perm:entity:update"}
+	}
+	return []string{"rbac:role:" + role}
+}
+
+// externalRBACTags returns the sorted, de-duplicated RBAC tags of roles
+func externalRBACTags(roles []string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, role := range roles {
+		for _, tag := range RoleTags(role) {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// ProvisionExternalUser returns the user entity of an external identity,
+// creating it on first login. Existing users get the email and RBAC tags of
+// the identity, so group changes at the provider take effect at the next
+// login.
+func (sm *SecurityManager) ProvisionExternalUser(ext ExternalIdentity) (*SecurityUser, error) {
+	user, _, err := sm.SyncExternalUser(ext, false)
+	return user, err
+}
+
+// SyncExternalUser creates or updates the user entity of an external
+// identity and reports what changed. With linkLocal, a local user holding
+// the identity's username is converted into the external user instead of
+// failing with ErrExternalIdentityConflict; its password is then checked by
+// the provider's verifier.
+func (sm *SecurityManager) SyncExternalUser(ext ExternalIdentity, linkLocal bool) (*SecurityUser, ExternalSyncAction, error) {
+	if ext.Provider == "" || ext.Subject == "" || ext.Username == "" {
+		return nil, "", fmt.Errorf("external identity requires provider, subject and username")
+	}
+	identityTag := IdentityTagPrefix + ext.Provider + ":" + ext.Subject
+	rbacTags := externalRBACTags(ext.Roles)
+
+	// Serialize with CreateUser so the identity checks cannot race
+	sm.identityMu.Lock()
+	defer sm.identityMu.Unlock()
+
+	holders, err := sm.entityRepo.ListByTag(identityTag)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to look up external user: %w", err)
+	}
+	if existing := SelectUserEntity(holders); existing != nil {
+		return sm.syncExternalUser(existing, ext, rbacTags, nil)
+	}
+
+	if err := CheckUniqueIdentity(sm.entityRepo, "", []string{UsernameTagPrefix + ext.Username}); err != nil {
+		if !errors.Is(err, ErrDuplicateIdentity) {
+			return nil, "", err
+		}
+		if linkLocal {
+			if local := sm.linkableLocalUser(ext.Username); local != nil {
+				logger.Info("Linking local user %s (%s) to %s identity %s", ext.Username, local.ID, ext.Provider, ext.Subject)
+				user, _, err := sm.syncExternalUser(local, ext, rbacTags, []string{identityTag, AuthProviderTagPrefix + ext.Provider})
+				return user, ExternalUserLinked, err
+			}
+		}
+		return nil, "", fmt.Errorf("%w: %s", ErrExternalIdentityConflict, ext.Username)
+	}
+
+	tags := []string{
+		UsernameTagPrefix + ext.Username,
+		identityTag,
+		"name:" + ext.Username,
+		"status:active",
+		AuthProviderTagPrefix + ext.Provider,
+	}
+	if ext.Email != "" {
+		tags = append(tags, "profile:email:"+ext.Email)
+	}
+	tags = append(tags, rbacTags...)
+
+	entity, err := NewEntityWithMandatoryTags(EntityTypeUser, "system", SystemUserID, tags)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create user entity structure: %w", err)
+	}
+	if err := sm.entityRepo.Create(entity); err != nil {
+		return nil, "", fmt.Errorf("failed to create user entity: %w", err)
+	}
+	logger.Info("Provisioned %s user %s (%s) with roles %v", ext.Provider, ext.Username, entity.ID, ext.Roles)
+
+	return &SecurityUser{
+		ID:       entity.ID,
+		Username: ext.Username,
+		Email:    ext.Email,
+		Status:   "active",
+		Entity:   entity,
+	}, ExternalUserCreated, nil
+}
+
+// linkableLocalUser returns the local user holding a username, or nil when
+// the username belongs to another external user
+func (sm *SecurityManager) linkableLocalUser(username string) *Entity {
+	holders, err := sm.entityRepo.ListByTag(UsernameTagPrefix + username)
+	if err != nil {
+		return nil
+	}
+	user := SelectUserEntity(holders)
+	if user == nil {
+		return nil
+	}
+	for _, tag := range user.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, AuthProviderTagPrefix) {
+			return nil
+		}
+	}
+	return user
+}
+
+// syncExternalUser applies the identity's email and RBAC tags, plus any
+// extra tags, to an existing user. Users deprovisioned by a directory sync
+// are reactivated; other inactive users are rejected.
+func (sm *SecurityManager) syncExternalUser(entity *Entity, ext ExternalIdentity, rbacTags, extraTags []string) (*SecurityUser, ExternalSyncAction, error) {
+	reactivate := entity.HasTag(statusDeprovisioned)
+	if !reactivate && !entity.HasTag("status:active") {
+		return nil, "", ErrUserInactive
+	}
+
+	var currentRBAC []string
+	email := ""
+	kept := make([]string, 0, len(entity.Tags))
+	for _, tag := range entity.Tags {
+		clean := stripTagTimestamp(tag)
+		switch {
+		case strings.HasPrefix(clean, rbacTagPrefix):
+			currentRBAC = append(currentRBAC, clean)
+			continue
+		case strings.HasPrefix(clean, "profile:email:"):
+			email = strings.TrimPrefix(clean, "profile:email:")
+			if ext.Email != "" {
+				continue
+			}
+		case reactivate && strings.HasPrefix(clean, "status:"):
+			continue
+		}
+		kept = append(kept, tag)
+	}
+	sort.Strings(currentRBAC)
+
+	username := ext.Username
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, UsernameTagPrefix) {
+			username = strings.TrimPrefix(tag, UsernameTagPrefix)
+			break
+		}
+	}
+
+	if !reactivate && len(extraTags) == 0 &&
+		strings.Join(currentRBAC, ",") == strings.Join(rbacTags, ",") && (ext.Email == "" || ext.Email == email) {
+		return &SecurityUser{ID: entity.ID, Username: username, Email: email, Status: "active", Entity: entity}, ExternalUserUnchanged, nil
+	}
+
+	updated := entity.WithTags(kept)
+	if reactivate {
+		updated.AddTag("status:active")
+	}
+	if ext.Email != "" {
+		updated.AddTag("profile:email:" + ext.Email)
+		email = ext.Email
+	}
+	for _, tag := range append(extraTags, rbacTags...) {
+		updated.AddTag(tag)
+	}
+	if err := sm.entityRepo.Update(updated); err != nil {
+		return nil, "", fmt.Errorf("failed to update external user: %w", err)
+	}
+	sm.ForgetUserSessions(entity.ID)
+
+	action := ExternalUserUpdated
+	if reactivate {
+		action = ExternalUserReactivated
+	}
+	logger.Info("Updated %s user %s (%s): %s, roles %v", ext.Provider, username, entity.ID, action, ext.Roles)
+
+	return &SecurityUser{ID: entity.ID, Username: username, Email: email, Status: "active", Entity: updated}, action, nil
+}
+
+// ListExternalUsers returns the users of a provider
+func (sm *SecurityManager) ListExternalUsers(provider string) ([]*Entity, error) {
+	entities, err := sm.entityRepo.ListByTag(AuthProviderTagPrefix + provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s users: %w", provider, err)
+	}
+	users := make([]*Entity, 0, len(entities))
+	for _, entity := range entities {
+		if entity.HasTag("type:" + EntityTypeUser) {
+			users = append(users, entity)
+		}
+	}
+	return users, nil
+}
+
+// DeprovisionExternalUser deactivates an external user removed from its
+// directory and revokes its sessions. The user is reactivated if a later
+// sync finds it again.
+func (sm *SecurityManager) DeprovisionExternalUser(entity *Entity) error {
+	sm.identityMu.Lock()
+	defer sm.identityMu.Unlock()
+
+	updated := &Entity{
+		ID:        entity.ID,
+		Content:   entity.Content,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+	}
+	for _, tag := range entity.Tags {
+		if !strings.HasPrefix(stripTagTimestamp(tag), "status:") {
+			updated.Tags = append(updated.Tags, tag)
+		}
+	}
+	updated.AddTag(statusDeprovisioned)
+	if err := sm.entityRepo.Update(updated); err != nil {
+		return fmt.Errorf("failed to deprovision user: %w", err)
+	}
+	if _, err := sm.RevokeUserSessions(entity.ID); err != nil {
+		return fmt.Errorf("user deprovisioned but revoking sessions failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Entities are located with tags in the geo namespace, either as
+// coordinates in decimal degrees or as a geohash:
+//
+//	geo:lat:52.3731
+//	geo:lon:4.8922
+//	geo:hash:u173zq
+//
+// When both forms are present the coordinates win, being the more precise.
+const (
+	GeoLatTagPrefix  = "geo:lat:"
+	GeoLonTagPrefix  = "geo:lon:"
+	GeoHashTagPrefix = "geo:hash:"
+)
+
+// earthRadiusMeters is the mean radius of the Earth
+const earthRadiusMeters = 6371008.8
+
+// geohashAlphabet is the base32 alphabet of geohashes
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// GeoPoint is a location in decimal degrees
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Valid reports whether the point lies within the coordinate ranges
+func (p GeoPoint) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// GeoBounds is a bounding box. A box crossing the antimeridian has a
+// MinLon greater than its MaxLon.
+type GeoBounds struct {
+	MinLat float64 `json:"min_lat"`
+	MinLon float64 `json:"min_lon"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLon float64 `json:"max_lon"`
+}
+
+// ParseGeoBBox parses a GeoJSON-ordered bounding box "west,south,east,north"
+func ParseGeoBBox(value string) (GeoBounds, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return GeoBounds{}, fmt.Errorf("bbox must be west,south,east,north")
+	}
+	var coords [4]float64
+	for i, part := range parts {
+		coord, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return GeoBounds{}, fmt.Errorf("bbox coordinate %q is not a number", part)
+		}
+		coords[i] = coord
+	}
+	bounds := GeoBounds{MinLon: coords[0], MinLat: coords[1], MaxLon: coords[2], MaxLat: coords[3]}
+	if !(GeoPoint{Lat: bounds.MinLat, Lon: bounds.MinLon}).Valid() || !(GeoPoint{Lat: bounds.MaxLat, Lon: bounds.MaxLon}).Valid() {
+		return GeoBounds{}, fmt.Errorf("bbox coordinates are out of range")
+	}
+	if bounds.MinLat > bounds.MaxLat {
+		return GeoBounds{}, fmt.Errorf("bbox south must not exceed north")
+	}
+	return bounds, nil
+}
+
+// Contains reports whether a point lies within the box
+func (b GeoBounds) Contains(p GeoPoint) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return p.Lon >= b.MinLon && p.Lon <= b.MaxLon
+	}
+	return p.Lon >= b.MinLon || p.Lon <= b.MaxLon
+}
+
+// Split returns the box as boxes that do not cross the antimeridian
+func (b GeoBounds) Split() []GeoBounds {
+	if b.MinLon <= b.MaxLon {
+		return []GeoBounds{b}
+	}
+	return []GeoBounds{
+		{MinLat: b.MinLat, MinLon: b.MinLon, MaxLat: b.MaxLat, MaxLon: 180},
+		{MinLat: b.MinLat, MinLon: -180, MaxLat: b.MaxLat, MaxLon: b.MaxLon},
+	}
+}
+
+// GeoRadiusBounds returns a box enclosing the circle of a radius around a
+// point
+func GeoRadiusBounds(center GeoPoint, radiusMeters float64) GeoBounds {
+	dLat := radiusMeters / earthRadiusMeters * 180 / math.Pi
+	bounds := GeoBounds{
+		MinLat: math.Max(center.Lat-dLat, -90),
+		MaxLat: math.Min(center.Lat+dLat, 90),
+		MinLon: -180,
+		MaxLon: 180,
+	}
+	// The circle is widest at its edge nearest a pole; reaching the pole it
+	// covers every longitude
+	if edge := math.Abs(center.Lat) + dLat; edge < 90 {
+		if dLon := dLat / math.Cos(edge*math.Pi/180); dLon < 180 {
+			bounds.MinLon = normalizeLon(center.Lon - dLon)
+			bounds.MaxLon = normalizeLon(center.Lon + dLon)
+		}
+	}
+	return bounds
+}
+
+// normalizeLon wraps a longitude into [-180, 180]
+func normalizeLon(lon float64) float64 {
+	for lon < -180 {
+		lon += 360
+	}
+	for lon > 180 {
+		lon -= 360
+	}
+	return lon
+}
+
+// GeoDistanceMeters returns the great-circle distance between two points
+func GeoDistanceMeters(a, b GeoPoint) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// EncodeGeohash returns the geohash of a point with precision characters
+func EncodeGeohash(p GeoPoint, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	bit, ch, even := 0, 0, true
+	for len(hash) < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if p.Lon >= mid {
+				ch |= 1 << (4 - bit)
+				lonRange[0] = mid
+			} else {
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if p.Lat >= mid {
+				ch |= 1 << (4 - bit)
+				latRange[0] = mid
+			} else {
+				latRange[1] = mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			hash = append(hash, geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// DecodeGeohash returns the center of a geohash cell
+func DecodeGeohash(hash string) (GeoPoint, error) {
+	if hash == "" {
+		return GeoPoint{}, fmt.Errorf("empty geohash")
+	}
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	even := true
+	for _, c := range strings.ToLower(hash) {
+		value := strings.IndexRune(geohashAlphabet, c)
+		if value < 0 {
+			return GeoPoint{}, fmt.Errorf("invalid geohash %q", hash)
+		}
+		for bit := 4; bit >= 0; bit-- {
+			r := &latRange
+			if even {
+				r = &lonRange
+			}
+			mid := (r[0] + r[1]) / 2
+			if value&(1<<bit) != 0 {
+				r[0] = mid
+			} else {
+				r[1] = mid
+			}
+			even = !even
+		}
+	}
+	return GeoPoint{Lat: (latRange[0] + latRange[1]) / 2, Lon: (lonRange[0] + lonRange[1]) / 2}, nil
+}
+
+// GeohashCellSize returns the height and width in degrees of the geohash
+// cells of a precision
+func GeohashCellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lonBits))
+}
+
+// GeoLocation returns the location of an entity from its geo tags. The most
+// recently added value of each tag wins.
+func GeoLocation(entity *Entity) (GeoPoint, bool) {
+	var lat, lon, hash string
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		switch {
+		case strings.HasPrefix(tag, GeoLatTagPrefix):
+			lat = strings.TrimPrefix(tag, GeoLatTagPrefix)
+		case strings.HasPrefix(tag, GeoLonTagPrefix):
+			lon = strings.TrimPrefix(tag, GeoLonTagPrefix)
+		case strings.HasPrefix(tag, GeoHashTagPrefix):
+			hash = strings.TrimPrefix(tag, GeoHashTagPrefix)
+		}
+	}
+	return ParseGeoLocation(lat, lon, hash)
+}
+
+// ParseGeoLocation builds a location from geo tag values: the coordinates
+// when both are valid, else the center of the geohash
+func ParseGeoLocation(lat, lon, hash string) (GeoPoint, bool) {
+	if lat != "" && lon != "" {
+		latValue, latErr := strconv.ParseFloat(lat, 64)
+		lonValue, lonErr := strconv.ParseFloat(lon, 64)
+		point := GeoPoint{Lat: latValue, Lon: lonValue}
+		if latErr == nil && lonErr == nil && point.Valid() {
+			return point, true
+		}
+	}
+	if hash != "" {
+		if point, err := DecodeGeohash(hash); err == nil {
+			return point, true
+		}
+	}
+	return GeoPoint{}, false
+}
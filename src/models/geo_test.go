@@ -0,0 +1,113 @@
+package models_test
+
+import (
+	"math"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestGeohash checks geohash encoding against known hashes and decoding
+// back to the cell
+func TestGeohash(t *testing.T) {
+	known := map[string]models.GeoPoint{
+		"u4pruydqqvj": {Lat: 57.64911, Lon: 10.40744},
+		"ezs42":       {Lat: 42.6, Lon: -5.6},
+	}
+	for want, point := range known {
+		if got := models.EncodeGeohash(point, len(want)); got != want {
+			t.Errorf("EncodeGeohash(%v) = %q, want %q", point, got, want)
+		}
+		center, err := models.DecodeGeohash(want)
+		if err != nil {
+			t.Fatalf("DecodeGeohash(%q): %v", want, err)
+		}
+		height, width := models.GeohashCellSize(len(want))
+		if math.Abs(center.Lat-point.Lat) > height || math.Abs(center.Lon-point.Lon) > width {
+			t.Errorf("DecodeGeohash(%q) = %v, want near %v", want, center, point)
+		}
+	}
+	if _, err := models.DecodeGeohash("u4pa"); err == nil {
+		t.Error("DecodeGeohash accepted a hash outside the alphabet")
+	}
+}
+
+// TestGeoBounds checks bounding box parsing and containment, including boxes
+// crossing the antimeridian
+func TestGeoBounds(t *testing.T) {
+	bounds, err := models.ParseGeoBBox("4.7,52.2,5.1,52.5")
+	if err != nil {
+		t.Fatalf("ParseGeoBBox: %v", err)
+	}
+	if !bounds.Contains(models.GeoPoint{Lat: 52.37, Lon: 4.89}) {
+		t.Error("box does not contain a point inside it")
+	}
+	if bounds.Contains(models.GeoPoint{Lat: 51.92, Lon: 4.48}) {
+		t.Error("box contains a point outside it")
+	}
+
+	pacific, err := models.ParseGeoBBox("170,-20,-170,20")
+	if err != nil {
+		t.Fatalf("ParseGeoBBox: %v", err)
+	}
+	if !pacific.Contains(models.GeoPoint{Lat: 0, Lon: 179}) || !pacific.Contains(models.GeoPoint{Lat: 0, Lon: -179}) {
+		t.Error("antimeridian box does not contain points on either side")
+	}
+	if pacific.Contains(models.GeoPoint{Lat: 0, Lon: 0}) {
+		t.Error("antimeridian box contains the prime meridian")
+	}
+	if parts := pacific.Split(); len(parts) != 2 {
+		t.Errorf("Split returned %d boxes, want 2", len(parts))
+	}
+
+	for _, bbox := range []string{"1,2,3", "a,0,1,1", "0,10,1,5", "0,0,190,1"} {
+		if _, err := models.ParseGeoBBox(bbox); err == nil {
+			t.Errorf("ParseGeoBBox(%q) succeeded, want an error", bbox)
+		}
+	}
+}
+
+// TestGeoRadius checks distances and that the radius box encloses the circle
+func TestGeoRadius(t *testing.T) {
+	amsterdam := models.GeoPoint{Lat: 52.3731, Lon: 4.8922}
+	rotterdam := models.GeoPoint{Lat: 51.9244, Lon: 4.4777}
+	if d := models.GeoDistanceMeters(amsterdam, rotterdam); d < 56000 || d > 59000 {
+		t.Errorf("GeoDistanceMeters = %.0f, want about 57500", d)
+	}
+
+	bounds := models.GeoRadiusBounds(amsterdam, 60000)
+	if !bounds.Contains(rotterdam) {
+		t.Error("radius box does not contain a point within the radius")
+	}
+	// Near the antimeridian the box wraps
+	wrapped := models.GeoRadiusBounds(models.GeoPoint{Lat: 0, Lon: 179.9}, 50000)
+	if wrapped.MinLon <= wrapped.MaxLon {
+		t.Errorf("radius box %v does not wrap the antimeridian", wrapped)
+	}
+}
+
+// TestGeoLocation checks that coordinates win over geohashes and that the
+// latest tag wins
+func TestGeoLocation(t *testing.T) {
+	entity := &models.Entity{Tags: []string{
+		"1|geo:hash:u173zq",
+		"2|geo:lat:10",
+		"3|geo:lon:20",
+		"4|geo:lat:52.3731",
+		"5|geo:lon:4.8922",
+	}}
+	point, ok := models.GeoLocation(entity)
+	if !ok || point != (models.GeoPoint{Lat: 52.3731, Lon: 4.8922}) {
+		t.Errorf("GeoLocation = %v %v, want the latest coordinates", point, ok)
+	}
+
+	entity = &models.Entity{Tags: []string{"1|geo:hash:u173zq", "2|geo:lat:91", "3|geo:lon:4"}}
+	point, ok = models.GeoLocation(entity)
+	if !ok || models.EncodeGeohash(point, 6) != "u173zq" {
+		t.Errorf("GeoLocation = %v %v, want the geohash cell center", point, ok)
+	}
+
+	if _, ok := models.GeoLocation(&models.Entity{Tags: []string{"1|type:place"}}); ok {
+		t.Error("GeoLocation located an entity without geo tags")
+	}
+}
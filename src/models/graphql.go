@@ -0,0 +1,1072 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// GraphQL query documents. The parser covers the executable part of the
+// language served by the /graphql endpoint: operations with variables,
+// fields with aliases and arguments, fragments and directives. Type system
+// definitions are rejected.
+
+// graphqlMaxNesting caps how deeply selection sets and values may nest, so
+// a hostile document cannot exhaust the parser's stack
+const graphqlMaxNesting = 64
+
+// GraphQLValueKind is the kind of a value literal
+type GraphQLValueKind int
+
+const (
+	GraphQLVariable GraphQLValueKind = iota
+	GraphQLInt
+	GraphQLFloat
+	GraphQLString
+	GraphQLBoolean
+	GraphQLNull
+	GraphQLEnum
+	GraphQLList
+	GraphQLObject
+)
+
+// GraphQLValue is a value literal. Text holds the variable name, the
+// decoded string, or the literal as written for the other scalars.
+type GraphQLValue struct {
+	Kind   GraphQLValueKind
+	Text   string
+	List   []*GraphQLValue
+	Fields []GraphQLArgument
+}
+
+// GraphQLArgument is a named value: a field or directive argument, or a
+// field of an object value
+type GraphQLArgument struct {
+	Name  string
+	Value *GraphQLValue
+}
+
+// GraphQLDirective is a directive such as @include(if: $flag)
+type GraphQLDirective struct {
+	Name      string
+	Arguments []GraphQLArgument
+}
+
+// GraphQLSelectionKind is the kind of an entry of a selection set
+type GraphQLSelectionKind int
+
+const (
+	GraphQLField GraphQLSelectionKind = iota
+	GraphQLFragmentSpread
+	GraphQLInlineFragment
+)
+
+// GraphQLSelection is a field, a fragment spread (Name is the fragment) or
+// an inline fragment (TypeCondition is optional)
+type GraphQLSelection struct {
+	Kind          GraphQLSelectionKind
+	Alias         string
+	Name          string
+	Arguments     []GraphQLArgument
+	TypeCondition string
+	Directives    []GraphQLDirective
+	SelectionSet  []*GraphQLSelection
+	Line, Column  int
+}
+
+// ResponseKey returns the key of a field in the response: its alias, or
+// its name without one
+func (s *GraphQLSelection) ResponseKey() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+// Argument returns the value of a named argument, or nil
+func (s *GraphQLSelection) Argument(name string) *GraphQLValue {
+	for _, arg := range s.Arguments {
+		if arg.Name == name {
+			return arg.Value
+		}
+	}
+	return nil
+}
+
+// GraphQLVariableDefinition declares a variable of an operation. Type is
+// the type as written, e.g. "[String!]!".
+type GraphQLVariableDefinition struct {
+	Name    string
+	Type    string
+	Default *GraphQLValue
+}
+
+// GraphQLOperation is a query, mutation or subscription
+type GraphQLOperation struct {
+	Type         string
+	Name         string
+	Variables    []GraphQLVariableDefinition
+	Directives   []GraphQLDirective
+	SelectionSet []*GraphQLSelection
+}
+
+// GraphQLFragment is a named fragment definition
+type GraphQLFragment struct {
+	Name          string
+	TypeCondition string
+	Directives    []GraphQLDirective
+	SelectionSet  []*GraphQLSelection
+}
+
+// GraphQLDocument is a parsed query document
+type GraphQLDocument struct {
+	Operations []*GraphQLOperation
+	Fragments  map[string]*GraphQLFragment
+}
+
+// Operation returns the operation to execute: the one named, or the only
+// operation of the document when name is empty
+func (d *GraphQLDocument) Operation(name string) (*GraphQLOperation, error) {
+	if name == "" {
+		if len(d.Operations) != 1 {
+			return nil, fmt.Errorf("document defines %d operations; operationName is required", len(d.Operations))
+		}
+		return d.Operations[0], nil
+	}
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// VariableValues applies the operation's variable defaults to the values
+// supplied with a request and checks that non-null variables are set
+func (op *GraphQLOperation) VariableValues(input map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(op.Variables))
+	for _, def := range op.Variables {
+		value, ok := input[def.Name]
+		if !ok && def.Default != nil {
+			var err error
+			if value, err = def.Default.Resolve(nil); err != nil {
+				return nil, err
+			}
+			ok = true
+		}
+		if value == nil && strings.HasSuffix(def.Type, "!") {
+			return nil, fmt.Errorf("variable $%s of type %s must not be null", def.Name, def.Type)
+		}
+		if ok {
+			values[def.Name] = value
+		}
+	}
+	return values, nil
+}
+
+// Resolve converts a value to Go: int64, float64, string, bool, nil,
+// []interface{} or map[string]interface{}. Enum values become strings and
+// variables are looked up, an unset variable resolving to nil.
+func (v *GraphQLValue) Resolve(variables map[string]interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch v.Kind {
+	case GraphQLVariable:
+		return variables[v.Text], nil
+	case GraphQLInt:
+		n, err := strconv.ParseInt(v.Text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("integer %s is out of range", v.Text)
+		}
+		return n, nil
+	case GraphQLFloat:
+		f, err := strconv.ParseFloat(v.Text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("float %s is out of range", v.Text)
+		}
+		return f, nil
+	case GraphQLString, GraphQLEnum:
+		return v.Text, nil
+	case GraphQLBoolean:
+		return v.Text == "true", nil
+	case GraphQLList:
+		list := make([]interface{}, len(v.List))
+		for i, item := range v.List {
+			value, err := item.Resolve(variables)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case GraphQLObject:
+		object := make(map[string]interface{}, len(v.Fields))
+		for _, field := range v.Fields {
+			value, err := field.Value.Resolve(variables)
+			if err != nil {
+				return nil, err
+			}
+			object[field.Name] = value
+		}
+		return object, nil
+	default:
+		return nil, nil
+	}
+}
+
+// CollectFields flattens a selection set of an object type into its
+// fields: fragments whose type condition matches are expanded, @skip and
+// @include are applied, and fields sharing a response key are merged into
+// one with their selection sets combined.
+func (d *GraphQLDocument) CollectFields(typeName string, set []*GraphQLSelection, variables map[string]interface{}) ([]*GraphQLSelection, error) {
+	var fields []*GraphQLSelection
+	byKey := make(map[string]*GraphQLSelection)
+	if err := d.collectFields(typeName, set, variables, make(map[string]bool), &fields, byKey); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func (d *GraphQLDocument) collectFields(typeName string, set []*GraphQLSelection, variables map[string]interface{},
+	visited map[string]bool, fields *[]*GraphQLSelection, byKey map[string]*GraphQLSelection) error {
+	for _, selection := range set {
+		include, err := graphqlIncluded(selection.Directives, variables)
+		if err != nil {
+			return err
+		}
+		if !include {
+			continue
+		}
+
+		switch selection.Kind {
+		case GraphQLField:
+			key := selection.ResponseKey()
+			existing, ok := byKey[key]
+			if !ok {
+				byKey[key] = selection
+				*fields = append(*fields, selection)
+				continue
+			}
+			if existing.Name != selection.Name {
+				return fmt.Errorf("fields %s and %s both use the response key %q", existing.Name, selection.Name, key)
+			}
+			if len(selection.SelectionSet) > 0 {
+				merged := *existing
+				merged.SelectionSet = append(append([]*GraphQLSelection{}, existing.SelectionSet...), selection.SelectionSet...)
+				byKey[key] = &merged
+				for i, field := range *fields {
+					if field == existing {
+						(*fields)[i] = &merged
+					}
+				}
+			}
+		case GraphQLInlineFragment:
+			if selection.TypeCondition != "" && selection.TypeCondition != typeName {
+				continue
+			}
+			if err := d.collectFields(typeName, selection.SelectionSet, variables, visited, fields, byKey); err != nil {
+				return err
+			}
+		case GraphQLFragmentSpread:
+			if visited[selection.Name] {
+				continue
+			}
+			visited[selection.Name] = true
+			fragment, ok := d.Fragments[selection.Name]
+			if !ok {
+				return fmt.Errorf("unknown fragment %q", selection.Name)
+			}
+			if fragment.TypeCondition != typeName {
+				continue
+			}
+			if err := d.collectFields(typeName, fragment.SelectionSet, variables, visited, fields, byKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// graphqlIncluded evaluates the @skip and @include directives
+func graphqlIncluded(directives []GraphQLDirective, variables map[string]interface{}) (bool, error) {
+	for _, directive := range directives {
+		if directive.Name != "skip" && directive.Name != "include" {
+			return false, fmt.Errorf("unknown directive @%s", directive.Name)
+		}
+		var condition *GraphQLValue
+		for _, arg := range directive.Arguments {
+			if arg.Name == "if" {
+				condition = arg.Value
+			}
+		}
+		value, err := condition.Resolve(variables)
+		if err != nil {
+			return false, err
+		}
+		flag, ok := value.(bool)
+		if !ok {
+			return false, fmt.Errorf("@%s requires a Boolean if argument", directive.Name)
+		}
+		if flag == (directive.Name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ParseGraphQL parses a query document
+func ParseGraphQL(source string) (*GraphQLDocument, error) {
+	p := &graphqlParser{lexer: graphqlLexer{src: source, line: 1, lineStart: 0}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &GraphQLDocument{Fragments: make(map[string]*GraphQLFragment)}
+	names := make(map[string]bool)
+	for p.tok.kind != graphqlEOF {
+		switch {
+		case p.tok.is("{"):
+			set, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &GraphQLOperation{Type: "query", SelectionSet: set})
+		case p.tok.kind == graphqlName && (p.tok.text == "query" || p.tok.text == "mutation" || p.tok.text == "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			if op.Name != "" {
+				if names[op.Name] {
+					return nil, fmt.Errorf("operation %q is defined twice", op.Name)
+				}
+				names[op.Name] = true
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.tok.kind == graphqlName && p.tok.text == "fragment":
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.Fragments[fragment.Name]; ok {
+				return nil, fmt.Errorf("fragment %q is defined twice", fragment.Name)
+			}
+			doc.Fragments[fragment.Name] = fragment
+		default:
+			return nil, p.errorf("expected an operation or fragment, found %s", p.tok)
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("document defines no operation")
+	}
+	for _, op := range doc.Operations {
+		if op.Name == "" && len(doc.Operations) > 1 {
+			return nil, fmt.Errorf("an anonymous operation must be the only operation of a document")
+		}
+	}
+	return doc, nil
+}
+
+// graphqlTokenKind classifies tokens
+type graphqlTokenKind int
+
+const (
+	graphqlEOF graphqlTokenKind = iota
+	graphqlPunct
+	graphqlName
+	graphqlIntToken
+	graphqlFloatToken
+	graphqlStringToken
+)
+
+type graphqlToken struct {
+	kind         graphqlTokenKind
+	text         string
+	line, column int
+}
+
+func (t graphqlToken) is(punct string) bool {
+	return t.kind == graphqlPunct && t.text == punct
+}
+
+func (t graphqlToken) String() string {
+	switch t.kind {
+	case graphqlEOF:
+		return "end of document"
+	case graphqlStringToken:
+		return "string"
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+// graphqlLexer splits a document into tokens, skipping whitespace, commas
+// and comments
+type graphqlLexer struct {
+	src       string
+	pos       int
+	line      int
+	lineStart int
+}
+
+func (l *graphqlLexer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("syntax error at line %d, column %d: %s", l.line, l.pos-l.lineStart+1, fmt.Sprintf(format, args...))
+}
+
+func (l *graphqlLexer) newline() {
+	l.line++
+	l.lineStart = l.pos
+}
+
+func (l *graphqlLexer) next() (graphqlToken, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.pos++
+			l.newline()
+		case c == '\r':
+			l.pos++
+			if l.pos < len(l.src) && l.src[l.pos] == '\n' {
+				l.pos++
+			}
+			l.newline()
+		case c == ' ' || c == '\t' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "\uFEFF"):
+			l.pos += len("\uFEFF")
+		default:
+			return l.token()
+		}
+	}
+	return graphqlToken{kind: graphqlEOF, line: l.line, column: l.pos - l.lineStart + 1}, nil
+}
+
+func (l *graphqlLexer) token() (graphqlToken, error) {
+	start := l.pos
+	tok := graphqlToken{line: l.line, column: start - l.lineStart + 1}
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		tok.kind, tok.text = graphqlPunct, "..."
+	case strings.IndexByte("!$&()=:@[]{}|", c) >= 0:
+		l.pos++
+		tok.kind, tok.text = graphqlPunct, string(c)
+	case c == '_' || isGraphQLLetter(c):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isGraphQLLetter(l.src[l.pos]) || isGraphQLDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		tok.kind, tok.text = graphqlName, l.src[start:l.pos]
+	case c == '-' || isGraphQLDigit(c):
+		return l.number(tok)
+	case c == '"':
+		var err error
+		if strings.HasPrefix(l.src[l.pos:], `"""`) {
+			tok.text, err = l.blockString()
+		} else {
+			tok.text, err = l.quotedString()
+		}
+		if err != nil {
+			return tok, err
+		}
+		tok.kind = graphqlStringToken
+	default:
+		r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+		return tok, l.errorf("unexpected character %q", r)
+	}
+	return tok, nil
+}
+
+func isGraphQLLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isGraphQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (l *graphqlLexer) digits() int {
+	start := l.pos
+	for l.pos < len(l.src) && isGraphQLDigit(l.src[l.pos]) {
+		l.pos++
+	}
+	return l.pos - start
+}
+
+// number lexes an IntValue or FloatValue
+func (l *graphqlLexer) number(tok graphqlToken) (graphqlToken, error) {
+	start := l.pos
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	intStart := l.pos
+	if l.digits() == 0 {
+		return tok, l.errorf("invalid number")
+	}
+	if l.src[intStart] == '0' && l.pos-intStart > 1 {
+		return tok, l.errorf("invalid number %s: leading zero", l.src[start:l.pos])
+	}
+	tok.kind = graphqlIntToken
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		l.pos++
+		if l.digits() == 0 {
+			return tok, l.errorf("invalid number %s", l.src[start:l.pos])
+		}
+		tok.kind = graphqlFloatToken
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if l.digits() == 0 {
+			return tok, l.errorf("invalid number %s", l.src[start:l.pos])
+		}
+		tok.kind = graphqlFloatToken
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == '.' || l.src[l.pos] == '_' || isGraphQLLetter(l.src[l.pos])) {
+		return tok, l.errorf("invalid number %s", l.src[start:l.pos+1])
+	}
+	tok.text = l.src[start:l.pos]
+	return tok, nil
+}
+
+// quotedString lexes a "..." string and decodes its escapes
+func (l *graphqlLexer) quotedString() (string, error) {
+	l.pos++
+	var b strings.Builder
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' || l.src[l.pos] == '\r' {
+			return "", l.errorf("unterminated string")
+		}
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return b.String(), nil
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return "", l.errorf("unterminated string")
+			}
+			escape := l.src[l.pos+1]
+			l.pos += 2
+			switch escape {
+			case '"', '\\', '/':
+				b.WriteByte(escape)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				r, err := l.unicodeEscape()
+				if err != nil {
+					return "", err
+				}
+				b.WriteRune(r)
+			default:
+				return "", l.errorf("invalid escape \\%c", escape)
+			}
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+}
+
+// unicodeEscape decodes the hex digits of a \u escape, joining surrogate
+// pairs
+func (l *graphqlLexer) unicodeEscape() (rune, error) {
+	hex := func() (rune, bool) {
+		if l.pos+4 > len(l.src) {
+			return 0, false
+		}
+		n, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+		if err != nil {
+			return 0, false
+		}
+		l.pos += 4
+		return rune(n), true
+	}
+	r, ok := hex()
+	if !ok {
+		return 0, l.errorf("invalid unicode escape")
+	}
+	if r >= 0xD800 && r < 0xDC00 && strings.HasPrefix(l.src[l.pos:], `\u`) {
+		l.pos += 2
+		low, ok := hex()
+		if !ok || low < 0xDC00 || low > 0xDFFF {
+			return 0, l.errorf("invalid unicode escape")
+		}
+		return (r-0xD800)<<10 + (low - 0xDC00) + 0x10000, nil
+	}
+	if r >= 0xD800 && r <= 0xDFFF {
+		return 0, l.errorf("invalid unicode escape")
+	}
+	return r, nil
+}
+
+// blockString lexes a """...""" string, removing the common indentation
+// and the blank first and last lines as the specification requires
+func (l *graphqlLexer) blockString() (string, error) {
+	l.pos += 3
+	var raw strings.Builder
+	for {
+		if l.pos >= len(l.src) {
+			return "", l.errorf("unterminated block string")
+		}
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], `"""`):
+			l.pos += 3
+			return graphqlBlockStringValue(raw.String()), nil
+		case strings.HasPrefix(l.src[l.pos:], `\"""`):
+			raw.WriteString(`"""`)
+			l.pos += 4
+		default:
+			c := l.src[l.pos]
+			raw.WriteByte(c)
+			l.pos++
+			if c == '\n' || (c == '\r' && !strings.HasPrefix(l.src[l.pos:], "\n")) {
+				l.newline()
+			}
+		}
+	}
+}
+
+func graphqlBlockStringValue(raw string) string {
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(raw), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// graphqlParser is a recursive-descent parser over the lexer's tokens
+type graphqlParser struct {
+	lexer   graphqlLexer
+	tok     graphqlToken
+	nesting int
+}
+
+func (p *graphqlParser) advance() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *graphqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("syntax error at line %d, column %d: %s", p.tok.line, p.tok.column, fmt.Sprintf(format, args...))
+}
+
+// expect consumes a punctuator
+func (p *graphqlParser) expect(punct string) error {
+	if !p.tok.is(punct) {
+		return p.errorf("expected %q, found %s", punct, p.tok)
+	}
+	return p.advance()
+}
+
+// name consumes a name
+func (p *graphqlParser) name() (string, error) {
+	if p.tok.kind != graphqlName {
+		return "", p.errorf("expected a name, found %s", p.tok)
+	}
+	name := p.tok.text
+	return name, p.advance()
+}
+
+// nest guards the depth of nested selection sets and values
+func (p *graphqlParser) nest() error {
+	p.nesting++
+	if p.nesting > graphqlMaxNesting {
+		return p.errorf("document is nested more than %d levels deep", graphqlMaxNesting)
+	}
+	return nil
+}
+
+func (p *graphqlParser) operation() (*GraphQLOperation, error) {
+	op := &GraphQLOperation{Type: p.tok.text}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == graphqlName {
+		op.Name = p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.tok.is("(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.tok.is(")") {
+			def, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.Variables = append(op.Variables, def)
+		}
+		if len(op.Variables) == 0 {
+			return nil, p.errorf("expected a variable definition")
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if op.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.SelectionSet, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *graphqlParser) variableDefinition() (GraphQLVariableDefinition, error) {
+	var def GraphQLVariableDefinition
+	if err := p.expect("$"); err != nil {
+		return def, err
+	}
+	var err error
+	if def.Name, err = p.name(); err != nil {
+		return def, err
+	}
+	if err := p.expect(":"); err != nil {
+		return def, err
+	}
+	if def.Type, err = p.typeReference(); err != nil {
+		return def, err
+	}
+	if p.tok.is("=") {
+		if err := p.advance(); err != nil {
+			return def, err
+		}
+		if def.Default, err = p.value(true); err != nil {
+			return def, err
+		}
+	}
+	// Directives on variable definitions are accepted and ignored
+	_, err = p.directives()
+	return def, err
+}
+
+// typeReference parses a type such as [ID!]! into its written form
+func (p *graphqlParser) typeReference() (string, error) {
+	var typ string
+	if p.tok.is("[") {
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		if err := p.nest(); err != nil {
+			return "", err
+		}
+		inner, err := p.typeReference()
+		if err != nil {
+			return "", err
+		}
+		p.nesting--
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.tok.is("!") {
+		typ += "!"
+		return typ, p.advance()
+	}
+	return typ, nil
+}
+
+func (p *graphqlParser) fragment() (*GraphQLFragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	fragment := &GraphQLFragment{}
+	var err error
+	if fragment.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if fragment.Name == "on" {
+		return nil, p.errorf("a fragment may not be named \"on\"")
+	}
+	if p.tok.kind != graphqlName || p.tok.text != "on" {
+		return nil, p.errorf("expected \"on\", found %s", p.tok)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if fragment.TypeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if fragment.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if fragment.SelectionSet, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (p *graphqlParser) selectionSet() ([]*GraphQLSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	var set []*GraphQLSelection
+	for !p.tok.is("}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, selection)
+	}
+	if len(set) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	p.nesting--
+	return set, p.advance()
+}
+
+func (p *graphqlParser) selection() (*GraphQLSelection, error) {
+	selection := &GraphQLSelection{Line: p.tok.line, Column: p.tok.column}
+	var err error
+	if p.tok.is("...") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == graphqlName && p.tok.text != "on" {
+			selection.Kind = GraphQLFragmentSpread
+			if selection.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+			selection.Directives, err = p.directives()
+			return selection, err
+		}
+		selection.Kind = GraphQLInlineFragment
+		if p.tok.kind == graphqlName {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if selection.TypeCondition, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if selection.Directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		selection.SelectionSet, err = p.selectionSet()
+		return selection, err
+	}
+
+	selection.Kind = GraphQLField
+	if selection.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if p.tok.is(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		selection.Alias = selection.Name
+		if selection.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if selection.Arguments, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if selection.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.tok.is("{") {
+		if selection.SelectionSet, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return selection, nil
+}
+
+// arguments parses an optional parenthesised argument list
+func (p *graphqlParser) arguments(constant bool) ([]GraphQLArgument, error) {
+	if !p.tok.is("(") {
+		return nil, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var args []GraphQLArgument
+	seen := make(map[string]bool)
+	for !p.tok.is(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, p.errorf("argument %q is given twice", name)
+		}
+		seen[name] = true
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value(constant)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, GraphQLArgument{Name: name, Value: value})
+	}
+	if len(args) == 0 {
+		return nil, p.errorf("expected an argument")
+	}
+	return args, p.advance()
+}
+
+func (p *graphqlParser) directives() ([]GraphQLDirective, error) {
+	var directives []GraphQLDirective
+	for p.tok.is("@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, GraphQLDirective{Name: name, Arguments: args})
+	}
+	return directives, nil
+}
+
+// value parses a value literal; constant values may not use variables
+func (p *graphqlParser) value(constant bool) (*GraphQLValue, error) {
+	tok := p.tok
+	switch {
+	case tok.is("$"):
+		if constant {
+			return nil, p.errorf("variables are not allowed here")
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return &GraphQLValue{Kind: GraphQLVariable, Text: name}, nil
+	case tok.is("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		list := &GraphQLValue{Kind: GraphQLList}
+		for !p.tok.is("]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list.List = append(list.List, item)
+		}
+		p.nesting--
+		return list, p.advance()
+	case tok.is("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		object := &GraphQLValue{Kind: GraphQLObject}
+		seen := make(map[string]bool)
+		for !p.tok.is("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if seen[name] {
+				return nil, p.errorf("field %q is given twice", name)
+			}
+			seen[name] = true
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			object.Fields = append(object.Fields, GraphQLArgument{Name: name, Value: value})
+		}
+		p.nesting--
+		return object, p.advance()
+	}
+
+	value := &GraphQLValue{Text: tok.text}
+	switch tok.kind {
+	case graphqlIntToken:
+		value.Kind = GraphQLInt
+	case graphqlFloatToken:
+		value.Kind = GraphQLFloat
+	case graphqlStringToken:
+		value.Kind = GraphQLString
+	case graphqlName:
+		switch tok.text {
+		case "true", "false":
+			value.Kind = GraphQLBoolean
+		case "null":
+			value.Kind = GraphQLNull
+		default:
+			value.Kind = GraphQLEnum
+		}
+	default:
+		return nil, p.errorf("expected a value, found %s", tok)
+	}
+	return value, p.advance()
+}
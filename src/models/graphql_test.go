@@ -0,0 +1,154 @@
+package models_test
+
+import (
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestParseGraphQL checks operations, variables, aliases, arguments and
+// the value literals parse into the document
+func TestParseGraphQL(t *testing.T) {
+	doc, err := models.ParseGraphQL(`
+		# Open tickets with their owners
+		query Tickets($status: String = "open", $limit: Int!) {
+			open: entities(tags: ["type:ticket", $status], limit: $limit, matchAll: true) {
+				id
+				tag(namespace: "status")
+				related(direction: OUT, type: "owner") { ...Owner }
+			}
+			entity(id: "t-1") { content note: tag(namespace: """
+				  block
+				""") }
+		}
+		fragment Owner on Entity { id tags(namespace: "name") }`)
+	if err != nil {
+		t.Fatalf("ParseGraphQL: %v", err)
+	}
+
+	op, err := doc.Operation("")
+	if err != nil {
+		t.Fatalf("Operation: %v", err)
+	}
+	if op.Type != "query" || op.Name != "Tickets" || len(op.Variables) != 2 {
+		t.Fatalf("operation = %+v", op)
+	}
+	if def := op.Variables[1]; def.Name != "limit" || def.Type != "Int!" || def.Default != nil {
+		t.Errorf("$limit = %+v", def)
+	}
+	if len(op.SelectionSet) != 2 {
+		t.Fatalf("%d root fields, want 2", len(op.SelectionSet))
+	}
+
+	open := op.SelectionSet[0]
+	if open.Alias != "open" || open.Name != "entities" || open.ResponseKey() != "open" || len(open.SelectionSet) != 3 {
+		t.Fatalf("aliased field = %+v", open)
+	}
+	tags := open.Argument("tags")
+	if tags == nil || tags.Kind != models.GraphQLList || tags.List[1].Kind != models.GraphQLVariable || tags.List[1].Text != "status" {
+		t.Errorf("tags argument = %+v", tags)
+	}
+	if direction := open.SelectionSet[2].Argument("direction"); direction.Kind != models.GraphQLEnum || direction.Text != "OUT" {
+		t.Errorf("direction argument = %+v", direction)
+	}
+	if spread := open.SelectionSet[2].SelectionSet[0]; spread.Kind != models.GraphQLFragmentSpread || spread.Name != "Owner" {
+		t.Errorf("fragment spread = %+v", spread)
+	}
+	if note := op.SelectionSet[1].SelectionSet[1]; note.Argument("namespace").Text != "block" {
+		t.Errorf("block string = %q", note.Argument("namespace").Text)
+	}
+
+	variables, err := op.VariableValues(map[string]interface{}{"limit": float64(5)})
+	if err != nil {
+		t.Fatalf("VariableValues: %v", err)
+	}
+	value, err := tags.Resolve(variables)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if list, ok := value.([]interface{}); !ok || len(list) != 2 || list[1] != "open" {
+		t.Errorf("resolved tags = %#v", value)
+	}
+	if _, err := op.VariableValues(nil); err == nil {
+		t.Error("VariableValues accepted a missing non-null variable")
+	}
+}
+
+// TestGraphQLCollectFields checks fragments, type conditions, directives
+// and the merging of fields sharing a response key
+func TestGraphQLCollectFields(t *testing.T) {
+	doc, err := models.ParseGraphQL(`{
+		entity(id: "a") {
+			id
+			...Names
+			... on Entity { type }
+			... on Change { timestamp }
+			dataset @skip(if: $brief)
+			content @include(if: false)
+			related { id }
+			related { type }
+		}
+	}
+	fragment Names on Entity { id tag(namespace: "name") ...Names }`)
+	if err != nil {
+		t.Fatalf("ParseGraphQL: %v", err)
+	}
+	root := doc.Operations[0].SelectionSet[0]
+
+	fields, err := doc.CollectFields("Entity", root.SelectionSet, map[string]interface{}{"brief": true})
+	if err != nil {
+		t.Fatalf("CollectFields: %v", err)
+	}
+	var keys []string
+	for _, field := range fields {
+		keys = append(keys, field.ResponseKey())
+	}
+	want := []string{"id", "tag", "type", "related"}
+	if len(keys) != len(want) {
+		t.Fatalf("fields = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("fields = %v, want %v", keys, want)
+		}
+	}
+	if related := fields[3]; len(related.SelectionSet) != 2 {
+		t.Errorf("merged related has %d selections, want 2", len(related.SelectionSet))
+	}
+
+	if _, err := doc.CollectFields("Entity", root.SelectionSet, nil); err == nil {
+		t.Error("CollectFields accepted @skip without a Boolean")
+	}
+}
+
+// TestParseGraphQLErrors checks documents the parser rejects
+func TestParseGraphQLErrors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"{ }",
+		"{ entity(id: ) { id } }",
+		`{ entity(id: "a", id: "b") { id } }`,
+		`{ entity(id: "unterminated) { id } }`,
+		"{ entities(limit: 01) { id } }",
+		"query A { id } query A { id }",
+		"{ id } query B { id }",
+		"fragment F on Entity { id }",
+		"type Entity { id: ID }",
+		"query ($a: Int = $b) { id }",
+	} {
+		if _, err := models.ParseGraphQL(source); err == nil {
+			t.Errorf("ParseGraphQL(%q) succeeded", source)
+		}
+	}
+
+	doc, err := models.ParseGraphQL("query A { id } query B { id }")
+	if err != nil {
+		t.Fatalf("ParseGraphQL: %v", err)
+	}
+	if _, err := doc.Operation(""); err == nil {
+		t.Error("Operation chose between two operations without a name")
+	}
+	if op, err := doc.Operation("B"); err != nil || op.Name != "B" {
+		t.Errorf("Operation(B) = %+v, %v", op, err)
+	}
+}
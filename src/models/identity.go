@@ -0,0 +1,116 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Identity tags name a user uniquely, for example identity:username:alice.
+// At most one live entity may hold each identity tag; users merged into
+// another by the user reconciler give theirs up.
+const (
+	IdentityTagPrefix   = "identity:"
+	UsernameTagPrefix   = "identity:username:"
+	MergedIntoTagPrefix = "merged_into:"
+	MergedFromTagPrefix = "merged_from:"
+)
+
+// ErrDuplicateIdentity is returned when an identity tag is already held by
+// another entity
+var ErrDuplicateIdentity = errors.New("identity already in use")
+
+// stripTagTimestamp returns a tag without its "timestamp|" prefix
+func stripTagTimestamp(tag string) string {
+	if idx := strings.Index(tag, "|"); idx >= 0 {
+		return tag[idx+1:]
+	}
+	return tag
+}
+
+// IsMergedUser reports whether a user entity was merged into another
+func IsMergedUser(entity *Entity) bool {
+	return entity.GetTagValue("merged_into") != ""
+}
+
+// ClaimsIdentity reports whether any of the tag sets holds an identity tag.
+// Tags may carry timestamps.
+func ClaimsIdentity(tagSets ...[]string) bool {
+	for _, tags := range tagSets {
+		for _, tag := range tags {
+			if strings.HasPrefix(stripTagTimestamp(tag), IdentityTagPrefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LockIdentities takes the lock CreateUser holds while it checks and claims
+// a username, and returns the function releasing it. Writers that check
+// identity tags with CheckUniqueIdentity hold it until their write is
+// stored, so they cannot claim an identity a concurrent write claims too.
+func (sm *SecurityManager) LockIdentities() (unlock func()) {
+	sm.identityMu.Lock()
+	return sm.identityMu.Unlock
+}
+
+// CheckUniqueIdentity returns ErrDuplicateIdentity when an entity other than
+// entityID already holds one of the identity tags in tags. Tags may carry
+// timestamps. Pass an empty entityID for entities not created yet.
+func CheckUniqueIdentity(repo EntityRepository, entityID string, tags []string) error {
+	for _, tag := range tags {
+		tag = stripTagTimestamp(tag)
+		if !strings.HasPrefix(tag, IdentityTagPrefix) {
+			continue
+		}
+		holders, err := repo.ListByTag(tag)
+		if err != nil {
+			return fmt.Errorf("failed to check identity %s: %w", tag, err)
+		}
+		for _, holder := range holders {
+			if holder.ID != entityID && !IsMergedUser(holder) {
+				return fmt.Errorf("%w: %s is held by entity %s", ErrDuplicateIdentity, tag, holder.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// SelectUserEntity picks the user entity a username resolves to when
+// several entities claim it. Active users with credentials win, then the
+// earliest created, so lookups and the reconciler agree on the same entity.
+func SelectUserEntity(entities []*Entity) *Entity {
+	var candidates []*Entity
+	for _, entity := range entities {
+		if !IsMergedUser(entity) {
+			candidates = append(candidates, entity)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	rank := func(entity *Entity) int {
+		score := 0
+		if entity.HasTag("status:active") {
+			score += 2
+		}
+		if entity.HasTag("has:credentials") {
+			score++
+		}
+		return score
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ri, rj := rank(candidates[i]), rank(candidates[j])
+		if ri != rj {
+			return ri > rj
+		}
+		if candidates[i].CreatedAt != candidates[j].CreatedAt {
+			return candidates[i].CreatedAt < candidates[j].CreatedAt
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	return candidates[0]
+}
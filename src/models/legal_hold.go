@@ -0,0 +1,51 @@
+package models
+
+import "strings"
+
+// An entity under legal hold is immutable while the hold lasts: the
+// repository refuses to update, tag, delete or purge it, and retention
+// leaves its history alone. Holds are placed and lifted only by users with
+// the entity:legal_hold permission, and are recorded as:
+//
+//	immutable:legal-hold
+//	immutable:legal-hold-by:<user id>
+//	immutable:legal-hold-reason:<reason>   (optional)
+const (
+	LegalHoldTag             = "immutable:legal-hold"
+	LegalHoldByTagPrefix     = "immutable:legal-hold-by:"
+	LegalHoldReasonTagPrefix = "immutable:legal-hold-reason:"
+)
+
+// LegalHold describes the legal hold on an entity
+type LegalHold struct {
+	EntityID string `json:"entity_id"`
+	Held     bool   `json:"held"`
+	HeldBy   string `json:"held_by,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ParseLegalHold returns the legal hold state of an entity
+func ParseLegalHold(entity *Entity) LegalHold {
+	hold := LegalHold{EntityID: entity.ID}
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		switch {
+		case tag == LegalHoldTag:
+			hold.Held = true
+		case strings.HasPrefix(tag, LegalHoldByTagPrefix):
+			hold.HeldBy = strings.TrimPrefix(tag, LegalHoldByTagPrefix)
+		case strings.HasPrefix(tag, LegalHoldReasonTagPrefix):
+			hold.Reason = strings.TrimPrefix(tag, LegalHoldReasonTagPrefix)
+		}
+	}
+	if !hold.Held {
+		return LegalHold{EntityID: entity.ID}
+	}
+	return hold
+}
+
+// IsLegalHoldTag reports whether a tag, with or without its timestamp,
+// records a legal hold
+func IsLegalHoldTag(tag string) bool {
+	tag = stripTagTimestamp(tag)
+	return tag == LegalHoldTag || strings.HasPrefix(tag, LegalHoldTag+"-")
+}
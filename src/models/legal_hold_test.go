@@ -0,0 +1,39 @@
+package models_test
+
+import (
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestParseLegalHold checks that hold details count only while the hold tag
+// is present
+func TestParseLegalHold(t *testing.T) {
+	entity := models.NewEntity()
+	entity.AddTag(models.LegalHoldByTagPrefix + "admin")
+	if hold := models.ParseLegalHold(entity); hold.Held || hold.HeldBy != "" {
+		t.Fatalf("ParseLegalHold() without the hold tag = %+v", hold)
+	}
+
+	entity.AddTag(models.LegalHoldTag)
+	entity.AddTag(models.LegalHoldReasonTagPrefix + "case 42")
+	hold := models.ParseLegalHold(entity)
+	if !hold.Held || hold.HeldBy != "admin" || hold.Reason != "case 42" {
+		t.Errorf("ParseLegalHold() = %+v", hold)
+	}
+	if !entity.Lifecycle().IsOnLegalHold() {
+		t.Error("IsOnLegalHold() = false for a held entity")
+	}
+
+	for tag, want := range map[string]bool{
+		models.LegalHoldTag:                          true,
+		"1700000000000000000|" + models.LegalHoldTag: true,
+		models.LegalHoldByTagPrefix + "admin":        true,
+		"immutable:other":                            false,
+		"legal:hold":                                 false,
+	} {
+		if got := models.IsLegalHoldTag(tag); got != want {
+			t.Errorf("IsLegalHoldTag(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
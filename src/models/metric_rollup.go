@@ -0,0 +1,138 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metric rollups summarize the temporal value: tags of a raw metric entity
+// into fixed time buckets. Each resolution of a metric is kept on its own
+// entity:
+//
+//	type:metric_rollup
+//	dataset:system
+//	rollup:metric:<metric name>
+//	rollup:source:<raw metric entity id>
+//	rollup:resolution:1m | 1h | 1d
+//
+// with one temporal tag per bucket, timestamped at the bucket start:
+//
+//	<bucket start>|value:<avg>:min:<min>:max:<max>:sum:<sum>:count:<n>
+//
+// The average comes first so readers of plain value: tags still see a
+// number. Rollup entities are not type:metric, so they are never rolled up
+// or collected again.
+const (
+	MetricRollupType     = "metric_rollup"
+	MetricRollupValueTag = "value:"
+)
+
+// RollupResolution is a bucket width metrics are rolled up to
+type RollupResolution struct {
+	Name     string
+	Duration time.Duration
+}
+
+// RollupResolutions are the rollup resolutions, finest first. Each one is
+// computed from the one before it, and the finest from raw values.
+var RollupResolutions = []RollupResolution{
+	{Name: "1m", Duration: time.Minute},
+	{Name: "1h", Duration: time.Hour},
+	{Name: "1d", Duration: 24 * time.Hour},
+}
+
+// ParseRollupResolution accepts "1m", "1h" and "1d", and their long forms
+// "1min", "1hour" and "1day"
+func ParseRollupResolution(s string) (RollupResolution, bool) {
+	switch s {
+	case "1min":
+		s = "1m"
+	case "1hour":
+		s = "1h"
+	case "1day":
+		s = "1d"
+	}
+	for _, resolution := range RollupResolutions {
+		if resolution.Name == s {
+			return resolution, true
+		}
+	}
+	return RollupResolution{}, false
+}
+
+// MetricRollupID is the ID of the entity holding one resolution of a raw
+// metric entity's rollups
+func MetricRollupID(sourceID string, resolution RollupResolution) string {
+	return "metric_rollup_" + resolution.Name + "_" + sourceID
+}
+
+// MetricRollup summarizes the values of one bucket
+type MetricRollup struct {
+	Start time.Time `json:"start"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Sum   float64   `json:"sum"`
+	Count int64     `json:"count"`
+}
+
+// Avg returns the mean of the bucket's values
+func (b MetricRollup) Avg() float64 {
+	if b.Count == 0 {
+		return 0
+	}
+	return b.Sum / float64(b.Count)
+}
+
+// Merge folds another summary into the bucket
+func (b *MetricRollup) Merge(other MetricRollup) {
+	if other.Count == 0 {
+		return
+	}
+	if b.Count == 0 || other.Min < b.Min {
+		b.Min = other.Min
+	}
+	if b.Count == 0 || other.Max > b.Max {
+		b.Max = other.Max
+	}
+	b.Sum += other.Sum
+	b.Count += other.Count
+}
+
+// Tag returns the temporal tag storing the bucket
+func (b MetricRollup) Tag() string {
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	return strconv.FormatInt(b.Start.UnixNano(), 10) + "|" + MetricRollupValueTag + format(b.Avg()) +
+		":min:" + format(b.Min) + ":max:" + format(b.Max) + ":sum:" + format(b.Sum) +
+		":count:" + strconv.FormatInt(b.Count, 10)
+}
+
+// ParseMetricRollupTag reads a bucket written by Tag
+func ParseMetricRollupTag(tag string) (MetricRollup, bool) {
+	timestamp, value, ok := strings.Cut(tag, "|")
+	if !ok || !strings.HasPrefix(value, MetricRollupValueTag) {
+		return MetricRollup{}, false
+	}
+	nanos, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return MetricRollup{}, false
+	}
+
+	// avg:min:<min>:max:<max>:sum:<sum>:count:<n>
+	fields := strings.Split(strings.TrimPrefix(value, MetricRollupValueTag), ":")
+	if len(fields) != 9 || fields[1] != "min" || fields[3] != "max" || fields[5] != "sum" || fields[7] != "count" {
+		return MetricRollup{}, false
+	}
+	bucket := MetricRollup{Start: time.Unix(0, nanos)}
+	var errs [4]error
+	bucket.Min, errs[0] = strconv.ParseFloat(fields[2], 64)
+	bucket.Max, errs[1] = strconv.ParseFloat(fields[4], 64)
+	bucket.Sum, errs[2] = strconv.ParseFloat(fields[6], 64)
+	bucket.Count, errs[3] = strconv.ParseInt(fields[8], 10, 64)
+	for _, err := range errs {
+		if err != nil {
+			return MetricRollup{}, false
+		}
+	}
+	return bucket, true
+}
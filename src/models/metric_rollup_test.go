@@ -0,0 +1,37 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestMetricRollupTag checks that merged buckets survive a round trip
+// through their temporal tag
+func TestMetricRollupTag(t *testing.T) {
+	start := time.Unix(1700000040, 0)
+	var bucket models.MetricRollup
+	bucket.Merge(models.MetricRollup{Start: start, Min: 3, Max: 3, Sum: 3, Count: 1})
+	bucket.Merge(models.MetricRollup{Start: start, Min: -1.5, Max: 10, Sum: 12.5, Count: 4})
+	bucket.Start = start
+
+	tag := bucket.Tag()
+	if want := "1700000040000000000|value:3.1:min:-1.5:max:10:sum:15.5:count:5"; tag != want {
+		t.Fatalf("Tag() = %q, want %q", tag, want)
+	}
+
+	parsed, ok := models.ParseMetricRollupTag(tag)
+	if !ok {
+		t.Fatalf("ParseMetricRollupTag(%q) failed", tag)
+	}
+	if !parsed.Start.Equal(start) || parsed.Min != -1.5 || parsed.Max != 10 || parsed.Sum != 15.5 || parsed.Count != 5 {
+		t.Errorf("ParseMetricRollupTag(%q) = %+v", tag, parsed)
+	}
+
+	for _, raw := range []string{"1700000040000000000|value:3", "value:3:min:1:max:1:sum:1:count:1"} {
+		if _, ok := models.ParseMetricRollupTag(raw); ok {
+			t.Errorf("ParseMetricRollupTag(%q) accepted a non-rollup tag", raw)
+		}
+	}
+}
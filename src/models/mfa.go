@@ -0,0 +1,442 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MFA state is kept in tags of the user entity, because its content holds
+// the password credentials. TOTP secrets are stored encrypted with the
+// server's MFA key; backup codes only as SHA-256 hashes.
+const (
+	MFATagPrefix          = "mfa:"
+	mfaEnabledTag         = "mfa:enabled"
+	mfaSecretTagPrefix    = "mfa:secret:"
+	mfaPendingTagPrefix   = "mfa:pending_secret:"
+	mfaBackupTagPrefix    = "mfa:backup:"
+	mfaLastStepTagPrefix  = "mfa:last_step:"
+	totpDigits            = 6
+	totpPeriod            = 30
+	totpSkew              = 1 // accepted steps before and after the current one
+	mfaBackupCodeCount    = 10
+	mfaBackupCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	mfaBackupCodeLength   = 10
+	mfaSecretSize         = 20
+	mfaKeySize            = 32
+)
+
+var (
+	// ErrMFANotConfigured is returned when no MFA encryption key is loaded
+	ErrMFANotConfigured = errors.New("two-factor authentication is not configured")
+	// ErrMFANotEnabled is returned for users without two-factor authentication
+	ErrMFANotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already has it
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnrolled is returned when confirming without a pending enrollment
+	ErrMFANotEnrolled = errors.New("no two-factor enrollment in progress")
+	// ErrInvalidMFACode is returned for wrong, expired or reused codes
+	ErrInvalidMFACode = errors.New("invalid two-factor code")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// LoadOrCreateMFAKey reads the base64 encoded 32-byte key that encrypts TOTP
+// secrets, generating it with mode 0600 if the file does not exist
+func LoadOrCreateMFAKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key := make([]byte, mfaKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate MFA key: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create MFA key directory: %w", err)
+		}
+		encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+		if err := os.WriteFile(path, []byte(encoded), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write MFA key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MFA key: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MFA key in %s: %w", path, err)
+	}
+	if len(key) != mfaKeySize {
+		return nil, fmt.Errorf("invalid MFA key in %s: expected %d bytes, got %d", path, mfaKeySize, len(key))
+	}
+	return key, nil
+}
+
+// TOTPCode returns the RFC 6238 code of secret for the 30 second step
+// containing t
+func TOTPCode(secret []byte, t time.Time) string {
+	return totpCodeAt(secret, uint64(t.Unix())/totpPeriod)
+}
+
+func totpCodeAt(secret []byte, step uint64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], step)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTOTP returns the step code matches within the allowed clock skew
+func matchTOTP(secret []byte, code string, now time.Time) (uint64, bool) {
+	current := uint64(now.Unix()) / totpPeriod
+	for delta := -totpSkew; delta <= totpSkew; delta++ {
+		step := current + uint64(int64(delta))
+		if subtle.ConstantTimeCompare([]byte(totpCodeAt(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPEnrollment is returned when a user starts enrolling an authenticator
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// SetMFAKey sets the key that encrypts TOTP secrets and the issuer shown in
+// authenticator apps. Without a key two-factor enrollment is unavailable.
+func (sm *SecurityManager) SetMFAKey(key []byte, issuer string) {
+	sm.mfaMu.Lock()
+	defer sm.mfaMu.Unlock()
+	sm.mfaKey = key
+	sm.mfaIssuer = issuer
+}
+
+// MFAEnabled reports whether a user entity has two-factor authentication on
+func MFAEnabled(entity *Entity) bool {
+	return entity != nil && entity.HasTag(mfaEnabledTag)
+}
+
+// EnrollTOTP generates a TOTP secret for a user and stores it as pending
+// until ConfirmTOTP proves the user's authenticator produces valid codes
+func (sm *SecurityManager) EnrollTOTP(user *SecurityUser) (*TOTPEnrollment, error) {
+	sm.mfaMu.Lock()
+	defer sm.mfaMu.Unlock()
+	if sm.mfaKey == nil {
+		return nil, ErrMFANotConfigured
+	}
+
+	entity, err := sm.entityRepo.GetByID(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if MFAEnabled(entity) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret := make([]byte, mfaSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	sealed, err := sm.sealMFASecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := sm.replaceMFATags(entity, []string{mfaPendingTagPrefix + sealed}); err != nil {
+		return nil, err
+	}
+
+	encoded := totpEncoding.EncodeToString(secret)
+	label := url.PathEscape(sm.mfaIssuer + ":" + user.Username)
+	query := url.Values{
+		"secret": {encoded},
+		"issuer": {sm.mfaIssuer},
+		"digits": {strconv.Itoa(totpDigits)},
+		"period": {strconv.Itoa(totpPeriod)},
+	}
+	return &TOTPEnrollment{
+		Secret:          encoded,
+		ProvisioningURI: "otpauth://totp/" + label + "?" + query.Encode(),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once code matches the
+// pending secret and returns the user's new backup codes
+func (sm *SecurityManager) ConfirmTOTP(userID, code string) ([]string, error) {
+	sm.mfaMu.Lock()
+	defer sm.mfaMu.Unlock()
+	if sm.mfaKey == nil {
+		return nil, ErrMFANotConfigured
+	}
+
+	entity, err := sm.entityRepo.GetByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if MFAEnabled(entity) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	sealed := mfaTagValue(entity, mfaPendingTagPrefix)
+	if sealed == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	secret, err := sm.openMFASecret(sealed)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, backupTags, err := generateBackupCodes()
+	if err != nil {
+		return nil, err
+	}
+	tags := append([]string{
+		mfaEnabledTag,
+		mfaSecretTagPrefix + sealed,
+		mfaLastStepTagPrefix + strconv.FormatUint(step, 10),
+	}, backupTags...)
+	if err := sm.replaceMFATags(entity, tags); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor checks a TOTP code or, if totpCode is empty, a backup
+// code of a user with two-factor authentication. TOTP codes are accepted
+// once; backup codes are consumed.
+func (sm *SecurityManager) VerifySecondFactor(userID, totpCode, backupCode string) error {
+	sm.mfaMu.Lock()
+	defer sm.mfaMu.Unlock()
+
+	entity, err := sm.entityRepo.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if !MFAEnabled(entity) {
+		return ErrMFANotEnabled
+	}
+
+	kept := currentMFATags(entity)
+	if totpCode = strings.TrimSpace(totpCode); totpCode != "" {
+		if sm.mfaKey == nil {
+			return ErrMFANotConfigured
+		}
+		secret, err := sm.openMFASecret(mfaTagValue(entity, mfaSecretTagPrefix))
+		if err != nil {
+			return err
+		}
+		step, ok := matchTOTP(secret, totpCode, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		// Reject replays of a code, or of an earlier one, already used
+		if last, err := strconv.ParseUint(mfaTagValue(entity, mfaLastStepTagPrefix), 10, 64); err == nil && step <= last {
+			return ErrInvalidMFACode
+		}
+		tags := make([]string, 0, len(kept))
+		for _, tag := range kept {
+			if !strings.HasPrefix(tag, mfaLastStepTagPrefix) {
+				tags = append(tags, tag)
+			}
+		}
+		return sm.replaceMFATags(entity, append(tags, mfaLastStepTagPrefix+strconv.FormatUint(step, 10)))
+	}
+
+	hashed := mfaBackupTagPrefix + hashBackupCode(backupCode)
+	for i, tag := range kept {
+		if subtle.ConstantTimeCompare([]byte(tag), []byte(hashed)) == 1 {
+			return sm.replaceMFATags(entity, append(kept[:i:i], kept[i+1:]...))
+		}
+	}
+	return ErrInvalidMFACode
+}
+
+// RegenerateBackupCodes replaces a user's backup codes
+func (sm *SecurityManager) RegenerateBackupCodes(userID string) ([]string, error) {
+	sm.mfaMu.Lock()
+	defer sm.mfaMu.Unlock()
+
+	entity, err := sm.entityRepo.GetByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if !MFAEnabled(entity) {
+		return nil, ErrMFANotEnabled
+	}
+
+	codes, backupTags, err := generateBackupCodes()
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, tag := range currentMFATags(entity) {
+		if !strings.HasPrefix(tag, mfaBackupTagPrefix) {
+			tags = append(tags, tag)
+		}
+	}
+	if err := sm.replaceMFATags(entity, append(tags, backupTags...)); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableMFA removes a user's TOTP secret, backup codes and any pending
+// enrollment
+func (sm *SecurityManager) DisableMFA(userID string) error {
+	sm.mfaMu.Lock()
+	defer sm.mfaMu.Unlock()
+
+	entity, err := sm.entityRepo.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if len(currentMFATags(entity)) == 0 {
+		return ErrMFANotEnabled
+	}
+	return sm.replaceMFATags(entity, nil)
+}
+
+// MFABackupCodesRemaining returns the number of unused backup codes
+func MFABackupCodesRemaining(entity *Entity) int {
+	count := 0
+	for _, tag := range currentMFATags(entity) {
+		if strings.HasPrefix(tag, mfaBackupTagPrefix) {
+			count++
+		}
+	}
+	return count
+}
+
+// replaceMFATags rewrites the user's mfa: tags to tags in a single update
+func (sm *SecurityManager) replaceMFATags(entity *Entity, tags []string) error {
+	kept := make([]string, 0, len(entity.Tags)+len(tags))
+	for _, tag := range entity.Tags {
+		if !strings.HasPrefix(stripTagTimestamp(tag), MFATagPrefix) {
+			kept = append(kept, tag)
+		}
+	}
+
+	updated := entity.WithTags(kept)
+	for _, tag := range tags {
+		updated.AddTag(tag)
+	}
+	if err := sm.entityRepo.Update(updated); err != nil {
+		return fmt.Errorf("failed to update two-factor settings: %w", err)
+	}
+	return nil
+}
+
+// currentMFATags returns the entity's mfa: tags without timestamps
+func currentMFATags(entity *Entity) []string {
+	var tags []string
+	for _, tag := range entity.Tags {
+		if tag = stripTagTimestamp(tag); strings.HasPrefix(tag, MFATagPrefix) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// mfaTagValue returns the value of the entity's mfa tag with prefix
+func mfaTagValue(entity *Entity, prefix string) string {
+	for _, tag := range currentMFATags(entity) {
+		if strings.HasPrefix(tag, prefix) {
+			return strings.TrimPrefix(tag, prefix)
+		}
+	}
+	return ""
+}
+
+// sealMFASecret encrypts a TOTP secret with AES-256-GCM
+func (sm *SecurityManager) sealMFASecret(secret []byte) (string, error) {
+	gcm, err := sm.mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, secret, nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openMFASecret decrypts a TOTP secret sealed by sealMFASecret
+func (sm *SecurityManager) openMFASecret(sealed string) ([]byte, error) {
+	gcm, err := sm.mfaCipher()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid stored TOTP secret")
+	}
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	return secret, nil
+}
+
+func (sm *SecurityManager) mfaCipher() (cipher.AEAD, error) {
+	if sm.mfaKey == nil {
+		return nil, ErrMFANotConfigured
+	}
+	block, err := aes.NewCipher(sm.mfaKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MFA key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// generateBackupCodes returns new backup codes and the tags storing their
+// hashes
+func generateBackupCodes() ([]string, []string, error) {
+	codes := make([]string, mfaBackupCodeCount)
+	tags := make([]string, mfaBackupCodeCount)
+	buf := make([]byte, mfaBackupCodeLength)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate backup codes: %w", err)
+		}
+		code := make([]byte, mfaBackupCodeLength)
+		for j, b := range buf {
+			code[j] = mfaBackupCodeAlphabet[b&31]
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+		tags[i] = mfaBackupTagPrefix + hashBackupCode(codes[i])
+	}
+	return codes, tags, nil
+}
+
+// hashBackupCode normalizes a backup code and hashes it for storage
+func hashBackupCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,26 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestTOTPCode checks codes against the SHA-1 test vectors of RFC 6238,
+// truncated to six digits
+func TestTOTPCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		if got := models.TOTPCode(secret, time.Unix(unix, 0)); got != want {
+			t.Errorf("TOTPCode at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Projection selects the fields list and query responses return for each
+// entity. The ID is always returned. Tags are either all returned or only
+// those in the listed namespaces.
+type Projection struct {
+	Content    bool
+	Tags       bool
+	Namespaces []string // tag namespaces returned when Tags is false
+	CreatedAt  bool
+	UpdatedAt  bool
+}
+
+// ParseProjection parses a fields parameter, a comma-separated list of id,
+// tags, tags.<namespace>, content, created_at and updated_at, and an
+// exclude_content flag, which drops content from whatever fields select.
+// Without either, it returns nil: entities are returned whole.
+func ParseProjection(fields string, excludeContent bool) (*Projection, error) {
+	if strings.TrimSpace(fields) == "" {
+		if !excludeContent {
+			return nil, nil
+		}
+		return &Projection{Tags: true, CreatedAt: true, UpdatedAt: true}, nil
+	}
+
+	p := &Projection{}
+	for _, field := range strings.Split(fields, ",") {
+		switch field = strings.TrimSpace(field); field {
+		case "id":
+		case "tags":
+			p.Tags = true
+		case "content":
+			p.Content = !excludeContent
+		case "created_at":
+			p.CreatedAt = true
+		case "updated_at":
+			p.UpdatedAt = true
+		default:
+			namespace, ok := strings.CutPrefix(field, "tags.")
+			if !ok || namespace == "" || strings.ContainsAny(namespace, ":|") {
+				return nil, fmt.Errorf("unknown field %q: use id, tags, tags.<namespace>, content, created_at or updated_at", field)
+			}
+			p.Namespaces = append(p.Namespaces, namespace)
+		}
+	}
+	if p.Tags {
+		p.Namespaces = nil
+	}
+	return p, nil
+}
+
+// Apply returns a copy of entity holding only the selected fields. Tags
+// keep their timestamps, if they have any, and are matched to namespaces
+// without them.
+func (p *Projection) Apply(entity *Entity) *Entity {
+	result := &Entity{ID: entity.ID, Tags: []string{}}
+	switch {
+	case p.Tags:
+		result.Tags = entity.Tags
+	case len(p.Namespaces) > 0:
+		for _, tag := range entity.Tags {
+			if p.selectsTag(tag) {
+				result.Tags = append(result.Tags, tag)
+			}
+		}
+	}
+	if p.Content {
+		result.Content = entity.Content
+	}
+	if p.CreatedAt {
+		result.CreatedAt = entity.CreatedAt
+	}
+	if p.UpdatedAt {
+		result.UpdatedAt = entity.UpdatedAt
+	}
+	return result
+}
+
+// selectsTag reports whether a tag is in one of the selected namespaces
+func (p *Projection) selectsTag(tag string) bool {
+	if _, clean, ok := strings.Cut(tag, "|"); ok {
+		tag = clean
+	}
+	for _, namespace := range p.Namespaces {
+		if strings.HasPrefix(tag, namespace+":") {
+			return true
+		}
+	}
+	return false
+}
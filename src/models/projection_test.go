@@ -0,0 +1,59 @@
+package models_test
+
+import (
+	"reflect"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestParseProjection checks the fields and exclude_content parameters and
+// the entity copies a projection returns
+func TestParseProjection(t *testing.T) {
+	if p, err := models.ParseProjection("", false); p != nil || err != nil {
+		t.Fatalf("ParseProjection without fields = %+v, %v, want nil", p, err)
+	}
+	for _, fields := range []string{"name", "tags.", "tags.a:b", "id,contents"} {
+		if _, err := models.ParseProjection(fields, false); err == nil {
+			t.Errorf("ParseProjection(%q) succeeded", fields)
+		}
+	}
+
+	entity := &models.Entity{
+		ID:        "e-1",
+		Tags:      []string{"1|type:ticket", "2|status:open", "3|status:triaged", "name:printer"},
+		Content:   []byte(`{"body":"jammed"}`),
+		CreatedAt: 1,
+		UpdatedAt: 3,
+	}
+
+	p, err := models.ParseProjection("", true)
+	if err != nil {
+		t.Fatalf("ParseProjection: %v", err)
+	}
+	got := p.Apply(entity)
+	if got.Content != nil || len(got.Tags) != 4 || got.CreatedAt != 1 || got.UpdatedAt != 3 {
+		t.Errorf("exclude_content = %+v", got)
+	}
+
+	p, err = models.ParseProjection("id, tags.status,tags.name,content", true)
+	if err != nil {
+		t.Fatalf("ParseProjection: %v", err)
+	}
+	got = p.Apply(entity)
+	want := &models.Entity{ID: "e-1", Tags: []string{"2|status:open", "3|status:triaged", "name:printer"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("projected entity = %+v, want %+v", got, want)
+	}
+	if len(entity.Tags) != 4 || entity.Content == nil {
+		t.Error("Apply modified the entity")
+	}
+
+	p, err = models.ParseProjection("id", false)
+	if err != nil {
+		t.Fatalf("ParseProjection: %v", err)
+	}
+	if got := p.Apply(entity); got.ID != "e-1" || got.Tags == nil || len(got.Tags) != 0 || got.Content != nil {
+		t.Errorf("id only = %+v", got)
+	}
+}
@@ -0,0 +1,295 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Entities holding JSON content can mark fields as sensitive with tags
+// naming a JSON path:
+//
+//	sensitive:content:$.ssn
+//	sensitive:content:$.patient.address
+//	sensitive:content:$.cards[*].number
+//
+// Readers without the entity:view_sensitive permission get the content with
+// those fields replaced by RedactedValue; the keys stay so the document
+// keeps its shape. Paths are written with a leading "$", "." between keys,
+// "[n]" for array elements and "*" or "[*]" for every key or element.
+const (
+	SensitiveTagPrefix = "sensitive:content:"
+
+	// RedactedValue replaces the value of a sensitive field
+	RedactedValue = "[REDACTED]"
+)
+
+// SensitivePath is a parsed sensitive content path
+type SensitivePath struct {
+	Path     string
+	Segments []string
+}
+
+// ParseSensitivePath parses a path such as "$.cards[*].number" into its
+// segments, here "cards", "*" and "number"
+func ParseSensitivePath(path string) (SensitivePath, error) {
+	rest := strings.TrimSpace(path)
+	rest = strings.TrimPrefix(rest, "$")
+	var segments []string
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return SensitivePath{}, fmt.Errorf("sensitive path %q has an empty key", path)
+			}
+			segments = append(segments, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return SensitivePath{}, fmt.Errorf("sensitive path %q has an unclosed [", path)
+			}
+			index := strings.Trim(rest[1:end], `"'`)
+			if index == "" {
+				return SensitivePath{}, fmt.Errorf("sensitive path %q has an empty index", path)
+			}
+			segments = append(segments, index)
+			rest = rest[end+1:]
+		default:
+			if len(segments) > 0 {
+				return SensitivePath{}, fmt.Errorf("sensitive path %q is malformed", path)
+			}
+			// Accept a bare leading key, as in "ssn" or "patient.ssn"
+			rest = "." + rest
+		}
+	}
+	if len(segments) == 0 {
+		return SensitivePath{}, fmt.Errorf("sensitive path %q names no field", path)
+	}
+	return SensitivePath{Path: path, Segments: segments}, nil
+}
+
+// SensitivePaths returns the sensitive content paths declared by an
+// entity's tags. Malformed paths are skipped.
+func SensitivePaths(entity *Entity) []SensitivePath {
+	var paths []SensitivePath
+	seen := make(map[string]bool)
+	for _, tag := range entity.Tags {
+		// Avoid building the tag view for the common entity without sensitive tags
+		if !strings.Contains(tag, SensitiveTagPrefix) {
+			continue
+		}
+		clean := stripTagTimestamp(tag)
+		if !strings.HasPrefix(clean, SensitiveTagPrefix) {
+			continue
+		}
+		raw := strings.TrimPrefix(clean, SensitiveTagPrefix)
+		if seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		if path, err := ParseSensitivePath(raw); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// HasSensitiveContent reports whether an entity declares sensitive paths
+func HasSensitiveContent(entity *Entity) bool {
+	return len(SensitivePaths(entity)) > 0
+}
+
+// CanViewSensitiveContent reports whether a user may see sensitive fields:
+// administrators and holders of entity:view_sensitive, directly or through
+// a wildcard
+func CanViewSensitiveContent(user *SecurityUser) bool {
+	if user == nil || user.Entity == nil {
+		return false
+	}
+	for _, tag := range user.Entity.GetTagsWithoutTimestamp() {
+		switch tag {
+		case "rbac:role:admin", "rbac:perm:*", "rbac:perm:*:*", "rbac:perm:entity:*", "rbac:perm:entity:view_sensitive":
+			return true
+		}
+	}
+	return false
+}
+
+// RedactContent replaces the values at paths in JSON content with
+// RedactedValue. It returns the content unchanged, and false, when the
+// content is not JSON or no path matched.
+func RedactContent(content []byte, paths []SensitivePath) ([]byte, bool) {
+	if len(paths) == 0 {
+		return content, false
+	}
+	document, ok := ParseJSONContent(content)
+	if !ok {
+		return content, false
+	}
+	redacted := false
+	for _, path := range paths {
+		if redactSegments(document, path.Segments) {
+			redacted = true
+		}
+	}
+	if !redacted {
+		return content, false
+	}
+	out, err := json.Marshal(document)
+	if err != nil {
+		return content, false
+	}
+	return out, true
+}
+
+// redactSegments masks the values segments lead to below node
+func redactSegments(node interface{}, segments []string) bool {
+	segment, last := segments[0], len(segments) == 1
+	redacted := false
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, value := range n {
+			if segment != "*" && segment != key {
+				continue
+			}
+			if last {
+				n[key] = RedactedValue
+				redacted = true
+			} else if redactSegments(value, segments[1:]) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for i, value := range n {
+			if segment != "*" && segment != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				n[i] = RedactedValue
+				redacted = true
+			} else if redactSegments(value, segments[1:]) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+// RedactEntityFor returns the entity as user may see it: a copy with its
+// sensitive fields masked, or the entity itself when nothing needs hiding
+func RedactEntityFor(user *SecurityUser, entity *Entity) *Entity {
+	return RedactVersionFor(user, entity, entity)
+}
+
+// RedactVersionFor redacts a historical version of an entity with the
+// sensitive paths of both the version and the current entity, so marking a
+// field sensitive also hides its earlier values
+func RedactVersionFor(user *SecurityUser, version, current *Entity) *Entity {
+	if version == nil || len(version.Content) == 0 {
+		return version
+	}
+	paths := SensitivePaths(version)
+	if current != nil && current != version {
+		paths = append(paths, SensitivePaths(current)...)
+	}
+	if len(paths) == 0 || CanViewSensitiveContent(user) {
+		return version
+	}
+	content, redacted := RedactContent(version.Content, paths)
+	if !redacted {
+		return version
+	}
+	return &Entity{
+		ID:        version.ID,
+		Tags:      version.Tags,
+		Content:   content,
+		CreatedAt: version.CreatedAt,
+		UpdatedAt: version.UpdatedAt,
+	}
+}
+
+// RedactEntitiesFor applies RedactEntityFor to each entity
+func RedactEntitiesFor(user *SecurityUser, entities []*Entity) []*Entity {
+	if CanViewSensitiveContent(user) {
+		return entities
+	}
+	redacted := make([]*Entity, len(entities))
+	for i, entity := range entities {
+		redacted[i] = RedactEntityFor(user, entity)
+	}
+	return redacted
+}
+
+// Overlaps reports whether a content filter path such as "cards.0.number"
+// reaches a sensitive field or an object holding one
+func (p SensitivePath) Overlaps(path string) bool {
+	segments := strings.Split(path, ".")
+	for i := 0; i < len(segments) && i < len(p.Segments); i++ {
+		if p.Segments[i] != "*" && p.Segments[i] != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterSensitiveMatches drops entities whose match on a content path
+// involved one of their sensitive fields, unless user may see them, so
+// queries cannot probe masked values
+func FilterSensitiveMatches(user *SecurityUser, entities []*Entity, path string) []*Entity {
+	if CanViewSensitiveContent(user) {
+		return entities
+	}
+	filtered := entities[:0:0]
+	for _, entity := range entities {
+		exposed := false
+		for _, sensitive := range SensitivePaths(entity) {
+			if sensitive.Overlaps(path) {
+				exposed = true
+				break
+			}
+		}
+		if !exposed {
+			filtered = append(filtered, entity)
+		}
+	}
+	return filtered
+}
+
+// FilterSensitiveSearchMatches drops entities found by a content search
+// whose content no longer matches once redacted for user
+func FilterSensitiveSearchMatches(user *SecurityUser, entities []*Entity, search string) []*Entity {
+	if CanViewSensitiveContent(user) {
+		return entities
+	}
+	search = strings.ToLower(search)
+	filtered := entities[:0:0]
+	for _, entity := range entities {
+		visible := RedactEntityFor(user, entity)
+		if visible == entity || strings.Contains(strings.ToLower(string(visible.Content)), search) {
+			filtered = append(filtered, entity)
+		}
+	}
+	return filtered
+}
+
+// DropsSensitivePaths reports whether giving an entity the tags would
+// remove one of its sensitive paths
+func DropsSensitivePaths(entity *Entity, tags []string) bool {
+	kept := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		kept[stripTagTimestamp(tag)] = true
+	}
+	for _, path := range SensitivePaths(entity) {
+		if !kept[SensitiveTagPrefix+path.Path] {
+			return true
+		}
+	}
+	return false
+}
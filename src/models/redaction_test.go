@@ -0,0 +1,92 @@
+package models_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestRedactEntityFor checks that sensitive fields are masked for users
+// without entity:view_sensitive and left alone for those with it
+func TestRedactEntityFor(t *testing.T) {
+	content := `{"name":"Ann","ssn":"123-45-6789","age":41,"cards":[{"number":"4111","brand":"visa"},{"number":"5500","brand":"mc"}],"notes":"n/a"}`
+	entity := &models.Entity{ID: "e1", Content: []byte(content), Tags: []string{
+		"type:patient",
+		"1700000000000000000|sensitive:content:$.ssn",
+		"sensitive:content:$.cards[*].number",
+		"sensitive:content:$.missing.field",
+	}}
+
+	viewer := aclUser("u1", "alice", "rbac:role:user", "rbac:perm:entity:view")
+	redacted := models.RedactEntityFor(viewer, entity)
+	if redacted == entity {
+		t.Fatal("content was not redacted for a user without entity:view_sensitive")
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(redacted.Content, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":  "Ann",
+		"ssn":   models.RedactedValue,
+		"age":   float64(41),
+		"notes": "n/a",
+		"cards": []interface{}{
+			map[string]interface{}{"number": models.RedactedValue, "brand": "visa"},
+			map[string]interface{}{"number": models.RedactedValue, "brand": "mc"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redacted content = %s", redacted.Content)
+	}
+	if string(entity.Content) != content {
+		t.Error("redaction modified the stored entity")
+	}
+
+	for _, user := range []*models.SecurityUser{
+		aclUser("u2", "root", "rbac:role:admin"),
+		aclUser("u3", "bob", "rbac:role:user", "rbac:perm:entity:view_sensitive"),
+		aclUser("u4", "carol", "rbac:role:user", "rbac:perm:entity:*"),
+	} {
+		if models.RedactEntityFor(user, entity) != entity {
+			t.Errorf("content was redacted for %s", user.Username)
+		}
+	}
+
+	plain := &models.Entity{ID: "e2", Content: []byte("ssn 123-45-6789"), Tags: []string{"sensitive:content:$.ssn"}}
+	if models.RedactEntityFor(viewer, plain) != plain {
+		t.Error("non-JSON content was rewritten")
+	}
+}
+
+// TestParseSensitivePath checks the accepted path forms
+func TestParseSensitivePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"$.ssn", []string{"ssn"}},
+		{"ssn", []string{"ssn"}},
+		{"$.patient.address.zip", []string{"patient", "address", "zip"}},
+		{"$.items[0].sku", []string{"items", "0", "sku"}},
+		{"$.items[*]", []string{"items", "*"}},
+		{"$['odd key'].x", []string{"odd key", "x"}},
+	}
+	for _, tt := range tests {
+		path, err := models.ParseSensitivePath(tt.path)
+		if err != nil {
+			t.Errorf("ParseSensitivePath(%q): %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(path.Segments, tt.want) {
+			t.Errorf("ParseSensitivePath(%q) = %q, want %q", tt.path, path.Segments, tt.want)
+		}
+	}
+	for _, bad := range []string{"$", "", "$.a..b", "$.a[0", "$.a[]"} {
+		if _, err := models.ParseSensitivePath(bad); err == nil {
+			t.Errorf("ParseSensitivePath(%q) succeeded", bad)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -17,6 +18,7 @@ type sessionValidationResult struct {
 	userID    string
 	username  string
 	email     string
+	scope     string // Dataset the session was scoped to at login
 	timestamp time.Time
 	expiry    time.Time
 }
@@ -27,6 +29,11 @@ type SecurityManager struct {
 	sessionCache        sync.Map // map[string]*sessionValidationResult
 	sessionCacheTTL     time.Duration
 	sessionCacheMutex   sync.RWMutex // Prevents race conditions in session validation
+	identityMu          sync.Mutex   // Serializes identity checks with user creation
+	mfaMu               sync.Mutex   // Serializes two-factor state changes and code checks
+	mfaKey              []byte       // Encrypts stored TOTP secrets; nil disables enrollment
+	mfaIssuer           string       // Issuer shown in authenticator apps
+	passwordVerifiers   map[string]ExternalPasswordVerifier // Verify passwords of external users by provider
 }
 
 // NewSecurityManager creates a new security manager
@@ -71,6 +78,7 @@ type SecurityUser struct {
 	Username string  // Login username (must be unique across the system)
 	Email    string  // Contact email address (optional, used for notifications)
 	Status   string  // Account status: "active", "inactive", "suspended", "deleted"
+	Scope    string  // Dataset the session is confined to; empty when unscoped
 	Entity   *Entity // Underlying entity containing user data and permissions
 }
 
@@ -83,6 +91,7 @@ type SecuritySession struct {
 	CreatedAt time.Time // Session creation timestamp (UTC)
 	IPAddress string    // Client IP address for security auditing
 	UserAgent string    // Client user agent string for device tracking
+	Scope     string    // Dataset the session is confined to; empty when unscoped
 	Entity    *Entity   // Underlying entity storing session metadata and audit trail
 }
 
@@ -109,17 +118,18 @@ type SecurityPermission struct {
 func (sm *SecurityManager) CreateUser(username, password, email string) (*SecurityUser, error) {
 	logger.TraceIf("auth", "creating user for username: %s", username)
 	
-	// Check if user already exists
-	existingUsers, err := sm.entityRepo.ListByTag("identity:username:" + username)
-	if err != nil {
+	// Check if user already exists; the lock keeps concurrent creates from
+	// both passing the check
+	sm.identityMu.Lock()
+	defer sm.identityMu.Unlock()
+	if err := CheckUniqueIdentity(sm.entityRepo, "", []string{UsernameTagPrefix + username}); err != nil {
+		if errors.Is(err, ErrDuplicateIdentity) {
+			logger.TraceIf("auth", "user %s already exists: %v", username, err)
+			return nil, fmt.Errorf("user with username '%s' already exists", username)
+		}
 		return nil, fmt.Errorf("failed to check for existing user: %v", err)
 	}
 	
-	if len(existingUsers) > 0 {
-		logger.TraceIf("auth", "user %s already exists with id: %s", username, existingUsers[0].ID)
-		return nil, fmt.Errorf("user with username '%s' already exists", username)
-	}
-	
 	// Generate password hash and salt
 	salt := generateSalt()
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password+salt), bcrypt.DefaultCost)
@@ -200,7 +210,11 @@ func (sm *SecurityManager) AuthenticateUser(username, password string) (*Securit
 	}
 	logger.TraceIf("auth", "found %d user entities for username: %s", len(userEntities), username)
 	
-	userEntity := userEntities[0]
+	// Resolve duplicates left by legacy migrations deterministically
+	userEntity := SelectUserEntity(userEntities)
+	if userEntity == nil {
+		return nil, fmt.Errorf("user not found")
+	}
 	
 	// Check if user is active and has credentials
 	userTags := userEntity.GetTagsWithoutTimestamp()
@@ -219,6 +233,15 @@ func (sm *SecurityManager) AuthenticateUser(username, password string) (*Securit
 		return nil, fmt.Errorf("user account is not active")
 	}
 	
+	// Users of an external directory are verified against the directory
+	if verify := sm.externalPasswordVerifier(userEntity); verify != nil {
+		if err := verify(userEntity, password); err != nil {
+			logger.TraceIf("auth", "external password verification failed: %v", err)
+			return nil, fmt.Errorf("invalid password")
+		}
+		return externalSecurityUser(userEntity, username), nil
+	}
+	
 	if !hasCredentials {
 		logger.TraceIf("auth", "user does not have embedded credentials")
 		return nil, fmt.Errorf("no credentials found for user")
@@ -297,12 +320,20 @@ func (sm *SecurityManager) AuthenticateUser(username, password string) (*Securit
 		Username: username,
 		Email:    email,
 		Status:   "active",
+		Scope:    userScope(userEntity, ""),
 		Entity:   userEntity,
 	}, nil
 }
 
 // CreateSession creates a new session entity using the new UUID-based architecture
 func (sm *SecurityManager) CreateSession(user *SecurityUser, ipAddress, userAgent string) (*SecuritySession, error) {
+	return sm.CreateScopedSession(user, ipAddress, userAgent, "")
+}
+
+// CreateScopedSession creates a session confined to the scope dataset, or
+// an unscoped one when scope is empty. The scope is not checked; resolve it
+// with ResolveSessionScope first.
+func (sm *SecurityManager) CreateScopedSession(user *SecurityUser, ipAddress, userAgent, scope string) (*SecuritySession, error) {
 	token := generateSecureToken()
 	expiresAt := time.Now().Add(2 * time.Hour) // 2 hour sessions
 	
@@ -315,6 +346,9 @@ func (sm *SecurityManager) CreateSession(user *SecurityUser, ipAddress, userAgen
 		"authenticated_as:" + user.ID,
 		"session:active",
 	}
+	if scope != "" {
+		additionalTags = append(additionalTags, SessionScopeTagPrefix+scope)
+	}
 	
 	// Create session entity with mandatory tags (owned by the user)
 	sessionEntity, err := NewEntityWithMandatoryTags(
@@ -366,6 +400,7 @@ func (sm *SecurityManager) CreateSession(user *SecurityUser, ipAddress, userAgen
 		CreatedAt: time.Unix(0, sessionEntity.CreatedAt),
 		IPAddress: ipAddress,
 		UserAgent: userAgent,
+		Scope:     scope,
 		Entity:    sessionEntity,
 	}, nil
 }
@@ -402,6 +437,7 @@ func (sm *SecurityManager) ValidateSession(token string) (*SecurityUser, error)
 					Username: result.username,
 					Email:    result.email,
 					Status:   "active",
+					Scope:    userScope(userEntity, result.scope),
 					Entity:   userEntity, // Must include entity for RBAC permission checking
 				}, nil
 			}
@@ -459,7 +495,7 @@ func (sm *SecurityManager) ValidateSession(token string) (*SecurityUser, error)
 	var expirationStr string
 	var isInvalidated bool
 	
-	logger.Trace("auth", "ValidateSession: Processing session %s with %d tags", sessionEntity.ID, len(sessionTags))
+	logger.TraceIf("auth", "ValidateSession: Processing session %s with %d tags", sessionEntity.ID, len(sessionTags))
 	
 	for _, tag := range sessionTags {
 		if strings.HasPrefix(tag, "expires:") {
@@ -493,11 +529,12 @@ func (sm *SecurityManager) ValidateSession(token string) (*SecurityUser, error)
 	}
 	
 	// Get user via tag-based relationship
-	var userID string
+	var userID, scope string
 	for _, tag := range sessionTags {
 		if strings.HasPrefix(tag, "authenticated_as:") {
 			userID = strings.TrimPrefix(tag, "authenticated_as:")
-			break
+		} else if strings.HasPrefix(tag, SessionScopeTagPrefix) {
+			scope = strings.TrimPrefix(tag, SessionScopeTagPrefix)
 		}
 	}
 	
@@ -530,6 +567,7 @@ func (sm *SecurityManager) ValidateSession(token string) (*SecurityUser, error)
 		userID:    userEntity.ID,
 		username:  username,
 		email:     email,
+		scope:     scope,
 		timestamp: time.Now(),
 		expiry:    expiresAt,
 	})
@@ -541,10 +579,24 @@ func (sm *SecurityManager) ValidateSession(token string) (*SecurityUser, error)
 		Username: username,
 		Email:    email,
 		Status:   "active",
+		Scope:    userScope(userEntity, scope),
 		Entity:   userEntity,
 	}, nil
 }
 
+// ForgetUserSessions drops cached session validations of a user so their
+// sessions are looked up again
+func (sm *SecurityManager) ForgetUserSessions(userID string) {
+	sm.sessionCacheMutex.Lock()
+	defer sm.sessionCacheMutex.Unlock()
+	sm.sessionCache.Range(func(token, cached interface{}) bool {
+		if cached.(*sessionValidationResult).userID == userID {
+			sm.sessionCache.Delete(token)
+		}
+		return true
+	})
+}
+
 // InvalidateSessionCache invalidates a session from the cache (called during logout)
 func (sm *SecurityManager) InvalidateSessionCache(token string) {
 	// SURGICAL FIX: Use write lock for cache invalidation to prevent race conditions
@@ -609,6 +661,12 @@ func (sm *SecurityManager) HasPermissionInDataset(user *SecurityUser, resource,
 		}
 	}
 	
+	// Check for permissions granted within the dataset
+	if datasetID != "" && hasDatasetPermission(userTags, resource, action, datasetID) {
+		logger.Debug("HasPermissionInDataset: found permission %s:%s in dataset %s", resource, action, datasetID)
+		return true, nil
+	}
+	
 	logger.Debug("HasPermissionInDataset: no matching permissions found for user %s", user.ID)
 	return false, nil
 }
@@ -656,6 +714,11 @@ func (sm *SecurityManager) getGroupRoles(groupID string) ([]*SecurityRole, error
 
 // CanAccessDataset checks if a user can access a specific dataset via tag-based RBAC
 func (sm *SecurityManager) CanAccessDataset(user *SecurityUser, datasetID string) (bool, error) {
+	// Sessions scoped to a dataset reach no other, whatever the user's roles
+	if user.Scope != "" {
+		return datasetID == user.Scope, nil
+	}
+
 	userTags := user.Entity.GetTagsWithoutTimestamp()
 	
 	// Admin users have access to all datasets
@@ -666,10 +729,17 @@ func (sm *SecurityManager) CanAccessDataset(user *SecurityUser, datasetID string
 	}
 	
 	// Check for specific dataset access tags (can be implemented later)
-	// For now, regular users have access to default dataset
+	// For now, regular users have access to default dataset, their own and
+	// those they hold permissions in
 	if datasetID == "default" || datasetID == "" {
 		return true, nil
 	}
+	if dataset, _ := UserDefaultDataset(user.Entity); dataset != "" && dataset == datasetID {
+		return true, nil
+	}
+	if len(DatasetPermissions(user.Entity, datasetID)) > 0 {
+		return true, nil
+	}
 	
 	return false, nil
 }
@@ -727,6 +797,28 @@ func (sm *SecurityManager) InvalidateSession(token string) error {
 	return nil
 }
 
+// RevokeUserSessions invalidates every active session of a user and
+// returns how many were revoked
+func (sm *SecurityManager) RevokeUserSessions(userID string) (int, error) {
+	sessions, err := sm.entityRepo.ListByTag("authenticated_as:" + userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find sessions: %v", err)
+	}
+	revoked := 0
+	for _, session := range sessions {
+		token := session.GetTagValue("token")
+		if token == "" || session.HasTag("status:invalidated") {
+			continue
+		}
+		if err := sm.InvalidateSession(token); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	sm.ForgetUserSessions(userID)
+	return revoked, nil
+}
+
 // RefreshSession extends the expiration time of an existing session
 func (sm *SecurityManager) RefreshSession(token string) (*SecuritySession, error) {
 	logger.TraceIf("auth", "refreshing session with token prefix: %s", token[:8])
@@ -865,6 +957,27 @@ func generateSalt() string {
 	return hex.EncodeToString(bytes)
 }
 
+// CredentialContent returns the salt|hash content that stores a password on
+// a user entity, in the format AuthenticateUser verifies
+func CredentialContent(password string) ([]byte, error) {
+	salt := generateSalt()
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password+salt), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %v", err)
+	}
+	return []byte(salt + "|" + string(hashedPassword)), nil
+}
+
+// VerifyCredentialContent reports whether password matches credential
+// content written by CredentialContent
+func VerifyCredentialContent(content []byte, password string) bool {
+	parts := strings.SplitN(string(content), "|", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(parts[1]), []byte(password+parts[0])) == nil
+}
+
 // min returns the smaller of two integers
 func min(a, b int) int {
 	if a < b {
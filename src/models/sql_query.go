@@ -0,0 +1,1090 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrSQLReadOnly is returned for statements that would modify data; the SQL
+// gateway only reads
+var ErrSQLReadOnly = errors.New("only SELECT statements are supported: the SQL gateway is read-only")
+
+// SQLStatementKind classifies a statement of the SQL gateway dialect
+type SQLStatementKind int
+
+const (
+	// SQLStatementEmpty is a statement without tokens, such as ";"
+	SQLStatementEmpty SQLStatementKind = iota
+	// SQLStatementSelect is a SELECT query
+	SQLStatementSelect
+	// SQLStatementSet changes a session setting
+	SQLStatementSet
+	// SQLStatementShow reads a session setting
+	SQLStatementShow
+	// SQLStatementTransaction is BEGIN, COMMIT, ROLLBACK and the like,
+	// which have no effect on a read-only session
+	SQLStatementTransaction
+)
+
+// SQLStatement is a parsed statement
+type SQLStatement struct {
+	Kind   SQLStatementKind
+	Select *SQLSelect
+	// Setting is the lowercased variable of a SET or SHOW, and Value the
+	// value a SET gives it
+	Setting string
+	Value   string
+	// Command is the command tag of a SET or transaction statement
+	Command string
+}
+
+// SQLValueKind is the type of a literal
+type SQLValueKind int
+
+const (
+	SQLNull SQLValueKind = iota
+	SQLString
+	SQLNumber
+	SQLBool
+)
+
+// SQLValue is a literal or bound parameter. Text holds the string, the
+// number as written, or "true" and "false".
+type SQLValue struct {
+	Kind SQLValueKind
+	Text string
+}
+
+// SQLAggregates are the aggregate functions a select item may apply
+var SQLAggregates = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+// SQLSelectItem is an item of a select list
+type SQLSelectItem struct {
+	// Column is the column read, "*" for COUNT(*), empty for a literal or
+	// function call
+	Column string
+	// Aggregate is count, sum, avg, min or max
+	Aggregate string
+	// Distinct counts distinct values: COUNT(DISTINCT column)
+	Distinct bool
+	// Trunc is the unit of date_trunc(unit, column)
+	Trunc string
+	// Function is a function without arguments, such as version()
+	Function string
+	Literal  *SQLValue
+	Alias    string
+}
+
+// Name is the result column name of the item
+func (item SQLSelectItem) Name() string {
+	switch {
+	case item.Alias != "":
+		return item.Alias
+	case item.Aggregate != "":
+		return item.Aggregate
+	case item.Trunc != "":
+		return "date_trunc"
+	case item.Function != "":
+		return item.Function
+	case item.Literal != nil:
+		return "?column?"
+	default:
+		return item.Column
+	}
+}
+
+// SQLConditionOp is the operator of a WHERE condition node
+type SQLConditionOp int
+
+const (
+	SQLAnd SQLConditionOp = iota
+	SQLOr
+	SQLNot
+	// SQLCompare compares Column with Values[0] using Operator: = != < <= > >=
+	SQLCompare
+	// SQLIn matches Column against any of Values
+	SQLIn
+	// SQLLike matches Column against the pattern Values[0]; Operator is
+	// like or ilike
+	SQLLike
+	// SQLIsNull matches a missing Column
+	SQLIsNull
+	// SQLBetween matches Column within Values[0] and Values[1] inclusive
+	SQLBetween
+)
+
+// SQLCondition is a node of a WHERE condition tree. And and Or combine Left
+// and Right, Not negates Left; the other operators test a column, negated
+// by Negated (NOT IN, NOT LIKE, IS NOT NULL, NOT BETWEEN).
+type SQLCondition struct {
+	Op          SQLConditionOp
+	Left, Right *SQLCondition
+	Column      string
+	Operator    string
+	Values      []SQLValue
+	Negated     bool
+}
+
+// SQLOrder is an ORDER BY term naming a column or alias, or a 1-based
+// position in the select list
+type SQLOrder struct {
+	Column   string
+	Position int
+	Desc     bool
+}
+
+// SQLSelect is a parsed SELECT query over one table
+type SQLSelect struct {
+	Distinct bool
+	// Star selects every column of the table
+	Star  bool
+	Items []SQLSelectItem
+	// Table is the lowercased table name, prefixed by its schema outside
+	// the public schema, or empty without FROM
+	Table string
+	Where *SQLCondition
+	// GroupBy holds column names, aliases or 1-based positions as text
+	GroupBy []string
+	OrderBy []SQLOrder
+	// Limit is -1 without LIMIT
+	Limit  int
+	Offset int
+}
+
+// ParseSQL parses a statement of the SQL gateway dialect: a subset of
+// PostgreSQL SELECT over a single table, with WHERE, GROUP BY, ORDER BY,
+// LIMIT and OFFSET. Unquoted identifiers are folded to lower case.
+// Placeholders $1, $2... take the values of args, or NULL beyond them.
+func ParseSQL(text string, args []SQLValue) (*SQLStatement, error) {
+	tokens, err := tokenizeSQL(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens, args: args}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	p.accept(";")
+	if !p.at(sqlTokenEOF) {
+		return nil, p.errorf("unexpected %s", p.peek())
+	}
+	return stmt, nil
+}
+
+// SplitSQLStatements splits text on the semicolons outside quotes and
+// comments, dropping blank statements
+func SplitSQLStatements(text string) []string {
+	var statements []string
+	start := 0
+	flush := func(end int) {
+		if statement := strings.TrimSpace(text[start:end]); statement != "" {
+			statements = append(statements, statement)
+		}
+		start = end + 1
+	}
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\'' || c == '"':
+			for i++; i < len(text); i++ {
+				if text[i] == c {
+					if i+1 < len(text) && text[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case c == '-' && i+1 < len(text) && text[i+1] == '-':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(text) && text[i+1] == '*':
+			if end := strings.Index(text[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(text)
+			}
+		case c == ';':
+			flush(i)
+		}
+	}
+	if start < len(text) {
+		flush(len(text))
+	}
+	return statements
+}
+
+// SQLParameterCount returns the highest placeholder $n of a statement, the
+// number of parameters it takes
+func SQLParameterCount(text string) int {
+	tokens, err := tokenizeSQL(text)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, token := range tokens {
+		if token.kind != sqlTokenParam {
+			continue
+		}
+		if n, err := strconv.Atoi(token.text); err == nil && n > count {
+			count = n
+		}
+	}
+	return count
+}
+
+type sqlTokenKind int
+
+const (
+	sqlTokenEOF sqlTokenKind = iota
+	sqlTokenIdent
+	sqlTokenQuotedIdent
+	sqlTokenString
+	sqlTokenNumber
+	sqlTokenParam
+	sqlTokenSymbol
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+}
+
+func (t sqlToken) String() string {
+	switch t.kind {
+	case sqlTokenEOF:
+		return "end of statement"
+	case sqlTokenString:
+		return "'" + t.text + "'"
+	default:
+		return `"` + t.text + `"`
+	}
+}
+
+// sqlSymbols are the operators and punctuation, two-character ones first
+var sqlSymbols = []string{"<=", ">=", "<>", "!=", "::", "=", "<", ">", "(", ")", ",", "*", ".", ";", "-", "+"}
+
+// tokenizeSQL splits a statement into tokens
+func tokenizeSQL(text string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	i := 0
+	for i < len(text) {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(text[i:], "--"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment at position %d", i+1)
+			}
+			i += end + 4
+		case c == '\'' || c == '"':
+			start := i
+			var value strings.Builder
+			for i++; ; i++ {
+				if i >= len(text) {
+					return nil, fmt.Errorf("unterminated quoted string at position %d", start+1)
+				}
+				if text[i] == c {
+					if i+1 < len(text) && text[i+1] == c {
+						value.WriteByte(c)
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				value.WriteByte(text[i])
+			}
+			kind := sqlTokenString
+			if c == '"' {
+				kind = sqlTokenQuotedIdent
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: value.String(), pos: start})
+		case isSQLIdentStart(c):
+			start := i
+			for i < len(text) && (isSQLIdentStart(text[i]) || isSQLDigit(text[i]) || text[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenIdent, text: strings.ToLower(text[start:i]), pos: start})
+		case isSQLDigit(c) || (c == '.' && i+1 < len(text) && isSQLDigit(text[i+1])):
+			start := i
+			for i < len(text) && (isSQLDigit(text[i]) || text[i] == '.') {
+				i++
+			}
+			if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
+				i++
+				if i < len(text) && (text[i] == '+' || text[i] == '-') {
+					i++
+				}
+				for i < len(text) && isSQLDigit(text[i]) {
+					i++
+				}
+			}
+			number := text[start:i]
+			if _, err := strconv.ParseFloat(number, 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", number, start+1)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenNumber, text: number, pos: start})
+		case c == '$' && i+1 < len(text) && isSQLDigit(text[i+1]):
+			start := i
+			for i++; i < len(text) && isSQLDigit(text[i]); i++ {
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenParam, text: text[start+1 : i], pos: start})
+		default:
+			matched := false
+			for _, symbol := range sqlSymbols {
+				if strings.HasPrefix(text[i:], symbol) {
+					tokens = append(tokens, sqlToken{kind: sqlTokenSymbol, text: symbol, pos: i})
+					i += len(symbol)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i+1)
+			}
+		}
+	}
+	return append(tokens, sqlToken{kind: sqlTokenEOF, pos: len(text)}), nil
+}
+
+func isSQLIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isSQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// sqlReserved are the keywords that end a select item or table reference,
+// so they are never taken as an alias
+var sqlReserved = map[string]bool{
+	"select": true, "from": true, "where": true, "group": true, "order": true, "by": true,
+	"limit": true, "offset": true, "and": true, "or": true, "not": true, "as": true,
+	"asc": true, "desc": true, "in": true, "like": true, "ilike": true, "is": true,
+	"null": true, "between": true, "distinct": true, "having": true, "join": true,
+	"union": true, "on": true, "nulls": true,
+}
+
+// sqlWriteCommands are statements refused as read-only rather than as
+// syntax errors
+var sqlWriteCommands = map[string]bool{
+	"insert": true, "update": true, "delete": true, "create": true, "drop": true,
+	"alter": true, "truncate": true, "grant": true, "revoke": true, "copy": true,
+	"merge": true, "upsert": true, "replace": true, "vacuum": true, "comment": true,
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+	args   []SQLValue
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sqlParser) next() sqlToken {
+	token := p.tokens[p.pos]
+	if token.kind != sqlTokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *sqlParser) at(kind sqlTokenKind) bool {
+	return p.peek().kind == kind
+}
+
+// atKeyword reports whether the next token is the unquoted keyword
+func (p *sqlParser) atKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == sqlTokenIdent && token.text == keyword
+}
+
+// acceptKeyword consumes the keyword if it is next
+func (p *sqlParser) acceptKeyword(keyword string) bool {
+	if p.atKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// accept consumes the symbol if it is next
+func (p *sqlParser) accept(symbol string) bool {
+	token := p.peek()
+	if token.kind == sqlTokenSymbol && token.text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorf("expected %s, found %s", strings.ToUpper(keyword), p.peek())
+	}
+	return nil
+}
+
+func (p *sqlParser) expect(symbol string) error {
+	if !p.accept(symbol) {
+		return p.errorf("expected %q, found %s", symbol, p.peek())
+	}
+	return nil
+}
+
+func (p *sqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("syntax error at position %d: %s", p.peek().pos+1, fmt.Sprintf(format, args...))
+}
+
+// identifier consumes an unreserved identifier
+func (p *sqlParser) identifier() (string, error) {
+	token := p.peek()
+	if token.kind == sqlTokenQuotedIdent || (token.kind == sqlTokenIdent && !sqlReserved[token.text]) {
+		p.pos++
+		return token.text, nil
+	}
+	return "", p.errorf("expected an identifier, found %s", token)
+}
+
+func (p *sqlParser) statement() (*SQLStatement, error) {
+	if p.at(sqlTokenEOF) || p.accept(";") {
+		return &SQLStatement{Kind: SQLStatementEmpty}, nil
+	}
+	token := p.peek()
+	if token.kind != sqlTokenIdent {
+		return nil, p.errorf("unexpected %s", token)
+	}
+	switch token.text {
+	case "select":
+		p.pos++
+		query, err := p.selectQuery()
+		if err != nil {
+			return nil, err
+		}
+		return &SQLStatement{Kind: SQLStatementSelect, Select: query}, nil
+	case "set":
+		p.pos++
+		return p.setStatement()
+	case "show":
+		p.pos++
+		setting, err := p.settingName()
+		if err != nil {
+			return nil, err
+		}
+		return &SQLStatement{Kind: SQLStatementShow, Setting: setting}, nil
+	case "begin", "start", "commit", "end", "rollback", "abort", "discard", "deallocate", "reset":
+		p.pos++
+		for !p.at(sqlTokenEOF) && !(p.peek().kind == sqlTokenSymbol && p.peek().text == ";") {
+			p.pos++
+		}
+		command := strings.ToUpper(token.text)
+		switch token.text {
+		case "start":
+			command = "START TRANSACTION"
+		case "end":
+			command = "COMMIT"
+		case "abort":
+			command = "ROLLBACK"
+		case "discard":
+			command = "DISCARD ALL"
+		}
+		return &SQLStatement{Kind: SQLStatementTransaction, Command: command}, nil
+	}
+	if sqlWriteCommands[token.text] {
+		return nil, ErrSQLReadOnly
+	}
+	return nil, p.errorf("unsupported statement %s", strings.ToUpper(token.text))
+}
+
+// setStatement parses SET [SESSION | LOCAL] name {= | TO} value and
+// SET TIME ZONE value
+func (p *sqlParser) setStatement() (*SQLStatement, error) {
+	if !p.acceptKeyword("session") {
+		p.acceptKeyword("local")
+	}
+	var setting string
+	if p.acceptKeyword("time") {
+		if err := p.expectKeyword("zone"); err != nil {
+			return nil, err
+		}
+		setting = "timezone"
+	} else {
+		name, err := p.settingName()
+		if err != nil {
+			return nil, err
+		}
+		setting = name
+		if !p.accept("=") && !p.acceptKeyword("to") {
+			return nil, p.errorf("expected = or TO, found %s", p.peek())
+		}
+	}
+	var values []string
+	for !p.at(sqlTokenEOF) && !(p.peek().kind == sqlTokenSymbol && p.peek().text == ";") {
+		token := p.next()
+		if token.kind == sqlTokenSymbol && token.text == "," {
+			continue
+		}
+		values = append(values, token.text)
+	}
+	if len(values) == 0 {
+		return nil, p.errorf("SET %s needs a value", setting)
+	}
+	return &SQLStatement{Kind: SQLStatementSet, Setting: setting, Value: strings.Join(values, ", "), Command: "SET"}, nil
+}
+
+// settingName parses a possibly dotted configuration parameter name
+func (p *sqlParser) settingName() (string, error) {
+	token := p.next()
+	if token.kind != sqlTokenIdent && token.kind != sqlTokenQuotedIdent {
+		return "", p.errorf("expected a parameter name, found %s", token)
+	}
+	name := strings.ToLower(token.text)
+	if name == "time" && p.acceptKeyword("zone") {
+		return "timezone", nil
+	}
+	for p.accept(".") {
+		part := p.next()
+		if part.kind != sqlTokenIdent && part.kind != sqlTokenQuotedIdent {
+			return "", p.errorf("expected a parameter name, found %s", part)
+		}
+		name += "." + strings.ToLower(part.text)
+	}
+	return name, nil
+}
+
+func (p *sqlParser) selectQuery() (*SQLSelect, error) {
+	query := &SQLSelect{Limit: -1}
+	query.Distinct = p.acceptKeyword("distinct")
+	if !query.Distinct {
+		p.acceptKeyword("all")
+	}
+
+	if p.accept("*") {
+		query.Star = true
+	} else {
+		for {
+			item, err := p.selectItem()
+			if err != nil {
+				return nil, err
+			}
+			query.Items = append(query.Items, item)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("from") {
+		table, err := p.tableReference()
+		if err != nil {
+			return nil, err
+		}
+		query.Table = table
+		if p.accept(",") || p.atKeyword("join") || p.atKeyword("inner") || p.atKeyword("left") || p.atKeyword("cross") {
+			return nil, p.errorf("joins are not supported; query one table at a time")
+		}
+	} else if query.Star {
+		return nil, p.errorf("SELECT * needs a FROM clause")
+	}
+
+	if p.acceptKeyword("where") {
+		condition, err := p.orCondition()
+		if err != nil {
+			return nil, err
+		}
+		query.Where = condition
+	}
+
+	if p.acceptKeyword("group") {
+		if err := p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			term, err := p.groupTerm()
+			if err != nil {
+				return nil, err
+			}
+			query.GroupBy = append(query.GroupBy, term)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.atKeyword("having") {
+		return nil, p.errorf("HAVING is not supported")
+	}
+
+	if p.acceptKeyword("order") {
+		if err := p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			order, err := p.orderTerm()
+			if err != nil {
+				return nil, err
+			}
+			query.OrderBy = append(query.OrderBy, order)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	// LIMIT and OFFSET may come in either order
+	for {
+		switch {
+		case p.acceptKeyword("limit"):
+			if p.acceptKeyword("all") {
+				continue
+			}
+			limit, err := p.count("LIMIT")
+			if err != nil {
+				return nil, err
+			}
+			query.Limit = limit
+		case p.acceptKeyword("offset"):
+			offset, err := p.count("OFFSET")
+			if err != nil {
+				return nil, err
+			}
+			if offset < 0 {
+				offset = 0
+			}
+			query.Offset = offset
+			if !p.acceptKeyword("rows") {
+				p.acceptKeyword("row")
+			}
+		default:
+			return query, nil
+		}
+	}
+}
+
+// count parses the non-negative integer of LIMIT or OFFSET; a NULL
+// parameter yields -1
+func (p *sqlParser) count(clause string) (int, error) {
+	value, err := p.literal()
+	if err != nil {
+		return 0, err
+	}
+	if value.Kind == SQLNull {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(value.Text)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", clause)
+	}
+	return n, nil
+}
+
+// tableReference parses [schema.]table [[AS] alias]
+func (p *sqlParser) tableReference() (string, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return "", err
+	}
+	if p.accept(".") {
+		table, err := p.identifier()
+		if err != nil {
+			return "", err
+		}
+		if name != "public" {
+			table = name + "." + table
+		}
+		name = table
+	}
+	if p.acceptKeyword("as") {
+		if _, err := p.identifier(); err != nil {
+			return "", err
+		}
+	} else if token := p.peek(); token.kind == sqlTokenQuotedIdent || (token.kind == sqlTokenIdent && !sqlReserved[token.text] &&
+		token.text != "inner" && token.text != "left" && token.text != "cross") {
+		p.pos++
+	}
+	return name, nil
+}
+
+// columnName parses a column, dropping a table qualifier
+func (p *sqlParser) columnName() (string, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return "", err
+	}
+	if p.accept(".") {
+		if name, err = p.identifier(); err != nil {
+			return "", err
+		}
+	}
+	p.skipCast()
+	return name, nil
+}
+
+// skipCast drops a PostgreSQL ::type cast, which BI tools add freely; values
+// are converted by the comparisons instead
+func (p *sqlParser) skipCast() {
+	for p.accept("::") {
+		p.next()
+		for p.peek().kind == sqlTokenIdent && (p.peek().text == "zone" || p.peek().text == "time" ||
+			p.peek().text == "with" || p.peek().text == "without" || p.peek().text == "precision" || p.peek().text == "varying") {
+			p.pos++
+		}
+	}
+}
+
+func (p *sqlParser) selectItem() (SQLSelectItem, error) {
+	var item SQLSelectItem
+	token := p.peek()
+	switch {
+	case token.kind == sqlTokenIdent && p.tokens[p.pos+1].kind == sqlTokenSymbol && p.tokens[p.pos+1].text == "(":
+		p.pos += 2
+		if err := p.functionCall(token.text, &item); err != nil {
+			return item, err
+		}
+		p.skipCast()
+	case token.kind == sqlTokenIdent && (token.text == "current_user" || token.text == "session_user" ||
+		token.text == "current_schema" || token.text == "current_catalog" || token.text == "user"):
+		p.pos++
+		item.Function = token.text
+	case token.kind == sqlTokenIdent && sqlReserved[token.text] && token.text != "null":
+		return item, p.errorf("unexpected %s", token)
+	case token.kind == sqlTokenIdent && token.text != "null" && token.text != "true" && token.text != "false",
+		token.kind == sqlTokenQuotedIdent:
+		column, err := p.columnName()
+		if err != nil {
+			return item, err
+		}
+		item.Column = column
+	default:
+		value, err := p.literal()
+		if err != nil {
+			return item, err
+		}
+		item.Literal = &value
+	}
+
+	if p.acceptKeyword("as") {
+		alias, err := p.aliasName()
+		if err != nil {
+			return item, err
+		}
+		item.Alias = alias
+	} else if token := p.peek(); token.kind == sqlTokenQuotedIdent || (token.kind == sqlTokenIdent && !sqlReserved[token.text]) {
+		p.pos++
+		item.Alias = token.text
+	}
+	return item, nil
+}
+
+// aliasName parses an alias, which may be a keyword after AS
+func (p *sqlParser) aliasName() (string, error) {
+	token := p.peek()
+	if token.kind == sqlTokenIdent || token.kind == sqlTokenQuotedIdent {
+		p.pos++
+		return token.text, nil
+	}
+	return "", p.errorf("expected an alias, found %s", token)
+}
+
+// functionCall parses the arguments of an aggregate, date_trunc or a
+// function without arguments, after the opening parenthesis
+func (p *sqlParser) functionCall(name string, item *SQLSelectItem) error {
+	switch {
+	case SQLAggregates[name]:
+		item.Aggregate = name
+		if name == "count" && p.accept("*") {
+			item.Column = "*"
+		} else {
+			item.Distinct = p.acceptKeyword("distinct")
+			column, err := p.columnName()
+			if err != nil {
+				return err
+			}
+			item.Column = column
+		}
+	case name == "date_trunc":
+		unit, err := p.literal()
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(unit.Text) {
+		case "second", "minute", "hour", "day", "week", "month", "year":
+			item.Trunc = strings.ToLower(unit.Text)
+		default:
+			return fmt.Errorf("date_trunc unit %q is not supported", unit.Text)
+		}
+		if err := p.expect(","); err != nil {
+			return err
+		}
+		column, err := p.columnName()
+		if err != nil {
+			return err
+		}
+		item.Column = column
+	default:
+		item.Function = name
+	}
+	return p.expect(")")
+}
+
+// groupTerm parses a GROUP BY column, alias or position
+func (p *sqlParser) groupTerm() (string, error) {
+	if p.at(sqlTokenNumber) {
+		return p.next().text, nil
+	}
+	if p.atKeyword("date_trunc") {
+		return "", p.errorf("group by the alias or position of a date_trunc item")
+	}
+	return p.columnName()
+}
+
+// orderTerm parses an ORDER BY column, alias or position and direction
+func (p *sqlParser) orderTerm() (SQLOrder, error) {
+	var order SQLOrder
+	if p.at(sqlTokenNumber) {
+		position, err := strconv.Atoi(p.next().text)
+		if err != nil || position < 1 {
+			return order, fmt.Errorf("ORDER BY position must be a positive integer")
+		}
+		order.Position = position
+	} else {
+		column, err := p.columnName()
+		if err != nil {
+			return order, err
+		}
+		order.Column = column
+	}
+	if p.acceptKeyword("desc") {
+		order.Desc = true
+	} else {
+		p.acceptKeyword("asc")
+	}
+	if p.acceptKeyword("nulls") {
+		if !p.acceptKeyword("first") && !p.acceptKeyword("last") {
+			return order, p.errorf("expected FIRST or LAST, found %s", p.peek())
+		}
+	}
+	return order, nil
+}
+
+func (p *sqlParser) orCondition() (*SQLCondition, error) {
+	left, err := p.andCondition()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		right, err := p.andCondition()
+		if err != nil {
+			return nil, err
+		}
+		left = &SQLCondition{Op: SQLOr, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) andCondition() (*SQLCondition, error) {
+	left, err := p.notCondition()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("and") {
+		right, err := p.notCondition()
+		if err != nil {
+			return nil, err
+		}
+		left = &SQLCondition{Op: SQLAnd, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) notCondition() (*SQLCondition, error) {
+	if p.acceptKeyword("not") {
+		operand, err := p.notCondition()
+		if err != nil {
+			return nil, err
+		}
+		return &SQLCondition{Op: SQLNot, Left: operand}, nil
+	}
+	if p.accept("(") {
+		condition, err := p.orCondition()
+		if err != nil {
+			return nil, err
+		}
+		return condition, p.expect(")")
+	}
+	return p.predicate()
+}
+
+// sqlFlipped mirrors a comparison for literal-first predicates
+var sqlFlipped = map[string]string{"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// predicate parses a test of a column: a comparison, [NOT] IN, [NOT] LIKE,
+// IS [NOT] NULL or [NOT] BETWEEN. A comparison may put the literal first.
+func (p *sqlParser) predicate() (*SQLCondition, error) {
+	if !p.at(sqlTokenIdent) && !p.at(sqlTokenQuotedIdent) || p.atKeyword("null") || p.atKeyword("true") || p.atKeyword("false") {
+		value, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		operator, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		column, err := p.columnName()
+		if err != nil {
+			return nil, err
+		}
+		return &SQLCondition{Op: SQLCompare, Column: column, Operator: sqlFlipped[operator], Values: []SQLValue{value}}, nil
+	}
+
+	column, err := p.columnName()
+	if err != nil {
+		return nil, err
+	}
+	condition := &SQLCondition{Column: column}
+
+	if p.acceptKeyword("is") {
+		condition.Op = SQLIsNull
+		condition.Negated = p.acceptKeyword("not")
+		return condition, p.expectKeyword("null")
+	}
+	condition.Negated = p.acceptKeyword("not")
+	switch {
+	case p.acceptKeyword("in"):
+		condition.Op = SQLIn
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for {
+			value, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			condition.Values = append(condition.Values, value)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return condition, p.expect(")")
+	case p.atKeyword("like") || p.atKeyword("ilike"):
+		condition.Op = SQLLike
+		condition.Operator = p.next().text
+		value, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		condition.Values = []SQLValue{value}
+		return condition, nil
+	case p.acceptKeyword("between"):
+		condition.Op = SQLBetween
+		low, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("and"); err != nil {
+			return nil, err
+		}
+		high, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		condition.Values = []SQLValue{low, high}
+		return condition, nil
+	case condition.Negated:
+		return nil, p.errorf("expected IN, LIKE or BETWEEN after NOT, found %s", p.peek())
+	}
+
+	operator, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	condition.Op = SQLCompare
+	condition.Operator = operator
+	condition.Values = []SQLValue{value}
+	return condition, nil
+}
+
+// comparison parses a comparison operator, normalizing <> to !=
+func (p *sqlParser) comparison() (string, error) {
+	token := p.peek()
+	if token.kind == sqlTokenSymbol {
+		switch token.text {
+		case "=", "!=", "<", "<=", ">", ">=":
+			p.pos++
+			return token.text, nil
+		case "<>":
+			p.pos++
+			return "!=", nil
+		}
+	}
+	return "", p.errorf("expected a comparison operator, found %s", token)
+}
+
+// literal parses a string, number, boolean, NULL or placeholder, with an
+// optional sign, type prefix such as TIMESTAMP '...', or ::type cast
+func (p *sqlParser) literal() (SQLValue, error) {
+	token := p.peek()
+	if token.kind == sqlTokenIdent && p.tokens[p.pos+1].kind == sqlTokenString {
+		switch token.text {
+		case "timestamp", "timestamptz", "date", "time", "interval", "text", "varchar":
+			p.pos++
+			token = p.peek()
+		}
+	}
+
+	var value SQLValue
+	switch token.kind {
+	case sqlTokenString:
+		value = SQLValue{Kind: SQLString, Text: token.text}
+	case sqlTokenNumber:
+		value = SQLValue{Kind: SQLNumber, Text: token.text}
+	case sqlTokenParam:
+		index, err := strconv.Atoi(token.text)
+		if err != nil || index < 1 {
+			return value, p.errorf("invalid parameter $%s", token.text)
+		}
+		if index <= len(p.args) {
+			value = p.args[index-1]
+		}
+	case sqlTokenSymbol:
+		if token.text != "-" && token.text != "+" {
+			return value, p.errorf("expected a value, found %s", token)
+		}
+		p.pos++
+		number := p.peek()
+		if number.kind != sqlTokenNumber {
+			return value, p.errorf("expected a number, found %s", number)
+		}
+		value = SQLValue{Kind: SQLNumber, Text: strings.TrimPrefix(token.text, "+") + number.text}
+	case sqlTokenIdent:
+		switch token.text {
+		case "null":
+			value = SQLValue{Kind: SQLNull}
+		case "true", "false":
+			value = SQLValue{Kind: SQLBool, Text: token.text}
+		default:
+			return value, p.errorf("expected a value, found %s", token)
+		}
+	default:
+		return value, p.errorf("expected a value, found %s", token)
+	}
+	p.pos++
+	p.skipCast()
+	return value, nil
+}
@@ -0,0 +1,138 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestParseSQLSelect checks the clauses of a SELECT parse into the query
+func TestParseSQLSelect(t *testing.T) {
+	stmt, err := models.ParseSQL(`SELECT type, date_trunc('hour', e.created_at) AS "Time", COUNT(*) n
+		FROM public.entities e
+		WHERE dataset = 'prod' AND (status IN ('open', 'blocked') OR priority >= 3) AND NOT title LIKE 'tmp%'
+		GROUP BY 1, "Time" ORDER BY n DESC, 2 LIMIT 10 OFFSET 5;`, nil)
+	if err != nil {
+		t.Fatalf("ParseSQL: %v", err)
+	}
+	if stmt.Kind != models.SQLStatementSelect {
+		t.Fatalf("Kind = %v, want select", stmt.Kind)
+	}
+	query := stmt.Select
+	if query.Table != "entities" {
+		t.Errorf("Table = %q, want entities", query.Table)
+	}
+	if len(query.Items) != 3 {
+		t.Fatalf("%d items, want 3", len(query.Items))
+	}
+	if item := query.Items[1]; item.Trunc != "hour" || item.Column != "created_at" || item.Name() != "Time" {
+		t.Errorf("date_trunc item = %+v", item)
+	}
+	if item := query.Items[2]; item.Aggregate != "count" || item.Column != "*" || item.Name() != "n" {
+		t.Errorf("count item = %+v", item)
+	}
+	if len(query.GroupBy) != 2 || query.GroupBy[0] != "1" || query.GroupBy[1] != "Time" {
+		t.Errorf("GroupBy = %v", query.GroupBy)
+	}
+	if len(query.OrderBy) != 2 || !query.OrderBy[0].Desc || query.OrderBy[0].Column != "n" || query.OrderBy[1].Position != 2 {
+		t.Errorf("OrderBy = %+v", query.OrderBy)
+	}
+	if query.Limit != 10 || query.Offset != 5 {
+		t.Errorf("Limit, Offset = %d, %d, want 10, 5", query.Limit, query.Offset)
+	}
+
+	// dataset = 'prod' AND (...) AND NOT ...
+	where := query.Where
+	if where.Op != models.SQLAnd || where.Right.Op != models.SQLNot || where.Right.Left.Op != models.SQLLike {
+		t.Fatalf("WHERE tree = %+v", where)
+	}
+	if first := where.Left.Left; first.Op != models.SQLCompare || first.Column != "dataset" || first.Values[0].Text != "prod" {
+		t.Errorf("first condition = %+v", first)
+	}
+	if or := where.Left.Right; or.Op != models.SQLOr || len(or.Left.Values) != 2 || or.Right.Operator != ">=" {
+		t.Errorf("OR condition = %+v", or)
+	}
+}
+
+// TestParseSQLLiterals checks parameters, casts, flipped comparisons and
+// the NULL and BETWEEN predicates
+func TestParseSQLLiterals(t *testing.T) {
+	args := []models.SQLValue{{Kind: models.SQLString, Text: "2026-01-01"}}
+	stmt, err := models.ParseSQL(`select id from history where timestamp between $1 and '2026-02-01'::timestamptz
+		and 10 < "Score" and value is not null and id = -1.5e2 limit $2`, args)
+	if err != nil {
+		t.Fatalf("ParseSQL: %v", err)
+	}
+	query := stmt.Select
+	if query.Limit != -1 {
+		t.Errorf("Limit = %d, want -1 for a NULL parameter", query.Limit)
+	}
+
+	var conditions []*models.SQLCondition
+	var collect func(c *models.SQLCondition)
+	collect = func(c *models.SQLCondition) {
+		if c.Op == models.SQLAnd {
+			collect(c.Left)
+			collect(c.Right)
+			return
+		}
+		conditions = append(conditions, c)
+	}
+	collect(query.Where)
+	if len(conditions) != 4 {
+		t.Fatalf("%d conditions, want 4", len(conditions))
+	}
+	if between := conditions[0]; between.Op != models.SQLBetween || between.Values[0].Text != "2026-01-01" || between.Values[1].Text != "2026-02-01" {
+		t.Errorf("BETWEEN = %+v", between)
+	}
+	if flipped := conditions[1]; flipped.Column != "Score" || flipped.Operator != ">" || flipped.Values[0].Text != "10" {
+		t.Errorf("flipped comparison = %+v", flipped)
+	}
+	if null := conditions[2]; null.Op != models.SQLIsNull || !null.Negated {
+		t.Errorf("IS NOT NULL = %+v", null)
+	}
+	if number := conditions[3]; number.Values[0].Kind != models.SQLNumber || number.Values[0].Text != "-1.5e2" {
+		t.Errorf("number = %+v", number.Values[0])
+	}
+	if n := models.SQLParameterCount(`select id from tags where tag = $2 and type = '$9'`); n != 2 {
+		t.Errorf("SQLParameterCount = %d, want 2", n)
+	}
+}
+
+// TestParseSQLStatements checks the statements besides SELECT and the
+// errors of unsupported ones
+func TestParseSQLStatements(t *testing.T) {
+	set, err := models.ParseSQL("SET extra_float_digits = 3", nil)
+	if err != nil || set.Kind != models.SQLStatementSet || set.Setting != "extra_float_digits" || set.Value != "3" {
+		t.Errorf("SET = %+v, %v", set, err)
+	}
+	show, err := models.ParseSQL("SHOW TIME ZONE", nil)
+	if err != nil || show.Kind != models.SQLStatementShow || show.Setting != "timezone" {
+		t.Errorf("SHOW = %+v, %v", show, err)
+	}
+	begin, err := models.ParseSQL("START TRANSACTION READ ONLY", nil)
+	if err != nil || begin.Kind != models.SQLStatementTransaction || begin.Command != "START TRANSACTION" {
+		t.Errorf("START TRANSACTION = %+v, %v", begin, err)
+	}
+
+	if _, err := models.ParseSQL("DELETE FROM entities", nil); !errors.Is(err, models.ErrSQLReadOnly) {
+		t.Errorf("DELETE error = %v, want ErrSQLReadOnly", err)
+	}
+	for _, text := range []string{
+		"SELECT * FROM entities JOIN tags ON id = entity_id",
+		"SELECT id FROM entities WHERE",
+		"SELECT 'unterminated",
+		"SELECT id FROM entities LIMIT -1",
+		"SELECT *",
+	} {
+		if _, err := models.ParseSQL(text, nil); err == nil {
+			t.Errorf("ParseSQL(%q) succeeded", text)
+		}
+	}
+
+	statements := models.SplitSQLStatements("SELECT 1; SELECT 'a;b' -- c;\n; /* ; */ SHOW x")
+	if len(statements) != 3 || statements[1] != "SELECT 'a;b' -- c;" {
+		t.Errorf("SplitSQLStatements = %q", statements)
+	}
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A user's default dataset is kept in profile:default_dataset:<name>. Users
+// also tagged profile:dataset_restricted are confined to it: every session
+// they open is scoped to the default dataset, whatever they ask for. Other
+// users may scope a session at login to any dataset they can access; the
+// session then carries scope:dataset:<name>.
+const (
+	DefaultDatasetTagPrefix = "profile:default_dataset:"
+	DatasetRestrictedTag    = "profile:dataset_restricted"
+	SessionScopeTagPrefix   = "scope:dataset:"
+)
+
+var datasetNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+var (
+	// ErrInvalidScope is returned for scopes that are not a dataset name
+	ErrInvalidScope = errors.New("invalid session scope")
+	// ErrScopeNotAllowed is returned when a user may not scope a session to
+	// a dataset
+	ErrScopeNotAllowed = errors.New("session scope not allowed")
+)
+
+// UserDefaultDataset returns the user's default dataset, if any, and
+// whether the user is confined to it
+func UserDefaultDataset(entity *Entity) (dataset string, restricted bool) {
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, DefaultDatasetTagPrefix) {
+			dataset = strings.TrimPrefix(tag, DefaultDatasetTagPrefix)
+		} else if tag == DatasetRestrictedTag {
+			restricted = true
+		}
+	}
+	return dataset, restricted && dataset != ""
+}
+
+// userScope returns the dataset a session of the user is confined to: the
+// session's own scope, or else the default dataset of a restricted user
+func userScope(entity *Entity, sessionScope string) string {
+	if sessionScope != "" {
+		return sessionScope
+	}
+	if dataset, restricted := UserDefaultDataset(entity); restricted {
+		return dataset
+	}
+	return ""
+}
+
+// SetDefaultDataset sets the user's default dataset and whether the user is
+// confined to it. An empty dataset clears both. Open sessions of a user who
+// becomes restricted are confined from their next request.
+func (sm *SecurityManager) SetDefaultDataset(userID, dataset string, restricted bool) error {
+	if dataset != "" && !datasetNamePattern.MatchString(dataset) {
+		return fmt.Errorf("%w: dataset name %q may only use letters, digits, '.', '_' and '-'", ErrInvalidScope, dataset)
+	}
+
+	entity, err := sm.entityRepo.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	kept := make([]string, 0, len(entity.Tags)+2)
+	for _, tag := range entity.Tags {
+		plain := stripTagTimestamp(tag)
+		if !strings.HasPrefix(plain, DefaultDatasetTagPrefix) && plain != DatasetRestrictedTag {
+			kept = append(kept, tag)
+		}
+	}
+
+	updated := entity.WithTags(kept)
+	if dataset != "" {
+		updated.AddTag(DefaultDatasetTagPrefix + dataset)
+		if restricted {
+			updated.AddTag(DatasetRestrictedTag)
+		}
+	}
+	if err := sm.entityRepo.Update(updated); err != nil {
+		return fmt.Errorf("failed to update default dataset: %w", err)
+	}
+	return nil
+}
+
+// ResolveSessionScope returns the dataset a new session of the user is
+// scoped to when it asks for requested, which is empty for an unscoped
+// session. Restricted users always get their default dataset and may only
+// ask for it; others may ask for any dataset they can access.
+func (sm *SecurityManager) ResolveSessionScope(user *SecurityUser, requested string) (string, error) {
+	if requested != "" && !datasetNamePattern.MatchString(requested) {
+		return "", fmt.Errorf("%w: %q is not a dataset name", ErrInvalidScope, requested)
+	}
+
+	dataset, restricted := UserDefaultDataset(user.Entity)
+	if restricted {
+		if requested != "" && requested != dataset {
+			return "", fmt.Errorf("%w: user is restricted to dataset %s", ErrScopeNotAllowed, dataset)
+		}
+		return dataset, nil
+	}
+	if requested == "" || requested == dataset {
+		return requested, nil
+	}
+
+	allowed, err := sm.CanAccessDataset(user, requested)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", fmt.Errorf("%w: no access to dataset %s", ErrScopeNotAllowed, requested)
+	}
+	return requested, nil
+}
@@ -0,0 +1,32 @@
+package models_test
+
+import (
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestUserDefaultDataset checks that a restriction without a default
+// dataset confines the user to nothing
+func TestUserDefaultDataset(t *testing.T) {
+	cases := []struct {
+		tags           []string
+		wantDataset    string
+		wantRestricted bool
+	}{
+		{nil, "", false},
+		{[]string{models.DefaultDatasetTagPrefix + "tenant-a"}, "tenant-a", false},
+		{[]string{models.DefaultDatasetTagPrefix + "tenant-a", models.DatasetRestrictedTag}, "tenant-a", true},
+		{[]string{models.DatasetRestrictedTag}, "", false},
+	}
+	for _, c := range cases {
+		user := models.NewEntity()
+		for _, tag := range c.tags {
+			user.AddTag(tag)
+		}
+		dataset, restricted := models.UserDefaultDataset(user)
+		if dataset != c.wantDataset || restricted != c.wantRestricted {
+			t.Errorf("UserDefaultDataset(%v) = %q, %v, want %q, %v", c.tags, dataset, restricted, c.wantDataset, c.wantRestricted)
+		}
+	}
+}
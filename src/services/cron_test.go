@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCronNext checks the next run of cron expressions from a fixed time
+func TestCronNext(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatalf("parse %s: %v", value, err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		from       string
+		want       string // empty when the expression never matches
+	}{
+		{"every minute", "* * * * *", "2026-01-01 10:07", "2026-01-01 10:08"},
+		{"strictly after", "@hourly", "2026-01-01 10:00", "2026-01-01 11:00"},
+		{"minute step", "*/15 * * * *", "2026-01-01 10:07", "2026-01-01 10:15"},
+		{"step from a value", "5/20 * * * *", "2026-01-01 10:06", "2026-01-01 10:25"},
+		{"range with step", "0-10/5 8-9 * * *", "2026-01-01 08:11", "2026-01-01 09:00"},
+		{"list", "0 12 1 jan,jul *", "2026-02-01 00:00", "2026-07-01 12:00"},
+		{"weekday range", "0 9 * * 1-5", "2026-01-02 10:00", "2026-01-05 09:00"},
+		{"weekday names", "0 9 * * mon-fri", "2026-01-03 10:00", "2026-01-05 09:00"},
+		{"7 is Sunday", "0 0 * * 7", "2026-01-01 00:00", "2026-01-04 00:00"},
+		{"0 is Sunday", "0 0 * * 0", "2026-01-01 00:00", "2026-01-04 00:00"},
+		{"range ending at 7", "0 0 * * 6-7", "2026-01-04 12:00", "2026-01-10 00:00"},
+		{"day of month", "0 0 13 * *", "2026-01-01 00:00", "2026-01-13 00:00"},
+		{"either day field", "0 0 13 * 5", "2026-01-01 00:00", "2026-01-02 00:00"},
+		{"either day field, day of month first", "0 0 13 * 5", "2026-01-10 00:00", "2026-01-13 00:00"},
+		{"starred day of month with step is unrestricted", "0 0 */10 * mon", "2026-01-01 00:00", "2026-05-11 00:00"},
+		{"leap day", "30 2 29 2 *", "2026-03-01 00:00", "2028-02-29 02:30"},
+		{"yearly", "@yearly", "2026-06-15 08:00", "2027-01-01 00:00"},
+		{"weekly", "@WEEKLY", "2026-01-01 00:00", "2026-01-04 00:00"},
+		{"never", "0 0 30 2 *", "2026-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expression)
+		if err != nil {
+			t.Errorf("%s: ParseCron(%q): %v", tt.name, tt.expression, err)
+			continue
+		}
+		got := schedule.Next(at(tt.from))
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%s: Next(%s) of %q = %v, want never", tt.name, tt.from, tt.expression, got)
+			}
+			continue
+		}
+		if want := at(tt.want); !got.Equal(want) {
+			t.Errorf("%s: Next(%s) of %q = %v, want %v", tt.name, tt.from, tt.expression, got, want)
+		}
+	}
+}
+
+// TestCronNextLocation checks that runs fall on the wall clock of the
+// time's location
+func TestCronNextLocation(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	schedule, err := ParseCron("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := schedule.Next(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC).In(berlin))
+	if want := time.Date(2026, 1, 2, 2, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next = %v, want 03:00 in Berlin (%v)", got, want)
+	}
+}
+
+// TestParseCronErrors checks that malformed expressions are refused
+func TestParseCronErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@reboot",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-2-3 * * * *",
+		"-5 * * * *",
+		"x * * * *",
+		"* * * foo *",
+		"* * * * funday",
+		"1,,2 * * * *",
+	} {
+		if _, err := ParseCron(expression); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want an error", expression)
+		}
+	}
+}
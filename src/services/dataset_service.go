@@ -0,0 +1,349 @@
+package services
+
+import (
+	"context"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DatasetCloneTag records on a cloned entity the ID of the entity it was
+// copied from
+const DatasetCloneTag = "clone:source:"
+
+var (
+	// ErrDatasetNotFound is returned for datasets without entities or a
+	// dataset entity
+	ErrDatasetNotFound = errors.New("dataset not found")
+
+	// ErrDatasetExists is returned when cloning into a dataset in use
+	ErrDatasetExists = errors.New("a dataset with this name already exists")
+
+	// ErrInvalidDatasetOperation is returned for invalid names, the system
+	// dataset and promotions of a dataset into itself
+	ErrInvalidDatasetOperation = errors.New("invalid dataset operation")
+
+	// ErrDatasetForbidden is returned when a promotion would move entities
+	// whose ACL does not grant the user write access
+	ErrDatasetForbidden = errors.New("entity ACL does not grant write access")
+)
+
+// DatasetCloneResult summarizes a clone
+type DatasetCloneResult struct {
+	Source    string     `json:"source"`
+	Target    string     `json:"target"`
+	DatasetID string     `json:"dataset_id"`
+	AsOf      *time.Time `json:"as_of,omitempty"`
+	Cloned    int        `json:"cloned"`
+	Skipped   int        `json:"skipped"`
+	Duration  string     `json:"duration"`
+}
+
+// DatasetPromoteResult summarizes a promotion
+type DatasetPromoteResult struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Promoted int    `json:"promoted"`
+	Duration string `json:"duration"`
+}
+
+// DatasetService copies datasets and promotes one dataset's entities into
+// another, so environments such as staging and production can be managed
+// inside one database
+type DatasetService struct {
+	repository models.EntityRepository
+
+	// mu serializes clones and promotions so two cannot interleave
+	mu sync.Mutex
+}
+
+// NewDatasetService creates a new dataset service
+func NewDatasetService(repository models.EntityRepository) *DatasetService {
+	return &DatasetService{repository: repository}
+}
+
+// ResolveDataset returns the name of a dataset given by its dataset entity
+// ID or its name
+func (ds *DatasetService) ResolveDataset(idOrName string) (string, error) {
+	if entity, err := ds.repository.GetByID(idOrName); err == nil && entity.HasTag("type:dataset") {
+		if name := entity.GetTagValue("name"); name != "" {
+			return name, nil
+		}
+	}
+	exists, err := ds.datasetExists(idOrName)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrDatasetNotFound, idOrName)
+	}
+	return idOrName, nil
+}
+
+// datasetEntity returns the dataset entity of a name, or nil
+func (ds *DatasetService) datasetEntity(name string) (*models.Entity, error) {
+	entities, err := ds.repository.ListByTag("name:" + name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up dataset %s: %w", name, err)
+	}
+	for _, entity := range entities {
+		if entity.HasTag("type:dataset") {
+			return entity, nil
+		}
+	}
+	return nil, nil
+}
+
+// datasetExists reports whether a dataset has a dataset entity or entities
+func (ds *DatasetService) datasetExists(name string) (bool, error) {
+	entity, err := ds.datasetEntity(name)
+	if err != nil || entity != nil {
+		return entity != nil, err
+	}
+	members, err := ds.repository.ListByTag("dataset:" + name)
+	if err != nil {
+		return false, fmt.Errorf("failed to list dataset %s: %w", name, err)
+	}
+	return len(members) > 0, nil
+}
+
+// checkDatasetName rejects names unsafe in tags and the system dataset,
+// whose users and credentials are never copied or moved
+func checkDatasetName(name string) error {
+	if !sandboxNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: dataset name %q may only use letters, digits, '.', '_' and '-'", ErrInvalidDatasetOperation, name)
+	}
+	if name == "system" || name == "_system" {
+		return fmt.Errorf("%w: the system dataset cannot be cloned or promoted", ErrInvalidDatasetOperation)
+	}
+	return nil
+}
+
+// Clone copies the entities of a dataset into a new dataset. With a
+// non-zero asOf entities are copied with their tags as of that time, and
+// entities created after it are left out. Copies get new IDs, the user as
+// creator and a clone:source tag naming their original; tag values naming
+// another copied entity are rewritten to its copy's ID. Entities the user
+// cannot read are skipped. When a copy fails the new dataset is removed.
+func (ds *DatasetService) Clone(ctx context.Context, source, target string, asOf time.Time, user *models.SecurityUser) (*DatasetCloneResult, error) {
+	if err := checkDatasetName(source); err != nil {
+		return nil, err
+	}
+	if err := checkDatasetName(target); err != nil {
+		return nil, err
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	start := time.Now()
+	exists, err := ds.datasetExists(target)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("%w: %s", ErrDatasetExists, target)
+	}
+	sources, err := ds.repository.ListByTag("dataset:" + source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dataset %s: %w", source, err)
+	}
+
+	result := &DatasetCloneResult{Source: source, Target: target}
+	if !asOf.IsZero() {
+		result.AsOf = &asOf
+	}
+	creator := models.SystemUserID
+	if user != nil {
+		creator = user.ID
+	}
+
+	var copies []clonedEntity
+	newIDs := make(map[string]string, len(sources))
+	for _, original := range sources {
+		if !models.CanAccessEntity(user, original, models.ACLRead) {
+			result.Skipped++
+			continue
+		}
+		snapshot := original
+		if !asOf.IsZero() {
+			if original.CreatedAt > asOf.UnixNano() {
+				continue
+			}
+			if snapshot, err = ds.repository.GetEntityAsOf(original.ID, asOf); err != nil {
+				return nil, fmt.Errorf("failed to read entity %s as of %s: %w", original.ID, asOf.Format(time.RFC3339), err)
+			}
+			if !snapshot.HasTag("dataset:" + source) {
+				continue
+			}
+		}
+
+		entityType := "entity"
+		var tags []string
+		for _, tag := range snapshot.GetTagsWithoutTimestamp() {
+			if strings.HasPrefix(tag, "type:") {
+				entityType = strings.TrimPrefix(tag, "type:")
+			}
+			if !hasAnyPrefix(tag, seedDropNamespaces) && !strings.HasPrefix(tag, DatasetCloneTag) {
+				tags = append(tags, tag)
+			}
+		}
+		entity, err := models.NewEntityWithMandatoryTags(entityType, target, creator, tags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy entity %s: %w", original.ID, err)
+		}
+		entity.Content = snapshot.Content
+		newIDs[original.ID] = entity.ID
+		copies = append(copies, clonedEntity{source: original.ID, entity: entity})
+	}
+
+	dataset, err := models.NewEntityWithMandatoryTags("dataset", "system", creator, []string{"name:" + target, "id:" + target})
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.repository.Create(dataset); err != nil {
+		return nil, fmt.Errorf("failed to create dataset %s: %w", target, err)
+	}
+	result.DatasetID = dataset.ID
+
+	for _, clone := range copies {
+		err := ctx.Err()
+		if err == nil {
+			for i, tag := range clone.entity.Tags {
+				if namespace, value, ok := strings.Cut(tag, ":"); ok {
+					if newID, ok := newIDs[value]; ok {
+						clone.entity.Tags[i] = namespace + ":" + newID
+					}
+				}
+			}
+			clone.entity.AddTag(DatasetCloneTag + clone.source)
+			if err = ds.repository.Create(clone.entity); err != nil {
+				err = fmt.Errorf("failed to copy entity %s: %w", clone.source, err)
+			}
+		}
+		if err != nil {
+			ds.removeClone(dataset.ID, copies[:result.Cloned])
+			return nil, err
+		}
+		result.Cloned++
+	}
+
+	result.Duration = time.Since(start).String()
+	logger.Info("DatasetService: cloned %s into %s (%d entities, %d skipped)", source, target, result.Cloned, result.Skipped)
+	return result, nil
+}
+
+// clonedEntity is the copy of an entity made by a clone
+type clonedEntity struct {
+	source string
+	entity *models.Entity
+}
+
+// removeClone deletes the copies and dataset entity of a failed clone
+func (ds *DatasetService) removeClone(datasetID string, copies []clonedEntity) {
+	for _, clone := range copies {
+		if err := ds.repository.Delete(clone.entity.ID); err != nil {
+			logger.Error("DatasetService: failed to remove copy %s of a failed clone: %v", clone.entity.ID, err)
+		}
+	}
+	if err := ds.repository.Delete(datasetID); err != nil {
+		logger.Error("DatasetService: failed to remove dataset %s of a failed clone: %v", datasetID, err)
+	}
+}
+
+// Promote moves every entity of source into target by replacing its
+// dataset tag. Nothing is moved unless the user may write every entity,
+// and when a move fails the entities already moved are moved back, so the
+// promotion takes effect for all entities or none.
+func (ds *DatasetService) Promote(ctx context.Context, source, target string, user *models.SecurityUser) (*DatasetPromoteResult, error) {
+	if err := checkDatasetName(source); err != nil {
+		return nil, err
+	}
+	if err := checkDatasetName(target); err != nil {
+		return nil, err
+	}
+	if source == target {
+		return nil, fmt.Errorf("%w: a dataset cannot be promoted into itself", ErrInvalidDatasetOperation)
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	start := time.Now()
+	exists, err := ds.datasetExists(target)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrDatasetNotFound, target)
+	}
+	entities, err := ds.repository.ListByTag("dataset:" + source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dataset %s: %w", source, err)
+	}
+
+	denied := 0
+	for _, entity := range entities {
+		if !models.CanAccessEntity(user, entity, models.ACLWrite) {
+			denied++
+		}
+	}
+	if denied > 0 {
+		return nil, fmt.Errorf("%w: %d entities of %s", ErrDatasetForbidden, denied, source)
+	}
+
+	result := &DatasetPromoteResult{Source: source, Target: target}
+	for _, entity := range entities {
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			if err = ds.repository.Update(withDataset(entity, target)); err != nil {
+				err = fmt.Errorf("failed to promote entity %s: %w", entity.ID, err)
+			}
+		}
+		if err != nil {
+			ds.restore(entities[:result.Promoted], source)
+			return nil, err
+		}
+		result.Promoted++
+	}
+
+	result.Duration = time.Since(start).String()
+	logger.Info("DatasetService: promoted %s into %s (%d entities)", source, target, result.Promoted)
+	return result, nil
+}
+
+// restore moves the entities of a failed promotion back to their dataset
+func (ds *DatasetService) restore(entities []*models.Entity, dataset string) {
+	for _, entity := range entities {
+		if err := ds.repository.Update(withDataset(entity, dataset)); err != nil {
+			logger.Error("DatasetService: failed to move entity %s back after a failed promotion: %v", entity.ID, err)
+		}
+	}
+}
+
+// withDataset returns a copy of an entity with its dataset tag replaced
+func withDataset(entity *models.Entity, dataset string) *models.Entity {
+	tags := make([]string, 0, len(entity.Tags))
+	for _, tag := range entity.Tags {
+		clean := tag
+		if idx := strings.Index(tag, "|"); idx != -1 {
+			clean = tag[idx+1:]
+		}
+		if !strings.HasPrefix(clean, "dataset:") {
+			tags = append(tags, tag)
+		}
+	}
+	updated := &models.Entity{
+		ID:        entity.ID,
+		Tags:      tags,
+		Content:   entity.Content,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+	}
+	updated.AddTag("dataset:" + dataset)
+	return updated
+}
@@ -14,6 +14,8 @@ import (
 
 // DeletionCollector manages automatic entity lifecycle transitions based on retention policies
 type DeletionCollector struct {
+	writePauser
+
 	// Core dependencies
 	repository   models.EntityRepository
 	policyEngine *models.PolicyEngine
@@ -35,6 +37,10 @@ type DeletionCollector struct {
 	systemUserID string
 }
 
+// orphanChunkGracePeriod protects newly stored chunks from orphan collection
+// while the upload that references them is still being written
+const orphanChunkGracePeriod = 10 * time.Minute
+
 // DeletionCollectorConfig configures the deletion collector behavior
 type DeletionCollectorConfig struct {
 	// Enabled controls whether the collector is active
@@ -77,6 +83,10 @@ type CollectorStats struct {
 	Purged              int64 `json:"purged"`
 	Restored            int64 `json:"restored"`
 	
+	// Content-addressed chunk reference counting
+	ChunkRefsReleased   int64 `json:"chunk_refs_released"`
+	ChunksPurged        int64 `json:"chunks_purged"`
+	
 	// Error tracking
 	Errors              int64 `json:"errors"`
 	LastError           string `json:"last_error,omitempty"`
@@ -213,7 +223,7 @@ func (dc *DeletionCollector) collectionLoop() {
 	defer ticker.Stop()
 	
 	// Run once immediately on startup
-	if err := dc.runCollectionCycle(); err != nil {
+	if err := dc.scheduledCycle(); err != nil {
 		logger.Error("DeletionCollector: Initial collection cycle failed: %v", err)
 	}
 	
@@ -224,7 +234,7 @@ func (dc *DeletionCollector) collectionLoop() {
 			return
 			
 		case <-ticker.C:
-			if err := dc.runCollectionCycle(); err != nil {
+			if err := dc.scheduledCycle(); err != nil {
 				logger.Error("DeletionCollector: Collection cycle failed: %v", err)
 				dc.recordError(err)
 			}
@@ -232,6 +242,16 @@ func (dc *DeletionCollector) collectionLoop() {
 	}
 }
 
+// scheduledCycle runs a collection cycle of the background loop, which
+// is skipped while writes are paused
+func (dc *DeletionCollector) scheduledCycle() error {
+	if dc.writesPaused() {
+		logger.Debug("DeletionCollector: Skipping collection cycle while writes are paused")
+		return nil
+	}
+	return dc.runCollectionCycle()
+}
+
 // runCollectionCycle executes a single collection and cleanup cycle
 func (dc *DeletionCollector) runCollectionCycle() error {
 	startTime := time.Now()
@@ -289,6 +309,12 @@ func (dc *DeletionCollector) runCollectionCycle() error {
 		logger.Debug("DeletionCollector: Processed batch %d-%d (%d transitioned)", i, end-1, batchTransitioned)
 	}
 	
+	// Purge deleted entities whose purge policy period has elapsed
+	transitioned += dc.applyPurgePolicies(cycleCtx)
+	
+	// Collect shared chunks whose referrers have all disappeared
+	dc.collectOrphanedChunks(cycleCtx, allEntities)
+	
 	duration := time.Since(startTime)
 	
 	// Update final statistics
@@ -409,6 +435,11 @@ func (dc *DeletionCollector) applyTransition(entity *models.Entity, policy model
 	logger.Info("DeletionCollector: Applying transition %s->%s to entity %s (policy: %s, rule: %s)", 
 		rule.FromState, rule.ToState, entity.ID, policy.Name, rule.Name)
 	
+	if rule.ToState == models.StatePurged && entity.Lifecycle().IsOnLegalHold() {
+		logger.Debug("DeletionCollector: Entity %s is on legal hold, not purging", entity.ID)
+		return false
+	}
+	
 	if dc.config.DryRun {
 		logger.Info("DeletionCollector: DRY RUN - Would transition entity %s from %s to %s", 
 			entity.ID, rule.FromState, rule.ToState)
@@ -464,10 +495,84 @@ func (dc *DeletionCollector) applyTransition(entity *models.Entity, policy model
 		return false
 	}
 	
+	// Purged entities give up their references to shared chunks
+	if rule.ToState == models.StatePurged {
+		dc.ReleaseChunks(entity)
+	}
+	
 	logger.Debug("DeletionCollector: Successfully transitioned entity %s to %s", entity.ID, rule.ToState)
 	return true
 }
 
+// ReleaseChunks drops an entity's references to its content-addressed chunks.
+// A shared chunk is only purged once its last live referrer is gone.
+func (dc *DeletionCollector) ReleaseChunks(entity *models.Entity) {
+	if !entity.IsChunked() {
+		return
+	}
+	
+	for _, chunkID := range entity.ChunkIDs() {
+		if !models.IsContentAddressedChunkID(chunkID) {
+			continue // Legacy per-entity chunk, not shared
+		}
+		
+		if dc.config.DryRun {
+			logger.Info("DeletionCollector: DRY RUN - Would release chunk %s held by %s", chunkID, entity.ID)
+			continue
+		}
+		
+		purged, err := models.ReleaseChunk(dc.repository, entity.ID, chunkID)
+		if err != nil {
+			logger.Error("DeletionCollector: Failed to release chunk %s held by %s: %v", chunkID, entity.ID, err)
+			dc.recordError(err)
+			continue
+		}
+		
+		dc.incrementStat("chunk_ref_released")
+		if purged {
+			logger.Debug("DeletionCollector: Purged chunk %s (last referrer %s)", chunkID, entity.ID)
+			dc.incrementStat("chunk_purged")
+		}
+	}
+}
+
+// collectOrphanedChunks purges content-addressed chunks with no live referrers,
+// e.g. chunks left behind by referrers that were removed outside the collector
+func (dc *DeletionCollector) collectOrphanedChunks(ctx context.Context, entities []*models.Entity) {
+	for _, entity := range entities {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		
+		if !models.IsContentAddressedChunkID(entity.ID) {
+			continue
+		}
+		
+		// Skip fresh chunks whose referrer may still be mid-upload
+		if time.Since(time.Unix(0, entity.CreatedAt)) < orphanChunkGracePeriod {
+			continue
+		}
+		
+		if dc.config.DryRun {
+			continue
+		}
+		
+		purged, err := models.ReleaseChunk(dc.repository, "", entity.ID)
+		if err != nil {
+			logger.Error("DeletionCollector: Failed to collect orphaned chunk %s: %v", entity.ID, err)
+			dc.recordError(err)
+			continue
+		}
+		
+		if purged {
+			logger.Debug("DeletionCollector: Purged orphaned chunk %s", entity.ID)
+			dc.incrementStat("chunk_purged")
+		}
+	}
+}
+
 // incrementStat safely increments a specific statistic counter
 func (dc *DeletionCollector) incrementStat(statName string) {
 	if !dc.config.EnableMetrics {
@@ -486,6 +591,10 @@ func (dc *DeletionCollector) incrementStat(statName string) {
 		dc.stats.Purged++
 	case "restored":
 		dc.stats.Restored++
+	case "chunk_ref_released":
+		dc.stats.ChunkRefsReleased++
+	case "chunk_purged":
+		dc.stats.ChunksPurged++
 	}
 }
 
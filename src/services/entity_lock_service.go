@@ -0,0 +1,166 @@
+package services
+
+import (
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrEntityLocked is returned when another user holds an entity's lock
+	ErrEntityLocked = errors.New("entity is locked by another user")
+
+	// ErrLockNotHeld is returned when unlocking an entity the user holds no
+	// lock on
+	ErrLockNotHeld = errors.New("entity lock is not held")
+
+	// ErrInvalidLockTTL is returned for lock leases that are not positive or
+	// exceed the maximum
+	ErrInvalidLockTTL = errors.New("invalid lock ttl")
+)
+
+// EntityLockServiceConfig configures entity locks
+type EntityLockServiceConfig struct {
+	// Enforce refuses updates by other users while a lock is held
+	Enforce bool
+
+	// DefaultTTL is the lease of locks taken without a ttl
+	DefaultTTL time.Duration
+
+	// MaxTTL is the longest lease a lock may be taken for
+	MaxTTL time.Duration
+}
+
+// LockedError reports the lock that refused an operation
+type LockedError struct {
+	Lock *models.EntityLock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v: held by %s until %s", ErrEntityLocked, e.Lock.Holder, e.Lock.ExpiresAt.Format(time.RFC3339))
+}
+
+// Unwrap makes errors.Is match ErrEntityLocked
+func (e *LockedError) Unwrap() error {
+	return ErrEntityLocked
+}
+
+// EntityLockService grants advisory locks on entities. A lock is a lease
+// stored as tags on the entity; its holder renews it by locking again and
+// it is released by unlocking or by expiring.
+type EntityLockService struct {
+	repository models.EntityRepository
+	config     EntityLockServiceConfig
+
+	// mu serializes lock changes so two users cannot both take a lock
+	mu sync.Mutex
+}
+
+// NewEntityLockService creates a new entity lock service
+func NewEntityLockService(repository models.EntityRepository, config EntityLockServiceConfig) *EntityLockService {
+	if config.DefaultTTL <= 0 {
+		config.DefaultTTL = 5 * time.Minute
+	}
+	if config.MaxTTL <= 0 {
+		config.MaxTTL = time.Hour
+	}
+	if config.DefaultTTL > config.MaxTTL {
+		config.DefaultTTL = config.MaxTTL
+	}
+	return &EntityLockService{repository: repository, config: config}
+}
+
+// IsEnforced reports whether updates honor locks
+func (ls *EntityLockService) IsEnforced() bool {
+	return ls.config.Enforce
+}
+
+// Lock takes or renews the lock on an entity for ttl, or the default lease
+// when ttl is zero. A lock held by another user is refused with a
+// LockedError until it expires.
+func (ls *EntityLockService) Lock(id string, user *models.SecurityUser, ttl time.Duration) (*models.EntityLock, error) {
+	if user == nil {
+		return nil, errors.New("locks need an authenticated user")
+	}
+	if ttl == 0 {
+		ttl = ls.config.DefaultTTL
+	}
+	if ttl < 0 || ttl > ls.config.MaxTTL {
+		return nil, fmt.Errorf("%w: must be positive and at most %s", ErrInvalidLockTTL, ls.config.MaxTTL)
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	entity, err := ls.repository.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	lock := &models.EntityLock{EntityID: id, Holder: user.ID, AcquiredAt: now}
+	if current := models.ParseEntityLock(entity, now); current != nil {
+		if !current.HeldBy(user) {
+			return nil, &LockedError{Lock: current}
+		}
+		// A renewal keeps the time the lock was first taken
+		lock.AcquiredAt = current.AcquiredAt
+	}
+	lock.ExpiresAt = now.Add(ttl)
+
+	if err := ls.repository.Update(withLockTags(entity, lock.Tags())); err != nil {
+		return nil, fmt.Errorf("failed to lock entity %s: %w", id, err)
+	}
+	logger.Debug("EntityLockService: %s locked %s until %s", user.ID, id, lock.ExpiresAt.Format(time.RFC3339))
+	return lock, nil
+}
+
+// Unlock releases the lock on an entity. Only its holder may release an
+// unexpired lock unless force is set; an expired lock's tags are removed by
+// anyone.
+func (ls *EntityLockService) Unlock(id string, user *models.SecurityUser, force bool) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	entity, err := ls.repository.GetByID(id)
+	if err != nil {
+		return err
+	}
+	current := models.ParseEntityLock(entity, time.Now())
+	if current == nil && len(models.WithoutLockTags(entity.Tags)) == len(entity.Tags) {
+		return fmt.Errorf("%w: entity %s is not locked", ErrLockNotHeld, id)
+	}
+	if current != nil && !current.HeldBy(user) && !force {
+		return &LockedError{Lock: current}
+	}
+
+	if err := ls.repository.Update(withLockTags(entity, nil)); err != nil {
+		return fmt.Errorf("failed to unlock entity %s: %w", id, err)
+	}
+	return nil
+}
+
+// CheckUpdate returns a LockedError when locks are enforced and another
+// user holds the entity's lock
+func (ls *EntityLockService) CheckUpdate(entity *models.Entity, user *models.SecurityUser) error {
+	if !ls.config.Enforce {
+		return nil
+	}
+	if lock := models.ParseEntityLock(entity, time.Now()); lock != nil && !lock.HeldBy(user) {
+		return &LockedError{Lock: lock}
+	}
+	return nil
+}
+
+// withLockTags returns a copy of an entity with its lock tags replaced
+func withLockTags(entity *models.Entity, lockTags []string) *models.Entity {
+	return &models.Entity{
+		ID:        entity.ID,
+		Tags:      append(models.WithoutLockTags(entity.Tags), lockTags...),
+		Content:   entity.Content,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+	}
+}
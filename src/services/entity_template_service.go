@@ -0,0 +1,343 @@
+package services
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entity templates standardize how entities of a kind are created. They are
+// stored as entities:
+//
+//	type:entity_template
+//	dataset:system
+//	template:name:invoice
+//
+// The entity's JSON content holds the definition: the type and dataset of
+// created entities, default tags, tag namespaces and content fields every
+// instance must have, and a JSON content scaffold. Instantiating a template
+// applies the caller's overrides on top of the defaults.
+const entityTemplateNameTag = "template:name:"
+
+// entityTemplateNamePattern restricts template names to what is safe in
+// tags and URL paths
+var entityTemplateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+var (
+	// ErrEntityTemplateNotFound is returned for names without a template
+	ErrEntityTemplateNotFound = errors.New("entity template not found")
+
+	// ErrEntityTemplateExists is returned when creating a template whose name is taken
+	ErrEntityTemplateExists = errors.New("an entity template with this name already exists")
+
+	// ErrInvalidEntityTemplate is returned for invalid template definitions
+	ErrInvalidEntityTemplate = errors.New("invalid entity template")
+
+	// ErrTemplateRequirements is returned when an instance lacks required
+	// tags or content fields
+	ErrTemplateRequirements = errors.New("template requirements not met")
+)
+
+// EntityTemplate defines the defaults of entities created from it
+type EntityTemplate struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Type and Dataset of created entities. Without a Dataset the caller's
+	// dataset: tag applies, else "default".
+	Type    string `json:"type"`
+	Dataset string `json:"dataset,omitempty"`
+
+	// Tags are added to every instance unless the caller gives a tag of
+	// the same namespace
+	Tags []string `json:"tags,omitempty"`
+
+	// RequiredTags are tag namespaces every instance must have
+	RequiredTags []string `json:"required_tags,omitempty"`
+
+	// Content is a JSON object the caller's content is merged into
+	Content map[string]interface{} `json:"content,omitempty"`
+
+	// RequiredFields are content paths, e.g. "customer.id", every instance
+	// must have
+	RequiredFields []string `json:"required_fields,omitempty"`
+
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// EntityTemplateService stores entity templates
+type EntityTemplateService struct {
+	repository models.EntityRepository
+}
+
+// NewEntityTemplateService creates a new entity template service
+func NewEntityTemplateService(repository models.EntityRepository) *EntityTemplateService {
+	return &EntityTemplateService{repository: repository}
+}
+
+// List returns every template, ordered by name
+func (ts *EntityTemplateService) List() ([]EntityTemplate, error) {
+	entities, err := ts.repository.ListByTag("type:entity_template")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entity templates: %w", err)
+	}
+	templates := make([]EntityTemplate, 0, len(entities))
+	for _, entity := range entities {
+		template, err := parseEntityTemplate(entity)
+		if err != nil {
+			logger.Warn("EntityTemplateService: skipping template entity %s: %v", entity.ID, err)
+			continue
+		}
+		templates = append(templates, *template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+// Get returns the template of a name
+func (ts *EntityTemplateService) Get(name string) (*EntityTemplate, error) {
+	_, template, err := ts.find(name)
+	return template, err
+}
+
+// find returns the template of a name and its entity
+func (ts *EntityTemplateService) find(name string) (*models.Entity, *EntityTemplate, error) {
+	entities, err := ts.repository.ListByTag(entityTemplateNameTag + name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up entity template: %w", err)
+	}
+	for _, entity := range entities {
+		if !entity.HasTag("type:entity_template") {
+			continue
+		}
+		if template, err := parseEntityTemplate(entity); err == nil && template.Name == name {
+			return entity, template, nil
+		}
+	}
+	return nil, nil, ErrEntityTemplateNotFound
+}
+
+// parseEntityTemplate builds an EntityTemplate from a template entity
+func parseEntityTemplate(entity *models.Entity) (*EntityTemplate, error) {
+	var template EntityTemplate
+	if err := json.Unmarshal(entity.Content, &template); err != nil {
+		return nil, fmt.Errorf("invalid entity template definition: %w", err)
+	}
+	template.ID = entity.ID
+	template.CreatedAt = time.Unix(0, entity.CreatedAt)
+	template.UpdatedAt = time.Unix(0, entity.UpdatedAt)
+	return &template, nil
+}
+
+// encodeEntityTemplate returns the stored form of a definition
+func encodeEntityTemplate(template EntityTemplate) ([]byte, error) {
+	template.ID = ""
+	template.CreatedAt, template.UpdatedAt = time.Time{}, time.Time{}
+	return json.Marshal(template)
+}
+
+// Create saves a new template
+func (ts *EntityTemplateService) Create(template EntityTemplate, createdBy string) (*EntityTemplate, error) {
+	if err := ValidateEntityTemplate(&template); err != nil {
+		return nil, err
+	}
+	if _, _, err := ts.find(template.Name); err == nil {
+		return nil, ErrEntityTemplateExists
+	} else if !errors.Is(err, ErrEntityTemplateNotFound) {
+		return nil, err
+	}
+
+	template.CreatedBy = createdBy
+	content, err := encodeEntityTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := models.NewEntityWithMandatoryTags("entity_template", "system", createdBy, nil)
+	if err != nil {
+		return nil, err
+	}
+	entity.AddTag(entityTemplateNameTag + template.Name)
+	entity.AddTag("content:type:json")
+	entity.Content = content
+	if err := ts.repository.Create(entity); err != nil {
+		return nil, fmt.Errorf("failed to create entity template: %w", err)
+	}
+	logger.Info("EntityTemplateService: created template %s", template.Name)
+	return parseEntityTemplate(entity)
+}
+
+// Update replaces the definition of a template. Templates cannot be renamed.
+func (ts *EntityTemplateService) Update(name string, template EntityTemplate) (*EntityTemplate, error) {
+	if template.Name == "" {
+		template.Name = name
+	}
+	if template.Name != name {
+		return nil, fmt.Errorf("%w: templates cannot be renamed", ErrInvalidEntityTemplate)
+	}
+	if err := ValidateEntityTemplate(&template); err != nil {
+		return nil, err
+	}
+	entity, existing, err := ts.find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	template.CreatedBy = existing.CreatedBy
+	content, err := encodeEntityTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	entity.Content = content
+	if err := ts.repository.Update(entity); err != nil {
+		return nil, fmt.Errorf("failed to update entity template: %w", err)
+	}
+	logger.Info("EntityTemplateService: updated template %s", name)
+	return parseEntityTemplate(entity)
+}
+
+// Delete removes a template. Entities created from it are not changed.
+func (ts *EntityTemplateService) Delete(name string) error {
+	entity, _, err := ts.find(name)
+	if err != nil {
+		return err
+	}
+	if err := ts.repository.Delete(entity.ID); err != nil {
+		return fmt.Errorf("failed to delete entity template: %w", err)
+	}
+	logger.Info("EntityTemplateService: deleted template %s", name)
+	return nil
+}
+
+// ValidateEntityTemplate checks a definition
+func ValidateEntityTemplate(template *EntityTemplate) error {
+	if !entityTemplateNamePattern.MatchString(template.Name) {
+		return fmt.Errorf("%w: name %q may only use letters, digits, '.', '_' and '-'", ErrInvalidEntityTemplate, template.Name)
+	}
+	if template.Type == "" || strings.ContainsAny(template.Type, ": ") {
+		return fmt.Errorf("%w: type is required and may not contain ':' or spaces", ErrInvalidEntityTemplate)
+	}
+	if strings.ContainsAny(template.Dataset, ": ") {
+		return fmt.Errorf("%w: invalid dataset %q", ErrInvalidEntityTemplate, template.Dataset)
+	}
+	for _, tag := range template.Tags {
+		namespace := tagNamespace(tag)
+		if namespace == "" {
+			return fmt.Errorf("%w: tag %q has no namespace", ErrInvalidEntityTemplate, tag)
+		}
+		if namespace == "type" || namespace == "dataset" {
+			return fmt.Errorf("%w: set %s with the template's %s field", ErrInvalidEntityTemplate, namespace, namespace)
+		}
+		if namespace == "template" {
+			return fmt.Errorf("%w: the template: tag is set on instances automatically", ErrInvalidEntityTemplate)
+		}
+	}
+	for _, namespace := range template.RequiredTags {
+		if namespace == "" || strings.Contains(namespace, ":") {
+			return fmt.Errorf("%w: required tag %q must be a namespace without ':'", ErrInvalidEntityTemplate, namespace)
+		}
+	}
+	for _, field := range template.RequiredFields {
+		if field == "" {
+			return fmt.Errorf("%w: empty required field", ErrInvalidEntityTemplate)
+		}
+	}
+	return nil
+}
+
+// tagNamespace returns the part of a tag before its first ':'
+func tagNamespace(tag string) string {
+	if i := strings.Index(tag, ":"); i > 0 {
+		return tag[:i]
+	}
+	return ""
+}
+
+// Instantiate applies a caller's tags and content to the template. A
+// caller's tag replaces the template's tags of the same namespace. The
+// template fixes the type, and the dataset when it sets one, and tags each
+// instance template:<name>. JSON object
+// content is merged into the scaffold, with the caller's values winning.
+// It returns the tags and content of the new entity.
+func (template *EntityTemplate) Instantiate(tags []string, content interface{}) ([]string, interface{}, error) {
+	given := make(map[string]bool, len(tags))
+	merged := []string{"type:" + template.Type, "template:" + template.Name}
+	if template.Dataset != "" {
+		merged = append(merged, "dataset:"+template.Dataset)
+	}
+	for _, tag := range tags {
+		namespace := tagNamespace(tag)
+		if namespace == "type" || namespace == "template" || (namespace == "dataset" && template.Dataset != "") {
+			continue
+		}
+		given[namespace] = true
+		merged = append(merged, tag)
+	}
+	for _, tag := range template.Tags {
+		if !given[tagNamespace(tag)] {
+			merged = append(merged, tag)
+		}
+	}
+
+	if len(template.Content) > 0 {
+		switch override := content.(type) {
+		case nil:
+			content = mergeTemplateContent(template.Content, nil)
+		case map[string]interface{}:
+			content = mergeTemplateContent(template.Content, override)
+		default:
+			return nil, nil, fmt.Errorf("%w: template %s requires JSON object content", ErrTemplateRequirements, template.Name)
+		}
+	}
+
+	var missing []string
+	present := make(map[string]bool, len(merged))
+	for _, tag := range merged {
+		present[tagNamespace(tag)] = true
+	}
+	for _, namespace := range template.RequiredTags {
+		if !present[namespace] {
+			missing = append(missing, "tag "+namespace)
+		}
+	}
+	for _, field := range template.RequiredFields {
+		if value, ok := models.LookupJSONPath(content, field); !ok || value == nil {
+			missing = append(missing, "content field "+field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("%w: missing %s", ErrTemplateRequirements, strings.Join(missing, ", "))
+	}
+	return merged, content, nil
+}
+
+// mergeTemplateContent deep-merges override into a copy of scaffold
+func mergeTemplateContent(scaffold, override map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(scaffold)+len(override))
+	for key, value := range scaffold {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = mergeTemplateContent(nested, nil)
+		}
+		result[key] = value
+	}
+	for key, value := range override {
+		nested, isObject := value.(map[string]interface{})
+		existing, wasObject := result[key].(map[string]interface{})
+		if isObject && wasObject {
+			result[key] = mergeTemplateContent(existing, nested)
+		} else {
+			result[key] = value
+		}
+	}
+	return result
+}
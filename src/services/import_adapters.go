@@ -0,0 +1,211 @@
+package services
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// csvImport reads a CSV file whose header names the fields
+type csvImport struct {
+	file   *os.File
+	reader *csv.Reader
+	header []string
+}
+
+// openCSVImport opens a CSV import and reads its header
+func openCSVImport(path string, options ImportOptions) (ImportAdapter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(bufio.NewReader(file))
+	if options.Delimiter != 0 {
+		reader.Comma = options.Delimiter
+	}
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		file.Close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("csv import is empty")
+		}
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	names := make([]string, len(header))
+	for i, name := range header {
+		names[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if names[i] == "" {
+			file.Close()
+			return nil, fmt.Errorf("csv header column %d has no name", i+1)
+		}
+	}
+	return &csvImport{file: file, reader: reader, header: names}, nil
+}
+
+func (c *csvImport) Next() (ImportRecord, error) {
+	values, err := c.reader.Read()
+	if err == io.EOF {
+		return ImportRecord{}, io.EOF
+	}
+	line, _ := c.reader.FieldPos(0)
+	if err != nil {
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			return ImportRecord{}, &ImportRowError{Row: parseErr.StartLine, Message: parseErr.Err.Error()}
+		}
+		return ImportRecord{}, err
+	}
+	if len(values) != len(c.header) {
+		return ImportRecord{}, &ImportRowError{Row: line, Message: fmt.Sprintf("%d fields, header has %d", len(values), len(c.header))}
+	}
+	fields := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		fields[c.header[i]] = value
+	}
+	return ImportRecord{Row: line, Fields: fields}, nil
+}
+
+func (c *csvImport) Close() error {
+	return c.file.Close()
+}
+
+// jsonlImport reads a file with a JSON object per line
+type jsonlImport struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	line    int
+}
+
+// openJSONLImport opens a JSONL import
+func openJSONLImport(path string, options ImportOptions) (ImportAdapter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	return &jsonlImport{file: file, scanner: scanner}, nil
+}
+
+func (j *jsonlImport) Next() (ImportRecord, error) {
+	for j.scanner.Scan() {
+		j.line++
+		line := strings.TrimSpace(j.scanner.Text())
+		if line == "" {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		var fields map[string]interface{}
+		if err := decoder.Decode(&fields); err != nil || fields == nil {
+			return ImportRecord{}, &ImportRowError{Row: j.line, Message: "line is not a JSON object"}
+		}
+		return ImportRecord{Row: j.line, Fields: fields}, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return ImportRecord{}, err
+	}
+	return ImportRecord{}, io.EOF
+}
+
+func (j *jsonlImport) Close() error {
+	return j.file.Close()
+}
+
+// sqliteImport reads the rows of a SQLite table
+type sqliteImport struct {
+	db      *sql.DB
+	rows    *sql.Rows
+	columns []string
+	row     int
+}
+
+// openSQLiteImport opens a SQLite database read-only and selects the rows
+// of the table
+func openSQLiteImport(path string, options ImportOptions) (ImportAdapter, error) {
+	db, err := sql.Open("sqlite3", "file:"+url.PathEscape(path)+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite import: %w", err)
+	}
+
+	var name string
+	err = db.QueryRow("SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name = ?", options.Table).Scan(&name)
+	if err == sql.ErrNoRows {
+		db.Close()
+		return nil, fmt.Errorf("sqlite import has no table %q", options.Table)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read sqlite import: %w", err)
+	}
+
+	// The name is quoted as an identifier; it was checked to be a table
+	rows, err := db.Query(`SELECT * FROM "` + strings.ReplaceAll(name, `"`, `""`) + `"`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read table %s: %w", name, err)
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		db.Close()
+		return nil, fmt.Errorf("failed to read table %s: %w", name, err)
+	}
+	return &sqliteImport{db: db, rows: rows, columns: columns}, nil
+}
+
+func (s *sqliteImport) Next() (ImportRecord, error) {
+	if !s.rows.Next() {
+		if err := s.rows.Err(); err != nil {
+			return ImportRecord{}, err
+		}
+		return ImportRecord{}, io.EOF
+	}
+	s.row++
+	values := make([]interface{}, len(s.columns))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := s.rows.Scan(pointers...); err != nil {
+		return ImportRecord{}, &ImportRowError{Row: s.row, Message: err.Error()}
+	}
+
+	fields := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case int64:
+			fields[s.columns[i]] = json.Number(strconv.FormatInt(v, 10))
+		case float64:
+			fields[s.columns[i]] = json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+		case []byte:
+			if !utf8.Valid(v) {
+				return ImportRecord{}, &ImportRowError{Row: s.row, Message: fmt.Sprintf("column %s holds binary data", s.columns[i])}
+			}
+			fields[s.columns[i]] = string(v)
+		case time.Time:
+			fields[s.columns[i]] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			fields[s.columns[i]] = v
+		}
+	}
+	return ImportRecord{Row: s.row, Fields: fields}, nil
+}
+
+func (s *sqliteImport) Close() error {
+	s.rows.Close()
+	return s.db.Close()
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Import formats with built-in adapters
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatJSONL  = "jsonl"
+	ImportFormatSQLite = "sqlite"
+)
+
+// ImportNoContent as the content field imports records without content
+const ImportNoContent = "-"
+
+// importMaxReportedErrors caps the row errors kept in an import result
+const importMaxReportedErrors = 1000
+
+// importProgressInterval is how many rows pass between progress reports
+const importProgressInterval = 1000
+
+// importProtectedNamespaces are tag namespaces an import may not write:
+// the mapping sets type and dataset, and identity, security and content
+// tags belong to their subsystems
+var importProtectedNamespaces = map[string]bool{
+	"type":       true,
+	"dataset":    true,
+	"created_at": true,
+	"created_by": true,
+	"uuid":       true,
+	"identity":   true,
+	"rbac":       true,
+	"acl":        true,
+	"content":    true,
+	"chunk":      true,
+	"lifecycle":  true,
+}
+
+// ImportRecord is one record of an import source. Fields hold JSON values:
+// strings, json.Number, bool, nil, and for JSONL nested objects and arrays.
+type ImportRecord struct {
+	// Row is the position of the record in the source: the line of a CSV
+	// or JSONL file, the row number of a SQLite table
+	Row    int
+	Fields map[string]interface{}
+}
+
+// ImportAdapter reads the records of an import source
+type ImportAdapter interface {
+	// Next returns the next record, or io.EOF after the last one. A record
+	// that cannot be read returns an *ImportRowError; reading continues
+	// with the next one.
+	Next() (ImportRecord, error)
+	Close() error
+}
+
+// ImportAdapterFactory opens the file at path as an import source
+type ImportAdapterFactory func(path string, options ImportOptions) (ImportAdapter, error)
+
+// ImportTagField maps a record field to a tag namespace. Field is a field
+// name or a JSONPath such as $.customer.country into nested JSONL records.
+type ImportTagField struct {
+	Namespace string `json:"namespace"`
+	Field     string `json:"field"`
+}
+
+// ParseImportTagField parses "namespace=field", or "field" to use the
+// field's last path segment as the namespace
+func ParseImportTagField(spec string) (ImportTagField, error) {
+	namespace, field, ok := strings.Cut(spec, "=")
+	if !ok {
+		field = spec
+		namespace = spec
+		if path, err := models.ContentPathFromJSONPath(spec); err == nil {
+			namespace = path[strings.LastIndex(path, ".")+1:]
+		}
+	}
+	namespace, field = strings.TrimSpace(namespace), strings.TrimSpace(field)
+	if namespace == "" || field == "" {
+		return ImportTagField{}, fmt.Errorf("tag field %q must be namespace=field or field", spec)
+	}
+	if strings.ContainsAny(namespace, ":|") {
+		return ImportTagField{}, fmt.Errorf("tag namespace %q must not contain ':' or '|'", namespace)
+	}
+	return ImportTagField{Namespace: namespace, Field: field}, nil
+}
+
+// ImportMapping turns records into entities
+type ImportMapping struct {
+	EntityType string `json:"type"`
+	Dataset    string `json:"dataset"`
+	// Tags are added to every entity
+	Tags []string `json:"tags,omitempty"`
+	// TagFields become namespace:value tags; empty and null values add none
+	TagFields []ImportTagField `json:"tag_fields,omitempty"`
+	// ContentField is the field stored as content, the whole record as a
+	// JSON object when empty, or no content when ImportNoContent
+	ContentField string `json:"content_field,omitempty"`
+}
+
+// ImportOptions describes an import
+type ImportOptions struct {
+	Format  string        `json:"format"`
+	Mapping ImportMapping `json:"mapping"`
+	// DryRun maps and validates every record without creating entities
+	DryRun bool `json:"dry_run"`
+	// MaxErrors stops the import after this many failed rows; 0 means no limit
+	MaxErrors int `json:"max_errors,omitempty"`
+	// Table is the table read by the SQLite adapter
+	Table string `json:"table,omitempty"`
+	// Delimiter is the CSV field separator, ',' when zero
+	Delimiter rune `json:"-"`
+}
+
+// ImportRowError reports a record that was not imported
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"error"`
+}
+
+func (e *ImportRowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Format string `json:"format"`
+	DryRun bool   `json:"dry_run"`
+	Rows   int    `json:"rows"`
+	// Imported counts the entities created, or in a dry run those that
+	// would be
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors,omitempty"`
+	// Aborted reports an import stopped by MaxErrors
+	Aborted bool `json:"aborted,omitempty"`
+}
+
+// ImportService creates entities from CSV, JSONL and SQLite files through
+// format adapters. Further formats are added with RegisterAdapter.
+type ImportService struct {
+	repository models.EntityRepository
+
+	mu       sync.RWMutex
+	adapters map[string]ImportAdapterFactory
+}
+
+// NewImportService creates an import service with the built-in adapters
+func NewImportService(repository models.EntityRepository) *ImportService {
+	is := &ImportService{
+		repository: repository,
+		adapters:   make(map[string]ImportAdapterFactory),
+	}
+	is.RegisterAdapter(ImportFormatCSV, openCSVImport)
+	is.RegisterAdapter(ImportFormatJSONL, openJSONLImport)
+	is.RegisterAdapter(ImportFormatSQLite, openSQLiteImport)
+	return is
+}
+
+// RegisterAdapter adds or replaces the adapter of a format
+func (is *ImportService) RegisterAdapter(format string, factory ImportAdapterFactory) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	is.adapters[format] = factory
+}
+
+// Formats lists the formats with an adapter
+func (is *ImportService) Formats() []string {
+	is.mu.RLock()
+	defer is.mu.RUnlock()
+	formats := make([]string, 0, len(is.adapters))
+	for format := range is.adapters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Validate checks the options before any record is read
+func (is *ImportService) Validate(options ImportOptions) error {
+	is.mu.RLock()
+	_, ok := is.adapters[options.Format]
+	is.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown import format %q (available: %s)", options.Format, strings.Join(is.Formats(), ", "))
+	}
+	if options.Format == ImportFormatSQLite && options.Table == "" {
+		return fmt.Errorf("a sqlite import needs a table")
+	}
+	if options.MaxErrors < 0 {
+		return fmt.Errorf("max_errors must not be negative")
+	}
+
+	mapping := options.Mapping
+	if mapping.EntityType == "" || strings.ContainsAny(mapping.EntityType, ":|") {
+		return fmt.Errorf("an import needs an entity type without ':' or '|'")
+	}
+	if mapping.Dataset == "" || strings.ContainsAny(mapping.Dataset, ":|") {
+		return fmt.Errorf("an import needs a dataset without ':' or '|'")
+	}
+	for _, tag := range mapping.Tags {
+		namespace, value, ok := strings.Cut(tag, ":")
+		if !ok || namespace == "" || value == "" {
+			return fmt.Errorf("tag %q must be namespace:value", tag)
+		}
+		if importProtectedNamespaces[namespace] {
+			return fmt.Errorf("tag %q is in a protected namespace", tag)
+		}
+	}
+	for _, field := range mapping.TagFields {
+		if importProtectedNamespaces[field.Namespace] {
+			return fmt.Errorf("tag namespace %q is protected", field.Namespace)
+		}
+	}
+	return nil
+}
+
+// Import creates an entity per record of the file at path, created by
+// createdBy. Records that fail are reported in the result and skipped.
+// progress, if set, is called with the rows read so far.
+func (is *ImportService) Import(ctx context.Context, path string, options ImportOptions, createdBy string, progress func(rows int)) (*ImportResult, error) {
+	if err := is.Validate(options); err != nil {
+		return nil, err
+	}
+	is.mu.RLock()
+	open := is.adapters[options.Format]
+	is.mu.RUnlock()
+
+	adapter, err := open(path, options)
+	if err != nil {
+		return nil, err
+	}
+	defer adapter.Close()
+
+	result := &ImportResult{Format: options.Format, DryRun: options.DryRun}
+	fail := func(row int, err error) {
+		result.Failed++
+		if len(result.Errors) < importMaxReportedErrors {
+			result.Errors = append(result.Errors, ImportRowError{Row: row, Message: err.Error()})
+		}
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if options.MaxErrors > 0 && result.Failed >= options.MaxErrors {
+			result.Aborted = true
+			break
+		}
+
+		record, err := adapter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rowErr, ok := err.(*ImportRowError)
+			if !ok {
+				return result, fmt.Errorf("failed to read %s import: %w", options.Format, err)
+			}
+			result.Rows++
+			fail(rowErr.Row, fmt.Errorf("%s", rowErr.Message))
+			continue
+		}
+		result.Rows++
+		if progress != nil && result.Rows%importProgressInterval == 0 {
+			progress(result.Rows)
+		}
+
+		entity, err := options.Mapping.entity(record, createdBy)
+		if err == nil && !options.DryRun {
+			err = is.repository.Create(entity)
+		}
+		if err != nil {
+			fail(record.Row, err)
+			continue
+		}
+		result.Imported++
+	}
+	if progress != nil {
+		progress(result.Rows)
+	}
+
+	logger.Info("Import of %s %s: %d rows, %d imported, %d failed (dry run: %v)",
+		options.Format, path, result.Rows, result.Imported, result.Failed, options.DryRun)
+	return result, nil
+}
+
+// entity builds the entity of a record
+func (m ImportMapping) entity(record ImportRecord, createdBy string) (*models.Entity, error) {
+	tags := append([]string(nil), m.Tags...)
+	for _, field := range m.TagFields {
+		value, ok := recordField(record, field.Field)
+		if !ok || value == nil {
+			continue
+		}
+		key, ok := models.ContentPathValueKey(value)
+		if !ok {
+			return nil, fmt.Errorf("field %s is not a scalar value", field.Field)
+		}
+		if key == "" {
+			continue
+		}
+		tags = append(tags, field.Namespace+":"+key)
+	}
+
+	entity, err := models.NewEntityWithMandatoryTags(m.EntityType, m.Dataset, createdBy, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var content interface{} = record.Fields
+	switch m.ContentField {
+	case ImportNoContent:
+		return entity, nil
+	case "":
+	default:
+		value, ok := recordField(record, m.ContentField)
+		if !ok || value == nil {
+			return entity, nil
+		}
+		content = value
+	}
+	if text, ok := content.(string); ok {
+		entity.Content = []byte(text)
+		entity.AddTag("content:type:text/plain")
+		return entity, nil
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode content: %w", err)
+	}
+	entity.Content = data
+	entity.AddTag("content:type:application/json")
+	return entity, nil
+}
+
+// recordField returns a field by name, else by JSONPath into nested values
+func recordField(record ImportRecord, field string) (interface{}, bool) {
+	if value, ok := record.Fields[field]; ok {
+		return value, true
+	}
+	path, err := models.ContentPathFromJSONPath(field)
+	if err != nil {
+		return nil, false
+	}
+	return models.LookupJSONPath(record.Fields, path)
+}
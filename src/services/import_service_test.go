@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"entitydb/models"
+	"entitydb/storage/binary"
+)
+
+// writeImportFile writes an import source to a temporary file
+func writeImportFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// importedEntity returns the one entity carrying tag
+func importedEntity(t *testing.T, repo *binary.EntityRepository, tag string) *models.Entity {
+	t.Helper()
+	entities, err := repo.ListByTag(tag)
+	if err != nil || len(entities) != 1 {
+		t.Fatalf("ListByTag(%s) = %d entities, %v; want 1", tag, len(entities), err)
+	}
+	return entities[0]
+}
+
+// TestImportCSV checks that CSV columns map to tags and content, that bad
+// rows are reported by line and skipped, and that a dry run creates nothing
+func TestImportCSV(t *testing.T) {
+	repo := newTestRepository(t)
+	service := NewImportService(repo)
+	path := writeImportFile(t, "products.csv", "sku,country,name\n"+
+		"p-1,NL,Widget\n"+
+		"p-2,,Gadget\n"+
+		"p-3,DE\n"+
+		"p-4,F\"R,Gizmo\n"+
+		"p-5,BE,Doohickey\n")
+	options := ImportOptions{
+		Format: ImportFormatCSV,
+		Mapping: ImportMapping{
+			EntityType:   "product",
+			Dataset:      "shop",
+			Tags:         []string{"source:legacy"},
+			TagFields:    []ImportTagField{{Namespace: "sku", Field: "sku"}, {Namespace: "origin", Field: "country"}},
+			ContentField: "name",
+		},
+		DryRun: true,
+	}
+	want := &ImportResult{Format: ImportFormatCSV, DryRun: true, Rows: 5, Imported: 3, Failed: 2}
+
+	result, err := service.Import(context.Background(), path, options, models.SystemUserID, nil)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(result.Errors) != 2 || result.Errors[0].Row != 4 || result.Errors[1].Row != 5 {
+		t.Errorf("dry run errors = %+v, want lines 4 and 5", result.Errors)
+	}
+	result.Errors = nil
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("dry run = %+v, want %+v", result, want)
+	}
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if entities, _ := repo.ListByTag("type:product"); len(entities) != 0 {
+		t.Fatalf("dry run created %d entities", len(entities))
+	}
+
+	options.DryRun = false
+	want.DryRun = false
+	result, err = service.Import(context.Background(), path, options, models.SystemUserID, nil)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	result.Errors = nil
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("import = %+v, want %+v", result, want)
+	}
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if entities, _ := repo.ListByTag("type:product"); len(entities) != 3 {
+		t.Errorf("import created %d products, want 3", len(entities))
+	}
+
+	widget := importedEntity(t, repo, "sku:p-1")
+	for _, tag := range []string{"type:product", "dataset:shop", "source:legacy", "origin:NL", "content:type:text/plain"} {
+		if !widget.HasTag(tag) {
+			t.Errorf("p-1 lacks %s: %v", tag, widget.GetTagsWithoutTimestamp())
+		}
+	}
+	if string(widget.Content) != "Widget" {
+		t.Errorf("p-1 content = %q, want Widget", widget.Content)
+	}
+	if gadget := importedEntity(t, repo, "sku:p-2"); gadget.GetTagValue("origin") != "" {
+		t.Errorf("p-2 has an origin tag for an empty column: %v", gadget.GetTagsWithoutTimestamp())
+	}
+}
+
+// TestImportJSONL checks that JSONL fields and nested paths map to tags,
+// that the record becomes the content, and that bad lines are reported
+func TestImportJSONL(t *testing.T) {
+	repo := newTestRepository(t)
+	service := NewImportService(repo)
+	path := writeImportFile(t, "orders.jsonl", `{"id":1,"customer":{"country":"NL"},"total":12.50}`+"\n"+
+		"\n"+
+		"not json\n"+
+		`{"id":2,"customer":{"country":["NL","DE"]}}`+"\n"+
+		`{"id":3,"customer":{}}`+"\n")
+
+	country, err := ParseImportTagField("$.customer.country")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := service.Import(context.Background(), path, ImportOptions{
+		Format: ImportFormatJSONL,
+		Mapping: ImportMapping{
+			EntityType: "order",
+			Dataset:    "shop",
+			TagFields:  []ImportTagField{{Namespace: "order", Field: "id"}, country},
+		},
+	}, models.SystemUserID, nil)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Rows != 4 || result.Imported != 2 || result.Failed != 2 || len(result.Errors) != 2 ||
+		result.Errors[0].Row != 3 || result.Errors[1].Row != 4 {
+		t.Errorf("import = %+v, want 2 of 4 rows imported and lines 3 and 4 failed", result)
+	}
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	first := importedEntity(t, repo, "order:1")
+	if !first.HasTag("country:NL") || !first.HasTag("content:type:application/json") {
+		t.Errorf("order 1 tags = %v", first.GetTagsWithoutTimestamp())
+	}
+	var content map[string]interface{}
+	if err := json.Unmarshal(first.Content, &content); err != nil || content["total"] != 12.5 {
+		t.Errorf("order 1 content = %s, %v; want the record", first.Content, err)
+	}
+	if third := importedEntity(t, repo, "order:3"); third.GetTagValue("country") != "" {
+		t.Errorf("order 3 has a country tag for a missing field: %v", third.GetTagsWithoutTimestamp())
+	}
+}
+
+// TestImportMaxErrors checks that an import stops after MaxErrors failed rows
+func TestImportMaxErrors(t *testing.T) {
+	repo := newTestRepository(t)
+	service := NewImportService(repo)
+	path := writeImportFile(t, "bad.jsonl", "1\n2\n3\n{\"id\":4}\n")
+	result, err := service.Import(context.Background(), path, ImportOptions{
+		Format:    ImportFormatJSONL,
+		Mapping:   ImportMapping{EntityType: "order", Dataset: "shop"},
+		MaxErrors: 2,
+	}, models.SystemUserID, nil)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if !result.Aborted || result.Rows != 2 || result.Failed != 2 || result.Imported != 0 {
+		t.Errorf("import = %+v, want it aborted after 2 failed rows", result)
+	}
+}
+
+// TestImportValidate checks that invalid options are refused before any
+// record is read
+func TestImportValidate(t *testing.T) {
+	service := NewImportService(nil)
+	valid := ImportMapping{EntityType: "product", Dataset: "shop"}
+	for _, tc := range []struct {
+		name    string
+		options ImportOptions
+	}{
+		{"unknown format", ImportOptions{Format: "xlsx", Mapping: valid}},
+		{"sqlite without a table", ImportOptions{Format: ImportFormatSQLite, Mapping: valid}},
+		{"negative max errors", ImportOptions{Format: ImportFormatCSV, Mapping: valid, MaxErrors: -1}},
+		{"no type", ImportOptions{Format: ImportFormatCSV, Mapping: ImportMapping{Dataset: "shop"}}},
+		{"dataset with a colon", ImportOptions{Format: ImportFormatCSV, Mapping: ImportMapping{EntityType: "product", Dataset: "shop:eu"}}},
+		{"tag without a value", ImportOptions{Format: ImportFormatCSV, Mapping: ImportMapping{EntityType: "product", Dataset: "shop", Tags: []string{"source"}}}},
+		{"protected tag", ImportOptions{Format: ImportFormatCSV, Mapping: ImportMapping{EntityType: "product", Dataset: "shop", Tags: []string{"acl:read:user:mallory"}}}},
+		{"protected tag field", ImportOptions{Format: ImportFormatCSV, Mapping: ImportMapping{EntityType: "product", Dataset: "shop", TagFields: []ImportTagField{{Namespace: "rbac", Field: "role"}}}}},
+	} {
+		if err := service.Validate(tc.options); err == nil {
+			t.Errorf("%s: Validate succeeded, want an error", tc.name)
+		}
+	}
+	if err := service.Validate(ImportOptions{Format: ImportFormatCSV, Mapping: valid}); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+// TestParseImportTagField checks the namespace=field and field forms
+func TestParseImportTagField(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		want ImportTagField
+	}{
+		{"country", ImportTagField{Namespace: "country", Field: "country"}},
+		{"origin = country", ImportTagField{Namespace: "origin", Field: "country"}},
+		{"$.customer.country", ImportTagField{Namespace: "country", Field: "$.customer.country"}},
+		{"region=$.customer.country", ImportTagField{Namespace: "region", Field: "$.customer.country"}},
+	} {
+		if got, err := ParseImportTagField(tc.spec); err != nil || got != tc.want {
+			t.Errorf("ParseImportTagField(%q) = %+v, %v; want %+v", tc.spec, got, err, tc.want)
+		}
+	}
+	for _, spec := range []string{"", "=country", "origin=", "geo:country=country"} {
+		if _, err := ParseImportTagField(spec); err == nil {
+			t.Errorf("ParseImportTagField(%q) succeeded, want an error", spec)
+		}
+	}
+}
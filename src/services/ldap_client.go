@@ -0,0 +1,718 @@
+package services
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A minimal LDAPv3 client (RFC 4511): simple bind, StartTLS and subtree
+// search with the paged results control, which directories such as Active
+// Directory require for more than 1000 entries.
+
+// LDAP result codes used by the client
+const (
+	ldapSuccess            = 0
+	ldapInvalidCredentials = 49
+)
+
+// BER tags of the LDAP operations and filters used by the client
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+
+	ldapBindRequest      = 0x60
+	ldapBindResponse     = 0x61
+	ldapUnbindRequest    = 0x42
+	ldapSearchRequest    = 0x63
+	ldapSearchEntry      = 0x64
+	ldapSearchDone       = 0x65
+	ldapSearchReference  = 0x73
+	ldapExtendedRequest  = 0x77
+	ldapExtendedResponse = 0x78
+	ldapControls         = 0xa0
+
+	ldapStartTLSOID    = "1.3.6.1.4.1.1466.20037"
+	ldapPagedResultOID = "1.2.840.113556.1.4.319"
+
+	// ldapMaxMessageSize bounds a single response message
+	ldapMaxMessageSize = 16 << 20
+
+	// ldapPageSize is the number of entries requested per search page
+	ldapPageSize = 500
+)
+
+// LDAPError is a non-success LDAP result
+type LDAPError struct {
+	Code    int
+	Message string
+}
+
+func (e *LDAPError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("LDAP result code %d", e.Code)
+	}
+	return fmt.Sprintf("LDAP result code %d: %s", e.Code, e.Message)
+}
+
+// IsLDAPInvalidCredentials reports whether err is a failed bind
+func IsLDAPInvalidCredentials(err error) bool {
+	var ldapErr *LDAPError
+	return errors.As(err, &ldapErr) && ldapErr.Code == ldapInvalidCredentials
+}
+
+// LDAPEntry is a search result
+type LDAPEntry struct {
+	DN         string
+	Attributes map[string][][]byte // keyed by lower-cased attribute name
+}
+
+// Values returns the values of an attribute as strings
+func (e *LDAPEntry) Values(attribute string) []string {
+	raw := e.Attributes[strings.ToLower(attribute)]
+	values := make([]string, len(raw))
+	for i, value := range raw {
+		values[i] = string(value)
+	}
+	return values
+}
+
+// Value returns the first value of an attribute
+func (e *LDAPEntry) Value(attribute string) string {
+	if raw := e.Attributes[strings.ToLower(attribute)]; len(raw) > 0 {
+		return string(raw[0])
+	}
+	return ""
+}
+
+// ldapConn is a connection to an LDAP server. Operations are synchronous;
+// a connection must not be used concurrently.
+type ldapConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	nextID  int64
+}
+
+// dialLDAP connects to an ldap:// or ldaps:// URL, upgrading ldap://
+// connections with StartTLS when startTLS is set
+func dialLDAP(rawURL string, startTLS bool, tlsConfig *tls.Config, timeout time.Duration) (*ldapConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "389"
+		if u.Scheme == "ldaps" {
+			port = "636"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	config := tlsConfig.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		conn, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, config)
+	default:
+		return nil, fmt.Errorf("unsupported LDAP URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+
+	c := &ldapConn{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+	if startTLS && u.Scheme == "ldap" {
+		if err := c.startTLS(config); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// startTLS upgrades the connection to TLS
+func (c *ldapConn) startTLS(config *tls.Config) error {
+	op := berEncode(ldapExtendedRequest, berEncode(0x80, []byte(ldapStartTLSOID)))
+	response, err := c.roundTrip(op, nil)
+	if err != nil {
+		return fmt.Errorf("StartTLS failed: %w", err)
+	}
+	if response.tag != ldapExtendedResponse {
+		return fmt.Errorf("StartTLS failed: unexpected response 0x%x", response.tag)
+	}
+	if err := ldapResult(response); err != nil {
+		return fmt.Errorf("StartTLS failed: %w", err)
+	}
+	tlsConn := tls.Client(c.conn, config)
+	tlsConn.SetDeadline(time.Now().Add(c.timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("StartTLS handshake failed: %w", err)
+	}
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Close sends an unbind request and closes the connection
+func (c *ldapConn) Close() error {
+	c.nextID++
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	c.conn.Write(berEncode(berSequence, berInt(berInteger, c.nextID), berEncode(ldapUnbindRequest, nil)))
+	return c.conn.Close()
+}
+
+// Bind authenticates with a DN and password. Empty passwords are rejected:
+// servers treat them as unauthenticated binds, which always succeed.
+func (c *ldapConn) Bind(dn, password string) error {
+	if password == "" {
+		return &LDAPError{Code: ldapInvalidCredentials, Message: "empty password"}
+	}
+	op := berEncode(ldapBindRequest,
+		berInt(berInteger, 3),
+		berEncode(berOctetString, []byte(dn)),
+		berEncode(0x80, []byte(password)),
+	)
+	response, err := c.roundTrip(op, nil)
+	if err != nil {
+		return err
+	}
+	if response.tag != ldapBindResponse {
+		return fmt.Errorf("unexpected bind response 0x%x", response.tag)
+	}
+	return ldapResult(response)
+}
+
+// Search returns the entries below baseDN matching filter, fetching them in
+// pages
+func (c *ldapConn) Search(baseDN, filter string, attributes []string) ([]*LDAPEntry, error) {
+	encodedFilter, err := compileLDAPFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([][]byte, len(attributes))
+	for i, attribute := range attributes {
+		attrs[i] = berEncode(berOctetString, []byte(attribute))
+	}
+	op := berEncode(ldapSearchRequest,
+		berEncode(berOctetString, []byte(baseDN)),
+		berInt(berEnumerated, 2), // wholeSubtree
+		berInt(berEnumerated, 0), // neverDerefAliases
+		berInt(berInteger, 0),    // no size limit
+		berInt(berInteger, int64(c.timeout/time.Second)),
+		berEncode(berBoolean, []byte{0}),
+		encodedFilter,
+		berEncode(berSequence, attrs...),
+	)
+
+	var entries []*LDAPEntry
+	var cookie []byte
+	for {
+		pagedControl := berEncode(berSequence,
+			berEncode(berOctetString, []byte(ldapPagedResultOID)),
+			berEncode(berOctetString, berEncode(berSequence,
+				berInt(berInteger, ldapPageSize),
+				berEncode(berOctetString, cookie),
+			)),
+		)
+		id, err := c.send(op, berEncode(ldapControls, pagedControl))
+		if err != nil {
+			return nil, err
+		}
+
+		cookie = nil
+		for done := false; !done; {
+			message, err := c.receive(id)
+			if err != nil {
+				return nil, err
+			}
+			switch message.op.tag {
+			case ldapSearchEntry:
+				entry, err := parseLDAPEntry(message.op)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, entry)
+			case ldapSearchReference:
+				// Referrals to other servers are not followed
+			case ldapSearchDone:
+				if err := ldapResult(message.op); err != nil {
+					return nil, err
+				}
+				cookie = pagedResultCookie(message.controls)
+				done = true
+			default:
+				return nil, fmt.Errorf("unexpected search response 0x%x", message.op.tag)
+			}
+		}
+		if len(cookie) == 0 {
+			return entries, nil
+		}
+	}
+}
+
+// ldapMessage is a decoded LDAPMessage
+type ldapMessage struct {
+	id       int64
+	op       berValue
+	controls []berValue
+}
+
+// roundTrip sends an operation and reads its single response
+func (c *ldapConn) roundTrip(op, controls []byte) (berValue, error) {
+	id, err := c.send(op, controls)
+	if err != nil {
+		return berValue{}, err
+	}
+	message, err := c.receive(id)
+	if err != nil {
+		return berValue{}, err
+	}
+	return message.op, nil
+}
+
+// send writes an LDAPMessage and returns its message ID
+func (c *ldapConn) send(op, controls []byte) (int64, error) {
+	c.nextID++
+	message := berEncode(berSequence, berInt(berInteger, c.nextID), op, controls)
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(message); err != nil {
+		return 0, fmt.Errorf("failed to send LDAP request: %w", err)
+	}
+	return c.nextID, nil
+}
+
+// receive reads the next LDAPMessage, which must answer message id
+func (c *ldapConn) receive(id int64) (*ldapMessage, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	raw, err := readBERMessage(c.reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LDAP response: %w", err)
+	}
+	envelope, _, err := berDecode(raw)
+	if err != nil || envelope.tag != berSequence {
+		return nil, fmt.Errorf("malformed LDAP response")
+	}
+	parts, err := envelope.children()
+	if err != nil || len(parts) < 2 {
+		return nil, fmt.Errorf("malformed LDAP response")
+	}
+	message := &ldapMessage{id: parts[0].int(), op: parts[1]}
+	if len(parts) > 2 && parts[2].tag == ldapControls {
+		message.controls, _ = parts[2].children()
+	}
+	if message.id == 0 {
+		// Notice of disconnection
+		return nil, fmt.Errorf("LDAP server closed the connection: %v", ldapResult(message.op))
+	}
+	if message.id != id {
+		return nil, fmt.Errorf("unexpected LDAP message ID %d, expected %d", message.id, id)
+	}
+	return message, nil
+}
+
+// ldapResult converts an LDAPResult to an error
+func ldapResult(op berValue) error {
+	parts, err := op.children()
+	if err != nil || len(parts) < 3 {
+		return fmt.Errorf("malformed LDAP result")
+	}
+	if code := int(parts[0].int()); code != ldapSuccess {
+		return &LDAPError{Code: code, Message: string(parts[2].content)}
+	}
+	return nil
+}
+
+// parseLDAPEntry decodes a SearchResultEntry
+func parseLDAPEntry(op berValue) (*LDAPEntry, error) {
+	parts, err := op.children()
+	if err != nil || len(parts) < 2 {
+		return nil, fmt.Errorf("malformed LDAP search entry")
+	}
+	entry := &LDAPEntry{DN: string(parts[0].content), Attributes: make(map[string][][]byte)}
+	attributes, err := parts[1].children()
+	if err != nil {
+		return nil, fmt.Errorf("malformed LDAP search entry %s", entry.DN)
+	}
+	for _, attribute := range attributes {
+		pair, err := attribute.children()
+		if err != nil || len(pair) < 2 {
+			return nil, fmt.Errorf("malformed attribute in LDAP entry %s", entry.DN)
+		}
+		values, err := pair[1].children()
+		if err != nil {
+			return nil, fmt.Errorf("malformed attribute in LDAP entry %s", entry.DN)
+		}
+		name := strings.ToLower(string(pair[0].content))
+		for _, value := range values {
+			entry.Attributes[name] = append(entry.Attributes[name], value.content)
+		}
+	}
+	return entry, nil
+}
+
+// pagedResultCookie returns the cookie of a paged results response control
+func pagedResultCookie(controls []berValue) []byte {
+	for _, control := range controls {
+		parts, err := control.children()
+		if err != nil || len(parts) < 2 || string(parts[0].content) != ldapPagedResultOID {
+			continue
+		}
+		value := parts[len(parts)-1]
+		inner, _, err := berDecode(value.content)
+		if err != nil {
+			return nil
+		}
+		fields, err := inner.children()
+		if err != nil || len(fields) < 2 {
+			return nil
+		}
+		return fields[1].content
+	}
+	return nil
+}
+
+// berValue is a decoded BER element
+type berValue struct {
+	tag     byte
+	content []byte
+}
+
+// children decodes the elements of a constructed value
+func (v berValue) children() ([]berValue, error) {
+	var values []berValue
+	rest := v.content
+	for len(rest) > 0 {
+		child, remaining, err := berDecode(rest)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, child)
+		rest = remaining
+	}
+	return values, nil
+}
+
+// int decodes an INTEGER or ENUMERATED value
+func (v berValue) int() int64 {
+	var n int64
+	for i, b := range v.content {
+		if i == 0 && b&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(b)
+	}
+	return n
+}
+
+// berEncode encodes an element from its tag and the concatenated contents
+func berEncode(tag byte, contents ...[]byte) []byte {
+	length := 0
+	for _, content := range contents {
+		length += len(content)
+	}
+	encoded := append([]byte{tag}, berLength(length)...)
+	for _, content := range contents {
+		encoded = append(encoded, content...)
+	}
+	return encoded
+}
+
+// berLength encodes a definite length
+func berLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	var digits []byte
+	for n := length; n > 0; n >>= 8 {
+		digits = append([]byte{byte(n)}, digits...)
+	}
+	return append([]byte{0x80 | byte(len(digits))}, digits...)
+}
+
+// berInt encodes an INTEGER or ENUMERATED value
+func berInt(tag byte, n int64) []byte {
+	var content []byte
+	for {
+		content = append([]byte{byte(n)}, content...)
+		if n >= -128 && n < 128 {
+			return berEncode(tag, content)
+		}
+		n >>= 8
+	}
+}
+
+// berDecode decodes one element and returns the remaining bytes
+func berDecode(data []byte) (berValue, []byte, error) {
+	if len(data) < 2 {
+		return berValue{}, nil, fmt.Errorf("truncated BER element")
+	}
+	tag := data[0]
+	length, header, err := berDecodeLength(data[1:])
+	if err != nil {
+		return berValue{}, nil, err
+	}
+	start := 1 + header
+	if length > len(data)-start {
+		return berValue{}, nil, fmt.Errorf("truncated BER element")
+	}
+	return berValue{tag: tag, content: data[start : start+length]}, data[start+length:], nil
+}
+
+// berDecodeLength decodes a definite length and returns it with the number
+// of bytes it occupied
+func berDecodeLength(data []byte) (int, int, error) {
+	if len(data) == 0 {
+		return 0, 0, fmt.Errorf("truncated BER length")
+	}
+	if data[0] < 0x80 {
+		return int(data[0]), 1, nil
+	}
+	digits := int(data[0] & 0x7f)
+	if digits == 0 || digits > 4 || len(data) < 1+digits {
+		return 0, 0, fmt.Errorf("unsupported BER length")
+	}
+	length := 0
+	for _, b := range data[1 : 1+digits] {
+		length = length<<8 | int(b)
+	}
+	return length, 1 + digits, nil
+}
+
+// readBERMessage reads one complete BER element from a stream
+func readBERMessage(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[1]&0x80 != 0 {
+		digits := int(header[1] & 0x7f)
+		if digits == 0 || digits > 4 {
+			return nil, fmt.Errorf("unsupported BER length")
+		}
+		extra := make([]byte, digits)
+		if _, err := io.ReadFull(r, extra); err != nil {
+			return nil, err
+		}
+		header = append(header, extra...)
+	}
+	length, _, err := berDecodeLength(header[1:])
+	if err != nil {
+		return nil, err
+	}
+	if length > ldapMaxMessageSize {
+		return nil, fmt.Errorf("LDAP message of %d bytes exceeds limit", length)
+	}
+	message := make([]byte, len(header)+length)
+	copy(message, header)
+	if _, err := io.ReadFull(r, message[len(header):]); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// compileLDAPFilter encodes an RFC 4515 string filter
+func compileLDAPFilter(filter string) ([]byte, error) {
+	filter = strings.TrimSpace(filter)
+	encoded, rest, err := parseLDAPFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP filter %q: %w", filter, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid LDAP filter %q: unexpected %q", filter, rest)
+	}
+	return encoded, nil
+}
+
+// parseLDAPFilter parses one parenthesized filter and returns the rest
+func parseLDAPFilter(s string) ([]byte, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", fmt.Errorf("expected '('")
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", fmt.Errorf("unexpected end")
+	}
+
+	switch s[0] {
+	case '&', '|':
+		tag := byte(0xa0)
+		if s[0] == '|' {
+			tag = 0xa1
+		}
+		s = s[1:]
+		var children [][]byte
+		for strings.HasPrefix(s, "(") {
+			child, rest, err := parseLDAPFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			children = append(children, child)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", fmt.Errorf("expected ')'")
+		}
+		return berEncode(tag, children...), s[1:], nil
+	case '!':
+		child, rest, err := parseLDAPFilter(s[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", fmt.Errorf("expected ')'")
+		}
+		return berEncode(0xa2, child), rest[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", fmt.Errorf("expected ')'")
+	}
+	encoded, err := parseLDAPItem(s[:end])
+	if err != nil {
+		return nil, "", err
+	}
+	return encoded, s[end+1:], nil
+}
+
+// parseLDAPItem encodes a simple filter item such as cn=a*b
+func parseLDAPItem(item string) ([]byte, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("missing '=' in %q", item)
+	}
+	attribute, value := item[:eq], item[eq+1:]
+	tag := byte(0xa3) // equalityMatch
+	switch attribute[len(attribute)-1] {
+	case '>':
+		tag, attribute = 0xa5, attribute[:len(attribute)-1]
+	case '<':
+		tag, attribute = 0xa6, attribute[:len(attribute)-1]
+	case '~':
+		tag, attribute = 0xa8, attribute[:len(attribute)-1]
+	case ':':
+		return parseLDAPExtensible(attribute[:len(attribute)-1], value)
+	}
+	if attribute == "" {
+		return nil, fmt.Errorf("missing attribute in %q", item)
+	}
+
+	if tag == 0xa3 && value == "*" {
+		return berEncode(0x87, []byte(attribute)), nil // present
+	}
+	if tag == 0xa3 && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		var substrings [][]byte
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			decoded, err := unescapeLDAPValue(part)
+			if err != nil {
+				return nil, err
+			}
+			choice := byte(0x81) // any
+			if i == 0 {
+				choice = 0x80 // initial
+			} else if i == len(parts)-1 {
+				choice = 0x82 // final
+			}
+			substrings = append(substrings, berEncode(choice, decoded))
+		}
+		return berEncode(0xa4, berEncode(berOctetString, []byte(attribute)), berEncode(berSequence, substrings...)), nil
+	}
+
+	decoded, err := unescapeLDAPValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return berEncode(tag, berEncode(berOctetString, []byte(attribute)), berEncode(berOctetString, decoded)), nil
+}
+
+// parseLDAPExtensible encodes an extensible match such as
+// memberOf:1.2.840.113556.1.4.1941:=cn=staff,dc=example,dc=com
+func parseLDAPExtensible(spec, value string) ([]byte, error) {
+	parts := strings.Split(spec, ":")
+	attribute, rule, dnAttributes := parts[0], "", false
+	for _, part := range parts[1:] {
+		if strings.EqualFold(part, "dn") {
+			dnAttributes = true
+		} else {
+			rule = part
+		}
+	}
+	decoded, err := unescapeLDAPValue(value)
+	if err != nil {
+		return nil, err
+	}
+	var fields [][]byte
+	if rule != "" {
+		fields = append(fields, berEncode(0x81, []byte(rule)))
+	}
+	if attribute != "" {
+		fields = append(fields, berEncode(0x82, []byte(attribute)))
+	}
+	if rule == "" && attribute == "" {
+		return nil, fmt.Errorf("extensible match needs an attribute or matching rule")
+	}
+	fields = append(fields, berEncode(0x83, decoded))
+	if dnAttributes {
+		fields = append(fields, berEncode(0x84, []byte{0xff}))
+	}
+	return berEncode(0xa9, fields...), nil
+}
+
+// unescapeLDAPValue decodes \XX escapes in a filter value
+func unescapeLDAPValue(value string) ([]byte, error) {
+	decoded := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			decoded = append(decoded, value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return nil, fmt.Errorf("truncated escape in %q", value)
+		}
+		b, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid escape in %q", value)
+		}
+		decoded = append(decoded, b[0])
+		i += 2
+	}
+	return decoded, nil
+}
+
+// EscapeLDAPFilterValue escapes raw bytes for use as a filter value
+func EscapeLDAPFilterValue(value []byte) string {
+	var escaped strings.Builder
+	for _, b := range value {
+		if b < 0x20 || b >= 0x7f || b == '*' || b == '(' || b == ')' || b == '\\' {
+			fmt.Fprintf(&escaped, "\\%02x", b)
+		} else {
+			escaped.WriteByte(b)
+		}
+	}
+	return escaped.String()
+}
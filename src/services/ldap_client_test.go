@@ -0,0 +1,356 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCompileLDAPFilter checks the BER encoding of each kind of filter
+func TestCompileLDAPFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string // hex of the BER encoding
+	}{
+		{"(cn=alice)", "a30b0402636e0405616c696365"},
+		{"  (cn=alice)  ", "a30b0402636e0405616c696365"},
+		{"(objectClass=*)", "870b6f626a656374436c617373"},
+		{"(cn=a*b*c)", "a40f0402636e3009800161810162820163"},
+		{"(cn=*mid*)", "a40b0402636e300581036d6964"},
+		{"(&(objectClass=user)(!(cn=x)))", "a020a313040b6f626a656374436c617373040475736572a209a3070402636e040178"},
+		{"(|(a=1)(b=2))", "a110a306040161040131a306040162040132"},
+		{`(cn=a\2ab)`, "a3090402636e0403612a62"},
+		{"(uid>=5)", "a5080403756964040135"},
+		{"(memberOf:1.2.840.113556.1.4.1941:=cn=staff)", "a92d8117312e322e3834302e3131333535362e312e342e3139343182086d656d6265724f668308636e3d7374616666"},
+		{"(cn:dn:=x)", "a90a8202636e8301788401ff"},
+	}
+	for _, tt := range tests {
+		got, err := compileLDAPFilter(tt.filter)
+		if err != nil {
+			t.Errorf("compileLDAPFilter(%q): %v", tt.filter, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("compileLDAPFilter(%q) = %x, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
+
+// TestCompileLDAPFilterErrors checks that malformed filters are refused
+func TestCompileLDAPFilterErrors(t *testing.T) {
+	for _, filter := range []string{
+		"",
+		"cn=alice",
+		"(cn=alice",
+		"(cn=alice))",
+		"(cnalice)",
+		"(=alice)",
+		"(>=5)",
+		"(&(a=1)",
+		"(!(a=1)",
+		`(cn=a\2)`,
+		`(cn=a\zz)`,
+		`(cn=a*\4*)`,
+		"(:=x)",
+	} {
+		if encoded, err := compileLDAPFilter(filter); err == nil {
+			t.Errorf("compileLDAPFilter(%q) = %x, want an error", filter, encoded)
+		}
+	}
+}
+
+// TestEscapeLDAPFilterValue checks that escaped values match literally
+func TestEscapeLDAPFilterValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"alice", "alice"},
+		{"a*(b)\\", `a\2a\28b\29\5c`},
+		{"nul\x00", `nul\00`},
+		{"tab\there", `tab\09here`},
+		{"Jürgen", `J\c3\bcrgen`},
+	}
+	for _, tt := range tests {
+		escaped := EscapeLDAPFilterValue([]byte(tt.value))
+		if escaped != tt.want {
+			t.Errorf("EscapeLDAPFilterValue(%q) = %q, want %q", tt.value, escaped, tt.want)
+			continue
+		}
+		// An escaped value is an equality match on the raw value, never a
+		// substring, presence or nested filter
+		got, err := compileLDAPFilter("(cn=" + escaped + ")")
+		if err != nil {
+			t.Errorf("compile escaped %q: %v", tt.value, err)
+			continue
+		}
+		want := berEncode(0xa3, berEncode(berOctetString, []byte("cn")), berEncode(berOctetString, []byte(tt.value)))
+		if !bytes.Equal(got, want) {
+			t.Errorf("escaped %q compiles to %x, want %x", tt.value, got, want)
+		}
+	}
+}
+
+// TestBERDecodeMalformed checks that truncated and malformed BER input is
+// refused rather than read past its end
+func TestBERDecodeMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string // hex
+	}{
+		{"empty", ""},
+		{"tag only", "30"},
+		{"content shorter than length", "3005020101"},
+		{"long length truncated", "308201"},
+		{"indefinite length", "3080"},
+		{"length of five bytes", "30850000000001"},
+		{"long length beyond data", "3084000100000000"},
+	} {
+		data, _ := hex.DecodeString(tt.data)
+		if value, _, err := berDecode(data); err == nil {
+			t.Errorf("%s: berDecode(%s) = %+v, want an error", tt.name, tt.data, value)
+		}
+	}
+
+	// A constructed value whose last child is cut short
+	if children, err := (berValue{tag: berSequence, content: []byte{0x02, 0x01, 0x05, 0x04, 0x03, 'a'}}).children(); err == nil {
+		t.Errorf("children of a truncated sequence = %+v, want an error", children)
+	}
+
+	// Results and entries with missing parts
+	if err := ldapResult(berValue{tag: ldapBindResponse, content: berInt(berEnumerated, 0)}); err == nil || IsLDAPInvalidCredentials(err) {
+		t.Errorf("ldapResult of a result without matched DN and message = %v, want malformed", err)
+	}
+	if entry, err := parseLDAPEntry(berValue{tag: ldapSearchEntry, content: berEncode(berOctetString, []byte("cn=a"))}); err == nil {
+		t.Errorf("parseLDAPEntry without attributes = %+v, want an error", entry)
+	}
+	attribute := berEncode(berSequence, berEncode(berSequence, berEncode(berOctetString, []byte("cn"))))
+	if entry, err := parseLDAPEntry(berValue{tag: ldapSearchEntry, content: append(berEncode(berOctetString, []byte("cn=a")), attribute...)}); err == nil {
+		t.Errorf("parseLDAPEntry with an attribute without values = %+v, want an error", entry)
+	}
+}
+
+// TestReadBERMessage checks that one message is read from a stream and that
+// truncated or oversized messages are refused
+func TestReadBERMessage(t *testing.T) {
+	message := berEncode(berSequence, berInt(berInteger, 1), berEncode(ldapSearchDone, bytes.Repeat([]byte{'x'}, 300)))
+	got, err := readBERMessage(bufio.NewReader(bytes.NewReader(append(append([]byte{}, message...), 0x30))))
+	if err != nil || !bytes.Equal(got, message) {
+		t.Fatalf("readBERMessage = %x, %v; want %x", got, err, message)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty stream", nil},
+		{"truncated header", []byte{0x30}},
+		{"truncated long length", []byte{0x30, 0x82, 0x01}},
+		{"truncated content", message[:len(message)-1]},
+		{"indefinite length", []byte{0x30, 0x80, 0x00, 0x00}},
+		{"oversized message", []byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff}},
+	} {
+		if got, err := readBERMessage(bufio.NewReader(bytes.NewReader(tt.data))); err == nil {
+			t.Errorf("%s: readBERMessage = %x, want an error", tt.name, got)
+		}
+	}
+}
+
+// ldapTestServer answers the requests of one client connection in a test
+type ldapTestServer struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newLDAPTestConn returns a client connection and the server end it talks to
+func newLDAPTestConn(t *testing.T) (*ldapConn, *ldapTestServer) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	conn := &ldapConn{conn: client, reader: bufio.NewReader(client), timeout: 5 * time.Second}
+	return conn, &ldapTestServer{conn: server, reader: bufio.NewReader(server)}
+}
+
+// read returns the message ID, operation and controls of the next request
+func (s *ldapTestServer) read() (int64, berValue, []berValue, error) {
+	raw, err := readBERMessage(s.reader)
+	if err != nil {
+		return 0, berValue{}, nil, err
+	}
+	envelope, _, err := berDecode(raw)
+	if err != nil {
+		return 0, berValue{}, nil, err
+	}
+	parts, err := envelope.children()
+	if err != nil || len(parts) < 2 {
+		return 0, berValue{}, nil, errors.New("malformed request")
+	}
+	var controls []berValue
+	if len(parts) > 2 {
+		controls, _ = parts[2].children()
+	}
+	return parts[0].int(), parts[1], controls, nil
+}
+
+// write sends a response message
+func (s *ldapTestServer) write(id int64, op []byte, controls ...[]byte) error {
+	parts := [][]byte{berInt(berInteger, id), op}
+	if len(controls) > 0 {
+		parts = append(parts, berEncode(ldapControls, controls...))
+	}
+	_, err := s.conn.Write(berEncode(berSequence, parts...))
+	return err
+}
+
+// ldapTestEntry encodes a search entry with a single valued cn attribute
+func ldapTestEntry(dn, cn string) []byte {
+	return berEncode(ldapSearchEntry,
+		berEncode(berOctetString, []byte(dn)),
+		berEncode(berSequence, berEncode(berSequence,
+			berEncode(berOctetString, []byte("CN")),
+			berEncode(0x31, berEncode(berOctetString, []byte(cn))),
+		)),
+	)
+}
+
+// ldapTestDone encodes a search result with a result code and, if set, a
+// paged results control carrying cookie
+func ldapTestDone(code int64, cookie []byte) ([]byte, [][]byte) {
+	op := berEncode(ldapSearchDone, berInt(berEnumerated, code), berEncode(berOctetString, nil), berEncode(berOctetString, []byte("done")))
+	if cookie == nil {
+		return op, nil
+	}
+	control := berEncode(berSequence,
+		berEncode(berOctetString, []byte(ldapPagedResultOID)),
+		berEncode(berOctetString, berEncode(berSequence, berInt(berInteger, 0), berEncode(berOctetString, cookie))),
+	)
+	return op, [][]byte{control}
+}
+
+// TestLDAPPagedSearch checks that a search follows the paged results cookie
+// until the server returns an empty one
+func TestLDAPPagedSearch(t *testing.T) {
+	conn, server := newLDAPTestConn(t)
+	pages := [][]string{{"alice", "bob"}, {"carol"}}
+
+	cookies := make(chan string, len(pages))
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- func() error {
+			for i, page := range pages {
+				id, op, controls, err := server.read()
+				if err != nil {
+					return err
+				}
+				if op.tag != ldapSearchRequest {
+					return errors.New("expected a search request")
+				}
+				cookies <- string(pagedResultCookie(controls))
+				for _, name := range page {
+					if err := server.write(id, ldapTestEntry("cn="+name+",dc=example", name)); err != nil {
+						return err
+					}
+				}
+				if i == 0 {
+					// References to other servers are skipped
+					if err := server.write(id, berEncode(ldapSearchReference, berEncode(berOctetString, []byte("ldap://other/")))); err != nil {
+						return err
+					}
+				}
+				cookie := []byte{}
+				if i < len(pages)-1 {
+					cookie = []byte("page-" + string(rune('1'+i)))
+				}
+				done, doneControls := ldapTestDone(ldapSuccess, cookie)
+				if err := server.write(id, done, doneControls...); err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+	}()
+
+	entries, err := conn.Search("dc=example", "(objectClass=person)", []string{"cn"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if err := <-serverErr; err != nil {
+		t.Fatalf("server: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Value("cn"))
+	}
+	if strings.Join(names, ",") != "alice,bob,carol" {
+		t.Errorf("Search returned %v, want alice, bob and carol", names)
+	}
+	if entries[0].DN != "cn=alice,dc=example" {
+		t.Errorf("first DN = %q", entries[0].DN)
+	}
+	if first, second := <-cookies, <-cookies; first != "" || second != "page-1" {
+		t.Errorf("request cookies = %q, %q; want none, then the cookie of the first page", first, second)
+	}
+}
+
+// TestLDAPSearchErrors checks that failed and malformed responses end a
+// search with an error
+func TestLDAPSearchErrors(t *testing.T) {
+	t.Run("result code", func(t *testing.T) {
+		conn, server := newLDAPTestConn(t)
+		go func() {
+			id, _, _, err := server.read()
+			if err != nil {
+				return
+			}
+			done, _ := ldapTestDone(50, nil) // insufficientAccessRights
+			server.write(id, done)
+		}()
+		_, err := conn.Search("dc=example", "(cn=*)", nil)
+		var ldapErr *LDAPError
+		if !errors.As(err, &ldapErr) || ldapErr.Code != 50 {
+			t.Errorf("Search = %v, want LDAP result 50", err)
+		}
+	})
+
+	t.Run("message ID", func(t *testing.T) {
+		conn, server := newLDAPTestConn(t)
+		go func() {
+			id, _, _, err := server.read()
+			if err != nil {
+				return
+			}
+			server.write(id+1, ldapTestEntry("cn=x", "x"))
+		}()
+		if _, err := conn.Search("dc=example", "(cn=*)", nil); err == nil || !strings.Contains(err.Error(), "message ID") {
+			t.Errorf("Search = %v, want a message ID error", err)
+		}
+	})
+
+	t.Run("malformed entry", func(t *testing.T) {
+		conn, server := newLDAPTestConn(t)
+		go func() {
+			id, _, _, err := server.read()
+			if err != nil {
+				return
+			}
+			server.write(id, berEncode(ldapSearchEntry, berEncode(berOctetString, []byte("cn=x"))))
+		}()
+		if _, err := conn.Search("dc=example", "(cn=*)", nil); err == nil {
+			t.Error("Search accepted a malformed entry")
+		}
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		conn, _ := newLDAPTestConn(t)
+		if _, err := conn.Search("dc=example", "(cn=*", nil); err == nil {
+			t.Error("Search accepted an invalid filter")
+		}
+	})
+}
@@ -0,0 +1,537 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// LDAPProvider is the external identity provider name of directory users.
+// They carry identity:ldap:<id> and auth:provider:ldap, and log in with
+// their directory password.
+const LDAPProvider = "ldap"
+
+// ldapTimeout bounds connecting and each LDAP operation
+const ldapTimeout = 30 * time.Second
+
+// adAccountDisabled is the ACCOUNTDISABLE flag of userAccountControl
+const adAccountDisabled = 0x2
+
+// LDAPSyncConfig configures directory synchronization
+type LDAPSyncConfig struct {
+	URL          string // ldap:// or ldaps://
+	StartTLS     bool
+	CACertFile   string // PEM bundle trusted for the server certificate; empty uses system roots
+	BindDN       string
+	BindPassword string
+
+	UserBaseDN        string
+	UserFilter        string
+	UsernameAttribute string
+	EmailAttribute    string
+	IDAttribute       string // stable, unique user ID such as entryUUID or objectGUID
+
+	// Group membership comes from GroupAttribute of the user entries
+	// (memberOf) or, when GroupBaseDN is set, from GroupMemberAttribute of
+	// the groups matching GroupFilter
+	GroupAttribute       string
+	GroupBaseDN          string
+	GroupFilter          string
+	GroupMemberAttribute string
+
+	// GroupRoles maps lower-cased group DNs or common names to roles.
+	// Users without a mapped group get DefaultRole; with no default role
+	// they are not synchronized.
+	GroupRoles  map[string][]string
+	DefaultRole string
+
+	Interval       time.Duration
+	Deprovision    bool // deactivate users no longer in the directory
+	LinkLocalUsers bool // convert local users holding a directory username
+}
+
+// ParseLDAPGroupRoles parses group=role pairs separated by semicolons. The
+// group is a DN or common name; the role follows the last '=', so DNs may
+// be used as they are.
+func ParseLDAPGroupRoles(value string) (map[string][]string, error) {
+	groupRoles := make(map[string][]string)
+	for _, pair := range strings.Split(value, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		eq := strings.LastIndex(pair, "=")
+		if eq <= 0 || strings.TrimSpace(pair[eq+1:]) == "" {
+			return nil, fmt.Errorf("invalid LDAP group role mapping %q, expected group=role", pair)
+		}
+		group := normalizeDN(pair[:eq])
+		groupRoles[group] = append(groupRoles[group], strings.TrimSpace(pair[eq+1:]))
+	}
+	return groupRoles, nil
+}
+
+// normalizeDN lower-cases a DN and removes spaces around separators so DNs
+// from configuration and the directory compare equal
+func normalizeDN(dn string) string {
+	rdns := strings.Split(dn, ",")
+	for i, rdn := range rdns {
+		if attribute, value, ok := strings.Cut(rdn, "="); ok {
+			rdn = strings.TrimSpace(attribute) + "=" + strings.TrimSpace(value)
+		}
+		rdns[i] = strings.ToLower(strings.TrimSpace(rdn))
+	}
+	return strings.Join(rdns, ",")
+}
+
+// commonName returns the value of the first RDN of a DN
+func commonName(dn string) string {
+	first, _, _ := strings.Cut(dn, ",")
+	if _, value, ok := strings.Cut(first, "="); ok {
+		return value
+	}
+	return first
+}
+
+// LDAPSyncConflict is a directory user that could not be synchronized
+type LDAPSyncConflict struct {
+	Username string `json:"username"`
+	DN       string `json:"dn"`
+	Reason   string `json:"reason"`
+}
+
+// LDAPSyncResult summarizes a synchronization run
+type LDAPSyncResult struct {
+	StartedAt      time.Time          `json:"started_at"`
+	Duration       string             `json:"duration"`
+	DirectoryUsers int                `json:"directory_users"`
+	Created        int                `json:"created"`
+	Updated        int                `json:"updated"`
+	Unchanged      int                `json:"unchanged"`
+	Linked         int                `json:"linked"`
+	Reactivated    int                `json:"reactivated"`
+	Deprovisioned  int                `json:"deprovisioned"`
+	Skipped        int                `json:"skipped"`
+	Conflicts      []LDAPSyncConflict `json:"conflicts,omitempty"`
+	Errors         []string           `json:"errors,omitempty"`
+}
+
+// LDAPSyncService imports directory users and their group memberships into
+// user entities with RBAC role tags, deactivates users removed from the
+// directory, and verifies directory users' passwords at login
+type LDAPSyncService struct {
+	writePauser
+
+	securityManager *models.SecurityManager
+	config          LDAPSyncConfig
+	tlsConfig       *tls.Config
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running int32
+
+	// runMu serializes synchronization runs
+	runMu sync.Mutex
+
+	mu   sync.RWMutex
+	last *LDAPSyncResult
+}
+
+// NewLDAPSyncService creates a directory synchronization service
+func NewLDAPSyncService(securityManager *models.SecurityManager, config LDAPSyncConfig) (*LDAPSyncService, error) {
+	if config.URL == "" || config.UserBaseDN == "" {
+		return nil, fmt.Errorf("LDAP sync requires a URL and user base DN")
+	}
+	if config.UsernameAttribute == "" || config.IDAttribute == "" {
+		return nil, fmt.Errorf("LDAP sync requires username and ID attributes")
+	}
+	if _, err := compileLDAPFilter(config.UserFilter); err != nil {
+		return nil, err
+	}
+	if config.GroupBaseDN != "" {
+		if _, err := compileLDAPFilter(config.GroupFilter); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CACertFile != "" {
+		pem, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP CA certificates: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LDAPSyncService{
+		securityManager: securityManager,
+		config:          config,
+		tlsConfig:       tlsConfig,
+		ctx:             ctx,
+		cancel:          cancel,
+	}, nil
+}
+
+// Start registers the login password verifier and begins periodic
+// synchronization, with a first run right away
+func (ls *LDAPSyncService) Start() error {
+	if !atomic.CompareAndSwapInt32(&ls.running, 0, 1) {
+		return fmt.Errorf("LDAP sync service is already running")
+	}
+	ls.securityManager.SetPasswordVerifier(LDAPProvider, ls.Authenticate)
+
+	logger.Info("LDAPSyncService: synchronizing %s from %s every %v", ls.config.UserBaseDN, ls.config.URL, ls.config.Interval)
+	ls.wg.Add(1)
+	go ls.syncLoop()
+	return nil
+}
+
+// Stop ends periodic synchronization
+func (ls *LDAPSyncService) Stop() error {
+	if !atomic.CompareAndSwapInt32(&ls.running, 1, 0) {
+		return nil
+	}
+	ls.cancel()
+	ls.wg.Wait()
+	return nil
+}
+
+// LastResult returns the result of the most recent run, if any
+func (ls *LDAPSyncService) LastResult() *LDAPSyncResult {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	return ls.last
+}
+
+// Config returns the service configuration without the bind password
+func (ls *LDAPSyncService) Config() LDAPSyncConfig {
+	config := ls.config
+	config.BindPassword = ""
+	return config
+}
+
+func (ls *LDAPSyncService) syncLoop() {
+	defer ls.wg.Done()
+
+	ls.runLogged()
+	if ls.config.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(ls.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ls.ctx.Done():
+			return
+		case <-ticker.C:
+			ls.runLogged()
+		}
+	}
+}
+
+func (ls *LDAPSyncService) runLogged() {
+	if ls.writesPaused() {
+		logger.Debug("LDAPSyncService: Skipping sync while writes are paused")
+		return
+	}
+	result, err := ls.RunOnce()
+	if err != nil {
+		logger.Error("LDAPSyncService: sync failed: %v", err)
+		return
+	}
+	logger.Info("LDAPSyncService: %d directory users, %d created, %d updated, %d linked, %d reactivated, %d deprovisioned, %d conflicts",
+		result.DirectoryUsers, result.Created, result.Updated, result.Linked, result.Reactivated, result.Deprovisioned, len(result.Conflicts))
+}
+
+// connect opens a connection bound as the service account
+func (ls *LDAPSyncService) connect() (*ldapConn, error) {
+	conn, err := dialLDAP(ls.config.URL, ls.config.StartTLS, ls.tlsConfig, ldapTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if ls.config.BindDN != "" {
+		if err := conn.Bind(ls.config.BindDN, ls.config.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("service account bind failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// directoryUser is a user entry mapped to an external identity
+type directoryUser struct {
+	dn       string
+	identity models.ExternalIdentity
+}
+
+// RunOnce synchronizes the directory now. Results of failed runs are
+// recorded too.
+func (ls *LDAPSyncService) RunOnce() (*LDAPSyncResult, error) {
+	ls.runMu.Lock()
+	defer ls.runMu.Unlock()
+
+	result := &LDAPSyncResult{StartedAt: time.Now()}
+	err := ls.run(result)
+	result.Duration = time.Since(result.StartedAt).String()
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	ls.mu.Lock()
+	ls.last = result
+	ls.mu.Unlock()
+	return result, err
+}
+
+func (ls *LDAPSyncService) run(result *LDAPSyncResult) error {
+	users, err := ls.readDirectory(result)
+	if err != nil {
+		return err
+	}
+
+	// Subjects of directory users that are still entitled to an account
+	present := make(map[string]bool, len(users))
+	for _, user := range users {
+		present[user.identity.Subject] = true
+		_, action, err := ls.securityManager.SyncExternalUser(user.identity, ls.config.LinkLocalUsers)
+		switch {
+		case errors.Is(err, models.ErrExternalIdentityConflict):
+			result.Conflicts = append(result.Conflicts, LDAPSyncConflict{
+				Username: user.identity.Username,
+				DN:       user.dn,
+				Reason:   "username belongs to another user",
+			})
+		case errors.Is(err, models.ErrUserInactive):
+			result.Skipped++
+		case err != nil:
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", user.dn, err))
+		case action == models.ExternalUserCreated:
+			result.Created++
+		case action == models.ExternalUserUpdated:
+			result.Updated++
+		case action == models.ExternalUserLinked:
+			result.Linked++
+		case action == models.ExternalUserReactivated:
+			result.Reactivated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	if !ls.config.Deprovision {
+		return nil
+	}
+	// An empty result is more likely a directory or filter problem than
+	// every user leaving, so nobody is deprovisioned
+	if len(users) == 0 {
+		return fmt.Errorf("directory returned no users; deprovisioning skipped")
+	}
+	existing, err := ls.securityManager.ListExternalUsers(LDAPProvider)
+	if err != nil {
+		return err
+	}
+	prefix := models.IdentityTagPrefix + LDAPProvider + ":"
+	for _, entity := range existing {
+		if !entity.HasTag("status:active") {
+			continue
+		}
+		subject := ""
+		for _, tag := range entity.GetTagsWithoutTimestamp() {
+			if strings.HasPrefix(tag, prefix) {
+				subject = strings.TrimPrefix(tag, prefix)
+				break
+			}
+		}
+		if subject == "" || present[subject] {
+			continue
+		}
+		if err := ls.securityManager.DeprovisionExternalUser(entity); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("deprovision %s: %v", entity.ID, err))
+			continue
+		}
+		logger.Info("LDAPSyncService: deprovisioned user %s (%s)", entity.GetTagValue("name"), entity.ID)
+		result.Deprovisioned++
+	}
+	return nil
+}
+
+// readDirectory searches users and groups and maps the entitled users to
+// external identities
+func (ls *LDAPSyncService) readDirectory(result *LDAPSyncResult) ([]directoryUser, error) {
+	conn, err := ls.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	attributes := []string{ls.config.UsernameAttribute, ls.config.IDAttribute, "userAccountControl"}
+	if ls.config.EmailAttribute != "" {
+		attributes = append(attributes, ls.config.EmailAttribute)
+	}
+	if ls.config.GroupBaseDN == "" && ls.config.GroupAttribute != "" {
+		attributes = append(attributes, ls.config.GroupAttribute)
+	}
+	entries, err := conn.Search(ls.config.UserBaseDN, ls.config.UserFilter, attributes)
+	if err != nil {
+		return nil, fmt.Errorf("user search failed: %w", err)
+	}
+
+	var groupMembers map[string][]string
+	if ls.config.GroupBaseDN != "" {
+		if groupMembers, err = ls.readGroups(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	users := make([]directoryUser, 0, len(entries))
+	for _, entry := range entries {
+		username := entry.Value(ls.config.UsernameAttribute)
+		rawID := entry.Attributes[strings.ToLower(ls.config.IDAttribute)]
+		if username == "" || len(rawID) == 0 || strings.ContainsAny(username, "|\r\n") {
+			result.Skipped++
+			continue
+		}
+		if uac, err := strconv.ParseInt(entry.Value("userAccountControl"), 10, 64); err == nil && uac&adAccountDisabled != 0 {
+			result.Skipped++
+			continue
+		}
+		result.DirectoryUsers++
+
+		var groups []string
+		if groupMembers != nil {
+			groups = append(groups, groupMembers[normalizeDN(entry.DN)]...)
+			groups = append(groups, groupMembers[strings.ToLower(username)]...)
+		} else {
+			groups = entry.Values(ls.config.GroupAttribute)
+		}
+		roles := ls.roles(groups)
+		if len(roles) == 0 {
+			// Not entitled; existing accounts are deprovisioned
+			result.Skipped++
+			continue
+		}
+
+		email := ""
+		if ls.config.EmailAttribute != "" {
+			email = entry.Value(ls.config.EmailAttribute)
+		}
+		users = append(users, directoryUser{
+			dn: entry.DN,
+			identity: models.ExternalIdentity{
+				Provider: LDAPProvider,
+				Subject:  ldapSubject(rawID[0]),
+				Username: username,
+				Email:    email,
+				Roles:    roles,
+			},
+		})
+	}
+	return users, nil
+}
+
+// readGroups maps normalized member DNs, and lower-cased member usernames
+// for posixGroup style memberUid values, to the DNs of their groups
+func (ls *LDAPSyncService) readGroups(conn *ldapConn) (map[string][]string, error) {
+	groups, err := conn.Search(ls.config.GroupBaseDN, ls.config.GroupFilter, []string{ls.config.GroupMemberAttribute})
+	if err != nil {
+		return nil, fmt.Errorf("group search failed: %w", err)
+	}
+	members := make(map[string][]string)
+	for _, group := range groups {
+		for _, member := range group.Values(ls.config.GroupMemberAttribute) {
+			key := strings.ToLower(member)
+			if strings.Contains(member, "=") {
+				key = normalizeDN(member)
+			}
+			members[key] = append(members[key], group.DN)
+		}
+	}
+	return members, nil
+}
+
+// roles returns the roles mapped to a user's groups, by DN or common name
+func (ls *LDAPSyncService) roles(groups []string) []string {
+	var roles []string
+	for _, group := range groups {
+		dn := normalizeDN(group)
+		roles = append(roles, ls.config.GroupRoles[dn]...)
+		if cn := commonName(dn); cn != dn {
+			roles = append(roles, ls.config.GroupRoles[cn]...)
+		}
+	}
+	if len(roles) == 0 && ls.config.DefaultRole != "" {
+		roles = []string{ls.config.DefaultRole}
+	}
+	return roles
+}
+
+// ldapSubject renders a user ID attribute value as an identity subject.
+// Binary IDs such as objectGUID are hex encoded.
+func ldapSubject(raw []byte) string {
+	if utf8.Valid(raw) && !strings.ContainsAny(string(raw), "|\x00\r\n") {
+		return string(raw)
+	}
+	return "hex:" + hex.EncodeToString(raw)
+}
+
+// ldapSubjectValue reverses ldapSubject
+func ldapSubjectValue(subject string) []byte {
+	if encoded, ok := strings.CutPrefix(subject, "hex:"); ok {
+		if raw, err := hex.DecodeString(encoded); err == nil {
+			return raw
+		}
+	}
+	return []byte(subject)
+}
+
+// Authenticate verifies a directory user's password by binding as the
+// user's current directory entry. It is registered as the login password
+// verifier of LDAP users.
+func (ls *LDAPSyncService) Authenticate(user *models.Entity, password string) error {
+	prefix := models.IdentityTagPrefix + LDAPProvider + ":"
+	subject := ""
+	for _, tag := range user.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, prefix) {
+			subject = strings.TrimPrefix(tag, prefix)
+			break
+		}
+	}
+	if subject == "" {
+		return fmt.Errorf("user has no LDAP identity")
+	}
+
+	conn, err := ls.connect()
+	if err != nil {
+		logger.Warn("LDAP login of %s failed: %v", user.ID, err)
+		return err
+	}
+	defer conn.Close()
+
+	filter := fmt.Sprintf("(&%s(%s=%s))", ls.config.UserFilter, ls.config.IDAttribute, EscapeLDAPFilterValue(ldapSubjectValue(subject)))
+	entries, err := conn.Search(ls.config.UserBaseDN, filter, []string{"1.1"})
+	if err != nil {
+		logger.Warn("LDAP login of %s failed: %v", user.ID, err)
+		return fmt.Errorf("user lookup failed: %w", err)
+	}
+	if len(entries) != 1 {
+		return fmt.Errorf("user not found in directory")
+	}
+	return conn.Bind(entries[0].DN, password)
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"context"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Purge policies are ordinary entities tagged type:purge_policy. They tell
+// the deletion collector when soft-deleted and archived entities are
+// removed for good, for example:
+//
+//	type:purge_policy
+//	purge:after:30d              (purge 30 days after deletion)
+//	purge:dataset:tenant-a       (optional, limit to one dataset)
+//	purge:type:document          (optional, limit to one entity type)
+//	purge:exclude_type:user      (optional, repeatable, never purge this type)
+//	purge:exclude_tag:keep:true  (optional, repeatable, never purge entities with this tag)
+//	purge:enabled:false          (optional, switch the policy off)
+//
+// Entities under legal hold are never purged, whatever the policy says.
+const (
+	PurgePolicyType           = "purge_policy"
+	purgeAfterTag             = "purge:after:"
+	purgeDatasetTag           = "purge:dataset:"
+	purgeEntityTypeTag        = "purge:type:"
+	purgeExcludeEntityTypeTag = "purge:exclude_type:"
+	purgeExcludeTagTag        = "purge:exclude_tag:"
+	purgeEnabledTag           = "purge:enabled:"
+)
+
+// TagPurgePolicy is a purge policy loaded from a policy entity
+type TagPurgePolicy struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name,omitempty"`
+	Dataset      string        `json:"dataset,omitempty"`
+	EntityType   string        `json:"entity_type,omitempty"`
+	ExcludeTypes []string      `json:"exclude_types,omitempty"`
+	ExcludeTags  []string      `json:"exclude_tags,omitempty"`
+	After        time.Duration `json:"-"`
+	AfterText    string        `json:"after,omitempty"`
+	Enabled      bool          `json:"enabled"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// specificity ranks how narrowly a policy is scoped; narrower policies win
+func (p TagPurgePolicy) specificity() int {
+	score := 0
+	if p.EntityType != "" {
+		score += 2
+	}
+	if p.Dataset != "" {
+		score++
+	}
+	return score
+}
+
+// matches reports whether the policy covers an entity. Excluded types and
+// tags take the entity out of the policy's scope.
+func (p TagPurgePolicy) matches(entity *models.Entity, dataset, entityType string) bool {
+	if p.Dataset != "" && p.Dataset != dataset {
+		return false
+	}
+	if p.EntityType != "" && p.EntityType != entityType {
+		return false
+	}
+	for _, excluded := range p.ExcludeTypes {
+		if excluded == entityType {
+			return false
+		}
+	}
+	for _, excluded := range p.ExcludeTags {
+		if entity.HasTag(excluded) {
+			return false
+		}
+	}
+	return true
+}
+
+// PurgeCandidate is a deleted entity a purge policy has scheduled for removal
+type PurgeCandidate struct {
+	EntityID   string    `json:"entity_id"`
+	EntityType string    `json:"entity_type,omitempty"`
+	Dataset    string    `json:"dataset,omitempty"`
+	State      string    `json:"state"`
+	DeletedAt  time.Time `json:"deleted_at"`
+	PolicyID   string    `json:"policy_id"`
+	PurgeAt    time.Time `json:"purge_at"`
+}
+
+// PurgePreview lists what the next collection cycle would purge
+type PurgePreview struct {
+	GeneratedAt time.Time `json:"generated_at"`
+
+	// NextRunAt is when the next scheduled cycle starts; it is nil when the
+	// collector only runs on demand
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+
+	DryRun     bool             `json:"dry_run"`
+	Policies   []TagPurgePolicy `json:"policies"`
+	Candidates []PurgeCandidate `json:"candidates"`
+
+	// Held counts deleted entities a policy would purge but for a legal hold
+	Held int `json:"held"`
+}
+
+// ParseTagPurgePolicy builds a policy from a policy entity's current tags
+func ParseTagPurgePolicy(entity *models.Entity) (TagPurgePolicy, error) {
+	policy := TagPurgePolicy{
+		ID:      entity.ID,
+		Name:    entity.GetTagValue("name"),
+		Enabled: true,
+	}
+
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		switch {
+		case strings.HasPrefix(tag, purgeAfterTag):
+			value := strings.TrimPrefix(tag, purgeAfterTag)
+			after, err := ParseRetentionAge(value)
+			if err != nil {
+				return policy, err
+			}
+			policy.After = after
+			policy.AfterText = value
+
+		case strings.HasPrefix(tag, purgeDatasetTag):
+			policy.Dataset = strings.TrimPrefix(tag, purgeDatasetTag)
+
+		case strings.HasPrefix(tag, purgeEntityTypeTag):
+			policy.EntityType = strings.TrimPrefix(tag, purgeEntityTypeTag)
+
+		case strings.HasPrefix(tag, purgeExcludeEntityTypeTag):
+			policy.ExcludeTypes = append(policy.ExcludeTypes, strings.TrimPrefix(tag, purgeExcludeEntityTypeTag))
+
+		case strings.HasPrefix(tag, purgeExcludeTagTag):
+			policy.ExcludeTags = append(policy.ExcludeTags, strings.TrimPrefix(tag, purgeExcludeTagTag))
+
+		case strings.HasPrefix(tag, purgeEnabledTag):
+			policy.Enabled = strings.TrimPrefix(tag, purgeEnabledTag) != "false"
+		}
+	}
+
+	if policy.After == 0 {
+		return policy, fmt.Errorf("purge policy needs a purge:after tag")
+	}
+	sort.Strings(policy.ExcludeTypes)
+	sort.Strings(policy.ExcludeTags)
+	return policy, nil
+}
+
+// LoadPurgePolicies reads all purge policy entities. Policies that fail to
+// parse are returned with Error set and are not applied.
+func (dc *DeletionCollector) LoadPurgePolicies() ([]TagPurgePolicy, error) {
+	entities, err := dc.repository.ListByTag("type:" + PurgePolicyType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list purge policies: %w", err)
+	}
+
+	policies := make([]TagPurgePolicy, 0, len(entities))
+	for _, entity := range entities {
+		policy, err := ParseTagPurgePolicy(entity)
+		if err != nil {
+			policy.Error = err.Error()
+		}
+		policies = append(policies, policy)
+	}
+
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ID < policies[j].ID
+	})
+	return policies, nil
+}
+
+// selectPurgePolicy returns the policy governing a deleted entity: the most
+// narrowly scoped matching policy, and among equally narrow ones the one
+// waiting longest, so that overlapping policies never purge early
+func selectPurgePolicy(policies []TagPurgePolicy, entity *models.Entity, dataset, entityType string) (TagPurgePolicy, bool) {
+	var selected TagPurgePolicy
+	found := false
+
+	for _, policy := range policies {
+		if !policy.Enabled || policy.Error != "" || !policy.matches(entity, dataset, entityType) {
+			continue
+		}
+		switch {
+		case !found || policy.specificity() > selected.specificity():
+			selected = policy
+			found = true
+		case policy.specificity() == selected.specificity():
+			if policy.After > selected.After || (policy.After == selected.After && policy.ID < selected.ID) {
+				selected = policy
+			}
+		}
+	}
+
+	return selected, found
+}
+
+// purgeCandidate reports when a deleted entity is due for purging under the
+// policies; ok is false for active entities and entities no policy covers
+func purgeCandidate(policies []TagPurgePolicy, entity *models.Entity) (candidate PurgeCandidate, ok bool) {
+	lifecycle := entity.Lifecycle()
+	state := lifecycle.GetCurrentState()
+	if state != models.StateSoftDeleted && state != models.StateArchived {
+		return candidate, false
+	}
+	deletedAt := lifecycle.GetDeletedAt()
+	if deletedAt == nil {
+		deletedAt = lifecycle.GetArchivedAt()
+	}
+	if deletedAt == nil {
+		return candidate, false
+	}
+
+	dataset := entity.GetTagValue("dataset")
+	entityType := entity.GetTagValue("type")
+	policy, found := selectPurgePolicy(policies, entity, dataset, entityType)
+	if !found {
+		return candidate, false
+	}
+
+	return PurgeCandidate{
+		EntityID:   entity.ID,
+		EntityType: entityType,
+		Dataset:    dataset,
+		State:      string(state),
+		DeletedAt:  *deletedAt,
+		PolicyID:   policy.ID,
+		PurgeAt:    deletedAt.Add(policy.After),
+	}, true
+}
+
+// PreviewPurge lists the deleted entities the next collection cycle would
+// purge under the current purge policies, without changing anything
+func (dc *DeletionCollector) PreviewPurge() (*PurgePreview, error) {
+	policies, err := dc.LoadPurgePolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	preview := &PurgePreview{
+		GeneratedAt: now,
+		DryRun:      dc.config.DryRun,
+		Policies:    policies,
+		Candidates:  []PurgeCandidate{},
+	}
+
+	// Entities that fall due before the next scheduled cycle are purged by it
+	cutoff := now
+	if dc.config.Enabled && dc.IsRunning() {
+		dc.mu.RLock()
+		nextRun := dc.stats.LastRunTime.Add(dc.config.Interval)
+		dc.mu.RUnlock()
+		if nextRun.Before(now) {
+			nextRun = now
+		}
+		preview.NextRunAt = &nextRun
+		cutoff = nextRun
+	}
+
+	entities, err := dc.deletedEntities()
+	if err != nil {
+		return nil, err
+	}
+	for _, entity := range entities {
+		candidate, ok := purgeCandidate(policies, entity)
+		if !ok || candidate.PurgeAt.After(cutoff) {
+			continue
+		}
+		if entity.Lifecycle().IsOnLegalHold() {
+			preview.Held++
+			continue
+		}
+		preview.Candidates = append(preview.Candidates, candidate)
+	}
+
+	sort.Slice(preview.Candidates, func(i, j int) bool {
+		return preview.Candidates[i].PurgeAt.Before(preview.Candidates[j].PurgeAt)
+	})
+	return preview, nil
+}
+
+// deletedEntities lists soft-deleted and archived entities
+func (dc *DeletionCollector) deletedEntities() ([]*models.Entity, error) {
+	var deleted []*models.Entity
+	seen := make(map[string]bool)
+	for _, state := range []models.EntityLifecycleState{models.StateSoftDeleted, models.StateArchived} {
+		entities, err := dc.repository.ListByTag("lifecycle:state:" + string(state))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s entities: %w", state, err)
+		}
+		for _, entity := range entities {
+			if !seen[entity.ID] {
+				seen[entity.ID] = true
+				deleted = append(deleted, entity)
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// applyPurgePolicies permanently removes deleted entities whose purge
+// policy period has elapsed. It returns how many entities were purged.
+func (dc *DeletionCollector) applyPurgePolicies(ctx context.Context) int {
+	policies, err := dc.LoadPurgePolicies()
+	if err != nil {
+		logger.Error("DeletionCollector: Failed to load purge policies: %v", err)
+		dc.recordError(err)
+		return 0
+	}
+	if len(policies) == 0 {
+		return 0
+	}
+
+	entities, err := dc.deletedEntities()
+	if err != nil {
+		logger.Error("DeletionCollector: %v", err)
+		dc.recordError(err)
+		return 0
+	}
+
+	now := time.Now()
+	purged := 0
+	for _, entity := range entities {
+		select {
+		case <-ctx.Done():
+			return purged
+		default:
+		}
+
+		candidate, ok := purgeCandidate(policies, entity)
+		if !ok || candidate.PurgeAt.After(now) {
+			continue
+		}
+		if entity.Lifecycle().IsOnLegalHold() {
+			logger.Debug("DeletionCollector: Entity %s is on legal hold, not purging", entity.ID)
+			continue
+		}
+		if dc.purgeByPolicy(entity, candidate) {
+			purged++
+		}
+	}
+	return purged
+}
+
+// purgeByPolicy permanently removes an entity as its purge policy demands,
+// recording the purge in the deletion index first
+func (dc *DeletionCollector) purgeByPolicy(entity *models.Entity, candidate PurgeCandidate) bool {
+	if dc.config.DryRun {
+		logger.Info("DeletionCollector: DRY RUN - Would purge entity %s (deleted %v, policy: %s)",
+			entity.ID, candidate.DeletedAt.Format(time.RFC3339), candidate.PolicyID)
+		return true
+	}
+
+	logger.Info("DeletionCollector: Purging entity %s (deleted %v, policy: %s)",
+		entity.ID, candidate.DeletedAt.Format(time.RFC3339), candidate.PolicyID)
+
+	if binaryRepo, ok := dc.repository.(*binary.EntityRepository); ok {
+		entry := binary.NewDeletionEntry(
+			entity.ID,
+			models.StatePurged,
+			dc.systemUserID,
+			"purge policy period elapsed",
+			candidate.PolicyID,
+			time.Now().UnixNano(),
+		)
+		if err := binaryRepo.AddDeletionEntry(entry); err != nil {
+			logger.Warn("DeletionCollector: Failed to record purge of %s in deletion index: %v", entity.ID, err)
+		}
+	}
+
+	if err := dc.repository.Delete(entity.ID); err != nil {
+		logger.Error("DeletionCollector: Failed to purge entity %s: %v", entity.ID, err)
+		dc.recordError(err)
+		return false
+	}
+	dc.incrementStat("purged")
+
+	// Release shared content chunks now that this referrer is gone
+	dc.ReleaseChunks(entity)
+	return true
+}
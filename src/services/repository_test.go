@@ -0,0 +1,47 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"entitydb/config"
+	"entitydb/models"
+	"entitydb/storage/binary"
+)
+
+// newTestRepository returns an empty binary repository in a temporary
+// directory, closed when the test ends
+func newTestRepository(t *testing.T) *binary.EntityRepository {
+	t.Helper()
+	cfg := config.Load()
+	cfg.DataPath = t.TempDir()
+	cfg.DatabaseFilename = filepath.Join(cfg.DataPath, "entities.edb")
+	cfg.WALFilename = filepath.Join(cfg.DataPath, "entitydb.wal")
+	cfg.IndexFilename = filepath.Join(cfg.DataPath, "entities.edb.idx")
+	repo, err := binary.NewEntityRepositoryWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// createTestEntity stores an entity and flushes it so queries see it
+func createTestEntity(t *testing.T, repo *binary.EntityRepository, entity *models.Entity) {
+	t.Helper()
+	if err := repo.Create(entity); err != nil {
+		t.Fatalf("Create %s: %v", entity.ID, err)
+	}
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+}
+
+// testWritePause is a WritePause a test switches on and off
+type testWritePause struct {
+	readOnly bool
+}
+
+func (p *testWritePause) ReadOnly() bool {
+	return p.readOnly
+}
@@ -0,0 +1,672 @@
+package services
+
+import (
+	"context"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Retention policies are ordinary entities tagged type:retention_policy.
+// Their scope and limits are tags, for example:
+//
+//	type:retention_policy
+//	retention:dataset:metrics      (optional, limit to one dataset)
+//	retention:type:sensor_reading  (optional, limit to one entity type)
+//	retention:age:90d              (drop tag values older than 90 days)
+//	retention:versions:10          (keep at most 10 values per tag namespace)
+//	retention:enabled:false        (optional, switch the policy off)
+const (
+	RetentionPolicyType    = "retention_policy"
+	retentionAgeTag        = "retention:age:"
+	retentionVersionsTag   = "retention:versions:"
+	retentionDatasetTag    = "retention:dataset:"
+	retentionEntityTypeTag = "retention:type:"
+	retentionEnabledTag    = "retention:enabled:"
+)
+
+// retentionProtectedNamespaces are tag namespaces whose history the retention
+// service never prunes: identity, security, lifecycle and content layout tags
+// are read by other subsystems and must stay intact.
+var retentionProtectedNamespaces = map[string]bool{
+	"type":       true,
+	"dataset":    true,
+	"created_at": true,
+	"created_by": true,
+	"uuid":       true,
+	"identity":   true,
+	"rbac":       true,
+	"lifecycle":  true,
+	"retention":  true,
+	"content":    true,
+	"chunk":      true,
+}
+
+// TagRetentionPolicy is a retention policy loaded from a policy entity
+type TagRetentionPolicy struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name,omitempty"`
+	Dataset     string        `json:"dataset,omitempty"`
+	EntityType  string        `json:"entity_type,omitempty"`
+	MaxAge      time.Duration `json:"-"`
+	MaxAgeText  string        `json:"max_age,omitempty"`
+	MaxVersions int           `json:"max_versions,omitempty"`
+	Enabled     bool          `json:"enabled"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// specificity ranks how narrowly a policy is scoped; narrower policies win
+func (p TagRetentionPolicy) specificity() int {
+	score := 0
+	if p.EntityType != "" {
+		score += 2
+	}
+	if p.Dataset != "" {
+		score++
+	}
+	return score
+}
+
+// matches reports whether the policy applies to an entity in the given dataset and type
+func (p TagRetentionPolicy) matches(dataset, entityType string) bool {
+	if p.Dataset != "" && p.Dataset != dataset {
+		return false
+	}
+	if p.EntityType != "" && p.EntityType != entityType {
+		return false
+	}
+	return true
+}
+
+// RetentionServiceConfig configures the retention service behavior
+type RetentionServiceConfig struct {
+	// Enabled controls whether the service runs in the background
+	Enabled bool
+
+	// Interval determines how often policies are applied
+	Interval time.Duration
+
+	// BatchSize limits how many entities are processed between cancellation checks
+	BatchSize int
+
+	// MaxRuntime limits how long a single retention cycle can run
+	MaxRuntime time.Duration
+
+	// DryRun mode counts what would be pruned without making changes
+	DryRun bool
+}
+
+// RetentionStats tracks retention service activity
+type RetentionStats struct {
+	TotalRuns       int64     `json:"total_runs"`
+	LastRunTime     time.Time `json:"last_run_time"`
+	LastRunDuration string    `json:"last_run_duration"`
+	LastRunDryRun   bool      `json:"last_run_dry_run"`
+
+	Policies        int   `json:"policies"`
+	InvalidPolicies int   `json:"invalid_policies"`
+	EntitiesScanned int64 `json:"entities_scanned"`
+	EntitiesPruned  int64 `json:"entities_pruned"`
+	TagsPruned      int64 `json:"tags_pruned"`
+	TagsWouldPrune  int64 `json:"tags_would_prune"`
+
+	// TagsPrunedByPolicy counts pruned tag values per policy ID
+	TagsPrunedByPolicy map[string]int64 `json:"tags_pruned_by_policy"`
+
+	Errors        int64     `json:"errors"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitempty"`
+}
+
+// RetentionRunResult summarizes a single retention cycle
+type RetentionRunResult struct {
+	DryRun          bool           `json:"dry_run"`
+	Duration        string         `json:"duration"`
+	Policies        int            `json:"policies"`
+	EntitiesScanned int            `json:"entities_scanned"`
+	EntitiesPruned  int            `json:"entities_pruned"`
+	TagsPruned      int            `json:"tags_pruned"`
+	ByPolicy        map[string]int `json:"by_policy"`
+	Errors          []string       `json:"errors,omitempty"`
+}
+
+// RetentionService prunes old temporal tag values according to retention
+// policy entities scoped per dataset or per entity type
+type RetentionService struct {
+	writePauser
+
+	repository models.EntityRepository
+	config     RetentionServiceConfig
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running int32
+
+	// runMu serializes retention cycles between the loop and manual runs
+	runMu sync.Mutex
+
+	stats RetentionStats
+	mu    sync.RWMutex
+}
+
+// NewRetentionService creates a new retention service
+func NewRetentionService(repository models.EntityRepository, config RetentionServiceConfig) *RetentionService {
+	if config.Interval == 0 {
+		config.Interval = 1 * time.Hour
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = 100
+	}
+	if config.MaxRuntime == 0 {
+		config.MaxRuntime = 30 * time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &RetentionService{
+		repository: repository,
+		config:     config,
+		ctx:        ctx,
+		cancel:     cancel,
+		stats: RetentionStats{
+			TagsPrunedByPolicy: make(map[string]int64),
+		},
+	}
+}
+
+// Start begins the retention service background loop
+func (rs *RetentionService) Start() error {
+	if !atomic.CompareAndSwapInt32(&rs.running, 0, 1) {
+		return fmt.Errorf("retention service is already running")
+	}
+
+	if !rs.config.Enabled {
+		logger.Info("RetentionService: Service disabled by configuration")
+		return nil
+	}
+
+	logger.Info("RetentionService: Starting service (interval: %v, dry run: %v)",
+		rs.config.Interval, rs.config.DryRun)
+
+	rs.wg.Add(1)
+	go rs.retentionLoop()
+
+	return nil
+}
+
+// Stop gracefully shuts down the retention service
+func (rs *RetentionService) Stop() error {
+	if !atomic.CompareAndSwapInt32(&rs.running, 1, 0) {
+		return fmt.Errorf("retention service is not running")
+	}
+
+	logger.Info("RetentionService: Stopping service")
+	rs.cancel()
+	rs.wg.Wait()
+	logger.Info("RetentionService: Service stopped")
+
+	return nil
+}
+
+// IsRunning returns true if the service has been started
+func (rs *RetentionService) IsRunning() bool {
+	return atomic.LoadInt32(&rs.running) == 1
+}
+
+// IsEnabled returns true if the background loop is enabled by configuration
+func (rs *RetentionService) IsEnabled() bool {
+	return rs.config.Enabled
+}
+
+// IsDryRun returns true if scheduled cycles only count what would be pruned
+func (rs *RetentionService) IsDryRun() bool {
+	return rs.config.DryRun
+}
+
+// GetStats returns current retention statistics
+func (rs *RetentionService) GetStats() RetentionStats {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	stats := rs.stats
+	stats.TagsPrunedByPolicy = make(map[string]int64, len(rs.stats.TagsPrunedByPolicy))
+	for id, count := range rs.stats.TagsPrunedByPolicy {
+		stats.TagsPrunedByPolicy[id] = count
+	}
+	return stats
+}
+
+// RunOnce executes a single retention cycle. With dryRun set nothing is
+// modified and the result reports what would have been pruned.
+func (rs *RetentionService) RunOnce(dryRun bool) (*RetentionRunResult, error) {
+	logger.Info("RetentionService: Manual retention cycle requested (dry run: %v)", dryRun)
+	return rs.runRetentionCycle(dryRun)
+}
+
+// ScheduleAction returns the scheduler action applying retention policies.
+// Scheduled runs honour the dry run setting, like the background loop.
+func (rs *RetentionService) ScheduleAction() ScheduleAction {
+	return ScheduleAction{
+		Resource:   "admin",
+		Permission: "update",
+		Run: func(ctx context.Context, schedule Schedule, owner *models.SecurityUser) (interface{}, error) {
+			logger.Info("RetentionService: Retention cycle started by schedule %s", schedule.ID)
+			result, err := rs.runRetentionCycle(rs.config.DryRun)
+			if result == nil {
+				return nil, err
+			}
+			return result, err
+		},
+	}
+}
+
+// retentionLoop is the main background loop
+func (rs *RetentionService) retentionLoop() {
+	defer rs.wg.Done()
+
+	ticker := time.NewTicker(rs.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rs.ctx.Done():
+			logger.Debug("RetentionService: Retention loop stopping")
+			return
+
+		case <-ticker.C:
+			if rs.writesPaused() {
+				logger.Debug("RetentionService: Skipping retention cycle while writes are paused")
+				continue
+			}
+			if _, err := rs.runRetentionCycle(rs.config.DryRun); err != nil {
+				logger.Error("RetentionService: Retention cycle failed: %v", err)
+				rs.recordError(err)
+			}
+		}
+	}
+}
+
+// LoadPolicies reads all retention policy entities. Policies that fail to
+// parse are returned with Error set and are not applied.
+func (rs *RetentionService) LoadPolicies() ([]TagRetentionPolicy, error) {
+	entities, err := rs.repository.ListByTag("type:" + RetentionPolicyType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %w", err)
+	}
+
+	policies := make([]TagRetentionPolicy, 0, len(entities))
+	for _, entity := range entities {
+		policy, err := ParseTagRetentionPolicy(entity)
+		if err != nil {
+			policy.Error = err.Error()
+		}
+		policies = append(policies, policy)
+	}
+
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ID < policies[j].ID
+	})
+	return policies, nil
+}
+
+// ParseTagRetentionPolicy builds a policy from a policy entity's current tags
+func ParseTagRetentionPolicy(entity *models.Entity) (TagRetentionPolicy, error) {
+	policy := TagRetentionPolicy{
+		ID:      entity.ID,
+		Name:    entity.GetTagValue("name"),
+		Enabled: true,
+	}
+
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		switch {
+		case strings.HasPrefix(tag, retentionAgeTag):
+			value := strings.TrimPrefix(tag, retentionAgeTag)
+			age, err := ParseRetentionAge(value)
+			if err != nil {
+				return policy, err
+			}
+			policy.MaxAge = age
+			policy.MaxAgeText = value
+
+		case strings.HasPrefix(tag, retentionVersionsTag):
+			value := strings.TrimPrefix(tag, retentionVersionsTag)
+			versions, err := strconv.Atoi(value)
+			if err != nil || versions < 1 {
+				return policy, fmt.Errorf("invalid retention versions %q: must be a positive integer", value)
+			}
+			policy.MaxVersions = versions
+
+		case strings.HasPrefix(tag, retentionDatasetTag):
+			policy.Dataset = strings.TrimPrefix(tag, retentionDatasetTag)
+
+		case strings.HasPrefix(tag, retentionEntityTypeTag):
+			policy.EntityType = strings.TrimPrefix(tag, retentionEntityTypeTag)
+
+		case strings.HasPrefix(tag, retentionEnabledTag):
+			policy.Enabled = strings.TrimPrefix(tag, retentionEnabledTag) != "false"
+		}
+	}
+
+	if policy.MaxAge == 0 && policy.MaxVersions == 0 {
+		return policy, fmt.Errorf("retention policy needs a retention:age or retention:versions tag")
+	}
+	return policy, nil
+}
+
+// ParseRetentionAge parses ages such as 90d, 2w, 36h or 30m
+func ParseRetentionAge(value string) (time.Duration, error) {
+	if len(value) > 1 {
+		unit := value[len(value)-1]
+		if unit == 'd' || unit == 'w' {
+			n, err := strconv.Atoi(value[:len(value)-1])
+			if err == nil && n > 0 {
+				days := time.Duration(n) * 24 * time.Hour
+				if unit == 'w' {
+					days *= 7
+				}
+				return days, nil
+			}
+		}
+	}
+
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid retention age %q: use a positive duration such as 90d, 2w or 36h", value)
+	}
+	return age, nil
+}
+
+// selectPolicy returns the policy governing an entity: the most narrowly
+// scoped matching policies, combined by taking the strictest limits
+func selectPolicy(policies []TagRetentionPolicy, dataset, entityType string) (TagRetentionPolicy, bool) {
+	var selected TagRetentionPolicy
+	found := false
+
+	for _, policy := range policies {
+		if !policy.matches(dataset, entityType) {
+			continue
+		}
+		switch {
+		case !found || policy.specificity() > selected.specificity():
+			selected = policy
+			found = true
+		case policy.specificity() == selected.specificity():
+			if policy.MaxAge > 0 && (selected.MaxAge == 0 || policy.MaxAge < selected.MaxAge) {
+				selected.MaxAge = policy.MaxAge
+				selected.MaxAgeText = policy.MaxAgeText
+			}
+			if policy.MaxVersions > 0 && (selected.MaxVersions == 0 || policy.MaxVersions < selected.MaxVersions) {
+				selected.MaxVersions = policy.MaxVersions
+			}
+			if policy.ID < selected.ID {
+				selected.ID = policy.ID
+			}
+		}
+	}
+
+	return selected, found
+}
+
+// pruneTemporalTags applies a policy to an entity's tags. Temporal tag values
+// are grouped by namespace (the part before the first colon, as in
+// GetCurrentTags); the newest value of every namespace is always kept, as are
+// non-temporal tags and protected namespaces.
+func pruneTemporalTags(tags []string, policy TagRetentionPolicy, now time.Time) ([]string, int) {
+	type temporalTag struct {
+		index     int
+		timestamp int64
+	}
+
+	byNamespace := make(map[string][]temporalTag)
+	for i, tag := range tags {
+		pipe := strings.Index(tag, "|")
+		if pipe < 0 {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(tag[:pipe], 10, 64)
+		if err != nil {
+			continue
+		}
+		namespace := tag[pipe+1:]
+		if colon := strings.Index(namespace, ":"); colon >= 0 {
+			namespace = namespace[:colon]
+		}
+		if retentionProtectedNamespaces[namespace] {
+			continue
+		}
+		byNamespace[namespace] = append(byNamespace[namespace], temporalTag{index: i, timestamp: timestamp})
+	}
+
+	cutoff := int64(0)
+	if policy.MaxAge > 0 {
+		cutoff = now.Add(-policy.MaxAge).UnixNano()
+	}
+
+	remove := make(map[int]bool)
+	for _, values := range byNamespace {
+		// Newest first
+		sort.Slice(values, func(i, j int) bool {
+			return values[i].timestamp > values[j].timestamp
+		})
+		for rank, value := range values {
+			if rank == 0 {
+				continue
+			}
+			if policy.MaxVersions > 0 && rank >= policy.MaxVersions {
+				remove[value.index] = true
+			} else if cutoff > 0 && value.timestamp < cutoff {
+				remove[value.index] = true
+			}
+		}
+	}
+
+	if len(remove) == 0 {
+		return tags, 0
+	}
+
+	kept := make([]string, 0, len(tags)-len(remove))
+	for i, tag := range tags {
+		if !remove[i] {
+			kept = append(kept, tag)
+		}
+	}
+	return kept, len(remove)
+}
+
+// runRetentionCycle applies all enabled policies to every entity they govern
+func (rs *RetentionService) runRetentionCycle(dryRun bool) (*RetentionRunResult, error) {
+	rs.runMu.Lock()
+	defer rs.runMu.Unlock()
+
+	startTime := time.Now()
+
+	cycleCtx, cycleCancel := context.WithTimeout(rs.ctx, rs.config.MaxRuntime)
+	defer cycleCancel()
+
+	loaded, err := rs.LoadPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]TagRetentionPolicy, 0, len(loaded))
+	invalid := 0
+	for _, policy := range loaded {
+		if policy.Error != "" {
+			invalid++
+			logger.Warn("RetentionService: Skipping invalid policy %s: %s", policy.ID, policy.Error)
+			continue
+		}
+		if policy.Enabled {
+			policies = append(policies, policy)
+		}
+	}
+
+	result := &RetentionRunResult{
+		DryRun:   dryRun,
+		Policies: len(policies),
+		ByPolicy: make(map[string]int),
+	}
+
+	rs.mu.Lock()
+	rs.stats.TotalRuns++
+	rs.stats.LastRunTime = startTime
+	rs.stats.LastRunDryRun = dryRun
+	rs.stats.Policies = len(policies)
+	rs.stats.InvalidPolicies = invalid
+	rs.mu.Unlock()
+
+	if len(policies) > 0 {
+		candidates, err := rs.candidateEntities(policies)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		for i, entity := range candidates {
+			if i%rs.config.BatchSize == 0 {
+				select {
+				case <-cycleCtx.Done():
+					logger.Warn("RetentionService: Retention cycle cancelled due to timeout")
+					rs.finishCycle(result, startTime)
+					return result, cycleCtx.Err()
+				default:
+				}
+			}
+
+			rs.applyToEntity(entity, policies, now, dryRun, result)
+		}
+	}
+
+	rs.finishCycle(result, startTime)
+
+	logger.Info("RetentionService: Retention cycle completed in %s (scanned: %d, pruned %d tags from %d entities, dry run: %v)",
+		result.Duration, result.EntitiesScanned, result.TagsPruned, result.EntitiesPruned, dryRun)
+
+	return result, nil
+}
+
+// candidateEntities returns the entities any policy could govern. Scoped
+// policies are resolved through the tag index; an unscoped policy covers
+// every entity.
+func (rs *RetentionService) candidateEntities(policies []TagRetentionPolicy) ([]*models.Entity, error) {
+	scopeTags := make(map[string]bool)
+	for _, policy := range policies {
+		switch {
+		case policy.EntityType != "":
+			scopeTags["type:"+policy.EntityType] = true
+		case policy.Dataset != "":
+			scopeTags["dataset:"+policy.Dataset] = true
+		default:
+			entities, err := rs.repository.List()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list entities: %w", err)
+			}
+			return entities, nil
+		}
+	}
+
+	seen := make(map[string]bool)
+	var candidates []*models.Entity
+	for tag := range scopeTags {
+		entities, err := rs.repository.ListByTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list entities tagged %s: %w", tag, err)
+		}
+		for _, entity := range entities {
+			if !seen[entity.ID] {
+				seen[entity.ID] = true
+				candidates = append(candidates, entity)
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// applyToEntity prunes one entity's tags according to the policy governing it
+func (rs *RetentionService) applyToEntity(entity *models.Entity, policies []TagRetentionPolicy, now time.Time, dryRun bool, result *RetentionRunResult) {
+	entityType := entity.GetTagValue("type")
+	if entityType == RetentionPolicyType {
+		return
+	}
+	// The history of entities under legal hold must stay intact
+	if entity.HasTag(models.LegalHoldTag) {
+		return
+	}
+	// Neither is the history of entities in write-once datasets pruned
+	if worm, ok := rs.repository.(interface{ IsWriteOnceDataset(string) bool }); ok && worm.IsWriteOnceDataset(entity.GetDataset()) {
+		return
+	}
+
+	policy, ok := selectPolicy(policies, entity.GetDataset(), entityType)
+	if !ok {
+		return
+	}
+	result.EntitiesScanned++
+
+	kept, removed := pruneTemporalTags(entity.Tags, policy, now)
+	if removed == 0 {
+		return
+	}
+
+	if !dryRun {
+		// Update a copy: the listed entity may be the cached instance, whose
+		// old tags the repository needs to clear from the indexes
+		pruned := &models.Entity{
+			ID:        entity.ID,
+			Tags:      kept,
+			Content:   entity.Content,
+			CreatedAt: entity.CreatedAt,
+		}
+		if err := rs.repository.Update(pruned); err != nil {
+			logger.Error("RetentionService: Failed to prune entity %s: %v", entity.ID, err)
+			rs.recordError(err)
+			if len(result.Errors) < 100 {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", entity.ID, err))
+			}
+			return
+		}
+	}
+
+	logger.Debug("RetentionService: Pruned %d tag values from entity %s (policy %s, dry run: %v)",
+		removed, entity.ID, policy.ID, dryRun)
+
+	result.EntitiesPruned++
+	result.TagsPruned += removed
+	result.ByPolicy[policy.ID] += removed
+}
+
+// finishCycle folds a cycle's result into the service statistics
+func (rs *RetentionService) finishCycle(result *RetentionRunResult, startTime time.Time) {
+	duration := time.Since(startTime)
+	result.Duration = duration.String()
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.stats.LastRunDuration = result.Duration
+	rs.stats.EntitiesScanned += int64(result.EntitiesScanned)
+	if result.DryRun {
+		rs.stats.TagsWouldPrune += int64(result.TagsPruned)
+		return
+	}
+	rs.stats.EntitiesPruned += int64(result.EntitiesPruned)
+	rs.stats.TagsPruned += int64(result.TagsPruned)
+	for id, count := range result.ByPolicy {
+		rs.stats.TagsPrunedByPolicy[id] += int64(count)
+	}
+}
+
+// recordError records an error in the statistics
+func (rs *RetentionService) recordError(err error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.stats.Errors++
+	rs.stats.LastError = err.Error()
+	rs.stats.LastErrorTime = time.Now()
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestParseRetentionAge checks the day and week units and Go durations
+func TestParseRetentionAge(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"90d": 90 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+		"30m": 30 * time.Minute,
+	} {
+		if got, err := ParseRetentionAge(value); err != nil || got != want {
+			t.Errorf("ParseRetentionAge(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "d", "0d", "-1w", "0s", "-5m", "ninety days"} {
+		if _, err := ParseRetentionAge(value); err == nil {
+			t.Errorf("ParseRetentionAge(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+// TestPruneTemporalTags checks which tag values a policy removes
+func TestPruneTemporalTags(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(tag string, days int) string {
+		return models.FormatTemporalTagAt(tag, now.AddDate(0, 0, -days).UnixNano())
+	}
+	tags := []string{
+		daysAgo("status:new", 40),
+		daysAgo("status:open", 20),
+		daysAgo("status:closed", 10),
+		daysAgo("status:archived", 1),
+		daysAgo("owner:alice", 50),
+		daysAgo("rbac:role:admin", 60),
+		daysAgo("rbac:role:user", 2),
+		"plain:tag",
+	}
+
+	for _, tc := range []struct {
+		name   string
+		policy TagRetentionPolicy
+		want   []string
+	}{
+		{"versions", TagRetentionPolicy{MaxVersions: 2}, []string{"status:closed", "status:archived", "owner:alice"}},
+		{"age", TagRetentionPolicy{MaxAge: 30 * 24 * time.Hour}, []string{"status:open", "status:closed", "status:archived", "owner:alice"}},
+		{"both", TagRetentionPolicy{MaxAge: 15 * 24 * time.Hour, MaxVersions: 3}, []string{"status:closed", "status:archived", "owner:alice"}},
+		{"limits not reached", TagRetentionPolicy{MaxAge: 100 * 24 * time.Hour, MaxVersions: 4}, []string{"status:new", "status:open", "status:closed", "status:archived", "owner:alice"}},
+	} {
+		kept, removed := pruneTemporalTags(tags, tc.policy, now)
+		var got []string
+		for _, tag := range kept {
+			_, plain, err := models.ParseTemporalTag(tag)
+			if err != nil || strings.HasPrefix(plain, "rbac:") {
+				continue
+			}
+			got = append(got, plain)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") || removed != 5-len(tc.want) {
+			t.Errorf("%s: kept %v (removed %d), want %v", tc.name, got, removed, tc.want)
+		}
+		// Protected namespaces and tags without a timestamp stay
+		for _, tag := range []string{tags[5], tags[6], "plain:tag"} {
+			if !containsString(kept, tag) {
+				t.Errorf("%s: pruned %s", tc.name, tag)
+			}
+		}
+	}
+}
+
+// TestSelectPolicy checks that the narrowest matching policies govern an
+// entity and that equally narrow ones combine to the strictest limits
+func TestSelectPolicy(t *testing.T) {
+	policies := []TagRetentionPolicy{
+		{ID: "p-all", MaxVersions: 50},
+		{ID: "p-metrics", Dataset: "metrics", MaxAge: 90 * 24 * time.Hour},
+		{ID: "p-sensor", EntityType: "sensor", MaxVersions: 10},
+		{ID: "p-sensor-strict", EntityType: "sensor", MaxAge: 7 * 24 * time.Hour, MaxVersions: 20},
+	}
+	for _, tc := range []struct {
+		dataset, entityType string
+		want                TagRetentionPolicy
+	}{
+		{"default", "document", TagRetentionPolicy{ID: "p-all", MaxVersions: 50}},
+		{"metrics", "document", TagRetentionPolicy{ID: "p-metrics", Dataset: "metrics", MaxAge: 90 * 24 * time.Hour}},
+		{"metrics", "sensor", TagRetentionPolicy{ID: "p-sensor", EntityType: "sensor", MaxAge: 7 * 24 * time.Hour, MaxVersions: 10}},
+	} {
+		got, ok := selectPolicy(policies, tc.dataset, tc.entityType)
+		if !ok || got != tc.want {
+			t.Errorf("policy for %s/%s = %+v, want %+v", tc.dataset, tc.entityType, got, tc.want)
+		}
+	}
+	if _, ok := selectPolicy(policies[1:3], "default", "document"); ok {
+		t.Error("a scoped policy governs an entity outside its scope")
+	}
+}
+
+// TestRetentionRunOnce checks that a cycle prunes the entities a policy
+// governs, spares entities under legal hold, and that a dry run only
+// reports what it would prune
+func TestRetentionRunOnce(t *testing.T) {
+	repo := newTestRepository(t)
+	history := func(id string, extra ...string) *models.Entity {
+		base := time.Now().Add(-time.Hour).UnixNano()
+		tags := []string{"type:sensor", "dataset:metrics"}
+		for i, value := range []string{"1", "2", "3", "4"} {
+			tags = append(tags, models.FormatTemporalTagAt("reading:"+value, base+int64(i)))
+		}
+		return &models.Entity{ID: id, Tags: append(tags, extra...)}
+	}
+	createTestEntity(t, repo, history("sensor-1"))
+	createTestEntity(t, repo, history("sensor-held", models.LegalHoldTag))
+	createTestEntity(t, repo, &models.Entity{ID: "policy-sensors", Tags: []string{"type:retention_policy", "retention:type:sensor", "retention:versions:2"}})
+	createTestEntity(t, repo, &models.Entity{ID: "policy-broken", Tags: []string{"type:retention_policy", "retention:age:soon"}})
+	readings := func(id string) int {
+		entity, err := repo.GetByID(id)
+		if err != nil {
+			t.Fatalf("GetByID(%s): %v", id, err)
+		}
+		count := 0
+		for _, tag := range entity.GetTagsWithoutTimestamp() {
+			if strings.HasPrefix(tag, "reading:") {
+				count++
+			}
+		}
+		return count
+	}
+
+	service := NewRetentionService(repo, RetentionServiceConfig{})
+	result, err := service.RunOnce(true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !result.DryRun || result.Policies != 1 || result.EntitiesScanned != 1 || result.EntitiesPruned != 1 || result.TagsPruned != 2 {
+		t.Errorf("dry run = %+v, want 2 tags of 1 entity", result)
+	}
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if got := readings("sensor-1"); got != 4 {
+		t.Fatalf("dry run left %d readings, want all 4", got)
+	}
+
+	result, err = service.RunOnce(false)
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if result.DryRun || result.TagsPruned != 2 || result.ByPolicy["policy-sensors"] != 2 || len(result.Errors) != 0 {
+		t.Errorf("run = %+v, want 2 tags pruned by policy-sensors", result)
+	}
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if got := readings("sensor-1"); got != 2 {
+		t.Errorf("sensor-1 has %d readings after pruning, want 2", got)
+	}
+	if got := readings("sensor-held"); got != 4 {
+		t.Errorf("sensor-held has %d readings, want its history kept under legal hold", got)
+	}
+
+	stats := service.GetStats()
+	if stats.TotalRuns != 2 || stats.TagsWouldPrune != 2 || stats.TagsPruned != 2 || stats.EntitiesPruned != 1 ||
+		stats.InvalidPolicies != 1 || stats.TagsPrunedByPolicy["policy-sensors"] != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,528 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sandboxes are dataset entities with extra tags:
+//
+//	type:dataset
+//	dataset:system
+//	name:demo
+//	sandbox:true
+//	sandbox:template:crm-demo      (optional, seed from crm-demo.jsonl)
+//	sandbox:reset_interval:24h     (optional, reset on a schedule)
+//	sandbox:last_reset:<unix nano>
+//
+// Resetting a sandbox deletes every entity tagged dataset:<name> and seeds it
+// again from the template bundle. Only users granted rbac:perm:sandbox:<name>
+// (or sandbox:*) and administrators can use a sandbox's dataset routes.
+const (
+	sandboxTag              = "sandbox:true"
+	sandboxTemplateTag      = "sandbox:template:"
+	sandboxResetIntervalTag = "sandbox:reset_interval:"
+	sandboxLastResetTag     = "sandbox:last_reset:"
+)
+
+// sandboxNamePattern restricts sandbox and template names to what is safe
+// in tags, URL paths and file names
+var sandboxNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// seedDropNamespaces are tags of template entities replaced when seeding
+var seedDropNamespaces = []string{"type:", "dataset:", "created_at:", "created_by:", "uuid:"}
+
+var (
+	// ErrSandboxNotFound is returned for names that are not sandboxes
+	ErrSandboxNotFound = errors.New("sandbox not found")
+
+	// ErrSandboxExists is returned when a dataset of the name exists
+	ErrSandboxExists = errors.New("a dataset with this name already exists")
+
+	// ErrInvalidSandbox is returned for invalid names and reset intervals
+	ErrInvalidSandbox = errors.New("invalid sandbox")
+
+	// ErrTemplateNotFound is returned for missing template bundles
+	ErrTemplateNotFound = errors.New("sandbox template not found")
+)
+
+// Sandbox is a sandbox dataset loaded from its dataset entity
+type Sandbox struct {
+	ID            string        `json:"id"`
+	Name          string        `json:"name"`
+	Template      string        `json:"template,omitempty"`
+	ResetInterval time.Duration `json:"-"`
+	ResetEvery    string        `json:"reset_interval,omitempty"`
+	LastReset     *time.Time    `json:"last_reset,omitempty"`
+	NextReset     *time.Time    `json:"next_reset,omitempty"`
+}
+
+// SandboxResetResult summarizes one reset
+type SandboxResetResult struct {
+	Sandbox  string    `json:"sandbox"`
+	Deleted  int       `json:"deleted"`
+	Seeded   int       `json:"seeded"`
+	ResetAt  time.Time `json:"reset_at"`
+	Duration string    `json:"duration"`
+}
+
+// SandboxServiceConfig configures the sandbox service
+type SandboxServiceConfig struct {
+	// TemplatePath is the directory of <template>.jsonl bundles
+	TemplatePath string
+
+	// CheckInterval is how often reset schedules are checked; 0 disables
+	// scheduled resets
+	CheckInterval time.Duration
+}
+
+// SandboxService creates, resets and deletes sandbox datasets
+type SandboxService struct {
+	writePauser
+
+	repository models.EntityRepository
+	config     SandboxServiceConfig
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running int32
+
+	// resetMu serializes resets between the loop and API calls
+	resetMu sync.Mutex
+
+	// names caches which datasets are sandboxes for the security middleware
+	mu    sync.RWMutex
+	names map[string]bool
+}
+
+// NewSandboxService creates a new sandbox service
+func NewSandboxService(repository models.EntityRepository, config SandboxServiceConfig) *SandboxService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SandboxService{
+		repository: repository,
+		config:     config,
+		ctx:        ctx,
+		cancel:     cancel,
+		names:      make(map[string]bool),
+	}
+}
+
+// Start loads the sandboxes and begins checking reset schedules
+func (ss *SandboxService) Start() error {
+	if !atomic.CompareAndSwapInt32(&ss.running, 0, 1) {
+		return fmt.Errorf("sandbox service is already running")
+	}
+	if err := os.MkdirAll(ss.config.TemplatePath, 0755); err != nil {
+		return fmt.Errorf("failed to create sandbox template directory: %w", err)
+	}
+	sandboxes, err := ss.LoadSandboxes()
+	if err != nil {
+		return err
+	}
+	if ss.config.CheckInterval <= 0 {
+		logger.Info("SandboxService: %d sandboxes, scheduled resets disabled", len(sandboxes))
+		return nil
+	}
+
+	logger.Info("SandboxService: %d sandboxes, checking reset schedules every %v", len(sandboxes), ss.config.CheckInterval)
+	ss.wg.Add(1)
+	go ss.scheduleLoop()
+	return nil
+}
+
+// Stop ends the schedule loop
+func (ss *SandboxService) Stop() error {
+	if !atomic.CompareAndSwapInt32(&ss.running, 1, 0) {
+		return nil
+	}
+	ss.cancel()
+	ss.wg.Wait()
+	return nil
+}
+
+// IsSandbox reports whether a dataset is a sandbox
+func (ss *SandboxService) IsSandbox(dataset string) bool {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.names[dataset]
+}
+
+// scheduleLoop resets sandboxes whose interval has elapsed
+func (ss *SandboxService) scheduleLoop() {
+	defer ss.wg.Done()
+
+	ticker := time.NewTicker(ss.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ss.ctx.Done():
+			return
+		case <-ticker.C:
+			if ss.writesPaused() {
+				continue
+			}
+			sandboxes, err := ss.LoadSandboxes()
+			if err != nil {
+				logger.Error("SandboxService: %v", err)
+				continue
+			}
+			now := time.Now()
+			for _, sandbox := range sandboxes {
+				if sandbox.NextReset == nil || now.Before(*sandbox.NextReset) {
+					continue
+				}
+				if result, err := ss.Reset(sandbox.Name); err != nil {
+					logger.Error("SandboxService: scheduled reset of %s failed: %v", sandbox.Name, err)
+				} else {
+					logger.Info("SandboxService: reset %s (deleted %d, seeded %d)", sandbox.Name, result.Deleted, result.Seeded)
+				}
+			}
+		}
+	}
+}
+
+// LoadSandboxes reads all sandbox dataset entities and refreshes the cache
+// used by IsSandbox
+func (ss *SandboxService) LoadSandboxes() ([]Sandbox, error) {
+	// ListByTag also sees writes still queued in the batch writer
+	entities, err := ss.repository.ListByTag(sandboxTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sandboxes: %w", err)
+	}
+
+	sandboxes := make([]Sandbox, 0, len(entities))
+	names := make(map[string]bool, len(entities))
+	for _, entity := range entities {
+		sandbox := parseSandbox(entity)
+		if sandbox.Name == "" || !entity.HasTag("type:dataset") {
+			continue
+		}
+		sandboxes = append(sandboxes, sandbox)
+		names[sandbox.Name] = true
+	}
+	sort.Slice(sandboxes, func(i, j int) bool {
+		return sandboxes[i].Name < sandboxes[j].Name
+	})
+
+	ss.mu.Lock()
+	ss.names = names
+	ss.mu.Unlock()
+	return sandboxes, nil
+}
+
+// parseSandbox builds a Sandbox from a dataset entity's current tags
+func parseSandbox(entity *models.Entity) Sandbox {
+	sandbox := Sandbox{ID: entity.ID, Name: entity.GetTagValue("name")}
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		switch {
+		case strings.HasPrefix(tag, sandboxTemplateTag):
+			sandbox.Template = strings.TrimPrefix(tag, sandboxTemplateTag)
+		case strings.HasPrefix(tag, sandboxResetIntervalTag):
+			value := strings.TrimPrefix(tag, sandboxResetIntervalTag)
+			if interval, err := ParseRetentionAge(value); err == nil {
+				sandbox.ResetInterval, sandbox.ResetEvery = interval, value
+			}
+		case strings.HasPrefix(tag, sandboxLastResetTag):
+			if nanos, err := strconv.ParseInt(strings.TrimPrefix(tag, sandboxLastResetTag), 10, 64); err == nil {
+				lastReset := time.Unix(0, nanos)
+				sandbox.LastReset = &lastReset
+			}
+		}
+	}
+	if sandbox.ResetInterval > 0 && sandbox.LastReset != nil {
+		next := sandbox.LastReset.Add(sandbox.ResetInterval)
+		sandbox.NextReset = &next
+	}
+	return sandbox
+}
+
+// templateFile returns the bundle path of a template
+func (ss *SandboxService) templateFile(template string) string {
+	return filepath.Join(ss.config.TemplatePath, template+".jsonl")
+}
+
+// Templates lists the available template bundles
+func (ss *SandboxService) Templates() []string {
+	matches, _ := filepath.Glob(filepath.Join(ss.config.TemplatePath, "*.jsonl"))
+	templates := make([]string, 0, len(matches))
+	for _, match := range matches {
+		templates = append(templates, strings.TrimSuffix(filepath.Base(match), ".jsonl"))
+	}
+	sort.Strings(templates)
+	return templates
+}
+
+// Create creates a sandbox dataset and seeds it from its template.
+// resetInterval may be empty for sandboxes reset only on request.
+func (ss *SandboxService) Create(name, template, resetInterval string) (*Sandbox, *SandboxResetResult, error) {
+	if !sandboxNamePattern.MatchString(name) {
+		return nil, nil, fmt.Errorf("%w: name %q may only use letters, digits, '.', '_' and '-'", ErrInvalidSandbox, name)
+	}
+	tags := []string{"type:dataset", "dataset:system", "name:" + name, "id:" + name, sandboxTag}
+	if template != "" {
+		if !sandboxNamePattern.MatchString(template) {
+			return nil, nil, fmt.Errorf("%w: template name %q", ErrInvalidSandbox, template)
+		}
+		if _, err := os.Stat(ss.templateFile(template)); err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, template)
+		}
+		tags = append(tags, sandboxTemplateTag+template)
+	}
+	if resetInterval != "" {
+		if _, err := ParseRetentionAge(resetInterval); err != nil {
+			return nil, nil, fmt.Errorf("%w: reset interval %q, use a positive duration such as 30m, 24h or 7d", ErrInvalidSandbox, resetInterval)
+		}
+		tags = append(tags, sandboxResetIntervalTag+resetInterval)
+	}
+
+	ss.resetMu.Lock()
+	existing, err := ss.repository.ListByTag("name:" + name)
+	if err != nil {
+		ss.resetMu.Unlock()
+		return nil, nil, fmt.Errorf("failed to check datasets: %w", err)
+	}
+	for _, entity := range existing {
+		if entity.HasTag("type:dataset") {
+			ss.resetMu.Unlock()
+			return nil, nil, ErrSandboxExists
+		}
+	}
+	entity, err := models.NewEntityWithMandatoryTags("dataset", "system", models.SystemUserID, nil)
+	if err != nil {
+		ss.resetMu.Unlock()
+		return nil, nil, err
+	}
+	// The mandatory tags already carry type and dataset
+	for _, tag := range tags[2:] {
+		entity.AddTag(tag)
+	}
+	err = ss.repository.Create(entity)
+	ss.resetMu.Unlock()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create sandbox: %w", err)
+	}
+	logger.Info("SandboxService: created sandbox %s (template: %q, reset interval: %q)", name, template, resetInterval)
+
+	if _, err := ss.LoadSandboxes(); err != nil {
+		return nil, nil, err
+	}
+	result, err := ss.Reset(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	sandbox, err := ss.find(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &sandbox.sandbox, result, nil
+}
+
+// loadedSandbox is a sandbox with its dataset entity
+type loadedSandbox struct {
+	sandbox Sandbox
+	entity  *models.Entity
+}
+
+// find returns the sandbox of a name
+func (ss *SandboxService) find(name string) (*loadedSandbox, error) {
+	entities, err := ss.repository.ListByTag("name:" + name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up sandbox: %w", err)
+	}
+	for _, entity := range entities {
+		if !entity.HasTag("type:dataset") || !entity.HasTag(sandboxTag) {
+			continue
+		}
+		if sandbox := parseSandbox(entity); sandbox.Name == name {
+			return &loadedSandbox{sandbox: sandbox, entity: entity}, nil
+		}
+	}
+	return nil, ErrSandboxNotFound
+}
+
+// Reset deletes every entity of a sandbox and seeds it from its template
+func (ss *SandboxService) Reset(name string) (*SandboxResetResult, error) {
+	ss.resetMu.Lock()
+	defer ss.resetMu.Unlock()
+
+	loaded, err := ss.find(name)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	result := &SandboxResetResult{Sandbox: name}
+
+	deleted, err := ss.wipe(name)
+	result.Deleted = deleted
+	if err != nil {
+		return result, err
+	}
+	if loaded.sandbox.Template != "" {
+		seeded, err := ss.seed(name, loaded.sandbox.Template)
+		result.Seeded = seeded
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.ResetAt = time.Now()
+	result.Duration = time.Since(start).String()
+	if err := ss.recordReset(loaded.entity, result.ResetAt); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// wipe deletes the entities of a sandbox's dataset
+func (ss *SandboxService) wipe(name string) (int, error) {
+	entities, err := ss.repository.ListByTag("dataset:" + name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sandbox entities: %w", err)
+	}
+	deleted := 0
+	for _, entity := range entities {
+		if err := ss.repository.Delete(entity.ID); err != nil {
+			return deleted, fmt.Errorf("failed to delete sandbox entity %s: %w", entity.ID, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// seed creates the entities of a template bundle in a sandbox. Bundles use
+// the JSONL export format; entities get new IDs and tag values naming
+// another entity of the bundle are rewritten to its new ID.
+func (ss *SandboxService) seed(name, template string) (int, error) {
+	file, err := os.Open(ss.templateFile(template))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrTemplateNotFound, template)
+	}
+	defer file.Close()
+
+	var entities []*models.Entity
+	newIDs := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var source models.Entity
+		if err := json.Unmarshal(scanner.Bytes(), &source); err != nil {
+			return 0, fmt.Errorf("template %s line %d: %w", template, line, err)
+		}
+
+		entityType := "entity"
+		var tags []string
+		for _, tag := range source.GetTagsWithoutTimestamp() {
+			if strings.HasPrefix(tag, "type:") {
+				entityType = strings.TrimPrefix(tag, "type:")
+			}
+			if !hasAnyPrefix(tag, seedDropNamespaces) {
+				tags = append(tags, tag)
+			}
+		}
+		entity, err := models.NewEntityWithMandatoryTags(entityType, name, models.SystemUserID, tags)
+		if err != nil {
+			return 0, fmt.Errorf("template %s line %d: %w", template, line, err)
+		}
+		entity.Content = source.Content
+		if source.ID != "" {
+			newIDs[source.ID] = entity.ID
+		}
+		entities = append(entities, entity)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read template %s: %w", template, err)
+	}
+
+	for i, entity := range entities {
+		for j, tag := range entity.Tags {
+			if namespace, value, ok := strings.Cut(tag, ":"); ok {
+				if newID, ok := newIDs[value]; ok {
+					entity.Tags[j] = namespace + ":" + newID
+				}
+			}
+		}
+		if err := ss.repository.Create(entity); err != nil {
+			return i, fmt.Errorf("failed to seed sandbox entity: %w", err)
+		}
+	}
+	return len(entities), nil
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordReset replaces the last reset time of a sandbox
+func (ss *SandboxService) recordReset(entity *models.Entity, at time.Time) error {
+	tags := make([]string, 0, len(entity.Tags))
+	for _, tag := range entity.Tags {
+		clean := tag
+		if idx := strings.Index(tag, "|"); idx != -1 {
+			clean = tag[idx+1:]
+		}
+		if !strings.HasPrefix(clean, sandboxLastResetTag) {
+			tags = append(tags, tag)
+		}
+	}
+	updated := &models.Entity{
+		ID:        entity.ID,
+		Tags:      tags,
+		Content:   entity.Content,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+	}
+	updated.AddTag(sandboxLastResetTag + strconv.FormatInt(at.UnixNano(), 10))
+	if err := ss.repository.Update(updated); err != nil {
+		return fmt.Errorf("failed to record sandbox reset: %w", err)
+	}
+	return nil
+}
+
+// Delete wipes a sandbox and removes its dataset entity
+func (ss *SandboxService) Delete(name string) (int, error) {
+	ss.resetMu.Lock()
+	defer ss.resetMu.Unlock()
+
+	loaded, err := ss.find(name)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := ss.wipe(name)
+	if err != nil {
+		return deleted, err
+	}
+	if err := ss.repository.Delete(loaded.entity.ID); err != nil {
+		return deleted, fmt.Errorf("failed to delete sandbox dataset: %w", err)
+	}
+
+	ss.mu.Lock()
+	delete(ss.names, name)
+	ss.mu.Unlock()
+	logger.Info("SandboxService: deleted sandbox %s (%d entities)", name, deleted)
+	return deleted, nil
+}
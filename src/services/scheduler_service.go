@@ -0,0 +1,805 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Schedules are ordinary entities tagged type:schedule that the scheduler
+// runs on a cron expression. Their action and its settings are tags, for
+// example:
+//
+//	type:schedule
+//	schedule:cron:0 3 * * *                    (five fields, or @daily etc.)
+//	schedule:action:tag_view                   (retention, tag_view or export)
+//	schedule:view:stale-orders                 (tag_view: the view to run)
+//	schedule:param:days:30                     (tag_view: a view parameter, repeatable)
+//	schedule:tag:status:stale                  (tag_view: tag added to every result)
+//	schedule:dataset:sales                     (export: the dataset to export)
+//	schedule:format:csv                        (export: jsonl or csv, default jsonl)
+//	schedule:timezone:Europe/Berlin            (optional, default UTC)
+//	schedule:alert:https://example.com/alerts  (optional, notified of failed runs)
+//	schedule:enabled:false                     (optional, switch the schedule off)
+//
+// A schedule runs as the user who created it, and only while that user is
+// active and holds the permission its action needs. Every run is recorded
+// as a type:schedule_run entity in the system dataset.
+const (
+	ScheduleType         = "schedule"
+	ScheduleRunType      = "schedule_run"
+	scheduleCronTag      = "schedule:cron:"
+	scheduleActionTag    = "schedule:action:"
+	scheduleViewTag      = "schedule:view:"
+	scheduleParamTag     = "schedule:param:"
+	scheduleTagTag       = "schedule:tag:"
+	scheduleDatasetTag   = "schedule:dataset:"
+	scheduleFormatTag    = "schedule:format:"
+	scheduleTimezoneTag  = "schedule:timezone:"
+	scheduleAlertTag     = "schedule:alert:"
+	scheduleEnabledTag   = "schedule:enabled:"
+	scheduleRunIDTag     = "schedule:id:"
+	scheduleRunStatusTag = "schedule_run:status:"
+)
+
+// Schedule actions
+const (
+	ScheduleActionRetention = "retention"
+	ScheduleActionTagView   = "tag_view"
+	ScheduleActionExport    = "export"
+)
+
+// Schedule run triggers and outcomes
+const (
+	ScheduleTriggerCron   = "cron"
+	ScheduleTriggerManual = "manual"
+
+	ScheduleRunSucceeded = "succeeded"
+	ScheduleRunFailed    = "failed"
+)
+
+// ScheduleAlertEvent is the event header value of failure alerts
+const ScheduleAlertEvent = "schedule.failed"
+
+// schedulerTickInterval is how often due schedules are looked for; runs
+// start within this long of their cron time
+const schedulerTickInterval = 15 * time.Second
+
+var (
+	// ErrScheduleNotFound is returned for IDs without a schedule entity
+	ErrScheduleNotFound = errors.New("schedule not found")
+
+	// ErrInvalidSchedule is returned when running a schedule that fails to parse
+	ErrInvalidSchedule = errors.New("invalid schedule")
+
+	// ErrScheduleRunning is returned when a schedule's previous run has not finished
+	ErrScheduleRunning = errors.New("schedule is already running")
+)
+
+// Schedule is a schedule loaded from a schedule entity
+type Schedule struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name,omitempty"`
+	Cron     string            `json:"cron"`
+	Timezone string            `json:"timezone,omitempty"`
+	Action   string            `json:"action"`
+	View     string            `json:"view,omitempty"`
+	Params   map[string]string `json:"params,omitempty"`
+	Tag      string            `json:"tag,omitempty"`
+	Dataset  string            `json:"dataset,omitempty"`
+	Format   string            `json:"format,omitempty"`
+	AlertURL string            `json:"alert_url,omitempty"`
+	Owner    string            `json:"owner"`
+	Enabled  bool              `json:"enabled"`
+	NextRun  *time.Time        `json:"next_run,omitempty"`
+	Error    string            `json:"error,omitempty"`
+
+	cron     *CronSchedule
+	location *time.Location
+}
+
+// spec identifies the timing of a schedule; a change reschedules it
+func (s Schedule) spec() string {
+	return s.Cron + "|" + s.Timezone
+}
+
+// next returns the schedule's first run time after t
+func (s Schedule) next(t time.Time) time.Time {
+	return s.cron.Next(t.In(s.location))
+}
+
+// ScheduleAction is a kind of work schedules can run
+type ScheduleAction struct {
+	// Resource and Permission name the RBAC permission the schedule's
+	// owner needs, such as entity and update
+	Resource   string
+	Permission string
+
+	// Validate checks the action's settings of a schedule; optional
+	Validate func(schedule Schedule) error
+
+	// Run performs the action as owner and returns a JSON-encodable
+	// summary recorded with the run
+	Run func(ctx context.Context, schedule Schedule, owner *models.SecurityUser) (interface{}, error)
+}
+
+// PermissionChecker resolves RBAC permissions of users
+type PermissionChecker interface {
+	HasPermission(user *models.SecurityUser, resource, action string) (bool, error)
+}
+
+// ScheduleRun records one run of a schedule
+type ScheduleRun struct {
+	ID         string      `json:"id,omitempty"`
+	ScheduleID string      `json:"schedule_id"`
+	Name       string      `json:"name,omitempty"`
+	Action     string      `json:"action"`
+	Trigger    string      `json:"trigger"`
+	Status     string      `json:"status"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	Duration   string      `json:"duration"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// ScheduleAlert is the JSON body POSTed to alert URLs when a run fails
+type ScheduleAlert struct {
+	Event               string      `json:"event"`
+	Run                 ScheduleRun `json:"run"`
+	ConsecutiveFailures int         `json:"consecutive_failures"`
+}
+
+// SchedulerServiceConfig configures the scheduler
+type SchedulerServiceConfig struct {
+	// Enabled controls whether schedules run on their cron expressions
+	Enabled bool
+
+	// HistoryLimit is how many run records are kept per schedule
+	HistoryLimit int
+
+	// AlertURL is notified of every failed run, in addition to the
+	// schedule's own alert URL
+	AlertURL string
+
+	// AllowedHosts restricts the hosts of schedules' alert URLs; empty
+	// allows any host
+	AllowedHosts []string
+
+	// AlertTimeout limits each alert request
+	AlertTimeout time.Duration
+}
+
+// SchedulerStats tracks scheduler activity
+type SchedulerStats struct {
+	Schedules        int       `json:"schedules"`
+	InvalidSchedules int       `json:"invalid_schedules"`
+	Runs             int64     `json:"runs"`
+	Succeeded        int64     `json:"succeeded"`
+	Failed           int64     `json:"failed"`
+	Skipped          int64     `json:"skipped"` // cron runs skipped while the previous run was busy
+	AlertsSent       int64     `json:"alerts_sent"`
+	AlertsFailed     int64     `json:"alerts_failed"`
+	LastRunTime      time.Time `json:"last_run_time,omitempty"`
+
+	// ConsecutiveFailures counts the failed runs since the last success
+	// per schedule ID
+	ConsecutiveFailures map[string]int `json:"consecutive_failures"`
+}
+
+// scheduledRun is the next cron run of a schedule
+type scheduledRun struct {
+	spec string
+	at   time.Time
+}
+
+// SchedulerService runs schedule entities' actions on their cron
+// expressions and records every run
+type SchedulerService struct {
+	writePauser
+
+	repository  models.EntityRepository
+	permissions PermissionChecker
+	config      SchedulerServiceConfig
+	client      *http.Client
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running int32
+
+	actionsMu sync.RWMutex
+	actions   map[string]ScheduleAction
+
+	// nextRuns and active are only used under runMu
+	runMu    sync.Mutex
+	nextRuns map[string]scheduledRun
+	active   map[string]bool
+
+	stats SchedulerStats
+	mu    sync.Mutex
+}
+
+// NewSchedulerService creates a new scheduler. Actions are added with
+// RegisterAction.
+func NewSchedulerService(repository models.EntityRepository, permissions PermissionChecker, config SchedulerServiceConfig) *SchedulerService {
+	if config.HistoryLimit <= 0 {
+		config.HistoryLimit = 50
+	}
+	if config.AlertTimeout == 0 {
+		config.AlertTimeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &SchedulerService{
+		repository:  repository,
+		permissions: permissions,
+		config:      config,
+		client: &http.Client{
+			Timeout: config.AlertTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		ctx:      ctx,
+		cancel:   cancel,
+		actions:  make(map[string]ScheduleAction),
+		nextRuns: make(map[string]scheduledRun),
+		active:   make(map[string]bool),
+		stats:    SchedulerStats{ConsecutiveFailures: make(map[string]int)},
+	}
+}
+
+// RegisterAction makes an action available to schedules
+func (ss *SchedulerService) RegisterAction(name string, action ScheduleAction) {
+	ss.actionsMu.Lock()
+	defer ss.actionsMu.Unlock()
+	ss.actions[name] = action
+}
+
+// action returns a registered action
+func (ss *SchedulerService) action(name string) (ScheduleAction, bool) {
+	ss.actionsMu.RLock()
+	defer ss.actionsMu.RUnlock()
+	action, ok := ss.actions[name]
+	return action, ok
+}
+
+// Start begins running schedules
+func (ss *SchedulerService) Start() error {
+	if !atomic.CompareAndSwapInt32(&ss.running, 0, 1) {
+		return fmt.Errorf("scheduler is already running")
+	}
+
+	if !ss.config.Enabled {
+		logger.Info("SchedulerService: Service disabled by configuration")
+		return nil
+	}
+
+	logger.Info("SchedulerService: Starting service (history limit: %d)", ss.config.HistoryLimit)
+
+	ss.wg.Add(1)
+	go ss.schedulerLoop()
+
+	return nil
+}
+
+// Stop stops the scheduler and waits for running actions, which are
+// cancelled
+func (ss *SchedulerService) Stop() error {
+	if !atomic.CompareAndSwapInt32(&ss.running, 1, 0) {
+		return fmt.Errorf("scheduler is not running")
+	}
+
+	logger.Info("SchedulerService: Stopping service")
+	ss.cancel()
+	ss.wg.Wait()
+	logger.Info("SchedulerService: Service stopped")
+
+	return nil
+}
+
+// IsEnabled returns true if schedules run by configuration
+func (ss *SchedulerService) IsEnabled() bool {
+	return ss.config.Enabled
+}
+
+// GetStats returns current scheduler statistics
+func (ss *SchedulerService) GetStats() SchedulerStats {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	stats := ss.stats
+	stats.ConsecutiveFailures = make(map[string]int, len(ss.stats.ConsecutiveFailures))
+	for id, failures := range ss.stats.ConsecutiveFailures {
+		stats.ConsecutiveFailures[id] = failures
+	}
+	return stats
+}
+
+// schedulerLoop starts due schedules until the service stops
+func (ss *SchedulerService) schedulerLoop() {
+	defer ss.wg.Done()
+
+	ticker := time.NewTicker(schedulerTickInterval)
+	defer ticker.Stop()
+
+	ss.tick(time.Now())
+	for {
+		select {
+		case <-ss.ctx.Done():
+			logger.Debug("SchedulerService: Scheduler loop stopping")
+			return
+
+		case now := <-ticker.C:
+			ss.tick(now)
+		}
+	}
+}
+
+// tick reloads the schedules and starts those that are due. A schedule
+// seen for the first time, or whose timing changed, is scheduled from
+// now; runs missed while the server was down are not caught up. While
+// writes are paused nothing starts, and runs that fell due start once on
+// the first tick after writes resume.
+func (ss *SchedulerService) tick(now time.Time) {
+	if ss.writesPaused() {
+		return
+	}
+	schedules, err := ss.LoadSchedules()
+	if err != nil {
+		logger.Error("SchedulerService: Failed to load schedules: %v", err)
+		return
+	}
+
+	ss.runMu.Lock()
+	defer ss.runMu.Unlock()
+
+	seen := make(map[string]bool, len(schedules))
+	for _, schedule := range schedules {
+		if schedule.Error != "" || !schedule.Enabled {
+			continue
+		}
+		seen[schedule.ID] = true
+
+		next, ok := ss.nextRuns[schedule.ID]
+		if !ok || next.spec != schedule.spec() {
+			ss.nextRuns[schedule.ID] = scheduledRun{spec: schedule.spec(), at: schedule.next(now)}
+			continue
+		}
+		if next.at.IsZero() || now.Before(next.at) {
+			continue
+		}
+		ss.nextRuns[schedule.ID] = scheduledRun{spec: next.spec, at: schedule.next(now)}
+
+		if ss.active[schedule.ID] {
+			logger.Warn("SchedulerService: Skipping run of schedule %s, its previous run is still busy", schedule.ID)
+			ss.mu.Lock()
+			ss.stats.Skipped++
+			ss.mu.Unlock()
+			continue
+		}
+		ss.active[schedule.ID] = true
+		ss.wg.Add(1)
+		go func(schedule Schedule) {
+			defer ss.wg.Done()
+			ss.execute(schedule, ScheduleTriggerCron)
+		}(schedule)
+	}
+	for id := range ss.nextRuns {
+		if !seen[id] {
+			delete(ss.nextRuns, id)
+		}
+	}
+}
+
+// RunNow runs a schedule immediately and waits for the run to finish. It
+// runs whether or not the schedule is enabled.
+func (ss *SchedulerService) RunNow(id string) (*ScheduleRun, error) {
+	entity, err := ss.repository.GetByID(id)
+	if err != nil || !entity.HasTag("type:"+ScheduleType) {
+		return nil, ErrScheduleNotFound
+	}
+	schedule, err := ss.ParseSchedule(entity)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	ss.runMu.Lock()
+	if ss.active[id] {
+		ss.runMu.Unlock()
+		return nil, ErrScheduleRunning
+	}
+	ss.active[id] = true
+	ss.runMu.Unlock()
+
+	logger.Info("SchedulerService: Manual run of schedule %s requested", id)
+	return ss.execute(schedule, ScheduleTriggerManual), nil
+}
+
+// execute runs a schedule's action, records the run and alerts on failure.
+// The schedule must have been marked active.
+func (ss *SchedulerService) execute(schedule Schedule, trigger string) *ScheduleRun {
+	defer func() {
+		ss.runMu.Lock()
+		delete(ss.active, schedule.ID)
+		ss.runMu.Unlock()
+	}()
+
+	run := &ScheduleRun{
+		ScheduleID: schedule.ID,
+		Name:       schedule.Name,
+		Action:     schedule.Action,
+		Trigger:    trigger,
+		StartedAt:  time.Now().UTC(),
+	}
+	result, err := ss.perform(schedule)
+	run.FinishedAt = time.Now().UTC()
+	run.Duration = run.FinishedAt.Sub(run.StartedAt).String()
+	run.Result = result
+	run.Status = ScheduleRunSucceeded
+	if err != nil {
+		run.Status = ScheduleRunFailed
+		run.Error = err.Error()
+		logger.Error("SchedulerService: Schedule %s (%s) failed: %v", schedule.ID, schedule.Action, err)
+	} else {
+		logger.Info("SchedulerService: Schedule %s (%s) completed in %s", schedule.ID, schedule.Action, run.Duration)
+	}
+
+	failures := ss.recordRun(run)
+	if err := ss.saveRun(run); err != nil {
+		logger.Error("SchedulerService: Failed to record run of schedule %s: %v", schedule.ID, err)
+	}
+	if run.Status == ScheduleRunFailed {
+		ss.alert(schedule, run, failures)
+	}
+	return run
+}
+
+// perform checks the schedule's owner and runs its action
+func (ss *SchedulerService) perform(schedule Schedule) (result interface{}, err error) {
+	action, ok := ss.action(schedule.Action)
+	if !ok {
+		return nil, fmt.Errorf("action %q is not available", schedule.Action)
+	}
+	owner, err := ss.loadOwner(schedule.Owner)
+	if err != nil {
+		return nil, err
+	}
+	if ss.permissions != nil && action.Resource != "" {
+		allowed, err := ss.permissions.HasPermission(owner, action.Resource, action.Permission)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check permissions of owner %s: %w", owner.ID, err)
+		}
+		if !allowed {
+			return nil, fmt.Errorf("owner %s lacks %s:%s permission", owner.ID, action.Resource, action.Permission)
+		}
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("action panicked: %v", recovered)
+		}
+	}()
+	return action.Run(ss.ctx, schedule, owner)
+}
+
+// loadOwner returns the active user a schedule runs as
+func (ss *SchedulerService) loadOwner(id string) (*models.SecurityUser, error) {
+	if id == "" {
+		return nil, fmt.Errorf("schedule has no owner")
+	}
+	entity, err := ss.repository.GetByID(id)
+	if err != nil || !entity.HasTag("type:"+models.EntityTypeUser) {
+		return nil, fmt.Errorf("owner %s not found", id)
+	}
+	status := entity.GetTagValue("status")
+	if status != "" && status != "active" {
+		return nil, fmt.Errorf("owner %s is %s", id, status)
+	}
+	owner := &models.SecurityUser{ID: entity.ID, Status: "active", Entity: entity}
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		if username, ok := strings.CutPrefix(tag, "identity:username:"); ok {
+			owner.Username = username
+		} else if email, ok := strings.CutPrefix(tag, "profile:email:"); ok {
+			owner.Email = email
+		}
+	}
+	return owner, nil
+}
+
+// recordRun folds a run into the statistics and returns the schedule's
+// consecutive failures
+func (ss *SchedulerService) recordRun(run *ScheduleRun) int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.stats.Runs++
+	ss.stats.LastRunTime = run.FinishedAt
+	if run.Status == ScheduleRunFailed {
+		ss.stats.Failed++
+		ss.stats.ConsecutiveFailures[run.ScheduleID]++
+	} else {
+		ss.stats.Succeeded++
+		delete(ss.stats.ConsecutiveFailures, run.ScheduleID)
+	}
+	return ss.stats.ConsecutiveFailures[run.ScheduleID]
+}
+
+// saveRun writes a run record and drops the schedule's records beyond the
+// history limit, oldest first
+func (ss *SchedulerService) saveRun(run *ScheduleRun) error {
+	content, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	entity, err := models.NewEntityWithMandatoryTags(ScheduleRunType, "system", models.SystemUserID, []string{
+		scheduleRunIDTag + run.ScheduleID,
+		scheduleRunStatusTag + run.Status,
+		"schedule_run:trigger:" + run.Trigger,
+		"content:type:json",
+	})
+	if err != nil {
+		return err
+	}
+	entity.Content = content
+	if err := ss.repository.Create(entity); err != nil {
+		return err
+	}
+	run.ID = entity.ID
+
+	runs, err := ss.runEntities(run.ScheduleID)
+	if err != nil {
+		return err
+	}
+	// The new record may not be indexed yet while writes are batched
+	limit := ss.config.HistoryLimit
+	if len(runs) == 0 || runs[len(runs)-1].ID != run.ID {
+		limit--
+	}
+	for len(runs) > limit {
+		if err := ss.repository.Delete(runs[0].ID); err != nil {
+			return fmt.Errorf("failed to prune run %s: %w", runs[0].ID, err)
+		}
+		runs = runs[1:]
+	}
+	return nil
+}
+
+// runEntities returns a schedule's run records, oldest first
+func (ss *SchedulerService) runEntities(scheduleID string) ([]*models.Entity, error) {
+	entities, err := ss.repository.ListByTag(scheduleRunIDTag + scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedule runs: %w", err)
+	}
+	runs := entities[:0]
+	for _, entity := range entities {
+		if entity.HasTag("type:" + ScheduleRunType) {
+			runs = append(runs, entity)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].CreatedAt != runs[j].CreatedAt {
+			return runs[i].CreatedAt < runs[j].CreatedAt
+		}
+		return runs[i].ID < runs[j].ID
+	})
+	return runs, nil
+}
+
+// ListRuns returns a schedule's recorded runs, newest first
+func (ss *SchedulerService) ListRuns(scheduleID string) ([]ScheduleRun, error) {
+	entities, err := ss.runEntities(scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]ScheduleRun, 0, len(entities))
+	for i := len(entities) - 1; i >= 0; i-- {
+		var run ScheduleRun
+		if err := json.Unmarshal(entities[i].Content, &run); err != nil {
+			logger.Warn("SchedulerService: Skipping run entity %s: %v", entities[i].ID, err)
+			continue
+		}
+		run.ID = entities[i].ID
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// alert POSTs a failed run to the schedule's and the configured alert URLs
+func (ss *SchedulerService) alert(schedule Schedule, run *ScheduleRun, failures int) {
+	var targets []string
+	for _, target := range []string{schedule.AlertURL, ss.config.AlertURL} {
+		if target != "" && !containsString(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(ScheduleAlert{Event: ScheduleAlertEvent, Run: *run, ConsecutiveFailures: failures})
+	if err != nil {
+		logger.Error("SchedulerService: Failed to encode alert for schedule %s: %v", schedule.ID, err)
+		return
+	}
+	for _, target := range targets {
+		err := ss.sendAlert(target, body)
+		ss.mu.Lock()
+		if err != nil {
+			ss.stats.AlertsFailed++
+		} else {
+			ss.stats.AlertsSent++
+		}
+		ss.mu.Unlock()
+		if err != nil {
+			logger.Warn("SchedulerService: Failed to alert %s of failed schedule %s: %v", target, schedule.ID, err)
+		}
+	}
+}
+
+// sendAlert POSTs an alert once
+func (ss *SchedulerService) sendAlert(target string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "EntityDB-Scheduler/1.0")
+	req.Header.Set(WebhookEventHeader, ScheduleAlertEvent)
+
+	resp, err := ss.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("alert receiver responded %s", resp.Status)
+	}
+	return nil
+}
+
+// LoadSchedules reads all schedule entities. Schedules that fail to parse
+// are returned with Error set and do not run.
+func (ss *SchedulerService) LoadSchedules() ([]Schedule, error) {
+	entities, err := ss.repository.ListByTag("type:" + ScheduleType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	now := time.Now()
+	schedules := make([]Schedule, 0, len(entities))
+	invalid := 0
+	for _, entity := range entities {
+		schedule, err := ss.ParseSchedule(entity)
+		if err != nil {
+			schedule.Error = err.Error()
+			invalid++
+		} else if schedule.Enabled {
+			if next := schedule.next(now); !next.IsZero() {
+				schedule.NextRun = &next
+			}
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].ID < schedules[j].ID
+	})
+
+	ss.mu.Lock()
+	ss.stats.Schedules = len(schedules) - invalid
+	ss.stats.InvalidSchedules = invalid
+	ss.mu.Unlock()
+	return schedules, nil
+}
+
+// ParseSchedule builds a schedule from a schedule entity's tags. Where a
+// setting appears more than once the most recently added value wins.
+func (ss *SchedulerService) ParseSchedule(entity *models.Entity) (Schedule, error) {
+	schedule := Schedule{
+		ID:      entity.ID,
+		Name:    entity.GetTagValue("name"),
+		Owner:   scheduleOwner(entity),
+		Enabled: true,
+	}
+
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		switch {
+		case strings.HasPrefix(tag, scheduleCronTag):
+			schedule.Cron = strings.TrimPrefix(tag, scheduleCronTag)
+		case strings.HasPrefix(tag, scheduleActionTag):
+			schedule.Action = strings.TrimPrefix(tag, scheduleActionTag)
+		case strings.HasPrefix(tag, scheduleViewTag):
+			schedule.View = strings.TrimPrefix(tag, scheduleViewTag)
+		case strings.HasPrefix(tag, scheduleParamTag):
+			name, value, ok := strings.Cut(strings.TrimPrefix(tag, scheduleParamTag), ":")
+			if !ok || name == "" {
+				return schedule, fmt.Errorf("invalid parameter tag %q: use schedule:param:<name>:<value>", tag)
+			}
+			if schedule.Params == nil {
+				schedule.Params = make(map[string]string)
+			}
+			schedule.Params[name] = value
+		case strings.HasPrefix(tag, scheduleTagTag):
+			schedule.Tag = strings.TrimPrefix(tag, scheduleTagTag)
+		case strings.HasPrefix(tag, scheduleDatasetTag):
+			schedule.Dataset = strings.TrimPrefix(tag, scheduleDatasetTag)
+		case strings.HasPrefix(tag, scheduleFormatTag):
+			schedule.Format = strings.TrimPrefix(tag, scheduleFormatTag)
+		case strings.HasPrefix(tag, scheduleTimezoneTag):
+			schedule.Timezone = strings.TrimPrefix(tag, scheduleTimezoneTag)
+		case strings.HasPrefix(tag, scheduleAlertTag):
+			schedule.AlertURL = strings.TrimPrefix(tag, scheduleAlertTag)
+		case strings.HasPrefix(tag, scheduleEnabledTag):
+			schedule.Enabled = strings.TrimPrefix(tag, scheduleEnabledTag) != "false"
+		}
+	}
+
+	if schedule.Cron == "" {
+		return schedule, fmt.Errorf("schedule needs a schedule:cron tag")
+	}
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return schedule, err
+	}
+	schedule.cron = cron
+
+	schedule.location = time.UTC
+	if schedule.Timezone != "" {
+		if schedule.location, err = time.LoadLocation(schedule.Timezone); err != nil {
+			return schedule, fmt.Errorf("unknown timezone %q", schedule.Timezone)
+		}
+	}
+
+	if schedule.AlertURL != "" {
+		target, err := url.Parse(schedule.AlertURL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return schedule, fmt.Errorf("invalid alert URL %q: use an absolute http or https URL", schedule.AlertURL)
+		}
+		if !webhookHostAllowed(target.Hostname(), ss.config.AllowedHosts) {
+			return schedule, fmt.Errorf("alert host %q is not in ENTITYDB_WEBHOOK_ALLOWED_HOSTS", target.Hostname())
+		}
+	}
+
+	if schedule.Action == "" {
+		return schedule, fmt.Errorf("schedule needs a schedule:action tag")
+	}
+	action, ok := ss.action(schedule.Action)
+	if !ok {
+		return schedule, fmt.Errorf("unknown action %q", schedule.Action)
+	}
+	if action.Validate != nil {
+		if err := action.Validate(schedule); err != nil {
+			return schedule, err
+		}
+	}
+	return schedule, nil
+}
+
+// scheduleOwner returns the user who created a schedule entity. The first
+// created_by tag is the one set at creation, ahead of any tags the creator
+// supplied.
+func scheduleOwner(entity *models.Entity) string {
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		if value, ok := strings.CutPrefix(tag, "created_by:"); ok {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"entitydb/models"
+	"entitydb/storage/binary"
+)
+
+// TestSchedulerPausedWrites checks that no schedule starts while writes are
+// paused and that schedules run again once writes resume
+func TestSchedulerPausedWrites(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestEntity(t, repo, &models.Entity{ID: "user-alice", Tags: []string{"type:user", "identity:username:alice", "status:active"}})
+	createTestEntity(t, repo, &models.Entity{ID: "schedule-1", Tags: []string{"type:schedule", "created_by:user-alice", "schedule:cron:* * * * *", "schedule:action:count"}})
+
+	var runs int32
+	scheduler := NewSchedulerService(repo, nil, SchedulerServiceConfig{Enabled: true})
+	scheduler.RegisterAction("count", ScheduleAction{Run: func(context.Context, Schedule, *models.SecurityUser) (interface{}, error) {
+		atomic.AddInt32(&runs, 1)
+		return nil, nil
+	}})
+	pause := &testWritePause{readOnly: true}
+	scheduler.SetWritePause(pause)
+
+	now := time.Date(2026, 1, 1, 12, 0, 30, 0, time.UTC)
+	for minute := 0; minute < 3; minute++ {
+		scheduler.tick(now.Add(time.Duration(minute) * time.Minute))
+	}
+	scheduler.wg.Wait()
+	if got := atomic.LoadInt32(&runs); got != 0 {
+		t.Fatalf("%d runs while writes were paused, want 0", got)
+	}
+	if runs, err := scheduler.ListRuns("schedule-1"); err != nil || len(runs) != 0 {
+		t.Fatalf("run entities while writes were paused: %v, %v", runs, err)
+	}
+
+	pause.readOnly = false
+	scheduler.tick(now.Add(3 * time.Minute))
+	scheduler.tick(now.Add(4 * time.Minute))
+	scheduler.wg.Wait()
+	if got := atomic.LoadInt32(&runs); got != 1 {
+		t.Fatalf("%d runs after writes resumed, want 1", got)
+	}
+}
+
+// newTestScheduler returns a scheduler over a repository holding the user
+// alice, with a count action that counts its runs
+func newTestScheduler(t *testing.T, config SchedulerServiceConfig) (*SchedulerService, *binary.EntityRepository, *int32) {
+	t.Helper()
+	repo := newTestRepository(t)
+	createTestEntity(t, repo, &models.Entity{ID: "user-alice", Tags: []string{"type:user", "identity:username:alice", "status:active"}})
+	var runs int32
+	scheduler := NewSchedulerService(repo, nil, config)
+	scheduler.RegisterAction("count", ScheduleAction{
+		Validate: func(schedule Schedule) error {
+			if schedule.Params["fail"] == "invalid" {
+				return errors.New("invalid count")
+			}
+			return nil
+		},
+		Run: func(_ context.Context, schedule Schedule, _ *models.SecurityUser) (interface{}, error) {
+			atomic.AddInt32(&runs, 1)
+			if schedule.Params["fail"] == "run" {
+				return nil, errors.New("count failed")
+			}
+			return map[string]int{"counted": 1}, nil
+		},
+	})
+	return scheduler, repo, &runs
+}
+
+// TestSchedulerTick checks that enabled schedules run once at each cron time
+// and that disabled and invalid schedules do not run
+func TestSchedulerTick(t *testing.T) {
+	scheduler, repo, runs := newTestScheduler(t, SchedulerServiceConfig{Enabled: true})
+	createTestEntity(t, repo, &models.Entity{ID: "schedule-1", Tags: []string{"type:schedule", "created_by:user-alice", "schedule:cron:*/5 * * * *", "schedule:action:count"}})
+	createTestEntity(t, repo, &models.Entity{ID: "schedule-off", Tags: []string{"type:schedule", "created_by:user-alice", "schedule:cron:* * * * *", "schedule:action:count", "schedule:enabled:false"}})
+	createTestEntity(t, repo, &models.Entity{ID: "schedule-bad", Tags: []string{"type:schedule", "created_by:user-alice", "schedule:cron:61 * * * *", "schedule:action:count"}})
+
+	start := time.Date(2026, 1, 1, 10, 1, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		minute int
+		runs   int32
+	}{
+		{1, 0}, // first sight: the next run is scheduled
+		{4, 0},
+		{5, 1},
+		{6, 1},
+		{9, 1},
+		{10, 2},
+	} {
+		scheduler.tick(start.Add(time.Duration(tc.minute-1) * time.Minute))
+		scheduler.wg.Wait()
+		if got := atomic.LoadInt32(runs); got != tc.runs {
+			t.Fatalf("%d runs after the tick at 10:%02d, want %d", got, tc.minute, tc.runs)
+		}
+	}
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	history, err := scheduler.ListRuns("schedule-1")
+	if err != nil || len(history) != 2 {
+		t.Fatalf("ListRuns = %d runs, %v; want 2", len(history), err)
+	}
+	for _, run := range history {
+		if run.Trigger != ScheduleTriggerCron || run.Status != ScheduleRunSucceeded || run.Action != "count" {
+			t.Errorf("run = %+v, want a succeeded cron run of count", run)
+		}
+	}
+	stats := scheduler.GetStats()
+	if stats.Runs != 2 || stats.Succeeded != 2 || stats.Schedules != 2 || stats.InvalidSchedules != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+// TestSchedulerTimezone checks that a schedule's cron expression is read in
+// its time zone
+func TestSchedulerTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	scheduler, _, _ := newTestScheduler(t, SchedulerServiceConfig{})
+	schedule, err := scheduler.ParseSchedule(&models.Entity{ID: "schedule-1", Tags: []string{
+		"schedule:cron:0 9 * * *", "schedule:action:count", "schedule:timezone:America/New_York",
+	}})
+	if err != nil {
+		t.Fatalf("ParseSchedule: %v", err)
+	}
+	got := schedule.next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2026, 1, 1, 14, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("next = %v, want 09:00 in New York (%v)", got, want)
+	}
+}
+
+// TestParseScheduleErrors checks that schedules with missing or invalid
+// settings are refused
+func TestParseScheduleErrors(t *testing.T) {
+	scheduler, _, _ := newTestScheduler(t, SchedulerServiceConfig{AllowedHosts: []string{"alerts.example.com"}})
+	for _, tags := range [][]string{
+		{"schedule:action:count"},
+		{"schedule:cron:* * *", "schedule:action:count"},
+		{"schedule:cron:* * * * *"},
+		{"schedule:cron:* * * * *", "schedule:action:reboot"},
+		{"schedule:cron:* * * * *", "schedule:action:count", "schedule:timezone:Mars/Olympus"},
+		{"schedule:cron:* * * * *", "schedule:action:count", "schedule:alert:ftp://alerts.example.com/"},
+		{"schedule:cron:* * * * *", "schedule:action:count", "schedule:alert:https://evil.example.com/"},
+		{"schedule:cron:* * * * *", "schedule:action:count", "schedule:param:nameless"},
+		{"schedule:cron:* * * * *", "schedule:action:count", "schedule:param:fail:invalid"},
+	} {
+		if _, err := scheduler.ParseSchedule(&models.Entity{ID: "schedule-1", Tags: tags}); err == nil {
+			t.Errorf("ParseSchedule(%v) succeeded, want an error", tags)
+		}
+	}
+	if _, err := scheduler.ParseSchedule(&models.Entity{ID: "schedule-1", Tags: []string{
+		"schedule:cron:* * * * *", "schedule:action:count", "schedule:alert:https://alerts.example.com/hook",
+	}}); err != nil {
+		t.Errorf("ParseSchedule with an allowed alert host: %v", err)
+	}
+}
+
+// testPermissions grants the permissions listed as resource:action
+type testPermissions map[string]bool
+
+func (p testPermissions) HasPermission(_ *models.SecurityUser, resource, action string) (bool, error) {
+	return p[resource+":"+action], nil
+}
+
+// TestSchedulerRunNow checks manual runs: the owner must be active and hold
+// the action's permission, failures are alerted, and the history is capped
+func TestSchedulerRunNow(t *testing.T) {
+	alerts := make(chan ScheduleAlert, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert ScheduleAlert
+		if r.Header.Get(WebhookEventHeader) != ScheduleAlertEvent || json.NewDecoder(r.Body).Decode(&alert) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		alerts <- alert
+	}))
+	defer receiver.Close()
+
+	scheduler, repo, runs := newTestScheduler(t, SchedulerServiceConfig{HistoryLimit: 2, AlertURL: receiver.URL})
+	scheduler.permissions = testPermissions{"entity:update": true}
+	scheduler.RegisterAction("guarded", ScheduleAction{Resource: "admin", Permission: "update", Run: func(context.Context, Schedule, *models.SecurityUser) (interface{}, error) {
+		atomic.AddInt32(runs, 1)
+		return nil, nil
+	}})
+	createTestEntity(t, repo, &models.Entity{ID: "user-gone", Tags: []string{"type:user", "status:disabled"}})
+	createTestEntity(t, repo, &models.Entity{ID: "schedule-ok", Tags: []string{"type:schedule", "created_by:user-alice", "schedule:cron:0 0 1 1 *", "schedule:action:count", "schedule:enabled:false"}})
+	createTestEntity(t, repo, &models.Entity{ID: "schedule-fail", Tags: []string{"type:schedule", "created_by:user-alice", "schedule:cron:0 0 1 1 *", "schedule:action:count", "schedule:param:fail:run"}})
+	createTestEntity(t, repo, &models.Entity{ID: "schedule-guarded", Tags: []string{"type:schedule", "created_by:user-alice", "schedule:cron:0 0 1 1 *", "schedule:action:guarded"}})
+	createTestEntity(t, repo, &models.Entity{ID: "schedule-orphan", Tags: []string{"type:schedule", "created_by:user-gone", "schedule:cron:0 0 1 1 *", "schedule:action:count"}})
+
+	// Disabled schedules run when asked to; only the newest runs are kept
+	for i := 0; i < 3; i++ {
+		run, err := scheduler.RunNow("schedule-ok")
+		if err != nil || run.Status != ScheduleRunSucceeded || run.Trigger != ScheduleTriggerManual {
+			t.Fatalf("RunNow = %+v, %v", run, err)
+		}
+		if _, err := repo.FlushPendingWrites(); err != nil {
+			t.Fatalf("FlushPendingWrites: %v", err)
+		}
+	}
+	if history, err := scheduler.ListRuns("schedule-ok"); err != nil || len(history) != 2 {
+		t.Errorf("ListRuns = %d runs, %v; want the history limit of 2", len(history), err)
+	}
+
+	for _, tc := range []struct {
+		id    string
+		error string
+	}{
+		{"schedule-fail", "count failed"},
+		{"schedule-guarded", "lacks admin:update"},
+		{"schedule-orphan", "is disabled"},
+	} {
+		before := atomic.LoadInt32(runs)
+		run, err := scheduler.RunNow(tc.id)
+		if err != nil || run.Status != ScheduleRunFailed || !strings.Contains(run.Error, tc.error) {
+			t.Errorf("RunNow(%s) = %+v, %v; want a run failing with %q", tc.id, run, err, tc.error)
+		}
+		if tc.id != "schedule-fail" && atomic.LoadInt32(runs) != before {
+			t.Errorf("RunNow(%s) ran the action", tc.id)
+		}
+		select {
+		case alert := <-alerts:
+			if alert.Run.ScheduleID != tc.id || alert.ConsecutiveFailures != 1 {
+				t.Errorf("alert = %+v, want the first failure of %s", alert, tc.id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no alert for the failed run of %s", tc.id)
+		}
+	}
+	if _, err := scheduler.RunNow("schedule-fail"); err != nil {
+		t.Fatal(err)
+	}
+	if alert := <-alerts; alert.ConsecutiveFailures != 2 {
+		t.Errorf("second failure alerted with %d consecutive failures, want 2", alert.ConsecutiveFailures)
+	}
+
+	if _, err := scheduler.RunNow("missing"); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("RunNow of a missing schedule = %v, want ErrScheduleNotFound", err)
+	}
+	createTestEntity(t, repo, &models.Entity{ID: "schedule-invalid", Tags: []string{"type:schedule", "schedule:cron:nope", "schedule:action:count"}})
+	if _, err := scheduler.RunNow("schedule-invalid"); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("RunNow of an invalid schedule = %v, want ErrInvalidSchedule", err)
+	}
+}
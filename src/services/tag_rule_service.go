@@ -0,0 +1,504 @@
+package services
+
+import (
+	"context"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tag rules derive tags from entity content. They are ordinary entities
+// tagged type:tag_rule whose condition and derived tags are tags, for
+// example:
+//
+//	type:tag_rule
+//	dataset:support
+//	tag_rule:field:content.status    (content path; "$.status" also works)
+//	tag_rule:operator:eq             (optional, default eq; exists needs no value)
+//	tag_rule:value:closed
+//	tag_rule:add:lifecycle:closed    (repeatable)
+//	tag_rule:type:ticket             (optional, limit to one entity type)
+//	tag_rule:enabled:false           (optional, switch the rule off)
+//
+// A rule applies to entities in its own dataset, so declaring one takes
+// the same access as tagging those entities. Rules are applied after each
+// committed write and to existing entities by ApplyAll. They only add
+// tags: when the condition stops holding, derived tags stay.
+const (
+	TagRuleType          = "tag_rule"
+	tagRuleFieldTag      = "tag_rule:field:"
+	tagRuleOperatorTag   = "tag_rule:operator:"
+	tagRuleValueTag      = "tag_rule:value:"
+	tagRuleAddTag        = "tag_rule:add:"
+	tagRuleEntityTypeTag = "tag_rule:type:"
+	tagRuleEnabledTag    = "tag_rule:enabled:"
+)
+
+// tagRuleOperators are the content filter operators a rule may use
+var tagRuleOperators = map[string]bool{
+	"eq": true, "ne": true, "gt": true, "lt": true, "gte": true, "lte": true,
+	"like": true, "in": true, "exists": true,
+}
+
+// tagRuleProtectedNamespaces are tag namespaces rules may not add to:
+// identity, security and layout tags are set only by their subsystems
+var tagRuleProtectedNamespaces = map[string]bool{
+	"type":       true,
+	"dataset":    true,
+	"created_at": true,
+	"created_by": true,
+	"uuid":       true,
+	"identity":   true,
+	"rbac":       true,
+	"acl":        true,
+	"content":    true,
+	"chunk":      true,
+	TagRuleType:  true,
+}
+
+// TagRule is a tag rule loaded from a rule entity
+type TagRule struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name,omitempty"`
+	Dataset    string   `json:"dataset"`
+	EntityType string   `json:"entity_type,omitempty"`
+	Field      string   `json:"field"`
+	Operator   string   `json:"operator"`
+	Value      string   `json:"value,omitempty"`
+	Tags       []string `json:"tags"`
+	Enabled    bool     `json:"enabled"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// active reports whether the rule is applied
+func (r TagRule) active() bool {
+	return r.Enabled && r.Error == ""
+}
+
+// missingTags returns the tags the rule derives for an entity that it does
+// not carry yet; nil when the rule does not apply
+func (r TagRule) missingTags(entity *models.Entity) []string {
+	if r.EntityType != "" && entity.GetTagValue("type") != r.EntityType {
+		return nil
+	}
+	path := strings.TrimPrefix(r.Field, models.ContentPathPrefix)
+	if !models.MatchContentPath(entity.Content, path, r.Operator, r.Value) {
+		return nil
+	}
+	var missing []string
+	for _, tag := range r.Tags {
+		if !entity.HasTag(tag) {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
+
+// ParseTagRule builds a tag rule from a rule entity's tags. Where a setting
+// appears more than once the most recently added value wins.
+func ParseTagRule(entity *models.Entity) (TagRule, error) {
+	rule := TagRule{
+		ID:       entity.ID,
+		Name:     entity.GetTagValue("name"),
+		Dataset:  entity.GetDataset(),
+		Operator: "eq",
+		Enabled:  true,
+	}
+
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		switch {
+		case strings.HasPrefix(tag, tagRuleFieldTag):
+			rule.Field = strings.TrimPrefix(tag, tagRuleFieldTag)
+
+		case strings.HasPrefix(tag, tagRuleOperatorTag):
+			rule.Operator = strings.TrimPrefix(tag, tagRuleOperatorTag)
+
+		case strings.HasPrefix(tag, tagRuleValueTag):
+			rule.Value = strings.TrimPrefix(tag, tagRuleValueTag)
+
+		case strings.HasPrefix(tag, tagRuleAddTag):
+			derived := strings.TrimPrefix(tag, tagRuleAddTag)
+			if !containsString(rule.Tags, derived) {
+				rule.Tags = append(rule.Tags, derived)
+			}
+
+		case strings.HasPrefix(tag, tagRuleEntityTypeTag):
+			rule.EntityType = strings.TrimPrefix(tag, tagRuleEntityTypeTag)
+
+		case strings.HasPrefix(tag, tagRuleEnabledTag):
+			rule.Enabled = strings.TrimPrefix(tag, tagRuleEnabledTag) != "false"
+		}
+	}
+
+	if rule.Dataset == "" || rule.Dataset == "system" {
+		return rule, fmt.Errorf("tag rule must be declared in the dataset it applies to, which cannot be system")
+	}
+	if rule.Field == "" {
+		return rule, fmt.Errorf("tag rule needs a tag_rule:field tag")
+	}
+	path := strings.TrimPrefix(rule.Field, models.ContentPathPrefix)
+	if strings.HasPrefix(path, "$") {
+		converted, err := models.ContentPathFromJSONPath(path)
+		if err != nil {
+			return rule, err
+		}
+		path = converted
+	}
+	rule.Field = models.ContentPathPrefix + path
+	if !tagRuleOperators[rule.Operator] {
+		return rule, fmt.Errorf("invalid tag rule operator %q", rule.Operator)
+	}
+	if rule.Value == "" && rule.Operator != "exists" {
+		return rule, fmt.Errorf("tag rule needs a tag_rule:value tag unless its operator is exists")
+	}
+	if len(rule.Tags) == 0 {
+		return rule, fmt.Errorf("tag rule needs at least one tag_rule:add tag")
+	}
+	for _, derived := range rule.Tags {
+		namespace, _, _ := strings.Cut(derived, ":")
+		if tagRuleProtectedNamespaces[namespace] || strings.HasPrefix(derived, "lifecycle:state:") {
+			return rule, fmt.Errorf("tag rules cannot add %q tags", derived)
+		}
+	}
+	return rule, nil
+}
+
+// TagRuleServiceConfig configures tag rules
+type TagRuleServiceConfig struct {
+	// Enabled controls whether rules are applied on write
+	Enabled bool
+}
+
+// TagRuleStats tracks tag rule activity on write
+type TagRuleStats struct {
+	Events    int64 `json:"events"`     // change events examined
+	Tagged    int64 `json:"tagged"`     // entities that received derived tags
+	TagsAdded int64 `json:"tags_added"` // derived tags added
+	Errors    int64 `json:"errors"`     // entities whose derived tags failed to be added
+
+	// FeedResets counts resubscriptions after falling behind the change
+	// feed; entities written meanwhile get their tags from ApplyAll
+	FeedResets int64 `json:"feed_resets"`
+}
+
+// TagRuleRunResult reports a run of the rules over existing entities
+type TagRuleRunResult struct {
+	Rules     int           `json:"rules"`
+	Examined  int           `json:"examined"`
+	Tagged    int           `json:"tagged"`
+	TagsAdded int           `json:"tags_added"`
+	Errors    []string      `json:"errors,omitempty"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// TagRuleService adds the tags of tag rules to the entities whose content
+// matches them
+type TagRuleService struct {
+	writePauser
+
+	repository models.EntityRepository
+	changes    ChangeSource
+	config     TagRuleServiceConfig
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running int32
+
+	// rules is reloaded whenever a rule entity changes; active rules are
+	// also held by dataset
+	rulesMu   sync.RWMutex
+	rules     []TagRule
+	byDataset map[string][]TagRule
+
+	stats TagRuleStats
+	mu    sync.Mutex
+}
+
+// NewTagRuleService creates a new tag rule service. changes may be nil when
+// the repository has no change feed, in which case rules are only applied
+// by ApplyAll.
+func NewTagRuleService(repository models.EntityRepository, changes ChangeSource, config TagRuleServiceConfig) *TagRuleService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TagRuleService{
+		repository: repository,
+		changes:    changes,
+		config:     config,
+		ctx:        ctx,
+		cancel:     cancel,
+		byDataset:  make(map[string][]TagRule),
+	}
+}
+
+// Start loads the rules and begins applying them to written entities
+func (ts *TagRuleService) Start() error {
+	if !atomic.CompareAndSwapInt32(&ts.running, 0, 1) {
+		return fmt.Errorf("tag rule service is already running")
+	}
+
+	if !ts.config.Enabled {
+		logger.Info("TagRuleService: Service disabled by configuration")
+		return nil
+	}
+	if ts.changes == nil {
+		logger.Warn("TagRuleService: Repository has no change feed, rules are not applied on write")
+		return nil
+	}
+
+	if err := ts.reload(); err != nil {
+		return err
+	}
+
+	changes, unsubscribe := ts.changes.SubscribeChanges(0)
+	ts.wg.Add(1)
+	go ts.applyLoop(changes, unsubscribe)
+
+	logger.Info("TagRuleService: Started with %d tag rules", len(ts.Rules()))
+	return nil
+}
+
+// Stop stops applying rules on write
+func (ts *TagRuleService) Stop() error {
+	if !atomic.CompareAndSwapInt32(&ts.running, 1, 0) {
+		return fmt.Errorf("tag rule service is not running")
+	}
+
+	logger.Info("TagRuleService: Stopping service")
+	ts.cancel()
+	ts.wg.Wait()
+	logger.Info("TagRuleService: Service stopped")
+
+	return nil
+}
+
+// IsEnabled returns true if rules are applied on write
+func (ts *TagRuleService) IsEnabled() bool {
+	return ts.config.Enabled
+}
+
+// GetStats returns current statistics
+func (ts *TagRuleService) GetStats() TagRuleStats {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.stats
+}
+
+// Rules returns the rules currently applied on write
+func (ts *TagRuleService) Rules() []TagRule {
+	ts.rulesMu.RLock()
+	defer ts.rulesMu.RUnlock()
+	return append([]TagRule(nil), ts.rules...)
+}
+
+// LoadRules reads all rule entities. Rules that fail to parse are returned
+// with Error set and are not applied.
+func (ts *TagRuleService) LoadRules() ([]TagRule, error) {
+	entities, err := ts.repository.ListByTag("type:" + TagRuleType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tag rules: %w", err)
+	}
+
+	rules := make([]TagRule, 0, len(entities))
+	for _, entity := range entities {
+		rule, err := ParseTagRule(entity)
+		if err != nil {
+			rule.Error = err.Error()
+		}
+		rules = append(rules, rule)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+// reload replaces the rules applied on write
+func (ts *TagRuleService) reload() error {
+	rules, err := ts.LoadRules()
+	if err != nil {
+		return err
+	}
+	byDataset := make(map[string][]TagRule)
+	for _, rule := range rules {
+		if rule.active() {
+			byDataset[rule.Dataset] = append(byDataset[rule.Dataset], rule)
+		}
+	}
+	ts.rulesMu.Lock()
+	ts.rules = rules
+	ts.byDataset = byDataset
+	ts.rulesMu.Unlock()
+	return nil
+}
+
+// datasetRules returns the active rules of a dataset
+func (ts *TagRuleService) datasetRules(dataset string) []TagRule {
+	ts.rulesMu.RLock()
+	defer ts.rulesMu.RUnlock()
+	return ts.byDataset[dataset]
+}
+
+// applyLoop applies the rules to each written entity. A subscription
+// dropped for falling behind is renewed.
+func (ts *TagRuleService) applyLoop(changes <-chan binary.ChangeEvent, unsubscribe func()) {
+	defer ts.wg.Done()
+	defer func() { unsubscribe() }()
+
+	for {
+		select {
+		case <-ts.ctx.Done():
+			return
+
+		case change, ok := <-changes:
+			if !ok {
+				logger.Warn("TagRuleService: Fell behind the change feed, some writes were not tagged")
+				ts.mu.Lock()
+				ts.stats.FeedResets++
+				ts.mu.Unlock()
+				changes, unsubscribe = ts.changes.SubscribeChanges(0)
+				continue
+			}
+			ts.handleChange(change)
+		}
+	}
+}
+
+// handleChange reloads the rules when a rule entity changes and otherwise
+// applies the rules of the entity's dataset to it. Writes seen while writes
+// are paused are not tagged.
+func (ts *TagRuleService) handleChange(change binary.ChangeEvent) {
+	if change.Dataset == "system" {
+		return
+	}
+	if ts.writesPaused() && change.Op != binary.ChangeOpDelete {
+		return
+	}
+	if change.Op == binary.ChangeOpDelete {
+		if containsString(change.Tags, "type:"+TagRuleType) {
+			if err := ts.reload(); err != nil {
+				logger.Error("TagRuleService: Failed to reload tag rules: %v", err)
+			}
+		}
+		return
+	}
+
+	entity, err := ts.repository.GetByID(change.EntityID)
+	if err != nil {
+		// Deleted since
+		return
+	}
+	if entity.HasTag("type:" + TagRuleType) {
+		if err := ts.reload(); err != nil {
+			logger.Error("TagRuleService: Failed to reload tag rules: %v", err)
+		}
+		return
+	}
+
+	ts.mu.Lock()
+	ts.stats.Events++
+	ts.mu.Unlock()
+
+	added, err := ts.apply(entity, ts.datasetRules(change.Dataset))
+	ts.mu.Lock()
+	if added > 0 {
+		ts.stats.Tagged++
+		ts.stats.TagsAdded += int64(added)
+	}
+	if err != nil {
+		ts.stats.Errors++
+	}
+	ts.mu.Unlock()
+	if err != nil {
+		logger.Error("TagRuleService: Failed to tag %s: %v", entity.ID, err)
+	}
+}
+
+// apply adds the tags the rules derive for an entity and returns how many
+// were added. Each added tag is a change of its own, which finds the tags
+// present and adds nothing.
+func (ts *TagRuleService) apply(entity *models.Entity, rules []TagRule) (int, error) {
+	if entity.HasTag("type:" + TagRuleType) {
+		return 0, nil
+	}
+	var missing []string
+	for _, rule := range rules {
+		for _, tag := range rule.missingTags(entity) {
+			if !containsString(missing, tag) {
+				missing = append(missing, tag)
+			}
+		}
+	}
+
+	added := 0
+	for _, tag := range missing {
+		if err := ts.repository.AddTag(entity.ID, tag); err != nil {
+			return added, fmt.Errorf("failed to add %s: %w", tag, err)
+		}
+		added++
+	}
+	return added, nil
+}
+
+// ApplyAll applies the rules to every existing entity of the datasets that
+// have rules, so entities written before a rule was declared, or while the
+// service was disabled, get its tags. progress is called after each entity.
+func (ts *TagRuleService) ApplyAll(ctx context.Context, progress func(processed, total int, entityID string, err error)) (*TagRuleRunResult, error) {
+	startTime := time.Now()
+	rules, err := ts.LoadRules()
+	if err != nil {
+		return nil, err
+	}
+
+	byDataset := make(map[string][]TagRule)
+	result := &TagRuleRunResult{}
+	for _, rule := range rules {
+		if rule.active() {
+			byDataset[rule.Dataset] = append(byDataset[rule.Dataset], rule)
+			result.Rules++
+		}
+	}
+
+	var entities []*models.Entity
+	for dataset := range byDataset {
+		inDataset, err := ts.repository.ListByTag("dataset:" + dataset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dataset %s: %w", dataset, err)
+		}
+		entities = append(entities, inDataset...)
+	}
+
+	for i, entity := range entities {
+		if err := ctx.Err(); err != nil {
+			result.Duration = time.Since(startTime)
+			return result, err
+		}
+		var added int
+		var err error
+		if !entity.HasTag("type:" + TagRuleType) {
+			added, err = ts.apply(entity, byDataset[entity.GetDataset()])
+			result.Examined++
+		}
+		if added > 0 {
+			result.Tagged++
+			result.TagsAdded += added
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", entity.ID, err))
+		}
+		if progress != nil {
+			progress(i+1, len(entities), entity.ID, err)
+		}
+	}
+
+	result.Duration = time.Since(startTime)
+	logger.Info("TagRuleService: Applied %d rules to %d entities, added %d tags to %d",
+		result.Rules, result.Examined, result.TagsAdded, result.Tagged)
+	return result, nil
+}
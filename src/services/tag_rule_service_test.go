@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// taggedEntity returns an entity carrying tags with timestamps, as read
+// back from the repository
+func taggedEntity(id, content string, tags ...string) *models.Entity {
+	entity := &models.Entity{ID: id}
+	if content != "" {
+		entity.Content = []byte(content)
+	}
+	for _, tag := range tags {
+		entity.AddTag(tag)
+	}
+	return entity
+}
+
+// TestParseTagRule checks the settings read from a rule entity and the
+// rules that are refused
+func TestParseTagRule(t *testing.T) {
+	rule, err := ParseTagRule(taggedEntity("rule-1", "",
+		"type:tag_rule", "dataset:support", "name:closed tickets",
+		"tag_rule:field:$.status", "tag_rule:value:closed", "tag_rule:type:ticket",
+		"tag_rule:add:lifecycle:closed", "tag_rule:add:sla:stopped", "tag_rule:add:lifecycle:closed",
+	))
+	if err != nil {
+		t.Fatalf("ParseTagRule: %v", err)
+	}
+	if rule.Dataset != "support" || rule.Field != "content.status" || rule.Operator != "eq" || rule.Value != "closed" ||
+		rule.EntityType != "ticket" || strings.Join(rule.Tags, ",") != "lifecycle:closed,sla:stopped" || !rule.active() {
+		t.Errorf("rule = %+v", rule)
+	}
+
+	valid := []string{"dataset:support", "tag_rule:field:content.status", "tag_rule:value:closed", "tag_rule:add:lifecycle:closed"}
+	for _, tc := range []struct {
+		name string
+		tags []string
+	}{
+		{"no dataset", []string{"tag_rule:field:content.status", "tag_rule:value:closed", "tag_rule:add:lifecycle:closed"}},
+		{"system dataset", []string{"dataset:system", "tag_rule:field:content.status", "tag_rule:value:closed", "tag_rule:add:lifecycle:closed"}},
+		{"no field", []string{"dataset:support", "tag_rule:value:closed", "tag_rule:add:lifecycle:closed"}},
+		{"invalid JSONPath", append(valid, "tag_rule:field:$..status")},
+		{"unknown operator", append(valid, "tag_rule:operator:matches")},
+		{"no value", []string{"dataset:support", "tag_rule:field:content.status", "tag_rule:add:lifecycle:closed"}},
+		{"no derived tags", []string{"dataset:support", "tag_rule:field:content.status", "tag_rule:value:closed"}},
+		{"security tag", append(valid, "tag_rule:add:acl:read:user:mallory")},
+		{"identity tag", append(valid, "tag_rule:add:identity:username:root")},
+		{"lifecycle state", append(valid, "tag_rule:add:lifecycle:state:deleted")},
+	} {
+		if _, err := ParseTagRule(taggedEntity("rule-1", "", tc.tags...)); err == nil {
+			t.Errorf("%s: ParseTagRule succeeded, want an error", tc.name)
+		}
+	}
+	if _, err := ParseTagRule(taggedEntity("rule-1", "",
+		"dataset:support", "tag_rule:field:content.assignee", "tag_rule:operator:exists", "tag_rule:add:assigned:yes",
+	)); err != nil {
+		t.Errorf("exists without a value: %v", err)
+	}
+}
+
+// TestTagRuleMatching checks which tags a rule derives for an entity
+func TestTagRuleMatching(t *testing.T) {
+	rule := func(operator, value, entityType string) TagRule {
+		return TagRule{Field: "content.status", Operator: operator, Value: value, EntityType: entityType, Tags: []string{"lifecycle:closed", "sla:stopped"}, Enabled: true}
+	}
+	ticket := func(content string, tags ...string) *models.Entity {
+		return taggedEntity("ticket-1", content, append([]string{"type:ticket"}, tags...)...)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		rule   TagRule
+		entity *models.Entity
+		want   string
+	}{
+		{"equal", rule("eq", "closed", ""), ticket(`{"status":"closed"}`), "lifecycle:closed,sla:stopped"},
+		{"not equal", rule("eq", "closed", ""), ticket(`{"status":"open"}`), ""},
+		{"missing field", rule("eq", "closed", ""), ticket(`{"priority":1}`), ""},
+		{"ne", rule("ne", "open", ""), ticket(`{"status":"closed"}`), "lifecycle:closed,sla:stopped"},
+		{"in", rule("in", "resolved, closed", ""), ticket(`{"status":"closed"}`), "lifecycle:closed,sla:stopped"},
+		{"exists", rule("exists", "", ""), ticket(`{"status":null}`), "lifecycle:closed,sla:stopped"},
+		{"entity type", rule("eq", "closed", "ticket"), ticket(`{"status":"closed"}`), "lifecycle:closed,sla:stopped"},
+		{"other entity type", rule("eq", "closed", "invoice"), ticket(`{"status":"closed"}`), ""},
+		{"tags already present", rule("eq", "closed", ""), ticket(`{"status":"closed"}`, "sla:stopped"), "lifecycle:closed"},
+	} {
+		if got := strings.Join(tc.rule.missingTags(tc.entity), ","); got != tc.want {
+			t.Errorf("%s: missing tags = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestTagRulesOnWrite checks that a rule tags written entities whose
+// content matches, and that the tags it adds do not trigger it again
+func TestTagRulesOnWrite(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestEntity(t, repo, &models.Entity{ID: "rule-closed", Tags: []string{
+		"type:tag_rule", "dataset:support", "tag_rule:field:content.status", "tag_rule:value:closed",
+		"tag_rule:add:lifecycle:closed", "tag_rule:add:sla:stopped",
+	}})
+	service := NewTagRuleService(repo, repo, TagRuleServiceConfig{Enabled: true})
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer service.Stop()
+
+	createTestEntity(t, repo, &models.Entity{ID: "ticket-open", Tags: []string{"type:ticket", "dataset:support"}, Content: []byte(`{"status":"open"}`)})
+	createTestEntity(t, repo, &models.Entity{ID: "ticket-closed", Tags: []string{"type:ticket", "dataset:support"}, Content: []byte(`{"status":"closed"}`)})
+	createTestEntity(t, repo, &models.Entity{ID: "other-closed", Tags: []string{"type:ticket", "dataset:sales"}, Content: []byte(`{"status":"closed"}`)})
+
+	// Three creates and the two tags added to ticket-closed
+	deadline := time.Now().Add(5 * time.Second)
+	for service.GetStats().Events < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v, want 5 events", service.GetStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if stats := service.GetStats(); stats.Events != 5 || stats.Tagged != 1 || stats.TagsAdded != 2 || stats.Errors != 0 {
+		t.Errorf("stats = %+v, want 5 events and one entity given 2 tags", stats)
+	}
+
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	for id, want := range map[string]bool{"ticket-closed": true, "ticket-open": false, "other-closed": false} {
+		entity, err := repo.GetByID(id)
+		if err != nil {
+			t.Fatalf("GetByID(%s): %v", id, err)
+		}
+		if entity.HasTag("lifecycle:closed") != want || entity.HasTag("sla:stopped") != want {
+			t.Errorf("%s tags = %v, want derived tags %v", id, entity.GetTagsWithoutTimestamp(), want)
+		}
+	}
+}
+
+// TestTagRulesApplyAll checks that ApplyAll tags entities written before
+// their rule and adds nothing when run again
+func TestTagRulesApplyAll(t *testing.T) {
+	repo := newTestRepository(t)
+	createTestEntity(t, repo, &models.Entity{ID: "ticket-closed", Tags: []string{"type:ticket", "dataset:support"}, Content: []byte(`{"status":"closed"}`)})
+	createTestEntity(t, repo, &models.Entity{ID: "ticket-open", Tags: []string{"type:ticket", "dataset:support"}, Content: []byte(`{"status":"open"}`)})
+	createTestEntity(t, repo, &models.Entity{ID: "rule-closed", Tags: []string{
+		"type:tag_rule", "dataset:support", "tag_rule:field:content.status", "tag_rule:value:closed", "tag_rule:add:lifecycle:closed",
+	}})
+	createTestEntity(t, repo, &models.Entity{ID: "rule-broken", Tags: []string{"type:tag_rule", "dataset:support", "tag_rule:field:content.status"}})
+	service := NewTagRuleService(repo, nil, TagRuleServiceConfig{})
+
+	result, err := service.ApplyAll(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ApplyAll: %v", err)
+	}
+	if result.Rules != 1 || result.Examined != 2 || result.Tagged != 1 || result.TagsAdded != 1 || len(result.Errors) != 0 {
+		t.Errorf("first run = %+v, want one rule adding one tag to one of two entities", result)
+	}
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+	if entity, err := repo.GetByID("ticket-closed"); err != nil || !entity.HasTag("lifecycle:closed") {
+		t.Fatalf("ticket-closed = %+v, %v; want it tagged lifecycle:closed", entity, err)
+	}
+
+	result, err = service.ApplyAll(context.Background(), nil)
+	if err != nil || result.Tagged != 0 || result.TagsAdded != 0 {
+		t.Errorf("second run = %+v, %v; want nothing added", result, err)
+	}
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserMergeType tags the entities that record user merges
+const UserMergeType = "user_merge"
+
+// userReferencePrefixes are tags that point at a user by ID. Merging a user
+// rewrites them to point at the surviving user.
+var userReferencePrefixes = []string{
+	"created_by:",
+	"authenticated_as:",
+	"lifecycle:deleted_by:",
+	"lifecycle:restored_by:",
+	"deleted_by:",
+	"restored_by:",
+	"archived_by:",
+	"purged_by:",
+}
+
+// mergeExcludedNamespaces are tag namespaces of a duplicate user that are not
+// carried into the survivor: they describe the duplicate entity itself or
+// would override the survivor's identity, state or credentials.
+var mergeExcludedNamespaces = map[string]bool{
+	"type":        true,
+	"dataset":     true,
+	"created_at":  true,
+	"created_by":  true,
+	"uuid":        true,
+	"identity":    true,
+	"name":        true,
+	"status":      true,
+	"has":         true,
+	"content":     true,
+	"merged":      true,
+	"merged_into": true,
+	"merged_from": true,
+}
+
+// UserMerge describes the merge of the user entities sharing a username
+type UserMerge struct {
+	Username   string   `json:"username"`
+	SurvivorID string   `json:"survivor_id"`
+	MergedIDs  []string `json:"merged_ids"`
+
+	// CarriedTags are tags of the merged users added to the survivor with
+	// their original timestamps
+	CarriedTags []string `json:"carried_tags,omitempty"`
+
+	// References counts tags on other entities rewritten from a merged user
+	// to the survivor
+	References int `json:"references"`
+
+	ReportID string `json:"report_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// UserReconciliationResult summarizes a reconciliation run
+type UserReconciliationResult struct {
+	DryRun       bool        `json:"dry_run"`
+	Duration     string      `json:"duration"`
+	UsersScanned int         `json:"users_scanned"`
+	Merges       []UserMerge `json:"merges"`
+}
+
+// UserReconciler finds user entities sharing a username, which legacy
+// migrations created and which make logins resolve to an arbitrary entity,
+// and merges each group into one surviving user. The survivor is the entity
+// models.SelectUserEntity resolves the username to.
+type UserReconciler struct {
+	repository models.EntityRepository
+	security   *models.SecurityManager
+
+	// runMu serializes runs so two merges never interleave
+	runMu sync.Mutex
+}
+
+// NewUserReconciler creates a user reconciler. The security manager, which
+// may be nil, has cached sessions of merged users dropped.
+func NewUserReconciler(repository models.EntityRepository, security *models.SecurityManager) *UserReconciler {
+	return &UserReconciler{repository: repository, security: security}
+}
+
+// duplicateGroups returns the users sharing each username, survivor first
+func (ur *UserReconciler) duplicateGroups() (map[string][]*models.Entity, int, error) {
+	users, err := ur.repository.ListByTag("type:" + models.EntityTypeUser)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	byName := make(map[string][]*models.Entity)
+	for _, user := range users {
+		if models.IsMergedUser(user) {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, tag := range user.GetTagsWithoutTimestamp() {
+			if !strings.HasPrefix(tag, models.UsernameTagPrefix) {
+				continue
+			}
+			name := strings.TrimPrefix(tag, models.UsernameTagPrefix)
+			if !seen[name] {
+				seen[name] = true
+				byName[name] = append(byName[name], user)
+			}
+		}
+	}
+
+	groups := make(map[string][]*models.Entity)
+	for name, entities := range byName {
+		if len(entities) < 2 {
+			continue
+		}
+		survivor := models.SelectUserEntity(entities)
+		group := []*models.Entity{survivor}
+		for _, entity := range entities {
+			if entity.ID != survivor.ID {
+				group = append(group, entity)
+			}
+		}
+		groups[name] = group
+	}
+	return groups, len(users), nil
+}
+
+// RunOnce finds and merges duplicate users. With dryRun set nothing is
+// modified and the result reports the merges that would be made.
+func (ur *UserReconciler) RunOnce(dryRun bool) (*UserReconciliationResult, error) {
+	ur.runMu.Lock()
+	defer ur.runMu.Unlock()
+
+	start := time.Now()
+	groups, scanned, err := ur.duplicateGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := &UserReconciliationResult{
+		DryRun:       dryRun,
+		UsersScanned: scanned,
+		Merges:       make([]UserMerge, 0, len(names)),
+	}
+	for _, name := range names {
+		merge := ur.merge(name, groups[name], dryRun)
+		if merge.Error != "" {
+			logger.Error("UserReconciler: Failed to merge duplicate users of %s: %s", name, merge.Error)
+		} else if !dryRun {
+			logger.Info("UserReconciler: Merged %d duplicate users of %s into %s (%d references rewritten)",
+				len(merge.MergedIDs), name, merge.SurvivorID, merge.References)
+		}
+		result.Merges = append(result.Merges, merge)
+	}
+	result.Duration = time.Since(start).String()
+	return result, nil
+}
+
+// merge folds the duplicates of a username into the survivor, the first
+// entity of group
+func (ur *UserReconciler) merge(username string, group []*models.Entity, dryRun bool) UserMerge {
+	survivor := group[0]
+	merge := UserMerge{Username: username, SurvivorID: survivor.ID}
+	for _, duplicate := range group[1:] {
+		merge.MergedIDs = append(merge.MergedIDs, duplicate.ID)
+	}
+
+	for _, duplicate := range group[1:] {
+		carried, err := ur.carryHistory(survivor.ID, duplicate, dryRun)
+		if err != nil {
+			merge.Error = err.Error()
+			return merge
+		}
+		merge.CarriedTags = append(merge.CarriedTags, carried...)
+
+		references, err := ur.rewriteReferences(duplicate.ID, survivor.ID, dryRun)
+		merge.References += references
+		if err != nil {
+			merge.Error = err.Error()
+			return merge
+		}
+
+		if dryRun {
+			continue
+		}
+		if err := ur.retire(duplicate, survivor.ID, username); err != nil {
+			merge.Error = err.Error()
+			return merge
+		}
+		if ur.security != nil {
+			ur.security.ForgetUserSessions(duplicate.ID)
+		}
+	}
+
+	if !dryRun {
+		reportID, err := ur.recordMerge(merge)
+		if err != nil {
+			merge.Error = err.Error()
+			return merge
+		}
+		merge.ReportID = reportID
+	}
+	return merge
+}
+
+// carryHistory adds the duplicate's tags the survivor lacks to the survivor,
+// keeping their timestamps so they join its history, and records the merge
+// on the survivor. It returns the carried tags without timestamps.
+func (ur *UserReconciler) carryHistory(survivorID string, duplicate *models.Entity, dryRun bool) ([]string, error) {
+	survivor, err := ur.repository.GetByID(survivorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load survivor %s: %w", survivorID, err)
+	}
+
+	var carried, carriedTags []string
+	seen := make(map[string]bool)
+	for _, tag := range duplicate.Tags {
+		clean := tag
+		if idx := strings.Index(tag, "|"); idx >= 0 {
+			clean = tag[idx+1:]
+		}
+		namespace := clean
+		if idx := strings.Index(clean, ":"); idx >= 0 {
+			namespace = clean[:idx]
+		}
+		if mergeExcludedNamespaces[namespace] || seen[clean] || survivor.HasTag(clean) {
+			continue
+		}
+		seen[clean] = true
+		carried = append(carried, clean)
+		carriedTags = append(carriedTags, tag)
+	}
+	if dryRun {
+		return carried, nil
+	}
+
+	updated := survivor.WithTags(append(append([]string(nil), survivor.Tags...), carriedTags...))
+	updated.AddTag(models.MergedFromTagPrefix + duplicate.ID)
+	if err := ur.repository.Update(updated); err != nil {
+		return nil, fmt.Errorf("failed to update survivor %s: %w", survivorID, err)
+	}
+	return carried, nil
+}
+
+// rewriteReferences points tags referencing fromID at toID. In a dry run it
+// only counts them.
+func (ur *UserReconciler) rewriteReferences(fromID, toID string, dryRun bool) (int, error) {
+	count := 0
+	for _, prefix := range userReferencePrefixes {
+		holders, err := ur.repository.ListByTag(prefix + fromID)
+		if err != nil {
+			return count, fmt.Errorf("failed to find %s%s references: %w", prefix, fromID, err)
+		}
+		for _, holder := range holders {
+			if holder.ID == fromID {
+				continue
+			}
+			count++
+			if dryRun {
+				continue
+			}
+			if err := ur.repository.AddTag(holder.ID, prefix+toID); err != nil {
+				return count, fmt.Errorf("failed to rewrite reference on %s: %w", holder.ID, err)
+			}
+			for _, stored := range holder.StoredTags(prefix + fromID) {
+				if err := ur.repository.RemoveTag(holder.ID, stored); err != nil {
+					return count, fmt.Errorf("failed to rewrite reference on %s: %w", holder.ID, err)
+				}
+			}
+		}
+	}
+	return count, nil
+}
+
+// retire marks a duplicate as merged and takes away its identity and
+// credentials so the username only resolves to the survivor
+func (ur *UserReconciler) retire(duplicate *models.Entity, survivorID, username string) error {
+	// merged_into first: from then on the duplicate's identity tags no longer
+	// count as taken
+	for _, tag := range []string{models.MergedIntoTagPrefix + survivorID, "merged:username:" + username, "status:merged"} {
+		if err := ur.repository.AddTag(duplicate.ID, tag); err != nil {
+			return fmt.Errorf("failed to mark %s as merged: %w", duplicate.ID, err)
+		}
+	}
+
+	remove := []string{"status:active", "has:credentials"}
+	for _, tag := range duplicate.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, models.IdentityTagPrefix) {
+			remove = append(remove, tag)
+		}
+	}
+	for _, tag := range remove {
+		for _, stored := range duplicate.StoredTags(tag) {
+			if err := ur.repository.RemoveTag(duplicate.ID, stored); err != nil {
+				return fmt.Errorf("failed to retire %s: %w", duplicate.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// recordMerge stores the merge report as a user_merge entity
+func (ur *UserReconciler) recordMerge(merge UserMerge) (string, error) {
+	entity, err := models.NewEntityWithMandatoryTags(UserMergeType, "system", models.SystemUserID, []string{
+		"merge:username:" + merge.Username,
+		"merge:survivor:" + merge.SurvivorID,
+		"content:type:application/json",
+	})
+	if err != nil {
+		return "", err
+	}
+	if entity.Content, err = json.Marshal(merge); err != nil {
+		return "", err
+	}
+	if err := ur.repository.Create(entity); err != nil {
+		return "", fmt.Errorf("failed to record merge: %w", err)
+	}
+	return entity.ID, nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"testing"
+
+	"entitydb/models"
+	"entitydb/storage/binary"
+)
+
+// newDuplicateUsers stores two users sharing the username alice, the older
+// one active with credentials, and a document created by the newer one
+func newDuplicateUsers(t *testing.T) *binary.EntityRepository {
+	t.Helper()
+	repo := newTestRepository(t)
+	createTestEntity(t, repo, &models.Entity{ID: "user-alice", CreatedAt: 1000, Tags: []string{
+		"type:user", "dataset:system", "identity:username:alice", "status:active", "has:credentials", "rbac:role:user",
+	}})
+	createTestEntity(t, repo, &models.Entity{ID: "user-alice-2", CreatedAt: 2000, Tags: []string{
+		"type:user", "dataset:system", "identity:username:alice", "status:active", "rbac:role:auditor", "profile:email:alice@example.com",
+	}})
+	createTestEntity(t, repo, &models.Entity{ID: "user-bob", CreatedAt: 3000, Tags: []string{
+		"type:user", "dataset:system", "identity:username:bob", "status:active", "has:credentials",
+	}})
+	createTestEntity(t, repo, &models.Entity{ID: "doc-1", Tags: []string{"type:document", "created_by:user-alice-2"}})
+	return repo
+}
+
+// TestUserReconcilerDryRun checks that a dry run reports the merge it would
+// make without changing anything
+func TestUserReconcilerDryRun(t *testing.T) {
+	repo := newDuplicateUsers(t)
+	result, err := NewUserReconciler(repo, nil).RunOnce(true)
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if !result.DryRun || result.UsersScanned != 3 || len(result.Merges) != 1 {
+		t.Fatalf("dry run = %+v, want one merge of three users scanned", result)
+	}
+	merge := result.Merges[0]
+	if merge.Username != "alice" || merge.SurvivorID != "user-alice" || len(merge.MergedIDs) != 1 || merge.MergedIDs[0] != "user-alice-2" {
+		t.Errorf("merge = %+v, want user-alice-2 merged into user-alice", merge)
+	}
+	if merge.References != 1 || merge.ReportID != "" || merge.Error != "" {
+		t.Errorf("merge = %+v, want one reference and no report", merge)
+	}
+	carried := map[string]bool{}
+	for _, tag := range merge.CarriedTags {
+		carried[tag] = true
+	}
+	if !carried["rbac:role:auditor"] || !carried["profile:email:alice@example.com"] || carried["status:active"] || carried["identity:username:alice"] {
+		t.Errorf("carried tags = %v, want the role and email only", merge.CarriedTags)
+	}
+
+	duplicate, _ := repo.GetByID("user-alice-2")
+	document, _ := repo.GetByID("doc-1")
+	if models.IsMergedUser(duplicate) || !document.HasTag("created_by:user-alice-2") {
+		t.Error("dry run changed the users or their references")
+	}
+	if reports, _ := repo.ListByTag("type:" + UserMergeType); len(reports) != 0 {
+		t.Errorf("dry run recorded %d merge reports", len(reports))
+	}
+}
+
+// TestUserReconcilerMerge checks that duplicates are folded into the
+// survivor, which keeps the username, their history and their references
+func TestUserReconcilerMerge(t *testing.T) {
+	repo := newDuplicateUsers(t)
+	reconciler := NewUserReconciler(repo, nil)
+	result, err := reconciler.RunOnce(false)
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if len(result.Merges) != 1 || result.Merges[0].Error != "" || result.Merges[0].ReportID == "" {
+		t.Fatalf("merge = %+v, want one recorded merge", result.Merges)
+	}
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("FlushPendingWrites: %v", err)
+	}
+
+	survivor, err := repo.GetByID("user-alice")
+	if err != nil {
+		t.Fatalf("GetByID survivor: %v", err)
+	}
+	for _, tag := range []string{"identity:username:alice", "has:credentials", "rbac:role:auditor", "profile:email:alice@example.com", "merged_from:user-alice-2"} {
+		if !survivor.HasTag(tag) {
+			t.Errorf("survivor lacks %s: %v", tag, survivor.GetTagsWithoutTimestamp())
+		}
+	}
+
+	duplicate, err := repo.GetByID("user-alice-2")
+	if err != nil {
+		t.Fatalf("GetByID duplicate: %v", err)
+	}
+	if !models.IsMergedUser(duplicate) || !duplicate.HasTag("status:merged") {
+		t.Errorf("duplicate not marked merged: %v", duplicate.GetTagsWithoutTimestamp())
+	}
+	for _, tag := range []string{"identity:username:alice", "status:active"} {
+		if duplicate.HasTag(tag) {
+			t.Errorf("duplicate kept %s", tag)
+		}
+	}
+
+	document, _ := repo.GetByID("doc-1")
+	if !document.HasTag("created_by:user-alice") || document.HasTag("created_by:user-alice-2") {
+		t.Errorf("reference not rewritten: %v", document.GetTagsWithoutTimestamp())
+	}
+
+	holders, _ := repo.ListByTag("identity:username:alice")
+	if user := models.SelectUserEntity(holders); user == nil || user.ID != "user-alice" {
+		t.Errorf("alice resolves to %v, want user-alice", user)
+	}
+	if err := models.CheckUniqueIdentity(repo, "user-alice", []string{"identity:username:alice"}); err != nil {
+		t.Errorf("survivor does not hold alice alone: %v", err)
+	}
+
+	again, err := reconciler.RunOnce(false)
+	if err != nil || len(again.Merges) != 0 {
+		t.Errorf("second run = %+v, %v; want no merges", again, err)
+	}
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"entitydb/storage/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Views are saved queries stored as entities:
+//
+//	type:view
+//	dataset:system
+//	view:name:open-orders
+//
+// The entity's JSON content holds the definition: an EQL expression whose
+// tags may contain {{name}} placeholders, plus sort order, projected fields
+// and a default limit. Running a view substitutes the placeholders with
+// request values or the view's defaults.
+const viewNameTag = "view:name:"
+
+// viewNamePattern restricts view names to what is safe in tags and URL paths
+var viewNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// viewParameterPattern matches the names allowed for {{name}} placeholders
+var viewParameterPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// viewReservedParameters are run options that cannot name a parameter
+var viewReservedParameters = map[string]bool{"limit": true, "offset": true}
+
+var (
+	// ErrViewNotFound is returned for names without a view
+	ErrViewNotFound = errors.New("view not found")
+
+	// ErrViewExists is returned when creating a view whose name is taken
+	ErrViewExists = errors.New("a view with this name already exists")
+
+	// ErrInvalidView is returned for invalid definitions and run parameters
+	ErrInvalidView = errors.New("invalid view")
+)
+
+// View is a saved query
+type View struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Query is an EQL expression; {{name}} in a tag is a parameter
+	Query string `json:"query"`
+
+	// Dataset restricts results to one dataset
+	Dataset string `json:"dataset,omitempty"`
+
+	// Sort is id, created_at, updated_at, tag:<namespace> or
+	// content.<path>; Order is asc (default) or desc
+	Sort  string `json:"sort,omitempty"`
+	Order string `json:"order,omitempty"`
+
+	// Fields projects each result to these fields: id, tags, content,
+	// created_at, updated_at, tag:<namespace> or content.<path>
+	Fields []string `json:"fields,omitempty"`
+
+	// Limit is the default page size; 0 returns every result
+	Limit int `json:"limit,omitempty"`
+
+	// Parameters maps parameter names to default values. Placeholders
+	// without a default must be given when the view is run.
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// ViewService stores and resolves saved queries
+type ViewService struct {
+	repository models.EntityRepository
+}
+
+// NewViewService creates a new view service
+func NewViewService(repository models.EntityRepository) *ViewService {
+	return &ViewService{repository: repository}
+}
+
+// List returns every view, ordered by name
+func (vs *ViewService) List() ([]View, error) {
+	entities, err := vs.repository.ListByTag("type:view")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list views: %w", err)
+	}
+	views := make([]View, 0, len(entities))
+	for _, entity := range entities {
+		view, err := parseView(entity)
+		if err != nil {
+			logger.Warn("ViewService: skipping view entity %s: %v", entity.ID, err)
+			continue
+		}
+		views = append(views, *view)
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+	return views, nil
+}
+
+// Get returns the view of a name
+func (vs *ViewService) Get(name string) (*View, error) {
+	_, view, err := vs.find(name)
+	return view, err
+}
+
+// find returns the view of a name and its entity
+func (vs *ViewService) find(name string) (*models.Entity, *View, error) {
+	entities, err := vs.repository.ListByTag(viewNameTag + name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up view: %w", err)
+	}
+	for _, entity := range entities {
+		if !entity.HasTag("type:view") {
+			continue
+		}
+		if view, err := parseView(entity); err == nil && view.Name == name {
+			return entity, view, nil
+		}
+	}
+	return nil, nil, ErrViewNotFound
+}
+
+// parseView builds a View from a view entity
+func parseView(entity *models.Entity) (*View, error) {
+	var view View
+	if err := json.Unmarshal(entity.Content, &view); err != nil {
+		return nil, fmt.Errorf("invalid view definition: %w", err)
+	}
+	view.ID = entity.ID
+	view.CreatedAt = time.Unix(0, entity.CreatedAt)
+	view.UpdatedAt = time.Unix(0, entity.UpdatedAt)
+	return &view, nil
+}
+
+// encodeView returns the stored form of a definition
+func encodeView(view View) ([]byte, error) {
+	view.ID = ""
+	view.CreatedAt, view.UpdatedAt = time.Time{}, time.Time{}
+	return json.Marshal(view)
+}
+
+// Create saves a new view
+func (vs *ViewService) Create(view View, createdBy string) (*View, error) {
+	if err := ValidateView(&view); err != nil {
+		return nil, err
+	}
+	if _, _, err := vs.find(view.Name); err == nil {
+		return nil, ErrViewExists
+	} else if !errors.Is(err, ErrViewNotFound) {
+		return nil, err
+	}
+
+	view.CreatedBy = createdBy
+	content, err := encodeView(view)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := models.NewEntityWithMandatoryTags("view", "system", createdBy, nil)
+	if err != nil {
+		return nil, err
+	}
+	entity.AddTag(viewNameTag + view.Name)
+	entity.AddTag("content:type:json")
+	entity.Content = content
+	if err := vs.repository.Create(entity); err != nil {
+		return nil, fmt.Errorf("failed to create view: %w", err)
+	}
+	logger.Info("ViewService: created view %s", view.Name)
+	return parseView(entity)
+}
+
+// Update replaces the definition of a view. Views cannot be renamed.
+func (vs *ViewService) Update(name string, view View) (*View, error) {
+	if view.Name == "" {
+		view.Name = name
+	}
+	if view.Name != name {
+		return nil, fmt.Errorf("%w: views cannot be renamed", ErrInvalidView)
+	}
+	if err := ValidateView(&view); err != nil {
+		return nil, err
+	}
+	entity, existing, err := vs.find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	view.CreatedBy = existing.CreatedBy
+	content, err := encodeView(view)
+	if err != nil {
+		return nil, err
+	}
+	entity.Content = content
+	if err := vs.repository.Update(entity); err != nil {
+		return nil, fmt.Errorf("failed to update view: %w", err)
+	}
+	logger.Info("ViewService: updated view %s", name)
+	return parseView(entity)
+}
+
+// Delete removes a view
+func (vs *ViewService) Delete(name string) error {
+	entity, _, err := vs.find(name)
+	if err != nil {
+		return err
+	}
+	if err := vs.repository.Delete(entity.ID); err != nil {
+		return fmt.Errorf("failed to delete view: %w", err)
+	}
+	logger.Info("ViewService: deleted view %s", name)
+	return nil
+}
+
+// ValidateView checks a definition and normalizes its sort order
+func ValidateView(view *View) error {
+	if !viewNamePattern.MatchString(view.Name) {
+		return fmt.Errorf("%w: name %q may only use letters, digits, '.', '_' and '-'", ErrInvalidView, view.Name)
+	}
+	node, err := binary.ParseEQL(view.Query)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidView, err)
+	}
+	for _, name := range binary.EQLParameters(node) {
+		if viewReservedParameters[name] {
+			return fmt.Errorf("%w: %q cannot be used as a parameter name", ErrInvalidView, name)
+		}
+	}
+	for name := range view.Parameters {
+		if !viewParameterPattern.MatchString(name) || viewReservedParameters[name] {
+			return fmt.Errorf("%w: invalid parameter name %q", ErrInvalidView, name)
+		}
+	}
+	if view.Sort != "" && (view.Sort == "tags" || view.Sort == "content" || !validViewField(view.Sort)) {
+		return fmt.Errorf("%w: cannot sort by %q", ErrInvalidView, view.Sort)
+	}
+	switch view.Order = strings.ToLower(view.Order); view.Order {
+	case "", "asc", "desc":
+	default:
+		return fmt.Errorf("%w: order must be asc or desc", ErrInvalidView)
+	}
+	for _, field := range view.Fields {
+		if !validViewField(field) {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidView, field)
+		}
+	}
+	if view.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidView)
+	}
+	return nil
+}
+
+// validViewField reports whether a field can be projected
+func validViewField(field string) bool {
+	switch field {
+	case "id", "tags", "content", "created_at", "updated_at":
+		return true
+	}
+	if namespace, ok := strings.CutPrefix(field, "tag:"); ok {
+		return namespace != ""
+	}
+	return models.IsContentPathField(field)
+}
+
+// Expression returns the view's query with its placeholders replaced by
+// values, falling back to the view's defaults
+func (view *View) Expression(values map[string]string) (string, error) {
+	node, err := binary.ParseEQL(view.Query)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidView, err)
+	}
+	merged := make(map[string]string, len(view.Parameters)+len(values))
+	for name, value := range view.Parameters {
+		if value != "" {
+			merged[name] = value
+		}
+	}
+	for name, value := range values {
+		merged[name] = value
+	}
+	substituted, err := binary.SubstituteEQL(node, merged)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidView, err)
+	}
+	return binary.FormatEQL(substituted), nil
+}
+
+// SortViewResults orders entities by the view's sort field. Entities
+// without a value sort last; ties fall back to creation time and ID.
+func (view *View) SortViewResults(entities []*models.Entity) {
+	field := view.Sort
+	if field == "" {
+		field = "created_at"
+	}
+	desc := view.Order == "desc"
+	keys := make(map[string]interface{}, len(entities))
+	for _, entity := range entities {
+		if value, ok := viewFieldValue(entity, field); ok {
+			keys[entity.ID] = value
+		}
+	}
+	sort.SliceStable(entities, func(i, j int) bool {
+		a, aok := keys[entities[i].ID]
+		b, bok := keys[entities[j].ID]
+		if aok != bok {
+			return aok
+		}
+		if aok {
+			if c := compareViewValues(a, b); c != 0 {
+				return (c < 0) != desc
+			}
+		}
+		if entities[i].CreatedAt != entities[j].CreatedAt {
+			return entities[i].CreatedAt < entities[j].CreatedAt
+		}
+		return entities[i].ID < entities[j].ID
+	})
+}
+
+// Project returns the view's fields of an entity. Missing fields are null.
+func (view *View) Project(entity *models.Entity) map[string]interface{} {
+	row := make(map[string]interface{}, len(view.Fields))
+	for _, field := range view.Fields {
+		value, _ := viewFieldValue(entity, field)
+		row[field] = value
+	}
+	return row
+}
+
+// viewFieldValue resolves a field of an entity
+func viewFieldValue(entity *models.Entity, field string) (interface{}, bool) {
+	switch field {
+	case "id":
+		return entity.ID, true
+	case "tags":
+		return entity.GetTagsWithoutTimestamp(), true
+	case "content":
+		if document, ok := models.ParseJSONContent(entity.Content); ok {
+			return document, true
+		}
+		return string(entity.Content), len(entity.Content) > 0
+	case "created_at":
+		return entity.CreatedAt, true
+	case "updated_at":
+		return entity.UpdatedAt, true
+	}
+	if namespace, ok := strings.CutPrefix(field, "tag:"); ok {
+		value := entity.GetTagValue(namespace)
+		return value, value != ""
+	}
+	if models.IsContentPathField(field) {
+		return models.LookupContentPath(entity.Content, strings.TrimPrefix(field, models.ContentPathPrefix))
+	}
+	return nil, false
+}
+
+// compareViewValues orders numbers numerically and everything else by its
+// string form
+func compareViewValues(a, b interface{}) int {
+	af, aNumber := viewNumber(a)
+	bf, bNumber := viewNumber(b)
+	if aNumber && bNumber {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func viewNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
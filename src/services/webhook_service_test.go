@@ -0,0 +1,178 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"entitydb/models"
+	"entitydb/storage/binary"
+)
+
+// TestSignWebhookPayload checks the signature against a known HMAC-SHA256
+func TestSignWebhookPayload(t *testing.T) {
+	got := SignWebhookPayload("sekrit", "1700000000", []byte(`{"event":"create"}`))
+	if want := "sha256=f271c113892d68bb95a1cab399aa21900f813dc93f14a2ae0cf995abf26b5652"; got != want {
+		t.Errorf("SignWebhookPayload = %s, want %s", got, want)
+	}
+}
+
+// TestWebhookDelivery checks that creating an entity POSTs a payload signed
+// with the webhook's secret
+func TestWebhookDelivery(t *testing.T) {
+	const secret = "sekrit"
+	deliveries := make(chan WebhookPayload, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(r.Header.Get(WebhookTimestampHeader) + "."))
+		mac.Write(body)
+		if !hmac.Equal([]byte(r.Header.Get(WebhookSignatureHeader)), []byte("sha256="+hex.EncodeToString(mac.Sum(nil)))) {
+			t.Errorf("delivery signature %q does not match the secret", r.Header.Get(WebhookSignatureHeader))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil || r.Header.Get(WebhookEventHeader) != payload.Event || r.Header.Get(WebhookDeliveryHeader) != payload.DeliveryID {
+			t.Errorf("delivery headers %v do not match the payload %s", r.Header, body)
+		}
+		deliveries <- payload
+	}))
+	defer receiver.Close()
+
+	repo := newTestRepository(t)
+	createTestEntity(t, repo, &models.Entity{ID: "webhook-orders", Tags: []string{
+		"type:webhook", "webhook:url:" + receiver.URL, "webhook:secret:" + secret, "webhook:filter:type:order",
+	}})
+	service := NewWebhookService(repo, repo, WebhookServiceConfig{Enabled: true})
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer service.Stop()
+
+	createTestEntity(t, repo, &models.Entity{ID: "note-1", Tags: []string{"type:note"}})
+	createTestEntity(t, repo, &models.Entity{ID: "order-1", Tags: []string{"type:order"}})
+	select {
+	case payload := <-deliveries:
+		if payload.Event != WebhookEventCreate || payload.EntityID != "order-1" || !slices.Contains(payload.Tags, "type:order") {
+			t.Errorf("payload = %+v, want the creation of order-1", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery for order-1")
+	}
+	select {
+	case payload := <-deliveries:
+		t.Errorf("unexpected delivery %+v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestWebhookFiltering checks which webhooks a change is queued for
+func TestWebhookFiltering(t *testing.T) {
+	repo := newTestRepository(t)
+	for _, webhook := range []*models.Entity{
+		{ID: "webhook-all", Tags: []string{"type:webhook", "webhook:url:https://hooks.example.com/all"}},
+		{ID: "webhook-deletes", Tags: []string{"type:webhook", "webhook:url:https://hooks.example.com/deletes", "webhook:event:delete"}},
+		{ID: "webhook-paid-orders", Tags: []string{"type:webhook", "webhook:url:https://hooks.example.com/paid", "webhook:filter:type:order", "webhook:filter:status:paid"}},
+		{ID: "webhook-off", Tags: []string{"type:webhook", "webhook:url:https://hooks.example.com/off", "webhook:enabled:false"}},
+		{ID: "webhook-foreign", Tags: []string{"type:webhook", "webhook:url:https://evil.example.org/"}},
+		{ID: "webhook-bad", Tags: []string{"type:webhook", "webhook:url:https://hooks.example.com/bad", "webhook:event:rename"}},
+	} {
+		createTestEntity(t, repo, webhook)
+	}
+	createTestEntity(t, repo, &models.Entity{ID: "order-open", Tags: []string{"type:order", "status:open"}})
+	createTestEntity(t, repo, &models.Entity{ID: "order-paid", Tags: []string{"type:order", "status:paid"}})
+
+	service := NewWebhookService(repo, nil, WebhookServiceConfig{Enabled: true, AllowedHosts: []string{"*.example.com"}})
+	if err := service.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	for _, webhook := range service.Webhooks() {
+		if wantError := webhook.ID == "webhook-foreign" || webhook.ID == "webhook-bad"; (webhook.Error != "") != wantError {
+			t.Errorf("webhook %s error = %q", webhook.ID, webhook.Error)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		event  string
+		change binary.ChangeEvent
+		want   []string
+	}{
+		{"create", WebhookEventCreate, binary.ChangeEvent{Op: binary.ChangeOpCreate, EntityID: "order-open"}, []string{"webhook-all"}},
+		{"update matching every filter", WebhookEventUpdate, binary.ChangeEvent{Op: binary.ChangeOpUpdate, EntityID: "order-paid"}, []string{"webhook-all", "webhook-paid-orders"}},
+		{"tag change is an update", WebhookEventUpdate, binary.ChangeEvent{Op: binary.ChangeOpTag, EntityID: "order-paid"}, []string{"webhook-all", "webhook-paid-orders"}},
+		{"delete filters on the deleted tags", WebhookEventDelete, binary.ChangeEvent{Op: binary.ChangeOpDelete, EntityID: "order-gone", Tags: []string{"type:order", "status:paid"}}, []string{"webhook-all", "webhook-deletes", "webhook-paid-orders"}},
+		{"system dataset", "", binary.ChangeEvent{Op: binary.ChangeOpCreate, EntityID: "order-paid", Dataset: "system"}, nil},
+		{"entity deleted since", "", binary.ChangeEvent{Op: binary.ChangeOpUpdate, EntityID: "order-missing"}, nil},
+		{"webhook entity", "", binary.ChangeEvent{Op: binary.ChangeOpUpdate, EntityID: "webhook-all"}, nil},
+	}
+	for _, tt := range tests {
+		service.handleChange(tt.change)
+		var got []string
+		for len(service.queue) > 0 {
+			delivery := <-service.queue
+			if delivery.payload.EntityID != tt.change.EntityID || delivery.payload.Event != tt.event {
+				t.Errorf("%s: payload = %+v", tt.name, delivery.payload)
+			}
+			got = append(got, delivery.webhook.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: delivered to %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestWebhookRetry checks that a failed delivery is retried and that the
+// service gives up after MaxRetries
+func TestWebhookRetry(t *testing.T) {
+	var attempts, failures int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := atomic.AddInt32(&attempts, 1)
+		if r.URL.Path == "/down" || attempt <= atomic.LoadInt32(&failures) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	service := NewWebhookService(nil, nil, WebhookServiceConfig{Enabled: true, MaxRetries: 1})
+	delivery := func(id, path string) webhookDelivery {
+		return webhookDelivery{
+			webhook: Webhook{ID: id, URL: receiver.URL + path, Enabled: true},
+			payload: WebhookPayload{DeliveryID: id, Event: WebhookEventCreate},
+			body:    []byte(`{}`),
+		}
+	}
+
+	atomic.StoreInt32(&failures, 1)
+	service.deliver(delivery("webhook-flaky", "/flaky"))
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("flaky receiver got %d attempts, want 2", got)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	service.deliver(delivery("webhook-down", "/down"))
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("receiver that is down got %d attempts, want 2", got)
+	}
+
+	stats := service.GetStats()
+	if stats.Delivered != 1 || stats.Failed != 1 || stats.Retries != 2 {
+		t.Errorf("stats = %+v, want 1 delivered, 1 failed and 2 retries", stats)
+	}
+	if down := stats.ByWebhook["webhook-down"]; down.Failed != 1 || down.LastStatus != http.StatusServiceUnavailable || down.LastError == "" {
+		t.Errorf("stats of webhook-down = %+v", down)
+	}
+	if flaky := stats.ByWebhook["webhook-flaky"]; flaky.Delivered != 1 || flaky.LastStatus != http.StatusOK {
+		t.Errorf("stats of webhook-flaky = %+v", flaky)
+	}
+}
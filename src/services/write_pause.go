@@ -0,0 +1,25 @@
+package services
+
+// WritePause reports whether background writes are paused. The server mode
+// implements it: while the server is read-only, services skip the writes
+// they make on their own schedule or in reaction to other writes, so a
+// migration or restore sees no changes the API refused.
+type WritePause interface {
+	ReadOnly() bool
+}
+
+// writePauser is embedded by services whose background writes pause
+type writePauser struct {
+	pause WritePause
+}
+
+// SetWritePause makes the service skip its background writes while pause
+// reports the server read-only. Call it before Start.
+func (p *writePauser) SetWritePause(pause WritePause) {
+	p.pause = pause
+}
+
+// writesPaused reports whether background writes are currently paused
+func (p *writePauser) writesPaused() bool {
+	return p.pause != nil && p.pause.ReadOnly()
+}
@@ -0,0 +1,170 @@
+package binary
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"entitydb/models"
+)
+
+// AdjacencyIndex keeps the typed relationships declared by "rel:<type>:<id>"
+// tags as adjacency lists in both directions, so the neighbours of an entity
+// are found without scanning the tag index. Like the tag value index it is
+// fed by the tag index and tracks only current (untimed) tags; edges of
+// entities marked deleted stay indexed and are filtered by the repository.
+type AdjacencyIndex struct {
+	mu       sync.RWMutex
+	out      map[string]map[adjacentEdge]struct{} // source -> type and target
+	in       map[string]map[adjacentEdge]struct{} // target -> type and source
+	memBytes int64                                // approximate, guarded by mu
+}
+
+// adjacentEdge is an edge as seen from one end: its type and the other end
+type adjacentEdge struct {
+	relType string
+	peer    string
+}
+
+// NewAdjacencyIndex creates an empty adjacency index
+func NewAdjacencyIndex() *AdjacencyIndex {
+	return &AdjacencyIndex{
+		out: make(map[string]map[adjacentEdge]struct{}),
+		in:  make(map[string]map[adjacentEdge]struct{}),
+	}
+}
+
+// splitRelationshipTag parses an untimed relationship tag. Temporal index
+// keys are rejected so each edge is counted once.
+func splitRelationshipTag(tag string) (string, string, bool) {
+	if !strings.HasPrefix(tag, models.RelationshipTagPrefix) || strings.Contains(tag, "|") {
+		return "", "", false
+	}
+	return models.ParseRelationshipTag(tag)
+}
+
+// add records the edge declared by tag on entityID
+func (idx *AdjacencyIndex) add(tag, entityID string) {
+	relType, target, ok := splitRelationshipTag(tag)
+	if !ok {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.link(idx.out, entityID, adjacentEdge{relType, target})
+	idx.link(idx.in, target, adjacentEdge{relType, entityID})
+}
+
+// remove forgets the edge declared by tag on entityID
+func (idx *AdjacencyIndex) remove(tag, entityID string) {
+	relType, target, ok := splitRelationshipTag(tag)
+	if !ok {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.unlink(idx.out, entityID, adjacentEdge{relType, target})
+	idx.unlink(idx.in, target, adjacentEdge{relType, entityID})
+}
+
+func (idx *AdjacencyIndex) link(lists map[string]map[adjacentEdge]struct{}, id string, edge adjacentEdge) {
+	list := lists[id]
+	if list == nil {
+		list = make(map[adjacentEdge]struct{})
+		lists[id] = list
+		idx.memBytes += mapEntryBytes + stringBytes(id) + mapHeaderBytes
+	}
+	if _, exists := list[edge]; !exists {
+		list[edge] = struct{}{}
+		idx.memBytes += adjacentEdgeBytes(edge)
+	}
+}
+
+func (idx *AdjacencyIndex) unlink(lists map[string]map[adjacentEdge]struct{}, id string, edge adjacentEdge) {
+	list := lists[id]
+	if _, exists := list[edge]; !exists {
+		return
+	}
+	delete(list, edge)
+	idx.memBytes -= adjacentEdgeBytes(edge)
+	if len(list) == 0 {
+		delete(lists, id)
+		idx.memBytes -= mapEntryBytes + stringBytes(id) + mapHeaderBytes
+	}
+}
+
+// adjacentEdgeBytes approximates one entry of an adjacency list
+func adjacentEdgeBytes(edge adjacentEdge) int64 {
+	return mapEntryBytes + stringBytes(edge.relType) + stringBytes(edge.peer)
+}
+
+// MemoryBytes returns the approximate bytes held by the index
+func (idx *AdjacencyIndex) MemoryBytes() int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.memBytes
+}
+
+// Edges returns the edges of an entity in the given direction, optionally
+// restricted to one relationship type, ordered by type and peer
+func (idx *AdjacencyIndex) Edges(entityID string, direction models.EdgeDirection, relType string) []models.Edge {
+	idx.mu.RLock()
+	var edges []models.Edge
+	if direction != models.EdgeIncoming {
+		for edge := range idx.out[entityID] {
+			if relType == "" || edge.relType == relType {
+				edges = append(edges, models.Edge{Source: entityID, Target: edge.peer, Type: edge.relType})
+			}
+		}
+	}
+	if direction != models.EdgeOutgoing {
+		for edge := range idx.in[entityID] {
+			if relType == "" || edge.relType == relType {
+				edges = append(edges, models.Edge{Source: edge.peer, Target: entityID, Type: edge.relType})
+			}
+		}
+	}
+	idx.mu.RUnlock()
+
+	sortEdges(edges)
+	return edges
+}
+
+// sortEdges orders edges by type, then source, then target
+func sortEdges(edges []models.Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Type != edges[j].Type {
+			return edges[i].Type < edges[j].Type
+		}
+		if edges[i].Source != edges[j].Source {
+			return edges[i].Source < edges[j].Source
+		}
+		return edges[i].Target < edges[j].Target
+	})
+}
+
+// Edges returns the typed relationships of an entity declared with
+// "rel:<type>:<id>" tags. Outgoing edges are declared by the entity and
+// incoming ones by entities pointing at it; direction selects which are
+// returned and a non-empty relType restricts them to one type. Edges whose
+// source or target is marked deleted are skipped, and queued writes are
+// reflected.
+func (r *EntityRepository) Edges(entityID string, direction models.EdgeDirection, relType string) []models.Edge {
+	// Index rebuilds swap the tag index under the repository lock
+	r.mu.RLock()
+	tags := r.shardedTagIndex
+	r.mu.RUnlock()
+
+	edges := tags.edges.Edges(entityID, direction, relType)
+	if r.batchWriter != nil {
+		edges = r.batchWriter.overlay.applyToEdges(entityID, direction, relType, edges)
+	}
+
+	live := edges[:0]
+	for _, edge := range edges {
+		if !tags.IsDeleted(edge.Source) && !tags.IsDeleted(edge.Target) {
+			live = append(live, edge)
+		}
+	}
+	return live
+}
@@ -0,0 +1,44 @@
+package binary
+
+import (
+	"reflect"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestAdjacencyIndex checks that rel: tags fed through the tag index are
+// queryable from both ends and forgotten when removed
+func TestAdjacencyIndex(t *testing.T) {
+	tags := NewShardedTagIndex()
+	tags.AddTag("rel:depends_on:b", "a")
+	tags.AddTag("1700000000000000000|rel:depends_on:c", "a")
+	tags.AddTag("rel:owns:b", "c")
+	tags.AddTag("relates_to:b", "d")
+
+	out := tags.edges.Edges("a", models.EdgeOutgoing, "")
+	if want := []models.Edge{{Source: "a", Target: "b", Type: "depends_on"}}; !reflect.DeepEqual(out, want) {
+		t.Errorf("outgoing edges of a = %v, want %v", out, want)
+	}
+
+	in := tags.edges.Edges("b", models.EdgeIncoming, "")
+	want := []models.Edge{
+		{Source: "a", Target: "b", Type: "depends_on"},
+		{Source: "c", Target: "b", Type: "owns"},
+	}
+	if !reflect.DeepEqual(in, want) {
+		t.Errorf("incoming edges of b = %v, want %v", in, want)
+	}
+	if got := tags.edges.Edges("b", models.EdgeBoth, "owns"); len(got) != 1 || got[0].Source != "c" {
+		t.Errorf("owns edges of b = %v, want one from c", got)
+	}
+
+	tags.RemoveTag("rel:depends_on:b", "a")
+	tags.RemoveEntities(map[string]struct{}{"c": {}})
+	if got := tags.edges.Edges("b", models.EdgeBoth, ""); len(got) != 0 {
+		t.Errorf("edges of b after removal = %v, want none", got)
+	}
+	if got := tags.edges.MemoryBytes(); got != 0 {
+		t.Errorf("adjacency index bytes after removal = %d, want 0", got)
+	}
+}
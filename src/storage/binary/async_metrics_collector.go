@@ -186,8 +186,16 @@ func (amc *AsyncMetricsCollector) Start(ctx context.Context) error {
 
 // Stop stops the async metrics collection
 func (amc *AsyncMetricsCollector) Stop() error {
+	_, err := amc.Shutdown()
+	return err
+}
+
+// Shutdown stops the async metrics collection after the workers have
+// processed the queued metrics, and returns the number of aggregated metrics
+// persisted by the final flush
+func (amc *AsyncMetricsCollector) Shutdown() (int, error) {
 	if !atomic.CompareAndSwapInt32(&amc.running, 1, 0) {
-		return fmt.Errorf("metrics collector not running")
+		return 0, fmt.Errorf("metrics collector not running")
 	}
 	
 	logger.Info("Stopping async metrics collector")
@@ -196,13 +204,14 @@ func (amc *AsyncMetricsCollector) Stop() error {
 	amc.wg.Wait()
 	
 	// Flush remaining metrics
-	amc.flushAggregatedMetrics()
+	flushed := amc.flushAggregatedMetrics()
 	
-	logger.Info("Async metrics collector stopped. Processed: %d, Dropped: %d", 
+	logger.Info("Async metrics collector stopped. Processed: %d, Dropped: %d, Flushed: %d", 
 		atomic.LoadInt64(&amc.processedCount), 
-		atomic.LoadInt64(&amc.droppedCount))
+		atomic.LoadInt64(&amc.droppedCount),
+		flushed)
 	
-	return nil
+	return flushed, nil
 }
 
 // CollectMetric collects a metric point asynchronously
@@ -285,6 +294,15 @@ func (amc *AsyncMetricsCollector) worker(ctx context.Context, workerID int) {
 			
 		case <-amc.shutdownChan:
 			logger.Debug("Metrics worker %d stopping due to shutdown signal", workerID)
+			// Take the metrics still queued so the final flush persists them
+			for queued := true; queued; {
+				select {
+				case metric := <-amc.metricChan:
+					batch = append(batch, metric)
+				default:
+					queued = false
+				}
+			}
 			amc.processBatch(batch)
 			return
 			
@@ -348,8 +366,9 @@ func (amc *AsyncMetricsCollector) aggregationFlusher(ctx context.Context) {
 	}
 }
 
-// flushAggregatedMetrics persists aggregated metrics to storage
-func (amc *AsyncMetricsCollector) flushAggregatedMetrics() {
+// flushAggregatedMetrics persists aggregated metrics to storage and returns
+// the number persisted
+func (amc *AsyncMetricsCollector) flushAggregatedMetrics() int {
 	startTime := time.Now()
 	
 	amc.aggregateMu.Lock()
@@ -357,7 +376,7 @@ func (amc *AsyncMetricsCollector) flushAggregatedMetrics() {
 	amc.aggregateMu.Unlock()
 	
 	if len(metricsToFlush) == 0 {
-		return
+		return 0
 	}
 	
 	successCount := 0
@@ -373,6 +392,7 @@ func (amc *AsyncMetricsCollector) flushAggregatedMetrics() {
 	amc.metaMetrics.PersistenceLatency = flushDuration
 	
 	logger.Debug("Flushed %d/%d aggregated metrics in %v", successCount, len(metricsToFlush), flushDuration)
+	return successCount
 }
 
 // persistAggregatedMetric persists a single aggregated metric
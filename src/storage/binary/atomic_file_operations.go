@@ -282,7 +282,11 @@ func (afm *AtomicFileManager) createOperation(targetPath string, opType AtomicOp
 func (afm *AtomicFileManager) performWrite(op *AtomicOperation) error {
 	op.mu.Lock()
 	defer op.mu.Unlock()
-	
+	return afm.writeLocked(op)
+}
+
+// writeLocked writes op's data through a temporary file; op.mu must be held
+func (afm *AtomicFileManager) writeLocked(op *AtomicOperation) error {
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(op.TargetPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -343,7 +347,7 @@ func (afm *AtomicFileManager) performUpdate(op *AtomicOperation) error {
 	}
 	
 	// Perform write
-	if err := afm.performWrite(op); err != nil {
+	if err := afm.writeLocked(op); err != nil {
 		// Restore from backup if write failed
 		afm.restoreFromBackup(op)
 		return err
@@ -0,0 +1,354 @@
+package binary
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"entitydb/models"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupManifestSuffix is appended to a backup's path to name its manifest
+const backupManifestSuffix = ".manifest.json"
+
+// backupManifestVersion is the current manifest format
+const backupManifestVersion = 1
+
+// BackupManifest accompanies a backup so it can be proven untampered after
+// being copied between environments or stored offsite. It records the
+// checksum of the backup file and of every entity the backup restores to,
+// and optionally an Ed25519 signature over everything else in the manifest.
+type BackupManifest struct {
+	Version   int               `json:"version"`
+	Backup    string            `json:"backup"`
+	SizeBytes int64             `json:"size_bytes"`
+	SHA256    string            `json:"sha256"`
+	CreatedAt time.Time         `json:"created_at"`
+	Entities  map[string]string `json:"entities"`
+	PublicKey string            `json:"public_key,omitempty"`
+	Signature string            `json:"signature,omitempty"`
+}
+
+// BackupVerification is the outcome of checking a backup against its manifest
+type BackupVerification struct {
+	Verified         bool     `json:"verified"`
+	Manifest         bool     `json:"manifest"`
+	FileChecksum     bool     `json:"file_checksum"`
+	Signed           bool     `json:"signed"`
+	SignatureValid   bool     `json:"signature_valid"`
+	EntitiesChecked  int      `json:"entities_checked"`
+	Mismatched       int      `json:"mismatched"`
+	Missing          int      `json:"missing"`
+	Unexpected       int      `json:"unexpected"`
+	MismatchedSample []string `json:"mismatched_sample,omitempty"`
+	Problems         []string `json:"problems,omitempty"`
+}
+
+// BackupManifestPath returns the manifest path of a backup file
+func BackupManifestPath(backupPath string) string {
+	return backupPath + backupManifestSuffix
+}
+
+// isBackupManifest reports whether a file name belongs to a manifest
+func isBackupManifest(name string) bool {
+	return strings.HasSuffix(name, backupManifestSuffix)
+}
+
+// entityChecksum hashes the ID, tags and content of an entity. Tags are
+// sorted so the checksum does not depend on their storage order.
+func entityChecksum(entity *models.Entity) string {
+	hash := sha256.New()
+	field := func(data []byte) {
+		var length [8]byte
+		binary.LittleEndian.PutUint64(length[:], uint64(len(data)))
+		hash.Write(length[:])
+		hash.Write(data)
+	}
+
+	tags := append([]string(nil), entity.Tags...)
+	sort.Strings(tags)
+	field([]byte(entity.ID))
+	for _, tag := range tags {
+		field([]byte(tag))
+	}
+	field(entity.Content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// fileChecksum returns the SHA-256 and size of a file
+func fileChecksum(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// WriteBackupManifest restores a backup into scratchPath, records the
+// checksum of every restored entity and writes the manifest next to the
+// backup, signed when key is not nil
+func WriteBackupManifest(backupPath, scratchPath string, key ed25519.PrivateKey) (*BackupManifest, error) {
+	sum, size, err := fileChecksum(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("checksum %s: %w", filepath.Base(backupPath), err)
+	}
+	entities, _, err := restoreDatabaseCopy(backupPath, scratchPath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BackupManifest{
+		Version:   backupManifestVersion,
+		Backup:    filepath.Base(backupPath),
+		SizeBytes: size,
+		SHA256:    sum,
+		CreatedAt: time.Now().UTC(),
+		Entities:  make(map[string]string, len(entities)),
+	}
+	for id, entity := range entities {
+		manifest.Entities[id] = entityChecksum(entity)
+	}
+	if key != nil {
+		if err := manifest.Sign(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := manifest.write(backupPath); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// write stores the manifest next to its backup, replacing any previous one
+func (m *BackupManifest) write(backupPath string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := BackupManifestPath(backupPath)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return nil
+}
+
+// ReadBackupManifest reads the manifest of a backup file
+func ReadBackupManifest(backupPath string) (*BackupManifest, error) {
+	data, err := os.ReadFile(BackupManifestPath(backupPath))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BackupManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// signedContent returns the bytes covered by the signature: the manifest
+// encoded without its signature
+func (m *BackupManifest) signedContent() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// Sign signs the manifest with an Ed25519 private key
+func (m *BackupManifest) Sign(key ed25519.PrivateKey) error {
+	m.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	content, err := m.signedContent()
+	if err != nil {
+		return err
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, content))
+	return nil
+}
+
+// verifySignature checks the signature against trusted, or against the
+// embedded public key when no key is trusted
+func (m *BackupManifest) verifySignature(trusted ed25519.PublicKey) error {
+	key := trusted
+	if key == nil {
+		embedded, err := base64.StdEncoding.DecodeString(m.PublicKey)
+		if err != nil || len(embedded) != ed25519.PublicKeySize {
+			return fmt.Errorf("manifest public key is invalid")
+		}
+		key = embedded
+	}
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("manifest signature is not valid base64")
+	}
+	content, err := m.signedContent()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, content, signature) {
+		return fmt.Errorf("manifest signature does not match")
+	}
+	return nil
+}
+
+// VerifyBackup checks a backup file and the entities restored from it
+// against the backup's manifest. With a trusted key the manifest must carry
+// a valid signature by that key; without one a signature only proves the
+// manifest is intact, and a backup without a manifest is reported but not
+// treated as a problem.
+func VerifyBackup(backupPath string, entities map[string]*models.Entity, trusted ed25519.PublicKey) *BackupVerification {
+	result := &BackupVerification{}
+	problem := func(format string, args ...interface{}) {
+		result.Problems = append(result.Problems, fmt.Sprintf(format, args...))
+	}
+
+	manifest, err := ReadBackupManifest(backupPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			problem("cannot read manifest: %v", err)
+		} else if trusted != nil {
+			problem("backup has no manifest")
+		}
+		return result
+	}
+	result.Manifest = true
+
+	if sum, size, err := fileChecksum(backupPath); err != nil {
+		problem("cannot checksum backup: %v", err)
+	} else if sum != manifest.SHA256 || size != manifest.SizeBytes {
+		problem("backup file checksum does not match its manifest")
+	} else {
+		result.FileChecksum = true
+	}
+
+	result.Signed = manifest.Signature != ""
+	switch {
+	case result.Signed:
+		if err := manifest.verifySignature(trusted); err != nil {
+			problem("%v", err)
+		} else {
+			result.SignatureValid = true
+		}
+	case trusted != nil:
+		problem("manifest is not signed")
+	}
+
+	var mismatched []string
+	for id, sum := range manifest.Entities {
+		entity, ok := entities[id]
+		if !ok {
+			result.Missing++
+			continue
+		}
+		result.EntitiesChecked++
+		if entityChecksum(entity) != sum {
+			result.Mismatched++
+			mismatched = append(mismatched, id)
+		}
+	}
+	for id := range entities {
+		if _, ok := manifest.Entities[id]; !ok {
+			result.Unexpected++
+		}
+	}
+	sort.Strings(mismatched)
+	if len(mismatched) > standbySampleLimit {
+		mismatched = mismatched[:standbySampleLimit]
+	}
+	result.MismatchedSample = mismatched
+
+	if result.Mismatched > 0 {
+		problem("%d entities do not match their manifest checksum", result.Mismatched)
+	}
+	if result.Missing > 0 {
+		problem("%d entities in the manifest are missing from the backup", result.Missing)
+	}
+	if result.Unexpected > 0 {
+		problem("%d entities in the backup are not in the manifest", result.Unexpected)
+	}
+
+	result.Verified = len(result.Problems) == 0
+	return result
+}
+
+// LoadBackupSigningKey reads an Ed25519 private key, either PEM encoded
+// PKCS#8 or a base64 encoded seed or private key
+func LoadBackupSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		key, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an Ed25519 private key", path)
+		}
+		return key, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither PEM nor base64: %w", path, err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, fmt.Errorf("%s holds %d bytes, not an Ed25519 seed or private key", path, len(raw))
+}
+
+// LoadBackupVerifyKey reads an Ed25519 public key, either PEM encoded PKIX
+// or a base64 encoded key
+func LoadBackupVerifyKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an Ed25519 public key", path)
+		}
+		return key, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither PEM nor base64: %w", path, err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%s holds %d bytes, not an Ed25519 public key", path, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
@@ -0,0 +1,59 @@
+package binary
+
+import (
+	"crypto/ed25519"
+	"entitydb/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestBackupManifestVerification tests signature and checksum verification
+func TestBackupManifestVerification(t *testing.T) {
+	backup := filepath.Join(t.TempDir(), "entities.edb.backup.routine-1")
+	if err := os.WriteFile(backup, []byte("backup contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entities := map[string]*models.Entity{
+		"e1": {ID: "e1", Tags: []string{"1|type:a", "2|status:x"}, Content: []byte("one")},
+		"e2": {ID: "e2", Tags: []string{"1|type:b"}},
+	}
+
+	sum, size, _ := fileChecksum(backup)
+	manifest := &BackupManifest{Version: backupManifestVersion, SizeBytes: size, SHA256: sum, Entities: map[string]string{}}
+	for id, entity := range entities {
+		manifest.Entities[id] = entityChecksum(entity)
+	}
+	_, key, _ := ed25519.GenerateKey(nil)
+	if err := manifest.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.write(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	public := key.Public().(ed25519.PublicKey)
+	if result := VerifyBackup(backup, entities, public); !result.Verified || !result.SignatureValid {
+		t.Fatalf("Intact backup failed verification: %v", result.Problems)
+	}
+
+	// Tag order does not affect the checksum, content does
+	entities["e1"] = &models.Entity{ID: "e1", Tags: []string{"2|status:x", "1|type:a"}, Content: []byte("one")}
+	if result := VerifyBackup(backup, entities, public); !result.Verified {
+		t.Errorf("Reordered tags failed verification: %v", result.Problems)
+	}
+	entities["e1"] = &models.Entity{ID: "e1", Tags: []string{"1|type:a", "2|status:x"}, Content: []byte("uno")}
+	if result := VerifyBackup(backup, entities, public); result.Verified || result.Mismatched != 1 {
+		t.Errorf("Tampered entity passed verification: %+v", result)
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	if result := VerifyBackup(backup, entities, other); result.SignatureValid {
+		t.Error("Signature accepted for an untrusted key")
+	}
+
+	os.WriteFile(backup, []byte("backup c0ntents"), 0644)
+	if result := VerifyBackup(backup, entities, nil); result.FileChecksum {
+		t.Error("Modified backup file passed the checksum")
+	}
+}
@@ -28,7 +28,6 @@
 package binary
 
 import (
-	"hash"
 	"hash/fnv"
 	"math"
 	"sync"
@@ -36,12 +35,11 @@ import (
 
 // BloomFilter provides probabilistic existence testing with very fast lookups
 type BloomFilter struct {
-	bits     []uint64
-	k        uint // number of hash functions
-	m        uint // number of bits
-	n        uint // number of items
-	hashFunc hash.Hash64
-	mu       sync.RWMutex
+	bits []uint64
+	k    uint // number of hash functions
+	m    uint // number of bits
+	n    uint // number of items
+	mu   sync.RWMutex
 }
 
 // NewBloomFilter creates a new bloom filter with optimal parameters.
@@ -67,11 +65,10 @@ func NewBloomFilter(expectedItems uint, falsePositiveRate float64) *BloomFilter
 	m = (m + 63) / 64 * 64
 	
 	return &BloomFilter{
-		bits:     make([]uint64, m/64),
-		k:        k,
-		m:        m,
-		n:        0,
-		hashFunc: fnv.New64a(),
+		bits: make([]uint64, m/64),
+		k:    k,
+		m:    m,
+		n:    0,
 	}
 }
 
@@ -116,17 +113,25 @@ func (bf *BloomFilter) Contains(item string) bool {
 	return true
 }
 
-// getHashes generates k hash values for an item
+// Count returns the number of items added
+func (bf *BloomFilter) Count() uint {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+	return bf.n
+}
+
+// getHashes generates k hash values for an item. Each call hashes with its
+// own FNV state, since Contains runs concurrently under the read lock.
 func (bf *BloomFilter) getHashes(item string) []uint64 {
 	hashes := make([]uint64, bf.k)
 	
-	bf.hashFunc.Reset()
-	bf.hashFunc.Write([]byte(item))
-	h1 := bf.hashFunc.Sum64()
+	hashFunc := fnv.New64a()
+	hashFunc.Write([]byte(item))
+	h1 := hashFunc.Sum64()
 	
-	bf.hashFunc.Reset()
-	bf.hashFunc.Write([]byte(item + "salt"))
-	h2 := bf.hashFunc.Sum64()
+	hashFunc.Reset()
+	hashFunc.Write([]byte(item + "salt"))
+	h2 := hashFunc.Sum64()
 	
 	// Use double hashing to generate k hashes
 	for i := uint(0); i < bf.k; i++ {
@@ -138,6 +143,8 @@ func (bf *BloomFilter) getHashes(item string) []uint64 {
 
 // EstimateFalsePositiveRate estimates the current false positive rate
 func (bf *BloomFilter) EstimateFalsePositiveRate() float64 {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
 	return math.Pow(1-math.Exp(-float64(bf.k*bf.n)/float64(bf.m)), float64(bf.k))
 }
 
@@ -4,6 +4,7 @@ package binary
 import (
 	"container/list"
 	"entitydb/models"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,11 +14,22 @@ import (
 type cacheEntry struct {
 	entity      *models.Entity
 	size        int64
+	storedAt    int64
 	accessTime  int64
 	accessCount int64
 	listElement *list.Element
+	
+	// Dirty entries hold changes that only exist in the WAL; pinned entries
+	// were selected by an administrator. Both are kept out of the LRU list,
+	// so they are never evicted or expired.
+	dirty  bool
+	pinned bool
 }
 
+// pressureRecoveryDelay is how long after the last pressure cleanup the
+// configured limits are restored
+const pressureRecoveryDelay = 2 * time.Minute
+
 // BoundedEntityCache provides a size-limited entity cache with LRU eviction
 // and adaptive sizing based on memory pressure.
 type BoundedEntityCache struct {
@@ -31,6 +43,18 @@ type BoundedEntityCache struct {
 	memoryUsed  int64
 	memoryLimit int64
 	
+	// Configured limits, restored once memory pressure subsides
+	baseMaxSize     int
+	baseMemoryLimit int64
+	lastPressure    time.Time
+	
+	// Entries older than ttl are treated as missing (0 disables expiry)
+	ttl time.Duration
+	
+	// Entities pinned by ID, and tags that pin every entity carrying them
+	pins    map[string]struct{}
+	pinTags []string
+	
 	// Statistics
 	hits      int64
 	misses    int64
@@ -47,31 +71,53 @@ func NewBoundedEntityCache(maxSize int, memoryLimit int64) *BoundedEntityCache {
 	return &BoundedEntityCache{
 		entries:     make(map[string]*cacheEntry),
 		lru:         list.New(),
+		pins:        make(map[string]struct{}),
 		maxSize:     maxSize,
 		memoryLimit: memoryLimit,
 		lastResize:  time.Now(),
+		
+		baseMaxSize:     maxSize,
+		baseMemoryLimit: memoryLimit,
 	}
 }
 
+// SetTTL makes entries expire ttl after they were stored
+func (c *BoundedEntityCache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// expired reports whether an entry has outlived the TTL
+func (c *BoundedEntityCache) expired(entry *cacheEntry, now int64) bool {
+	return c.ttl > 0 && now-atomic.LoadInt64(&entry.storedAt) > int64(c.ttl)
+}
+
 // Get retrieves an entity from the cache
 func (c *BoundedEntityCache) Get(entityID string) (*models.Entity, bool) {
 	c.mu.RLock()
 	entry, ok := c.entries[entityID]
-	if !ok {
+	now := time.Now().UnixNano()
+	if !ok || (entry.listElement != nil && c.expired(entry, now)) {
 		c.mu.RUnlock()
 		atomic.AddInt64(&c.misses, 1)
+		if ok {
+			c.removeIfSame(entityID, entry)
+		}
 		return nil, false
 	}
 	
 	// Update access stats
-	atomic.StoreInt64(&entry.accessTime, time.Now().UnixNano())
+	atomic.StoreInt64(&entry.accessTime, now)
 	atomic.AddInt64(&entry.accessCount, 1)
 	atomic.AddInt64(&c.hits, 1)
 	
 	// Move to front of LRU (upgrade to write lock)
 	c.mu.RUnlock()
 	c.mu.Lock()
-	c.lru.MoveToFront(entry.listElement)
+	if entry.listElement != nil {
+		c.lru.MoveToFront(entry.listElement)
+	}
 	c.mu.Unlock()
 	
 	return entry.entity, true
@@ -85,7 +131,161 @@ func (c *BoundedEntityCache) Put(entityID string, entity *models.Entity) {
 	
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.put(entityID, entity)
+}
+
+// PutDirty adds or updates an entity whose latest state has not reached the
+// data file yet. The entry is kept until ClearDirty is called.
+func (c *BoundedEntityCache) PutDirty(entityID string, entity *models.Entity) {
+	if entity == nil {
+		return
+	}
+	
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.put(entityID, entity)
+	entry.dirty = true
+	c.relink(entityID, entry)
+}
+
+// IsDirty reports whether an entity holds changes not yet in the data file
+func (c *BoundedEntityCache) IsDirty(entityID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[entityID]
+	return ok && entry.dirty
+}
+
+// ClearDirty unpins all dirty entries once their changes are persisted,
+// making them evictable again
+func (c *BoundedEntityCache) ClearDirty() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	for entityID, entry := range c.entries {
+		if entry.dirty {
+			entry.dirty = false
+			c.relink(entityID, entry)
+		}
+	}
+	c.evictIfNeeded(0)
+}
+
+// SetPinTags pins every entity carrying one of the given tags
+func (c *BoundedEntityCache) SetPinTags(tags []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	c.pinTags = append([]string(nil), tags...)
+	for entityID, entry := range c.entries {
+		entry.pinned = c.shouldPin(entityID, entry.entity)
+		c.relink(entityID, entry)
+	}
+	c.evictIfNeeded(0)
+}
+
+// Pin keeps an entity cached until Unpin is called. The pin applies as soon
+// as the entity is stored if it is not cached yet.
+func (c *BoundedEntityCache) Pin(entityID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	c.pins[entityID] = struct{}{}
+	if entry, ok := c.entries[entityID]; ok {
+		entry.pinned = true
+		c.relink(entityID, entry)
+	}
+}
+
+// Unpin removes a pin set by Pin. Entities carrying a pin tag stay pinned.
+func (c *BoundedEntityCache) Unpin(entityID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	delete(c.pins, entityID)
+	if entry, ok := c.entries[entityID]; ok {
+		entry.pinned = c.shouldPin(entityID, entry.entity)
+		c.relink(entityID, entry)
+	}
+}
+
+// PinnedStats describes the pinned part of the cache
+type PinnedStats struct {
+	// Entities currently held in memory by a pin
+	Entities   int   `json:"entities"`
+	MemoryUsed int64 `json:"memory_used"`
+	// Entities pinned by ID, cached or not
+	PinnedIDs []string `json:"pinned_ids"`
+	PinTags   []string `json:"pin_tags"`
+}
+
+// PinnedStats returns the size of the pinned set
+func (c *BoundedEntityCache) PinnedStats() PinnedStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	
+	stats := PinnedStats{
+		PinnedIDs: make([]string, 0, len(c.pins)),
+		PinTags:   append([]string{}, c.pinTags...),
+	}
+	for entityID := range c.pins {
+		stats.PinnedIDs = append(stats.PinnedIDs, entityID)
+	}
+	for _, entry := range c.entries {
+		if entry.pinned {
+			stats.Entities++
+			stats.MemoryUsed += entry.size
+		}
+	}
+	return stats
+}
+
+// shouldPin reports whether an entity is pinned by ID or by tag. Tags are
+// matched without building the entity's tag caches, which are not safe for
+// concurrent use. Callers hold c.mu.
+func (c *BoundedEntityCache) shouldPin(entityID string, entity *models.Entity) bool {
+	if _, ok := c.pins[entityID]; ok {
+		return true
+	}
+	if len(c.pinTags) == 0 || entity == nil {
+		return false
+	}
+	for _, tag := range entity.Tags {
+		if pipe := strings.LastIndex(tag, "|"); pipe >= 0 {
+			tag = tag[pipe+1:]
+		}
+		for _, pinTag := range c.pinTags {
+			if tag == pinTag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// relink keeps an entry in the LRU list only while it may be evicted.
+// Callers hold c.mu.
+func (c *BoundedEntityCache) relink(entityID string, entry *cacheEntry) {
+	held := entry.dirty || entry.pinned
+	switch {
+	case held && entry.listElement != nil:
+		c.lru.Remove(entry.listElement)
+		entry.listElement = nil
+	case !held && entry.listElement == nil:
+		entry.listElement = c.lru.PushFront(entityID)
+	}
+}
+
+// unlink removes an entry from the LRU list if it is in it. Callers hold c.mu.
+func (c *BoundedEntityCache) unlink(entry *cacheEntry) {
+	if entry.listElement != nil {
+		c.lru.Remove(entry.listElement)
+		entry.listElement = nil
+	}
+}
+
+// put stores an entity and returns its entry. Callers hold c.mu.
+func (c *BoundedEntityCache) put(entityID string, entity *models.Entity) *cacheEntry {
 	// Calculate entity size
 	entitySize := c.calculateEntitySize(entity)
 	
@@ -95,33 +295,53 @@ func (c *BoundedEntityCache) Put(entityID string, entity *models.Entity) {
 		oldSize := entry.size
 		entry.entity = entity
 		entry.size = entitySize
-		entry.accessTime = time.Now().UnixNano()
+		atomic.StoreInt64(&entry.storedAt, time.Now().UnixNano())
+		atomic.StoreInt64(&entry.accessTime, time.Now().UnixNano())
 		atomic.AddInt64(&entry.accessCount, 1)
 		
 		// Update memory tracking
 		atomic.AddInt64(&c.memoryUsed, entitySize-oldSize)
 		
+		// Tags may have gained or lost a pin tag
+		entry.pinned = c.shouldPin(entityID, entity)
+		c.relink(entityID, entry)
+		
 		// Move to front
-		c.lru.MoveToFront(entry.listElement)
-		return
+		if entry.listElement != nil {
+			c.lru.MoveToFront(entry.listElement)
+		}
+		return entry
 	}
 	
 	// Check if we need to evict
+	c.restoreLimitsIfRecovered()
 	c.evictIfNeeded(entitySize)
 	
 	// Create new entry
+	now := time.Now().UnixNano()
 	entry := &cacheEntry{
 		entity:      entity,
 		size:        entitySize,
-		accessTime:  time.Now().UnixNano(),
+		storedAt:    now,
+		accessTime:  now,
 		accessCount: 1,
+		pinned:      c.shouldPin(entityID, entity),
 	}
 	
 	// Add to LRU and map
-	entry.listElement = c.lru.PushFront(entityID)
+	c.relink(entityID, entry)
 	c.entries[entityID] = entry
 	c.currentSize++
 	atomic.AddInt64(&c.memoryUsed, entitySize)
+	return entry
+}
+
+// Contains reports whether an entity is cached without affecting LRU order
+func (c *BoundedEntityCache) Contains(entityID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.entries[entityID]
+	return ok
 }
 
 // Delete removes an entity from the cache
@@ -131,7 +351,7 @@ func (c *BoundedEntityCache) Delete(entityID string) {
 	
 	if entry, ok := c.entries[entityID]; ok {
 		delete(c.entries, entityID)
-		c.lru.Remove(entry.listElement)
+		c.unlink(entry)
 		c.currentSize--
 		atomic.AddInt64(&c.memoryUsed, -entry.size)
 		
@@ -141,8 +361,47 @@ func (c *BoundedEntityCache) Delete(entityID string) {
 	}
 }
 
-// evictIfNeeded removes least recently used entries if limits are exceeded
+// removeIfSame removes an entry unless it was replaced since it was read
+func (c *BoundedEntityCache) removeIfSame(entityID string, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, ok := c.entries[entityID]; ok && current == entry {
+		delete(c.entries, entityID)
+		c.unlink(entry)
+		c.currentSize--
+		atomic.AddInt64(&c.memoryUsed, -entry.size)
+	}
+}
+
+// RemoveExpired drops every entry that has outlived the TTL and returns the
+// number removed
+func (c *BoundedEntityCache) RemoveExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return 0
+	}
+	now := time.Now().UnixNano()
+	removed := 0
+	for entityID, entry := range c.entries {
+		if entry.listElement != nil && c.expired(entry, now) {
+			delete(c.entries, entityID)
+			c.unlink(entry)
+			c.currentSize--
+			atomic.AddInt64(&c.memoryUsed, -entry.size)
+			removed++
+		}
+	}
+	return removed
+}
+
+// evictIfNeeded removes least recently used entries if limits are exceeded.
+// Dirty and pinned entries are not in the LRU list, so they still count
+// towards the limits but are never evicted.
 func (c *BoundedEntityCache) evictIfNeeded(newSize int64) {
+	// Frequently accessed entries get one reprieve per pass; once every entry
+	// has had one, the least recently used is evicted regardless
+	reprieves := c.lru.Len()
 	for (c.currentSize >= c.maxSize || atomic.LoadInt64(&c.memoryUsed)+newSize > c.memoryLimit) && c.lru.Len() > 0 {
 		elem := c.lru.Back()
 		if elem == nil {
@@ -152,8 +411,9 @@ func (c *BoundedEntityCache) evictIfNeeded(newSize int64) {
 		entityID := elem.Value.(string)
 		if entry, ok := c.entries[entityID]; ok {
 			// Don't evict frequently accessed items
-			if atomic.LoadInt64(&entry.accessCount) > 100 {
+			if reprieves > 0 && atomic.LoadInt64(&entry.accessCount) > 100 {
 				// Move to middle instead of evicting
+				reprieves--
 				c.lru.MoveAfter(elem, c.lru.Front())
 				continue
 			}
@@ -219,14 +479,14 @@ func (c *BoundedEntityCache) Clear() {
 
 // Stats returns cache statistics
 type CacheStats struct {
-	Size        int
-	MemoryUsed  int64
-	Hits        int64
-	Misses      int64
-	Evictions   int64
-	HitRate     float64
-	MaxSize     int
-	MemoryLimit int64
+	Size        int     `json:"size"`
+	MemoryUsed  int64   `json:"memory_used"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	Evictions   int64   `json:"evictions"`
+	HitRate     float64 `json:"hit_rate"`
+	MaxSize     int     `json:"max_size"`
+	MemoryLimit int64   `json:"memory_limit"`
 }
 
 func (c *BoundedEntityCache) Stats() CacheStats {
@@ -258,6 +518,7 @@ func (c *BoundedEntityCache) SetMaxSize(size int) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.maxSize = size
+	c.baseMaxSize = size
 }
 
 // SetMemoryLimit updates the memory limit
@@ -265,6 +526,7 @@ func (c *BoundedEntityCache) SetMemoryLimit(limit int64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.memoryLimit = limit
+	c.baseMemoryLimit = limit
 }
 
 // SetEvictionCallback sets a callback for when entities are evicted
@@ -274,10 +536,22 @@ func (c *BoundedEntityCache) SetEvictionCallback(fn func(entityID string, entity
 	c.evictionFunc = fn
 }
 
+// restoreLimitsIfRecovered restores the configured limits once no pressure
+// cleanup has been needed for pressureRecoveryDelay. Callers hold c.mu.
+func (c *BoundedEntityCache) restoreLimitsIfRecovered() {
+	if c.lastPressure.IsZero() || time.Since(c.lastPressure) < pressureRecoveryDelay {
+		return
+	}
+	c.maxSize = c.baseMaxSize
+	c.memoryLimit = c.baseMemoryLimit
+	c.lastPressure = time.Time{}
+}
+
 // TriggerPressureCleanup performs aggressive cache cleanup under memory pressure
 func (c *BoundedEntityCache) TriggerPressureCleanup(pressure float64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.lastPressure = time.Now()
 	
 	// Calculate how much to evict based on pressure
 	targetEviction := int(float64(c.currentSize) * pressure * 0.4) // Evict up to 40% of entries under high pressure
@@ -312,15 +586,16 @@ func (c *BoundedEntityCache) TriggerPressureCleanup(pressure float64) {
 	
 	// If pressure is critical, also reduce max size temporarily
 	if pressure > 0.9 {
+		// The minimums never raise the limits above their configured values
 		c.maxSize = int(float64(c.maxSize) * 0.7) // Reduce by 30%
-		if c.maxSize < 100 {
-			c.maxSize = 100 // Minimum cache size
+		if minSize := min(100, c.baseMaxSize); c.maxSize < minSize {
+			c.maxSize = minSize // Minimum cache size
 		}
 		
 		// Also reduce memory limit temporarily
 		c.memoryLimit = int64(float64(c.memoryLimit) * 0.7)
-		if c.memoryLimit < 10*1024*1024 {
-			c.memoryLimit = 10 * 1024 * 1024 // Minimum 10MB
+		if minLimit := min(10*1024*1024, c.baseMemoryLimit); c.memoryLimit < minLimit {
+			c.memoryLimit = minLimit // Minimum 10MB
 		}
 	}
 }
\ No newline at end of file
@@ -1,10 +1,13 @@
 package binary
 
 import (
+	"context"
 	"entitydb/logger"
 	"entitydb/models"
+	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,39 +15,39 @@ import (
 type CachedRepository struct {
 	models.EntityRepository
 	
-	// Entity cache with TTL
-	entityCache     *sync.Map // map[string]*cachedEntity
+	// Bounded LRU entity cache with TTL
+	entityCache     *BoundedEntityCache
 	tagCache        *sync.Map // map[string]*cachedTagResult
 	cacheTTL        time.Duration
 	
-	// Performance metrics
-	cacheHits   uint64
-	cacheMisses uint64
+	// Performance metrics, counted by concurrent readers
+	cacheHits   atomic.Uint64
+	cacheMisses atomic.Uint64
 	
 	// Background cleaner
 	cleanupTicker *time.Ticker
 	done          chan bool
 }
 
-type cachedEntity struct {
-	entity    *models.Entity
-	timestamp time.Time
-}
-
 type cachedTagResult struct {
 	entities  []*models.Entity
 	timestamp time.Time
 }
 
-// NewCachedRepository wraps a repository with caching
-func NewCachedRepository(baseRepo models.EntityRepository, ttl time.Duration) *CachedRepository {
+// NewCachedRepository wraps a repository with caching. The entity cache holds
+// at most maxEntries entities and memoryLimit bytes, evicting the least
+// recently used.
+func NewCachedRepository(baseRepo models.EntityRepository, ttl time.Duration, maxEntries int, memoryLimit int64) *CachedRepository {
 	if ttl == 0 {
 		ttl = 5 * time.Minute // Default 5 minute TTL
 	}
 	
+	entityCache := NewBoundedEntityCache(maxEntries, memoryLimit)
+	entityCache.SetTTL(ttl)
+	
 	repo := &CachedRepository{
 		EntityRepository: baseRepo,
-		entityCache:     &sync.Map{},
+		entityCache:     entityCache,
 		tagCache:        &sync.Map{},
 		cacheTTL:        ttl,
 		cleanupTicker:   time.NewTicker(ttl / 2),
@@ -54,24 +57,20 @@ func NewCachedRepository(baseRepo models.EntityRepository, ttl time.Duration) *C
 	// Start background cleanup
 	go repo.cleanupExpired()
 	
-	logger.Info("Created CachedRepository with TTL: %v", ttl)
+	logger.Info("Created CachedRepository with TTL: %v, max entities: %d, memory limit: %d MB",
+		ttl, maxEntries, memoryLimit/(1024*1024))
 	return repo
 }
 
 // GetByID with caching
 func (r *CachedRepository) GetByID(id string) (*models.Entity, error) {
 	// Check cache first
-	if cached, ok := r.entityCache.Load(id); ok {
-		ce := cached.(*cachedEntity)
-		if time.Since(ce.timestamp) < r.cacheTTL {
-			r.cacheHits++
-			return ce.entity, nil
-		}
-		// Expired, remove it
-		r.entityCache.Delete(id)
+	if entity, ok := r.entityCache.Get(id); ok {
+		r.cacheHits.Add(1)
+		return entity, nil
 	}
 	
-	r.cacheMisses++
+	r.cacheMisses.Add(1)
 	
 	// Get from underlying repository
 	entity, err := r.EntityRepository.GetByID(id)
@@ -80,10 +79,7 @@ func (r *CachedRepository) GetByID(id string) (*models.Entity, error) {
 	}
 	
 	// Cache the result
-	r.entityCache.Store(id, &cachedEntity{
-		entity:    entity,
-		timestamp: time.Now(),
-	})
+	r.entityCache.Put(id, entity)
 	
 	return entity, nil
 }
@@ -96,10 +92,7 @@ func (r *CachedRepository) Create(entity *models.Entity) error {
 	}
 	
 	// Add to cache
-	r.entityCache.Store(entity.ID, &cachedEntity{
-		entity:    entity,
-		timestamp: time.Now(),
-	})
+	r.entityCache.Put(entity.ID, entity)
 	
 	// Invalidate tag caches that might be affected
 	r.invalidateTagCaches(entity.Tags)
@@ -118,10 +111,7 @@ func (r *CachedRepository) Update(entity *models.Entity) error {
 	}
 	
 	// Update cache
-	r.entityCache.Store(entity.ID, &cachedEntity{
-		entity:    entity,
-		timestamp: time.Now(),
-	})
+	r.entityCache.Put(entity.ID, entity)
 	
 	// Invalidate affected tag caches
 	if oldEntity != nil {
@@ -132,6 +122,74 @@ func (r *CachedRepository) Update(entity *models.Entity) error {
 	return nil
 }
 
+// UpdateIfVersion performs a conditional update and invalidates caches
+func (r *CachedRepository) UpdateIfVersion(entity *models.Entity, expectedVersion uint64) error {
+	repo, ok := r.EntityRepository.(*EntityRepository)
+	if !ok {
+		return fmt.Errorf("underlying repository does not support conditional updates")
+	}
+	
+	oldEntity, _ := repo.GetByID(entity.ID)
+	
+	if err := repo.UpdateIfVersion(entity, expectedVersion); err != nil {
+		return err
+	}
+	
+	r.entityCache.Put(entity.ID, entity)
+	
+	if oldEntity != nil {
+		r.invalidateTagCaches(oldEntity.Tags)
+	}
+	r.invalidateTagCaches(entity.Tags)
+	
+	return nil
+}
+
+// Upsert creates or updates an entity by key tag and invalidates caches
+func (r *CachedRepository) Upsert(keyTag string, apply UpsertFunc) (*models.Entity, bool, error) {
+	repo, ok := r.EntityRepository.(*EntityRepository)
+	if !ok {
+		return nil, false, fmt.Errorf("underlying repository does not support upserts")
+	}
+
+	var oldTags []string
+	entity, created, err := repo.Upsert(keyTag, func(existing *models.Entity) (*models.Entity, error) {
+		if existing != nil {
+			oldTags = existing.Tags
+		}
+		return apply(existing)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.entityCache.Put(entity.ID, entity)
+	r.invalidateTagCaches(oldTags)
+	r.invalidateTagCaches(entity.Tags)
+
+	return entity, created, nil
+}
+
+// AddTag adds a tag and drops the entity from the cache
+func (r *CachedRepository) AddTag(id string, tag string) error {
+	if err := r.EntityRepository.AddTag(id, tag); err != nil {
+		return err
+	}
+	r.entityCache.Delete(id)
+	r.invalidateTagCaches([]string{tag})
+	return nil
+}
+
+// RemoveTag removes a tag and drops the entity from the cache
+func (r *CachedRepository) RemoveTag(id string, tag string) error {
+	if err := r.EntityRepository.RemoveTag(id, tag); err != nil {
+		return err
+	}
+	r.entityCache.Delete(id)
+	r.invalidateTagCaches([]string{tag})
+	return nil
+}
+
 // Delete invalidates caches
 func (r *CachedRepository) Delete(id string) error {
 	// Get entity to know which tags to invalidate
@@ -162,14 +220,14 @@ func (r *CachedRepository) ListByTags(tags []string, matchAll bool) ([]*models.E
 	if cached, ok := r.tagCache.Load(cacheKey); ok {
 		cr := cached.(*cachedTagResult)
 		if time.Since(cr.timestamp) < r.cacheTTL {
-			r.cacheHits++
+			r.cacheHits.Add(1)
 			return cr.entities, nil
 		}
 		// Expired
 		r.tagCache.Delete(cacheKey)
 	}
 	
-	r.cacheMisses++
+	r.cacheMisses.Add(1)
 	
 	// Get from underlying repository
 	entities, err := r.EntityRepository.ListByTags(tags, matchAll)
@@ -192,27 +250,59 @@ func (r *CachedRepository) ListByTag(tag string) ([]*models.Entity, error) {
 	return r.EntityRepository.ListByTag(tag)
 }
 
+// ListByTagContext lists entities with a tag, stopping once ctx is cancelled
+func (r *CachedRepository) ListByTagContext(ctx context.Context, tag string) ([]*models.Entity, error) {
+	if base, ok := r.EntityRepository.(CancellableRepository); ok {
+		return base.ListByTagContext(ctx, tag)
+	}
+	return r.EntityRepository.ListByTag(tag)
+}
+
+// SearchContentContext searches entity content, stopping once ctx is
+// cancelled
+func (r *CachedRepository) SearchContentContext(ctx context.Context, searchText string) ([]*models.Entity, error) {
+	if base, ok := r.EntityRepository.(CancellableRepository); ok {
+		return base.SearchContentContext(ctx, searchText)
+	}
+	return r.EntityRepository.SearchContent(searchText)
+}
+
 // List with caching
 func (r *CachedRepository) List() ([]*models.Entity, error) {
+	return r.ListContext(context.Background())
+}
+
+// ListContext lists all entities with caching, stopping once ctx is
+// cancelled. A cancelled listing is not cached.
+func (r *CachedRepository) ListContext(ctx context.Context) ([]*models.Entity, error) {
 	// Check if we have it cached
 	cacheKey := "_all_entities_"
 	
 	if cached, ok := r.tagCache.Load(cacheKey); ok {
 		cr := cached.(*cachedTagResult)
 		if time.Since(cr.timestamp) < r.cacheTTL {
-			r.cacheHits++
+			r.cacheHits.Add(1)
 			return cr.entities, nil
 		}
 		r.tagCache.Delete(cacheKey)
 	}
 	
-	r.cacheMisses++
+	r.cacheMisses.Add(1)
 	
 	// Get from underlying repository
-	entities, err := r.EntityRepository.List()
+	var entities []*models.Entity
+	var err error
+	if base, ok := r.EntityRepository.(CancellableRepository); ok {
+		entities, err = base.ListContext(ctx)
+	} else {
+		entities, err = r.EntityRepository.List()
+	}
 	if err != nil {
 		return nil, err
 	}
+	if skipsContent(ctx) {
+		return entities, nil
+	}
 	
 	// Cache the result
 	r.tagCache.Store(cacheKey, &cachedTagResult{
@@ -222,10 +312,7 @@ func (r *CachedRepository) List() ([]*models.Entity, error) {
 	
 	// Also populate entity cache while we have the data
 	for _, entity := range entities {
-		r.entityCache.Store(entity.ID, &cachedEntity{
-			entity:    entity,
-			timestamp: time.Now(),
-		})
+		r.entityCache.Put(entity.ID, entity)
 	}
 	
 	return entities, nil
@@ -263,13 +350,7 @@ func (r *CachedRepository) cleanupExpired() {
 			now := time.Now()
 			
 			// Clean entity cache
-			r.entityCache.Range(func(key, value interface{}) bool {
-				ce := value.(*cachedEntity)
-				if now.Sub(ce.timestamp) > r.cacheTTL {
-					r.entityCache.Delete(key)
-				}
-				return true
-			})
+			r.entityCache.RemoveExpired()
 			
 			// Clean tag cache
 			r.tagCache.Range(func(key, value interface{}) bool {
@@ -288,7 +369,12 @@ func (r *CachedRepository) cleanupExpired() {
 
 // GetCacheStats returns cache performance metrics
 func (r *CachedRepository) GetCacheStats() (hits, misses uint64) {
-	return r.cacheHits, r.cacheMisses
+	return r.cacheHits.Load(), r.cacheMisses.Load()
+}
+
+// EntityCacheStats returns the size, memory use and evictions of the entity cache
+func (r *CachedRepository) EntityCacheStats() CacheStats {
+	return r.entityCache.Stats()
 }
 
 // Close stops the background cleanup
@@ -305,6 +391,8 @@ func (r *CachedRepository) GetUnderlying() models.EntityRepository {
 
 // TriggerCachePressureCleanup performs cache cleanup under memory pressure
 func (r *CachedRepository) TriggerCachePressureCleanup(pressure float64) {
+	r.entityCache.TriggerPressureCleanup(pressure)
+	
 	// Clean tag cache based on pressure level
 	if pressure > 0.7 {
 		// Count current cache entries
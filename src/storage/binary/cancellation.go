@@ -0,0 +1,21 @@
+package binary
+
+import (
+	"context"
+	"entitydb/models"
+)
+
+// CancellableRepository is implemented by repositories whose long reads stop
+// when their context is cancelled or its deadline passes, so a scan is not
+// finished for a client that has gone away. A stopped read returns the
+// context's error.
+type CancellableRepository interface {
+	ListContext(ctx context.Context) ([]*models.Entity, error)
+	ListByTagContext(ctx context.Context, tag string) ([]*models.Entity, error)
+	SearchContentContext(ctx context.Context, searchText string) ([]*models.Entity, error)
+}
+
+var (
+	_ CancellableRepository = (*EntityRepository)(nil)
+	_ CancellableRepository = (*CachedRepository)(nil)
+)
@@ -0,0 +1,102 @@
+package binary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestCancelledReads checks that list, tag and content reads return the
+// context's error once it is cancelled or its deadline has passed
+func TestCancelledReads(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	for i := 0; i < 20; i++ {
+		entity := &models.Entity{
+			ID:      fmt.Sprintf("cancel-%02d", i),
+			Tags:    []string{"type:document", "dataset:default"},
+			Content: []byte(fmt.Sprintf("report %d", i)),
+		}
+		if err := repo.Create(entity); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	if entities, err := repo.ListByTagContext(context.Background(), "type:document"); err != nil || len(entities) != 20 {
+		t.Fatalf("ListByTagContext = %d entities, %v, want 20", len(entities), err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	for _, tc := range []struct {
+		ctx  context.Context
+		want error
+	}{
+		{cancelled, context.Canceled},
+		{expired, context.DeadlineExceeded},
+	} {
+		if _, err := repo.ListContext(tc.ctx); !errors.Is(err, tc.want) {
+			t.Errorf("ListContext error = %v, want %v", err, tc.want)
+		}
+		if _, err := repo.ListByTagContext(tc.ctx, "type:document"); !errors.Is(err, tc.want) {
+			t.Errorf("ListByTagContext error = %v, want %v", err, tc.want)
+		}
+		if _, err := repo.SearchContentContext(tc.ctx, "report"); !errors.Is(err, tc.want) {
+			t.Errorf("SearchContentContext error = %v, want %v", err, tc.want)
+		}
+	}
+
+	// A cancelled read leaves no partial result in the tag cache
+	repo.cache.Clear()
+	if _, err := repo.ListByTagContext(cancelled, "type:document"); err == nil {
+		t.Fatal("ListByTagContext succeeded with a cancelled context")
+	}
+	if entities, err := repo.ListByTag("type:document"); err != nil || len(entities) != 20 {
+		t.Errorf("ListByTag after a cancelled read = %d entities, %v, want 20", len(entities), err)
+	}
+}
+
+// TestFetchEntitiesCancelled checks that the concurrent disk reads of a
+// large fetch stop with the context's error
+func TestFetchEntitiesCancelled(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	ids := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("fetch-%02d", i)
+		if err := repo.Create(&models.Entity{ID: id, Tags: []string{"type:document"}}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	flushWrites(t, repo)
+	if err := repo.writerManager.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	repo.readerPool.Invalidate()
+	repo.entityCache.Clear()
+
+	reader, err := repo.readerPool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.readerPool.Put(reader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := repo.fetchEntitiesWithReader(ctx, reader, ids); !errors.Is(err, context.Canceled) {
+		t.Errorf("fetchEntitiesWithReader error = %v, want %v", err, context.Canceled)
+	}
+	if entities, err := repo.fetchEntitiesWithReader(context.Background(), reader, ids); err != nil || len(entities) != 20 {
+		t.Errorf("fetchEntitiesWithReader = %d entities, %v, want 20", len(entities), err)
+	}
+}
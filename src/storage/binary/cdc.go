@@ -0,0 +1,455 @@
+package binary
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Change data capture publishes every committed WAL operation to a message
+// broker. Operations are appended to a durable outbox as they are logged and
+// removed once the broker acknowledges them, so delivery is at-least-once:
+// after a crash or a broker outage unacknowledged operations are sent again.
+// Consumers deduplicate by sequence number.
+const (
+	cdcOutboxFile  = "outbox.jsonl"
+	cdcStateFile   = "outbox.state"
+	cdcMinBackoff  = time.Second
+	cdcMaxBackoff  = 30 * time.Second
+	cdcIdleRecheck = time.Second
+)
+
+// CDCRecord is one committed WAL operation
+type CDCRecord struct {
+	Sequence  uint64         `json:"sequence"`
+	Op        string         `json:"op"` // create, update or delete
+	EntityID  string         `json:"entity_id"`
+	Timestamp int64          `json:"timestamp"` // WAL time in nanoseconds
+	Entity    *models.Entity `json:"entity,omitempty"`
+}
+
+// CDCSink publishes records to a message broker
+type CDCSink interface {
+	Name() string
+	// Publish returns once the broker has accepted every record. On error
+	// the whole batch is sent again.
+	Publish(ctx context.Context, records []CDCRecord) error
+	Close() error
+}
+
+// CDCStats reports the publisher's progress
+type CDCStats struct {
+	Sink          string    `json:"sink"`
+	Directory     string    `json:"directory"`
+	LastSequence  uint64    `json:"last_sequence"`  // last operation written to the outbox
+	AckedSequence uint64    `json:"acked_sequence"` // last operation the broker acknowledged
+	Pending       uint64    `json:"pending"`
+	OutboxBytes   int64     `json:"outbox_bytes"`
+	Published     uint64    `json:"published"` // since startup
+	Failures      uint64    `json:"failures"`
+	LastPublished time.Time `json:"last_published,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// cdcState is the acknowledged position in the outbox
+type cdcState struct {
+	AckedSequence uint64 `json:"acked_sequence"`
+	AckedOffset   int64  `json:"acked_offset"`
+	LastTimestamp int64  `json:"last_timestamp"`
+}
+
+// CDCPublisher keeps the outbox and sends it to a sink in batches
+type CDCPublisher struct {
+	dir       string
+	batchSize int
+
+	mu            sync.Mutex
+	file          *os.File
+	size          int64
+	lastSequence  uint64
+	lastTimestamp int64 // WAL time of the last operation in the outbox
+	state         cdcState
+	sink          CDCSink
+
+	published     uint64
+	failures      uint64
+	lastPublished time.Time
+	lastError     string
+
+	notify chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewCDCPublisherFromConfig creates the publisher configured by cfg. It
+// returns nil when change data capture is disabled.
+func NewCDCPublisherFromConfig(cfg *config.Config) (*CDCPublisher, error) {
+	if cfg.CDCSink == "" {
+		return nil, nil
+	}
+	return NewCDCPublisher(cfg.CDCOutboxFullPath(), cfg.CDCBatchSize)
+}
+
+// NewCDCPublisher opens the outbox in dir. A line torn by a crash is
+// discarded; the WAL replay appends the operation again.
+func NewCDCPublisher(dir string, batchSize int) (*CDCPublisher, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create CDC outbox directory: %w", err)
+	}
+	p := &CDCPublisher{dir: dir, batchSize: batchSize, notify: make(chan struct{}, 1)}
+
+	if err := p.readState(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, cdcOutboxFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CDC outbox: %w", err)
+	}
+	p.file = file
+	if err := p.recoverOutbox(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *CDCPublisher) readState() error {
+	data, err := os.ReadFile(filepath.Join(p.dir, cdcStateFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read CDC outbox state: %w", err)
+	}
+	if err := json.Unmarshal(data, &p.state); err != nil {
+		return fmt.Errorf("invalid CDC outbox state file: %w", err)
+	}
+	return nil
+}
+
+func (p *CDCPublisher) writeState() error {
+	data, err := json.Marshal(p.state)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(p.dir, cdcStateFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// recoverOutbox finds the last operation in the outbox and truncates a torn
+// final line
+func (p *CDCPublisher) recoverOutbox() error {
+	info, err := p.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat CDC outbox: %w", err)
+	}
+	p.size = info.Size()
+	// The outbox is truncated after everything is acknowledged; a crash
+	// between truncating and saving the state leaves an offset past the end
+	if p.state.AckedOffset > p.size {
+		p.state.AckedOffset = 0
+	}
+	p.lastSequence = p.state.AckedSequence
+	p.lastTimestamp = p.state.LastTimestamp
+
+	valid := p.state.AckedOffset
+	err = p.scan(p.state.AckedOffset, p.size, 0, func(record CDCRecord, end int64) {
+		p.lastSequence = record.Sequence
+		p.lastTimestamp = record.Timestamp
+		valid = end
+	})
+	if err != nil {
+		return err
+	}
+	if valid < p.size {
+		logger.Warn("Discarding %d bytes of incomplete CDC outbox data", p.size-valid)
+		if err := p.file.Truncate(valid); err != nil {
+			return fmt.Errorf("failed to truncate CDC outbox: %w", err)
+		}
+		p.size = valid
+	}
+	return nil
+}
+
+// scan calls fn for each complete record between from and to, stopping
+// after limit records when limit is positive
+func (p *CDCPublisher) scan(from, to int64, limit int, fn func(record CDCRecord, end int64)) error {
+	reader := bufio.NewReader(io.NewSectionReader(p.file, from, to-from))
+	offset := from
+	for count := 0; limit <= 0 || count < limit; count++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil // a partial line is not a record
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CDC outbox: %w", err)
+		}
+		var record CDCRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil
+		}
+		offset += int64(len(line))
+		fn(record, offset)
+	}
+	return nil
+}
+
+// Append writes a logged WAL operation to the outbox. Checkpoints are not
+// published.
+func (p *CDCPublisher) Append(entry WALEntry) error {
+	if p == nil {
+		return nil
+	}
+	record := CDCRecord{
+		EntityID:  entry.EntityID,
+		Timestamp: entry.Timestamp.UnixNano(),
+	}
+	switch entry.OpType {
+	case WALOpCreate:
+		record.Op, record.Entity = ChangeOpCreate, entry.Entity
+	case WALOpUpdate:
+		record.Op, record.Entity = ChangeOpUpdate, entry.Entity
+	case WALOpDelete:
+		record.Op = ChangeOpDelete
+	default:
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	record.Sequence = p.lastSequence + 1
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode CDC record: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := p.file.WriteAt(line, p.size); err != nil {
+		return fmt.Errorf("failed to write CDC outbox: %w", err)
+	}
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync CDC outbox: %w", err)
+	}
+	p.size += int64(len(line))
+	p.lastSequence = record.Sequence
+	p.lastTimestamp = record.Timestamp
+
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// recover appends a replayed WAL entry the outbox has not seen yet, for
+// operations logged just before a crash
+func (p *CDCPublisher) recover(entry WALEntry) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	seen := entry.Timestamp.UnixNano() <= p.lastTimestamp
+	p.mu.Unlock()
+	if seen {
+		return
+	}
+	if err := p.Append(entry); err != nil {
+		logger.Error("Failed to add replayed WAL entry for %s to the CDC outbox: %v", entry.EntityID, err)
+	}
+}
+
+// Start begins publishing the outbox to sink
+func (p *CDCPublisher) Start(sink CDCSink) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sink != nil {
+		return fmt.Errorf("CDC publisher already started")
+	}
+	p.sink = sink
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.run()
+	return nil
+}
+
+func (p *CDCPublisher) run() {
+	defer close(p.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-p.stop
+		cancel()
+	}()
+
+	backoff := cdcMinBackoff
+	for {
+		records, end, err := p.nextBatch()
+		if err == nil && len(records) == 0 {
+			select {
+			case <-p.notify:
+			case <-time.After(cdcIdleRecheck):
+			case <-p.stop:
+				return
+			}
+			continue
+		}
+		if err == nil {
+			err = p.sink.Publish(ctx, records)
+		}
+		if err == nil {
+			err = p.ack(records[len(records)-1], end, len(records))
+		}
+		if err == nil {
+			backoff = cdcMinBackoff
+			continue
+		}
+
+		p.recordFailure(err)
+		select {
+		case <-time.After(backoff):
+		case <-p.stop:
+			return
+		}
+		if backoff *= 2; backoff > cdcMaxBackoff {
+			backoff = cdcMaxBackoff
+		}
+	}
+}
+
+// nextBatch reads up to batchSize unacknowledged records and the outbox
+// offset just past them
+func (p *CDCPublisher) nextBatch() ([]CDCRecord, int64, error) {
+	p.mu.Lock()
+	from, to := p.state.AckedOffset, p.size
+	p.mu.Unlock()
+
+	// Appends only extend the outbox and only this goroutine truncates it,
+	// so the range can be read without the lock
+	records := make([]CDCRecord, 0, p.batchSize)
+	end := from
+	err := p.scan(from, to, p.batchSize, func(record CDCRecord, offset int64) {
+		records = append(records, record)
+		end = offset
+	})
+	return records, end, err
+}
+
+// ack records that the broker accepted everything up to last. Once the
+// whole outbox is acknowledged it is emptied.
+func (p *CDCPublisher) ack(last CDCRecord, end int64, count int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state = cdcState{AckedSequence: last.Sequence, AckedOffset: end, LastTimestamp: last.Timestamp}
+	if err := p.writeState(); err != nil {
+		return fmt.Errorf("failed to save CDC outbox state: %w", err)
+	}
+	if end == p.size {
+		if err := p.file.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate CDC outbox: %w", err)
+		}
+		p.size = 0
+		p.state.AckedOffset = 0
+		if err := p.writeState(); err != nil {
+			return fmt.Errorf("failed to save CDC outbox state: %w", err)
+		}
+	}
+	p.published += uint64(count)
+	p.lastPublished = time.Now()
+	p.lastError = ""
+	return nil
+}
+
+func (p *CDCPublisher) recordFailure(err error) {
+	p.mu.Lock()
+	p.failures++
+	p.lastError = err.Error()
+	sink := ""
+	if p.sink != nil {
+		sink = p.sink.Name()
+	}
+	p.mu.Unlock()
+	logger.Warn("Failed to publish change data capture batch to %s: %v", sink, err)
+}
+
+// Stats reports the publisher's progress
+func (p *CDCPublisher) Stats() CDCStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := CDCStats{
+		Directory:     p.dir,
+		LastSequence:  p.lastSequence,
+		AckedSequence: p.state.AckedSequence,
+		Pending:       p.lastSequence - p.state.AckedSequence,
+		OutboxBytes:   p.size,
+		Published:     p.published,
+		Failures:      p.failures,
+		LastPublished: p.lastPublished,
+		LastError:     p.lastError,
+	}
+	if p.sink != nil {
+		stats.Sink = p.sink.Name()
+	}
+	return stats
+}
+
+// Close stops publishing and closes the sink and the outbox. Operations
+// not yet acknowledged stay in the outbox for the next run.
+func (p *CDCPublisher) Close() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	sink, stop, done := p.sink, p.stop, p.done
+	p.sink = nil
+	p.mu.Unlock()
+	if sink != nil {
+		close(stop)
+		<-done
+		if err := sink.Close(); err != nil {
+			logger.Warn("Failed to close CDC sink %s: %v", sink.Name(), err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.file.Close()
+}
+
+// SetCDC makes the WAL publish each logged operation through a CDC publisher
+func (w *WAL) SetCDC(publisher *CDCPublisher) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cdc = publisher
+}
+
+// StartCDC begins publishing committed operations to sink
+func (r *EntityRepository) StartCDC(sink CDCSink) error {
+	if r.wal == nil || r.wal.cdc == nil {
+		return fmt.Errorf("change data capture is not configured")
+	}
+	return r.wal.cdc.Start(sink)
+}
+
+// GetCDCStats reports change data capture progress; ok is false when it is
+// disabled
+func (r *EntityRepository) GetCDCStats() (stats CDCStats, ok bool) {
+	if r.wal == nil || r.wal.cdc == nil {
+		return CDCStats{}, false
+	}
+	return r.wal.cdc.Stats(), true
+}
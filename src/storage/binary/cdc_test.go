@@ -0,0 +1,187 @@
+package binary
+
+import (
+	"context"
+	"entitydb/config"
+	"entitydb/models"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeCDCSink struct {
+	mu      sync.Mutex
+	records []CDCRecord
+	fail    int // batches to reject before accepting
+}
+
+func (s *fakeCDCSink) Name() string { return "fake" }
+
+func (s *fakeCDCSink) Publish(ctx context.Context, records []CDCRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail > 0 {
+		s.fail--
+		return fmt.Errorf("broker unavailable")
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func (s *fakeCDCSink) Close() error { return nil }
+
+func (s *fakeCDCSink) sequences() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sequences := make([]uint64, len(s.records))
+	for i, record := range s.records {
+		sequences[i] = record.Sequence
+	}
+	return sequences
+}
+
+func cdcEntry(op WALOpType, id string, at time.Time) WALEntry {
+	entry := WALEntry{OpType: op, EntityID: id, Timestamp: at}
+	if op != WALOpDelete {
+		entry.Entity = &models.Entity{ID: id, Tags: []string{"type:test"}}
+	}
+	return entry
+}
+
+func TestCDCPublisherDeliversInOrder(t *testing.T) {
+	dir := t.TempDir()
+	publisher, err := NewCDCPublisher(dir, 2)
+	if err != nil {
+		t.Fatalf("create publisher: %v", err)
+	}
+	now := time.Now()
+	publisher.Append(cdcEntry(WALOpCreate, "a", now))
+	publisher.Append(cdcEntry(WALOpUpdate, "a", now.Add(time.Millisecond)))
+	publisher.Append(cdcEntry(WALOpCheckpoint, "", now.Add(2*time.Millisecond)))
+	publisher.Append(cdcEntry(WALOpDelete, "a", now.Add(3*time.Millisecond)))
+
+	sink := &fakeCDCSink{}
+	if err := publisher.Start(sink); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for publisher.Stats().Pending > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	publisher.Close()
+
+	if got := sink.sequences(); fmt.Sprint(got) != "[1 2 3]" {
+		t.Fatalf("published sequences %v, want [1 2 3]", got)
+	}
+	if sink.records[2].Op != ChangeOpDelete || sink.records[2].Entity != nil {
+		t.Errorf("delete record = %+v", sink.records[2])
+	}
+	if info, err := os.Stat(filepath.Join(dir, cdcOutboxFile)); err != nil || info.Size() != 0 {
+		t.Errorf("outbox not emptied after acknowledgement")
+	}
+
+	// Sequences continue across restarts
+	publisher, err = NewCDCPublisher(dir, 2)
+	if err != nil {
+		t.Fatalf("reopen publisher: %v", err)
+	}
+	defer publisher.Close()
+	publisher.Append(cdcEntry(WALOpCreate, "b", now.Add(4*time.Millisecond)))
+	if stats := publisher.Stats(); stats.LastSequence != 4 || stats.AckedSequence != 3 {
+		t.Errorf("last=%d acked=%d after restart, want 4 and 3", stats.LastSequence, stats.AckedSequence)
+	}
+}
+
+func TestCDCPublisherKeepsUnacknowledgedOperations(t *testing.T) {
+	dir := t.TempDir()
+	publisher, err := NewCDCPublisher(dir, 10)
+	if err != nil {
+		t.Fatalf("create publisher: %v", err)
+	}
+	now := time.Now()
+	publisher.Append(cdcEntry(WALOpCreate, "a", now))
+	publisher.Append(cdcEntry(WALOpCreate, "b", now.Add(time.Millisecond)))
+	publisher.Close()
+
+	// Simulate a crash in the middle of an append
+	outbox, err := os.OpenFile(filepath.Join(dir, cdcOutboxFile), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open outbox: %v", err)
+	}
+	outbox.WriteString(`{"sequence":3,"op":"cre`)
+	outbox.Close()
+
+	publisher, err = NewCDCPublisher(dir, 10)
+	if err != nil {
+		t.Fatalf("reopen publisher: %v", err)
+	}
+	// Replay skips operations already in the outbox
+	publisher.recover(cdcEntry(WALOpCreate, "b", now.Add(time.Millisecond)))
+	publisher.recover(cdcEntry(WALOpCreate, "c", now.Add(2*time.Millisecond)))
+
+	sink := &fakeCDCSink{fail: 1}
+	publisher.Start(sink)
+	deadline := time.Now().Add(5 * time.Second)
+	for publisher.Stats().Pending > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := publisher.Stats()
+	publisher.Close()
+
+	if got := sink.sequences(); fmt.Sprint(got) != "[1 2 3]" {
+		t.Fatalf("published sequences %v, want [1 2 3]", got)
+	}
+	if sink.records[2].EntityID != "c" {
+		t.Errorf("sequence 3 is %s, want the replayed operation on c", sink.records[2].EntityID)
+	}
+	if stats.Failures != 1 {
+		t.Errorf("failures = %d, want 1", stats.Failures)
+	}
+}
+
+func TestRepositoryPublishesCommittedOperations(t *testing.T) {
+	repo := newTestRepository(t, func(cfg *config.Config) {
+		cfg.CDCSink = "fake"
+	})
+	defer repo.Close()
+
+	entity := models.NewEntity()
+	entity.AddTag("type:test")
+	if err := repo.Create(entity); err != nil {
+		t.Fatalf("create entity: %v", err)
+	}
+	// Batched creates reach the WAL when the batch is flushed
+	if _, err := repo.FlushPendingWrites(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if err := repo.Delete(entity.ID); err != nil {
+		t.Fatalf("delete entity: %v", err)
+	}
+
+	sink := &fakeCDCSink{}
+	if err := repo.StartCDC(sink); err != nil {
+		t.Fatalf("start CDC: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if stats, _ := repo.GetCDCStats(); stats.LastSequence > 0 && stats.Pending == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	ops := []string{}
+	for _, record := range sink.records {
+		if record.EntityID == entity.ID {
+			ops = append(ops, record.Op)
+		}
+	}
+	if fmt.Sprint(ops) != "[create delete]" {
+		t.Errorf("published operations %v, want [create delete]", ops)
+	}
+}
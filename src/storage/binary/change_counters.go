@@ -0,0 +1,271 @@
+package binary
+
+import (
+	"context"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// changeCounterReserve is how far ahead of the latest counter the persisted
+// high-water mark is kept, so the mark is rewritten at most about once per
+// reserve under steady load
+const changeCounterReserve = uint64(time.Minute)
+
+// ChangeCounters tracks monotonically increasing change counters per entity
+// and per dataset so clients can detect changes with a single comparison.
+//
+// Counters are drawn from one shared sequence that never falls behind the
+// wall clock, so a counter is never lower than the UpdatedAt timestamp
+// reported for entities that have not changed since startup. With a
+// high-water mark file the sequence resumes above every value handed out
+// before a restart, even when the clock has gone backwards.
+type ChangeCounters struct {
+	seq      uint64
+	seed     uint64
+	mu       sync.RWMutex
+	entities map[string]uint64
+	datasets map[string]uint64
+
+	// path holds the persisted high-water mark; counters created without
+	// one are kept in memory only
+	path      string
+	reserveMu sync.Mutex
+	reserved  uint64
+
+	// updateLocks serialize updates per entity so a version check and the
+	// write it guards cannot interleave with another update
+	updateLocks [64]sync.Mutex
+}
+
+// ErrVersionConflict is returned when a conditional update names a version
+// the entity has already moved past
+var ErrVersionConflict = errors.New("entity version conflict")
+
+// NewChangeCounters creates in-memory change counters seeded from the
+// current time
+func NewChangeCounters() *ChangeCounters {
+	return newChangeCounters(uint64(time.Now().UnixNano()))
+}
+
+// OpenChangeCounters creates change counters whose high-water mark is
+// persisted at path. They are seeded from the current time or the mark,
+// whichever is later.
+func OpenChangeCounters(path string) (*ChangeCounters, error) {
+	seed := uint64(time.Now().UnixNano())
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		mark, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid change counter file %s: %w", path, err)
+		}
+		if mark > seed {
+			seed = mark
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read change counter file: %w", err)
+	}
+
+	cc := newChangeCounters(seed)
+	cc.path = path
+	if err := cc.reserve(seed); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+func newChangeCounters(seed uint64) *ChangeCounters {
+	return &ChangeCounters{
+		seq:      seed,
+		seed:     seed,
+		entities: make(map[string]uint64),
+		datasets: make(map[string]uint64),
+	}
+}
+
+// Record bumps the counters for an entity and its dataset and returns the new value
+func (cc *ChangeCounters) Record(entityID, dataset string) uint64 {
+	value := cc.next()
+
+	cc.mu.Lock()
+	cc.entities[entityID] = value
+	if dataset != "" {
+		cc.datasets[dataset] = value
+	}
+	cc.mu.Unlock()
+
+	return value
+}
+
+// Remove bumps the counter of a deleted entity's dataset and forgets the
+// entity. It returns the counter value of the deletion.
+func (cc *ChangeCounters) Remove(entityID, dataset string) uint64 {
+	value := cc.next()
+
+	cc.mu.Lock()
+	delete(cc.entities, entityID)
+	if dataset != "" {
+		cc.datasets[dataset] = value
+	}
+	cc.mu.Unlock()
+
+	return value
+}
+
+// next returns the next counter value: one more than the last, or the
+// current time if the clock is ahead of the sequence
+func (cc *ChangeCounters) next() uint64 {
+	for {
+		current := atomic.LoadUint64(&cc.seq)
+		value := current + 1
+		if now := uint64(time.Now().UnixNano()); now > value {
+			value = now
+		}
+		if atomic.CompareAndSwapUint64(&cc.seq, current, value) {
+			if cc.path != "" && value > atomic.LoadUint64(&cc.reserved) {
+				if err := cc.reserve(value); err != nil {
+					logger.Error("Failed to persist change counter high-water mark: %v", err)
+				}
+			}
+			return value
+		}
+	}
+}
+
+// reserve persists a high-water mark above value, so counters issued up to
+// the mark are never issued again after a restart
+func (cc *ChangeCounters) reserve(value uint64) error {
+	cc.reserveMu.Lock()
+	defer cc.reserveMu.Unlock()
+	if value <= atomic.LoadUint64(&cc.reserved) {
+		return nil
+	}
+
+	mark := value + changeCounterReserve
+	tmp := cc.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(mark, 10)), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, cc.path); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&cc.reserved, mark)
+	return nil
+}
+
+// Entity returns the counter for an entity, if it changed since startup
+func (cc *ChangeCounters) Entity(entityID string) (uint64, bool) {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	value, ok := cc.entities[entityID]
+	return value, ok
+}
+
+// Dataset returns the counter for a dataset. Datasets without changes since
+// startup report the startup seed.
+func (cc *ChangeCounters) Dataset(dataset string) uint64 {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	if value, ok := cc.datasets[dataset]; ok {
+		return value
+	}
+	return cc.seed
+}
+
+// Current returns the most recent counter value across all entities
+func (cc *ChangeCounters) Current() uint64 {
+	return atomic.LoadUint64(&cc.seq)
+}
+
+// lockEntity acquires the update lock for an entity and returns its release
+func (cc *ChangeCounters) lockEntity(entityID string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(entityID))
+	lock := &cc.updateLocks[h.Sum32()%uint32(len(cc.updateLocks))]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// recordChange bumps the change counters for an entity and its dataset and
+// publishes the change to change feed subscribers. Deletions pass the
+// entity's last tags and drop the entity's counter.
+func (r *EntityRepository) recordChange(op, entityID, dataset string, tags []string) {
+	if r.changeCounters == nil {
+		return
+	}
+	var version uint64
+	if op == ChangeOpDelete {
+		version = r.changeCounters.Remove(entityID, dataset)
+	} else {
+		version = r.changeCounters.Record(entityID, dataset)
+	}
+	r.publishChange(op, entityID, dataset, version, tags)
+}
+
+// GetEntityChangeCounter returns the change counter for an entity. Entities
+// untouched since startup report their last update timestamp, which is always
+// lower than any counter issued since.
+func (r *EntityRepository) GetEntityChangeCounter(entity *models.Entity) uint64 {
+	if r.changeCounters != nil {
+		if value, ok := r.changeCounters.Entity(entity.ID); ok {
+			return value
+		}
+	}
+	if entity.UpdatedAt > 0 {
+		return uint64(entity.UpdatedAt)
+	}
+	return uint64(entity.CreatedAt)
+}
+
+// UpdateIfVersion updates an entity only if its change counter still equals
+// expectedVersion. The check, the write and the counter bump happen under the
+// entity's update lock, so of two writers holding the same version exactly one
+// succeeds and the other gets ErrVersionConflict.
+func (r *EntityRepository) UpdateIfVersion(entity *models.Entity, expectedVersion uint64) error {
+	if r.changeCounters == nil {
+		return fmt.Errorf("change counters not initialized")
+	}
+	unlock := r.changeCounters.lockEntity(entity.ID)
+	defer unlock()
+
+	// A create still queued by the batch writer is not readable yet
+	if r.useBatchWrites && r.batchWriter != nil {
+		if err := r.batchWriter.Flush(); err != nil {
+			return fmt.Errorf("failed to flush pending writes: %w", err)
+		}
+	}
+
+	existing, err := r.GetByID(entity.ID)
+	if err != nil {
+		return fmt.Errorf("entity not found: %w", err)
+	}
+	if current := r.GetEntityChangeCounter(existing); current != expectedVersion {
+		return fmt.Errorf("%w: expected version %d, current version %d", ErrVersionConflict, expectedVersion, current)
+	}
+	return r.update(context.Background(), entity)
+}
+
+// GetDatasetChangeCounter returns the change counter for a dataset
+func (r *EntityRepository) GetDatasetChangeCounter(dataset string) uint64 {
+	if r.changeCounters == nil {
+		return 0
+	}
+	return r.changeCounters.Dataset(dataset)
+}
+
+// GetChangeCounter returns the most recent change counter across the repository
+func (r *EntityRepository) GetChangeCounter() uint64 {
+	if r.changeCounters == nil {
+		return 0
+	}
+	return r.changeCounters.Current()
+}
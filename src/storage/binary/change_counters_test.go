@@ -0,0 +1,158 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestChangeCountersHighWaterMark checks that counters resume above the
+// persisted high-water mark, also when the clock is behind it
+func TestChangeCountersHighWaterMark(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entities.edb.counter")
+
+	// A mark an hour ahead stands for a clock that has gone backwards
+	ahead := uint64(time.Now().Add(time.Hour).UnixNano())
+	if err := os.WriteFile(path, []byte(strconv.FormatUint(ahead, 10)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	counters, err := OpenChangeCounters(path)
+	if err != nil {
+		t.Fatalf("OpenChangeCounters: %v", err)
+	}
+	first := counters.Record("doc-1", "default")
+	second := counters.Record("doc-1", "default")
+	if first <= ahead || second <= first {
+		t.Fatalf("counters %d, %d after a mark of %d", first, second, ahead)
+	}
+
+	reopened, err := OpenChangeCounters(path)
+	if err != nil {
+		t.Fatalf("OpenChangeCounters: %v", err)
+	}
+	if got := reopened.Record("doc-1", "default"); got <= second {
+		t.Errorf("counter after reopening = %d, want above %d", got, second)
+	}
+	if got := reopened.Dataset("other"); got <= second {
+		t.Errorf("seed of an unchanged dataset after reopening = %d, want above %d", got, second)
+	}
+
+	if err := os.WriteFile(path, []byte("soon"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenChangeCounters(path); err == nil {
+		t.Error("OpenChangeCounters accepted an invalid mark")
+	}
+}
+
+// TestChangeCountersDelete checks that deleting an entity drops its counter,
+// bumps its dataset's counter, and that counters keep increasing across a
+// restart of the repository
+func TestChangeCountersDelete(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	cfg := repo.config
+
+	if err := repo.Create(&models.Entity{ID: "doc-1", Tags: []string{"type:document", "dataset:notes"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	created, ok := repo.changeCounters.Entity("doc-1")
+	if !ok {
+		t.Fatal("created entity has no counter")
+	}
+
+	if err := repo.Delete("doc-1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if value, ok := repo.changeCounters.Entity("doc-1"); ok {
+		t.Errorf("deleted entity still has counter %d", value)
+	}
+	deleted := repo.GetDatasetChangeCounter("notes")
+	if deleted <= created {
+		t.Errorf("dataset counter after the delete = %d, want above %d", deleted, created)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	repo, err := NewEntityRepositoryWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer repo.Close()
+	if err := repo.Create(&models.Entity{ID: "doc-2", Tags: []string{"type:document", "dataset:notes"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	if got := repo.GetDatasetChangeCounter("notes"); got <= deleted {
+		t.Errorf("dataset counter after reopening = %d, want above %d", got, deleted)
+	}
+}
+
+// TestUpdateIfVersionConcurrent checks that of many writers holding the same
+// version exactly one update succeeds and the others conflict
+func TestUpdateIfVersionConcurrent(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	if err := repo.Create(&models.Entity{ID: "doc-1", Tags: []string{"type:document"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	entity, err := repo.GetByID("doc-1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	version := repo.GetEntityChangeCounter(entity)
+
+	const writers = 16
+	errs := make([]error, writers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			update := &models.Entity{ID: "doc-1", Tags: []string{"type:document", fmt.Sprintf("writer:%d", i)}}
+			errs[i] = repo.UpdateIfVersion(update, version)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if winner >= 0 {
+				t.Fatalf("writers %d and %d both updated version %d", winner, i, version)
+			}
+			winner = i
+		case !errors.Is(err, ErrVersionConflict):
+			t.Errorf("writer %d: %v, want ErrVersionConflict", i, err)
+		}
+	}
+	if winner < 0 {
+		t.Fatal("no writer updated the entity")
+	}
+
+	flushWrites(t, repo)
+	stored, err := repo.GetByID("doc-1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !stored.HasTag(fmt.Sprintf("writer:%d", winner)) {
+		t.Errorf("stored tags %v lack the winning writer %d", stored.GetTagsWithoutTimestamp(), winner)
+	}
+	if current := repo.GetEntityChangeCounter(stored); current <= version {
+		t.Errorf("version after the update = %d, want above %d", current, version)
+	}
+}
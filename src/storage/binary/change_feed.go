@@ -0,0 +1,120 @@
+package binary
+
+import (
+	"sync"
+	"time"
+)
+
+// Change operations published on the change feed
+const (
+	ChangeOpCreate = "create"
+	ChangeOpUpdate = "update"
+	ChangeOpDelete = "delete"
+	ChangeOpTag    = "tag"
+)
+
+// defaultChangeFeedBuffer is used when a subscriber asks for no buffer
+const defaultChangeFeedBuffer = 256
+
+// ChangeEvent describes one committed entity change
+type ChangeEvent struct {
+	Op        string `json:"op"`
+	EntityID  string `json:"entity_id"`
+	Dataset   string `json:"dataset,omitempty"`
+	Version   uint64 `json:"version"`
+	Timestamp int64  `json:"timestamp"`
+	
+	// Tags holds the current tags of a deleted entity, which can no longer
+	// be read; it is empty for other operations
+	Tags []string `json:"-"`
+}
+
+// ChangeFeed fans committed changes out to subscribers. Publishing never
+// blocks writers: a subscriber whose buffer is full is dropped and its
+// channel closed, so it can tell it fell behind and resubscribe.
+type ChangeFeed struct {
+	mu          sync.RWMutex
+	nextID      uint64
+	subscribers map[uint64]chan ChangeEvent
+}
+
+// NewChangeFeed creates an empty change feed
+func NewChangeFeed() *ChangeFeed {
+	return &ChangeFeed{subscribers: make(map[uint64]chan ChangeEvent)}
+}
+
+// Subscribe registers a subscriber and returns its channel and a cancel
+// function that must be called once the subscriber stops reading
+func (f *ChangeFeed) Subscribe(buffer int) (<-chan ChangeEvent, func()) {
+	if buffer <= 0 {
+		buffer = defaultChangeFeedBuffer
+	}
+	ch := make(chan ChangeEvent, buffer)
+
+	f.mu.Lock()
+	id := f.nextID
+	f.nextID++
+	f.subscribers[id] = ch
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() { f.drop(id) })
+	}
+}
+
+// Publish delivers an event to every subscriber without blocking
+func (f *ChangeFeed) Publish(event ChangeEvent) {
+	f.mu.RLock()
+	var lagging []uint64
+	for id, ch := range f.subscribers {
+		select {
+		case ch <- event:
+		default:
+			lagging = append(lagging, id)
+		}
+	}
+	f.mu.RUnlock()
+
+	for _, id := range lagging {
+		f.drop(id)
+	}
+}
+
+// Subscribers returns the number of active subscribers
+func (f *ChangeFeed) Subscribers() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.subscribers)
+}
+
+// drop removes a subscriber and closes its channel
+func (f *ChangeFeed) drop(id uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ch, ok := f.subscribers[id]; ok {
+		delete(f.subscribers, id)
+		close(ch)
+	}
+}
+
+// SubscribeChanges streams committed entity changes. The channel is closed
+// when the subscriber falls more than buffer events behind.
+func (r *EntityRepository) SubscribeChanges(buffer int) (<-chan ChangeEvent, func()) {
+	return r.changeFeed.Subscribe(buffer)
+}
+
+// publishChange sends a change to change feed subscribers
+func (r *EntityRepository) publishChange(op, entityID, dataset string, version uint64, tags []string) {
+	if r.changeFeed == nil {
+		return
+	}
+	r.changeFeed.Publish(ChangeEvent{
+		Op:        op,
+		EntityID:  entityID,
+		Dataset:   dataset,
+		Version:   version,
+		Timestamp: time.Now().UnixNano(),
+		Tags:      tags,
+	})
+}
@@ -0,0 +1,115 @@
+package binary
+
+import (
+	"entitydb/models"
+	"fmt"
+	"io"
+)
+
+// chunkResult is the outcome of one chunk fetch
+type chunkResult struct {
+	content []byte
+	err     error
+}
+
+// ChunkReadAhead reads the chunks of a chunked entity in order while fetching
+// the next chunks concurrently. Fetches are only started as chunks are
+// consumed, so a slow client holds at most window chunks in memory and stops
+// further reads until it catches up.
+//
+// A ChunkReadAhead is not safe for concurrent use.
+type ChunkReadAhead struct {
+	fetch    func(id string) (*models.Entity, error)
+	chunkIDs []string
+	window   int
+
+	// Index of the next chunk returned by Next
+	next int
+	// Fetches in flight or completed but not consumed, keyed by chunk index
+	pending map[int]chan chunkResult
+}
+
+// NewChunkReadAhead creates a reader over chunkIDs that keeps up to window
+// chunks in flight ahead of the consumer. A window of 0 fetches one chunk at
+// a time when it is requested.
+func NewChunkReadAhead(fetch func(id string) (*models.Entity, error), chunkIDs []string, window int) *ChunkReadAhead {
+	if window < 0 {
+		window = 0
+	}
+	return &ChunkReadAhead{
+		fetch:    fetch,
+		chunkIDs: chunkIDs,
+		window:   window,
+		pending:  make(map[int]chan chunkResult),
+	}
+}
+
+// ReadChunksAhead returns a read-ahead reader over chunkIDs using the
+// configured read-ahead window
+func (r *EntityRepository) ReadChunksAhead(chunkIDs []string) *ChunkReadAhead {
+	window := 0
+	if r.config != nil {
+		window = r.config.ChunkReadAhead
+	}
+	return NewChunkReadAhead(r.GetByID, chunkIDs, window)
+}
+
+// Next returns the content of the next chunk, or io.EOF after the last one
+func (c *ChunkReadAhead) Next() ([]byte, error) {
+	if c.next >= len(c.chunkIDs) {
+		return nil, io.EOF
+	}
+
+	// Keep the window full before waiting on the chunk the client needs
+	for i := c.next; i <= c.next+c.window && i < len(c.chunkIDs); i++ {
+		c.start(i)
+	}
+
+	result := <-c.pending[c.next]
+	delete(c.pending, c.next)
+	c.next++
+	return result.content, result.err
+}
+
+// Seek makes Next continue at the chunk with the given index. Fetches for
+// chunks that will not be read are abandoned.
+func (c *ChunkReadAhead) Seek(index int) {
+	if index == c.next {
+		return
+	}
+	for i := range c.pending {
+		if i < index || i > index+c.window {
+			delete(c.pending, i)
+		}
+	}
+	c.next = index
+}
+
+// Close abandons all outstanding fetches. Their results are discarded.
+func (c *ChunkReadAhead) Close() {
+	c.pending = make(map[int]chan chunkResult)
+	c.next = len(c.chunkIDs)
+}
+
+// start fetches a chunk in the background unless it is already pending
+func (c *ChunkReadAhead) start(index int) {
+	if _, ok := c.pending[index]; ok {
+		return
+	}
+
+	// Buffered so an abandoned fetch never blocks
+	ch := make(chan chunkResult, 1)
+	c.pending[index] = ch
+	chunkID := c.chunkIDs[index]
+	go func() {
+		entity, err := c.fetch(chunkID)
+		switch {
+		case err != nil:
+			ch <- chunkResult{err: fmt.Errorf("failed to get chunk %s: %w", chunkID, err)}
+		case entity == nil || entity.IsRecoveryPlaceholder():
+			ch <- chunkResult{err: fmt.Errorf("chunk %s is missing", chunkID)}
+		default:
+			ch <- chunkResult{content: entity.Content}
+		}
+	}()
+}
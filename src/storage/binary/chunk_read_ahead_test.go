@@ -0,0 +1,70 @@
+package binary
+
+import (
+	"entitydb/models"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestChunkReadAhead tests ordering, concurrency and the read-ahead bound
+func TestChunkReadAhead(t *testing.T) {
+	const chunks = 8
+	const delay = 20 * time.Millisecond
+
+	var inFlight, maxInFlight int32
+	fetch := func(id string) (*models.Entity, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		atomic.AddInt32(&inFlight, -1)
+		return &models.Entity{ID: id, Content: []byte(id)}, nil
+	}
+
+	ids := make([]string, chunks)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("chunk-%d", i)
+	}
+
+	reader := NewChunkReadAhead(fetch, ids, 3)
+	start := time.Now()
+	for i := 0; i < chunks; i++ {
+		content, err := reader.Next()
+		if err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+		if string(content) != ids[i] {
+			t.Fatalf("chunk %d: got %q", i, content)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after last chunk, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed >= chunks*delay {
+		t.Errorf("Read-ahead took %v, no faster than sequential fetches", elapsed)
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > 4 {
+		t.Errorf("%d fetches in flight, window allows 4", max)
+	}
+
+	// Seeking backwards fetches the requested chunk again
+	reader = NewChunkReadAhead(fetch, ids, 2)
+	reader.Next()
+	reader.Seek(5)
+	if content, _ := reader.Next(); string(content) != ids[5] {
+		t.Errorf("After seek got %q, want %q", content, ids[5])
+	}
+	reader.Seek(0)
+	if content, _ := reader.Next(); string(content) != ids[0] {
+		t.Errorf("After seek got %q, want %q", content, ids[0])
+	}
+	reader.Close()
+}
@@ -0,0 +1,309 @@
+package binary
+
+import (
+	"compress/gzip"
+	"entitydb/config"
+	"entitydb/logger"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Compression Codecs
+//
+// Content is compressed by a codec chosen per write: the configured default,
+// or the codec configured for the content's type. The codec's type is stored
+// in the record's compression byte, so readers decompress every record with
+// the codec it was written with whatever the current configuration is.
+
+// Codec compresses and decompresses entity content
+type Codec interface {
+	// Type is the value stored in the compression byte of records
+	Type() CompressionType
+	// Name identifies the codec in configuration
+	Name() string
+	Compress(content []byte) ([]byte, error)
+	// Decompress restores content of originalSize bytes
+	Decompress(data []byte, originalSize int) ([]byte, error)
+}
+
+var (
+	codecsMu     sync.RWMutex
+	codecsByType = make(map[CompressionType]Codec)
+	codecsByName = make(map[string]Codec)
+)
+
+func init() {
+	RegisterCodec(gzipCodec{})
+	RegisterCodec(newZstdCodec())
+	RegisterCodec(lz4Codec{})
+}
+
+// RegisterCodec makes a codec available for writing and reading. Its type
+// must be unique, non-zero and leave contentEncryptedFlag clear.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	t, name := c.Type(), strings.ToLower(c.Name())
+	if t == CompressionNone || t&contentEncryptedFlag != 0 {
+		panic(fmt.Sprintf("compression codec %q has reserved type %d", name, t))
+	}
+	if _, exists := codecsByType[t]; exists {
+		panic(fmt.Sprintf("compression codec type %d registered twice", t))
+	}
+	if _, exists := codecsByName[name]; exists || name == "none" {
+		panic(fmt.Sprintf("compression codec %q registered twice", name))
+	}
+	codecsByType[t] = c
+	codecsByName[name] = c
+}
+
+// GetCodec returns the codec of a compression type
+func GetCodec(t CompressionType) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecsByType[t]
+	return c, ok
+}
+
+// CodecNames lists the registered codecs
+func CodecNames() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	names := make([]string, 0, len(codecsByName))
+	for name := range codecsByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compressionTypeByName resolves a configured codec name; "none" disables
+// compression
+func compressionTypeByName(name string) (CompressionType, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "none" {
+		return CompressionNone, nil
+	}
+	codecsMu.RLock()
+	c, ok := codecsByName[name]
+	codecsMu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("unknown compression codec %q (available: none, %s)", name, strings.Join(CodecNames(), ", "))
+	}
+	return c.Type(), nil
+}
+
+// decompress restores content stored with compression type t
+func decompress(t CompressionType, data []byte, originalSize int) ([]byte, error) {
+	if t == CompressionNone {
+		return data, nil
+	}
+	c, ok := GetCodec(t)
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression type: %d", t)
+	}
+	return c.Decompress(data, originalSize)
+}
+
+// CompressionPolicy chooses the codec content is written with
+type CompressionPolicy struct {
+	Default       CompressionType
+	ByContentType map[string]CompressionType // MIME type or "type/*" -> codec
+}
+
+// NewCompressionPolicy builds a policy from a default codec name and a
+// comma-separated list of "content-type=codec" pairs. Content types may be a
+// wildcard such as "image/*".
+func NewCompressionPolicy(defaultCodec, byContentType string) (*CompressionPolicy, error) {
+	if defaultCodec == "" {
+		defaultCodec = "gzip"
+	}
+	t, err := compressionTypeByName(defaultCodec)
+	if err != nil {
+		return nil, err
+	}
+	policy := &CompressionPolicy{Default: t, ByContentType: make(map[string]CompressionType)}
+	for _, item := range strings.Split(byContentType, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		contentType, name, ok := strings.Cut(item, "=")
+		contentType = strings.ToLower(strings.TrimSpace(contentType))
+		if !ok || contentType == "" {
+			return nil, fmt.Errorf("invalid compression rule %q, expected content-type=codec", item)
+		}
+		if policy.ByContentType[contentType], err = compressionTypeByName(name); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// codecFor returns the compression type for content of a MIME type, trying
+// the exact type, then its "type/*" wildcard, then the default
+func (p *CompressionPolicy) codecFor(contentType string) CompressionType {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+	if t, ok := p.ByContentType[contentType]; ok {
+		return t
+	}
+	if major, _, ok := strings.Cut(contentType, "/"); ok {
+		if t, ok := p.ByContentType[major+"/*"]; ok {
+			return t
+		}
+	}
+	return p.Default
+}
+
+// activeCompression is the process-wide compression policy; nil means gzip
+// for all content, as before codecs were configurable
+var activeCompression atomic.Pointer[CompressionPolicy]
+
+// SetCompressionPolicy installs the policy writers compress content with
+func SetCompressionPolicy(p *CompressionPolicy) {
+	activeCompression.Store(p)
+}
+
+// ConfigureCompression installs the compression policy named by cfg
+func ConfigureCompression(cfg *config.Config) error {
+	policy, err := NewCompressionPolicy(cfg.CompressionCodec, cfg.CompressionContentTypes)
+	if err != nil {
+		return err
+	}
+	SetCompressionPolicy(policy)
+	return nil
+}
+
+// CompressForContentType compresses content with the codec the active policy
+// selects for its MIME type. Content below CompressionThreshold, or that
+// does not shrink, is stored uncompressed.
+func CompressForContentType(content []byte, contentType string) (*CompressedContent, error) {
+	t := CompressionGzip
+	if p := activeCompression.Load(); p != nil {
+		t = p.codecFor(contentType)
+	}
+	return compressWith(t, content)
+}
+
+// compressWith compresses content with the codec of type t
+func compressWith(t CompressionType, content []byte) (*CompressedContent, error) {
+	uncompressed := &CompressedContent{Type: CompressionNone, Data: content, OriginalSize: len(content)}
+	if t == CompressionNone || len(content) < CompressionThreshold {
+		return uncompressed, nil
+	}
+	c, ok := GetCodec(t)
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression type: %d", t)
+	}
+	data, err := c.Compress(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s compression failed: %w", c.Name(), err)
+	}
+	if len(data) >= len(content) {
+		logger.Trace("Compression not beneficial for content of size %d (%s: %d)", len(content), c.Name(), len(data))
+		return uncompressed, nil
+	}
+	logger.Trace("Compressed %d bytes to %d bytes with %s (%.1f%% reduction)",
+		len(content), len(data), c.Name(), float64(len(content)-len(data))/float64(len(content))*100)
+	return &CompressedContent{Type: t, Data: data, OriginalSize: len(content)}, nil
+}
+
+// gzipCodec is the original content codec
+type gzipCodec struct{}
+
+func (gzipCodec) Type() CompressionType { return CompressionGzip }
+func (gzipCodec) Name() string          { return "gzip" }
+
+func (gzipCodec) Compress(content []byte) ([]byte, error) {
+	compressed := GetSmallBuffer()
+	defer PutSmallBuffer(compressed)
+	compressed.Reset()
+
+	gw := gzip.NewWriter(compressed)
+	if _, err := gw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), compressed.Bytes()...), nil
+}
+
+func (gzipCodec) Decompress(data []byte, originalSize int) ([]byte, error) {
+	return DecompressWithPool(data)
+}
+
+// zstdCodec compresses better and faster than gzip. Its encoder and decoder
+// are shared; EncodeAll and DecodeAll are safe for concurrent use.
+type zstdCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCodec() *zstdCodec {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(fmt.Sprintf("zstd encoder: %v", err))
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(fmt.Sprintf("zstd decoder: %v", err))
+	}
+	return &zstdCodec{encoder: encoder, decoder: decoder}
+}
+
+func (*zstdCodec) Type() CompressionType { return CompressionZstd }
+func (*zstdCodec) Name() string          { return "zstd" }
+
+func (c *zstdCodec) Compress(content []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(content, nil), nil
+}
+
+func (c *zstdCodec) Decompress(data []byte, originalSize int) ([]byte, error) {
+	return c.decoder.DecodeAll(data, make([]byte, 0, originalSize))
+}
+
+// lz4Codec trades ratio for the fastest decompression. Blocks carry no
+// length, so decompression relies on the stored original size.
+type lz4Codec struct{}
+
+func (lz4Codec) Type() CompressionType { return CompressionLZ4 }
+func (lz4Codec) Name() string          { return "lz4" }
+
+func (lz4Codec) Compress(content []byte) ([]byte, error) {
+	var compressor lz4.Compressor
+	data := make([]byte, lz4.CompressBlockBound(len(content)))
+	n, err := compressor.CompressBlock(content, data)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		// Incompressible; report no saving so the content is stored as-is
+		return content, nil
+	}
+	return data[:n], nil
+}
+
+func (lz4Codec) Decompress(data []byte, originalSize int) ([]byte, error) {
+	if originalSize <= 0 {
+		return nil, fmt.Errorf("lz4 content has no original size")
+	}
+	content := make([]byte, originalSize)
+	n, err := lz4.UncompressBlock(data, content)
+	if err != nil {
+		return nil, err
+	}
+	if n != originalSize {
+		return nil, fmt.Errorf("lz4 content decompressed to %d bytes, want %d", n, originalSize)
+	}
+	return content, nil
+}
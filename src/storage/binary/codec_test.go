@@ -0,0 +1,117 @@
+package binary
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestCodecsRoundTrip checks that every registered codec restores content
+func TestCodecsRoundTrip(t *testing.T) {
+	content := bytes.Repeat([]byte(`{"metric":"cpu","value":42},`), 200)
+	for _, name := range CodecNames() {
+		ct, err := compressionTypeByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compressed, err := compressWith(ct, content)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if compressed.Type != ct || len(compressed.Data) >= len(content) {
+			t.Errorf("%s stored type %d with %d of %d bytes", name, compressed.Type, len(compressed.Data), len(content))
+		}
+		got, err := DecompressContent(compressed)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%s round trip = %d bytes, %v", name, len(got), err)
+		}
+	}
+}
+
+// TestCompressionPolicy checks codec selection by content type
+func TestCompressionPolicy(t *testing.T) {
+	policy, err := NewCompressionPolicy("zstd", "application/json=lz4, image/*=none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for contentType, want := range map[string]CompressionType{
+		"application/json":                CompressionLZ4,
+		"Application/JSON; charset=utf-8": CompressionLZ4,
+		"image/png":                       CompressionNone,
+		"text/plain":                      CompressionZstd,
+		"":                                CompressionZstd,
+	} {
+		if got := policy.codecFor(contentType); got != want {
+			t.Errorf("codecFor(%q) = %d, want %d", contentType, got, want)
+		}
+	}
+
+	for _, bad := range [][2]string{{"brotli", ""}, {"gzip", "text/plain"}, {"gzip", "text/plain=snappy"}} {
+		if _, err := NewCompressionPolicy(bad[0], bad[1]); err == nil {
+			t.Errorf("NewCompressionPolicy(%q, %q) succeeded", bad[0], bad[1])
+		}
+	}
+}
+
+// TestMixedCodecRecords checks that a file holding records written under
+// different policies reads back whatever the current policy is
+func TestMixedCodecRecords(t *testing.T) {
+	defer SetCompressionPolicy(nil)
+
+	var entities []*models.Entity
+	for i, name := range []string{"none", "gzip", "zstd", "lz4"} {
+		entities = append(entities, &models.Entity{
+			ID:      fmt.Sprintf("entity-%s", name),
+			Tags:    []string{"1|type:document", "2|content:type:text/plain"},
+			Content: bytes.Repeat([]byte(fmt.Sprintf("line %d compressed with %s; ", i, name)), 100),
+		})
+	}
+
+	path := ""
+	for i, entity := range entities {
+		policy, err := NewCompressionPolicy([]string{"none", "gzip", "zstd", "lz4"}[i], "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		SetCompressionPolicy(policy)
+		if path == "" {
+			path = writeTestEntities(t, entities[:1])
+		} else {
+			appendTestEntities(t, path, []*models.Entity{entity})
+		}
+	}
+	SetCompressionPolicy(nil)
+
+	reader, err := NewReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	mapped, err := NewMMapReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+	for i, want := range entities {
+		entry := reader.index[want.ID]
+		data := make([]byte, entry.Size)
+		if _, err := reader.file.ReadAt(data, int64(entry.Offset)); err != nil {
+			t.Fatal(err)
+		}
+		rec, err := parseEntityRecord(data)
+		if err != nil || CompressionType(rec.compression) != CompressionType(i) {
+			t.Errorf("%s stored with compression type %d (%v), want %d", want.ID, rec.compression, err, i)
+		}
+		for source, get := range map[string]func(string) (*models.Entity, error){"file": reader.GetEntity, "mapped": mapped.GetEntity} {
+			got, err := get(want.ID)
+			if err != nil {
+				t.Fatalf("%s read of %s: %v", source, want.ID, err)
+			}
+			if !bytes.Equal(got.Content, want.Content) {
+				t.Errorf("%s read of %s returned %d bytes, want %d", source, want.ID, len(got.Content), len(want.Content))
+			}
+		}
+	}
+}
@@ -14,7 +14,8 @@ type CompressionType byte
 const (
 	CompressionNone CompressionType = 0
 	CompressionGzip CompressionType = 1
-	// Reserved for future: CompressionZstd CompressionType = 2
+	CompressionZstd CompressionType = 2
+	CompressionLZ4  CompressionType = 3
 	
 	// Compression threshold - only compress if content is larger than this
 	CompressionThreshold = 1024 // 1KB
@@ -27,7 +28,8 @@ type CompressedContent struct {
 	OriginalSize int
 }
 
-// CompressContent compresses content if it's above the threshold for storage efficiency.
+// CompressContent compresses content with gzip if it's above the threshold
+// for storage efficiency.
 //
 // Parameters:
 //   - content: Raw byte data to potentially compress
@@ -36,132 +38,25 @@ type CompressedContent struct {
 //   - *CompressedContent: Wrapper containing compressed/uncompressed data with metadata
 //   - error: Compression errors (typically gzip encoding failures)
 func CompressContent(content []byte) (*CompressedContent, error) {
-	if len(content) < CompressionThreshold {
-		// Don't compress small content
-		return &CompressedContent{
-			Type:         CompressionNone,
-			Data:         content,
-			OriginalSize: len(content),
-		}, nil
-	}
-	
-	// Use gzip compression
-	var compressed bytes.Buffer
-	gw := gzip.NewWriter(&compressed)
-	
-	n, err := gw.Write(content)
-	if err != nil {
-		return nil, fmt.Errorf("compression write failed: %w", err)
-	}
-	
-	if err := gw.Close(); err != nil {
-		return nil, fmt.Errorf("compression close failed: %w", err)
-	}
-	
-	// Only use compression if it actually saves space
-	if compressed.Len() >= len(content) {
-		logger.Trace("Compression not beneficial for content of size %d (compressed: %d)", 
-			len(content), compressed.Len())
-		return &CompressedContent{
-			Type:         CompressionNone,
-			Data:         content,
-			OriginalSize: len(content),
-		}, nil
-	}
-	
-	logger.Trace("Compressed %d bytes to %d bytes (%.1f%% reduction)", 
-		n, compressed.Len(), float64(len(content)-compressed.Len())/float64(len(content))*100)
-	
-	return &CompressedContent{
-		Type:         CompressionGzip,
-		Data:         compressed.Bytes(),
-		OriginalSize: len(content),
-	}, nil
+	return compressWith(CompressionGzip, content)
 }
 
-// DecompressContent decompresses content based on its type
+// DecompressContent decompresses content with the codec of its type
 func DecompressContent(cc *CompressedContent) ([]byte, error) {
-	switch cc.Type {
-	case CompressionNone:
-		return cc.Data, nil
-		
-	case CompressionGzip:
-		gr, err := gzip.NewReader(bytes.NewReader(cc.Data))
-		if err != nil {
-			return nil, fmt.Errorf("gzip reader creation failed: %w", err)
-		}
-		defer gr.Close()
-		
-		// Pre-allocate buffer based on original size if known
-		var decompressed bytes.Buffer
-		if cc.OriginalSize > 0 {
-			decompressed.Grow(cc.OriginalSize)
-		}
-		
-		_, err = io.Copy(&decompressed, gr)
-		if err != nil {
-			return nil, fmt.Errorf("decompression failed: %w", err)
-		}
-		
-		result := decompressed.Bytes()
-		if cc.OriginalSize > 0 && len(result) != cc.OriginalSize {
-			logger.Warn("Decompressed size mismatch: expected %d, got %d", 
-				cc.OriginalSize, len(result))
-		}
-		
-		return result, nil
-		
-	default:
-		return nil, fmt.Errorf("unsupported compression type: %d", cc.Type)
+	result, err := decompress(cc.Type, cc.Data, cc.OriginalSize)
+	if err != nil {
+		return nil, err
+	}
+	if cc.Type != CompressionNone && cc.OriginalSize > 0 && len(result) != cc.OriginalSize {
+		logger.Warn("Decompressed size mismatch: expected %d, got %d",
+			cc.OriginalSize, len(result))
 	}
+	return result, nil
 }
 
-// CompressWithPool compresses content using pooled buffers
+// CompressWithPool compresses content with gzip using pooled buffers
 func CompressWithPool(content []byte) (*CompressedContent, error) {
-	if len(content) < CompressionThreshold {
-		return &CompressedContent{
-			Type:         CompressionNone,
-			Data:         content,
-			OriginalSize: len(content),
-		}, nil
-	}
-	
-	// Get buffer from pool
-	compressed := GetSmallBuffer()
-	defer PutSmallBuffer(compressed)
-	compressed.Reset()
-	
-	gw := gzip.NewWriter(compressed)
-	n, err := gw.Write(content)
-	if err != nil {
-		return nil, fmt.Errorf("compression write failed: %w", err)
-	}
-	
-	if err := gw.Close(); err != nil {
-		return nil, fmt.Errorf("compression close failed: %w", err)
-	}
-	
-	// Check if compression is beneficial
-	if compressed.Len() >= len(content) {
-		return &CompressedContent{
-			Type:         CompressionNone,
-			Data:         content,
-			OriginalSize: len(content),
-		}, nil
-	}
-	
-	// Make a copy of the compressed data
-	compressedData := make([]byte, compressed.Len())
-	copy(compressedData, compressed.Bytes())
-	
-	logger.Trace("Compressed %d bytes to %d bytes (%.1f%% reduction)", 
-		n, len(compressedData), float64(len(content)-len(compressedData))/float64(len(content))*100)
-	
-	return &CompressedContent{
-		Type:         CompressionGzip,
-		Data:         compressedData,
-		OriginalSize: len(content),
-	}, nil
+	return compressWith(CompressionGzip, content)
 }
 
 // DecompressWithPool decompresses gzip data using pooled buffers
@@ -0,0 +1,117 @@
+package binary
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestContentAddressedChunks checks that identical chunk data is stored once
+// with a reference per parent, that the chunk is deleted with its last live
+// reference, and that storing the data again re-creates it under the same ID
+func TestContentAddressedChunks(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	for _, id := range []string{"parent-a", "parent-b", "parent-c"} {
+		if err := repo.Create(&models.Entity{ID: id, Tags: []string{"type:document", "dataset:default"}}); err != nil {
+			t.Fatalf("Create %s: %v", id, err)
+		}
+	}
+	flushWrites(t, repo)
+
+	data := bytes.Repeat([]byte("chunk data "), 1000)
+	chunkID, reused, err := models.StoreChunk(repo, "parent-a", data)
+	if err != nil || reused {
+		t.Fatalf("first StoreChunk = %s, reused %v, %v", chunkID, reused, err)
+	}
+	if chunkID != models.ContentAddressedChunkID(data) || !strings.HasPrefix(chunkID, models.ChunkIDPrefix) || len(chunkID) > 64 {
+		t.Fatalf("chunk ID %q is not a prefixed hash within the 64-character ID limit", chunkID)
+	}
+	flushWrites(t, repo)
+
+	again, reused, err := models.StoreChunk(repo, "parent-b", data)
+	if err != nil || !reused || again != chunkID {
+		t.Fatalf("second StoreChunk = %s, reused %v, %v; want %s reused", again, reused, err, chunkID)
+	}
+	flushWrites(t, repo)
+	chunk, err := repo.GetByID(chunkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if referrers := chunk.ChunkReferrers(); len(referrers) != 2 {
+		t.Errorf("chunk referrers = %v, want parent-a and parent-b", referrers)
+	}
+
+	if deleted, err := models.ReleaseChunk(repo, "parent-a", chunkID); err != nil || deleted {
+		t.Fatalf("ReleaseChunk with a live referrer left = %v, %v", deleted, err)
+	}
+	chunk, err = repo.GetByID(chunkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if referrers := chunk.ChunkReferrers(); len(referrers) != 1 || referrers[0] != "parent-b" {
+		t.Errorf("chunk referrers after release = %v, want parent-b", referrers)
+	}
+	if deleted, err := models.ReleaseChunk(repo, "parent-b", chunkID); err != nil || !deleted {
+		t.Fatalf("ReleaseChunk of the last referrer = %v, %v", deleted, err)
+	}
+	if _, deleted := repo.deletionIndex.GetEntry(chunkID); !deleted {
+		t.Fatal("released chunk is not recorded as deleted")
+	}
+
+	recreated, reused, err := models.StoreChunk(repo, "parent-c", data)
+	if err != nil || reused || recreated != chunkID {
+		t.Fatalf("StoreChunk after deletion = %s, reused %v, %v; want %s re-created", recreated, reused, err, chunkID)
+	}
+	flushWrites(t, repo)
+	if _, deleted := repo.deletionIndex.GetEntry(chunkID); deleted {
+		t.Error("re-created chunk is still recorded as deleted")
+	}
+	chunk, err = repo.GetByID(chunkID)
+	if err != nil || chunk.IsRecoveryPlaceholder() || !bytes.Equal(chunk.Content, data) {
+		t.Fatalf("re-created chunk = %+v, %v", chunk, err)
+	}
+	if referrers := chunk.ChunkReferrers(); len(referrers) != 1 || referrers[0] != "parent-c" {
+		t.Errorf("re-created chunk referrers = %v, want parent-c", referrers)
+	}
+}
+
+// TestChunkBehaviourScopedToChunkIDs checks that other entities keep exact
+// tag removal, even those whose ID looks like a bare hash
+func TestChunkBehaviourScopedToChunkIDs(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	hashLike := strings.Repeat("ab", 32)
+	if models.IsContentAddressedChunkID(hashLike) {
+		t.Errorf("IsContentAddressedChunkID(%q) = true for an unprefixed ID", hashLike)
+	}
+	if err := repo.Create(&models.Entity{ID: hashLike, Tags: []string{"type:document", "dataset:default", "status:draft"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+
+	if err := repo.RemoveTag(hashLike, "status:draft"); err != nil {
+		t.Fatalf("RemoveTag: %v", err)
+	}
+	entity, err := repo.GetByID(hashLike)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entity.HasTag("status:draft") {
+		t.Error("RemoveTag matched a stored tag by content on an entity that is not a chunk")
+	}
+	stored := entity.StoredTags("status:draft")
+	if len(stored) != 1 {
+		t.Fatalf("StoredTags(status:draft) = %v, want one tag", stored)
+	}
+	if err := repo.RemoveTag(hashLike, stored[0]); err != nil {
+		t.Fatalf("RemoveTag of the stored tag: %v", err)
+	}
+	if entity, err = repo.GetByID(hashLike); err != nil || entity.HasTag("status:draft") {
+		t.Errorf("stored tag was not removed: %+v, %v", entity, err)
+	}
+}
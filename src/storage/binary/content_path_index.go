@@ -0,0 +1,236 @@
+package binary
+
+import (
+	"context"
+	"entitydb/models"
+	"strings"
+	"sync"
+)
+
+// contentPathAllDatasets configures a path for every dataset
+const contentPathAllDatasets = "*"
+
+// contentPathEntry records one indexed value so it can be removed again
+type contentPathEntry struct {
+	dataset string
+	path    string
+	key     string
+}
+
+// ContentPathIndex maps values at configured JSON content paths to entity IDs,
+// per dataset. Paths are configured as "dataset:path" pairs; "*" as the
+// dataset indexes the path everywhere.
+type ContentPathIndex struct {
+	mu sync.RWMutex
+
+	// paths lists the indexed content paths per dataset
+	paths map[string][]string
+	// values maps dataset -> path -> value key -> entity IDs
+	values map[string]map[string]map[string]map[string]struct{}
+	// entries holds each entity's indexed values
+	entries map[string][]contentPathEntry
+}
+
+// ContentPathIndexStats summarizes the content path index
+type ContentPathIndexStats struct {
+	Paths    map[string][]string `json:"paths"`
+	Entities int                 `json:"entities"`
+	Values   int                 `json:"values"`
+}
+
+// ParseContentIndexPaths parses a comma-separated list of "dataset:path"
+// pairs. Paths are dot-separated or JSONPaths such as "$.customer.country".
+func ParseContentIndexPaths(spec string) map[string][]string {
+	paths := make(map[string][]string)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		dataset := strings.TrimSpace(parts[0])
+		path := strings.TrimPrefix(strings.TrimSpace(parts[1]), models.ContentPathPrefix)
+		if strings.HasPrefix(path, "$") {
+			// JSONPath form, as accepted by the content_path query parameter
+			converted, err := models.ContentPathFromJSONPath(path)
+			if err != nil {
+				continue
+			}
+			path = converted
+		}
+		if dataset == "" || path == "" {
+			continue
+		}
+		paths[dataset] = append(paths[dataset], path)
+	}
+	return paths
+}
+
+// NewContentPathIndex creates an index for the configured paths. It returns
+// nil when no paths are configured; a nil index indexes nothing.
+func NewContentPathIndex(spec string) *ContentPathIndex {
+	paths := ParseContentIndexPaths(spec)
+	if len(paths) == 0 {
+		return nil
+	}
+	return &ContentPathIndex{
+		paths:   paths,
+		values:  make(map[string]map[string]map[string]map[string]struct{}),
+		entries: make(map[string][]contentPathEntry),
+	}
+}
+
+// pathsFor returns the paths indexed for a dataset
+func (idx *ContentPathIndex) pathsFor(dataset string) []string {
+	if dataset == contentPathAllDatasets {
+		return idx.paths[contentPathAllDatasets]
+	}
+	return append(append([]string{}, idx.paths[dataset]...), idx.paths[contentPathAllDatasets]...)
+}
+
+// Covers reports whether a path is indexed for a dataset
+func (idx *ContentPathIndex) Covers(dataset, path string) bool {
+	if idx == nil || dataset == "" {
+		return false
+	}
+	for _, p := range idx.pathsFor(dataset) {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Index replaces the indexed values of an entity with those in its current content
+func (idx *ContentPathIndex) Index(entity *models.Entity) {
+	if idx == nil || entity == nil {
+		return
+	}
+
+	var entries []contentPathEntry
+	dataset := entity.GetDataset()
+	if paths := idx.pathsFor(dataset); dataset != "" && len(paths) > 0 {
+		if document, ok := models.ParseJSONContent(entity.Content); ok {
+			for _, path := range paths {
+				value, found := models.LookupJSONPath(document, path)
+				if !found {
+					continue
+				}
+				if key, scalar := models.ContentPathValueKey(value); scalar {
+					entries = append(entries, contentPathEntry{dataset: dataset, path: path, key: key})
+				}
+			}
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(entity.ID)
+	for _, entry := range entries {
+		byPath, ok := idx.values[entry.dataset]
+		if !ok {
+			byPath = make(map[string]map[string]map[string]struct{})
+			idx.values[entry.dataset] = byPath
+		}
+		byKey, ok := byPath[entry.path]
+		if !ok {
+			byKey = make(map[string]map[string]struct{})
+			byPath[entry.path] = byKey
+		}
+		ids, ok := byKey[entry.key]
+		if !ok {
+			ids = make(map[string]struct{})
+			byKey[entry.key] = ids
+		}
+		ids[entity.ID] = struct{}{}
+	}
+	if len(entries) > 0 {
+		idx.entries[entity.ID] = entries
+	}
+}
+
+// Remove drops an entity from the index
+func (idx *ContentPathIndex) Remove(entityID string) {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(entityID)
+}
+
+func (idx *ContentPathIndex) removeLocked(entityID string) {
+	for _, entry := range idx.entries[entityID] {
+		ids := idx.values[entry.dataset][entry.path][entry.key]
+		delete(ids, entityID)
+		if len(ids) == 0 {
+			delete(idx.values[entry.dataset][entry.path], entry.key)
+		}
+	}
+	delete(idx.entries, entityID)
+}
+
+// Lookup returns the IDs of entities in a dataset whose content has value at path
+func (idx *ContentPathIndex) Lookup(dataset, path, value string) []string {
+	if idx == nil {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	byKey := idx.values[dataset][path]
+	result := make([]string, 0, len(byKey[value]))
+	for id := range byKey[value] {
+		result = append(result, id)
+	}
+	// Numbers are keyed in canonical form, so "42.0" also finds 42
+	if key := models.ContentPathQueryKey(value); key != value {
+		for id := range byKey[key] {
+			if _, seen := byKey[value][id]; !seen {
+				result = append(result, id)
+			}
+		}
+	}
+	return result
+}
+
+// Stats reports the configured paths and index size
+func (idx *ContentPathIndex) Stats() ContentPathIndexStats {
+	if idx == nil {
+		return ContentPathIndexStats{Paths: map[string][]string{}}
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	values := 0
+	for _, entries := range idx.entries {
+		values += len(entries)
+	}
+	return ContentPathIndexStats{Paths: idx.paths, Entities: len(idx.entries), Values: values}
+}
+
+// ListByContentPath returns entities in a dataset whose JSON content has value
+// at path. The boolean is false when the path is not indexed for the dataset,
+// in which case callers must scan instead.
+func (r *EntityRepository) ListByContentPath(dataset, path, value string) ([]*models.Entity, bool, error) {
+	if !r.contentPaths.Covers(dataset, path) {
+		return nil, false, nil
+	}
+
+	ids := r.shardedTagIndex.FilterDeleted(r.contentPaths.Lookup(dataset, path, value))
+	if len(ids) == 0 {
+		return []*models.Entity{}, true, nil
+	}
+
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		return nil, true, err
+	}
+	defer r.readerPool.Put(reader)
+
+	entities, err := r.fetchEntitiesWithReader(context.Background(), reader, ids)
+	return entities, true, err
+}
+
+// ContentPathIndexStats reports the configured content paths and index size
+func (r *EntityRepository) ContentPathIndexStats() ContentPathIndexStats {
+	return r.contentPaths.Stats()
+}
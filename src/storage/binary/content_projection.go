@@ -0,0 +1,22 @@
+package binary
+
+import "context"
+
+// withoutContentKey is the context key of reads that leave content on disk
+type withoutContentKey struct{}
+
+// WithoutContent returns a context whose list and tag lookups read entities
+// without their content, for callers that need only IDs and tags. Records
+// are decoded from their tags and content framing alone, so content is
+// neither read, decrypted nor decompressed. Entities already held in memory
+// are returned as they are, content included, and entities read this way
+// are not cached.
+func WithoutContent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutContentKey{}, true)
+}
+
+// skipsContent reports whether reads in ctx leave content on disk
+func skipsContent(ctx context.Context) bool {
+	skip, _ := ctx.Value(withoutContentKey{}).(bool)
+	return skip
+}
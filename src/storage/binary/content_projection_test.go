@@ -0,0 +1,66 @@
+package binary
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestReadWithoutContent checks that file and mapped reads without content
+// decode the tags a full read does, including records whose tags do not fit
+// in the first read
+func TestReadWithoutContent(t *testing.T) {
+	entities := readPathEntities(12)
+	manyTags := &models.Entity{ID: "many-tags", Content: []byte("body")}
+	for i := 0; i < 400; i++ {
+		manyTags.Tags = append(manyTags.Tags, fmt.Sprintf("%d|label:value-%03d", i+1, i))
+	}
+	path := writeTestEntities(t, append(entities, manyTags))
+
+	reader, err := NewReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	mapped, err := NewMMapReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+
+	for _, id := range reader.EntityIDs() {
+		want, err := reader.GetEntity(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, read := range map[string]func(string) (*models.Entity, error){
+			"file":   reader.GetEntityWithoutContent,
+			"mapped": mapped.GetEntityWithoutContent,
+		} {
+			got, err := read(id)
+			if err != nil {
+				t.Fatalf("%s GetEntityWithoutContent(%s): %v", name, id, err)
+			}
+			// Content type tags added on read carry the current time
+			if got.Content != nil || len(got.Tags) != len(want.Tags) || !reflect.DeepEqual(got.Tags[:3], want.Tags[:3]) {
+				t.Errorf("%s %s = %q %v, want no content and %v", name, id, got.Content, got.Tags, want.Tags)
+			}
+		}
+	}
+
+	if _, err := reader.GetEntityWithoutContent("missing"); err != ErrNotFound {
+		t.Errorf("GetEntityWithoutContent of a missing entity = %v, want ErrNotFound", err)
+	}
+	for name, readAll := range map[string]func(context.Context) ([]*models.Entity, error){
+		"file":   reader.GetAllEntitiesWithoutContent,
+		"mapped": mapped.GetAllEntitiesWithoutContent,
+	} {
+		all, err := readAll(context.Background())
+		if err != nil || len(all) != 13 {
+			t.Errorf("%s GetAllEntitiesWithoutContent returned %d entities, %v; want 13", name, len(all), err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package binary
+
+import (
+	"context"
+	"entitydb/logger"
+	"fmt"
+	"time"
+)
+
+// ContentRekeyProgressFunc reports each entity examined by RekeyContent
+type ContentRekeyProgressFunc func(processed, total int, entityID string, err error)
+
+// ContentRekeyResult summarises a RekeyContent run
+type ContentRekeyResult struct {
+	TargetKey string         `json:"target_key"` // "" when content is being decrypted
+	Examined  int            `json:"examined"`
+	Rewritten int            `json:"rewritten"`
+	Failed    int            `json:"failed"`
+	Before    map[string]int `json:"before"` // entities per key before the run; "" is plaintext
+	Duration  string         `json:"duration"`
+}
+
+// RekeyContent rewrites every entity whose content is not sealed the way
+// the current settings seal new content: under another master key after a
+// rotation, in plaintext after encryption was enabled, or sealed after it
+// was disabled. Tags and content are unchanged, so no history is added;
+// only the stored record is replaced.
+//
+// The superseded records stay in the data file, still sealed with the old
+// key, until the file is rewritten. Entities changed only in memory are
+// skipped, because the next checkpoint writes them with the current key.
+func (r *EntityRepository) RekeyContent(ctx context.Context, progress ContentRekeyProgressFunc) (*ContentRekeyResult, error) {
+	started := time.Now()
+	result := &ContentRekeyResult{
+		TargetKey: GetContentEncryptor().TargetKeyID(),
+		Before:    make(map[string]int),
+	}
+
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reader: %w", err)
+	}
+	ids := reader.EntityIDs()
+	r.readerPool.Put(reader)
+
+	rewritten := false
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		changed, keyID, err := r.rekeyEntity(id, result.TargetKey)
+		result.Examined++
+		if err != nil {
+			result.Failed++
+			logger.Warn("Failed to re-encrypt entity %s: %v", id, err)
+		} else {
+			result.Before[keyID]++
+			if changed {
+				result.Rewritten++
+				rewritten = true
+			}
+		}
+		if progress != nil {
+			progress(i+1, len(ids), id, err)
+		}
+	}
+
+	// Pooled readers still point at the superseded records, which remain
+	// readable, so advancing the generation once at the end is enough
+	if rewritten {
+		r.readerPool.Advance()
+	}
+
+	result.Duration = time.Since(started).String()
+	logger.Info("Content re-encryption finished: %d examined, %d rewritten, %d failed (target key %q) in %s",
+		result.Examined, result.Rewritten, result.Failed, result.TargetKey, result.Duration)
+	return result, nil
+}
+
+// rekeyEntity rewrites one entity if its content is not sealed with
+// targetKey, returning the key it was sealed with before
+func (r *EntityRepository) rekeyEntity(id, targetKey string) (bool, string, error) {
+	// Hold the entity's write lock so a concurrent update cannot be
+	// overwritten by the version read here
+	r.lockManager.AcquireEntityLock(id, WriteLock)
+	defer r.lockManager.ReleaseEntityLock(id, WriteLock)
+
+	if r.entityCache.IsDirty(id) {
+		return false, "", nil
+	}
+
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		return false, "", err
+	}
+	defer r.readerPool.Put(reader)
+
+	keyID, tagCount, err := reader.contentKeyID(id)
+	if err != nil {
+		return false, "", err
+	}
+	if keyID == targetKey {
+		return false, keyID, nil
+	}
+
+	entity, err := reader.GetEntity(id)
+	if err != nil {
+		return false, keyID, err
+	}
+	if len(entity.Content) == 0 {
+		return false, keyID, nil
+	}
+	// Drop the content type tag the reader adds to records without one
+	if len(entity.Tags) > tagCount {
+		entity.Tags = entity.Tags[:tagCount]
+	}
+	if err := r.writerManager.WriteEntity(entity); err != nil {
+		return false, keyID, err
+	}
+	return true, keyID, nil
+}
@@ -0,0 +1,133 @@
+package binary
+
+import (
+	"bytes"
+	"context"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// With content versioning enabled, an update that replaces an entity's
+// content first stores the old content in a content_version entity:
+//
+//	type:content_version
+//	content_version:of:<entity id>
+//	content_version:until:<unix nanos the content was replaced>
+//
+// The version carries the entity's dataset and ACL tags, so it is readable
+// by the same users. GetEntityAsOf returns the content of the first version
+// replaced after the requested time, or the current content.
+const (
+	// ContentVersionOfTag names the entity whose content a version holds
+	ContentVersionOfTag = "content_version:of:"
+
+	// ContentVersionUntilTag records when a version's content was replaced
+	ContentVersionUntilTag = "content_version:until:"
+)
+
+// saveContentVersion stores the content an update of entity replaces, when
+// content versioning is enabled and the update changes the content
+func (r *EntityRepository) saveContentVersion(ctx context.Context, entity *models.Entity) error {
+	if r.config == nil || !r.config.ContentVersioning {
+		return nil
+	}
+	existing, err := r.GetByIDContext(ctx, entity.ID)
+	if err != nil {
+		// The update itself reports the missing entity
+		return nil
+	}
+	if bytes.Equal(existing.Content, entity.Content) || existing.HasTag("type:content_version") {
+		return nil
+	}
+
+	tags := []string{
+		ContentVersionOfTag + entity.ID,
+		ContentVersionUntilTag + strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+	for _, tag := range existing.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, models.ACLReadTagPrefix) || strings.HasPrefix(tag, models.ACLWriteTagPrefix) {
+			tags = append(tags, tag)
+		}
+	}
+	version, err := models.NewEntityWithMandatoryTags("content_version", existing.GetDataset(), models.SystemUserID, tags)
+	if err != nil {
+		return err
+	}
+	version.Content = existing.Content
+	if err := r.CreateContext(ctx, version); err != nil {
+		return fmt.Errorf("failed to store content version of %s: %w", entity.ID, err)
+	}
+
+	if limit := r.config.ContentVersionLimit; limit > 0 {
+		versions, err := r.ContentVersions(entity.ID)
+		if err != nil {
+			logger.Warn("Failed to list content versions of %s: %v", entity.ID, err)
+			return nil
+		}
+		for len(versions) > limit {
+			if err := r.deleteEntity(versions[0].ID); err != nil {
+				logger.Warn("Failed to delete content version %s: %v", versions[0].ID, err)
+			}
+			versions = versions[1:]
+		}
+	}
+	return nil
+}
+
+// ContentVersions returns the content versions of an entity, oldest first
+func (r *EntityRepository) ContentVersions(id string) ([]*models.Entity, error) {
+	versions, err := r.ListByTag(ContentVersionOfTag + id)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return contentVersionUntil(versions[i]) < contentVersionUntil(versions[j])
+	})
+	return versions, nil
+}
+
+// contentVersionUntil returns when a version's content was replaced
+func contentVersionUntil(version *models.Entity) int64 {
+	for _, tag := range version.GetTagsWithoutTimestamp() {
+		if value, ok := strings.CutPrefix(tag, ContentVersionUntilTag); ok {
+			until, _ := strconv.ParseInt(value, 10, 64)
+			return until
+		}
+	}
+	return 0
+}
+
+// contentAsOf returns the content an entity had at a time. Times before the
+// oldest version kept return that version's content.
+func (r *EntityRepository) contentAsOf(entity *models.Entity, timestamp time.Time) []byte {
+	versions, err := r.ContentVersions(entity.ID)
+	if err != nil {
+		logger.Warn("Failed to list content versions of %s: %v", entity.ID, err)
+		return entity.Content
+	}
+	for _, version := range versions {
+		if contentVersionUntil(version) > timestamp.UnixNano() {
+			return version.Content
+		}
+	}
+	return entity.Content
+}
+
+// deleteContentVersions deletes the content versions of a deleted entity
+func (r *EntityRepository) deleteContentVersions(id string) {
+	versions, err := r.ContentVersions(id)
+	if err != nil {
+		logger.Warn("Failed to list content versions of deleted entity %s: %v", id, err)
+		return
+	}
+	for _, version := range versions {
+		if err := r.deleteEntity(version.ID); err != nil {
+			logger.Warn("Failed to delete content version %s: %v", version.ID, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package binary
+
+import (
+	"testing"
+	"time"
+
+	"entitydb/config"
+	"entitydb/models"
+)
+
+// TestContentVersionsAsOf checks that updates keep replaced content as
+// versions, that GetEntityAsOf returns the content of the requested time
+// and that the version limit and deletes remove versions
+func TestContentVersionsAsOf(t *testing.T) {
+	repo := newTestRepository(t, func(cfg *config.Config) {
+		cfg.ContentVersioning = true
+		cfg.ContentVersionLimit = 2
+	})
+	defer repo.Close()
+
+	entity, err := models.NewEntityWithMandatoryTags("document", "default", models.SystemUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity.Content = []byte("v1")
+	if err := repo.Create(entity); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var times []time.Time
+	for _, content := range []string{"v2", "v3", "v4"} {
+		time.Sleep(2 * time.Millisecond)
+		times = append(times, time.Now())
+		time.Sleep(2 * time.Millisecond)
+		current, err := repo.GetByID(entity.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		updated := &models.Entity{ID: current.ID, Tags: append([]string(nil), current.Tags...), Content: []byte(content)}
+		if err := repo.Update(updated); err != nil {
+			t.Fatalf("Update to %s: %v", content, err)
+		}
+	}
+	repo.FlushPendingWrites()
+
+	versions, err := repo.ContentVersions(entity.ID)
+	if err != nil {
+		t.Fatalf("ContentVersions: %v", err)
+	}
+	if len(versions) != 2 || string(versions[0].Content) != "v2" || string(versions[1].Content) != "v3" {
+		t.Fatalf("got %d versions, want v2 and v3 kept under the limit", len(versions))
+	}
+
+	// v1 was dropped by the limit, so the oldest kept version answers for it
+	for i, want := range []string{"v2", "v2", "v3"} {
+		snapshot, err := repo.GetEntityAsOf(entity.ID, times[i])
+		if err != nil {
+			t.Fatalf("GetEntityAsOf: %v", err)
+		}
+		if string(snapshot.Content) != want {
+			t.Errorf("content as of update %d = %q, want %q", i, snapshot.Content, want)
+		}
+	}
+	if snapshot, _ := repo.GetEntityAsOf(entity.ID, time.Now()); string(snapshot.Content) != "v4" {
+		t.Errorf("content as of now = %q, want v4", snapshot.Content)
+	}
+
+	if err := repo.Delete(entity.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if versions, _ := repo.ContentVersions(entity.ID); len(versions) != 0 {
+		t.Errorf("%d content versions left after deleting the entity", len(versions))
+	}
+}
@@ -0,0 +1,31 @@
+package binary
+
+// ContentionStats describes how busy the repository's locks, readers and
+// writer are, for spotting capacity problems before requests start failing
+type ContentionStats struct {
+	Locks      LockStats
+	ReaderPool ReaderPoolStats
+
+	// Writes in progress or waiting for the single writer
+	WriterQueueDepth int64
+
+	// Operations waiting in the single writer queue, when it is enabled
+	WriteQueueDepth   int64
+	WriteQueueEnabled bool
+}
+
+// ContentionStats returns the current lock, reader pool and writer statistics
+func (r *EntityRepository) ContentionStats() ContentionStats {
+	stats := ContentionStats{Locks: r.lockManager.GetStats()}
+	if pool := r.readerPool; pool != nil {
+		stats.ReaderPool = pool.Stats()
+	}
+	if r.writerManager != nil {
+		stats.WriterQueueDepth = r.writerManager.QueueDepth()
+	}
+	if r.useSingleWriter && r.writerQueue != nil && r.writerQueue.IsRunning() {
+		stats.WriteQueueEnabled = true
+		stats.WriteQueueDepth = r.writerQueue.GetStatistics()["queue_depth"]
+	}
+	return stats
+}
@@ -0,0 +1,73 @@
+package binary
+
+import (
+	"entitydb/models"
+	"testing"
+	"time"
+)
+
+func TestLockManagerContention(t *testing.T) {
+	lm := NewLockManager()
+
+	lm.AcquireEntityLock("a", WriteLock)
+	stats := lm.GetStats()
+	if stats.HeldEntityLocks != 1 || stats.TrackedEntityLocks != 1 {
+		t.Fatalf("held=%d tracked=%d, want 1 and 1", stats.HeldEntityLocks, stats.TrackedEntityLocks)
+	}
+	if stats.Contentions != 0 {
+		t.Fatalf("uncontended acquisition counted as contention")
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		lm.AcquireEntityLock("a", ReadLock)
+		close(acquired)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	lm.ReleaseEntityLock("a", WriteLock)
+	<-acquired
+	lm.ReleaseEntityLock("a", ReadLock)
+
+	stats = lm.GetStats()
+	if stats.Contentions != 1 {
+		t.Errorf("contentions = %d, want 1", stats.Contentions)
+	}
+	if stats.HeldEntityLocks != 0 {
+		t.Errorf("held = %d after release, want 0", stats.HeldEntityLocks)
+	}
+	if stats.ReadLocks != 1 || stats.WriteLocks != 1 {
+		t.Errorf("read=%d write=%d, want 1 and 1", stats.ReadLocks, stats.WriteLocks)
+	}
+	if stats.AverageWait() <= 0 {
+		t.Errorf("average wait not recorded")
+	}
+}
+
+func TestRepositoryContentionStats(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	entity := models.NewEntity()
+	entity.AddTag("type:test")
+	if err := repo.Create(entity); err != nil {
+		t.Fatalf("create entity: %v", err)
+	}
+	before := repo.ContentionStats().ReaderPool
+
+	reader, err := repo.readerPool.Get()
+	if err != nil {
+		t.Fatalf("borrow reader: %v", err)
+	}
+	repo.readerPool.Put(reader)
+
+	stats := repo.ContentionStats()
+	if got := stats.ReaderPool.Hits + stats.ReaderPool.Misses; got != before.Hits+before.Misses+1 {
+		t.Errorf("borrows = %d, want %d", got, before.Hits+before.Misses+1)
+	}
+	if stats.ReaderPool.MaxSize == 0 {
+		t.Errorf("reader pool size not reported")
+	}
+	if stats.WriterQueueDepth != 0 {
+		t.Errorf("writer queue depth = %d with no writes in progress", stats.WriterQueueDepth)
+	}
+}
@@ -0,0 +1,84 @@
+package binary
+
+import (
+	"entitydb/models"
+	"sync"
+)
+
+// PublicReadTag on a dataset entity publishes the dataset read-only: its
+// entities may be read without credentials
+const PublicReadTag = "public:read"
+
+// PublicDatasets holds the datasets published with the public:read tag.
+// Like durability settings, the tag is observed from dataset entities as
+// those are indexed, so adding or removing it takes effect immediately.
+type PublicDatasets struct {
+	mu     sync.RWMutex
+	owners map[string]string // dataset entity ID -> dataset name
+	names  map[string]int    // dataset name -> public dataset entities
+}
+
+// NewPublicDatasets creates an empty set of public datasets
+func NewPublicDatasets() *PublicDatasets {
+	return &PublicDatasets{
+		owners: make(map[string]string),
+		names:  make(map[string]int),
+	}
+}
+
+// Observe records whether a dataset entity publishes its dataset. Only
+// system dataset records can publish one.
+func (p *PublicDatasets) Observe(entity *models.Entity) {
+	if p == nil || entity == nil {
+		return
+	}
+	name := ""
+	if isSystemDatasetRecord(entity) && entity.GetTagValue("public") == "read" {
+		name = entity.GetTagValue("name")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removeLocked(entity.ID)
+	if name != "" {
+		p.owners[entity.ID] = name
+		p.names[name]++
+	}
+}
+
+// Remove drops a deleted dataset entity
+func (p *PublicDatasets) Remove(entityID string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removeLocked(entityID)
+}
+
+func (p *PublicDatasets) removeLocked(entityID string) {
+	name, ok := p.owners[entityID]
+	if !ok {
+		return
+	}
+	delete(p.owners, entityID)
+	if p.names[name]--; p.names[name] <= 0 {
+		delete(p.names, name)
+	}
+}
+
+// IsPublic reports whether a dataset is published read-only
+func (p *PublicDatasets) IsPublic(dataset string) bool {
+	if p == nil || dataset == "" {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.names[dataset] > 0
+}
+
+// IsPublicDataset reports whether a dataset is published read-only with
+// the public:read tag of its dataset entity
+func (r *EntityRepository) IsPublicDataset(dataset string) bool {
+	return r.publicDatasets.IsPublic(dataset)
+}
@@ -0,0 +1,78 @@
+package binary
+
+import (
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestPublicDatasets checks that the public:read tag of a dataset entity
+// publishes its dataset, and that updating or deleting the entity
+// withdraws it
+func TestPublicDatasets(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	dataset := &models.Entity{
+		ID:   "catalog-dataset",
+		Tags: []string{"type:dataset", "dataset:system", "name:catalog", PublicReadTag},
+	}
+	if err := repo.Create(dataset); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	if !repo.IsPublicDataset("catalog") {
+		t.Fatal("dataset with public:read is not public")
+	}
+	if repo.IsPublicDataset("private") {
+		t.Error("unknown dataset is public")
+	}
+
+	// A plain entity carrying the tag does not publish its dataset
+	if err := repo.Create(&models.Entity{
+		ID:   "stray",
+		Tags: []string{"type:document", "dataset:private", "name:private", PublicReadTag},
+	}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	if repo.IsPublicDataset("private") {
+		t.Error("document with public:read published its dataset")
+	}
+
+	// Nor does a dataset lookalike outside the system dataset, which any
+	// writer of its own dataset could create
+	if err := repo.Create(&models.Entity{
+		ID:   "lookalike",
+		Tags: []string{"type:dataset", "dataset:mine", "name:payroll", PublicReadTag},
+	}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	if repo.IsPublicDataset("payroll") {
+		t.Error("dataset lookalike outside the system dataset published payroll")
+	}
+
+	dataset.Tags = []string{"type:dataset", "dataset:system", "name:catalog"}
+	if err := repo.Update(dataset); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if repo.IsPublicDataset("catalog") {
+		t.Error("dataset is still public after public:read was removed")
+	}
+
+	if err := repo.AddTag(dataset.ID, PublicReadTag); err != nil {
+		t.Fatalf("AddTag: %v", err)
+	}
+	flushWrites(t, repo)
+	if !repo.IsPublicDataset("catalog") {
+		t.Error("dataset is not public after public:read was added")
+	}
+
+	if err := repo.Delete(dataset.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if repo.IsPublicDataset("catalog") {
+		t.Error("deleted dataset is still public")
+	}
+}
@@ -0,0 +1,35 @@
+package binary
+
+import (
+	"entitydb/models"
+)
+
+// SystemDataset holds the dataset entities. Only those records configure a
+// dataset: an entity in any other dataset may carry the same tags and
+// settings, but anyone who can write to that dataset could then publish,
+// freeze or re-quota a dataset they do not administer. The API refuses
+// system dataset writes outside the dataset endpoints to users who may not
+// update datasets, so the records are written by dataset administrators.
+const SystemDataset = models.SystemDataset
+
+// isSystemDatasetRecord reports whether an entity is a dataset entity of the
+// system dataset, whose tags and settings configure the dataset it names
+func isSystemDatasetRecord(entity *models.Entity) bool {
+	return entity.GetTagValue("type") == "dataset" && entity.GetDataset() == SystemDataset
+}
+
+// observeDatasetRecord applies the durability, public read and write-once
+// settings of an indexed entity. Observers drop the settings an entity no
+// longer records, so every indexed entity is observed.
+func (r *EntityRepository) observeDatasetRecord(entity *models.Entity) {
+	r.datasetDurability.Observe(entity)
+	r.publicDatasets.Observe(entity)
+	r.writeOnceDatasets.Observe(entity)
+}
+
+// forgetDatasetRecord drops the settings of a deleted entity
+func (r *EntityRepository) forgetDatasetRecord(id string) {
+	r.datasetDurability.Remove(id)
+	r.publicDatasets.Remove(id)
+	r.writeOnceDatasets.Remove(id)
+}
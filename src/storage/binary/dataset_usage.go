@@ -0,0 +1,394 @@
+package binary
+
+import (
+	"encoding/json"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dataset quota modes
+const (
+	// DatasetQuotaModeWarn logs writes that exceed a quota and accepts them
+	DatasetQuotaModeWarn = "warn"
+	// DatasetQuotaModeReject refuses writes that would exceed a quota
+	DatasetQuotaModeReject = "reject"
+)
+
+// Dataset settings that override the configured quota for one dataset
+const (
+	datasetQuotaEntitiesSetting = "quota_max_entities"
+	datasetQuotaBytesSetting    = "quota_max_bytes"
+	datasetQuotaModeSetting     = "quota_mode"
+)
+
+// untimestampedTagOverhead is the "<unix nanos>|" prefix a tag gains when it is stored
+const untimestampedTagOverhead = 20
+
+// datasetQuotaWarnInterval limits how often an over-quota dataset is logged
+const datasetQuotaWarnInterval = time.Minute
+
+// ErrDatasetQuotaExceeded is returned when a write would take a dataset past
+// a quota enforced in reject mode
+var ErrDatasetQuotaExceeded = errors.New("dataset quota exceeded")
+
+// DatasetQuota limits the size of a dataset. Zero limits are unlimited.
+type DatasetQuota struct {
+	MaxEntities int64  `json:"max_entities"`
+	MaxBytes    int64  `json:"max_bytes"`
+	Mode        string `json:"mode"`
+}
+
+// unlimited reports whether the quota sets no limits
+func (q DatasetQuota) unlimited() bool {
+	return q.MaxEntities <= 0 && q.MaxBytes <= 0
+}
+
+// DatasetUsage reports the storage used by one dataset
+type DatasetUsage struct {
+	Dataset       string       `json:"dataset"`
+	Entities      int64        `json:"entities"`
+	ContentBytes  int64        `json:"content_bytes"`
+	TagBytes      int64        `json:"tag_bytes"`
+	TotalBytes    int64        `json:"total_bytes"`
+	Quota         DatasetQuota `json:"quota"`
+	QuotaExceeded bool         `json:"quota_exceeded"`
+}
+
+// datasetUsageEntry is one entity's contribution to its dataset's usage
+type datasetUsageEntry struct {
+	dataset      string
+	contentBytes int64
+	tagBytes     int64
+}
+
+// datasetUsageTotals holds the running totals of one dataset
+type datasetUsageTotals struct {
+	entities     int64
+	contentBytes int64
+	tagBytes     int64
+}
+
+// DatasetUsageTracker maintains entity counts and content and tag bytes per
+// dataset. Totals are adjusted on every indexed write from the difference
+// between the entity's previous and current contribution, so they never need
+// a scan after the startup index build.
+//
+// Quotas default to the configured limits. A dataset entity can override them
+// with the quota_max_entities, quota_max_bytes and quota_mode settings. The
+// system dataset is exempt from the configured defaults so that a full
+// dataset quota cannot lock users out.
+type DatasetUsageTracker struct {
+	mu       sync.RWMutex
+	defaults DatasetQuota
+	entries  map[string]datasetUsageEntry
+	totals   map[string]*datasetUsageTotals
+
+	// overrides maps dataset names to quotas set in dataset settings;
+	// overrideOwners maps the dataset entity that set them to its dataset name
+	overrides      map[string]DatasetQuota
+	overrideOwners map[string]string
+
+	lastWarned map[string]time.Time
+}
+
+// NewDatasetUsageTracker creates a tracker enforcing the given default quota
+func NewDatasetUsageTracker(defaults DatasetQuota) *DatasetUsageTracker {
+	if defaults.Mode != DatasetQuotaModeReject {
+		defaults.Mode = DatasetQuotaModeWarn
+	}
+	return &DatasetUsageTracker{
+		defaults:       defaults,
+		entries:        make(map[string]datasetUsageEntry),
+		totals:         make(map[string]*datasetUsageTotals),
+		overrides:      make(map[string]DatasetQuota),
+		overrideOwners: make(map[string]string),
+		lastWarned:     make(map[string]time.Time),
+	}
+}
+
+// measureEntity returns an entity's contribution to its dataset's usage
+func measureEntity(entity *models.Entity) datasetUsageEntry {
+	entry := datasetUsageEntry{
+		dataset:      entity.GetDataset(),
+		contentBytes: int64(len(entity.Content)),
+	}
+	for _, tag := range entity.Tags {
+		entry.tagBytes += int64(len(tag))
+		if !strings.Contains(tag, "|") {
+			entry.tagBytes += untimestampedTagOverhead
+		}
+	}
+	return entry
+}
+
+// Observe replaces an entity's contribution with its current size
+func (t *DatasetUsageTracker) Observe(entity *models.Entity) {
+	if t == nil || entity == nil {
+		return
+	}
+	entry := measureEntity(entity)
+	override, owned := datasetQuotaOverride(entity)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(entity.ID)
+	if entry.dataset != "" {
+		totals := t.totalsLocked(entry.dataset)
+		totals.entities++
+		totals.contentBytes += entry.contentBytes
+		totals.tagBytes += entry.tagBytes
+		t.entries[entity.ID] = entry
+	}
+	if owned {
+		t.overrides[override.name] = override.quota
+		t.overrideOwners[entity.ID] = override.name
+	}
+}
+
+// ObserveTag adds a tag appended to an entity without a full rewrite
+func (t *DatasetUsageTracker) ObserveTag(entityID, tag string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[entityID]
+	if !ok {
+		return
+	}
+	entry.tagBytes += int64(len(tag))
+	t.entries[entityID] = entry
+	t.totalsLocked(entry.dataset).tagBytes += int64(len(tag))
+}
+
+// Remove drops an entity's contribution
+func (t *DatasetUsageTracker) Remove(entityID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(entityID)
+}
+
+func (t *DatasetUsageTracker) removeLocked(entityID string) {
+	if entry, ok := t.entries[entityID]; ok {
+		if totals, ok := t.totals[entry.dataset]; ok {
+			totals.entities--
+			totals.contentBytes -= entry.contentBytes
+			totals.tagBytes -= entry.tagBytes
+			if totals.entities <= 0 {
+				delete(t.totals, entry.dataset)
+			}
+		}
+		delete(t.entries, entityID)
+	}
+	if name, ok := t.overrideOwners[entityID]; ok {
+		delete(t.overrides, name)
+		delete(t.overrideOwners, entityID)
+	}
+}
+
+func (t *DatasetUsageTracker) totalsLocked(dataset string) *datasetUsageTotals {
+	totals, ok := t.totals[dataset]
+	if !ok {
+		totals = &datasetUsageTotals{}
+		t.totals[dataset] = totals
+	}
+	return totals
+}
+
+// quotaLocked returns the quota that applies to a dataset
+func (t *DatasetUsageTracker) quotaLocked(dataset string) DatasetQuota {
+	if quota, ok := t.overrides[dataset]; ok {
+		return quota
+	}
+	if dataset == "system" {
+		return DatasetQuota{Mode: t.defaults.Mode}
+	}
+	return t.defaults
+}
+
+// usageLocked builds the usage report of a dataset
+func (t *DatasetUsageTracker) usageLocked(dataset string) DatasetUsage {
+	usage := DatasetUsage{Dataset: dataset, Quota: t.quotaLocked(dataset)}
+	if totals, ok := t.totals[dataset]; ok {
+		usage.Entities = totals.entities
+		usage.ContentBytes = totals.contentBytes
+		usage.TagBytes = totals.tagBytes
+	}
+	usage.TotalBytes = usage.ContentBytes + usage.TagBytes
+	usage.QuotaExceeded = quotaExceeded(usage.Quota, usage.Entities, usage.TotalBytes)
+	return usage
+}
+
+// quotaExceeded reports whether a count or size is past a quota
+func quotaExceeded(quota DatasetQuota, entities, bytes int64) bool {
+	return (quota.MaxEntities > 0 && entities > quota.MaxEntities) ||
+		(quota.MaxBytes > 0 && bytes > quota.MaxBytes)
+}
+
+// Usage returns the usage of one dataset
+func (t *DatasetUsageTracker) Usage(dataset string) DatasetUsage {
+	if t == nil {
+		return DatasetUsage{Dataset: dataset}
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.usageLocked(dataset)
+}
+
+// All returns the usage of every dataset holding entities, sorted by name
+func (t *DatasetUsageTracker) All() []DatasetUsage {
+	if t == nil {
+		return []DatasetUsage{}
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	result := make([]DatasetUsage, 0, len(t.totals))
+	for dataset := range t.totals {
+		result = append(result, t.usageLocked(dataset))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Dataset < result[j].Dataset })
+	return result
+}
+
+// Check reports whether writing entity would take its dataset past its quota.
+// Writes that do not grow the dataset always pass. In reject mode an exceeded
+// quota returns ErrDatasetQuotaExceeded; in warn mode it is logged.
+func (t *DatasetUsageTracker) Check(entity *models.Entity) error {
+	if t == nil || entity == nil {
+		return nil
+	}
+	entry := measureEntity(entity)
+	if entry.dataset == "" {
+		return nil
+	}
+
+	t.mu.RLock()
+	previous, exists := t.entries[entity.ID]
+	t.mu.RUnlock()
+
+	entityDelta := int64(1)
+	byteDelta := entry.contentBytes + entry.tagBytes
+	if exists && previous.dataset == entry.dataset {
+		entityDelta = 0
+		byteDelta -= previous.contentBytes + previous.tagBytes
+	}
+	return t.check(entry.dataset, entityDelta, byteDelta)
+}
+
+// CheckTag reports whether appending a tag would take the entity's dataset past its quota
+func (t *DatasetUsageTracker) CheckTag(entityID, tag string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	entry, ok := t.entries[entityID]
+	t.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	delta := int64(len(tag))
+	if !strings.Contains(tag, "|") {
+		delta += untimestampedTagOverhead
+	}
+	return t.check(entry.dataset, 0, delta)
+}
+
+func (t *DatasetUsageTracker) check(dataset string, entityDelta, byteDelta int64) error {
+	if entityDelta <= 0 && byteDelta <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usage := t.usageLocked(dataset)
+	if usage.Quota.unlimited() {
+		return nil
+	}
+
+	var reason string
+	switch {
+	case entityDelta > 0 && usage.Quota.MaxEntities > 0 && usage.Entities+entityDelta > usage.Quota.MaxEntities:
+		reason = fmt.Sprintf("dataset %s would hold %d entities, quota is %d",
+			dataset, usage.Entities+entityDelta, usage.Quota.MaxEntities)
+	case byteDelta > 0 && usage.Quota.MaxBytes > 0 && usage.TotalBytes+byteDelta > usage.Quota.MaxBytes:
+		reason = fmt.Sprintf("dataset %s would use %d bytes, quota is %d",
+			dataset, usage.TotalBytes+byteDelta, usage.Quota.MaxBytes)
+	default:
+		return nil
+	}
+
+	if usage.Quota.Mode == DatasetQuotaModeReject {
+		return fmt.Errorf("%w: %s", ErrDatasetQuotaExceeded, reason)
+	}
+	if time.Since(t.lastWarned[dataset]) >= datasetQuotaWarnInterval {
+		t.lastWarned[dataset] = time.Now()
+		logger.Warn("Dataset quota exceeded: %s", reason)
+	}
+	return nil
+}
+
+// namedDatasetQuota is a quota override and the dataset it applies to
+type namedDatasetQuota struct {
+	name  string
+	quota DatasetQuota
+}
+
+// datasetQuotaOverride reads the quota settings of a dataset entity. It
+// reports false for other entities, including dataset lookalikes outside the
+// system dataset, and for datasets without quota settings.
+func datasetQuotaOverride(entity *models.Entity) (namedDatasetQuota, bool) {
+	if !isSystemDatasetRecord(entity) {
+		return namedDatasetQuota{}, false
+	}
+	name := entity.GetTagValue("name")
+	if name == "" || len(entity.Content) == 0 {
+		return namedDatasetQuota{}, false
+	}
+
+	var content struct {
+		Settings map[string]string `json:"settings"`
+	}
+	if err := json.Unmarshal(entity.Content, &content); err != nil {
+		return namedDatasetQuota{}, false
+	}
+	settings := content.Settings
+
+	var quota DatasetQuota
+	found := false
+	if v, err := strconv.ParseInt(settings[datasetQuotaEntitiesSetting], 10, 64); err == nil {
+		quota.MaxEntities = v
+		found = true
+	}
+	if v, err := strconv.ParseInt(settings[datasetQuotaBytesSetting], 10, 64); err == nil {
+		quota.MaxBytes = v
+		found = true
+	}
+	if !found {
+		return namedDatasetQuota{}, false
+	}
+	quota.Mode = DatasetQuotaModeWarn
+	if settings[datasetQuotaModeSetting] == DatasetQuotaModeReject {
+		quota.Mode = DatasetQuotaModeReject
+	}
+	return namedDatasetQuota{name: name, quota: quota}, true
+}
+
+// GetDatasetUsage returns the storage used by a dataset and its quota
+func (r *EntityRepository) GetDatasetUsage(dataset string) DatasetUsage {
+	return r.datasetUsage.Usage(dataset)
+}
+
+// GetAllDatasetUsage returns the storage used by every dataset
+func (r *EntityRepository) GetAllDatasetUsage() []DatasetUsage {
+	return r.datasetUsage.All()
+}
@@ -0,0 +1,93 @@
+package binary
+
+import (
+	"errors"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestDatasetUsageTracker checks that usage follows creates, updates, tag
+// additions and deletes without double counting rewritten entities
+func TestDatasetUsageTracker(t *testing.T) {
+	tracker := NewDatasetUsageTracker(DatasetQuota{})
+	entity := &models.Entity{ID: "a", Tags: []string{"1|dataset:orders"}, Content: []byte("12345")}
+
+	tracker.Observe(entity)
+	tracker.Observe(entity)
+	usage := tracker.Usage("orders")
+	if usage.Entities != 1 || usage.ContentBytes != 5 || usage.TagBytes != 16 {
+		t.Fatalf("usage after create = %+v, want 1 entity, 5 content and 16 tag bytes", usage)
+	}
+
+	entity.Content = []byte("123")
+	tracker.Observe(entity)
+	tracker.ObserveTag("a", "2|status:new")
+	usage = tracker.Usage("orders")
+	if usage.ContentBytes != 3 || usage.TagBytes != 28 || usage.TotalBytes != 31 {
+		t.Fatalf("usage after update = %+v, want 3 content and 28 tag bytes", usage)
+	}
+
+	tracker.Remove("a")
+	if usage = tracker.Usage("orders"); usage.Entities != 0 || usage.TotalBytes != 0 {
+		t.Fatalf("usage after delete = %+v, want empty", usage)
+	}
+	if all := tracker.All(); len(all) != 0 {
+		t.Errorf("datasets after delete = %v, want none", all)
+	}
+}
+
+// TestDatasetQuota checks that reject mode refuses growing writes, warn mode
+// accepts them, and dataset settings override the configured limits
+func TestDatasetQuota(t *testing.T) {
+	tracker := NewDatasetUsageTracker(DatasetQuota{MaxEntities: 1, Mode: DatasetQuotaModeReject})
+	first := &models.Entity{ID: "a", Tags: []string{"1|dataset:orders"}}
+	second := &models.Entity{ID: "b", Tags: []string{"1|dataset:orders"}}
+
+	if err := tracker.Check(first); err != nil {
+		t.Fatalf("first create rejected: %v", err)
+	}
+	tracker.Observe(first)
+	if err := tracker.Check(second); !errors.Is(err, ErrDatasetQuotaExceeded) {
+		t.Fatalf("second create error = %v, want ErrDatasetQuotaExceeded", err)
+	}
+	if err := tracker.Check(first); err != nil {
+		t.Errorf("rewrite of an existing entity rejected: %v", err)
+	}
+	if err := tracker.Check(&models.Entity{ID: "c", Tags: []string{"1|dataset:system"}}); err != nil {
+		t.Errorf("system dataset limited by configured default: %v", err)
+	}
+
+	dataset := &models.Entity{
+		ID:      "orders-dataset",
+		Tags:    []string{"1|type:dataset", "1|dataset:system", "1|name:orders"},
+		Content: []byte(`{"settings":{"quota_max_entities":"10","quota_max_bytes":"20","quota_mode":"warn"}}`),
+	}
+	tracker.Observe(dataset)
+	if quota := tracker.Usage("orders").Quota; quota.MaxEntities != 10 || quota.MaxBytes != 20 || quota.Mode != DatasetQuotaModeWarn {
+		t.Fatalf("orders quota = %+v, want the dataset settings", quota)
+	}
+	big := &models.Entity{ID: "d", Tags: []string{"1|dataset:orders"}, Content: make([]byte, 64)}
+	if err := tracker.Check(big); err != nil {
+		t.Errorf("warn mode rejected a write: %v", err)
+	}
+	tracker.Observe(big)
+	if !tracker.Usage("orders").QuotaExceeded {
+		t.Error("orders not reported over its byte quota")
+	}
+
+	// Dataset lookalikes outside the system dataset do not set quotas
+	tracker.Observe(&models.Entity{
+		ID:      "lookalike",
+		Tags:    []string{"1|type:dataset", "1|dataset:mine", "1|name:orders"},
+		Content: []byte(`{"settings":{"quota_max_entities":"1000"}}`),
+	})
+	if quota := tracker.Usage("orders").Quota; quota.MaxEntities != 10 {
+		t.Errorf("orders quota after a lookalike = %+v, want the dataset settings", quota)
+	}
+
+	tracker.Remove("orders-dataset")
+	if quota := tracker.Usage("orders").Quota; quota.MaxEntities != 1 {
+		t.Errorf("orders quota after dataset delete = %+v, want the default", quota)
+	}
+}
@@ -0,0 +1,196 @@
+package binary
+
+import (
+	"context"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// WriteOnceTag on a dataset entity makes its dataset write-once (WORM):
+// entities can be created in it and gain tags, but their content and
+// existing tags never change and they cannot leave the dataset or be
+// deleted. The tag cannot be removed from the dataset entity, nor can the
+// dataset entity be deleted, so the mode cannot be switched off.
+const WriteOnceTag = "write:once"
+
+// ErrWriteOnce is returned for writes a write-once dataset refuses
+var ErrWriteOnce = errors.New("write-once dataset")
+
+// writeOnceFrozenTagPrefixes are tags an entity in a write-once dataset
+// cannot gain: they would move it out of the dataset or delete it
+var writeOnceFrozenTagPrefixes = []string{"dataset:", "lifecycle:state:"}
+
+// WriteOnceDatasets holds the datasets made write-once with the write:once
+// tag. Like public datasets, the tag is observed from dataset entities as
+// those are indexed, so adding it takes effect immediately.
+type WriteOnceDatasets struct {
+	mu     sync.RWMutex
+	owners map[string]string // dataset entity ID -> dataset name
+	names  map[string]int    // dataset name -> write-once dataset entities
+}
+
+// NewWriteOnceDatasets creates an empty set of write-once datasets
+func NewWriteOnceDatasets() *WriteOnceDatasets {
+	return &WriteOnceDatasets{
+		owners: make(map[string]string),
+		names:  make(map[string]int),
+	}
+}
+
+// Observe records whether a dataset entity makes its dataset write-once.
+// Only system dataset records can make one write-once.
+func (wo *WriteOnceDatasets) Observe(entity *models.Entity) {
+	if wo == nil || entity == nil {
+		return
+	}
+	name := ""
+	if isSystemDatasetRecord(entity) && entity.HasTag(WriteOnceTag) {
+		name = entity.GetTagValue("name")
+	}
+
+	wo.mu.Lock()
+	defer wo.mu.Unlock()
+	wo.removeLocked(entity.ID)
+	if name != "" {
+		wo.owners[entity.ID] = name
+		wo.names[name]++
+	}
+}
+
+// Remove drops a deleted dataset entity
+func (wo *WriteOnceDatasets) Remove(entityID string) {
+	if wo == nil {
+		return
+	}
+	wo.mu.Lock()
+	defer wo.mu.Unlock()
+	wo.removeLocked(entityID)
+}
+
+func (wo *WriteOnceDatasets) removeLocked(entityID string) {
+	name, ok := wo.owners[entityID]
+	if !ok {
+		return
+	}
+	delete(wo.owners, entityID)
+	if wo.names[name]--; wo.names[name] <= 0 {
+		delete(wo.names, name)
+	}
+}
+
+// IsWriteOnce reports whether a dataset is write-once
+func (wo *WriteOnceDatasets) IsWriteOnce(dataset string) bool {
+	if wo == nil || dataset == "" {
+		return false
+	}
+	wo.mu.RLock()
+	defer wo.mu.RUnlock()
+	return wo.names[dataset] > 0
+}
+
+// IsWriteOnceDataset reports whether a dataset is made write-once with the
+// write:once tag of its dataset entity
+func (r *EntityRepository) IsWriteOnceDataset(dataset string) bool {
+	return r.writeOnceDatasets.IsWriteOnce(dataset)
+}
+
+// checkWriteOnce refuses an update that a write-once dataset does not
+// allow: in such a dataset an update may only append tags, keeping every
+// existing tag and the content. Dataset entities cannot drop their
+// write:once tag.
+func (r *EntityRepository) checkWriteOnce(ctx context.Context, entity *models.Entity) error {
+	existing, err := r.GetByIDContext(ctx, entity.ID)
+	if err != nil {
+		// Missing entities are reported by the update itself
+		return nil
+	}
+	if isSystemDatasetRecord(existing) && existing.HasTag(WriteOnceTag) && !entity.HasTag(WriteOnceTag) {
+		return fmt.Errorf("%w: the write:once tag of dataset %s cannot be removed", ErrWriteOnce, existing.GetTagValue("name"))
+	}
+
+	dataset := existing.GetDataset()
+	if !r.writeOnceDatasets.IsWriteOnce(dataset) {
+		return nil
+	}
+	if existing == entity {
+		// The caller changed the cached entity itself, so the stored
+		// version is the baseline. Entities of write-once datasets only
+		// gain tags, so a stored version older than the cache still is.
+		if existing, err = r.readEntity(entity.ID); err != nil {
+			return fmt.Errorf("%w: entity %s in dataset %s cannot be verified: %v", ErrWriteOnce, entity.ID, dataset, err)
+		}
+	}
+	if string(entity.Content) != string(existing.Content) {
+		return fmt.Errorf("%w: the content of entity %s in dataset %s cannot change", ErrWriteOnce, entity.ID, dataset)
+	}
+
+	// Updates replace the tag set and stamp tags afresh, so tags are
+	// compared without their timestamps
+	kept := make(map[string]bool, len(entity.Tags))
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		kept[tag] = true
+	}
+	existingTags := make(map[string]bool, len(existing.Tags))
+	for _, tag := range existing.GetTagsWithoutTimestamp() {
+		existingTags[tag] = true
+		// Signatures are replaced whenever an entity is signed
+		if !kept[tag] && !strings.HasPrefix(tag, SignatureTagPrefix) {
+			return fmt.Errorf("%w: tag %s of entity %s in dataset %s cannot be removed or replaced", ErrWriteOnce, tag, entity.ID, dataset)
+		}
+	}
+	for tag := range kept {
+		if !existingTags[tag] {
+			if err := writeOnceTagAllowed(entity.ID, dataset, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkWriteOnceTag refuses adding a tag that would move an entity out of a
+// write-once dataset or change its lifecycle state
+func (r *EntityRepository) checkWriteOnceTag(entityID, tag string) error {
+	existing, err := r.GetByID(entityID)
+	if err != nil {
+		return nil
+	}
+	dataset := existing.GetDataset()
+	if !r.writeOnceDatasets.IsWriteOnce(dataset) {
+		return nil
+	}
+	return writeOnceTagAllowed(entityID, dataset, tag)
+}
+
+// checkWriteOnceDelete refuses deleting an entity of a write-once dataset,
+// or the dataset entity making a dataset write-once
+func (r *EntityRepository) checkWriteOnceDelete(id string) error {
+	existing, err := r.GetByID(id)
+	if err != nil {
+		return nil
+	}
+	if isSystemDatasetRecord(existing) && existing.HasTag(WriteOnceTag) {
+		return fmt.Errorf("%w: dataset %s cannot be deleted", ErrWriteOnce, existing.GetTagValue("name"))
+	}
+	if dataset := existing.GetDataset(); r.writeOnceDatasets.IsWriteOnce(dataset) {
+		return fmt.Errorf("%w: entity %s in dataset %s cannot be deleted", ErrWriteOnce, id, dataset)
+	}
+	return nil
+}
+
+// writeOnceTagAllowed refuses tags an entity in a write-once dataset
+// cannot gain
+func writeOnceTagAllowed(entityID, dataset, tag string) error {
+	if idx := strings.Index(tag, "|"); idx != -1 {
+		tag = tag[idx+1:]
+	}
+	for _, prefix := range writeOnceFrozenTagPrefixes {
+		if strings.HasPrefix(tag, prefix) {
+			return fmt.Errorf("%w: entity %s in dataset %s cannot gain tag %s", ErrWriteOnce, entityID, dataset, tag)
+		}
+	}
+	return nil
+}
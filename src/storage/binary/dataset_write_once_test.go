@@ -0,0 +1,117 @@
+package binary
+
+import (
+	"errors"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestWriteOnceDatasets checks that entities of a dataset made write-once
+// with the write:once tag can be created and gain tags, but cannot be
+// changed, moved or deleted, and that the mode cannot be switched off
+func TestWriteOnceDatasets(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	dataset := &models.Entity{
+		ID:   "ledger-dataset",
+		Tags: []string{"type:dataset", "dataset:system", "name:ledger", WriteOnceTag},
+	}
+	if err := repo.Create(dataset); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	entry := &models.Entity{
+		ID:      "ledger-entry",
+		Tags:    []string{"type:entry", "dataset:ledger", "amount:10"},
+		Content: []byte("debit"),
+	}
+	if err := repo.Create(entry); err != nil {
+		t.Fatalf("Create in write-once dataset: %v", err)
+	}
+	flushWrites(t, repo)
+	if !repo.IsWriteOnceDataset("ledger") {
+		t.Fatal("dataset with write:once is not write-once")
+	}
+
+	// Temporal tags keep accumulating
+	if err := repo.AddTag(entry.ID, "reviewed:true"); err != nil {
+		t.Fatalf("AddTag: %v", err)
+	}
+	flushWrites(t, repo)
+
+	current, err := repo.GetByID(entry.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	changes := map[string]*models.Entity{
+		"replace tag": {ID: entry.ID, Tags: []string{"type:entry", "dataset:ledger", "amount:20"}, Content: []byte("debit")},
+		"content":     {ID: entry.ID, Tags: current.Tags, Content: []byte("credit")},
+		"move":        {ID: entry.ID, Tags: append(append([]string{}, current.Tags...), "dataset:other"), Content: []byte("debit")},
+	}
+	for name, change := range changes {
+		if err := repo.Update(change); !errors.Is(err, ErrWriteOnce) {
+			t.Errorf("%s: Update returned %v, want ErrWriteOnce", name, err)
+		}
+	}
+	if err := repo.AddTag(entry.ID, "lifecycle:state:soft_deleted"); !errors.Is(err, ErrWriteOnce) {
+		t.Errorf("AddTag lifecycle state returned %v, want ErrWriteOnce", err)
+	}
+	if err := repo.Delete(entry.ID); !errors.Is(err, ErrWriteOnce) {
+		t.Errorf("Delete returned %v, want ErrWriteOnce", err)
+	}
+
+	// Appending through Update is allowed too
+	appended := &models.Entity{ID: entry.ID, Tags: append(append([]string{}, current.Tags...), "note:checked"), Content: []byte("debit")}
+	if err := repo.Update(appended); err != nil {
+		t.Errorf("Update appending a tag: %v", err)
+	}
+
+	// Changing the cached entity in place does not get past the check;
+	// this runs last as it leaves the cache changed
+	cached, err := repo.GetByID(entry.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	cached.AddTag("lifecycle:state:soft_deleted")
+	if err := repo.Update(cached); !errors.Is(err, ErrWriteOnce) {
+		t.Errorf("Update of the cached entity returned %v, want ErrWriteOnce", err)
+	}
+
+	// Entities outside the dataset are unaffected
+	other := &models.Entity{ID: "draft", Tags: []string{"type:entry", "dataset:drafts"}}
+	if err := repo.Create(other); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	other.Tags = []string{"type:entry", "dataset:drafts", "amount:5"}
+	if err := repo.Update(other); err != nil {
+		t.Errorf("Update outside write-once dataset: %v", err)
+	}
+
+	// A dataset lookalike outside the system dataset does not freeze the
+	// dataset it names, and can be deleted like any entity
+	lookalike := &models.Entity{ID: "lookalike", Tags: []string{"type:dataset", "dataset:mine", "name:drafts", WriteOnceTag}}
+	if err := repo.Create(lookalike); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	if repo.IsWriteOnceDataset("drafts") {
+		t.Error("dataset lookalike outside the system dataset made drafts write-once")
+	}
+	if err := repo.Delete(lookalike.ID); err != nil {
+		t.Errorf("Delete of dataset lookalike: %v", err)
+	}
+
+	// Dropping write:once is itself a change to the dataset and is refused
+	unlocked := &models.Entity{ID: dataset.ID, Tags: []string{"type:dataset", "dataset:system", "name:ledger"}}
+	if err := repo.Update(unlocked); !errors.Is(err, ErrWriteOnce) {
+		t.Errorf("removing write:once returned %v, want ErrWriteOnce", err)
+	}
+	if err := repo.Delete(dataset.ID); !errors.Is(err, ErrWriteOnce) {
+		t.Errorf("deleting write-once dataset returned %v, want ErrWriteOnce", err)
+	}
+	if !repo.IsWriteOnceDataset("ledger") {
+		t.Error("dataset is no longer write-once")
+	}
+}
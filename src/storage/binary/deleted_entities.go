@@ -0,0 +1,81 @@
+package binary
+
+import (
+	"entitydb/models"
+	"strings"
+)
+
+// lifecycleTagPrefix marks lifecycle tags. Lookups of these tags are how
+// deleted entities are found, so they always include deleted entities.
+const lifecycleTagPrefix = "lifecycle:"
+
+// isDeletedLifecycleState reports whether entities in a state are hidden from tag lookups
+func isDeletedLifecycleState(state models.EntityLifecycleState) bool {
+	return state == models.StateSoftDeleted || state == models.StateArchived || state == models.StatePurged
+}
+
+// syncDeletionState marks an entity deleted or active in the tag index
+// according to its current lifecycle state. Cached tag queries are dropped
+// when the entity's visibility changes.
+func (r *EntityRepository) syncDeletionState(entity *models.Entity) {
+	r.setDeleted(entity.ID, isDeletedLifecycleState(entity.GetLifecycleState()))
+}
+
+// syncDeletionStateForTag updates the deletion set when a lifecycle state tag
+// is added on its own. The added tag is always the most recent state.
+func (r *EntityRepository) syncDeletionStateForTag(entityID, tag string) {
+	if parts := strings.SplitN(tag, "|", 2); len(parts) == 2 {
+		tag = parts[1]
+	}
+	if !strings.HasPrefix(tag, "lifecycle:state:") {
+		return
+	}
+	state := strings.TrimPrefix(tag, "lifecycle:state:")
+	if !models.IsValidState(state) {
+		return
+	}
+	r.setDeleted(entityID, isDeletedLifecycleState(models.EntityLifecycleState(state)))
+}
+
+// setDeleted flips an entity's bit in the tag index deletion set
+func (r *EntityRepository) setDeleted(entityID string, deleted bool) {
+	var changed bool
+	if deleted {
+		changed = r.shardedTagIndex.MarkDeleted(entityID)
+	} else {
+		changed = r.shardedTagIndex.MarkActive(entityID)
+	}
+	if changed && r.cache != nil {
+		r.cache.Invalidate("tag:")
+	}
+}
+
+// filterDeletedForTag removes deleted entities from the results of a tag
+// lookup unless the tag is a lifecycle tag
+func (r *EntityRepository) filterDeletedForTag(tag string, ids []string) []string {
+	if strings.HasPrefix(tag, lifecycleTagPrefix) {
+		return ids
+	}
+	return r.shardedTagIndex.FilterDeleted(ids)
+}
+
+// IsEntityDeleted reports whether an entity is soft deleted, archived or
+// purged and therefore excluded from tag lookups
+func (r *EntityRepository) IsEntityDeleted(entityID string) bool {
+	return r.shardedTagIndex.IsDeleted(entityID)
+}
+
+// GetDeletedEntityCount returns the number of entities excluded from tag lookups
+func (r *EntityRepository) GetDeletedEntityCount() int {
+	return r.shardedTagIndex.DeletedCount()
+}
+
+// includesLifecycleTag reports whether any of the tags is a lifecycle tag
+func includesLifecycleTag(tags []string) bool {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, lifecycleTagPrefix) {
+			return true
+		}
+	}
+	return false
+}
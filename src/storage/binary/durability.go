@@ -0,0 +1,150 @@
+package binary
+
+import (
+	"context"
+	"encoding/json"
+	"entitydb/models"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DurabilityMode selects when a write is acknowledged
+type DurabilityMode string
+
+// Durability modes
+const (
+	// DurabilityRelaxed queues creates and tag additions in the batch writer,
+	// which logs each batch to the WAL with one fsync (group commit). The
+	// write returns before the batch is flushed.
+	DurabilityRelaxed DurabilityMode = "relaxed"
+	// DurabilityStrict flushes the batch writer after queueing a write, so
+	// the write is fsynced to the WAL before it returns
+	DurabilityStrict DurabilityMode = "strict"
+)
+
+// datasetDurabilitySetting is the dataset setting that selects the
+// durability mode of writes to the dataset
+const datasetDurabilitySetting = "durability"
+
+// ParseDurabilityMode parses "strict" or "relaxed", ignoring case
+func ParseDurabilityMode(s string) (DurabilityMode, error) {
+	switch mode := DurabilityMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case DurabilityStrict, DurabilityRelaxed:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown durability mode %q: use strict or relaxed", s)
+}
+
+// durabilityKey is the context key of a request's durability mode
+type durabilityKey struct{}
+
+// WithDurability returns a context whose writes use mode, overriding the
+// dataset and configured modes
+func WithDurability(ctx context.Context, mode DurabilityMode) context.Context {
+	return context.WithValue(ctx, durabilityKey{}, mode)
+}
+
+// DurabilityFrom returns the durability mode requested in ctx, if any
+func DurabilityFrom(ctx context.Context) (DurabilityMode, bool) {
+	mode, ok := ctx.Value(durabilityKey{}).(DurabilityMode)
+	return mode, ok
+}
+
+// DatasetDurability holds the durability modes datasets select with the
+// durability setting. Like quota overrides, they are observed from dataset
+// entities as those are indexed.
+type DatasetDurability struct {
+	mu     sync.RWMutex
+	modes  map[string]DurabilityMode // dataset name -> mode
+	owners map[string]string         // dataset entity ID -> dataset name
+}
+
+// NewDatasetDurability creates an empty set of dataset durability modes
+func NewDatasetDurability() *DatasetDurability {
+	return &DatasetDurability{
+		modes:  make(map[string]DurabilityMode),
+		owners: make(map[string]string),
+	}
+}
+
+// Observe records the durability setting of a dataset entity
+func (d *DatasetDurability) Observe(entity *models.Entity) {
+	if d == nil || entity == nil {
+		return
+	}
+	name, mode, ok := datasetDurabilityOverride(entity)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.removeLocked(entity.ID)
+	if ok {
+		d.modes[name] = mode
+		d.owners[entity.ID] = name
+	}
+}
+
+// Remove drops the setting of a deleted dataset entity
+func (d *DatasetDurability) Remove(entityID string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.removeLocked(entityID)
+}
+
+func (d *DatasetDurability) removeLocked(entityID string) {
+	if name, ok := d.owners[entityID]; ok {
+		delete(d.modes, name)
+		delete(d.owners, entityID)
+	}
+}
+
+// Mode returns the durability mode a dataset selects, if any
+func (d *DatasetDurability) Mode(dataset string) (DurabilityMode, bool) {
+	if d == nil || dataset == "" {
+		return "", false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	mode, ok := d.modes[dataset]
+	return mode, ok
+}
+
+// datasetDurabilityOverride reads the durability setting of a system dataset
+// record
+func datasetDurabilityOverride(entity *models.Entity) (string, DurabilityMode, bool) {
+	if !isSystemDatasetRecord(entity) {
+		return "", "", false
+	}
+	name := entity.GetTagValue("name")
+	if name == "" || len(entity.Content) == 0 {
+		return "", "", false
+	}
+	var content struct {
+		Settings map[string]string `json:"settings"`
+	}
+	if err := json.Unmarshal(entity.Content, &content); err != nil {
+		return "", "", false
+	}
+	mode, err := ParseDurabilityMode(content.Settings[datasetDurabilitySetting])
+	if err != nil {
+		return "", "", false
+	}
+	return name, mode, true
+}
+
+// writeDurability returns the durability mode of a write: the mode requested
+// in ctx, else the mode of the entity's dataset, else the configured mode
+func (r *EntityRepository) writeDurability(ctx context.Context, entity *models.Entity) DurabilityMode {
+	if mode, ok := DurabilityFrom(ctx); ok {
+		return mode
+	}
+	if entity != nil {
+		if mode, ok := r.datasetDurability.Mode(entity.GetDataset()); ok {
+			return mode
+		}
+	}
+	return r.durability
+}
@@ -0,0 +1,120 @@
+package binary
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"entitydb/config"
+	"entitydb/models"
+)
+
+// TestWriteDurability checks that strict writes bypass the batch writer,
+// relaxed writes are queued, and that the request mode overrides the
+// dataset's durability setting, which overrides the configured mode
+func TestWriteDurability(t *testing.T) {
+	repo := newTestRepository(t, func(cfg *config.Config) {
+		cfg.BatchWrites = true
+		cfg.BatchWriteSize = 1000
+		cfg.BatchFlushInterval = time.Hour
+		cfg.DurabilityMode = "relaxed"
+	})
+	defer repo.Close()
+
+	strict := WithDurability(context.Background(), DurabilityStrict)
+	relaxed := WithDurability(context.Background(), DurabilityRelaxed)
+	create := func(ctx context.Context, dataset string) *models.Entity {
+		t.Helper()
+		entity, err := models.NewEntityWithMandatoryTags("document", dataset, models.SystemUserID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.CreateContext(ctx, entity); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return entity
+	}
+
+	create(context.Background(), "default")
+	if pending := repo.batchWriter.PendingCount(); pending != 1 {
+		t.Fatalf("relaxed create left %d writes queued, want 1", pending)
+	}
+	flushWrites(t, repo)
+
+	entity := create(strict, "default")
+	if pending := repo.batchWriter.PendingCount(); pending != 0 {
+		t.Errorf("strict create left %d writes queued", pending)
+	}
+	if _, err := repo.GetByID(entity.ID); err != nil {
+		t.Errorf("GetByID of strict create: %v", err)
+	}
+
+	// A dataset selects strict writes with its durability setting
+	dataset := &models.Entity{
+		ID:      "payments-dataset",
+		Tags:    []string{"type:dataset", "dataset:system", "name:payments"},
+		Content: []byte(`{"settings":{"durability":"strict"}}`),
+	}
+	if err := repo.CreateContext(strict, dataset); err != nil {
+		t.Fatalf("Create dataset: %v", err)
+	}
+	create(context.Background(), "payments")
+	if pending := repo.batchWriter.PendingCount(); pending != 0 {
+		t.Errorf("create in a strict dataset left %d writes queued", pending)
+	}
+	create(relaxed, "payments")
+	if pending := repo.batchWriter.PendingCount(); pending != 1 {
+		t.Errorf("relaxed request in a strict dataset left %d writes queued, want 1", pending)
+	}
+	flushWrites(t, repo)
+
+	// Dataset lookalikes outside the system dataset select nothing
+	lookalike := &models.Entity{
+		ID:      "invoices-lookalike",
+		Tags:    []string{"type:dataset", "dataset:mine", "name:invoices"},
+		Content: []byte(`{"settings":{"durability":"strict"}}`),
+	}
+	if err := repo.CreateContext(strict, lookalike); err != nil {
+		t.Fatalf("Create lookalike: %v", err)
+	}
+	create(context.Background(), "invoices")
+	if pending := repo.batchWriter.PendingCount(); pending != 1 {
+		t.Errorf("create in a dataset named by a lookalike left %d writes queued, want 1", pending)
+	}
+}
+
+// TestParseDurabilityMode checks the accepted durability mode names
+func TestParseDurabilityMode(t *testing.T) {
+	for value, want := range map[string]DurabilityMode{
+		"strict":   DurabilityStrict,
+		"Relaxed":  DurabilityRelaxed,
+		" STRICT ": DurabilityStrict,
+	} {
+		if mode, err := ParseDurabilityMode(value); err != nil || mode != want {
+			t.Errorf("ParseDurabilityMode(%q) = %q, %v, want %q", value, mode, err, want)
+		}
+	}
+	if _, err := ParseDurabilityMode("eventual"); err == nil {
+		t.Error("ParseDurabilityMode accepted an unknown mode")
+	}
+}
+
+// TestCreateWithoutBatchWrites checks that creates complete with the batch
+// writer disabled, where every write goes straight to the WAL and data file
+func TestCreateWithoutBatchWrites(t *testing.T) {
+	repo := newTestRepository(t, func(cfg *config.Config) {
+		cfg.BatchWrites = false
+	})
+	defer repo.Close()
+
+	entity, err := models.NewEntityWithMandatoryTags("document", "default", models.SystemUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(entity); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := repo.GetByID(entity.ID); err != nil {
+		t.Errorf("GetByID: %v", err)
+	}
+}
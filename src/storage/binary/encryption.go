@@ -0,0 +1,405 @@
+package binary
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"entitydb/config"
+	"entitydb/logger"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Content Encryption
+//
+// Entity content can be encrypted at rest with envelope encryption. Every
+// write generates a random 256-bit data key, seals the (compressed) content
+// with it using AES-GCM, and seals the data key with the active master key.
+// Both are stored together, so rotating the master key only requires
+// re-sealing records, and a leaked data key exposes a single version of a
+// single entity. The entity ID is bound to both as additional data, which
+// stops a sealed record from being replayed under another entity.
+//
+// Sealed content layout:
+//
+//	[Magic:4 "EDBX"][Version:1][KeyIDLen:1][KeyID][WrappedKeyLen:2][WrappedKey][Nonce:12][Ciphertext+Tag]
+//
+// where WrappedKey is [Nonce:12][Sealed data key+Tag]. Entity records mark
+// sealed content with contentEncryptedFlag in their compression byte, WAL
+// entries with a flag bit in their operation byte.
+// Plaintext content may start with the magic too, so the flag alone tells
+// sealed content apart; the magic only checks that flagged content parses.
+
+const (
+	// contentEncryptedFlag is set in an entity record's compression byte
+	// when its content is sealed
+	contentEncryptedFlag = 0x80
+
+	sealedVersion  = 1
+	masterKeySize  = 32
+	dataKeySize    = 32
+	maxKeyIDLength = 64
+)
+
+var sealedMagic = []byte("EDBX")
+
+var (
+	// ErrNoEncryptionKeys is returned when sealed content is read without a
+	// key ring configured
+	ErrNoEncryptionKeys = errors.New("content is encrypted but no encryption keys are configured")
+
+	// ErrUnknownEncryptionKey is returned when sealed content names a master
+	// key that is not in the key ring
+	ErrUnknownEncryptionKey = errors.New("content is sealed with a master key that is not in the key ring")
+)
+
+// MasterKey is one key of the master key ring
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// ContentEncryptor seals and opens entity content with a master key ring
+type ContentEncryptor struct {
+	enabled  bool
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+// NewContentEncryptor creates an encryptor over keys. New content is sealed
+// with the key named activeID when enabled is true; when false the keys are
+// only used to read content sealed earlier.
+func NewContentEncryptor(keys []MasterKey, activeID string, enabled bool) (*ContentEncryptor, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("encryption key ring is empty")
+	}
+	e := &ContentEncryptor{
+		enabled:  enabled,
+		activeID: activeID,
+		keys:     make(map[string]cipher.AEAD, len(keys)),
+	}
+	for _, key := range keys {
+		if key.ID == "" || len(key.ID) > maxKeyIDLength || strings.ContainsAny(key.ID, " \t") {
+			return nil, fmt.Errorf("invalid encryption key ID %q", key.ID)
+		}
+		if _, exists := e.keys[key.ID]; exists {
+			return nil, fmt.Errorf("encryption key %q is listed twice", key.ID)
+		}
+		if len(key.Key) != masterKeySize {
+			return nil, fmt.Errorf("encryption key %q is %d bytes, want %d", key.ID, len(key.Key), masterKeySize)
+		}
+		aead, err := newGCM(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", key.ID, err)
+		}
+		e.keys[key.ID] = aead
+	}
+	if e.activeID == "" {
+		e.activeID = keys[len(keys)-1].ID
+	}
+	if _, ok := e.keys[e.activeID]; !ok {
+		return nil, fmt.Errorf("active encryption key %q is not in the key ring", e.activeID)
+	}
+	return e, nil
+}
+
+// Enabled reports whether new content is sealed
+func (e *ContentEncryptor) Enabled() bool {
+	return e.enabled
+}
+
+// ActiveKeyID returns the master key new content is sealed with
+func (e *ContentEncryptor) ActiveKeyID() string {
+	return e.activeID
+}
+
+// KeyIDs returns the IDs in the key ring, sorted
+func (e *ContentEncryptor) KeyIDs() []string {
+	ids := make([]string, 0, len(e.keys))
+	for id := range e.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TargetKeyID returns the key content should be sealed with under the
+// current settings, or "" when new content is stored in plaintext
+func (e *ContentEncryptor) TargetKeyID() string {
+	if e == nil || !e.enabled {
+		return ""
+	}
+	return e.activeID
+}
+
+// Seal encrypts content for entityID under a fresh data key
+func (e *ContentEncryptor) Seal(entityID string, content []byte) ([]byte, error) {
+	master := e.keys[e.activeID]
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := sealWithNonce(master, dataKey, []byte(entityID))
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(sealedMagic)+4+len(e.activeID)+len(wrapped)+data.NonceSize()+len(content)+data.Overhead()))
+	out.Write(sealedMagic)
+	out.WriteByte(sealedVersion)
+	out.WriteByte(byte(len(e.activeID)))
+	out.WriteString(e.activeID)
+	binary.Write(out, binary.LittleEndian, uint16(len(wrapped)))
+	out.Write(wrapped)
+
+	sealed, err := sealWithNonce(data, content, []byte(entityID))
+	if err != nil {
+		return nil, err
+	}
+	out.Write(sealed)
+	return out.Bytes(), nil
+}
+
+// Open decrypts content sealed for entityID
+func (e *ContentEncryptor) Open(entityID string, sealed []byte) ([]byte, error) {
+	keyID, wrapped, body, err := parseSealed(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, ErrNoEncryptionKeys
+	}
+	master, ok := e.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEncryptionKey, keyID)
+	}
+
+	dataKey, err := openWithNonce(master, wrapped, []byte(entityID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	content, err := openWithNonce(data, body, []byte(entityID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt content: %w", err)
+	}
+	return content, nil
+}
+
+// SealedKeyID returns the master key ID of sealed content
+func SealedKeyID(sealed []byte) (string, error) {
+	keyID, _, _, err := parseSealed(sealed)
+	return keyID, err
+}
+
+// parseSealed splits sealed content into its master key ID, wrapped data
+// key and sealed body
+func parseSealed(sealed []byte) (keyID string, wrapped, body []byte, err error) {
+	if len(sealed) <= len(sealedMagic) || !bytes.Equal(sealed[:len(sealedMagic)], sealedMagic) || sealed[len(sealedMagic)] != sealedVersion {
+		return "", nil, nil, fmt.Errorf("content is not sealed")
+	}
+	pos := len(sealedMagic) + 1
+	if pos >= len(sealed) {
+		return "", nil, nil, fmt.Errorf("sealed content truncated")
+	}
+	idLen := int(sealed[pos])
+	pos++
+	if pos+idLen+2 > len(sealed) {
+		return "", nil, nil, fmt.Errorf("sealed content truncated")
+	}
+	keyID = string(sealed[pos : pos+idLen])
+	pos += idLen
+	wrappedLen := int(binary.LittleEndian.Uint16(sealed[pos : pos+2]))
+	pos += 2
+	if pos+wrappedLen > len(sealed) {
+		return "", nil, nil, fmt.Errorf("sealed content truncated")
+	}
+	return keyID, sealed[pos : pos+wrappedLen], sealed[pos+wrappedLen:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealWithNonce encrypts plaintext under a random nonce, returned as a prefix
+func sealWithNonce(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func openWithNonce(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("sealed data truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+// activeEncryptor is the process-wide content encryptor, nil when no key
+// ring is configured. Writers, readers and the WAL all consult it.
+var activeEncryptor atomic.Pointer[ContentEncryptor]
+
+// SetContentEncryptor installs the encryptor used for entity content
+func SetContentEncryptor(e *ContentEncryptor) {
+	activeEncryptor.Store(e)
+}
+
+// GetContentEncryptor returns the installed encryptor, or nil
+func GetContentEncryptor() *ContentEncryptor {
+	return activeEncryptor.Load()
+}
+
+// sealContent seals content for storage if encryption is enabled,
+// reporting whether it did
+func sealContent(entityID string, content []byte) ([]byte, bool, error) {
+	e := GetContentEncryptor()
+	if e == nil || !e.enabled || len(content) == 0 {
+		return content, false, nil
+	}
+	sealed, err := e.Seal(entityID, content)
+	if err != nil {
+		return nil, false, err
+	}
+	return sealed, true, nil
+}
+
+// openContent reverses sealContent
+func openContent(entityID string, sealed []byte) ([]byte, error) {
+	return GetContentEncryptor().Open(entityID, sealed)
+}
+
+// ConfigureContentEncryption loads the master key ring named by cfg and
+// installs the encryptor. Without a key source nothing is installed, which
+// is an error when encryption is enabled. A key ring configured with
+// encryption disabled still lets content sealed earlier be read.
+func ConfigureContentEncryption(cfg *config.Config) error {
+	if cfg.EncryptionKeyCommand == "" && cfg.EncryptionKeyFile == "" {
+		if cfg.EncryptionEnabled {
+			return fmt.Errorf("encryption is enabled but neither ENTITYDB_ENCRYPTION_KEY_FILE nor ENTITYDB_ENCRYPTION_KEY_COMMAND is set")
+		}
+		SetContentEncryptor(nil)
+		return nil
+	}
+
+	keys, err := LoadMasterKeys(cfg)
+	if err != nil {
+		return err
+	}
+	e, err := NewContentEncryptor(keys, cfg.EncryptionActiveKey, cfg.EncryptionEnabled)
+	if err != nil {
+		return err
+	}
+	SetContentEncryptor(e)
+	if e.enabled {
+		logger.Info("Content encryption enabled with master key %q (%d keys in ring)", e.activeID, len(e.keys))
+	} else {
+		logger.Info("Content encryption disabled; %d master keys loaded to read sealed content", len(e.keys))
+	}
+	return nil
+}
+
+// LoadMasterKeys reads the key ring from the key command's output or the
+// key file
+func LoadMasterKeys(cfg *config.Config) ([]MasterKey, error) {
+	var ring []byte
+	var source string
+	if cfg.EncryptionKeyCommand != "" {
+		source = "encryption key command"
+		cmd := exec.Command("/bin/sh", "-c", cfg.EncryptionKeyCommand)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s failed: %w: %s", source, err, strings.TrimSpace(stderr.String()))
+		}
+		ring = out
+	} else {
+		source = cfg.EncryptionKeyFile
+		info, err := os.Stat(cfg.EncryptionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			logger.Warn("Encryption key file %s is accessible by other users (mode %v)", cfg.EncryptionKeyFile, info.Mode().Perm())
+		}
+		if ring, err = os.ReadFile(cfg.EncryptionKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+	}
+
+	keys, err := ParseKeyRing(ring)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	return keys, nil
+}
+
+// ParseKeyRing parses "<key-id> <key>" lines, where the key is 32 bytes in
+// base64 or hex. Blank lines and lines starting with # are ignored.
+func ParseKeyRing(data []byte) ([]MasterKey, error) {
+	var keys []MasterKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want \"<key-id> <key>\"", line)
+		}
+		key, err := decodeMasterKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		keys = append(keys, MasterKey{ID: fields[0], Key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found")
+	}
+	return keys, nil
+}
+
+func decodeMasterKey(s string) ([]byte, error) {
+	if len(s) == hex.EncodedLen(masterKeySize) {
+		if key, err := hex.DecodeString(s); err == nil {
+			return key, nil
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("key is neither base64 nor hex")
+	}
+	if len(key) != masterKeySize {
+		return nil, fmt.Errorf("key is %d bytes, want %d", len(key), masterKeySize)
+	}
+	return key, nil
+}
@@ -0,0 +1,172 @@
+package binary
+
+import (
+	"bytes"
+	"entitydb/config"
+	"entitydb/models"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testKeyRing(t *testing.T, ids ...string) []MasterKey {
+	t.Helper()
+	keys := make([]MasterKey, len(ids))
+	for i, id := range ids {
+		keys[i] = MasterKey{ID: id, Key: bytes.Repeat([]byte{byte(i + 1)}, masterKeySize)}
+	}
+	return keys
+}
+
+// TestContentEncryptorRoundTrip checks sealing, opening with a rotated key
+// ring and binding to the entity ID
+func TestContentEncryptorRoundTrip(t *testing.T) {
+	old, err := NewContentEncryptor(testKeyRing(t, "k1"), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(`{"ssn":"078-05-1120"}`)
+	sealed, err := old.Seal("e1", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("078-05-1120")) {
+		t.Fatal("sealed content contains the plaintext")
+	}
+	if keyID, err := SealedKeyID(sealed); err != nil || keyID != "k1" {
+		t.Errorf("SealedKeyID = %q, %v; want k1", keyID, err)
+	}
+
+	// After rotation k2 seals new content and k1 still opens old content
+	rotated, err := NewContentEncryptor(testKeyRing(t, "k1", "k2"), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ActiveKeyID() != "k2" {
+		t.Errorf("active key = %q, want the last key k2", rotated.ActiveKeyID())
+	}
+	opened, err := rotated.Open("e1", sealed)
+	if err != nil || !bytes.Equal(opened, content) {
+		t.Fatalf("Open = %q, %v", opened, err)
+	}
+
+	if _, err := rotated.Open("e2", sealed); err == nil {
+		t.Error("content sealed for e1 opened as e2")
+	}
+	if _, err := (*ContentEncryptor)(nil).Open("e1", sealed); !errors.Is(err, ErrNoEncryptionKeys) {
+		t.Errorf("Open without keys = %v, want ErrNoEncryptionKeys", err)
+	}
+	withoutK1, _ := NewContentEncryptor(testKeyRing(t, "k2"), "", true)
+	if _, err := withoutK1.Open("e1", sealed); !errors.Is(err, ErrUnknownEncryptionKey) {
+		t.Errorf("Open with a retired key = %v, want ErrUnknownEncryptionKey", err)
+	}
+}
+
+func TestParseKeyRing(t *testing.T) {
+	ring := "# master keys\n" +
+		"2024 AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n" +
+		"\n" +
+		"2025 0202020202020202020202020202020202020202020202020202020202020202\n"
+	keys, err := ParseKeyRing([]byte(ring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != "2024" || keys[1].ID != "2025" || keys[1].Key[0] != 2 {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+	if _, err := ParseKeyRing([]byte("short AQID\n")); err == nil {
+		t.Error("accepted a key shorter than 32 bytes")
+	}
+}
+
+// TestEncryptedEntityFile checks that content written with encryption
+// enabled is absent from the data file and read back transparently
+func TestEncryptedEntityFile(t *testing.T) {
+	encryptor, err := NewContentEncryptor(testKeyRing(t, "k1"), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetContentEncryptor(encryptor)
+	defer SetContentEncryptor(nil)
+
+	cfg := config.Load()
+	cfg.DataPath = t.TempDir()
+	path := filepath.Join(cfg.DataPath, "entities.edb")
+	writer, err := NewWriter(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := bytes.Repeat([]byte("patient record 4417; "), 100)
+	entity := &models.Entity{ID: "patient-1", Tags: []string{"1|type:patient"}, Content: secret}
+	if err := writer.WriteEntity(entity); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("patient record 4417")) {
+		t.Error("data file contains plaintext content")
+	}
+
+	reader, err := NewReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	read, err := reader.GetEntity("patient-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read.Content, secret) {
+		t.Error("content read back differs")
+	}
+	if keyID, err := reader.ContentKeyID("patient-1"); err != nil || keyID != "k1" {
+		t.Errorf("ContentKeyID = %q, %v; want k1", keyID, err)
+	}
+
+	SetContentEncryptor(nil)
+	if _, err := reader.GetEntity("patient-1"); !errors.Is(err, ErrNoEncryptionKeys) {
+		t.Errorf("GetEntity without keys = %v, want ErrNoEncryptionKeys", err)
+	}
+}
+
+// TestPlaintextWithSealedMagic checks that plaintext content starting like
+// sealed content is stored and read back as plaintext in WAL entries, with
+// and without encryption
+func TestPlaintextWithSealedMagic(t *testing.T) {
+	content := append([]byte("EDBX\x01"), []byte("not actually sealed")...)
+	entity := &models.Entity{ID: "lookalike", Tags: []string{"1|type:blob"}, Content: content}
+	decoder := &WAL{}
+
+	roundTrip := func(name string) {
+		t.Helper()
+		data, err := decoder.serializeEntry(WALEntry{OpType: WALOpUpdate, EntityID: entity.ID, Entity: entity, Timestamp: time.Now()})
+		if err != nil {
+			t.Fatalf("%s: serializeEntry: %v", name, err)
+		}
+		entry, err := decoder.deserializeEntry(data)
+		if err != nil {
+			t.Fatalf("%s: deserializeEntry: %v", name, err)
+		}
+		if entry.OpType != WALOpUpdate || !bytes.Equal(entry.Entity.Content, content) {
+			t.Errorf("%s: WAL entry read back as %v with content %q", name, entry.OpType, entry.Entity.Content)
+		}
+	}
+
+	roundTrip("plaintext")
+
+	encryptor, err := NewContentEncryptor(testKeyRing(t, "k1"), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetContentEncryptor(encryptor)
+	defer SetContentEncryptor(nil)
+	roundTrip("encrypted")
+}
@@ -0,0 +1,61 @@
+package binary
+
+import (
+	"entitydb/logger"
+	"fmt"
+	"strings"
+)
+
+// parsePinTags splits a comma-separated list of pin tags
+func parsePinTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// loadPinnedEntities reads every entity carrying a pin tag into the entity
+// cache so pinned entities never need a disk read. It returns the number of
+// entities loaded.
+func (r *EntityRepository) loadPinnedEntities() int {
+	loaded := 0
+	for _, tag := range r.entityCache.PinnedStats().PinTags {
+		for _, id := range r.shardedTagIndex.GetEntitiesForTag(tag) {
+			if _, err := r.GetByID(id); err != nil {
+				logger.Warn("Failed to load pinned entity %s: %v", id, err)
+				continue
+			}
+			loaded++
+		}
+	}
+	if loaded > 0 {
+		logger.Info("Loaded %d pinned entities into memory", loaded)
+	}
+	return loaded
+}
+
+// PinEntity keeps an entity in memory until UnpinEntity is called or the
+// server restarts. Tag an entity with a configured pin tag to pin it across
+// restarts.
+func (r *EntityRepository) PinEntity(id string) error {
+	entity, err := r.GetByID(id)
+	if err != nil || entity == nil || entity.IsRecoveryPlaceholder() {
+		return fmt.Errorf("entity %s not found", id)
+	}
+	r.entityCache.Pin(id)
+	r.entityCache.Put(id, entity)
+	return nil
+}
+
+// UnpinEntity removes a pin set by PinEntity
+func (r *EntityRepository) UnpinEntity(id string) {
+	r.entityCache.Unpin(id)
+}
+
+// PinnedEntities reports the pinned set
+func (r *EntityRepository) PinnedEntities() PinnedStats {
+	return r.entityCache.PinnedStats()
+}
@@ -0,0 +1,245 @@
+package binary
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"strings"
+)
+
+// entityHeaderSize is the encoded size of an EntityHeader
+const entityHeaderSize = 16
+
+// entityRecord locates the sections of one encoded entity record. The fields
+// slice the record's bytes, so parsing copies nothing and decodes nothing;
+// tags and content are decoded only when asked for.
+//
+// Record layout:
+//   [EntityHeader][Tags][CompressionType][ContentTypeLen][ContentType]
+//   [OriginalSize][CompressedSize][Data][Timestamp]
+//
+// Tags are TagCount little-endian uint32 dictionary IDs, or the compact tag
+// section when the header carries entityFlagCompactTags.
+type entityRecord struct {
+	header      EntityHeader
+	tagSection  []byte // encoded tags, without the compact section's length prefix
+	compression uint8  // CompressionType, with contentEncryptedFlag when sealed
+	contentType []byte
+	origSize    int    // content size before compression
+	content     []byte // stored content, possibly sealed and compressed
+}
+
+// parseEntityRecord checks the framing of a record and locates its sections
+func parseEntityRecord(data []byte) (entityRecord, error) {
+	rec, pos, storedSize, err := parseEntityRecordHead(data)
+	if err != nil || rec.header.ContentCount == 0 {
+		return rec, err
+	}
+	if pos+storedSize+8 > len(data) {
+		return rec, fmt.Errorf("entity record: %d content bytes extend past the record", storedSize)
+	}
+	rec.content = data[pos : pos+storedSize]
+	return rec, nil
+}
+
+// parseEntityRecordHead locates the sections of a record up to its content
+// data, returning the position and stored size of the data. data may end
+// there: nothing after it is looked at.
+func parseEntityRecordHead(data []byte) (rec entityRecord, pos, storedSize int, err error) {
+	if len(data) < entityHeaderSize {
+		return rec, 0, 0, fmt.Errorf("entity record of %d bytes is shorter than its header", len(data))
+	}
+	rec.header = EntityHeader{
+		Modified:     int64(binary.LittleEndian.Uint64(data[0:8])),
+		TagCount:     binary.LittleEndian.Uint16(data[8:10]),
+		ContentCount: binary.LittleEndian.Uint16(data[10:12]),
+		Reserved:     binary.LittleEndian.Uint32(data[12:16]),
+	}
+	pos = entityHeaderSize
+
+	end := pos + int(rec.header.TagCount)*4
+	if rec.compactTags() {
+		if pos+4 > len(data) {
+			return rec, 0, 0, fmt.Errorf("entity record: tag section length extends past the record")
+		}
+		pos += 4
+		end = pos + int(binary.LittleEndian.Uint32(data[pos-4:pos]))
+	}
+	if end > len(data) {
+		return rec, 0, 0, fmt.Errorf("entity record: %d tags extend past the record", rec.header.TagCount)
+	}
+	rec.tagSection = data[pos:end]
+	pos = end
+	if rec.header.ContentCount == 0 {
+		return rec, pos, 0, nil
+	}
+
+	if pos+3 > len(data) {
+		return rec, 0, 0, fmt.Errorf("entity record: content header extends past the record")
+	}
+	rec.compression = data[pos]
+	typeLen := int(binary.LittleEndian.Uint16(data[pos+1 : pos+3]))
+	pos += 3
+	if pos+typeLen+8 > len(data) {
+		return rec, 0, 0, fmt.Errorf("entity record: content type extends past the record")
+	}
+	rec.contentType = data[pos : pos+typeLen]
+	pos += typeLen
+
+	// The stored size frames the data; the original size sizes decompression
+	rec.origSize = int(binary.LittleEndian.Uint32(data[pos : pos+4]))
+	storedSize = int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+	return rec, pos + 8, storedSize, nil
+}
+
+// entityRecordHeadLen returns the length of the part of a record that
+// parseEntityRecordHead reads. When data is too short to tell, it returns
+// the length needed to get further; readers read that many bytes of the
+// record and ask again until the result fits in what they have read.
+func entityRecordHeadLen(data []byte) int {
+	if len(data) < entityHeaderSize+4 {
+		return entityHeaderSize + 4
+	}
+	tagCount := int(binary.LittleEndian.Uint16(data[8:10]))
+	contentCount := binary.LittleEndian.Uint16(data[10:12])
+	end := entityHeaderSize + tagCount*4
+	if binary.LittleEndian.Uint32(data[12:16])&entityFlagCompactTags != 0 {
+		end = entityHeaderSize + 4 + int(binary.LittleEndian.Uint32(data[entityHeaderSize:entityHeaderSize+4]))
+	}
+	if contentCount == 0 {
+		return end
+	}
+	if len(data) < end+3 {
+		return end + 3
+	}
+	return end + 3 + int(binary.LittleEndian.Uint16(data[end+1:end+3])) + 8
+}
+
+// compactTags reports whether the record uses the compact tag encoding
+func (rec *entityRecord) compactTags() bool {
+	return rec.header.Reserved&entityFlagCompactTags != 0
+}
+
+// tags resolves the stored tags through the dictionary
+func (rec *entityRecord) tags(dict *TagDictionary) ([]string, error) {
+	if rec.compactTags() {
+		return decodeCompactTags(rec.tagSection, int(rec.header.TagCount), dict)
+	}
+	tags := make([]string, rec.header.TagCount, int(rec.header.TagCount)+1)
+	for i := range tags {
+		tags[i] = dict.GetTag(binary.LittleEndian.Uint32(rec.tagSection[i*4:]))
+	}
+	return tags, nil
+}
+
+// addContentTypeTag tags an entity decoded from the record with its content
+// type unless the record has no content or a content type tag is stored
+func (rec *entityRecord) addContentTypeTag(entity *models.Entity) {
+	if rec.header.ContentCount == 0 {
+		return
+	}
+	for _, tag := range entity.Tags {
+		if strings.Contains(tag, "content:type:") {
+			return
+		}
+	}
+	entity.AddTag("content:type:" + string(rec.contentType))
+}
+
+// decodeContent returns the content of entity id, decrypted and
+// decompressed. The result never shares memory with the record.
+func (rec *entityRecord) decodeContent(id string) ([]byte, error) {
+	if rec.header.ContentCount == 0 {
+		return []byte{}, nil
+	}
+
+	// Until decrypted or decompressed, content is the record's bytes
+	content, shared := rec.content, true
+	compression := rec.compression
+	if compression&contentEncryptedFlag != 0 {
+		opened, err := openContent(id, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt content of entity %s: %w", id, err)
+		}
+		content, shared = opened, false
+		compression &^= contentEncryptedFlag
+	}
+
+	if t := CompressionType(compression); t != CompressionNone {
+		if _, ok := GetCodec(t); !ok {
+			return nil, fmt.Errorf("content of entity %s uses unsupported compression type %d", id, t)
+		}
+		decompressed, err := decompress(t, content, rec.origSize)
+		if err == nil {
+			return decompressed, nil
+		}
+		logger.Warn("Failed to decompress content for entity %s: %v, using as-is", id, err)
+	}
+	if shared {
+		content = append([]byte{}, content...)
+	}
+	return content, nil
+}
+
+// decodeEntityRecord decodes a whole entity record, verifying the content
+// against the checksum tag when the entity carries one
+func decodeEntityRecord(data []byte, id string, dict *TagDictionary) (*models.Entity, error) {
+	rec, err := parseEntityRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	entity := &models.Entity{ID: id}
+	if entity.Tags, err = rec.tags(dict); err != nil {
+		return nil, fmt.Errorf("entity %s: %w", id, err)
+	}
+	rec.addContentTypeTag(entity)
+	if entity.Content, err = rec.decodeContent(id); err != nil {
+		return nil, err
+	}
+	if rec.header.ContentCount > 0 {
+		verifyContentChecksum(entity)
+	}
+	return entity, nil
+}
+
+// decodeEntityRecordTags decodes an entity from a record, or from the part
+// of it entityRecordHeadLen covers, without its content. The entity carries
+// the tags decodeEntityRecord would give it, content type tag included.
+func decodeEntityRecordTags(data []byte, id string, dict *TagDictionary) (*models.Entity, error) {
+	rec, _, _, err := parseEntityRecordHead(data)
+	if err != nil {
+		return nil, err
+	}
+	entity := &models.Entity{ID: id}
+	if entity.Tags, err = rec.tags(dict); err != nil {
+		return nil, fmt.Errorf("entity %s: %w", id, err)
+	}
+	rec.addContentTypeTag(entity)
+	return entity, nil
+}
+
+// verifyContentChecksum compares the SHA256 of an entity's content with its
+// checksum tag ("timestamp|checksum:sha256:hash") and logs a mismatch. The
+// read still succeeds so the integrity issue can be monitored and repaired.
+func verifyContentChecksum(entity *models.Entity) {
+	var stored string
+	for _, tag := range entity.Tags {
+		if _, value, ok := strings.Cut(tag, "|"); ok && strings.HasPrefix(value, "checksum:sha256:") {
+			stored = strings.TrimPrefix(value, "checksum:sha256:")
+			break
+		}
+	}
+	if stored == "" {
+		return
+	}
+
+	actual := sha256.Sum256(entity.Content)
+	if actualHex := hex.EncodeToString(actual[:]); actualHex != stored {
+		logger.Warn("Content checksum mismatch for entity %s: expected %s, got %s", entity.ID, stored, actualHex)
+	} else {
+		logger.Trace("Content integrity verified for entity %s", entity.ID)
+	}
+}
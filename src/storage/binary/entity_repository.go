@@ -16,9 +16,12 @@ import (
 	"entitydb/config"
 	"entitydb/cache"
 	"entitydb/logger"
+	"entitydb/tracing"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -27,6 +30,8 @@ import (
 	"time"
 	"runtime"
 	"bytes"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // RecursionGuard prevents infinite recursion in entity creation operations
@@ -199,6 +204,16 @@ type EntityRepository struct {
 	batchWriter     *BatchWriter
 	useBatchWrites  bool // Feature flag for batched write operations
 	
+	// Durability of writes that neither the request nor the dataset selects
+	durability        DurabilityMode
+	datasetDurability *DatasetDurability
+	
+	// Datasets published read-only with the public:read tag
+	publicDatasets *PublicDatasets
+	
+	// Datasets made write-once with the write:once tag
+	writeOnceDatasets *WriteOnceDatasets
+	
 	// In-memory entity storage with bounded caching
 	entityCache  *BoundedEntityCache // Bounded LRU cache for entities
 	
@@ -231,9 +246,8 @@ type EntityRepository struct {
 	persistentIndexLoaded bool        // Whether persistent index was loaded successfully
 	
 	// High-performance features (merged from HighPerformanceRepository)
-	mmapReader     *MMapReader            // Memory-mapped file reader
 	skipList       *SkipList              // Fast skip-list index
-	bloomFilter    *BloomFilter           // Bloom filter for existence checks
+	idFilter       *entityIDFilter        // Bloom filter answering lookups of missing IDs (nil when disabled)
 	queryProcessor *ParallelQueryProcessor // Parallel query processing
 	perfStats      *PerformanceStats      // Performance monitoring
 	
@@ -267,11 +281,54 @@ type EntityRepository struct {
 	// Track entity count for index building
 	loadedEntityCount int
 	
+	// Entities on disk the last index build could not read
+	indexBuildUnreadable int
+	
 	// Circuit breaker for update operations
 	updateCircuitBreaker *UpdateCircuitBreaker
 	
 	// Deletion index for tracking deleted/purged entities
 	deletionIndex *DeletionIndex
+	
+	// Per-entity and per-dataset change counters
+	changeCounters *ChangeCounters
+	
+	// Serialize upserts by key tag so lookup and write cannot interleave
+	upsertLocks [64]sync.Mutex
+	
+	// Subscribers to committed entity changes
+	changeFeed *ChangeFeed
+	
+	// Optional per-dataset index of JSON content paths (nil when not configured)
+	contentPaths *ContentPathIndex
+	
+	// Entity count and bytes per dataset, checked against dataset quotas
+	datasetUsage *DatasetUsageTracker
+	
+	// Entity counts by type and dataset for the entity summary
+	entitySummary *EntitySummaryTracker
+	
+	// Geohash prefix index of entities tagged with a location
+	geoIndex *GeoIndex
+	
+	// Cardinality samples of the tag namespaces, for growth rates
+	tagGrowth *TagGrowthTracker
+	
+	// Throughput of the most recent index rebuild
+	lastIndexRebuild IndexRebuildStats
+	rebuildStatsMu   sync.RWMutex
+	
+	// Online index rebuild state. Entities indexed while a rebuild runs are
+	// recorded in rebuildDirty and re-applied to the rebuilt indexes.
+	rebuildRunning int32
+	rebuildDirty   map[string]struct{}
+	rebuildDirtyMu sync.Mutex
+	
+	// Entities whose records failed a check, the report of the most recent
+	// diagnosis or forced rebuild, and whether one is running
+	quarantine      entityQuarantine
+	lastRecovery    atomic.Pointer[RecoveryReport]
+	recoveryRunning int32
 }
 
 // PerformanceStats tracks performance metrics for the repository
@@ -301,6 +358,7 @@ type TagVariantCache struct {
 	mu            sync.RWMutex
 	variantToTag  map[string][]string  // clean tag -> list of entities with that tag variant
 	tagToVariants map[string][]string  // temporal tag -> list of clean variants
+	memBytes      int64                // approximate bytes held by both maps
 }
 
 // NewTagVariantCache creates a new tag variant cache
@@ -318,12 +376,20 @@ func (tvc *TagVariantCache) AddTagVariant(temporalTag, cleanTag, entityID string
 	
 	// Add entity to the clean tag variant
 	if !contains(tvc.variantToTag[cleanTag], entityID) {
+		if _, exists := tvc.variantToTag[cleanTag]; !exists {
+			tvc.memBytes += mapEntryBytes + stringBytes(cleanTag) + sliceHeaderBytes
+		}
 		tvc.variantToTag[cleanTag] = append(tvc.variantToTag[cleanTag], entityID)
+		tvc.memBytes += stringBytes(entityID)
 	}
 	
 	// Track that this temporal tag has this clean variant
 	if !contains(tvc.tagToVariants[temporalTag], cleanTag) {
+		if _, exists := tvc.tagToVariants[temporalTag]; !exists {
+			tvc.memBytes += mapEntryBytes + stringBytes(temporalTag) + sliceHeaderBytes
+		}
 		tvc.tagToVariants[temporalTag] = append(tvc.tagToVariants[temporalTag], cleanTag)
+		tvc.memBytes += stringBytes(cleanTag)
 	}
 }
 
@@ -354,10 +420,12 @@ func (tvc *TagVariantCache) RemoveEntityFromVariant(entityID string) {
 				newEntities = append(newEntities, id)
 			}
 		}
+		tvc.memBytes -= int64(len(entities)-len(newEntities)) * stringBytes(entityID)
 		if len(newEntities) > 0 {
 			tvc.variantToTag[cleanTag] = newEntities
 		} else {
 			delete(tvc.variantToTag, cleanTag)
+			tvc.memBytes -= mapEntryBytes + stringBytes(cleanTag) + sliceHeaderBytes
 		}
 	}
 }
@@ -369,6 +437,13 @@ func (tvc *TagVariantCache) GetVariantStats() (int, int) {
 	return len(tvc.variantToTag), len(tvc.tagToVariants)
 }
 
+// MemoryBytes returns the approximate bytes held by the cache
+func (tvc *TagVariantCache) MemoryBytes() int64 {
+	tvc.mu.RLock()
+	defer tvc.mu.RUnlock()
+	return tvc.memBytes
+}
+
 // contains checks if a slice contains a string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -395,6 +470,7 @@ func (tvc *TagVariantCache) TriggerPressureCleanup(pressure float64) {
 		for cleanTag, entities := range tvc.variantToTag {
 			if len(entities) <= minEntityCount {
 				delete(tvc.variantToTag, cleanTag)
+				tvc.memBytes -= mapEntryBytes + stringBytes(cleanTag) + sliceHeaderBytes + stringsBytes(entities)
 				cleaned++
 			}
 		}
@@ -410,9 +486,10 @@ func (tvc *TagVariantCache) TriggerPressureCleanup(pressure float64) {
 			
 			// Clear excess temporal mappings (simplified - could be improved with actual LRU)
 			count := 0
-			for temporalTag := range tvc.tagToVariants {
+			for temporalTag, variants := range tvc.tagToVariants {
 				if count > keepCount {
 					delete(tvc.tagToVariants, temporalTag)
+					tvc.memBytes -= mapEntryBytes + stringBytes(temporalTag) + sliceHeaderBytes + stringsBytes(variants)
 				}
 				count++
 			}
@@ -427,8 +504,10 @@ func (tvc *TagVariantCache) TriggerPressureCleanup(pressure float64) {
 // BatchWriter handles batched write operations for improved throughput
 type BatchWriter struct {
 	mu           sync.Mutex
+	flushMu      sync.Mutex                 // serializes flushes, so Flush returns after batches in flight
 	pending      map[string]*models.Entity  // entityID -> entity (pending writes)
 	pendingOps   []batchOperation           // ordered list of operations
+	overlay      *PendingOverlay            // read view of queued writes
 	batchSize    int                        // max entities per batch
 	flushTimer   *time.Timer               // automatic flush timer
 	flushInterval time.Duration             // how often to auto-flush
@@ -441,7 +520,7 @@ type BatchWriter struct {
 type batchOperation struct {
 	opType   string         // "create", "update", "addtag"
 	entityID string         // target entity ID
-	entity   *models.Entity // entity data (for create/update)
+	entity   *models.Entity // entity data (for create/update), or the stored entity (for addtag)
 	tag      string         // tag data (for addtag)
 }
 
@@ -450,6 +529,7 @@ func NewBatchWriter(repo *EntityRepository, batchSize int, flushInterval time.Du
 	return &BatchWriter{
 		pending:       make(map[string]*models.Entity),
 		pendingOps:    make([]batchOperation, 0, batchSize),
+		overlay:       NewPendingOverlay(),
 		batchSize:     batchSize,
 		flushInterval: flushInterval,
 		repo:          repo,
@@ -522,6 +602,7 @@ func (bw *BatchWriter) AddCreate(entity *models.Entity) error {
 		entity:   entity,
 	})
 	bw.pending[entity.ID] = entity
+	bw.overlay.Put(entity)
 	
 	// Check if we need to flush
 	if len(bw.pendingOps) >= bw.batchSize {
@@ -542,6 +623,7 @@ func (bw *BatchWriter) AddUpdate(entity *models.Entity) error {
 		entity:   entity,
 	})
 	bw.pending[entity.ID] = entity
+	bw.overlay.Put(entity)
 	
 	if len(bw.pendingOps) >= bw.batchSize {
 		go bw.Flush()
@@ -550,17 +632,38 @@ func (bw *BatchWriter) AddUpdate(entity *models.Entity) error {
 	return nil
 }
 
-// AddTag adds a tag operation to the batch
-func (bw *BatchWriter) AddTag(entityID, tag string) error {
+// AddTag adds a tag operation to the batch. stored is the entity as the
+// caller read it, or nil; it is the base for entities that are neither queued
+// nor cached.
+func (bw *BatchWriter) AddTag(entityID, tag string, stored *models.Entity) error {
 	bw.mu.Lock()
 	defer bw.mu.Unlock()
 	
 	bw.pendingOps = append(bw.pendingOps, batchOperation{
 		opType:   "addtag",
 		entityID: entityID,
+		entity:   stored,
 		tag:      tag,
 	})
 	
+	// The tag is applied to a copy so readers see it before the batch runs
+	base, exists := bw.overlay.Get(entityID)
+	if !exists {
+		base, exists = bw.repo.entityCache.Get(entityID)
+	}
+	if !exists && stored != nil {
+		base, exists = stored, true
+	}
+	if exists {
+		bw.overlay.Put(&models.Entity{
+			ID:        base.ID,
+			Tags:      append(append([]string(nil), base.Tags...), tag),
+			Content:   base.Content,
+			CreatedAt: base.CreatedAt,
+			UpdatedAt: models.Now(),
+		})
+	}
+	
 	if len(bw.pendingOps) >= bw.batchSize {
 		go bw.Flush()
 	}
@@ -568,8 +671,12 @@ func (bw *BatchWriter) AddTag(entityID, tag string) error {
 	return nil
 }
 
-// Flush executes all pending batch operations
+// Flush executes all pending batch operations. It waits for a flush already
+// in progress, so every write queued before the call is durable when it
+// returns.
 func (bw *BatchWriter) Flush() error {
+	bw.flushMu.Lock()
+	defer bw.flushMu.Unlock()
 	bw.mu.Lock()
 	
 	if len(bw.pendingOps) == 0 {
@@ -580,18 +687,62 @@ func (bw *BatchWriter) Flush() error {
 	// Capture pending operations
 	ops := make([]batchOperation, len(bw.pendingOps))
 	copy(ops, bw.pendingOps)
+	pending := bw.pending
 	entities := make(map[string]*models.Entity)
-	for k, v := range bw.pending {
+	for k, v := range pending {
 		entities[k] = v
 	}
 	
+	// Capture the versions readers see for this batch. Writes queued after
+	// the batch is captured stay in the overlay.
+	var visible []*models.Entity
+	for _, op := range ops {
+		if entity, exists := bw.overlay.Get(op.entityID); exists {
+			visible = append(visible, entity)
+		}
+	}
+	
 	// Clear pending state
 	bw.pendingOps = bw.pendingOps[:0]
 	bw.pending = make(map[string]*models.Entity)
 	
 	bw.mu.Unlock()
 	
-	return bw.executeBatch(ops, entities)
+	if err := bw.executeBatch(ops, entities); err != nil {
+		// The batch is queued again ahead of later writes, and its entities
+		// stay visible until a flush applies it
+		bw.requeue(ops, pending)
+		return err
+	}
+	for _, entity := range visible {
+		bw.overlay.Release(entity)
+	}
+	return nil
+}
+
+// requeue puts the operations of a failed batch back in front of the queue.
+// Entities queued since the batch was captured are newer and are kept.
+func (bw *BatchWriter) requeue(ops []batchOperation, pending map[string]*models.Entity) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	bw.pendingOps = append(ops, bw.pendingOps...)
+	for id, entity := range pending {
+		if _, newer := bw.pending[id]; !newer {
+			bw.pending[id] = entity
+		}
+	}
+}
+
+// PendingCount returns the number of queued operations
+func (bw *BatchWriter) PendingCount() int {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return len(bw.pendingOps)
+}
+
+// Pending returns the queued version of an entity, if any
+func (bw *BatchWriter) Pending(id string) (*models.Entity, bool) {
+	return bw.overlay.Get(id)
 }
 
 // executeBatch performs the actual batch execution
@@ -639,12 +790,22 @@ func (bw *BatchWriter) executeBatch(ops []batchOperation, entities map[string]*m
 	// Phase 3: Process operations and batch index updates
 	bw.repo.mu.Lock()
 	
-	// Process AddTag operations
+	// Process AddTag operations. Entities created or updated in this batch are
+	// not in the cache yet, so tags for them are applied to the pending
+	// version; entities in neither start from the version read by AddTag.
+	// Tags go on a copy, since readers may hold the pending or cached entity.
 	for _, op := range ops {
 		if op.opType == "addtag" {
-			if entity, exists := bw.repo.entityCache.Get(op.entityID); exists {
-				// Add the tag to the entity
-				entity.Tags = append(entity.Tags, op.tag)
+			entity, exists := entities[op.entityID]
+			if !exists {
+				entity, exists = bw.repo.entityCache.Get(op.entityID)
+			}
+			if !exists && op.entity != nil {
+				entity, exists = op.entity, true
+			}
+			// A batch queued again after a failure may carry the tag already
+			if exists && !slices.Contains(entity.Tags, op.tag) {
+				entity = entity.WithTags(append(append([]string(nil), entity.Tags...), op.tag))
 				entity.UpdatedAt = models.Now()
 				entities[op.entityID] = entity  // Update the batch entities map
 			}
@@ -678,18 +839,17 @@ func (bw *BatchWriter) executeBatch(ops []batchOperation, entities map[string]*m
 	return nil
 }
 
-// batchWALLog logs multiple entities to WAL efficiently
+// batchWALLog logs multiple entities to the WAL with a single fsync
 func (bw *BatchWriter) batchWALLog(entities []*models.Entity) error {
-	for _, entity := range entities {
-		if err := bw.repo.wal.LogCreate(entity); err != nil {
-			return err
-		}
-	}
-	return nil
+	return bw.repo.wal.LogCreateBatch(entities)
 }
 
 // batchDiskWrite writes multiple entities to disk efficiently
 func (bw *BatchWriter) batchDiskWrite(entities []*models.Entity) error {
+	// Readers opened before the batch do not see it
+	if pool := bw.repo.readerPool; pool != nil {
+		defer pool.Advance()
+	}
 	for _, entity := range entities {
 		if err := bw.repo.writerManager.WriteEntity(entity); err != nil {
 			return err
@@ -700,20 +860,40 @@ func (bw *BatchWriter) batchDiskWrite(entities []*models.Entity) error {
 
 // NewEntityRepositoryWithConfig creates a new binary entity repository using full configuration
 func NewEntityRepositoryWithConfig(cfg *config.Config) (*EntityRepository, error) {
+	report := GetStartupReport()
+	phaseStart := time.Now()
+	
 	// Ensure data directory exists
 	if err := os.MkdirAll(cfg.DataPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 	
+	// Load the encryption key ring before anything reads the data file or WAL
+	if err := ConfigureContentEncryption(cfg); err != nil {
+		return nil, fmt.Errorf("failed to configure content encryption: %w", err)
+	}
+	if err := ConfigureCompression(cfg); err != nil {
+		return nil, fmt.Errorf("failed to configure content compression: %w", err)
+	}
+	if err := ConfigureEntitySigning(cfg); err != nil {
+		return nil, fmt.Errorf("failed to configure entity signing: %w", err)
+	}
+	
 	// Always use sharded index for improved concurrency
 	
 	// Check environment variable for tag variant cache feature flag
 	// Default to true for optimized temporal tag lookups
 	useVariants := os.Getenv("ENTITYDB_USE_VARIANT_CACHE") != "false"
 	
-	// Check environment variable for batch writes feature flag
-	// Default to true for improved write throughput
-	useBatchWrites := os.Getenv("ENTITYDB_USE_BATCH_WRITES") != "false"
+	useBatchWrites := cfg.BatchWrites
+	durability := DurabilityRelaxed
+	if cfg.DurabilityMode != "" {
+		mode, err := ParseDurabilityMode(cfg.DurabilityMode)
+		if err != nil {
+			return nil, err
+		}
+		durability = mode
+	}
 	
 	// Use database filename for unified file format
 	databasePath := cfg.DatabaseFilename
@@ -728,14 +908,25 @@ func NewEntityRepositoryWithConfig(cfg *config.Config) (*EntityRepository, error
 		temporalIndex:   NewTemporalIndex(),
 		namespaceIndex:  NewNamespaceIndex(),
 		lastCheckpoint:  time.Now(),  // Initialize checkpoint time
-		shardedTagIndex: NewShardedTagIndex(),
 		tagVariantCache: NewTagVariantCache(),
 		useVariantCache: useVariants,
 		useBatchWrites:  useBatchWrites,
+		durability:      durability,
+		datasetDurability: NewDatasetDurability(),
+		publicDatasets:  NewPublicDatasets(),
+		writeOnceDatasets: NewWriteOnceDatasets(),
 		config:          cfg, // Store config reference for later use
+		contentPaths:    NewContentPathIndex(cfg.ContentIndexPaths),
+		datasetUsage:    NewDatasetUsageTracker(DatasetQuota{
+			MaxEntities: cfg.DatasetQuotaMaxEntities,
+			MaxBytes:    cfg.DatasetQuotaMaxBytes,
+			Mode:        cfg.DatasetQuotaMode,
+		}),
+		entitySummary:   NewEntitySummaryTracker(),
+		geoIndex:        NewGeoIndex(),
+		tagGrowth:       NewTagGrowthTracker(),
 		// Initialize performance features
 		skipList:        NewSkipList(),
-		bloomFilter:     NewBloomFilter(100000, 0.01), // Support up to 100k entities with 1% false positive rate
 		perfStats:       &PerformanceStats{},
 		// Initialize WAL-only features
 		walEntities:     make(map[string]*models.Entity),
@@ -743,6 +934,13 @@ func NewEntityRepositoryWithConfig(cfg *config.Config) (*EntityRepository, error
 		// Initialize deletion index
 		deletionIndex:   NewDeletionIndex(),
 	}
+	repo.shardedTagIndex = repo.newTagIndex()
+	if cfg.IDBloomFilter {
+		repo.idFilter = newEntityIDFilter(cfg.IDBloomFalsePositiveRate)
+	}
+	if cfg.TagIndexMemoryBudget > 0 {
+		logger.Info("Tag index memory budget %d bytes, cold posting lists spill to %s", cfg.TagIndexMemoryBudget, repo.tagSpillDir())
+	}
 	
 	logger.Info("Using unified file format with sharded tag index for improved concurrency")
 	logger.Info("Entity cache initialized with size limit %d and memory limit %d MB", 
@@ -753,18 +951,29 @@ func NewEntityRepositoryWithConfig(cfg *config.Config) (*EntityRepository, error
 	}
 	
 	if useBatchWrites {
-		// Initialize batch writer with reasonable defaults
-		batchSize := 10         // batch up to 10 entities
-		flushInterval := 100 * time.Millisecond  // flush every 100ms
+		batchSize := cfg.BatchWriteSize
+		if batchSize <= 0 {
+			batchSize = 10
+		}
+		flushInterval := cfg.BatchFlushInterval
+		if flushInterval <= 0 {
+			flushInterval = 100 * time.Millisecond
+		}
 		repo.batchWriter = NewBatchWriter(repo, batchSize, flushInterval)
 		repo.batchWriter.Start()
 		logger.Info("Using batch writes for improved write throughput (batch size: %d, flush interval: %v)", 
 			batchSize, flushInterval)
 	}
+	logger.Info("Default write durability: %s", durability)
+	
+	// Initialize WriterManager for atomic operations
+	repo.writerManager = NewWriterManager(databasePath, cfg)
 	
 	// Ensure the data file exists with a proper header before trying to read it
 	dataFile := databasePath
+	dataFileCreated := false
 	if _, err := os.Stat(dataFile); os.IsNotExist(err) {
+		dataFileCreated = true
 		// Use the writerManager to create the initial file with header
 		_, err := repo.writerManager.GetWriter()
 		if err != nil {
@@ -781,9 +990,7 @@ func NewEntityRepositoryWithConfig(cfg *config.Config) (*EntityRepository, error
 		return nil, fmt.Errorf("failed to create reader pool: %w", err)
 	}
 	repo.readerPool = readerPool
-	
-	// Initialize WriterManager with ReaderPool for atomic operations
-	repo.writerManager = NewWriterManager(databasePath, cfg, readerPool)
+
 	
 	// Initialize embedded WAL from unified database file  
 	wal, err := NewWAL(cfg.DatabaseFilename)
@@ -792,6 +999,30 @@ func NewEntityRepositoryWithConfig(cfg *config.Config) (*EntityRepository, error
 	}
 	repo.wal = wal
 	
+	// Copy WAL entries to archive segments for point-in-time recovery
+	archiver, err := NewWALArchiverFromConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating WAL archiver: %w", err)
+	}
+	wal.SetArchiver(archiver)
+	
+	// Keep committed operations for change data capture until published
+	cdc, err := NewCDCPublisherFromConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating CDC publisher: %w", err)
+	}
+	wal.SetCDC(cdc)
+	
+	storageDetails := map[string]interface{}{
+		"database_file": databasePath,
+		"created":       dataFileCreated,
+	}
+	if stat, err := os.Stat(dataFile); err == nil {
+		storageDetails["size_bytes"] = stat.Size()
+	}
+	report.RecordPhase("storage_open", phaseStart, storageDetails, nil)
+	phaseStart = time.Now()
+	
 	// Initialize recovery manager
 	repo.recovery = NewRecoveryManagerWithConfig(cfg)
 	
@@ -937,16 +1168,13 @@ func NewEntityRepositoryWithConfig(cfg *config.Config) (*EntityRepository, error
 	// Initialize circuit breaker for update operations
 	repo.updateCircuitBreaker = NewUpdateCircuitBreaker()
 	
-	// Initialize memory-mapped reader if database file exists and has content
-	if stat, err := os.Stat(dataFile); err == nil && stat.Size() > HeaderSize {
-		if mmapReader, err := NewMMapReader(dataFile); err != nil {
-			logger.Warn("Failed to create memory-mapped reader: %v, will fall back to standard reads", err)
-		} else {
-			repo.mmapReader = mmapReader
-		}
-	} else {
-		logger.Info("Database file is empty or too small for mmap, skipping mmap initialization")
+	// Initialize change counters for cheap cache validation
+	changeCounters, err := OpenChangeCounters(repo.getDataFile() + ".counter")
+	if err != nil {
+		return nil, err
 	}
+	repo.changeCounters = changeCounters
+	repo.changeFeed = NewChangeFeed()
 	
 	// Initialize parallel query processor
 	repo.queryProcessor = NewParallelQueryProcessor(repo)
@@ -960,28 +1188,84 @@ func NewEntityRepositoryWithConfig(cfg *config.Config) (*EntityRepository, error
 		repo.writerManager.ReleaseWriter()
 	}
 	
+	report.RecordPhase("services_start", phaseStart, map[string]interface{}{
+		"single_writer":     repo.useSingleWriter,
+		"batch_writes":      useBatchWrites,
+		"atomic_operations": useAtomicOps,
+		"mmap_reader":       repo.readerPool.Mapped() != nil,
+	}, nil)
+	phaseStart = time.Now()
+	
 	// CRITICAL FIX: Replay WAL BEFORE building indexes to prevent index-database gaps
 	logger.Info("Replaying WAL before index building to ensure consistency")
-	if err := repo.replayWAL(); err != nil {
+	err = repo.replayWAL()
+	if err != nil {
 		logger.Warn("WAL replay failed during initialization: %v", err)
 		// Continue - this is not fatal, but log the issue
 	}
+	replayed, skipped := repo.wal.LastReplayStats()
+	report.RecordWALReplay(replayed, skipped)
+	if skipped > 0 {
+		report.RecordRecoveryAction("wal_entries_skipped",
+			fmt.Sprintf("skipped %d corrupt or unapplicable WAL entries during replay", skipped))
+	}
+	report.RecordPhase("wal_replay", phaseStart, map[string]interface{}{
+		"entries_replayed": replayed,
+		"entries_skipped":  skipped,
+	}, err)
+	phaseStart = time.Now()
 	
 	// Build initial indexes (now includes entities from both database and WAL)
-	if err := repo.buildIndexes(); err != nil {
+	err = repo.buildIndexes()
+	if err != nil {
 		logger.Warn("Failed to build initial indexes: %v", err)
 		// Don't fail initialization - we can still write entities
 	}
+	repo.sampleTagGrowth()
+	indexSource := IndexSourceRebuilt
+	if repo.persistentIndexLoaded {
+		indexSource = IndexSourcePersisted
+	}
+	entitiesLoaded := len(repo.shardedTagIndex.EntityIDs())
+	tagIndexEntries := repo.shardedTagIndex.GetEntryCount()
+	report.RecordIndexes(indexSource, entitiesLoaded, tagIndexEntries)
+	if repo.indexBuildUnreadable > 0 {
+		report.RecordRecoveryAction("unreadable_entities_skipped",
+			fmt.Sprintf("skipped %d entities that could not be read from the data file", repo.indexBuildUnreadable))
+	}
+	report.RecordPhase("index_build", phaseStart, map[string]interface{}{
+		"source":            indexSource,
+		"entities":          entitiesLoaded,
+		"tag_index_entries": tagIndexEntries,
+		"deleted_entities":  repo.shardedTagIndex.DeletedCount(),
+		"unreadable":        repo.indexBuildUnreadable,
+	}, err)
+	phaseStart = time.Now()
+	
+	// Build the ID filter before serving lookups
+	if repo.idFilter != nil {
+		repo.idFilter.rebuild(repo.storedEntityIDs)
+	}
 	
 	// Build performance indexes if possible, but don't fail if we can't
-	if err := repo.buildConcurrentIndexes(); err != nil {
+	err = repo.buildConcurrentIndexes()
+	if err != nil {
 		logger.Warn("Failed to build performance indexes: %v", err)
 		// Don't fail - we can still use the base repository functionality
 	}
+	report.RecordPhase("performance_indexes", phaseStart, nil, err)
+	phaseStart = time.Now()
+	
+	// Pinned entities are served from memory from the start
+	repo.entityCache.SetPinTags(parsePinTags(cfg.CachePinTags))
+	pinned := repo.loadPinnedEntities()
+	report.RecordPhase("pinned_entities", phaseStart, map[string]interface{}{
+		"entities": pinned,
+	}, nil)
 	
 	// Log entity count after building indexes
 	logger.Info("Initialized: %d entities cached, %d tag index entries", 
-		repo.entityCache.Stats().Size, repo.shardedTagIndex.GetEntryCount())
+		repo.entityCache.Stats().Size, tagIndexEntries)
 	
 	return repo, nil
 }
@@ -994,20 +1278,8 @@ func NewHighPerformanceRepositoryWithConfig(cfg *config.Config) (*EntityReposito
 		return nil, err
 	}
 	
-	// Initialize memory-mapped reader if possible
-	dbFile := repo.getDataFile()
-	if stat, err := os.Stat(dbFile); err == nil && stat.Size() > HeaderSize {
-		if mmapReader, err := NewMMapReader(dbFile); err == nil {
-			repo.mmapReader = mmapReader
-			logger.Info("High-performance mode: Memory-mapped reader initialized")
-		} else {
-			logger.Warn("High-performance mode: Failed to create memory-mapped reader: %v", err)
-		}
-	}
-	
-	// Initialize skip list and bloom filter
+	// Initialize skip list
 	repo.skipList = NewSkipList()
-	repo.bloomFilter = NewBloomFilter(100000, 0.01) // Support up to 100k entities with 1% false positive rate
 	
 	// Initialize parallel query processor
 	repo.queryProcessor = NewParallelQueryProcessor(repo)
@@ -1060,6 +1332,25 @@ func NewDatasetRepositoryWithConfig(cfg *config.Config) (*EntityRepository, erro
 }
 
 	
+// FlushPendingWrites writes the operations queued in the batch writer and
+// syncs the data file, returning the number of queued operations written.
+// Used when draining before shutdown; the WAL is left to the next checkpoint.
+func (r *EntityRepository) FlushPendingWrites() (int, error) {
+	flushed := 0
+	if r.batchWriter != nil {
+		flushed = r.batchWriter.PendingCount()
+		if err := r.batchWriter.Flush(); err != nil {
+			return 0, fmt.Errorf("error flushing batch writer: %w", err)
+		}
+	}
+	if r.writerManager != nil {
+		if err := r.writerManager.Flush(); err != nil {
+			return flushed, fmt.Errorf("error syncing data file: %w", err)
+		}
+	}
+	return flushed, nil
+}
+
 // Close properly shuts down the repository and its resources
 func (r *EntityRepository) Close() error {
 	var errors []error
@@ -1157,7 +1448,7 @@ func (r *EntityRepository) buildIndexes() error {
 	// This preserves indexes populated during WAL replay
 	if !entitiesAlreadyLoaded {
 		logger.Debug("Clearing indexes - no entities loaded yet")
-		r.shardedTagIndex = NewShardedTagIndex()
+		r.shardedTagIndex = r.newTagIndex()
 		r.contentIndex = make(map[string][]string)
 		r.temporalIndex = NewTemporalIndex()
 		r.namespaceIndex = NewNamespaceIndex()
@@ -1215,12 +1506,15 @@ func (r *EntityRepository) buildIndexes() error {
 		}
 		defer r.readerPool.Put(reader)
 		
-		// Read all entities
-		diskEntities, err := reader.GetAllEntities()
-		if err != nil {
-			return err
-		}
+		// Read all entities, decoding them in parallel
+		workers := resolveIndexRebuildSettings(r.config).workers
+		total := len(reader.EntityIDs())
+		progress := newStartupProgress("entity load", "entities", int64(total))
+		diskEntities := reader.GetAllEntitiesParallel(workers, func(done, _ int) {
+			progress.update(int64(done))
+		})
 		entities = diskEntities
+		r.indexBuildUnreadable = total - len(diskEntities)
 		
 		// Load entities and optionally build indexes
 		logger.Debug("Loading entities from disk: %d found", len(entities))
@@ -1236,6 +1530,16 @@ func (r *EntityRepository) buildIndexes() error {
 			logger.Debug("Processing entities sequentially (%d entities)", len(entities))
 			r.buildIndexesSequential(entities, entitiesAlreadyLoaded)
 		}
+		
+		// Rebuild the deletion set from each entity's current lifecycle state
+		for _, entity := range entities {
+			r.syncDeletionState(entity)
+			r.contentPaths.Index(entity)
+			r.datasetUsage.Observe(entity)
+			r.observeDatasetRecord(entity)
+			r.entitySummary.Observe(entity)
+			r.geoIndex.Observe(entity)
+		}
 	}
 	
 	return nil
@@ -1254,17 +1558,15 @@ func (r *EntityRepository) populateShardedIndexParallel(loadedIndex map[string][
 		entries = append(entries, indexEntry{tag: tag, entities: entities})
 	}
 	
-	// Process in parallel chunks for optimal memory usage and concurrency.
-	// ChunkSize defines entries processed per goroutine during index population.
-	// Value of 100 balances memory usage (100 entries ≈ 100KB-1MB depending on
-	// tag complexity) against goroutine overhead. Testing shows diminishing
-	// returns above 100-200 entries per chunk due to lock contention.
-	const chunkSize = 100
-	numWorkers := 4 // Reasonable number of workers for index population
+	// Worker count and chunk size come from the index rebuild configuration
+	// (ENTITYDB_INDEX_REBUILD_WORKERS / ENTITYDB_INDEX_REBUILD_CHUNK_SIZE).
+	settings := resolveIndexRebuildSettings(r.config)
+	numWorkers := settings.workers
+	chunkSize := settings.chunkSize
 	
 	if len(entries) > chunkSize {
-		// Use worker goroutines for large datasets
-		entryChan := make(chan indexEntry, numWorkers)
+		// Use worker goroutines for large datasets, handing out chunks of entries
+		chunkChan := make(chan []indexEntry, numWorkers)
 		var wg sync.WaitGroup
 		
 		// Start workers
@@ -1272,23 +1574,29 @@ func (r *EntityRepository) populateShardedIndexParallel(loadedIndex map[string][
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				for entry := range entryChan {
-					for _, entityID := range entry.entities {
-						r.shardedTagIndex.AddTag(entry.tag, entityID)
+				for chunk := range chunkChan {
+					for _, entry := range chunk {
+						for _, entityID := range entry.entities {
+							r.shardedTagIndex.AddTag(entry.tag, entityID)
+						}
 					}
 				}
 			}()
 		}
 		
 		// Send work to workers
-		for _, entry := range entries {
-			entryChan <- entry
+		for start := 0; start < len(entries); start += chunkSize {
+			end := start + chunkSize
+			if end > len(entries) {
+				end = len(entries)
+			}
+			chunkChan <- entries[start:end]
 		}
-		close(entryChan)
+		close(chunkChan)
 		
 		// Wait for completion
 		wg.Wait()
-		logger.Debug("Populated sharded index using %d workers", numWorkers)
+		logger.Debug("Populated sharded index using %d workers (chunk size %d)", numWorkers, chunkSize)
 	} else {
 		// Sequential processing for small datasets
 		for _, entry := range entries {
@@ -1299,19 +1607,19 @@ func (r *EntityRepository) populateShardedIndexParallel(loadedIndex map[string][
 	}
 }
 
-// buildIndexesParallel builds indexes using parallel processing for better performance
+// buildIndexesParallel builds indexes using parallel processing for better performance.
+// Workers claim entities in chunks and are paced by the optional I/O rate limit
+// so a rebuild does not starve other workloads sharing the disk.
 func (r *EntityRepository) buildIndexesParallel(entities []*models.Entity, entitiesAlreadyLoaded bool) {
-	// ChunkSize for entity processing balances memory usage with concurrency.
-	// Value of 50 entities per chunk provides optimal performance for most workloads:
-	// - Memory: ~50-500KB per chunk depending on entity content size
-	// - CPU: Reduces goroutine creation overhead vs per-entity processing
-	// - I/O: Batches disk operations for better throughput
-	// - Tested optimal range: 25-100 entities, 50 provides best balance
-	const chunkSize = 50
-	numWorkers := 4       // Use 4 workers for parallel processing
+	settings := resolveIndexRebuildSettings(r.config)
+	numWorkers := settings.workers
+	chunkSize := settings.chunkSize
+	throttle := newRebuildThrottle(settings.rateLimitMB)
+	startTime := time.Now()
+	var totalBytes int64
 	
 	// Create channels for work distribution
-	entityChan := make(chan *models.Entity, numWorkers)
+	chunkChan := make(chan []*models.Entity, numWorkers)
 	var wg sync.WaitGroup
 	
 	// Temporary storage for parallel results (to avoid lock contention)
@@ -1333,109 +1641,155 @@ func (r *EntityRepository) buildIndexesParallel(entities []*models.Entity, entit
 			defer wg.Done()
 			logger.Trace("Index worker %d started", workerID)
 			
-			for entity := range entityChan {
-				result := indexResult{
-					entityID:         entity.ID,
-					tagMappings:      make(map[string]bool),
-					contentMappings:  make(map[string]bool),
-					temporalEntries:  make([]temporalEntry, 0),
-					namespaceEntries: make([]namespaceEntry, 0),
+			for chunk := range chunkChan {
+				var chunkBytes int64
+				for _, entity := range chunk {
+					chunkBytes += estimateEntitySize(entity)
 				}
+				throttle.wait(chunkBytes)
 				
-				// Process tags
-				for _, tag := range entity.Tags {
-					result.tagMappings[tag] = true
+				for _, entity := range chunk {
+					result := indexResult{
+						entityID:         entity.ID,
+						tagMappings:      make(map[string]bool),
+						contentMappings:  make(map[string]bool),
+						temporalEntries:  make([]temporalEntry, 0),
+						namespaceEntries: make([]namespaceEntry, 0),
+					}
 					
-					// Handle temporal tags
-					if strings.Contains(tag, "|") {
-						parts := strings.SplitN(tag, "|", 2)
-						if len(parts) == 2 {
-							// Index non-timestamped version
-							actualTag := parts[1]
-							result.tagMappings[actualTag] = true
-							
-							// Temporal index entry
-							if timestampNanos, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
-								timestamp := time.Unix(0, timestampNanos)
-								result.temporalEntries = append(result.temporalEntries, temporalEntry{
-									entityID:  entity.ID,
-									tag:       tag,
-									timestamp: timestamp,
-								})
+					// Process tags
+					for _, tag := range entity.Tags {
+						result.tagMappings[tag] = true
+						
+						// Handle temporal tags
+						if strings.Contains(tag, "|") {
+							parts := strings.SplitN(tag, "|", 2)
+							if len(parts) == 2 {
+								// Index non-timestamped version
+								actualTag := parts[1]
+								result.tagMappings[actualTag] = true
+								
+								// Temporal index entry
+								if timestampNanos, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+									timestamp := time.Unix(0, timestampNanos)
+									result.temporalEntries = append(result.temporalEntries, temporalEntry{
+										entityID:  entity.ID,
+										tag:       tag,
+										timestamp: timestamp,
+									})
+								}
 							}
 						}
+						
+						// Namespace index entry
+						result.namespaceEntries = append(result.namespaceEntries, namespaceEntry{
+							entityID: entity.ID,
+							tag:      tag,
+						})
 					}
 					
-					// Namespace index entry
-					result.namespaceEntries = append(result.namespaceEntries, namespaceEntry{
-						entityID: entity.ID,
-						tag:      tag,
-					})
-				}
-				
-				// Process content
-				if len(entity.Content) > 0 {
-					contentStr := string(entity.Content)
-					result.contentMappings[contentStr] = true
+					// Process content
+					if len(entity.Content) > 0 {
+						contentStr := string(entity.Content)
+						result.contentMappings[contentStr] = true
+					}
+					
+					resultChan <- result
 				}
-				
-				resultChan <- result
 			}
 			logger.Trace("Index worker %d finished", workerID)
 		}(i)
 	}
 	
-	// Send entities to workers
+	// Send entities to workers in chunks
 	go func() {
-		for _, entity := range entities {
-			// Add to entity cache (only if not already loaded)
-			if !entitiesAlreadyLoaded {
-				r.entityCache.Put(entity.ID, entity)
-				r.loadedEntityCount++
+		for start := 0; start < len(entities); start += chunkSize {
+			end := start + chunkSize
+			if end > len(entities) {
+				end = len(entities)
 			}
-			entityChan <- entity
+			chunk := entities[start:end]
+			for _, entity := range chunk {
+				// Add to entity cache (only if not already loaded)
+				if !entitiesAlreadyLoaded {
+					r.entityCache.Put(entity.ID, entity)
+					r.loadedEntityCount++
+				}
+				totalBytes += estimateEntitySize(entity)
+			}
+			chunkChan <- chunk
 		}
-		close(entityChan)
+		close(chunkChan)
 	}()
 	
 	// Wait for workers to complete
 	wg.Wait()
 	close(resultChan)
 	
-	// Collect results and update indexes (this must be sequential to avoid race conditions)
+	// Collect results. The tag index is loaded shard by shard in parallel
+	// while the unsharded indexes are filled on a single goroutine.
 	logger.Debug("Collecting parallel indexing results...")
+	results := make([]indexResult, 0, len(entities))
 	for result := range resultChan {
-		// Update tag indexes and tag variant cache
-		for tag := range result.tagMappings {
-			r.shardedTagIndex.AddTag(tag, result.entityID)
-			
+		results = append(results, result)
+	}
+	
+	var others sync.WaitGroup
+	others.Add(1)
+	go func() {
+		defer others.Done()
+		for _, result := range results {
 			// Update tag variant cache for temporal tags
-			if r.useVariantCache && strings.Contains(tag, "|") {
-				parts := strings.SplitN(tag, "|", 2)
-				if len(parts) == 2 {
-					cleanTag := parts[1]
-					r.tagVariantCache.AddTagVariant(tag, cleanTag, result.entityID)
+			if r.useVariantCache {
+				for tag := range result.tagMappings {
+					if parts := strings.SplitN(tag, "|", 2); len(parts) == 2 {
+						r.tagVariantCache.AddTagVariant(tag, parts[1], result.entityID)
+					}
 				}
 			}
+			
+			// Update content index
+			for content := range result.contentMappings {
+				r.contentIndex[content] = append(r.contentIndex[content], result.entityID)
+			}
+			
+			// Update temporal index
+			for _, entry := range result.temporalEntries {
+				r.temporalIndex.AddEntry(entry.entityID, entry.tag, entry.timestamp)
+			}
+			
+			// Update namespace index
+			for _, entry := range result.namespaceEntries {
+				r.namespaceIndex.AddTag(entry.entityID, entry.tag)
+			}
 		}
-		
-		// Update content index
-		for content := range result.contentMappings {
-			r.contentIndex[content] = append(r.contentIndex[content], result.entityID)
-		}
-		
-		// Update temporal index
-		for _, entry := range result.temporalEntries {
-			r.temporalIndex.AddEntry(entry.entityID, entry.tag, entry.timestamp)
-		}
-		
-		// Update namespace index
-		for _, entry := range result.namespaceEntries {
-			r.namespaceIndex.AddTag(entry.entityID, entry.tag)
+	}()
+	
+	postings := make([]map[string][]string, NumShards)
+	for _, result := range results {
+		for tag := range result.tagMappings {
+			i := tagShardIndex(tag)
+			if postings[i] == nil {
+				postings[i] = make(map[string][]string)
+			}
+			postings[i][tag] = append(postings[i][tag], result.entityID)
 		}
 	}
+	r.shardedTagIndex.LoadPostings(postings, numWorkers)
+	others.Wait()
+	
+	r.recordIndexRebuild(IndexRebuildStats{
+		StartedAt:    startTime,
+		Duration:     time.Since(startTime),
+		Entities:     int64(len(entities)),
+		Bytes:        totalBytes,
+		Workers:      numWorkers,
+		ChunkSize:    chunkSize,
+		RateLimitMB:  settings.rateLimitMB,
+		ThrottledFor: throttle.throttledFor(),
+	})
 	
-	logger.Debug("Parallel indexing completed for %d entities using %d workers", len(entities), numWorkers)
+	logger.Debug("Parallel indexing completed for %d entities using %d workers (chunk size %d)", len(entities), numWorkers, chunkSize)
 }
 
 // buildIndexesSequential builds indexes using sequential processing (fallback method)
@@ -1515,6 +1869,7 @@ func (r *EntityRepository) buildIndexesSequential(entities []*models.Entity, ent
 // This function MUST be called with the mutex already locked
 func (r *EntityRepository) updateIndexes(entity *models.Entity) {
 	logger.Trace("Updating indexes for entity %s (%d tags)", entity.ID, len(entity.Tags))
+	r.noteIndexChange(entity.ID)
 	
 	// Helper function to remove entity ID from tag index
 	removeEntityFromTag := func(tag, entityID string) {
@@ -1526,7 +1881,8 @@ func (r *EntityRepository) updateIndexes(entity *models.Entity) {
 
 	// CRITICAL: First remove all existing index entries for this entity
 	// This prevents duplicate entries when updating
-	if existingEntity, exists := r.entityCache.Get(entity.ID); exists {
+	existingEntity, exists := r.entityCache.Get(entity.ID)
+	if exists {
 		// Remove entity from tag variant cache first
 		if r.useVariantCache {
 			r.tagVariantCache.RemoveEntityFromVariant(entity.ID)
@@ -1563,15 +1919,6 @@ func (r *EntityRepository) updateIndexes(entity *models.Entity) {
 		if strings.Contains(tag, "|") {
 			parts := strings.SplitN(tag, "|", 2)
 			if len(parts) == 2 {
-				// Try to parse timestamp as nanosecond epoch
-				if timestampNanos, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
-					timestamp := time.Unix(0, timestampNanos)
-					r.temporalIndex.AddEntry(entity.ID, tag, timestamp)
-					logger.Trace("Added to temporal index: %s", entity.ID)
-				} else {
-					logger.Trace("Failed to parse timestamp in tag: %s", tag)
-				}
-				
 				// Index the actual tag part too
 				actualTag := parts[1]
 				logger.Trace("Indexing non-timestamped: %s for %s", actualTag, entity.ID)
@@ -1587,6 +1934,17 @@ func (r *EntityRepository) updateIndexes(entity *models.Entity) {
 		// Add to namespace index
 		r.namespaceIndex.AddTag(entity.ID, tag)
 	}
+
+	// Record the tags added and removed and any content change in the
+	// entity's history. A cached entity modified in place does not tell the
+	// previous content.
+	if existingEntity == entity {
+		existingEntity = nil
+	}
+	r.temporalIndex.RecordWrite(entity, existingEntity, time.Now())
+	
+	// Hide soft-deleted entities from tag lookups, or show restored ones again
+	r.syncDeletionState(entity)
 	
 	// Mark tag index as dirty
 	r.tagIndexDirty = true
@@ -1597,20 +1955,42 @@ func (r *EntityRepository) updateIndexes(entity *models.Entity) {
 		r.contentIndex[contentStr] = append(r.contentIndex[contentStr], entity.ID)
 		logger.Trace("Indexed %d bytes of content for %s", len(contentStr), entity.ID)
 	}
+	r.contentPaths.Index(entity)
+	r.datasetUsage.Observe(entity)
+	r.observeDatasetRecord(entity)
+	r.entitySummary.Observe(entity)
+	r.geoIndex.Observe(entity)
+	
+	// Added last, so a concurrent filter rebuild that misses this add lists
+	// the entity from the tag index
+	r.idFilter.add(entity.ID, r.storedEntityIDs)
 	
 	// Dump tag index for debugging - removed as too verbose
 }
 
 // Create creates a new entity with strong durability guarantees
 func (r *EntityRepository) Create(entity *models.Entity) error {
+	return r.CreateContext(context.Background(), entity)
+}
+
+// CreateContext creates an entity, recording its storage spans under the
+// trace of ctx
+func (r *EntityRepository) CreateContext(ctx context.Context, entity *models.Entity) (err error) {
+	ctx, span := tracing.Start(ctx, "repository.create", entityAttributes(entity)...)
+	defer func() { tracing.End(span, err) }()
+	
+	if err := r.datasetUsage.Check(entity); err != nil {
+		return err
+	}
+	
 	// CRITICAL: Use RecursionGuard to prevent infinite loops in entity creation
 	// This prevents: metrics → entity → metrics → entity → stack overflow
 	executed, err := globalRecursionGuard.Execute("entity-create", func() error {
 		// Use single writer queue if enabled for additional corruption prevention
 		if r.useSingleWriter && r.writerQueue != nil && r.writerQueue.IsRunning() {
-			return r.writerQueue.CreateEntity(entity)
+			return r.writerQueue.CreateEntity(ctx, entity)
 		}
-		return r.createInternal(entity)
+		return r.createInternal(ctx, entity)
 	})
 	
 	if !executed {
@@ -1618,11 +1998,15 @@ func (r *EntityRepository) Create(entity *models.Entity) error {
 		return fmt.Errorf("recursion guard: entity creation blocked to prevent infinite loops")
 	}
 	
+	if err == nil {
+		r.recordChange(ChangeOpCreate, entity.ID, entity.GetDataset(), nil)
+	}
+	
 	return err
 }
 
 // createInternal contains the actual entity creation logic
-func (r *EntityRepository) createInternal(entity *models.Entity) error {
+func (r *EntityRepository) createInternal(ctx context.Context, entity *models.Entity) error {
 	startTime := time.Now()
 	
 	// Generate UUID only if no ID is provided
@@ -1630,6 +2014,14 @@ func (r *EntityRepository) createInternal(entity *models.Entity) error {
 		entity.ID = models.GenerateUUID()
 	}
 	
+	// A content-addressed chunk is re-created under the ID of a deleted chunk
+	// when the same data is stored again; the new chunk supersedes the deletion
+	if r.deletionIndex != nil && models.IsContentAddressedChunkID(entity.ID) {
+		if _, deleted := r.deletionIndex.GetEntry(entity.ID); deleted {
+			r.deletionIndex.RemoveEntry(entity.ID)
+		}
+	}
+	
 	entity.CreatedAt = models.Now()
 	entity.UpdatedAt = entity.CreatedAt
 	
@@ -1644,7 +2036,10 @@ func (r *EntityRepository) createInternal(entity *models.Entity) error {
 			timestampedTags = append(timestampedTags, tag)
 		}
 	}
-	entity.Tags = timestampedTags
+	entity.SetTags(timestampedTags)
+	if err := signEntity(entity); err != nil {
+		return err
+	}
 	
 	// Note: Checksum generation disabled - was causing systematic validation failures
 	// without providing real security value. Can be re-implemented properly if needed.
@@ -1656,36 +2051,56 @@ func (r *EntityRepository) createInternal(entity *models.Entity) error {
 	// Use batch writer if enabled for better throughput
 	if r.useBatchWrites && r.batchWriter != nil {
 		logger.Trace("Using batch writer for entity creation: %s", entity.ID)
-		return r.batchWriter.AddCreate(entity)
+		// Resolved before queueing: a full batch is flushed concurrently
+		strict := r.writeDurability(ctx, entity) == DurabilityStrict
+		_, span := tracing.Start(ctx, "batch.enqueue")
+		err := r.batchWriter.AddCreate(entity)
+		tracing.End(span, err)
+		if err == nil && strict {
+			// A strict write returns once its batch is fsynced to the WAL
+			_, span = tracing.Start(ctx, "batch.flush")
+			err = r.batchWriter.Flush()
+			tracing.End(span, err)
+		}
+		return err
 	}
 	
 	// Fallback to individual write operation
 	logger.Trace("Using individual write for entity creation: %s", entity.ID)
 	
 	// Log to WAL first
-	if err := r.wal.LogCreate(entity); err != nil {
+	_, span := tracing.Start(ctx, "wal.write")
+	err := r.wal.LogCreate(entity)
+	tracing.End(span, err)
+	if err != nil {
 		return fmt.Errorf("error logging to WAL: %w", err)
 	}
 	
 	// Write entity with locking
+	lockStart := time.Now()
 	r.lockManager.AcquireEntityLock(entity.ID, WriteLock)
+	RequestStatsFrom(ctx).recordLockWait(lockStart)
 	defer r.lockManager.ReleaseEntityLock(entity.ID, WriteLock)
 	
 	// CRITICAL: Update indexes BEFORE writing to ensure atomicity
 	// This prevents the entity from being written without indexes
+	_, span = tracing.Start(ctx, "index.update")
 	r.mu.Lock()
 	r.updateIndexes(entity)
 	// Store entity in-memory as well
 	r.entityCache.Put(entity.ID, entity)
 	r.mu.Unlock()
+	span.End()
 	
 	// Write entity using WriterManager with atomic operations if enabled
+	_, span = tracing.Start(ctx, "disk.write")
 	var writeErr error
 	if r.useAtomicOperations {
 		writeErr = r.writerManager.WriteEntityAtomic(entity)
 	} else {
 		writeErr = r.writerManager.WriteEntity(entity)
 	}
+	tracing.End(span, writeErr)
 	
 	if writeErr != nil {
 		// Rollback index changes on write failure
@@ -1709,37 +2124,11 @@ func (r *EntityRepository) createInternal(entity *models.Entity) error {
 	// Invalidate cache
 	r.cache.Clear()
 	
-	// Invalidate reader pool to force new readers to see the entity
-	// Close old pool and create new bounded pool to prevent FD corruption
-	if r.readerPool != nil {
-		r.readerPool.Close()
-	}
-	var refreshErr error
-	r.readerPool, refreshErr = NewReaderPool(r.getDataFile(), 2, 8)
-	if refreshErr != nil {
-		logger.Error("Failed to recreate reader pool: %v", refreshErr)
-	}
-	
-	// Explicitly sync to disk to ensure persistence
-	if err := r.writerManager.Flush(); err != nil {
-		logger.Error("Failed to flush writes to disk: %v", err)
-		return fmt.Errorf("failed to flush entity to disk: %w", err)
-	}
-	
-	// Force a checkpoint to ensure data is fully persisted
-	if err := r.writerManager.Checkpoint(); err != nil {
-		logger.Error("Failed to checkpoint after create: %v", err)
-		// Don't fail the write, just log the error
-	}
-	
-	// After checkpoint, invalidate reader pool to ensure readers see the updated index
-	// This provides fresh readers while maintaining bounded file descriptors
+	// WriteEntity returned once a group commit synced the entity to disk
+	// and checkpointed the header and index; pooled readers opened before
+	// then are replaced as they are next borrowed
 	if r.readerPool != nil {
-		if invalidateErr := r.readerPool.Invalidate(); invalidateErr != nil {
-			logger.Error("Failed to invalidate reader pool: %v", invalidateErr)
-		} else {
-			logger.Debug("Reader pool invalidated after checkpoint for fresh data access")
-		}
+		r.readerPool.Advance()
 	}
 	
 	logger.Debug("Created entity: %s", entity.ID)
@@ -1764,7 +2153,15 @@ func (r *EntityRepository) createInternal(entity *models.Entity) error {
 
 // GetByID gets an entity by ID with improved reliability from in-memory cache
 func (r *EntityRepository) GetByID(id string) (*models.Entity, error) {
+	return r.GetByIDContext(context.Background(), id)
+}
+
+// GetByIDContext gets an entity by ID, recording the cache lookup and any
+// disk read as spans under the trace of ctx
+func (r *EntityRepository) GetByIDContext(ctx context.Context, id string) (entity *models.Entity, err error) {
 	logger.Trace("GetByID: %s", id)
+	ctx, span := tracing.Start(ctx, "repository.get", attribute.String("entity.id", id))
+	defer func() { tracing.End(span, err) }()
 	
 	// Check if entity is in deletion index
 	if r.deletionIndex != nil {
@@ -1773,10 +2170,23 @@ func (r *EntityRepository) GetByID(id string) (*models.Entity, error) {
 		}
 	}
 	
+	// Writes still queued in the batch writer are newer than anything cached
+	if r.batchWriter != nil {
+		if entity, pending := r.batchWriter.Pending(id); pending {
+			logger.Trace("Found in pending writes: %s", id)
+			span.SetAttributes(attribute.String("entity.source", "pending"))
+			RequestStatsFrom(ctx).recordCacheHit()
+			return entity, nil
+		}
+	}
+
 	// First check in-memory cache for the entity
 	entity, exists := r.entityCache.Get(id)
+	span.SetAttributes(attribute.Bool("cache.hit", exists))
 	if exists {
 		logger.Trace("Found in memory cache: %s", id)
+		span.SetAttributes(attribute.String("entity.source", "cache"))
+		RequestStatsFrom(ctx).recordCacheHit()
 		// Skip metrics for metric entities to avoid recursion
 		if !storageMetricsDisabled && storageMetrics != nil && !isMetricEntity(entity) && !isMetricsOperation() {
 			storageMetrics.TrackCacheOperation("entity", true)
@@ -1784,6 +2194,13 @@ func (r *EntityRepository) GetByID(id string) (*models.Entity, error) {
 		return entity, nil
 	}
 	
+	// An ID the filter has never seen is not stored; skip the disk read and
+	// recovery attempts a miss would otherwise cost
+	if !r.idFilter.mayContain(id) {
+		span.SetAttributes(attribute.String("entity.source", "id_filter"))
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	
 	// Cache miss - we don't have the entity yet to check its type, so use ID-based heuristic
 	// Most metric entities won't pass this check anyway since they get created later
 	if !storageMetricsDisabled && storageMetrics != nil && !strings.HasPrefix(id, "metric_") && !isMetricsOperation() {
@@ -1803,37 +2220,29 @@ func (r *EntityRepository) GetByID(id string) (*models.Entity, error) {
 		}
 	}
 	
-	// Skip flush and checkpoint for metric entities to avoid infinite recursion
-	// For non-metric entities, force a flush and checkpoint
-	if !strings.HasPrefix(id, "metric_") {
-		// Force a flush and checkpoint of any pending writes before attempting to read
-		// This ensures that we can read immediately after writing
-		if err := r.writerManager.Flush(); err != nil {
-			logger.Error("Failed to flush writes: %v", err)
-			// Continue anyway as we might still find the entity
-		}
-		
-		// Also force a checkpoint to ensure index is updated
-		if err := r.writerManager.Checkpoint(); err != nil {
-			logger.Error("Failed to checkpoint: %v", err)
-			// Continue anyway as we might still find the entity
-		}
-	}
-	
+	// No checkpoint is needed before reading: every write to the data file is
+	// checkpointed, queued writes are served from the pending overlay above and
+	// versions only in the WAL stay pinned in the entity cache.
+
 	// Acquire read lock for the entity
+	lockStart := time.Now()
 	r.lockManager.AcquireEntityLock(id, ReadLock)
+	RequestStatsFrom(ctx).recordLockWait(lockStart)
 	defer r.lockManager.ReleaseEntityLock(id, ReadLock)
 	
-	// Get a reader from the pool
-	reader, err := r.readerPool.Get()
-	if err != nil {
-		logger.Error("Failed to get reader from pool: %v", err)
-		return nil, err
-	}
-	defer r.readerPool.Put(reader)
-	
 	readStart := time.Now()
-	entity, err = reader.GetEntity(id)
+	span.SetAttributes(attribute.String("entity.source", "disk"))
+	_, readSpan := tracing.Start(ctx, "disk.read")
+	entity, err = r.readEntity(id)
+	if err != nil && found {
+		// Pooled readers keep the index they were opened with. An indexed
+		// entity that was written and evicted from the cache since then is
+		// only visible to readers opened after that write's checkpoint.
+		r.readerPool.Advance()
+		entity, err = r.readEntity(id)
+	}
+	tracing.End(readSpan, err)
+	RequestStatsFrom(ctx).recordDiskRead(entity)
 	readDuration := time.Since(readStart)
 	
 	// Track read metrics (skip metric entities to avoid recursion)
@@ -1862,6 +2271,9 @@ func (r *EntityRepository) GetByID(id string) (*models.Entity, error) {
 		} else {
 			logger.Error("Recovery failed for entity %s: %v", id, recErr)
 		}
+		if found {
+			r.quarantineReadFailure(id, err)
+		}
 		
 		return nil, err
 	}
@@ -1879,16 +2291,69 @@ func (r *EntityRepository) GetByID(id string) (*models.Entity, error) {
 	return entity, nil
 }
 
+// readEntity reads an entity from disk, from the memory-mapped data file
+// when it can be mapped and with a pooled reader otherwise
+func (r *EntityRepository) readEntity(id string) (*models.Entity, error) {
+	if mapped := r.readerPool.Mapped(); mapped != nil {
+		entity, err := mapped.GetEntity(id)
+		if err != errMMapClosed {
+			return entity, err
+		}
+	}
+	
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		logger.Error("Failed to get reader from pool: %v", err)
+		return nil, err
+	}
+	defer r.readerPool.Put(reader)
+	return reader.GetEntity(id)
+}
+
 // Update updates an existing entity
 func (r *EntityRepository) Update(entity *models.Entity) error {
+	return r.UpdateContext(context.Background(), entity)
+}
+
+// UpdateContext updates an entity, recording its storage spans under the
+// trace of ctx
+func (r *EntityRepository) UpdateContext(ctx context.Context, entity *models.Entity) error {
+	if r.changeCounters != nil {
+		unlock := r.changeCounters.lockEntity(entity.ID)
+		defer unlock()
+	}
+	return r.update(ctx, entity)
+}
+
+// update applies an update and bumps the entity's change counter. Callers
+// hold the entity's update lock.
+func (r *EntityRepository) update(ctx context.Context, entity *models.Entity) (err error) {
+	ctx, span := tracing.Start(ctx, "repository.update", entityAttributes(entity)...)
+	defer func() { tracing.End(span, err) }()
+	
+	if err := r.checkLegalHold(ctx, entity); err != nil {
+		return err
+	}
+	if err := r.checkWriteOnce(ctx, entity); err != nil {
+		return err
+	}
+	
+	if err := r.datasetUsage.Check(entity); err != nil {
+		return err
+	}
+	
+	if err := r.saveContentVersion(ctx, entity); err != nil {
+		return err
+	}
+	
 	// CRITICAL: Use RecursionGuard to prevent infinite loops in update operations
 	// This prevents: metrics → Update → metrics → Update → stack overflow
 	executed, err := globalRecursionGuard.Execute("entity-update", func() error {
 		// Use single writer queue if enabled for additional corruption prevention
 		if r.useSingleWriter && r.writerQueue != nil && r.writerQueue.IsRunning() {
-			return r.writerQueue.UpdateEntity(entity)
+			return r.writerQueue.UpdateEntity(ctx, entity)
 		}
-		return r.updateInternal(entity)
+		return r.updateInternal(ctx, entity)
 	})
 	
 	if !executed {
@@ -1896,11 +2361,15 @@ func (r *EntityRepository) Update(entity *models.Entity) error {
 		return fmt.Errorf("recursion guard: entity update blocked to prevent infinite loops")
 	}
 	
+	if err == nil {
+		r.recordChange(ChangeOpUpdate, entity.ID, entity.GetDataset(), nil)
+	}
+	
 	return err
 }
 
 // updateInternal contains the actual update logic
-func (r *EntityRepository) updateInternal(entity *models.Entity) error {
+func (r *EntityRepository) updateInternal(ctx context.Context, entity *models.Entity) error {
 	startTime := time.Now()
 	
 	if entity.ID == "" {
@@ -1915,8 +2384,17 @@ func (r *EntityRepository) updateInternal(entity *models.Entity) error {
 		}
 	}
 	
+	// Apply a queued create or tag first so it cannot overwrite this update
+	if r.batchWriter != nil {
+		if _, pending := r.batchWriter.Pending(entity.ID); pending {
+			if err := r.batchWriter.Flush(); err != nil {
+				return fmt.Errorf("failed to flush pending writes: %w", err)
+			}
+		}
+	}
+	
 	// Verify the entity exists (prevents ID manipulation)
-	existingEntity, err := r.GetByID(entity.ID)
+	existingEntity, err := r.GetByIDContext(ctx, entity.ID)
 	if err != nil {
 		// Record failure in circuit breaker
 		if r.updateCircuitBreaker != nil {
@@ -1942,12 +2420,18 @@ func (r *EntityRepository) updateInternal(entity *models.Entity) error {
 			timestampedTags = append(timestampedTags, tag)
 		}
 	}
-	entity.Tags = timestampedTags
+	entity.SetTags(timestampedTags)
+	if err := signEntity(entity); err != nil {
+		return err
+	}
 	
 	// Content in the new model is just binary data - no timestamps needed
 	
 	// Log to WAL first
-	if err := r.wal.LogUpdate(entity); err != nil {
+	_, span := tracing.Start(ctx, "wal.write")
+	err = r.wal.LogUpdate(entity)
+	tracing.End(span, err)
+	if err != nil {
 		// Record failure in circuit breaker
 		if r.updateCircuitBreaker != nil {
 			r.updateCircuitBreaker.RecordFailure(entity.ID, err)
@@ -1955,28 +2439,49 @@ func (r *EntityRepository) updateInternal(entity *models.Entity) error {
 		return fmt.Errorf("error logging to WAL: %w", err)
 	}
 	
-	// INCREMENTAL UPDATE ARCHITECTURE FIX
-	// Previous implementation caused massive CPU spikes by:
-	// 1. Reading ALL entities from disk
-	// 2. Rewriting the ENTIRE database file
-	// 3. Rebuilding ALL indexes from scratch
-	// 4. Clearing ALL caches
-	// This new approach updates only in-memory structures and relies on WAL for durability
+	// INCREMENTAL UPDATE ARCHITECTURE
+	// The new version is appended to the data file and the file index entry
+	// is repointed to it, like Create. The previous record stays in the file
+	// until compaction, so an update costs O(entity size), not O(file size).
 	
 	// Acquire write lock for in-memory update
+	lockStart := time.Now()
 	r.lockManager.AcquireEntityLock(entity.ID, WriteLock)
+	RequestStatsFrom(ctx).recordLockWait(lockStart)
 	defer r.lockManager.ReleaseEntityLock(entity.ID, WriteLock)
 	
-	// Update in-memory entity storage
+	// Update indexes incrementally (no full rebuild). This must run before the
+	// cache is updated: updateIndexes removes the index entries of the cached
+	// previous version.
+	_, span = tracing.Start(ctx, "index.update")
 	r.mu.Lock()
-	r.entityCache.Put(entity.ID, entity)
-	
-	// Update indexes incrementally (no full rebuild)
 	r.updateIndexes(entity)
 	r.mu.Unlock()
+	span.End()
+	
+	// Append the new version. If that fails the update is still in the WAL,
+	// so keep it pinned in memory for the next checkpoint to persist.
+	_, span = tracing.Start(ctx, "disk.write")
+	err = r.writerManager.WriteEntity(entity)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Warn("Failed to append update for entity %s, deferring to checkpoint: %v", entity.ID, err)
+		r.mu.Lock()
+		r.entityCache.PutDirty(entity.ID, entity)
+		r.mu.Unlock()
+	} else {
+		r.mu.Lock()
+		r.entityCache.Put(entity.ID, entity)
+		r.mu.Unlock()
+		
+		// Pooled readers still point at the previous record
+		r.readerPool.Advance()
+	}
 	
-	// Invalidate cache for this specific entity only (not all caches)
+	// Invalidate cache for this specific entity and cached tag queries, which
+	// may still list the entity under tags the update removed
 	r.cache.Invalidate(entity.ID)
+	r.cache.Invalidate("tag:")
 	
 	// Save tag index periodically (but don't force a rebuild)
 	if err := r.SaveTagIndexIfNeeded(); err != nil {
@@ -2163,8 +2668,23 @@ func (r *EntityRepository) GetBaseRepository() *EntityRepository {
 	return r
 }
 
-// Delete deletes an entity
+// Delete deletes an entity and its content versions
 func (r *EntityRepository) Delete(id string) error {
+	if err := r.checkLegalHoldID(id); err != nil {
+		return err
+	}
+	if err := r.checkWriteOnceDelete(id); err != nil {
+		return err
+	}
+	if err := r.deleteEntity(id); err != nil {
+		return err
+	}
+	r.deleteContentVersions(id)
+	return nil
+}
+
+// deleteEntity deletes an entity, leaving its content versions
+func (r *EntityRepository) deleteEntity(id string) error {
 	// ENHANCED LOGGING: Track entity lifecycle for stale entry debugging
 	logger.Info("ENTITY_LIFECYCLE: Deleting entity %s", id)
 	
@@ -2208,6 +2728,7 @@ func (r *EntityRepository) Delete(id string) error {
 	// Remove from all indexes
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.noteIndexChange(id)
 	
 	// Remove from cache
 	r.cache.Clear() // Clear entire cache since we don't have per-entity removal
@@ -2236,6 +2757,17 @@ func (r *EntityRepository) Delete(id string) error {
 		r.temporalIndex.RemoveEntity(id)
 	}
 	
+	r.contentPaths.Remove(id)
+	r.datasetUsage.Remove(id)
+	r.forgetDatasetRecord(id)
+	r.entitySummary.Remove(id)
+	r.geoIndex.Remove(id)
+	
+	// The entity is gone, so it no longer needs a deletion bit
+	r.shardedTagIndex.MarkActive(id)
+	
+	r.recordChange(ChangeOpDelete, id, entity.GetDataset(), entity.GetTagsWithoutTimestamp())
+	
 	logger.Info("Delete.entity_repository: Successfully deleted entity %s", id)
 	
 	return nil
@@ -2263,18 +2795,21 @@ func (r *EntityRepository) Rollback(tx interface{}) error {
 
 // List lists all entities
 func (r *EntityRepository) List() ([]*models.Entity, error) {
+	return r.ListContext(context.Background())
+}
+
+// ListContext lists all entities, abandoning the scan with the context's
+// error once ctx is cancelled or its deadline passes
+func (r *EntityRepository) ListContext(ctx context.Context) ([]*models.Entity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	startTime := time.Now()
 	
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	
-	reader, err := r.readerPool.Get()
-	if err != nil {
-		return nil, err
-	}
-	defer r.readerPool.Put(reader)
-	
-	entities, err := reader.GetAllEntities()
+	entities, err := r.readAllEntities(ctx)
 	
 	// Filter out deleted entities
 	if r.deletionIndex != nil && entities != nil {
@@ -2314,8 +2849,53 @@ func (r *EntityRepository) List() ([]*models.Entity, error) {
 	return entities, err
 }
 
+// readAllEntities reads every entity in the data file, like readEntity
+// preferring the memory mapping
+func (r *EntityRepository) readAllEntities(ctx context.Context) ([]*models.Entity, error) {
+	if mapped := r.readerPool.Mapped(); mapped != nil {
+		var entities []*models.Entity
+		var err error
+		if skipsContent(ctx) {
+			entities, err = mapped.GetAllEntitiesWithoutContent(ctx)
+		} else {
+			entities, err = mapped.GetAllEntitiesContext(ctx)
+		}
+		if err != errMMapClosed {
+			return entities, err
+		}
+	}
+	
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer r.readerPool.Put(reader)
+	if skipsContent(ctx) {
+		return reader.GetAllEntitiesWithoutContent(ctx)
+	}
+	return reader.GetAllEntitiesContext(ctx)
+}
+
 // ListByTag lists entities with a specific tag
 func (r *EntityRepository) ListByTag(tag string) ([]*models.Entity, error) {
+	return r.ListByTagContext(context.Background(), tag)
+}
+
+// ListByTagContext lists entities with a specific tag, abandoning the reads
+// with the context's error once ctx is cancelled or its deadline passes
+func (r *EntityRepository) ListByTagContext(ctx context.Context, tag string) ([]*models.Entity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entities, err := r.listByTag(ctx, tag)
+	if err == nil && r.batchWriter != nil {
+		entities = r.batchWriter.overlay.applyToTagResult(tag, entities)
+	}
+	return entities, err
+}
+
+// listByTag looks a tag up in the indexes, without queued writes
+func (r *EntityRepository) listByTag(ctx context.Context, tag string) ([]*models.Entity, error) {
 	startTime := time.Now()
 	logger.Trace("ListByTag: %s", tag)
 	
@@ -2346,20 +2926,29 @@ func (r *EntityRepository) ListByTag(tag string) ([]*models.Entity, error) {
 	// Use sharded index for better concurrency
 	logger.Trace("ListByTag: Using sharded index for tag: %s", tag)
 		
+		// Deleted entities are skipped by the index itself, except when
+		// looking up lifecycle tags, which is how deleted entities are found
+		includeDeleted := strings.HasPrefix(tag, lifecycleTagPrefix)
+		
 		// Direct lookup first
-		directMatches := r.shardedTagIndex.GetEntitiesForTag(tag)
+		var directMatches []string
+		if includeDeleted {
+			directMatches = r.shardedTagIndex.GetEntitiesForTagIncludingDeleted(tag)
+		} else {
+			directMatches = r.shardedTagIndex.GetEntitiesForTag(tag)
+		}
 		logger.Trace("ListByTag: Direct matches from sharded index: %d", len(directMatches))
 		
 		var temporalMatches []string
 		if r.useVariantCache {
 			// OPTIMIZED: Use pre-computed tag variant cache instead of scanning
 			logger.Trace("Using tag variant cache for optimized temporal lookup")
-			temporalMatches = r.tagVariantCache.GetEntitiesForVariant(tag)
-			if temporalMatches == nil {
-				temporalMatches = []string{}
-			}
-		} else {
+			temporalMatches = r.filterDeletedForTag(tag, r.tagVariantCache.GetEntitiesForVariant(tag))
+		} else if includeDeleted {
 			// FALLBACK: Use slow temporal tag scanning
+			logger.Trace("Using legacy temporal tag scanning (variant cache disabled)")
+			temporalMatches = r.shardedTagIndex.OptimizedListByTagIncludingDeleted(tag, true)
+		} else {
 			logger.Trace("Using legacy temporal tag scanning (variant cache disabled)")
 			temporalMatches = r.shardedTagIndex.OptimizedListByTag(tag, true)
 		}
@@ -2402,7 +2991,7 @@ func (r *EntityRepository) ListByTag(tag string) ([]*models.Entity, error) {
 	}
 	defer r.readerPool.Put(reader)
 	
-	entities, err := r.fetchEntitiesWithReader(reader, matchingEntityIDs)
+	entities, err := r.fetchEntitiesWithReader(ctx, reader, matchingEntityIDs)
 	if err != nil {
 		logger.Error("Failed to fetch entities: %v", err)
 		return nil, err
@@ -2422,13 +3011,16 @@ func (r *EntityRepository) ListByTag(tag string) ([]*models.Entity, error) {
 		storageMetrics.TrackRead("list_by_tag", totalSize, time.Since(startTime), err)
 	}
 	
-	// Cache the result
-	r.cache.Set(cacheKey, entities)
+	// Cache the result, unless it was read without content
+	if !skipsContent(ctx) {
+		r.cache.Set(cacheKey, entities)
+	}
 	return entities, err
 }
 
-// fetchEntitiesWithReader is a helper to fetch multiple entities
-func (r *EntityRepository) fetchEntitiesWithReader(reader *Reader, entityIDs []string) ([]*models.Entity, error) {
+// fetchEntitiesWithReader is a helper to fetch multiple entities. Disk reads
+// stop once ctx is cancelled and the context's error is returned.
+func (r *EntityRepository) fetchEntitiesWithReader(ctx context.Context, reader *Reader, entityIDs []string) ([]*models.Entity, error) {
 	if len(entityIDs) == 0 {
 		return []*models.Entity{}, nil
 	}
@@ -2455,10 +3047,18 @@ func (r *EntityRepository) fetchEntitiesWithReader(reader *Reader, entityIDs []s
 	}
 	
 	// For remaining entities not in memory, read from disk
+	readEntity := (*Reader).GetEntity
+	if skipsContent(ctx) {
+		readEntity = (*Reader).GetEntityWithoutContent
+	}
+	
 	// For small sets, use sequential processing
 	if len(remainingIDs) <= 5 {
 		for _, id := range remainingIDs {
-			entity, err := reader.GetEntity(id)
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			entity, err := readEntity(reader, id)
 			if err == nil {
 				entities = append(entities, entity)
 			} else {
@@ -2507,9 +3107,12 @@ func (r *EntityRepository) fetchEntitiesWithReader(reader *Reader, entityIDs []s
 			}
 			defer r.readerPool.Put(workerReader)
 			
-			// Process work items
+			// Process work items, draining the queue once ctx is cancelled
 			for id := range workQueue {
-				entity, err := workerReader.GetEntity(id)
+				if ctx.Err() != nil {
+					continue
+				}
+				entity, err := readEntity(workerReader, id)
 				if err != nil {
 					errors <- err
 				} else {
@@ -2533,6 +3136,10 @@ func (r *EntityRepository) fetchEntitiesWithReader(reader *Reader, entityIDs []s
 		}
 	}
 	
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	
 	// Combine memory entities with disk entities
 	entities = append(entities, diskEntities...)
 	
@@ -2580,7 +3187,7 @@ func (r *EntityRepository) ListByTags(tags []string, matchAll bool) ([]*models.E
 			entitySet := make(map[string]bool)
 			
 			// First check for exact tag match
-			if ids := r.shardedTagIndex.GetEntitiesForTag(searchTag); len(ids) > 0 {
+			if ids := r.shardedTagIndex.GetEntitiesForTagIncludingDeleted(searchTag); len(ids) > 0 {
 				logger.Trace("Found exact match: %d entities", len(ids))
 				for _, id := range ids {
 					entitySet[id] = true
@@ -2643,7 +3250,7 @@ func (r *EntityRepository) ListByTags(tags []string, matchAll bool) ([]*models.E
 		entitySet := make(map[string]bool)
 		for _, tag := range tags {
 			// First check for exact tag match
-			if tagIDs := r.shardedTagIndex.GetEntitiesForTag(tag); len(tagIDs) > 0 {
+			if tagIDs := r.shardedTagIndex.GetEntitiesForTagIncludingDeleted(tag); len(tagIDs) > 0 {
 				for _, id := range tagIDs {
 					entitySet[id] = true
 				}
@@ -2674,6 +3281,11 @@ func (r *EntityRepository) ListByTags(tags []string, matchAll bool) ([]*models.E
 	
 	r.mu.RUnlock()
 	
+	// Deleted entities are excluded unless a lifecycle tag was requested
+	if !includesLifecycleTag(tags) {
+		entityIDs = r.shardedTagIndex.FilterDeleted(entityIDs)
+	}
+	
 	// Fetch the entities
 	if len(entityIDs) == 0 {
 		return []*models.Entity{}, nil
@@ -2685,7 +3297,7 @@ func (r *EntityRepository) ListByTags(tags []string, matchAll bool) ([]*models.E
 	}
 	defer r.readerPool.Put(reader)
 	
-	return r.fetchEntitiesWithReader(reader, entityIDs)
+	return r.fetchEntitiesWithReader(context.Background(), reader, entityIDs)
 }
 
 // Query methods using in-memory indexes
@@ -2714,6 +3326,7 @@ func (r *EntityRepository) ListByTagWildcard(pattern string) ([]*models.Entity,
 			matchingIDs = append(matchingIDs, ids...)
 		}
 	}
+	matchingIDs = r.filterDeletedForTag(prefix, matchingIDs)
 	
 	// Remove duplicates
 	idSet := make(map[string]bool)
@@ -2739,6 +3352,15 @@ func (r *EntityRepository) ListByTagWildcard(pattern string) ([]*models.Entity,
 }
 
 func (r *EntityRepository) SearchContent(searchText string) ([]*models.Entity, error) {
+	return r.SearchContentContext(context.Background(), searchText)
+}
+
+// SearchContentContext searches entity content, abandoning the search with
+// the context's error once ctx is cancelled or its deadline passes
+func (r *EntityRepository) SearchContentContext(ctx context.Context, searchText string) ([]*models.Entity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	
@@ -2747,6 +3369,9 @@ func (r *EntityRepository) SearchContent(searchText string) ([]*models.Entity, e
 	
 	// Search in content index
 	for key, ids := range r.contentIndex {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if strings.Contains(strings.ToLower(key), searchLower) {
 			for _, id := range ids {
 				matchingIDs[id] = true
@@ -2762,6 +3387,9 @@ func (r *EntityRepository) SearchContent(searchText string) ([]*models.Entity, e
 	
 	entities := make([]*models.Entity, 0, len(matchingIDs))
 	for id := range matchingIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		entity, err := reader.GetEntity(id)
 		if err == nil {
 			entities = append(entities, entity)
@@ -2835,7 +3463,7 @@ func (r *EntityRepository) ListByNamespace(namespace string) ([]*models.Entity,
 	}
 	defer r.readerPool.Put(reader)
 	
-	return r.fetchEntitiesWithReader(reader, entityIDs)
+	return r.fetchEntitiesWithReader(context.Background(), reader, entityIDs)
 }
 
 // GetUniqueTagValues returns unique values for a given tag namespace
@@ -2899,6 +3527,30 @@ func (r *EntityRepository) AddContent(entityID, contentType, content string) err
 
 // AddTag adds a tag to an entity efficiently without full entity rewrite
 func (r *EntityRepository) AddTag(entityID, tag string) error {
+	// Serialize with updates and tag removals so a concurrent read-modify-write
+	// cannot drop this tag
+	if r.changeCounters != nil {
+		unlock := r.changeCounters.lockEntity(entityID)
+		defer unlock()
+	}
+	
+	if tag == models.LegalHoldTag {
+		return fmt.Errorf("%w: placing a hold on %s needs the entity:legal_hold permission", ErrLegalHold, entityID)
+	}
+	if strings.HasPrefix(tag, SignatureTagPrefix) {
+		return fmt.Errorf("signature tags are only written when an entity is signed")
+	}
+	if err := r.checkLegalHoldID(entityID); err != nil {
+		return err
+	}
+	if err := r.checkWriteOnceTag(entityID, tag); err != nil {
+		return err
+	}
+	
+	if err := r.datasetUsage.CheckTag(entityID, tag); err != nil {
+		return err
+	}
+	
 	// CRITICAL: Use RecursionGuard to prevent infinite loops in tag operations
 	// This prevents: metrics → AddTag → GetByID → recovery → metrics → stack overflow
 	executed, err := globalRecursionGuard.Execute("entity-addtag", func() error {
@@ -2914,6 +3566,14 @@ func (r *EntityRepository) AddTag(entityID, tag string) error {
 		return fmt.Errorf("recursion guard: tag addition blocked to prevent infinite loops")
 	}
 	
+	if err == nil {
+		dataset := ""
+		if cached, exists := r.entityCache.Get(entityID); exists {
+			dataset = cached.GetDataset()
+		}
+		r.recordChange(ChangeOpTag, entityID, dataset, nil)
+	}
+	
 	return err
 }
 
@@ -2923,11 +3583,14 @@ func (r *EntityRepository) addTagInternal(entityID, tag string) error {
 	
 	// Try to get current entity to check for duplicate tags, but be resilient to indexing delays
 	entity, err := r.GetByID(entityID)
+	var stored *models.Entity
 	if err != nil {
 		// Entity not found in index - check if it exists in WAL/file before triggering recovery
 		logger.Trace("Entity %s not immediately available in index for AddTag, proceeding optimistically", entityID)
 		// Continue without duplicate check - temporal system will handle duplicates gracefully
 		entity = &models.Entity{ID: entityID, Tags: []string{}} // Minimal entity for processing
+	} else if !entity.IsRecoveryPlaceholder() {
+		stored = entity
 	}
 	
 	// Ensure tag has timestamp (temporal-only system)
@@ -2939,7 +3602,15 @@ func (r *EntityRepository) addTagInternal(entityID, tag string) error {
 	// Use batch writer if enabled for better throughput
 	if r.useBatchWrites && r.batchWriter != nil {
 		logger.Trace("Using batch writer for AddTag: %s -> %s", entityID, tag)
-		return r.batchWriter.AddTag(entityID, timestampedTag)
+		strict := r.writeDurability(context.Background(), entity) == DurabilityStrict
+		if err := r.batchWriter.AddTag(entityID, timestampedTag, stored); err != nil {
+			return err
+		}
+		if strict {
+			// A strict write returns once its batch is fsynced to the WAL
+			return r.batchWriter.Flush()
+		}
+		return nil
 	}
 	
 	// Fallback to individual tag addition
@@ -2984,12 +3655,13 @@ func (r *EntityRepository) addTagInternal(entityID, tag string) error {
 	if cachedEntity, exists := r.entityCache.Get(entityID); exists {
 		cachedEntity.Tags = append(cachedEntity.Tags, timestampedTag)
 		cachedEntity.UpdatedAt = entity.UpdatedAt
-		r.entityCache.Put(entityID, cachedEntity)
+		r.entityCache.PutDirty(entityID, cachedEntity)
 	}
 	r.mu.Unlock()
 	
 	// Update indexes efficiently without database rewrite
 	// Use sharded index for better concurrency
+	r.noteIndexChange(entityID)
 	r.shardedTagIndex.AddTag(timestampedTag, entityID)
 	// Also index the non-timestamped version for easier searching
 	if strings.Contains(timestampedTag, "|") {
@@ -3017,6 +3689,12 @@ func (r *EntityRepository) addTagInternal(entityID, tag string) error {
 	
 	// Add to namespace index
 	r.namespaceIndex.AddTag(entityID, timestampedTag)
+	r.datasetUsage.ObserveTag(entityID, timestampedTag)
+	r.entitySummary.ObserveTag(entityID, timestampedTag, entity.UpdatedAt)
+	r.geoIndex.ObserveTag(entity, timestampedTag)
+	
+	// A lifecycle state tag flips the entity's deletion bit
+	r.syncDeletionStateForTag(entityID, timestampedTag)
 	
 	// Invalidate cache
 	r.cache.Clear()
@@ -3098,20 +3776,19 @@ func (r *EntityRepository) checkAndPerformCheckpoint() {
 			return
 		}
 		
-		// Flush all pending writes
-		if err := r.writerManager.Flush(); err != nil {
-			logger.Error("Failed to flush writes during checkpoint: %v", err)
-			r.storeCheckpointMetric("failed", time.Since(startTime), walSizeBefore, walSizeBefore, checkpointReason)
-			return
-		}
-		
-		// Force checkpoint to persist everything
+		// Sync all writes and force a checkpoint to persist everything
 		if err := r.writerManager.Checkpoint(); err != nil {
 			logger.Error("Failed to checkpoint during WAL truncation: %v", err)
 			r.storeCheckpointMetric("failed", time.Since(startTime), walSizeBefore, walSizeBefore, checkpointReason)
 			return
 		}
 		
+		// Replace the readers and mapping of the previous file layout now
+		// rather than as each is next borrowed
+		if err := r.readerPool.Invalidate(); err != nil {
+			logger.Warn("Failed to refresh reader pool after checkpoint: %v", err)
+		}
+		
 		// Truncate the WAL
 		if err := r.wal.Truncate(); err != nil {
 			logger.Error("Failed to truncate WAL: %v", err)
@@ -3119,6 +3796,9 @@ func (r *EntityRepository) checkAndPerformCheckpoint() {
 			return
 		}
 		
+		// Everything cached is now on disk and may be evicted again
+		r.entityCache.ClearDirty()
+		
 		// Get WAL size after checkpoint
 		var walSizeAfter int64
 		if info, err := os.Stat(walPath); err == nil {
@@ -3306,30 +3986,45 @@ func (r *EntityRepository) storeCheckpointMetric(status string, duration time.Du
 
 // RemoveTag removes a tag from an entity
 func (r *EntityRepository) RemoveTag(entityID, tag string) error {
+	if r.changeCounters != nil {
+		unlock := r.changeCounters.lockEntity(entityID)
+		defer unlock()
+	}
+	
+	// Apply tags still queued by AddTag so they are not lost by the rewrite
+	if r.useBatchWrites && r.batchWriter != nil {
+		if err := r.batchWriter.Flush(); err != nil {
+			return fmt.Errorf("failed to flush pending writes: %w", err)
+		}
+	}
+	
 	entity, err := r.GetByID(entityID)
 	if err != nil {
 		return err
 	}
 	
-	// Remove tag
-	filtered := make([]string, 0)
+	// Chunk reference tags are released by their content, whatever time
+	// they were added at
+	byContent := models.IsContentAddressedChunkID(entityID)
+	filtered := make([]string, 0, len(entity.Tags))
 	for _, existingTag := range entity.Tags {
-		if existingTag != tag {
-			filtered = append(filtered, existingTag)
+		if existingTag == tag {
+			continue
+		}
+		if parts := strings.SplitN(existingTag, "|", 2); byContent && len(parts) == 2 && parts[1] == tag {
+			continue
 		}
+		filtered = append(filtered, existingTag)
+	}
+	if len(filtered) == len(entity.Tags) {
+		return nil
 	}
 	
-	entity.Tags = filtered
-	err = r.Update(entity)
-	return err
+	return r.update(context.Background(), entity.WithTags(filtered))
 }
 
 // Stub implementations for unimplemented methods
 
-func (r *EntityRepository) ListByExpression(expression string) ([]*models.Entity, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
 func (r *EntityRepository) ListByMetadata(key, value string) ([]*models.Entity, error) {
 	return nil, fmt.Errorf("not implemented")
 }
@@ -3413,82 +4108,53 @@ func (r *EntityRepository) GetEntityAsOf(id string, timestamp time.Time) (*model
 		snapshot := &models.Entity{
 			ID:        entity.ID,
 			Tags:      temporalTags,
-			Content:   entity.Content,
+			Content:   r.contentAsOf(entity, timestamp),
 			CreatedAt: entity.CreatedAt,
 			UpdatedAt: entity.UpdatedAt,
 		}
 		return snapshot, nil
 	}
 	
-	// Fallback to current entity
+	// Fallback to current entity, with its content at the time
+	if content := r.contentAsOf(entity, timestamp); !bytes.Equal(content, entity.Content) {
+		snapshot := *entity
+		snapshot.Content = content
+		return &snapshot, nil
+	}
 	return entity, nil
 }
 
+// GetEntityHistory returns the most recent changes of an entity, oldest first
 func (r *EntityRepository) GetEntityHistory(id string, limit int) ([]*models.EntityChange, error) {
-	// Get temporal entries for this entity
-	// For now, just use the current time as the end point
-	to := time.Now()
-	from := to.Add(-24 * 365 * time.Hour) // Go back one year
-	entries := r.temporalIndex.GetEntityHistory(id, from, to)
-	
-	// Convert temporal entries to EntityChange objects
-	changes := make([]*models.EntityChange, 0, len(entries))
-	
-	for i, entry := range entries {
-		if i >= limit && limit > 0 {
-			break
-		}
-		
-		change := &models.EntityChange{
-			Type:      "tag_change",
-			Timestamp: models.Now(),
-			NewValue:  entry.Tag,
-		}
-		
-		// Try to find the previous value
-		if i > 0 {
-			change.OldValue = entries[i-1].Tag
-		}
-		
-		changes = append(changes, change)
-	}
-	
-	return changes, nil
+	return r.GetEntityChanges(id, time.Time{}, time.Time{}, limit)
+}
+
+// GetEntityChanges returns the changes of an entity between two times,
+// inclusive and oldest first. A zero time leaves that end of the range open;
+// with a positive limit only the most recent changes are returned.
+func (r *EntityRepository) GetEntityChanges(id string, from, to time.Time, limit int) ([]*models.EntityChange, error) {
+	return r.temporalIndex.GetEntityChanges(id, from, to, limit), nil
 }
 
+// GetRecentChanges returns the latest change of each entity changed within
+// the last day, newest first
 func (r *EntityRepository) GetRecentChanges(limit int) ([]*models.EntityChange, error) {
-	// Get entity IDs that changed recently (within the last day)
 	since := time.Now().Add(-24 * time.Hour)
 	entityIDs := r.temporalIndex.GetRecentChanges(since)
-	
-	// Fetch the entities efficiently
-	if len(entityIDs) == 0 {
-		return []*models.EntityChange{}, nil
-	}
-	
-	// Convert entity IDs to EntityChange objects
+
 	changes := make([]*models.EntityChange, 0, len(entityIDs))
-	
-	// Get temporal entries for these entities
-	for i, entityID := range entityIDs {
-		if i >= limit && limit > 0 {
-			break
-		}
-		
-		// Get the most recent change for this entity
-		entries := r.temporalIndex.GetEntityHistory(entityID, since, time.Now())
-		if len(entries) > 0 {
-			// Take the most recent entry
-			entry := entries[len(entries)-1]
-			change := &models.EntityChange{
-				Type:      "tag_change",
-				Timestamp: models.Now(),
-				NewValue:  entry.Tag,
-			}
-			changes = append(changes, change)
+	for _, entityID := range entityIDs {
+		if latest := r.temporalIndex.GetEntityChanges(entityID, since, time.Time{}, 1); len(latest) > 0 {
+			changes = append(changes, latest[0])
 		}
 	}
-	
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Timestamp > changes[j].Timestamp
+	})
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+
 	return changes, nil
 }
 
@@ -3605,7 +4271,7 @@ func (r *EntityRepository) ReindexTags() error {
 	defer r.mu.Unlock()
 	
 	// Clear existing indexes
-	r.shardedTagIndex = NewShardedTagIndex()
+	r.shardedTagIndex = r.newTagIndex()
 	r.contentIndex = make(map[string][]string)
 	r.temporalIndex = NewTemporalIndex()
 	r.namespaceIndex = NewNamespaceIndex()
@@ -3660,6 +4326,8 @@ func (r *EntityRepository) ReindexTags() error {
 			r.namespaceIndex.AddTag(entity.ID, tag)
 		}
 		
+		r.syncDeletionState(entity)
+		
 		// Update content index
 		if len(entity.Content) > 0 {
 			contentStr := string(entity.Content)
@@ -3679,32 +4347,55 @@ func (r *EntityRepository) ReindexTags() error {
 	return nil
 }
 
-// replayWAL replays the WAL to rebuild indexes for any operations not yet in the data file
+// replayWAL replays the WAL to rebuild indexes for any operations not yet in the data file.
+// Every entry carries the full entity, so only the last entry of each entity
+// is applied: earlier versions would be indexed only to be replaced.
 func (r *EntityRepository) replayWAL() error {
 	if r.wal == nil {
 		return fmt.Errorf("WAL not initialized")
 	}
 	
+	final := make(map[string]WALEntry)
+	order := make([]string, 0)
+	settings := resolveIndexRebuildSettings(r.config)
+	err := r.wal.ReplayParallel(settings.workers, walReplayBatchSize, func(entries []WALEntry) {
+		for _, entry := range entries {
+			r.wal.cdc.recover(entry)
+			switch entry.OpType {
+			case WALOpCreate, WALOpUpdate:
+				if entry.Entity == nil {
+					continue
+				}
+			case WALOpDelete:
+			default:
+				continue
+			}
+			if _, seen := final[entry.EntityID]; !seen {
+				order = append(order, entry.EntityID)
+			}
+			final[entry.EntityID] = entry
+		}
+	})
+	if err != nil {
+		return err
+	}
+	
 	entitiesReplayed := 0
-	err := r.wal.Replay(func(entry WALEntry) error {
+	r.mu.Lock()
+	for _, id := range order {
+		entry := final[id]
 		switch entry.OpType {
 		case WALOpCreate, WALOpUpdate:
-			if entry.Entity != nil {
-				// Add to in-memory cache
-				r.mu.Lock()
-				r.entityCache.Put(entry.EntityID, entry.Entity)
-				r.loadedEntityCount++
-				
-				// Update tag index - use the updateIndexes method for consistency
-				r.updateIndexes(entry.Entity)
-				
-				r.mu.Unlock()
-				entitiesReplayed++
-			}
+			// Add to in-memory cache
+			r.entityCache.Put(entry.EntityID, entry.Entity)
+			r.loadedEntityCount++
+			
+			// Update tag index - use the updateIndexes method for consistency
+			r.updateIndexes(entry.Entity)
+			entitiesReplayed++
 			
 		case WALOpDelete:
 			// Remove from indexes
-			r.mu.Lock()
 			if entity, exists := r.entityCache.Get(entry.EntityID); exists {
 				// Remove from tag index
 				for _, tag := range entity.Tags {
@@ -3715,14 +4406,9 @@ func (r *EntityRepository) replayWAL() error {
 				r.entityCache.Delete(entry.EntityID)
 				r.loadedEntityCount--
 			}
-			r.mu.Unlock()
 		}
-		return nil
-	})
-	
-	if err != nil {
-		return err
 	}
+	r.mu.Unlock()
 	
 	logger.Info("WAL replay complete: %d entities processed", entitiesReplayed)
 	return nil
@@ -3784,6 +4470,12 @@ func (r *EntityRepository) persistWALEntries() error {
 			continue
 		}
 		
+		// Creates and updates are written to the data file as they happen;
+		// only changes pinned in memory still need persisting
+		if !r.entityCache.IsDirty(entityID) {
+			continue
+		}
+		
 		// Get the current in-memory state with all accumulated tags
 		r.mu.RLock()
 		currentEntity, exists := r.entityCache.Get(entityID)
@@ -3872,7 +4564,7 @@ func (r *EntityRepository) RepairIndexes() error {
 	logger.Info("Starting index repair")
 	
 	// Clear existing indexes
-	r.shardedTagIndex = NewShardedTagIndex()
+	r.shardedTagIndex = r.newTagIndex()
 	r.contentIndex = make(map[string][]string)
 	r.temporalIndex = NewTemporalIndex()
 	r.namespaceIndex = NewNamespaceIndex()
@@ -4001,6 +4693,8 @@ func (r *EntityRepository) detectAndFixIndexCorruption(entityID string) error {
 		r.contentIndex[contentStr] = append(r.contentIndex[contentStr], entity.ID)
 	}
 	
+	r.syncDeletionState(entity)
+	
 	// Mark index as dirty
 	r.tagIndexDirty = true
 	
@@ -4141,15 +4835,6 @@ func (r *EntityRepository) buildConcurrentIndexes() error {
 			r.skipList.Insert(entity.ID, entity.ID)
 		}
 		
-		// Add to bloom filter
-		if r.bloomFilter != nil {
-			r.bloomFilter.Add(entity.ID)
-			
-			// Index tags
-			for _, tag := range entity.Tags {
-				r.bloomFilter.Add(tag)
-			}
-		}
 	}
 	
 	logger.Info("Built concurrent performance indexes in %v", time.Since(start))
@@ -4184,10 +4869,7 @@ func (r *EntityRepository) GetStats() map[string]interface{} {
 		hitRate = float64(r.perfStats.cacheHits) / float64(r.perfStats.cacheHits+r.perfStats.cacheMisses) * 100
 	}
 	
-	bloomFilterSize := 0
-	if r.bloomFilter != nil {
-		bloomFilterSize = int(r.bloomFilter.n)
-	}
+	bloomFilterSize := int(r.idFilter.stats().Items)
 	
 	return map[string]interface{}{
 		"queryCount":      r.perfStats.queryCount,
@@ -4213,6 +4895,11 @@ func (r *EntityRepository) performAutomaticRecovery() error {
 	return nil
 }
 
+// EntityCacheStats returns the size, memory use and evictions of the entity cache
+func (r *EntityRepository) EntityCacheStats() CacheStats {
+	return r.entityCache.Stats()
+}
+
 // TriggerCachePressureCleanup performs cache cleanup under memory pressure
 func (r *EntityRepository) TriggerCachePressureCleanup(pressure float64) {
 	if r.entityCache != nil {
@@ -4225,6 +4912,15 @@ func (r *EntityRepository) TriggerCachePressureCleanup(pressure float64) {
 		r.tagVariantCache.TriggerPressureCleanup(pressure)
 		logger.Debug("EntityRepository: triggered tag variant cache pressure cleanup at %.1f%%", pressure*100)
 	}
+	
+	// Spill cold tag posting lists well below the index budget
+	r.mu.RLock()
+	tags := r.shardedTagIndex
+	r.mu.RUnlock()
+	if stats, ok := tags.SpillStats(); ok {
+		freed := tags.SpillCold(int64(float64(stats.BudgetBytes) * (1 - pressure)))
+		logger.Debug("EntityRepository: spilled %d bytes of tag posting lists at %.1f%% pressure", freed, pressure*100)
+	}
 }
 
 // ===== ENTITY LIFECYCLE OPERATIONS =====
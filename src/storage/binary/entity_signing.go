@@ -0,0 +1,384 @@
+package binary
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Entity Signing
+//
+// Entities can be signed with Ed25519 when they are created or updated, so
+// consumers holding the public key can prove their content and tags were
+// not changed outside EntityDB. The signature is stored on the entity as a
+// temporal tag:
+//
+//	<nanos>|signature:<key-id>:<base64 signature>
+//
+// It covers the canonical form of the entity at the signature's timestamp:
+// the JSON encoding of
+//
+//	{"id": "<entity id>", "tags": [...], "content": "<base64 content>"}
+//
+// where tags are the entity's tags stamped at or before the signature,
+// without timestamps, deduplicated and sorted. Signature tags and the
+// content checksum the writer adds to stored records are left out. Tags
+// added later, e.g. by AddTag, are not covered until the next update
+// re-signs the entity; verification lists them as unsigned.
+
+// SignatureTagPrefix starts the tag holding an entity's signature
+const SignatureTagPrefix = "signature:"
+
+// unsignedTagPrefixes start tags signatures never cover: the signature
+// itself, and the writer's content checksum, which is derived from the
+// signed content
+var unsignedTagPrefixes = []string{SignatureTagPrefix, "checksum:sha256:"}
+
+// SigningKey is one key of the signing key ring
+type SigningKey struct {
+	ID  string
+	Key ed25519.PrivateKey
+}
+
+// SigningPublicKey is the public half of a signing key
+type SigningPublicKey struct {
+	ID        string `json:"id"`
+	PublicKey string `json:"public_key"` // base64
+	Active    bool   `json:"active"`
+}
+
+// EntitySigner signs entities with the active key of a signing key ring and
+// verifies signatures made with any key in it
+type EntitySigner struct {
+	enabled  bool
+	activeID string
+	keys     map[string]ed25519.PrivateKey
+}
+
+// NewEntitySigner creates a signer over keys. New entities are signed with
+// the key named activeID when enabled is true; when false the keys are only
+// used to verify signatures made earlier.
+func NewEntitySigner(keys []SigningKey, activeID string, enabled bool) (*EntitySigner, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("signing key ring is empty")
+	}
+	s := &EntitySigner{
+		enabled:  enabled,
+		activeID: activeID,
+		keys:     make(map[string]ed25519.PrivateKey, len(keys)),
+	}
+	for _, key := range keys {
+		if key.ID == "" || len(key.ID) > maxKeyIDLength || strings.ContainsAny(key.ID, " \t:|") {
+			return nil, fmt.Errorf("invalid signing key ID %q", key.ID)
+		}
+		if _, exists := s.keys[key.ID]; exists {
+			return nil, fmt.Errorf("signing key %q is listed twice", key.ID)
+		}
+		if len(key.Key) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("signing key %q is not an Ed25519 private key", key.ID)
+		}
+		s.keys[key.ID] = key.Key
+	}
+	if s.activeID == "" {
+		s.activeID = keys[len(keys)-1].ID
+	}
+	if _, ok := s.keys[s.activeID]; !ok {
+		return nil, fmt.Errorf("active signing key %q is not in the key ring", s.activeID)
+	}
+	return s, nil
+}
+
+// Enabled reports whether new entities are signed
+func (s *EntitySigner) Enabled() bool {
+	return s.enabled
+}
+
+// ActiveKeyID returns the key new signatures are made with
+func (s *EntitySigner) ActiveKeyID() string {
+	return s.activeID
+}
+
+// PublicKeys returns the public keys of the key ring, sorted by ID
+func (s *EntitySigner) PublicKeys() []SigningPublicKey {
+	keys := make([]SigningPublicKey, 0, len(s.keys))
+	for id, key := range s.keys {
+		keys = append(keys, SigningPublicKey{
+			ID:        id,
+			PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			Active:    id == s.activeID,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// Sign replaces the signature tags of entity with a signature by the active
+// key. The signature is stamped no earlier than the entity's newest tag, so
+// it covers every tag entity has.
+func (s *EntitySigner) Sign(entity *models.Entity) error {
+	signedAt := models.Now()
+	tags := make([]string, 0, len(entity.Tags)+1)
+	for _, tag := range entity.Tags {
+		nanos, plain := splitSignedTag(tag)
+		if strings.HasPrefix(plain, SignatureTagPrefix) {
+			continue
+		}
+		if nanos > signedAt {
+			signedAt = nanos
+		}
+		tags = append(tags, tag)
+	}
+
+	payload, err := SignaturePayload(entity.ID, tags, entity.Content, signedAt)
+	if err != nil {
+		return err
+	}
+	signature := ed25519.Sign(s.keys[s.activeID], payload)
+	tag := SignatureTagPrefix + s.activeID + ":" + base64.StdEncoding.EncodeToString(signature)
+	entity.SetTags(append(tags, models.FormatTemporalTagAt(tag, signedAt)))
+	return nil
+}
+
+// SignatureVerification reports whether an entity's signature matches it
+type SignatureVerification struct {
+	EntityID string     `json:"entity_id"`
+	Signed   bool       `json:"signed"`
+	Valid    bool       `json:"valid"`
+	KeyID    string     `json:"key_id,omitempty"`
+	SignedAt *time.Time `json:"signed_at,omitempty"`
+
+	// UnsignedTags were added after the signature and are not covered by it
+	UnsignedTags []string `json:"unsigned_tags,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// Verify checks the newest signature of entity against the key ring
+func (s *EntitySigner) Verify(entity *models.Entity) *SignatureVerification {
+	result := &SignatureVerification{EntityID: entity.ID}
+
+	var signedAt int64
+	var signature string
+	for _, tag := range entity.Tags {
+		nanos, plain := splitSignedTag(tag)
+		if strings.HasPrefix(plain, SignatureTagPrefix) && (signature == "" || nanos > signedAt) {
+			signedAt, signature = nanos, strings.TrimPrefix(plain, SignatureTagPrefix)
+		}
+	}
+	if signature == "" {
+		return result
+	}
+	result.Signed = true
+	at := time.Unix(0, signedAt).UTC()
+	result.SignedAt = &at
+
+	keyID, encoded, ok := strings.Cut(signature, ":")
+	result.KeyID = keyID
+	if !ok {
+		result.Error = "signature tag is malformed"
+		return result
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		result.Error = "signature is not valid base64"
+		return result
+	}
+	if s == nil {
+		result.Error = "no signing keys are configured"
+		return result
+	}
+	key, ok := s.keys[keyID]
+	if !ok {
+		result.Error = fmt.Sprintf("signing key %q is not in the key ring", keyID)
+		return result
+	}
+
+	payload, err := SignaturePayload(entity.ID, entity.Tags, entity.Content, signedAt)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), payload, raw) {
+		result.Error = "signature does not match the entity"
+		return result
+	}
+	result.Valid = true
+
+	covered := make(map[string]bool)
+	for _, tag := range entity.Tags {
+		if nanos, plain := splitSignedTag(tag); nanos <= signedAt {
+			covered[plain] = true
+		}
+	}
+	for _, tag := range entity.Tags {
+		nanos, plain := splitSignedTag(tag)
+		if nanos > signedAt && !covered[plain] && !unsignedTag(plain) {
+			covered[plain] = true
+			result.UnsignedTags = append(result.UnsignedTags, plain)
+		}
+	}
+	sort.Strings(result.UnsignedTags)
+	return result
+}
+
+// SignaturePayload returns the canonical form of an entity signed at
+// signedAt: its ID, its tags stamped at or before signedAt and its content
+func SignaturePayload(entityID string, tags []string, content []byte, signedAt int64) ([]byte, error) {
+	seen := make(map[string]bool, len(tags))
+	canonical := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		nanos, plain := splitSignedTag(tag)
+		if nanos > signedAt || unsignedTag(plain) || seen[plain] {
+			continue
+		}
+		seen[plain] = true
+		canonical = append(canonical, plain)
+	}
+	sort.Strings(canonical)
+
+	if content == nil {
+		content = []byte{}
+	}
+	return json.Marshal(struct {
+		ID      string   `json:"id"`
+		Tags    []string `json:"tags"`
+		Content []byte   `json:"content"`
+	}{entityID, canonical, content})
+}
+
+// unsignedTag reports whether signatures leave a tag out
+func unsignedTag(tag string) bool {
+	for _, prefix := range unsignedTagPrefixes {
+		if strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSignedTag returns a tag's timestamp and the tag without it. Tags
+// without an epoch timestamp are treated as the oldest.
+func splitSignedTag(tag string) (int64, string) {
+	nanos, plain, err := models.ParseTemporalTag(tag)
+	if err != nil {
+		if idx := strings.Index(tag, "|"); idx != -1 {
+			return 0, tag[idx+1:]
+		}
+		return 0, tag
+	}
+	return nanos, plain
+}
+
+// activeSigner is the process-wide entity signer, nil when no signing key
+// ring is configured
+var activeSigner atomic.Pointer[EntitySigner]
+
+// SetEntitySigner installs the signer used for entities
+func SetEntitySigner(s *EntitySigner) {
+	activeSigner.Store(s)
+}
+
+// GetEntitySigner returns the installed signer, or nil
+func GetEntitySigner() *EntitySigner {
+	return activeSigner.Load()
+}
+
+// signEntity signs entity if signing is enabled
+func signEntity(entity *models.Entity) error {
+	s := GetEntitySigner()
+	if s == nil || !s.enabled {
+		return nil
+	}
+	if err := s.Sign(entity); err != nil {
+		return fmt.Errorf("failed to sign entity %s: %w", entity.ID, err)
+	}
+	return nil
+}
+
+// ConfigureEntitySigning loads the signing key ring named by cfg and
+// installs the signer. Without a key file nothing is installed, which is an
+// error when signing is enabled. A key ring configured with signing
+// disabled still lets signatures made earlier be verified.
+func ConfigureEntitySigning(cfg *config.Config) error {
+	if cfg.SigningKeyFile == "" {
+		if cfg.SigningEnabled {
+			return fmt.Errorf("signing is enabled but ENTITYDB_SIGNING_KEY_FILE is not set")
+		}
+		SetEntitySigner(nil)
+		return nil
+	}
+
+	info, err := os.Stat(cfg.SigningKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read signing key file: %w", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		logger.Warn("Signing key file %s is accessible by other users (mode %v)", cfg.SigningKeyFile, info.Mode().Perm())
+	}
+	ring, err := os.ReadFile(cfg.SigningKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read signing key file: %w", err)
+	}
+	keys, err := ParseSigningKeyRing(ring)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cfg.SigningKeyFile, err)
+	}
+	s, err := NewEntitySigner(keys, cfg.SigningActiveKey, cfg.SigningEnabled)
+	if err != nil {
+		return err
+	}
+	SetEntitySigner(s)
+	if s.enabled {
+		logger.Info("Entity signing enabled with key %q (%d keys in ring)", s.activeID, len(s.keys))
+	} else {
+		logger.Info("Entity signing disabled; %d keys loaded to verify signatures", len(s.keys))
+	}
+	return nil
+}
+
+// ParseSigningKeyRing parses "<key-id> <key>" lines, where the key is a
+// base64 Ed25519 seed or private key. Blank lines and lines starting with #
+// are ignored.
+func ParseSigningKeyRing(data []byte) ([]SigningKey, error) {
+	var keys []SigningKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want \"<key-id> <key>\"", line)
+		}
+		raw, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: key is not base64", line)
+		}
+		switch len(raw) {
+		case ed25519.SeedSize:
+			keys = append(keys, SigningKey{ID: fields[0], Key: ed25519.NewKeyFromSeed(raw)})
+		case ed25519.PrivateKeySize:
+			keys = append(keys, SigningKey{ID: fields[0], Key: ed25519.PrivateKey(raw)})
+		default:
+			return nil, fmt.Errorf("line %d: key is %d bytes, not an Ed25519 seed or private key", line, len(raw))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found")
+	}
+	return keys, nil
+}
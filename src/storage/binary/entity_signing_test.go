@@ -0,0 +1,116 @@
+package binary
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"entitydb/config"
+	"entitydb/models"
+)
+
+// TestEntitySigning checks that entities are signed when written, that
+// verification catches changes made outside the repository, and that
+// signatures by a retired key still verify after a rotation
+func TestEntitySigning(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "signing.keys")
+	firstSeed := make([]byte, ed25519.SeedSize)
+	secondSeed := make([]byte, ed25519.SeedSize)
+	secondSeed[0] = 1
+	first := base64.StdEncoding.EncodeToString(firstSeed)
+	second := base64.StdEncoding.EncodeToString(secondSeed)
+	if err := os.WriteFile(keyFile, []byte("# signing keys\nk1 "+first+"\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	repo := newTestRepository(t, func(cfg *config.Config) {
+		cfg.SigningEnabled = true
+		cfg.SigningKeyFile = keyFile
+	})
+	defer repo.Close()
+	defer SetEntitySigner(nil)
+	cfg := repo.config
+
+	entity := &models.Entity{
+		ID:      "signed-entity",
+		Tags:    []string{"type:document", "dataset:default", "status:draft"},
+		Content: []byte("original"),
+	}
+	if err := repo.Create(entity); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	stored, err := repo.GetByID(entity.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	result := GetEntitySigner().Verify(stored)
+	if !result.Signed || !result.Valid || result.KeyID != "k1" {
+		t.Fatalf("created entity verification = %+v, want valid signature by k1", result)
+	}
+
+	// Changes made without the key break the signature
+	tampered := &models.Entity{ID: stored.ID, Tags: stored.Tags, Content: []byte("forged")}
+	if result := GetEntitySigner().Verify(tampered); result.Valid {
+		t.Error("entity with changed content still verifies")
+	}
+	tampered = &models.Entity{ID: stored.ID, Tags: append(append([]string{}, stored.Tags...), "1|owner:mallory"), Content: stored.Content}
+	if result := GetEntitySigner().Verify(tampered); result.Valid {
+		t.Error("entity with a backdated tag still verifies")
+	}
+	if err := repo.AddTag(entity.ID, "signature:k1:AAAA"); err == nil {
+		t.Error("AddTag accepted a signature tag")
+	}
+
+	// Tags added later are reported but do not invalidate the signature
+	if err := repo.AddTag(entity.ID, "reviewed:true"); err != nil {
+		t.Fatalf("AddTag: %v", err)
+	}
+	flushWrites(t, repo)
+	stored, err = repo.GetByID(entity.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	result = GetEntitySigner().Verify(stored)
+	if !result.Valid || len(result.UnsignedTags) != 1 || result.UnsignedTags[0] != "reviewed:true" {
+		t.Errorf("verification after AddTag = %+v, want valid with reviewed:true unsigned", result)
+	}
+
+	// Rotate: k2 signs from now on, k1 only verifies
+	if err := os.WriteFile(keyFile, []byte("k1 "+first+"\nk2 "+second+"\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	cfg.SigningActiveKey = "k2"
+	if err := ConfigureEntitySigning(cfg); err != nil {
+		t.Fatalf("ConfigureEntitySigning: %v", err)
+	}
+	if result := GetEntitySigner().Verify(stored); !result.Valid || result.KeyID != "k1" {
+		t.Errorf("k1 signature after rotation = %+v, want valid", result)
+	}
+
+	updated := &models.Entity{ID: entity.ID, Tags: stored.Tags, Content: []byte("revised")}
+	if err := repo.Update(updated); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	stored, err = repo.GetByID(entity.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	result = GetEntitySigner().Verify(stored)
+	if !result.Valid || result.KeyID != "k2" || len(result.UnsignedTags) != 0 {
+		t.Errorf("updated entity verification = %+v, want valid signature by k2 covering every tag", result)
+	}
+	signatures := 0
+	for _, tag := range stored.GetTagsWithoutTimestamp() {
+		if strings.HasPrefix(tag, SignatureTagPrefix) {
+			signatures++
+		}
+	}
+	if signatures != 1 {
+		t.Errorf("updated entity has %d signature tags, want 1", signatures)
+	}
+}
@@ -0,0 +1,191 @@
+package binary
+
+import (
+	"entitydb/models"
+	"strings"
+	"sync"
+)
+
+// summaryRecentEntities is the number of recently written entities a
+// summary lists
+const summaryRecentEntities = 10
+
+// summaryUnknownType counts entities without a type tag
+const summaryUnknownType = "unknown"
+
+// EntitySummary counts the live entities of a repository by type and
+// dataset. Entities in a deleted lifecycle state are not counted.
+type EntitySummary struct {
+	TotalCount     int64            `json:"total_count"`
+	TypeCounts     map[string]int64 `json:"type_counts"`
+	DatasetCounts  map[string]int64 `json:"dataset_counts"`
+	LastUpdated    int64            `json:"last_updated"`
+	RecentEntities []string         `json:"recent_entities"`
+}
+
+// entitySummaryEntry is what one entity contributes to the summary
+type entitySummaryEntry struct {
+	entityType string
+	dataset    string
+}
+
+// EntitySummaryTracker maintains the entity summary as entities are
+// indexed and deleted, like DatasetUsageTracker, so reading it never
+// scans the repository
+type EntitySummaryTracker struct {
+	mu          sync.RWMutex
+	entries     map[string]entitySummaryEntry
+	types       map[string]int64
+	datasets    map[string]int64
+	lastUpdated int64
+	recent      []string // most recently written last
+}
+
+// NewEntitySummaryTracker creates an empty summary
+func NewEntitySummaryTracker() *EntitySummaryTracker {
+	return &EntitySummaryTracker{
+		entries:  make(map[string]entitySummaryEntry),
+		types:    make(map[string]int64),
+		datasets: make(map[string]int64),
+	}
+}
+
+// Observe replaces an entity's contribution with its current state
+func (t *EntitySummaryTracker) Observe(entity *models.Entity) {
+	if t == nil || entity == nil {
+		return
+	}
+	deleted := isDeletedLifecycleState(entity.GetLifecycleState())
+	entry := entitySummaryEntry{entityType: entity.GetTagValue("type"), dataset: entity.GetDataset()}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(entity.ID)
+	if deleted {
+		return
+	}
+	t.addLocked(entity.ID, entry)
+	t.touchLocked(entity.ID, entity.UpdatedAt)
+}
+
+// ObserveTag applies a tag appended to an entity without a full rewrite
+func (t *EntitySummaryTracker) ObserveTag(entityID, tag string, updatedAt int64) {
+	if t == nil {
+		return
+	}
+	if parts := strings.SplitN(tag, "|", 2); len(parts) == 2 {
+		tag = parts[1]
+	}
+	key, value, _ := strings.Cut(tag, ":")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[entityID]
+	if !ok {
+		return
+	}
+	switch key {
+	case "type", "dataset":
+		t.removeLocked(entityID)
+		if key == "type" {
+			entry.entityType = value
+		} else {
+			entry.dataset = value
+		}
+		t.addLocked(entityID, entry)
+	case "lifecycle":
+		if state, ok := strings.CutPrefix(value, "state:"); ok && isDeletedLifecycleState(models.EntityLifecycleState(state)) {
+			t.removeLocked(entityID)
+			return
+		}
+	}
+	t.touchLocked(entityID, updatedAt)
+}
+
+// Remove drops a deleted entity
+func (t *EntitySummaryTracker) Remove(entityID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(entityID)
+}
+
+func (t *EntitySummaryTracker) addLocked(entityID string, entry entitySummaryEntry) {
+	if entry.entityType == "" {
+		entry.entityType = summaryUnknownType
+	}
+	t.entries[entityID] = entry
+	t.types[entry.entityType]++
+	if entry.dataset != "" {
+		t.datasets[entry.dataset]++
+	}
+}
+
+func (t *EntitySummaryTracker) removeLocked(entityID string) {
+	entry, ok := t.entries[entityID]
+	if !ok {
+		return
+	}
+	delete(t.entries, entityID)
+	if t.types[entry.entityType]--; t.types[entry.entityType] <= 0 {
+		delete(t.types, entry.entityType)
+	}
+	if entry.dataset != "" {
+		if t.datasets[entry.dataset]--; t.datasets[entry.dataset] <= 0 {
+			delete(t.datasets, entry.dataset)
+		}
+	}
+	t.recent = removeRecent(t.recent, entityID)
+}
+
+// touchLocked records a write to an entity
+func (t *EntitySummaryTracker) touchLocked(entityID string, updatedAt int64) {
+	if updatedAt > t.lastUpdated {
+		t.lastUpdated = updatedAt
+	}
+	t.recent = append(removeRecent(t.recent, entityID), entityID)
+	if len(t.recent) > summaryRecentEntities {
+		t.recent = t.recent[len(t.recent)-summaryRecentEntities:]
+	}
+}
+
+// removeRecent removes an ID from the recently written entities
+func removeRecent(recent []string, entityID string) []string {
+	for i, id := range recent {
+		if id == entityID {
+			return append(recent[:i:i], recent[i+1:]...)
+		}
+	}
+	return recent
+}
+
+// Summary returns a copy of the summary, newest recent entity first
+func (t *EntitySummaryTracker) Summary() EntitySummary {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	summary := EntitySummary{
+		TotalCount:     int64(len(t.entries)),
+		TypeCounts:     make(map[string]int64, len(t.types)),
+		DatasetCounts:  make(map[string]int64, len(t.datasets)),
+		LastUpdated:    t.lastUpdated,
+		RecentEntities: make([]string, 0, len(t.recent)),
+	}
+	for entityType, count := range t.types {
+		summary.TypeCounts[entityType] = count
+	}
+	for dataset, count := range t.datasets {
+		summary.DatasetCounts[dataset] = count
+	}
+	for i := len(t.recent) - 1; i >= 0; i-- {
+		summary.RecentEntities = append(summary.RecentEntities, t.recent[i])
+	}
+	return summary
+}
+
+// EntitySummary returns the entity counts by type and dataset without
+// reading any entity
+func (r *EntityRepository) EntitySummary() EntitySummary {
+	return r.entitySummary.Summary()
+}
@@ -0,0 +1,105 @@
+package binary
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"entitydb/models"
+)
+
+// summaryEntity builds an entity whose tags are timestamped at updatedAt,
+// as stored entities are
+func summaryEntity(id string, updatedAt int64, tags []string) *models.Entity {
+	entity := &models.Entity{ID: id, UpdatedAt: updatedAt}
+	for _, tag := range tags {
+		entity.Tags = append(entity.Tags, fmt.Sprintf("%d|%s", updatedAt, tag))
+	}
+	return entity
+}
+
+// TestEntitySummaryTracker checks that the summary follows writes, tag
+// additions and deletes without rescanning
+func TestEntitySummaryTracker(t *testing.T) {
+	tracker := NewEntitySummaryTracker()
+	tracker.Observe(summaryEntity("a", 10, []string{"type:document", "dataset:docs"}))
+	tracker.Observe(summaryEntity("b", 20, []string{"type:document", "dataset:docs"}))
+	tracker.Observe(summaryEntity("c", 15, []string{"dataset:other"}))
+
+	summary := tracker.Summary()
+	if summary.TotalCount != 3 {
+		t.Errorf("TotalCount = %d, want 3", summary.TotalCount)
+	}
+	if want := map[string]int64{"document": 2, "unknown": 1}; !reflect.DeepEqual(summary.TypeCounts, want) {
+		t.Errorf("TypeCounts = %v, want %v", summary.TypeCounts, want)
+	}
+	if want := map[string]int64{"docs": 2, "other": 1}; !reflect.DeepEqual(summary.DatasetCounts, want) {
+		t.Errorf("DatasetCounts = %v, want %v", summary.DatasetCounts, want)
+	}
+	if summary.LastUpdated != 20 {
+		t.Errorf("LastUpdated = %d, want 20", summary.LastUpdated)
+	}
+	if want := []string{"c", "b", "a"}; !reflect.DeepEqual(summary.RecentEntities, want) {
+		t.Errorf("RecentEntities = %v, want %v", summary.RecentEntities, want)
+	}
+
+	// Rewriting an entity moves it between types and datasets
+	tracker.Observe(summaryEntity("a", 30, []string{"type:report", "dataset:other"}))
+	// An appended type tag retypes the entity
+	tracker.ObserveTag("c", "40|type:report", 40)
+	summary = tracker.Summary()
+	if want := map[string]int64{"document": 1, "report": 2}; !reflect.DeepEqual(summary.TypeCounts, want) {
+		t.Errorf("TypeCounts after retype = %v, want %v", summary.TypeCounts, want)
+	}
+	if want := map[string]int64{"docs": 1, "other": 2}; !reflect.DeepEqual(summary.DatasetCounts, want) {
+		t.Errorf("DatasetCounts after move = %v, want %v", summary.DatasetCounts, want)
+	}
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(summary.RecentEntities, want) {
+		t.Errorf("RecentEntities after writes = %v, want %v", summary.RecentEntities, want)
+	}
+
+	// Soft deleted and removed entities are no longer counted
+	tracker.ObserveTag("b", "50|lifecycle:state:soft_deleted", 50)
+	tracker.Remove("c")
+	summary = tracker.Summary()
+	if summary.TotalCount != 1 {
+		t.Errorf("TotalCount after deletes = %d, want 1", summary.TotalCount)
+	}
+	if want := map[string]int64{"report": 1}; !reflect.DeepEqual(summary.TypeCounts, want) {
+		t.Errorf("TypeCounts after deletes = %v, want %v", summary.TypeCounts, want)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(summary.RecentEntities, want) {
+		t.Errorf("RecentEntities after deletes = %v, want %v", summary.RecentEntities, want)
+	}
+}
+
+// TestRepositoryEntitySummary checks that repository writes and deletes
+// reach the summary
+func TestRepositoryEntitySummary(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	before := repo.EntitySummary()
+	for _, id := range []string{"summary-1", "summary-2"} {
+		if err := repo.Create(&models.Entity{ID: id, Tags: []string{"type:summarytest", "dataset:summary"}}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	flushWrites(t, repo)
+
+	summary := repo.EntitySummary()
+	if summary.TotalCount != before.TotalCount+2 {
+		t.Errorf("TotalCount = %d, want %d", summary.TotalCount, before.TotalCount+2)
+	}
+	if summary.TypeCounts["summarytest"] != 2 || summary.DatasetCounts["summary"] != 2 {
+		t.Errorf("summary counts = %v %v, want 2 of each", summary.TypeCounts, summary.DatasetCounts)
+	}
+
+	if err := repo.Delete("summary-1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	summary = repo.EntitySummary()
+	if summary.TypeCounts["summarytest"] != 1 || summary.DatasetCounts["summary"] != 1 {
+		t.Errorf("summary counts after delete = %v %v, want 1 of each", summary.TypeCounts, summary.DatasetCounts)
+	}
+}
@@ -0,0 +1,220 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"entitydb/models"
+)
+
+// Entity time series
+//
+// A time series counts entity creations and tag changes per hour, day, week
+// or month from the temporal index. An entity is created at its first
+// recorded change; the tags written with it are part of the creation rather
+// than changes. A tag change is a tag added that the entity did not carry or
+// a tag removed. Stamping a tag the entity already carries again is not a
+// change, nor are checksum and signature tags, which are rewritten by every
+// write. Buckets are aligned in UTC; weeks start on Monday.
+
+// Timeseries intervals
+const (
+	TimeseriesHour  = "hour"
+	TimeseriesDay   = "day"
+	TimeseriesWeek  = "week"
+	TimeseriesMonth = "month"
+)
+
+// maxTimeseriesBuckets bounds the buckets of one series, so a wide range at
+// hourly resolution cannot build an unbounded response
+const maxTimeseriesBuckets = 10000
+
+// creationWindow is how long after an entity's first change its tags still
+// count as written with it. Tags of one create are stamped one by one.
+const creationWindow = time.Second
+
+// ErrInvalidTimeseries reports a time series request that cannot be counted
+var ErrInvalidTimeseries = errors.New("invalid time series")
+
+// TimeseriesOptions selects the entities and range of a time series
+type TimeseriesOptions struct {
+	Tags      []string  // entities must carry every tag (none for all entities)
+	Interval  string    // hour, day, week or month
+	From      time.Time // first instant counted
+	To        time.Time // last instant counted
+	Namespace string    // count only changes of tags in this namespace when set
+}
+
+// TimeseriesBucket counts the events of one interval
+type TimeseriesBucket struct {
+	Start      time.Time `json:"start"`
+	Period     string    `json:"period"`
+	Created    int       `json:"created"`
+	TagChanges int       `json:"tag_changes"`
+}
+
+// Timeseries is a series of bucketed event counts
+type Timeseries struct {
+	Interval        string             `json:"interval"`
+	From            time.Time          `json:"from"`
+	To              time.Time          `json:"to"`
+	Entities        int                `json:"entities"` // entities matching the tags
+	Buckets         []TimeseriesBucket `json:"buckets"`
+	TotalCreated    int                `json:"total_created"`
+	TotalTagChanges int                `json:"total_tag_changes"`
+}
+
+// EntityTimeseries counts the creations and tag changes of active entities
+// carrying every tag of opts in each interval from opts.From to opts.To. A
+// tag matches entities that carry it at any timestamp, as in ListByTag.
+func (r *EntityRepository) EntityTimeseries(opts TimeseriesOptions) (*Timeseries, error) {
+	buckets, err := timeseriesBuckets(opts.Interval, opts.From, opts.To)
+	if err != nil {
+		return nil, err
+	}
+	series := &Timeseries{Interval: opts.Interval, From: opts.From, To: opts.To, Buckets: buckets}
+
+	// Index rebuilds swap the indexes under the repository lock
+	r.mu.RLock()
+	tags, temporal := r.shardedTagIndex, r.temporalIndex
+	r.mu.RUnlock()
+	if tags == nil || temporal == nil {
+		return series, nil
+	}
+
+	var ids []string
+	if len(opts.Tags) > 0 {
+		ids = r.tagCandidates(opts.Tags[0])
+		for _, tag := range opts.Tags[1:] {
+			ids = intersectIDs(ids, r.tagCandidates(tag))
+		}
+	}
+
+	temporal.mu.RLock()
+	defer temporal.mu.RUnlock()
+	count := func(entityID string) {
+		entries := temporal.timestampIndex[entityID]
+		if len(entries) == 0 || tags.IsDeleted(entityID) {
+			return
+		}
+		series.Entities++
+		created := entries[0].Timestamp
+		if i := series.bucketOf(created); i >= 0 {
+			series.Buckets[i].Created++
+			series.TotalCreated++
+		}
+		for _, changed := range tagChangeTimes(entries, created, opts.Namespace) {
+			if i := series.bucketOf(changed); i >= 0 {
+				series.Buckets[i].TagChanges++
+				series.TotalTagChanges++
+			}
+		}
+	}
+	if len(opts.Tags) > 0 {
+		for _, id := range ids {
+			count(id)
+		}
+	} else {
+		for id := range temporal.timestampIndex {
+			count(id)
+		}
+	}
+	return series, nil
+}
+
+// tagChangeTimes returns the times of an entity's tag changes after its
+// creation, oldest first, of namespace only when it is set
+func tagChangeTimes(entries []TemporalEntry, created time.Time, namespace string) []time.Time {
+	var times []time.Time
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		var clean string
+		switch entry.Type {
+		case models.ChangeTagAdded:
+			_, clean = temporalTagTime(entry.Tag, entry.Timestamp)
+		case models.ChangeTagRemoved:
+			clean = entry.Tag
+		default:
+			continue
+		}
+		if unsignedTag(clean) {
+			continue
+		}
+
+		changed := false
+		if entry.Type == models.ChangeTagAdded {
+			changed = !present[clean]
+			present[clean] = true
+		} else {
+			changed = present[clean]
+			delete(present, clean)
+		}
+		if !changed || entry.Timestamp.Sub(created) <= creationWindow {
+			continue
+		}
+		if namespace == "" || tagNamespace(clean) == namespace {
+			times = append(times, entry.Timestamp)
+		}
+	}
+	return times
+}
+
+// bucketOf returns the index of the bucket holding t, or -1 when t is
+// outside the series
+func (s *Timeseries) bucketOf(t time.Time) int {
+	if t.Before(s.From) || t.After(s.To) {
+		return -1
+	}
+	i := sort.Search(len(s.Buckets), func(i int) bool {
+		return s.Buckets[i].Start.After(t)
+	})
+	return i - 1
+}
+
+// timeseriesBuckets returns the empty buckets covering from to to
+func timeseriesBuckets(interval string, from, to time.Time) ([]TimeseriesBucket, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: range ends before it starts", ErrInvalidTimeseries)
+	}
+
+	from = from.UTC()
+	var start time.Time
+	var next func(time.Time) time.Time
+	var label func(time.Time) string
+	switch interval {
+	case TimeseriesHour:
+		start = from.Truncate(time.Hour)
+		next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+		label = func(t time.Time) string { return t.Format("2006-01-02 15:00") }
+	case TimeseriesDay:
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+		label = func(t time.Time) string { return t.Format("2006-01-02") }
+	case TimeseriesWeek:
+		// Weekday counts from Sunday; ISO weeks start on Monday
+		offset := (int(from.Weekday()) + 6) % 7
+		start = time.Date(from.Year(), from.Month(), from.Day()-offset, 0, 0, 0, 0, time.UTC)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+		label = func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}
+	case TimeseriesMonth:
+		start = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+		label = func(t time.Time) string { return t.Format("2006-01") }
+	default:
+		return nil, fmt.Errorf("%w: unknown interval %q", ErrInvalidTimeseries, interval)
+	}
+
+	var buckets []TimeseriesBucket
+	for t := start; !t.After(to); t = next(t) {
+		if len(buckets) == maxTimeseriesBuckets {
+			return nil, fmt.Errorf("%w: more than %d %s buckets", ErrInvalidTimeseries, maxTimeseriesBuckets, interval)
+		}
+		buckets = append(buckets, TimeseriesBucket{Start: t, Period: label(t)})
+	}
+	return buckets, nil
+}
@@ -0,0 +1,92 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestEntityTimeseries checks that creations and tag changes are counted in
+// the bucket of their timestamp, that the tags written with an entity are not
+// changes, and that tag filters select the entities counted
+func TestEntityTimeseries(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	// Monday 3 March 2025
+	monday := time.Date(2025, 3, 3, 10, 0, 0, 0, time.UTC)
+	at := func(days int, tag string) string {
+		return fmt.Sprintf("%d|%s", monday.AddDate(0, 0, days).UnixNano(), tag)
+	}
+	entities := []*models.Entity{
+		{ID: "task-1", Tags: []string{at(0, "type:task"), at(0, "status:open")}},
+		{ID: "task-2", Tags: []string{at(1, "type:task"), at(1, "status:open")}},
+		{ID: "note-1", Tags: []string{at(0, "type:note")}},
+	}
+	for _, entity := range entities {
+		if err := repo.Create(entity); err != nil {
+			t.Fatalf("Create %s: %v", entity.ID, err)
+		}
+	}
+	flushWrites(t, repo)
+
+	// Close task-1 on Wednesday, restamping the tags it keeps
+	closed := &models.Entity{ID: "task-1", Tags: []string{at(2, "type:task"), at(2, "status:done")}}
+	if err := repo.Update(closed); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	week := TimeseriesOptions{Interval: TimeseriesDay, From: monday.Truncate(24 * time.Hour), To: monday.AddDate(0, 0, 6)}
+	series, err := repo.EntityTimeseries(week)
+	if err != nil {
+		t.Fatalf("EntityTimeseries: %v", err)
+	}
+	if len(series.Buckets) != 7 || series.Buckets[0].Period != "2025-03-03" {
+		t.Fatalf("buckets = %+v, want 7 days from 2025-03-03", series.Buckets)
+	}
+	created := []int{2, 1, 0, 0, 0, 0, 0}
+	// Adding status:done; removing status:open is recorded at the time of the
+	// write, outside this week
+	changes := []int{0, 0, 1, 0, 0, 0, 0}
+	for i, bucket := range series.Buckets {
+		if bucket.Created != created[i] || bucket.TagChanges != changes[i] {
+			t.Errorf("%s: created %d, tag changes %d, want %d and %d", bucket.Period, bucket.Created, bucket.TagChanges, created[i], changes[i])
+		}
+	}
+
+	tasks := week
+	tasks.Tags = []string{"type:task"}
+	tasks.Namespace = "status"
+	tasks.Interval = TimeseriesWeek
+	series, err = repo.EntityTimeseries(tasks)
+	if err != nil {
+		t.Fatalf("EntityTimeseries: %v", err)
+	}
+	if series.Entities != 2 || len(series.Buckets) != 1 || series.Buckets[0].Period != "2025-W10" ||
+		series.TotalCreated != 2 || series.TotalTagChanges != 1 {
+		t.Errorf("task series = %+v, want 2 entities created and 1 status change in 2025-W10", series)
+	}
+	removals := tasks
+	removals.To = time.Now().Add(time.Minute)
+	if series, err = repo.EntityTimeseries(removals); err != nil || series.TotalTagChanges != 2 {
+		t.Errorf("status changes up to now = %v, %v, want 2", series, err)
+	}
+	tasks.Namespace = "priority"
+	if series, err = repo.EntityTimeseries(tasks); err != nil || series.TotalTagChanges != 0 {
+		t.Errorf("priority changes = %v, %v, want none", series, err)
+	}
+
+	invalid := []TimeseriesOptions{
+		{Interval: "fortnight", From: week.From, To: week.To},
+		{Interval: TimeseriesDay, From: week.To, To: week.From},
+		{Interval: TimeseriesHour, From: week.From, To: week.From.AddDate(5, 0, 0)},
+	}
+	for _, opts := range invalid {
+		if _, err := repo.EntityTimeseries(opts); !errors.Is(err, ErrInvalidTimeseries) {
+			t.Errorf("EntityTimeseries(%s, %s to %s) returned %v, want ErrInvalidTimeseries", opts.Interval, opts.From, opts.To, err)
+		}
+	}
+}
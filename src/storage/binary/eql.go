@@ -0,0 +1,589 @@
+package binary
+
+import (
+	"context"
+	"entitydb/models"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// EntityDB Query Language (EQL)
+//
+// EQL combines tag lookups with boolean operators:
+//
+//   type:doc AND (status:draft OR status:review) AND NOT dataset:archive
+//
+// Operands are tags, optionally ending in "*" for a prefix match, or double
+// quoted when they contain spaces or parentheses. AND binds tighter than OR
+// and keywords are case-insensitive. Expressions are compiled to
+// intersections, unions and differences of tag index lookups, so no entity is
+// read before the final result set is known. NOT may only narrow an AND
+// with at least one positive operand, which keeps every query bounded by
+// the index instead of the whole repository.
+
+// EQLNode is a node of a parsed EQL expression
+type EQLNode interface {
+	String() string
+}
+
+// EQLTag matches entities carrying a tag, or any tag with a prefix when Wildcard is set
+type EQLTag struct {
+	Tag      string
+	Wildcard bool
+}
+
+// EQLAnd matches entities matching every operand
+type EQLAnd struct {
+	Operands []EQLNode
+}
+
+// EQLOr matches entities matching any operand
+type EQLOr struct {
+	Operands []EQLNode
+}
+
+// EQLNot excludes entities matching its operand
+type EQLNot struct {
+	Operand EQLNode
+	pos     int
+}
+
+func (n *EQLTag) String() string {
+	if n.Wildcard {
+		return n.Tag + "*"
+	}
+	return n.Tag
+}
+
+func (n *EQLAnd) String() string { return joinEQL(n.Operands, " AND ") }
+
+func (n *EQLOr) String() string { return joinEQL(n.Operands, " OR ") }
+
+func (n *EQLNot) String() string { return "NOT " + n.Operand.String() }
+
+func joinEQL(operands []EQLNode, sep string) string {
+	parts := make([]string, len(operands))
+	for i, operand := range operands {
+		parts[i] = operand.String()
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// EQLSyntaxError reports an invalid EQL expression and where it went wrong
+type EQLSyntaxError struct {
+	Position int
+	Message  string
+}
+
+func (e *EQLSyntaxError) Error() string {
+	return fmt.Sprintf("EQL syntax error at position %d: %s", e.Position, e.Message)
+}
+
+type eqlTokenKind int
+
+const (
+	eqlEOF eqlTokenKind = iota
+	eqlLParen
+	eqlRParen
+	eqlAnd
+	eqlOr
+	eqlNot
+	eqlTerm
+)
+
+type eqlToken struct {
+	kind   eqlTokenKind
+	value  string
+	pos    int
+	quoted bool
+}
+
+// tokenizeEQL splits an expression into parentheses, keywords and tag terms
+func tokenizeEQL(input string) ([]eqlToken, error) {
+	var tokens []eqlToken
+	runes := []rune(input)
+	i := 0
+	for i < len(runes) {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, eqlToken{kind: eqlLParen, value: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, eqlToken{kind: eqlRParen, value: ")", pos: i})
+			i++
+		case c == '"':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, &EQLSyntaxError{Position: start, Message: "unterminated quoted tag"}
+			}
+			i++ // Closing quote
+			tokens = append(tokens, eqlToken{kind: eqlTerm, value: sb.String(), pos: start, quoted: true})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				i++
+			}
+			word := string(runes[start:i])
+			kind := eqlTerm
+			switch strings.ToUpper(word) {
+			case "AND":
+				kind = eqlAnd
+			case "OR":
+				kind = eqlOr
+			case "NOT":
+				kind = eqlNot
+			}
+			tokens = append(tokens, eqlToken{kind: kind, value: word, pos: start})
+		}
+	}
+	tokens = append(tokens, eqlToken{kind: eqlEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// eqlParser is a recursive descent parser over EQL tokens
+type eqlParser struct {
+	tokens []eqlToken
+	pos    int
+	depth  int
+}
+
+// maxEQLDepth bounds parenthesis and NOT nesting
+const maxEQLDepth = 64
+
+// ParseEQL parses an EQL expression into a node tree
+func ParseEQL(input string) (EQLNode, error) {
+	tokens, err := tokenizeEQL(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &eqlParser{tokens: tokens}
+	if p.peek().kind == eqlEOF {
+		return nil, &EQLSyntaxError{Position: 0, Message: "empty expression"}
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != eqlEOF {
+		return nil, &EQLSyntaxError{Position: tok.pos, Message: fmt.Sprintf("unexpected %q", tok.value)}
+	}
+	if err := checkEQLNegations(node, false); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// checkEQLNegations rejects NOT anywhere but directly under an AND that has
+// a positive operand, since anything else would match the whole repository
+func checkEQLNegations(node EQLNode, allowed bool) error {
+	switch n := node.(type) {
+	case *EQLNot:
+		if !allowed {
+			return &EQLSyntaxError{Position: n.pos, Message: "NOT must follow AND with at least one positive term"}
+		}
+		return checkEQLNegations(n.Operand, false)
+	case *EQLAnd:
+		positive := false
+		for _, operand := range n.Operands {
+			if _, ok := operand.(*EQLNot); !ok {
+				positive = true
+			}
+		}
+		for _, operand := range n.Operands {
+			if err := checkEQLNegations(operand, positive); err != nil {
+				return err
+			}
+		}
+	case *EQLOr:
+		for _, operand := range n.Operands {
+			if err := checkEQLNegations(operand, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *eqlParser) peek() eqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *eqlParser) next() eqlToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != eqlEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parseOr parses: and { OR and }
+func (p *eqlParser) parseOr() (EQLNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	operands := []EQLNode{first}
+	for p.peek().kind == eqlOr {
+		p.next()
+		operand, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &EQLOr{Operands: operands}, nil
+}
+
+// parseAnd parses: unary { AND unary }
+func (p *eqlParser) parseAnd() (EQLNode, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	operands := []EQLNode{first}
+	for p.peek().kind == eqlAnd {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &EQLAnd{Operands: operands}, nil
+}
+
+// parseUnary parses: NOT unary | "(" or ")" | term
+func (p *eqlParser) parseUnary() (EQLNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case eqlNot:
+		if p.depth++; p.depth > maxEQLDepth {
+			return nil, &EQLSyntaxError{Position: tok.pos, Message: "expression nested too deeply"}
+		}
+		defer func() { p.depth-- }()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &EQLNot{Operand: operand, pos: tok.pos}, nil
+	case eqlLParen:
+		if p.depth++; p.depth > maxEQLDepth {
+			return nil, &EQLSyntaxError{Position: tok.pos, Message: "expression nested too deeply"}
+		}
+		defer func() { p.depth-- }()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != eqlRParen {
+			return nil, &EQLSyntaxError{Position: closing.pos, Message: "missing closing parenthesis"}
+		}
+		return node, nil
+	case eqlTerm:
+		if !tok.quoted && strings.HasSuffix(tok.value, "*") {
+			if tok.value == "*" {
+				return nil, &EQLSyntaxError{Position: tok.pos, Message: "wildcard needs a tag prefix"}
+			}
+			return &EQLTag{Tag: strings.TrimSuffix(tok.value, "*"), Wildcard: true}, nil
+		}
+		return &EQLTag{Tag: tok.value}, nil
+	case eqlEOF:
+		return nil, &EQLSyntaxError{Position: tok.pos, Message: "unexpected end of expression"}
+	default:
+		return nil, &EQLSyntaxError{Position: tok.pos, Message: fmt.Sprintf("unexpected %q", tok.value)}
+	}
+}
+
+// EQLTags returns the tag operands of an expression, with "*" on prefix matches
+func EQLTags(node EQLNode) []string {
+	var tags []string
+	var walk func(EQLNode)
+	walk = func(n EQLNode) {
+		switch n := n.(type) {
+		case *EQLTag:
+			tags = append(tags, n.String())
+		case *EQLAnd:
+			for _, operand := range n.Operands {
+				walk(operand)
+			}
+		case *EQLOr:
+			for _, operand := range n.Operands {
+				walk(operand)
+			}
+		case *EQLNot:
+			walk(n.Operand)
+		}
+	}
+	walk(node)
+	return tags
+}
+
+// eqlPlaceholder matches a {{name}} parameter placeholder in a tag
+var eqlPlaceholder = regexp.MustCompile(`\{\{([A-Za-z_][A-Za-z0-9_]*)\}\}`)
+
+// EQLParameters returns the names of the {{name}} placeholders in an
+// expression's tags, in order of first appearance
+func EQLParameters(node EQLNode) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, tag := range EQLTags(node) {
+		for _, match := range eqlPlaceholder.FindAllStringSubmatch(tag, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+	}
+	return names
+}
+
+// SubstituteEQL returns a copy of node with the {{name}} placeholders in its
+// tags replaced by values. Values only ever become tag text, so a parameter
+// cannot add operators to the expression.
+func SubstituteEQL(node EQLNode, values map[string]string) (EQLNode, error) {
+	switch n := node.(type) {
+	case *EQLTag:
+		var missing string
+		tag := eqlPlaceholder.ReplaceAllStringFunc(n.Tag, func(placeholder string) string {
+			name := eqlPlaceholder.FindStringSubmatch(placeholder)[1]
+			value, ok := values[name]
+			if !ok && missing == "" {
+				missing = name
+			}
+			return value
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("missing value for parameter %q", missing)
+		}
+		if n.Wildcard && (tag == "" || eqlNeedsQuotes(tag)) {
+			return nil, fmt.Errorf("invalid prefix %q for wildcard %s", tag, n.String())
+		}
+		return &EQLTag{Tag: tag, Wildcard: n.Wildcard}, nil
+	case *EQLAnd:
+		operands, err := substituteEQLOperands(n.Operands, values)
+		if err != nil {
+			return nil, err
+		}
+		return &EQLAnd{Operands: operands}, nil
+	case *EQLOr:
+		operands, err := substituteEQLOperands(n.Operands, values)
+		if err != nil {
+			return nil, err
+		}
+		return &EQLOr{Operands: operands}, nil
+	case *EQLNot:
+		operand, err := SubstituteEQL(n.Operand, values)
+		if err != nil {
+			return nil, err
+		}
+		return &EQLNot{Operand: operand, pos: n.pos}, nil
+	default:
+		return nil, fmt.Errorf("unsupported EQL node %T", node)
+	}
+}
+
+func substituteEQLOperands(operands []EQLNode, values map[string]string) ([]EQLNode, error) {
+	result := make([]EQLNode, len(operands))
+	for i, operand := range operands {
+		substituted, err := SubstituteEQL(operand, values)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = substituted
+	}
+	return result, nil
+}
+
+// FormatEQL renders a node as an expression that ParseEQL reads back to the
+// same tree, quoting tags that would otherwise be split or read as keywords
+func FormatEQL(node EQLNode) string {
+	switch n := node.(type) {
+	case *EQLTag:
+		if n.Wildcard {
+			return n.Tag + "*"
+		}
+		if eqlNeedsQuotes(n.Tag) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(n.Tag) + `"`
+		}
+		return n.Tag
+	case *EQLAnd:
+		return formatEQLOperands(n.Operands, " AND ")
+	case *EQLOr:
+		return formatEQLOperands(n.Operands, " OR ")
+	case *EQLNot:
+		return "NOT " + FormatEQL(n.Operand)
+	default:
+		return ""
+	}
+}
+
+func formatEQLOperands(operands []EQLNode, sep string) string {
+	parts := make([]string, len(operands))
+	for i, operand := range operands {
+		parts[i] = FormatEQL(operand)
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// eqlNeedsQuotes reports whether a tag must be quoted to parse as one term
+func eqlNeedsQuotes(tag string) bool {
+	if tag == "" || strings.HasSuffix(tag, "*") {
+		return true
+	}
+	switch strings.ToUpper(tag) {
+	case "AND", "OR", "NOT":
+		return true
+	}
+	return strings.IndexFunc(tag, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+	}) >= 0
+}
+
+// eqlSet is a set of entity IDs
+type eqlSet map[string]struct{}
+
+func newEQLSet(ids []string) eqlSet {
+	set := make(eqlSet, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+// evaluateEQL resolves an expression to the IDs of matching entities using
+// only the tag index. Deleted entities are excluded unless the expression
+// refers to a lifecycle tag, matching ListByTags.
+func (r *EntityRepository) evaluateEQL(node EQLNode) ([]string, error) {
+	set, err := r.evaluateEQLNode(node)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	if !includesLifecycleTag(EQLTags(node)) {
+		ids = r.shardedTagIndex.FilterDeleted(ids)
+	}
+	return ids, nil
+}
+
+func (r *EntityRepository) evaluateEQLNode(node EQLNode) (eqlSet, error) {
+	switch n := node.(type) {
+	case *EQLTag:
+		if n.Wildcard {
+			return newEQLSet(r.wildcardEntityIDs(n.Tag)), nil
+		}
+		return newEQLSet(r.tagEntityIDs(n.Tag)), nil
+
+	case *EQLOr:
+		result := make(eqlSet)
+		for _, operand := range n.Operands {
+			set, err := r.evaluateEQLNode(operand)
+			if err != nil {
+				return nil, err
+			}
+			for id := range set {
+				result[id] = struct{}{}
+			}
+		}
+		return result, nil
+
+	case *EQLAnd:
+		var positives, negatives []eqlSet
+		for _, operand := range n.Operands {
+			if not, ok := operand.(*EQLNot); ok {
+				set, err := r.evaluateEQLNode(not.Operand)
+				if err != nil {
+					return nil, err
+				}
+				negatives = append(negatives, set)
+				continue
+			}
+			set, err := r.evaluateEQLNode(operand)
+			if err != nil {
+				return nil, err
+			}
+			positives = append(positives, set)
+		}
+		if len(positives) == 0 {
+			return nil, fmt.Errorf("AND without positive terms: %s", n)
+		}
+
+		// Intersect starting from the smallest set
+		smallest := 0
+		for i, set := range positives {
+			if len(set) < len(positives[smallest]) {
+				smallest = i
+			}
+		}
+		result := make(eqlSet, len(positives[smallest]))
+	candidates:
+		for id := range positives[smallest] {
+			for i, set := range positives {
+				if i == smallest {
+					continue
+				}
+				if _, ok := set[id]; !ok {
+					continue candidates
+				}
+			}
+			for _, set := range negatives {
+				if _, ok := set[id]; ok {
+					continue candidates
+				}
+			}
+			result[id] = struct{}{}
+		}
+		return result, nil
+
+	case *EQLNot:
+		return nil, fmt.Errorf("NOT outside AND: %s", n)
+
+	default:
+		return nil, fmt.Errorf("unsupported EQL node %T", node)
+	}
+}
+
+// ListByExpression lists entities matching an EQL expression
+func (r *EntityRepository) ListByExpression(expression string) ([]*models.Entity, error) {
+	node, err := ParseEQL(expression)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := r.evaluateEQL(node)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*models.Entity{}, nil
+	}
+
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer r.readerPool.Put(reader)
+
+	return r.fetchEntitiesWithReader(context.Background(), reader, ids)
+}
@@ -0,0 +1,98 @@
+package binary
+
+import (
+	"testing"
+)
+
+func TestParseEQL(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"type:doc", "type:doc"},
+		{"type:doc AND status:draft", "(type:doc AND status:draft)"},
+		{"a OR b AND c", "(a OR (b AND c))"},
+		{"(a OR b) and c", "((a OR b) AND c)"},
+		{"type:doc AND (status:draft OR status:review) AND NOT dataset:archive",
+			"(type:doc AND (status:draft OR status:review) AND NOT dataset:archive)"},
+		{"status:* AND NOT status:done", "(status:* AND NOT status:done)"},
+		{`"name:a b" OR "title:(x)"`, "(name:a b OR title:(x))"},
+	}
+
+	for _, tt := range tests {
+		node, err := ParseEQL(tt.input)
+		if err != nil {
+			t.Errorf("ParseEQL(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got := node.String(); got != tt.want {
+			t.Errorf("ParseEQL(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseEQLErrors(t *testing.T) {
+	inputs := []string{
+		"",
+		"type:doc AND",
+		"(type:doc",
+		"type:doc)",
+		"AND type:doc",
+		`"type:doc`,
+		"*",
+		"NOT type:doc",
+		"type:doc OR NOT status:draft",
+		"NOT a AND NOT b",
+		"a AND NOT NOT b",
+	}
+
+	for _, input := range inputs {
+		if _, err := ParseEQL(input); err == nil {
+			t.Errorf("ParseEQL(%q) succeeded, want error", input)
+		} else if _, ok := err.(*EQLSyntaxError); !ok {
+			t.Errorf("ParseEQL(%q) returned %T, want *EQLSyntaxError", input, err)
+		}
+	}
+}
+
+func TestSubstituteEQL(t *testing.T) {
+	node, err := ParseEQL("type:order AND status:{{status}} AND NOT customer:{{customer}}*")
+	if err != nil {
+		t.Fatalf("ParseEQL failed: %v", err)
+	}
+	if got := EQLParameters(node); len(got) != 2 || got[0] != "status" || got[1] != "customer" {
+		t.Errorf("EQLParameters = %v, want [status customer]", got)
+	}
+
+	tests := []struct {
+		status, customer string
+		want             string
+	}{
+		{"open", "acme", "(type:order AND status:open AND NOT customer:acme*)"},
+		// Values cannot inject operators
+		{"open OR type:user", "acme", `(type:order AND "status:open OR type:user" AND NOT customer:acme*)`},
+		{`a"b`, "acme", `(type:order AND "status:a\"b" AND NOT customer:acme*)`},
+	}
+	for _, tt := range tests {
+		substituted, err := SubstituteEQL(node, map[string]string{"status": tt.status, "customer": tt.customer})
+		if err != nil {
+			t.Errorf("SubstituteEQL(%q) failed: %v", tt.status, err)
+			continue
+		}
+		formatted := FormatEQL(substituted)
+		if formatted != tt.want {
+			t.Errorf("FormatEQL = %s, want %s", formatted, tt.want)
+		}
+		reparsed, err := ParseEQL(formatted)
+		if err != nil || reparsed.String() != substituted.String() {
+			t.Errorf("%s does not parse back to %s (err %v)", formatted, substituted, err)
+		}
+	}
+
+	if _, err := SubstituteEQL(node, map[string]string{"status": "open"}); err == nil {
+		t.Errorf("missing parameter accepted")
+	}
+	if _, err := SubstituteEQL(node, map[string]string{"status": "open", "customer": "a b"}); err == nil {
+		t.Errorf("wildcard prefix with a space accepted")
+	}
+}
@@ -68,7 +68,8 @@ const (
 	
 	// FormatVersion indicates the unified format version.
 	// Version 3: Added deletion sections for temporal deletion architecture
-	FormatVersion uint32 = 3
+	// Version 4: Added compact (delta-encoded) entity tags
+	FormatVersion uint32 = 4
 	
 	// HeaderSize is the fixed size of the unified file header in bytes.
 	// The unified header contains metadata and section offsets for all components.
@@ -325,8 +326,11 @@ func (h *Header) Write(w io.Writer) error {
 	}
 	
 	// Ensure version is correct - this fixes the version 678 corruption issue
+	// Older supported versions are upgraded: their records stay readable
 	if version != FormatVersion {
-		logger.Warn("Header version corrupted (%d), correcting to %d", version, FormatVersion)
+		if !supportedFormatVersion(version) {
+			logger.Warn("Header version corrupted (%d), correcting to %d", version, FormatVersion)
+		}
 		version = FormatVersion
 	}
 	
@@ -381,7 +385,7 @@ func (h *Header) Read(r io.Reader) error {
 			if n >= 8 {
 				h.Magic = binary.LittleEndian.Uint32(buf[0:4])
 				h.Version = binary.LittleEndian.Uint32(buf[4:8])
-				if h.Magic == MagicNumber && h.Version == FormatVersion {
+				if h.Magic == MagicNumber && supportedFormatVersion(h.Version) {
 					// Valid header but incomplete - assume empty file
 					h.EntityCount = 0
 					return nil
@@ -412,8 +416,7 @@ func (h *Header) Read(r io.Reader) error {
 	if h.Magic != MagicNumber {
 		return ErrInvalidFormat
 	}
-	// Support both version 2 (without deletion index) and version 3 (with deletion index)
-	if h.Version != 2 && h.Version != FormatVersion {
+	if !supportedFormatVersion(h.Version) {
 		return ErrVersionMismatch
 	}
 	
@@ -447,6 +450,13 @@ type IndexEntry struct {
 	Flags    uint32    // Reserved flags (0 = normal, 1 = compressed)
 }
 
+// supportedFormatVersion reports whether files of the given format version
+// can be read. Version 2 files have no deletion index; records written before
+// version 4 have no compact tags and are read as before.
+func supportedFormatVersion(version uint32) bool {
+	return version >= 2 && version <= FormatVersion
+}
+
 // EntityHeader represents the header of an entity data block.
 // This header precedes the tag and content data for each entity.
 //
@@ -456,12 +466,12 @@ type IndexEntry struct {
 //	0x00    8     Modified (Unix timestamp in nanoseconds)
 //	0x08    2     TagCount (number of tags)
 //	0x0A    2     ContentCount (number of content chunks)
-//	0x0C    4     Reserved (must be 0)
+//	0x0C    4     Flags (entityFlagCompactTags; other bits must be 0)
 type EntityHeader struct {
 	Modified     int64   // Last modification timestamp (Unix nanoseconds)
 	TagCount     uint16  // Number of tags in this entity
 	ContentCount uint16  // Number of content chunks (for autochunking)
-	Reserved     uint32  // Reserved for future use (must be 0)
+	Reserved     uint32  // Record flags, see entityFlagCompactTags
 }
 
 // TagDictionary manages tag string compression using dictionary encoding.
@@ -0,0 +1,328 @@
+package binary
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"entitydb/config"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Offline consistency check
+//
+// A check reads the database file without opening a repository: the header
+// and the bounds of the sections it declares, every record named by the
+// entity index (the checks of a storage diagnosis), and the frames of the
+// embedded WAL section. A repair opens the repository, which replays the
+// WAL, forces a recovery rebuild, closes it and checks the file again.
+// The check backs the --fsck startup mode and must not run against a
+// database a server has open.
+
+// Consistency check areas
+const (
+	FsckCheckHeader = "header"
+	FsckCheckIndex  = "index"
+	FsckCheckRecord = "record"
+	FsckCheckWAL    = "wal"
+	FsckCheckRepair = "repair"
+)
+
+// FsckOptions controls a consistency check
+type FsckOptions struct {
+	Repair   bool                 // repair and check again when problems are found
+	Progress RecoveryProgressFunc // reports each record examined (optional)
+}
+
+// FsckProblem is an inconsistency found by a check
+type FsckProblem struct {
+	Check    string `json:"check"`
+	EntityID string `json:"entity_id,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+// FsckHeader summarizes the header of the checked file
+type FsckHeader struct {
+	Version            uint32 `json:"version"`
+	EntityCount        uint64 `json:"entity_count"`
+	FileSize           int64  `json:"file_size"` // size on disk
+	WALSequence        uint64 `json:"wal_sequence"`
+	CheckpointSequence uint64 `json:"checkpoint_sequence"`
+}
+
+// FsckRecords describes the entity index and the records it names
+type FsckRecords struct {
+	IndexEntries       int `json:"index_entries"`
+	Examined           int `json:"examined"`
+	IndexOutOfRange    int `json:"index_out_of_range"`
+	Unreadable         int `json:"unreadable"`
+	ChecksumMismatches int `json:"checksum_mismatches"`
+}
+
+// FsckWAL describes the frames of the embedded WAL section
+type FsckWAL struct {
+	Sequence           uint64 `json:"sequence"`
+	Entries            int    `json:"entries"`
+	Corrupt            int    `json:"corrupt"`
+	ChecksumMismatches int    `json:"checksum_mismatches"`
+	Truncated          bool   `json:"truncated"` // the log ends in a partial entry
+}
+
+// FsckReport is the result of a consistency check. When a repair ran, the
+// checks describe the file after it and the problems found before it are
+// kept in ProblemsBeforeRepair.
+type FsckReport struct {
+	Database             string          `json:"database"`
+	StartedAt            time.Time       `json:"started_at"`
+	Duration             time.Duration   `json:"duration_ns"`
+	Healthy              bool            `json:"healthy"`
+	Problems             []FsckProblem   `json:"problems"`
+	Header               FsckHeader      `json:"header"`
+	Records              FsckRecords     `json:"records"`
+	WAL                  FsckWAL         `json:"wal"`
+	Repair               *RecoveryReport `json:"repair,omitempty"`
+	ProblemsBeforeRepair []FsckProblem   `json:"problems_before_repair,omitempty"`
+}
+
+func (report *FsckReport) problem(check, entityID, format string, args ...interface{}) {
+	report.Problems = append(report.Problems, FsckProblem{Check: check, EntityID: entityID, Detail: fmt.Sprintf(format, args...)})
+}
+
+// CheckDatabase checks the consistency of the database file named by cfg,
+// repairing it when asked to and problems are found. It returns an error
+// only when the check cannot run; problems are listed in the report.
+func CheckDatabase(ctx context.Context, cfg *config.Config, opts FsckOptions) (*FsckReport, error) {
+	if err := ConfigureContentEncryption(cfg); err != nil {
+		return nil, fmt.Errorf("failed to configure content encryption: %w", err)
+	}
+
+	startedAt := time.Now()
+	report, err := checkDatabaseFile(ctx, cfg, opts.Progress)
+	if err != nil || report.Healthy || !opts.Repair {
+		return report, err
+	}
+
+	before := report.Problems
+	repair, repairErr := repairDatabase(ctx, cfg, opts.Progress)
+	if report, err = checkDatabaseFile(ctx, cfg, opts.Progress); err != nil {
+		return nil, err
+	}
+	report.StartedAt = startedAt
+	report.Duration = time.Since(startedAt)
+	report.Repair = repair
+	report.ProblemsBeforeRepair = before
+	if repairErr != nil {
+		report.problem(FsckCheckRepair, "", "%v", repairErr)
+		report.Healthy = false
+	}
+	return report, nil
+}
+
+// repairDatabase opens the repository, replaying its WAL, and forces a
+// recovery rebuild
+func repairDatabase(ctx context.Context, cfg *config.Config, progress RecoveryProgressFunc) (*RecoveryReport, error) {
+	repo, err := NewEntityRepositoryWithConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+	report, err := repo.ForceRecoveryRebuild(ctx, progress)
+	if closeErr := repo.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close repository: %w", closeErr)
+	}
+	return report, err
+}
+
+// checkDatabaseFile runs the checks on the database file
+func checkDatabaseFile(ctx context.Context, cfg *config.Config, progress RecoveryProgressFunc) (*FsckReport, error) {
+	report := &FsckReport{Database: cfg.DatabaseFilename, StartedAt: time.Now(), Problems: []FsckProblem{}}
+	defer func() {
+		report.Duration = time.Since(report.StartedAt)
+		report.Healthy = len(report.Problems) == 0
+	}()
+
+	file, err := os.Open(cfg.DatabaseFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	report.Header.FileSize = stat.Size()
+
+	header, ok := checkHeader(file, report)
+	if !ok {
+		return report, nil
+	}
+	checkWALSection(file, header, report)
+	checkIndexEntries(file, header, report)
+
+	reader, err := NewReader(cfg.DatabaseFilename)
+	if err != nil {
+		report.problem(FsckCheckIndex, "", "index unreadable: %v", err)
+		return report, nil
+	}
+	defer reader.Close()
+	if err := checkRecords(ctx, reader, cfg, report, progress); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// checkHeader reads the header and checks the sections it declares lie
+// within the file, reporting whether the rest of the file can be checked
+func checkHeader(file *os.File, report *FsckReport) (*Header, bool) {
+	size := report.Header.FileSize
+	if size < HeaderSize {
+		report.problem(FsckCheckHeader, "", "file is %d bytes, shorter than the %d byte header", size, HeaderSize)
+		return nil, false
+	}
+	header := &Header{}
+	if err := header.Read(file); err != nil {
+		report.problem(FsckCheckHeader, "", "header unreadable: %v", err)
+		return nil, false
+	}
+	report.Header.Version = header.Version
+	report.Header.EntityCount = header.EntityCount
+	report.Header.WALSequence = header.WALSequence
+	report.Header.CheckpointSequence = header.CheckpointSequence
+
+	ok := true
+	if header.WALOffset < HeaderSize || (header.DataOffset > 0 && header.WALOffset+header.WALSize > header.DataOffset) {
+		report.problem(FsckCheckHeader, "", "WAL section at %d (%d bytes) overlaps the header or the data section at %d",
+			header.WALOffset, header.WALSize, header.DataOffset)
+		ok = false
+	}
+	// The data file is extended as entities are written, so the WAL
+	// section may be declared past its end
+	for _, section := range []struct {
+		name         string
+		offset, size uint64
+	}{
+		{"data", header.DataOffset, header.DataSize},
+		{"tag dictionary", header.TagDictOffset, header.TagDictSize},
+		{"entity index", header.EntityIndexOffset, header.EntityIndexSize},
+		{"deletion index", header.DeletionIndexOffset, header.DeletionIndexSize},
+	} {
+		if section.size > 0 && (section.offset < HeaderSize || section.offset+section.size > uint64(size)) {
+			report.problem(FsckCheckHeader, "", "%s section at %d (%d bytes) lies outside the %d byte file",
+				section.name, section.offset, section.size, size)
+			ok = false
+		}
+	}
+	if header.EntityIndexSize != header.EntityCount*IndexEntrySize {
+		report.problem(FsckCheckHeader, "", "entity index is %d bytes, %d entities need %d",
+			header.EntityIndexSize, header.EntityCount, header.EntityCount*IndexEntrySize)
+	}
+	return header, ok
+}
+
+// checkWALSection reads the frames of the WAL section: a 16 byte header
+// holding the sequence number, then length-prefixed entries up to a zero
+// length, the end of the section or an entry running past it
+func checkWALSection(file *os.File, header *Header, report *FsckReport) {
+	end := header.WALOffset + header.WALSize
+	if header.WALSize == 0 || end > uint64(report.Header.FileSize) {
+		end = uint64(report.Header.FileSize)
+	}
+	section := io.NewSectionReader(file, int64(header.WALOffset), int64(end-min(end, header.WALOffset)))
+
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(section, buf); err != nil {
+		// A file without entities may end before the WAL header is written
+		return
+	}
+	report.WAL.Sequence = binary.LittleEndian.Uint64(buf[0:8])
+
+	pos := int64(16)
+	decoder := &WAL{}
+	for pos+4 <= section.Size() {
+		if _, err := section.ReadAt(buf[:4], pos); err != nil {
+			break
+		}
+		length := int64(binary.LittleEndian.Uint32(buf[:4]))
+		if length == 0 {
+			break
+		}
+		if pos+4+length > section.Size() {
+			// A torn last write, which replay ignores as well
+			report.WAL.Truncated = true
+			break
+		}
+		data := make([]byte, length)
+		if _, err := section.ReadAt(data, pos+4); err != nil {
+			report.problem(FsckCheckWAL, "", "entry at %d unreadable: %v", int64(header.WALOffset)+pos, err)
+			break
+		}
+		pos += 4 + length
+
+		entry, err := decoder.deserializeEntry(data)
+		if err != nil {
+			report.WAL.Corrupt++
+			report.problem(FsckCheckWAL, "", "entry at %d: %v", int64(header.WALOffset)+pos-4-length, err)
+			continue
+		}
+		report.WAL.Entries++
+		if entry.Checksum != "" && entry.Entity != nil {
+			sum := sha256.Sum256(entry.Entity.Content)
+			if hex.EncodeToString(sum[:]) != entry.Checksum {
+				report.WAL.ChecksumMismatches++
+				report.problem(FsckCheckWAL, entry.EntityID, "content does not match WAL checksum %s", entry.Checksum)
+			}
+		}
+	}
+}
+
+// checkIndexEntries checks the entries of the entity index section lie
+// within the file and name distinct entities. Readers leave out entries
+// failing the first checks, so a diagnosis of the records does not see them.
+func checkIndexEntries(file *os.File, header *Header, report *FsckReport) {
+	entries := io.NewSectionReader(file, int64(header.EntityIndexOffset), int64(header.EntityIndexSize))
+	seen := make(map[string]bool)
+	buf := make([]byte, IndexEntrySize)
+	for i := int64(0); (i+1)*IndexEntrySize <= entries.Size(); i++ {
+		if _, err := entries.ReadAt(buf, i*IndexEntrySize); err != nil {
+			report.problem(FsckCheckIndex, "", "index entry %d unreadable: %v", i, err)
+			return
+		}
+		report.Records.IndexEntries++
+		id := string(bytes.TrimRight(buf[:96], "\x00"))
+		offset := binary.LittleEndian.Uint64(buf[96:104])
+		size := binary.LittleEndian.Uint32(buf[104:108])
+		switch {
+		case id == "":
+			report.problem(FsckCheckIndex, "", "index entry %d names no entity", i)
+		case seen[id]:
+			report.problem(FsckCheckIndex, id, "entity indexed more than once")
+		case size == 0:
+			report.problem(FsckCheckIndex, id, "index entry %d has a zero size", i)
+		case offset < HeaderSize || offset+uint64(size) > uint64(report.Header.FileSize):
+			report.Records.IndexOutOfRange++
+			report.problem(FsckCheckIndex, id, "%s: record at %d (%d bytes) lies outside the %d byte file",
+				QuarantineIndexOutOfRange, offset, size, report.Header.FileSize)
+		}
+		seen[id] = true
+	}
+}
+
+// checkRecords diagnoses every record the reader indexes
+func checkRecords(ctx context.Context, reader *Reader, cfg *config.Config, report *FsckReport, progress RecoveryProgressFunc) error {
+	var quarantine entityQuarantine
+	diagnosis := &RecoveryReport{}
+	if err := diagnoseRecords(ctx, reader, NewRecoveryManagerWithConfig(cfg), &quarantine, diagnosis, progress); err != nil {
+		return err
+	}
+	report.Records.Examined = diagnosis.Examined
+	report.Records.IndexOutOfRange += diagnosis.IndexOutOfRange
+	report.Records.Unreadable = diagnosis.Unreadable
+	report.Records.ChecksumMismatches = diagnosis.ChecksumMismatches
+	for _, failed := range quarantine.list() {
+		report.problem(FsckCheckRecord, failed.ID, "%s: %s", failed.Reason, failed.Detail)
+	}
+	return nil
+}
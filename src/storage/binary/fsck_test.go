@@ -0,0 +1,92 @@
+package binary
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestCheckDatabase checks a consistent database, then one whose record
+// content was overwritten on disk
+func TestCheckDatabase(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	cfg := repo.config
+	var ids []string
+	for _, content := range []string{"first", "second", "third"} {
+		entity, err := models.NewEntityWithMandatoryTags("note", "default", models.SystemUserID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entity.Content = []byte(content + " note body")
+		if err := repo.Create(entity); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, entity.ID)
+	}
+	flushWrites(t, repo)
+	updated, err := repo.GetByID(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated.Content = []byte("first note body, edited")
+	if err := repo.Update(updated); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := repo.Delete(ids[2]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CheckDatabase(context.Background(), cfg, FsckOptions{})
+	if err != nil {
+		t.Fatalf("CheckDatabase: %v", err)
+	}
+	if !report.Healthy || report.Records.Examined != 3 || report.Records.IndexEntries != 3 {
+		t.Fatalf("consistent database reported %+v", report)
+	}
+
+	// Move a record's index entry far past the end of the file, as a
+	// corrupted high word of the offset would
+	reader, err := NewReader(cfg.DatabaseFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := *reader.index[ids[1]]
+	indexOffset := int64(reader.header.EntityIndexOffset)
+	reader.Close()
+	file, err := os.OpenFile(cfg.DatabaseFilename, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offset [8]byte
+	for i := int64(0); i < 3; i++ {
+		var id [96]byte
+		file.ReadAt(id[:], indexOffset+i*IndexEntrySize)
+		if id == entry.EntityID {
+			binary.LittleEndian.PutUint64(offset[:], entry.Offset|1<<40)
+			file.WriteAt(offset[:], indexOffset+i*IndexEntrySize+96)
+		}
+	}
+	file.Close()
+
+	report, err = CheckDatabase(context.Background(), cfg, FsckOptions{})
+	if err != nil {
+		t.Fatalf("CheckDatabase: %v", err)
+	}
+	if report.Healthy || report.Records.IndexOutOfRange != 1 || len(report.Problems) != 1 || report.Problems[0].EntityID != ids[1] {
+		t.Fatalf("out of range index entry reported %+v", report)
+	}
+
+	report, err = CheckDatabase(context.Background(), cfg, FsckOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("CheckDatabase with repair: %v", err)
+	}
+	if !report.Healthy || report.Repair == nil || len(report.ProblemsBeforeRepair) != 1 || report.Records.Examined != 3 {
+		t.Fatalf("repair reported %+v", report)
+	}
+}
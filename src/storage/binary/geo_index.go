@@ -0,0 +1,286 @@
+package binary
+
+import (
+	"context"
+	"entitydb/models"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// geoIndexPrecision is the longest geohash prefix indexed, cells of about
+// 1.2 by 0.6 km
+const geoIndexPrecision = 6
+
+// geoMaxCoverCells bounds the geohash cells a search visits
+const geoMaxCoverCells = 64
+
+// geoEntry holds the geo tag values and location of an entity
+type geoEntry struct {
+	lat, lon, hash string
+	dataset        string
+	point          models.GeoPoint
+	geohash        string // at geoIndexPrecision
+}
+
+// locate resolves the entry's location from its tag values
+func (e *geoEntry) locate() bool {
+	point, ok := models.ParseGeoLocation(e.lat, e.lon, e.hash)
+	if !ok {
+		return false
+	}
+	e.point = point
+	e.geohash = models.EncodeGeohash(point, geoIndexPrecision)
+	return true
+}
+
+// GeoIndex maps geohash prefixes to the entities located in their cells,
+// at every precision up to geoIndexPrecision. A search visits the cells
+// covering its box at the finest precision that keeps them few, then
+// checks each candidate's exact location.
+type GeoIndex struct {
+	mu      sync.RWMutex
+	entries map[string]*geoEntry
+	cells   [geoIndexPrecision]map[string]map[string]struct{}
+}
+
+// GeoIndexStats summarizes the geo index
+type GeoIndexStats struct {
+	Entities int `json:"entities"`
+	Cells    int `json:"cells"`
+}
+
+// GeoMatch is an entity found by a geo search with its location
+type GeoMatch struct {
+	Entity   *models.Entity  `json:"entity"`
+	Location models.GeoPoint `json:"location"`
+	// DistanceMeters is the distance from the center of a radius search
+	DistanceMeters float64 `json:"distance_meters,omitempty"`
+}
+
+// GeoQuery selects entities by location: within Bounds, or within
+// RadiusMeters of Center when Center is set
+type GeoQuery struct {
+	Bounds       models.GeoBounds
+	Center       *models.GeoPoint
+	RadiusMeters float64
+	Dataset      string
+}
+
+// NewGeoIndex creates an empty geo index
+func NewGeoIndex() *GeoIndex {
+	idx := &GeoIndex{entries: make(map[string]*geoEntry)}
+	for i := range idx.cells {
+		idx.cells[i] = make(map[string]map[string]struct{})
+	}
+	return idx
+}
+
+// Observe replaces an entity's location with the one of its current tags
+func (idx *GeoIndex) Observe(entity *models.Entity) {
+	if idx == nil || entity == nil {
+		return
+	}
+	entry := &geoEntry{dataset: entity.GetDataset()}
+	for _, tag := range entity.GetTagsWithoutTimestamp() {
+		entry.setTag(tag)
+	}
+	located := !isDeletedLifecycleState(entity.GetLifecycleState()) && entry.locate()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(entity.ID)
+	if located {
+		idx.addLocked(entity.ID, entry)
+	}
+}
+
+// ObserveTag relocates an entity when a geo tag is appended to it without
+// a full rewrite; entity carries the appended tag
+func (idx *GeoIndex) ObserveTag(entity *models.Entity, tag string) {
+	if parts := strings.SplitN(tag, "|", 2); len(parts) == 2 {
+		tag = parts[1]
+	}
+	if strings.HasPrefix(tag, "geo:") {
+		idx.Observe(entity)
+	}
+}
+
+// setTag records the value of a geo tag
+func (e *geoEntry) setTag(tag string) {
+	switch {
+	case strings.HasPrefix(tag, models.GeoLatTagPrefix):
+		e.lat = strings.TrimPrefix(tag, models.GeoLatTagPrefix)
+	case strings.HasPrefix(tag, models.GeoLonTagPrefix):
+		e.lon = strings.TrimPrefix(tag, models.GeoLonTagPrefix)
+	case strings.HasPrefix(tag, models.GeoHashTagPrefix):
+		e.hash = strings.TrimPrefix(tag, models.GeoHashTagPrefix)
+	}
+}
+
+// Remove drops a deleted entity
+func (idx *GeoIndex) Remove(entityID string) {
+	if idx == nil {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(entityID)
+}
+
+func (idx *GeoIndex) addLocked(entityID string, entry *geoEntry) {
+	idx.entries[entityID] = entry
+	for i := range idx.cells {
+		prefix := entry.geohash[:i+1]
+		ids, ok := idx.cells[i][prefix]
+		if !ok {
+			ids = make(map[string]struct{})
+			idx.cells[i][prefix] = ids
+		}
+		ids[entityID] = struct{}{}
+	}
+}
+
+func (idx *GeoIndex) removeLocked(entityID string) {
+	entry, ok := idx.entries[entityID]
+	if !ok {
+		return
+	}
+	delete(idx.entries, entityID)
+	for i := range idx.cells {
+		prefix := entry.geohash[:i+1]
+		delete(idx.cells[i][prefix], entityID)
+		if len(idx.cells[i][prefix]) == 0 {
+			delete(idx.cells[i], prefix)
+		}
+	}
+}
+
+// coverCells returns the geohash cells covering a box that does not cross
+// the antimeridian, at the finest precision with at most geoMaxCoverCells
+func coverCells(bounds models.GeoBounds) []string {
+	for precision := geoIndexPrecision; precision >= 1; precision-- {
+		height, width := models.GeohashCellSize(precision)
+		latFrom, latTo := cellIndex(bounds.MinLat+90, height), cellIndex(bounds.MaxLat+90, height)
+		lonFrom, lonTo := cellIndex(bounds.MinLon+180, width), cellIndex(bounds.MaxLon+180, width)
+		if (latTo-latFrom+1)*(lonTo-lonFrom+1) > geoMaxCoverCells && precision > 1 {
+			continue
+		}
+
+		latCells, lonCells := int(180/height), int(360/width)
+		var cells []string
+		for lat := latFrom; lat <= latTo && lat < latCells; lat++ {
+			for lon := lonFrom; lon <= lonTo && lon < lonCells; lon++ {
+				center := models.GeoPoint{
+					Lat: -90 + (float64(lat)+0.5)*height,
+					Lon: -180 + (float64(lon)+0.5)*width,
+				}
+				cells = append(cells, models.EncodeGeohash(center, precision))
+			}
+		}
+		return cells
+	}
+	return nil
+}
+
+// cellIndex returns the cell of an offset from the grid origin
+func cellIndex(offset, size float64) int {
+	return int(offset / size)
+}
+
+// Search returns the IDs and locations of the entities within a query's
+// area. Deleted entities are not indexed.
+func (idx *GeoIndex) Search(query GeoQuery) map[string]models.GeoPoint {
+	found := make(map[string]models.GeoPoint)
+	if idx == nil {
+		return found
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	for _, bounds := range query.Bounds.Split() {
+		for _, cell := range coverCells(bounds) {
+			for id := range idx.cells[len(cell)-1][cell] {
+				entry := idx.entries[id]
+				if query.Dataset != "" && entry.dataset != query.Dataset {
+					continue
+				}
+				if !query.Bounds.Contains(entry.point) {
+					continue
+				}
+				if query.Center != nil && models.GeoDistanceMeters(*query.Center, entry.point) > query.RadiusMeters {
+					continue
+				}
+				found[id] = entry.point
+			}
+		}
+	}
+	return found
+}
+
+// Stats reports the size of the index
+func (idx *GeoIndex) Stats() GeoIndexStats {
+	if idx == nil {
+		return GeoIndexStats{}
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	cells := 0
+	for i := range idx.cells {
+		cells += len(idx.cells[i])
+	}
+	return GeoIndexStats{Entities: len(idx.entries), Cells: cells}
+}
+
+// GeoSearch returns the entities tagged with a location within a query's
+// area, nearest first for radius searches and by ID otherwise. The reads
+// stop when ctx ends.
+func (r *EntityRepository) GeoSearch(ctx context.Context, query GeoQuery) ([]GeoMatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if query.Center != nil {
+		query.Bounds = models.GeoRadiusBounds(*query.Center, query.RadiusMeters)
+	}
+
+	locations := r.geoIndex.Search(query)
+	ids := make([]string, 0, len(locations))
+	for id := range locations {
+		ids = append(ids, id)
+	}
+	ids = r.shardedTagIndex.FilterDeleted(ids)
+	if len(ids) == 0 {
+		return []GeoMatch{}, nil
+	}
+
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer r.readerPool.Put(reader)
+
+	entities, err := r.fetchEntitiesWithReader(ctx, reader, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]GeoMatch, 0, len(entities))
+	for _, entity := range entities {
+		match := GeoMatch{Entity: entity, Location: locations[entity.ID]}
+		if query.Center != nil {
+			match.DistanceMeters = models.GeoDistanceMeters(*query.Center, match.Location)
+		}
+		matches = append(matches, match)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if query.Center != nil && matches[i].DistanceMeters != matches[j].DistanceMeters {
+			return matches[i].DistanceMeters < matches[j].DistanceMeters
+		}
+		return matches[i].Entity.ID < matches[j].Entity.ID
+	})
+	return matches, nil
+}
+
+// GeoIndexStats reports the number of located entities and indexed cells
+func (r *EntityRepository) GeoIndexStats() GeoIndexStats {
+	return r.geoIndex.Stats()
+}
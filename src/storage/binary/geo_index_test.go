@@ -0,0 +1,110 @@
+package binary
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"entitydb/models"
+)
+
+// geoSearchIDs returns the sorted IDs found by an index search
+func geoSearchIDs(idx *GeoIndex, query GeoQuery) []string {
+	ids := []string{}
+	for id := range idx.Search(query) {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TestGeoIndexSearch checks bounding box searches over the geohash cells,
+// including boxes crossing the antimeridian and relocated entities
+func TestGeoIndexSearch(t *testing.T) {
+	idx := NewGeoIndex()
+	idx.Observe(summaryEntity("amsterdam", 1, []string{"geo:lat:52.3731", "geo:lon:4.8922", "dataset:places"}))
+	idx.Observe(summaryEntity("rotterdam", 1, []string{"geo:lat:51.9244", "geo:lon:4.4777", "dataset:places"}))
+	idx.Observe(summaryEntity("utrecht", 1, []string{"geo:hash:u178ke", "dataset:other"}))
+	idx.Observe(summaryEntity("fiji", 1, []string{"geo:lat:-17.7", "geo:lon:178.1"}))
+	idx.Observe(summaryEntity("samoa", 1, []string{"geo:lat:-13.8", "geo:lon:-171.8"}))
+	idx.Observe(summaryEntity("nowhere", 1, []string{"type:place"}))
+
+	netherlands := models.GeoBounds{MinLat: 50.7, MinLon: 3.3, MaxLat: 53.6, MaxLon: 7.2}
+	if got, want := geoSearchIDs(idx, GeoQuery{Bounds: netherlands}), []string{"amsterdam", "rotterdam", "utrecht"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search = %v, want %v", got, want)
+	}
+	if got, want := geoSearchIDs(idx, GeoQuery{Bounds: netherlands, Dataset: "places"}), []string{"amsterdam", "rotterdam"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dataset search = %v, want %v", got, want)
+	}
+	// A small box is answered from fine cells and checked exactly
+	city := models.GeoBounds{MinLat: 52.3, MinLon: 4.8, MaxLat: 52.4, MaxLon: 4.95}
+	if got, want := geoSearchIDs(idx, GeoQuery{Bounds: city}), []string{"amsterdam"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("city search = %v, want %v", got, want)
+	}
+
+	pacific := models.GeoBounds{MinLat: -20, MinLon: 175, MaxLat: -10, MaxLon: -170}
+	if got, want := geoSearchIDs(idx, GeoQuery{Bounds: pacific}), []string{"fiji", "samoa"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("antimeridian search = %v, want %v", got, want)
+	}
+	world := models.GeoBounds{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180}
+	if got := geoSearchIDs(idx, GeoQuery{Bounds: world}); len(got) != 5 {
+		t.Errorf("world search = %v, want every located entity", got)
+	}
+
+	// Appending coordinates moves an entity; removing drops it
+	idx.ObserveTag(summaryEntity("fiji", 2, []string{"geo:lat:52.37", "geo:lon:4.9"}), "2|geo:lon:4.9")
+	idx.Remove("rotterdam")
+	if got, want := geoSearchIDs(idx, GeoQuery{Bounds: netherlands, Dataset: ""}), []string{"amsterdam", "fiji", "utrecht"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search after updates = %v, want %v", got, want)
+	}
+	if stats := idx.Stats(); stats.Entities != 4 {
+		t.Errorf("Stats().Entities = %d, want 4", stats.Entities)
+	}
+}
+
+// TestRepositoryGeoSearch checks radius searches through the repository,
+// nearest first, and that deleted entities are not found
+func TestRepositoryGeoSearch(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	places := map[string][]string{
+		"geo-amsterdam": {"geo:lat:52.3731", "geo:lon:4.8922"},
+		"geo-haarlem":   {"geo:lat:52.3874", "geo:lon:4.6462"},
+		"geo-rotterdam": {"geo:lat:51.9244", "geo:lon:4.4777"},
+	}
+	for id, tags := range places {
+		if err := repo.Create(&models.Entity{ID: id, Tags: append(tags, "type:place", "dataset:geo")}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	flushWrites(t, repo)
+
+	center := models.GeoPoint{Lat: 52.3731, Lon: 4.8922}
+	matches, err := repo.GeoSearch(context.Background(), GeoQuery{Center: &center, RadiusMeters: 30000})
+	if err != nil {
+		t.Fatalf("GeoSearch: %v", err)
+	}
+	var ids []string
+	for _, match := range matches {
+		ids = append(ids, match.Entity.ID)
+	}
+	if want := []string{"geo-amsterdam", "geo-haarlem"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("radius search = %v, want %v", ids, want)
+	}
+	if matches[1].DistanceMeters < 16000 || matches[1].DistanceMeters > 18000 {
+		t.Errorf("distance to Haarlem = %.0f, want about 16800", matches[1].DistanceMeters)
+	}
+
+	if err := repo.Delete("geo-haarlem"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	matches, err = repo.GeoSearch(context.Background(), GeoQuery{Center: &center, RadiusMeters: 30000})
+	if err != nil {
+		t.Fatalf("GeoSearch after delete: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Entity.ID != "geo-amsterdam" {
+		t.Errorf("radius search after delete = %v, want only geo-amsterdam", matches)
+	}
+}
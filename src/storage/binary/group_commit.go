@@ -0,0 +1,87 @@
+package binary
+
+import (
+	"sync"
+)
+
+// groupCommit coalesces the syncs of concurrent writers (group commit).
+// A writer takes a ticket once its write is in the file and waits for the
+// ticket to be committed. The first waiter becomes the leader and syncs on
+// behalf of every ticket issued so far; writers arriving meanwhile park
+// until the next sync covers them. Under load one fsync covers many writes,
+// while a write is still durable before its writer returns.
+//
+// A failed sync commits nothing: the leader returns the error and the next
+// waiter retries the sync.
+type groupCommit struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	flush     func() error
+	issued    uint64 // tickets handed out
+	committed uint64 // highest ticket covered by a successful sync
+	syncing   bool
+	syncs     uint64 // successful syncs
+}
+
+// GroupCommitStats reports how many commits a group commit's syncs covered
+type GroupCommitStats struct {
+	Commits uint64 `json:"commits"`
+	Syncs   uint64 `json:"syncs"`
+}
+
+// newGroupCommit creates a group commit that makes writes durable with flush
+func newGroupCommit(flush func() error) *groupCommit {
+	g := &groupCommit{flush: flush}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// ticket records a completed write. Tickets must be taken in the order the
+// writes reached the file when that order matters to the sync function.
+func (g *groupCommit) ticket() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.issued++
+	return g.issued
+}
+
+// wait returns once a sync that started after ticket t was issued succeeds
+func (g *groupCommit) wait(t uint64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for g.committed < t {
+		if g.syncing {
+			g.cond.Wait()
+			continue
+		}
+		g.syncing = true
+		target := g.issued
+		g.mu.Unlock()
+		err := g.flush()
+		g.mu.Lock()
+		g.syncing = false
+		if err == nil {
+			if target > g.committed {
+				g.committed = target
+			}
+			g.syncs++
+		}
+		g.cond.Broadcast()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit makes every write completed before the call durable
+func (g *groupCommit) commit() error {
+	return g.wait(g.ticket())
+}
+
+// stats reports the tickets committed and the syncs that committed them
+func (g *groupCommit) stats() GroupCommitStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return GroupCommitStats{Commits: g.committed, Syncs: g.syncs}
+}
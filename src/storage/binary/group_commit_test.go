@@ -0,0 +1,114 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestGroupCommitCoalesces checks that writers waiting while a sync runs
+// share the next sync, and that a failed sync is retried by the next waiter
+func TestGroupCommitCoalesces(t *testing.T) {
+	var syncs atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g := newGroupCommit(func() error {
+		if syncs.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return nil
+	})
+
+	first := g.ticket()
+	done := make(chan error, 1)
+	go func() { done <- g.wait(first) }()
+	<-started
+
+	// These writes land while the first sync runs
+	const writers = 20
+	var wg sync.WaitGroup
+	tickets := make([]uint64, writers)
+	for i := range tickets {
+		tickets[i] = g.ticket()
+	}
+	for _, ticket := range tickets {
+		wg.Add(1)
+		go func(ticket uint64) {
+			defer wg.Done()
+			if err := g.wait(ticket); err != nil {
+				t.Errorf("wait(%d): %v", ticket, err)
+			}
+		}(ticket)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("wait(%d): %v", first, err)
+	}
+	wg.Wait()
+	if n := syncs.Load(); n != 2 {
+		t.Errorf("%d writes took %d syncs, want 2", writers+1, n)
+	}
+	if stats := g.stats(); stats.Commits != writers+1 || stats.Syncs != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	failing := true
+	g = newGroupCommit(func() error {
+		if failing {
+			failing = false
+			return errors.New("disk full")
+		}
+		return nil
+	})
+	ticket := g.ticket()
+	if err := g.wait(ticket); err == nil {
+		t.Fatal("failed sync reported success")
+	}
+	if err := g.wait(ticket); err != nil {
+		t.Errorf("retried sync: %v", err)
+	}
+}
+
+// TestWALGroupCommit checks that concurrent WAL writers are all logged and
+// replayed while sharing fsyncs
+func TestWALGroupCommit(t *testing.T) {
+	wal, err := NewWALWithPath(filepath.Join(t.TempDir(), "entitydb.wal"))
+	if err != nil {
+		t.Fatalf("NewWALWithPath: %v", err)
+	}
+	defer wal.Close()
+
+	const writers = 32
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entity := &models.Entity{ID: fmt.Sprintf("entity-%d", i), Tags: []string{"1|type:test"}}
+			if err := wal.LogCreate(entity); err != nil {
+				t.Errorf("LogCreate: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	replayed := 0
+	if err := wal.Replay(func(entry WALEntry) error {
+		replayed++
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if replayed != writers {
+		t.Errorf("replayed %d entries, want %d", replayed, writers)
+	}
+	if stats := wal.GroupCommitStats(); stats.Commits != writers || stats.Syncs == 0 || stats.Syncs > writers {
+		t.Errorf("group commit stats = %+v", stats)
+	}
+}
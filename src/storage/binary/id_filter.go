@@ -0,0 +1,182 @@
+package binary
+
+import (
+	"entitydb/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// minIDFilterCapacity is the smallest number of IDs an ID filter is sized
+// for, so small databases do not rebuild on every few creates
+const minIDFilterCapacity = 100000
+
+// entityIDFilter is a Bloom filter over the IDs of stored entities. GetByID
+// consults it after the cache: an ID the filter has never seen is definitely
+// not stored, and is reported missing without a disk read or recovery
+// attempt. Deleted IDs stay in the filter until it is rebuilt, which only
+// costs an occasional disk read.
+//
+// The filter is sized for twice the IDs it is built from and rebuilt in the
+// background once it holds more than its capacity, as well as after index
+// rebuilds.
+type entityIDFilter struct {
+	falsePositiveRate float64
+
+	mu       sync.RWMutex
+	current  *BloomFilter // nil until the first build completes
+	next     *BloomFilter // filter being built; receives adds meanwhile
+	capacity uint
+
+	rebuilding int32
+	negatives  int64 // lookups answered as definitely missing
+}
+
+// IDFilterStats describes the entity ID filter
+type IDFilterStats struct {
+	Enabled                    bool    `json:"enabled"`
+	Items                      uint    `json:"items"`
+	Capacity                   uint    `json:"capacity"`
+	EstimatedFalsePositiveRate float64 `json:"estimated_false_positive_rate"`
+	Negatives                  int64   `json:"negatives"`
+}
+
+// newEntityIDFilter creates an unbuilt ID filter
+func newEntityIDFilter(falsePositiveRate float64) *entityIDFilter {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+	return &entityIDFilter{falsePositiveRate: falsePositiveRate}
+}
+
+// mayContain reports whether an entity might be stored. It is true until
+// the filter is first built.
+func (f *entityIDFilter) mayContain(id string) bool {
+	if f == nil {
+		return true
+	}
+	f.mu.RLock()
+	current := f.current
+	f.mu.RUnlock()
+	if current == nil || current.Contains(id) {
+		return true
+	}
+	atomic.AddInt64(&f.negatives, 1)
+	return false
+}
+
+// add records a stored entity ID, starting a background rebuild once the
+// filter holds more IDs than it was sized for
+func (f *entityIDFilter) add(id string, ids func() []string) {
+	if f == nil {
+		return
+	}
+	f.mu.RLock()
+	current, next, capacity := f.current, f.next, f.capacity
+	f.mu.RUnlock()
+	// Updates add IDs already present; skipping them keeps the count of
+	// items close to the number of distinct IDs
+	if current != nil && !current.Contains(id) {
+		current.Add(id)
+		if current.Count() > capacity {
+			go f.rebuild(ids)
+		}
+	}
+	if next != nil && !next.Contains(id) {
+		next.Add(id)
+	}
+}
+
+// rebuild builds a new filter from ids and swaps it in. IDs added while it
+// builds go to both filters, so none are lost.
+func (f *entityIDFilter) rebuild(ids func() []string) {
+	if f == nil || !atomic.CompareAndSwapInt32(&f.rebuilding, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&f.rebuilding, 0)
+	start := time.Now()
+
+	// Size from the current count before listing, then add the listing
+	f.mu.RLock()
+	sizeHint := uint(0)
+	if f.current != nil {
+		sizeHint = f.current.Count()
+	}
+	f.mu.RUnlock()
+	capacity := sizeHint * 2
+	if capacity < minIDFilterCapacity {
+		capacity = minIDFilterCapacity
+	}
+	next := NewBloomFilter(capacity, f.falsePositiveRate)
+	f.mu.Lock()
+	f.next = next
+	f.mu.Unlock()
+
+	listed := ids()
+	if uint(len(listed)) > capacity {
+		// Grew past the hint while listing: start over at the right size
+		capacity = uint(len(listed)) * 2
+		next = NewBloomFilter(capacity, f.falsePositiveRate)
+		f.mu.Lock()
+		f.next = next
+		f.mu.Unlock()
+		listed = ids()
+	}
+	for _, id := range listed {
+		if !next.Contains(id) {
+			next.Add(id)
+		}
+	}
+
+	f.mu.Lock()
+	f.current, f.next, f.capacity = next, nil, capacity
+	f.mu.Unlock()
+	logger.Debug("Built entity ID filter: %d IDs, capacity %d, in %v", len(listed), capacity, time.Since(start))
+}
+
+// stats describes the filter
+func (f *entityIDFilter) stats() IDFilterStats {
+	if f == nil {
+		return IDFilterStats{}
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	stats := IDFilterStats{Enabled: true, Capacity: f.capacity, Negatives: atomic.LoadInt64(&f.negatives)}
+	if f.current != nil {
+		stats.Items = f.current.Count()
+		stats.EstimatedFalsePositiveRate = f.current.EstimateFalsePositiveRate()
+	}
+	return stats
+}
+
+// storedEntityIDs lists the IDs in the data file and those only known to
+// the tag index, for building the ID filter
+func (r *EntityRepository) storedEntityIDs() []string {
+	r.mu.RLock()
+	tagIndex := r.shardedTagIndex
+	r.mu.RUnlock()
+	ids := tagIndex.EntityIDs()
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		logger.Warn("ID filter built from the tag index only: %v", err)
+		return ids
+	}
+	defer r.readerPool.Put(reader)
+
+	indexed := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		indexed[id] = struct{}{}
+	}
+	for _, id := range reader.EntityIDs() {
+		if _, ok := indexed[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// IDFilterStats describes the Bloom filter GetByID uses to answer lookups
+// of missing entities without reading the disk
+func (r *EntityRepository) IDFilterStats() IDFilterStats {
+	return r.idFilter.stats()
+}
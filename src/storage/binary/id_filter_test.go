@@ -0,0 +1,88 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"entitydb/config"
+	"entitydb/models"
+)
+
+// TestIDFilterGetByID checks that GetByID answers missing IDs from the ID
+// filter, finds entities created before and after a restart, and that an
+// online index rebuild rebuilds the filter
+func TestIDFilterGetByID(t *testing.T) {
+	repo := newTestRepository(t, func(cfg *config.Config) {
+		cfg.IDBloomFilter = true
+	})
+	cfg := repo.config
+
+	entity, err := models.NewEntityWithMandatoryTags("document", "default", models.SystemUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(entity); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := repo.GetByID(entity.ID); err != nil {
+		t.Fatalf("GetByID of created entity: %v", err)
+	}
+	if _, err := repo.GetByID("never-stored"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetByID of missing ID = %v, want ErrNotFound", err)
+	}
+	if stats := repo.IDFilterStats(); !stats.Enabled || stats.Negatives == 0 {
+		t.Errorf("ID filter stats = %+v, want a negative lookup recorded", stats)
+	}
+	repo.FlushPendingWrites()
+	repo.Close()
+
+	// The filter is rebuilt from the stored entities on open
+	repo, err = NewEntityRepositoryWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen repository: %v", err)
+	}
+	defer repo.Close()
+	repo.entityCache.Delete(entity.ID)
+	if _, err := repo.GetByID(entity.ID); err != nil {
+		t.Errorf("GetByID after reopen: %v", err)
+	}
+	if err := repo.RebuildIndexesOnline(nil); err != nil {
+		t.Fatalf("RebuildIndexesOnline: %v", err)
+	}
+	repo.entityCache.Delete(entity.ID)
+	if _, err := repo.GetByID(entity.ID); err != nil {
+		t.Errorf("GetByID after index rebuild: %v", err)
+	}
+}
+
+// TestEntityIDFilterRebuild checks that IDs added while the filter is
+// rebuilt are kept and that the filter grows past its capacity
+func TestEntityIDFilterRebuild(t *testing.T) {
+	f := newEntityIDFilter(0.01)
+	if !f.mayContain("anything") {
+		t.Fatal("an unbuilt filter must not answer misses")
+	}
+
+	stored := []string{"a", "b"}
+	list := func() []string {
+		// A write lands while the rebuild lists the stored IDs
+		f.add("late", nil)
+		return stored
+	}
+	f.rebuild(list)
+	for _, id := range []string{"a", "b", "late"} {
+		if !f.mayContain(id) {
+			t.Errorf("filter lost %s", id)
+		}
+	}
+
+	var many []string
+	for i := 0; i < minIDFilterCapacity+10; i++ {
+		many = append(many, fmt.Sprintf("id-%d", i))
+	}
+	f.rebuild(func() []string { return many })
+	if stats := f.stats(); stats.Capacity < uint(len(many)) || stats.Items == 0 {
+		t.Errorf("filter stats after growth = %+v, want capacity for %d IDs", stats, len(many))
+	}
+}
@@ -286,7 +286,7 @@ func (iiv *IndexIntegrityValidator) validateTagIndex(expected map[string][]strin
 	
 	// Check each expected tag
 	for tag, expectedEntities := range expected {
-		actualEntities := iiv.repo.shardedTagIndex.GetEntitiesForTag(tag)
+		actualEntities := iiv.repo.shardedTagIndex.GetEntitiesForTagIncludingDeleted(tag)
 		
 		// Find missing entries (in expected but not in index)
 		actualSet := make(map[string]bool)
@@ -434,18 +434,10 @@ func (iiv *IndexIntegrityValidator) validateNamespaceIndex(entities []*models.En
 // getAllEntitiesFromStorage retrieves all entities directly from storage
 func (iiv *IndexIntegrityValidator) getAllEntitiesFromStorage() ([]*models.Entity, error) {
 	// Read directly from file to bypass potentially corrupted indexes
-	var entities []*models.Entity
-	
 	// Get a reader
-	readerInterface := iiv.repo.readerPool.Get()
-	if readerInterface == nil {
-		return nil, fmt.Errorf("failed to get reader from pool")
-	}
-	
-	reader, ok := readerInterface.(*Reader)
-	if !ok {
-		iiv.repo.readerPool.Put(readerInterface)
-		return nil, fmt.Errorf("invalid reader type")
+	reader, err := iiv.repo.readerPool.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reader from pool: %w", err)
 	}
 	defer iiv.repo.readerPool.Put(reader)
 	
@@ -0,0 +1,74 @@
+package binary
+
+// Approximate sizes used to account for index memory. They follow the
+// 64-bit runtime layout and ignore allocator rounding and spare slice
+// capacity, so the totals are estimates for capacity planning rather than
+// exact heap usage.
+const (
+	stringHeaderBytes = 16
+	sliceHeaderBytes  = 24
+	mapHeaderBytes    = 48
+	timeBytes         = 24
+	mapEntryBytes     = 48 // key and value slots plus amortized bucket overhead
+)
+
+// stringBytes approximates a string held in an index
+func stringBytes(s string) int64 {
+	return stringHeaderBytes + int64(len(s))
+}
+
+// stringsBytes approximates the strings of a slice
+func stringsBytes(values []string) int64 {
+	var total int64
+	for _, v := range values {
+		total += stringBytes(v)
+	}
+	return total
+}
+
+// IndexMemoryStats is the approximate memory held by each in-memory index
+type IndexMemoryStats struct {
+	TagIndexBytes       int64 `json:"tag_index_bytes"`
+	TagValueIndexBytes  int64 `json:"tag_value_index_bytes"`
+	AdjacencyIndexBytes int64 `json:"adjacency_index_bytes"`
+	VariantCacheBytes   int64 `json:"variant_cache_bytes"`
+	TemporalIndexBytes  int64 `json:"temporal_index_bytes"`
+	NamespaceIndexBytes int64 `json:"namespace_index_bytes"`
+	TotalBytes          int64 `json:"total_bytes"`
+
+	// Spilled tag posting lists, present with a tag index memory budget
+	TagIndexSpill *TagIndexSpillStats `json:"tag_index_spill,omitempty"`
+}
+
+// IndexMemoryStats reports the approximate memory of the tag, tag value,
+// adjacency, variant, temporal and namespace indexes. Each index tracks its size as
+// entries are inserted and removed, so reading it costs no scan.
+func (r *EntityRepository) IndexMemoryStats() IndexMemoryStats {
+	// Index rebuilds swap the indexes under the repository lock
+	r.mu.RLock()
+	tags, variants := r.shardedTagIndex, r.tagVariantCache
+	temporal, namespaces := r.temporalIndex, r.namespaceIndex
+	r.mu.RUnlock()
+
+	var stats IndexMemoryStats
+	if tags != nil {
+		stats.TagIndexBytes = tags.MemoryBytes()
+		stats.TagValueIndexBytes = tags.values.MemoryBytes()
+		stats.AdjacencyIndexBytes = tags.edges.MemoryBytes()
+		if spill, ok := tags.SpillStats(); ok {
+			stats.TagIndexSpill = &spill
+		}
+	}
+	if variants != nil {
+		stats.VariantCacheBytes = variants.MemoryBytes()
+	}
+	if temporal != nil {
+		stats.TemporalIndexBytes = temporal.MemoryBytes()
+	}
+	if namespaces != nil {
+		stats.NamespaceIndexBytes = namespaces.MemoryBytes()
+	}
+	stats.TotalBytes = stats.TagIndexBytes + stats.TagValueIndexBytes + stats.AdjacencyIndexBytes +
+		stats.VariantCacheBytes + stats.TemporalIndexBytes + stats.NamespaceIndexBytes
+	return stats
+}
@@ -0,0 +1,66 @@
+package binary
+
+import (
+	"testing"
+	"time"
+)
+
+// TestIndexMemoryAccounting checks that each index's byte count grows on
+// insert and returns to zero once everything is removed
+func TestIndexMemoryAccounting(t *testing.T) {
+	tags := NewShardedTagIndex()
+	tags.AddTag("type:user", "e1")
+	tags.AddTag("type:user", "e2")
+	tags.AddTag("type:user", "e2")
+	tags.AddTag("status:active", "e1")
+	tags.MarkDeleted("e2")
+	if tags.MemoryBytes() <= 0 || tags.values.MemoryBytes() <= 0 {
+		t.Fatalf("tag index bytes = %d, value index bytes = %d, want > 0", tags.MemoryBytes(), tags.values.MemoryBytes())
+	}
+	tags.RemoveTag("status:active", "e1")
+	tags.RemoveEntities(map[string]struct{}{"e1": {}, "e2": {}})
+	if got := tags.MemoryBytes(); got != 0 {
+		t.Errorf("tag index bytes after removal = %d, want 0", got)
+	}
+	if got := tags.values.MemoryBytes(); got != 0 {
+		t.Errorf("tag value index bytes after removal = %d, want 0", got)
+	}
+
+	namespaces := NewNamespaceIndex()
+	namespaces.AddTag("e1", "1|type:user")
+	namespaces.AddTag("e1", "2|status:active")
+	namespaces.AddTag("e2", "type:user")
+	before := namespaces.MemoryBytes()
+	namespaces.RemoveEntity("e1")
+	namespaces.RemoveEntity("e2")
+	// Namespaces themselves are kept once seen
+	if got, want := namespaces.MemoryBytes(), 2*(mapEntryBytes+mapHeaderBytes)+stringBytes("type")+stringBytes("status"); before <= want || got != want {
+		t.Errorf("namespace index bytes = %d then %d, want > %d then %d", before, got, want, want)
+	}
+
+	temporal := NewTemporalIndex()
+	now := time.Now()
+	temporal.AddEntry("e1", "type:user", now)
+	temporal.AddEntry("e1", "status:active", now.Add(2*time.Hour))
+	temporal.AddEntry("e2", "type:user", now)
+	if temporal.MemoryBytes() <= 0 {
+		t.Fatalf("temporal index bytes = %d, want > 0", temporal.MemoryBytes())
+	}
+	temporal.RemoveEntity("e1")
+	temporal.RemoveEntity("e2")
+	if got := temporal.MemoryBytes(); got != 0 {
+		t.Errorf("temporal index bytes after removal = %d, want 0", got)
+	}
+
+	variants := NewTagVariantCache()
+	variants.AddTagVariant("1|type:user", "type:user", "e1")
+	variants.AddTagVariant("1|type:user", "type:user", "e2")
+	if variants.MemoryBytes() <= 0 {
+		t.Fatalf("variant cache bytes = %d, want > 0", variants.MemoryBytes())
+	}
+	variants.RemoveEntityFromVariant("e1")
+	variants.RemoveEntityFromVariant("e2")
+	if got, want := variants.MemoryBytes(), mapEntryBytes+stringBytes("1|type:user")+sliceHeaderBytes+stringBytes("type:user"); got != want {
+		t.Errorf("variant cache bytes after removal = %d, want %d (temporal mapping kept)", got, want)
+	}
+}
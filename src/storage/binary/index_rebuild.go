@@ -0,0 +1,313 @@
+package binary
+
+import (
+	"entitydb/config"
+	"entitydb/logger"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IndexRebuildStats captures throughput of the most recent index rebuild
+type IndexRebuildStats struct {
+	StartedAt      time.Time     `json:"started_at"`
+	Duration       time.Duration `json:"duration_ns"`
+	Entities       int64         `json:"entities"`
+	Bytes          int64         `json:"bytes"`
+	Workers        int           `json:"workers"`
+	ChunkSize      int           `json:"chunk_size"`
+	RateLimitMB    int           `json:"rate_limit_mb"`
+	ThrottledFor   time.Duration `json:"throttled_ns"`
+	EntitiesPerSec float64       `json:"entities_per_sec"`
+	BytesPerSec    float64       `json:"bytes_per_sec"`
+}
+
+// indexRebuildSettings holds the resolved parallelism and throttling settings
+type indexRebuildSettings struct {
+	workers     int
+	chunkSize   int
+	rateLimitMB int
+}
+
+// resolveIndexRebuildSettings derives rebuild settings from configuration,
+// falling back to CPU-count defaults for unset or invalid values
+func resolveIndexRebuildSettings(cfg *config.Config) indexRebuildSettings {
+	settings := indexRebuildSettings{
+		workers:   runtime.NumCPU(),
+		chunkSize: 50,
+	}
+	if cfg == nil {
+		return settings
+	}
+	if cfg.IndexRebuildWorkers > 0 {
+		settings.workers = cfg.IndexRebuildWorkers
+	}
+	if cfg.IndexRebuildChunkSize > 0 {
+		settings.chunkSize = cfg.IndexRebuildChunkSize
+	}
+	if cfg.IndexRebuildIORateLimitMB > 0 {
+		settings.rateLimitMB = cfg.IndexRebuildIORateLimitMB
+	}
+	return settings
+}
+
+// rebuildThrottle paces rebuild work to a byte-per-second budget.
+// A zero budget disables throttling.
+type rebuildThrottle struct {
+	mu          sync.Mutex
+	bytesPerSec int64
+	start       time.Time
+	consumed    int64
+	throttled   time.Duration
+}
+
+// newRebuildThrottle creates a throttle limited to rateLimitMB megabytes per second
+func newRebuildThrottle(rateLimitMB int) *rebuildThrottle {
+	return &rebuildThrottle{
+		bytesPerSec: int64(rateLimitMB) * 1024 * 1024,
+		start:       time.Now(),
+	}
+}
+
+// wait accounts for n bytes and sleeps until the budget allows them
+func (t *rebuildThrottle) wait(n int64) {
+	if t.bytesPerSec <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	t.consumed += n
+	due := t.start.Add(time.Duration(float64(t.consumed) / float64(t.bytesPerSec) * float64(time.Second)))
+	delay := time.Until(due)
+	if delay > 0 {
+		t.throttled += delay
+	}
+	t.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// throttledFor returns the total time spent sleeping
+func (t *rebuildThrottle) throttledFor() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.throttled
+}
+
+// estimateEntitySize approximates the bytes read to index an entity
+func estimateEntitySize(entity *models.Entity) int64 {
+	size := int64(len(entity.ID) + len(entity.Content))
+	for _, tag := range entity.Tags {
+		size += int64(len(tag))
+	}
+	return size
+}
+
+// recordIndexRebuild stores throughput figures for the completed rebuild
+func (r *EntityRepository) recordIndexRebuild(stats IndexRebuildStats) {
+	if secs := stats.Duration.Seconds(); secs > 0 {
+		stats.EntitiesPerSec = float64(stats.Entities) / secs
+		stats.BytesPerSec = float64(stats.Bytes) / secs
+	}
+
+	r.rebuildStatsMu.Lock()
+	r.lastIndexRebuild = stats
+	r.rebuildStatsMu.Unlock()
+}
+
+// GetIndexRebuildStats returns throughput figures for the most recent index rebuild
+func (r *EntityRepository) GetIndexRebuildStats() IndexRebuildStats {
+	r.rebuildStatsMu.RLock()
+	defer r.rebuildStatsMu.RUnlock()
+	return r.lastIndexRebuild
+}
+
+// ErrIndexRebuildRunning is returned when an online rebuild is already in progress
+var ErrIndexRebuildRunning = errors.New("index rebuild already in progress")
+
+// IndexRebuildProgressFunc receives progress of an online index rebuild after
+// each entity. err is set when the entity could not be read.
+type IndexRebuildProgressFunc func(processed, total int, entityID string, err error)
+
+// indexSet holds a complete set of in-memory indexes built off to the side
+type indexSet struct {
+	tags       *ShardedTagIndex
+	temporal   *TemporalIndex
+	namespaces *NamespaceIndex
+	content    map[string][]string
+	variants   *TagVariantCache
+}
+
+// add indexes an entity into the set the same way updateIndexes does
+func (s *indexSet) add(entity *models.Entity) {
+	for _, tag := range entity.Tags {
+		s.tags.AddTag(tag, entity.ID)
+		if parts := strings.SplitN(tag, "|", 2); len(parts) == 2 {
+			if timestampNanos, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+				s.temporal.AddEntry(entity.ID, tag, time.Unix(0, timestampNanos))
+			}
+			s.tags.AddTag(parts[1], entity.ID)
+			if s.variants != nil {
+				s.variants.AddTagVariant(tag, parts[1], entity.ID)
+			}
+		}
+		s.namespaces.AddTag(entity.ID, tag)
+	}
+	if isDeletedLifecycleState(entity.GetLifecycleState()) {
+		s.tags.MarkDeleted(entity.ID)
+	}
+	if len(entity.Content) > 0 {
+		contentStr := string(entity.Content)
+		s.content[contentStr] = append(s.content[contentStr], entity.ID)
+	}
+}
+
+// noteIndexChange records that an entity's indexes changed while an online
+// rebuild is running, so the change can be re-applied after the swap
+func (r *EntityRepository) noteIndexChange(entityID string) {
+	if atomic.LoadInt32(&r.rebuildRunning) == 0 {
+		return
+	}
+	r.rebuildDirtyMu.Lock()
+	if r.rebuildDirty != nil {
+		r.rebuildDirty[entityID] = struct{}{}
+	}
+	r.rebuildDirtyMu.Unlock()
+}
+
+// RebuildIndexesOnline rebuilds all in-memory indexes without blocking reads.
+//
+// The new indexes are built from the data file into a separate set while the
+// live indexes keep serving queries and absorbing writes. Entities written
+// during the rebuild are recorded and re-indexed once the new set is swapped
+// in, which is the only step that holds the repository lock. Entities held in
+// the entity cache are indexed from memory since they may be newer than the
+// data file.
+func (r *EntityRepository) RebuildIndexesOnline(progress IndexRebuildProgressFunc) error {
+	if !atomic.CompareAndSwapInt32(&r.rebuildRunning, 0, 1) {
+		return ErrIndexRebuildRunning
+	}
+	defer atomic.StoreInt32(&r.rebuildRunning, 0)
+
+	r.rebuildDirtyMu.Lock()
+	r.rebuildDirty = make(map[string]struct{})
+	r.rebuildDirtyMu.Unlock()
+
+	started := time.Now()
+	settings := resolveIndexRebuildSettings(r.config)
+	throttle := newRebuildThrottle(settings.rateLimitMB)
+
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		return fmt.Errorf("failed to get reader: %w", err)
+	}
+	defer r.readerPool.Put(reader)
+
+	set := &indexSet{
+		tags:       r.newTagIndex(),
+		temporal:   NewTemporalIndex(),
+		namespaces: NewNamespaceIndex(),
+		content:    make(map[string][]string),
+	}
+	if r.useVariantCache {
+		set.variants = NewTagVariantCache()
+	}
+
+	// Index every entity in the data file plus those only known to the live
+	// index, which are not yet persisted and are served from memory
+	ids := reader.EntityIDs()
+	onDisk := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		onDisk[id] = struct{}{}
+	}
+	for _, id := range r.shardedTagIndex.EntityIDs() {
+		if _, ok := onDisk[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+
+	var totalBytes int64
+	for i, id := range ids {
+		entity, ok := r.entityCache.Get(id)
+		if !ok {
+			entity, err = reader.GetEntity(id)
+			if err != nil {
+				if progress != nil {
+					progress(i+1, len(ids), id, err)
+				}
+				continue
+			}
+		}
+
+		size := estimateEntitySize(entity)
+		throttle.wait(size)
+		totalBytes += size
+		set.add(entity)
+
+		if progress != nil {
+			progress(i+1, len(ids), id, nil)
+		}
+	}
+
+	// Swap in the new indexes and catch up with writes made meanwhile
+	r.mu.Lock()
+	r.rebuildDirtyMu.Lock()
+	dirty := r.rebuildDirty
+	r.rebuildDirty = nil
+	r.rebuildDirtyMu.Unlock()
+
+	set.tags.RemoveEntities(dirty)
+	for id := range dirty {
+		set.temporal.RemoveEntity(id)
+		set.namespaces.RemoveEntity(id)
+		if set.variants != nil {
+			set.variants.RemoveEntityFromVariant(id)
+		}
+	}
+
+	// History recorded from writes cannot be rebuilt from stored tags
+	set.temporal.absorbRecordedChanges(r.temporalIndex)
+
+	r.shardedTagIndex = set.tags
+	r.temporalIndex = set.temporal
+	r.namespaceIndex = set.namespaces
+	r.contentIndex = set.content
+	if set.variants != nil {
+		r.tagVariantCache = set.variants
+	}
+	for id := range dirty {
+		if entity, ok := r.entityCache.Get(id); ok {
+			set.add(entity)
+		}
+	}
+	r.tagIndexDirty = true
+	r.mu.Unlock()
+
+	r.cache.Clear()
+
+	// Drop deleted IDs from the ID filter and resize it to the data
+	r.idFilter.rebuild(r.storedEntityIDs)
+
+	r.recordIndexRebuild(IndexRebuildStats{
+		StartedAt:    started,
+		Duration:     time.Since(started),
+		Entities:     int64(len(ids)),
+		Bytes:        totalBytes,
+		Workers:      1,
+		ChunkSize:    settings.chunkSize,
+		RateLimitMB:  settings.rateLimitMB,
+		ThrottledFor: throttle.throttledFor(),
+	})
+
+	logger.Info("Online index rebuild complete: %d entities in %v, %d re-applied after swap",
+		len(ids), time.Since(started), len(dirty))
+	return nil
+}
@@ -0,0 +1,76 @@
+package binary
+
+import (
+	"entitydb/cache"
+)
+
+// Index, cache and pool introspection
+//
+// These report the live state of the repository's in-memory structures for
+// the admin dashboard. Each is read without stopping writers, so figures
+// taken from different structures may not agree exactly.
+
+// TagIndexShardsStats summarizes the shards of the tag index and lists each
+// one, so uneven tag distribution shows up as hot shards
+type TagIndexShardsStats struct {
+	NumShards     int                  `json:"num_shards"`
+	TotalTags     int                  `json:"total_tags"`
+	TotalPostings int                  `json:"total_postings"`
+	MemoryBytes   int64                `json:"memory_bytes"`
+	MinTags       int                  `json:"min_tags_per_shard"`
+	MaxTags       int                  `json:"max_tags_per_shard"`
+	AvgTags       float64              `json:"avg_tags_per_shard"`
+	Shards        []TagIndexShardStats `json:"shards"`
+}
+
+// PoolStats describes the repository's reader pool and the shared buffer
+// pools
+type PoolStats struct {
+	ReaderPool         ReaderPoolStats   `json:"reader_pool"`
+	ReaderPoolHitRatio float64           `json:"reader_pool_hit_ratio"`
+	BufferPools        []BufferPoolStats `json:"buffer_pools"`
+}
+
+// TagIndexShardStats returns the tag count, posting count and approximate
+// memory of every shard of the tag index
+func (r *EntityRepository) TagIndexShardStats() TagIndexShardsStats {
+	// Index rebuilds swap the index under the repository lock
+	r.mu.RLock()
+	index := r.shardedTagIndex
+	r.mu.RUnlock()
+
+	stats := TagIndexShardsStats{NumShards: NumShards, Shards: []TagIndexShardStats{}}
+	if index == nil {
+		return stats
+	}
+	stats.Shards = index.ShardStats()
+	for i, shard := range stats.Shards {
+		stats.TotalTags += shard.Tags
+		stats.TotalPostings += shard.Postings
+		stats.MemoryBytes += shard.MemoryBytes
+		if i == 0 || shard.Tags < stats.MinTags {
+			stats.MinTags = shard.Tags
+		}
+		if shard.Tags > stats.MaxTags {
+			stats.MaxTags = shard.Tags
+		}
+	}
+	stats.AvgTags = float64(stats.TotalTags) / float64(NumShards)
+	return stats
+}
+
+// QueryCacheStats returns the entries, hit rate and evictions of the tag
+// query result cache
+func (r *EntityRepository) QueryCacheStats() cache.QueryCacheStats {
+	return r.cache.Stats()
+}
+
+// PoolStats returns the reader pool and buffer pool statistics
+func (r *EntityRepository) PoolStats() PoolStats {
+	stats := PoolStats{BufferPools: BufferPoolsStats()}
+	if pool := r.readerPool; pool != nil {
+		stats.ReaderPool = pool.Stats()
+		stats.ReaderPoolHitRatio = stats.ReaderPool.HitRatio()
+	}
+	return stats
+}
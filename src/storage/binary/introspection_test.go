@@ -0,0 +1,53 @@
+package binary
+
+import (
+	"testing"
+	"time"
+
+	"entitydb/cache"
+)
+
+// TestIntrospectionStats checks that the per-shard figures add up to the
+// index totals and that the query cache and buffer pools count their use
+func TestIntrospectionStats(t *testing.T) {
+	tags := NewShardedTagIndex()
+	tags.AddTag("type:user", "e1")
+	tags.AddTag("type:user", "e2")
+	tags.AddTag("status:active", "e1")
+	tags.AddTag("name:alice", "e1")
+
+	var shardTags, postings int
+	var memory int64
+	for _, shard := range tags.ShardStats() {
+		shardTags += shard.Tags
+		postings += shard.Postings
+		memory += shard.MemoryBytes
+	}
+	if shardTags != 3 || postings != tags.GetEntryCount() {
+		t.Errorf("shards hold %d tags and %d postings, want 3 and %d", shardTags, postings, tags.GetEntryCount())
+	}
+	// Nothing is deleted, so the shards hold all of the tracked memory
+	if memory != tags.MemoryBytes() {
+		t.Errorf("shard memory = %d, want %d", memory, tags.MemoryBytes())
+	}
+
+	queries := cache.NewQueryCache(2, time.Minute)
+	queries.Set("a", 1)
+	queries.Set("a", 2)
+	queries.Get("a")
+	queries.Get("missing")
+	queries.Set("b", 3)
+	queries.Set("c", 4)
+	stats := queries.Stats()
+	if stats.Entries != 2 || stats.Hits != 1 || stats.Misses != 1 || stats.Evictions != 1 || stats.HitRate != 0.5 {
+		t.Errorf("query cache stats = %+v, want 2 entries, 1 hit, 1 miss, 1 eviction", stats)
+	}
+
+	pool := NewSafeBufferPool(64)
+	buf := pool.Get()
+	pool.Put(buf)
+	pool.Get()
+	if stats := pool.Stats("test"); stats.Gets != 2 || stats.Puts != 1 || stats.Outstanding != 1 || stats.Allocations < 1 {
+		t.Errorf("buffer pool stats = %+v, want 2 gets, 1 put, 1 outstanding", stats)
+	}
+}
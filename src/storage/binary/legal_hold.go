@@ -0,0 +1,63 @@
+package binary
+
+import (
+	"context"
+	"entitydb/models"
+	"errors"
+	"fmt"
+)
+
+// ErrLegalHold is returned for writes to an entity under legal hold: while
+// it carries models.LegalHoldTag it cannot be updated, tagged or deleted.
+// Writes that place or lift a hold are refused too unless their context
+// comes from WithLegalHoldChange.
+var ErrLegalHold = errors.New("legal hold")
+
+// legalHoldChangeKey is the context key of writes allowed to place or lift
+// a legal hold
+type legalHoldChangeKey struct{}
+
+// WithLegalHoldChange returns a context whose updates may place or lift a
+// legal hold, and may change an entity while it is held. Callers check the
+// entity:legal_hold permission before using it.
+func WithLegalHoldChange(ctx context.Context) context.Context {
+	return context.WithValue(ctx, legalHoldChangeKey{}, true)
+}
+
+// changesLegalHold reports whether writes in ctx may place or lift a hold
+func changesLegalHold(ctx context.Context) bool {
+	allowed, _ := ctx.Value(legalHoldChangeKey{}).(bool)
+	return allowed
+}
+
+// checkLegalHold refuses an update of an entity under legal hold, and an
+// update placing a hold, unless ctx allows hold changes
+func (r *EntityRepository) checkLegalHold(ctx context.Context, entity *models.Entity) error {
+	if changesLegalHold(ctx) {
+		return nil
+	}
+	existing, err := r.GetByIDContext(ctx, entity.ID)
+	if err != nil {
+		// Missing entities are reported by the update itself
+		return nil
+	}
+	if existing.HasTag(models.LegalHoldTag) {
+		return fmt.Errorf("%w: entity %s is held", ErrLegalHold, entity.ID)
+	}
+	if entity.HasTag(models.LegalHoldTag) {
+		return fmt.Errorf("%w: placing a hold on %s needs the entity:legal_hold permission", ErrLegalHold, entity.ID)
+	}
+	return nil
+}
+
+// checkLegalHoldID refuses tagging or deleting an entity under legal hold
+func (r *EntityRepository) checkLegalHoldID(id string) error {
+	existing, err := r.GetByID(id)
+	if err != nil {
+		return nil
+	}
+	if existing.HasTag(models.LegalHoldTag) {
+		return fmt.Errorf("%w: entity %s is held", ErrLegalHold, id)
+	}
+	return nil
+}
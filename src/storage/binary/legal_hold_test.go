@@ -0,0 +1,84 @@
+package binary
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestLegalHold checks that a held entity cannot be changed or deleted, and
+// that holds are only placed and lifted through WithLegalHoldChange
+func TestLegalHold(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	entity := models.NewEntity()
+	entity.AddTag("type:document")
+	if err := repo.Create(entity); err != nil {
+		t.Fatal(err)
+	}
+	withTag := func(tag string) *models.Entity {
+		current, err := repo.GetByID(entity.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		updated := &models.Entity{ID: current.ID, Tags: append([]string(nil), current.Tags...), Content: current.Content}
+		if tag != "" {
+			updated.AddTag(tag)
+		}
+		return updated
+	}
+
+	if err := repo.Update(withTag(models.LegalHoldTag)); !errors.Is(err, ErrLegalHold) {
+		t.Fatalf("placing a hold with Update: err = %v, want ErrLegalHold", err)
+	}
+	if err := repo.AddTag(entity.ID, models.LegalHoldTag); !errors.Is(err, ErrLegalHold) {
+		t.Fatalf("placing a hold with AddTag: err = %v, want ErrLegalHold", err)
+	}
+	if err := repo.UpdateContext(WithLegalHoldChange(context.Background()), withTag(models.LegalHoldTag)); err != nil {
+		t.Fatalf("placing a hold with WithLegalHoldChange: %v", err)
+	}
+
+	if err := repo.Update(withTag("status:changed")); !errors.Is(err, ErrLegalHold) {
+		t.Errorf("Update of a held entity: err = %v, want ErrLegalHold", err)
+	}
+	if err := repo.AddTag(entity.ID, "status:changed"); !errors.Is(err, ErrLegalHold) {
+		t.Errorf("AddTag on a held entity: err = %v, want ErrLegalHold", err)
+	}
+	held, err := repo.GetByID(entity.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hold := held.StoredTags(models.LegalHoldTag)
+	if len(hold) == 0 {
+		t.Fatalf("held entity has no %s tag: %v", models.LegalHoldTag, held.Tags)
+	}
+	if err := repo.RemoveTag(entity.ID, hold[0]); !errors.Is(err, ErrLegalHold) {
+		t.Errorf("RemoveTag of the hold: err = %v, want ErrLegalHold", err)
+	}
+	if err := repo.Delete(entity.ID); !errors.Is(err, ErrLegalHold) {
+		t.Errorf("Delete of a held entity: err = %v, want ErrLegalHold", err)
+	}
+
+	current, err := repo.GetByID(entity.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lifted := &models.Entity{ID: current.ID, Content: current.Content}
+	for _, tag := range current.Tags {
+		if !models.IsLegalHoldTag(tag) {
+			lifted.Tags = append(lifted.Tags, tag)
+		}
+	}
+	if err := repo.UpdateContext(WithLegalHoldChange(context.Background()), lifted); err != nil {
+		t.Fatalf("lifting a hold with WithLegalHoldChange: %v", err)
+	}
+	if err := repo.AddTag(entity.ID, "status:changed"); err != nil {
+		t.Errorf("AddTag after the hold was lifted: %v", err)
+	}
+	if err := repo.Delete(entity.ID); err != nil {
+		t.Errorf("Delete after the hold was lifted: %v", err)
+	}
+}
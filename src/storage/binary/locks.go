@@ -31,17 +31,29 @@ type LockManager struct {
 	compactLock sync.Mutex // Prevents compaction during writes
 	
 	// Statistics
-	stats LockStats
+	stats   LockStats
+	statsMu sync.Mutex // Protects stats
 }
 
 // LockStats tracks locking statistics
 type LockStats struct {
-	mu            sync.Mutex
 	ReadLocks     int64
 	WriteLocks    int64
 	WaitTime      time.Duration
 	HeldTime      time.Duration
-	Contentions   int64
+	Contentions   int64 // Acquisitions that had to wait for another holder
+	
+	HeldEntityLocks    int64 // Entity locks currently held
+	TrackedEntityLocks int64 // Entities with a lock allocated
+}
+
+// AverageWait returns the mean time an acquisition waited for its lock
+func (s LockStats) AverageWait() time.Duration {
+	acquired := s.ReadLocks + s.WriteLocks
+	if acquired == 0 {
+		return 0
+	}
+	return s.WaitTime / time.Duration(acquired)
 }
 
 // NewLockManager creates a new lock manager
@@ -54,20 +66,7 @@ func NewLockManager() *LockManager {
 
 // AcquireFileLock acquires a file-level lock
 func (lm *LockManager) AcquireFileLock(lockType LockType) {
-	start := time.Now()
-	
-	switch lockType {
-	case ReadLock:
-		lm.fileLock.RLock()
-		lm.stats.ReadLocks++
-	case WriteLock:
-		lm.fileLock.Lock()
-		lm.stats.WriteLocks++
-	}
-	
-	lm.stats.mu.Lock()
-	lm.stats.WaitTime += time.Since(start)
-	lm.stats.mu.Unlock()
+	lm.acquire(&lm.fileLock, lockType)
 }
 
 // ReleaseFileLock releases a file-level lock
@@ -90,20 +89,11 @@ func (lm *LockManager) AcquireEntityLock(entityID string, lockType LockType) {
 	}
 	lm.entityMu.Unlock()
 	
-	start := time.Now()
-	
-	switch lockType {
-	case ReadLock:
-		lock.RLock()
-		lm.stats.ReadLocks++
-	case WriteLock:
-		lock.Lock()
-		lm.stats.WriteLocks++
-	}
+	lm.acquire(lock, lockType)
 	
-	lm.stats.mu.Lock()
-	lm.stats.WaitTime += time.Since(start)
-	lm.stats.mu.Unlock()
+	lm.statsMu.Lock()
+	lm.stats.HeldEntityLocks++
+	lm.statsMu.Unlock()
 }
 
 // ReleaseEntityLock releases a lock for a specific entity
@@ -122,6 +112,10 @@ func (lm *LockManager) ReleaseEntityLock(entityID string, lockType LockType) {
 	case WriteLock:
 		lock.Unlock()
 	}
+	
+	lm.statsMu.Lock()
+	lm.stats.HeldEntityLocks--
+	lm.statsMu.Unlock()
 }
 
 // AcquireTagLock acquires a lock for a specific tag
@@ -134,20 +128,39 @@ func (lm *LockManager) AcquireTagLock(tag string, lockType LockType) {
 	}
 	lm.tagMu.Unlock()
 	
+	lm.acquire(lock, lockType)
+}
+
+// acquire takes lock, counting the acquisition, the time spent waiting and
+// whether another holder made it wait
+func (lm *LockManager) acquire(lock *sync.RWMutex, lockType LockType) {
 	start := time.Now()
+	contended := false
 	
 	switch lockType {
 	case ReadLock:
-		lock.RLock()
-		lm.stats.ReadLocks++
+		if !lock.TryRLock() {
+			contended = true
+			lock.RLock()
+		}
 	case WriteLock:
-		lock.Lock()
-		lm.stats.WriteLocks++
+		if !lock.TryLock() {
+			contended = true
+			lock.Lock()
+		}
 	}
 	
-	lm.stats.mu.Lock()
+	lm.statsMu.Lock()
+	if lockType == WriteLock {
+		lm.stats.WriteLocks++
+	} else {
+		lm.stats.ReadLocks++
+	}
+	if contended {
+		lm.stats.Contentions++
+	}
 	lm.stats.WaitTime += time.Since(start)
-	lm.stats.mu.Unlock()
+	lm.statsMu.Unlock()
 }
 
 // ReleaseTagLock releases a lock for a specific tag
@@ -180,17 +193,15 @@ func (lm *LockManager) ReleaseWriteLock() {
 
 // GetStats returns locking statistics
 func (lm *LockManager) GetStats() LockStats {
-	lm.stats.mu.Lock()
-	defer lm.stats.mu.Unlock()
-	// Return a copy without the mutex to avoid copying lock value
-	return LockStats{
-		mu:          sync.Mutex{}, // fresh mutex
-		ReadLocks:   lm.stats.ReadLocks,
-		WriteLocks:  lm.stats.WriteLocks,
-		WaitTime:    lm.stats.WaitTime,
-		HeldTime:    lm.stats.HeldTime,
-		Contentions: lm.stats.Contentions,
-	}
+	lm.entityMu.Lock()
+	tracked := int64(len(lm.entityLocks))
+	lm.entityMu.Unlock()
+	
+	lm.statsMu.Lock()
+	defer lm.statsMu.Unlock()
+	stats := lm.stats
+	stats.TrackedEntityLocks = tracked
+	return stats
 }
 
 // CleanupOldLocks removes locks for entities that haven't been accessed recently
@@ -112,6 +112,65 @@ func TestBoundedEntityCache(t *testing.T) {
 		newStats.Size, newStats.MemoryUsed, newStats.HitRate*100)
 }
 
+// TestBoundedEntityCacheDirtyPinning tests that unpersisted entities survive eviction
+func TestBoundedEntityCacheDirtyPinning(t *testing.T) {
+	cache := NewBoundedEntityCache(5, 50*1024*1024)
+
+	cache.PutDirty("dirty", &models.Entity{ID: "dirty", Content: []byte("unpersisted")})
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("entity-%d", i)
+		cache.Put(id, &models.Entity{ID: id})
+	}
+	cache.TriggerPressureCleanup(1.0)
+
+	if _, found := cache.Get("dirty"); !found {
+		t.Fatal("Dirty entity was evicted before being persisted")
+	}
+
+	// Once persisted, the entity is evictable again
+	cache.ClearDirty()
+	for i := 20; i < 40; i++ {
+		id := fmt.Sprintf("entity-%d", i)
+		cache.Put(id, &models.Entity{ID: id})
+	}
+	if _, found := cache.Get("dirty"); found {
+		t.Error("Entity still pinned after ClearDirty")
+	}
+}
+
+// TestBoundedEntityCachePinning tests tag and explicit pins
+func TestBoundedEntityCachePinning(t *testing.T) {
+	cache := NewBoundedEntityCache(5, 50*1024*1024)
+	cache.SetPinTags([]string{"cache:pinned"})
+
+	cache.Put("tagged", &models.Entity{ID: "tagged", Tags: []string{"1700000000000000000|cache:pinned"}})
+	cache.Pin("explicit")
+	cache.Put("explicit", &models.Entity{ID: "explicit"})
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("entity-%d", i)
+		cache.Put(id, &models.Entity{ID: id})
+	}
+	cache.TriggerPressureCleanup(1.0)
+
+	for _, id := range []string{"tagged", "explicit"} {
+		if _, found := cache.Get(id); !found {
+			t.Errorf("Pinned entity %s was evicted", id)
+		}
+	}
+	if stats := cache.PinnedStats(); stats.Entities != 2 {
+		t.Errorf("Expected 2 pinned entities, got %d", stats.Entities)
+	}
+
+	cache.Unpin("explicit")
+	for i := 20; i < 40; i++ {
+		id := fmt.Sprintf("entity-%d", i)
+		cache.Put(id, &models.Entity{ID: id})
+	}
+	if _, found := cache.Get("explicit"); found {
+		t.Error("Entity still pinned after Unpin")
+	}
+}
+
 // TestMetricsRecursionPrevention tests that metrics collection doesn't cause recursion
 func TestMetricsRecursionPrevention(t *testing.T) {
 	// Setup
@@ -1,278 +1,290 @@
 package binary
 
 import (
-	"entitydb/models"
+	"bytes"
+	"context"
+	"encoding/binary"
 	"entitydb/logger"
-	"encoding/json"
+	"entitydb/models"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
 	"syscall"
-	"unsafe"
-	"encoding/binary"
-	"bytes"
 )
 
-// MMapReader provides zero-copy reads using memory-mapped files
+// indexEntrySize is the encoded size of an IndexEntry
+const indexEntrySize = 112
+
+// errMMapClosed is returned by an MMapReader that was closed, typically
+// because the data file changed and the mapping was replaced. Callers fall
+// back to file reads.
+var errMMapClosed = errors.New("memory-mapped reader closed")
+
+// mappedEntry locates an entity record in the mapping
+type mappedEntry struct {
+	offset uint64
+	size   uint32
+}
+
+// MMapReader reads entities straight from a read-only memory mapping of the
+// data file. Lookups need no file descriptor, seek or read call, and records
+// are decoded in place: tags resolve through the dictionary and content is
+// copied out only when it is decoded, so GetEntityTags never reads the
+// content data.
+//
+// The mapping covers the file as it was when the reader was created, like
+// the index and dictionary loaded with it. Entities written later need a new
+// reader; ReaderPool replaces its mapping whenever it is invalidated.
+//
+// An MMapReader is safe for concurrent use. Close waits for reads in progress
+// before unmapping, and reads after Close return errMMapClosed.
 type MMapReader struct {
-	file     *os.File
-	data     []byte
-	size     int64
-	header   *Header
-	index    map[string]*IndexEntry
-	indexMu  sync.RWMutex
+	file    *os.File
+	data    []byte
+	header  *Header
+	tagDict *TagDictionary
+	index   map[string]mappedEntry // not modified after NewMMapReader
+
+	mu     sync.RWMutex // held shared while mapped bytes are read
+	closed bool
 }
 
-// NewMMapReader creates a new memory-mapped reader
+// NewMMapReader maps a data file and loads its header, tag dictionary and
+// entity index from the mapping
 func NewMMapReader(filename string) (*MMapReader, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error opening file: %w", err)
 	}
-	
+
 	stat, err := file.Stat()
 	if err != nil {
 		file.Close()
 		return nil, fmt.Errorf("error getting file stats: %w", err)
 	}
-	
-	size := stat.Size()
-	if size == 0 {
+	if stat.Size() < HeaderSize {
 		file.Close()
-		return nil, fmt.Errorf("file is empty")
+		return nil, fmt.Errorf("file of %d bytes is too small to map", stat.Size())
 	}
-	
-	// Memory-map the file with private mapping to prevent external corruption
-	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_PRIVATE)
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
 	if err != nil {
 		file.Close()
 		return nil, fmt.Errorf("error mapping file: %w", err)
 	}
-	
+
 	reader := &MMapReader{
-		file: file,
-		data: data,
-		size: size,
-		index: make(map[string]*IndexEntry),
+		file:    file,
+		data:    data,
+		header:  &Header{},
+		tagDict: NewTagDictionary(),
 	}
-	
-	// Read header
-	if err := reader.readHeader(); err != nil {
+	if err := reader.header.Read(bytes.NewReader(data[:HeaderSize])); err != nil {
 		reader.Close()
-		return nil, err
+		return nil, fmt.Errorf("error reading header: %w", err)
 	}
-	
-	// Build index
-	if err := reader.buildIndex(); err != nil {
+	if reader.header.Magic != MagicNumber || !supportedFormatVersion(reader.header.Version) {
 		reader.Close()
-		return nil, err
+		return nil, fmt.Errorf("unsupported file format (magic %x, version %d)", reader.header.Magic, reader.header.Version)
 	}
-	
+
+	reader.loadTagDictionary()
+	reader.buildIndex()
+	logger.Debug("Mapped %s: %d bytes, %d entities", filename, len(data), len(reader.index))
 	return reader, nil
 }
 
-// readHeader reads the file header from memory-mapped data
-func (r *MMapReader) readHeader() error {
-	if len(r.data) < 64 {
-		return fmt.Errorf("file too small for header")
+// section returns the mapped bytes of a file section, or nil when the
+// section lies outside the mapping
+func (r *MMapReader) section(offset, size uint64) []byte {
+	if offset == 0 || offset > uint64(len(r.data)) || size > uint64(len(r.data))-offset {
+		return nil
+	}
+	return r.data[offset : offset+size]
+}
+
+// loadTagDictionary decodes the tag dictionary. Like Reader, a damaged
+// dictionary is logged and the entries decoded so far are kept.
+func (r *MMapReader) loadTagDictionary() {
+	if r.header.EntityCount == 0 || r.header.TagDictSize == 0 {
+		return
+	}
+	dict := r.section(r.header.TagDictOffset, r.header.TagDictSize)
+	if dict == nil {
+		logger.Warn("Tag dictionary at offset %d (%d bytes) lies outside the mapped file", r.header.TagDictOffset, r.header.TagDictSize)
+		return
 	}
-	
-	// Direct cast to header struct (zero-copy)
-	r.header = (*Header)(unsafe.Pointer(&r.data[0]))
-	
-	// Validate magic number
-	if r.header.Magic != MagicNumber {
-		return fmt.Errorf("invalid magic number")
+	if err := r.tagDict.Read(bytes.NewReader(dict)); err != nil {
+		logger.Warn("Failed to read tag dictionary: %v", err)
 	}
-	
-	return nil
 }
 
-// buildIndex builds the entity index from memory-mapped data
-func (r *MMapReader) buildIndex() error {
-	if r.header.EntityIndexOffset == 0 || r.header.EntityCount == 0 {
-		return nil // No entities
+// buildIndex decodes the entity index, skipping entries that are empty or
+// point outside the mapping. An index cut short by a concurrent write is
+// read as far as it goes.
+func (r *MMapReader) buildIndex() {
+	r.index = make(map[string]mappedEntry, r.header.EntityCount)
+	if r.header.EntityCount == 0 || r.header.EntityIndexOffset == 0 || r.header.EntityIndexOffset > uint64(len(r.data)) {
+		return
 	}
-	
-	offset := r.header.EntityIndexOffset
-	
-	for i := uint64(0); i < r.header.EntityCount; i++ {
-		if offset+52 > uint64(r.size) {
-			return fmt.Errorf("index entry %d exceeds file size", i)
-		}
-		
-		// Direct memory access
-		tempEntry := &IndexEntry{
-			Offset: *(*uint64)(unsafe.Pointer(&r.data[offset+36])),
-			Size:   *(*uint32)(unsafe.Pointer(&r.data[offset+44])),
-			Flags:  *(*uint32)(unsafe.Pointer(&r.data[offset+48])),
+
+	count := r.header.EntityCount
+	if available := (uint64(len(r.data)) - r.header.EntityIndexOffset) / indexEntrySize; available < count {
+		logger.Debug("Mapped index holds %d of %d entries (concurrent write in progress)", available, count)
+		count = available
+	}
+
+	skipped := 0
+	pos := r.header.EntityIndexOffset
+	for i := uint64(0); i < count; i, pos = i+1, pos+indexEntrySize {
+		raw := r.data[pos : pos+indexEntrySize]
+		id := string(bytes.TrimRight(raw[:96], "\x00"))
+		entry := mappedEntry{
+			offset: binary.LittleEndian.Uint64(raw[96:104]),
+			size:   binary.LittleEndian.Uint32(raw[104:108]),
 		}
-		
-		// Extract entity ID
-		entityID := string(r.data[offset:offset+36])
-		
-		// RACE CONDITION FIX: Create a defensive copy of IndexEntry to prevent concurrent access corruption
-		// Unsafe pointer operations can create shared memory access patterns causing corruption
-		indexEntry := &IndexEntry{
-			Offset: tempEntry.Offset,
-			Size:   tempEntry.Size,
-			Flags:  tempEntry.Flags,
+		if id == "" || entry.size == 0 || r.section(entry.offset, uint64(entry.size)) == nil {
+			skipped++
+			continue
 		}
-		// Copy EntityID from the extracted string
-		copy(indexEntry.EntityID[:], []byte(entityID))
-		r.index[entityID] = indexEntry
-		
-		offset += 52
+		r.index[id] = entry
+	}
+	if skipped > 0 {
+		logger.Debug("Skipped %d empty or out of range index entries while mapping", skipped)
 	}
-	
-	return nil
 }
 
-// GetEntity retrieves an entity by ID with zero-copy
-func (r *MMapReader) GetEntity(id string) (*models.Entity, error) {
-	r.indexMu.RLock()
-	entry, exists := r.index[id]
-	if !exists {
-		r.indexMu.RUnlock()
-		return nil, fmt.Errorf("entity not found: %s", id)
-	}
-	
-	// RACE CONDITION FIX: Create defensive copy of IndexEntry to prevent shared pointer access
-	entryCopy := &IndexEntry{
-		Offset: entry.Offset,
-		Size:   entry.Size,
-		Flags:  entry.Flags,
+// record returns the mapped bytes of an entity record. Callers hold r.mu.
+func (r *MMapReader) record(id string) ([]byte, error) {
+	if r.closed {
+		return nil, errMMapClosed
 	}
-	copy(entryCopy.EntityID[:], entry.EntityID[:])
-	r.indexMu.RUnlock()
-	
-	// Use entryCopy instead of entry for safe access
-	entry = entryCopy
-	
-	if entry.Offset+uint64(entry.Size) > uint64(r.size) {
-		return nil, fmt.Errorf("entity data exceeds file size")
+	entry, ok := r.index[id]
+	if !ok {
+		return nil, ErrNotFound
 	}
-	
-	// Direct deserialize from memory-mapped data
-	// The data includes an entity header before the actual entity data
-	data := r.data[entry.Offset:entry.Offset+uint64(entry.Size)]
-	
-	// Parse entity header (8 bytes)
-	if len(data) < 8 {
-		return nil, fmt.Errorf("entity data too small for header")
-	}
-	
-	reader := bytes.NewReader(data)
-	
-	// Read entity header
-	var entityHeader EntityHeader
-	if err := binary.Read(reader, binary.LittleEndian, &entityHeader.Modified); err != nil {
+	return r.data[entry.offset : entry.offset+uint64(entry.size)], nil
+}
+
+// GetEntity decodes an entity from the mapping
+func (r *MMapReader) GetEntity(id string) (*models.Entity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data, err := r.record(id)
+	if err != nil {
 		return nil, err
 	}
-	if err := binary.Read(reader, binary.LittleEndian, &entityHeader.TagCount); err != nil {
+	return decodeEntityRecord(data, id, r.tagDict)
+}
+
+// GetEntityTags returns the tags of an entity, as GetEntity would, without
+// decoding or copying its content
+func (r *MMapReader) GetEntityTags(id string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data, err := r.record(id)
+	if err != nil {
 		return nil, err
 	}
-	if err := binary.Read(reader, binary.LittleEndian, &entityHeader.ContentCount); err != nil {
+	entity, err := decodeEntityRecordTags(data, id, r.tagDict)
+	if err != nil {
 		return nil, err
 	}
-	if err := binary.Read(reader, binary.LittleEndian, &entityHeader.Reserved); err != nil {
+	return entity.Tags, nil
+}
+
+// GetEntityWithoutContent decodes an entity from the mapping without its
+// content, leaving the pages holding the content untouched
+func (r *MMapReader) GetEntityWithoutContent(id string) (*models.Entity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data, err := r.record(id)
+	if err != nil {
 		return nil, err
 	}
-	
-	// Now deserialize the rest of the entity data
-	entity := &models.Entity{ID: id}
-	
-	// Read tags
-	entity.Tags = make([]string, entityHeader.TagCount)
-	for i := uint16(0); i < entityHeader.TagCount; i++ {
-		var tagID uint32
-		if err := binary.Read(reader, binary.LittleEndian, &tagID); err != nil {
-			return nil, err
-		}
-		// For now, we'll just use the tag ID as the tag string
-		// In a real implementation, we'd look up the tag in the dictionary
-		entity.Tags[i] = fmt.Sprintf("tag:%d", tagID)
-	}
-	
-	// Read content items (old format - convert to new format)
-	contentData := make(map[string]string)
-	for i := uint16(0); i < entityHeader.ContentCount; i++ {
-		// Type
-		var typeLen uint16
-		if err := binary.Read(reader, binary.LittleEndian, &typeLen); err != nil {
-			return nil, err
-		}
-		typeBytes := make([]byte, typeLen)
-		if _, err := reader.Read(typeBytes); err != nil {
-			return nil, err
-		}
-		
-		// Value
-		var valueLen uint32
-		if err := binary.Read(reader, binary.LittleEndian, &valueLen); err != nil {
-			return nil, err
-		}
-		valueBytes := make([]byte, valueLen)
-		if _, err := reader.Read(valueBytes); err != nil {
-			return nil, err
-		}
-		
-		// Timestamp
-		var tsNano int64
-		if err := binary.Read(reader, binary.LittleEndian, &tsNano); err != nil {
-			return nil, err
-		}
-		
-		// Add to content data map
-		contentData[string(typeBytes)] = string(valueBytes)
-		entity.AddTag("content:type:" + string(typeBytes))
-	}
-	
-	// Convert content data to JSON
-	if len(contentData) > 0 {
-		jsonData, _ := json.Marshal(contentData)
-		entity.Content = jsonData
+	return decodeEntityRecordTags(data, id, r.tagDict)
+}
+
+// HasEntity reports whether the mapped index holds an entity
+func (r *MMapReader) HasEntity(id string) bool {
+	_, ok := r.index[id]
+	return ok
+}
+
+// EntityIDs returns the IDs of all entities in the mapped index
+func (r *MMapReader) EntityIDs() []string {
+	ids := make([]string, 0, len(r.index))
+	for id := range r.index {
+		ids = append(ids, id)
 	}
-	
-	return entity, nil
+	return ids
 }
 
-// GetAllEntities reads all entities with zero-copy
+// GetAllEntities decodes every entity in the mapping. Unreadable entities
+// are logged and skipped, as by Reader.GetAllEntities.
 func (r *MMapReader) GetAllEntities() ([]*models.Entity, error) {
-	r.indexMu.RLock()
-	defer r.indexMu.RUnlock()
-	
+	return r.GetAllEntitiesContext(context.Background())
+}
+
+// GetAllEntitiesContext decodes every entity like GetAllEntities, stopping
+// with the context's error once ctx is cancelled
+func (r *MMapReader) GetAllEntitiesContext(ctx context.Context) ([]*models.Entity, error) {
+	return r.getAllEntities(ctx, decodeEntityRecord)
+}
+
+// GetAllEntitiesWithoutContent decodes every entity like
+// GetAllEntitiesContext, without content
+func (r *MMapReader) GetAllEntitiesWithoutContent(ctx context.Context) ([]*models.Entity, error) {
+	return r.getAllEntities(ctx, decodeEntityRecordTags)
+}
+
+// getAllEntities decodes every record in the mapping with decode
+func (r *MMapReader) getAllEntities(ctx context.Context, decode func([]byte, string, *TagDictionary) (*models.Entity, error)) ([]*models.Entity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return nil, errMMapClosed
+	}
 	entities := make([]*models.Entity, 0, len(r.index))
-	
 	for id, entry := range r.index {
-		if entry.Offset+uint64(entry.Size) > uint64(r.size) {
-			logger.Error("Entity %s data exceeds file size", id)
-			continue
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		
-		entity, err := r.GetEntity(id)
+		entity, err := decode(r.data[entry.offset:entry.offset+uint64(entry.size)], id, r.tagDict)
 		if err != nil {
-			logger.Error("Failed to deserialize entity %s: %v", id, err)
+			logger.Warn("Error getting entity %s: %v", id, err)
 			continue
 		}
-		
 		entities = append(entities, entity)
 	}
-	
 	return entities, nil
 }
 
-// Close unmaps the file and closes it
+// Close waits for reads in progress, then unmaps and closes the file. It is
+// safe to call more than once.
 func (r *MMapReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	var err error
 	if r.data != nil {
-		if err := syscall.Munmap(r.data); err != nil {
-			return fmt.Errorf("error unmapping file: %w", err)
+		if unmapErr := syscall.Munmap(r.data); unmapErr != nil {
+			err = fmt.Errorf("error unmapping file: %w", unmapErr)
 		}
+		r.data = nil
 	}
-	
-	if r.file != nil {
-		return r.file.Close()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
 	}
-	
-	return nil
-}
\ No newline at end of file
+	return err
+}
@@ -0,0 +1,276 @@
+package binary
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"entitydb/config"
+	"entitydb/models"
+)
+
+// writeTestEntities writes entities to a new data file and returns its path
+func writeTestEntities(tb testing.TB, entities []*models.Entity) string {
+	tb.Helper()
+	cfg := config.Load()
+	cfg.DataPath = tb.TempDir()
+	path := filepath.Join(cfg.DataPath, "entities.edb")
+	appendTestEntities(tb, path, entities)
+	return path
+}
+
+// appendTestEntities writes entities to an existing or new data file
+func appendTestEntities(tb testing.TB, path string, entities []*models.Entity) {
+	tb.Helper()
+	cfg := config.Load()
+	cfg.DataPath = filepath.Dir(path)
+	writer, err := NewWriter(path, cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, entity := range entities {
+		if err := writer.WriteEntity(entity); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// readPathEntities returns entities with small, large (compressed) and no
+// content
+func readPathEntities(n int) []*models.Entity {
+	entities := make([]*models.Entity, n)
+	for i := range entities {
+		entity := &models.Entity{
+			ID:   fmt.Sprintf("entity-%04d", i),
+			Tags: []string{"1|type:document", fmt.Sprintf("2|name:doc-%d", i), "3|status:draft"},
+		}
+		switch i % 3 {
+		case 0:
+			entity.Content = []byte(fmt.Sprintf(`{"index":%d}`, i))
+		case 1:
+			entity.Content = bytes.Repeat([]byte(fmt.Sprintf("section %d of a long document; ", i)), 200)
+		}
+		entities[i] = entity
+	}
+	return entities
+}
+
+// TestMMapReaderMatchesReader checks that the mapped read path decodes the
+// same entities as file reads
+func TestMMapReaderMatchesReader(t *testing.T) {
+	path := writeTestEntities(t, readPathEntities(30))
+
+	reader, err := NewReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	mapped, err := NewMMapReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+
+	ids := reader.EntityIDs()
+	if len(ids) != 30 || len(mapped.EntityIDs()) != 30 {
+		t.Fatalf("indexed %d entities by file and %d by mapping, want 30", len(ids), len(mapped.EntityIDs()))
+	}
+	for _, id := range ids {
+		want, err := reader.GetEntity(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := mapped.GetEntity(id)
+		if err != nil {
+			t.Fatalf("mapped GetEntity(%s): %v", id, err)
+		}
+		// Content type tags added on read carry the current time
+		if !bytes.Equal(got.Content, want.Content) || len(got.Tags) != len(want.Tags) ||
+			!reflect.DeepEqual(got.Tags[:3], want.Tags[:3]) {
+			t.Errorf("mapped %s = %q %v, want %q %v", id, got.Content, got.Tags, want.Content, want.Tags)
+		}
+		tags, err := mapped.GetEntityTags(id)
+		if err != nil || len(tags) != len(want.Tags) {
+			t.Errorf("GetEntityTags(%s) = %v, %v; want %d tags", id, tags, err, len(want.Tags))
+		}
+	}
+
+	all, err := mapped.GetAllEntities()
+	if err != nil || len(all) != 30 {
+		t.Errorf("mapped GetAllEntities returned %d entities, %v; want 30", len(all), err)
+	}
+	if _, err := mapped.GetEntity("missing"); err != ErrNotFound {
+		t.Errorf("GetEntity of a missing entity = %v, want ErrNotFound", err)
+	}
+
+	mapped.Close()
+	if _, err := mapped.GetEntity(ids[0]); err != errMMapClosed {
+		t.Errorf("GetEntity after Close = %v, want errMMapClosed", err)
+	}
+}
+
+// TestReaderPoolMapping checks that invalidating the pool replaces its
+// mapping so entities written since are found
+func TestReaderPoolMapping(t *testing.T) {
+	path := writeTestEntities(t, readPathEntities(3))
+	pool, err := NewReaderPool(path, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := pool.Mapped()
+	if first == nil || !first.HasEntity("entity-0002") {
+		t.Fatal("pool did not map the data file")
+	}
+	if pool.Mapped() != first {
+		t.Error("pool mapped the file again without invalidation")
+	}
+
+	appendTestEntities(t, path, []*models.Entity{{ID: "entity-late", Tags: []string{"1|type:document"}}})
+	if _, err := first.GetEntity("entity-late"); err != ErrNotFound {
+		t.Errorf("old mapping found an entity written after it, err = %v", err)
+	}
+	if err := pool.Invalidate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.GetEntity("entity-0000"); err != errMMapClosed {
+		t.Errorf("replaced mapping read = %v, want errMMapClosed", err)
+	}
+	ids := pool.Mapped().EntityIDs()
+	sort.Strings(ids)
+	if len(ids) != 4 || ids[3] != "entity-late" {
+		t.Errorf("mapping after invalidation holds %v, want the late entity", ids)
+	}
+
+	pool.Close()
+	if pool.Mapped() != nil {
+		t.Error("closed pool mapped the file again")
+	}
+}
+
+// TestReaderPoolGenerations checks that advancing the generation leaves
+// pooled readers open until they are borrowed, and that a stale reader or
+// mapping is then replaced by one that sees the entities written since
+func TestReaderPoolGenerations(t *testing.T) {
+	path := writeTestEntities(t, readPathEntities(3))
+	pool, err := NewReaderPool(path, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	first := pool.Mapped()
+
+	appendTestEntities(t, path, []*models.Entity{{ID: "entity-late", Tags: []string{"1|type:document"}}})
+	pool.Advance()
+	if stats := pool.Stats(); stats.Open != 2 || stats.Available != 2 || stats.Refreshed != 0 {
+		t.Errorf("stats after Advance = %+v, want both readers still open and idle", stats)
+	}
+
+	reader, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.GetEntity("entity-late"); err != nil {
+		t.Errorf("borrowed reader after Advance: %v", err)
+	}
+	pool.Put(reader)
+	if stats := pool.Stats(); stats.Open != 2 || stats.Refreshed != 1 {
+		t.Errorf("stats after borrowing = %+v, want 2 open readers and 1 refreshed", stats)
+	}
+
+	// The refreshed reader is current and is not reopened again
+	for i := 0; i < 4; i++ {
+		reader, err := pool.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Put(reader)
+	}
+	if stats := pool.Stats(); stats.Refreshed != 2 {
+		t.Errorf("refreshed = %d after borrowing both readers, want 2", stats.Refreshed)
+	}
+
+	if first != nil {
+		mapped := pool.Mapped()
+		if mapped == first || mapped == nil || !mapped.HasEntity("entity-late") {
+			t.Error("mapping was not replaced after Advance")
+		}
+		if pool.Mapped() != mapped {
+			t.Error("pool mapped the file again within a generation")
+		}
+	}
+}
+
+// BenchmarkReadPath compares reads of single entities and of all entities
+// through the memory mapping and through pooled file readers
+func BenchmarkReadPath(b *testing.B) {
+	const count = 2000
+	path := writeTestEntities(b, readPathEntities(count))
+	pool, err := NewReaderPool(path, 4, 8)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pool.Close()
+	mapped := pool.Mapped()
+	if mapped == nil {
+		b.Skip("data file cannot be mapped")
+	}
+	ids := mapped.EntityIDs()
+
+	b.Run("GetEntity/file", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				reader, err := pool.Get()
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, err = reader.GetEntity(ids[i%count])
+				pool.Put(reader)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+	b.Run("GetEntity/mmap", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if _, err := pool.Mapped().GetEntity(ids[i%count]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+	b.Run("GetEntityTags/mmap", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if _, err := pool.Mapped().GetEntityTags(ids[i%count]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+	b.Run("List/file", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := pool.WithReader(func(reader *Reader) error {
+				_, err := reader.GetAllEntities()
+				return err
+			}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("List/mmap", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := pool.Mapped().GetAllEntities(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -10,6 +10,7 @@ type NamespaceIndex struct {
 	mu        sync.RWMutex
 	index     map[string]map[string][]string // namespace -> tag -> entityIDs
 	entityMap map[string]map[string]string   // entityID -> namespace -> latest value
+	memBytes  int64                          // approximate bytes held by both maps
 }
 
 // NewNamespaceIndex creates a new namespace index
@@ -50,18 +51,32 @@ func (ni *NamespaceIndex) AddTag(entityID string, tag string) {
 	// Initialize namespace map if needed
 	if ni.index[namespace] == nil {
 		ni.index[namespace] = make(map[string][]string)
+		ni.memBytes += mapEntryBytes + stringBytes(namespace) + mapHeaderBytes
 	}
 	
 	// Initialize entity namespace map if needed
 	if ni.entityMap[entityID] == nil {
 		ni.entityMap[entityID] = make(map[string]string)
+		ni.memBytes += mapEntryBytes + stringBytes(entityID) + mapHeaderBytes
 	}
 	
 	// Add to index
 	fullTag := namespace + ":" + value
-	ni.index[namespace][fullTag] = appendUnique(ni.index[namespace][fullTag], entityID)
+	entities, exists := ni.index[namespace][fullTag]
+	if !exists {
+		ni.memBytes += mapEntryBytes + stringBytes(fullTag) + sliceHeaderBytes
+	}
+	ni.index[namespace][fullTag] = appendUnique(entities, entityID)
+	if len(ni.index[namespace][fullTag]) > len(entities) {
+		ni.memBytes += stringBytes(entityID)
+	}
 	
 	// Update entity map with latest value for this namespace
+	if previous, exists := ni.entityMap[entityID][namespace]; exists {
+		ni.memBytes += int64(len(value) - len(previous))
+	} else {
+		ni.memBytes += mapEntryBytes + stringBytes(namespace) + stringBytes(value)
+	}
 	ni.entityMap[entityID][namespace] = value
 }
 
@@ -87,17 +102,28 @@ func (ni *NamespaceIndex) RemoveEntity(entityID string) {
 						filtered = append(filtered, id)
 					}
 				}
+				ni.memBytes -= int64(len(entities)-len(filtered)) * stringBytes(entityID)
 				if len(filtered) == 0 {
 					delete(tags, fullTag)
+					ni.memBytes -= mapEntryBytes + stringBytes(fullTag) + sliceHeaderBytes
 				} else {
 					tags[fullTag] = filtered
 				}
 			}
 		}
+		ni.memBytes -= mapEntryBytes + stringBytes(namespace) + stringBytes(value)
 	}
 	
 	// Remove from entity map
 	delete(ni.entityMap, entityID)
+	ni.memBytes -= mapEntryBytes + stringBytes(entityID) + mapHeaderBytes
+}
+
+// MemoryBytes returns the approximate bytes held by the index
+func (ni *NamespaceIndex) MemoryBytes() int64 {
+	ni.mu.RLock()
+	defer ni.mu.RUnlock()
+	return ni.memBytes
 }
 
 // GetByNamespace returns all entities with tags in a namespace
@@ -125,6 +151,13 @@ func (ni *NamespaceIndex) GetByNamespace(namespace string) []string {
 	return result
 }
 
+// EntityCount returns the number of entities in the index
+func (ni *NamespaceIndex) EntityCount() int {
+	ni.mu.RLock()
+	defer ni.mu.RUnlock()
+	return len(ni.entityMap)
+}
+
 // GetByNamespaceValue returns entities with a specific namespace:value
 func (ni *NamespaceIndex) GetByNamespaceValue(namespace, value string) []string {
 	ni.mu.RLock()
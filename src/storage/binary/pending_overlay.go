@@ -0,0 +1,112 @@
+package binary
+
+import (
+	"entitydb/models"
+	"sync"
+)
+
+// PendingOverlay holds the latest version of entities whose writes are logged
+// but still queued in the batch writer, so they are in neither the indexes,
+// the entity cache nor the data file yet. GetByID consults it before anything
+// else and ListByTag merges it into its results, which lets clients read
+// their own writes without forcing a checkpoint.
+//
+// Entries are released once the batch that contains them has been applied.
+type PendingOverlay struct {
+	mu       sync.RWMutex
+	entities map[string]*models.Entity
+}
+
+// NewPendingOverlay creates an empty overlay
+func NewPendingOverlay() *PendingOverlay {
+	return &PendingOverlay{entities: make(map[string]*models.Entity)}
+}
+
+// Put makes entity the visible version for its ID
+func (o *PendingOverlay) Put(entity *models.Entity) {
+	o.mu.Lock()
+	o.entities[entity.ID] = entity
+	o.mu.Unlock()
+}
+
+// Get returns the pending version of an entity
+func (o *PendingOverlay) Get(id string) (*models.Entity, bool) {
+	o.mu.RLock()
+	entity, exists := o.entities[id]
+	o.mu.RUnlock()
+	return entity, exists
+}
+
+// Release removes the pending version of an entity once it has been applied.
+// A newer version put after entity was captured stays visible.
+func (o *PendingOverlay) Release(entity *models.Entity) {
+	o.mu.Lock()
+	if o.entities[entity.ID] == entity {
+		delete(o.entities, entity.ID)
+	}
+	o.mu.Unlock()
+}
+
+// applyToTagResult makes a tag lookup reflect queued writes: entities with
+// a pending version are replaced by it, or dropped when it lost the tag, and
+// pending entities gaining the tag are added
+func (o *PendingOverlay) applyToTagResult(tag string, entities []*models.Entity) []*models.Entity {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if len(o.entities) == 0 {
+		return entities
+	}
+
+	result := make([]*models.Entity, 0, len(entities))
+	seen := make(map[string]bool, len(entities))
+	for _, entity := range entities {
+		seen[entity.ID] = true
+		if pending, exists := o.entities[entity.ID]; exists {
+			if pending.HasTag(tag) {
+				result = append(result, pending)
+			}
+			continue
+		}
+		result = append(result, entity)
+	}
+	for id, pending := range o.entities {
+		if !seen[id] && pending.HasTag(tag) {
+			result = append(result, pending)
+		}
+	}
+	return result
+}
+
+// applyToEdges makes an edge lookup reflect queued writes: edges declared by
+// entities with a pending version are replaced by the ones that version
+// declares
+func (o *PendingOverlay) applyToEdges(entityID string, direction models.EdgeDirection, relType string, edges []models.Edge) []models.Edge {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if len(o.entities) == 0 {
+		return edges
+	}
+
+	result := make([]models.Edge, 0, len(edges))
+	for _, edge := range edges {
+		if _, pending := o.entities[edge.Source]; !pending {
+			result = append(result, edge)
+		}
+	}
+	for _, pending := range o.entities {
+		for _, edge := range models.EntityEdges(pending) {
+			if edge.Matches(entityID, direction, relType) {
+				result = append(result, edge)
+			}
+		}
+	}
+	sortEdges(result)
+	return result
+}
+
+// Len returns the number of pending entities
+func (o *PendingOverlay) Len() int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return len(o.entities)
+}
@@ -0,0 +1,135 @@
+package binary
+
+import (
+	"entitydb/config"
+	"entitydb/models"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestBatchWriterPendingOverlay tests that queued writes are readable
+func TestBatchWriterPendingOverlay(t *testing.T) {
+	repo := &EntityRepository{entityCache: NewBoundedEntityCache(10, 1024*1024)}
+	bw := NewBatchWriter(repo, 100, time.Hour)
+
+	created := &models.Entity{ID: "e1", Tags: []string{"1|type:test"}}
+	bw.AddCreate(created)
+	if entity, pending := bw.Pending("e1"); !pending || entity != created {
+		t.Fatal("Queued create is not visible")
+	}
+
+	bw.AddTag("e1", "2|status:new", nil)
+	entity, _ := bw.Pending("e1")
+	if len(entity.Tags) != 2 || entity.Tags[1] != "2|status:new" {
+		t.Errorf("Queued tag is not visible: %v", entity.Tags)
+	}
+	if len(created.Tags) != 1 {
+		t.Errorf("Queued tag was applied to the pending create: %v", created.Tags)
+	}
+
+	// Releasing a superseded version keeps the newer one visible
+	bw.overlay.Release(created)
+	if _, pending := bw.Pending("e1"); !pending {
+		t.Error("Release dropped a newer pending version")
+	}
+	bw.overlay.Release(entity)
+	if _, pending := bw.Pending("e1"); pending {
+		t.Error("Released entity is still pending")
+	}
+}
+
+// queuedRepository returns a repository whose writes stay queued until the
+// test flushes them
+func queuedRepository(t *testing.T) *EntityRepository {
+	return newTestRepository(t, func(cfg *config.Config) {
+		cfg.BatchWrites = true
+		cfg.BatchWriteSize = 1000
+		cfg.BatchFlushInterval = time.Hour
+		cfg.DurabilityMode = "relaxed"
+	})
+}
+
+// TestQueuedTagOnUncachedEntity checks that a tag queued for an entity that
+// is neither pending nor cached, such as one evicted after AddTag read it, is
+// visible before the batch runs and is kept when it does
+func TestQueuedTagOnUncachedEntity(t *testing.T) {
+	repo := queuedRepository(t)
+	defer repo.Close()
+
+	if err := repo.Create(&models.Entity{ID: "cold", Tags: []string{"type:document", "dataset:default"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	flushWrites(t, repo)
+	stored, err := repo.GetByID("cold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.entityCache.Delete("cold")
+
+	if err := repo.batchWriter.AddTag("cold", models.NowString()+"|status:tagged", stored); err != nil {
+		t.Fatalf("AddTag: %v", err)
+	}
+	entity, err := repo.GetByID("cold")
+	if err != nil || !entity.HasTag("status:tagged") {
+		t.Fatalf("queued tag is not visible before the flush: %+v, %v", entity, err)
+	}
+	if stored.HasTag("status:tagged") {
+		t.Error("queued tag was applied to the entity read by the caller")
+	}
+
+	flushWrites(t, repo)
+	entity, err = repo.GetByID("cold")
+	if err != nil || !entity.HasTag("status:tagged") || !entity.HasTag("type:document") {
+		t.Errorf("entity after the flush = %+v, %v, want its tags and the queued one", entity, err)
+	}
+}
+
+// TestFailedBatchStaysQueued checks that the writes of a batch that fails
+// stay visible and queued, and are applied by the next flush
+func TestFailedBatchStaysQueued(t *testing.T) {
+	repo := queuedRepository(t)
+	defer repo.Close()
+
+	if err := repo.Create(&models.Entity{ID: "retried", Tags: []string{"type:document", "dataset:default"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.AddTag("retried", "status:tagged"); err != nil {
+		t.Fatalf("AddTag: %v", err)
+	}
+
+	// Writes to a read-only handle fail, failing the batch's WAL log
+	readOnly, err := os.Open(repo.wal.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	repo.wal.mu.Lock()
+	walFile := repo.wal.file
+	repo.wal.file = readOnly
+	repo.wal.mu.Unlock()
+
+	if err := repo.batchWriter.Flush(); err == nil {
+		t.Fatal("Flush with a failing WAL succeeded")
+	}
+	if repo.batchWriter.PendingCount() != 2 {
+		t.Errorf("%d operations queued after the failed batch, want 2", repo.batchWriter.PendingCount())
+	}
+	entity, err := repo.GetByID("retried")
+	if err != nil || !entity.HasTag("status:tagged") {
+		t.Fatalf("entity of the failed batch is not visible: %+v, %v", entity, err)
+	}
+
+	repo.wal.mu.Lock()
+	repo.wal.file = walFile
+	repo.wal.mu.Unlock()
+	flushWrites(t, repo)
+	if repo.batchWriter.PendingCount() != 0 || repo.batchWriter.overlay.Len() != 0 {
+		t.Errorf("after the retry %d operations and %d entities are pending, want none",
+			repo.batchWriter.PendingCount(), repo.batchWriter.overlay.Len())
+	}
+	entity, err = repo.GetByID("retried")
+	if err != nil || !entity.HasTag("status:tagged") || len(entity.StoredTags("status:tagged")) != 1 {
+		t.Errorf("entity after the retry = %+v, %v, want the queued tag once", entity, err)
+	}
+}
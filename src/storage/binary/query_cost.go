@@ -0,0 +1,170 @@
+package binary
+
+import (
+	"strings"
+)
+
+// diskReadCostFactor weights an entity read from disk against one served from memory
+const diskReadCostFactor = 4
+
+// QuerySpec describes the filters of a list or query request for cost estimation.
+// Filters are considered in the same order the handlers apply them: EQL
+// expression, wildcard, content search, namespace, tags, and finally a full
+// listing.
+type QuerySpec struct {
+	Expression string
+	Tags       []string
+	Wildcard   string
+	Search     string
+	Namespace  string
+}
+
+// QueryCostEstimate is the estimated cost of executing a query
+type QueryCostEstimate struct {
+	QueryType  string `json:"query_type"`
+	Candidates int    `json:"candidates"`
+	DiskReads  int    `json:"disk_reads"`
+	FullScan   bool   `json:"full_scan"`
+	Cost       int64  `json:"cost"`
+}
+
+// EstimateQueryCost estimates how expensive a query would be without running it.
+//
+// The candidate set is derived from index cardinalities only; no entity is read.
+// For multi-tag queries the smallest tag's set bounds the intersection. Disk
+// reads are candidates not currently held in the entity cache, except for full
+// listings which always read from the file. Cost is candidates plus disk reads
+// weighted by diskReadCostFactor.
+func (r *EntityRepository) EstimateQueryCost(spec QuerySpec) QueryCostEstimate {
+	estimate := QueryCostEstimate{}
+
+	var candidates []string
+	switch {
+	case spec.Expression != "":
+		// Expressions are resolved against the index only, which is cheap
+		// compared to reading the entities they select
+		estimate.QueryType = "expression"
+		if node, err := ParseEQL(spec.Expression); err == nil {
+			candidates, _ = r.evaluateEQL(node)
+		}
+	case spec.Wildcard != "":
+		estimate.QueryType = "wildcard"
+		candidates = r.wildcardCandidates(spec.Wildcard)
+	case spec.Search != "":
+		estimate.QueryType = "search"
+		candidates = r.searchCandidates(spec.Search)
+	case spec.Namespace != "":
+		estimate.QueryType = "namespace"
+		candidates = r.namespaceIndex.GetByNamespace(spec.Namespace)
+	case len(spec.Tags) > 1:
+		estimate.QueryType = "multi_tag_and"
+		for i, tag := range spec.Tags {
+			ids := r.tagCandidates(tag)
+			if i == 0 || len(ids) < len(candidates) {
+				candidates = ids
+			}
+			if len(candidates) == 0 {
+				break
+			}
+		}
+	case len(spec.Tags) == 1:
+		estimate.QueryType = "tag_filter"
+		candidates = r.tagCandidates(spec.Tags[0])
+	default:
+		estimate.QueryType = "list_all"
+		estimate.FullScan = true
+		estimate.Candidates = r.namespaceIndex.EntityCount()
+		estimate.DiskReads = estimate.Candidates
+	}
+
+	if !estimate.FullScan {
+		estimate.Candidates = len(candidates)
+		for _, id := range candidates {
+			if !r.entityCache.Contains(id) {
+				estimate.DiskReads++
+			}
+		}
+	}
+
+	estimate.Cost = int64(estimate.Candidates) + int64(estimate.DiskReads)*diskReadCostFactor
+	return estimate
+}
+
+// tagCandidates returns the IDs of active entities carrying a tag, including temporal variants
+func (r *EntityRepository) tagCandidates(tag string) []string {
+	return r.filterDeletedForTag(tag, r.tagEntityIDs(tag))
+}
+
+// tagEntityIDs returns the IDs of all entities carrying a tag, including
+// temporal variants and deleted entities
+func (r *EntityRepository) tagEntityIDs(tag string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(matches []string) {
+		for _, id := range matches {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	add(r.shardedTagIndex.GetEntitiesForTagIncludingDeleted(tag))
+	if r.useVariantCache {
+		add(r.tagVariantCache.GetEntitiesForVariant(tag))
+	} else {
+		add(r.shardedTagIndex.OptimizedListByTagIncludingDeleted(tag, true))
+	}
+	return ids
+}
+
+// wildcardCandidates returns the IDs of active entities with a tag matching a prefix pattern
+func (r *EntityRepository) wildcardCandidates(pattern string) []string {
+	prefix := strings.TrimSuffix(pattern, "*")
+	return r.filterDeletedForTag(prefix, r.wildcardEntityIDs(prefix))
+}
+
+// wildcardEntityIDs returns the IDs of all entities, including deleted ones,
+// with a tag starting with prefix
+func (r *EntityRepository) wildcardEntityIDs(prefix string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for tag, entityIDs := range r.shardedTagIndex.GetAllTags() {
+		actualTag := tag
+		if parts := strings.SplitN(tag, "|", 2); len(parts) == 2 {
+			actualTag = parts[1]
+		}
+		if !strings.HasPrefix(actualTag, prefix) {
+			continue
+		}
+		for _, id := range entityIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// searchCandidates returns the IDs of entities whose indexed content matches the search text
+func (r *EntityRepository) searchCandidates(searchText string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	searchLower := strings.ToLower(searchText)
+	seen := make(map[string]bool)
+	var ids []string
+	for key, entityIDs := range r.contentIndex {
+		if !strings.Contains(strings.ToLower(key), searchLower) {
+			continue
+		}
+		for _, id := range entityIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,217 @@
+package binary
+
+import (
+	"entitydb/models"
+	"strings"
+)
+
+// Query plan strategies
+const (
+	StrategyEQL              = "eql_index"
+	StrategyTagIndex         = "tag_index"
+	StrategyTagIntersection  = "tag_index_intersection"
+	StrategyTagScan          = "tag_index_scan"
+	StrategyContentIndexScan = "content_index_scan"
+	StrategyNamespaceIndex   = "namespace_index"
+	StrategyContentPathIndex = "content_path_index"
+	StrategyDatasetTagIndex  = "dataset_tag_index"
+	StrategyFullScan         = "full_scan"
+)
+
+// QueryFilterSpec is the legacy single-field filter of the query endpoint
+// (filter, operator and value parameters)
+type QueryFilterSpec struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// contentPath returns the content path the filter reads, if any
+func (f *QueryFilterSpec) contentPath() (string, bool) {
+	if f == nil || !models.IsContentPathField(f.Field) {
+		return "", false
+	}
+	return strings.TrimPrefix(f.Field, models.ContentPathPrefix), true
+}
+
+// QueryPlan explains how a list or query request would be executed
+type QueryPlan struct {
+	QueryType string `json:"query_type"`
+	Strategy  string `json:"strategy"`
+
+	// Candidates is the number of entities the strategy fetches before any
+	// filter evaluated on entity data; EstimatedCount is the number expected
+	// to match. CountExact is set when the count is resolved from indexes
+	// alone.
+	Candidates     int  `json:"candidates"`
+	EstimatedCount int  `json:"estimated_count"`
+	CountExact     bool `json:"count_exact"`
+
+	// ShardFanOut is the number of tag index shards consulted, out of
+	// TotalShards
+	ShardFanOut int `json:"shard_fan_out"`
+	TotalShards int `json:"total_shards"`
+
+	FullScan    bool     `json:"full_scan"`
+	DiskReads   int      `json:"disk_reads"`
+	Cost        int64    `json:"cost"`
+	PostFilters []string `json:"post_filters,omitempty"`
+}
+
+// ExplainQuery reports the strategy a query would use, the entities it would
+// fetch and match, and the tag index shards it would consult, without
+// reading any entity.
+//
+// Strategies are chosen in the order the query handler applies its filters:
+// EQL expression, wildcard, content search, namespace, tags, legacy filter,
+// and finally a full listing. A content path filter on a tag-based query is
+// evaluated on the fetched entities, so its count is an upper bound.
+// Permission filtering of the results is not taken into account.
+func (r *EntityRepository) ExplainQuery(spec QuerySpec, filter *QueryFilterSpec, dataset string) QueryPlan {
+	plan := QueryPlan{TotalShards: NumShards, CountExact: true}
+
+	var fetched, matched []string
+	switch {
+	case spec.Expression != "":
+		plan.QueryType, plan.Strategy = "expression", StrategyEQL
+		if node, err := ParseEQL(spec.Expression); err == nil {
+			matched, _ = r.evaluateEQL(node)
+			plan.ShardFanOut = r.tagShardFanOut(EQLTags(node))
+		}
+		fetched = matched
+	case spec.Wildcard != "":
+		plan.QueryType, plan.Strategy = "wildcard", StrategyTagScan
+		fetched = r.wildcardCandidates(spec.Wildcard)
+		matched = fetched
+		plan.ShardFanOut = NumShards
+	case spec.Search != "":
+		plan.QueryType, plan.Strategy = "search", StrategyContentIndexScan
+		fetched = r.searchCandidates(spec.Search)
+		matched = fetched
+	case spec.Namespace != "":
+		plan.QueryType, plan.Strategy = "namespace", StrategyNamespaceIndex
+		fetched = r.namespaceIndex.GetByNamespace(spec.Namespace)
+		matched = fetched
+	case len(spec.Tags) > 1:
+		// Each tag's entities are fetched and intersected in memory
+		plan.QueryType, plan.Strategy = "multi_tag_and", StrategyTagIntersection
+		for i, tag := range spec.Tags {
+			ids := r.tagCandidates(tag)
+			fetched = append(fetched, ids...)
+			if i == 0 {
+				matched = ids
+			} else {
+				matched = intersectIDs(matched, ids)
+			}
+		}
+		plan.ShardFanOut = r.tagShardFanOut(spec.Tags)
+	case len(spec.Tags) == 1:
+		plan.QueryType, plan.Strategy = "tag_filter", StrategyTagIndex
+		fetched = r.tagCandidates(spec.Tags[0])
+		matched = fetched
+		plan.ShardFanOut = r.tagShardFanOut(spec.Tags)
+	case filter != nil && filter.Field != "":
+		return r.explainFilter(plan, filter, dataset)
+	default:
+		plan.QueryType, plan.Strategy = "list_all", StrategyFullScan
+		plan.FullScan = true
+		plan.CountExact = false
+		plan.Candidates = r.namespaceIndex.EntityCount()
+		plan.EstimatedCount = plan.Candidates
+		plan.DiskReads = plan.Candidates
+		plan.Cost = int64(plan.Candidates) + int64(plan.DiskReads)*diskReadCostFactor
+		return plan
+	}
+
+	if path, ok := filter.contentPath(); ok {
+		plan.PostFilters = append(plan.PostFilters, "content path "+path)
+		plan.CountExact = false
+	}
+	plan.finish(r, fetched, len(matched))
+	return plan
+}
+
+// explainFilter plans a legacy filter query. An equality filter on a content
+// path indexed for the dataset uses the content path index, other filters in
+// a dataset start from the dataset tag, and the rest scan every entity.
+func (r *EntityRepository) explainFilter(plan QueryPlan, filter *QueryFilterSpec, dataset string) QueryPlan {
+	plan.QueryType = "legacy_filter"
+	path, isContentPath := filter.contentPath()
+	if isContentPath {
+		plan.QueryType = "content_filter"
+	}
+
+	var fetched []string
+	switch {
+	case isContentPath && dataset != "" && filter.Operator == "eq" && r.contentPaths.Covers(dataset, path):
+		plan.Strategy = StrategyContentPathIndex
+		fetched = r.shardedTagIndex.FilterDeleted(r.contentPaths.Lookup(dataset, path, filter.Value))
+		plan.finish(r, fetched, len(fetched))
+		return plan
+	case dataset != "":
+		plan.Strategy = StrategyDatasetTagIndex
+		datasetTag := "dataset:" + dataset
+		fetched = r.tagCandidates(datasetTag)
+		plan.ShardFanOut = r.tagShardFanOut([]string{datasetTag})
+	default:
+		plan.Strategy = StrategyFullScan
+		plan.FullScan = true
+	}
+
+	plan.PostFilters = append(plan.PostFilters, filter.Field+" "+filter.Operator)
+	plan.CountExact = false
+	if plan.FullScan {
+		plan.Candidates = r.namespaceIndex.EntityCount()
+		plan.EstimatedCount = plan.Candidates
+		plan.DiskReads = plan.Candidates
+		plan.Cost = int64(plan.Candidates) + int64(plan.DiskReads)*diskReadCostFactor
+		return plan
+	}
+	plan.finish(r, fetched, len(fetched))
+	return plan
+}
+
+// finish fills in the counts and cost of an index-driven plan, with the
+// cost model of EstimateQueryCost
+func (p *QueryPlan) finish(r *EntityRepository, fetched []string, matched int) {
+	p.Candidates = len(fetched)
+	p.EstimatedCount = matched
+	for _, id := range fetched {
+		if !r.entityCache.Contains(id) {
+			p.DiskReads++
+		}
+	}
+	p.Cost = int64(p.Candidates) + int64(p.DiskReads)*diskReadCostFactor
+}
+
+// tagShardFanOut returns the number of tag index shards consulted to look up
+// tags. Exact tags touch their own shard; wildcard tags, and temporal variant
+// matching without the variant cache, scan every shard.
+func (r *EntityRepository) tagShardFanOut(tags []string) int {
+	if !r.useVariantCache {
+		return NumShards
+	}
+	shards := make(map[int]bool)
+	for _, tag := range tags {
+		if strings.HasSuffix(tag, "*") {
+			return NumShards
+		}
+		shards[tagShardIndex(tag)] = true
+	}
+	return len(shards)
+}
+
+// intersectIDs returns the IDs present in both a and b
+func intersectIDs(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, id := range b {
+		in[id] = true
+	}
+	result := make([]string, 0, len(a))
+	for _, id := range a {
+		if in[id] {
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package binary
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestExplainQuery checks the strategy, counts and shard fan-out reported
+// for each kind of list and query request
+func TestExplainQuery(t *testing.T) {
+	repo := &EntityRepository{
+		shardedTagIndex: NewShardedTagIndex(),
+		tagVariantCache: NewTagVariantCache(),
+		useVariantCache: true,
+		namespaceIndex:  NewNamespaceIndex(),
+		entityCache:     NewBoundedEntityCache(100, 1<<20),
+		contentPaths:    NewContentPathIndex("orders:customer.country"),
+	}
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("e%d", i)
+		tags := []string{"type:order", "dataset:orders"}
+		if i%2 == 0 {
+			tags = append(tags, "status:open")
+		}
+		for _, tag := range tags {
+			repo.shardedTagIndex.AddTag(tag, id)
+			repo.namespaceIndex.AddTag(id, tag)
+		}
+		content, _ := json.Marshal(map[string]interface{}{"customer": map[string]string{"country": []string{"NL", "DE"}[i%2]}})
+		repo.contentPaths.Index(&models.Entity{ID: id, Tags: []string{"1|dataset:orders"}, Content: content})
+	}
+	repo.entityCache.Put("e0", &models.Entity{ID: "e0"})
+
+	tests := []struct {
+		name     string
+		spec     QuerySpec
+		filter   *QueryFilterSpec
+		dataset  string
+		strategy string
+		fetched  int
+		count    int
+		exact    bool
+		fanOut   int
+		fullScan bool
+	}{
+		{name: "tag", spec: QuerySpec{Tags: []string{"status:open"}},
+			strategy: StrategyTagIndex, fetched: 5, count: 5, exact: true, fanOut: 1},
+		{name: "tags", spec: QuerySpec{Tags: []string{"type:order", "status:open"}},
+			strategy: StrategyTagIntersection, fetched: 15, count: 5, exact: true, fanOut: 2},
+		{name: "wildcard", spec: QuerySpec{Wildcard: "status:*"},
+			strategy: StrategyTagScan, fetched: 5, count: 5, exact: true, fanOut: NumShards},
+		{name: "expression", spec: QuerySpec{Expression: "type:order AND NOT status:open"},
+			strategy: StrategyEQL, fetched: 5, count: 5, exact: true, fanOut: 2},
+		{name: "tag with content filter", spec: QuerySpec{Tags: []string{"status:open"}},
+			filter:   &QueryFilterSpec{Field: "content.customer.country", Operator: "eq", Value: "NL"},
+			strategy: StrategyTagIndex, fetched: 5, count: 5, fanOut: 1},
+		{name: "indexed content path",
+			filter: &QueryFilterSpec{Field: "content.customer.country", Operator: "eq", Value: "DE"}, dataset: "orders",
+			strategy: StrategyContentPathIndex, fetched: 5, count: 5, exact: true},
+		{name: "filter in dataset",
+			filter: &QueryFilterSpec{Field: "created_at", Operator: "gt", Value: "0"}, dataset: "orders",
+			strategy: StrategyDatasetTagIndex, fetched: 10, count: 10, fanOut: 1},
+		{name: "filter", filter: &QueryFilterSpec{Field: "created_at", Operator: "gt", Value: "0"},
+			strategy: StrategyFullScan, fetched: 10, count: 10, fullScan: true},
+		{name: "list all", strategy: StrategyFullScan, fetched: 10, count: 10, fullScan: true},
+	}
+	for _, tt := range tests {
+		plan := repo.ExplainQuery(tt.spec, tt.filter, tt.dataset)
+		if plan.Strategy != tt.strategy || plan.Candidates != tt.fetched || plan.EstimatedCount != tt.count ||
+			plan.CountExact != tt.exact || plan.ShardFanOut != tt.fanOut || plan.FullScan != tt.fullScan {
+			t.Errorf("%s: plan = %+v, want %s fetching %d, matching %d (exact %v), fan-out %d, full scan %v",
+				tt.name, plan, tt.strategy, tt.fetched, tt.count, tt.exact, tt.fanOut, tt.fullScan)
+		}
+	}
+
+	plan := repo.ExplainQuery(QuerySpec{Tags: []string{"status:open"}}, nil, "")
+	if plan.DiskReads != 4 || plan.Cost != 5+4*diskReadCostFactor {
+		t.Errorf("tag plan reads %d entities at cost %d, want 4 uncached reads", plan.DiskReads, plan.Cost)
+	}
+}
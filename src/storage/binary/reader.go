@@ -2,9 +2,8 @@ package binary
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"context"
 	"encoding/binary"
-	"encoding/hex"
 	"entitydb/models"
 	"entitydb/logger"
 	"entitydb/storage/pools"
@@ -12,8 +11,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 var (
@@ -57,6 +56,7 @@ type Reader struct {
 	indexMu         sync.RWMutex            // SURGICAL FIX: Protects index from concurrent access corruption
 	corruptionCount int                     // Track corruption instances for recovery triggers
 	filename        string                  // File path for reopening
+	generation      uint64                  // Pool file generation the reader was opened at
 	// legacyReader removed - single source of truth: unified format only
 }
 
@@ -428,6 +428,167 @@ func (r *Reader) GetEntity(id string) (*models.Entity, error) {
 	return entity, nil
 }
 
+// ContentKeyID returns the master key the content of entity id is sealed
+// with, or "" when the content is stored in plaintext or empty. Only the
+// record's framing is parsed; the content is not decrypted.
+func (r *Reader) ContentKeyID(id string) (string, error) {
+	keyID, _, err := r.contentKeyID(id)
+	return keyID, err
+}
+
+// contentKeyID also returns the number of tags stored in the record, which
+// parseEntity may extend with a content type tag
+func (r *Reader) contentKeyID(id string) (string, int, error) {
+	r.indexMu.RLock()
+	entry, exists := r.index[id]
+	if !exists {
+		r.indexMu.RUnlock()
+		return "", 0, ErrNotFound
+	}
+	offset, size := entry.Offset, entry.Size
+	r.indexMu.RUnlock()
+	
+	data := make([]byte, size)
+	if _, err := r.file.ReadAt(data, int64(offset)); err != nil {
+		return "", 0, err
+	}
+	
+	buf := bytes.NewReader(data)
+	var header EntityHeader
+	if err := binary.Read(buf, binary.LittleEndian, &header); err != nil {
+		return "", 0, err
+	}
+	tagCount := int(header.TagCount)
+	if header.ContentCount == 0 {
+		return "", tagCount, nil
+	}
+	tagBytes := int64(header.TagCount) * 4
+	if header.Reserved&entityFlagCompactTags != 0 {
+		var sectionLen uint32
+		if err := binary.Read(buf, binary.LittleEndian, &sectionLen); err != nil {
+			return "", 0, err
+		}
+		tagBytes = int64(sectionLen)
+	}
+	if _, err := buf.Seek(tagBytes, io.SeekCurrent); err != nil {
+		return "", 0, err
+	}
+	
+	// [CompressionType][ContentTypeLen][ContentType][OriginalSize][CompressedSize][Data]
+	var compressionType uint8
+	var typeLen uint16
+	if err := binary.Read(buf, binary.LittleEndian, &compressionType); err != nil {
+		return "", 0, err
+	}
+	if compressionType&contentEncryptedFlag == 0 {
+		return "", tagCount, nil
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &typeLen); err != nil {
+		return "", 0, err
+	}
+	var sizes [2]uint32
+	if _, err := buf.Seek(int64(typeLen), io.SeekCurrent); err != nil {
+		return "", 0, err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &sizes); err != nil {
+		return "", 0, err
+	}
+	start := len(data) - buf.Len()
+	if start+int(sizes[1]) > len(data) {
+		return "", 0, fmt.Errorf("entity %s: content extends past its record", id)
+	}
+	keyID, err := SealedKeyID(data[start : start+int(sizes[1])])
+	return keyID, tagCount, err
+}
+
+// GetEntityWithoutContent reads an entity's header, tags and content
+// framing, leaving its content on disk. The entity has no content.
+func (r *Reader) GetEntityWithoutContent(id string) (*models.Entity, error) {
+	r.indexMu.RLock()
+	entry, exists := r.index[id]
+	if !exists {
+		r.indexMu.RUnlock()
+		return nil, ErrNotFound
+	}
+	offset, size := int64(entry.Offset), int(entry.Size)
+	r.indexMu.RUnlock()
+	
+	// One read covers the head of most records; a compact tag section or a
+	// content type longer than the first guess takes another
+	var data []byte
+	for need := min(size, 512); need > len(data); need = min(entityRecordHeadLen(data), size) {
+		read := len(data)
+		data = append(data, make([]byte, need-read)...)
+		if _, err := r.file.ReadAt(data[read:], offset+int64(read)); err != nil {
+			return nil, err
+		}
+	}
+	return decodeEntityRecordTags(data, id, r.tagDict)
+}
+
+// readEntityAt reads and parses one entity with positional reads, so unlike
+// GetEntity it can run on several goroutines sharing one reader
+func (r *Reader) readEntityAt(id string) (*models.Entity, error) {
+	r.indexMu.RLock()
+	entry, exists := r.index[id]
+	if !exists {
+		r.indexMu.RUnlock()
+		return nil, ErrNotFound
+	}
+	offset, size := entry.Offset, entry.Size
+	r.indexMu.RUnlock()
+	
+	data := make([]byte, size)
+	if _, err := r.file.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+	return r.parseEntity(data, id)
+}
+
+// GetAllEntitiesParallel reads all entities like GetAllEntities, decoding
+// them on the given number of goroutines. Unreadable entities are logged and
+// skipped. progress, if set, is called from the workers after each entity.
+func (r *Reader) GetAllEntitiesParallel(workers int, progress func(done, total int)) []*models.Entity {
+	ids := r.EntityIDs()
+	if workers < 1 {
+		workers = 1
+	}
+	
+	results := make([]*models.Entity, len(ids))
+	var next, done int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1) - 1)
+				if i >= len(ids) {
+					return
+				}
+				entity, err := r.readEntityAt(ids[i])
+				if err != nil {
+					logger.Warn("Error getting entity %s: %v", ids[i], err)
+				} else {
+					results[i] = entity
+				}
+				if progress != nil {
+					progress(int(atomic.AddInt64(&done, 1)), len(ids))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	
+	entities := make([]*models.Entity, 0, len(ids))
+	for _, entity := range results {
+		if entity != nil {
+			entities = append(entities, entity)
+		}
+	}
+	return entities
+}
+
 // GetAllEntities reads all entities from the binary file.
 // This method is useful for bulk operations like backups or migrations.
 //
@@ -449,12 +610,21 @@ func (r *Reader) GetEntity(id string) (*models.Entity, error) {
 //   Safe for concurrent use, but may cause contention
 //   if called simultaneously from multiple goroutines.
 func (r *Reader) GetAllEntities() ([]*models.Entity, error) {
+	return r.GetAllEntitiesContext(context.Background())
+}
+
+// GetAllEntitiesContext reads all entities like GetAllEntities, stopping
+// with the context's error once ctx is cancelled
+func (r *Reader) GetAllEntitiesContext(ctx context.Context) ([]*models.Entity, error) {
 	// Single source of truth: unified format only
 	
 	logger.Trace("GetAllEntities called, index has %d entries, header says %d entities", len(r.index), r.header.EntityCount)
 	entities := make([]*models.Entity, 0, r.header.EntityCount)
 	
 	for id := range r.index {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		logger.Trace("Getting entity with ID: %s", id)
 		entity, err := r.GetEntity(id)
 		if err != nil {
@@ -469,6 +639,33 @@ func (r *Reader) GetAllEntities() ([]*models.Entity, error) {
 	return entities, nil
 }
 
+// GetAllEntitiesWithoutContent reads every entity like
+// GetAllEntitiesContext, leaving the content on disk
+func (r *Reader) GetAllEntitiesWithoutContent(ctx context.Context) ([]*models.Entity, error) {
+	entities := make([]*models.Entity, 0, r.header.EntityCount)
+	for _, id := range r.EntityIDs() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entity, err := r.GetEntityWithoutContent(id)
+		if err != nil {
+			logger.Warn("Error getting entity %s: %v", id, err)
+			continue
+		}
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
+// EntityIDs returns the IDs of all entities in the file index
+func (r *Reader) EntityIDs() []string {
+	ids := make([]string, 0, len(r.index))
+	for id := range r.index {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 // parseEntity decodes binary entity data into a models.Entity struct.
 // It handles the complete binary format including header, tags, and content.
 //
@@ -477,6 +674,7 @@ func (r *Reader) GetAllEntities() ([]*models.Entity, error) {
 //
 // The method handles both compressed and uncompressed content transparently,
 // and properly decodes JSON content that was stored without extra wrapping.
+// The record format is decoded by decodeEntityRecord, shared with MMapReader.
 //
 // Parameters:
 //   - data: Raw binary data read from file
@@ -486,145 +684,7 @@ func (r *Reader) GetAllEntities() ([]*models.Entity, error) {
 //   - *models.Entity: Fully populated entity
 //   - error: Parsing errors or corruption
 func (r *Reader) parseEntity(data []byte, id string) (*models.Entity, error) {
-	buf := bytes.NewReader(data)
-	
-	// Read entity header containing metadata
-	var header EntityHeader
-	if err := binary.Read(buf, binary.LittleEndian, &header); err != nil {
-		return nil, err
-	}
-	
-	entity := &models.Entity{
-		ID:   id,
-		Tags: make([]string, header.TagCount),
-		Content: []byte{}, // Unified content model
-	}
-	
-	// Tag Resolution Algorithm:
-	// 1. Read tag IDs (4 bytes each)
-	// 2. Look up each ID in the tag dictionary
-	// 3. Dictionary returns the original tag string
-	// This reduces storage size significantly for repeated tags
-	for i := uint16(0); i < header.TagCount; i++ {
-		var tagID uint32
-		if err := binary.Read(buf, binary.LittleEndian, &tagID); err != nil {
-			return nil, err
-		}
-		entity.Tags[i] = r.tagDict.GetTag(tagID)
-	}
-	
-	// Content Decoding Algorithm:
-	// The binary format stores content with metadata for proper reconstruction
-	// Format: [CompressionType][ContentTypeLen][ContentType][OriginalSize][CompressedSize][Data][Timestamp]
-	if header.ContentCount > 0 {
-		// Read compression type (1 byte)
-		// 0 = no compression, 1 = gzip compression
-		var compressionType uint8
-		if err := binary.Read(buf, binary.LittleEndian, &compressionType); err != nil {
-			return nil, err
-		}
-		
-		// Content type
-		var typeLen uint16
-		if err := binary.Read(buf, binary.LittleEndian, &typeLen); err != nil {
-			return nil, err
-		}
-		// Use small buffer pool for type string
-		typeSlice := pools.GetByteSlice()
-		defer pools.PutByteSlice(typeSlice)
-		
-		if cap(*typeSlice) < int(typeLen) {
-			*typeSlice = make([]byte, typeLen)
-		} else {
-			*typeSlice = (*typeSlice)[:typeLen]
-		}
-		typeBytes := *typeSlice
-		if _, err := buf.Read(typeBytes); err != nil {
-			return nil, err
-		}
-		contentType := string(typeBytes)
-		
-		// Read original size and compressed size (writer writes both)
-		var originalSize uint32
-		if err := binary.Read(buf, binary.LittleEndian, &originalSize); err != nil {
-			return nil, err
-		}
-		
-		var compressedSize uint32
-		if err := binary.Read(buf, binary.LittleEndian, &compressedSize); err != nil {
-			return nil, err
-		}
-		
-		// For content, allocate based on compressed size and read that many bytes
-		contentBytes := make([]byte, compressedSize)
-		if _, err := buf.Read(contentBytes); err != nil {
-			return nil, err
-		}
-		
-		// Decompress if needed
-		if CompressionType(compressionType) == CompressionGzip {
-			decompressed, err := DecompressWithPool(contentBytes)
-			if err != nil {
-				logger.Warn("Failed to decompress content for entity %s: %v, using as-is", id, err)
-			} else {
-				contentBytes = decompressed
-			}
-		}
-		
-		// Timestamp
-		var tsNano int64
-		if err := binary.Read(buf, binary.LittleEndian, &tsNano); err != nil {
-			return nil, err
-		}
-		
-		// Store content directly (no conversion needed for JSON)
-		entity.Content = contentBytes
-		
-		// Add content type tag if not already present
-		hasContentTypeTag := false
-		for _, tag := range entity.Tags {
-			if strings.Contains(tag, "content:type:") {
-				hasContentTypeTag = true
-				break
-			}
-		}
-		if !hasContentTypeTag {
-			entity.AddTag("content:type:" + contentType)
-		}
-		
-		// Content Integrity Validation:
-		// Validate content checksum against stored checksum tag for data integrity verification
-		// Algorithm matches writer: SHA256 of final decompressed content
-		actualChecksum := sha256.Sum256(contentBytes)
-		actualChecksumHex := hex.EncodeToString(actualChecksum[:])
-		
-		// Find stored checksum in entity tags (temporal format: "timestamp|checksum:sha256:hash")
-		var storedChecksumHex string
-		for _, tag := range entity.Tags {
-			if strings.Contains(tag, "|checksum:sha256:") {
-				parts := strings.SplitN(tag, "|", 2)
-				if len(parts) == 2 && strings.HasPrefix(parts[1], "checksum:sha256:") {
-					storedChecksumHex = strings.TrimPrefix(parts[1], "checksum:sha256:")
-					break
-				}
-			}
-		}
-		
-		// Perform validation if checksum tag exists
-		if storedChecksumHex != "" {
-			if actualChecksumHex != storedChecksumHex {
-				logger.Warn("Content checksum mismatch for entity %s: expected %s, got %s", 
-					id, storedChecksumHex, actualChecksumHex)
-				// Note: Continue operation but log integrity issue for monitoring
-			} else {
-				logger.Trace("Content integrity verified for entity %s", id)
-			}
-		}
-		
-		logger.Trace("Content loaded for entity %s (%d bytes)", id, len(contentBytes))
-	}
-	
-	return entity, nil
+	return decodeEntityRecord(data, id, r.tagDict)
 }
 
 // Close releases all resources associated with the Reader.
@@ -6,10 +6,19 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// ReaderPool manages a pool of file readers to avoid repeated opens/closes
+// ReaderPool manages a pool of file readers to avoid repeated opens/closes.
+//
+// Readers load the header and index of the data file when opened, so they
+// do not see records written after that. Instead of closing readers on every
+// write, the pool keeps a file generation that writes advance: readers and
+// the memory mapping record the generation they were opened at, and one
+// found stale is replaced when it is next borrowed. Only checkpoints and
+// index repairs, after which the file is rewritten, close idle readers
+// eagerly with Invalidate.
 type ReaderPool struct {
 	dataFile    string
 	maxSize     int
@@ -21,13 +30,53 @@ type ReaderPool struct {
 	allReaders  []*Reader
 	mu          sync.Mutex
 	
+	// File generation, advanced by every write readers must see
+	generation  atomic.Uint64
+	
+	// Memory-mapped view of the data file, the primary read path. It is
+	// replaced once the generation it was mapped at is stale; mappedErr
+	// keeps a failed mapping from being retried before then.
+	mapped      *MMapReader
+	mappedErr   error
+	mappedGen   uint64
+	mappedMu    sync.RWMutex
+	
 	// Metrics
 	created     int64
-	borrowed    int64
-	returned    int64
+	borrowed    atomic.Int64
+	returned    atomic.Int64
+	hits        atomic.Int64 // Borrows served by an idle reader
+	misses      atomic.Int64 // Borrows that opened a reader or waited for one
+	timeouts    atomic.Int64 // Borrows that gave up waiting
+	refreshed   atomic.Int64 // Stale readers replaced when borrowed
 	closed      chan bool
 }
 
+// ReaderPoolStats is a point-in-time view of reader pool usage
+type ReaderPoolStats struct {
+	Open      int   `json:"open"`      // Readers open, idle or borrowed
+	Available int   `json:"available"` // Idle readers
+	MaxSize   int   `json:"max_size"`
+	Borrowed  int64 `json:"borrowed"`
+	Returned  int64 `json:"returned"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Timeouts  int64 `json:"timeouts"`
+	Refreshed int64 `json:"refreshed"` // Stale readers replaced when borrowed
+	
+	// File generation; readers opened at an older one are stale
+	Generation uint64 `json:"generation"`
+}
+
+// HitRatio returns the fraction of borrows served by an idle reader
+func (s ReaderPoolStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
 // NewReaderPool creates a new reader pool
 func NewReaderPool(dataFile string, minSize, maxSize int) (*ReaderPool, error) {
 	if minSize <= 0 {
@@ -48,7 +97,7 @@ func NewReaderPool(dataFile string, minSize, maxSize int) (*ReaderPool, error) {
 	
 	// Pre-create minimum readers
 	for i := 0; i < minSize; i++ {
-		reader, err := NewReader(dataFile)
+		reader, err := pool.open()
 		if err != nil {
 			// Clean up any created readers
 			pool.Close()
@@ -69,18 +118,20 @@ func NewReaderPool(dataFile string, minSize, maxSize int) (*ReaderPool, error) {
 
 // Get borrows a reader from the pool
 func (p *ReaderPool) Get() (*Reader, error) {
-	p.borrowed++
+	p.borrowed.Add(1)
 	
 	select {
 	case reader := <-p.available:
 		// Got one from the pool
-		return reader, nil
+		p.hits.Add(1)
+		return p.current(reader)
 		
 	default:
 		// Pool is empty, try to create a new one
+		p.misses.Add(1)
 		p.mu.Lock()
 		if len(p.allReaders) < p.maxSize {
-			reader, err := NewReader(p.dataFile)
+			reader, err := p.open()
 			if err != nil {
 				p.mu.Unlock()
 				return nil, fmt.Errorf("failed to create new reader: %v", err)
@@ -95,20 +146,70 @@ func (p *ReaderPool) Get() (*Reader, error) {
 		// Pool is at max size, wait for one to become available
 		select {
 		case reader := <-p.available:
-			return reader, nil
+			return p.current(reader)
 		case <-time.After(5 * time.Second):
+			p.timeouts.Add(1)
 			return nil, fmt.Errorf("reader pool timeout: all %d readers in use", p.maxSize)
 		}
 	}
 }
 
+// open opens a reader at the current generation. The generation is read
+// first, so a write committed while the reader opens leaves it stale rather
+// than marked current without that write.
+func (p *ReaderPool) open() (*Reader, error) {
+	generation := p.generation.Load()
+	reader, err := NewReader(p.dataFile)
+	if err != nil {
+		return nil, err
+	}
+	reader.generation = generation
+	return reader, nil
+}
+
+// current returns a borrowed reader, or a freshly opened reader in its place
+// when it is stale
+func (p *ReaderPool) current(reader *Reader) (*Reader, error) {
+	if reader.generation == p.generation.Load() {
+		return reader, nil
+	}
+	p.refreshed.Add(1)
+	fresh, err := p.open()
+	
+	p.mu.Lock()
+	for i, r := range p.allReaders {
+		if r == reader {
+			p.allReaders = append(p.allReaders[:i], p.allReaders[i+1:]...)
+			break
+		}
+	}
+	if err == nil {
+		p.allReaders = append(p.allReaders, fresh)
+		p.created++
+	}
+	p.mu.Unlock()
+	
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen stale reader: %v", err)
+	}
+	return fresh, nil
+}
+
+// Advance starts a new file generation, after a write readers must see.
+// Pooled readers and the mapping are replaced as they are next used, so a
+// write costs no reopening of readers nobody borrows.
+func (p *ReaderPool) Advance() {
+	p.generation.Add(1)
+}
+
 // Put returns a reader to the pool
 func (p *ReaderPool) Put(reader *Reader) {
 	if reader == nil {
 		return
 	}
 	
-	p.returned++
+	p.returned.Add(1)
 	
 	select {
 	case p.available <- reader:
@@ -131,9 +232,103 @@ func (p *ReaderPool) WithReader(fn func(*Reader) error) error {
 	return fn(reader)
 }
 
+// Mapped returns the memory-mapped reader of the data file, mapping it on
+// first use after the pool is created or invalidated and again once the
+// generation advances. It returns nil when the file cannot be mapped, and
+// callers then read through pooled readers. A reader replaced meanwhile
+// returns errMMapClosed, which also means falling back to a pooled reader.
+func (p *ReaderPool) Mapped() *MMapReader {
+	generation := p.generation.Load()
+	p.mappedMu.RLock()
+	mapped, mappedErr, mappedGen := p.mapped, p.mappedErr, p.mappedGen
+	p.mappedMu.RUnlock()
+	if (mapped != nil || mappedErr != nil) && mappedGen == generation {
+		return mapped
+	}
+	
+	p.mappedMu.Lock()
+	var stale *MMapReader
+	if p.isClosed() {
+		p.mappedMu.Unlock()
+		return nil
+	}
+	if (p.mapped == nil && p.mappedErr == nil) || p.mappedGen != generation {
+		stale = p.mapped
+		p.mapped, p.mappedErr = NewMMapReader(p.dataFile)
+		p.mappedGen = generation
+		if p.mappedErr != nil {
+			logger.Warn("Memory-mapped reads unavailable, using file reads: %v", p.mappedErr)
+		}
+	}
+	mapped = p.mapped
+	p.mappedMu.Unlock()
+	
+	// The stale mapping is closed once its reads in progress finish
+	if stale != nil {
+		if err := stale.Close(); err != nil {
+			logger.Warn("Failed to close memory-mapped reader: %v", err)
+		}
+	}
+	return mapped
+}
+
+// isClosed reports whether Close has been called
+func (p *ReaderPool) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// unmap drops the memory-mapped reader. The next Mapped call maps the file
+// again unless reason is set, which Mapped then keeps returning nil for. The
+// old mapping is closed once its reads in progress finish.
+func (p *ReaderPool) unmap(reason error) {
+	p.mappedMu.Lock()
+	mapped := p.mapped
+	p.mapped, p.mappedErr = nil, reason
+	p.mappedMu.Unlock()
+	
+	if mapped != nil {
+		if err := mapped.Close(); err != nil {
+			logger.Warn("Failed to close memory-mapped reader: %v", err)
+		}
+	}
+}
+
+// Invalidate starts a new generation and closes all idle readers and the
+// memory mapping now, so subsequent borrowers open fresh readers that observe
+// the latest file header and index. It is for checkpoints and index repairs;
+// writes only Advance the generation.
+func (p *ReaderPool) Invalidate() error {
+	p.generation.Add(1)
+	p.unmap(nil)
+	
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	for {
+		select {
+		case reader := <-p.available:
+			reader.Close()
+			for i, r := range p.allReaders {
+				if r == reader {
+					p.allReaders = append(p.allReaders[:i], p.allReaders[i+1:]...)
+					break
+				}
+			}
+		default:
+			return nil
+		}
+	}
+}
+
 // Close closes all readers in the pool
 func (p *ReaderPool) Close() error {
 	close(p.closed)
+	p.unmap(fmt.Errorf("reader pool closed"))
 	
 	// Close all readers
 	p.mu.Lock()
@@ -152,11 +347,32 @@ func (p *ReaderPool) Close() error {
 	}
 	
 	logger.Info("Closed ReaderPool: created=%d, borrowed=%d, returned=%d", 
-		p.created, p.borrowed, p.returned)
+		p.created, p.borrowed.Load(), p.returned.Load())
 	
 	return nil
 }
 
+// Stats returns the pool's current size and borrow counters
+func (p *ReaderPool) Stats() ReaderPoolStats {
+	p.mu.Lock()
+	open := len(p.allReaders)
+	p.mu.Unlock()
+	
+	return ReaderPoolStats{
+		Open:      open,
+		Available: len(p.available),
+		MaxSize:   p.maxSize,
+		Borrowed:  p.borrowed.Load(),
+		Returned:  p.returned.Load(),
+		Hits:      p.hits.Load(),
+		Misses:    p.misses.Load(),
+		Timeouts:  p.timeouts.Load(),
+		Refreshed: p.refreshed.Load(),
+		
+		Generation: p.generation.Load(),
+	}
+}
+
 // reportMetrics periodically logs pool metrics
 func (p *ReaderPool) reportMetrics() {
 	ticker := time.NewTicker(30 * time.Second)
@@ -170,8 +386,12 @@ func (p *ReaderPool) reportMetrics() {
 			total := len(p.allReaders)
 			p.mu.Unlock()
 			
-			logger.Debug("ReaderPool stats: %d/%d available, borrowed=%d, returned=%d",
-				available, total, p.borrowed, p.returned)
+			p.mappedMu.RLock()
+			mapped := p.mapped != nil
+			p.mappedMu.RUnlock()
+			
+			logger.Debug("ReaderPool stats: %d/%d available, borrowed=%d, returned=%d, mapped=%v",
+				available, total, p.borrowed.Load(), p.returned.Load(), mapped)
 				
 		case <-p.closed:
 			return
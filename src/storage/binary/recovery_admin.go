@@ -0,0 +1,276 @@
+package binary
+
+import (
+	"context"
+	"entitydb/logger"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operator-driven recovery
+//
+// A diagnosis checks every entity record in the data file: its index entry
+// must lie within the file, the record must decode, and its content must
+// match its checksum tag. Entities failing a check are quarantined; reads
+// that fail at runtime quarantine the entity too. Quarantined entities are
+// listed for operators and released once a later diagnosis reads them
+// cleanly. A forced rebuild repairs the persisted index, rebuilds the
+// in-memory indexes from the data file and then diagnoses.
+
+// ErrRecoveryRunning is returned when a diagnosis or rebuild is requested
+// while another is in progress
+var ErrRecoveryRunning = errors.New("storage recovery already in progress")
+
+// Quarantine reasons
+const (
+	QuarantineIndexOutOfRange  = "index_entry_out_of_range"
+	QuarantineUnreadable       = "unreadable"
+	QuarantineChecksumMismatch = "checksum_mismatch"
+	QuarantineReadFailure      = "read_failure"
+)
+
+// QuarantinedEntity is an entity whose stored record failed a check
+type QuarantinedEntity struct {
+	ID         string    `json:"id"`
+	Reason     string    `json:"reason"`
+	Detail     string    `json:"detail,omitempty"`
+	Offset     uint64    `json:"offset"`
+	Size       uint32    `json:"size"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// RecoveryReport describes a diagnosis or forced rebuild
+type RecoveryReport struct {
+	Action             string        `json:"action"` // "diagnose" or "rebuild"
+	StartedAt          time.Time     `json:"started_at"`
+	Duration           time.Duration `json:"duration_ns"`
+	DataFileSize       int64         `json:"data_file_size"`
+	IndexEntries       int           `json:"index_entries"`
+	Examined           int           `json:"examined"`
+	IndexOutOfRange    int           `json:"index_out_of_range"`
+	Unreadable         int           `json:"unreadable"`
+	ChecksumMismatches int           `json:"checksum_mismatches"`
+	Quarantined        int           `json:"quarantined"` // in quarantine after the run
+	Released           int           `json:"released"`
+	IndexRebuilt       bool          `json:"index_rebuilt,omitempty"`
+	Error              string        `json:"error,omitempty"`
+}
+
+// RecoveryProgressFunc reports each entity examined by a diagnosis
+type RecoveryProgressFunc func(processed, total int, entityID string, err error)
+
+// entityQuarantine holds the quarantined entities by ID
+type entityQuarantine struct {
+	mu      sync.RWMutex
+	entries map[string]QuarantinedEntity
+}
+
+func (q *entityQuarantine) add(entry QuarantinedEntity) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.entries == nil {
+		q.entries = make(map[string]QuarantinedEntity)
+	}
+	if _, exists := q.entries[entry.ID]; !exists {
+		logger.Warn("Quarantined entity %s: %s %s", entry.ID, entry.Reason, entry.Detail)
+	}
+	q.entries[entry.ID] = entry
+}
+
+// release removes an entity, reporting whether it was quarantined
+func (q *entityQuarantine) release(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, exists := q.entries[id]; !exists {
+		return false
+	}
+	delete(q.entries, id)
+	return true
+}
+
+func (q *entityQuarantine) len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.entries)
+}
+
+// list returns the quarantined entities, most recently detected first
+func (q *entityQuarantine) list() []QuarantinedEntity {
+	q.mu.RLock()
+	entries := make([]QuarantinedEntity, 0, len(q.entries))
+	for _, entry := range q.entries {
+		entries = append(entries, entry)
+	}
+	q.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].DetectedAt.Equal(entries[j].DetectedAt) {
+			return entries[i].DetectedAt.After(entries[j].DetectedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// QuarantinedEntities lists the entities whose records failed a check
+func (r *EntityRepository) QuarantinedEntities() []QuarantinedEntity {
+	return r.quarantine.list()
+}
+
+// LastRecoveryReport returns the report of the most recent diagnosis or
+// rebuild, or nil when none has run
+func (r *EntityRepository) LastRecoveryReport() *RecoveryReport {
+	return r.lastRecovery.Load()
+}
+
+// quarantineReadFailure records an entity whose read failed outside a diagnosis
+func (r *EntityRepository) quarantineReadFailure(id string, err error) {
+	r.quarantine.add(QuarantinedEntity{
+		ID:         id,
+		Reason:     QuarantineReadFailure,
+		Detail:     err.Error(),
+		DetectedAt: time.Now(),
+	})
+}
+
+// DiagnoseStorage checks every entity record in the data file, quarantining
+// those that fail and releasing those that now pass
+func (r *EntityRepository) DiagnoseStorage(ctx context.Context, progress RecoveryProgressFunc) (*RecoveryReport, error) {
+	if !atomic.CompareAndSwapInt32(&r.recoveryRunning, 0, 1) {
+		return nil, ErrRecoveryRunning
+	}
+	defer atomic.StoreInt32(&r.recoveryRunning, 0)
+
+	report := &RecoveryReport{Action: "diagnose", StartedAt: time.Now()}
+	err := r.diagnose(ctx, report, progress)
+	return r.finishRecovery(report, err)
+}
+
+// ForceRecoveryRebuild repairs out-of-range entries in the persisted index,
+// rebuilds the in-memory indexes from the data file and diagnoses the result
+func (r *EntityRepository) ForceRecoveryRebuild(ctx context.Context, progress RecoveryProgressFunc) (*RecoveryReport, error) {
+	if !atomic.CompareAndSwapInt32(&r.recoveryRunning, 0, 1) {
+		return nil, ErrRecoveryRunning
+	}
+	defer atomic.StoreInt32(&r.recoveryRunning, 0)
+
+	report := &RecoveryReport{Action: "rebuild", StartedAt: time.Now()}
+	logger.Info("Forced storage rebuild started")
+
+	if err := r.RepairIndex(); err != nil {
+		return r.finishRecovery(report, fmt.Errorf("failed to repair index: %w", err))
+	}
+	if err := r.readerPool.Invalidate(); err != nil {
+		return r.finishRecovery(report, fmt.Errorf("failed to refresh readers: %w", err))
+	}
+	if err := r.RebuildIndexesOnline(IndexRebuildProgressFunc(progress)); err != nil {
+		return r.finishRecovery(report, fmt.Errorf("failed to rebuild indexes: %w", err))
+	}
+	report.IndexRebuilt = true
+
+	err := r.diagnose(ctx, report, progress)
+	return r.finishRecovery(report, err)
+}
+
+// finishRecovery records a report as the last one and returns it
+func (r *EntityRepository) finishRecovery(report *RecoveryReport, err error) (*RecoveryReport, error) {
+	report.Duration = time.Since(report.StartedAt)
+	report.Quarantined = r.quarantine.len()
+	if err != nil {
+		report.Error = err.Error()
+		logger.Error("Storage %s failed: %v", report.Action, err)
+	} else {
+		logger.Info("Storage %s completed in %v: %d examined, %d quarantined, %d released",
+			report.Action, report.Duration, report.Examined, report.Quarantined, report.Released)
+	}
+	r.lastRecovery.Store(report)
+	return report, err
+}
+
+// diagnose checks the records of a pooled reader into report, after
+// writing out queued writes so recent entities are on disk
+func (r *EntityRepository) diagnose(ctx context.Context, report *RecoveryReport, progress RecoveryProgressFunc) error {
+	if r.useBatchWrites && r.batchWriter != nil {
+		if err := r.batchWriter.Flush(); err != nil {
+			return fmt.Errorf("failed to flush pending writes: %w", err)
+		}
+	}
+	// Pooled readers keep the index they were opened with
+	if err := r.readerPool.Invalidate(); err != nil {
+		return fmt.Errorf("failed to refresh readers: %w", err)
+	}
+	reader, err := r.readerPool.Get()
+	if err != nil {
+		return fmt.Errorf("failed to get reader: %w", err)
+	}
+	defer r.readerPool.Put(reader)
+
+	return diagnoseRecords(ctx, reader, r.recovery, &r.quarantine, report, progress)
+}
+
+// indexedRecord is an entity's location in the data file
+type indexedRecord struct {
+	id     string
+	offset uint64
+	size   uint32
+}
+
+// diagnoseRecords checks every record indexed by reader, updating quarantine
+// and report
+func diagnoseRecords(ctx context.Context, reader *Reader, rm *RecoveryManager, quarantine *entityQuarantine, report *RecoveryReport, progress RecoveryProgressFunc) error {
+	stat, err := reader.file.Stat()
+	if err != nil {
+		return fmt.Errorf("data file not accessible: %w", err)
+	}
+	report.DataFileSize = stat.Size()
+
+	// Records are checked in file order
+	reader.indexMu.RLock()
+	records := make([]indexedRecord, 0, len(reader.index))
+	for id, entry := range reader.index {
+		records = append(records, indexedRecord{id: id, offset: entry.Offset, size: entry.Size})
+	}
+	reader.indexMu.RUnlock()
+	sort.Slice(records, func(i, j int) bool { return records[i].offset < records[j].offset })
+	report.IndexEntries = len(records)
+
+	for i, rec := range records {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		problem := QuarantinedEntity{ID: rec.id, Offset: rec.offset, Size: rec.size}
+
+		if end := rec.offset + uint64(rec.size); end > uint64(report.DataFileSize) {
+			report.IndexOutOfRange++
+			problem.Reason = QuarantineIndexOutOfRange
+			problem.Detail = fmt.Sprintf("record ends at %d past the %d byte file", end, report.DataFileSize)
+		} else if entity, err := reader.GetEntity(rec.id); err != nil {
+			report.Unreadable++
+			problem.Reason = QuarantineUnreadable
+			problem.Detail = err.Error()
+		} else if valid, expected := rm.ValidateChecksum(entity); !valid && expected != "" {
+			report.ChecksumMismatches++
+			problem.Reason = QuarantineChecksumMismatch
+			problem.Detail = "content does not match checksum " + expected
+		}
+		report.Examined++
+
+		if problem.Reason != "" {
+			problem.DetectedAt = time.Now()
+			quarantine.add(problem)
+		} else if quarantine.release(rec.id) {
+			report.Released++
+		}
+		if progress != nil {
+			var err error
+			if problem.Reason != "" {
+				err = errors.New(problem.Reason)
+			}
+			progress(i+1, len(records), rec.id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package binary
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"entitydb/config"
+	"entitydb/models"
+)
+
+// TestDiagnoseRecords checks that a diagnosis quarantines records that are
+// out of range or fail their checksum, and releases them once they pass
+func TestDiagnoseRecords(t *testing.T) {
+	var entities []*models.Entity
+	for i := 0; i < 5; i++ {
+		entities = append(entities, &models.Entity{
+			ID:      fmt.Sprintf("entity-%d", i),
+			Tags:    []string{"1|type:document"},
+			Content: []byte(fmt.Sprintf(`{"index":%d}`, i)),
+		})
+	}
+	path := writeTestEntities(t, entities)
+
+	// Flip a content byte of entity-1 on disk
+	reader, err := NewReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := reader.index["entity-1"]
+	data := make([]byte, entry.Size)
+	if _, err := reader.file.ReadAt(data, int64(entry.Offset)); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := parseEntityRecord(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentOffset := int64(entry.Offset) + int64(cap(data)-cap(rec.content))
+	reader.Close()
+	corrupt := func(b byte) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteAt([]byte{b}, contentOffset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	corrupt('[')
+
+	var quarantine entityQuarantine
+	outOfRange := true
+	diagnose := func() *RecoveryReport {
+		t.Helper()
+		reader, err := NewReader(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+		// An index entry pointing past the end of the file
+		if out, ok := reader.index["entity-3"]; ok && outOfRange {
+			out.Offset = 1 << 40
+		}
+		report := &RecoveryReport{}
+		rm := NewRecoveryManagerWithConfig(config.Load())
+		if err := diagnoseRecords(context.Background(), reader, rm, &quarantine, report, nil); err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	report := diagnose()
+	if report.Examined != 5 || report.ChecksumMismatches != 1 || report.IndexOutOfRange != 1 || report.Unreadable != 0 {
+		t.Fatalf("report = %+v, want 5 examined, 1 checksum mismatch and 1 out of range", report)
+	}
+	quarantined := quarantine.list()
+	reasons := map[string]string{}
+	for _, entity := range quarantined {
+		reasons[entity.ID] = entity.Reason
+	}
+	if len(quarantined) != 2 || reasons["entity-1"] != QuarantineChecksumMismatch || reasons["entity-3"] != QuarantineIndexOutOfRange {
+		t.Fatalf("quarantined %+v", quarantined)
+	}
+
+	// Once repaired, both are released
+	corrupt('{')
+	outOfRange = false
+	report = diagnose()
+	if report.Released != 2 || quarantine.len() != 0 {
+		t.Errorf("after repair released %d and kept %v in quarantine", report.Released, quarantine.list())
+	}
+}
@@ -73,7 +73,7 @@ func (f *RepositoryFactory) CreateRepository(cfg *config.Config) (models.EntityR
 	// Wrap with caching if enabled
 	if enableCache {
 		logger.Info("Wrapping repository with CachedRepository (TTL: %v)", cacheTTL)
-		return NewCachedRepository(baseRepo, cacheTTL), nil
+		return NewCachedRepository(baseRepo, cacheTTL, cfg.EntityCacheSize, cfg.EntityCacheMemoryLimit), nil
 	}
 	
 	return baseRepo, nil
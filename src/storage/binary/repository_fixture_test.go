@@ -0,0 +1,41 @@
+package binary
+
+import (
+	"path/filepath"
+	"testing"
+
+	"entitydb/config"
+)
+
+// newTestRepository opens a repository whose files live in a temporary
+// directory. configure, if set, adjusts the configuration before the
+// repository is opened. Callers close the repository; its configuration is
+// repo.config for tests that reopen or inspect the files.
+func newTestRepository(t *testing.T, configure func(*config.Config)) *EntityRepository {
+	t.Helper()
+	cfg := config.Load()
+	cfg.DataPath = t.TempDir()
+	cfg.DatabaseFilename = filepath.Join(cfg.DataPath, "entities.edb")
+	cfg.WALFilename = filepath.Join(cfg.DataPath, "entitydb.wal")
+	cfg.IndexFilename = filepath.Join(cfg.DataPath, "entities.edb.idx")
+	if configure != nil {
+		configure(cfg)
+	}
+	repo, err := NewEntityRepositoryWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	return repo
+}
+
+// flushWrites writes the queued batch, if any. Queued creates and tag
+// changes reach the indexes when their batch is written.
+func flushWrites(t *testing.T, repo *EntityRepository) {
+	t.Helper()
+	if repo.batchWriter == nil {
+		return
+	}
+	if err := repo.batchWriter.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+}
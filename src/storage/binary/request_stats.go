@@ -0,0 +1,103 @@
+package binary
+
+import (
+	"context"
+	"entitydb/models"
+	"sync/atomic"
+	"time"
+)
+
+// RequestStats accumulates the storage work done for one API request. The
+// context-aware repository methods record into the stats of their context;
+// callers record the index lookups of list and query calls.
+type RequestStats struct {
+	indexLookups    atomic.Int64
+	entitiesFetched atomic.Int64
+	cacheHits       atomic.Int64
+	diskReads       atomic.Int64
+	bytesRead       atomic.Int64
+	lockWait        atomic.Int64 // nanoseconds
+}
+
+// RequestStatsSnapshot is a point-in-time copy of RequestStats
+type RequestStatsSnapshot struct {
+	IndexLookups    int64         `json:"index_lookups"`
+	EntitiesFetched int64         `json:"entities_fetched"`
+	CacheHits       int64         `json:"cache_hits"`
+	DiskReads       int64         `json:"disk_reads"`
+	BytesRead       int64         `json:"bytes_read"`
+	LockWait        time.Duration `json:"lock_wait_ns"`
+}
+
+// requestStatsKey is the context key of a request's stats
+type requestStatsKey struct{}
+
+// WithRequestStats returns a context whose storage work is recorded in stats
+func WithRequestStats(ctx context.Context, stats *RequestStats) context.Context {
+	return context.WithValue(ctx, requestStatsKey{}, stats)
+}
+
+// RequestStatsFrom returns the stats of ctx, or nil. Recording into nil
+// stats does nothing.
+func RequestStatsFrom(ctx context.Context) *RequestStats {
+	stats, _ := ctx.Value(requestStatsKey{}).(*RequestStats)
+	return stats
+}
+
+// RecordIndexLookup records an index lookup that returned entities
+func (s *RequestStats) RecordIndexLookup(entities []*models.Entity) {
+	if s == nil {
+		return
+	}
+	s.indexLookups.Add(1)
+	s.entitiesFetched.Add(int64(len(entities)))
+	var size int64
+	for _, entity := range entities {
+		size += int64(len(entity.Content))
+	}
+	s.bytesRead.Add(size)
+}
+
+// recordCacheHit records an entity served from memory
+func (s *RequestStats) recordCacheHit() {
+	if s == nil {
+		return
+	}
+	s.entitiesFetched.Add(1)
+	s.cacheHits.Add(1)
+}
+
+// recordDiskRead records an entity read from the data file
+func (s *RequestStats) recordDiskRead(entity *models.Entity) {
+	if s == nil {
+		return
+	}
+	s.diskReads.Add(1)
+	if entity != nil {
+		s.entitiesFetched.Add(1)
+		s.bytesRead.Add(int64(len(entity.Content)))
+	}
+}
+
+// recordLockWait records time spent waiting for a lock since start
+func (s *RequestStats) recordLockWait(start time.Time) {
+	if s == nil {
+		return
+	}
+	s.lockWait.Add(int64(time.Since(start)))
+}
+
+// Snapshot copies the stats
+func (s *RequestStats) Snapshot() RequestStatsSnapshot {
+	if s == nil {
+		return RequestStatsSnapshot{}
+	}
+	return RequestStatsSnapshot{
+		IndexLookups:    s.indexLookups.Load(),
+		EntitiesFetched: s.entitiesFetched.Load(),
+		CacheHits:       s.cacheHits.Load(),
+		DiskReads:       s.diskReads.Load(),
+		BytesRead:       s.bytesRead.Load(),
+		LockWait:        time.Duration(s.lockWait.Load()),
+	}
+}
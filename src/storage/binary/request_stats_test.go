@@ -0,0 +1,50 @@
+package binary
+
+import (
+	"context"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestRequestStats checks that context-aware repository calls record their
+// storage work in the stats of their context
+func TestRequestStats(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	entity := models.NewEntity()
+	entity.AddTag("type:document")
+	entity.Content = []byte(`{"title":"stats"}`)
+	if err := repo.Create(entity); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &RequestStats{}
+	ctx := WithRequestStats(context.Background(), stats)
+	if _, err := repo.GetByIDContext(ctx, entity.ID); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := repo.ListByTag("type:document")
+	if err != nil {
+		t.Fatal(err)
+	}
+	RequestStatsFrom(ctx).RecordIndexLookup(listed)
+
+	got := stats.Snapshot()
+	if got.IndexLookups != 1 || got.EntitiesFetched != 2 || got.CacheHits+got.DiskReads != 1 {
+		t.Errorf("stats = %+v, want 1 lookup, 2 entities and 1 cache hit or disk read", got)
+	}
+	if got.BytesRead < int64(len(entity.Content)) {
+		t.Errorf("bytes read = %d, want at least %d", got.BytesRead, len(entity.Content))
+	}
+
+	// Calls without stats record nothing
+	if _, err := repo.GetByID(entity.ID); err != nil {
+		t.Fatal(err)
+	}
+	RequestStatsFrom(context.Background()).RecordIndexLookup(listed)
+	if after := stats.Snapshot(); after != got {
+		t.Errorf("stats changed to %+v outside the request", after)
+	}
+}
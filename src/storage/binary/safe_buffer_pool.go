@@ -3,26 +3,48 @@ package binary
 import (
 	"bytes"
 	"sync"
+	"sync/atomic"
 )
 
 // SafeBufferPool provides thread-safe buffer pooling with proper reset
 type SafeBufferPool struct {
 	pool sync.Pool
+	size int
+	
+	// Counters since the pool was created. The garbage collector may empty
+	// a sync.Pool at any time, so allocations keep growing slowly even when
+	// every buffer is returned.
+	gets        atomic.Int64
+	puts        atomic.Int64
+	allocations atomic.Int64
+	discarded   atomic.Int64
+}
+
+// BufferPoolStats describes the use of a buffer pool
+type BufferPoolStats struct {
+	Name        string  `json:"name"`
+	BufferSize  int     `json:"buffer_size"`
+	Gets        int64   `json:"gets"`
+	Puts        int64   `json:"puts"`
+	Allocations int64   `json:"allocations"`
+	Discarded   int64   `json:"discarded"`
+	Outstanding int64   `json:"outstanding"`
+	ReuseRatio  float64 `json:"reuse_ratio"`
 }
 
 // NewSafeBufferPool creates a new safe buffer pool
 func NewSafeBufferPool(size int) *SafeBufferPool {
-	return &SafeBufferPool{
-		pool: sync.Pool{
-			New: func() interface{} {
-				return bytes.NewBuffer(make([]byte, 0, size))
-			},
-		},
+	p := &SafeBufferPool{size: size}
+	p.pool.New = func() interface{} {
+		p.allocations.Add(1)
+		return bytes.NewBuffer(make([]byte, 0, size))
 	}
+	return p
 }
 
 // Get retrieves a buffer from the pool, properly reset
 func (p *SafeBufferPool) Get() *bytes.Buffer {
+	p.gets.Add(1)
 	buf := p.pool.Get().(*bytes.Buffer)
 	buf.Reset() // Always reset before use
 	return buf
@@ -30,8 +52,10 @@ func (p *SafeBufferPool) Get() *bytes.Buffer {
 
 // Put returns a buffer to the pool
 func (p *SafeBufferPool) Put(buf *bytes.Buffer) {
+	p.puts.Add(1)
 	// Only pool reasonable sized buffers
 	if buf.Cap() > 10*1024*1024 { // 10MB limit
+		p.discarded.Add(1)
 		return
 	}
 	// Reset before putting back
@@ -39,6 +63,28 @@ func (p *SafeBufferPool) Put(buf *bytes.Buffer) {
 	p.pool.Put(buf)
 }
 
+// Stats returns the pool's counters under the given name. Outstanding is
+// the number of buffers taken and not yet returned; the reuse ratio is the
+// fraction of gets served without allocating.
+func (p *SafeBufferPool) Stats(name string) BufferPoolStats {
+	gets := p.gets.Load()
+	puts := p.puts.Load()
+	allocations := p.allocations.Load()
+	stats := BufferPoolStats{
+		Name:        name,
+		BufferSize:  p.size,
+		Gets:        gets,
+		Puts:        puts,
+		Allocations: allocations,
+		Discarded:   p.discarded.Load(),
+		Outstanding: max(gets-puts, 0),
+	}
+	if gets > 0 {
+		stats.ReuseRatio = float64(max(gets-allocations, 0)) / float64(gets)
+	}
+	return stats
+}
+
 // Global pools for different use cases
 var (
 	// smallSafeBufferPool for small operations (4KB)
@@ -51,6 +97,16 @@ var (
 	largeSafeBufferPool = NewSafeBufferPool(1024 * 1024)
 )
 
+// BufferPoolsStats returns the statistics of the shared small, medium and
+// large buffer pools
+func BufferPoolsStats() []BufferPoolStats {
+	return []BufferPoolStats{
+		smallSafeBufferPool.Stats("small"),
+		mediumSafeBufferPool.Stats("medium"),
+		largeSafeBufferPool.Stats("large"),
+	}
+}
+
 // GetSmallBuffer gets a small buffer from the safe pool
 func GetSmallBuffer() *bytes.Buffer {
 	return smallSafeBufferPool.Get()
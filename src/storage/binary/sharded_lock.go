@@ -42,6 +42,24 @@ const (
 //   entities := index.GetEntitiesForTag("type:user")
 type ShardedTagIndex struct {
 	shards [NumShards]*TagIndexShard
+	
+	// Soft-deleted entities stay indexed under their tags but are skipped
+	// by lookups, so active-only queries cost the same as unfiltered ones
+	// and restoring an entity only clears its entry here.
+	deletedMu sync.RWMutex
+	deleted   map[string]struct{}
+	
+	// Values per namespace with entity counts, for prefix suggestions
+	values *TagValueIndex
+	
+	// Typed relationships declared by rel: tags, in both directions
+	edges *AdjacencyIndex
+	
+	// Approximate bytes held by the tag map and deleted set
+	memBytes int64
+	
+	// Spill file for cold posting lists (nil without a memory budget)
+	spill *tagSpillFile
 }
 
 // TagIndexShard represents a single shard of the tag index.
@@ -51,6 +69,12 @@ type TagIndexShard struct {
 	mu       sync.RWMutex        // Protects tag map access
 	tags     map[string][]string // tag -> entity IDs mapping
 	queue    *FairQueue          // Ensures fair reader/writer access
+	
+	// With a memory budget: tags whose entity IDs were spilled to disk, and
+	// the spill pass in which each resident tag was last read
+	spilled  map[string]tagSpillRef
+	accessMu sync.Mutex // Protects lastRead, which readers update
+	lastRead map[string]uint32
 }
 
 // FairQueue implements fair scheduling between readers and writers
@@ -73,7 +97,11 @@ type FairQueue struct {
 
 // NewShardedTagIndex creates a new sharded tag index
 func NewShardedTagIndex() *ShardedTagIndex {
-	index := &ShardedTagIndex{}
+	index := &ShardedTagIndex{
+		deleted: make(map[string]struct{}),
+		values:  NewTagValueIndex(),
+		edges:   NewAdjacencyIndex(),
+	}
 	for i := 0; i < NumShards; i++ {
 		index.shards[i] = &TagIndexShard{
 			tags:  make(map[string][]string),
@@ -101,10 +129,79 @@ func NewFairQueue() *FairQueue {
 //
 // Performance: O(len(tag)) for hash calculation
 func (s *ShardedTagIndex) getShard(tag string) *TagIndexShard {
+	return s.shards[tagShardIndex(tag)]
+}
+
+// tagShardIndex returns the number of the shard owning a tag
+func tagShardIndex(tag string) int {
 	h := fnv.New32a()
 	h.Write([]byte(tag))
-	shardIdx := h.Sum32() & (NumShards - 1)
-	return s.shards[shardIdx]
+	return int(h.Sum32() & (NumShards - 1))
+}
+
+// LoadPostings adds posting lists in bulk, one goroutine per group of
+// shards. postings[i] holds the tags of shard i with entity IDs to add. It
+// is equivalent to calling AddTag for every pair, without the per-add
+// duplicate scan that makes loading large tags quadratic.
+func (s *ShardedTagIndex) LoadPostings(postings []map[string][]string, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(postings) || i >= NumShards {
+					return
+				}
+				if len(postings[i]) > 0 {
+					s.loadShardPostings(s.shards[i], postings[i])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	s.maybeSpill()
+}
+
+// loadShardPostings adds the posting lists of one shard under a single lock
+func (s *ShardedTagIndex) loadShardPostings(shard *TagIndexShard, postings map[string][]string) {
+	shard.queue.AcquireWrite()
+	defer shard.queue.ReleaseWrite()
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	
+	var added int64
+	for tag, ids := range postings {
+		if s.spill != nil {
+			s.loadLocked(shard, tag)
+		}
+		existing, ok := shard.tags[tag]
+		if !ok {
+			added += mapEntryBytes + stringBytes(tag) + sliceHeaderBytes
+		}
+		present := make(map[string]struct{}, len(existing)+len(ids))
+		for _, id := range existing {
+			present[id] = struct{}{}
+		}
+		before := len(existing)
+		for _, id := range ids {
+			if _, dup := present[id]; dup {
+				continue
+			}
+			present[id] = struct{}{}
+			existing = append(existing, id)
+			added += stringBytes(id)
+			s.edges.add(tag, id)
+		}
+		shard.tags[tag] = existing
+		s.values.adjust(tag, len(existing)-before)
+	}
+	atomic.AddInt64(&s.memBytes, added)
 }
 
 // AddTag associates an entity ID with a tag in the index.
@@ -132,8 +229,13 @@ func (s *ShardedTagIndex) AddTag(tag string, entityID string) {
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 	
+	if s.spill != nil {
+		s.loadLocked(shard, tag)
+		defer s.maybeSpill()
+	}
 	if shard.tags[tag] == nil {
 		shard.tags[tag] = make([]string, 0, 1)
+		atomic.AddInt64(&s.memBytes, mapEntryBytes+stringBytes(tag)+sliceHeaderBytes)
 	}
 	
 	// Check if entity already exists for this tag
@@ -144,11 +246,28 @@ func (s *ShardedTagIndex) AddTag(tag string, entityID string) {
 	}
 	
 	shard.tags[tag] = append(shard.tags[tag], entityID)
+	atomic.AddInt64(&s.memBytes, stringBytes(entityID))
+	s.values.adjust(tag, 1)
+	s.edges.add(tag, entityID)
 }
 
-// GetEntitiesForTag returns all entity IDs for a given tag
+// GetEntitiesForTag returns the IDs of active entities for a given tag.
+// Entities marked deleted are excluded.
 func (s *ShardedTagIndex) GetEntitiesForTag(tag string) []string {
+	return s.getEntitiesForTag(tag, false)
+}
+
+// GetEntitiesForTagIncludingDeleted returns all entity IDs for a given tag,
+// including entities marked deleted
+func (s *ShardedTagIndex) GetEntitiesForTagIncludingDeleted(tag string) []string {
+	return s.getEntitiesForTag(tag, true)
+}
+
+func (s *ShardedTagIndex) getEntitiesForTag(tag string, includeDeleted bool) []string {
 	shard := s.getShard(tag)
+	if s.spill != nil {
+		s.loadForRead(shard, tag)
+	}
 	
 	// Use fair queue for read access
 	shard.queue.AcquireRead()
@@ -157,14 +276,80 @@ func (s *ShardedTagIndex) GetEntitiesForTag(tag string) []string {
 	shard.mu.RLock()
 	defer shard.mu.RUnlock()
 	
-	entities := shard.tags[tag]
+	// A list spilled again since loadForRead is read from disk
+	entities, _ := s.postings(shard, tag)
 	if entities == nil {
 		return []string{}
 	}
+	if s.spill != nil {
+		s.noteRead(shard, tag)
+	}
 	
 	// Return a copy to avoid race conditions
-	result := make([]string, len(entities))
-	copy(result, entities)
+	if includeDeleted {
+		result := make([]string, len(entities))
+		copy(result, entities)
+		return result
+	}
+	return s.FilterDeleted(entities)
+}
+
+// MarkDeleted excludes an entity from tag lookups. Returns true if the
+// entity was not already marked.
+func (s *ShardedTagIndex) MarkDeleted(entityID string) bool {
+	s.deletedMu.Lock()
+	defer s.deletedMu.Unlock()
+	
+	if _, exists := s.deleted[entityID]; exists {
+		return false
+	}
+	s.deleted[entityID] = struct{}{}
+	atomic.AddInt64(&s.memBytes, mapEntryBytes+stringBytes(entityID))
+	return true
+}
+
+// MarkActive makes a previously deleted entity visible to tag lookups again.
+// Returns true if the entity was marked deleted.
+func (s *ShardedTagIndex) MarkActive(entityID string) bool {
+	s.deletedMu.Lock()
+	defer s.deletedMu.Unlock()
+	
+	if _, exists := s.deleted[entityID]; !exists {
+		return false
+	}
+	delete(s.deleted, entityID)
+	atomic.AddInt64(&s.memBytes, -(mapEntryBytes + stringBytes(entityID)))
+	return true
+}
+
+// IsDeleted reports whether an entity is excluded from tag lookups
+func (s *ShardedTagIndex) IsDeleted(entityID string) bool {
+	s.deletedMu.RLock()
+	defer s.deletedMu.RUnlock()
+	
+	_, exists := s.deleted[entityID]
+	return exists
+}
+
+// DeletedCount returns the number of entities excluded from tag lookups
+func (s *ShardedTagIndex) DeletedCount() int {
+	s.deletedMu.RLock()
+	defer s.deletedMu.RUnlock()
+	
+	return len(s.deleted)
+}
+
+// FilterDeleted returns a copy of ids without the entities marked deleted
+func (s *ShardedTagIndex) FilterDeleted(ids []string) []string {
+	s.deletedMu.RLock()
+	defer s.deletedMu.RUnlock()
+	
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, deleted := s.deleted[id]; !deleted {
+			result = append(result, id)
+		}
+	}
 	return result
 }
 
@@ -179,6 +364,9 @@ func (s *ShardedTagIndex) RemoveTag(tag string, entityID string) {
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 	
+	if s.spill != nil {
+		s.loadLocked(shard, tag)
+	}
 	entities := shard.tags[tag]
 	if entities == nil {
 		return // Tag doesn't exist
@@ -192,14 +380,93 @@ func (s *ShardedTagIndex) RemoveTag(tag string, entityID string) {
 		}
 	}
 	
+	freed := int64(len(entities)-len(newEntities)) * stringBytes(entityID)
 	if len(newEntities) > 0 {
 		shard.tags[tag] = newEntities
 	} else {
 		// Remove the tag entirely if no entities left
 		delete(shard.tags, tag)
+		freed += mapEntryBytes + stringBytes(tag) + sliceHeaderBytes
+	}
+	atomic.AddInt64(&s.memBytes, -freed)
+	s.values.adjust(tag, len(newEntities)-len(entities))
+	if len(newEntities) < len(entities) {
+		s.edges.remove(tag, entityID)
 	}
 }
 
+// EntityIDs returns the IDs of all entities present in the index, including
+// entities marked deleted
+func (s *ShardedTagIndex) EntityIDs() []string {
+	seen := make(map[string]struct{})
+	for _, shard := range s.shards {
+		shard.queue.AcquireRead()
+		shard.mu.RLock()
+		s.forEachPostings(shard, func(_ string, entities []string) {
+			for _, id := range entities {
+				seen[id] = struct{}{}
+			}
+		})
+		shard.mu.RUnlock()
+		shard.queue.ReleaseRead()
+	}
+	
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// RemoveEntities removes a set of entities from every tag in one pass over
+// all shards. Use it instead of RemoveTag when the tags are not known.
+func (s *ShardedTagIndex) RemoveEntities(entityIDs map[string]struct{}) {
+	if len(entityIDs) == 0 {
+		return
+	}
+	for _, shard := range s.shards {
+		shard.queue.AcquireWrite()
+		shard.mu.Lock()
+		for tag := range shard.spilled {
+			if ids, ok := s.postings(shard, tag); ok && containsAny(ids, entityIDs) {
+				s.loadLocked(shard, tag)
+			}
+		}
+		for tag, entities := range shard.tags {
+			var freed int64
+			kept := entities[:0]
+			for _, id := range entities {
+				if _, remove := entityIDs[id]; !remove {
+					kept = append(kept, id)
+				} else {
+					freed += stringBytes(id)
+					s.edges.remove(tag, id)
+				}
+			}
+			removed := len(entities) - len(kept)
+			if len(kept) > 0 {
+				shard.tags[tag] = kept
+			} else {
+				delete(shard.tags, tag)
+				freed += mapEntryBytes + stringBytes(tag) + sliceHeaderBytes
+			}
+			atomic.AddInt64(&s.memBytes, -freed)
+			s.values.adjust(tag, -removed)
+		}
+		shard.mu.Unlock()
+		shard.queue.ReleaseWrite()
+	}
+	
+	s.deletedMu.Lock()
+	for id := range entityIDs {
+		if _, exists := s.deleted[id]; exists {
+			delete(s.deleted, id)
+			atomic.AddInt64(&s.memBytes, -(mapEntryBytes + stringBytes(id)))
+		}
+	}
+	s.deletedMu.Unlock()
+}
+
 // GetAllTags returns all tags in the index (for backward compatibility)
 // This should be avoided in hot paths as it locks all shards
 func (s *ShardedTagIndex) GetAllTags() map[string][]string {
@@ -213,9 +480,9 @@ func (s *ShardedTagIndex) GetAllTags() map[string][]string {
 	
 	// Copy all data
 	for _, shard := range s.shards {
-		for tag, entities := range shard.tags {
+		s.forEachPostings(shard, func(tag string, entities []string) {
 			result[tag] = append([]string(nil), entities...)
-		}
+		})
 	}
 	
 	// Unlock all shards
@@ -323,11 +590,21 @@ func (q *FairQueue) ReleaseWrite() {
 	}
 }
 
-// OptimizedListByTag performs an optimized tag lookup using sharding
+// OptimizedListByTag performs an optimized tag lookup using sharding.
+// Entities marked deleted are excluded.
 func (s *ShardedTagIndex) OptimizedListByTag(tag string, fullScan bool) []string {
+	return s.optimizedListByTag(tag, fullScan, false)
+}
+
+// OptimizedListByTagIncludingDeleted is OptimizedListByTag including entities marked deleted
+func (s *ShardedTagIndex) OptimizedListByTagIncludingDeleted(tag string, fullScan bool) []string {
+	return s.optimizedListByTag(tag, fullScan, true)
+}
+
+func (s *ShardedTagIndex) optimizedListByTag(tag string, fullScan bool, includeDeleted bool) []string {
 	if !fullScan {
 		// Direct lookup for exact tag match
-		return s.GetEntitiesForTag(tag)
+		return s.getEntitiesForTag(tag, includeDeleted)
 	}
 	
 	// For pattern matching, we still need to scan, but we can parallelize
@@ -349,6 +626,13 @@ func (s *ShardedTagIndex) OptimizedListByTag(tag string, fullScan bool) []string
 					localResults = append(localResults, entities...)
 				}
 			}
+			for t := range sh.spilled {
+				if t == tag || matchesPattern(t, tag) {
+					if entities, ok := s.postings(sh, t); ok {
+						localResults = append(localResults, entities...)
+					}
+				}
+			}
 			
 			sh.mu.RUnlock()
 			sh.queue.ReleaseRead()
@@ -378,7 +662,10 @@ func (s *ShardedTagIndex) OptimizedListByTag(tag string, fullScan bool) []string
 		}
 	}
 	
-	return allResults
+	if includeDeleted {
+		return allResults
+	}
+	return s.FilterDeleted(allResults)
 }
 
 // matchesPattern checks if a tag matches a pattern (simple implementation)
@@ -400,6 +687,12 @@ func matchesPattern(tag, pattern string) bool {
 	return false
 }
 
+// MemoryBytes returns the approximate bytes held by the tag map and the
+// deleted set, excluding the tag value and adjacency indexes
+func (s *ShardedTagIndex) MemoryBytes() int64 {
+	return atomic.LoadInt64(&s.memBytes)
+}
+
 // GetShardStats returns statistics about shard distribution
 func (s *ShardedTagIndex) GetShardStats() map[string]interface{} {
 	stats := make(map[string]interface{})
@@ -411,7 +704,7 @@ func (s *ShardedTagIndex) GetShardStats() map[string]interface{} {
 	
 	for i, shard := range s.shards {
 		shard.mu.RLock()
-		count := len(shard.tags)
+		count := len(shard.tags) + len(shard.spilled)
 		shard.mu.RUnlock()
 		
 		distribution[i] = count
@@ -429,10 +722,45 @@ func (s *ShardedTagIndex) GetShardStats() map[string]interface{} {
 	stats["max_tags_per_shard"] = maxTags
 	stats["min_tags_per_shard"] = minTags
 	stats["avg_tags_per_shard"] = totalTags / NumShards
+	stats["deleted_entities"] = s.DeletedCount()
 	
 	return stats
 }
 
+// TagIndexShardStats describes one shard of the tag index. Memory covers the
+// posting lists held in memory; spilled posting lists only count towards
+// the tags and postings.
+type TagIndexShardStats struct {
+	Shard       int   `json:"shard"`
+	Tags        int   `json:"tags"`
+	SpilledTags int   `json:"spilled_tags"`
+	Postings    int   `json:"postings"`
+	MemoryBytes int64 `json:"memory_bytes"`
+}
+
+// ShardStats returns the tag count, posting count and approximate memory of
+// every shard, in shard order. Each shard is read under its own lock, so the
+// figures of different shards may be from slightly different moments.
+func (s *ShardedTagIndex) ShardStats() []TagIndexShardStats {
+	stats := make([]TagIndexShardStats, NumShards)
+	for i, shard := range s.shards {
+		shardStats := TagIndexShardStats{Shard: i}
+		shard.mu.RLock()
+		for tag, ids := range shard.tags {
+			shardStats.Postings += len(ids)
+			shardStats.MemoryBytes += mapEntryBytes + stringBytes(tag) + sliceHeaderBytes + stringsBytes(ids)
+		}
+		for _, ref := range shard.spilled {
+			shardStats.Postings += int(ref.count)
+		}
+		shardStats.SpilledTags = len(shard.spilled)
+		shardStats.Tags = len(shard.tags) + shardStats.SpilledTags
+		shard.mu.RUnlock()
+		stats[i] = shardStats
+	}
+	return stats
+}
+
 // ToMap converts the sharded index to a regular map for persistence
 func (idx *ShardedTagIndex) ToMap() map[string][]string {
 	result := make(map[string][]string)
@@ -440,9 +768,9 @@ func (idx *ShardedTagIndex) ToMap() map[string][]string {
 	// Collect all tags from all shards
 	for _, shard := range idx.shards {
 		shard.mu.RLock()
-		for tag, entities := range shard.tags {
+		idx.forEachPostings(shard, func(tag string, entities []string) {
 			result[tag] = append(result[tag], entities...)
-		}
+		})
 		shard.mu.RUnlock()
 	}
 	
@@ -458,6 +786,9 @@ func (idx *ShardedTagIndex) GetEntryCount() int {
 		for _, entityIDs := range shard.tags {
 			count += len(entityIDs)
 		}
+		for _, ref := range shard.spilled {
+			count += int(ref.count)
+		}
 		shard.mu.RUnlock()
 	}
 	return count
@@ -468,15 +799,19 @@ func (idx *ShardedTagIndex) HasEntity(entityID string) bool {
 	for i := 0; i < NumShards; i++ {
 		shard := idx.shards[i]
 		shard.mu.RLock()
-		for _, entityIDs := range shard.tags {
+		found := false
+		idx.forEachPostings(shard, func(_ string, entityIDs []string) {
 			for _, id := range entityIDs {
 				if id == entityID {
-					shard.mu.RUnlock()
-					return true
+					found = true
+					return
 				}
 			}
-		}
+		})
 		shard.mu.RUnlock()
+		if found {
+			return true
+		}
 	}
 	return false
 }
@@ -212,9 +212,9 @@ func (swq *SingleWriterQueue) processOperation(op *WriteOperation) error {
 	var err error
 	switch op.Type {
 	case OpCreate:
-		err = swq.repo.createInternal(op.Entity)
+		err = swq.repo.createInternal(op.Context, op.Entity)
 	case OpUpdate:
-		err = swq.repo.updateInternal(op.Entity)
+		err = swq.repo.updateInternal(op.Context, op.Entity)
 	case OpAddTag:
 		err = swq.repo.addTagInternal(op.EntityID, op.Tag)
 	case OpDelete:
@@ -272,13 +272,14 @@ func (swq *SingleWriterQueue) Enqueue(op *WriteOperation) error {
 }
 
 // CreateEntity queues an entity creation
-func (swq *SingleWriterQueue) CreateEntity(entity *models.Entity) error {
+func (swq *SingleWriterQueue) CreateEntity(ctx context.Context, entity *models.Entity) error {
 	op := &WriteOperation{
 		Type:     OpCreate,
 		Entity:   entity,
 		EntityID: entity.ID,
 		Done:     make(chan error, 1),
-		Context:  context.Background(),
+		// Keep the caller's trace but not its cancellation
+		Context:  context.WithoutCancel(ctx),
 	}
 	
 	if err := swq.Enqueue(op); err != nil {
@@ -295,13 +296,14 @@ func (swq *SingleWriterQueue) CreateEntity(entity *models.Entity) error {
 }
 
 // UpdateEntity queues an entity update
-func (swq *SingleWriterQueue) UpdateEntity(entity *models.Entity) error {
+func (swq *SingleWriterQueue) UpdateEntity(ctx context.Context, entity *models.Entity) error {
 	op := &WriteOperation{
 		Type:     OpUpdate,
 		Entity:   entity,
 		EntityID: entity.ID,
 		Done:     make(chan error, 1),
-		Context:  context.Background(),
+		// Keep the caller's trace but not its cancellation
+		Context:  context.WithoutCancel(ctx),
 	}
 	
 	if err := swq.Enqueue(op); err != nil {
@@ -0,0 +1,413 @@
+package binary
+
+import (
+	"context"
+	"crypto/ed25519"
+	"entitydb/config"
+	"entitydb/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Scheduled snapshots
+//
+// A snapshot is a copy of the database file taken right after a checkpoint
+// while appends are held off, so unlike a routine backup it always has a
+// complete header and index and needs no WAL replay. Snapshots are named
+// after the database with the time they were taken, pruned by count and
+// age, and restored offline with --snapshot-restore.
+
+// snapshotMarker appears in the names of snapshots of the database file
+const snapshotMarker = ".snapshot-"
+
+// snapshotTimeLayout is the time format of snapshot names
+const snapshotTimeLayout = "20060102-150405.000000"
+
+// SnapshotSchedulerConfig configures scheduled snapshots
+type SnapshotSchedulerConfig struct {
+	// Path is the directory snapshots are written to
+	Path string
+
+	// Interval determines how often a snapshot is taken
+	Interval time.Duration
+
+	// Keep is the number of snapshots kept (0 = no limit)
+	Keep int
+
+	// MaxAge is the age after which snapshots are deleted (0 = no limit)
+	MaxAge time.Duration
+
+	// Manifest writes a backup manifest next to each snapshot, signed with
+	// the key in SigningKey when set
+	Manifest   bool
+	SigningKey string
+}
+
+// SnapshotInfo describes a snapshot on disk
+type SnapshotInfo struct {
+	Name      string        `json:"name"`
+	Path      string        `json:"path"`
+	SizeBytes int64         `json:"size_bytes"`
+	TakenAt   time.Time     `json:"taken_at"`
+	Entities  uint64        `json:"entities,omitempty"`
+	Duration  time.Duration `json:"duration_ns,omitempty"`
+	Manifest  bool          `json:"manifest"`
+}
+
+// SnapshotStats counts the snapshots taken since startup
+type SnapshotStats struct {
+	Taken          int64         `json:"taken"`
+	Failed         int64         `json:"failed"`
+	Pruned         int64         `json:"pruned"`
+	LastSnapshotAt time.Time     `json:"last_snapshot_at,omitempty"`
+	LastDuration   time.Duration `json:"last_duration_ns"`
+	LastSizeBytes  int64         `json:"last_size_bytes"`
+	LastError      string        `json:"last_error,omitempty"`
+	TotalDuration  time.Duration `json:"total_duration_ns"`
+	Retained       int           `json:"retained"`
+}
+
+// Snapshot writes a consistent copy of the database into dir. Writes queued
+// in the batch writer are applied first; writes arriving while the file is
+// copied wait for it.
+func (r *EntityRepository) Snapshot(dir string) (*SnapshotInfo, error) {
+	start := time.Now()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create snapshot directory: %w", err)
+	}
+	if r.batchWriter != nil {
+		if err := r.batchWriter.Flush(); err != nil {
+			return nil, fmt.Errorf("error flushing batch writer: %w", err)
+		}
+	}
+
+	name := filepath.Base(r.getDataFile()) + snapshotMarker + start.UTC().Format(snapshotTimeLayout)
+	path := filepath.Join(dir, name)
+	// The snapshot only appears under its name once complete, so a partial
+	// copy is never listed or restored
+	if err := r.writerManager.Snapshot(path + ".tmp"); err != nil {
+		os.Remove(path + ".tmp")
+		return nil, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return nil, err
+	}
+
+	info, err := readSnapshotInfo(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	info.Duration = time.Since(start)
+	return info, nil
+}
+
+// ListSnapshots returns the snapshots in dir, newest first
+func ListSnapshots(dir string) ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []SnapshotInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []SnapshotInfo{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isSnapshotName(name) {
+			continue
+		}
+		info, err := readSnapshotInfo(dir, name)
+		if err != nil {
+			logger.Warn("Skipping snapshot %s: %v", name, err)
+			continue
+		}
+		snapshots = append(snapshots, *info)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].TakenAt.After(snapshots[j].TakenAt) })
+	return snapshots, nil
+}
+
+// isSnapshotName reports whether a file name belongs to a complete snapshot
+func isSnapshotName(name string) bool {
+	return strings.Contains(name, snapshotMarker) && !strings.HasSuffix(name, ".tmp") &&
+		!strings.HasSuffix(name, ".scan") && !isBackupManifest(name)
+}
+
+// readSnapshotInfo describes a snapshot from its name and header. The time
+// in the name is used over the modification time, which copying the
+// snapshot elsewhere and back changes.
+func readSnapshotInfo(dir, name string) (*SnapshotInfo, error) {
+	path := filepath.Join(dir, name)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &SnapshotInfo{Name: name, Path: path, SizeBytes: stat.Size(), TakenAt: stat.ModTime()}
+	stamp := name[strings.LastIndex(name, snapshotMarker)+len(snapshotMarker):]
+	if takenAt, err := time.Parse(snapshotTimeLayout, stamp); err == nil {
+		info.TakenAt = takenAt
+	}
+	header := &Header{}
+	if err := header.Read(file); err == nil {
+		info.Entities = header.EntityCount
+	}
+	if _, err := os.Stat(BackupManifestPath(path)); err == nil {
+		info.Manifest = true
+	}
+	return info, nil
+}
+
+// SnapshotScheduler takes snapshots of the repository on an interval and
+// prunes old ones
+type SnapshotScheduler struct {
+	repo   *EntityRepository
+	config SnapshotSchedulerConfig
+
+	running  int32
+	stopChan chan struct{}
+	runMu    sync.Mutex
+
+	mu    sync.RWMutex
+	stats SnapshotStats
+}
+
+// NewSnapshotScheduler creates a snapshot scheduler
+func NewSnapshotScheduler(repo *EntityRepository, cfg SnapshotSchedulerConfig) *SnapshotScheduler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	return &SnapshotScheduler{
+		repo:     repo,
+		config:   cfg,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins taking scheduled snapshots
+func (ss *SnapshotScheduler) Start() error {
+	if !atomic.CompareAndSwapInt32(&ss.running, 0, 1) {
+		return fmt.Errorf("snapshot scheduler already running")
+	}
+
+	go ss.loop()
+	logger.Info("Snapshot scheduler started (path: %s, interval: %v, keep: %d)",
+		ss.config.Path, ss.config.Interval, ss.config.Keep)
+	return nil
+}
+
+// Stop ends scheduled snapshots
+func (ss *SnapshotScheduler) Stop() error {
+	if !atomic.CompareAndSwapInt32(&ss.running, 1, 0) {
+		return fmt.Errorf("snapshot scheduler not running")
+	}
+
+	close(ss.stopChan)
+	logger.Info("Snapshot scheduler stopped")
+	return nil
+}
+
+// IsRunning reports whether scheduled snapshots are active
+func (ss *SnapshotScheduler) IsRunning() bool {
+	return atomic.LoadInt32(&ss.running) == 1
+}
+
+func (ss *SnapshotScheduler) loop() {
+	ticker := time.NewTicker(ss.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ss.TakeSnapshot()
+		case <-ss.stopChan:
+			return
+		}
+	}
+}
+
+// Path returns the snapshot directory
+func (ss *SnapshotScheduler) Path() string {
+	return ss.config.Path
+}
+
+// Stats returns the snapshot counters
+func (ss *SnapshotScheduler) Stats() SnapshotStats {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.stats
+}
+
+// Snapshots returns the snapshots on disk, newest first
+func (ss *SnapshotScheduler) Snapshots() ([]SnapshotInfo, error) {
+	return ListSnapshots(ss.config.Path)
+}
+
+// TakeSnapshot takes a snapshot now, writes its manifest and prunes old
+// snapshots
+func (ss *SnapshotScheduler) TakeSnapshot() (*SnapshotInfo, error) {
+	ss.runMu.Lock()
+	defer ss.runMu.Unlock()
+
+	info, err := ss.repo.Snapshot(ss.config.Path)
+	if err != nil {
+		logger.Error("Snapshot failed: %v", err)
+		ss.mu.Lock()
+		ss.stats.Failed++
+		ss.stats.LastError = err.Error()
+		ss.mu.Unlock()
+		return nil, err
+	}
+
+	// A missing manifest leaves the snapshot usable, so failures are only logged
+	if ss.config.Manifest {
+		if err := ss.writeManifest(info.Path); err != nil {
+			logger.Warn("Failed to write manifest for snapshot %s: %v", info.Name, err)
+		} else {
+			info.Manifest = true
+		}
+	}
+
+	pruned, retained := ss.prune()
+	logger.Info("Snapshot %s taken in %v (%d bytes, %d entities)", info.Name, info.Duration, info.SizeBytes, info.Entities)
+
+	ss.mu.Lock()
+	ss.stats.Taken++
+	ss.stats.Pruned += int64(pruned)
+	ss.stats.LastSnapshotAt = info.TakenAt
+	ss.stats.LastDuration = info.Duration
+	ss.stats.LastSizeBytes = info.SizeBytes
+	ss.stats.LastError = ""
+	ss.stats.TotalDuration += info.Duration
+	ss.stats.Retained = retained
+	ss.mu.Unlock()
+	return info, nil
+}
+
+// writeManifest writes the manifest of a snapshot
+func (ss *SnapshotScheduler) writeManifest(path string) error {
+	var key ed25519.PrivateKey
+	if ss.config.SigningKey != "" {
+		var err error
+		if key, err = LoadBackupSigningKey(ss.config.SigningKey); err != nil {
+			return fmt.Errorf("load signing key: %w", err)
+		}
+	}
+	_, err := WriteBackupManifest(path, path+".scan", key)
+	return err
+}
+
+// prune deletes the snapshots beyond the configured count or older than
+// the maximum age, always keeping the newest, and returns how many were
+// deleted and how many remain
+func (ss *SnapshotScheduler) prune() (int, int) {
+	snapshots, err := ListSnapshots(ss.config.Path)
+	if err != nil {
+		logger.Warn("Cannot list snapshots for pruning: %v", err)
+		return 0, 0
+	}
+
+	pruned := 0
+	for i, snapshot := range snapshots {
+		if i == 0 {
+			continue
+		}
+		overCount := ss.config.Keep > 0 && i >= ss.config.Keep
+		tooOld := ss.config.MaxAge > 0 && time.Since(snapshot.TakenAt) > ss.config.MaxAge
+		if !overCount && !tooOld {
+			continue
+		}
+		if err := os.Remove(snapshot.Path); err != nil {
+			logger.Warn("Failed to delete snapshot %s: %v", snapshot.Name, err)
+			continue
+		}
+		os.Remove(BackupManifestPath(snapshot.Path))
+		logger.Debug("Deleted snapshot %s", snapshot.Name)
+		pruned++
+	}
+	return pruned, len(snapshots) - pruned
+}
+
+// SnapshotRestoreReport describes restoring a snapshot over the database
+type SnapshotRestoreReport struct {
+	Snapshot string `json:"snapshot"`
+	Database string `json:"database"`
+	Restored bool   `json:"restored"`
+
+	// PreviousDatabase is where the replaced database file was kept
+	PreviousDatabase string `json:"previous_database,omitempty"`
+
+	// Check is the consistency check of the snapshot, made before restoring
+	Check *FsckReport `json:"check"`
+}
+
+// RestoreSnapshot replaces the database file with a snapshot, which must
+// pass a consistency check first. The server must not be running. A
+// snapshot not found as given is looked up by name in the snapshot
+// directory; the replaced database is kept next to it.
+func RestoreSnapshot(ctx context.Context, cfg *config.Config, snapshot string) (*SnapshotRestoreReport, error) {
+	if _, err := os.Stat(snapshot); err != nil {
+		snapshot = filepath.Join(cfg.SnapshotFullPath(), filepath.Base(snapshot))
+		if _, err := os.Stat(snapshot); err != nil {
+			return nil, fmt.Errorf("snapshot %s not found", filepath.Base(snapshot))
+		}
+	}
+	report := &SnapshotRestoreReport{Snapshot: snapshot, Database: cfg.DatabaseFilename}
+
+	checkConfig := *cfg
+	checkConfig.DatabaseFilename = snapshot
+	check, err := CheckDatabase(ctx, &checkConfig, FsckOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot check snapshot: %w", err)
+	}
+	report.Check = check
+	if !check.Healthy {
+		return report, nil
+	}
+
+	// Copy first so a failed copy leaves the database in place
+	staged := cfg.DatabaseFilename + ".restore.tmp"
+	if err := copySyncedFile(snapshot, staged); err != nil {
+		os.Remove(staged)
+		return nil, fmt.Errorf("copy snapshot: %w", err)
+	}
+	if _, err := os.Stat(cfg.DatabaseFilename); err == nil {
+		report.PreviousDatabase = cfg.DatabaseFilename + ".pre-restore-" + time.Now().UTC().Format("20060102-150405")
+		if err := os.Rename(cfg.DatabaseFilename, report.PreviousDatabase); err != nil {
+			os.Remove(staged)
+			return nil, fmt.Errorf("keep current database: %w", err)
+		}
+	}
+	if err := os.Rename(staged, cfg.DatabaseFilename); err != nil {
+		return nil, fmt.Errorf("replace database: %w", err)
+	}
+	report.Restored = true
+	logger.Info("Restored snapshot %s over %s", filepath.Base(snapshot), cfg.DatabaseFilename)
+	return report, nil
+}
+
+// copySyncedFile copies a file and syncs the copy to disk
+func copySyncedFile(src, dst string) error {
+	if err := copyFileForWAL(src, dst); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(dst, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
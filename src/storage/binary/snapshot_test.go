@@ -0,0 +1,108 @@
+package binary
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"entitydb/config"
+	"entitydb/models"
+)
+
+// TestSnapshotScheduler takes snapshots while entities are written, checks
+// the newest is a complete copy, that old ones are pruned down to the
+// configured count, and that restoring one replaces the database
+func TestSnapshotScheduler(t *testing.T) {
+	repo := newTestRepository(t, func(cfg *config.Config) {
+		cfg.SnapshotPath = "./snapshots"
+	})
+	cfg := repo.config
+	closed := false
+	defer func() {
+		if !closed {
+			repo.Close()
+		}
+	}()
+
+	scheduler := NewSnapshotScheduler(repo, SnapshotSchedulerConfig{Path: cfg.SnapshotFullPath(), Keep: 2})
+	var ids []string
+	var latest *SnapshotInfo
+	for i := 0; i < 3; i++ {
+		entity, err := models.NewEntityWithMandatoryTags("note", "default", models.SystemUserID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Create(entity); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, entity.ID)
+
+		// Queued creates are applied before the copy is taken
+		if latest, err = scheduler.TakeSnapshot(); err != nil {
+			t.Fatalf("TakeSnapshot: %v", err)
+		}
+		if latest.Entities != uint64(len(ids)) {
+			t.Errorf("snapshot %d holds %d entities, want %d", i, latest.Entities, len(ids))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	snapshots, err := scheduler.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Name != latest.Name {
+		t.Fatalf("snapshots after pruning = %+v, want the 2 newest", snapshots)
+	}
+	if stats := scheduler.Stats(); stats.Taken != 3 || stats.Pruned != 1 || stats.Retained != 2 || stats.LastSizeBytes != latest.SizeBytes {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	reader, err := NewReader(latest.Path)
+	if err != nil {
+		t.Fatalf("snapshot unreadable: %v", err)
+	}
+	for _, id := range ids {
+		if _, err := reader.GetEntity(id); err != nil {
+			t.Errorf("snapshot is missing entity %s: %v", id, err)
+		}
+	}
+	reader.Close()
+
+	// An entity written after the snapshot is gone once it is restored
+	extra, err := models.NewEntityWithMandatoryTags("note", "default", models.SystemUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(extra); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	closed = true
+
+	report, err := RestoreSnapshot(context.Background(), cfg, latest.Name)
+	if err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	if !report.Restored || !report.Check.Healthy || report.PreviousDatabase == "" {
+		t.Fatalf("restore report = %+v", report)
+	}
+	if _, err := os.Stat(report.PreviousDatabase); err != nil {
+		t.Errorf("replaced database was not kept: %v", err)
+	}
+
+	reader, err = NewReader(cfg.DatabaseFilename)
+	if err != nil {
+		t.Fatalf("restored database unreadable: %v", err)
+	}
+	defer reader.Close()
+	if got := len(reader.EntityIDs()); got != len(ids) {
+		t.Errorf("restored database holds %d entities, want %d", got, len(ids))
+	}
+	if _, err := reader.GetEntity(extra.ID); err == nil {
+		t.Errorf("entity written after the snapshot survived the restore")
+	}
+}
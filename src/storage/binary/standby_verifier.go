@@ -0,0 +1,518 @@
+package binary
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"entitydb/logger"
+	"entitydb/models"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// routineBackupMarker appears in the names of backups the WAL integrity
+// system takes of the database file
+const routineBackupMarker = ".backup.routine-"
+
+// standbySampleLimit bounds the entity IDs listed per divergence category
+const standbySampleLimit = 20
+
+// standbyHistoryLimit bounds how many reports are kept
+const standbyHistoryLimit = 10
+
+// Standby verification statuses, from best to worst
+const (
+	StandbyStatusOK       = "ok"
+	StandbyStatusStale    = "stale"
+	StandbyStatusDiverged = "diverged"
+	StandbyStatusFailed   = "failed"
+)
+
+// StandbyVerifierConfig configures warm standby verification
+type StandbyVerifierConfig struct {
+	// PrimaryDatabase is the primary's database file, compared against the restore
+	PrimaryDatabase string
+
+	// BackupPath is the directory holding the primary's routine backups
+	BackupPath string
+
+	// RestorePath is a scratch directory backups are restored into
+	RestorePath string
+
+	// Interval determines how often the latest backup is restored and checked
+	Interval time.Duration
+
+	// MaxBackupAge is the age after which the latest backup counts as stale
+	MaxBackupAge time.Duration
+
+	// VerifyKey, when set, requires backup manifests signed with this key
+	VerifyKey ed25519.PublicKey
+}
+
+// StandbyBackupInfo describes the backup a verification restored
+type StandbyBackupInfo struct {
+	Path       string    `json:"path"`
+	SizeBytes  int64     `json:"size_bytes"`
+	TakenAt    time.Time `json:"taken_at"`
+	AgeSeconds int64     `json:"age_seconds"`
+	Fresh      bool      `json:"fresh"`
+}
+
+// StandbyRestoreInfo reports what restoring a database file produced
+type StandbyRestoreInfo struct {
+	Entities          int `json:"entities"`
+	SnapshotEntities  int `json:"snapshot_entities"`
+	Unreadable        int `json:"unreadable"`
+	WALEntriesApplied int `json:"wal_entries_applied"`
+	WALEntriesFailed  int `json:"wal_entries_failed"`
+}
+
+// StandbyDivergence compares the restored backup with the primary. Changes
+// and deletions after the backup was taken are expected; entities created
+// before the backup but absent from it mean the backup is incomplete.
+type StandbyDivergence struct {
+	PrimaryEntities    int      `json:"primary_entities"`
+	MissingFromBackup  int      `json:"missing_from_backup"`
+	CreatedSinceBackup int      `json:"created_since_backup"`
+	ChangedSinceBackup int      `json:"changed_since_backup"`
+	DeletedSinceBackup int      `json:"deleted_since_backup"`
+	MissingSample      []string `json:"missing_sample,omitempty"`
+}
+
+// StandbyReport is the outcome of one standby verification
+type StandbyReport struct {
+	Status     string              `json:"status"`
+	VerifiedAt time.Time           `json:"verified_at"`
+	Duration   string              `json:"duration"`
+	Backup     *StandbyBackupInfo  `json:"backup,omitempty"`
+	Restore    *StandbyRestoreInfo `json:"restore,omitempty"`
+	Integrity  *BackupVerification `json:"integrity,omitempty"`
+	Primary    *StandbyRestoreInfo `json:"primary,omitempty"`
+	Divergence *StandbyDivergence  `json:"divergence,omitempty"`
+	Problems   []string            `json:"problems,omitempty"`
+}
+
+// StandbyVerifier continuously restores the latest routine backup of a
+// primary database into a scratch directory, replays its write-ahead log,
+// checks the result and compares it with the primary, so that unrestorable
+// or stale backups are noticed before they are needed.
+type StandbyVerifier struct {
+	config StandbyVerifierConfig
+
+	running  int32
+	stopChan chan struct{}
+	runMu    sync.Mutex
+
+	mu      sync.RWMutex
+	history []*StandbyReport
+}
+
+// NewStandbyVerifier creates a standby verifier
+func NewStandbyVerifier(cfg StandbyVerifierConfig) *StandbyVerifier {
+	if cfg.BackupPath == "" {
+		cfg.BackupPath = filepath.Dir(cfg.PrimaryDatabase)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Minute
+	}
+	return &StandbyVerifier{
+		config:   cfg,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins periodic verification
+func (sv *StandbyVerifier) Start() error {
+	if !atomic.CompareAndSwapInt32(&sv.running, 0, 1) {
+		return fmt.Errorf("standby verifier already running")
+	}
+
+	go sv.loop()
+	logger.Info("Standby verifier started (primary: %s, backups: %s, interval: %v)",
+		sv.config.PrimaryDatabase, sv.config.BackupPath, sv.config.Interval)
+	return nil
+}
+
+// Stop ends periodic verification
+func (sv *StandbyVerifier) Stop() error {
+	if !atomic.CompareAndSwapInt32(&sv.running, 1, 0) {
+		return fmt.Errorf("standby verifier not running")
+	}
+
+	close(sv.stopChan)
+	logger.Info("Standby verifier stopped")
+	return nil
+}
+
+// IsRunning reports whether periodic verification is active
+func (sv *StandbyVerifier) IsRunning() bool {
+	return atomic.LoadInt32(&sv.running) == 1
+}
+
+func (sv *StandbyVerifier) loop() {
+	ticker := time.NewTicker(sv.config.Interval)
+	defer ticker.Stop()
+
+	sv.Verify()
+	for {
+		select {
+		case <-ticker.C:
+			sv.Verify()
+		case <-sv.stopChan:
+			return
+		}
+	}
+}
+
+// LatestReport returns the most recent report, or nil before the first run
+func (sv *StandbyVerifier) LatestReport() *StandbyReport {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	if len(sv.history) == 0 {
+		return nil
+	}
+	return sv.history[len(sv.history)-1]
+}
+
+// History returns recent reports, oldest first
+func (sv *StandbyVerifier) History() []*StandbyReport {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	return append([]*StandbyReport{}, sv.history...)
+}
+
+// Verify restores the latest backup, checks it and records the report
+func (sv *StandbyVerifier) Verify() *StandbyReport {
+	sv.runMu.Lock()
+	defer sv.runMu.Unlock()
+
+	start := time.Now()
+	report := &StandbyReport{VerifiedAt: start}
+	sv.verify(report)
+	report.Duration = time.Since(start).String()
+	report.Status = standbyStatus(report)
+
+	if report.Status == StandbyStatusOK {
+		logger.Info("Standby verification passed in %s", report.Duration)
+	} else {
+		logger.Warn("Standby verification %s: %s", report.Status, strings.Join(report.Problems, "; "))
+	}
+
+	sv.mu.Lock()
+	sv.history = append(sv.history, report)
+	if len(sv.history) > standbyHistoryLimit {
+		sv.history = sv.history[len(sv.history)-standbyHistoryLimit:]
+	}
+	sv.mu.Unlock()
+
+	return report
+}
+
+func (sv *StandbyVerifier) verify(report *StandbyReport) {
+	backupPath, backupInfo, err := sv.latestBackup()
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+		return
+	}
+	age := time.Since(backupInfo.ModTime())
+	report.Backup = &StandbyBackupInfo{
+		Path:       backupPath,
+		SizeBytes:  backupInfo.Size(),
+		TakenAt:    backupInfo.ModTime(),
+		AgeSeconds: int64(age.Seconds()),
+		Fresh:      sv.config.MaxBackupAge <= 0 || age <= sv.config.MaxBackupAge,
+	}
+
+	if err := os.MkdirAll(sv.config.RestorePath, 0755); err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("cannot create restore directory: %v", err))
+		return
+	}
+
+	restored, restoreInfo, err := restoreDatabaseCopy(backupPath, filepath.Join(sv.config.RestorePath, "backup.edb"))
+	report.Restore = restoreInfo
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("backup restore failed: %v", err))
+		return
+	}
+	report.Integrity = VerifyBackup(backupPath, restored, sv.config.VerifyKey)
+
+	primary, primaryInfo, err := restoreDatabaseCopy(sv.config.PrimaryDatabase, filepath.Join(sv.config.RestorePath, "primary.edb"))
+	report.Primary = primaryInfo
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("primary read failed: %v", err))
+		return
+	}
+
+	report.Divergence = compareStandby(restored, primary, backupInfo.ModTime())
+}
+
+// VerifyBackupFile restores a backup from the backup directory and checks it
+// against its manifest, for example after copying it back from offsite
+// storage. An empty name selects the latest routine backup.
+func (sv *StandbyVerifier) VerifyBackupFile(name string) (*BackupVerification, error) {
+	sv.runMu.Lock()
+	defer sv.runMu.Unlock()
+
+	var backupPath string
+	if name == "" {
+		latest, _, err := sv.latestBackup()
+		if err != nil {
+			return nil, err
+		}
+		backupPath = latest
+	} else {
+		// Only files inside the backup directory can be verified
+		backupPath = filepath.Join(sv.config.BackupPath, filepath.Base(name))
+		if _, err := os.Stat(backupPath); err != nil {
+			return nil, fmt.Errorf("backup %s not found", filepath.Base(name))
+		}
+	}
+
+	if err := os.MkdirAll(sv.config.RestorePath, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create restore directory: %w", err)
+	}
+	restored, _, err := restoreDatabaseCopy(backupPath, filepath.Join(sv.config.RestorePath, "verify.edb"))
+	if err != nil {
+		return nil, fmt.Errorf("backup restore failed: %w", err)
+	}
+	return VerifyBackup(backupPath, restored, sv.config.VerifyKey), nil
+}
+
+// latestBackup finds the newest routine backup of the primary database
+func (sv *StandbyVerifier) latestBackup() (string, os.FileInfo, error) {
+	prefix := filepath.Base(sv.config.PrimaryDatabase) + routineBackupMarker
+	entries, err := os.ReadDir(sv.config.BackupPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot read backup directory: %w", err)
+	}
+
+	var latest os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) || isBackupManifest(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if latest == nil || info.ModTime().After(latest.ModTime()) {
+			latest = info
+		}
+	}
+	if latest == nil {
+		return "", nil, fmt.Errorf("no backups matching %s* in %s", prefix, sv.config.BackupPath)
+	}
+	return filepath.Join(sv.config.BackupPath, latest.Name()), latest, nil
+}
+
+// restoreDatabaseCopy copies a database file, reads its entity snapshot and
+// replays its write-ahead log on top, returning the resulting entities
+func restoreDatabaseCopy(source, target string) (map[string]*models.Entity, *StandbyRestoreInfo, error) {
+	info := &StandbyRestoreInfo{}
+	defer os.Remove(target)
+
+	if err := copyFileForWAL(source, target); err != nil {
+		return nil, info, fmt.Errorf("copy %s: %w", source, err)
+	}
+
+	reader, err := NewReader(target)
+	if err != nil {
+		return nil, info, fmt.Errorf("open %s: %w", filepath.Base(source), err)
+	}
+	ids := reader.EntityIDs()
+	snapshot, err := reader.GetAllEntities()
+	reader.Close()
+	if err != nil {
+		return nil, info, fmt.Errorf("read %s: %w", filepath.Base(source), err)
+	}
+
+	entities := make(map[string]*models.Entity, len(snapshot))
+	for _, entity := range snapshot {
+		entities[entity.ID] = entity
+	}
+	info.SnapshotEntities = len(snapshot)
+	info.Unreadable = len(ids) - len(snapshot)
+
+	err = replayWALSection(target, func(entry *WALEntry) {
+		switch entry.OpType {
+		case WALOpCreate, WALOpUpdate:
+			if entry.Entity != nil {
+				entities[entry.EntityID] = entry.Entity
+			}
+		case WALOpDelete:
+			delete(entities, entry.EntityID)
+		}
+		info.WALEntriesApplied++
+	}, func() {
+		info.WALEntriesFailed++
+	})
+	if err != nil {
+		return nil, info, fmt.Errorf("replay WAL of %s: %w", filepath.Base(source), err)
+	}
+
+	info.Entities = len(entities)
+	return entities, info, nil
+}
+
+// replayWALSection reads the entries in the embedded WAL section of a unified
+// file. Unlike WAL.Replay it stays within the section: it skips the section's
+// sequence header and stops at the first unwritten (zero length) slot.
+func replayWALSection(path string, apply func(entry *WALEntry), failed func()) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := &Header{}
+	if err := header.Read(file); err != nil {
+		return err
+	}
+	if header.WALSize <= 16 {
+		return nil
+	}
+
+	section := make([]byte, header.WALSize-16)
+	n, err := file.ReadAt(section, int64(header.WALOffset)+16)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	section = section[:n]
+
+	decoder := &WAL{}
+	for offset := 0; offset+4 <= len(section); {
+		length := int(binary.LittleEndian.Uint32(section[offset : offset+4]))
+		offset += 4
+		if length == 0 {
+			break
+		}
+		if offset+length > len(section) {
+			failed()
+			break
+		}
+		entry, err := decoder.deserializeEntry(section[offset : offset+length])
+		offset += length
+		if err != nil {
+			failed()
+			continue
+		}
+		apply(entry)
+	}
+	return nil
+}
+
+// compareStandby classifies differences between a restored backup and the primary
+func compareStandby(backup, primary map[string]*models.Entity, takenAt time.Time) *StandbyDivergence {
+	divergence := &StandbyDivergence{PrimaryEntities: len(primary)}
+	cutoff := takenAt.UnixNano()
+
+	var missing []string
+	for id, entity := range primary {
+		restored, ok := backup[id]
+		if !ok {
+			if entityCreatedAt(entity) > cutoff {
+				divergence.CreatedSinceBackup++
+			} else {
+				divergence.MissingFromBackup++
+				missing = append(missing, id)
+			}
+			continue
+		}
+		if !sameEntityState(restored, entity) {
+			divergence.ChangedSinceBackup++
+		}
+	}
+	for id := range backup {
+		if _, ok := primary[id]; !ok {
+			divergence.DeletedSinceBackup++
+		}
+	}
+
+	sort.Strings(missing)
+	if len(missing) > standbySampleLimit {
+		missing = missing[:standbySampleLimit]
+	}
+	divergence.MissingSample = missing
+	return divergence
+}
+
+// entityCreatedAt returns an entity's creation time from its created_at tag,
+// falling back to its earliest tag timestamp
+func entityCreatedAt(entity *models.Entity) int64 {
+	if value := entity.GetTagValue("created_at"); value != "" {
+		if nanos, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return nanos
+		}
+	}
+	var earliest int64
+	for _, tag := range entity.Tags {
+		if parts := strings.SplitN(tag, "|", 2); len(parts) == 2 {
+			if nanos, err := strconv.ParseInt(parts[0], 10, 64); err == nil && (earliest == 0 || nanos < earliest) {
+				earliest = nanos
+			}
+		}
+	}
+	return earliest
+}
+
+// sameEntityState reports whether two copies of an entity have the same tags and content
+func sameEntityState(a, b *models.Entity) bool {
+	if len(a.Tags) != len(b.Tags) || !bytes.Equal(a.Content, b.Content) {
+		return false
+	}
+	tags := make(map[string]int, len(a.Tags))
+	for _, tag := range a.Tags {
+		tags[tag]++
+	}
+	for _, tag := range b.Tags {
+		if tags[tag] == 0 {
+			return false
+		}
+		tags[tag]--
+	}
+	return true
+}
+
+// standbyStatus derives the overall status from a report
+func standbyStatus(report *StandbyReport) string {
+	if report.Divergence == nil {
+		return StandbyStatusFailed
+	}
+
+	// A backup that does not match its manifest cannot be trusted at all
+	if report.Integrity != nil && len(report.Integrity.Problems) > 0 {
+		report.Problems = append(report.Problems, report.Integrity.Problems...)
+		return StandbyStatusFailed
+	}
+
+	diverged := false
+	if report.Restore.Unreadable > 0 {
+		diverged = true
+		report.Problems = append(report.Problems, fmt.Sprintf("%d entities in the backup are unreadable", report.Restore.Unreadable))
+	}
+	if report.Restore.WALEntriesFailed > 0 {
+		diverged = true
+		report.Problems = append(report.Problems, fmt.Sprintf("%d WAL entries in the backup failed to replay", report.Restore.WALEntriesFailed))
+	}
+	if report.Divergence.MissingFromBackup > 0 {
+		diverged = true
+		report.Problems = append(report.Problems, fmt.Sprintf("%d entities created before the backup are missing from it", report.Divergence.MissingFromBackup))
+	}
+	if diverged {
+		return StandbyStatusDiverged
+	}
+
+	if !report.Backup.Fresh {
+		report.Problems = append(report.Problems, fmt.Sprintf("latest backup is %ds old", report.Backup.AgeSeconds))
+		return StandbyStatusStale
+	}
+	return StandbyStatusOK
+}
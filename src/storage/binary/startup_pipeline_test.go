@@ -0,0 +1,119 @@
+package binary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// TestWALReplayParallel checks that parallel replay delivers the entries of
+// a WAL in log order, in batches, and counts corrupt frames like Replay
+func TestWALReplayParallel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.wal")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	frame := func(data []byte) {
+		binary.Write(file, binary.LittleEndian, uint32(len(data)))
+		file.Write(data)
+	}
+	base := time.Unix(1700000000, 0)
+	for i := 0; i < 10; i++ {
+		entry := WALEntry{OpType: WALOpUpdate, EntityID: fmt.Sprintf("e%d", i%3), Timestamp: base.Add(time.Duration(i))}
+		entry.Entity = &models.Entity{ID: entry.EntityID, Tags: []string{fmt.Sprintf("seq:%d", i)}}
+		data, err := (&WAL{}).serializeEntry(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame(data)
+		if i == 4 {
+			frame(nil)             // zero length, skipped
+			frame([]byte{1, 2, 3}) // too short to decode
+		}
+	}
+
+	wal := &WAL{file: file, path: path}
+	var sequential []string
+	if err := wal.Replay(func(entry WALEntry) error {
+		sequential = append(sequential, entry.Entity.Tags[0])
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	_, sequentialFailed := wal.LastReplayStats()
+
+	var parallel []string
+	batches := 0
+	if err := wal.ReplayParallel(4, 3, func(entries []WALEntry) {
+		batches++
+		for _, entry := range entries {
+			parallel = append(parallel, entry.Entity.Tags[0])
+		}
+	}); err != nil {
+		t.Fatalf("ReplayParallel: %v", err)
+	}
+	processed, failed := wal.LastReplayStats()
+
+	if !reflect.DeepEqual(parallel, sequential) || len(parallel) != 10 {
+		t.Errorf("parallel replay order = %v, want %v", parallel, sequential)
+	}
+	if processed != 10 || failed != 2 || failed != sequentialFailed {
+		t.Errorf("parallel replay stats = %d processed, %d failed; want 10 and 2", processed, failed)
+	}
+	if batches < 4 {
+		t.Errorf("entries delivered in %d batches, want batches of at most 3 frames", batches)
+	}
+}
+
+// TestLoadPostings checks that bulk loading matches AddTag, including tags
+// that already hold entities
+func TestLoadPostings(t *testing.T) {
+	bulk, single := NewShardedTagIndex(), NewShardedTagIndex()
+	bulk.AddTag("type:user", "e0")
+	single.AddTag("type:user", "e0")
+
+	postings := make([]map[string][]string, NumShards)
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("e%d", i)
+		for _, tag := range []string{"type:user", fmt.Sprintf("name:%d", i), "rel:owns:x"} {
+			shard := tagShardIndex(tag)
+			if postings[shard] == nil {
+				postings[shard] = make(map[string][]string)
+			}
+			postings[shard][tag] = append(postings[shard][tag], id)
+			single.AddTag(tag, id)
+		}
+	}
+	bulk.LoadPostings(postings, 4)
+
+	want, got := single.GetAllTags(), bulk.GetAllTags()
+	for _, ids := range want {
+		sort.Strings(ids)
+	}
+	for _, ids := range got {
+		sort.Strings(ids)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bulk loaded tags differ from AddTag")
+	}
+	if bulk.MemoryBytes() != single.MemoryBytes() || bulk.values.MemoryBytes() != single.values.MemoryBytes() {
+		t.Errorf("bulk index bytes = %d/%d, want %d/%d", bulk.MemoryBytes(), bulk.values.MemoryBytes(),
+			single.MemoryBytes(), single.values.MemoryBytes())
+	}
+	if got := bulk.values.Suggest("type", "", 1); len(got) != 1 || got[0].Count != 50 {
+		t.Errorf("type values after bulk load = %v, want user with 50", got)
+	}
+	if edges := bulk.edges.MemoryBytes(); edges != single.edges.MemoryBytes() {
+		t.Errorf("adjacency bytes = %d, want %d", edges, single.edges.MemoryBytes())
+	}
+}
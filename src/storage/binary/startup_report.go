@@ -0,0 +1,200 @@
+package binary
+
+import (
+	"sync"
+	"time"
+
+	"entitydb/logger"
+)
+
+// Index sources reported at startup
+const (
+	IndexSourceRebuilt   = "rebuilt"
+	IndexSourcePersisted = "persisted"
+)
+
+// StartupPhase is one timed step of server initialization
+type StartupPhase struct {
+	Name       string                 `json:"name"`
+	StartedAt  time.Time              `json:"started_at"`
+	Duration   string                 `json:"duration"`
+	DurationMs float64                `json:"duration_ms"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// StartupRecoveryAction is a corrective step taken during initialization
+type StartupRecoveryAction struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// StartupReportSnapshot is the startup report as returned to clients
+type StartupReportSnapshot struct {
+	StartedAt          time.Time               `json:"started_at"`
+	CompletedAt        *time.Time              `json:"completed_at,omitempty"`
+	Complete           bool                    `json:"complete"`
+	TotalDuration      string                  `json:"total_duration"`
+	TotalDurationMs    float64                 `json:"total_duration_ms"`
+	WALEntriesReplayed int                     `json:"wal_entries_replayed"`
+	WALEntriesSkipped  int                     `json:"wal_entries_skipped"`
+	EntitiesLoaded     int                     `json:"entities_loaded"`
+	IndexSource        string                  `json:"index_source"`
+	TagIndexEntries    int                     `json:"tag_index_entries"`
+	MigrationsApplied  int                     `json:"migrations_applied"`
+	RecoveryActions    []StartupRecoveryAction `json:"recovery_actions"`
+	Phases             []StartupPhase          `json:"phases"`
+}
+
+// StartupReport collects what happened while the server initialized so it
+// can be inspected after boot instead of reconstructed from log lines
+type StartupReport struct {
+	mu       sync.Mutex
+	snapshot StartupReportSnapshot
+}
+
+// startupReport is the report for this process. Its start time is the
+// moment the package was initialized, which is as close to process start as
+// the storage layer can observe.
+var startupReport = NewStartupReport()
+
+// NewStartupReport creates an empty report starting now
+func NewStartupReport() *StartupReport {
+	return &StartupReport{
+		snapshot: StartupReportSnapshot{
+			StartedAt:       time.Now(),
+			RecoveryActions: []StartupRecoveryAction{},
+			Phases:          []StartupPhase{},
+		},
+	}
+}
+
+// GetStartupReport returns the startup report for this process
+func GetStartupReport() *StartupReport {
+	return startupReport
+}
+
+// RecordPhase records a phase that began at start and has just finished
+func (s *StartupReport) RecordPhase(name string, start time.Time, details map[string]interface{}, err error) {
+	duration := time.Since(start)
+	phase := StartupPhase{
+		Name:       name,
+		StartedAt:  start,
+		Duration:   duration.Round(time.Microsecond).String(),
+		DurationMs: float64(duration) / float64(time.Millisecond),
+		Details:    details,
+	}
+	if err != nil {
+		phase.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	s.snapshot.Phases = append(s.snapshot.Phases, phase)
+	s.mu.Unlock()
+}
+
+// RecordRecoveryAction records a corrective step taken during initialization
+func (s *StartupReport) RecordRecoveryAction(action, detail string) {
+	s.mu.Lock()
+	s.snapshot.RecoveryActions = append(s.snapshot.RecoveryActions, StartupRecoveryAction{
+		Time:   time.Now(),
+		Action: action,
+		Detail: detail,
+	})
+	s.mu.Unlock()
+}
+
+// RecordWALReplay records how many WAL entries were replayed and skipped
+func (s *StartupReport) RecordWALReplay(replayed, skipped int) {
+	s.mu.Lock()
+	s.snapshot.WALEntriesReplayed += replayed
+	s.snapshot.WALEntriesSkipped += skipped
+	s.mu.Unlock()
+}
+
+// RecordIndexes records where the indexes came from and what they hold
+func (s *StartupReport) RecordIndexes(source string, entitiesLoaded, tagIndexEntries int) {
+	s.mu.Lock()
+	s.snapshot.IndexSource = source
+	s.snapshot.EntitiesLoaded = entitiesLoaded
+	s.snapshot.TagIndexEntries = tagIndexEntries
+	s.mu.Unlock()
+}
+
+// RecordMigrations adds to the number of migrations applied
+func (s *StartupReport) RecordMigrations(applied int) {
+	s.mu.Lock()
+	s.snapshot.MigrationsApplied += applied
+	s.mu.Unlock()
+}
+
+// Complete marks initialization as finished. Later calls are ignored.
+func (s *StartupReport) Complete() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot.CompletedAt != nil {
+		return
+	}
+	now := time.Now()
+	s.snapshot.CompletedAt = &now
+	s.snapshot.Complete = true
+}
+
+// Snapshot returns a copy of the report. Until initialization completes the
+// total duration is measured up to now.
+func (s *StartupReport) Snapshot() StartupReportSnapshot {
+	s.mu.Lock()
+	snapshot := s.snapshot
+	snapshot.Phases = append(make([]StartupPhase, 0, len(s.snapshot.Phases)), s.snapshot.Phases...)
+	snapshot.RecoveryActions = append(make([]StartupRecoveryAction, 0, len(s.snapshot.RecoveryActions)), s.snapshot.RecoveryActions...)
+	s.mu.Unlock()
+
+	end := time.Now()
+	if snapshot.CompletedAt != nil {
+		end = *snapshot.CompletedAt
+	}
+	total := end.Sub(snapshot.StartedAt)
+	snapshot.TotalDuration = total.Round(time.Millisecond).String()
+	snapshot.TotalDurationMs = float64(total) / float64(time.Millisecond)
+	return snapshot
+}
+
+// startupProgressInterval is how often long startup steps log their progress
+const startupProgressInterval = 5 * time.Second
+
+// startupProgress logs the progress of a long startup step at most every
+// few seconds. It is safe for concurrent use.
+type startupProgress struct {
+	step  string
+	unit  string
+	total int64
+	start time.Time
+
+	mu      sync.Mutex
+	lastLog time.Time
+}
+
+// newStartupProgress starts tracking a step of total units
+func newStartupProgress(step, unit string, total int64) *startupProgress {
+	now := time.Now()
+	return &startupProgress{step: step, unit: unit, total: total, start: now, lastLog: now}
+}
+
+// update logs done units if the last log line is old enough
+func (p *startupProgress) update(done int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.lastLog) < startupProgressInterval {
+		return
+	}
+	p.lastLog = now
+	if p.total > 0 {
+		logger.Info("Startup %s: %d/%d %s (%.0f%%, %v elapsed)", p.step, done, p.total, p.unit,
+			float64(done)*100/float64(p.total), now.Sub(p.start).Round(time.Second))
+	} else {
+		logger.Info("Startup %s: %d %s (%v elapsed)", p.step, done, p.unit, now.Sub(p.start).Round(time.Second))
+	}
+}
@@ -0,0 +1,125 @@
+package binary
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Storage statistics
+//
+// Writes append entity records to the data section and point the entity
+// index at the newest record; records replaced by an update or dropped by a
+// delete stay in the file until it is compacted. The dead space estimate is
+// the data section size less the bytes of the records the index points at.
+
+// StorageSection is the location of a section of the unified data file
+type StorageSection struct {
+	Offset uint64 `json:"offset"`
+	Size   uint64 `json:"size"`
+}
+
+// StorageStats describes the files of a repository for capacity planning
+type StorageStats struct {
+	DataFile          string                    `json:"data_file"`
+	DataFileSize      int64                     `json:"data_file_size"`
+	WALFileSize       int64                     `json:"wal_file_size"`
+	IndexFileSize     int64                     `json:"index_file_size"`
+	TotalSize         int64                     `json:"total_size"`
+	FormatVersion     uint32                    `json:"format_version"`
+	EntityCount       int                       `json:"entity_count"`
+	LiveBytes         uint64                    `json:"live_bytes"`
+	AverageEntitySize uint64                    `json:"average_entity_size"`
+	DeadSpaceBytes    uint64                    `json:"dead_space_bytes"`
+	DeadSpaceRatio    float64                   `json:"dead_space_ratio"`
+	Sections          map[string]StorageSection `json:"sections"`
+	LastModified      time.Time                 `json:"last_modified"`
+	WALSequence       uint64                    `json:"wal_sequence"`
+	CheckpointSeq     uint64                    `json:"checkpoint_sequence"`
+	IDFilter          IDFilterStats             `json:"id_filter"`
+	WALGroupCommit    GroupCommitStats          `json:"wal_group_commit"`
+	DataGroupCommit   GroupCommitStats          `json:"data_group_commit"`
+}
+
+// StorageStats returns the sizes of the repository's files, the live and
+// dead bytes of its data section and the sections of the unified header.
+// Queued writes are flushed first so the figures include them.
+func (r *EntityRepository) StorageStats() (*StorageStats, error) {
+	if r.useBatchWrites && r.batchWriter != nil {
+		if err := r.batchWriter.Flush(); err != nil {
+			return nil, fmt.Errorf("failed to flush pending writes: %w", err)
+		}
+	}
+
+	reader, err := NewReader(r.getDataFile())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data file: %w", err)
+	}
+	defer reader.Close()
+
+	stats, err := readStorageStats(reader)
+	if err != nil {
+		return nil, err
+	}
+	if stat, err := os.Stat(r.getWALFile()); err == nil {
+		stats.WALFileSize = stat.Size()
+	}
+	if r.config != nil {
+		if stat, err := os.Stat(r.config.IndexFilename); err == nil {
+			stats.IndexFileSize = stat.Size()
+		}
+	}
+	stats.TotalSize = stats.DataFileSize + stats.WALFileSize + stats.IndexFileSize
+	stats.IDFilter = r.IDFilterStats()
+	if r.wal != nil {
+		stats.WALGroupCommit = r.wal.GroupCommitStats()
+	}
+	if r.writerManager != nil {
+		stats.DataGroupCommit = r.writerManager.GroupCommitStats()
+	}
+	return stats, nil
+}
+
+// readStorageStats computes the data file statistics of a reader
+func readStorageStats(reader *Reader) (*StorageStats, error) {
+	stat, err := reader.file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("data file not accessible: %w", err)
+	}
+	h := reader.header
+	stats := &StorageStats{
+		DataFile:      reader.filename,
+		DataFileSize:  stat.Size(),
+		FormatVersion: h.Version,
+		Sections: map[string]StorageSection{
+			"wal":            {Offset: h.WALOffset, Size: h.WALSize},
+			"data":           {Offset: h.DataOffset, Size: h.DataSize},
+			"tag_dictionary": {Offset: h.TagDictOffset, Size: h.TagDictSize},
+			"entity_index":   {Offset: h.EntityIndexOffset, Size: h.EntityIndexSize},
+			"deletion_index": {Offset: h.DeletionIndexOffset, Size: h.DeletionIndexSize},
+		},
+		WALSequence:   h.WALSequence,
+		CheckpointSeq: h.CheckpointSequence,
+	}
+	if h.LastModified > 0 {
+		stats.LastModified = time.Unix(h.LastModified, 0)
+	}
+
+	reader.indexMu.RLock()
+	stats.EntityCount = len(reader.index)
+	for _, entry := range reader.index {
+		stats.LiveBytes += uint64(entry.Size)
+	}
+	reader.indexMu.RUnlock()
+
+	if stats.EntityCount > 0 {
+		stats.AverageEntitySize = stats.LiveBytes / uint64(stats.EntityCount)
+	}
+	if h.DataSize > stats.LiveBytes {
+		stats.DeadSpaceBytes = h.DataSize - stats.LiveBytes
+	}
+	if h.DataSize > 0 {
+		stats.DeadSpaceRatio = float64(stats.DeadSpaceBytes) / float64(h.DataSize)
+	}
+	return stats, nil
+}
@@ -0,0 +1,55 @@
+package binary
+
+import (
+	"fmt"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestReadStorageStats checks that records replaced by an update count as
+// dead space and live records count towards the average entity size
+func TestReadStorageStats(t *testing.T) {
+	var entities []*models.Entity
+	for i := 0; i < 3; i++ {
+		entities = append(entities, &models.Entity{
+			ID:      fmt.Sprintf("entity-%d", i),
+			Tags:    []string{"1|type:document"},
+			Content: []byte(fmt.Sprintf(`{"index":%d}`, i)),
+		})
+	}
+
+	stats := readTestStorageStats(t, writeTestEntities(t, entities))
+	if stats.EntityCount != 3 || stats.DeadSpaceBytes != 0 {
+		t.Fatalf("fresh file: %d entities with %d dead bytes, want 3 and 0", stats.EntityCount, stats.DeadSpaceBytes)
+	}
+	if stats.AverageEntitySize != stats.LiveBytes/3 || stats.Sections["data"].Size != stats.LiveBytes {
+		t.Errorf("live bytes %d, average %d, data section %d", stats.LiveBytes, stats.AverageEntitySize, stats.Sections["data"].Size)
+	}
+	replacedSize := stats.LiveBytes / 3
+
+	// Rewriting entity-1 appends a record and leaves the old one behind
+	updated := &models.Entity{ID: "entity-1", Tags: []string{"2|type:document"}, Content: []byte(`{"index":1}`)}
+	stats = readTestStorageStats(t, writeTestEntities(t, append(entities, updated)))
+	if stats.EntityCount != 3 {
+		t.Errorf("entity count after update = %d, want 3", stats.EntityCount)
+	}
+	if stats.DeadSpaceBytes != replacedSize || stats.DeadSpaceRatio <= 0 {
+		t.Errorf("dead space after update = %d (ratio %f), want the %d bytes of the replaced record", stats.DeadSpaceBytes, stats.DeadSpaceRatio, replacedSize)
+	}
+}
+
+// readTestStorageStats returns the storage statistics of a data file
+func readTestStorageStats(t *testing.T, path string) *StorageStats {
+	t.Helper()
+	reader, err := NewReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	stats, err := readStorageStats(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
@@ -0,0 +1,230 @@
+package binary
+
+import (
+	"entitydb/models"
+	"sort"
+	"strings"
+)
+
+// TagCountQuery selects the entities a count covers and how it is grouped
+type TagCountQuery struct {
+	Tags    []string // entities carrying all of these tags; none counts every entity
+	GroupBy string   // namespace whose values the count is grouped by, if set
+	Limit   int      // groups returned, largest first (0 = all)
+}
+
+// TagCounts is the result of a count
+type TagCounts struct {
+	Count       int             `json:"count"`
+	GroupBy     string          `json:"group_by,omitempty"`
+	Groups      []TagValueCount `json:"groups,omitempty"`
+	TotalGroups int             `json:"total_groups,omitempty"`
+}
+
+// CountByTags counts the entities carrying all of the query's tags, and
+// per value of the group-by namespace, from the posting lists of the tag
+// index without reading any entity. Counts agree with the lengths of the
+// lists ListByTag returns: entities marked deleted are left out, an entity
+// counts towards every value it has carried, and writes still queued in the
+// batch writer are counted from their pending versions.
+func (r *EntityRepository) CountByTags(query TagCountQuery) TagCounts {
+	r.mu.RLock()
+	c := tagCounter{index: r.shardedTagIndex}
+	r.mu.RUnlock()
+	if r.batchWriter != nil {
+		c.pending = r.batchWriter.overlay.snapshot()
+	}
+
+	// A single tag is counted from its posting list alone; grouping and
+	// further tags need the matching entities as a set
+	if len(query.Tags) == 1 && query.GroupBy == "" {
+		return TagCounts{Count: c.countTag(query.Tags[0], nil) + c.countPending(query.Tags, "", nil)}
+	}
+	filter, count := c.matchingSet(query.Tags)
+	groups := make(map[string]int)
+	result := TagCounts{Count: count + c.countPending(query.Tags, query.GroupBy, groups)}
+	if query.GroupBy == "" {
+		return result
+	}
+
+	result.GroupBy = query.GroupBy
+	result.Groups = []TagValueCount{}
+	for _, value := range c.index.values.namespaceValues(query.GroupBy) {
+		groups[value] += c.countTag(query.GroupBy+":"+value, filter)
+	}
+	for value, n := range groups {
+		if n > 0 {
+			result.Groups = append(result.Groups, TagValueCount{Value: value, Count: n})
+		}
+	}
+	sort.Slice(result.Groups, func(i, j int) bool {
+		if result.Groups[i].Count != result.Groups[j].Count {
+			return result.Groups[i].Count > result.Groups[j].Count
+		}
+		return result.Groups[i].Value < result.Groups[j].Value
+	})
+	result.TotalGroups = len(result.Groups)
+	if query.Limit > 0 && len(result.Groups) > query.Limit {
+		result.Groups = result.Groups[:query.Limit]
+	}
+	return result
+}
+
+// snapshot returns the pending entities by ID
+func (o *PendingOverlay) snapshot() map[string]*models.Entity {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	entities := make(map[string]*models.Entity, len(o.entities))
+	for id, entity := range o.entities {
+		entities[id] = entity
+	}
+	return entities
+}
+
+// namespaceValues returns the values of a namespace in value order
+func (idx *TagValueIndex) namespaceValues(namespace string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ns := idx.namespaces[namespace]
+	if ns == nil {
+		return nil
+	}
+	return append([]string(nil), ns.sorted...)
+}
+
+// tagCounter counts entities from the posting lists of the tag index,
+// leaving out entities marked deleted and entities with a pending version,
+// which are counted separately
+type tagCounter struct {
+	index   *ShardedTagIndex
+	pending map[string]*models.Entity
+}
+
+// withPostings calls fn with the posting list of a tag, nil when the tag is
+// not indexed, under the shard's read lock and the index's deleted set read
+// lock. fn must not keep the list.
+func (c *tagCounter) withPostings(tag string, fn func(ids []string)) {
+	s := c.index
+	shard := s.getShard(tag)
+	shard.queue.AcquireRead()
+	defer shard.queue.ReleaseRead()
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	s.deletedMu.RLock()
+	defer s.deletedMu.RUnlock()
+
+	ids, _ := s.postings(shard, tag)
+	fn(ids)
+}
+
+// skip reports whether an indexed entity is left out of posting list
+// counts. The caller holds the deleted set read lock.
+func (c *tagCounter) skip(id string) bool {
+	if _, deleted := c.index.deleted[id]; deleted {
+		return true
+	}
+	_, pending := c.pending[id]
+	return pending
+}
+
+// countTag counts the entities of a tag's posting list that are not skipped
+// and, with a filter, are in it. Without anything to skip or a filter this
+// is the length of the list.
+func (c *tagCounter) countTag(tag string, filter map[string]struct{}) int {
+	count := 0
+	c.withPostings(tag, func(ids []string) {
+		if filter == nil && len(c.index.deleted) == 0 && len(c.pending) == 0 {
+			count = len(ids)
+			return
+		}
+		for _, id := range ids {
+			if c.skip(id) {
+				continue
+			}
+			if _, ok := filter[id]; filter == nil || ok {
+				count++
+			}
+		}
+	})
+	return count
+}
+
+// matchingSet returns the indexed entities carrying all of tags that are
+// not skipped, as a set, and their number. Without tags every entity
+// matches: the set is nil and the entities are counted in a pass over the
+// index.
+func (c *tagCounter) matchingSet(tags []string) (map[string]struct{}, int) {
+	if len(tags) == 0 {
+		count := 0
+		for _, id := range c.index.EntityIDs() {
+			if !c.index.IsDeleted(id) && c.pending[id] == nil {
+				count++
+			}
+		}
+		return nil, count
+	}
+
+	// Start from the shortest posting list so the set stays small
+	lengths := make(map[string]int, len(tags))
+	for _, tag := range tags {
+		c.withPostings(tag, func(ids []string) { lengths[tag] = len(ids) })
+	}
+	ordered := append([]string(nil), tags...)
+	sort.Slice(ordered, func(i, j int) bool { return lengths[ordered[i]] < lengths[ordered[j]] })
+
+	set := make(map[string]struct{})
+	c.withPostings(ordered[0], func(ids []string) {
+		for _, id := range ids {
+			if !c.skip(id) {
+				set[id] = struct{}{}
+			}
+		}
+	})
+	for _, tag := range ordered[1:] {
+		if len(set) == 0 {
+			break
+		}
+		next := make(map[string]struct{}, len(set))
+		c.withPostings(tag, func(ids []string) {
+			for _, id := range ids {
+				if _, ok := set[id]; ok {
+					next[id] = struct{}{}
+				}
+			}
+		})
+		set = next
+	}
+	return set, len(set)
+}
+
+// countPending counts the pending entities carrying all of tags and adds
+// them to groups under each value of the group-by namespace they carry
+func (c *tagCounter) countPending(tags []string, groupBy string, groups map[string]int) int {
+	count := 0
+	for _, entity := range c.pending {
+		matches := true
+		for _, tag := range tags {
+			if !entity.HasTag(tag) {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		count++
+		if groupBy == "" {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, tag := range entity.GetTagsWithoutTimestamp() {
+			if value, ok := strings.CutPrefix(tag, groupBy+":"); ok && value != "" && !seen[value] {
+				seen[value] = true
+				groups[value]++
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,78 @@
+package binary
+
+import (
+	"reflect"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestCountByTags checks tag counts and grouped counts against the tag
+// lists they stand in for, before and after queued writes are applied and
+// once an entity is deleted
+func TestCountByTags(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	var tickets []string
+	for _, tc := range []struct{ kind, status string }{
+		{"ticket", "open"}, {"ticket", "open"}, {"ticket", "closed"}, {"ticket", "open"}, {"bug", "triaged"},
+	} {
+		entity, err := models.NewEntityWithMandatoryTags(tc.kind, "default", models.SystemUserID, []string{"status:" + tc.status})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Create(entity); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if tc.kind == "ticket" {
+			tickets = append(tickets, entity.ID)
+		}
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		list, err := repo.ListByTag("type:ticket")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := repo.CountByTags(TagCountQuery{Tags: []string{"type:ticket"}}); got.Count != len(list) {
+			t.Errorf("%s: count of type:ticket = %d, list has %d", stage, got.Count, len(list))
+		}
+		open, _ := repo.ListByTag("status:open")
+		if got := repo.CountByTags(TagCountQuery{Tags: []string{"type:ticket", "status:open"}}); got.Count != len(open) {
+			t.Errorf("%s: count of open tickets = %d, want %d", stage, got.Count, len(open))
+		}
+
+		grouped := repo.CountByTags(TagCountQuery{Tags: []string{"type:ticket"}, GroupBy: "status"})
+		want := map[string]int{}
+		for _, entity := range list {
+			want[entity.GetTagValue("status")]++
+		}
+		got := map[string]int{}
+		for _, group := range grouped.Groups {
+			got[group.Value] = group.Count
+		}
+		if grouped.Count != len(list) || grouped.TotalGroups != len(want) || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: grouped count = %+v, want %d tickets grouped as %v", stage, grouped, len(list), want)
+		}
+	}
+
+	// Creates may still be queued in the batch writer
+	check("queued")
+	flushWrites(t, repo)
+	check("applied")
+
+	all := repo.CountByTags(TagCountQuery{GroupBy: "status", Limit: 1})
+	if len(all.Groups) != 1 || all.Groups[0] != (TagValueCount{Value: "open", Count: 3}) || all.TotalGroups != 3 {
+		t.Errorf("limited count of every entity by status = %+v", all)
+	}
+	if got := repo.CountByTags(TagCountQuery{Tags: []string{"type:ticket", "status:missing"}}); got.Count != 0 {
+		t.Errorf("count with an unused tag = %d, want 0", got.Count)
+	}
+
+	if err := repo.Delete(tickets[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	check("deleted")
+}
@@ -0,0 +1,100 @@
+package binary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// entityFlagCompactTags is set in EntityHeader.Reserved when a record stores
+// its tags in the compact encoding
+const entityFlagCompactTags uint32 = 1 << 0
+
+// Compact tag encoding.
+//
+// Temporal tags ("timestamp|body") are stored as the dictionary ID of the
+// body and the timestamp as a delta from the previous temporal tag of the
+// record. The dictionary then holds each distinct body once instead of one
+// entry per timestamped value, and consecutive values of a metric cost a few
+// bytes each instead of a 4-byte ID plus a dictionary entry of ~40 bytes.
+//
+// Section layout, following the EntityHeader:
+//
+//	[SectionLen uint32]
+//	TagCount times:
+//	  uvarint  BodyID<<1 | Timestamped
+//	  varint   Timestamp - previous Timestamp   (only when Timestamped)
+//
+// Tags whose prefix is not a canonical decimal timestamp are stored whole
+// with Timestamped clear, so every tag round-trips byte for byte.
+
+// splitTemporalTag splits a tag into its nanosecond timestamp and body. It
+// reports false unless formatting the timestamp reproduces the prefix.
+func splitTemporalTag(tag string) (int64, string, bool) {
+	sep := strings.IndexByte(tag, '|')
+	if sep <= 0 {
+		return 0, "", false
+	}
+	ts, err := strconv.ParseInt(tag[:sep], 10, 64)
+	if err != nil || strconv.FormatInt(ts, 10) != tag[:sep] {
+		return 0, "", false
+	}
+	return ts, tag[sep+1:], true
+}
+
+// appendCompactTags appends the compact tag section, length prefix included,
+// adding tag bodies to the dictionary as needed
+func appendCompactTags(buf []byte, tags []string, dict *TagDictionary) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0)
+
+	var prev int64
+	for _, tag := range tags {
+		ts, body, temporal := splitTemporalTag(tag)
+		if !temporal {
+			buf = binary.AppendUvarint(buf, uint64(dict.GetOrCreateID(tag))<<1)
+			continue
+		}
+		buf = binary.AppendUvarint(buf, uint64(dict.GetOrCreateID(body))<<1|1)
+		buf = binary.AppendVarint(buf, ts-prev)
+		prev = ts
+	}
+
+	binary.LittleEndian.PutUint32(buf[start:], uint32(len(buf)-start-4))
+	return buf
+}
+
+// decodeCompactTags decodes count tags from a compact tag section
+func decodeCompactTags(section []byte, count int, dict *TagDictionary) ([]string, error) {
+	tags := make([]string, count, count+1)
+	var prev int64
+	pos := 0
+	for i := range tags {
+		code, n := binary.Uvarint(section[pos:])
+		if n <= 0 {
+			return nil, fmt.Errorf("compact tag %d of %d is truncated", i, count)
+		}
+		pos += n
+		body := dict.GetTag(uint32(code >> 1))
+		if code&1 == 0 {
+			tags[i] = body
+			continue
+		}
+
+		delta, n := binary.Varint(section[pos:])
+		if n <= 0 {
+			return nil, fmt.Errorf("timestamp of compact tag %d of %d is truncated", i, count)
+		}
+		pos += n
+		prev += delta
+		tag := make([]byte, 0, 20+len(body))
+		tag = strconv.AppendInt(tag, prev, 10)
+		tag = append(tag, '|')
+		tags[i] = string(append(tag, body...))
+	}
+	if pos != len(section) {
+		return nil, fmt.Errorf("compact tag section has %d trailing bytes", len(section)-pos)
+	}
+	return tags, nil
+}
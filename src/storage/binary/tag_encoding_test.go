@@ -0,0 +1,102 @@
+package binary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestCompactTagsRoundTrip checks that tags decode byte for byte, including
+// prefixes that only look like timestamps and timestamps that go backwards
+func TestCompactTagsRoundTrip(t *testing.T) {
+	tags := []string{
+		"1700000000000000000|metric:cpu:42",
+		"1700000000000000100|metric:cpu:43",
+		"1699999999999999000|metric:cpu:41",
+		"-5|metric:cpu:0",
+		"0017|type:padded",
+		"+3|type:signed",
+		"|type:empty",
+		"type:plain",
+		"1700000000000000200|",
+	}
+	dict := NewTagDictionary()
+	section := appendCompactTags(nil, tags, dict)
+
+	if got := int(binary.LittleEndian.Uint32(section)); got != len(section)-4 {
+		t.Fatalf("section length prefix = %d, want %d", got, len(section)-4)
+	}
+	got, err := decodeCompactTags(section[4:], len(tags), dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, tags) {
+		t.Errorf("decoded %q, want %q", got, tags)
+	}
+
+	if _, err := decodeCompactTags(section[4:len(section)-1], len(tags), dict); err == nil {
+		t.Error("truncated section decoded without error")
+	}
+	if _, err := decodeCompactTags(append(section[4:len(section):len(section)], 0), len(tags), dict); err == nil {
+		t.Error("section with trailing bytes decoded without error")
+	}
+}
+
+// TestLegacyTagRecord checks that records written with uint32 tag IDs still
+// decode
+func TestLegacyTagRecord(t *testing.T) {
+	dict := NewTagDictionary()
+	tags := []string{"1|type:document", "2|name:legacy"}
+
+	record := make([]byte, entityHeaderSize, entityHeaderSize+4*len(tags))
+	binary.LittleEndian.PutUint16(record[8:10], uint16(len(tags)))
+	for _, tag := range tags {
+		record = binary.LittleEndian.AppendUint32(record, dict.GetOrCreateID(tag))
+	}
+
+	entity, err := decodeEntityRecord(record, "legacy", dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entity.Tags, tags) {
+		t.Errorf("decoded %q, want %q", entity.Tags, tags)
+	}
+}
+
+// TestCompactTagsFileSize checks that a metrics-heavy entity round-trips
+// through the writer and reader, stores each tag body once in the
+// dictionary, and takes less space than one dictionary entry per value
+func TestCompactTagsFileSize(t *testing.T) {
+	const values = 2000
+	entity := &models.Entity{ID: "metric-cpu", Tags: []string{"1700000000000000000|type:metric"}}
+	for i := 0; i < values; i++ {
+		entity.Tags = append(entity.Tags, fmt.Sprintf("%d|value:%d", 1700000000000000000+int64(i)*1e9, i%10))
+	}
+	path := writeTestEntities(t, []*models.Entity{entity})
+
+	reader, err := NewReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	got, err := reader.GetEntity(entity.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Tags[:len(entity.Tags)], entity.Tags) {
+		t.Fatalf("read back %d tags that differ from the %d written", len(got.Tags), len(entity.Tags))
+	}
+
+	// type:metric, ten values and the checksum tag
+	if n := len(reader.tagDict.idToTag); n > 12 {
+		t.Errorf("dictionary holds %d tags, want at most 12", n)
+	}
+	// Uncompacted, every value costs a 4-byte ID and a ~30-byte dictionary
+	// entry; the file's reserved WAL region is not counted
+	if size := reader.header.DataSize + reader.header.TagDictSize; size > values*8 {
+		t.Errorf("data and dictionary of %d bytes for %d values, want at most %d", size, values, values*8)
+	}
+}
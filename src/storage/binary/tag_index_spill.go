@@ -0,0 +1,444 @@
+package binary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"entitydb/logger"
+)
+
+// Spilling cold posting lists. With a memory budget set, the tag index moves
+// posting lists that were not looked up since the previous spill pass to a
+// spill file and keeps only their location in memory. A lookup of a spilled
+// tag reads it back and makes it resident again; a write to it does the same
+// first. Scans over the whole index read spilled lists without loading them.
+const (
+	// Posting lists shorter than this are not worth a disk read
+	tagSpillMinEntries = 8
+
+	// Spilling stops once the index is back under this share of its budget,
+	// so it does not run again on the next write
+	tagSpillLowWater = 0.8
+
+	// The spill file is rewritten when more than half of it, and at least
+	// this much, belongs to lists loaded back into memory
+	tagSpillCompactBytes = 16 * 1024 * 1024
+
+	// Memory held for a spilled tag besides its key
+	tagSpillRefBytes = 16
+)
+
+// tagSpillRef locates a spilled posting list in the spill file
+type tagSpillRef struct {
+	offset int64
+	length uint32
+	count  uint32
+}
+
+// tagSpillFile holds spilled posting lists. The file is unlinked as soon as
+// it is created, so it never outlives the process and disappears with the
+// index it belongs to.
+type tagSpillFile struct {
+	dir    string
+	budget int64
+
+	mu        sync.Mutex // serializes appends and compaction
+	file      *os.File
+	size      int64
+	deadBytes int64
+
+	spilling int32  // a spill pass is running
+	epoch    uint32 // advanced by every spill pass
+
+	spilledTags  int64
+	spilledBytes int64 // memory freed by spilling
+	spills       int64
+	loads        int64
+}
+
+// TagIndexSpillStats describes the spilled part of the tag index
+type TagIndexSpillStats struct {
+	BudgetBytes  int64 `json:"budget_bytes"`
+	SpilledTags  int64 `json:"spilled_tags"`
+	SpilledBytes int64 `json:"spilled_bytes"`
+	FileBytes    int64 `json:"file_bytes"`
+	Spills       int64 `json:"spills"`
+	Loads        int64 `json:"loads"`
+}
+
+// EnableSpill gives the index a memory budget. Once the index holds more than
+// budget bytes, cold posting lists are spilled to a file in dir. It must be
+// called before the index is shared.
+func (s *ShardedTagIndex) EnableSpill(dir string, budget int64) {
+	if budget <= 0 {
+		return
+	}
+	s.spill = &tagSpillFile{dir: dir, budget: budget}
+	for _, shard := range s.shards {
+		shard.spilled = make(map[string]tagSpillRef)
+		shard.lastRead = make(map[string]uint32)
+	}
+}
+
+// openLocked creates the spill file on first use
+func (f *tagSpillFile) openLocked() error {
+	if f.file != nil {
+		return nil
+	}
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(f.dir, "tagindex-*.spill")
+	if err != nil {
+		return err
+	}
+	os.Remove(file.Name())
+	f.file = file
+	f.size = 0
+	f.deadBytes = 0
+	runtime.SetFinalizer(f, func(f *tagSpillFile) {
+		if f.file != nil {
+			f.file.Close()
+		}
+	})
+	return nil
+}
+
+// encodePostings serializes a posting list as a count followed by
+// length-prefixed IDs
+func encodePostings(ids []string) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(ids)))
+	for _, id := range ids {
+		buf = binary.AppendUvarint(buf, uint64(len(id)))
+		buf = append(buf, id...)
+	}
+	return buf
+}
+
+// decodePostings reverses encodePostings
+func decodePostings(buf []byte) ([]string, error) {
+	count, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, fmt.Errorf("corrupt spilled posting list header")
+	}
+	buf = buf[n:]
+	ids := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		length, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < length {
+			return nil, fmt.Errorf("corrupt spilled posting list entry %d", i)
+		}
+		ids = append(ids, string(buf[n:n+int(length)]))
+		buf = buf[n+int(length):]
+	}
+	return ids, nil
+}
+
+// write appends a posting list and returns its location
+func (f *tagSpillFile) write(ids []string) (tagSpillRef, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.openLocked(); err != nil {
+		return tagSpillRef{}, err
+	}
+	data := encodePostings(ids)
+	if _, err := f.file.WriteAt(data, f.size); err != nil {
+		return tagSpillRef{}, err
+	}
+	ref := tagSpillRef{offset: f.size, length: uint32(len(data)), count: uint32(len(ids))}
+	f.size += int64(len(data))
+	return ref, nil
+}
+
+// read loads a spilled posting list. Compaction holds every shard, so a
+// caller holding its shard never reads a file being replaced.
+func (f *tagSpillFile) read(ref tagSpillRef) ([]string, error) {
+	buf := make([]byte, ref.length)
+	if _, err := f.file.ReadAt(buf, ref.offset); err != nil {
+		return nil, err
+	}
+	return decodePostings(buf)
+}
+
+// residentBytes is the memory a resident posting list holds beyond its key
+func residentBytes(ids []string) int64 {
+	return sliceHeaderBytes + stringsBytes(ids)
+}
+
+// postings returns the posting list of a tag, reading it from the spill file
+// if it was spilled. The caller holds the shard lock for reading.
+func (s *ShardedTagIndex) postings(shard *TagIndexShard, tag string) ([]string, bool) {
+	if ids, ok := shard.tags[tag]; ok {
+		return ids, true
+	}
+	ref, ok := shard.spilled[tag]
+	if !ok {
+		return nil, false
+	}
+	ids, err := s.spill.read(ref)
+	if err != nil {
+		logger.Error("Failed to read spilled posting list for tag %s: %v", tag, err)
+		return nil, false
+	}
+	return ids, true
+}
+
+// forEachPostings calls fn for every tag of a shard, reading spilled lists
+// without loading them. The caller holds the shard lock.
+func (s *ShardedTagIndex) forEachPostings(shard *TagIndexShard, fn func(tag string, ids []string)) {
+	for tag, ids := range shard.tags {
+		fn(tag, ids)
+	}
+	for tag := range shard.spilled {
+		if ids, ok := s.postings(shard, tag); ok {
+			fn(tag, ids)
+		}
+	}
+}
+
+// loadLocked makes a spilled posting list resident again. The caller holds
+// the shard lock for writing.
+func (s *ShardedTagIndex) loadLocked(shard *TagIndexShard, tag string) {
+	ref, ok := shard.spilled[tag]
+	if !ok {
+		return
+	}
+	ids, err := s.spill.read(ref)
+	if err != nil {
+		// Keep the tag spilled rather than lose its postings
+		logger.Error("Failed to load spilled posting list for tag %s: %v", tag, err)
+		return
+	}
+	delete(shard.spilled, tag)
+	shard.tags[tag] = ids
+	freed := residentBytes(ids)
+	atomic.AddInt64(&s.memBytes, freed-tagSpillRefBytes)
+
+	f := s.spill
+	atomic.AddInt64(&f.spilledTags, -1)
+	atomic.AddInt64(&f.spilledBytes, -freed)
+	atomic.AddInt64(&f.loads, 1)
+	f.mu.Lock()
+	f.deadBytes += int64(ref.length)
+	f.mu.Unlock()
+}
+
+// loadForRead makes a spilled posting list resident before a lookup. The
+// write lock is only taken when the tag is actually spilled.
+func (s *ShardedTagIndex) loadForRead(shard *TagIndexShard, tag string) {
+	shard.mu.RLock()
+	_, spilled := shard.spilled[tag]
+	shard.mu.RUnlock()
+	if !spilled {
+		return
+	}
+
+	defer s.maybeSpill()
+	shard.queue.AcquireWrite()
+	defer shard.queue.ReleaseWrite()
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	s.loadLocked(shard, tag)
+}
+
+// containsAny reports whether ids holds any of a set of entities
+func containsAny(ids []string, set map[string]struct{}) bool {
+	for _, id := range ids {
+		if _, ok := set[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// noteRead marks a tag as recently read so the next spill pass keeps it
+func (s *ShardedTagIndex) noteRead(shard *TagIndexShard, tag string) {
+	epoch := atomic.LoadUint32(&s.spill.epoch)
+	shard.accessMu.Lock()
+	shard.lastRead[tag] = epoch
+	shard.accessMu.Unlock()
+}
+
+// maybeSpill starts a spill pass in the background once the index is over
+// its budget
+func (s *ShardedTagIndex) maybeSpill() {
+	if s.spill == nil || atomic.LoadInt64(&s.memBytes) <= s.spill.budget {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.spill.spilling, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&s.spill.spilling, 0)
+			s.SpillCold(int64(float64(s.spill.budget) * tagSpillLowWater))
+		}()
+	}
+}
+
+// SpillCold spills posting lists until the index holds at most target bytes.
+// Lists not read since the previous pass go first; if that is not enough,
+// lists not read during this pass follow. It returns the bytes freed.
+func (s *ShardedTagIndex) SpillCold(target int64) int64 {
+	if s.spill == nil {
+		return 0
+	}
+	f := s.spill
+	current := atomic.AddUint32(&f.epoch, 1)
+
+	var freed int64
+	for _, coldBefore := range []uint32{current - 1, current} {
+		for _, shard := range s.shards {
+			if atomic.LoadInt64(&s.memBytes) <= target {
+				break
+			}
+			freed += s.spillShard(shard, coldBefore)
+		}
+	}
+	if freed > 0 {
+		atomic.AddInt64(&f.spills, 1)
+		logger.Info("Spilled %d bytes of cold tag posting lists to disk (index now %d bytes, budget %d)",
+			freed, atomic.LoadInt64(&s.memBytes), f.budget)
+	}
+	s.compactSpill()
+	return freed
+}
+
+// spillShard spills the lists of a shard last read before an epoch
+func (s *ShardedTagIndex) spillShard(shard *TagIndexShard, coldBefore uint32) int64 {
+	f := s.spill
+	shard.queue.AcquireWrite()
+	defer shard.queue.ReleaseWrite()
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.accessMu.Lock()
+	defer shard.accessMu.Unlock()
+
+	var freed int64
+	for tag, ids := range shard.tags {
+		if len(ids) < tagSpillMinEntries {
+			continue
+		}
+		if epoch, read := shard.lastRead[tag]; read && epoch >= coldBefore {
+			continue
+		}
+		ref, err := f.write(ids)
+		if err != nil {
+			logger.Error("Failed to spill tag posting lists: %v", err)
+			return freed
+		}
+		delete(shard.tags, tag)
+		delete(shard.lastRead, tag)
+		shard.spilled[tag] = ref
+		bytes := residentBytes(ids)
+		atomic.AddInt64(&s.memBytes, tagSpillRefBytes-bytes)
+		atomic.AddInt64(&f.spilledTags, 1)
+		atomic.AddInt64(&f.spilledBytes, bytes)
+		freed += bytes - tagSpillRefBytes
+	}
+	// Forget reads older than this pass so the map does not grow without bound
+	for tag, epoch := range shard.lastRead {
+		if epoch < coldBefore {
+			delete(shard.lastRead, tag)
+		}
+	}
+	return freed
+}
+
+// compactSpill rewrites the spill file without the lists loaded back into
+// memory once they make up most of it. Every shard is held meanwhile.
+func (s *ShardedTagIndex) compactSpill() {
+	f := s.spill
+	f.mu.Lock()
+	needed := f.deadBytes >= tagSpillCompactBytes && f.deadBytes*2 > f.size
+	f.mu.Unlock()
+	if !needed {
+		return
+	}
+
+	for _, shard := range s.shards {
+		shard.queue.AcquireWrite()
+		shard.mu.Lock()
+	}
+	defer func() {
+		for _, shard := range s.shards {
+			shard.mu.Unlock()
+			shard.queue.ReleaseWrite()
+		}
+	}()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	old := f.file
+	f.file = nil
+	if err := f.openLocked(); err != nil {
+		f.file = old
+		logger.Error("Failed to compact tag spill file: %v", err)
+		return
+	}
+	moved := make([]map[string]tagSpillRef, len(s.shards))
+	for i, shard := range s.shards {
+		moved[i] = make(map[string]tagSpillRef, len(shard.spilled))
+		for tag, ref := range shard.spilled {
+			buf := make([]byte, ref.length)
+			_, err := old.ReadAt(buf, ref.offset)
+			if err == nil {
+				_, err = f.file.WriteAt(buf, f.size)
+			}
+			if err != nil {
+				f.file.Close()
+				f.file = old
+				logger.Error("Failed to compact tag spill file: %v", err)
+				return
+			}
+			moved[i][tag] = tagSpillRef{offset: f.size, length: ref.length, count: ref.count}
+			f.size += int64(ref.length)
+		}
+	}
+	for i, shard := range s.shards {
+		shard.spilled = moved[i]
+	}
+	old.Close()
+	logger.Debug("Compacted tag spill file to %d bytes", f.size)
+}
+
+// SpillStats describes the spilled part of the index, or reports false when
+// the index has no memory budget
+func (s *ShardedTagIndex) SpillStats() (TagIndexSpillStats, bool) {
+	f := s.spill
+	if f == nil {
+		return TagIndexSpillStats{}, false
+	}
+	f.mu.Lock()
+	fileBytes := f.size
+	f.mu.Unlock()
+	return TagIndexSpillStats{
+		BudgetBytes:  f.budget,
+		SpilledTags:  atomic.LoadInt64(&f.spilledTags),
+		SpilledBytes: atomic.LoadInt64(&f.spilledBytes),
+		FileBytes:    fileBytes,
+		Spills:       atomic.LoadInt64(&f.spills),
+		Loads:        atomic.LoadInt64(&f.loads),
+	}, true
+}
+
+// newTagIndex creates a tag index with the configured memory budget
+func (r *EntityRepository) newTagIndex() *ShardedTagIndex {
+	index := NewShardedTagIndex()
+	if r.config != nil {
+		index.EnableSpill(r.tagSpillDir(), r.config.TagIndexMemoryBudget)
+	}
+	return index
+}
+
+// tagSpillDir is where spilled posting lists are written
+func (r *EntityRepository) tagSpillDir() string {
+	if r.config.TagIndexSpillDir != "" {
+		return r.config.TagIndexSpillDir
+	}
+	return r.config.DataPath
+}
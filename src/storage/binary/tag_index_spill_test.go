@@ -0,0 +1,79 @@
+package binary
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// TestTagIndexSpill checks that spilled posting lists still answer lookups,
+// scans and writes, and that recently read tags are spilled last
+func TestTagIndexSpill(t *testing.T) {
+	tags := NewShardedTagIndex()
+	tags.EnableSpill(t.TempDir(), 1<<30)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("entity-%02d", i)
+		tags.AddTag("type:user", id)
+		tags.AddTag("status:active", id)
+		tags.AddTag("team:core", id)
+	}
+	entries := tags.GetEntryCount()
+	before := tags.MemoryBytes()
+
+	// Freeing a little spills one of the lists not read recently
+	tags.GetEntitiesForTag("type:user")
+	tags.SpillCold(before - 1)
+	if stats, _ := tags.SpillStats(); stats.SpilledTags != 1 {
+		t.Fatalf("spilled %d tags to free a few bytes, want 1", stats.SpilledTags)
+	}
+	if shard := tags.getShard("type:user"); shard.tags["type:user"] == nil {
+		t.Fatal("recently read tag spilled before cold ones")
+	}
+
+	freed := tags.SpillCold(0)
+	stats, _ := tags.SpillStats()
+	if freed <= 0 || tags.MemoryBytes() >= before || stats.SpilledTags != 3 || stats.Spills != 2 {
+		t.Fatalf("freed %d, bytes %d -> %d, stats %+v; want all three lists spilled", freed, before, tags.MemoryBytes(), stats)
+	}
+	if got := tags.GetEntryCount(); got != entries {
+		t.Errorf("entry count after spill = %d, want %d", got, entries)
+	}
+	if got := tags.GetAllTags()["team:core"]; len(got) != 20 {
+		t.Errorf("scan found %d entities for a spilled tag, want 20", len(got))
+	}
+	if !tags.HasEntity("entity-07") {
+		t.Error("entity held only by spilled lists not found")
+	}
+
+	// A lookup loads the list back
+	if got := tags.GetEntitiesForTag("status:active"); len(got) != 20 {
+		t.Fatalf("lookup of spilled tag returned %d entities, want 20", len(got))
+	}
+	if stats, _ = tags.SpillStats(); stats.SpilledTags != 2 || stats.Loads != 1 {
+		t.Errorf("stats after lookup = %+v, want 2 spilled and 1 load", stats)
+	}
+
+	// Writes to spilled tags apply to the full list
+	tags.RemoveTag("team:core", "entity-00")
+	tags.AddTag("type:user", "entity-20")
+	tags.RemoveEntities(map[string]struct{}{"entity-01": {}})
+	team := tags.GetEntitiesForTag("team:core")
+	sort.Strings(team)
+	if len(team) != 18 || team[0] != "entity-02" {
+		t.Errorf("team:core after removals = %v, want entity-02..entity-19", team)
+	}
+	if got := tags.GetEntitiesForTag("type:user"); len(got) != 20 {
+		t.Errorf("type:user after add and removal has %d entities, want 20", len(got))
+	}
+
+	// Everything loaded back matches the accounting of a fresh index
+	fresh := NewShardedTagIndex()
+	for tag, ids := range tags.GetAllTags() {
+		for _, id := range ids {
+			fresh.AddTag(tag, id)
+		}
+	}
+	if stats, _ = tags.SpillStats(); stats.SpilledTags != 0 || tags.MemoryBytes() != fresh.MemoryBytes() {
+		t.Errorf("bytes with nothing spilled = %d (stats %+v), want %d", tags.MemoryBytes(), stats, fresh.MemoryBytes())
+	}
+}
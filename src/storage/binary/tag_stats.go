@@ -0,0 +1,246 @@
+package binary
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cardinality samples are kept at most this often and for this long; the
+// growth rate of a namespace compares its cardinality with the oldest sample
+const (
+	tagGrowthSampleInterval = 5 * time.Minute
+	tagGrowthWindow         = time.Hour
+	tagGrowthMinSpan        = time.Minute
+)
+
+// TagNamespaceStats describes one tag namespace
+type TagNamespaceStats struct {
+	Namespace string `json:"namespace"`
+	// Distinct current values
+	Cardinality int `json:"cardinality"`
+	// Entities carrying a current value, summed over values
+	Assignments int `json:"assignments"`
+	// Most frequent values, most frequent first
+	TopValues []TagValueCount `json:"top_values"`
+	// Distinct values added per hour over the sampled window; omitted until
+	// a sample at least a minute old exists
+	GrowthPerHour *float64 `json:"growth_per_hour,omitempty"`
+	// Tag index keys of the namespace, including timestamped ones
+	IndexKeys int `json:"index_keys"`
+	// Approximate bytes held for the namespace by the tag and value indexes
+	IndexBytes int64 `json:"index_bytes"`
+}
+
+// TagStatsOptions limits a tag statistics report
+type TagStatsOptions struct {
+	Namespace string // report only this namespace when set
+	Limit     int    // namespaces returned, highest cardinality first (0 = all)
+	TopValues int    // values listed per namespace
+}
+
+// TagStats reports the namespaces of the tag index
+type TagStats struct {
+	Namespaces      []TagNamespaceStats `json:"namespaces"`
+	TotalNamespaces int                 `json:"total_namespaces"`
+	TotalIndexBytes int64               `json:"total_index_bytes"` // tag and value indexes, all namespaces
+	GeneratedAt     time.Time           `json:"generated_at"`
+}
+
+// namespaceCardinality returns the number of distinct values per namespace
+func (idx *TagValueIndex) namespaceCardinality() map[string]int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	counts := make(map[string]int, len(idx.namespaces))
+	for namespace, ns := range idx.namespaces {
+		counts[namespace] = len(ns.counts)
+	}
+	return counts
+}
+
+// namespaceStats fills in cardinality, assignments, top values and value
+// index bytes of a namespace
+func (idx *TagValueIndex) namespaceStats(namespace string, top int) TagNamespaceStats {
+	stats := TagNamespaceStats{Namespace: namespace, TopValues: []TagValueCount{}}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ns := idx.namespaces[namespace]
+	if ns == nil {
+		return stats
+	}
+	stats.Cardinality = len(ns.counts)
+	stats.IndexBytes = namespaceValuesBytes(namespace)
+
+	// ns.sorted is in value order, so keeping the first of equal counts
+	// leaves ties alphabetical
+	for _, value := range ns.sorted {
+		count := ns.counts[value]
+		stats.Assignments += count
+		stats.IndexBytes += tagValueBytes(value)
+		if top <= 0 {
+			continue
+		}
+		if len(stats.TopValues) == top && count <= stats.TopValues[top-1].Count {
+			continue
+		}
+		pos := sort.Search(len(stats.TopValues), func(i int) bool {
+			return stats.TopValues[i].Count < count
+		})
+		if len(stats.TopValues) < top {
+			stats.TopValues = append(stats.TopValues, TagValueCount{})
+		}
+		copy(stats.TopValues[pos+1:], stats.TopValues[pos:])
+		stats.TopValues[pos] = TagValueCount{Value: value, Count: count}
+	}
+	return stats
+}
+
+// tagIndexNamespace returns the namespace of a tag index key, which may carry
+// a timestamp prefix
+func tagIndexNamespace(tag string) string {
+	if _, rest, ok := strings.Cut(tag, "|"); ok {
+		tag = rest
+	}
+	namespace, _, _ := strings.Cut(tag, ":")
+	return namespace
+}
+
+// namespaceFootprint counts the keys and approximate bytes of the tag index
+// per namespace. It visits every shard, so it costs a pass over the index.
+func (s *ShardedTagIndex) namespaceFootprint() (map[string]int, map[string]int64) {
+	keys := make(map[string]int)
+	bytes := make(map[string]int64)
+	for _, shard := range s.shards {
+		shard.queue.AcquireRead()
+		shard.mu.RLock()
+		for tag, entities := range shard.tags {
+			namespace := tagIndexNamespace(tag)
+			keys[namespace]++
+			bytes[namespace] += mapEntryBytes + stringBytes(tag) + sliceHeaderBytes + stringsBytes(entities)
+		}
+		shard.mu.RUnlock()
+		shard.queue.ReleaseRead()
+	}
+	return keys, bytes
+}
+
+// tagGrowthSample is the cardinality of every namespace at one time
+type tagGrowthSample struct {
+	at          time.Time
+	cardinality map[string]int
+}
+
+// TagGrowthTracker keeps periodic cardinality samples of the tag namespaces
+// so their growth rate can be reported. Samples are taken when the index is
+// built and whenever statistics are requested, at most every five minutes,
+// and index rebuilds do not disturb them because cardinality is unchanged.
+type TagGrowthTracker struct {
+	mu      sync.Mutex
+	samples []tagGrowthSample
+}
+
+// NewTagGrowthTracker creates a tracker without samples
+func NewTagGrowthTracker() *TagGrowthTracker {
+	return &TagGrowthTracker{}
+}
+
+// observe records a sample unless a recent one exists, drops samples outside
+// the window and returns the oldest remaining one
+func (t *TagGrowthTracker) observe(now time.Time, cardinality map[string]int) *tagGrowthSample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n := len(t.samples); n == 0 || now.Sub(t.samples[n-1].at) >= tagGrowthSampleInterval {
+		t.samples = append(t.samples, tagGrowthSample{at: now, cardinality: cardinality})
+	}
+	// Keep one sample at or beyond the window so the rate covers a full hour
+	for len(t.samples) > 1 && now.Sub(t.samples[1].at) >= tagGrowthWindow {
+		t.samples = t.samples[1:]
+	}
+	oldest := t.samples[0]
+	return &oldest
+}
+
+// growthPerHour returns the values added per hour since a sample, or nil when
+// the sample is too recent to give a meaningful rate
+func growthPerHour(since *tagGrowthSample, now time.Time, namespace string, cardinality int) *float64 {
+	span := now.Sub(since.at)
+	if span < tagGrowthMinSpan {
+		return nil
+	}
+	rate := float64(cardinality-since.cardinality[namespace]) / span.Hours()
+	return &rate
+}
+
+// GetTagStats reports cardinality, top values, growth and index memory per
+// tag namespace, highest cardinality first
+func (r *EntityRepository) GetTagStats(opts TagStatsOptions) TagStats {
+	r.mu.RLock()
+	tags := r.shardedTagIndex
+	r.mu.RUnlock()
+
+	now := time.Now()
+	cardinality := tags.values.namespaceCardinality()
+	since := r.tagGrowth.observe(now, cardinality)
+	keys, bytes := tags.namespaceFootprint()
+
+	// Namespaces holding only timestamped or valueless tags have no values
+	// but still occupy the index
+	namespaces := make([]string, 0, len(keys))
+	for namespace := range keys {
+		namespaces = append(namespaces, namespace)
+	}
+	for namespace := range cardinality {
+		if _, ok := keys[namespace]; !ok {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	report := TagStats{
+		TotalNamespaces: len(namespaces),
+		TotalIndexBytes: tags.MemoryBytes() + tags.values.MemoryBytes(),
+		GeneratedAt:     now,
+	}
+
+	if opts.Namespace != "" {
+		namespaces = namespaces[:0]
+		if _, ok := keys[opts.Namespace]; ok {
+			namespaces = append(namespaces, opts.Namespace)
+		} else if _, ok := cardinality[opts.Namespace]; ok {
+			namespaces = append(namespaces, opts.Namespace)
+		}
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		a, b := namespaces[i], namespaces[j]
+		if cardinality[a] != cardinality[b] {
+			return cardinality[a] > cardinality[b]
+		}
+		if bytes[a] != bytes[b] {
+			return bytes[a] > bytes[b]
+		}
+		return a < b
+	})
+	if opts.Limit > 0 && len(namespaces) > opts.Limit {
+		namespaces = namespaces[:opts.Limit]
+	}
+
+	report.Namespaces = make([]TagNamespaceStats, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		stats := tags.values.namespaceStats(namespace, opts.TopValues)
+		stats.IndexKeys = keys[namespace]
+		stats.IndexBytes += bytes[namespace]
+		stats.GrowthPerHour = growthPerHour(since, now, namespace, stats.Cardinality)
+		report.Namespaces = append(report.Namespaces, stats)
+	}
+	return report
+}
+
+// sampleTagGrowth records a cardinality sample, used once the index is built
+// so growth is measured from startup
+func (r *EntityRepository) sampleTagGrowth() {
+	r.tagGrowth.observe(time.Now(), r.shardedTagIndex.values.namespaceCardinality())
+}
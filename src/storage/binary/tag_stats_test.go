@@ -0,0 +1,53 @@
+package binary
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestTagStats checks cardinality, top values and index footprint per
+// namespace, and that growth is measured against an older sample
+func TestTagStats(t *testing.T) {
+	repo := &EntityRepository{shardedTagIndex: NewShardedTagIndex(), tagGrowth: NewTagGrowthTracker()}
+	tags := repo.shardedTagIndex
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("e%d", i)
+		tags.AddTag("type:user", id)
+		tags.AddTag(fmt.Sprintf("session:s%d", i), id)
+		tags.AddTag(fmt.Sprintf("%d|session:s%d", i, i), id)
+	}
+	tags.AddTag("type:admin", "e0")
+
+	// An hour-old sample without sessions makes all three sessions growth
+	repo.tagGrowth.observe(time.Now().Add(-time.Hour), map[string]int{"type": 2})
+
+	stats := repo.GetTagStats(TagStatsOptions{TopValues: 1})
+	if stats.TotalNamespaces != 2 || len(stats.Namespaces) != 2 {
+		t.Fatalf("namespaces = %+v, want session and type", stats.Namespaces)
+	}
+	session, typ := stats.Namespaces[0], stats.Namespaces[1]
+	if session.Namespace != "session" || session.Cardinality != 3 || session.Assignments != 3 || session.IndexKeys != 6 {
+		t.Errorf("session stats = %+v, want 3 values on 6 index keys", session)
+	}
+	if typ.Namespace != "type" || typ.Cardinality != 2 || typ.Assignments != 4 {
+		t.Errorf("type stats = %+v, want 2 values on 4 entities", typ)
+	}
+	if len(typ.TopValues) != 1 || typ.TopValues[0] != (TagValueCount{Value: "user", Count: 3}) {
+		t.Errorf("type top values = %v, want user with 3", typ.TopValues)
+	}
+	if session.GrowthPerHour == nil || *session.GrowthPerHour < 2.9 || *session.GrowthPerHour > 3 {
+		t.Errorf("session growth = %v, want about 3 per hour", session.GrowthPerHour)
+	}
+	if typ.GrowthPerHour == nil || *typ.GrowthPerHour != 0 {
+		t.Errorf("type growth = %v, want 0", typ.GrowthPerHour)
+	}
+	if want := tags.MemoryBytes() + tags.values.MemoryBytes(); stats.TotalIndexBytes != want {
+		t.Errorf("total index bytes = %d, want %d", stats.TotalIndexBytes, want)
+	}
+
+	only := repo.GetTagStats(TagStatsOptions{Namespace: "type"})
+	if len(only.Namespaces) != 1 || only.Namespaces[0].Namespace != "type" || len(only.Namespaces[0].TopValues) != 0 {
+		t.Errorf("filtered stats = %+v, want type without top values", only.Namespaces)
+	}
+}
@@ -0,0 +1,144 @@
+package binary
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TagValueCount is a tag value with the number of entities carrying it
+type TagValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// TagValueIndex keeps the values of every tag namespace in sorted order with
+// their entity counts, so values sharing a prefix are found with a binary
+// search instead of a scan over the whole tag index. Only current (untimed)
+// tags are tracked; counts include entities marked deleted.
+type TagValueIndex struct {
+	mu         sync.RWMutex
+	namespaces map[string]*namespaceValues
+	memBytes   int64 // approximate, guarded by mu
+}
+
+// namespaceValues holds the values of one namespace
+type namespaceValues struct {
+	sorted []string
+	counts map[string]int
+}
+
+// NewTagValueIndex creates an empty tag value index
+func NewTagValueIndex() *TagValueIndex {
+	return &TagValueIndex{namespaces: make(map[string]*namespaceValues)}
+}
+
+// splitIndexedTag splits an untimed "namespace:value" tag. Temporal index
+// keys and tags without a value are rejected.
+func splitIndexedTag(tag string) (string, string, bool) {
+	if strings.Contains(tag, "|") {
+		return "", "", false
+	}
+	namespace, value, ok := strings.Cut(tag, ":")
+	if !ok || namespace == "" || value == "" {
+		return "", "", false
+	}
+	return namespace, value, true
+}
+
+// adjust changes the entity count of a tag by delta
+func (idx *TagValueIndex) adjust(tag string, delta int) {
+	namespace, value, ok := splitIndexedTag(tag)
+	if !ok || delta == 0 {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	ns := idx.namespaces[namespace]
+	if ns == nil {
+		if delta < 0 {
+			return
+		}
+		ns = &namespaceValues{counts: make(map[string]int)}
+		idx.namespaces[namespace] = ns
+		idx.memBytes += namespaceValuesBytes(namespace)
+	}
+
+	count, exists := ns.counts[value]
+	count += delta
+	pos := sort.SearchStrings(ns.sorted, value)
+	switch {
+	case count > 0 && !exists:
+		ns.sorted = append(ns.sorted, "")
+		copy(ns.sorted[pos+1:], ns.sorted[pos:])
+		ns.sorted[pos] = value
+		ns.counts[value] = count
+		idx.memBytes += tagValueBytes(value)
+	case count > 0:
+		ns.counts[value] = count
+	case exists:
+		ns.sorted = append(ns.sorted[:pos], ns.sorted[pos+1:]...)
+		delete(ns.counts, value)
+		idx.memBytes -= tagValueBytes(value)
+		if len(ns.counts) == 0 {
+			delete(idx.namespaces, namespace)
+			idx.memBytes -= namespaceValuesBytes(namespace)
+		}
+	}
+}
+
+// namespaceValuesBytes approximates a namespace entry without its values
+func namespaceValuesBytes(namespace string) int64 {
+	return mapEntryBytes + stringBytes(namespace) + sliceHeaderBytes + mapHeaderBytes
+}
+
+// tagValueBytes approximates a value, which is held in both the sorted slice
+// and the count map sharing one string
+func tagValueBytes(value string) int64 {
+	return stringBytes(value) + stringHeaderBytes + mapEntryBytes
+}
+
+// MemoryBytes returns the approximate bytes held by the index
+func (idx *TagValueIndex) MemoryBytes() int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.memBytes
+}
+
+// Suggest returns up to limit values of a namespace starting with prefix,
+// most frequent first and alphabetically among equal counts
+func (idx *TagValueIndex) Suggest(namespace, prefix string, limit int) []TagValueCount {
+	idx.mu.RLock()
+	ns := idx.namespaces[namespace]
+	var matches []TagValueCount
+	if ns != nil {
+		for i := sort.SearchStrings(ns.sorted, prefix); i < len(ns.sorted); i++ {
+			value := ns.sorted[i]
+			if !strings.HasPrefix(value, prefix) {
+				break
+			}
+			matches = append(matches, TagValueCount{Value: value, Count: ns.counts[value]})
+		}
+	}
+	idx.mu.RUnlock()
+
+	// Matches are already in value order, so a stable sort keeps ties alphabetical
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Count > matches[j].Count
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	if matches == nil {
+		matches = []TagValueCount{}
+	}
+	return matches
+}
+
+// SuggestTagValues returns the most frequent values of a tag namespace that
+// start with prefix
+func (r *EntityRepository) SuggestTagValues(namespace, prefix string, limit int) []TagValueCount {
+	return r.shardedTagIndex.values.Suggest(namespace, prefix, limit)
+}
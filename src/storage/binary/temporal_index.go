@@ -1,24 +1,41 @@
 package binary
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"entitydb/models"
+	"strconv"
 	"sync"
 	"time"
 	"sort"
 	"strings"
 )
 
-// TemporalIndex provides efficient temporal queries
+// TemporalIndex provides efficient temporal queries. It records every change
+// of an entity: tags added (at their timestamps), tags removed and content
+// replaced (at the time of the write). Added tags are rebuilt from the stored
+// timestamped tags on startup; removals and content changes are only known
+// from writes seen since.
 type TemporalIndex struct {
 	mu              sync.RWMutex
 	timestampIndex  map[string][]TemporalEntry // entityID -> sorted temporal entries
 	timeRangeIndex  map[int64][]string         // timestamp bucket -> entity IDs
+	contentDigests  map[string]string          // entityID -> digest of the last content written
 	bucketSize      int64                      // bucket size in seconds (3600 = 1 hour)
+	memBytes        int64                      // approximate bytes held by the maps
 }
 
 type TemporalEntry struct {
 	EntityID  string
 	Timestamp time.Time
-	Tag       string
+	Tag       string // tag added (with its timestamp) or removed (without)
+
+	// Type is models.ChangeTagAdded, ChangeTagRemoved or ChangeContentUpdated
+	Type string
+
+	// OldValue and NewValue are the content digests of a content change
+	OldValue string
+	NewValue string
 }
 
 // NewTemporalIndex creates a new temporal index
@@ -26,6 +43,7 @@ func NewTemporalIndex() *TemporalIndex {
 	return &TemporalIndex{
 		timestampIndex: make(map[string][]TemporalEntry),
 		timeRangeIndex: make(map[int64][]string),
+		contentDigests: make(map[string]string),
 		bucketSize:     3600, // 1 hour buckets
 	}
 }
@@ -34,7 +52,7 @@ func NewTemporalIndex() *TemporalIndex {
 func (ti *TemporalIndex) AddEntry(entityID string, tag string, timestamp time.Time) {
 	ti.mu.Lock()
 	defer ti.mu.Unlock()
-	
+
 	// Extract timestamp from temporal tag if not provided
 	if timestamp.IsZero() && strings.Contains(tag, "|") {
 		parts := strings.SplitN(tag, "|", 2)
@@ -45,38 +63,254 @@ func (ti *TemporalIndex) AddEntry(entityID string, tag string, timestamp time.Ti
 			}
 		}
 	}
-	
+
 	if timestamp.IsZero() {
 		return // Skip non-temporal tags
 	}
-	
-	entry := TemporalEntry{
+
+	ti.insertLocked(TemporalEntry{
 		EntityID:  entityID,
 		Timestamp: timestamp,
 		Tag:       tag,
+		Type:      models.ChangeTagAdded,
+	})
+}
+
+// insertLocked adds an entry in timestamp order, after entries of the same
+// timestamp. An added tag already recorded at its timestamp is not added
+// again, so indexing an entity twice does not duplicate its history.
+func (ti *TemporalIndex) insertLocked(entry TemporalEntry) {
+	entries := ti.timestampIndex[entry.EntityID]
+	pos := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Timestamp.After(entry.Timestamp)
+	})
+	if entry.Type == models.ChangeTagAdded {
+		for i := pos - 1; i >= 0 && entries[i].Timestamp.Equal(entry.Timestamp); i-- {
+			if entries[i].Type == models.ChangeTagAdded && entries[i].Tag == entry.Tag {
+				return
+			}
+		}
 	}
-	
+
 	// Add to entity timestamp index
-	ti.timestampIndex[entityID] = append(ti.timestampIndex[entityID], entry)
-	
-	// Sort entries for this entity by timestamp
-	sort.Slice(ti.timestampIndex[entityID], func(i, j int) bool {
-		return ti.timestampIndex[entityID][i].Timestamp.Before(ti.timestampIndex[entityID][j].Timestamp)
-	})
-	
+	if entries == nil {
+		ti.memBytes += mapEntryBytes + stringBytes(entry.EntityID) + sliceHeaderBytes
+	}
+	entries = append(entries, TemporalEntry{})
+	copy(entries[pos+1:], entries[pos:])
+	entries[pos] = entry
+	ti.timestampIndex[entry.EntityID] = entries
+	ti.memBytes += temporalEntryBytes(entry)
+
 	// Add to time range index (bucketed)
-	bucket := timestamp.Unix() / ti.bucketSize
-	ti.timeRangeIndex[bucket] = append(ti.timeRangeIndex[bucket], entityID)
+	bucket := entry.Timestamp.Unix() / ti.bucketSize
+	if _, exists := ti.timeRangeIndex[bucket]; !exists {
+		ti.memBytes += mapEntryBytes + sliceHeaderBytes
+	}
+	ti.timeRangeIndex[bucket] = append(ti.timeRangeIndex[bucket], entry.EntityID)
+	ti.memBytes += stringBytes(entry.EntityID)
+}
+
+// contentDigest identifies content in change records, in the form of the
+// checksum tags written with every entity
+func contentDigest(content []byte) string {
+	if len(content) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// RecordWrite records the changes a create or update makes to an entity,
+// against the state the index holds for it. New timestamped tags are added
+// at their timestamps; tags that are no longer present are recorded as
+// removed at the time of the write. A tag stamped again with a new timestamp
+// is not a change unless it makes a value its namespace's current value again.
+//
+// previous is the entity as stored before the write, or nil when it is not
+// known. It is only used for the content digest of entities whose content
+// the index has not seen written.
+func (ti *TemporalIndex) RecordWrite(entity, previous *models.Entity, at time.Time) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+
+	entries, seen := ti.timestampIndex[entity.ID]
+	present := presentTags(entries)
+	beforeLatest := latestByNamespace(present)
+
+	after := make(map[string]time.Time, len(entity.Tags))
+	for _, tag := range entity.Tags {
+		stamp, clean := temporalTagTime(tag, at)
+		if current, ok := after[clean]; !ok || stamp.After(current) {
+			after[clean] = stamp
+		}
+	}
+	afterLatest := latestByNamespace(after)
+
+	for _, tag := range entity.Tags {
+		stamp, clean := temporalTagTime(tag, at)
+		if before, ok := present[clean]; ok {
+			namespace := tagNamespace(clean)
+			if !stamp.After(before) || beforeLatest[namespace] == clean || afterLatest[namespace] != clean {
+				continue
+			}
+		}
+		if !strings.Contains(tag, "|") {
+			tag = strconv.FormatInt(at.UnixNano(), 10) + "|" + tag
+		}
+		ti.insertLocked(TemporalEntry{EntityID: entity.ID, Timestamp: stamp, Tag: tag, Type: models.ChangeTagAdded})
+	}
+	for clean := range present {
+		if _, ok := after[clean]; !ok {
+			ti.insertLocked(TemporalEntry{EntityID: entity.ID, Timestamp: at, Tag: clean, Type: models.ChangeTagRemoved})
+		}
+	}
+
+	digest := contentDigest(entity.Content)
+	oldDigest, known := ti.contentDigests[entity.ID]
+	if !known {
+		switch {
+		case previous != nil:
+			oldDigest, known = contentDigest(previous.Content), true
+		case !seen:
+			// A new entity starts out without content
+			known = true
+		}
+	}
+	if known && digest != oldDigest {
+		ti.insertLocked(TemporalEntry{
+			EntityID:  entity.ID,
+			Timestamp: at,
+			Type:      models.ChangeContentUpdated,
+			OldValue:  oldDigest,
+			NewValue:  digest,
+		})
+	}
+	if _, exists := ti.contentDigests[entity.ID]; !exists {
+		ti.memBytes += mapEntryBytes + stringBytes(entity.ID)
+	} else {
+		ti.memBytes -= stringBytes(ti.contentDigests[entity.ID])
+	}
+	ti.contentDigests[entity.ID] = digest
+	ti.memBytes += stringBytes(digest)
+}
+
+// temporalTagTime returns a tag's timestamp, or def for tags without one,
+// and the tag without it
+func temporalTagTime(tag string, def time.Time) (time.Time, string) {
+	stamp, clean, ok := strings.Cut(tag, "|")
+	if !ok {
+		return def, tag
+	}
+	if nanos, err := strconv.ParseInt(stamp, 10, 64); err == nil {
+		return time.Unix(0, nanos), clean
+	}
+	return def, clean
+}
+
+// tagNamespace returns the namespace of a tag without timestamp
+func tagNamespace(tag string) string {
+	if idx := strings.Index(tag, ":"); idx != -1 {
+		return tag[:idx]
+	}
+	if idx := strings.Index(tag, "="); idx != -1 {
+		return tag[:idx]
+	}
+	return ""
+}
+
+// presentTags replays entries into the tags present after them, without
+// timestamps, with the time each was last added
+func presentTags(entries []TemporalEntry) map[string]time.Time {
+	present := make(map[string]time.Time)
+	for _, entry := range entries {
+		switch entry.Type {
+		case models.ChangeTagAdded:
+			_, clean := temporalTagTime(entry.Tag, entry.Timestamp)
+			present[clean] = entry.Timestamp
+		case models.ChangeTagRemoved:
+			delete(present, entry.Tag)
+		}
+	}
+	return present
+}
+
+// latestByNamespace returns the most recently added tag of each namespace,
+// the value GetTagValue reports
+func latestByNamespace(tags map[string]time.Time) map[string]string {
+	latest := make(map[string]string)
+	stamps := make(map[string]time.Time)
+	for tag, stamp := range tags {
+		namespace := tagNamespace(tag)
+		if namespace == "" {
+			continue
+		}
+		if current, ok := stamps[namespace]; !ok || stamp.After(current) || (stamp.Equal(current) && tag > latest[namespace]) {
+			latest[namespace], stamps[namespace] = tag, stamp
+		}
+	}
+	return latest
+}
+
+// absorbRecordedChanges copies the history of another index into this one.
+// Removals, content changes and tags added before a removal cannot be
+// rebuilt from stored tags; entries this index already holds are skipped.
+func (ti *TemporalIndex) absorbRecordedChanges(other *TemporalIndex) {
+	if other == nil || other == ti {
+		return
+	}
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+
+	for entityID, entries := range other.timestampIndex {
+		for _, entry := range entries {
+			if !ti.hasEntryLocked(entry) {
+				ti.insertLocked(entry)
+			}
+		}
+		if digest, ok := other.contentDigests[entityID]; ok {
+			if _, exists := ti.contentDigests[entityID]; !exists {
+				ti.memBytes += mapEntryBytes + stringBytes(entityID) + stringBytes(digest)
+				ti.contentDigests[entityID] = digest
+			}
+		}
+	}
+}
+
+// hasEntryLocked reports whether an entry is already recorded
+func (ti *TemporalIndex) hasEntryLocked(entry TemporalEntry) bool {
+	entries := ti.timestampIndex[entry.EntityID]
+	pos := sort.Search(len(entries), func(i int) bool {
+		return !entries[i].Timestamp.Before(entry.Timestamp)
+	})
+	for ; pos < len(entries) && entries[pos].Timestamp.Equal(entry.Timestamp); pos++ {
+		if entries[pos] == entry {
+			return true
+		}
+	}
+	return false
 }
 
 // RemoveEntity removes all entries for an entity
 func (ti *TemporalIndex) RemoveEntity(entityID string) {
 	ti.mu.Lock()
 	defer ti.mu.Unlock()
-	
+
 	// Remove from timestamp index
+	if entries, exists := ti.timestampIndex[entityID]; exists {
+		ti.memBytes -= mapEntryBytes + stringBytes(entityID) + sliceHeaderBytes
+		for _, entry := range entries {
+			ti.memBytes -= temporalEntryBytes(entry)
+		}
+	}
 	delete(ti.timestampIndex, entityID)
-	
+	if digest, exists := ti.contentDigests[entityID]; exists {
+		ti.memBytes -= mapEntryBytes + stringBytes(entityID) + stringBytes(digest)
+		delete(ti.contentDigests, entityID)
+	}
+
 	// Remove from time range index
 	for bucket, entities := range ti.timeRangeIndex {
 		filtered := make([]string, 0)
@@ -85,56 +319,52 @@ func (ti *TemporalIndex) RemoveEntity(entityID string) {
 				filtered = append(filtered, id)
 			}
 		}
+		ti.memBytes -= int64(len(entities)-len(filtered)) * stringBytes(entityID)
 		if len(filtered) == 0 {
 			delete(ti.timeRangeIndex, bucket)
+			ti.memBytes -= mapEntryBytes + sliceHeaderBytes
 		} else {
 			ti.timeRangeIndex[bucket] = filtered
 		}
 	}
 }
 
-// GetEntityAsOf returns the entity state at a specific timestamp
+// temporalEntryBytes approximates an entry: its strings and a time.Time
+func temporalEntryBytes(entry TemporalEntry) int64 {
+	return stringBytes(entry.EntityID) + stringBytes(entry.Tag) + stringBytes(entry.Type) +
+		stringBytes(entry.OldValue) + stringBytes(entry.NewValue) + timeBytes
+}
+
+// MemoryBytes returns the approximate bytes held by the index
+func (ti *TemporalIndex) MemoryBytes() int64 {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	return ti.memBytes
+}
+
+// GetEntityAsOf returns the entity state at a specific timestamp: the most
+// recently added tag of each namespace among the tags not removed by then
 func (ti *TemporalIndex) GetEntityAsOf(entityID string, timestamp time.Time) []string {
 	ti.mu.RLock()
 	defer ti.mu.RUnlock()
-	
+
 	entries, exists := ti.timestampIndex[entityID]
 	if !exists {
 		return nil
 	}
-	
-	// Binary search for entries up to the timestamp
-	validTags := make([]string, 0)
-	namespaceLatest := make(map[string]string)
-	
-	for _, entry := range entries {
-		if entry.Timestamp.After(timestamp) {
-			break
-		}
-		
-		// Extract namespace from tag
-		tag := entry.Tag
-		if idx := strings.Index(tag, "|"); idx != -1 {
-			tag = tag[idx+1:]
-		}
-		
-		namespace := ""
-		if idx := strings.Index(tag, ":"); idx != -1 {
-			namespace = tag[:idx]
-		} else if idx := strings.Index(tag, "="); idx != -1 {
-			namespace = tag[:idx]
-		}
-		
-		if namespace != "" {
-			namespaceLatest[namespace] = tag
-		}
-	}
-	
+
+	// Entries are sorted, so those up to the timestamp are a prefix
+	end := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Timestamp.After(timestamp)
+	})
+	namespaceLatest := latestByNamespace(presentTags(entries[:end]))
+
 	// Convert map to slice
+	validTags := make([]string, 0, len(namespaceLatest))
 	for _, tag := range namespaceLatest {
 		validTags = append(validTags, tag)
 	}
-	
+
 	return validTags
 }
 
@@ -142,20 +372,20 @@ func (ti *TemporalIndex) GetEntityAsOf(entityID string, timestamp time.Time) []s
 func (ti *TemporalIndex) GetChangesInRange(from, to time.Time) []string {
 	ti.mu.RLock()
 	defer ti.mu.RUnlock()
-	
+
 	entitySet := make(map[string]bool)
-	
+
 	// Calculate bucket range
 	fromBucket := from.Unix() / ti.bucketSize
 	toBucket := to.Unix() / ti.bucketSize
-	
+
 	// Check all buckets in range
 	for bucket := fromBucket; bucket <= toBucket; bucket++ {
 		entities, exists := ti.timeRangeIndex[bucket]
 		if !exists {
 			continue
 		}
-		
+
 		// Add entities from this bucket
 		for _, entityID := range entities {
 			// Fine-grained check for entities in this bucket
@@ -163,7 +393,7 @@ func (ti *TemporalIndex) GetChangesInRange(from, to time.Time) []string {
 			if !exists {
 				continue
 			}
-			
+
 			for _, entry := range entries {
 				if entry.Timestamp.After(from) && entry.Timestamp.Before(to) {
 					entitySet[entityID] = true
@@ -172,13 +402,13 @@ func (ti *TemporalIndex) GetChangesInRange(from, to time.Time) []string {
 			}
 		}
 	}
-	
+
 	// Convert set to slice
 	result := make([]string, 0, len(entitySet))
 	for entityID := range entitySet {
 		result = append(result, entityID)
 	}
-	
+
 	return result
 }
 
@@ -191,18 +421,77 @@ func (ti *TemporalIndex) GetRecentChanges(since time.Time) []string {
 func (ti *TemporalIndex) GetEntityHistory(entityID string, from, to time.Time) []TemporalEntry {
 	ti.mu.RLock()
 	defer ti.mu.RUnlock()
-	
+
 	entries, exists := ti.timestampIndex[entityID]
 	if !exists {
 		return nil
 	}
-	
+
 	result := make([]TemporalEntry, 0)
 	for _, entry := range entries {
 		if entry.Timestamp.After(from) && entry.Timestamp.Before(to) {
 			result = append(result, entry)
 		}
 	}
-	
+
 	return result
-}
\ No newline at end of file
+}
+
+// GetEntityChanges returns the changes of an entity from from up to and
+// including to, oldest first. A zero from or to leaves that end open. With a
+// positive limit only the most recent limit changes are returned. An added
+// tag carries the value it replaced as the current value of its namespace.
+func (ti *TemporalIndex) GetEntityChanges(entityID string, from, to time.Time, limit int) []*models.EntityChange {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+
+	changes := make([]*models.EntityChange, 0)
+	present := make(map[string]time.Time)
+	latest := make(map[string]string)
+	for _, entry := range ti.timestampIndex[entityID] {
+		if !to.IsZero() && entry.Timestamp.After(to) {
+			break
+		}
+		change := &models.EntityChange{
+			Type:      entry.Type,
+			Timestamp: entry.Timestamp.UnixNano(),
+			EntityID:  entityID,
+		}
+		switch entry.Type {
+		case models.ChangeTagAdded:
+			_, clean := temporalTagTime(entry.Tag, entry.Timestamp)
+			change.NewValue = clean
+			present[clean] = entry.Timestamp
+			if namespace := tagNamespace(clean); namespace != "" {
+				// Entries are in timestamp order, so the added tag is the latest
+				if previous := latest[namespace]; previous != clean {
+					change.OldValue = previous
+				}
+				latest[namespace] = clean
+			}
+		case models.ChangeTagRemoved:
+			change.OldValue = entry.Tag
+			delete(present, entry.Tag)
+			if namespace := tagNamespace(entry.Tag); namespace != "" && latest[namespace] == entry.Tag {
+				// The namespace falls back to its most recent remaining tag
+				delete(latest, namespace)
+				var stamp time.Time
+				for tag, added := range present {
+					if tagNamespace(tag) == namespace && added.After(stamp) {
+						latest[namespace], stamp = tag, added
+					}
+				}
+			}
+		default:
+			change.OldValue, change.NewValue = entry.OldValue, entry.NewValue
+		}
+		if from.IsZero() || !entry.Timestamp.Before(from) {
+			changes = append(changes, change)
+		}
+	}
+
+	if limit > 0 && len(changes) > limit {
+		changes = changes[len(changes)-limit:]
+	}
+	return changes
+}
@@ -0,0 +1,142 @@
+package binary
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"entitydb/models"
+)
+
+// stamped returns a tag with the timestamp of t
+func stamped(t time.Time, tag string) string {
+	return fmt.Sprintf("%d|%s", t.UnixNano(), tag)
+}
+
+// sortChanges orders changes by time, then type and values
+func sortChanges(changes []models.EntityChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Timestamp != b.Timestamp {
+			return a.Timestamp < b.Timestamp
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.OldValue+a.NewValue < b.OldValue+b.NewValue
+	})
+}
+
+// TestTemporalIndexRecordsChanges checks that writes are recorded as tags
+// added with the value they replaced, tags removed and content updated, at
+// the times they happened
+func TestTemporalIndexRecordsChanges(t *testing.T) {
+	ti := NewTemporalIndex()
+	t0 := time.Unix(1700000000, 0)
+	t1, t2 := t0.Add(time.Minute), t0.Add(2*time.Minute)
+
+	created := &models.Entity{ID: "e1", Tags: []string{stamped(t0, "type:task"), stamped(t0, "status:open")}}
+	ti.RecordWrite(created, nil, t0)
+
+	// A new value is added next to the old one, which it supersedes
+	updated := &models.Entity{ID: "e1", Tags: append(append([]string(nil), created.Tags...), stamped(t1, "status:done")), Content: []byte("report")}
+	ti.RecordWrite(updated, created, t1)
+
+	removed := &models.Entity{ID: "e1", Tags: []string{stamped(t0, "type:task")}, Content: []byte("report")}
+	ti.RecordWrite(removed, updated, t2)
+
+	changes := ti.GetEntityChanges("e1", time.Time{}, time.Time{}, 0)
+	want := []models.EntityChange{
+		{Type: models.ChangeTagAdded, Timestamp: t0.UnixNano(), NewValue: "status:open"},
+		{Type: models.ChangeTagAdded, Timestamp: t0.UnixNano(), NewValue: "type:task"},
+		{Type: models.ChangeTagAdded, Timestamp: t1.UnixNano(), OldValue: "status:open", NewValue: "status:done"},
+		{Type: models.ChangeContentUpdated, Timestamp: t1.UnixNano(), NewValue: contentDigest([]byte("report"))},
+		{Type: models.ChangeTagRemoved, Timestamp: t2.UnixNano(), OldValue: "status:done"},
+		{Type: models.ChangeTagRemoved, Timestamp: t2.UnixNano(), OldValue: "status:open"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	got := make([]models.EntityChange, len(changes))
+	for i, change := range changes {
+		got[i] = *change
+		got[i].EntityID = ""
+	}
+	// Removals of one write are recorded in no particular order
+	sortChanges(got)
+	sortChanges(want)
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("change %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// The range and limit select changes, and as-of honors removals
+	if ranged := ti.GetEntityChanges("e1", t1, t1, 0); len(ranged) != 2 {
+		t.Errorf("got %d changes at t1, want 2", len(ranged))
+	}
+	if last := ti.GetEntityChanges("e1", time.Time{}, time.Time{}, 1); len(last) != 1 || last[0].Timestamp != t2.UnixNano() {
+		t.Errorf("limit 1 returned %+v, want the last change", last)
+	}
+	if tags := ti.GetEntityAsOf("e1", t1); len(tags) != 2 {
+		t.Errorf("tags as of t1 = %v, want type:task and status:done", tags)
+	}
+	if tags := ti.GetEntityAsOf("e1", t2); len(tags) != 1 || tags[0] != "type:task" {
+		t.Errorf("tags as of t2 = %v, want only type:task", tags)
+	}
+}
+
+// TestTemporalIndexNoDuplicateChanges checks that indexing an entity again
+// and stamping an unchanged tag again add no changes
+func TestTemporalIndexNoDuplicateChanges(t *testing.T) {
+	ti := NewTemporalIndex()
+	t0 := time.Unix(1700000000, 0)
+	t1 := t0.Add(time.Minute)
+
+	entity := &models.Entity{ID: "e1", Tags: []string{stamped(t0, "type:task"), stamped(t0, "status:open")}}
+	ti.RecordWrite(entity, nil, t0)
+	for _, tag := range entity.Tags {
+		ti.AddEntry(entity.ID, tag, t0)
+	}
+
+	restamped := &models.Entity{ID: "e1", Tags: []string{stamped(t0, "type:task"), stamped(t1, "status:open")}}
+	ti.RecordWrite(restamped, entity, t1)
+
+	if changes := ti.GetEntityChanges("e1", time.Time{}, time.Time{}, 0); len(changes) != 2 {
+		t.Fatalf("got %d changes, want the 2 tags added at creation: %+v", len(changes), changes)
+	}
+
+	ti.RemoveEntity("e1")
+	if ti.MemoryBytes() != 0 {
+		t.Errorf("MemoryBytes = %d after removing the only entity, want 0", ti.MemoryBytes())
+	}
+}
+
+// TestTemporalIndexAbsorbRecordedChanges checks that a rebuilt index keeps
+// the history that stored tags cannot reproduce
+func TestTemporalIndexAbsorbRecordedChanges(t *testing.T) {
+	old := NewTemporalIndex()
+	t0 := time.Unix(1700000000, 0)
+	t1 := t0.Add(time.Minute)
+
+	created := &models.Entity{ID: "e1", Tags: []string{stamped(t0, "type:task"), stamped(t0, "draft")}}
+	old.RecordWrite(created, nil, t0)
+	updated := &models.Entity{ID: "e1", Tags: []string{stamped(t0, "type:task")}, Content: []byte("body")}
+	old.RecordWrite(updated, created, t1)
+
+	rebuilt := NewTemporalIndex()
+	for _, tag := range updated.Tags {
+		rebuilt.AddEntry(updated.ID, tag, t0)
+	}
+	rebuilt.absorbRecordedChanges(old)
+
+	got := rebuilt.GetEntityChanges("e1", time.Time{}, time.Time{}, 0)
+	want := old.GetEntityChanges("e1", time.Time{}, time.Time{}, 0)
+	if len(got) != len(want) {
+		t.Fatalf("rebuilt index has %d changes, want %d: %+v", len(got), len(want), got)
+	}
+	if rebuilt.MemoryBytes() != old.MemoryBytes() {
+		t.Errorf("rebuilt index holds %d bytes, want %d", rebuilt.MemoryBytes(), old.MemoryBytes())
+	}
+}
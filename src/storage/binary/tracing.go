@@ -0,0 +1,95 @@
+package binary
+
+import (
+	"context"
+	"entitydb/models"
+	"entitydb/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ContextRepository is implemented by repositories that record the storage
+// spans of an operation (WAL write, index update, disk I/O, cache lookups)
+// under the trace of its context
+type ContextRepository interface {
+	CreateContext(ctx context.Context, entity *models.Entity) error
+	UpdateContext(ctx context.Context, entity *models.Entity) error
+	GetByIDContext(ctx context.Context, id string) (*models.Entity, error)
+}
+
+// entityAttributes describe the entity a storage span operates on
+func entityAttributes(entity *models.Entity) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("entity.id", entity.ID),
+		attribute.Int("entity.tags", len(entity.Tags)),
+		attribute.Int("entity.content_bytes", len(entity.Content)),
+	}
+}
+
+// The CachedRepository variants record the cache lookup and hand the
+// trace on to the wrapped repository
+
+// GetByIDContext gets an entity through the cache, recording the lookup
+// under the trace of ctx
+func (r *CachedRepository) GetByIDContext(ctx context.Context, id string) (entity *models.Entity, err error) {
+	ctx, span := tracing.Start(ctx, "cache.get", attribute.String("entity.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if entity, ok := r.entityCache.Get(id); ok {
+		r.cacheHits.Add(1)
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return entity, nil
+	}
+	r.cacheMisses.Add(1)
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+
+	if base, ok := r.EntityRepository.(ContextRepository); ok {
+		entity, err = base.GetByIDContext(ctx, id)
+	} else {
+		entity, err = r.EntityRepository.GetByID(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.entityCache.Put(id, entity)
+	return entity, nil
+}
+
+// CreateContext creates an entity, recording its storage spans under the
+// trace of ctx
+func (r *CachedRepository) CreateContext(ctx context.Context, entity *models.Entity) error {
+	base, ok := r.EntityRepository.(ContextRepository)
+	if !ok {
+		return r.Create(entity)
+	}
+	if err := base.CreateContext(ctx, entity); err != nil {
+		return err
+	}
+	r.entityCache.Put(entity.ID, entity)
+	r.invalidateTagCaches(entity.Tags)
+	return nil
+}
+
+// UpdateContext updates an entity, recording its storage spans under the
+// trace of ctx
+func (r *CachedRepository) UpdateContext(ctx context.Context, entity *models.Entity) error {
+	base, ok := r.EntityRepository.(ContextRepository)
+	if !ok {
+		return r.Update(entity)
+	}
+	oldEntity, _ := base.GetByIDContext(ctx, entity.ID)
+	if err := base.UpdateContext(ctx, entity); err != nil {
+		return err
+	}
+	r.entityCache.Put(entity.ID, entity)
+	if oldEntity != nil {
+		r.invalidateTagCaches(oldEntity.Tags)
+	}
+	r.invalidateTagCaches(entity.Tags)
+	return nil
+}
+
+var (
+	_ ContextRepository = (*EntityRepository)(nil)
+	_ ContextRepository = (*CachedRepository)(nil)
+)
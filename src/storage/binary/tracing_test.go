@@ -0,0 +1,68 @@
+package binary
+
+import (
+	"context"
+	"testing"
+
+	"entitydb/models"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestStorageSpans checks that repository operations record child spans
+// under the caller's span and none without one
+func TestStorageSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	entity := models.NewEntity()
+	entity.AddTag("type:document")
+	if err := repo.Create(entity); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetByID(entity.ID); err != nil {
+		t.Fatal(err)
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Fatalf("recorded %d spans without a parent span", len(spans))
+	}
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "request")
+	traced := models.NewEntity()
+	traced.AddTag("type:document")
+	if err := repo.CreateContext(ctx, traced); err != nil {
+		t.Fatal(err)
+	}
+	traced.AddTag("status:draft")
+	if err := repo.UpdateContext(ctx, traced); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetByIDContext(ctx, traced.ID); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	names := map[string]int{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s is outside the request trace", span.Name())
+		}
+		names[span.Name()]++
+	}
+	for _, name := range []string{"repository.create", "repository.update", "repository.get"} {
+		if names[name] == 0 {
+			t.Errorf("no %s span in %v", name, names)
+		}
+	}
+	if names["wal.write"] == 0 && names["batch.enqueue"] == 0 {
+		t.Errorf("no WAL or batch span in %v", names)
+	}
+}
@@ -0,0 +1,92 @@
+package binary
+
+import (
+	"context"
+	"entitydb/models"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// ErrUpsertKeyAmbiguous is returned when more than one entity carries an
+// upsert key tag, so the entity to update cannot be chosen
+var ErrUpsertKeyAmbiguous = errors.New("upsert key held by more than one entity")
+
+// UpsertFunc builds the entity to store for an upsert. existing is the
+// entity holding the key tag, or nil when a new entity will be created. It
+// returns the entity to write, which for an update must keep existing's ID.
+type UpsertFunc func(existing *models.Entity) (*models.Entity, error)
+
+// lockUpsertKey acquires the upsert lock for a key tag and returns its release
+func (r *EntityRepository) lockUpsertKey(keyTag string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(keyTag))
+	lock := &r.upsertLocks[h.Sum32()%uint32(len(r.upsertLocks))]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// Upsert creates or updates the entity identified by a unique key tag, such
+// as external:id:1234. The entity holding the tag is looked up in the tag
+// index and passed to apply; when none holds it, apply receives nil and its
+// result is created. The key tag is added to a created entity that lacks it.
+// It reports whether the entity was created.
+//
+// Upserts of the same key are serialized, and an update also holds the
+// entity's update lock, so two upserts cannot both create an entity for a
+// key and no update interleaves between reading the entity and writing it.
+// Entities given the key tag by other writes are not serialized against.
+func (r *EntityRepository) Upsert(keyTag string, apply UpsertFunc) (*models.Entity, bool, error) {
+	keyTag = strings.TrimSpace(keyTag)
+	if keyTag == "" {
+		return nil, false, fmt.Errorf("upsert key tag is required")
+	}
+	unlockKey := r.lockUpsertKey(keyTag)
+	defer unlockKey()
+
+	// A create still queued by the batch writer is not in the tag index yet
+	if r.useBatchWrites && r.batchWriter != nil {
+		if err := r.batchWriter.Flush(); err != nil {
+			return nil, false, fmt.Errorf("failed to flush pending writes: %w", err)
+		}
+	}
+
+	holders := r.tagCandidates(keyTag)
+	if len(holders) > 1 {
+		return nil, false, fmt.Errorf("%w: %s is held by %d entities", ErrUpsertKeyAmbiguous, keyTag, len(holders))
+	}
+	if len(holders) == 0 {
+		entity, err := apply(nil)
+		if err != nil {
+			return nil, false, err
+		}
+		if !entity.HasTag(keyTag) {
+			entity.AddTag(keyTag)
+		}
+		if err := r.Create(entity); err != nil {
+			return nil, false, err
+		}
+		return entity, true, nil
+	}
+
+	if r.changeCounters != nil {
+		unlock := r.changeCounters.lockEntity(holders[0])
+		defer unlock()
+	}
+	existing, err := r.GetByID(holders[0])
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read entity %s holding %s: %w", holders[0], keyTag, err)
+	}
+	entity, err := apply(existing)
+	if err != nil {
+		return nil, false, err
+	}
+	if entity.ID != existing.ID {
+		return nil, false, fmt.Errorf("upsert of %s changed entity ID %s to %s", keyTag, existing.ID, entity.ID)
+	}
+	if err := r.update(context.Background(), entity); err != nil {
+		return nil, false, err
+	}
+	return entity, false, nil
+}
@@ -0,0 +1,65 @@
+package binary
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"entitydb/models"
+)
+
+// TestUpsertConcurrent checks that concurrent upserts of one key create a
+// single entity and apply every update to it
+func TestUpsertConcurrent(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer repo.Close()
+
+	const workers = 8
+	var created, updated atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, isNew, err := repo.Upsert("external:id:1234", func(existing *models.Entity) (*models.Entity, error) {
+				if existing == nil {
+					entity := models.NewEntity()
+					entity.AddTag("type:order")
+					entity.AddTag(fmt.Sprintf("writer:%d", i))
+					return entity, nil
+				}
+				entity := &models.Entity{ID: existing.ID, Tags: append([]string(nil), existing.Tags...), Content: existing.Content}
+				entity.AddTag(fmt.Sprintf("writer:%d", i))
+				return entity, nil
+			})
+			if err != nil {
+				t.Errorf("Upsert: %v", err)
+				return
+			}
+			if isNew {
+				created.Add(1)
+			} else {
+				updated.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created.Load() != 1 || updated.Load() != workers-1 {
+		t.Fatalf("upserts created %d and updated %d entities, want 1 and %d", created.Load(), updated.Load(), workers-1)
+	}
+	holders, err := repo.ListByTag("external:id:1234")
+	if err != nil || len(holders) != 1 {
+		t.Fatalf("key held by %d entities (%v), want 1", len(holders), err)
+	}
+	for i := 0; i < workers; i++ {
+		if !holders[0].HasTag(fmt.Sprintf("writer:%d", i)) {
+			t.Errorf("update of writer %d was lost: %v", i, holders[0].GetTagsWithoutTimestamp())
+		}
+	}
+
+	if _, _, err := repo.Upsert(" ", nil); err == nil {
+		t.Error("Upsert with an empty key succeeded")
+	}
+}
@@ -9,10 +9,12 @@ import (
 	"encoding/hex"
 	"entitydb/models"
 	"entitydb/logger"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -45,6 +47,11 @@ const (
 	WALOpCheckpoint                  // Checkpoint marker for truncation
 )
 
+// walContentSealed is set in an entry's op type byte when its entity
+// content is sealed. Plaintext content may start with any bytes, including
+// the sealed content magic, so only the flag tells the two apart.
+const walContentSealed = 0x80
+
 // WAL implements a write-ahead log for ensuring durability and crash recovery.
 // All write operations are first logged to the WAL before being applied to
 // the main data file. This ensures that no data is lost even if the system
@@ -75,6 +82,23 @@ type WAL struct {
 	isUnified  bool           // Whether WAL is embedded in unified file
 	walOffset  uint64         // Offset to WAL section in unified file
 	walSize    uint64         // Size of WAL section in unified file
+
+	lastReplayProcessed int // Entries applied by the most recent Replay
+	lastReplayFailed    int // Entries skipped as corrupt or failed by the most recent Replay
+
+	archiver *WALArchiver  // Copies entries to archive segments (nil when archiving is disabled)
+	cdc      *CDCPublisher // Publishes operations to a message broker (nil when CDC is disabled)
+
+	groupOnce   sync.Once
+	group       *groupCommit  // Coalesces the fsyncs of concurrent writers
+	unpublished []walPending  // Entries written but not yet synced, in log order
+}
+
+// walPending is an entry written to the WAL file and waiting for the sync
+// that makes it durable, after which it is archived and published
+type walPending struct {
+	entry WALEntry
+	data  []byte
 }
 
 // NewWAL creates a new write-ahead log instance for the given unified database file.
@@ -270,8 +294,33 @@ func (w *WAL) LogCreate(entity *models.Entity) error {
 		return err
 	}
 	
-	op.SetMetadata("sequence", w.sequence)
-	logger.TraceIf("wal", "Successfully logged CREATE for entity %s at sequence %d", entity.ID, w.sequence)
+	sequence := w.currentSequence()
+	op.SetMetadata("sequence", sequence)
+	logger.TraceIf("wal", "Successfully logged CREATE for entity %s at sequence %d", entity.ID, sequence)
+	return nil
+}
+
+// LogCreateBatch logs the creation of several entities with one fsync.
+// The batch writer uses it to group-commit queued writes.
+func (w *WAL) LogCreateBatch(entities []*models.Entity) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	now := time.Now()
+	entries := make([]WALEntry, len(entities))
+	for i, entity := range entities {
+		entries[i] = WALEntry{
+			OpType:    WALOpCreate,
+			EntityID:  entity.ID,
+			Entity:    entity,
+			Timestamp: now,
+		}
+	}
+	if err := w.logEntries(entries); err != nil {
+		logger.Error("Failed to log CREATE batch of %d entities: %v", len(entities), err)
+		return err
+	}
+	logger.TraceIf("wal", "Logged CREATE batch of %d entities", len(entities))
 	return nil
 }
 
@@ -299,8 +348,9 @@ func (w *WAL) LogUpdate(entity *models.Entity) error {
 		return err
 	}
 	
-	op.SetMetadata("sequence", w.sequence)
-	logger.TraceIf("wal", "Successfully logged UPDATE for entity %s at sequence %d", entity.ID, w.sequence)
+	sequence := w.currentSequence()
+	op.SetMetadata("sequence", sequence)
+	logger.TraceIf("wal", "Successfully logged UPDATE for entity %s at sequence %d", entity.ID, sequence)
 	return nil
 }
 
@@ -325,8 +375,9 @@ func (w *WAL) LogDelete(entityID string) error {
 		return err
 	}
 	
-	op.SetMetadata("sequence", w.sequence)
-	logger.TraceIf("wal", "Successfully logged DELETE for entity %s at sequence %d", entityID, w.sequence)
+	sequence := w.currentSequence()
+	op.SetMetadata("sequence", sequence)
+	logger.TraceIf("wal", "Successfully logged DELETE for entity %s at sequence %d", entityID, sequence)
 	return nil
 }
 
@@ -359,8 +410,8 @@ func (w *WAL) LogCheckpoint() error {
 //   1. Serialize the entry to binary format
 //   2. Write 4-byte length prefix for framing
 //   3. Write serialized entry data
-//   4. Sync file to ensure durability
-//   5. Increment sequence number
+//   4. Increment sequence number
+//   5. Wait for a sync that covers the entry (shared by concurrent writers)
 //
 // Format: [Length:4][SerializedEntry:Length]
 //
@@ -373,45 +424,106 @@ func (w *WAL) LogCheckpoint() error {
 // Returns:
 //   - error: Serialization or I/O errors
 //
-// Note: This method must hold the mutex for the entire operation
+// Note: logEntries holds the mutex for the entire operation
 // to ensure write atomicity and sequence number consistency.
 func (w *WAL) logEntry(entry WALEntry) error {
+	return w.logEntries([]WALEntry{entry})
+}
+
+// logEntries writes entries to the WAL file and waits until a sync covers
+// them. Concurrent callers share syncs (group commit): while one caller
+// syncs, others append and park until the next sync, so under load one
+// fsync covers many entries. Entries are archived and published to CDC only
+// once synced, in log order.
+func (w *WAL) logEntries(entries []WALEntry) error {
 	w.mu.Lock()
-	defer w.mu.Unlock()
 	
 	// Initialize connection to unified file if needed (deferred WAL)
 	if w.file == nil && w.isUnified {
 		if err := w.initializeUnifiedConnection(); err != nil {
+			w.mu.Unlock()
 			return fmt.Errorf("failed to initialize unified WAL connection: %w", err)
 		}
 	}
 	
-	// Serialize the entry
-	data, err := w.serializeEntry(entry)
-	if err != nil {
-		return err
-	}
-	
-	// Write the length prefix
-	if err := binary.Write(w.file, binary.LittleEndian, uint32(len(data))); err != nil {
-		return err
+	for _, entry := range entries {
+		// Serialize the entry
+		data, err := w.serializeEntry(entry)
+		if err != nil {
+			w.mu.Unlock()
+			return err
+		}
+		
+		// Write the length prefix
+		if err := binary.Write(w.file, binary.LittleEndian, uint32(len(data))); err != nil {
+			w.mu.Unlock()
+			return err
+		}
+		
+		// Write the data
+		if _, err := w.file.Write(data); err != nil {
+			w.mu.Unlock()
+			return err
+		}
+		w.unpublished = append(w.unpublished, walPending{entry: entry, data: data})
+		w.sequence++
 	}
 	
-	// Write the data
-	if _, err := w.file.Write(data); err != nil {
-		return err
-	}
+	// Taken under the lock, so tickets follow the log order
+	ticket := w.groupCommit().ticket()
+	w.mu.Unlock()
 	
 	// Sync to ensure durability
-	if err := w.file.Sync(); err != nil {
-		return err
+	return w.groupCommit().wait(ticket)
+}
+
+// groupCommit returns the WAL's group commit, creating it on first use
+func (w *WAL) groupCommit() *groupCommit {
+	w.groupOnce.Do(func() {
+		w.group = newGroupCommit(func() error {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			return w.syncLocked()
+		})
+	})
+	return w.group
+}
+
+// syncLocked syncs the WAL file, then archives and publishes the entries
+// the sync made durable. w.mu must be held.
+func (w *WAL) syncLocked() error {
+	if w.file != nil {
+		if err := w.file.Sync(); err != nil {
+			return err
+		}
 	}
-	
-	w.sequence++
-	
+	for _, pending := range w.unpublished {
+		// The entry is durable in the WAL; a failed archive copy only costs
+		// point-in-time recovery coverage
+		if err := w.archiver.Append(pending.data, pending.entry.Timestamp); err != nil {
+			logger.Error("Failed to archive WAL entry for %s: %v", pending.entry.EntityID, err)
+		}
+		if err := w.cdc.Append(pending.entry); err != nil {
+			logger.Error("Failed to add WAL entry for %s to the CDC outbox: %v", pending.entry.EntityID, err)
+		}
+	}
+	w.unpublished = w.unpublished[:0]
 	return nil
 }
 
+// currentSequence returns the sequence number of the next entry
+func (w *WAL) currentSequence() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sequence
+}
+
+// GroupCommitStats reports the entries logged and the fsyncs that made
+// them durable
+func (w *WAL) GroupCommitStats() GroupCommitStats {
+	return w.groupCommit().stats()
+}
+
 // serializeEntry serializes a WAL entry
 func (w *WAL) serializeEntry(entry WALEntry) ([]byte, error) {
 	// Enhanced format with checksum:
@@ -469,12 +581,19 @@ func (w *WAL) serializeEntry(entry WALEntry) ([]byte, error) {
 			entityBuf = append(entityBuf, []byte(tag)...)
 		}
 		
-		// Store content length and content
-		contentLen := uint32(len(entry.Entity.Content))
+		// Store content length and content, sealed when encryption is enabled
+		content, sealed, err := sealContent(entry.EntityID, entry.Entity.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt content: %w", err)
+		}
+		if sealed {
+			buf[0] |= walContentSealed
+		}
+		contentLen := uint32(len(content))
 		contentLenBuf := make([]byte, 4)
 		binary.LittleEndian.PutUint32(contentLenBuf, contentLen)
 		entityBuf = append(entityBuf, contentLenBuf...)
-		entityBuf = append(entityBuf, entry.Entity.Content...)
+		entityBuf = append(entityBuf, content...)
 		
 		// Write entity buffer length and data
 		entityLen := uint32(len(entityBuf))
@@ -554,41 +673,16 @@ func (w *WAL) Replay(callback func(entry WALEntry) error) error {
 	entriesFailed := 0
 	
 	for {
-		// Read length prefix
-		var length uint32
-		if err := binary.Read(w.file, binary.LittleEndian, &length); err != nil {
-			if err == io.EOF {
-				break
-			}
-			op.Fail(err)
-			logger.Error("Failed to read entry length: %v", err)
-			return err
-		}
-		
-		// Validate length to prevent memory exhaustion
-		const maxEntrySize = 100 * 1024 * 1024 // 100MB max per entry
-		if length > maxEntrySize {
-			entriesFailed++
-			logger.Error("WAL entry too large (%d bytes), skipping corrupted entry", length)
-			// Skip this corrupted entry by seeking past it
-			if _, err := w.file.Seek(int64(length), io.SeekCurrent); err != nil {
-				logger.Error("Failed to skip corrupted entry: %v", err)
-				return err
-			}
-			continue
+		data, err := w.readFrame()
+		if err == io.EOF {
+			break
 		}
-		
-		if length == 0 {
+		if err == errCorruptFrame {
 			entriesFailed++
-			logger.Error("WAL entry has zero length, skipping")
 			continue
 		}
-		
-		// Read data
-		data := make([]byte, length)
-		if _, err := io.ReadFull(w.file, data); err != nil {
+		if err != nil {
 			op.Fail(err)
-			logger.Error("Failed to read entry data (length=%d): %v", length, err)
 			return err
 		}
 		
@@ -614,12 +708,168 @@ func (w *WAL) Replay(callback func(entry WALEntry) error) error {
 	
 	op.SetMetadata("entries_processed", entriesProcessed)
 	op.SetMetadata("entries_failed", entriesFailed)
+	w.lastReplayProcessed = entriesProcessed
+	w.lastReplayFailed = entriesFailed
 	
 	logger.Info("WAL replay completed: %d entries processed, %d failed", entriesProcessed, entriesFailed)
 	
 	return nil
 }
 
+// walReplayBatchSize is the number of WAL frames decoded together by
+// ReplayParallel when no batch size is given
+const walReplayBatchSize = 1024
+
+// ReplayParallel replays the WAL like Replay, decoding entries on several
+// goroutines. Frames are read in batches of batchSize; each batch is decoded
+// in parallel and handed to callback in log order, so the callback sees the
+// same sequence Replay would deliver. Decoding, which includes decompression
+// and decryption, dominates replay time, while applying entries usually
+// needs locks the callback already serializes on.
+func (w *WAL) ReplayParallel(workers, batchSize int, callback func(entries []WALEntry)) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if batchSize < 1 {
+		batchSize = walReplayBatchSize
+	}
+	
+	seekPos := int64(0)
+	if w.isUnified {
+		seekPos = int64(w.walOffset)
+	}
+	if _, err := w.file.Seek(seekPos, io.SeekStart); err != nil {
+		logger.Error("Failed to seek to WAL position %d: %v", seekPos, err)
+		return err
+	}
+	var walBytes int64
+	if stat, err := w.file.Stat(); err == nil {
+		walBytes = stat.Size() - seekPos
+	}
+	logger.Info("Starting parallel WAL replay from %s (%d bytes, %d workers)", w.path, walBytes, workers)
+	progress := newStartupProgress("WAL replay", "bytes", walBytes)
+	
+	entriesProcessed := 0
+	entriesFailed := 0
+	var readBytes int64
+	
+	frames := make([][]byte, 0, batchSize)
+	decoded := make([]*WALEntry, batchSize)
+	flush := func() {
+		var next int64 = -1
+		var wg sync.WaitGroup
+		for i := 0; i < workers && i < len(frames); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					j := int(atomic.AddInt64(&next, 1))
+					if j >= len(frames) {
+						return
+					}
+					entry, err := w.deserializeEntry(frames[j])
+					if err != nil {
+						logger.Error("Failed to deserialize entry: %v", err)
+						entry = nil
+					}
+					decoded[j] = entry
+				}
+			}()
+		}
+		wg.Wait()
+		
+		batch := make([]WALEntry, 0, len(frames))
+		for j := range frames {
+			if decoded[j] == nil {
+				entriesFailed++
+				continue
+			}
+			batch = append(batch, *decoded[j])
+			decoded[j] = nil
+		}
+		entriesProcessed += len(batch)
+		if len(batch) > 0 {
+			callback(batch)
+		}
+		frames = frames[:0]
+		progress.update(readBytes)
+	}
+	
+	for {
+		data, err := w.readFrame()
+		if err == io.EOF {
+			break
+		}
+		if err == errCorruptFrame {
+			entriesFailed++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		readBytes += int64(len(data)) + 4
+		frames = append(frames, data)
+		if len(frames) == batchSize {
+			flush()
+		}
+	}
+	flush()
+	
+	w.lastReplayProcessed = entriesProcessed
+	w.lastReplayFailed = entriesFailed
+	logger.Info("WAL replay completed: %d entries processed, %d failed", entriesProcessed, entriesFailed)
+	return nil
+}
+
+// errCorruptFrame marks a WAL frame that was skipped as corrupt
+var errCorruptFrame = errors.New("corrupt WAL frame")
+
+// readFrame reads the next length-prefixed entry from the WAL file. It
+// returns io.EOF at the end of the log and errCorruptFrame for a frame that
+// was skipped because its length is invalid.
+func (w *WAL) readFrame() ([]byte, error) {
+	// Read length prefix
+	var length uint32
+	if err := binary.Read(w.file, binary.LittleEndian, &length); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		logger.Error("Failed to read entry length: %v", err)
+		return nil, err
+	}
+	
+	// Validate length to prevent memory exhaustion
+	const maxEntrySize = 100 * 1024 * 1024 // 100MB max per entry
+	if length > maxEntrySize {
+		logger.Error("WAL entry too large (%d bytes), skipping corrupted entry", length)
+		// Skip this corrupted entry by seeking past it
+		if _, err := w.file.Seek(int64(length), io.SeekCurrent); err != nil {
+			logger.Error("Failed to skip corrupted entry: %v", err)
+			return nil, err
+		}
+		return nil, errCorruptFrame
+	}
+	
+	if length == 0 {
+		logger.Error("WAL entry has zero length, skipping")
+		return nil, errCorruptFrame
+	}
+	
+	// Read data
+	data := make([]byte, length)
+	if _, err := io.ReadFull(w.file, data); err != nil {
+		logger.Error("Failed to read entry data (length=%d): %v", length, err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// LastReplayStats returns how many entries the most recent Replay applied
+// and how many it skipped
+func (w *WAL) LastReplayStats() (processed, failed int) {
+	return w.lastReplayProcessed, w.lastReplayFailed
+}
+
 // deserializeEntry deserializes a WAL entry
 func (w *WAL) deserializeEntry(data []byte) (*WALEntry, error) {
 	if len(data) < 11 { // Minimum size: OpType(1) + Timestamp(8) + IDLen(2)
@@ -629,7 +879,8 @@ func (w *WAL) deserializeEntry(data []byte) (*WALEntry, error) {
 	entry := &WALEntry{}
 	
 	// Read op type
-	entry.OpType = WALOpType(data[0])
+	entry.OpType = WALOpType(data[0] &^ walContentSealed)
+	sealed := data[0]&walContentSealed != 0
 	
 	// Read timestamp
 	ts := binary.LittleEndian.Uint64(data[1:9])
@@ -714,6 +965,13 @@ func (w *WAL) deserializeEntry(data []byte) (*WALEntry, error) {
 				
 				if contentLen > 0 && entityPos+int(contentLen) <= len(entityData) {
 					entity.Content = entityData[entityPos : entityPos+int(contentLen)]
+					if sealed {
+						content, err := openContent(entry.EntityID, entity.Content)
+						if err != nil {
+							return nil, fmt.Errorf("failed to decrypt content of entity %s: %w", entry.EntityID, err)
+						}
+						entity.Content = content
+					}
 				}
 			}
 			
@@ -799,6 +1057,16 @@ func (w *WAL) Truncate() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	
+	// Publish entries still waiting for a group commit before they go
+	if err := w.syncLocked(); err != nil {
+		return fmt.Errorf("WAL not truncated: %w", err)
+	}
+	
+	// Archive the entries about to be discarded; keep them if that fails
+	if err := w.archiveSegment(); err != nil {
+		return fmt.Errorf("WAL not truncated: %w", err)
+	}
+	
 	// Close the current file
 	if err := w.file.Close(); err != nil {
 		return err
@@ -838,6 +1106,16 @@ func (w *WAL) Close() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	
+	if err := w.syncLocked(); err != nil {
+		logger.Error("Failed to sync WAL on close: %v", err)
+	}
+	if err := w.archiveSegment(); err != nil {
+		logger.Error("Failed to archive WAL segment on close: %v", err)
+	}
+	if err := w.cdc.Close(); err != nil {
+		logger.Error("Failed to close CDC outbox: %v", err)
+	}
+	
 	return w.file.Close()
 }
 
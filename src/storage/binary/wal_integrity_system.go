@@ -2,6 +2,7 @@ package binary
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"entitydb/config"
 	"entitydb/logger"
@@ -251,11 +252,17 @@ func (f *FileSystemMonitor) checkFileDescriptors() error {
 }
 
 func (f *FileSystemMonitor) checkFileSystemIntegrity() error {
-	// Basic file system integrity check
-	testFile := "/opt/entitydb/var/.fstest"
-	
-	// Test write
-	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
+	// Basic file system integrity check, with a file of its own so that
+	// concurrent checks do not remove each other's
+	file, err := os.CreateTemp("/opt/entitydb/var", ".fstest-*")
+	if err != nil {
+		return fmt.Errorf("file system write test failed: %w", err)
+	}
+	testFile := file.Name()
+	_, err = file.Write([]byte("test"))
+	file.Close()
+	if err != nil {
+		os.Remove(testFile)
 		return fmt.Errorf("file system write test failed: %w", err)
 	}
 
@@ -470,7 +477,36 @@ func (w *WALIntegritySystem) createRoutineBackup() error {
 	timestamp := time.Now().Format("20060102-150405")
 	routineBackup := fmt.Sprintf("%s.routine-%s", w.backupPath, timestamp)
 	
-	return copyFileForWAL(w.filePath, routineBackup)
+	if err := copyFileForWAL(w.filePath, routineBackup); err != nil {
+		return err
+	}
+	
+	// A missing manifest leaves the backup usable, so failures are only logged
+	if w.config.BackupManifestEnabled {
+		if err := w.writeRoutineManifest(routineBackup); err != nil {
+			logger.Warn("Failed to write manifest for backup %s: %v", routineBackup, err)
+		}
+	}
+	return nil
+}
+
+// writeRoutineManifest writes the manifest of a routine backup, signed when
+// a signing key is configured
+func (w *WALIntegritySystem) writeRoutineManifest(backup string) error {
+	var key ed25519.PrivateKey
+	if w.config.BackupSigningKey != "" {
+		var err error
+		if key, err = LoadBackupSigningKey(w.config.BackupSigningKey); err != nil {
+			return fmt.Errorf("load signing key: %w", err)
+		}
+	}
+	
+	manifest, err := WriteBackupManifest(backup, backup+".scan", key)
+	if err != nil {
+		return err
+	}
+	logger.Debug("Wrote manifest for backup %s: %d entities, signed: %v", backup, len(manifest.Entities), key != nil)
+	return nil
 }
 
 // cleanupOldBackups implements intelligent backup retention based on configuration
@@ -488,7 +524,7 @@ func (w *WALIntegritySystem) cleanupOldBackups() error {
 	// Filter and sort routine backup files
 	var backups []os.FileInfo
 	for _, file := range files {
-		if strings.HasPrefix(file.Name(), backupPrefix) && !file.IsDir() {
+		if strings.HasPrefix(file.Name(), backupPrefix) && !file.IsDir() && !isBackupManifest(file.Name()) {
 			backups = append(backups, file)
 		}
 	}
@@ -517,6 +553,7 @@ func (w *WALIntegritySystem) cleanupOldBackups() error {
 		if err := os.Remove(backupPath); err != nil {
 			logger.Warn("Failed to delete old backup %s: %v", backup.Name(), err)
 		} else {
+			os.Remove(BackupManifestPath(backupPath))
 			deleted++
 			logger.Debug("Deleted old backup: %s", backup.Name())
 		}
@@ -236,6 +236,14 @@ func (wrm *WALRotationManager) rotateWAL() error {
 		return fmt.Errorf("WAL not initialized")
 	}
 	
+	// Archive the entries rotation discards
+	wrm.wal.mu.Lock()
+	err := wrm.wal.archiveSegment()
+	wrm.wal.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("WAL not rotated: %w", err)
+	}
+	
 	// For unified files, we truncate the WAL section
 	if wrm.wal.isUnified {
 		return wrm.truncateUnifiedWAL()
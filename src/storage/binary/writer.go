@@ -311,18 +311,16 @@ func (w *Writer) WriteEntity(entity *models.Entity) error {
 		logger.TraceIf("storage", "Added checksum tag for entity %s: %s", entity.ID, checksumTag)
 	}
 	
-	// Convert tags to IDs
-	tagIDs := make([]uint32, len(tags))
-	for i, tag := range tags {
-		tagIDs[i] = w.tagDict.GetOrCreateID(tag)
-		logger.TraceIf("storage", "Tag '%s' assigned ID %d", tag, tagIDs[i])
-	}
+	// Encode tags compactly: temporal tags share one dictionary entry per
+	// tag body and store their timestamps as deltas
+	tagSection := appendCompactTags(nil, tags, w.tagDict)
 	
 	// Write entity header
 	header := EntityHeader{
 		Modified:     time.Now().Unix(),
-		TagCount:     uint16(len(tagIDs)),
+		TagCount:     uint16(len(tags)),
 		ContentCount: 1, // Now we store content as a single item
+		Reserved:     entityFlagCompactTags,
 	}
 	
 	logger.TraceIf("storage", "Writing entity header: Modified=%d, TagCount=%d, ContentCount=%d", 
@@ -330,10 +328,8 @@ func (w *Writer) WriteEntity(entity *models.Entity) error {
 	
 	binary.Write(buffer, binary.LittleEndian, header)
 	
-	// Write tag IDs
-	for _, id := range tagIDs {
-		binary.Write(buffer, binary.LittleEndian, id)
-	}
+	// Write tags
+	buffer.Write(tagSection)
 	
 	// Content Encoding Algorithm:
 	// The binary format stores content with metadata for proper decoding
@@ -369,11 +365,12 @@ func (w *Writer) WriteEntity(entity *models.Entity) error {
 		logger.TraceIf("storage", "Final content type for entity %s: %s", entity.ID, contentType)
 		
 		// Compression Strategy:
-		// - Content > 1KB is compressed using gzip
+		// - Content > 1KB is compressed with the codec configured for its
+		//   content type (gzip unless configured otherwise)
 		// - Compression is skipped if it doesn't reduce size
 		// - Failed compression falls back to uncompressed storage
-		// - Uses memory pools to avoid allocation overhead
-		compressed, err := CompressWithPool(entity.Content)
+		// - The codec is recorded in the compression byte for readers
+		compressed, err := CompressForContentType(entity.Content, contentType)
 		if err != nil {
 			logger.Warn("Compression failed for entity %s: %v, storing uncompressed", entity.ID, err)
 			compressed = &CompressedContent{
@@ -383,8 +380,26 @@ func (w *Writer) WriteEntity(entity *models.Entity) error {
 			}
 		}
 		
+		// Encryption happens after compression, since ciphertext does not
+		// compress; the flag bit in the compression byte marks sealed content
+		compressionByte := uint8(compressed.Type)
+		sealed, encrypted, err := sealContent(entity.ID, compressed.Data)
+		if err != nil {
+			op.Fail(err)
+			logger.Error("Failed to encrypt content for entity %s: %v", entity.ID, err)
+			return fmt.Errorf("failed to encrypt content: %w", err)
+		}
+		if encrypted {
+			compressed = &CompressedContent{
+				Type:         compressed.Type,
+				Data:         sealed,
+				OriginalSize: compressed.OriginalSize,
+			}
+			compressionByte |= contentEncryptedFlag
+		}
+		
 		// Write compression type
-		binary.Write(buffer, binary.LittleEndian, uint8(compressed.Type))
+		binary.Write(buffer, binary.LittleEndian, compressionByte)
 		
 		// For JSON content, store it directly without additional wrapping
 		if contentType == "application/json" {
@@ -726,19 +741,18 @@ func (w *Writer) Close() error {
 		return err
 	}
 	
-	// If there's a significant discrepancy, use calculated position
-	discrepancy := seekPos - dictOffset
-	if discrepancy < 0 {
-		discrepancy = -discrepancy
-	}
-	if discrepancy > 1024 { // Allow 1KB tolerance
-		logger.Warn("File position mismatch: calculated=%d, seek=%d, using calculated position", dictOffset, seekPos)
+	// Entities are appended at the end of the data section, so the
+	// calculated position is authoritative. Bytes past it are the dictionary
+	// and index of an earlier close, which this one replaces; writing after
+	// them would leave the dictionary past the file size in the header.
+	if seekPos != dictOffset {
+		if seekPos < dictOffset {
+			logger.Warn("File position mismatch: calculated=%d, seek=%d, using calculated position", dictOffset, seekPos)
+		}
 		if _, err := w.file.Seek(dictOffset, os.SEEK_SET); err != nil {
 			logger.Error("Failed to seek to calculated position: %v", err)
 			return err
 		}
-	} else {
-		dictOffset = seekPos // Positions match, use seek position
 	}
 	
 	logger.Debug("Writing tag dictionary at offset %d", dictOffset)
@@ -758,26 +772,18 @@ func (w *Writer) Close() error {
 	logger.Debug("Calculated index offset: %d (DictOffset: %d + DictSize: %d)", 
 		indexOffset, dictOffset, dictBuf.Len())
 	
-	// Verify this matches file seek position for consistency
-	seekPos, err = w.file.Seek(0, os.SEEK_END)
+	// The index directly follows the dictionary just written
+	seekPos, err = w.file.Seek(0, os.SEEK_CUR)
 	if err != nil {
 		logger.Error("Failed to get file position for index verification: %v", err)
 		return err
 	}
-	
-	// If there's a significant discrepancy, use calculated position
-	discrepancy = seekPos - indexOffset
-	if discrepancy < 0 {
-		discrepancy = -discrepancy
-	}
-	if discrepancy > 1024 { // Allow 1KB tolerance
+	if seekPos != indexOffset {
 		logger.Warn("Index position mismatch: calculated=%d, seek=%d, using calculated position", indexOffset, seekPos)
 		if _, err := w.file.Seek(indexOffset, os.SEEK_SET); err != nil {
 			logger.Error("Failed to seek to calculated index position: %v", err)
 			return err
 		}
-	} else {
-		indexOffset = seekPos // Positions match, use seek position
 	}
 	
 	logger.Debug("Writing index at offset %d with %d entries", indexOffset, len(w.index))
@@ -1235,6 +1241,19 @@ func (w *Writer) writeWALEntry(opType byte, entityID string, entity *models.Enti
 	// Format: [OpType:1][Sequence:8][Timestamp:8][EntityIDLen:2][EntityID][EntityDataLen:4][EntityData]
 	timestamp := time.Now().UnixNano()
 	
+	// Content is sealed first, so the op type can flag it
+	var content []byte
+	if entity != nil {
+		var sealed bool
+		var err error
+		if content, sealed, err = sealContent(entityID, entity.Content); err != nil {
+			return fmt.Errorf("failed to encrypt WAL content: %w", err)
+		}
+		if sealed {
+			opType |= walContentSealed
+		}
+	}
+	
 	entryBuf := new(bytes.Buffer)
 	binary.Write(entryBuf, binary.LittleEndian, opType)
 	binary.Write(entryBuf, binary.LittleEndian, w.walSequence)
@@ -1250,8 +1269,8 @@ func (w *Writer) writeWALEntry(opType byte, entityID string, entity *models.Enti
 			binary.Write(entityData, binary.LittleEndian, uint16(len(tag)))
 			entityData.WriteString(tag)
 		}
-		binary.Write(entityData, binary.LittleEndian, uint32(len(entity.Content)))
-		entityData.Write(entity.Content)
+		binary.Write(entityData, binary.LittleEndian, uint32(len(content)))
+		entityData.Write(content)
 		
 		binary.Write(entryBuf, binary.LittleEndian, uint32(entityData.Len()))
 		entryBuf.Write(entityData.Bytes())
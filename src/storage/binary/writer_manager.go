@@ -3,12 +3,17 @@ package binary
 import (
 	"entitydb/config"
 	"entitydb/models"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"entitydb/logger"
 )
 
+// errDataFileSync marks a checkpoint that failed before its appends were durable
+var errDataFileSync = errors.New("failed to sync data file")
+
 // WriterManager manages a single writer instance for thread-safe access
 type WriterManager struct {
 	mu              sync.Mutex
@@ -18,6 +23,12 @@ type WriterManager struct {
 	refCount        int
 	atomicFileManager *AtomicFileManager // Atomic file operations for corruption prevention
 	useAtomicOps    bool                 // Feature flag for atomic operations
+	pending         atomic.Int64         // Writes in progress or waiting for the writer
+	
+	// Appends hold appendMu shared; a commit holds it exclusively while it
+	// syncs and checkpoints, so the writer is not swapped under an append
+	appendMu        sync.RWMutex
+	group           *groupCommit // Coalesces the sync and checkpoint of concurrent writes
 }
 
 // NewWriterManager creates a new writer manager
@@ -28,6 +39,7 @@ func NewWriterManager(dataFile string, cfg *config.Config) *WriterManager {
 		atomicFileManager: NewAtomicFileManager(),
 		useAtomicOps:      true, // Default to enabled for corruption prevention
 	}
+	wm.group = newGroupCommit(wm.syncAndCheckpoint)
 	
 	// Start atomic file manager
 	if err := wm.atomicFileManager.Start(); err != nil {
@@ -68,66 +80,100 @@ func (wm *WriterManager) ReleaseWriter() {
 	}
 }
 
-// WriteEntity writes an entity using the managed writer and ensures it's persisted to disk
+// WriteEntity writes an entity using the managed writer and returns once it
+// is synced and checkpointed. Concurrent writes share one sync and
+// checkpoint (group commit).
 func (wm *WriterManager) WriteEntity(entity *models.Entity) error {
 	logger.Debug("WriterManager.WriteEntity called for entity %s", entity.ID)
+	wm.pending.Add(1)
+	defer wm.pending.Add(-1)
 	
+	wm.appendMu.RLock()
 	writer, err := wm.GetWriter()
 	if err != nil {
+		wm.appendMu.RUnlock()
 		logger.Error("Failed to get writer: %v", err)
 		return err
 	}
-	defer wm.ReleaseWriter()
-	
 	err = writer.WriteEntity(entity)
+	wm.ReleaseWriter()
 	if err != nil {
+		wm.appendMu.RUnlock()
 		logger.Error("Failed to write entity %s: %v", entity.ID, err)
 		return err
 	}
+	ticket := wm.group.ticket()
+	wm.appendMu.RUnlock()
 	
-	// Always sync file to disk immediately to ensure persistence
-	if err := writer.file.Sync(); err != nil {
+	if err := wm.group.wait(ticket); err != nil {
 		logger.Error("Failed to sync entity %s to disk: %v", entity.ID, err)
 		return fmt.Errorf("failed to sync entity to disk: %w", err)
 	}
 	
-	// Checkpoint after each write to ensure durability
-	logger.Debug("Starting checkpoint after write")
-	if err := wm.Checkpoint(); err != nil {
+	logger.Debug("WriterManager.WriteEntity completed for entity %s", entity.ID)
+	return nil
+}
+
+// syncAndCheckpoint is the group commit of the data file: one sync and
+// checkpoint covering every append made before it started
+func (wm *WriterManager) syncAndCheckpoint() error {
+	wm.appendMu.Lock()
+	defer wm.appendMu.Unlock()
+	
+	err := wm.checkpoint()
+	if errors.Is(err, errDataFileSync) {
+		return err
+	}
+	// The appends are durable; a failed header and index rewrite is
+	// repeated by the next checkpoint
+	if err != nil {
 		logger.Error("Failed to checkpoint after write: %v", err)
-		// Don't fail the write, just log the error
-	} else {
-		logger.Debug("Checkpoint completed successfully")
 	}
-	
-	logger.Debug("WriterManager.WriteEntity completed for entity %s", entity.ID)
 	return nil
 }
 
-// Flush immediately flushes all pending writes to disk
+// GroupCommitStats reports the writes committed and the syncs that
+// committed them
+func (wm *WriterManager) GroupCommitStats() GroupCommitStats {
+	return wm.group.stats()
+}
+
+// QueueDepth returns the number of writes in progress or waiting for the
+// writer
+func (wm *WriterManager) QueueDepth() int64 {
+	return wm.pending.Load()
+}
+
+// Flush makes every write made before the call durable. It joins the group
+// commit, so a flush concurrent with writes shares their sync.
 func (wm *WriterManager) Flush() error {
-	wm.mu.Lock()
-	defer wm.mu.Unlock()
-	
 	logger.Debug("WriterManager.Flush called")
+	return wm.group.commit()
+}
+
+// Checkpoint syncs the data file and rewrites its header and index now,
+// reporting a failed rewrite, which the group commit only logs
+func (wm *WriterManager) Checkpoint() error {
+	wm.appendMu.Lock()
+	defer wm.appendMu.Unlock()
+	return wm.checkpoint()
+}
+
+// Snapshot checkpoints the data file and copies it to path while appends
+// are held off, so the copy has a complete header and index
+func (wm *WriterManager) Snapshot(path string) error {
+	wm.appendMu.Lock()
+	defer wm.appendMu.Unlock()
 	
-	if wm.writer != nil {
-		logger.Debug("Flushing writer to disk")
-		if err := wm.writer.file.Sync(); err != nil {
-			logger.Error("Failed to sync file: %v", err)
-			return err
-		}
-		logger.Debug("Writer flushed successfully")
-		return nil
+	if err := wm.checkpoint(); err != nil {
+		return fmt.Errorf("checkpoint before snapshot: %w", err)
 	}
-	
-	logger.Debug("No writer exists, nothing to flush")
-	return nil
+	return copySyncedFile(wm.dataFile, path)
 }
 
-// Checkpoint performs a checkpoint operation with HeaderSync protection
+// checkpoint performs a checkpoint operation with HeaderSync protection
 // This implements a three-layer corruption prevention system
-func (wm *WriterManager) Checkpoint() error {
+func (wm *WriterManager) checkpoint() error {
 	wm.mu.Lock()
 	defer wm.mu.Unlock()
 	
@@ -144,7 +190,7 @@ func (wm *WriterManager) Checkpoint() error {
 		// Force a flush
 		if err := wm.writer.file.Sync(); err != nil {
 			logger.Error("Failed to sync file: %v", err)
-			return err
+			return fmt.Errorf("%w: %v", errDataFileSync, err)
 		}
 		logger.Debug("File synced")
 		
@@ -196,6 +242,12 @@ func (wm *WriterManager) WriteEntityAtomic(entity *models.Entity) error {
 	}
 	
 	logger.Debug("WriteEntityAtomic called for entity %s", entity.ID)
+	wm.pending.Add(1)
+	defer wm.pending.Add(-1)
+	
+	// The file is rebuilt from a snapshot, so no append may land meanwhile
+	wm.appendMu.Lock()
+	defer wm.appendMu.Unlock()
 	
 	// Get current file data
 	currentData, err := os.ReadFile(wm.dataFile)
@@ -281,6 +333,8 @@ func (wm *WriterManager) WriteEntityAtomic(entity *models.Entity) error {
 
 // Close closes the writer manager
 func (wm *WriterManager) Close() error {
+	wm.appendMu.Lock()
+	defer wm.appendMu.Unlock()
 	wm.mu.Lock()
 	defer wm.mu.Unlock()
 	
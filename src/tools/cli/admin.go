@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+
+	"entitydb/client"
+
+	"github.com/spf13/cobra"
+)
+
+func newReindexCommand() *cobra.Command {
+	var force, wait bool
+	cmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuild the server's indexes",
+		Long: "Queue an index rebuild. Reads stay available while it runs; with --wait\n" +
+			"the command returns when the rebuild finishes and fails if it did.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !wait {
+				return callAndPrint(cmd, http.MethodPost, "/admin/reindex", nil, map[string]bool{"force": force})
+			}
+			c, err := newAuthenticatedClient()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			jobID, err := c.Reindex(ctx, force)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "Reindex job %s queued\n", jobID)
+			status, err := waitForJob(ctx, func() (*client.JobStatus, error) {
+				return c.Job(ctx, jobID)
+			})
+			if err != nil {
+				return err
+			}
+			if err := printJSON(status); err != nil {
+				return err
+			}
+			return status.Err()
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Rebuild even if the indexes are healthy")
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait for the rebuild to finish")
+	return cmd
+}
+
+func newEncryptionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "encryption",
+		Short: "Inspect content encryption and re-encrypt after a key rotation",
+		Long: "Content encryption is configured on the server with a master key ring.\n" +
+			"To rotate keys: add a key with 'encryption generate-key', restart the server\n" +
+			"with it active, run 'encryption rekey --wait', then retire the old key.",
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "status",
+			Short: "Show whether content is encrypted and which keys are loaded",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return getAndPrint(cmd, "/admin/encryption", nil)
+			},
+		},
+		newEncryptionRekeyCommand(),
+		&cobra.Command{
+			Use:   "generate-key <key-id>",
+			Short: "Print a new master key line for the key ring file",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				key := make([]byte, 32)
+				if _, err := rand.Read(key); err != nil {
+					return err
+				}
+				fmt.Printf("%s %s\n", args[0], base64.StdEncoding.EncodeToString(key))
+				return nil
+			},
+		},
+	)
+	return cmd
+}
+
+func newEncryptionRekeyCommand() *cobra.Command {
+	var wait bool
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypt stored content with the active master key",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !wait {
+				return callAndPrint(cmd, http.MethodPost, "/admin/encryption/rekey", nil, nil)
+			}
+			c, err := newAuthenticatedClient()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			job, err := c.RekeyContent(ctx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "Re-encryption job %s queued\n", job.ID)
+			status, err := waitForJob(ctx, func() (*client.JobStatus, error) {
+				return c.Job(ctx, job.ID)
+			})
+			if err != nil {
+				return err
+			}
+			if err := printJSON(status); err != nil {
+				return err
+			}
+			return status.Err()
+		},
+	}
+	cmd.Flags().BoolVar(&wait, "wait", false, "Wait for the job to finish")
+	return cmd
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"entitydb/client"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newLoginCommand() *cobra.Command {
+	var username, password, totp, backupCode string
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Log in and save the session token",
+		Long: "Log in with a username and password and save the token in ~/.entitydb/cli.json\n" +
+			"(or $ENTITYDB_CLI_CONFIG). The password is read from --password,\n" +
+			"$ENTITYDB_PASSWORD or the terminal.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if username == "" {
+				if username, err = prompt("Username: ", false); err != nil {
+					return err
+				}
+			}
+			if password == "" {
+				password = os.Getenv("ENTITYDB_PASSWORD")
+			}
+			if password == "" {
+				if password, err = prompt("Password: ", true); err != nil {
+					return err
+				}
+			}
+
+			ctx := cmd.Context()
+			login, err := c.Login(ctx, client.LoginRequest{
+				Username:   username,
+				Password:   password,
+				TOTPCode:   totp,
+				BackupCode: backupCode,
+			})
+			var apiErr *client.APIError
+			if errors.As(err, &apiErr) && apiErr.MFARequired && totp == "" && backupCode == "" {
+				return fmt.Errorf("%s is enrolled in two-factor authentication; pass --totp or --backup-code", username)
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := saveSession(session{
+				Server:    c.BaseURL(),
+				Token:     login.Token,
+				Username:  username,
+				ExpiresAt: login.ExpiresAt,
+			}); err != nil {
+				return fmt.Errorf("logged in but failed to save the session: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Logged in to %s as %s (session expires %s)\n",
+				c.BaseURL(), username, login.ExpiresAt.Local().Format(time.RFC1123))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&username, "username", "u", "", "Username")
+	cmd.Flags().StringVarP(&password, "password", "p", "", "Password")
+	cmd.Flags().StringVar(&totp, "totp", "", "Authenticator code, for users with two-factor authentication")
+	cmd.Flags().StringVar(&backupCode, "backup-code", "", "Backup code, instead of --totp")
+	return cmd
+}
+
+func newLogoutCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "End the session and forget the saved token",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if token, _ := c.Token(); token != "" {
+				// The token may already have expired; forget it either way
+				if err := c.Logout(cmd.Context()); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}
+			return removeSession()
+		},
+	}
+}
+
+func newWhoamiCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "whoami",
+		Short: "Show the logged-in user",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return getAndPrint(cmd, "/auth/whoami", nil)
+		},
+	}
+}
+
+// stdin is shared so consecutive prompts do not lose buffered input
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt reads a line from the terminal, without echo for secrets
+func prompt(label string, secret bool) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	if secret && term.IsTerminal(int(os.Stdin.Fd())) {
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(value), err
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no input for %s", strings.TrimSuffix(label, ": "))
+	}
+	return strings.TrimSpace(line), nil
+}
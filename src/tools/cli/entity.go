@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"entitydb/client"
+
+	"github.com/spf13/cobra"
+)
+
+func newEntityCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "entity",
+		Aliases: []string{"entities"},
+		Short:   "Create, read, update and delete entities",
+	}
+	cmd.AddCommand(
+		newEntityGetCommand(),
+		newEntityListCommand(),
+		newEntityQueryCommand(),
+		newEntityCreateCommand(),
+		newEntityUpdateCommand(),
+		newEntityDeleteCommand(),
+		newEntityRestoreCommand(),
+	)
+	return cmd
+}
+
+func newEntityGetCommand() *cobra.Command {
+	var content, timestamps bool
+	cmd := &cobra.Command{
+		Use:   "get <id>",
+		Short: "Show an entity",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{"id": {args[0]}}
+			query.Set("include_content", strconv.FormatBool(content))
+			if timestamps {
+				query.Set("include_timestamps", "true")
+			}
+			return getAndPrint(cmd, "/entities/get", query)
+		},
+	}
+	cmd.Flags().BoolVar(&content, "content", true, "Include the content")
+	cmd.Flags().BoolVar(&timestamps, "timestamps", false, "Show tag timestamps")
+	return cmd
+}
+
+func newEntityListCommand() *cobra.Command {
+	var tag, search, namespace string
+	var wildcard, timestamps bool
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List entities by tag, tag wildcard or namespace",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{}
+			if tag != "" {
+				query.Set("tag", tag)
+			}
+			if wildcard {
+				query.Set("wildcard", "true")
+			}
+			if search != "" {
+				query.Set("search", search)
+			}
+			if namespace != "" {
+				query.Set("namespace", namespace)
+			}
+			if timestamps {
+				query.Set("include_timestamps", "true")
+			}
+			return getAndPrint(cmd, "/entities/list", query)
+		},
+	}
+	cmd.Flags().StringVar(&tag, "tag", "", "Tag to match, e.g. type:note")
+	cmd.Flags().BoolVar(&wildcard, "wildcard", false, "Treat --tag as a pattern with * wildcards")
+	cmd.Flags().StringVar(&search, "search", "", "Search content")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Tag namespace, e.g. status")
+	cmd.Flags().BoolVar(&timestamps, "timestamps", false, "Show tag timestamps")
+	return cmd
+}
+
+// registerQueryFlags binds the parameters of /entities/query, shared with
+// export, to q
+func registerQueryFlags(cmd *cobra.Command, q *client.Query) {
+	flags := cmd.Flags()
+	flags.StringArrayVar(&q.Tags, "tag", nil, "Tag to match; repeat to require several")
+	flags.StringVar(&q.Dataset, "dataset", "", "Restrict results to a dataset")
+	flags.StringVar(&q.Filter, "filter", "", "Filter field, e.g. created_at or content.customer.country")
+	flags.StringVar(&q.Operator, "operator", "", "Filter operator: eq, ne, gt, lt, gte, lte, like, in, exists")
+	flags.StringVar(&q.Value, "value", "", "Filter value")
+	flags.StringVar(&q.Sort, "sort", "", "Sort field: created_at, updated_at, id, tag_count")
+	flags.StringVar(&q.Order, "order", "", "Sort order: asc or desc")
+	flags.IntVar(&q.Limit, "limit", 0, "Maximum results")
+	flags.IntVar(&q.Offset, "offset", 0, "Results to skip")
+}
+
+func newEntityQueryCommand() *cobra.Command {
+	var q client.Query
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Query entities with filters, sorting and paging",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return getAndPrint(cmd, "/entities/query", q.Values())
+		},
+	}
+	registerQueryFlags(cmd, &q)
+	return cmd
+}
+
+// contentFlags read entity content from the command line or a file
+type contentFlags struct {
+	content string
+	file    string
+	json    bool
+}
+
+func (c *contentFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&c.content, "content", "", "Content as text")
+	cmd.Flags().StringVar(&c.file, "content-file", "", "Read the content from a file, or - for stdin")
+	cmd.Flags().BoolVar(&c.json, "json", false, "Send the content as a JSON object or array instead of text")
+}
+
+// value returns the content for a create or update request, or nil
+func (c *contentFlags) value() (interface{}, error) {
+	data := []byte(c.content)
+	switch {
+	case c.file != "" && c.content != "":
+		return nil, fmt.Errorf("--content and --content-file are mutually exclusive")
+	case c.file == "-":
+		var err error
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, err
+		}
+	case c.file != "":
+		var err error
+		if data, err = os.ReadFile(c.file); err != nil {
+			return nil, err
+		}
+	case c.content == "":
+		return nil, nil
+	}
+
+	if !c.json {
+		return string(data), nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("content is not valid JSON: %w", err)
+	}
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return value, nil
+	}
+	return nil, fmt.Errorf("JSON content must be an object or an array")
+}
+
+func newEntityCreateCommand() *cobra.Command {
+	var tags []string
+	var content contentFlags
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an entity",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			value, err := content.value()
+			if err != nil {
+				return err
+			}
+			request := map[string]interface{}{"tags": tags}
+			if value != nil {
+				request["content"] = value
+			}
+			return callAndPrint(cmd, http.MethodPost, "/entities/create", nil, request)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&tags, "tag", "t", nil, "Tag to set; repeat for several")
+	content.register(cmd)
+	return cmd
+}
+
+func newEntityUpdateCommand() *cobra.Command {
+	var tags []string
+	var content contentFlags
+	cmd := &cobra.Command{
+		Use:   "update <id>",
+		Short: "Replace the tags and content of an entity",
+		Long: "Replace the tags and content of an entity. Tags not given are removed;\n" +
+			"use 'tag add' and 'tag remove' to change single tags.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			value, err := content.value()
+			if err != nil {
+				return err
+			}
+			request := map[string]interface{}{"id": args[0], "tags": tags}
+			if value != nil {
+				request["content"] = value
+			}
+			return callAndPrint(cmd, http.MethodPut, "/entities/update", nil, request)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&tags, "tag", "t", nil, "Tag to set; repeat for several")
+	content.register(cmd)
+	return cmd
+}
+
+func newEntityDeleteCommand() *cobra.Command {
+	var reason, policy string
+	cmd := &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Soft-delete an entity",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request := map[string]string{"reason": reason}
+			if policy != "" {
+				request["policy"] = policy
+			}
+			return callAndPrint(cmd, http.MethodPost, "/entities/"+url.PathEscape(args[0])+"/delete", nil, request)
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "Deleted with entitydb-cli", "Reason recorded with the deletion")
+	cmd.Flags().StringVar(&policy, "policy", "", "Retention policy to apply")
+	return cmd
+}
+
+func newEntityRestoreCommand() *cobra.Command {
+	var reason string
+	cmd := &cobra.Command{
+		Use:   "restore <id>",
+		Short: "Restore a soft-deleted entity",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request := map[string]string{"reason": reason}
+			return callAndPrint(cmd, http.MethodPost, "/entities/"+url.PathEscape(args[0])+"/restore", nil, request)
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "Restored with entitydb-cli", "Reason recorded with the restore")
+	return cmd
+}
+
+func newTagCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tag",
+		Short: "Add or remove tags on an entity",
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "add <id> <tag>...",
+			Short: "Add tags to an entity",
+			Args:  cobra.MinimumNArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return patchTags(cmd, args[0], args[1:], nil)
+			},
+		},
+		&cobra.Command{
+			Use:   "remove <id> <tag>...",
+			Short: "Remove tags from an entity",
+			Args:  cobra.MinimumNArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return patchTags(cmd, args[0], nil, args[1:])
+			},
+		},
+	)
+	return cmd
+}
+
+func patchTags(cmd *cobra.Command, id string, add, remove []string) error {
+	request := map[string]interface{}{"id": id, "add_tags": add, "remove_tags": remove}
+	return callAndPrint(cmd, http.MethodPatch, "/entities/patch-tags", nil, request)
+}
+
+// getAndPrint fetches path and prints the response
+func getAndPrint(cmd *cobra.Command, path string, query url.Values) error {
+	return callAndPrint(cmd, http.MethodGet, path, query, nil)
+}
+
+// callAndPrint sends a request and prints the response as received
+func callAndPrint(cmd *cobra.Command, method, path string, query url.Values, body interface{}) error {
+	c, err := newAuthenticatedClient()
+	if err != nil {
+		return err
+	}
+	var response json.RawMessage
+	if err := c.Do(cmd.Context(), method, path, query, body, &response); err != nil {
+		return err
+	}
+	return printJSON(response)
+}
@@ -0,0 +1,145 @@
+// Command entitydb-cli administers an EntityDB server over its REST API.
+//
+// It covers login, entity CRUD, tag operations, temporal queries,
+// export/import, user management and reindexing, printing JSON so it can
+// be used from scripts. Requests go through the entitydb/client package,
+// which refreshes the session and retries transient failures:
+//
+//	entitydb-cli login -u admin
+//	entitydb-cli entity create --tag type:note --content "hello"
+//	entitydb-cli entity list --tag type:note
+//	entitydb-cli history <id>
+//	entitydb-cli export --tag type:note -o notes.jsonl
+//
+// The server and token come from --server/--token, then ENTITYDB_URL and
+// ENTITYDB_TOKEN, then the session saved by login.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"entitydb/client"
+
+	"github.com/spf13/cobra"
+)
+
+// Version is set at build time
+var Version = "dev"
+
+// globalOptions holds the flags shared by every command
+type globalOptions struct {
+	server   string
+	token    string
+	insecure bool
+	timeout  int
+}
+
+var options globalOptions
+
+func main() {
+	// Interrupting cancels the request in flight, including retries
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := newRootCommand().ExecuteContext(ctx); err != nil {
+		stop()
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:          "entitydb-cli",
+		Short:        "Administer an EntityDB server from the command line",
+		Version:      Version,
+		SilenceUsage: true,
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&options.server, "server", "", "Server URL (env ENTITYDB_URL, default "+defaultServer+")")
+	flags.StringVar(&options.token, "token", "", "Session token (env ENTITYDB_TOKEN, default from login)")
+	flags.BoolVar(&options.insecure, "insecure", false, "Skip TLS certificate verification")
+	flags.IntVar(&options.timeout, "timeout", 60, "Request timeout in seconds")
+
+	root.AddCommand(
+		newLoginCommand(),
+		newLogoutCommand(),
+		newWhoamiCommand(),
+		newEntityCommand(),
+		newTagCommand(),
+		newHistoryCommand(),
+		newAsOfCommand(),
+		newDiffCommand(),
+		newChangesCommand(),
+		newExportCommand(),
+		newImportCommand(),
+		newUserCommand(),
+		newReindexCommand(),
+		newEncryptionCommand(),
+	)
+	return root
+}
+
+// newClient builds a client from the flags, environment and saved session.
+// A saved session is updated whenever the client refreshes its token.
+func newClient() (*client.Client, error) {
+	saved, err := loadSession()
+	if err != nil {
+		return nil, err
+	}
+
+	server := strings.TrimRight(firstNonEmpty(options.server, os.Getenv("ENTITYDB_URL"), saved.Server, defaultServer), "/")
+	config := client.Config{
+		BaseURL:    server,
+		Token:      firstNonEmpty(options.token, os.Getenv("ENTITYDB_TOKEN")),
+		HTTPClient: newHTTPClient(),
+	}
+	// A saved token only belongs to the server it was issued by
+	if config.Token == "" && saved.Server == server {
+		config.Token = saved.Token
+		config.ExpiresAt = saved.ExpiresAt
+		config.OnTokenRefresh = func(token string, expiresAt time.Time) {
+			saved.Token, saved.ExpiresAt = token, expiresAt
+			if err := saveSession(saved); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save the refreshed session: %v\n", err)
+			}
+		}
+	}
+	return client.New(config)
+}
+
+// newAuthenticatedClient is newClient for commands that need a token
+func newAuthenticatedClient() (*client.Client, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	if token, _ := c.Token(); token == "" {
+		return nil, fmt.Errorf("not logged in to %s; run entitydb-cli login or set ENTITYDB_TOKEN", c.BaseURL())
+	}
+	return c, nil
+}
+
+// newHTTPClient applies --insecure and --timeout
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options.insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: transport, Timeout: time.Duration(options.timeout) * time.Second}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
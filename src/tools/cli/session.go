@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultServer = "http://localhost:8085"
+
+// session is what login saves between invocations
+type session struct {
+	Server    string    `json:"server"`
+	Token     string    `json:"token"`
+	Username  string    `json:"username,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// sessionPath is $ENTITYDB_CLI_CONFIG or ~/.entitydb/cli.json
+func sessionPath() (string, error) {
+	if path := os.Getenv("ENTITYDB_CLI_CONFIG"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate the session file: %w", err)
+	}
+	return filepath.Join(home, ".entitydb", "cli.json"), nil
+}
+
+// loadSession returns the saved session, or an empty one
+func loadSession() (session, error) {
+	var s session
+	path, err := sessionPath()
+	if err != nil {
+		return s, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("invalid session file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// saveSession writes the session readable by the current user only
+func saveSession(s session) error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// removeSession deletes the saved session
+func removeSession() error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// printJSON writes a response to stdout, indented
+func printJSON(v interface{}) error {
+	if raw, ok := v.(json.RawMessage); ok {
+		var indented bytes.Buffer
+		if json.Indent(&indented, raw, "", "  ") == nil {
+			indented.WriteByte('\n')
+			_, err := os.Stdout.Write(indented.Bytes())
+			return err
+		}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCommand() *cobra.Command {
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "history <id>",
+		Short: "Show the tag changes of an entity, newest first",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{"id": {args[0]}}
+			if limit > 0 {
+				query.Set("limit", strconv.Itoa(limit))
+			}
+			return getAndPrint(cmd, "/entities/history", query)
+		},
+	}
+	cmd.Flags().IntVar(&limit, "limit", 0, "Maximum changes to show")
+	return cmd
+}
+
+func newAsOfCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "as-of <id> <time>",
+		Short: "Show an entity as it was at a point in time",
+		Long:  "Show an entity as it was at a point in time, given as RFC3339 (2025-01-02T15:04:05Z).",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return getAndPrint(cmd, "/entities/as-of", url.Values{"id": {args[0]}, "as_of": {args[1]}})
+		},
+	}
+}
+
+func newDiffCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff <id> <from> <to>",
+		Short: "Show the tags added and removed between two points in time",
+		Long:  "Show the tags added and removed between two points in time, given as RFC3339.",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return getAndPrint(cmd, "/entities/diff", url.Values{"id": {args[0]}, "from": {args[1]}, "to": {args[2]}})
+		},
+	}
+}
+
+func newChangesCommand() *cobra.Command {
+	var id string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "changes",
+		Short: "Show recent changes across entities",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{}
+			if id != "" {
+				query.Set("id", id)
+			}
+			if limit > 0 {
+				query.Set("limit", strconv.Itoa(limit))
+			}
+			return getAndPrint(cmd, "/entities/changes", query)
+		},
+	}
+	cmd.Flags().StringVar(&id, "id", "", "Only show changes of this entity")
+	cmd.Flags().IntVar(&limit, "limit", 0, "Maximum changes to show")
+	return cmd
+}
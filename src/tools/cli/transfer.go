@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"entitydb/client"
+
+	"github.com/spf13/cobra"
+)
+
+// waitForJob polls a job every half second until it finishes, reporting
+// progress on stderr, and returns its final status
+func waitForJob(ctx context.Context, poll func() (*client.JobStatus, error)) (*client.JobStatus, error) {
+	reported := false
+	for {
+		status, err := poll()
+		if err != nil {
+			return nil, err
+		}
+		if status.Finished() {
+			if reported {
+				fmt.Fprintln(os.Stderr)
+			}
+			return status, nil
+		}
+		if status.Total > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s: %d/%d", status.Status, status.Processed, status.Total)
+			reported = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func newExportCommand() *cobra.Command {
+	var q client.Query
+	var format, output string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the entities matching a query to a JSONL or CSV file",
+		Long: "Start an export job on the server, wait for it and download the file.\n" +
+			"JSONL exports can be loaded into another server with 'entitydb-cli import'.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newAuthenticatedClient()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			started, err := c.StartExport(ctx, q, format)
+			if err != nil {
+				return err
+			}
+			status := started
+			_, err = waitForJob(ctx, func() (*client.JobStatus, error) {
+				if status, err = c.Export(ctx, started.ID); err != nil {
+					return nil, err
+				}
+				return &status.JobStatus, nil
+			})
+			if err != nil {
+				return err
+			}
+			if err := status.Err(); err != nil {
+				return err
+			}
+
+			body, err := c.DownloadExport(ctx, status.ID)
+			if err != nil {
+				return err
+			}
+			defer body.Close()
+
+			out := os.Stdout
+			if output != "" && output != "-" {
+				if out, err = os.Create(output); err != nil {
+					return err
+				}
+				defer out.Close()
+			}
+			written, err := io.Copy(out, body)
+			if err != nil {
+				return err
+			}
+			if out != os.Stdout {
+				if err := out.Close(); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "Exported %d entities (%d bytes) to %s\n", status.Total, written, output)
+			}
+			return nil
+		},
+	}
+	registerQueryFlags(cmd, &q)
+	cmd.Flags().StringVar(&format, "format", "jsonl", "jsonl or csv")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write, default stdout")
+	return cmd
+}
+
+// exportedEntity is one line of a JSONL export
+type exportedEntity struct {
+	ID      string   `json:"id"`
+	Tags    []string `json:"tags"`
+	Content []byte   `json:"content"`
+}
+
+// Tags the server sets itself on create
+var generatedTagPrefixes = []string{"uuid:", "created_at:", "created_by:", "content:"}
+
+// importRequest turns an exported entity into a create request. Tags lose
+// their timestamps and the server assigns a new ID and creation tags, so
+// an import copies the current state, not the history.
+func importRequest(entity exportedEntity, dataset string) (client.CreateEntityRequest, error) {
+	seen := make(map[string]bool)
+	tags := make([]string, 0, len(entity.Tags))
+	for _, tag := range entity.Tags {
+		if _, plain, ok := strings.Cut(tag, "|"); ok {
+			tag = plain
+		}
+		generated := false
+		for _, prefix := range generatedTagPrefixes {
+			generated = generated || strings.HasPrefix(tag, prefix)
+		}
+		if dataset != "" && strings.HasPrefix(tag, "dataset:") {
+			generated = true
+		}
+		if generated || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if dataset != "" {
+		tags = append(tags, "dataset:"+dataset)
+	}
+
+	request := client.CreateEntityRequest{Tags: tags}
+	if len(entity.Content) == 0 {
+		return request, nil
+	}
+	var value interface{}
+	if json.Unmarshal(entity.Content, &value) == nil {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			request.Content = value
+			return request, nil
+		}
+	}
+	if !utf8.Valid(entity.Content) {
+		return request, fmt.Errorf("binary content cannot be imported; upload it with the chunked upload API")
+	}
+	request.Content = string(entity.Content)
+	return request, nil
+}
+
+func newImportCommand() *cobra.Command {
+	var dataset string
+	var stopOnError, verbose bool
+	var file client.ImportRequest
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Create entities from a JSONL export, or from a CSV, JSONL or SQLite file",
+		Long: "Create one entity per line of a JSONL export (or - for stdin). The server\n" +
+			"assigns new IDs; --verbose prints each old and new ID. Tags are imported\n" +
+			"without their history.\n\n" +
+			"With --format the file is uploaded and imported by the server instead:\n" +
+			"each CSV row, JSONL object or SQLite table row becomes an entity of --type,\n" +
+			"tagged from the columns named by --field. --dry-run validates every row\n" +
+			"without creating entities; failed rows are reported with their line.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newAuthenticatedClient()
+			if err != nil {
+				return err
+			}
+			if file.Format != "" {
+				file.Dataset = dataset
+				if stopOnError {
+					file.MaxErrors = 1
+				}
+				return importFile(cmd.Context(), c, file, args[0])
+			}
+
+			in := os.Stdin
+			if args[0] != "-" {
+				if in, err = os.Open(args[0]); err != nil {
+					return err
+				}
+				defer in.Close()
+			}
+
+			summary := struct {
+				Imported int      `json:"imported"`
+				Failed   int      `json:"failed"`
+				Errors   []string `json:"errors,omitempty"`
+			}{}
+			fail := func(line int, err error) error {
+				summary.Failed++
+				summary.Errors = append(summary.Errors, fmt.Sprintf("line %d: %v", line, err))
+				if stopOnError {
+					return fmt.Errorf("line %d: %w", line, err)
+				}
+				return nil
+			}
+
+			scanner := bufio.NewScanner(in)
+			scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+			line := 0
+			for scanner.Scan() {
+				line++
+				if strings.TrimSpace(scanner.Text()) == "" {
+					continue
+				}
+				var entity exportedEntity
+				if err := json.Unmarshal(scanner.Bytes(), &entity); err != nil {
+					if err := fail(line, err); err != nil {
+						return err
+					}
+					continue
+				}
+				request, err := importRequest(entity, dataset)
+				if err != nil {
+					if err := fail(line, err); err != nil {
+						return err
+					}
+					continue
+				}
+				created, err := c.CreateEntity(cmd.Context(), request)
+				if err != nil {
+					if err := fail(line, err); err != nil {
+						return err
+					}
+					continue
+				}
+				summary.Imported++
+				if verbose {
+					fmt.Fprintf(os.Stderr, "%s -> %s\n", entity.ID, created.ID)
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+
+			if err := printJSON(summary); err != nil {
+				return err
+			}
+			if summary.Failed > 0 {
+				return fmt.Errorf("%d of %d entities failed to import", summary.Failed, summary.Failed+summary.Imported)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dataset, "dataset", "", "Import into this dataset instead of the exported one")
+	cmd.Flags().BoolVar(&stopOnError, "stop-on-error", false, "Stop at the first entity that fails")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Print the old and new ID of each entity")
+	cmd.Flags().StringVar(&file.Format, "format", "", "Import a csv, jsonl or sqlite file on the server")
+	cmd.Flags().StringVar(&file.Type, "type", "", "Entity type of a --format import")
+	cmd.Flags().StringArrayVar(&file.Fields, "field", nil, "Tag from a field, as namespace=field or field (repeatable)")
+	cmd.Flags().StringArrayVar(&file.Tags, "tag", nil, "Tag added to every imported entity (repeatable)")
+	cmd.Flags().StringVar(&file.ContentField, "content-field", "", "Field stored as content, - for none (default: the whole record)")
+	cmd.Flags().StringVar(&file.Table, "table", "", "Table of a sqlite import")
+	cmd.Flags().StringVar(&file.Delimiter, "delimiter", "", "Field separator of a csv import")
+	cmd.Flags().BoolVar(&file.DryRun, "dry-run", false, "Validate a --format import without creating entities")
+	cmd.Flags().IntVar(&file.MaxErrors, "max-errors", 0, "Stop a --format import after this many failed rows")
+	return cmd
+}
+
+// importFile uploads a file for the server to import, waits for the job and
+// prints its result
+func importFile(ctx context.Context, c *client.Client, req client.ImportRequest, path string) error {
+	in := os.Stdin
+	if path != "-" {
+		var err error
+		if in, err = os.Open(path); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	started, err := c.StartImport(ctx, req, in)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Import job %s queued\n", started.ID)
+	status, err := waitForJob(ctx, func() (*client.JobStatus, error) {
+		return c.Job(ctx, started.ID)
+	})
+	if err != nil {
+		return err
+	}
+	if err := status.Err(); err != nil {
+		return err
+	}
+
+	var result struct {
+		Rows     int `json:"rows"`
+		Imported int `json:"imported"`
+		Failed   int `json:"failed"`
+	}
+	if err := json.Unmarshal(status.Result, &result); err != nil {
+		return fmt.Errorf("invalid import result: %w", err)
+	}
+	if err := printJSON(status.Result); err != nil {
+		return err
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("%d of %d rows failed to import", result.Failed, result.Rows)
+	}
+	return nil
+}
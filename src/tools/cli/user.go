@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+func newUserCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "user",
+		Aliases: []string{"users"},
+		Short:   "Manage users",
+	}
+	cmd.AddCommand(
+		newUserListCommand(),
+		newUserCreateCommand(),
+		newUserPasswdCommand(),
+		newUserResetPasswordCommand(),
+	)
+	return cmd
+}
+
+func newUserListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return getAndPrint(cmd, "/entities/list", url.Values{"tag": {"type:user"}, "include_content": {"false"}})
+		},
+	}
+}
+
+func newUserCreateCommand() *cobra.Command {
+	var password, email, fullName, role string
+	cmd := &cobra.Command{
+		Use:   "create <username>",
+		Short: "Create a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := passwordOrPrompt(password, "Password for "+args[0]+": ")
+			if err != nil {
+				return err
+			}
+			return callAndPrint(cmd, http.MethodPost, "/users/create", nil, map[string]string{
+				"username":  args[0],
+				"password":  password,
+				"email":     email,
+				"full_name": fullName,
+				"role":      role,
+			})
+		},
+	}
+	cmd.Flags().StringVarP(&password, "password", "p", "", "Password, prompted for when not given")
+	cmd.Flags().StringVar(&email, "email", "", "Email address")
+	cmd.Flags().StringVar(&fullName, "full-name", "", "Full name")
+	cmd.Flags().StringVar(&role, "role", "user", "Role: user or admin")
+	return cmd
+}
+
+func newUserPasswdCommand() *cobra.Command {
+	var current, next string
+	cmd := &cobra.Command{
+		Use:   "passwd [username]",
+		Short: "Change your own password",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			username := ""
+			if len(args) == 1 {
+				username = args[0]
+			} else if session, err := loadSession(); err == nil {
+				username = session.Username
+			}
+			if username == "" {
+				return fmt.Errorf("username required")
+			}
+			current, err := passwordOrPrompt(current, "Current password: ")
+			if err != nil {
+				return err
+			}
+			next, err := passwordOrPrompt(next, "New password: ")
+			if err != nil {
+				return err
+			}
+			return callAndPrint(cmd, http.MethodPost, "/users/change-password", nil, map[string]string{
+				"username":         username,
+				"current_password": current,
+				"new_password":     next,
+			})
+		},
+	}
+	cmd.Flags().StringVar(&current, "current", "", "Current password, prompted for when not given")
+	cmd.Flags().StringVar(&next, "new", "", "New password, prompted for when not given")
+	return cmd
+}
+
+func newUserResetPasswordCommand() *cobra.Command {
+	var password string
+	cmd := &cobra.Command{
+		Use:   "reset-password <username>",
+		Short: "Set another user's password (admin)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := passwordOrPrompt(password, "New password for "+args[0]+": ")
+			if err != nil {
+				return err
+			}
+			return callAndPrint(cmd, http.MethodPost, "/users/reset-password", nil, map[string]string{
+				"username": args[0],
+				"password": password,
+			})
+		},
+	}
+	cmd.Flags().StringVarP(&password, "password", "p", "", "New password, prompted for when not given")
+	return cmd
+}
+
+// passwordOrPrompt returns value, or asks for it without echo
+func passwordOrPrompt(value, label string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	value, err := prompt(label, true)
+	if err == nil && value == "" {
+		err = fmt.Errorf("password must not be empty")
+	}
+	return value, err
+}
@@ -0,0 +1,118 @@
+// Package tracing exports OpenTelemetry spans for EntityDB.
+//
+// When enabled, API requests start a server span (continuing a W3C
+// traceparent sent by the caller) and the storage layer records child spans
+// for the WAL write, index update, disk write and cache lookups of each
+// operation, exported over OTLP/HTTP. When disabled the global no-op
+// provider is left in place, so instrumented code costs next to nothing.
+package tracing
+
+import (
+	"context"
+	"entitydb/config"
+	"entitydb/logger"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Instrumentation scope of EntityDB's spans
+const instrumentationName = "entitydb"
+
+// ShutdownFunc flushes buffered spans and stops exporting
+type ShutdownFunc func(ctx context.Context) error
+
+// Configure installs the global tracer provider described by cfg. The
+// returned function flushes and stops the exporter; it does nothing when
+// tracing is disabled.
+func Configure(cfg *config.Config) (ShutdownFunc, error) {
+	// Propagate trace context even when not exporting, so proxies and
+	// clients keep their traces intact
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !cfg.TracingEnabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	endpoint, err := exportURL(cfg.OTLPEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	resource, err := sdkresource.Merge(sdkresource.Default(), sdkresource.NewSchemaless(
+		attribute.String("service.name", cfg.TracingServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	rate := cfg.TracingSampleRate
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("tracing sample rate %v outside 0-1", rate)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(rate))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("Trace export failed: %v", err)
+	}))
+
+	logger.Info("Tracing enabled: exporting %.0f%% of traces to %s", rate*100, endpoint)
+	return provider.Shutdown, nil
+}
+
+// exportURL resolves the configured endpoint to the traces URL
+func exportURL(endpoint string) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// Tracer returns EntityDB's tracer from the global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a child of the span in ctx. Without one it returns a
+// non-recording span, so background work such as checkpoints and metrics
+// collection does not start traces of its own.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}